@@ -32,11 +32,27 @@ import (
 	"github.com/abcxyz/abc-updater/pkg/updater"
 	"github.com/abcxyz/abc/internal/metricswrap"
 	"github.com/abcxyz/abc/internal/version"
+	"github.com/abcxyz/abc/templates/commands/adopt"
+	"github.com/abcxyz/abc/templates/commands/adoptionreport"
+	"github.com/abcxyz/abc/templates/commands/backups"
+	"github.com/abcxyz/abc/templates/commands/console"
 	"github.com/abcxyz/abc/templates/commands/describe"
+	"github.com/abcxyz/abc/templates/commands/gha"
 	"github.com/abcxyz/abc/templates/commands/goldentest"
+	"github.com/abcxyz/abc/templates/commands/lsp"
+	"github.com/abcxyz/abc/templates/commands/manifest"
+	"github.com/abcxyz/abc/templates/commands/migratespec"
+	"github.com/abcxyz/abc/templates/commands/pin"
 	"github.com/abcxyz/abc/templates/commands/render"
+	"github.com/abcxyz/abc/templates/commands/schema"
+	"github.com/abcxyz/abc/templates/commands/stacks"
+	"github.com/abcxyz/abc/templates/commands/status"
 	"github.com/abcxyz/abc/templates/commands/upgrade"
+	"github.com/abcxyz/abc/templates/commands/validate"
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/config"
+	"github.com/abcxyz/abc/templates/common/messages"
+	"github.com/abcxyz/abc/templates/common/telemetry"
 	"github.com/abcxyz/pkg/cli"
 	"github.com/abcxyz/pkg/logging"
 	"github.com/abcxyz/pkg/sets"
@@ -51,12 +67,38 @@ const (
 	// Shorter than default metrics timeout since nothing can be done in parallel
 	// due to it starting after program logic finishes.
 	runtimeMetricsTimeout = 200 * time.Millisecond
+
+	// How long to wait for OpenTelemetry metrics to be flushed on exit.
+	otelShutdownTimeout = 2 * time.Second
 )
 
 var templateCommands = map[string]cli.CommandFactory{
+	"adopt": func() cli.Command {
+		return &adopt.Command{}
+	},
+	"adoption-report": func() cli.Command {
+		return &adoptionreport.Command{}
+	},
+	"backups": func() cli.Command {
+		return &cli.RootCommand{
+			Name:        "backups",
+			Description: "subcommands for managing backups of files that were overwritten by renders",
+			Commands: map[string]cli.CommandFactory{
+				"prune": func() cli.Command {
+					return &backups.PruneCommand{}
+				},
+			},
+		}
+	},
+	"console": func() cli.Command {
+		return &console.Command{}
+	},
 	"describe": func() cli.Command {
 		return &describe.Command{}
 	},
+	"gha": func() cli.Command {
+		return &gha.Command{}
+	},
 	"golden-test": func() cli.Command {
 		return &cli.RootCommand{
 			Name:        "golden-test",
@@ -74,12 +116,58 @@ var templateCommands = map[string]cli.CommandFactory{
 			},
 		}
 	},
+	"lsp": func() cli.Command {
+		return &lsp.Command{}
+	},
+	"manifest": func() cli.Command {
+		return &cli.RootCommand{
+			Name:        "manifest",
+			Description: "subcommands for inspecting the manifests written by renders",
+			Commands: map[string]cli.CommandFactory{
+				"get": func() cli.Command {
+					return &manifest.GetCommand{}
+				},
+			},
+		}
+	},
+	"migrate-spec": func() cli.Command {
+		return &migratespec.Command{}
+	},
+	"pin": func() cli.Command {
+		return &pin.PinCommand{}
+	},
 	"render": func() cli.Command {
 		return &render.Command{}
 	},
+	"schema": func() cli.Command {
+		return &schema.Command{}
+	},
+	"stacks": func() cli.Command {
+		return &cli.RootCommand{
+			Name:        "stacks",
+			Description: "subcommands for rendering and upgrading sets of templates together",
+			Commands: map[string]cli.CommandFactory{
+				"render": func() cli.Command {
+					return &stacks.RenderCommand{}
+				},
+				"upgrade": func() cli.Command {
+					return &stacks.UpgradeCommand{}
+				},
+			},
+		}
+	},
+	"status": func() cli.Command {
+		return &status.Command{}
+	},
+	"unpin": func() cli.Command {
+		return &pin.UnpinCommand{}
+	},
 	"upgrade": func() cli.Command {
 		return &upgrade.Command{}
 	},
+	"validate": func() cli.Command {
+		return &validate.Command{}
+	},
 }
 
 // In the past, all template-related commands were under the "abc"
@@ -110,19 +198,33 @@ func main() {
 		syscall.SIGINT, syscall.SIGTERM)
 	defer done()
 
+	// Config files must be applied before anything reads the environment,
+	// since they can set the logging variables too.
+	if err := applyConfigFiles(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
 	setLogEnvVars()
 	ctx = logging.WithLogger(ctx, logging.NewFromEnv("ABC_"))
 
+	catalog, err := messages.LoadFromEnv(os.LookupEnv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	ctx = messages.WithCatalog(ctx, catalog)
+
 	if err := realMain(ctx); err != nil {
 		done()
 
-		// On error, the exit code is 1 unless otherwise requested.
-		exitCode := 1
+		// The exit code depends on the category of the error, or is
+		// explicitly requested by an ExitCodeError. See common.ExitCodeOf.
+		exitCode := common.ExitCodeOf(err)
 
-		// In the special case where there's an ExitCodeErr, use that code.
+		// In the special case where there's an ExitCodeErr, don't print the
+		// "exit code" prefix.
 		var exitErr *common.ExitCodeError
 		if errors.As(err, &exitErr) {
-			exitCode = exitErr.Code
 			err = exitErr.Unwrap()
 		}
 
@@ -134,6 +236,18 @@ func main() {
 	}
 }
 
+// applyConfigFiles sets the environment variables that the user and repo
+// config files have defaults for, unless they're already set. Flags fall back
+// to their environment variables, so config files take effect for all flags
+// that have one.
+func applyConfigFiles() error {
+	cfg, err := config.LoadDefault()
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	return cfg.ApplyEnvDefaults(os.LookupEnv, os.Setenv) //nolint:wrapcheck
+}
+
 func setLogEnvVars() {
 	if os.Getenv("ABC_LOG_FORMAT") == "" {
 		os.Setenv("ABC_LOG_FORMAT", string(defaultLogFormat))
@@ -192,6 +306,9 @@ func realMain(ctx context.Context) error {
 	cleanup := metricswrap.WriteMetric(ctx, mClient, "runs", 1)
 	defer cleanup()
 
+	ctx, shutdownTelemetry := setupTelemetry(ctx)
+	defer shutdownTelemetry()
+
 	// This will cause a synchronous metrics call.
 	defer func() {
 		runtimeCtx, closer := context.WithTimeout(ctx, runtimeMetricsTimeout)
@@ -203,6 +320,32 @@ func realMain(ctx context.Context) error {
 	return rootCmd().Run(ctx, os.Args[1:]) //nolint:wrapcheck
 }
 
+// setupTelemetry enables the OpenTelemetry exporter for render and upgrade
+// metrics if the user opted in by setting ABC_OTEL_METRICS. The returned
+// function flushes any metrics that haven't been sent yet.
+func setupTelemetry(ctx context.Context) (context.Context, func()) {
+	logger := logging.FromContext(ctx)
+
+	enabled, _ := strconv.ParseBool(os.Getenv("ABC_OTEL_METRICS"))
+	if !enabled {
+		return ctx, func() {}
+	}
+
+	m, shutdown, err := telemetry.NewOTLPExporter(ctx, version.Name, version.Version)
+	if err != nil {
+		logger.WarnContext(ctx, "OpenTelemetry metrics are disabled", "error", err)
+		return ctx, func() {}
+	}
+
+	return telemetry.WithMetrics(ctx, m), func() {
+		shutdownCtx, done := context.WithTimeout(context.WithoutCancel(ctx), otelShutdownTimeout)
+		defer done()
+		if err := shutdown(shutdownCtx); err != nil {
+			logger.WarnContext(ctx, "failed flushing OpenTelemetry metrics", "error", err)
+		}
+	}
+}
+
 func checkSupportedOS() error {
 	switch runtime.GOOS {
 	case "windows":
@@ -21,6 +21,7 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 
+	"github.com/abcxyz/abc/templates/common"
 	"github.com/abcxyz/pkg/testutil"
 )
 
@@ -31,8 +32,12 @@ func TestRootCmd(t *testing.T) {
 		name       string
 		args       []string
 		wantStdout string
-		wantStderr string
-		wantErr    string
+		// If true, then stdout must be empty, rather than just containing
+		// wantStdout.
+		wantNoStdout bool
+		wantStderr   string
+		wantErr      string
+		wantExitCode int
 	}{
 		{
 			name:       "render_prints_to_stdout",
@@ -45,9 +50,33 @@ func TestRootCmd(t *testing.T) {
 			wantStdout: "Hello, Bob!\n",
 		},
 		{
-			name:    "error_return",
-			args:    []string{"render", "nonexistent/dir"},
-			wantErr: "isn't a valid template name",
+			name:         "quiet_suppresses_print",
+			args:         []string{"render", "--skip-manifest", "--quiet", "--input=person_name=Bob", "../../examples/templates/render/print"},
+			wantNoStdout: true,
+		},
+		{
+			name:         "quiet_and_verbose_are_exclusive",
+			args:         []string{"render", "--skip-manifest", "--quiet", "--verbose", "--input=person_name=Bob", "../../examples/templates/render/print"},
+			wantErr:      "--quiet and --verbose are mutually exclusive",
+			wantExitCode: common.ExitCodeGeneric,
+		},
+		{
+			name:         "invalid_log_format",
+			args:         []string{"render", "--skip-manifest", "--log-format=xml", "--input=person_name=Bob", "../../examples/templates/render/print"},
+			wantErr:      "invalid --log-format",
+			wantExitCode: common.ExitCodeGeneric,
+		},
+		{
+			name:         "error_return",
+			args:         []string{"render", "nonexistent/dir"},
+			wantErr:      "isn't a valid template name",
+			wantExitCode: common.ExitCodeGeneric,
+		},
+		{
+			name:         "unknown_input_exit_code",
+			args:         []string{"render", "--skip-manifest", "--input=person_name=Bob", "--input=nonexistent=foo", "../../examples/templates/render/print"},
+			wantErr:      "unknown input(s): nonexistent",
+			wantExitCode: common.ExitCodeInputValidation,
 		},
 		{
 			name:       "help_text",
@@ -55,9 +84,10 @@ func TestRootCmd(t *testing.T) {
 			wantStderr: "Usage: abc",
 		},
 		{
-			name:    "nonexistent_subcommand",
-			args:    []string{"nonexistent"},
-			wantErr: `unknown command "nonexistent": run "abc -help" for a list of commands`,
+			name:         "nonexistent_subcommand",
+			args:         []string{"nonexistent"},
+			wantErr:      `unknown command "nonexistent": run "abc -help" for a list of commands`,
+			wantExitCode: common.ExitCodeGeneric,
 		},
 	}
 
@@ -74,6 +104,12 @@ func TestRootCmd(t *testing.T) {
 			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
 				t.Error(diff)
 			}
+			if got := common.ExitCodeOf(err); got != tc.wantExitCode {
+				t.Errorf("got exit code %d, want %d", got, tc.wantExitCode)
+			}
+			if tc.wantNoStdout && stdout.Len() > 0 {
+				t.Errorf("got stdout %q, but wanted no stdout", stdout.String())
+			}
 			if !strings.Contains(stdout.String(), tc.wantStdout) {
 				t.Errorf("stdout was not as expected (-got,+want):\n%s", cmp.Diff(stdout.String(), tc.wantStdout))
 			}
@@ -0,0 +1,56 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package abc is the Go API for embedding abc in other programs, like internal
+// developer portals. It covers rendering, upgrading, and describing templates,
+// and listing template versions.
+//
+// Unlike the packages under templates/, which may change in any release, this
+// package follows semantic versioning: new fields and functions may be added
+// in minor releases, but nothing is removed or changes meaning until the next
+// major version. Options are passed in structs whose zero values are the
+// defaults, so that adding a field never breaks callers.
+//
+// These functions never prompt. Template inputs that have no value and no
+// default cause an error, just like running the CLI with --prompt=false.
+// Logs go to the logger in the context (see github.com/abcxyz/pkg/logging).
+package abc
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// absPath makes path absolute, resolving it against the working directory.
+func absPath(path string) (string, error) {
+	if filepath.IsAbs(path) {
+		return path, nil
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get working directory: %w", err)
+	}
+	return filepath.Join(wd, path), nil
+}
+
+// stdoutOrDiscard returns w, or io.Discard if w is nil, since an embedding
+// program usually doesn't want template output on its own stdout.
+func stdoutOrDiscard(w io.Writer) io.Writer {
+	if w == nil {
+		return io.Discard
+	}
+	return w
+}
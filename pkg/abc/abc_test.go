@@ -0,0 +1,260 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+const greetSpec = `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'a greeting'
+inputs:
+  - name: 'person'
+    desc: 'who to greet'
+    default: 'world'
+    rules:
+      - rule: 'size(person) > 0'
+        message: 'must not be empty'
+  - name: 'punctuation'
+    desc: 'how to end'
+steps:
+  - desc: 'include greet.txt'
+    action: 'include'
+    params:
+      paths: ['greet.txt']
+  - desc: 'fill in the greeting'
+    action: 'go_template'
+    params:
+      paths: ['greet.txt']
+`
+
+func TestRenderDescribeUpgrade(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+
+	tempBase := t.TempDir()
+	templateDir := filepath.Join(tempBase, "template_dir")
+	destDir := filepath.Join(tempBase, "dest_dir")
+	abctestutil.WriteAll(t, tempBase, abctestutil.WithGitRepoAt("", nil))
+	abctestutil.WriteAll(t, templateDir, map[string]string{
+		"spec.yaml": greetSpec,
+		"greet.txt": "hello, {{.person}}{{.punctuation}}\n",
+	})
+
+	desc, err := Describe(ctx, &DescribeOptions{Source: templateDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	world := "world"
+	wantDesc := &Description{
+		Desc: "a greeting",
+		Inputs: []*Input{
+			{
+				Name:    "person",
+				Desc:    "who to greet",
+				Default: &world,
+				Rules:   []*Rule{{Rule: "size(person) > 0", Message: "must not be empty"}},
+			},
+			{
+				Name: "punctuation",
+				Desc: "how to end",
+			},
+		},
+	}
+	if diff := cmp.Diff(desc, wantDesc); diff != "" {
+		t.Errorf("Describe() was not as expected (-got,+want): %s", diff)
+	}
+
+	// "punctuation" has no default, so it's required.
+	_, err = Render(ctx, &RenderOptions{
+		Source:         templateDir,
+		Dest:           destDir,
+		AcceptDefaults: true,
+	})
+	if diff := testutil.DiffErrString(err, "punctuation"); diff != "" {
+		t.Fatal(diff)
+	}
+
+	renderResult, err := Render(ctx, &RenderOptions{
+		Source:         templateDir,
+		Dest:           destDir,
+		Inputs:         map[string]string{"punctuation": "!"},
+		AcceptDefaults: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renderResult.ManifestPath == "" {
+		t.Errorf("got no manifest path, want one")
+	}
+	assertFile(t, filepath.Join(destDir, "greet.txt"), "hello, world!\n")
+
+	upgradeResult, err := Upgrade(ctx, &UpgradeOptions{Location: destDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upgradeResult.Result != UpgradeAlreadyUpToDate {
+		t.Errorf("got upgrade result %q, want %q", upgradeResult.Result, UpgradeAlreadyUpToDate)
+	}
+
+	abctestutil.WriteAll(t, templateDir, map[string]string{
+		"greet.txt": "goodbye, {{.person}}{{.punctuation}}\n",
+	})
+	upgradeResult, err = Upgrade(ctx, &UpgradeOptions{Location: destDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantUpgrade := &UpgradeResult{
+		Result: UpgradeSuccess,
+		Installations: []*UpgradedInstallation{
+			{
+				ManifestPath: filepath.Join(destDir, renderResult.ManifestPath),
+				Result:       UpgradeSuccess,
+				ChangedFiles: []string{filepath.Join(destDir, "greet.txt")},
+			},
+		},
+	}
+	if diff := cmp.Diff(upgradeResult, wantUpgrade, cmp.FilterPath(func(p cmp.Path) bool {
+		return p.Last().String() == ".Version"
+	}, cmp.Ignore())); diff != "" {
+		t.Errorf("Upgrade() was not as expected (-got,+want): %s", diff)
+	}
+	assertFile(t, filepath.Join(destDir, "greet.txt"), "goodbye, world!\n")
+}
+
+func TestRenderFS(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	tmpl := fstest.MapFS{
+		"greet/spec.yaml": &fstest.MapFile{Data: []byte(greetSpec)},
+		"greet/greet.txt": &fstest.MapFile{Data: []byte("hello, {{.person}}{{.punctuation}}\n")},
+	}
+
+	result, err := RenderFS(ctx, &RenderFSOptions{
+		Template:       tmpl,
+		TemplateDir:    "greet",
+		Version:        "v1.0.0",
+		Existing:       map[string][]byte{"greet.txt": []byte("old\n"), "other/file.txt": []byte("other\n")},
+		Inputs:         map[string]string{"punctuation": "!"},
+		AcceptDefaults: true,
+		ForceOverwrite: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := result.Files[result.ManifestPath]; !ok || result.ManifestPath == "" {
+		t.Errorf("the manifest %q wasn't among the files", result.ManifestPath)
+	}
+	delete(result.Files, result.ManifestPath)
+	want := map[string][]byte{
+		"greet.txt":      []byte("hello, world!\n"),
+		"other/file.txt": []byte("other\n"),
+	}
+	if diff := cmp.Diff(result.Files, want); diff != "" {
+		t.Errorf("files were not as expected (-got,+want): %s", diff)
+	}
+}
+
+func TestRenderFS_BufGenerate(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	tmpl := fstest.MapFS{
+		"spec.yaml": &fstest.MapFile{Data: []byte(`api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'generates code'
+steps:
+  - desc: 'include the protos'
+    action: 'include'
+    params:
+      paths: ['api.proto']
+  - desc: 'generate code'
+    action: 'buf_generate'
+    params: {}
+`)},
+		"api.proto": &fstest.MapFile{Data: []byte(`syntax = "proto3";`)},
+	}
+
+	_, err := RenderFS(ctx, &RenderFSOptions{Template: tmpl})
+	if diff := testutil.DiffErrString(err, "the buf_generate action can't be used when rendering to memory"); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestRequiredOptions(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	_, err := Render(ctx, &RenderOptions{Dest: "foo"})
+	if diff := testutil.DiffErrString(err, "RenderOptions.Source is required"); diff != "" {
+		t.Error(diff)
+	}
+	_, err = Render(ctx, &RenderOptions{Source: "foo"})
+	if diff := testutil.DiffErrString(err, "RenderOptions.Dest is required"); diff != "" {
+		t.Error(diff)
+	}
+	_, err = Upgrade(ctx, &UpgradeOptions{})
+	if diff := testutil.DiffErrString(err, "UpgradeOptions.Location is required"); diff != "" {
+		t.Error(diff)
+	}
+	_, err = Describe(ctx, &DescribeOptions{})
+	if diff := testutil.DiffErrString(err, "DescribeOptions.Source is required"); diff != "" {
+		t.Error(diff)
+	}
+	_, err = RenderFS(ctx, &RenderFSOptions{})
+	if diff := testutil.DiffErrString(err, "RenderFSOptions.Template is required"); diff != "" {
+		t.Error(diff)
+	}
+	_, err = ListVersions(ctx, &ListVersionsOptions{})
+	if diff := testutil.DiffErrString(err, "ListVersionsOptions.Source is required"); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestListVersions_Local(t *testing.T) {
+	t.Parallel()
+
+	_, err := ListVersions(context.Background(), &ListVersionsOptions{Source: t.TempDir()})
+	if diff := testutil.DiffErrString(err, "isn't a remote git repo"); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func assertFile(tb testing.TB, path, want string) {
+	tb.Helper()
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if string(got) != want {
+		tb.Errorf("%s contents = %q, want %q", path, got, want)
+	}
+}
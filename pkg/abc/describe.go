@@ -0,0 +1,135 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abc
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/registry"
+	"github.com/abcxyz/abc/templates/common/specutil"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
+)
+
+// DescribeOptions are the options for Describe.
+type DescribeOptions struct {
+	// The template location, in any form accepted by RenderOptions.Source.
+	// Required.
+	Source string
+
+	// "https" or "ssh". The default is "https".
+	GitProtocol string
+}
+
+// Description is what a template says about itself in its spec file.
+type Description struct {
+	Desc   string
+	Inputs []*Input
+
+	// CEL rules that check the combination of all inputs.
+	Rules []*Rule
+}
+
+// Input is one template input.
+type Input struct {
+	Name string
+	Desc string
+
+	// Nil if the input has no default, which means it's required.
+	Default *string
+
+	Rules []*Rule
+}
+
+// Rule is a CEL expression that an input value must satisfy.
+type Rule struct {
+	Rule string
+
+	// The optional explanation shown when the rule fails.
+	Message string
+}
+
+// Describe downloads a template and returns its description and inputs, like
+// "abc describe".
+func Describe(ctx context.Context, opts *DescribeOptions) (_ *Description, rErr error) {
+	if opts.Source == "" {
+		return nil, fmt.Errorf("DescribeOptions.Source is required")
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+
+	fs := &common.RealFS{}
+	tempTracker := tempdir.NewDirTracker(fs, false)
+	defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
+	templateDir, err := tempTracker.MkdirTempTracked("", tempdir.TemplateDirNamePart)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	source, err := registry.ResolveSource(wd, opts.Source)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	downloader, err := templatesource.ParseSource(ctx, &templatesource.ParseSourceParams{
+		CWD:             wd,
+		Source:          source,
+		FlagGitProtocol: opts.GitProtocol,
+	})
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	if _, err := downloader.Download(ctx, wd, templateDir, ""); err != nil {
+		return nil, fmt.Errorf("failed to download/copy template: %w", err)
+	}
+
+	s, err := specutil.Load(ctx, fs, templateDir, opts.Source)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	return newDescription(s), nil
+}
+
+func newDescription(s *spec.Spec) *Description {
+	out := &Description{
+		Desc:  s.Desc.Val,
+		Rules: newRules(s.Rules),
+	}
+	for _, in := range s.Inputs {
+		input := &Input{
+			Name:  in.Name.Val,
+			Desc:  in.Desc.Val,
+			Rules: newRules(in.Rules),
+		}
+		if in.Default != nil {
+			input.Default = &in.Default.Val
+		}
+		out.Inputs = append(out.Inputs, input)
+	}
+	return out
+}
+
+func newRules(rules []*spec.Rule) []*Rule {
+	var out []*Rule
+	for _, r := range rules {
+		out = append(out, &Rule{Rule: r.Rule.Val, Message: r.Message.Val})
+	}
+	return out
+}
@@ -0,0 +1,177 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/benbjohnson/clock"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/backups"
+	"github.com/abcxyz/abc/templates/common/registry"
+	"github.com/abcxyz/abc/templates/common/render"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+)
+
+// RenderOptions are the options for Render. They mean the same as the "abc
+// render" flags with similar names.
+type RenderOptions struct {
+	// The template location, like "github.com/abcxyz/abc/t/rest_server@latest",
+	// a local directory, or an alias from the registry file. Required.
+	Source string
+
+	// The directory to write the output to. Relative paths are resolved
+	// against the working directory. Required.
+	Dest string
+
+	// Template input values, by input name.
+	Inputs map[string]string
+
+	// Paths to YAML files of template input values. Values in Inputs take
+	// precedence.
+	InputFiles []string
+
+	// Use the default value for any input that isn't given, instead of
+	// failing.
+	AcceptDefaults bool
+
+	// Overwrite files in Dest that already exist. The old versions are backed
+	// up as they would be by the CLI.
+	ForceOverwrite bool
+
+	// Don't write a manifest, which means the output can't be upgraded later.
+	SkipManifest bool
+
+	// Skip running the validation rules of the template's inputs.
+	SkipInputValidation bool
+
+	// Allow the template's buf_generate actions, which run the buf CLI outside
+	// of abc's sandbox. Only set this for templates you trust.
+	AllowBufGenerate bool
+
+	// "https" or "ssh". The default is "https".
+	GitProtocol string
+
+	// The branch or "latest" to record in the manifest for future upgrades.
+	// The default is inferred from the version in Source.
+	UpgradeChannel string
+
+	// Where the output of "print" actions goes. The default is to discard it.
+	Stdout io.Writer
+}
+
+// RenderResult describes a completed render.
+type RenderResult struct {
+	// The path of the manifest, relative to Dest, or empty if SkipManifest was
+	// set.
+	ManifestPath string
+
+	// The location that upgrades will download the template from, or empty
+	// if the template came from a non-canonical location like a temp dir.
+	CanonicalSource string
+
+	// The version of the template that was rendered, like "v1.2.3" or a git
+	// SHA.
+	Version string
+
+	// The upgrade channel recorded in the manifest.
+	UpgradeChannel string
+
+	// The values of the outputs declared by the template, keyed by output
+	// name.
+	Outputs map[string]string
+}
+
+// Render downloads a template and renders it into opts.Dest.
+func Render(ctx context.Context, opts *RenderOptions) (*RenderResult, error) {
+	if opts.Source == "" {
+		return nil, fmt.Errorf("RenderOptions.Source is required")
+	}
+	if opts.Dest == "" {
+		return nil, fmt.Errorf("RenderOptions.Dest is required")
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+	dest, err := absPath(opts.Dest)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := registry.ResolveSource(wd, opts.Source)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	downloader, err := templatesource.ParseSource(ctx, &templatesource.ParseSourceParams{
+		CWD:                   wd,
+		Source:                source,
+		FlagGitProtocol:       opts.GitProtocol,
+		FlagUpgradeChannel:    opts.UpgradeChannel,
+		RequireUpgradeChannel: !opts.SkipManifest,
+	})
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	backupRoot, err := backups.DefaultRoot()
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	clk := clock.New()
+
+	result, err := render.Render(ctx, &render.Params{
+		AcceptDefaults:      opts.AcceptDefaults,
+		AllowBufGenerate:    opts.AllowBufGenerate,
+		BackupDir:           backups.ParentDir(backupRoot, clk.Now()),
+		Backups:             true,
+		Clock:               clk,
+		Cwd:                 wd,
+		DestDir:             dest,
+		Downloader:          downloader,
+		ForceOverwrite:      opts.ForceOverwrite,
+		FS:                  &common.RealFS{},
+		GitProtocol:         opts.GitProtocol,
+		InputFiles:          opts.InputFiles,
+		InputsFromFlags:     opts.Inputs,
+		OutDir:              dest,
+		SkipInputValidation: opts.SkipInputValidation,
+		SkipManifest:        opts.SkipManifest,
+		SourceForMessages:   opts.Source,
+		Stdout:              stdoutOrDiscard(opts.Stdout),
+		UpgradeChannel:      opts.UpgradeChannel,
+	})
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	out := &RenderResult{
+		ManifestPath: result.ManifestPath,
+		Outputs:      result.Outputs,
+	}
+	if dl := result.DownloadMetadata; dl != nil {
+		if dl.IsCanonical {
+			out.CanonicalSource = dl.CanonicalSource
+		}
+		out.Version = dl.Version
+		out.UpgradeChannel = dl.UpgradeChannel
+	}
+	return out, nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/benbjohnson/clock"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/render"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+)
+
+// RenderFSOptions are the options for RenderFS.
+type RenderFSOptions struct {
+	// The template, like an embed.FS compiled into the program or an
+	// fstest.MapFS. Required.
+	Template fs.FS
+
+	// The slash-separated path of the template directory within Template,
+	// like "templates/hello". The default is the root of Template.
+	TemplateDir string
+
+	// The version to record in the manifest, since an fs.FS has none of its
+	// own. May be empty.
+	Version string
+
+	// Files that are already in the destination, keyed by slash-separated
+	// path. They're visible to "include" actions with "from: destination",
+	// and rendering over one fails unless ForceOverwrite is set.
+	Existing map[string][]byte
+
+	// Template input values, by input name.
+	Inputs map[string]string
+
+	// Use the default value for any input that isn't given, instead of
+	// failing.
+	AcceptDefaults bool
+
+	// Overwrite files in Existing. There are no backups.
+	ForceOverwrite bool
+
+	// Don't write a manifest.
+	SkipManifest bool
+
+	// Skip running the validation rules of the template's inputs.
+	SkipInputValidation bool
+
+	// Where the output of "print" actions goes. The default is to discard it.
+	Stdout io.Writer
+}
+
+// RenderFSResult describes a completed RenderFS.
+type RenderFSResult struct {
+	// Every file in the destination after rendering, keyed by slash-separated
+	// path, including the unchanged files from RenderFSOptions.Existing and
+	// the manifest under ".abc/".
+	Files map[string][]byte
+
+	// The path of the manifest, or empty if SkipManifest was set.
+	ManifestPath string
+
+	// The values of the outputs declared by the template, keyed by output
+	// name.
+	Outputs map[string]string
+}
+
+// RenderFS renders a template entirely in memory, without reading or writing
+// the local disk, which suits a web service that renders a template for each
+// request. Actions that need the local disk, like "wasm" and "buf_generate",
+// fail.
+func RenderFS(ctx context.Context, opts *RenderFSOptions) (*RenderFSResult, error) {
+	if opts.Template == nil {
+		return nil, fmt.Errorf("RenderFSOptions.Template is required")
+	}
+
+	root := string(filepath.Separator)
+	dest := filepath.Join(root, "dest")
+	mfs := &common.MemFS{}
+	if err := mfs.MkdirAll(dest, common.OwnerRWXPerms); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	for path, buf := range opts.Existing {
+		abs := filepath.Join(dest, filepath.FromSlash(path))
+		if err := mfs.MkdirAll(filepath.Dir(abs), common.OwnerRWXPerms); err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+		if err := mfs.WriteFile(abs, buf, common.OwnerRWPerms); err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+	}
+
+	result, err := render.Render(ctx, &render.Params{
+		AcceptDefaults: opts.AcceptDefaults,
+		Clock:          clock.New(),
+		Cwd:            root,
+		DestDir:        dest,
+		Downloader: &templatesource.FSDownloader{
+			Src:     opts.Template,
+			Dir:     opts.TemplateDir,
+			FS:      mfs,
+			Version: opts.Version,
+		},
+		ForceOverwrite:      opts.ForceOverwrite,
+		FS:                  mfs,
+		InputsFromFlags:     opts.Inputs,
+		OutDir:              dest,
+		SkipInputValidation: opts.SkipInputValidation,
+		SkipManifest:        opts.SkipManifest,
+		SourceForMessages:   "RenderFSOptions.Template",
+		Stdout:              stdoutOrDiscard(opts.Stdout),
+		TempDirBase:         filepath.Join(root, "tmp"),
+	})
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	files := make(map[string][]byte)
+	if err := fs.WalkDir(mfs, dest, func(path string, de fs.DirEntry, err error) error {
+		if err != nil || de.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dest, path)
+		if err != nil {
+			return fmt.Errorf("filepath.Rel(): %w", err)
+		}
+		buf, err := mfs.ReadFile(path)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		files[filepath.ToSlash(rel)] = buf
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed reading the rendered files: %w", err)
+	}
+
+	return &RenderFSResult{
+		Files:        files,
+		ManifestPath: filepath.ToSlash(result.ManifestPath),
+		Outputs:      result.Outputs,
+	}, nil
+}
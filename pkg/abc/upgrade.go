@@ -0,0 +1,219 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/benbjohnson/clock"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/upgrade"
+)
+
+// The possible values of UpgradeResult.Result and UpgradedInstallation.Result.
+const (
+	// The installation was already on the newest version of the template.
+	UpgradeAlreadyUpToDate = "already_up_to_date"
+
+	// The upgrade was done, and no user intervention is needed.
+	UpgradeSuccess = "success"
+
+	// The patches that reverse "include from destination" changes couldn't
+	// be applied cleanly; see UpgradedInstallation.Conflicts.
+	UpgradePatchReversalConflict = "patch_reversal_conflict"
+
+	// The new template output conflicted with local edits; see
+	// UpgradedInstallation.Conflicts.
+	UpgradeMergeConflict = "merge_conflict"
+)
+
+// UpgradeOptions are the options for Upgrade. They mean the same as the "abc
+// upgrade" flags with similar names.
+type UpgradeOptions struct {
+	// A manifest file, or a directory to search for manifests. Relative paths
+	// are resolved against the working directory. Required.
+	Location string
+
+	// Values for template inputs that are new in the upgraded template, by
+	// input name.
+	Inputs map[string]string
+
+	// Paths to YAML files of template input values. Values in Inputs take
+	// precedence.
+	InputFiles []string
+
+	// Use the default value for any new input that isn't given, instead of
+	// failing.
+	AcceptDefaults bool
+
+	// Skip running the validation rules of the template's inputs.
+	SkipInputValidation bool
+
+	// "https" or "ssh". The default is "https".
+	GitProtocol string
+
+	// Only upgrade the manifests whose paths match this glob.
+	ManifestFilter string
+
+	// Upgrade to the template at this location, instead of the one in each
+	// manifest.
+	TemplateLocation string
+
+	// The branch or "latest" to pull upgrades from, instead of the one in
+	// each manifest.
+	UpgradeChannel string
+
+	// The version to upgrade to, instead of the newest one on the upgrade
+	// channel.
+	Version string
+
+	// If a template is deprecated in favor of a replacement that its author
+	// declared compatible, upgrade to the replacement.
+	FollowReplacement bool
+
+	// Where the output of "print" actions goes. The default is to discard it.
+	Stdout io.Writer
+}
+
+// UpgradeResult describes a completed upgrade, which may have conflicts that
+// need to be resolved by hand. Conflicts aren't errors.
+type UpgradeResult struct {
+	// The most severe result of all the installations, in the order
+	// UpgradeAlreadyUpToDate, UpgradeSuccess, UpgradePatchReversalConflict,
+	// UpgradeMergeConflict.
+	Result string
+
+	// Each installation that was upgraded or found to be up to date. An
+	// installation may appear more than once if it was upgraded more than
+	// once, which happens when a template's output is itself a template.
+	Installations []*UpgradedInstallation
+}
+
+// UpgradedInstallation is the outcome for one manifest. All paths are
+// absolute.
+type UpgradedInstallation struct {
+	ManifestPath string
+
+	// One of the Upgrade* constants.
+	Result string
+
+	// The template version that the installation was upgraded to.
+	Version string
+
+	// The files that were written or deleted.
+	ChangedFiles []string
+
+	// The files that need manual conflict resolution.
+	Conflicts []*Conflict
+}
+
+// Conflict is a file that needs manual resolution after an upgrade.
+type Conflict struct {
+	Path string
+
+	// The kind of conflict, like "editEditConflict" or
+	// "patchReversalConflict".
+	Kind string
+
+	// Where the local version of the file was moved to, if it was.
+	LocalPath string
+
+	// Where the template's version of the file, or the rejected patch hunks,
+	// were written, if they were.
+	TemplatePath string
+}
+
+// Upgrade upgrades the template installations at opts.Location to a newer
+// version of their templates. It stops at the first conflict, like "abc
+// upgrade" does.
+func Upgrade(ctx context.Context, opts *UpgradeOptions) (*UpgradeResult, error) {
+	if opts.Location == "" {
+		return nil, fmt.Errorf("UpgradeOptions.Location is required")
+	}
+	location, err := absPath(opts.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	result := upgrade.UpgradeAll(ctx, &upgrade.Params{
+		AcceptDefaults:      opts.AcceptDefaults,
+		Clock:               clock.New(),
+		FollowReplacement:   opts.FollowReplacement,
+		FS:                  &common.RealFS{},
+		GitProtocol:         opts.GitProtocol,
+		InputFiles:          opts.InputFiles,
+		InputsFromFlags:     opts.Inputs,
+		Location:            location,
+		ManifestFilter:      opts.ManifestFilter,
+		SkipInputValidation: opts.SkipInputValidation,
+		Stdout:              stdoutOrDiscard(opts.Stdout),
+		TemplateLocation:    opts.TemplateLocation,
+		UpgradeChannel:      opts.UpgradeChannel,
+		Version:             opts.Version,
+	})
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	return newUpgradeResult(result, location), nil
+}
+
+func newUpgradeResult(result *upgrade.Result, location string) *UpgradeResult {
+	out := &UpgradeResult{Result: result.Overall.String()}
+	for _, r := range result.Results {
+		manifestPath := filepath.Join(location, r.ManifestPath)
+		// Manifests are in the .abc directory of the installation.
+		installedDir := filepath.Dir(filepath.Dir(manifestPath))
+		abs := func(rel string) string {
+			if rel == "" {
+				return ""
+			}
+			return filepath.Join(installedDir, rel)
+		}
+
+		inst := &UpgradedInstallation{
+			ManifestPath: manifestPath,
+			Result:       r.Type.String(),
+		}
+		if r.DLMeta != nil {
+			inst.Version = r.DLMeta.Version
+		}
+		for _, a := range r.NonConflicts {
+			if a.Action != upgrade.Noop {
+				inst.ChangedFiles = append(inst.ChangedFiles, abs(a.Path))
+			}
+		}
+		for _, a := range r.MergeConflicts {
+			inst.Conflicts = append(inst.Conflicts, &Conflict{
+				Path:         abs(a.Path),
+				Kind:         string(a.Action),
+				LocalPath:    abs(a.OursPath),
+				TemplatePath: abs(a.IncomingTemplatePath),
+			})
+		}
+		for _, rc := range r.ReversalConflicts {
+			inst.Conflicts = append(inst.Conflicts, &Conflict{
+				Path:         rc.AbsPath,
+				Kind:         "patchReversalConflict",
+				TemplatePath: rc.RejectedHunks,
+			})
+		}
+		out.Installations = append(out.Installations, inst)
+	}
+	return out
+}
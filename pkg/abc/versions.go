@@ -0,0 +1,57 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package abc
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/abcxyz/abc/templates/common/registry"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+)
+
+// ListVersionsOptions are the options for ListVersions.
+type ListVersionsOptions struct {
+	// The location of a template in a remote git repo, like
+	// "github.com/abcxyz/abc/t/rest_server", or a registry alias for one. Any
+	// @version suffix is ignored, and may be left out. Required.
+	Source string
+
+	// "https" or "ssh". The default is "https".
+	GitProtocol string
+}
+
+// ListVersions returns the release versions of a template, which are the
+// vX.Y.Z semver tags of its git repo, newest first. Templates on the local
+// filesystem have no versions, so they're an error.
+func ListVersions(ctx context.Context, opts *ListVersionsOptions) ([]string, error) {
+	if opts.Source == "" {
+		return nil, fmt.Errorf("ListVersionsOptions.Source is required")
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+	source, err := registry.ResolveSource(wd, opts.Source)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	return templatesource.ListVersions(ctx, &templatesource.ParseSourceParams{ //nolint:wrapcheck
+		CWD:             wd,
+		Source:          source,
+		FlagGitProtocol: opts.GitProtocol,
+	})
+}
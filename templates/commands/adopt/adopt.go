@@ -0,0 +1,187 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package adopt implements the command that brings a project generated by
+// another scaffolding tool under abc's upgrade flow.
+package adopt
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/benbjohnson/clock"
+	"github.com/posener/complete/v2"
+	"github.com/posener/complete/v2/predict"
+
+	"github.com/abcxyz/abc-updater/pkg/metrics"
+	"github.com/abcxyz/abc/internal/metricswrap"
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/adopt"
+	"github.com/abcxyz/abc/templates/common/registry"
+	"github.com/abcxyz/abc/templates/common/render"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/pkg/cli"
+)
+
+type Command struct {
+	cli.BaseCommand
+	flags Flags
+
+	// Used in prompt tests to bypass "is the input a terminal" check.
+	skipPromptTTYCheck bool
+}
+
+// Desc implements cli.Command.
+func (c *Command) Desc() string {
+	return "write a manifest for a project generated by another scaffolding tool, so it can be upgraded by abc"
+}
+
+// Help implements cli.Command.
+func (c *Command) Help() string {
+	return `
+Usage: {{ COMMAND }} [options] --from=<tool> <answers_file>
+
+The {{ COMMAND }} command reads the answers file that another scaffolding tool
+wrote when it generated a project, and writes an abc manifest for the project as
+though it had been rendered by abc. After that, "abc upgrade" can upgrade the
+project like any other.
+
+The supported tools are:
+
+  - copier: the .copier-answers.yml file.
+  - cookiecutter: a cookiecutter replay file, or the .cruft.json file written
+    by cruft.
+
+The answers become the template inputs; answers that the abc template has no
+input for are ignored. Values given with --input take precedence over the
+answers file.
+
+The template must be an abc template, with a spec.yaml. By default, it's
+downloaded from the location and version in the answers file, which only works
+if that repo has been converted to an abc template. If the abc version of the
+template lives elsewhere, give its location with --template-location.
+
+No files other than the manifest are written. The manifest records what the
+template would output today, so files that differ from that will be treated as
+local customizations by future upgrades.
+`
+}
+
+// Flags implements cli.Command.
+func (c *Command) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+func (c *Command) PredictArgs() complete.Predictor {
+	return predict.Files("*")
+}
+
+func (c *Command) Run(ctx context.Context, args []string) error {
+	mClient := metrics.FromContext(ctx)
+	cleanup := metricswrap.WriteMetric(ctx, mClient, "command_adopt", 1)
+	defer cleanup()
+
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	ctx = c.flags.WithLogger(ctx, c.Stderr())
+
+	fs := &common.RealFS{}
+	buf, err := fs.ReadFile(c.flags.AnswersFile)
+	if err != nil {
+		return fmt.Errorf("failed reading answers file: %w", err)
+	}
+	answers, err := adopt.Parse(c.flags.From, buf)
+	if err != nil {
+		return fmt.Errorf("failed reading answers file %q: %w", c.flags.AnswersFile, err)
+	}
+
+	wd, err := c.WorkingDir()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+
+	source, err := templateSource(c.flags.TemplateLocation, answers)
+	if err != nil {
+		return err
+	}
+	source, err = registry.ResolveSource(wd, source)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	downloader, err := templatesource.ParseSource(ctx, &templatesource.ParseSourceParams{
+		CWD:                   wd,
+		Source:                source,
+		FlagGitProtocol:       c.flags.GitProtocol,
+		FlagUpgradeChannel:    c.flags.UpgradeChannel,
+		RequireUpgradeChannel: true,
+	})
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	result, err := render.Render(ctx, &render.Params{
+		AcceptDefaults:         c.flags.AcceptDefaults,
+		BackfillManifestOnly:   true,
+		Clock:                  clock.New(),
+		ContinueWithoutPatches: c.flags.ContinueWithoutPatches,
+		Cwd:                    wd,
+		Downloader:             downloader,
+		FS:                     fs,
+		GitProtocol:            c.flags.GitProtocol,
+		InputsFromFlags:        c.flags.Inputs,
+		// The answers have the lowest precedence, like the inputs saved in a
+		// manifest, and likewise unknown ones are ignored.
+		InputsFromManifest: answers.Inputs,
+		KeepTempDirs:       c.flags.KeepTempDirs,
+		OutDir:             c.flags.Dest,
+		Prompt:             c.flags.Prompt,
+		Prompter:           c,
+		SkipPromptTTYCheck: c.skipPromptTTYCheck,
+		SourceForMessages:  source,
+		Stdout:             c.Stdout(),
+		UpgradeChannel:     c.flags.UpgradeChannel,
+	})
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	fmt.Fprintf(c.Stdout(), "Wrote %s\n", filepath.Join(c.flags.Dest, result.ManifestPath))
+	return nil
+}
+
+// templateSource returns the location of the abc template to adopt: the
+// --template-location flag if given, otherwise the location and version in the
+// answers file.
+func templateSource(flagLocation string, answers *adopt.Answers) (string, error) {
+	if flagLocation != "" {
+		return flagLocation, nil
+	}
+	if answers.Source == "" {
+		return "", fmt.Errorf("the answers file doesn't say where the template came from; please use --template-location")
+	}
+	location, ok := adopt.Location(answers.Source)
+	if !ok {
+		return "", fmt.Errorf("the template location %q in the answers file isn't a GitHub or GitLab repo; please use --template-location", answers.Source)
+	}
+	version := answers.Version
+	if version == "" {
+		version = "latest"
+	}
+	return location + "@" + version, nil
+}
@@ -0,0 +1,294 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adopt
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/adopt"
+	"github.com/abcxyz/abc/templates/model"
+	manifestutil "github.com/abcxyz/abc/templates/model/manifest"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1beta7"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	mdl "github.com/abcxyz/abc/templates/testutil/model"
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+const specContents = `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'A template for testing adoption'
+inputs:
+  - name: 'project_name'
+    desc: 'the name of the project'
+  - name: 'use_docker'
+    desc: 'whether to include a Dockerfile'
+    default: 'false'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['README.md']
+  - desc: 'Template'
+    action: 'go_template'
+    params:
+      paths: ['README.md']
+`
+
+func TestCommand(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name        string
+		files       map[string]string
+		args        []string
+		answersFile string
+		wantInputs  []*manifest.Input
+		wantErr     string
+	}{
+		{
+			name: "copier",
+			files: map[string]string{
+				"dest/.copier-answers.yml": `_commit: v1.0.0
+_src_path: gh:foo/bar
+project_name: my-project
+use_docker: true
+unknown_to_abc: hello
+`,
+				"dest/README.md": "# my-project\n",
+			},
+			args:        []string{"--from=copier"},
+			answersFile: "dest/.copier-answers.yml",
+			wantInputs: []*manifest.Input{
+				{Name: mdl.S("project_name"), Value: mdl.S("my-project"), Source: mdl.S(manifest.InputSourceManifest)},
+				{Name: mdl.S("use_docker"), Value: mdl.S("true"), Source: mdl.S(manifest.InputSourceManifest)},
+			},
+		},
+		{
+			name: "cruft_with_input_override",
+			files: map[string]string{
+				"dest/.cruft.json": `{
+  "template": "https://github.com/foo/bar",
+  "commit": "abc123",
+  "context": {"cookiecutter": {"project_name": "my-project"}}
+}`,
+			},
+			args:        []string{"--from=cookiecutter", "--input=project_name=renamed", "--accept-defaults"},
+			answersFile: "dest/.cruft.json",
+			wantInputs: []*manifest.Input{
+				{Name: mdl.S("project_name"), Value: mdl.S("renamed"), Source: mdl.S(manifest.InputSourceFlag)},
+				{Name: mdl.S("use_docker"), Value: mdl.S("false"), Source: mdl.S(manifest.InputSourceDefault)},
+			},
+		},
+		{
+			name: "missing_input",
+			files: map[string]string{
+				"dest/.copier-answers.yml": `use_docker: true`,
+			},
+			args:        []string{"--from=copier"},
+			answersFile: "dest/.copier-answers.yml",
+			wantErr:     "missing input(s): project_name",
+		},
+		{
+			name: "bad_answers_file",
+			files: map[string]string{
+				"dest/.cruft.json": `{}`,
+			},
+			args:        []string{"--from=cookiecutter"},
+			answersFile: "dest/.cruft.json",
+			wantErr:     `must have a "cookiecutter" object`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			abctestutil.WriteAll(t, tempDir, tc.files)
+			templateDir := filepath.Join(tempDir, "template")
+			abctestutil.WriteAll(t, templateDir, map[string]string{
+				"spec.yaml": specContents,
+				"README.md": "# {{.project_name}}\n",
+			})
+			destDir := filepath.Join(tempDir, "dest")
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			cmd := &Command{}
+			_, stdout, _ := cmd.Pipe()
+			args := append([]string{"--template-location=" + templateDir, "--dest=" + destDir}, tc.args...)
+			args = append(args, filepath.Join(tempDir, tc.answersFile))
+			err := cmd.Run(ctx, args)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			manifestPaths, err := filepath.Glob(filepath.Join(destDir, common.ABCInternalDir, "manifest*.yaml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(manifestPaths) != 1 {
+				t.Fatalf("got manifests %v, want exactly one", manifestPaths)
+			}
+			if got, want := stdout.String(), "Wrote "+filepath.Join(destDir, common.ABCInternalDir, filepath.Base(manifestPaths[0]))+"\n"; got != want {
+				t.Errorf("got stdout %q, want %q", got, want)
+			}
+
+			got, _, err := manifestutil.Load(ctx, &common.RealFS{}, manifestPaths[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := []cmp.Option{cmpopts.IgnoreTypes(&model.ConfigPos{}, model.ConfigPos{})}
+			if diff := cmp.Diff(got.Inputs, tc.wantInputs, opts...); diff != "" {
+				t.Errorf("manifest inputs were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestTemplateSource(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name         string
+		flagLocation string
+		answers      *adopt.Answers
+		want         string
+		wantErr      string
+	}{
+		{
+			name:         "flag_wins",
+			flagLocation: "github.com/foo/abc-bar@latest",
+			answers:      &adopt.Answers{Source: "gh:foo/bar", Version: "v1.0.0"},
+			want:         "github.com/foo/abc-bar@latest",
+		},
+		{
+			name:    "from_answers",
+			answers: &adopt.Answers{Source: "gh:foo/bar", Version: "v1.0.0"},
+			want:    "github.com/foo/bar@v1.0.0",
+		},
+		{
+			name:    "from_answers_without_version",
+			answers: &adopt.Answers{Source: "https://gitlab.com/foo/bar.git"},
+			want:    "gitlab.com/foo/bar@latest",
+		},
+		{
+			name:    "no_source",
+			answers: &adopt.Answers{},
+			wantErr: "the answers file doesn't say where the template came from",
+		},
+		{
+			name:    "local_source",
+			answers: &adopt.Answers{Source: "/home/me/template"},
+			wantErr: "isn't a GitHub or GitLab repo",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := templateSource(tc.flagLocation, tc.answers)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFlags_Parse(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		args    []string
+		want    Flags
+		wantErr string
+	}{
+		{
+			name: "all_flags",
+			args: []string{
+				"--from=copier",
+				"--dest=/my/dir",
+				"--template-location=github.com/foo/bar@latest",
+				"--input=a=b",
+				"--accept-defaults",
+				".copier-answers.yml",
+			},
+			want: Flags{
+				AnswersFile:      ".copier-answers.yml",
+				AcceptDefaults:   true,
+				Dest:             "/my/dir",
+				From:             "copier",
+				GitProtocol:      "https",
+				Inputs:           map[string]string{"a": "b"},
+				TemplateLocation: "github.com/foo/bar@latest",
+			},
+		},
+		{
+			name:    "missing_answers_file",
+			args:    []string{"--from=copier"},
+			wantErr: "missing <answers_file> argument",
+		},
+		{
+			name:    "missing_from",
+			args:    []string{".copier-answers.yml"},
+			wantErr: `invalid --from ""`,
+		},
+		{
+			name:    "bad_from",
+			args:    []string{"--from=yeoman", ".copier-answers.yml"},
+			wantErr: `invalid --from "yeoman", must be one of [copier cookiecutter]`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var cmd Command
+			cmd.SetLookupEnv(cli.MapLookuper(nil))
+
+			err := cmd.Flags().Parse(tc.args)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(cmd.flags, tc.want, cmp.FilterPath(func(p cmp.Path) bool {
+				return p.String() == "LogFlags"
+			}, cmp.Ignore())); diff != "" {
+				t.Errorf("flags were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
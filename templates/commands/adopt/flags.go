@@ -0,0 +1,132 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adopt
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/posener/complete/v2/predict"
+
+	"github.com/abcxyz/abc/templates/common/adopt"
+	"github.com/abcxyz/abc/templates/common/flags"
+	"github.com/abcxyz/pkg/cli"
+)
+
+// Flags describes which answers file to adopt and where to write the manifest.
+type Flags struct {
+	// See common/flags.LogFlags.
+	flags.LogFlags
+
+	// The answers file written by the other tool; the first positional
+	// argument.
+	AnswersFile string
+
+	// See common/flags.AcceptDefaults().
+	AcceptDefaults bool
+
+	// Proceed even though the manifest can't record patches for files that
+	// the template modifies in place. See the render command's flag of the
+	// same name.
+	ContinueWithoutPatches bool
+
+	// The directory that the project was generated into, where the manifest
+	// will be written.
+	Dest string
+
+	// The format of the answers file, one of adopt.Formats.
+	From string
+
+	// See common/flags.GitProtocol().
+	GitProtocol string
+
+	// See common/flags.Inputs(). These override the answers file.
+	Inputs map[string]string
+
+	// See common/flags.KeepTempDirs().
+	KeepTempDirs bool
+
+	// See common/flags.Prompt().
+	Prompt bool
+
+	// The abc template to adopt the project into. If empty, the location
+	// recorded in the answers file is used.
+	TemplateLocation string
+
+	// See common/flags.UpgradeChannel().
+	UpgradeChannel string
+}
+
+func (f *Flags) Register(set *cli.FlagSet) {
+	a := flags.NewSection(set, "ADOPT OPTIONS")
+
+	a.StringVar(&cli.StringVar{
+		Name:    "from",
+		Example: "copier",
+		Target:  &f.From,
+		Predict: predict.Set(adopt.Formats),
+		Usage:   fmt.Sprintf("Required. The tool that wrote the answers file, one of %v.", adopt.Formats),
+	})
+	a.StringVar(&cli.StringVar{
+		Name:    "dest",
+		Aliases: []string{"d"},
+		Example: "/my/git/dir",
+		Target:  &f.Dest,
+		Default: ".",
+		Predict: predict.Dirs("*"),
+		Usage:   "The directory that the project was generated into, where the manifest will be written.",
+	})
+	a.StringVar(&cli.StringVar{
+		Name:    "template-location",
+		Example: "github.com/abcxyz/abc/t/rest_server@latest",
+		Target:  &f.TemplateLocation,
+		EnvVar:  "ABC_ADOPT_TEMPLATE_LOCATION",
+		Usage:   "The abc template that replaces the one that generated the project, in any form accepted by \"abc render\". Defaults to the template location in the answers file, at the version in the answers file.",
+	})
+	a.BoolVar(&cli.BoolVar{
+		Name:    "continue-without-patches",
+		Target:  &f.ContinueWithoutPatches,
+		Default: false,
+		EnvVar:  "ABC_CONTINUE_WITHOUT_PATCHES",
+		Usage:   `proceed even if the template modifies some files in place; the manifest will be missing the "patch reversal" fields for those files, which may cause spurious merge issues in future upgrades`,
+	})
+
+	r := flags.NewSection(set, "RENDER OPTIONS")
+	r.StringMapVar(flags.Inputs(&f.Inputs))
+	r.BoolVar(flags.AcceptDefaults(&f.AcceptDefaults))
+	r.BoolVar(flags.Prompt(&f.Prompt))
+	r.BoolVar(flags.KeepTempDirs(&f.KeepTempDirs))
+	r.StringVar(flags.UpgradeChannel(&f.UpgradeChannel))
+
+	g := flags.NewSection(set, "GIT OPTIONS")
+	g.StringVar(flags.GitProtocol(&f.GitProtocol))
+
+	f.LogFlags.Register(set)
+
+	set.AfterParse(func(existingErr error) error {
+		f.AnswersFile = strings.TrimSpace(set.Arg(0))
+		if f.AnswersFile == "" {
+			return fmt.Errorf("missing <answers_file> argument")
+		}
+		if len(set.Args()) > 1 {
+			return fmt.Errorf("expected exactly one argument, but got %q", set.Args())
+		}
+		if !slices.Contains(adopt.Formats, f.From) {
+			return fmt.Errorf("invalid --from %q, must be one of %v", f.From, adopt.Formats)
+		}
+		return nil
+	})
+}
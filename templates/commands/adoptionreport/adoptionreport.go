@@ -0,0 +1,358 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package adoptionreport implements the "adoption-report" subcommand, which
+// tells a template author where their template is installed, and at which
+// versions.
+package adoptionreport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc-updater/pkg/metrics"
+	"github.com/abcxyz/abc/internal/metricswrap"
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/abc/templates/model/decode"
+	"github.com/abcxyz/abc/templates/model/header"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1beta7"
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/logging"
+)
+
+type Command struct {
+	cli.BaseCommand
+	flags Flags
+
+	// testHTTPClient overrides the HTTP client in tests.
+	testHTTPClient *http.Client
+
+	// testListVersions overrides the lookup of the template's releases in
+	// tests.
+	testListVersions func(ctx context.Context, template string) ([]string, error)
+}
+
+// Desc implements cli.Command.
+func (c *Command) Desc() string {
+	return "report which versions of a template are installed across GitHub repos"
+}
+
+// Help implements cli.Command.
+func (c *Command) Help() string {
+	return `
+Usage: {{ COMMAND }} [options] (--org=<org> | --repo=<owner/name>...) <template_location>
+
+The {{ COMMAND }} command is for template authors. It uses GitHub code search
+to find the manifests of installations of the template at <template_location>,
+like github.com/my-org/my-templates/rest-server, in a GitHub org or a list of
+repos. It then reports how many installations are on each version of the
+template and each manifest api_version, and how far behind the template's
+latest release each installation is. This helps decide when old versions can
+stop being supported.
+
+Only installations whose template_location is exactly <template_location> are
+counted, and only files that GitHub has indexed can be found. Code search
+requires a GitHub token, from --github-token or $GITHUB_TOKEN.
+`
+}
+
+// Flags implements cli.Command.
+func (c *Command) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+func (c *Command) Run(ctx context.Context, args []string) error {
+	mClient := metrics.FromContext(ctx)
+	cleanup := metricswrap.WriteMetric(ctx, mClient, "command_adoption_report", 1)
+	defer cleanup()
+
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	ctx = c.flags.WithLogger(ctx, c.Stderr())
+
+	gh := &githubClient{
+		client: common.FirstNonZero(c.testHTTPClient, http.DefaultClient),
+		apiURL: strings.TrimSuffix(c.flags.GitHubAPIURL, "/"),
+		token:  c.flags.GitHubToken,
+	}
+	listVersions := c.testListVersions
+	if listVersions == nil {
+		listVersions = func(ctx context.Context, template string) ([]string, error) {
+			return templatesource.ListVersions(ctx, &templatesource.ParseSourceParams{
+				Source:          template,
+				FlagGitProtocol: c.flags.GitProtocol,
+			}) //nolint:wrapcheck
+		}
+	}
+
+	r, err := buildReport(ctx, gh, listVersions, &c.flags)
+	if err != nil {
+		return err
+	}
+	if c.flags.JSON {
+		enc := json.NewEncoder(c.Stdout())
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(r); err != nil {
+			return fmt.Errorf("failed writing report: %w", err)
+		}
+		return nil
+	}
+	return writeReport(c.Stdout(), r)
+}
+
+// report is the result of the command. It's printed as JSON with --json.
+type report struct {
+	Template string `json:"template"`
+
+	// The template's newest release, or empty if it has none or they
+	// couldn't be listed.
+	LatestVersion string `json:"latest_version,omitempty"`
+
+	Installations []*installation `json:"installations"`
+
+	// The number of installations on each template version and manifest
+	// api_version, most common first.
+	Versions    []*versionCount `json:"versions"`
+	APIVersions []*versionCount `json:"api_versions"`
+}
+
+// installation is one manifest of the template that was found.
+type installation struct {
+	Repo string `json:"repo"`
+
+	// The directory in the repo that the template was rendered into.
+	Dir string `json:"dir"`
+
+	Version          string    `json:"version"`
+	APIVersion       string    `json:"api_version"`
+	UpgradeChannel   string    `json:"upgrade_channel,omitempty"`
+	ModificationTime time.Time `json:"modification_time"`
+
+	// How many releases are newer than Version, or nil if Version isn't a
+	// known release, such as a commit SHA.
+	ReleasesBehind *int `json:"releases_behind,omitempty"`
+}
+
+type versionCount struct {
+	Version        string `json:"version"`
+	Installations  int    `json:"installations"`
+	ReleasesBehind *int   `json:"releases_behind,omitempty"`
+}
+
+func buildReport(ctx context.Context, gh *githubClient, listVersions func(context.Context, string) ([]string, error), f *Flags) (*report, error) {
+	logger := logging.FromContext(ctx).With("logger", "buildReport")
+
+	// Manifests quote the location in different ways, so search for the
+	// location alone, and check the template_location field of each hit.
+	terms := []string{`"` + f.Template + `"`, "path:" + common.ABCInternalDir}
+	if f.Org != "" {
+		terms = append(terms, "org:"+f.Org)
+	}
+	for _, r := range f.Repos {
+		terms = append(terms, "repo:"+r)
+	}
+	hits, err := gh.searchCode(ctx, strings.Join(terms, " "))
+	if err != nil {
+		return nil, err
+	}
+
+	// Releases, newest first.
+	releases, err := listVersions(ctx, f.Template)
+	if err != nil {
+		logger.WarnContext(ctx, "failed listing the template's releases, so the report won't say how far behind installations are",
+			"error", err)
+		releases = nil
+	}
+
+	r := &report{
+		Template:      f.Template,
+		Installations: []*installation{},
+	}
+	if len(releases) > 0 {
+		r.LatestVersion = releases[0]
+	}
+
+	for _, hit := range hits {
+		if !isManifestPath(hit.Path) {
+			continue
+		}
+		buf, err := gh.fileContents(ctx, hit.ContentsURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed reading %s in %s: %w", hit.Path, hit.Repo, err)
+		}
+		m, apiVersion, err := parseManifest(ctx, buf, hit.Repo+"/"+hit.Path)
+		if err != nil {
+			logger.WarnContext(ctx, "skipping a manifest that couldn't be parsed",
+				"repo", hit.Repo,
+				"path", hit.Path,
+				"error", err)
+			continue
+		}
+		if m.TemplateLocation.Val != f.Template {
+			continue
+		}
+		r.Installations = append(r.Installations, &installation{
+			Repo: hit.Repo,
+			// Manifests are in the .abc directory of the directory where the
+			// template was installed.
+			Dir:              path.Dir(path.Dir(hit.Path)),
+			Version:          m.TemplateVersion.Val,
+			APIVersion:       apiVersion,
+			UpgradeChannel:   m.UpgradeChannel.Val,
+			ModificationTime: m.ModificationTime,
+			ReleasesBehind:   releasesBehind(releases, m.TemplateVersion.Val),
+		})
+	}
+
+	sort.Slice(r.Installations, func(i, j int) bool {
+		a, b := r.Installations[i], r.Installations[j]
+		if a.Repo != b.Repo {
+			return a.Repo < b.Repo
+		}
+		return a.Dir < b.Dir
+	})
+
+	versions := map[string]int{}
+	apiVersions := map[string]int{}
+	for _, inst := range r.Installations {
+		versions[inst.Version]++
+		apiVersions[inst.APIVersion]++
+	}
+	r.Versions = counts(versions)
+	for _, vc := range r.Versions {
+		vc.ReleasesBehind = releasesBehind(releases, vc.Version)
+	}
+	r.APIVersions = counts(apiVersions)
+
+	return r, nil
+}
+
+// isManifestPath returns whether the given slash-separated path looks like a
+// manifest written by a render.
+func isManifestPath(p string) bool {
+	base := path.Base(p)
+	return path.Base(path.Dir(p)) == common.ABCInternalDir &&
+		strings.HasPrefix(base, "manifest") &&
+		strings.HasSuffix(base, ".yaml")
+}
+
+// parseManifest decodes and validates the manifest, upgrading it to the newest
+// manifest model. It also returns the api_version the manifest was written
+// with, which the upgraded model doesn't have.
+func parseManifest(ctx context.Context, buf []byte, filename string) (*manifest.Manifest, string, error) {
+	hdr := &header.Fields{}
+	if err := yaml.Unmarshal(buf, hdr); err != nil {
+		return nil, "", fmt.Errorf("error parsing file %s: %w", filename, err)
+	}
+	vu, _, err := decode.DecodeValidateUpgrade(ctx, bytes.NewReader(buf), filename, decode.KindManifest)
+	if err != nil {
+		return nil, "", err //nolint:wrapcheck
+	}
+	m, ok := vu.(*manifest.Manifest)
+	if !ok {
+		return nil, "", common.InternalErrorf("manifest file did not decode to *manifest.Manifest")
+	}
+	return m, common.FirstNonZero(hdr.NewStyleAPIVersion.Val, hdr.OldStyleAPIVersion.Val), nil
+}
+
+// releasesBehind returns the number of releases that are newer than the given
+// version, or nil if the version isn't one of the releases.
+func releasesBehind(releasesNewestFirst []string, version string) *int {
+	for i, r := range releasesNewestFirst {
+		if r == version {
+			return &i
+		}
+	}
+	return nil
+}
+
+// counts returns the given counts, most common first, and then sorted by
+// version.
+func counts(m map[string]int) []*versionCount {
+	out := make([]*versionCount, 0, len(m))
+	for v, n := range m {
+		out = append(out, &versionCount{Version: v, Installations: n})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Installations != out[j].Installations {
+			return out[i].Installations > out[j].Installations
+		}
+		return out[i].Version > out[j].Version
+	})
+	return out
+}
+
+// writeReport writes the report as a summary followed by tables.
+func writeReport(w io.Writer, r *report) error {
+	repos := map[string]struct{}{}
+	upToDate := 0
+	for _, inst := range r.Installations {
+		repos[inst.Repo] = struct{}{}
+		if b := inst.ReleasesBehind; b != nil && *b == 0 {
+			upToDate++
+		}
+	}
+
+	fmt.Fprintf(w, "Template: %s\n", r.Template)
+	fmt.Fprintf(w, "Latest release: %s\n", common.FirstNonZero(r.LatestVersion, "-"))
+	fmt.Fprintf(w, "Installations: %d in %d repos\n", len(r.Installations), len(repos))
+	if r.LatestVersion != "" {
+		fmt.Fprintf(w, "On the latest release: %d\n", upToDate)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\nVERSION\tINSTALLATIONS\tRELEASES BEHIND")
+	for _, vc := range r.Versions {
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", common.FirstNonZero(vc.Version, "-"), vc.Installations, behindText(vc.ReleasesBehind))
+	}
+	fmt.Fprintln(tw, "\nAPI VERSION\tINSTALLATIONS")
+	for _, vc := range r.APIVersions {
+		fmt.Fprintf(tw, "%s\t%d\n", vc.Version, vc.Installations)
+	}
+	fmt.Fprintln(tw, "\nREPO\tDIRECTORY\tVERSION\tAPI VERSION\tLAST RENDERED")
+	for _, inst := range r.Installations {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			inst.Repo,
+			inst.Dir,
+			common.FirstNonZero(inst.Version, "-"),
+			inst.APIVersion,
+			inst.ModificationTime.Format(time.DateOnly))
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("failed writing report: %w", err)
+	}
+	return nil
+}
+
+func behindText(b *int) string {
+	if b == nil {
+		return "?"
+	}
+	return fmt.Sprint(*b)
+}
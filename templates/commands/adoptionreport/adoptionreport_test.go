@@ -0,0 +1,228 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adoptionreport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+const template = "github.com/my-org/templates/rest-server"
+
+func manifestAt(apiVersion, location, version, modified string) string {
+	return fmt.Sprintf(`api_version: '%s'
+kind: 'Manifest'
+template_location: '%s'
+template_version: '%s'
+template_dirhash: 'h1:abc'
+creation_time: '%s'
+modification_time: '%s'
+`, apiVersion, location, version, modified, modified)
+}
+
+func TestAdoptionReport(t *testing.T) {
+	t.Parallel()
+
+	// The files that code search finds, keyed by "<repo>:<path>".
+	files := map[string]string{
+		"my-org/svc-a:.abc/manifest_a.lock.yaml":        manifestAt("cli.abcxyz.dev/v1beta7", template, "v1.2.0", "2024-05-01T00:00:00Z"),
+		"my-org/svc-a:admin/.abc/manifest_b.lock.yaml":  manifestAt("cli.abcxyz.dev/v1beta6", template, "v1.0.0", "2024-01-01T00:00:00Z"),
+		"my-org/svc-b:.abc/manifest_c.lock.yaml":        manifestAt("cli.abcxyz.dev/v1beta7", template, "v1.2.0", "2024-06-01T00:00:00Z"),
+		"my-org/svc-c:deploy/.abc/manifest_d.lock.yaml": manifestAt("cli.abcxyz.dev/v1beta7", template, "0123456789012345678901234567890123456789", "2024-06-02T00:00:00Z"),
+		"my-org/svc-c:other/.abc/manifest_e.lock.yaml":  manifestAt("cli.abcxyz.dev/v1beta7", template+"-v2", "v2.0.0", "2024-06-02T00:00:00Z"),
+		"my-org/svc-c:docs/example.md":                  "template_location: " + template,
+		"my-org/svc-d:broken/.abc/manifest_f.lock.yaml": "kind: 'Manifest'\n",
+	}
+
+	cases := []struct {
+		name        string
+		args        []string
+		releases    []string
+		releasesErr error
+		wantQuery   string
+		wantStdout  string
+		wantErr     string
+	}{
+		{
+			name:      "org",
+			args:      []string{"--org=my-org"},
+			releases:  []string{"v1.2.0", "v1.1.0", "v1.0.0"},
+			wantQuery: `"github.com/my-org/templates/rest-server" path:.abc org:my-org`,
+			wantStdout: `Template: github.com/my-org/templates/rest-server
+Latest release: v1.2.0
+Installations: 4 in 3 repos
+On the latest release: 2
+
+VERSION                                   INSTALLATIONS  RELEASES BEHIND
+v1.2.0                                    2              0
+v1.0.0                                    1              2
+0123456789012345678901234567890123456789  1              ?
+
+API VERSION             INSTALLATIONS
+cli.abcxyz.dev/v1beta7  3
+cli.abcxyz.dev/v1beta6  1
+
+REPO          DIRECTORY  VERSION                                   API VERSION             LAST RENDERED
+my-org/svc-a  .          v1.2.0                                    cli.abcxyz.dev/v1beta7  2024-05-01
+my-org/svc-a  admin      v1.0.0                                    cli.abcxyz.dev/v1beta6  2024-01-01
+my-org/svc-b  .          v1.2.0                                    cli.abcxyz.dev/v1beta7  2024-06-01
+my-org/svc-c  deploy     0123456789012345678901234567890123456789  cli.abcxyz.dev/v1beta7  2024-06-02
+`,
+		},
+		{
+			name:        "repos_without_releases",
+			args:        []string{"--repo=my-org/svc-a", "--repo=my-org/svc-b"},
+			releasesErr: fmt.Errorf("fake error"),
+			wantQuery:   `"github.com/my-org/templates/rest-server" path:.abc repo:my-org/svc-a repo:my-org/svc-b`,
+			wantStdout: `Template: github.com/my-org/templates/rest-server
+Latest release: -
+Installations: 4 in 3 repos
+
+VERSION                                   INSTALLATIONS  RELEASES BEHIND
+v1.2.0                                    2              ?
+v1.0.0                                    1              ?
+0123456789012345678901234567890123456789  1              ?
+
+API VERSION             INSTALLATIONS
+cli.abcxyz.dev/v1beta7  3
+cli.abcxyz.dev/v1beta6  1
+
+REPO          DIRECTORY  VERSION                                   API VERSION             LAST RENDERED
+my-org/svc-a  .          v1.2.0                                    cli.abcxyz.dev/v1beta7  2024-05-01
+my-org/svc-a  admin      v1.0.0                                    cli.abcxyz.dev/v1beta6  2024-01-01
+my-org/svc-b  .          v1.2.0                                    cli.abcxyz.dev/v1beta7  2024-06-01
+my-org/svc-c  deploy     0123456789012345678901234567890123456789  cli.abcxyz.dev/v1beta7  2024-06-02
+`,
+		},
+		{
+			name:    "org_and_repo",
+			args:    []string{"--org=my-org", "--repo=my-org/svc-a"},
+			wantErr: "exactly one of --org or --repo must be given",
+		},
+		{
+			name:    "neither_org_nor_repo",
+			wantErr: "exactly one of --org or --repo must be given",
+		},
+		{
+			name:    "bad_repo",
+			args:    []string{"--repo=svc-a"},
+			wantErr: `--repo "svc-a" must look like <owner>/<name>`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var mu sync.Mutex
+			var gotQuery string
+			var srv *httptest.Server
+			srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Authorization"); got != "Bearer fake-token" {
+					http.Error(w, "bad credentials", http.StatusUnauthorized)
+					return
+				}
+				if r.URL.Path == "/search/code" {
+					mu.Lock()
+					gotQuery = r.URL.Query().Get("q")
+					mu.Unlock()
+					type item struct {
+						Path       string            `json:"path"`
+						URL        string            `json:"url"`
+						Repository map[string]string `json:"repository"`
+					}
+					var items []item
+					for key := range files {
+						repo, p, _ := strings.Cut(key, ":")
+						items = append(items, item{
+							Path:       p,
+							URL:        srv.URL + "/contents/" + key,
+							Repository: map[string]string{"full_name": repo},
+						})
+					}
+					json.NewEncoder(w).Encode(map[string]any{ //nolint:errcheck
+						"total_count": len(items),
+						"items":       items,
+					})
+					return
+				}
+				contents, ok := files[strings.TrimPrefix(r.URL.Path, "/contents/")]
+				if !ok {
+					http.NotFound(w, r)
+					return
+				}
+				fmt.Fprint(w, contents)
+			}))
+			t.Cleanup(srv.Close)
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			cmd := &Command{
+				testListVersions: func(context.Context, string) ([]string, error) {
+					return tc.releases, tc.releasesErr
+				},
+			}
+			_, stdout, _ := cmd.Pipe()
+			args := append([]string{"--github-token=fake-token", "--github-api-url=" + srv.URL}, tc.args...)
+			err := cmd.Run(ctx, append(args, template))
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			if gotQuery != tc.wantQuery {
+				t.Errorf("got search query %q, want %q", gotQuery, tc.wantQuery)
+			}
+			if diff := cmp.Diff(stdout.String(), tc.wantStdout); diff != "" {
+				t.Errorf("stdout was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestAdoptionReport_JSON(t *testing.T) {
+	t.Parallel()
+
+	r := &report{
+		Template:      template,
+		LatestVersion: "v1.2.0",
+		Installations: []*installation{},
+		Versions:      counts(map[string]int{"v1.2.0": 1}),
+		APIVersions:   counts(map[string]int{"cli.abcxyz.dev/v1beta7": 1}),
+	}
+	r.Versions[0].ReleasesBehind = releasesBehind([]string{"v1.2.0"}, "v1.2.0")
+	got, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"template":"github.com/my-org/templates/rest-server","latest_version":"v1.2.0","installations":[],` +
+		`"versions":[{"version":"v1.2.0","installations":1,"releases_behind":0}],` +
+		`"api_versions":[{"version":"cli.abcxyz.dev/v1beta7","installations":1}]}`
+	if diff := cmp.Diff(string(got), want); diff != "" {
+		t.Errorf("JSON was not as expected (-got,+want): %s", diff)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adoptionreport
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common/flags"
+	"github.com/abcxyz/pkg/cli"
+)
+
+// DefaultGitHubAPIURL is the base URL of the GitHub REST API on github.com.
+const DefaultGitHubAPIURL = "https://api.github.com"
+
+// repoRE matches a GitHub repo name like "my-org/my-repo".
+var repoRE = regexp.MustCompile(`^[a-zA-Z0-9_.-]+/[a-zA-Z0-9_.-]+$`)
+
+// Flags describes which template to report on and where to look for it.
+type Flags struct {
+	// See common/flags.LogFlags.
+	flags.LogFlags
+
+	// Template is the canonical location of the template, as it appears in
+	// the template_location field of manifests, e.g.
+	// github.com/my-org/my-templates/rest-server.
+	Template string
+
+	// Org is the GitHub org to search. Exactly one of Org or Repos is set.
+	Org string
+
+	// Repos are the GitHub repos to search, like "my-org/my-repo".
+	Repos []string
+
+	// GitHubToken authenticates to the GitHub API, which requires
+	// authentication for code search.
+	GitHubToken string
+
+	// GitHubAPIURL is the base URL of the GitHub REST API, which differs for
+	// GitHub Enterprise Server.
+	GitHubAPIURL string
+
+	// The value of --git-protocol, used to look up the template's releases.
+	GitProtocol string
+
+	// If true, the report is printed as JSON rather than as tables.
+	JSON bool
+}
+
+func (f *Flags) Register(set *cli.FlagSet) {
+	s := flags.NewSection(set, "ADOPTION REPORT OPTIONS")
+
+	s.StringVar(&cli.StringVar{
+		Name:    "org",
+		Example: "my-org",
+		Target:  &f.Org,
+		Usage:   "the GitHub org whose repos are searched for installations of the template",
+	})
+	s.StringSliceVar(&cli.StringSliceVar{
+		Name:    "repo",
+		Example: "my-org/my-repo",
+		Target:  &f.Repos,
+		Usage:   "a GitHub repo to search for installations of the template, instead of a whole org; may be repeated",
+	})
+	s.StringVar(&cli.StringVar{
+		Name:    "github-token",
+		Example: "ghp_...",
+		EnvVar:  "GITHUB_TOKEN",
+		Target:  &f.GitHubToken,
+		Usage:   "the token used to call the GitHub API, which requires authentication for code search",
+	})
+	s.StringVar(&cli.StringVar{
+		Name:    "github-api-url",
+		Example: "https://github.example.com/api/v3",
+		Default: DefaultGitHubAPIURL,
+		EnvVar:  "GITHUB_API_URL",
+		Target:  &f.GitHubAPIURL,
+		Usage:   "the base URL of the GitHub REST API; only needed for GitHub Enterprise Server",
+	})
+	s.StringVar(flags.GitProtocol(&f.GitProtocol))
+	s.BoolVar(&cli.BoolVar{
+		Name:   "json",
+		Target: &f.JSON,
+		Usage:  "print the report as JSON instead of as tables",
+	})
+
+	f.LogFlags.Register(set)
+
+	set.AfterParse(func(existingErr error) error {
+		f.Template = strings.TrimSpace(set.Arg(0))
+		if f.Template == "" {
+			return fmt.Errorf("missing <template_location> argument")
+		}
+		if len(set.Args()) > 1 {
+			return fmt.Errorf("expected exactly one argument, but got %q", set.Args())
+		}
+		if strings.Contains(f.Template, "@") {
+			return fmt.Errorf("the template location %q must not have an @version, since installations of every version are reported", f.Template)
+		}
+		if (f.Org == "") == (len(f.Repos) == 0) {
+			return fmt.Errorf("exactly one of --org or --repo must be given")
+		}
+		for _, r := range f.Repos {
+			if !repoRE.MatchString(r) {
+				return fmt.Errorf("--repo %q must look like <owner>/<name>", r)
+			}
+		}
+		if f.GitHubToken == "" {
+			return fmt.Errorf("GitHub code search requires authentication; provide a token with --github-token or $GITHUB_TOKEN")
+		}
+		return nil
+	})
+}
@@ -0,0 +1,145 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adoptionreport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/abcxyz/pkg/logging"
+)
+
+const (
+	// The most results per page that the GitHub search API allows.
+	searchPageSize = 100
+
+	// GitHub's search API never returns more than this many results for one
+	// query, no matter how many pages are requested.
+	maxSearchResults = 1000
+)
+
+// githubClient calls the parts of the GitHub REST API that the report needs.
+type githubClient struct {
+	client *http.Client
+	apiURL string
+	token  string
+}
+
+// codeSearchHit is a file that matched a code search.
+type codeSearchHit struct {
+	// The repo containing the file, like "my-org/my-repo".
+	Repo string
+	// The slash-separated path of the file in the repo.
+	Path string
+	// The API URL of the file's contents at the commit that was indexed.
+	ContentsURL string
+}
+
+// searchCode returns the files that match the given code search query,
+// following pagination up to GitHub's limit on search results.
+func (g *githubClient) searchCode(ctx context.Context, query string) ([]*codeSearchHit, error) {
+	logger := logging.FromContext(ctx).With("logger", "searchCode")
+
+	var out []*codeSearchHit
+	for page := 1; page*searchPageSize <= maxSearchResults; page++ {
+		params := url.Values{
+			"q":        {query},
+			"per_page": {strconv.Itoa(searchPageSize)},
+			"page":     {strconv.Itoa(page)},
+		}
+		var resp struct {
+			TotalCount        int  `json:"total_count"`
+			IncompleteResults bool `json:"incomplete_results"`
+			Items             []struct {
+				Path       string `json:"path"`
+				URL        string `json:"url"`
+				Repository struct {
+					FullName string `json:"full_name"`
+				} `json:"repository"`
+			} `json:"items"`
+		}
+		body, err := g.get(ctx, g.apiURL+"/search/code?"+params.Encode(), "application/vnd.github+json")
+		if err != nil {
+			return nil, fmt.Errorf("code search failed: %w", err)
+		}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, fmt.Errorf("failed parsing code search response: %w", err)
+		}
+		if resp.IncompleteResults {
+			logger.WarnContext(ctx, "GitHub timed out during the code search, so some installations may be missing from the report")
+		}
+		if page == 1 && resp.TotalCount > maxSearchResults {
+			logger.WarnContext(ctx, "the code search matched more files than GitHub returns; narrow the search with --repo to see them all",
+				"total_count", resp.TotalCount,
+				"limit", maxSearchResults)
+		}
+
+		for _, item := range resp.Items {
+			out = append(out, &codeSearchHit{
+				Repo:        item.Repository.FullName,
+				Path:        item.Path,
+				ContentsURL: item.URL,
+			})
+		}
+		if len(resp.Items) < searchPageSize || len(out) >= resp.TotalCount {
+			break
+		}
+	}
+	return out, nil
+}
+
+// fileContents downloads the raw contents of a file, given its API URL.
+func (g *githubClient) fileContents(ctx context.Context, contentsURL string) ([]byte, error) {
+	return g.get(ctx, contentsURL, "application/vnd.github.raw")
+}
+
+func (g *githubClient) get(ctx context.Context, u, accept string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating request: %w", err)
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if g.token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.token)
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed calling the GitHub API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		err := fmt.Errorf("got HTTP status %q from %s: %s", resp.Status, strings.SplitN(u, "?", 2)[0], bytes.TrimSpace(msg))
+		if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+			err = fmt.Errorf("%w; the GitHub API rate limit was exceeded, try again later", err)
+		}
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading GitHub API response: %w", err)
+	}
+	return body, nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backups
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/posener/complete/v2/predict"
+
+	"github.com/abcxyz/abc/templates/common/flags"
+	"github.com/abcxyz/pkg/cli"
+)
+
+// PruneFlags describes which backups to prune.
+type PruneFlags struct {
+	// See common/flags.LogFlags.
+	flags.LogFlags
+
+	// See common/flags.BackupKeep().
+	BackupKeep int
+
+	// See common/flags.BackupMaxAge().
+	BackupMaxAge time.Duration
+
+	// BackupRoot is the directory containing backups. Defaults to
+	// ~/.abc/backups.
+	BackupRoot string
+
+	// DryRun only lists the backups that would be removed.
+	DryRun bool
+}
+
+func (p *PruneFlags) Register(set *cli.FlagSet) {
+	f := flags.NewSection(set, "PRUNE OPTIONS")
+
+	f.IntVar(flags.BackupKeep(&p.BackupKeep))
+	f.DurationVar(flags.BackupMaxAge(&p.BackupMaxAge))
+
+	f.StringVar(&cli.StringVar{
+		Name:    "backup-root",
+		Example: "/home/me/.abc/backups",
+		Target:  &p.BackupRoot,
+		Predict: predict.Dirs("*"),
+		Usage:   "The directory containing backups; defaults to ~/.abc/backups.",
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "dry-run",
+		Target:  &p.DryRun,
+		Default: false,
+		Usage:   "Print the backup directories that would be removed, without removing them.",
+	})
+
+	p.LogFlags.Register(set)
+
+	set.AfterParse(func(existingErr error) error {
+		if len(set.Args()) > 0 {
+			return fmt.Errorf("unexpected arguments: %q", set.Args())
+		}
+		if p.BackupKeep < 0 {
+			return fmt.Errorf("--backup-keep must not be negative")
+		}
+		if p.BackupMaxAge < 0 {
+			return fmt.Errorf("--backup-max-age must not be negative")
+		}
+		if p.BackupKeep == 0 && p.BackupMaxAge == 0 {
+			return fmt.Errorf("at least one of --backup-keep or --backup-max-age is required")
+		}
+		return nil
+	})
+}
@@ -0,0 +1,103 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package backups implements the subcommands for managing the backups of files
+// that were overwritten by renders.
+package backups
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/benbjohnson/clock"
+
+	"github.com/abcxyz/abc-updater/pkg/metrics"
+	"github.com/abcxyz/abc/internal/metricswrap"
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/backups"
+	"github.com/abcxyz/pkg/cli"
+)
+
+type PruneCommand struct {
+	cli.BaseCommand
+	flags PruneFlags
+
+	// For testing.
+	clock clock.Clock
+}
+
+// Desc implements cli.Command.
+func (c *PruneCommand) Desc() string {
+	return "delete old backups of files that were overwritten by renders"
+}
+
+// Help implements cli.Command.
+func (c *PruneCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options]
+
+The {{ COMMAND }} command deletes backup directories under ~/.abc/backups that
+are beyond the retention policy given by --backup-keep and --backup-max-age.
+Each backup directory holds the files that one render overwrote; the manifest
+written by that render records its location in the "backup_dir" field.
+`
+}
+
+// Flags implements cli.Command.
+func (c *PruneCommand) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+func (c *PruneCommand) Run(ctx context.Context, args []string) error {
+	mClient := metrics.FromContext(ctx)
+	cleanup := metricswrap.WriteMetric(ctx, mClient, "command_backups_prune", 1)
+	defer cleanup()
+
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	ctx = c.flags.WithLogger(ctx, c.Stderr())
+
+	root := c.flags.BackupRoot
+	if root == "" {
+		var err error
+		if root, err = backups.DefaultRoot(); err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+	clk := c.clock
+	if clk == nil {
+		clk = clock.New()
+	}
+
+	pruned, err := backups.Prune(ctx, &backups.PruneParams{
+		FS:     &common.RealFS{},
+		Root:   root,
+		Keep:   c.flags.BackupKeep,
+		MaxAge: c.flags.BackupMaxAge,
+		Now:    clk.Now(),
+		DryRun: c.flags.DryRun,
+	})
+	verb := "Removed"
+	if c.flags.DryRun {
+		verb = "Would remove"
+	}
+	for _, b := range pruned {
+		fmt.Fprintf(c.Stdout(), "%s %s (from %s)\n", verb, b.Dir, b.Time.Format(time.RFC3339))
+	}
+	return err //nolint:wrapcheck
+}
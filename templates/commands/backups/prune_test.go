@@ -0,0 +1,123 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backups
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestPruneFlags_Parse(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		args    []string
+		want    PruneFlags
+		wantErr string
+	}{
+		{
+			name: "all_flags",
+			args: []string{"--backup-keep=3", "--backup-max-age=24h", "--backup-root=/foo", "--dry-run"},
+			want: PruneFlags{
+				BackupKeep:   3,
+				BackupMaxAge: 24 * time.Hour,
+				BackupRoot:   "/foo",
+				DryRun:       true,
+			},
+		},
+		{
+			name:    "no_policy",
+			args:    []string{},
+			wantErr: "at least one of --backup-keep or --backup-max-age is required",
+		},
+		{
+			name:    "negative_keep",
+			args:    []string{"--backup-keep=-1"},
+			wantErr: "--backup-keep must not be negative",
+		},
+		{
+			name:    "unexpected_args",
+			args:    []string{"--backup-keep=1", "foo"},
+			wantErr: "unexpected arguments",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var cmd PruneCommand
+			cmd.SetLookupEnv(cli.MapLookuper(nil))
+
+			err := cmd.Flags().Parse(tc.args)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(cmd.flags, tc.want, cmp.FilterPath(func(p cmp.Path) bool {
+				return p.String() == "LogFlags"
+			}, cmp.Ignore())); diff != "" {
+				t.Errorf("flags were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestPruneCommand(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	abctestutil.WriteAll(t, root, map[string]string{
+		"1000/aaa/file.txt": "old",
+		"3000/bbb/file.txt": "new",
+	})
+
+	clk := clock.NewMock()
+	clk.Set(time.Unix(3500, 0))
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	cmd := &PruneCommand{clock: clk}
+	_, stdout, _ := cmd.Pipe()
+	if err := cmd.Run(ctx, []string{"--backup-root=" + root, "--backup-max-age=30m"}); err != nil {
+		t.Fatal(err)
+	}
+
+	wantStdout := "Removed " + filepath.Join(root, "1000", "aaa") + " (from 1970-01-01T00:16:40Z)\n"
+	if diff := cmp.Diff(stdout.String(), wantStdout); diff != "" {
+		t.Errorf("stdout was not as expected (-got,+want): %s", diff)
+	}
+
+	got := abctestutil.LoadDir(t, root)
+	want := map[string]string{
+		"3000/bbb/file.txt": "new",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("remaining backups were not as expected (-got,+want): %s", diff)
+	}
+}
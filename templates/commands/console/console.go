@@ -0,0 +1,306 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package console implements the "templates console" subcommand, an
+// interactive prompt for evaluating template expressions.
+package console
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/posener/complete/v2"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/abcxyz/abc-updater/pkg/metrics"
+	"github.com/abcxyz/abc/internal/metricswrap"
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/completion"
+	"github.com/abcxyz/abc/templates/common/input"
+	"github.com/abcxyz/abc/templates/common/registry"
+	"github.com/abcxyz/abc/templates/common/render"
+	"github.com/abcxyz/abc/templates/common/render/gotmpl"
+	"github.com/abcxyz/abc/templates/common/specutil"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/pkg/cli"
+)
+
+const prompt = "abc> "
+
+const helpText = `Type an expression and press enter to evaluate it:
+
+  {{.name | toUpper}}         A line containing "{{" is a Go template
+  name == "foo"               Anything else is a CEL expression, like an "if"
+
+Commands:
+
+  :cel <expr>                 Evaluate <expr> as CEL, even if it contains "{{"
+  :tmpl <text>                Evaluate <text> as a Go template
+  :vars                       Print the variables in scope and their values
+  :set <name>=<value>         Set a variable, like an input, for later expressions
+  :help                       Print this help
+  :quit                       Exit (so does Ctrl-D)
+`
+
+type Command struct {
+	cli.BaseCommand
+	flags ConsoleFlags
+
+	testFS common.FS
+}
+
+// Desc implements cli.Command.
+func (c *Command) Desc() string {
+	return "evaluate Go template and CEL expressions interactively in the scope of a template"
+}
+
+func (c *Command) Help() string {
+	return `
+Usage: {{ COMMAND }} [options] <source>
+
+The {{ COMMAND }} command opens a prompt where you can type Go template strings
+and CEL expressions and see what they evaluate to, with the given template's
+inputs, builtin variables, and functions in scope, just as they'd be during a
+render. It's the fastest way to debug an "if" expression or the use of a
+template function.
+
+The "<source>" is the location of the template, in any of the forms accepted by
+"abc templates render".
+
+The inputs come from --input and --input-file, plus the input defaults. Inputs
+without defaults must be given. Inside the console, ":set name=value" changes a
+variable, and ":help" lists the other commands.
+`
+}
+
+func (c *Command) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+func (c *Command) PredictArgs() complete.Predictor {
+	return completion.Sources()
+}
+
+type runParams struct {
+	fs     common.FS
+	stdin  io.Reader
+	stdout io.Writer
+}
+
+func (c *Command) Run(ctx context.Context, args []string) error {
+	mClient := metrics.FromContext(ctx)
+	cleanup := metricswrap.WriteMetric(ctx, mClient, "command_console", 1)
+	defer cleanup()
+
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	ctx = c.flags.WithLogger(ctx, c.Stderr())
+	fSys := c.testFS
+	if fSys == nil {
+		fSys = &common.RealFS{}
+	}
+	return c.realRun(ctx, &runParams{
+		fs:     fSys,
+		stdin:  c.Stdin(),
+		stdout: c.Stdout(),
+	})
+}
+
+// realRun provides a fakeable interface to test Run.
+func (c *Command) realRun(ctx context.Context, rp *runParams) (rErr error) {
+	tempTracker := tempdir.NewDirTracker(rp.fs, false)
+	defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("os.Getwd(): %w", err)
+	}
+
+	templateDir, err := tempTracker.MkdirTempTracked("", tempdir.TemplateDirNamePart)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	source, err := registry.ResolveSource(cwd, c.flags.Source)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	downloader, err := templatesource.ParseSource(ctx, &templatesource.ParseSourceParams{
+		CWD:             cwd,
+		Source:          source,
+		FlagGitProtocol: c.flags.GitProtocol,
+	})
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	dlMeta, err := downloader.Download(ctx, cwd, templateDir, "")
+	if err != nil {
+		return fmt.Errorf("failed to download/copy template: %w", err)
+	}
+
+	spec, err := specutil.Load(ctx, rp.fs, templateDir, c.flags.Source)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	inputs, err := input.Resolve(ctx, &input.ResolveParams{
+		AcceptDefaults: true,
+		FS:             rp.fs,
+		InputFiles:     c.flags.InputFiles,
+		Inputs:         c.flags.Inputs,
+		Spec:           spec,
+	})
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	scope, err := render.NewScope(&render.ScopeParams{
+		Spec:           spec,
+		Inputs:         inputs,
+		DownloaderVars: dlMeta.Vars,
+	})
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return repl(ctx, scope, rp.stdin, rp.stdout)
+}
+
+// repl reads lines from in and writes what they evaluate to, until in is
+// exhausted or the user quits.
+func repl(ctx context.Context, scope *common.Scope, in io.Reader, out io.Writer) error {
+	fmt.Fprintln(out, `Type an expression to evaluate it, ":help" for help, or ":quit" to exit.`)
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, prompt)
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			break
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if line == ":quit" || line == ":exit" {
+			return nil
+		}
+		result, newScope, err := evalLine(ctx, scope, line)
+		if err != nil {
+			fmt.Fprintf(out, "error: %v\n", err)
+			continue
+		}
+		scope = newScope
+		if result != "" {
+			fmt.Fprintln(out, result)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed reading input: %w", err)
+	}
+	return nil
+}
+
+// evalLine evaluates one line typed into the console. It returns the text to
+// show the user, and the scope to use for later lines, which only changes for
+// ":set".
+func evalLine(ctx context.Context, scope *common.Scope, line string) (string, *common.Scope, error) {
+	cmd, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	switch cmd {
+	case ":help":
+		return strings.TrimSuffix(helpText, "\n"), scope, nil
+	case ":vars":
+		return formatVars(scope.AllVars()), scope, nil
+	case ":set":
+		name, val, ok := strings.Cut(arg, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return "", nil, fmt.Errorf(`:set needs an argument like "name=value"`)
+		}
+		return "", scope.With(map[string]string{name: val}), nil
+	case ":cel":
+		out, err := evalCEL(ctx, scope, arg)
+		return out, scope, err
+	case ":tmpl":
+		out, err := evalGoTmpl(scope, arg)
+		return out, scope, err
+	}
+	if strings.HasPrefix(cmd, ":") {
+		return "", nil, fmt.Errorf(`unknown command %q, type ":help" for help`, cmd)
+	}
+	if strings.Contains(line, "{{") {
+		out, err := evalGoTmpl(scope, line)
+		return out, scope, err
+	}
+	out, err := evalCEL(ctx, scope, line)
+	return out, scope, err
+}
+
+// evalGoTmpl returns the output of the given Go template, quoted so that
+// leading and trailing whitespace is visible.
+func evalGoTmpl(scope *common.Scope, tmpl string) (string, error) {
+	out, err := gotmpl.ParseExec(nil, tmpl, scope)
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+	return fmt.Sprintf("%q", out), nil
+}
+
+// evalCEL returns the value of the given CEL expression as JSON, followed by
+// its CEL type, like `["a","b"] (list)`.
+func evalCEL(ctx context.Context, scope *common.Scope, expr string) (string, error) {
+	val, err := common.CelCompileAndEvalValue(ctx, scope, expr)
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+	return fmt.Sprintf("%s (%s)", celJSON(val), val.Type().TypeName()), nil
+}
+
+// celJSON formats a CEL value as JSON, falling back to Go's formatting for
+// values that have no JSON form.
+func celJSON(val ref.Val) string {
+	native, err := val.ConvertToNative(reflect.TypeOf(&structpb.Value{}))
+	if err != nil {
+		return fmt.Sprintf("%v", val.Value())
+	}
+	buf, err := json.Marshal(native.(*structpb.Value).AsInterface()) //nolint:forcetypeassert
+	if err != nil {
+		return fmt.Sprintf("%v", val.Value())
+	}
+	return string(buf)
+}
+
+// formatVars lists the given variables and their values, one per line, sorted
+// by name.
+func formatVars(vars map[string]string) string {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("%s = %q", name, vars[name]))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,226 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package console
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/flags"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestConsoleFlags_Parse(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		args    []string
+		want    ConsoleFlags
+		wantErr string
+	}{
+		{
+			name: "all_flags_present",
+			args: []string{
+				"--git-protocol", "ssh",
+				"--input", "foo=bar",
+				"--input-file", "inputs.yaml",
+				"helloworld@v1",
+			},
+			want: ConsoleFlags{
+				LogFlags: flags.LogFlags{
+					LogFormat: "text",
+					LogLevel:  "warning",
+				},
+				Source:      "helloworld@v1",
+				GitProtocol: "ssh",
+				Inputs:      map[string]string{"foo": "bar"},
+				InputFiles:  []string{"inputs.yaml"},
+			},
+		},
+		{
+			name:    "required_source_is_missing",
+			args:    []string{},
+			wantErr: "missing <source> file",
+		},
+		{
+			name:    "too_many_args",
+			args:    []string{"helloworld@v1", "other@v1"},
+			wantErr: "expected exactly one argument",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var cmd Command
+			cmd.SetLookupEnv(cli.MapLookuper(nil))
+
+			err := cmd.Flags().Parse(tc.args)
+			if err != nil || tc.wantErr != "" {
+				if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+					t.Fatal(diff)
+				}
+				return
+			}
+			if diff := cmp.Diff(cmd.flags, tc.want); diff != "" {
+				t.Errorf("got %#v, want %#v, diff (-got, +want): %v", cmd.flags, tc.want, diff)
+			}
+		})
+	}
+}
+
+func TestRealRun(t *testing.T) {
+	t.Parallel()
+
+	specContents := `api_version: 'cli.abcxyz.dev/v1beta6'
+kind: 'Template'
+desc: 'A template for testing the console'
+inputs:
+  - name: 'service'
+    desc: 'The service name'
+  - name: 'with_readme'
+    desc: 'Whether to include the README'
+    default: 'false'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['.']
+`
+
+	cases := []struct {
+		name       string
+		inputs     map[string]string
+		in         []string
+		wantStdout []string
+		wantErr    string
+	}{
+		{
+			name:   "go_template_and_cel",
+			inputs: map[string]string{"service": "api"},
+			in: []string{
+				`{{.service | toUpper}}-server`,
+				`bool(with_readme) || service == "api"`,
+				`service.split("")`,
+				`:tmpl x {{"{{"}}`,
+				`:cel "{{"`,
+			},
+			wantStdout: []string{
+				`"API-server"`,
+				`true (bool)`,
+				`["a","p","i"] (list)`,
+				`"x {{"`,
+				`"{{" (string)`,
+			},
+		},
+		{
+			name:   "errors_dont_end_the_session",
+			inputs: map[string]string{"service": "api"},
+			in: []string{
+				`nonexistent == "x"`,
+				`{{.nonexistent}}`,
+				`:bogus`,
+				`service`,
+			},
+			wantStdout: []string{
+				`error: the template referenced a nonexistent variable name "nonexistent"`,
+				`error: the template referenced a nonexistent variable name "nonexistent"`,
+				`error: unknown command ":bogus"`,
+				`"api" (string)`,
+			},
+		},
+		{
+			name:   "set_and_vars",
+			inputs: map[string]string{"service": "api"},
+			in: []string{
+				`:set service=web`,
+				`:set bogus`,
+				`:vars`,
+				`:quit`,
+				`service`,
+			},
+			wantStdout: []string{
+				`error: :set needs an argument like "name=value"`,
+				`_git_sha = ""`,
+				`service = "web"`,
+				`with_readme = "false"`,
+			},
+		},
+		{
+			name:    "missing_input",
+			wantErr: "service",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			sourceDir := filepath.Join(t.TempDir(), "source")
+			abctestutil.WriteAll(t, sourceDir, map[string]string{"spec.yaml": specContents})
+
+			stdout := &strings.Builder{}
+			c := &Command{
+				flags: ConsoleFlags{
+					Source: sourceDir,
+					Inputs: tc.inputs,
+				},
+			}
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			err := c.realRun(ctx, &runParams{
+				fs:     &common.RealFS{},
+				stdin:  strings.NewReader(strings.Join(tc.in, "\n")),
+				stdout: stdout,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+
+			for _, want := range tc.wantStdout {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("stdout %q doesn't contain %q", stdout.String(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestEvalLine_SetDoesNotLeak(t *testing.T) {
+	t.Parallel()
+
+	scope := common.NewScope(map[string]string{"x": "1"}, nil)
+	_, newScope, err := evalLine(context.Background(), scope, ":set x=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{scope.AllVars()["x"], newScope.AllVars()["x"]}
+	if diff := cmp.Diff(got, []string{"1", "2"}); diff != "" {
+		t.Errorf("scopes were not as expected (-got,+want): %s", diff)
+	}
+}
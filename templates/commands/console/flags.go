@@ -0,0 +1,66 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package console
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common/flags"
+	"github.com/abcxyz/pkg/cli"
+)
+
+// ConsoleFlags describes the template whose scope the console evaluates
+// expressions in.
+type ConsoleFlags struct {
+	// See common/flags.LogFlags.
+	flags.LogFlags
+
+	// Source is the location of the template.
+	//
+	// Example: github.com/abcxyz/abc/t/rest_server@latest
+	Source string
+
+	// GitProtocol either https or ssh.
+	GitProtocol string
+
+	// See common/flags.Inputs().
+	Inputs map[string]string
+
+	// See common/flags.InputFiles().
+	InputFiles []string
+}
+
+func (r *ConsoleFlags) Register(set *cli.FlagSet) {
+	t := flags.NewSection(set, "TEMPLATE OPTIONS")
+	t.StringMapVar(flags.Inputs(&r.Inputs))
+	t.StringSliceVar(flags.InputFiles(&r.InputFiles))
+
+	g := flags.NewSection(set, "GIT OPTIONS")
+	g.StringVar(flags.GitProtocol(&r.GitProtocol))
+
+	r.LogFlags.Register(set)
+
+	set.AfterParse(func(existingErr error) error {
+		r.Source = strings.TrimSpace(set.Arg(0))
+		if r.Source == "" {
+			return fmt.Errorf("missing <source> file")
+		}
+		if len(set.Args()) > 1 {
+			return fmt.Errorf("expected exactly one argument, the template <source>, but got %q", set.Args())
+		}
+		return nil
+	})
+}
@@ -20,17 +20,21 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	"github.com/posener/complete/v2"
-	"github.com/posener/complete/v2/predict"
 
 	"github.com/abcxyz/abc-updater/pkg/metrics"
 	"github.com/abcxyz/abc/internal/metricswrap"
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/completion"
+	"github.com/abcxyz/abc/templates/common/input"
+	"github.com/abcxyz/abc/templates/common/registry"
+	"github.com/abcxyz/abc/templates/common/render"
 	"github.com/abcxyz/abc/templates/common/specutil"
 	"github.com/abcxyz/abc/templates/common/tempdir"
 	"github.com/abcxyz/abc/templates/common/templatesource"
-	spec "github.com/abcxyz/abc/templates/model/spec/v1beta6"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
 	"github.com/abcxyz/pkg/cli"
 )
 
@@ -43,7 +47,7 @@ type Command struct {
 
 // Desc implements cli.Command.
 func (c *Command) Desc() string {
-	return "show the description and inputs of a given template."
+	return "show the description and inputs of a given template, and optionally its step plan."
 }
 
 func (c *Command) Help() string {
@@ -60,9 +64,16 @@ are accepted:
     - github.com/abcxyz/abc/t/rest_server@latest
     - github.com/abcxyz/abc/t/rest_server@v0.3.1
 - A local directory, like /home/me/mydir
+- An alias from the registry file (~/.abc/registry.yaml, or the file named
+  by $ABC_REGISTRY_FILE), like "rest_server"
 - (Deprecated) A go-getter-style location, with or without ?ref=foo. Examples:
     - github.com/abcxyz/abc.git//t/react_template?ref=latest
 	- github.com/abcxyz/abc.git//t/react_template
+
+With --plan, the steps that a render would execute are also printed, using the
+inputs given with --input and --input-file plus the input defaults. For each
+step, the plan shows whether its "if" condition is true, and which files it
+would target. for_each loops are expanded. Nothing is rendered.
 `
 }
 
@@ -73,7 +84,7 @@ func (c *Command) Flags() *cli.FlagSet {
 }
 
 func (c *Command) PredictArgs() complete.Predictor {
-	return predict.Dirs("")
+	return completion.Sources()
 }
 
 type runParams struct {
@@ -89,6 +100,7 @@ func (c *Command) Run(ctx context.Context, args []string) error {
 	if err := c.Flags().Parse(args); err != nil {
 		return fmt.Errorf("failed to parse flags: %w", err)
 	}
+	ctx = c.flags.WithLogger(ctx, c.Stderr())
 	fSys := c.testFS
 	if fSys == nil {
 		fSys = &common.RealFS{}
@@ -113,16 +125,21 @@ func (c *Command) realRun(ctx context.Context, rp *runParams) (rErr error) {
 	if err != nil {
 		return err //nolint:wrapcheck
 	}
+	source, err := registry.ResolveSource(cwd, c.flags.Source)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
 	downloader, err := templatesource.ParseSource(ctx, &templatesource.ParseSourceParams{
 		CWD:             cwd,
-		Source:          c.flags.Source,
+		Source:          source,
 		FlagGitProtocol: c.flags.GitProtocol,
 	})
 	if err != nil {
 		return err //nolint:wrapcheck
 	}
 
-	if _, err = downloader.Download(ctx, cwd, templateDir, ""); err != nil {
+	dlMeta, err := downloader.Download(ctx, cwd, templateDir, "")
+	if err != nil {
 		return fmt.Errorf("failed to download/copy template: %w", err)
 	}
 
@@ -132,9 +149,58 @@ func (c *Command) realRun(ctx context.Context, rp *runParams) (rErr error) {
 	}
 
 	specutil.FormatAttrs(c.Stdout(), c.specFieldsForDescribe(spec))
+
+	if !c.flags.Plan {
+		return nil
+	}
+	inputs, err := input.Resolve(ctx, &input.ResolveParams{
+		AcceptDefaults: true,
+		FS:             rp.fs,
+		InputFiles:     c.flags.InputFiles,
+		Inputs:         c.flags.Inputs,
+		Spec:           spec,
+	})
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	steps, err := render.Plan(ctx, &render.PlanParams{
+		Spec:           spec,
+		Inputs:         inputs,
+		DownloaderVars: dlMeta.Vars,
+	})
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	fmt.Fprintf(rp.stdout, "\nPlan:\n")
+	writePlan(rp.stdout, steps)
 	return nil
 }
 
+// writePlan prints one line per planned step, followed by the files that the
+// step targets.
+func writePlan(w io.Writer, steps []*render.PlannedStep) {
+	for _, s := range steps {
+		indent := strings.Repeat("  ", strings.Count(s.Number, "."))
+		line := fmt.Sprintf("%s%s. %s", indent, s.Number, s.Action)
+		if s.Desc != "" {
+			line += fmt.Sprintf(" (%s)", s.Desc)
+		}
+		if s.Iteration != "" {
+			line += fmt.Sprintf(" [%s]", s.Iteration)
+		}
+		switch {
+		case !s.Runs:
+			line += fmt.Sprintf(": skipped, if %q is false", s.If)
+		case s.If != "":
+			line += fmt.Sprintf(": runs, if %q is true", s.If)
+		}
+		fmt.Fprintf(w, "%s\n", line)
+		for _, t := range s.Targets {
+			fmt.Fprintf(w, "%s     %s\n", indent, t)
+		}
+	}
+}
+
 // specFieldsForDescribe get Description and Inputs fields for spec.
 func (c *Command) specFieldsForDescribe(spec *spec.Spec) [][]string {
 	l := make([][]string, 0)
@@ -16,6 +16,7 @@ package describe
 
 import (
 	"context"
+	"io"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -23,7 +24,8 @@ import (
 	"github.com/google/go-cmp/cmp"
 
 	"github.com/abcxyz/abc/templates/common"
-	spec "github.com/abcxyz/abc/templates/model/spec/v1beta6"
+	"github.com/abcxyz/abc/templates/common/flags"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
 	abctestutil "github.com/abcxyz/abc/templates/testutil"
 	mdl "github.com/abcxyz/abc/templates/testutil/model"
 	"github.com/abcxyz/pkg/cli"
@@ -47,8 +49,13 @@ func TestDescribeFlags_Parse(t *testing.T) {
 				"helloworld@v1",
 			},
 			want: DescribeFlags{
+				LogFlags: flags.LogFlags{
+					LogFormat: "text",
+					LogLevel:  "warning",
+				},
 				Source:      "helloworld@v1",
 				GitProtocol: "https",
+				Inputs:      map[string]string{},
 			},
 		},
 		{
@@ -57,10 +64,43 @@ func TestDescribeFlags_Parse(t *testing.T) {
 				"helloworld@v1",
 			},
 			want: DescribeFlags{
+				LogFlags: flags.LogFlags{
+					LogFormat: "text",
+					LogLevel:  "warning",
+				},
+				Source:      "helloworld@v1",
+				GitProtocol: "https",
+				Inputs:      map[string]string{},
+			},
+		},
+		{
+			name: "plan_with_inputs",
+			args: []string{
+				"--plan",
+				"--input", "foo=bar",
+				"--input-file", "inputs.yaml",
+				"helloworld@v1",
+			},
+			want: DescribeFlags{
+				LogFlags: flags.LogFlags{
+					LogFormat: "text",
+					LogLevel:  "warning",
+				},
 				Source:      "helloworld@v1",
 				GitProtocol: "https",
+				Plan:        true,
+				Inputs:      map[string]string{"foo": "bar"},
+				InputFiles:  []string{"inputs.yaml"},
 			},
 		},
+		{
+			name: "inputs_without_plan",
+			args: []string{
+				"--input", "foo=bar",
+				"helloworld@v1",
+			},
+			wantErr: "--input and --input-file can only be used with --plan",
+		},
 		{
 			name:    "required_source_is_missing",
 			args:    []string{},
@@ -186,6 +226,123 @@ steps:
 	}
 }
 
+func TestRealRun_Plan(t *testing.T) {
+	t.Parallel()
+
+	specContents := `
+api_version: 'cli.abcxyz.dev/v1beta6'
+kind: 'Template'
+desc: 'Test Description'
+inputs:
+  - name: 'with_readme'
+    desc: 'whether to include the README'
+    default: 'false'
+  - name: 'service'
+    desc: 'the service name'
+steps:
+  - desc: 'Include the main file'
+    action: 'include'
+    params:
+      paths:
+        - paths: ['main.go']
+          as: ['cmd/{{.service}}/main.go']
+  - desc: 'Include the README'
+    if: 'bool(with_readme)'
+    action: 'include'
+    params:
+      paths: ['README.md']
+  - desc: 'Per environment'
+    action: 'for_each'
+    params:
+      iterator:
+        key: 'env'
+        values: ['dev', 'prod']
+      steps:
+        - desc: 'Template the config'
+          action: 'go_template'
+          params:
+            paths: ['config/{{.env}}.yaml']
+`
+
+	cases := []struct {
+		name       string
+		inputs     map[string]string
+		wantStdout string
+		wantErr    string
+	}{
+		{
+			name:   "readme_skipped",
+			inputs: map[string]string{"service": "foo"},
+			wantStdout: `
+Plan:
+1. include (Include the main file)
+     cmd/foo/main.go
+2. include (Include the README): skipped, if "bool(with_readme)" is false
+3. for_each (Per environment)
+  3.1. go_template (Template the config) [env=dev]
+       config/dev.yaml
+  3.1. go_template (Template the config) [env=prod]
+       config/prod.yaml
+`,
+		},
+		{
+			name:   "readme_included",
+			inputs: map[string]string{"service": "foo", "with_readme": "true"},
+			wantStdout: `
+Plan:
+1. include (Include the main file)
+     cmd/foo/main.go
+2. include (Include the README): runs, if "bool(with_readme)" is true
+     README.md
+3. for_each (Per environment)
+  3.1. go_template (Template the config) [env=dev]
+       config/dev.yaml
+  3.1. go_template (Template the config) [env=prod]
+       config/prod.yaml
+`,
+		},
+		{
+			name:    "missing_input",
+			inputs:  map[string]string{},
+			wantErr: "missing input(s): service",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			sourceDir := t.TempDir()
+			abctestutil.WriteAll(t, sourceDir, map[string]string{"spec.yaml": specContents})
+			stdoutBuf := &strings.Builder{}
+			r := &Command{
+				flags: DescribeFlags{
+					Source: sourceDir,
+					Plan:   true,
+					Inputs: tc.inputs,
+				},
+			}
+			r.SetStdout(io.Discard)
+
+			rp := &runParams{
+				stdout: stdoutBuf,
+				fs:     &common.RealFS{},
+			}
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			err := r.realRun(ctx, rp)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(stdoutBuf.String(), tc.wantStdout); diff != "" {
+				t.Errorf("stdout was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
 func Test_SpecFieldsForDescribe(t *testing.T) {
 	t.Parallel()
 	cases := []struct {
@@ -24,6 +24,9 @@ import (
 
 // DescribeFlags describes what template to describe.
 type DescribeFlags struct {
+	// See common/flags.LogFlags.
+	flags.LogFlags
+
 	// Source is the location of the input template to be rendered.
 	//
 	// Example: github.com/abcxyz/abc/t/rest_server@latest
@@ -31,18 +34,44 @@ type DescribeFlags struct {
 
 	// GitProtocol either https or ssh.
 	GitProtocol string
+
+	// Plan prints the steps that would execute for the given inputs.
+	Plan bool
+
+	// See common/flags.Inputs(). Only used with --plan.
+	Inputs map[string]string
+
+	// See common/flags.InputFiles(). Only used with --plan.
+	InputFiles []string
 }
 
 func (r *DescribeFlags) Register(set *cli.FlagSet) {
-	g := set.NewSection("GIT OPTIONS")
+	g := flags.NewSection(set, "GIT OPTIONS")
 	g.StringVar(flags.GitProtocol(&r.GitProtocol))
 
+	p := flags.NewSection(set, "PLAN OPTIONS")
+	p.BoolVar(&cli.BoolVar{
+		Name:    "plan",
+		Target:  &r.Plan,
+		Default: false,
+		Usage: "Also print the steps that would execute for the given inputs, " +
+			"with their resolved if conditions and the files they target, " +
+			"without rendering anything.",
+	})
+	p.StringMapVar(flags.Inputs(&r.Inputs))
+	p.StringSliceVar(flags.InputFiles(&r.InputFiles))
+
+	r.LogFlags.Register(set)
+
 	// Default source to the first CLI argument, if given
 	set.AfterParse(func(existingErr error) error {
 		r.Source = strings.TrimSpace(set.Arg(0))
 		if r.Source == "" {
 			return fmt.Errorf("missing <source> file")
 		}
+		if !r.Plan && (len(r.Inputs) > 0 || len(r.InputFiles) > 0) {
+			return fmt.Errorf("--input and --input-file can only be used with --plan")
+		}
 
 		return nil
 	})
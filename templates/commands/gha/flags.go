@@ -0,0 +1,160 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gha
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/posener/complete/v2/predict"
+
+	"github.com/abcxyz/abc/templates/common/flags"
+	"github.com/abcxyz/pkg/cli"
+)
+
+// Flags are the options for "abc gha". Each one can also be set by the
+// INPUT_* environment variable that GitHub Actions sets for an action input of
+// the same name, with dashes replaced by underscores.
+type Flags struct {
+	// See common/flags.LogFlags.
+	flags.LogFlags
+
+	// The directory or manifest to upgrade.
+	Location string
+
+	// See common/flags.AcceptDefaults().
+	AcceptDefaults bool
+
+	// Whether merge conflicts and patch reversal conflicts fail the step.
+	FailOnConflict bool
+
+	// See common/flags.GitProtocol().
+	GitProtocol string
+
+	// Template input values, one KEY=VALUE per line, parsed into Inputs.
+	InputsText string
+	Inputs     map[string]string
+
+	// Same as in the upgrade command.
+	ManifestFilter   string
+	TemplateLocation string
+	UpgradeChannel   string
+	Version          string
+}
+
+func (f *Flags) Register(set *cli.FlagSet) {
+	g := flags.NewSection(set, "GITHUB ACTION OPTIONS")
+
+	g.StringVar(&cli.StringVar{
+		Name:    "location",
+		Example: "./some/dir",
+		Default: ".",
+		Predict: predict.Files(""),
+		EnvVar:  "INPUT_LOCATION",
+		Target:  &f.Location,
+		Usage:   "the directory to search for template installations to upgrade, or the path to a single manifest",
+	})
+	g.StringVar(&cli.StringVar{
+		Name:    "inputs",
+		Example: "project_id=my-project",
+		EnvVar:  "INPUT_INPUTS",
+		Target:  &f.InputsText,
+		Usage:   "template input values, one KEY=VALUE per line; these override the values saved in the manifest",
+	})
+	g.BoolVar(&cli.BoolVar{
+		Name:    "accept-defaults",
+		EnvVar:  "INPUT_ACCEPT_DEFAULTS",
+		Target:  &f.AcceptDefaults,
+		Default: false,
+		Usage:   "use the default value of any template input that wasn't provided, rather than failing",
+	})
+	g.BoolVar(&cli.BoolVar{
+		Name:    "fail-on-conflict",
+		EnvVar:  "INPUT_FAIL_ON_CONFLICT",
+		Target:  &f.FailOnConflict,
+		Default: true,
+		Usage:   "exit with a nonzero exit code if the upgrade left conflicts to resolve; set this to false to open a pull request with the conflicts instead",
+	})
+	g.StringVar(&cli.StringVar{
+		Name:    "version",
+		Example: "main",
+		EnvVar:  "INPUT_VERSION",
+		Target:  &f.Version,
+		Usage:   "for remote templates, the version to upgrade to; may be a git tag, branch, or SHA",
+	})
+	g.StringVar(&cli.StringVar{
+		Name:    "template-location",
+		Example: "github.com/abcxyz/abc/t/rest_server@mybranch",
+		EnvVar:  "INPUT_TEMPLATE_LOCATION",
+		Target:  &f.TemplateLocation,
+		Usage:   "upgrade to the template at this location, rather than the one stored in the manifest",
+	})
+	g.StringVar(&cli.StringVar{
+		Name:   "upgrade-channel",
+		EnvVar: "INPUT_UPGRADE_CHANNEL",
+		Target: &f.UpgradeChannel,
+		Usage:  `overrides the "upgrade_channel" field in the output manifest; either a branch name or "latest"`,
+	})
+	g.StringVar(&cli.StringVar{
+		Name:    "manifest-filter",
+		Example: `template_location == "github.com/abcxyz/abc/examples/templates/render/hello_jupiter"`,
+		EnvVar:  "INPUT_MANIFEST_FILTER",
+		Target:  &f.ManifestFilter,
+		Usage:   "a CEL expression that's evaluated against each manifest that's found; only those where it's true are upgraded",
+	})
+	g.StringVar(&cli.StringVar{
+		Name:    "git-protocol",
+		Example: "https",
+		Default: "https",
+		Predict: predict.Set([]string{"https", "ssh"}),
+		EnvVar:  "INPUT_GIT_PROTOCOL",
+		Target:  &f.GitProtocol,
+		Usage:   "either ssh or https, the protocol for connecting to git",
+	})
+
+	f.LogFlags.Register(set)
+
+	set.AfterParse(func(existingErr error) error {
+		// GitHub sets an INPUT_* variable for every input that the action
+		// declares, even if the workflow didn't set it, so empty means unset.
+		if f.Location == "" {
+			f.Location = "."
+		}
+		if f.GitProtocol == "" {
+			f.GitProtocol = "https"
+		}
+
+		var err error
+		f.Inputs, err = parseInputs(f.InputsText)
+		return err
+	})
+}
+
+// parseInputs parses lines of KEY=VALUE, ignoring blank lines.
+func parseInputs(s string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid template input %q, it must be of the form KEY=VALUE", line)
+		}
+		out[k] = v
+	}
+	return out, nil
+}
@@ -0,0 +1,225 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gha implements the "abc gha" command, which runs upgrades from a
+// GitHub Actions workflow.
+package gha
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/benbjohnson/clock"
+
+	"github.com/abcxyz/abc-updater/pkg/metrics"
+	"github.com/abcxyz/abc/internal/metricswrap"
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/upgrade"
+	"github.com/abcxyz/pkg/cli"
+)
+
+// Command implements cli.Command for running upgrades as a GitHub Action.
+type Command struct {
+	cli.BaseCommand
+	flags Flags
+}
+
+// Desc implements cli.Command.
+func (c *Command) Desc() string {
+	return "upgrade template installations from a GitHub Actions workflow"
+}
+
+// Help implements cli.Command.
+func (c *Command) Help() string {
+	return `
+Usage: {{ COMMAND }} [options]
+
+The {{ COMMAND }} command is an entrypoint for GitHub Actions. It upgrades the
+template installations under --location, like "abc upgrade", but never prompts,
+and reads its options from the INPUT_* environment variables that GitHub sets
+for action inputs.
+
+When it finishes, it sets these step outputs in $GITHUB_OUTPUT:
+
+  result          the overall upgrade result, like "success" or
+                  "merge_conflict", or "error"
+  changed_files   the files that were written or deleted, one per line
+  conflict_files  the files that need manual conflict resolution, one per line
+  has_changes     "true" if any file was changed or has a conflict
+
+It also writes a markdown summary of the upgrade to $GITHUB_STEP_SUMMARY.
+`
+}
+
+// Flags implements cli.Command.
+func (c *Command) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+func (c *Command) Run(ctx context.Context, args []string) error {
+	mClient := metrics.FromContext(ctx)
+	cleanup := metricswrap.WriteMetric(ctx, mClient, "command_gha", 1)
+	defer cleanup()
+
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	ctx = c.flags.WithLogger(ctx, c.Stderr())
+
+	wd, err := c.WorkingDir()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+	absLocation := c.flags.Location
+	if !filepath.IsAbs(absLocation) {
+		absLocation = filepath.Join(wd, absLocation)
+	}
+
+	result := upgrade.UpgradeAll(ctx, &upgrade.Params{
+		AcceptDefaults:   c.flags.AcceptDefaults,
+		Clock:            clock.New(),
+		CWD:              wd,
+		FS:               &common.RealFS{},
+		GitProtocol:      c.flags.GitProtocol,
+		InputsFromFlags:  c.flags.Inputs,
+		Location:         absLocation,
+		ManifestFilter:   c.flags.ManifestFilter,
+		Stdout:           c.Stdout(),
+		TemplateLocation: c.flags.TemplateLocation,
+		UpgradeChannel:   c.flags.UpgradeChannel,
+		Version:          c.flags.Version,
+	})
+
+	// Paths in the report are relative to the root of the repo, which is where
+	// GitHub expects annotations' file paths to start.
+	workspace := c.GetEnv("GITHUB_WORKSPACE")
+	if workspace == "" {
+		workspace = wd
+	}
+	rep := newReport(result, workspace, absLocation)
+	if err := c.writeOutputs(rep); err != nil {
+		return err
+	}
+	if err := c.writeSummary(rep); err != nil {
+		return err
+	}
+	rep.writeAnnotations(c.Stdout())
+
+	if result.Err != nil {
+		if result.ErrManifestPath != "" {
+			return fmt.Errorf("when upgrading the manifest at %s:\n%w",
+				result.ErrManifestPath, result.Err)
+		}
+		return result.Err
+	}
+
+	if result.Overall == upgrade.SourceUnavailable {
+		return &common.ExitCodeError{Code: common.ExitCodeDownload}
+	}
+	if !c.flags.FailOnConflict {
+		return nil
+	}
+	switch result.Overall {
+	case upgrade.MergeConflict:
+		return &common.ExitCodeError{Code: common.ExitCodeMergeConflict}
+	case upgrade.PatchReversalConflict:
+		return &common.ExitCodeError{Code: common.ExitCodePatchReversalConflict}
+	case upgrade.AlreadyUpToDate, upgrade.Success, upgrade.SourceUnavailable:
+	}
+	return nil
+}
+
+// writeOutputs appends the step outputs to the $GITHUB_OUTPUT file, if it's
+// set.
+func (c *Command) writeOutputs(rep *report) error {
+	path := c.GetEnv("GITHUB_OUTPUT")
+	if path == "" {
+		return nil
+	}
+
+	changed := make([]string, 0, len(rep.changed))
+	for _, f := range rep.changed {
+		changed = append(changed, f.path)
+	}
+	conflicts := make([]string, 0, len(rep.conflicts))
+	for _, f := range rep.conflicts {
+		conflicts = append(conflicts, f.path)
+	}
+
+	var sb strings.Builder
+	for _, o := range []struct{ name, value string }{
+		{"result", rep.result},
+		{"changed_files", strings.Join(changed, "\n")},
+		{"conflict_files", strings.Join(conflicts, "\n")},
+		{"has_changes", fmt.Sprint(len(changed)+len(conflicts) > 0)},
+	} {
+		if err := writeOutput(&sb, o.name, o.value); err != nil {
+			return err
+		}
+	}
+	return appendFile(path, sb.String())
+}
+
+// writeOutput writes one output in the format that GitHub expects in the
+// $GITHUB_OUTPUT file. Multiline values are written as a heredoc with a random
+// delimiter, so that a file name can't end the value early.
+func writeOutput(w io.Writer, name, value string) error {
+	if !strings.Contains(value, "\n") {
+		_, err := fmt.Fprintf(w, "%s=%s\n", name, value)
+		return err //nolint:wrapcheck
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Errorf("failed generating output delimiter: %w", err)
+	}
+	delim := "ghadelimiter_" + hex.EncodeToString(buf)
+	_, err := fmt.Fprintf(w, "%s<<%s\n%s\n%s\n", name, delim, value, delim)
+	return err //nolint:wrapcheck
+}
+
+// writeSummary appends a markdown summary of the upgrade to the
+// $GITHUB_STEP_SUMMARY file if it's set, or otherwise prints it.
+func (c *Command) writeSummary(rep *report) error {
+	summary := rep.markdown()
+	path := c.GetEnv("GITHUB_STEP_SUMMARY")
+	if path == "" {
+		fmt.Fprint(c.Stdout(), summary)
+		return nil
+	}
+	return appendFile(path, summary)
+}
+
+func appendFile(path, contents string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, common.OwnerRWPerms)
+	if err != nil {
+		return fmt.Errorf("failed opening %q: %w", path, err)
+	}
+	if _, err := f.WriteString(contents); err != nil {
+		f.Close()
+		return fmt.Errorf("failed writing %q: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed closing %q: %w", path, err)
+	}
+	return nil
+}
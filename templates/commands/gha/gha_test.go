@@ -0,0 +1,311 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gha
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/render"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestCommand(t *testing.T) {
+	t.Parallel()
+
+	includeDotSpec := `
+api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'my template'
+inputs:
+  - name: 'animal'
+    desc: 'An animal name'
+    default: 'dog'
+steps:
+  - desc: 'include .'
+    action: 'include'
+    params:
+      paths: ['.']
+  - desc: 'Append animal name'
+    action: 'append'
+    params:
+      paths: ['animal.txt']
+      with: '{{.animal}}'
+`
+
+	cases := []struct {
+		name             string
+		env              map[string]string
+		localEdits       map[string]string
+		upgradedTemplate map[string]string
+
+		wantExitCode int
+		wantErr      string
+		wantOutputs  string
+		wantSummary  string
+	}{
+		{
+			name: "success",
+			upgradedTemplate: map[string]string{
+				"spec.yaml":  includeDotSpec,
+				"greet.txt":  "hello, venus\n",
+				"color.txt":  "blue\n",
+				"animal.txt": "",
+			},
+			wantOutputs: `result=success
+changed_files<<DELIM
+dest_dir/color.txt
+dest_dir/greet.txt
+DELIM
+conflict_files=
+has_changes=true
+`,
+			wantSummary: "## abc upgrade: success\n\n" +
+				"| Manifest | Template version | Result |\n" +
+				"| --- | --- | --- |\n" +
+				"| `dest_dir/.abc/MANIFEST` | `SHA` | success |\n\n" +
+				"### Changed files\n\n" +
+				"| File | Action |\n" +
+				"| --- | --- |\n" +
+				"| `dest_dir/color.txt` | writeNew |\n" +
+				"| `dest_dir/greet.txt` | writeNew |\n\n",
+		},
+		{
+			name: "inputs_from_env",
+			env:  map[string]string{"INPUT_INPUTS": "animal=cat\n"},
+			upgradedTemplate: map[string]string{
+				"spec.yaml":  includeDotSpec,
+				"greet.txt":  "hello, world\n",
+				"animal.txt": "",
+			},
+			wantOutputs: `result=success
+changed_files=dest_dir/animal.txt
+conflict_files=
+has_changes=true
+`,
+		},
+		{
+			name: "conflict",
+			localEdits: map[string]string{
+				"greet.txt": "hello, mars\n",
+			},
+			upgradedTemplate: map[string]string{
+				"spec.yaml":  includeDotSpec,
+				"greet.txt":  "hello, venus\n",
+				"animal.txt": "",
+			},
+			wantExitCode: common.ExitCodeMergeConflict,
+			wantOutputs: `result=merge_conflict
+changed_files=
+conflict_files=dest_dir/greet.txt
+has_changes=true
+`,
+			wantSummary: "## abc upgrade: merge_conflict\n\n" +
+				"| Manifest | Template version | Result |\n" +
+				"| --- | --- | --- |\n" +
+				"| `dest_dir/.abc/MANIFEST` | `SHA` | merge_conflict |\n\n" +
+				"### Conflicts\n\n" +
+				"| File | Conflict | Local version | Template version |\n" +
+				"| --- | --- | --- | --- |\n" +
+				"| `dest_dir/greet.txt` | editEditConflict |  | `dest_dir/greet.abcmerge_from_new_template.txt` |\n\n",
+		},
+		{
+			name: "conflict_without_failing",
+			env:  map[string]string{"INPUT_FAIL_ON_CONFLICT": "false"},
+			localEdits: map[string]string{
+				"greet.txt": "hello, mars\n",
+			},
+			upgradedTemplate: map[string]string{
+				"spec.yaml":  includeDotSpec,
+				"greet.txt":  "hello, venus\n",
+				"animal.txt": "",
+			},
+			wantOutputs: `result=merge_conflict
+changed_files=
+conflict_files=dest_dir/greet.txt
+has_changes=true
+`,
+		},
+		{
+			name: "error",
+			upgradedTemplate: map[string]string{
+				"spec.yaml": "this isn't a valid spec",
+			},
+			wantErr: "error reading template spec file",
+			wantOutputs: `result=error
+changed_files=
+conflict_files=
+has_changes=false
+`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempBase := t.TempDir()
+			destDir := filepath.Join(tempBase, "dest_dir")
+			templateDir := filepath.Join(tempBase, "template_dir")
+			abctestutil.WriteAll(t, tempBase, abctestutil.WithGitRepoAt("", nil))
+			abctestutil.WriteAll(t, templateDir, map[string]string{
+				"spec.yaml":  includeDotSpec,
+				"greet.txt":  "hello, world\n",
+				"animal.txt": "",
+			})
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			downloader, err := templatesource.ParseSource(ctx, &templatesource.ParseSourceParams{
+				CWD:    tempBase,
+				Source: templateDir,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			renderResult, err := render.Render(ctx, &render.Params{
+				AcceptDefaults: true,
+				Clock:          clock.NewMock(),
+				Cwd:            tempBase,
+				DestDir:        destDir,
+				Downloader:     downloader,
+				FS:             &common.RealFS{},
+				OutDir:         destDir,
+				TempDirBase:    tempBase,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			abctestutil.WriteAll(t, destDir, tc.localEdits)
+
+			if err := os.RemoveAll(templateDir); err != nil {
+				t.Fatal(err)
+			}
+			abctestutil.WriteAll(t, templateDir, tc.upgradedTemplate)
+
+			outputPath := filepath.Join(tempBase, "github_output")
+			summaryPath := filepath.Join(tempBase, "github_step_summary")
+			env := map[string]string{
+				// GitHub sets a variable for every input, even if it's empty.
+				"INPUT_LOCATION":         destDir,
+				"INPUT_INPUTS":           "",
+				"INPUT_ACCEPT_DEFAULTS":  "true",
+				"INPUT_FAIL_ON_CONFLICT": "",
+				"INPUT_GIT_PROTOCOL":     "",
+				"GITHUB_OUTPUT":          outputPath,
+				"GITHUB_STEP_SUMMARY":    summaryPath,
+				"GITHUB_WORKSPACE":       tempBase,
+			}
+			for k, v := range tc.env {
+				env[k] = v
+			}
+
+			cmd := &Command{}
+			cmd.SetLookupEnv(func(key string) (string, bool) {
+				v, ok := env[key]
+				return v, ok
+			})
+			var stdout bytes.Buffer
+			cmd.SetStdout(&stdout)
+
+			err = cmd.Run(ctx, nil)
+			if tc.wantExitCode != 0 {
+				if got := common.ExitCodeOf(err); got != tc.wantExitCode {
+					t.Errorf("got exit code %d, want %d", got, tc.wantExitCode)
+				}
+			} else if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+
+			manifestName := filepath.Base(renderResult.ManifestPath)
+			clean := func(s string) string {
+				s = strings.ReplaceAll(s, manifestName, "MANIFEST")
+				s = regexp.MustCompile(`\b[0-9a-f]{40}\b`).ReplaceAllString(s, "SHA")
+				return regexp.MustCompile(`ghadelimiter_[0-9a-f]+`).ReplaceAllString(s, "DELIM")
+			}
+
+			gotOutputs, err := os.ReadFile(outputPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(clean(string(gotOutputs)), tc.wantOutputs); diff != "" {
+				t.Errorf("$GITHUB_OUTPUT was not as expected (-got,+want): %s", diff)
+			}
+
+			if tc.wantSummary != "" {
+				gotSummary, err := os.ReadFile(summaryPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(clean(string(gotSummary)), tc.wantSummary); diff != "" {
+					t.Errorf("$GITHUB_STEP_SUMMARY was not as expected (-got,+want): %s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestParseInputs(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		in      string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name: "empty",
+			want: map[string]string{},
+		},
+		{
+			name: "several_lines_with_blanks",
+			in:   "a=1\n\n  b = 2\nc=x=y\n",
+			want: map[string]string{"a": "1", "b ": " 2", "c": "x=y"},
+		},
+		{
+			name:    "missing_equals",
+			in:      "a=1\nb\n",
+			wantErr: `invalid template input "b"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseInputs(tc.in)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("inputs were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gha
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common/upgrade"
+)
+
+// report is what's worth telling the workflow about an upgrade. All paths are
+// relative to the root of the checked out repo, and use forward slashes.
+type report struct {
+	// The overall upgrade result, or "error".
+	result string
+	err    string
+
+	installations []installation
+	changed       []fileChange
+	conflicts     []fileChange
+}
+
+type installation struct {
+	manifest string
+	version  string
+	result   string
+}
+
+type fileChange struct {
+	path string
+
+	// For changes, the action that was taken, like "writeNew". For
+	// conflicts, the kind of conflict.
+	what string
+
+	// For merge conflicts, where the two versions of the file were saved.
+	oursPath     string
+	incomingPath string
+}
+
+func newReport(result *upgrade.Result, workspace, absLocation string) *report {
+	rel := func(path string) string {
+		if r, err := filepath.Rel(workspace, path); err == nil {
+			path = r
+		}
+		return filepath.ToSlash(path)
+	}
+
+	rep := &report{result: result.Overall.String()}
+	if result.Err != nil {
+		rep.result = "error"
+		rep.err = result.Err.Error()
+	}
+
+	for _, r := range result.Results {
+		absManifest := filepath.Join(absLocation, r.ManifestPath)
+		// Manifests are in the .abc directory of the installation.
+		installedDir := filepath.Dir(filepath.Dir(absManifest))
+
+		inst := installation{manifest: rel(absManifest), result: r.Type.String()}
+		if r.DLMeta != nil {
+			inst.version = r.DLMeta.Version
+		}
+		rep.installations = append(rep.installations, inst)
+
+		for _, a := range r.NonConflicts {
+			if a.Action == upgrade.Noop {
+				continue
+			}
+			rep.changed = append(rep.changed, fileChange{
+				path: rel(filepath.Join(installedDir, a.Path)),
+				what: string(a.Action),
+			})
+		}
+		for _, a := range r.MergeConflicts {
+			fc := fileChange{
+				path: rel(filepath.Join(installedDir, a.Path)),
+				what: string(a.Action),
+			}
+			if a.OursPath != "" {
+				fc.oursPath = rel(filepath.Join(installedDir, a.OursPath))
+			}
+			if a.IncomingTemplatePath != "" {
+				fc.incomingPath = rel(filepath.Join(installedDir, a.IncomingTemplatePath))
+			}
+			rep.conflicts = append(rep.conflicts, fc)
+		}
+		for _, rc := range r.ReversalConflicts {
+			rep.conflicts = append(rep.conflicts, fileChange{
+				path:         rel(rc.AbsPath),
+				what:         "patchReversalConflict",
+				incomingPath: rel(rc.RejectedHunks),
+			})
+		}
+	}
+	return rep
+}
+
+// markdown returns the report as markdown for the job summary.
+func (r *report) markdown() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "## abc upgrade: %s\n\n", r.result)
+	if r.err != "" {
+		fmt.Fprintf(&sb, "```\n%s\n```\n\n", r.err)
+	}
+
+	if len(r.installations) == 0 {
+		if r.err == "" {
+			sb.WriteString("No template installations were upgraded.\n\n")
+		}
+	} else {
+		sb.WriteString("| Manifest | Template version | Result |\n")
+		sb.WriteString("| --- | --- | --- |\n")
+		for _, inst := range r.installations {
+			fmt.Fprintf(&sb, "| %s | %s | %s |\n", code(inst.manifest), code(inst.version), inst.result)
+		}
+		sb.WriteString("\n")
+	}
+
+	if len(r.conflicts) > 0 {
+		sb.WriteString("### Conflicts\n\n")
+		sb.WriteString("| File | Conflict | Local version | Template version |\n")
+		sb.WriteString("| --- | --- | --- | --- |\n")
+		for _, c := range r.conflicts {
+			fmt.Fprintf(&sb, "| %s | %s | %s | %s |\n", code(c.path), c.what, code(c.oursPath), code(c.incomingPath))
+		}
+		sb.WriteString("\n")
+	}
+
+	if len(r.changed) > 0 {
+		sb.WriteString("### Changed files\n\n")
+		sb.WriteString("| File | Action |\n")
+		sb.WriteString("| --- | --- |\n")
+		for _, c := range r.changed {
+			fmt.Fprintf(&sb, "| %s | %s |\n", code(c.path), c.what)
+		}
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
+// code formats s as inline code in a markdown table cell, or returns an empty
+// string if s is empty.
+func code(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "`" + strings.ReplaceAll(s, "|", `\|`) + "`"
+}
+
+// writeAnnotations prints workflow commands that make GitHub show the error
+// and each conflict as an annotation.
+func (r *report) writeAnnotations(w io.Writer) {
+	if r.err != "" {
+		fmt.Fprintf(w, "::error title=abc upgrade failed::%s\n", escapeData(r.err))
+	}
+	for _, c := range r.conflicts {
+		fmt.Fprintf(w, "::warning file=%s,title=abc upgrade conflict::%s\n",
+			escapeProperty(c.path), escapeData(c.what+" in "+c.path))
+	}
+}
+
+// escapeData and escapeProperty escape the message and the properties of a
+// workflow command, the same way as the @actions/core toolkit.
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
@@ -0,0 +1,249 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldentest
+
+// This file measures which parts of a template's spec are exercised by its
+// golden tests.
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/specutil"
+	"github.com/abcxyz/abc/templates/model"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
+)
+
+// TestCaseCoverage records what a single golden test exercised.
+type TestCaseCoverage struct {
+	// Executed and Skipped count how many times each step was executed, or
+	// skipped because its "if" expression was false. They're keyed by the
+	// step's position in spec.yaml.
+	Executed map[model.ConfigPos]int
+	Skipped  map[model.ConfigPos]int
+
+	// Inputs are the input values given in the test's test.yaml. Inputs that
+	// took their default values aren't included.
+	Inputs map[string]string
+}
+
+func newTestCaseCoverage(tc *TestCase) *TestCaseCoverage {
+	return &TestCaseCoverage{
+		Executed: make(map[model.ConfigPos]int),
+		Skipped:  make(map[model.ConfigPos]int),
+		Inputs:   varValuesToMap(tc.TestConfig.Inputs),
+	}
+}
+
+// observe is a render.Params.StepObserver.
+func (c *TestCaseCoverage) observe(step *spec.Step, executed bool) {
+	if executed {
+		c.Executed[step.Pos]++
+	} else {
+		c.Skipped[step.Pos]++
+	}
+}
+
+// TemplateCoverage summarizes which parts of a template's spec were exercised
+// by its golden tests.
+type TemplateCoverage struct {
+	// TemplateDir is the absolute path of the template.
+	TemplateDir string
+
+	// Steps are every step in the spec, including steps nested inside
+	// for_each, in the order they appear in spec.yaml.
+	Steps []*StepCoverage
+
+	// Inputs are the spec's inputs, with the values that the tests used.
+	Inputs []*InputCoverage
+
+	// InputCombinations is the number of distinct combinations of input
+	// values among the tests.
+	InputCombinations int
+
+	// Tests is the number of golden tests that were measured.
+	Tests int
+}
+
+// StepCoverage says how many golden tests exercised a single step.
+type StepCoverage struct {
+	Pos    model.ConfigPos
+	Action string
+	Desc   string
+
+	// If is the step's "if" expression, or empty if it doesn't have one.
+	If string
+
+	// ExecutedBy and SkippedBy are the number of tests in which the step was
+	// executed at least once, or skipped at least once because its "if"
+	// expression was false.
+	ExecutedBy int
+	SkippedBy  int
+}
+
+// InputCoverage lists the values that the golden tests used for an input.
+type InputCoverage struct {
+	Name string
+
+	// Values are the distinct values, sorted. A test that didn't give a value
+	// for the input is counted as defaultValue.
+	Values []string
+}
+
+// defaultValue is shown in a coverage report for tests where an input took its
+// default value.
+const defaultValue = "<default>"
+
+// Percent returns the percentage of coverage points that were hit. Every step
+// has one point for being executed, and a step with an "if" expression has a
+// second point for being skipped, so that both outcomes of every "if" must be
+// tested for full coverage. A spec with no steps has full coverage.
+func (c *TemplateCoverage) Percent() float64 {
+	var hit, total int
+	for _, s := range c.Steps {
+		total++
+		if s.ExecutedBy > 0 {
+			hit++
+		}
+		if s.If != "" {
+			total++
+			if s.SkippedBy > 0 {
+				hit++
+			}
+		}
+	}
+	if total == 0 {
+		return 100
+	}
+	return 100 * float64(hit) / float64(total)
+}
+
+// SummarizeCoverage combines the coverage of each golden test in results into
+// a coverage summary per template, sorted by template directory. Results
+// without coverage information are ignored; coverage is only collected when
+// RunAllParams.Coverage is true, and isn't collected for upgrade tests.
+func SummarizeCoverage(ctx context.Context, results []*Result) ([]*TemplateCoverage, error) {
+	byTemplate := make(map[string][]*TestCaseCoverage)
+	for _, r := range results {
+		if r.Coverage != nil {
+			byTemplate[r.TemplateDir] = append(byTemplate[r.TemplateDir], r.Coverage)
+		}
+	}
+
+	out := make([]*TemplateCoverage, 0, len(byTemplate))
+	for templateDir, covs := range byTemplate {
+		s, err := specutil.Load(ctx, &common.RealFS{}, templateDir, templateDir)
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+		out = append(out, summarizeTemplate(templateDir, s, covs))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].TemplateDir < out[j].TemplateDir
+	})
+	return out, nil
+}
+
+func summarizeTemplate(templateDir string, s *spec.Spec, covs []*TestCaseCoverage) *TemplateCoverage {
+	out := &TemplateCoverage{
+		TemplateDir: templateDir,
+		Tests:       len(covs),
+	}
+
+	var walk func(steps []*spec.Step)
+	walk = func(steps []*spec.Step) {
+		for _, step := range steps {
+			sc := &StepCoverage{
+				Pos:    step.Pos,
+				Action: step.Action.Val,
+				Desc:   step.Desc.Val,
+				If:     step.If.Val,
+			}
+			for _, cov := range covs {
+				if cov.Executed[step.Pos] > 0 {
+					sc.ExecutedBy++
+				}
+				if cov.Skipped[step.Pos] > 0 {
+					sc.SkippedBy++
+				}
+			}
+			out.Steps = append(out.Steps, sc)
+			if step.ForEach != nil {
+				walk(step.ForEach.Steps)
+			}
+		}
+	}
+	walk(s.Steps)
+
+	combinations := make(map[string]struct{})
+	for _, cov := range covs {
+		var sb strings.Builder
+		for _, input := range s.Inputs {
+			v, ok := cov.Inputs[input.Name.Val]
+			if !ok {
+				v = defaultValue
+			}
+			fmt.Fprintf(&sb, "%q=%q;", input.Name.Val, v)
+		}
+		combinations[sb.String()] = struct{}{}
+	}
+	out.InputCombinations = len(combinations)
+
+	for _, input := range s.Inputs {
+		values := make(map[string]struct{})
+		for _, cov := range covs {
+			v, ok := cov.Inputs[input.Name.Val]
+			if !ok {
+				v = defaultValue
+			}
+			values[v] = struct{}{}
+		}
+		ic := &InputCoverage{Name: input.Name.Val}
+		for v := range values {
+			ic.Values = append(ic.Values, v)
+		}
+		sort.Strings(ic.Values)
+		out.Inputs = append(out.Inputs, ic)
+	}
+
+	return out
+}
+
+// writeCoverage writes a human-readable coverage report to w.
+func writeCoverage(w io.Writer, covs []*TemplateCoverage) {
+	for _, c := range covs {
+		fmt.Fprintf(w, "coverage for template location [%s]: %.1f%% of steps and \"if\" branches, from %d golden tests\n",
+			c.TemplateDir, c.Percent(), c.Tests)
+		for _, s := range c.Steps {
+			desc := fmt.Sprintf("line %d: %s step %q", s.Pos.Line, s.Action, s.Desc)
+			switch {
+			case s.ExecutedBy == 0:
+				fmt.Fprintf(w, "  %s was never executed\n", desc)
+			case s.If != "" && s.SkippedBy == 0:
+				fmt.Fprintf(w, "  %s was never skipped; no test makes %q false\n", desc, s.If)
+			}
+		}
+		if len(c.Inputs) > 0 {
+			fmt.Fprintf(w, "  %d distinct input combinations:\n", c.InputCombinations)
+			for _, ic := range c.Inputs {
+				fmt.Fprintf(w, "    %s: %s\n", ic.Name, strings.Join(ic.Values, ", "))
+			}
+		}
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldentest
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/abcxyz/abc/templates/model"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestSummarizeCoverage(t *testing.T) {
+	t.Parallel()
+
+	specYaml := `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'A template with a conditional step'
+inputs:
+  - name: 'flavor'
+    desc: 'The flavor'
+    default: 'vanilla'
+steps:
+  - desc: 'Include a file'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+  - desc: 'Chocolate only'
+    if: 'flavor == "chocolate"'
+    action: 'print'
+    params:
+      message: 'Chocolate!'
+  - desc: 'Loop'
+    action: 'for_each'
+    params:
+      iterator:
+        key: 'x'
+        values: ['1']
+      steps:
+        - desc: 'Print in loop'
+          action: 'print'
+          params:
+            message: '{{.x}}'
+`
+	defaultTest := `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'GoldenTest'`
+	chocolateTest := `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'GoldenTest'
+inputs:
+  - name: 'flavor'
+    value: 'chocolate'`
+
+	cases := []struct {
+		name        string
+		tests       map[string]string
+		wantSteps   []*StepCoverage
+		wantInputs  []*InputCoverage
+		wantPercent float64
+		wantReport  string
+	}{
+		{
+			name:  "if_never_true",
+			tests: map[string]string{"default": defaultTest},
+			wantSteps: []*StepCoverage{
+				{Action: "include", Desc: "Include a file", ExecutedBy: 1},
+				{Action: "print", Desc: "Chocolate only", If: `flavor == "chocolate"`, SkippedBy: 1},
+				{Action: "for_each", Desc: "Loop", ExecutedBy: 1},
+				{Action: "print", Desc: "Print in loop", ExecutedBy: 1},
+			},
+			wantInputs: []*InputCoverage{
+				{Name: "flavor", Values: []string{"<default>"}},
+			},
+			wantPercent: 80,
+			wantReport: `coverage for template location [TEMPLATE]: 80.0% of steps and "if" branches, from 1 golden tests
+  line 13: print step "Chocolate only" was never executed
+  1 distinct input combinations:
+    flavor: <default>
+`,
+		},
+		{
+			name:  "full_coverage",
+			tests: map[string]string{"default": defaultTest, "chocolate": chocolateTest},
+			wantSteps: []*StepCoverage{
+				{Action: "include", Desc: "Include a file", ExecutedBy: 2},
+				{Action: "print", Desc: "Chocolate only", If: `flavor == "chocolate"`, ExecutedBy: 1, SkippedBy: 1},
+				{Action: "for_each", Desc: "Loop", ExecutedBy: 2},
+				{Action: "print", Desc: "Print in loop", ExecutedBy: 2},
+			},
+			wantInputs: []*InputCoverage{
+				{Name: "flavor", Values: []string{"<default>", "chocolate"}},
+			},
+			wantPercent: 100,
+			wantReport: `coverage for template location [TEMPLATE]: 100.0% of steps and "if" branches, from 2 golden tests
+  2 distinct input combinations:
+    flavor: <default>, chocolate
+`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			tempDir := t.TempDir()
+
+			files := map[string]string{
+				"spec.yaml": specYaml,
+				"a.txt":     "a",
+			}
+			for name, contents := range tc.tests {
+				files["testdata/golden/"+name+"/test.yaml"] = contents
+			}
+			abctestutil.WriteAll(t, tempDir, files)
+			if err := recordTestCases(ctx, tempDir, nil, ""); err != nil {
+				t.Fatal(err)
+			}
+
+			results, err := RunAll(ctx, tempDir, &RunAllParams{Coverage: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			covs, err := SummarizeCoverage(ctx, results)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(covs) != 1 {
+				t.Fatalf("got %d template coverages, want 1", len(covs))
+			}
+			cov := covs[0]
+
+			opt := cmpopts.IgnoreTypes(model.ConfigPos{})
+			if diff := cmp.Diff(cov.Steps, tc.wantSteps, opt); diff != "" {
+				t.Errorf("step coverage was not as expected (-got,+want): %s", diff)
+			}
+			if diff := cmp.Diff(cov.Inputs, tc.wantInputs); diff != "" {
+				t.Errorf("input coverage was not as expected (-got,+want): %s", diff)
+			}
+			if got := cov.Percent(); got != tc.wantPercent {
+				t.Errorf("got coverage %.1f%%, want %.1f%%", got, tc.wantPercent)
+			}
+
+			var sb strings.Builder
+			writeCoverage(&sb, covs)
+			gotReport := strings.ReplaceAll(sb.String(), cov.TemplateDir, "TEMPLATE")
+			if diff := cmp.Diff(gotReport, tc.wantReport); diff != "" {
+				t.Errorf("coverage report was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestVerifyCommand_MinCoverage(t *testing.T) {
+	t.Parallel()
+
+	specYaml := `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'A template with a conditional step'
+steps:
+  - desc: 'Include a file'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+  - desc: 'Never run'
+    if: 'false'
+    action: 'print'
+    params:
+      message: 'unreachable'
+`
+	files := map[string]string{
+		"spec.yaml":                       specYaml,
+		"a.txt":                           "a",
+		"testdata/golden/test/test.yaml":  "api_version: 'cli.abcxyz.dev/v1beta7'\nkind: 'GoldenTest'",
+		"testdata/golden/test/data/a.txt": "a",
+	}
+
+	cases := []struct {
+		name       string
+		args       []string
+		wantStdout string
+		wantErr    string
+	}{
+		{
+			name:       "coverage_report_only",
+			args:       []string{"--coverage"},
+			wantStdout: `66.7% of steps and "if" branches`,
+		},
+		{
+			name:       "above_minimum",
+			args:       []string{"--min-coverage=60"},
+			wantStdout: `66.7% of steps and "if" branches`,
+		},
+		{
+			name:    "below_minimum",
+			args:    []string{"--min-coverage=70"},
+			wantErr: "has 66.7% coverage, which is below --min-coverage=70",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			abctestutil.WriteAll(t, tempDir, files)
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+
+			r := &VerifyCommand{}
+			_, stdout, _ := r.Pipe()
+			err := r.Run(ctx, append(tc.args, tempDir))
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if !strings.Contains(stdout.String(), tc.wantStdout) {
+				t.Errorf("stdout %q doesn't contain %q", stdout.String(), tc.wantStdout)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldentest
+
+// This file checks the assertions in the "expect" section of a test.yaml.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/model/decode"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1beta7"
+)
+
+// expectsError returns whether the test case is a negative test, meaning that
+// rendering is expected to fail. Negative tests have no recorded output.
+func (tc *TestCase) expectsError() bool {
+	return tc.TestConfig.Expect != nil && tc.TestConfig.Expect.ErrorContains.Val != ""
+}
+
+// wantsManifest returns whether the test case has assertions about the
+// manifest, meaning that the render must create one.
+func (tc *TestCase) wantsManifest() bool {
+	return tc.TestConfig.Expect != nil && tc.TestConfig.Expect.Manifest != nil
+}
+
+// checkRenderError checks the outcome of rendering a negative test case
+// against its expected error.
+func checkRenderError(tc *TestCase, renderErr error) error {
+	want := tc.TestConfig.Expect.ErrorContains.Val
+	if renderErr == nil {
+		return fmt.Errorf("expected rendering to fail with an error containing %q, but it succeeded", want)
+	}
+	if !strings.Contains(renderErr.Error(), want) {
+		return fmt.Errorf("expected rendering to fail with an error containing %q, but got a different error: %w", want, renderErr)
+	}
+	return nil
+}
+
+// checkStdout checks the output of the template's print actions against the
+// test case's expected stdout substrings.
+func checkStdout(tc *TestCase, stdout string) error {
+	if tc.TestConfig.Expect == nil {
+		return nil
+	}
+	var merr error
+	for _, want := range tc.TestConfig.Expect.StdoutContains {
+		if !strings.Contains(stdout, want.Val) {
+			merr = errors.Join(merr, fmt.Errorf("expected the printed messages to contain %q, but they were %q", want.Val, stdout))
+		}
+	}
+	return merr
+}
+
+// checkManifest checks the manifest file at the given path against the test
+// case's expected manifest contents.
+func checkManifest(ctx context.Context, tc *TestCase, manifestPath string) error {
+	m, err := readManifest(ctx, manifestPath)
+	if err != nil {
+		return err
+	}
+	want := tc.TestConfig.Expect.Manifest
+
+	gotInputs := make(map[string]string, len(m.Inputs))
+	for _, input := range m.Inputs {
+		gotInputs[input.Name.Val] = input.Value.Val
+	}
+	var merr error
+	for _, wantInput := range want.Inputs {
+		got, ok := gotInputs[wantInput.Name.Val]
+		if !ok {
+			merr = errors.Join(merr, fmt.Errorf("expected the manifest to record input %q, but it didn't", wantInput.Name.Val))
+			continue
+		}
+		if got != wantInput.Value.Val {
+			merr = errors.Join(merr, fmt.Errorf("expected the manifest to record input %q with value %q, but the value was %q",
+				wantInput.Name.Val, wantInput.Value.Val, got))
+		}
+	}
+
+	gotFiles := make(map[string]struct{}, len(m.OutputFiles))
+	for _, f := range m.OutputFiles {
+		gotFiles[f.File.Val] = struct{}{}
+	}
+	for _, wantFile := range want.OutputFiles {
+		if _, ok := gotFiles[wantFile.Val]; !ok {
+			merr = errors.Join(merr, fmt.Errorf("expected the manifest to list output file %q, but it didn't", wantFile.Val))
+		}
+	}
+	return merr
+}
+
+func readManifest(ctx context.Context, path string) (*manifest.Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest file at %q: %w", path, err)
+	}
+	defer f.Close()
+
+	manifestI, _, err := decode.DecodeValidateUpgrade(ctx, f, path, decode.KindManifest)
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest file: %w", err)
+	}
+	out, ok := manifestI.(*manifest.Manifest)
+	if !ok {
+		return nil, common.InternalErrorf("manifest file did not decode to *manifest.Manifest")
+	}
+	return out, nil
+}
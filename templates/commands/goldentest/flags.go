@@ -16,13 +16,21 @@
 package goldentest
 
 import (
+	"fmt"
+	"regexp"
 	"strings"
 
+	"github.com/posener/complete/v2/predict"
+
+	"github.com/abcxyz/abc/templates/common/flags"
 	"github.com/abcxyz/pkg/cli"
 )
 
 // Flags describes the template location and the test case.
 type Flags struct {
+	// See common/flags.LogFlags.
+	flags.LogFlags
+
 	// Positional arguments:
 
 	// Location is the file system location of the templates to be tested.
@@ -37,10 +45,19 @@ type Flags struct {
 	//
 	// Optional.
 	TestNames []string
+
+	// Run is a regular expression; only the tests whose names match it are
+	// recorded or verified.
+	//
+	// Optional.
+	Run string
+
+	// See common/flags.Strict().
+	Strict bool
 }
 
 func (r *Flags) Register(set *cli.FlagSet) {
-	f := set.NewSection("TEST OPTIONS")
+	f := flags.NewSection(set, "TEST OPTIONS")
 
 	f.StringSliceVar(&cli.StringSliceVar{
 		Name:    "test-name",
@@ -50,6 +67,17 @@ func (r *Flags) Register(set *cli.FlagSet) {
 		Usage:   "The name of the test cases to record or verify.",
 	})
 
+	f.StringVar(&cli.StringVar{
+		Name:    "run",
+		Example: "^postgres_",
+		Target:  &r.Run,
+		Usage:   "Only record or verify the test cases whose names match this regular expression.",
+	})
+
+	f.BoolVar(flags.Strict(&r.Strict))
+
+	r.LogFlags.Register(set)
+
 	// Default location to the first CLI argument, if given.
 	// If not given, default to current directory.
 	set.AfterParse(func(existingErr error) error {
@@ -59,6 +87,129 @@ func (r *Flags) Register(set *cli.FlagSet) {
 			// make current directory the default location
 			r.Location = "."
 		}
+
+		if _, err := regexp.Compile(r.Run); err != nil {
+			return fmt.Errorf("invalid --run regular expression %q: %w", r.Run, err)
+		}
+		return nil
+	})
+}
+
+// VerifyFlags are the flags for the verify subcommand, which accepts
+// everything in Flags plus some verify-specific flags.
+type VerifyFlags struct {
+	Flags
+
+	// Update, if true, rewrites the recorded output of tests that fail
+	// instead of reporting them as failures.
+	Update bool
+
+	// Jobs is the maximum number of tests to run in parallel. Zero means to
+	// choose automatically.
+	Jobs int
+
+	// ShardIndex and ShardTotal split the tests into ShardTotal disjoint
+	// groups and run only the group numbered ShardIndex (counting from 0), so
+	// that a large set of tests can be split across CI machines. ShardTotal
+	// zero means no sharding.
+	ShardIndex int
+	ShardTotal int
+
+	// JUnit is the path of a file to write a JUnit XML test report to.
+	//
+	// Optional.
+	JUnit string
+
+	// Coverage, if true, prints a report of which spec steps and "if"
+	// branches the tests exercised.
+	Coverage bool
+
+	// MinCoverage is the minimum coverage percentage that every template must
+	// have, otherwise verification fails. Implies Coverage. Zero means no
+	// minimum.
+	MinCoverage float64
+}
+
+func (r *VerifyFlags) Register(set *cli.FlagSet) {
+	f := flags.NewSection(set, "VERIFY OPTIONS")
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "update",
+		Target:  &r.Update,
+		Default: false,
+		Usage: "For any test whose rendered output doesn't match its recorded " +
+			"output, rewrite the recorded output and print a summary of the " +
+			"changed files, instead of failing.",
+	})
+
+	f.IntVar(&cli.IntVar{
+		Name:    "jobs",
+		Aliases: []string{"j"},
+		Example: "8",
+		Target:  &r.Jobs,
+		Usage:   "The maximum number of tests to run in parallel; the default depends on the number of CPUs.",
+	})
+
+	f.IntVar(&cli.IntVar{
+		Name:    "shard-index",
+		Example: "0",
+		Target:  &r.ShardIndex,
+		Usage:   "Used with --shard-total; the shard of tests to run, counting from 0.",
+	})
+
+	f.IntVar(&cli.IntVar{
+		Name:    "shard-total",
+		Example: "4",
+		Target:  &r.ShardTotal,
+		Usage: "Split the tests into this many shards and only run the one " +
+			"given by --shard-index. Every test is in exactly one shard.",
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "junit",
+		Example: "report.xml",
+		Target:  &r.JUnit,
+		Predict: predict.Files("*.xml"),
+		Usage:   "Write a JUnit XML report of the test results to this file.",
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "coverage",
+		Target:  &r.Coverage,
+		Default: false,
+		Usage: "Print a report of which spec steps and \"if\" branches the " +
+			"tests exercised, and which input values they used.",
+	})
+
+	f.Float64Var(&cli.Float64Var{
+		Name:    "min-coverage",
+		Example: "80",
+		Target:  &r.MinCoverage,
+		Usage: "Fail if any template's coverage of spec steps and \"if\" " +
+			"branches is below this percentage; implies --coverage.",
+	})
+
+	r.Flags.Register(set)
+
+	set.AfterParse(func(existingErr error) error {
+		if r.Jobs < 0 {
+			return fmt.Errorf("--jobs must not be negative, but was %d", r.Jobs)
+		}
+		if r.ShardTotal < 0 {
+			return fmt.Errorf("--shard-total must not be negative, but was %d", r.ShardTotal)
+		}
+		if r.ShardTotal == 0 && r.ShardIndex != 0 {
+			return fmt.Errorf("--shard-index requires --shard-total")
+		}
+		if r.ShardTotal > 0 && (r.ShardIndex < 0 || r.ShardIndex >= r.ShardTotal) {
+			return fmt.Errorf("--shard-index must be at least 0 and less than --shard-total (%d), but was %d", r.ShardTotal, r.ShardIndex)
+		}
+		if r.MinCoverage < 0 || r.MinCoverage > 100 {
+			return fmt.Errorf("--min-coverage must be between 0 and 100, but was %g", r.MinCoverage)
+		}
+		if r.MinCoverage > 0 {
+			r.Coverage = true
+		}
 		return nil
 	})
 }
@@ -0,0 +1,113 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldentest
+
+// This file writes golden test results as a JUnit XML report, which most CI
+// systems can display.
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name          `xml:"testsuites"`
+	Tests    int               `xml:"tests,attr"`
+	Failures int               `xml:"failures,attr"`
+	Time     string            `xml:"time,attr"`
+	Suites   []*junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string           `xml:"name,attr"`
+	Tests     int              `xml:"tests,attr"`
+	Failures  int              `xml:"failures,attr"`
+	Time      string           `xml:"time,attr"`
+	TestCases []*junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message  string `xml:"message,attr"`
+	Contents string `xml:",chardata"`
+}
+
+// writeJUnit writes the given results to w as a JUnit XML report, with one
+// test suite per template. The results must be sorted by template, as
+// returned by RunAll.
+func writeJUnit(w io.Writer, results []*Result) error {
+	out := &junitTestSuites{}
+	var total time.Duration
+	var suite *junitTestSuite
+	var suiteTime time.Duration
+	for _, r := range results {
+		if suite == nil || suite.Name != r.TemplateDir {
+			if suite != nil {
+				suite.Time = junitSeconds(suiteTime)
+			}
+			suite = &junitTestSuite{Name: r.TemplateDir}
+			suiteTime = 0
+			out.Suites = append(out.Suites, suite)
+		}
+
+		tc := &junitTestCase{
+			Name:      r.TestName,
+			ClassName: r.TemplateDir,
+			Time:      junitSeconds(r.Duration),
+		}
+		if !r.Passed() {
+			tc.Failure = &junitFailure{
+				Message:  fmt.Sprintf("golden test [%s] fails", r.TestName),
+				Contents: r.Err.Error(),
+			}
+			suite.Failures++
+			out.Failures++
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+		suite.Tests++
+		out.Tests++
+		suiteTime += r.Duration
+		total += r.Duration
+	}
+	if suite != nil {
+		suite.Time = junitSeconds(suiteTime)
+	}
+	out.Time = junitSeconds(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("failed writing JUnit report: %w", err)
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return fmt.Errorf("failed writing JUnit report: %w", err)
+	}
+	if _, err := io.WriteString(w, "\n"); err != nil {
+		return fmt.Errorf("failed writing JUnit report: %w", err)
+	}
+	return nil
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
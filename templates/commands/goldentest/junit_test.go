@@ -0,0 +1,78 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldentest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteJUnit(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		results []*Result
+		want    string
+	}{
+		{
+			name: "no_results",
+			want: `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites tests="0" failures="0" time="0.000"></testsuites>
+`,
+		},
+		{
+			name: "passes_and_failures",
+			results: []*Result{
+				{TemplateDir: "/t1", TestName: "fail", Err: fmt.Errorf("a.txt <mismatch>"), Duration: 1500 * time.Millisecond},
+				{TemplateDir: "/t1", TestName: "pass", Duration: 500 * time.Millisecond},
+				{TemplateDir: "/t2", TestName: "other", Duration: 250 * time.Millisecond},
+			},
+			want: `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites tests="3" failures="1" time="2.250">
+  <testsuite name="/t1" tests="2" failures="1" time="2.000">
+    <testcase name="fail" classname="/t1" time="1.500">
+      <failure message="golden test [fail] fails">a.txt &lt;mismatch&gt;</failure>
+    </testcase>
+    <testcase name="pass" classname="/t1" time="0.500"></testcase>
+  </testsuite>
+  <testsuite name="/t2" tests="1" failures="0" time="0.250">
+    <testcase name="other" classname="/t2" time="0.250"></testcase>
+  </testsuite>
+</testsuites>
+`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var sb strings.Builder
+			if err := writeJUnit(&sb, tc.results); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(sb.String(), tc.want); diff != "" {
+				t.Errorf("JUnit report was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
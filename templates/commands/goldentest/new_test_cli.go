@@ -37,7 +37,7 @@ import (
 	"github.com/abcxyz/abc/templates/common/specutil"
 	"github.com/abcxyz/abc/templates/model"
 	"github.com/abcxyz/abc/templates/model/decode"
-	goldentest "github.com/abcxyz/abc/templates/model/goldentest/v1beta4"
+	goldentest "github.com/abcxyz/abc/templates/model/goldentest/v1beta7"
 	"github.com/abcxyz/abc/templates/model/header"
 	"github.com/abcxyz/pkg/cli"
 	"github.com/abcxyz/pkg/logging"
@@ -88,6 +88,7 @@ func (c *NewTestCommand) Run(ctx context.Context, args []string) (rErr error) {
 	if err := c.Flags().Parse(args); err != nil {
 		return fmt.Errorf("failed to parse flags: %w", err)
 	}
+	ctx = c.flags.WithLogger(ctx, c.Stderr())
 	fs := &common.RealFS{}
 
 	spec, err := specutil.Load(ctx, fs, c.flags.Location, c.flags.Location)
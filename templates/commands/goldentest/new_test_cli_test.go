@@ -23,6 +23,7 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 
+	"github.com/abcxyz/abc/templates/common/flags"
 	abctestutil "github.com/abcxyz/abc/templates/testutil"
 	"github.com/abcxyz/abc/templates/testutil/prompt"
 	"github.com/abcxyz/pkg/cli"
@@ -66,7 +67,7 @@ steps:
       message: 'Hello, {{.name}}!'
 `
 
-	testYaml := `api_version: cli.abcxyz.dev/v1beta6
+	testYaml := `api_version: cli.abcxyz.dev/v1beta7
 kind: GoldenTest
 inputs:
     - name: name
@@ -167,7 +168,7 @@ builtin_vars:
 				"testdata/golden/new-test/test.yaml": testYaml,
 			},
 			expectedContents: map[string]string{
-				"test.yaml": `api_version: cli.abcxyz.dev/v1beta6
+				"test.yaml": `api_version: cli.abcxyz.dev/v1beta7
 kind: GoldenTest
 inputs:
     - name: name
@@ -207,7 +208,7 @@ steps:
 `,
 			},
 			expectedContents: map[string]string{
-				"test.yaml": `api_version: cli.abcxyz.dev/v1beta6
+				"test.yaml": `api_version: cli.abcxyz.dev/v1beta7
 kind: GoldenTest
 `,
 			},
@@ -275,6 +276,10 @@ func TestNewTestFlags_Parse(t *testing.T) {
 				"/a/b/c",
 			},
 			want: NewTestFlags{
+				LogFlags: flags.LogFlags{
+					LogFormat: "text",
+					LogLevel:  "warning",
+				},
 				NewTestName:    "new-test",
 				Location:       "/a/b/c",
 				Inputs:         map[string]string{"x": "y"},
@@ -293,6 +298,10 @@ func TestNewTestFlags_Parse(t *testing.T) {
 				"new-test",
 			},
 			want: NewTestFlags{
+				LogFlags: flags.LogFlags{
+					LogFormat: "text",
+					LogLevel:  "warning",
+				},
 				NewTestName:    "new-test",
 				Location:       ".",
 				Inputs:         map[string]string{"x": "y"},
@@ -370,7 +379,7 @@ Enter value: `,
 				},
 			},
 			expectedContents: map[string]string{
-				"test.yaml": `api_version: cli.abcxyz.dev/v1beta6
+				"test.yaml": `api_version: cli.abcxyz.dev/v1beta7
 kind: GoldenTest
 inputs:
     - name: name
@@ -24,6 +24,9 @@ import (
 
 // NewTestFlags describes what new golden test to render and how.
 type NewTestFlags struct {
+	// See common/flags.LogFlags.
+	flags.LogFlags
+
 	// Positional arguments:
 
 	// Location is the file system location of the template to be tested.
@@ -52,7 +55,7 @@ type NewTestFlags struct {
 }
 
 func (r *NewTestFlags) Register(set *cli.FlagSet) {
-	f := set.NewSection("NEW-TEST OPTIONS")
+	f := flags.NewSection(set, "NEW-TEST OPTIONS")
 
 	f.StringMapVar(flags.Inputs(&r.Inputs))
 
@@ -73,6 +76,8 @@ func (r *NewTestFlags) Register(set *cli.FlagSet) {
 		Usage:   "The key=val pairs of builtin_vars; may be repeated.",
 	})
 
+	r.LogFlags.Register(set)
+
 	// Default NewTestName to the first CLI argument, if given
 	set.AfterParse(func(existingErr error) error {
 		r.NewTestName = set.Arg(0)
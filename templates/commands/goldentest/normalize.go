@@ -0,0 +1,126 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldentest
+
+// This file applies the "normalize" rules of a test.yaml to the rendered
+// output, so that values that change from run to run don't cause spurious
+// golden test failures.
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+
+	"github.com/abcxyz/abc/templates/common"
+	goldentest "github.com/abcxyz/abc/templates/model/goldentest/v1beta7"
+)
+
+// stdoutRelPath is the path that normalizers use to match the output of print
+// actions.
+const stdoutRelPath = common.ABCInternalDir + "/" + common.ABCInternalStdout
+
+// normalizer is a compiled goldentest.Normalizer.
+type normalizer struct {
+	re    *regexp.Regexp
+	with  string
+	paths []string
+}
+
+func compileNormalizers(ns []*goldentest.Normalizer) ([]*normalizer, error) {
+	out := make([]*normalizer, 0, len(ns))
+	for _, n := range ns {
+		// The regex was already validated when the test.yaml was parsed,
+		// so this can only fail if the config was built some other way.
+		re, err := regexp.Compile(n.Regex.Val)
+		if err != nil {
+			return nil, n.Regex.Pos.Errorf("invalid regex %q: %w", n.Regex.Val, err)
+		}
+		paths := make([]string, 0, len(n.Paths))
+		for _, p := range n.Paths {
+			paths = append(paths, p.Val)
+		}
+		out = append(out, &normalizer{re: re, with: n.With.Val, paths: paths})
+	}
+	return out, nil
+}
+
+// appliesTo returns whether the normalizer should rewrite the file at the
+// given slash-separated path relative to the output directory.
+func (n *normalizer) appliesTo(relPath string) bool {
+	if len(n.paths) == 0 {
+		return true
+	}
+	for _, p := range n.paths {
+		// The pattern was already validated, so the error can be ignored.
+		if ok, _ := path.Match(p, relPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize applies each of the normalizers that match relPath to contents,
+// in order.
+func normalize(normalizers []*normalizer, relPath, contents string) string {
+	for _, n := range normalizers {
+		if n.appliesTo(relPath) {
+			contents = n.re.ReplaceAllString(contents, n.with)
+		}
+	}
+	return contents
+}
+
+// normalizeDir applies the normalizers to every regular file underneath dir,
+// rewriting the files that change.
+func normalizeDir(dir string, normalizers []*normalizer) error {
+	if len(normalizers) == 0 {
+		return nil
+	}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		relPath, err := filepath.Rel(dir, p)
+		if err != nil {
+			return fmt.Errorf("filepath.Rel(%q, %q): %w", dir, p, err)
+		}
+		buf, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("failed to read %q: %w", p, err)
+		}
+		normalized := normalize(normalizers, filepath.ToSlash(relPath), string(buf))
+		if normalized == string(buf) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("failed to stat %q: %w", p, err)
+		}
+		if err := os.WriteFile(p, []byte(normalized), info.Mode().Perm()); err != nil {
+			return fmt.Errorf("failed to write %q: %w", p, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed normalizing the output in %q: %w", dir, err)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldentest
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	goldentest "github.com/abcxyz/abc/templates/model/goldentest/v1beta7"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	mdl "github.com/abcxyz/abc/templates/testutil/model"
+	"github.com/abcxyz/pkg/logging"
+)
+
+func TestNormalize(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name        string
+		normalizers []*goldentest.Normalizer
+		relPath     string
+		in          string
+		want        string
+	}{
+		{
+			name:    "no_normalizers",
+			relPath: "a.txt",
+			in:      "built at 2024-01-02",
+			want:    "built at 2024-01-02",
+		},
+		{
+			name: "replace_all_matches",
+			normalizers: []*goldentest.Normalizer{
+				{Regex: mdl.S(`\d{4}-\d{2}-\d{2}`), With: mdl.S("<DATE>")},
+			},
+			relPath: "a.txt",
+			in:      "built at 2024-01-02, released 2024-02-03",
+			want:    "built at <DATE>, released <DATE>",
+		},
+		{
+			name: "capturing_groups",
+			normalizers: []*goldentest.Normalizer{
+				{Regex: mdl.S(`sha256:([0-9a-f]{4})[0-9a-f]*`), With: mdl.S("sha256:${1}...")},
+			},
+			relPath: "a.txt",
+			in:      "hash sha256:abcdef0123",
+			want:    "hash sha256:abcd...",
+		},
+		{
+			name: "empty_with_deletes",
+			normalizers: []*goldentest.Normalizer{
+				{Regex: mdl.S(`/tmp/[^/]+/`)},
+			},
+			relPath: "a.txt",
+			in:      "path is /tmp/abc123/out.txt",
+			want:    "path is out.txt",
+		},
+		{
+			name: "applied_in_order",
+			normalizers: []*goldentest.Normalizer{
+				{Regex: mdl.S(`foo`), With: mdl.S("bar")},
+				{Regex: mdl.S(`bar`), With: mdl.S("baz")},
+			},
+			relPath: "a.txt",
+			in:      "foo",
+			want:    "baz",
+		},
+		{
+			name: "path_matches",
+			normalizers: []*goldentest.Normalizer{
+				{Regex: mdl.S(`foo`), With: mdl.S("bar"), Paths: mdl.Strings("dir/*.txt")},
+			},
+			relPath: "dir/a.txt",
+			in:      "foo",
+			want:    "bar",
+		},
+		{
+			name: "path_does_not_match",
+			normalizers: []*goldentest.Normalizer{
+				{Regex: mdl.S(`foo`), With: mdl.S("bar"), Paths: mdl.Strings("*.txt")},
+			},
+			relPath: "dir/a.txt",
+			in:      "foo",
+			want:    "foo",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			normalizers, err := compileNormalizers(tc.normalizers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := normalize(normalizers, tc.relPath, tc.in)
+			if got != tc.want {
+				t.Errorf("normalize() got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestNormalize_RecordVerify tests that normalization is applied to the output
+// both when recording and when verifying.
+func TestNormalize_RecordVerify(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	tempDir := t.TempDir()
+
+	abctestutil.WriteAll(t, tempDir, map[string]string{
+		"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'A template that embeds a timestamp'
+steps:
+  - desc: 'Include some files'
+    action: 'include'
+    params:
+      paths: ['a.txt', 'b.txt']
+  - desc: 'Print the timestamp'
+    action: 'print'
+    params:
+      message: 'rendered at 1700000000000'
+`,
+		"a.txt": "rendered at 1700000000000",
+		"b.txt": "123",
+		"testdata/golden/test/test.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'GoldenTest'
+normalize:
+  - regex: '\d+'
+    with: '<NOW>'
+    paths: ['a.txt', '.abc/stdout']
+`,
+	})
+
+	if err := recordTestCases(ctx, tempDir, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	got := abctestutil.LoadDir(t, filepath.Join(tempDir, "testdata/golden/test/data"))
+	want := map[string]string{
+		".abc/.gitkeep": "",
+		".abc/stdout":   "rendered at <NOW>\n",
+		"a.txt":         "rendered at <NOW>",
+		"b.txt":         "123",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("recorded test data was not as expected (-got,+want): %s", diff)
+	}
+
+	results, err := RunAll(ctx, tempDir, &RunAllParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if !r.Passed() {
+			t.Errorf("verifying the normalized test failed: %v", r.Err)
+		}
+	}
+}
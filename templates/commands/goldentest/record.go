@@ -32,6 +32,7 @@ import (
 	"github.com/abcxyz/abc/internal/metricswrap"
 	"github.com/abcxyz/abc/templates/common"
 	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/abc/templates/common/warnings"
 	"github.com/abcxyz/pkg/cli"
 	"github.com/abcxyz/pkg/logging"
 )
@@ -49,7 +50,7 @@ func (c *RecordCommand) Desc() string {
 
 func (c *RecordCommand) Help() string {
 	return `
-Usage: {{ COMMAND }} [--test-name=<test-name-1>,<test-name-2>] [<location>]
+Usage: {{ COMMAND }} [--test-name=<test-name-1>,<test-name-2>] [--run=<regex>] [<location>]
 
 The {{ COMMAND }} records the template golden tests (capture the
 anticipated outcome akin to expected output in unit test).
@@ -76,7 +77,7 @@ func (c *RecordCommand) PredictArgs() complete.Predictor {
 	return predict.Dirs("")
 }
 
-func (c *RecordCommand) Run(ctx context.Context, args []string) error {
+func (c *RecordCommand) Run(ctx context.Context, args []string) (rErr error) {
 	mClient := metrics.FromContext(ctx)
 	cleanup := metricswrap.WriteMetric(ctx, mClient, "command_goldentest_record", 1)
 	defer cleanup()
@@ -84,6 +85,10 @@ func (c *RecordCommand) Run(ctx context.Context, args []string) error {
 	if err := c.Flags().Parse(args); err != nil {
 		return fmt.Errorf("failed to parse flags: %w", err)
 	}
+	ctx = c.flags.WithLogger(ctx, c.Stderr())
+	warns := &warnings.Collector{}
+	ctx = warnings.WithCollector(ctx, warns)
+	defer func() { rErr = errors.Join(rErr, warns.Report(c.Stderr(), c.flags.Strict)) }()
 
 	absLocation, err := filepath.Abs(c.flags.Location)
 	if err != nil {
@@ -95,18 +100,22 @@ func (c *RecordCommand) Run(ctx context.Context, args []string) error {
 	}
 	var merr error
 	for _, templateLocation := range templateLocations {
-		merr = errors.Join(merr, recordTestCases(ctx, templateLocation, c.flags.TestNames))
+		merr = errors.Join(merr, recordTestCases(ctx, templateLocation, c.flags.TestNames, c.flags.Run))
 	}
 	return merr
 }
 
-func recordTestCases(ctx context.Context, templateLocation string, testNames []string) (rErr error) {
+func recordTestCases(ctx context.Context, templateLocation string, testNames []string, run string) (rErr error) {
 	logger := logging.FromContext(ctx)
 	logger.InfoContext(ctx, "recording test for template location", "template_location", templateLocation)
 	testCases, err := parseTestCases(ctx, templateLocation, testNames)
 	if err != nil {
 		return fmt.Errorf("failed to parse golden test for template location %v: %w", templateLocation, err)
 	}
+	testCases, err = filterTestCases(testCases, run)
+	if err != nil {
+		return err
+	}
 
 	rfs := &common.RealFS{}
 
@@ -125,6 +134,10 @@ func recordTestCases(ctx context.Context, templateLocation string, testNames []s
 
 	// Recursively copy files from tempDir to template golden test directory.
 	for _, tc := range testCases {
+		if tc.expectsError() {
+			// A negative test has no output to record.
+			continue
+		}
 		if err := recordTestCase(ctx, templateLocation, tc, tempDir, rfs); err != nil {
 			rErr = errors.Join(rErr, fmt.Errorf("failed to record test case [%s] for template location [%s]: %w", tc.TestName, templateLocation, err))
 		}
@@ -133,6 +146,19 @@ func recordTestCases(ctx context.Context, templateLocation string, testNames []s
 }
 
 func recordTestCase(ctx context.Context, templateLocation string, tc *TestCase, tempDir string, rfs *common.RealFS) error {
+	renderedDir := filepath.Join(tempDir, goldenTestDir, tc.TestName, testDataDir)
+	if !tc.TestConfig.Features.SkipABCRenamed {
+		if err := renameGitDirsAndFiles(renderedDir); err != nil {
+			return fmt.Errorf("failed renaming git related dirs and files for test case %q: %w", tc.TestName, err)
+		}
+	}
+	return writeGoldenData(ctx, templateLocation, tc, renderedDir, rfs)
+}
+
+// writeGoldenData replaces the recorded test data for the given test case with
+// the contents of renderedDir, whose git-related files must already have been
+// renamed if needed.
+func writeGoldenData(ctx context.Context, templateLocation string, tc *TestCase, renderedDir string, rfs *common.RealFS) error {
 	logger := logging.FromContext(ctx)
 	logger.InfoContext(ctx, "recording test for test name", "testname", tc.TestName)
 	testDir := filepath.Join(templateLocation, goldenTestDir, tc.TestName, testDataDir)
@@ -152,11 +178,11 @@ func recordTestCase(ctx context.Context, templateLocation string, tc *TestCase,
 	}
 	params := &common.CopyParams{
 		DstRoot: testDir,
-		SrcRoot: filepath.Join(tempDir, goldenTestDir, tc.TestName, testDataDir),
+		SrcRoot: renderedDir,
 		FS:      rfs,
 		Visitor: visitor,
 	}
-	if err := common.CopyRecursive(ctx, nil, params); err != nil {
+	if _, err := common.CopyRecursive(ctx, nil, params); err != nil {
 		return fmt.Errorf("failed to copy recursive: %w", err)
 	}
 
@@ -165,12 +191,6 @@ func recordTestCase(ctx context.Context, templateLocation string, tc *TestCase,
 		return fmt.Errorf("failed to create dir %q: %w", abcInternal, err)
 	}
 
-	if !tc.TestConfig.Features.SkipABCRenamed {
-		if err := renameGitDirsAndFiles(testDir); err != nil {
-			return fmt.Errorf("failed renaming git related dirs and files for test case %q: %w", tc.TestName, err)
-		}
-	}
-
 	// git won't commit an empty directory, so add a placeholder file.
 	gitKeep := filepath.Join(abcInternal, ".gitkeep")
 	if err := os.WriteFile(gitKeep, []byte{}, common.OwnerRWPerms); err != nil {
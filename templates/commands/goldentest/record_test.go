@@ -23,6 +23,7 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 
+	"github.com/abcxyz/abc/templates/common/flags"
 	abctestutil "github.com/abcxyz/abc/templates/testutil"
 	"github.com/abcxyz/pkg/cli"
 	"github.com/abcxyz/pkg/logging"
@@ -503,19 +504,44 @@ func TestNewRecordFlags_Parse(t *testing.T) {
 			name: "all_flags_present",
 			args: []string{
 				"--test-name=test1",
+				"--run=^test",
 				"/a/b/c",
 			},
 			want: Flags{
+				LogFlags: flags.LogFlags{
+					LogFormat: "text",
+					LogLevel:  "warning",
+				},
 				TestNames: []string{"test1"},
+				Run:       "^test",
 				Location:  "/a/b/c",
 			},
 		},
+		{
+			name: "invalid_run_regex",
+			args: []string{
+				"--run=(",
+			},
+			want: Flags{
+				LogFlags: flags.LogFlags{
+					LogFormat: "text",
+					LogLevel:  "warning",
+				},
+				Run:      "(",
+				Location: ".",
+			},
+			wantErr: `invalid --run regular expression "("`,
+		},
 		{
 			name: "default_location",
 			args: []string{
 				"--test-name=test1",
 			},
 			want: Flags{
+				LogFlags: flags.LogFlags{
+					LogFormat: "text",
+					LogLevel:  "warning",
+				},
 				TestNames: []string{"test1"},
 				Location:  ".",
 			},
@@ -0,0 +1,296 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldentest
+
+// This file implements an in-process API for running golden tests, for use by
+// template authors who want to run their golden tests from "go test".
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/fatih/color"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/workerpool"
+)
+
+// RunAllParams contains the optional parameters to RunAll. The zero value is
+// valid.
+type RunAllParams struct {
+	// TestNames limits the golden tests that are run to those with the given
+	// names. If empty, all golden tests are run.
+	TestNames []string
+
+	// Run, if set, is a regular expression. Only the golden tests whose names
+	// match it are run.
+	Run string
+
+	// ShardIndex and ShardTotal, if ShardTotal is nonzero, split the golden
+	// tests into ShardTotal disjoint groups and only run the group numbered
+	// ShardIndex, counting from zero. The split is deterministic, so separate
+	// processes (like CI jobs) with the same ShardTotal and different
+	// ShardIndex values run every test exactly once between them.
+	ShardIndex int
+	ShardTotal int
+
+	// Concurrency is the maximum number of golden tests to run at once. If
+	// zero, a default based on the number of CPUs is used.
+	Concurrency int
+
+	// Color, if true, causes diffs in the returned errors to be highlighted
+	// using terminal color codes.
+	Color bool
+
+	// Update, if true, rewrites the recorded output of every test whose
+	// rendered output differs from it, instead of failing that test. The
+	// differences are returned in Result.Changes.
+	Update bool
+
+	// Coverage, if true, records which steps of the spec each test exercised
+	// in Result.Coverage. Use SummarizeCoverage to combine them.
+	Coverage bool
+}
+
+// Result is the outcome of running a single golden test.
+type Result struct {
+	// TemplateDir is the absolute path of the template that the test belongs
+	// to.
+	TemplateDir string
+
+	// TestName is the name of the test, which is the name of its directory
+	// under testdata/golden.
+	TestName string
+
+	// Err is nil if the rendered output matched the recorded output. Otherwise
+	// it describes the failure, including diffs of any mismatched files.
+	Err error
+
+	// Changes lists the files whose recorded output was rewritten. It's only
+	// set when RunAllParams.Update is true.
+	Changes []*FileChange
+
+	// Duration is how long the test took to run.
+	Duration time.Duration
+
+	// Coverage records what the test exercised. It's only set when
+	// RunAllParams.Coverage is true, and never for upgrade tests.
+	Coverage *TestCaseCoverage
+}
+
+// Passed returns whether the golden test passed.
+func (r *Result) Passed() bool {
+	return r.Err == nil
+}
+
+// RunAll finds every template with golden tests underneath dir, which may
+// itself be a template, and verifies each of their golden tests by rendering
+// the template and comparing against the recorded output. This is the same
+// check as the "golden-test verify" command, and is intended for template
+// repos that want to run their golden tests as part of "go test", for example:
+//
+//	func TestGoldenTests(t *testing.T) {
+//		results, err := goldentest.RunAll(context.Background(), ".", nil)
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		for _, r := range results {
+//			if !r.Passed() {
+//				t.Errorf("golden test %q in %q failed: %v", r.TestName, r.TemplateDir, r.Err)
+//			}
+//		}
+//	}
+//
+// The returned error is only non-nil if the tests couldn't be run at all, for
+// example because a test.yaml is malformed or the context was canceled. The
+// failures of individual tests are reported in the returned Results, which
+// are sorted by template dir and then by test name.
+func RunAll(ctx context.Context, dir string, p *RunAllParams) ([]*Result, error) {
+	if p == nil {
+		p = &RunAllParams{}
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	templateDirs, err := crawlTemplatesWithGoldenTests(absDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to crawl template locations: %w", err)
+	}
+
+	if p.ShardTotal < 0 || (p.ShardTotal > 0 && (p.ShardIndex < 0 || p.ShardIndex >= p.ShardTotal)) {
+		return nil, fmt.Errorf("invalid shard %d of %d", p.ShardIndex, p.ShardTotal)
+	}
+
+	logger := logging.FromContext(ctx).With("logger", "RunAll")
+	type templateTest struct {
+		templateDir string
+		tc          *TestCase
+	}
+	var tests []*templateTest
+	for _, templateDir := range templateDirs {
+		logger.InfoContext(ctx, "verifying test for template location", "template_location", templateDir)
+		testCases, err := parseTestCases(ctx, templateDir, p.TestNames)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse golden tests: %w", err)
+		}
+		testCases, err = filterTestCases(testCases, p.Run)
+		if err != nil {
+			return nil, err
+		}
+		for _, tc := range testCases {
+			tests = append(tests, &templateTest{templateDir: templateDir, tc: tc})
+		}
+	}
+
+	if p.ShardTotal > 0 {
+		// Templates are crawled in lexical order and tests are listed in
+		// lexical order, so every shard sees the same list.
+		var shard []*templateTest
+		for i, t := range tests {
+			if i%p.ShardTotal == p.ShardIndex {
+				shard = append(shard, t)
+			}
+		}
+		tests = shard
+	}
+
+	concurrency := int64(p.Concurrency)
+	if concurrency <= 0 {
+		// Concurrency is larger than the number of CPUs because the bottleneck
+		// is not CPU cycles. We just want to do I/O concurrently. The constant
+		// multiplier was chosen arbitrarily.
+		concurrency = int64(runtime.NumCPU()) * 4
+	}
+	pool := workerpool.New[*Result](&workerpool.Config{
+		Concurrency: concurrency,
+	})
+
+	red, green := fmt.Sprint, fmt.Sprint
+	if p.Color {
+		red = color.New(color.FgRed).SprintFunc()
+		green = color.New(color.FgGreen).SprintFunc()
+	}
+
+	for _, t := range tests {
+		t := t
+
+		dp := &diffOutputsOneTestParams{
+			templateLocation: t.templateDir,
+			useColor:         p.Color,
+			redSprintf:       red,
+			greenSprintf:     green,
+		}
+		workerFunc := func() (*Result, error) {
+			var cov *TestCaseCoverage
+			if p.Coverage && !t.tc.isUpgradeTest() {
+				cov = newTestCaseCoverage(t.tc)
+			}
+			start := time.Now()
+			changes, err := verifyTestCase(ctx, dp, t.tc, p.Update, cov)
+			return &Result{
+				TemplateDir: t.templateDir,
+				TestName:    t.tc.TestName,
+				Err:         err,
+				Changes:     changes,
+				Duration:    time.Since(start),
+				Coverage:    cov,
+			}, nil
+		}
+		if err := pool.Do(ctx, workerFunc); err != nil {
+			// The only way pool.Do() can return error is if the context is
+			// canceled.
+			return nil, err //nolint:wrapcheck
+		}
+	}
+
+	poolResults, err := pool.Done(ctx)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	out := make([]*Result, 0, len(poolResults))
+	for _, pr := range poolResults {
+		out = append(out, pr.Value)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].TemplateDir != out[j].TemplateDir {
+			return out[i].TemplateDir < out[j].TemplateDir
+		}
+		return out[i].TestName < out[j].TestName
+	})
+	return out, nil
+}
+
+// verifyTestCase renders a single test case into a temp dir and compares the
+// output against the recorded golden data. p.tempBase is ignored and replaced
+// with a fresh temp dir. If update is true, the recorded golden data is
+// replaced instead of returning an error when it differs, and the differences
+// are returned. If cov is non-nil, the steps that the test exercised are
+// recorded in it.
+func verifyTestCase(ctx context.Context, p *diffOutputsOneTestParams, tc *TestCase, update bool, cov *TestCaseCoverage) (_ []*FileChange, rErr error) {
+	fs := &common.RealFS{}
+	tempTracker := tempdir.NewDirTracker(fs, false)
+	defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
+
+	tempDir, err := tempTracker.MkdirTempTracked("", "verify-testcase-"+tc.TestName+"-")
+	if err != nil {
+		return nil, fmt.Errorf("failed creating temp directory: %w", err)
+	}
+
+	if err := renderTestCase(ctx, p.templateLocation, tempDir, tc, cov); err != nil {
+		return nil, fmt.Errorf("failed to render test case [%s] for template location [%s]: %w", tc.TestName, p.templateLocation, err)
+	}
+	if tc.expectsError() {
+		// The render failed as expected, so there's no output to compare.
+		return nil, nil
+	}
+
+	if update {
+		renderedDir := filepath.Join(tempDir, goldenTestDir, tc.TestName, testDataDir)
+		return updateTestCase(ctx, p.templateLocation, renderedDir, tc)
+	}
+
+	pCopy := *p
+	pCopy.tempBase = tempDir
+	return nil, diffOutputsOneTest(ctx, &pCopy, tc)
+}
+
+// filterTestCases returns the test cases whose names match the regular
+// expression run. If run is empty, all test cases are returned.
+func filterTestCases(testCases []*TestCase, run string) ([]*TestCase, error) {
+	if run == "" {
+		return testCases, nil
+	}
+	re, err := regexp.Compile(run)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression %q: %w", run, err)
+	}
+	out := make([]*TestCase, 0, len(testCases))
+	for _, tc := range testCases {
+		if re.MatchString(tc.TestName) {
+			out = append(out, tc)
+		}
+	}
+	return out, nil
+}
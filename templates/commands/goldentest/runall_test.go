@@ -0,0 +1,258 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldentest
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestRunAll(t *testing.T) {
+	t.Parallel()
+
+	specYaml := `api_version: 'cli.abcxyz.dev/v1beta5'
+kind: 'Template'
+
+desc: 'A simple template'
+
+steps:
+  - desc: 'Include some files and directories'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+`
+	testYaml := `api_version: 'cli.abcxyz.dev/v1beta5'
+kind: 'GoldenTest'`
+
+	// A result with the Err field flattened to a string for comparison.
+	type result struct {
+		TemplateDir string
+		TestName    string
+		Err         string
+	}
+
+	cases := []struct {
+		name         string
+		params       *RunAllParams
+		filesContent map[string]string
+		want         []result
+		wantErr      string
+	}{
+		{
+			name: "multiple_templates_and_tests",
+			filesContent: map[string]string{
+				"t1/spec.yaml":                          specYaml,
+				"t1/a.txt":                              "file A content",
+				"t1/testdata/golden/pass/test.yaml":     testYaml,
+				"t1/testdata/golden/pass/data/a.txt":    "file A content",
+				"t1/testdata/golden/fail/test.yaml":     testYaml,
+				"t1/testdata/golden/fail/data/a.txt":    "wrong content",
+				"t2/spec.yaml":                          specYaml,
+				"t2/a.txt":                              "file A content",
+				"t2/testdata/golden/another/test.yaml":  testYaml,
+				"t2/testdata/golden/another/data/a.txt": "file A content",
+			},
+			want: []result{
+				{TemplateDir: "t1", TestName: "fail", Err: "a.txt] file content mismatch"},
+				{TemplateDir: "t1", TestName: "pass"},
+				{TemplateDir: "t2", TestName: "another"},
+			},
+		},
+		{
+			name:   "test_names",
+			params: &RunAllParams{TestNames: []string{"pass"}, Concurrency: 1},
+			filesContent: map[string]string{
+				"t1/spec.yaml":                       specYaml,
+				"t1/a.txt":                           "file A content",
+				"t1/testdata/golden/pass/test.yaml":  testYaml,
+				"t1/testdata/golden/pass/data/a.txt": "file A content",
+				"t1/testdata/golden/fail/test.yaml":  testYaml,
+				"t1/testdata/golden/fail/data/a.txt": "wrong content",
+			},
+			want: []result{
+				{TemplateDir: "t1", TestName: "pass"},
+			},
+		},
+		{
+			name:   "run_regex",
+			params: &RunAllParams{Run: "^pg_"},
+			filesContent: map[string]string{
+				"t1/spec.yaml":                        specYaml,
+				"t1/a.txt":                            "file A content",
+				"t1/testdata/golden/pg_1/test.yaml":   testYaml,
+				"t1/testdata/golden/pg_1/data/a.txt":  "file A content",
+				"t1/testdata/golden/pg_2/test.yaml":   testYaml,
+				"t1/testdata/golden/pg_2/data/a.txt":  "file A content",
+				"t1/testdata/golden/sql_1/test.yaml":  testYaml,
+				"t1/testdata/golden/sql_1/data/a.txt": "file A content",
+				"t2/spec.yaml":                        specYaml,
+				"t2/a.txt":                            "file A content",
+				"t2/testdata/golden/pg_3/test.yaml":   testYaml,
+				"t2/testdata/golden/pg_3/data/a.txt":  "file A content",
+			},
+			want: []result{
+				{TemplateDir: "t1", TestName: "pg_1"},
+				{TemplateDir: "t1", TestName: "pg_2"},
+				{TemplateDir: "t2", TestName: "pg_3"},
+			},
+		},
+		{
+			name:   "shard_0_of_2",
+			params: &RunAllParams{ShardIndex: 0, ShardTotal: 2},
+			filesContent: map[string]string{
+				"t1/spec.yaml":                        specYaml,
+				"t1/a.txt":                            "file A content",
+				"t1/testdata/golden/pg_1/test.yaml":   testYaml,
+				"t1/testdata/golden/pg_1/data/a.txt":  "file A content",
+				"t1/testdata/golden/pg_2/test.yaml":   testYaml,
+				"t1/testdata/golden/pg_2/data/a.txt":  "file A content",
+				"t1/testdata/golden/sql_1/test.yaml":  testYaml,
+				"t1/testdata/golden/sql_1/data/a.txt": "file A content",
+				"t2/spec.yaml":                        specYaml,
+				"t2/a.txt":                            "file A content",
+				"t2/testdata/golden/pg_3/test.yaml":   testYaml,
+				"t2/testdata/golden/pg_3/data/a.txt":  "file A content",
+			},
+			want: []result{
+				{TemplateDir: "t1", TestName: "pg_1"},
+				{TemplateDir: "t1", TestName: "sql_1"},
+			},
+		},
+		{
+			name:   "shard_1_of_2_with_run",
+			params: &RunAllParams{Run: "pg", ShardIndex: 1, ShardTotal: 2},
+			filesContent: map[string]string{
+				"t1/spec.yaml":                        specYaml,
+				"t1/a.txt":                            "file A content",
+				"t1/testdata/golden/pg_1/test.yaml":   testYaml,
+				"t1/testdata/golden/pg_1/data/a.txt":  "file A content",
+				"t1/testdata/golden/pg_2/test.yaml":   testYaml,
+				"t1/testdata/golden/pg_2/data/a.txt":  "file A content",
+				"t1/testdata/golden/sql_1/test.yaml":  testYaml,
+				"t1/testdata/golden/sql_1/data/a.txt": "file A content",
+				"t2/spec.yaml":                        specYaml,
+				"t2/a.txt":                            "file A content",
+				"t2/testdata/golden/pg_3/test.yaml":   testYaml,
+				"t2/testdata/golden/pg_3/data/a.txt":  "file A content",
+			},
+			want: []result{
+				{TemplateDir: "t1", TestName: "pg_2"},
+			},
+		},
+		{
+			name:   "invalid_run_regex",
+			params: &RunAllParams{Run: "("},
+			filesContent: map[string]string{
+				"t1/spec.yaml":                        specYaml,
+				"t1/a.txt":                            "file A content",
+				"t1/testdata/golden/pg_1/test.yaml":   testYaml,
+				"t1/testdata/golden/pg_1/data/a.txt":  "file A content",
+				"t1/testdata/golden/pg_2/test.yaml":   testYaml,
+				"t1/testdata/golden/pg_2/data/a.txt":  "file A content",
+				"t1/testdata/golden/sql_1/test.yaml":  testYaml,
+				"t1/testdata/golden/sql_1/data/a.txt": "file A content",
+				"t2/spec.yaml":                        specYaml,
+				"t2/a.txt":                            "file A content",
+				"t2/testdata/golden/pg_3/test.yaml":   testYaml,
+				"t2/testdata/golden/pg_3/data/a.txt":  "file A content",
+			},
+			wantErr: `invalid regular expression "("`,
+		},
+		{
+			name:   "invalid_shard",
+			params: &RunAllParams{ShardIndex: 2, ShardTotal: 2},
+			filesContent: map[string]string{
+				"t1/spec.yaml":                        specYaml,
+				"t1/a.txt":                            "file A content",
+				"t1/testdata/golden/pg_1/test.yaml":   testYaml,
+				"t1/testdata/golden/pg_1/data/a.txt":  "file A content",
+				"t1/testdata/golden/pg_2/test.yaml":   testYaml,
+				"t1/testdata/golden/pg_2/data/a.txt":  "file A content",
+				"t1/testdata/golden/sql_1/test.yaml":  testYaml,
+				"t1/testdata/golden/sql_1/data/a.txt": "file A content",
+				"t2/spec.yaml":                        specYaml,
+				"t2/a.txt":                            "file A content",
+				"t2/testdata/golden/pg_3/test.yaml":   testYaml,
+				"t2/testdata/golden/pg_3/data/a.txt":  "file A content",
+			},
+			wantErr: "invalid shard 2 of 2",
+		},
+		{
+			name: "no_templates",
+			filesContent: map[string]string{
+				"some_file.txt": "hello",
+			},
+			want: []result{},
+		},
+		{
+			name: "malformed_test_yaml",
+			filesContent: map[string]string{
+				"t1/spec.yaml":                     specYaml,
+				"t1/testdata/golden/bad/test.yaml": "not yaml: [",
+			},
+			wantErr: "failed to parse golden tests",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			abctestutil.WriteAll(t, tempDir, tc.filesContent)
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+
+			results, err := RunAll(ctx, tempDir, tc.params)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			if len(results) != len(tc.want) {
+				t.Fatalf("got %d results, want %d", len(results), len(tc.want))
+			}
+			got := make([]result, 0, len(results))
+			for i, r := range results {
+				rel, err := filepath.Rel(tempDir, r.TemplateDir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, result{TemplateDir: rel, TestName: r.TestName})
+				if r.Passed() != (tc.want[i].Err == "") {
+					t.Errorf("test %q: got Passed()=%t, want %t (err: %v)", r.TestName, r.Passed(), tc.want[i].Err == "", r.Err)
+				}
+				if diff := testutil.DiffErrString(r.Err, tc.want[i].Err); diff != "" {
+					t.Errorf("test %q: %s", r.TestName, diff)
+				}
+				got[i].Err = tc.want[i].Err
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("results were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
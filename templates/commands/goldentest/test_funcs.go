@@ -23,18 +23,22 @@ import (
 	"os"
 	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/benbjohnson/clock"
 
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/builtinvar"
 	"github.com/abcxyz/abc/templates/common/errs"
 	"github.com/abcxyz/abc/templates/common/render"
 	"github.com/abcxyz/abc/templates/common/specutil"
 	"github.com/abcxyz/abc/templates/common/templatesource"
 	"github.com/abcxyz/abc/templates/model"
 	"github.com/abcxyz/abc/templates/model/decode"
-	goldentest "github.com/abcxyz/abc/templates/model/goldentest/v1beta4"
+	goldentest "github.com/abcxyz/abc/templates/model/goldentest/v1beta7"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
 )
 
 // TestCase describes a template golden test case.
@@ -43,8 +47,12 @@ type TestCase struct {
 	// Example: nextjs_with_auth0_idp.
 	TestName string
 
-	// Config of the test case.
+	// Config of the test case. For upgrade tests, this is empty.
 	TestConfig *goldentest.Test
+
+	// Config of an upgrade test case, which is set instead of a test.yaml
+	// config if the test case has an upgrade_test.yaml. Nil otherwise.
+	UpgradeConfig *goldentest.UpgradeTest
 }
 
 const (
@@ -132,6 +140,30 @@ func parseTestCases(ctx context.Context, location string, testNames []string) ([
 // buildtestCases builds the name and config of a test case.
 func buildTestCase(ctx context.Context, testDir, testName string) (*TestCase, error) {
 	testConfig := filepath.Join(testDir, testName, configName)
+	upgradeConfig := filepath.Join(testDir, testName, upgradeConfigName)
+	isUpgrade, err := common.Exists(upgradeConfig)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	if isUpgrade {
+		hasTestConfig, err := common.Exists(testConfig)
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+		if hasTestConfig {
+			return nil, fmt.Errorf("test case %q must have only one of %s and %s", testName, configName, upgradeConfigName)
+		}
+		upgradeTest, err := parseUpgradeTestConfig(ctx, upgradeConfig)
+		if err != nil {
+			return nil, err
+		}
+		return &TestCase{
+			TestName:      testName,
+			TestConfig:    &goldentest.Test{},
+			UpgradeConfig: upgradeTest,
+		}, nil
+	}
+
 	test, err := parseTestConfig(ctx, testConfig)
 	if err != nil {
 		return nil, err
@@ -157,7 +189,7 @@ func parseTestConfig(ctx context.Context, path string) (*goldentest.Test, error)
 	}
 	out, ok := testI.(*goldentest.Test)
 	if !ok {
-		return nil, fmt.Errorf("internal error: expected golden test config to be of type *goldentest.Test but got %T", testI)
+		return nil, common.InternalErrorf("expected golden test config to be of type *goldentest.Test but got %T", testI)
 	}
 
 	return out, nil
@@ -168,7 +200,7 @@ func parseTestConfig(ctx context.Context, path string) (*goldentest.Test, error)
 func renderTemplateTestCases(ctx context.Context, testCases []*TestCase, templateDir, tempDir string) error {
 	var merr error
 	for _, tc := range testCases {
-		if err := renderTestCase(ctx, templateDir, tempDir, tc); err != nil {
+		if err := renderTestCase(ctx, templateDir, tempDir, tc, nil); err != nil {
 			merr = errors.Join(merr, fmt.Errorf("failed to render test case [%s] for template location [%s]: %w", tc.TestName, templateDir, err))
 		}
 	}
@@ -178,30 +210,52 @@ func renderTemplateTestCases(ctx context.Context, testCases []*TestCase, templat
 	return nil
 }
 
-// renderTestCase renders a single test case for a single template.
-func renderTestCase(ctx context.Context, templateDir, outputDir string, tc *TestCase) error {
+// renderTestCase renders a single test case for a single template. If cov is
+// non-nil, the steps that the render exercised are recorded in it. Coverage
+// isn't recorded for upgrade tests.
+func renderTestCase(ctx context.Context, templateDir, outputDir string, tc *TestCase, cov *TestCaseCoverage) error {
 	testDir := filepath.Join(outputDir, goldenTestDir, tc.TestName, testDataDir)
+	if tc.isUpgradeTest() {
+		return renderUpgradeTestCase(ctx, templateDir, testDir, tc)
+	}
 
 	cwd, err := os.Getwd()
 	if err != nil {
 		return fmt.Errorf("os.Getwd(): %w", err)
 	}
 
+	builtins, clk, err := testBuiltins(tc)
+	if err != nil {
+		return err
+	}
+
 	stdoutBuf := &strings.Builder{}
 
-	_, err = render.Render(ctx, &render.Params{
-		AcceptDefaults:      true,
-		Clock:               clock.New(),
+	var stepObserver func(*spec.Step, bool)
+	if cov != nil {
+		stepObserver = cov.observe
+	}
+
+	result, err := render.Render(ctx, &render.Params{
+		AcceptDefaults: true,
+		// Golden tests are run by a template's authors on their own template,
+		// so it's trusted to run buf, like the rest of their build.
+		AllowBufGenerate:    true,
+		Clock:               clk,
 		Cwd:                 cwd,
 		OutDir:              testDir,
 		Downloader:          &templatesource.LocalDownloader{SrcPath: templateDir},
 		FS:                  &common.RealFS{},
 		InputsFromFlags:     varValuesToMap(tc.TestConfig.Inputs),
-		OverrideBuiltinVars: varValuesToMap(tc.TestConfig.BuiltinVars),
-		SkipManifest:        true,
+		OverrideBuiltinVars: builtins,
+		SkipManifest:        !tc.wantsManifest(),
 		SourceForMessages:   templateDir,
+		StepObserver:        stepObserver,
 		Stdout:              stdoutBuf,
 	})
+	if tc.expectsError() {
+		return checkRenderError(tc, err)
+	}
 	if err != nil {
 		var uve *errs.UnknownVarError
 		if errors.As(err, &uve) && strings.HasPrefix(uve.VarName, "_") {
@@ -210,21 +264,84 @@ func renderTestCase(ctx context.Context, templateDir, outputDir string, tc *Test
 		return err //nolint:wrapcheck
 	}
 
-	// write stdout to ".abc/.stdout"
-	// when the goldentest spec enables stdout verification and there is stdout.
-	if !tc.TestConfig.Features.SkipStdout && stdoutBuf.Len() > 0 {
-		abcInternal := filepath.Join(testDir, common.ABCInternalDir)
-		if err := os.MkdirAll(abcInternal, common.OwnerRWXPerms); err != nil {
-			return fmt.Errorf("failed to create dir %q: %w", abcInternal, err)
+	if err := checkStdout(tc, stdoutBuf.String()); err != nil {
+		return err
+	}
+	if tc.wantsManifest() {
+		// The manifest is only needed for checking the expectations. It's
+		// not part of the recorded output, because its name and contents vary
+		// from run to run.
+		manifestPath := filepath.Join(testDir, result.ManifestPath)
+		if err := checkManifest(ctx, tc, manifestPath); err != nil {
+			return err
 		}
-		stdoutFile := filepath.Join(abcInternal, common.ABCInternalStdout)
-		if err := os.WriteFile(stdoutFile, []byte(stdoutBuf.String()), common.OwnerRWPerms); err != nil {
-			return fmt.Errorf("failed creating %q: %w", stdoutFile, err)
+		if err := os.Remove(manifestPath); err != nil {
+			return fmt.Errorf("failed to remove manifest %q: %w", manifestPath, err)
 		}
 	}
+
+	normalizers, err := compileNormalizers(tc.TestConfig.Normalize)
+	if err != nil {
+		return err
+	}
+	if err := normalizeDir(testDir, normalizers); err != nil {
+		return err
+	}
+
+	// write stdout to ".abc/.stdout"
+	// when the goldentest spec enables stdout verification.
+	if !tc.TestConfig.Features.SkipStdout {
+		return writeStdout(testDir, normalize(normalizers, stdoutRelPath, stdoutBuf.String()))
+	}
+	return nil
+}
+
+// writeStdout writes the output of the template's print actions to
+// ".abc/.stdout" in testDir, if there was any output.
+func writeStdout(testDir, stdout string) error {
+	if stdout == "" {
+		return nil
+	}
+	abcInternal := filepath.Join(testDir, common.ABCInternalDir)
+	if err := os.MkdirAll(abcInternal, common.OwnerRWXPerms); err != nil {
+		return fmt.Errorf("failed to create dir %q: %w", abcInternal, err)
+	}
+	stdoutFile := filepath.Join(abcInternal, common.ABCInternalStdout)
+	if err := os.WriteFile(stdoutFile, []byte(stdout), common.OwnerRWPerms); err != nil {
+		return fmt.Errorf("failed creating %q: %w", stdoutFile, err)
+	}
 	return nil
 }
 
+// testBuiltins returns the builtin var values from the test case's
+// builtin_vars, and the clock to render with. If _now_ms is given, the clock is
+// frozen at that time, so that everything else that depends on the time (like
+// the manifest timestamps) agrees with it. If _git_sha is given but
+// _git_short_sha isn't, the short SHA is derived from it the same way as when
+// rendering from a real git repo.
+func testBuiltins(tc *TestCase) (map[string]string, clock.Clock, error) {
+	builtins := varValuesToMap(tc.TestConfig.BuiltinVars)
+
+	if sha, ok := builtins[builtinvar.GitSHA]; ok && len(sha) >= 7 {
+		if _, ok := builtins[builtinvar.GitShortSHA]; !ok {
+			builtins[builtinvar.GitShortSHA] = sha[:7]
+		}
+	}
+
+	nowMs, ok := builtins[builtinvar.NowMilliseconds]
+	if !ok {
+		return builtins, clock.New(), nil
+	}
+	ms, err := strconv.ParseInt(nowMs, 10, 64)
+	if err != nil {
+		return nil, nil, fmt.Errorf("the value of %q in the builtin_vars section of test.yaml must be a Unix timestamp in milliseconds, but was %q",
+			builtinvar.NowMilliseconds, nowMs)
+	}
+	mockClock := clock.NewMock()
+	mockClock.Set(time.UnixMilli(ms))
+	return builtins, mockClock, nil
+}
+
 func varValuesToMap(vvs []*goldentest.VarValue) map[string]string {
 	out := make(map[string]string, len(vvs))
 	for _, vv := range vvs {
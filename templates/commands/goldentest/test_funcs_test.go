@@ -25,7 +25,7 @@ import (
 
 	"github.com/abcxyz/abc/templates/model"
 	"github.com/abcxyz/abc/templates/model/goldentest/features"
-	goldentest "github.com/abcxyz/abc/templates/model/goldentest/v1beta4"
+	goldentest "github.com/abcxyz/abc/templates/model/goldentest/v1beta7"
 	abctestutil "github.com/abcxyz/abc/templates/testutil"
 	mdl "github.com/abcxyz/abc/templates/testutil/model"
 	"github.com/abcxyz/pkg/testutil"
@@ -312,7 +312,7 @@ steps:
 			abctestutil.WriteAll(t, tempDir, tc.filesContent)
 
 			ctx := context.Background()
-			err := renderTestCase(ctx, tempDir, tempDir, tc.testCase)
+			err := renderTestCase(ctx, tempDir, tempDir, tc.testCase, nil)
 			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
 				t.Fatal(diff)
 			}
@@ -558,6 +558,85 @@ steps:
 			},
 			wantErr: `you may need to provide a value for "_git_tag" in the builtin_vars section of test.yaml`,
 		},
+		{
+			name: "git_short_sha_is_derived_from_git_sha",
+			testCase: &TestCase{
+				TestName: "test",
+				TestConfig: &goldentest.Test{
+					BuiltinVars: []*goldentest.VarValue{
+						{
+							Name:  mdl.S("_git_sha"),
+							Value: mdl.S(abctestutil.MinimalGitHeadSHA),
+						},
+					},
+				},
+			},
+			filesContent: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta3'
+kind: 'Template'
+desc: 'A simple template'
+steps:
+- desc: 'Print the SHAs'
+  action: 'print'
+  params:
+    message: '{{._git_sha}} {{._git_short_sha}}'`,
+			},
+			want: map[string]string{
+				"data/.abc/stdout": abctestutil.MinimalGitHeadSHA + " " + abctestutil.MinimalGitHeadShortSHA + "\n",
+			},
+		},
+		{
+			name: "now_ms_freezes_the_clock",
+			testCase: &TestCase{
+				TestName: "test",
+				TestConfig: &goldentest.Test{
+					BuiltinVars: []*goldentest.VarValue{
+						{
+							Name:  mdl.S("_now_ms"),
+							Value: mdl.S("1700000000000"),
+						},
+					},
+				},
+			},
+			filesContent: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta6'
+kind: 'Template'
+desc: 'A simple template'
+steps:
+- desc: 'Print the time'
+  action: 'print'
+  params:
+    message: '{{._now_ms}} {{formatTime ._now_ms "2006-01-02"}}'`,
+			},
+			want: map[string]string{
+				"data/.abc/stdout": "1700000000000 2023-11-14\n",
+			},
+		},
+		{
+			name: "now_ms_must_be_an_integer",
+			testCase: &TestCase{
+				TestName: "test",
+				TestConfig: &goldentest.Test{
+					BuiltinVars: []*goldentest.VarValue{
+						{
+							Name:  mdl.S("_now_ms"),
+							Value: mdl.S("yesterday"),
+						},
+					},
+				},
+			},
+			filesContent: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta6'
+kind: 'Template'
+desc: 'A simple template'
+steps:
+- desc: 'Print the time'
+  action: 'print'
+  params:
+    message: '{{._now_ms}}'`,
+			},
+			wantErr: `the value of "_now_ms" in the builtin_vars section of test.yaml must be a Unix timestamp in milliseconds, but was "yesterday"`,
+		},
 	}
 
 	for _, tc := range cases {
@@ -571,7 +650,7 @@ steps:
 			abctestutil.WriteAll(t, tempDir, tc.filesContent)
 
 			ctx := context.Background()
-			err := renderTestCase(ctx, tempDir, tempDir, tc.testCase)
+			err := renderTestCase(ctx, tempDir, tempDir, tc.testCase, nil)
 			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
 				t.Fatal(diff)
 			}
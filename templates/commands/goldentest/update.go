@@ -0,0 +1,155 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldentest
+
+// This file implements "verify --update", which rewrites the recorded test data
+// of golden tests whose output has changed.
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common"
+)
+
+// ChangeKind says how a file in a golden test's recorded output changed.
+type ChangeKind string
+
+const (
+	// ChangeAdded means the file is newly produced by the template.
+	ChangeAdded ChangeKind = "added"
+	// ChangeRemoved means the file is no longer produced by the template.
+	ChangeRemoved ChangeKind = "removed"
+	// ChangeModified means the file's contents changed.
+	ChangeModified ChangeKind = "modified"
+)
+
+// FileChange is a single difference between a golden test's previously
+// recorded output and its new output.
+type FileChange struct {
+	// Path is the path of the file relative to the test's data dir.
+	Path string
+	Kind ChangeKind
+}
+
+// updateTestCase compares the freshly rendered output of a test case in
+// renderedDir against its recorded output, and if they differ, replaces the
+// recorded output. It returns the differences, which are empty if nothing was
+// updated.
+func updateTestCase(ctx context.Context, templateLocation, renderedDir string, tc *TestCase) ([]*FileChange, error) {
+	if !tc.TestConfig.Features.SkipABCRenamed {
+		if err := renameGitDirsAndFiles(renderedDir); err != nil {
+			return nil, fmt.Errorf("failed renaming git related dirs and files for test case %s: %w", tc.TestName, err)
+		}
+	}
+
+	goldenDataDir := filepath.Join(templateLocation, goldenTestDir, tc.TestName, testDataDir)
+	changes, err := goldenChanges(goldenDataDir, renderedDir, !tc.TestConfig.Features.SkipStdout)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	if err := writeGoldenData(ctx, templateLocation, tc, renderedDir, &common.RealFS{}); err != nil {
+		return nil, fmt.Errorf("failed to update test case [%s] for template location [%s]: %w", tc.TestName, templateLocation, err)
+	}
+	return changes, nil
+}
+
+// goldenChanges returns the files that differ between the recorded output in
+// goldenDataDir and the rendered output in renderedDir, sorted by path. The
+// recorded stdout is only compared if includeStdout is true.
+func goldenChanges(goldenDataDir, renderedDir string, includeStdout bool) ([]*FileChange, error) {
+	goldenFiles := make(map[string]struct{})
+	goldenExists, err := common.Exists(goldenDataDir)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	if goldenExists {
+		if err := addTestFiles(goldenFiles, goldenDataDir); err != nil {
+			return nil, err
+		}
+	}
+	renderedFiles := make(map[string]struct{})
+	if err := addTestFiles(renderedFiles, renderedDir); err != nil {
+		return nil, err
+	}
+	if includeStdout {
+		stdoutPath := filepath.Join(common.ABCInternalDir, common.ABCInternalStdout)
+		for dir, files := range map[string]map[string]struct{}{goldenDataDir: goldenFiles, renderedDir: renderedFiles} {
+			ok, err := common.Exists(filepath.Join(dir, stdoutPath))
+			if err != nil {
+				return nil, err //nolint:wrapcheck
+			}
+			if ok {
+				files[stdoutPath] = struct{}{}
+			}
+		}
+	}
+
+	var out []*FileChange
+	for relPath := range goldenFiles {
+		if _, ok := renderedFiles[relPath]; !ok {
+			out = append(out, &FileChange{Path: relPath, Kind: ChangeRemoved})
+		}
+	}
+	for relPath := range renderedFiles {
+		if _, ok := goldenFiles[relPath]; !ok {
+			out = append(out, &FileChange{Path: relPath, Kind: ChangeAdded})
+			continue
+		}
+		same, err := sameContents(filepath.Join(goldenDataDir, relPath), filepath.Join(renderedDir, relPath))
+		if err != nil {
+			return nil, err
+		}
+		if !same {
+			out = append(out, &FileChange{Path: relPath, Kind: ChangeModified})
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Path < out[j].Path
+	})
+	return out, nil
+}
+
+func sameContents(a, b string) (bool, error) {
+	aBuf, err := os.ReadFile(a)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %q: %w", a, err)
+	}
+	bBuf, err := os.ReadFile(b)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %q: %w", b, err)
+	}
+	return bytes.Equal(aBuf, bBuf), nil
+}
+
+// formatChanges returns a human-readable summary of the given changes, one
+// per line.
+func formatChanges(changes []*FileChange) string {
+	var sb strings.Builder
+	for _, c := range changes {
+		fmt.Fprintf(&sb, "  %s: %s\n", c.Kind, strings.TrimSuffix(c.Path, abcRenameSuffix))
+	}
+	return sb.String()
+}
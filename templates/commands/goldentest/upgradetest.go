@@ -0,0 +1,230 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldentest
+
+// This file runs upgrade tests, which are golden tests configured by an
+// upgrade_test.yaml instead of a test.yaml. An upgrade test renders an old
+// version of the template, simulates a user's local edits, and upgrades to the
+// current version of the template. The upgraded directory is the test output.
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/benbjohnson/clock"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/git"
+	"github.com/abcxyz/abc/templates/common/render"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/abc/templates/common/upgrade"
+	"github.com/abcxyz/abc/templates/model/decode"
+	goldentest "github.com/abcxyz/abc/templates/model/goldentest/v1beta7"
+)
+
+// upgradeConfigName is the name of the config file that makes a test case an
+// upgrade test. It's used instead of test.yaml.
+const upgradeConfigName = "upgrade_test.yaml"
+
+// isUpgradeTest returns whether the test case is an upgrade test.
+func (tc *TestCase) isUpgradeTest() bool {
+	return tc.UpgradeConfig != nil
+}
+
+// parseUpgradeTestConfig reads an upgrade_test.yaml and returns the result.
+func parseUpgradeTestConfig(ctx context.Context, path string) (*goldentest.UpgradeTest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening upgrade test config (%s): %w", path, err)
+	}
+	defer f.Close()
+
+	testI, _, err := decode.DecodeValidateUpgrade(ctx, f, path, decode.KindUpgradeTest)
+	if err != nil {
+		return nil, fmt.Errorf("error reading upgrade test config file: %w", err)
+	}
+	out, ok := testI.(*goldentest.UpgradeTest)
+	if !ok {
+		return nil, common.InternalErrorf("expected upgrade test config to be of type *goldentest.UpgradeTest but got %T", testI)
+	}
+	return out, nil
+}
+
+// renderUpgradeTestCase runs a single upgrade test case, leaving the upgraded
+// output in testDir.
+func renderUpgradeTestCase(ctx context.Context, templateDir, testDir string, tc *TestCase) (rErr error) {
+	uc := tc.UpgradeConfig
+
+	templateDir, err := filepath.Abs(templateDir)
+	if err != nil {
+		return fmt.Errorf("filepath.Abs(%q): %w", templateDir, err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("os.Getwd(): %w", err)
+	}
+
+	rfs := &common.RealFS{}
+	tempTracker := tempdir.NewDirTracker(rfs, false)
+	defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
+
+	oldTemplateDir, err := checkoutOldTemplate(ctx, tempTracker, templateDir, uc.FromRef.Val)
+	if err != nil {
+		return err
+	}
+
+	// Like golden tests, upgrade tests run the authors' own template, so it's
+	// trusted to run buf.
+	if _, err := render.Render(ctx, &render.Params{
+		AcceptDefaults:    true,
+		AllowBufGenerate:  true,
+		Clock:             clock.New(),
+		Cwd:               cwd,
+		OutDir:            testDir,
+		Downloader:        &templatesource.LocalDownloader{SrcPath: oldTemplateDir},
+		FS:                rfs,
+		InputsFromFlags:   varValuesToMap(uc.Inputs),
+		SourceForMessages: oldTemplateDir,
+		Stdout:            &strings.Builder{}, // only the upgrade's output is recorded
+	}); err != nil {
+		return fmt.Errorf("failed rendering the template at from_ref %q: %w", uc.FromRef.Val, err)
+	}
+
+	if err := applyEdits(testDir, uc.Edits); err != nil {
+		return err
+	}
+
+	stdoutBuf := &strings.Builder{}
+	result := upgrade.UpgradeAll(ctx, &upgrade.Params{
+		AcceptDefaults:   true,
+		AllowBufGenerate: true,
+		Clock:            clock.New(),
+		CWD:              cwd,
+		FS:               rfs,
+		InputsFromFlags:  varValuesToMap(uc.UpgradeInputs),
+		Location:         testDir,
+		Stdout:           stdoutBuf,
+		TemplateLocation: templateDir,
+	})
+	if result.Err != nil {
+		return fmt.Errorf("failed upgrading from from_ref %q to the current template version: %w", uc.FromRef.Val, result.Err)
+	}
+
+	if err := checkConflicts(uc, result); err != nil {
+		return err
+	}
+
+	// The manifest records timestamps and hashes that vary from run to run,
+	// so it's not part of the recorded output.
+	manifests, err := filepath.Glob(filepath.Join(testDir, common.ABCInternalDir, "manifest*.yaml"))
+	if err != nil {
+		return fmt.Errorf("filepath.Glob: %w", err)
+	}
+	for _, m := range manifests {
+		if err := os.Remove(m); err != nil {
+			return fmt.Errorf("failed to remove manifest %q: %w", m, err)
+		}
+	}
+
+	return writeStdout(testDir, stdoutBuf.String())
+}
+
+// checkoutOldTemplate clones the git repo containing templateDir and checks out
+// the given ref, returning the template's directory within the clone.
+func checkoutOldTemplate(ctx context.Context, tempTracker *tempdir.DirTracker, templateDir, ref string) (string, error) {
+	workspace, ok, err := git.Workspace(ctx, templateDir)
+	if err != nil {
+		return "", fmt.Errorf("failed looking for a git workspace containing %q: %w", templateDir, err)
+	}
+	if !ok {
+		return "", fmt.Errorf("upgrade tests require the template %q to be in a git repo, so that from_ref %q can be checked out", templateDir, ref)
+	}
+	relDir, err := filepath.Rel(workspace, templateDir)
+	if err != nil {
+		return "", fmt.Errorf("filepath.Rel(%q, %q): %w", workspace, templateDir, err)
+	}
+
+	cloneDir, err := tempTracker.MkdirTempTracked("", "upgrade-test-")
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+	if err := git.Clone(ctx, workspace, cloneDir); err != nil {
+		return "", fmt.Errorf("failed cloning %q: %w", workspace, err)
+	}
+	if err := git.Checkout(ctx, ref, cloneDir); err != nil {
+		return "", fmt.Errorf("failed checking out from_ref %q: %w", ref, err)
+	}
+
+	oldTemplateDir := filepath.Join(cloneDir, relDir)
+	ok, err = common.Exists(oldTemplateDir)
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+	if !ok {
+		return "", fmt.Errorf("the template directory %q doesn't exist at from_ref %q", relDir, ref)
+	}
+	return oldTemplateDir, nil
+}
+
+// applyEdits makes the given changes to the files in dir.
+func applyEdits(dir string, edits []*goldentest.Edit) error {
+	for _, e := range edits {
+		path := filepath.Join(dir, filepath.FromSlash(e.Path.Val))
+		if e.Delete.Val {
+			if err := os.Remove(path); err != nil {
+				return e.Pos.Errorf("failed deleting %q: %w", e.Path.Val, err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), common.OwnerRWXPerms); err != nil {
+			return fmt.Errorf("failed to create dir %q: %w", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(e.Contents.Val), common.OwnerRWPerms); err != nil {
+			return e.Pos.Errorf("failed writing %q: %w", e.Path.Val, err)
+		}
+	}
+	return nil
+}
+
+// checkConflicts compares the paths that had conflicts during the upgrade
+// against the test's expected conflicts.
+func checkConflicts(uc *goldentest.UpgradeTest, result *upgrade.Result) error {
+	got := []string{}
+	for _, r := range result.Results {
+		for _, c := range r.MergeConflicts {
+			got = append(got, c.Path)
+		}
+		for _, c := range r.ReversalConflicts {
+			got = append(got, c.RelPath)
+		}
+	}
+	slices.Sort(got)
+
+	want := make([]string, 0, len(uc.ExpectConflicts))
+	for _, c := range uc.ExpectConflicts {
+		want = append(want, c.Val)
+	}
+	slices.Sort(want)
+
+	if !slices.Equal(got, want) {
+		return fmt.Errorf("expected the upgrade to have conflicts in %q, but it had conflicts in %q", want, got)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldentest
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common/run"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestUpgradeTest(t *testing.T) {
+	t.Parallel()
+
+	specYaml := func(paths string) string {
+		return `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+
+desc: 'A simple template'
+
+steps:
+  - desc: 'Include some files'
+    action: 'include'
+    params:
+      paths: ` + paths + `
+  - desc: 'Print a message'
+    action: 'print'
+    params:
+      message: 'Hello'
+`
+	}
+
+	oldTemplate := map[string]string{
+		"spec.yaml": specYaml(`['a.txt', 'b.txt']`),
+		"a.txt":     "a v1\n",
+		"b.txt":     "b v1\n",
+	}
+	newTemplate := map[string]string{
+		"spec.yaml": specYaml(`['a.txt', 'b.txt', 'c.txt']`),
+		"a.txt":     "a v2\n",
+		"b.txt":     "b v1\n",
+		"c.txt":     "c v2\n",
+	}
+
+	cases := []struct {
+		name            string
+		upgradeTestYaml string
+		testYaml        string
+		wantData        map[string]string
+		wantErr         string
+	}{
+		{
+			name: "clean_upgrade_keeps_local_edits",
+			upgradeTestYaml: `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'UpgradeTest'
+from_ref: 'v1'
+edits:
+  - path: 'b.txt'
+    contents: 'my local b'
+  - path: 'mine.txt'
+    contents: 'a file the user added'`,
+			wantData: map[string]string{
+				".abc/.gitkeep": "",
+				".abc/stdout":   "Hello\n",
+				"a.txt":         "a v2\n",
+				"b.txt":         "my local b",
+				"c.txt":         "c v2\n",
+				"mine.txt":      "a file the user added",
+			},
+		},
+		{
+			name: "expected_conflict",
+			upgradeTestYaml: `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'UpgradeTest'
+from_ref: 'v1'
+edits:
+  - path: 'a.txt'
+    contents: 'my local a'
+expect_conflicts: ['a.txt']`,
+			wantData: map[string]string{
+				".abc/.gitkeep":                    "",
+				".abc/stdout":                      "Hello\n",
+				"a.txt":                            "my local a",
+				"a.abcmerge_from_new_template.txt": "a v2\n",
+				"b.txt":                            "b v1\n",
+				"c.txt":                            "c v2\n",
+			},
+		},
+		{
+			name: "unexpected_conflict",
+			upgradeTestYaml: `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'UpgradeTest'
+from_ref: 'v1'
+edits:
+  - path: 'a.txt'
+    contents: 'my local a'`,
+			wantErr: `expected the upgrade to have conflicts in [], but it had conflicts in ["a.txt"]`,
+		},
+		{
+			name: "missing_expected_conflict",
+			upgradeTestYaml: `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'UpgradeTest'
+from_ref: 'v1'
+expect_conflicts: ['b.txt']`,
+			wantErr: `expected the upgrade to have conflicts in ["b.txt"], but it had conflicts in []`,
+		},
+		{
+			name: "deleting_a_missing_file",
+			upgradeTestYaml: `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'UpgradeTest'
+from_ref: 'v1'
+edits:
+  - path: 'nonexistent.txt'
+    delete: true`,
+			wantErr: `failed deleting "nonexistent.txt"`,
+		},
+		{
+			name: "nonexistent_from_ref",
+			upgradeTestYaml: `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'UpgradeTest'
+from_ref: 'v9'`,
+			wantErr: `failed checking out from_ref "v9"`,
+		},
+		{
+			name: "both_config_files",
+			upgradeTestYaml: `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'UpgradeTest'
+from_ref: 'v1'`,
+			testYaml: `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'GoldenTest'`,
+			wantErr: `test case "test" must have only one of test.yaml and upgrade_test.yaml`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			tempDir := t.TempDir()
+
+			abctestutil.WriteAll(t, tempDir, oldTemplate)
+			mustRun(ctx, t, "git", "-C", tempDir, "init")
+			mustRun(ctx, t, "git", "config", "-f", tempDir+"/.git/config", "user.email", "fake@example.com")
+			mustRun(ctx, t, "git", "config", "-f", tempDir+"/.git/config", "user.name", "Nobody")
+			mustRun(ctx, t, "git", "-C", tempDir, "add", "-A")
+			mustRun(ctx, t, "git", "-C", tempDir, "commit", "--no-gpg-sign", "-m", "version 1")
+			mustRun(ctx, t, "git", "-C", tempDir, "tag", "v1")
+
+			files := map[string]string{
+				"testdata/golden/test/upgrade_test.yaml": tc.upgradeTestYaml,
+			}
+			if tc.testYaml != "" {
+				files["testdata/golden/test/test.yaml"] = tc.testYaml
+			}
+			for k, v := range newTemplate {
+				files[k] = v
+			}
+			abctestutil.WriteAll(t, tempDir, files)
+
+			err := recordTestCases(ctx, tempDir, nil, "")
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			gotData := abctestutil.LoadDir(t, filepath.Join(tempDir, "testdata/golden/test/data"))
+			if diff := cmp.Diff(gotData, tc.wantData); diff != "" {
+				t.Errorf("recorded test data was not as expected (-got,+want): %s", diff)
+			}
+
+			results, err := RunAll(ctx, tempDir, &RunAllParams{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range results {
+				if !r.Passed() {
+					t.Errorf("verifying the recorded upgrade test failed: %v", r.Err)
+				}
+			}
+		})
+	}
+}
+
+func mustRun(ctx context.Context, tb testing.TB, args ...string) {
+	tb.Helper()
+	if _, _, err := run.Simple(ctx, args...); err != nil {
+		tb.Fatal(err)
+	}
+}
@@ -21,11 +21,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
-	"runtime"
 	"sort"
 	"strings"
 
@@ -38,14 +36,12 @@ import (
 	"github.com/abcxyz/abc/internal/metricswrap"
 	"github.com/abcxyz/abc/templates/common"
 	"github.com/abcxyz/abc/templates/common/run"
-	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/abc/templates/common/warnings"
 	"github.com/abcxyz/pkg/cli"
-	"github.com/abcxyz/pkg/logging"
-	"github.com/abcxyz/pkg/workerpool"
 )
 
 type VerifyCommand struct {
-	flags Flags
+	flags VerifyFlags
 
 	cli.BaseCommand
 }
@@ -56,7 +52,7 @@ func (c *VerifyCommand) Desc() string {
 
 func (c *VerifyCommand) Help() string {
 	return `
-Usage: {{ COMMAND }} [--test-name=<test-name-1>,<test-name-2>] [<location>]
+Usage: {{ COMMAND }} [--test-name=<test-name-1>,<test-name-2>] [--run=<regex>] [--update] [<location>]
 
 The {{ COMMAND }} verifies the template golden tests.
 
@@ -69,7 +65,13 @@ If no "<location>" is given, default to current directory.
 For every test case, it is expected that
   - a testdata/golden/<test_name> folder exists to host test results.
   - a testdata/golden/<test_name>/test.yaml exists to define
-template input params.`
+template input params.
+
+With --update, any test whose output doesn't match is re-recorded instead of
+failing, and the files that changed are printed.
+
+For CI, --shard-index and --shard-total split the tests across machines, and
+--junit writes a JUnit XML report.`
 }
 
 func (c *VerifyCommand) Flags() *cli.FlagSet {
@@ -90,119 +92,99 @@ func (c *VerifyCommand) Run(ctx context.Context, args []string) (rErr error) {
 	if err := c.Flags().Parse(args); err != nil {
 		return fmt.Errorf("failed to parse flags: %w", err)
 	}
+	ctx = c.flags.WithLogger(ctx, c.Stderr())
+	warns := &warnings.Collector{}
+	ctx = warnings.WithCollector(ctx, warns)
+	defer func() { rErr = errors.Join(rErr, warns.Report(c.Stderr(), c.flags.Strict)) }()
 
-	absLocation, err := filepath.Abs(c.flags.Location)
-	if err != nil {
-		return err //nolint:wrapcheck
-	}
-	templateLocations, err := crawlTemplatesWithGoldenTests(absLocation)
-	if err != nil {
-		return fmt.Errorf("failed to crawl template locations: %w", err)
+	// Highlight error message color, given diff text might be hundreds lines long.
+	// Only color the text when the result is to displayed at a terminal
+	red, green := fmt.Sprint, fmt.Sprint
+	useColor := c.Stdout() == os.Stdout && isatty.IsTerminal(os.Stdout.Fd())
+	if useColor {
+		red = color.New(color.FgRed).SprintFunc()
+		green = color.New(color.FgGreen).SprintFunc()
 	}
 
-	pool := workerpool.New[string](&workerpool.Config{
-		// Concurrency is larger than the number of CPUs because the bottleneck
-		// is not CPU cycles. We just want to do I/O concurrently. The constant
-		// multiplier was chosen arbitrarily.
-		Concurrency: int64(runtime.NumCPU()) * 4,
+	results, err := RunAll(ctx, c.flags.Location, &RunAllParams{
+		TestNames:   c.flags.TestNames,
+		Run:         c.flags.Run,
+		ShardIndex:  c.flags.ShardIndex,
+		ShardTotal:  c.flags.ShardTotal,
+		Concurrency: c.flags.Jobs,
+		Color:       useColor,
+		Update:      c.flags.Update,
+		Coverage:    c.flags.Coverage,
 	})
-
-	var merr error
-	for _, templateLocation := range templateLocations {
-		merr = errors.Join(merr, verify(ctx, pool, templateLocation, c.flags.TestNames, c.Stdout()))
+	if err != nil {
+		return err
 	}
 
-	results, err := pool.Done(ctx)
-	if errors.Is(err, context.Canceled) {
-		// Any other errors besides context.Canceled will be processed in the
-		// following loop.
-		return err //nolint:wrapcheck
+	if c.flags.JUnit != "" {
+		if err := writeJUnitFile(c.flags.JUnit, results); err != nil {
+			return err
+		}
 	}
 
+	var merr error
 	var resultReport strings.Builder
 	resultReport.WriteString("\n")
 	for _, result := range results {
-		if result.Error != nil {
-			merr = errors.Join(merr, result.Error)
+		if result.Passed() && len(result.Changes) > 0 {
+			resultReport.WriteString(green(fmt.Sprintf("[↻] template location [%s] golden test [%s] updated", result.TemplateDir, result.TestName)))
+			resultReport.WriteString(":\n")
+			resultReport.WriteString(formatChanges(result.Changes))
+			continue
+		}
+		if result.Passed() {
+			resultReport.WriteString(green(fmt.Sprintf("[✓] template location [%s] golden test [%s] succeeds", result.TemplateDir, result.TestName)))
+			resultReport.WriteString("\n")
+			continue
 		}
-		resultReport.WriteString(result.Value)
+		failure := red(fmt.Sprintf("[x] template location [%s] golden test [%s] fails", result.TemplateDir, result.TestName))
+		merr = errors.Join(merr, fmt.Errorf("%s:\n %w", failure, result.Err))
 		resultReport.WriteString("\n")
 	}
 
-	fmt.Println(resultReport.String())
+	fmt.Fprintln(c.Stdout(), resultReport.String())
 
-	if merr != nil {
-		return fmt.Errorf("golden test verification failure:\n %w", merr)
-	}
-
-	return merr
-}
-
-func verify(ctx context.Context, pool *workerpool.Pool[string], templateLocation string, testNames []string, stdout io.Writer) error {
-	logger := logging.FromContext(ctx)
-	logger.InfoContext(ctx, "verifying test for template location", "template_location", templateLocation)
-	testCases, err := parseTestCases(ctx, templateLocation, testNames)
-	if err != nil {
-		return fmt.Errorf("failed to parse golden tests: %w", err)
-	}
-
-	fs := &common.RealFS{}
-
-	// Highlight error message color, given diff text might be hundreds lines long.
-	// Only color the text when the result is to displayed at a terminal
-	var red, green func(a ...interface{}) string
-	useColor := stdout == os.Stdout && isatty.IsTerminal(os.Stdout.Fd())
-	if useColor {
-		red = color.New(color.FgRed).SprintFunc()
-		green = color.New(color.FgGreen).SprintFunc()
-	} else {
-		red = fmt.Sprint
-		green = fmt.Sprint
-	}
-
-	for _, tc := range testCases {
-		tc := tc
-
-		workerFunc := func() (_ string, rErr error) {
-			tempTracker := tempdir.NewDirTracker(fs, false)
-			defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
-
-			tempDir, err := tempTracker.MkdirTempTracked("", "verify-testcase-"+tc.TestName+"-")
-			if err != nil {
-				return "", fmt.Errorf("failed creating temp directory: %w", err)
-			}
-
-			err = renderTemplateTestCases(ctx, testCases, templateLocation, tempDir)
-			if err != nil {
-				return "", fmt.Errorf("failed to render test cases: %w", err)
-			}
-			tempTracker.Track(tempDir)
-
-			p := &diffOutputsOneTestParams{
-				templateLocation: templateLocation,
-				tempBase:         tempDir,
-				useColor:         useColor,
-				redSprintf:       red,
-				greenSprintf:     green,
-			}
-
-			if err := diffOutputsOneTest(ctx, p, tc); err != nil {
-				result := red(fmt.Sprintf("[x] template location [%s] golden test [%s] fails", templateLocation, tc.TestName))
-				return "", fmt.Errorf("%s:\n %w", result, err)
+	if c.flags.Coverage {
+		covs, err := SummarizeCoverage(ctx, results)
+		if err != nil {
+			return fmt.Errorf("failed summarizing coverage: %w", err)
+		}
+		writeCoverage(c.Stdout(), covs)
+		for _, cov := range covs {
+			if pct := cov.Percent(); pct < c.flags.MinCoverage {
+				merr = errors.Join(merr, fmt.Errorf("template location [%s] has %.1f%% coverage, which is below --min-coverage=%g",
+					cov.TemplateDir, pct, c.flags.MinCoverage))
 			}
-			return green(fmt.Sprintf("[✓] template location [%s] golden test [%s] succeeds", templateLocation, tc.TestName)), nil
 		}
+	}
 
-		if err := pool.Do(ctx, workerFunc); err != nil {
-			// The only way pool.Do() can return error is if the context is
-			// canceled.
-			return err //nolint:wrapcheck
+	if merr != nil {
+		// This overrides the categories of the individual test failures,
+		// because what matters to the caller is that golden tests failed.
+		return &common.CategorizedError{
+			Category: common.CategoryGoldenTestFailure,
+			Err:      fmt.Errorf("golden test verification failure:\n %w", merr),
 		}
 	}
 
 	return nil
 }
 
+func writeJUnitFile(path string, results []*Result) (rErr error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create JUnit report file: %w", err)
+	}
+	defer func() {
+		rErr = errors.Join(rErr, f.Close())
+	}()
+	return writeJUnit(f, results)
+}
+
 type diffOutputsOneTestParams struct {
 	templateLocation string
 	tempBase         string
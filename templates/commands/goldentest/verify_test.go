@@ -17,10 +17,16 @@ package goldentest
 
 import (
 	"context"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/flags"
 	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/cli"
 	"github.com/abcxyz/pkg/logging"
 	"github.com/abcxyz/pkg/testutil"
 )
@@ -59,6 +65,7 @@ kind: 'GoldenTest'`
 		testNames    []string
 		filesContent map[string]string
 		wantErrs     []string
+		wantExitCode int
 	}{
 		{
 			name: "simple_test_verify_succeeds",
@@ -110,7 +117,8 @@ kind: 'GoldenTest'`
 				"testdata/golden/test/data/a.txt":         "file A content",
 				"testdata/golden/test/data/b.txt":         "file B content",
 			},
-			wantErrs: []string{"b.txt] expected, however missing"},
+			wantErrs:     []string{"b.txt] expected, however missing"},
+			wantExitCode: common.ExitCodeGoldenTestFailure,
 		},
 		{
 			name: "failed_to_render_test_case",
@@ -380,6 +388,109 @@ kind: 'GoldenTest'`,
 				"testdata/golden/test/data/.gitfoo/file1.txt": "file1",
 			},
 		},
+		{
+			name: "expect_stdout_and_manifest_succeeds",
+			filesContent: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'A template with an input'
+inputs:
+  - name: 'greeting'
+    desc: 'A greeting'
+    default: 'Hello'
+steps:
+  - desc: 'Include some files and directories'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+  - desc: 'Print a message'
+    action: 'print'
+    params:
+      message: '{{.greeting}}, world'
+`,
+				"a.txt": "file A content",
+				"testdata/golden/test/test.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'GoldenTest'
+expect:
+  stdout_contains: ['Hello, world']
+  manifest:
+    inputs:
+      - name: 'greeting'
+        value: 'Hello'
+    output_files: ['a.txt']`,
+				"testdata/golden/test/data/.abc/stdout": "Hello, world\n",
+				"testdata/golden/test/data/a.txt":       "file A content",
+			},
+		},
+		{
+			name: "expect_stdout_and_manifest_fails",
+			filesContent: map[string]string{
+				"spec.yaml": printSpecYaml,
+				"testdata/golden/test/test.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'GoldenTest'
+expect:
+  stdout_contains: ['Goodbye']
+  manifest:
+    output_files: ['a.txt']`,
+				"testdata/golden/test/data/.abc/stdout": "Hello\n",
+			},
+			wantErrs: []string{
+				`expected the printed messages to contain "Goodbye", but they were "Hello\n"`,
+			},
+		},
+		{
+			name: "expect_manifest_fails",
+			filesContent: map[string]string{
+				"spec.yaml": printSpecYaml,
+				"testdata/golden/test/test.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'GoldenTest'
+expect:
+  manifest:
+    output_files: ['a.txt']`,
+				"testdata/golden/test/data/.abc/stdout": "Hello\n",
+			},
+			wantErrs: []string{
+				`expected the manifest to list output file "a.txt", but it didn't`,
+			},
+		},
+		{
+			name: "expect_error_succeeds",
+			filesContent: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'A template with a validated input'
+inputs:
+  - name: 'email'
+    desc: 'An email address'
+    default: 'not an email'
+    rules:
+      - rule: 'email.contains("@")'
+        message: 'must be an email address'
+steps:
+  - desc: 'Print a message'
+    action: 'print'
+    params:
+      message: '{{.email}}'
+`,
+				"testdata/golden/test/test.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'GoldenTest'
+expect:
+  error_contains: 'must be an email address'`,
+			},
+		},
+		{
+			name: "expect_error_but_render_succeeds",
+			filesContent: map[string]string{
+				"spec.yaml": printSpecYaml,
+				"testdata/golden/test/test.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'GoldenTest'
+expect:
+  error_contains: 'some error'`,
+			},
+			wantErrs: []string{
+				`expected rendering to fail with an error containing "some error", but it succeeded`,
+			},
+		},
 		{
 			name: "no test recorded data",
 			filesContent: map[string]string{
@@ -421,6 +532,276 @@ kind: 'GoldenTest'`,
 					t.Fatal(diff)
 				}
 			}
+			if tc.wantExitCode != 0 {
+				if got := common.ExitCodeOf(err); got != tc.wantExitCode {
+					t.Errorf("got exit code %d, want %d", got, tc.wantExitCode)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyCommand_Update(t *testing.T) {
+	t.Parallel()
+
+	specYaml := `api_version: 'cli.abcxyz.dev/v1beta5'
+kind: 'Template'
+
+desc: 'A simple template'
+
+steps:
+  - desc: 'Include some files and directories'
+    action: 'include'
+    params:
+      paths: ['.']
+  - desc: 'Print a message'
+    action: 'print'
+    params:
+      message: 'Hello'
+`
+	testYaml := `api_version: 'cli.abcxyz.dev/v1beta5'
+kind: 'GoldenTest'`
+
+	cases := []struct {
+		name         string
+		filesContent map[string]string
+		wantStdout   []string
+		wantFiles    map[string]string
+		wantErr      string
+	}{
+		{
+			name: "updates_changed_test",
+			filesContent: map[string]string{
+				"spec.yaml":                      specYaml,
+				"a.txt":                          "new A content",
+				"c.txt":                          "file C content",
+				".gitignore":                     "ignored",
+				"testdata/golden/test/test.yaml": testYaml,
+				"testdata/golden/test/data/.abc/.gitkeep":          "",
+				"testdata/golden/test/data/.abc/stdout":            "Hello\n",
+				"testdata/golden/test/data/a.txt":                  "old A content",
+				"testdata/golden/test/data/b.txt":                  "file B content",
+				"testdata/golden/test/data/.gitignore.abc_renamed": "ignored",
+			},
+			wantStdout: []string{
+				"golden test [test] updated:\n" +
+					"  modified: a.txt\n" +
+					"  removed: b.txt\n" +
+					"  added: c.txt\n",
+			},
+			wantFiles: map[string]string{
+				"test.yaml":                   testYaml,
+				"data/.abc/.gitkeep":          "",
+				"data/.abc/stdout":            "Hello\n",
+				"data/a.txt":                  "new A content",
+				"data/c.txt":                  "file C content",
+				"data/.gitignore.abc_renamed": "ignored",
+			},
+		},
+		{
+			name: "unchanged_test_is_untouched",
+			filesContent: map[string]string{
+				"spec.yaml":                             specYaml,
+				"testdata/golden/test/test.yaml":        testYaml,
+				"testdata/golden/test/data/.abc/stdout": "Hello\n",
+			},
+			wantStdout: []string{"golden test [test] succeeds"},
+			wantFiles: map[string]string{
+				"test.yaml":        testYaml,
+				"data/.abc/stdout": "Hello\n",
+			},
+		},
+		{
+			name: "render_failure_is_not_updated",
+			filesContent: map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta5'
+kind: 'Template'
+desc: 'A template with a required input'
+inputs:
+  - name: 'required_input'
+    desc: 'An input without a default'
+steps:
+  - desc: 'Print'
+    action: 'print'
+    params:
+      message: '{{.required_input}}'
+`,
+				"testdata/golden/test/test.yaml":  testYaml,
+				"testdata/golden/test/data/a.txt": "file A content",
+			},
+			wantErr: "failed to render test case [test]",
+			wantFiles: map[string]string{
+				"test.yaml":  testYaml,
+				"data/a.txt": "file A content",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			abctestutil.WriteAll(t, tempDir, tc.filesContent)
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+
+			r := &VerifyCommand{}
+			_, stdout, _ := r.Pipe()
+			err := r.Run(ctx, []string{"--update", tempDir})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			for _, want := range tc.wantStdout {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("stdout %q doesn't contain %q", stdout.String(), want)
+				}
+			}
+
+			got := abctestutil.LoadDir(t, filepath.Join(tempDir, "testdata/golden/test"))
+			if diff := cmp.Diff(got, tc.wantFiles); diff != "" {
+				t.Errorf("golden test dir was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestVerifyFlags_Parse(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		args    []string
+		want    VerifyFlags
+		wantErr string
+	}{
+		{
+			name: "all_flags_present",
+			args: []string{
+				"--test-name=test1",
+				"--run=^test",
+				"--update",
+				"--jobs=3",
+				"--shard-index=1",
+				"--shard-total=4",
+				"--junit=report.xml",
+				"--coverage",
+				"/a/b/c",
+			},
+			want: VerifyFlags{
+				Flags: Flags{
+					LogFlags: flags.LogFlags{
+						LogFormat: "text",
+						LogLevel:  "warning",
+					},
+					TestNames: []string{"test1"},
+					Run:       "^test",
+					Location:  "/a/b/c",
+				},
+				Update:     true,
+				Jobs:       3,
+				ShardIndex: 1,
+				ShardTotal: 4,
+				JUnit:      "report.xml",
+				Coverage:   true,
+			},
+		},
+		{
+			name: "shard_index_out_of_range",
+			args: []string{"--shard-index=4", "--shard-total=4"},
+			want: VerifyFlags{
+				Flags: Flags{
+					LogFlags: flags.LogFlags{
+						LogFormat: "text",
+						LogLevel:  "warning",
+					},
+					Location: ".",
+				},
+				ShardIndex: 4,
+				ShardTotal: 4,
+			},
+			wantErr: "--shard-index must be at least 0 and less than --shard-total (4), but was 4",
+		},
+		{
+			name: "shard_index_without_total",
+			args: []string{"--shard-index=1"},
+			want: VerifyFlags{
+				Flags: Flags{
+					LogFlags: flags.LogFlags{
+						LogFormat: "text",
+						LogLevel:  "warning",
+					},
+					Location: ".",
+				},
+				ShardIndex: 1,
+			},
+			wantErr: "--shard-index requires --shard-total",
+		},
+		{
+			name: "negative_jobs",
+			args: []string{"--jobs=-1"},
+			want: VerifyFlags{
+				Flags: Flags{
+					LogFlags: flags.LogFlags{
+						LogFormat: "text",
+						LogLevel:  "warning",
+					},
+					Location: ".",
+				},
+				Jobs: -1,
+			},
+			wantErr: "--jobs must not be negative",
+		},
+		{
+			name: "min_coverage_implies_coverage",
+			args: []string{"--min-coverage=75.5"},
+			want: VerifyFlags{
+				Flags: Flags{
+					LogFlags: flags.LogFlags{
+						LogFormat: "text",
+						LogLevel:  "warning",
+					},
+					Location: ".",
+				},
+				Coverage:    true,
+				MinCoverage: 75.5,
+			},
+		},
+		{
+			name: "min_coverage_out_of_range",
+			args: []string{"--min-coverage=101"},
+			want: VerifyFlags{
+				Flags: Flags{
+					LogFlags: flags.LogFlags{
+						LogFormat: "text",
+						LogLevel:  "warning",
+					},
+					Location: ".",
+				},
+				MinCoverage: 101,
+			},
+			wantErr: "--min-coverage must be between 0 and 100, but was 101",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var cmd VerifyCommand
+			cmd.SetLookupEnv(cli.MapLookuper(nil))
+
+			err := cmd.Flags().Parse(tc.args)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(cmd.flags, tc.want); diff != "" {
+				t.Errorf("got %#v, want %#v, diff (-got, +want): %v", cmd.flags, tc.want, diff)
+			}
 		})
 	}
 }
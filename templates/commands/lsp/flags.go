@@ -0,0 +1,39 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsp
+
+import (
+	"fmt"
+
+	"github.com/abcxyz/abc/templates/common/flags"
+	"github.com/abcxyz/pkg/cli"
+)
+
+// Flags are the options for "abc lsp".
+type Flags struct {
+	// See common/flags.LogFlags.
+	flags.LogFlags
+}
+
+func (f *Flags) Register(set *cli.FlagSet) {
+	f.LogFlags.Register(set)
+
+	set.AfterParse(func(existingErr error) error {
+		if len(set.Args()) > 0 {
+			return fmt.Errorf("unexpected arguments: %q", set.Args())
+		}
+		return nil
+	})
+}
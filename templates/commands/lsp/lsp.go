@@ -0,0 +1,75 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lsp implements the "lsp" subcommand, which runs a language server
+// for editor integrations.
+package lsp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abcxyz/abc-updater/pkg/metrics"
+	"github.com/abcxyz/abc/internal/metricswrap"
+	"github.com/abcxyz/abc/templates/common/lsp"
+	"github.com/abcxyz/pkg/cli"
+)
+
+type Command struct {
+	cli.BaseCommand
+	flags Flags
+}
+
+// Desc implements cli.Command.
+func (c *Command) Desc() string {
+	return "run a language server that checks spec.yaml files in your editor"
+}
+
+func (c *Command) Help() string {
+	return `
+Usage: {{ COMMAND }} [options]
+
+The {{ COMMAND }} command runs a Language Server Protocol server on stdin and
+stdout. It's meant to be started by an editor, not run by hand.
+
+While you edit abc YAML files, the server reports the same decoding and
+validation errors that abc would, and warns about template variables in
+spec.yaml that aren't inputs or builtin variables. It also completes action
+names and the fields of each action's params.
+
+Logs are written to stderr, which most editors show in an output panel.
+`
+}
+
+func (c *Command) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+func (c *Command) Run(ctx context.Context, args []string) error {
+	mClient := metrics.FromContext(ctx)
+	cleanup := metricswrap.WriteMetric(ctx, mClient, "command_lsp", 1)
+	defer cleanup()
+
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	ctx = c.flags.WithLogger(ctx, c.Stderr())
+
+	if err := lsp.Serve(ctx, c.Stdin(), c.Stdout()); err != nil {
+		return fmt.Errorf("language server failed: %w", err)
+	}
+	return nil
+}
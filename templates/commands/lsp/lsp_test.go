@@ -0,0 +1,80 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestCommand(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		args       []string
+		in         []string
+		wantStdout string
+		wantErr    string
+	}{
+		{
+			name: "shutdown_and_exit",
+			in: []string{
+				`{"jsonrpc":"2.0","id":1,"method":"shutdown"}`,
+				`{"jsonrpc":"2.0","method":"exit"}`,
+			},
+			wantStdout: "Content-Length: 38\r\n\r\n" + `{"jsonrpc":"2.0","id":1,"result":null}`,
+		},
+		{
+			name:       "stdin_closed",
+			wantStdout: "",
+		},
+		{
+			name:    "bad_message",
+			in:      []string{"not json"},
+			wantErr: "language server failed: failed parsing message",
+		},
+		{
+			name:    "unexpected_args",
+			args:    []string{"foo"},
+			wantErr: "unexpected arguments",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			cmd := &Command{}
+			stdin, stdout, _ := cmd.Pipe()
+			for _, msg := range tc.in {
+				fmt.Fprintf(stdin, "Content-Length: %d\r\n\r\n%s", len(msg), msg)
+			}
+
+			err := cmd.Run(context.Background(), tc.args)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if got := stdout.String(); got != tc.wantStdout {
+				t.Errorf("stdout = %q, want %q", got, tc.wantStdout)
+			}
+		})
+	}
+}
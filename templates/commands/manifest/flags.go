@@ -0,0 +1,64 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common/flags"
+	"github.com/abcxyz/pkg/cli"
+)
+
+// GetFlags describes which manifest to read and what to print from it.
+type GetFlags struct {
+	// See common/flags.LogFlags.
+	flags.LogFlags
+
+	// Location is either a manifest file, or a directory that a template was
+	// rendered into.
+	Location string
+
+	// Fields are the manifest fields to print, in the form of dotted paths like
+	// "template_version" or "inputs.name_to_greet". If empty, the whole
+	// manifest is printed as JSON.
+	Fields []string
+}
+
+func (g *GetFlags) Register(set *cli.FlagSet) {
+	f := flags.NewSection(set, "GET OPTIONS")
+
+	f.StringSliceVar(&cli.StringSliceVar{
+		Name:    "field",
+		Example: "inputs.name_to_greet",
+		Target:  &g.Fields,
+		Usage: "a manifest field to print, as a dotted path; list elements are selected by their name " +
+			"(for inputs) or file (for output_files). May be repeated to print several fields, one per line. " +
+			"If omitted, the whole manifest is printed as JSON.",
+	})
+
+	g.LogFlags.Register(set)
+
+	set.AfterParse(func(existingErr error) error {
+		g.Location = strings.TrimSpace(set.Arg(0))
+		if g.Location == "" {
+			return fmt.Errorf("missing <location> argument")
+		}
+		if len(set.Args()) > 1 {
+			return fmt.Errorf("expected exactly one argument, but got %q", set.Args())
+		}
+		return nil
+	})
+}
@@ -0,0 +1,229 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package manifest implements the subcommands for inspecting the manifests
+// written by renders.
+package manifest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc-updater/pkg/metrics"
+	"github.com/abcxyz/abc/internal/metricswrap"
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/indexutil"
+	manifestutil "github.com/abcxyz/abc/templates/model/manifest"
+	"github.com/abcxyz/pkg/cli"
+)
+
+type GetCommand struct {
+	cli.BaseCommand
+	flags GetFlags
+}
+
+// Desc implements cli.Command.
+func (c *GetCommand) Desc() string {
+	return "print fields from a template manifest"
+}
+
+// Help implements cli.Command.
+func (c *GetCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options] <location>
+
+The {{ COMMAND }} command prints fields from a manifest, so that scripts don't
+need to parse the manifest YAML themselves. The <location> is either a manifest
+file, or a directory that a template was rendered into; in the latter case, the
+directory must contain exactly one manifest.
+
+Each --field is printed on its own line. Fields are dotted paths using the
+manifest's YAML field names, like "template_version" or
+"render_environment.os". Inputs are selected by name and output files by
+path, like "inputs.name_to_greet" or "output_files.main.go.hash". Scalar values
+are printed as plain text, and lists and objects as JSON. Without --field, the
+whole manifest is printed as JSON.
+
+Manifests written by older versions of abc are upgraded to the newest manifest
+format first, so the same field names work for all of them.
+`
+}
+
+// Flags implements cli.Command.
+func (c *GetCommand) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+func (c *GetCommand) Run(ctx context.Context, args []string) error {
+	mClient := metrics.FromContext(ctx)
+	cleanup := metricswrap.WriteMetric(ctx, mClient, "command_manifest_get", 1)
+	defer cleanup()
+
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	ctx = c.flags.WithLogger(ctx, c.Stderr())
+
+	fs := &common.RealFS{}
+	path, err := findManifest(fs, c.flags.Location)
+	if err != nil {
+		return err
+	}
+
+	m, _, err := manifestutil.Load(ctx, fs, path)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	// Round-trip through YAML to get a generic tree with the same field names
+	// as the manifest file.
+	buf, err := yaml.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed marshaling manifest: %w", err)
+	}
+	var tree map[string]any
+	if err := yaml.Unmarshal(buf, &tree); err != nil {
+		return fmt.Errorf("failed unmarshaling manifest: %w", err)
+	}
+
+	if len(c.flags.Fields) == 0 {
+		enc := json.NewEncoder(c.Stdout())
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(tree); err != nil {
+			return fmt.Errorf("failed writing manifest as JSON: %w", err)
+		}
+		return nil
+	}
+
+	for _, field := range c.flags.Fields {
+		val, err := lookup(tree, field)
+		if err != nil {
+			return err
+		}
+		if err := printValue(c.Stdout(), val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findManifest returns the path of the manifest at the given location, which
+// is either a manifest file or a directory containing a single manifest in its
+// .abc directory.
+func findManifest(fs common.FS, location string) (string, error) {
+	fi, err := fs.Stat(location)
+	if err != nil {
+		return "", fmt.Errorf("failed reading %q: %w", location, err)
+	}
+	if !fi.IsDir() {
+		return location, nil
+	}
+
+	abcDir := filepath.Join(location, common.ABCInternalDir)
+	paths, err := indexutil.CrawlManifests(abcDir)
+	if err != nil {
+		return "", fmt.Errorf("while crawling manifests: %w", err)
+	}
+	switch len(paths) {
+	case 0:
+		return "", fmt.Errorf("found no manifest in %q", abcDir)
+	case 1:
+		return filepath.Join(abcDir, paths[0]), nil
+	default:
+		return "", fmt.Errorf("found multiple manifests in %q, please give the path to one of them: %q", abcDir, paths)
+	}
+}
+
+// lookup returns the value at the given dotted path in the manifest tree. When
+// the path reaches a list, the next part of the path selects the list element
+// whose "name" or "file" field matches it. Since file names may themselves
+// contain dots, the longest matching element name wins.
+func lookup(tree map[string]any, field string) (any, error) {
+	parts := strings.Split(field, ".")
+	var cur any = tree
+	for len(parts) > 0 {
+		switch node := cur.(type) {
+		case map[string]any:
+			next, ok := node[parts[0]]
+			if !ok {
+				return nil, fmt.Errorf("the manifest has no field %q", field)
+			}
+			cur = next
+			parts = parts[1:]
+		case []any:
+			elem, consumed := findElement(node, parts)
+			if consumed == 0 {
+				return nil, fmt.Errorf("the manifest has no field %q", field)
+			}
+			cur = elem
+			parts = parts[consumed:]
+		default:
+			return nil, fmt.Errorf("the manifest has no field %q", field)
+		}
+	}
+	return cur, nil
+}
+
+// findElement finds the list element whose "name" or "file" field is equal to
+// the longest possible prefix of parts joined with dots. It returns the
+// element and the number of parts used, which is zero if nothing matched.
+func findElement(list []any, parts []string) (any, int) {
+	for n := len(parts); n > 0; n-- {
+		key := strings.Join(parts[:n], ".")
+		for _, elem := range list {
+			m, ok := elem.(map[string]any)
+			if !ok {
+				continue
+			}
+			if m["name"] == key || m["file"] == key {
+				return m, n
+			}
+		}
+	}
+	return nil, 0
+}
+
+// printValue prints a scalar as plain text, or a list or object as JSON, on a
+// line of its own.
+func printValue(w io.Writer, val any) error {
+	var s string
+	switch v := val.(type) {
+	case nil:
+	case string:
+		s = v
+	case time.Time:
+		s = v.Format(time.RFC3339Nano)
+	case map[string]any, []any:
+		buf, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed marshaling JSON: %w", err)
+		}
+		s = string(buf)
+	default:
+		s = fmt.Sprint(v)
+	}
+	if _, err := fmt.Fprintln(w, s); err != nil {
+		return fmt.Errorf("failed writing output: %w", err)
+	}
+	return nil
+}
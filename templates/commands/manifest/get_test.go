@@ -0,0 +1,223 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+const testManifest = `# Generated by the "abc" command. Do not modify.
+api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Manifest'
+creation_time: '2024-06-25T11:00:00Z'
+modification_time: '2024-06-25T12:00:00Z'
+template_location: 'github.com/abcxyz/abc/examples/templates/render/hello_jupiter'
+location_type: 'remote_git'
+template_version: 'v1.2.3'
+upgrade_channel: 'latest'
+template_dirhash: 'h1:abc'
+inputs:
+  - name: 'name_to_greet'
+    value: 'jupiter'
+    source: 'flag'
+  - name: 'punctuation'
+    value: '!'
+output_files:
+  - file: 'main.go'
+    hash: 'h1:def'
+render_environment:
+  cli_version: '1.0.0'
+  os: 'linux'
+  arch: 'amd64'
+  render_duration_ms: 123
+`
+
+// An old manifest that is upgraded to the newest model before being read.
+const testManifestV1alpha1 = `api_version: 'cli.abcxyz.dev/v1alpha1'
+kind: 'Manifest'
+creation_time: '2024-06-25T11:00:00Z'
+modification_time: '2024-06-25T12:00:00Z'
+template_location: ''
+location_type: ''
+template_version: ''
+upgrade_channel: ''
+template_dirhash: 'h1:abc'
+inputs: []
+output_files: []
+`
+
+func TestGetCommand(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		files      map[string]string
+		location   string
+		args       []string
+		wantStdout string
+		wantErr    string
+	}{
+		{
+			name:       "scalar_field_from_file",
+			files:      map[string]string{"dest/.abc/manifest_a.lock.yaml": testManifest},
+			location:   "dest/.abc/manifest_a.lock.yaml",
+			args:       []string{"--field=template_version"},
+			wantStdout: "v1.2.3\n",
+		},
+		{
+			name:     "several_fields_from_dir",
+			files:    map[string]string{"dest/.abc/manifest_a.lock.yaml": testManifest},
+			location: "dest",
+			args: []string{
+				"--field=inputs.name_to_greet.value",
+				"--field=output_files.main.go.hash",
+				"--field=render_environment.render_duration_ms",
+				"--field=modification_time",
+			},
+			wantStdout: "jupiter\nh1:def\n123\n2024-06-25T12:00:00Z\n",
+		},
+		{
+			name:       "object_field_as_json",
+			files:      map[string]string{"dest/.abc/manifest_a.lock.yaml": testManifest},
+			location:   "dest",
+			args:       []string{"--field=inputs.punctuation"},
+			wantStdout: `{"name":"punctuation","value":"!"}` + "\n",
+		},
+		{
+			name:     "whole_manifest_as_json",
+			files:    map[string]string{"dest/.abc/manifest_a.lock.yaml": testManifestV1alpha1},
+			location: "dest",
+			wantStdout: `{
+  "creation_time": "2024-06-25T11:00:00Z",
+  "inputs": [],
+  "location_type": "",
+  "modification_time": "2024-06-25T12:00:00Z",
+  "output_files": [],
+  "template_dirhash": "h1:abc",
+  "template_location": "",
+  "template_version": "",
+  "upgrade_channel": ""
+}
+`,
+		},
+		{
+			name:     "nonexistent_field",
+			files:    map[string]string{"dest/.abc/manifest_a.lock.yaml": testManifest},
+			location: "dest",
+			args:     []string{"--field=inputs.nonexistent"},
+			wantErr:  `the manifest has no field "inputs.nonexistent"`,
+		},
+		{
+			name: "multiple_manifests_in_dir",
+			files: map[string]string{
+				"dest/.abc/manifest_a.lock.yaml": testManifest,
+				"dest/.abc/manifest_b.lock.yaml": testManifest,
+			},
+			location: "dest",
+			wantErr:  "found multiple manifests",
+		},
+		{
+			name:     "no_manifest_in_dir",
+			files:    map[string]string{"dest/file.txt": "hello"},
+			location: "dest",
+			wantErr:  "found no manifest",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			abctestutil.WriteAll(t, tempDir, tc.files)
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			cmd := &GetCommand{}
+			_, stdout, _ := cmd.Pipe()
+			args := append(tc.args, filepath.Join(tempDir, tc.location))
+			err := cmd.Run(ctx, args)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(stdout.String(), tc.wantStdout); diff != "" {
+				t.Errorf("stdout was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestGetFlags_Parse(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		args    []string
+		want    GetFlags
+		wantErr string
+	}{
+		{
+			name: "fields_and_location",
+			args: []string{"--field=template_version", "--field=inputs.foo", "some/dir"},
+			want: GetFlags{
+				Location: "some/dir",
+				Fields:   []string{"template_version", "inputs.foo"},
+			},
+		},
+		{
+			name:    "missing_location",
+			args:    []string{"--field=template_version"},
+			wantErr: "missing <location> argument",
+		},
+		{
+			name:    "too_many_args",
+			args:    []string{"a", "b"},
+			wantErr: "expected exactly one argument",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var cmd GetCommand
+			cmd.SetLookupEnv(cli.MapLookuper(nil))
+
+			err := cmd.Flags().Parse(tc.args)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(cmd.flags, tc.want, cmp.FilterPath(func(p cmp.Path) bool {
+				return p.String() == "LogFlags"
+			}, cmp.Ignore())); diff != "" {
+				t.Errorf("flags were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
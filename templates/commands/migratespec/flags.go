@@ -0,0 +1,58 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migratespec
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common/flags"
+	"github.com/abcxyz/pkg/cli"
+)
+
+// Flags describes which template to migrate and how.
+type Flags struct {
+	// See common/flags.LogFlags.
+	flags.LogFlags
+
+	// Location is the local directory containing the template's spec.yaml.
+	Location string
+
+	// DryRun prints what would change without writing any files.
+	DryRun bool
+}
+
+func (f *Flags) Register(set *cli.FlagSet) {
+	s := flags.NewSection(set, "MIGRATE OPTIONS")
+	s.BoolVar(&cli.BoolVar{
+		Name:    "dry-run",
+		Target:  &f.DryRun,
+		Default: false,
+		Usage:   "print which files would be migrated and how their behavior would change, without writing them",
+	})
+
+	f.LogFlags.Register(set)
+
+	set.AfterParse(func(existingErr error) error {
+		f.Location = strings.TrimSpace(set.Arg(0))
+		if f.Location == "" {
+			return fmt.Errorf("missing <location> of the template directory")
+		}
+		if len(set.Args()) > 1 {
+			return fmt.Errorf("expected exactly one argument, the template directory, but got %q", set.Args())
+		}
+		return nil
+	})
+}
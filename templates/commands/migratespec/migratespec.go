@@ -0,0 +1,354 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package migratespec implements the "templates migrate-spec" subcommand.
+package migratespec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc-updater/pkg/metrics"
+	"github.com/abcxyz/abc/internal/metricswrap"
+	"github.com/abcxyz/abc/internal/version"
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/specutil"
+	"github.com/abcxyz/abc/templates/model"
+	"github.com/abcxyz/abc/templates/model/decode"
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// featureChanges describes, for each field of the spec and golden test
+// Features structs, how behavior changes when that feature is turned on by
+// migrating to a newer api_version.
+var featureChanges = map[string]string{
+	// Spec features.
+	"SkipGlobs":             "paths in actions are interpreted as file globs, so characters like *, ? and [ match other file names",
+	"SkipGitVars":           "the _git_sha, _git_short_sha and _git_tag variables are available to templates",
+	"SkipTime":              "the _now_ms variable and the formatTime function are available to templates",
+	"SkipFileMetadata":      "the file_metadata field is honored",
+	"SkipGitignore":         `includes with "from: destination" skip the paths ignored by the destination's .gitignore files`,
+	"SkipGitignorePatterns": `ignore patterns are gitignore-style (with "!", "**" and trailing "/") and also apply to the files that steps modify and write to the destination`,
+	"SkipConditionalPaths":  "file and directory names containing Go templates are rendered when included, and names that render to the empty string are skipped",
+	"SkipPartials":          "files in the _partials directory are available to go_template actions and are no longer included with the template root",
+
+	// Golden test features.
+	"SkipStdout":     "the template's stdout is recorded and verified; re-record this test",
+	"SkipABCRenamed": "git-related files in the golden data are stored with an .abc_renamed suffix; re-record this test",
+}
+
+type Command struct {
+	cli.BaseCommand
+	flags Flags
+}
+
+// Desc implements cli.Command.
+func (c *Command) Desc() string {
+	return "rewrite a template's spec.yaml and golden tests to the newest api_version"
+}
+
+// Help implements cli.Command.
+func (c *Command) Help() string {
+	return `
+Usage: {{ COMMAND }} [options] <location>
+
+The {{ COMMAND }} command rewrites the spec.yaml and golden test.yaml files of
+the template in the local directory <location> to use the newest api_version
+that this version of abc supports. Only the api_version line is changed, so
+comments and formatting are preserved.
+
+Newer api_versions can change how a template renders. For each file, the
+changes in behavior that the migration turns on are printed, so they can be
+reviewed before committing. Golden tests should be verified, and re-recorded
+if needed, after migrating.
+`
+}
+
+// Flags implements cli.Command.
+func (c *Command) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+func (c *Command) Run(ctx context.Context, args []string) error {
+	mClient := metrics.FromContext(ctx)
+	cleanup := metricswrap.WriteMetric(ctx, mClient, "command_migrate_spec", 1)
+	defer cleanup()
+
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	ctx = c.flags.WithLogger(ctx, c.Stderr())
+
+	fs := &common.RealFS{}
+	paths, err := templateFiles(fs, c.flags.Location)
+	if err != nil {
+		return err
+	}
+
+	// Migrate every file in memory before writing any of them, so an invalid
+	// file doesn't leave the template half-migrated.
+	isReleaseBuild := version.IsReleaseBuild()
+	migrations := make([]*migration, 0, len(paths))
+	for _, p := range paths {
+		m, err := migrateFile(ctx, fs, c.flags.Location, p.path, p.kind, isReleaseBuild)
+		if err != nil {
+			return err
+		}
+		migrations = append(migrations, m)
+	}
+
+	if !c.flags.DryRun {
+		for _, m := range migrations {
+			if m.buf == nil {
+				continue
+			}
+			if err := writeFile(fs, filepath.Join(c.flags.Location, m.path), m.buf); err != nil {
+				return err
+			}
+		}
+	}
+
+	return printSummary(c.Stdout(), migrations, c.flags.DryRun)
+}
+
+// templateFile is a file to migrate, relative to the template directory.
+type templateFile struct {
+	path string
+	kind string
+}
+
+// templateFiles returns the spec.yaml of the template in dir, followed by its
+// golden test files in sorted order.
+func templateFiles(fs common.FS, dir string) ([]*templateFile, error) {
+	if _, err := fs.Stat(filepath.Join(dir, specutil.SpecFileName)); err != nil {
+		if common.IsNotExistErr(err) {
+			return nil, fmt.Errorf("%q is not a template directory, it has no %s", dir, specutil.SpecFileName)
+		}
+		return nil, fmt.Errorf("failed reading %s in %q: %w", specutil.SpecFileName, dir, err)
+	}
+	out := []*templateFile{{path: specutil.SpecFileName, kind: decode.KindTemplate}}
+
+	tests, err := filepath.Glob(filepath.Join(dir, "testdata", "golden", "*", "test.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed finding golden tests: %w", err)
+	}
+	slices.Sort(tests)
+	for _, t := range tests {
+		rel, err := filepath.Rel(dir, t)
+		if err != nil {
+			return nil, fmt.Errorf("filepath.Rel(%q, %q): %w", dir, t, err)
+		}
+		out = append(out, &templateFile{path: rel, kind: decode.KindGoldenTest})
+	}
+	return out, nil
+}
+
+// migration is the result of migrating one file.
+type migration struct {
+	// path is relative to the template directory.
+	path string
+
+	from, to string
+
+	// changes describes the behavior that the migration turns on.
+	changes []string
+
+	// buf is the migrated contents of the file, or nil if the file is already
+	// up to date.
+	buf []byte
+}
+
+// migrateFile rewrites the api_version of the given file to the newest one,
+// and works out how its behavior changes by upgrading it in memory.
+func migrateFile(ctx context.Context, fs common.FS, dir, path, kind string, isReleaseBuild bool) (*migration, error) {
+	logger := logging.FromContext(ctx).With("logger", "migrateFile")
+
+	buf, err := fs.ReadFile(filepath.Join(dir, path))
+	if err != nil {
+		return nil, fmt.Errorf("failed reading %s: %w", path, err)
+	}
+	vu, apiVersion, _, err := decode.Decode(bytes.NewReader(buf), path, kind, isReleaseBuild)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	m := &migration{
+		path: path,
+		from: apiVersion,
+		to:   decode.LatestSupportedAPIVersion(isReleaseBuild),
+	}
+
+	for {
+		upgraded, err := vu.Upgrade(ctx)
+		if err != nil {
+			if errors.Is(err, model.ErrLatestVersion) {
+				break
+			}
+			return nil, fmt.Errorf("failed upgrading %s from api_version %s: %w", path, apiVersion, err)
+		}
+		vu = upgraded
+	}
+	m.changes = enabledFeatures(vu)
+
+	out, err := rewriteAPIVersion(buf, m.to)
+	if err != nil {
+		return nil, fmt.Errorf("failed rewriting %s: %w", path, err)
+	}
+	if bytes.Equal(out, buf) {
+		logger.DebugContext(ctx, "file is already up to date", "path", path)
+		return m, nil
+	}
+
+	// The old and new api_versions might disagree about which fields are
+	// allowed, so check that the rewritten file is still valid.
+	if _, _, _, err := decode.Decode(bytes.NewReader(out), path, kind, isReleaseBuild); err != nil {
+		return nil, fmt.Errorf("%s can't be migrated automatically from %s to %s: %w", path, m.from, m.to, err)
+	}
+	m.buf = out
+	return m, nil
+}
+
+// enabledFeatures returns the descriptions of the features that are turned
+// off in the given upgraded model, and so would be turned on by declaring the
+// newest api_version, in the order they were introduced.
+func enabledFeatures(vu model.ValidatorUpgrader) []string {
+	v := reflect.Indirect(reflect.ValueOf(vu))
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	f := v.FieldByName("Features")
+	if !f.IsValid() || f.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var out []string
+	for i := 0; i < f.NumField(); i++ {
+		if f.Field(i).Kind() != reflect.Bool || !f.Field(i).Bool() {
+			continue
+		}
+		name := f.Type().Field(i).Name
+		desc, ok := featureChanges[name]
+		if !ok {
+			desc = strings.TrimPrefix(name, "Skip") + " is enabled"
+		}
+		out = append(out, desc)
+	}
+	return out
+}
+
+// rewriteAPIVersion returns buf with the value of its top-level api_version
+// field replaced by apiVersion. An old-style "apiVersion" field is renamed to
+// "api_version". Only that line is changed; the rest of the file, including
+// comments, is kept byte for byte.
+func rewriteAPIVersion(buf []byte, apiVersion string) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(buf, &doc); err != nil {
+		return nil, fmt.Errorf("failed parsing YAML: %w", err)
+	}
+	if len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("the top level of the file must be a YAML object")
+	}
+
+	var key, val *yaml.Node
+	fields := doc.Content[0].Content
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i].Value == "api_version" || fields[i].Value == "apiVersion" {
+			key, val = fields[i], fields[i+1]
+			break
+		}
+	}
+	if key == nil {
+		return nil, fmt.Errorf(`the file has no "api_version" field`)
+	}
+	if val.Kind != yaml.ScalarNode || val.Line != key.Line {
+		return nil, fmt.Errorf(`the "api_version" field must be a string on the same line as its key`)
+	}
+
+	lines := strings.Split(string(buf), "\n")
+	line := lines[key.Line-1]
+	eol := ""
+	if strings.HasSuffix(line, "\r") {
+		line, eol = strings.TrimSuffix(line, "\r"), "\r"
+	}
+
+	// Keep a trailing comment, like "api_version: 'v1' # comment".
+	comment := ""
+	rest := line[val.Column-1:]
+	if i := strings.Index(rest, " #"); i >= 0 {
+		comment = rest[len(strings.TrimRight(rest[:i], " \t")):]
+	}
+
+	lines[key.Line-1] = fmt.Sprintf("%sapi_version: '%s'%s%s", line[:key.Column-1], apiVersion, comment, eol)
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// writeFile overwrites the file at path, keeping its permissions.
+func writeFile(fs common.FS, path string, buf []byte) error {
+	fi, err := fs.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed reading %s: %w", path, err)
+	}
+	if err := fs.WriteFile(path, buf, fi.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed writing %s: %w", path, err)
+	}
+	return nil
+}
+
+// printSummary prints what happened to each file, and how their behavior
+// changes.
+func printSummary(w io.Writer, migrations []*migration, dryRun bool) error {
+	verb := "migrated"
+	if dryRun {
+		verb = "would migrate"
+	}
+
+	var sb strings.Builder
+	var anyMigrated bool
+	for _, m := range migrations {
+		if m.buf == nil {
+			fmt.Fprintf(&sb, "%s: already at %s\n", m.path, m.to)
+			continue
+		}
+		anyMigrated = true
+		fmt.Fprintf(&sb, "%s: %s from %s to %s\n", m.path, verb, m.from, m.to)
+		if len(m.changes) == 0 {
+			sb.WriteString("  no changes in behavior\n")
+			continue
+		}
+		sb.WriteString("  changes in behavior:\n")
+		for _, c := range m.changes {
+			fmt.Fprintf(&sb, "  - %s\n", c)
+		}
+	}
+	if anyMigrated && len(migrations) > 1 {
+		sb.WriteString("\nRun \"abc templates golden-test verify\" to check whether the template's output changed.\n")
+	}
+
+	if _, err := io.WriteString(w, sb.String()); err != nil {
+		return fmt.Errorf("failed writing summary: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migratespec
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+const (
+	oldSpec = `# The template's spec.
+apiVersion: 'cli.abcxyz.dev/v1beta5' # pinned
+kind: 'Template'
+
+desc: 'A template'
+steps:
+  - desc: 'Include everything'
+    action: 'include'
+    params:
+      paths: ['.']
+`
+
+	migratedSpec = `# The template's spec.
+api_version: 'cli.abcxyz.dev/v1beta7' # pinned
+kind: 'Template'
+
+desc: 'A template'
+steps:
+  - desc: 'Include everything'
+    action: 'include'
+    params:
+      paths: ['.']
+`
+
+	oldTest = `api_version: "cli.abcxyz.dev/v1beta3"
+kind: 'GoldenTest'
+inputs:
+  - name: 'foo'
+    value: 'bar'
+`
+
+	migratedTest = `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'GoldenTest'
+inputs:
+  - name: 'foo'
+    value: 'bar'
+`
+
+	latestTest = `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'GoldenTest'
+`
+)
+
+func TestCommand(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		files      map[string]string
+		flagArgs   []string
+		wantFiles  map[string]string
+		wantStdout []string
+		wantErr    string
+	}{
+		{
+			name: "spec_and_golden_tests",
+			files: map[string]string{
+				"spec.yaml":                        oldSpec,
+				"testdata/golden/old/test.yaml":    oldTest,
+				"testdata/golden/latest/test.yaml": latestTest,
+			},
+			wantFiles: map[string]string{
+				"spec.yaml":                        migratedSpec,
+				"testdata/golden/old/test.yaml":    migratedTest,
+				"testdata/golden/latest/test.yaml": latestTest,
+			},
+			wantStdout: []string{
+				"spec.yaml: migrated from cli.abcxyz.dev/v1beta5 to cli.abcxyz.dev/v1beta7",
+				"the _now_ms variable and the formatTime function are available",
+				"files in the _partials directory are available",
+				"testdata/golden/latest/test.yaml: already at cli.abcxyz.dev/v1beta7",
+				"testdata/golden/old/test.yaml: migrated from cli.abcxyz.dev/v1beta3 to cli.abcxyz.dev/v1beta7",
+				"the template's stdout is recorded and verified; re-record this test",
+			},
+		},
+		{
+			name: "dry_run",
+			files: map[string]string{
+				"spec.yaml": oldSpec,
+			},
+			flagArgs: []string{"--dry-run"},
+			wantFiles: map[string]string{
+				"spec.yaml": oldSpec,
+			},
+			wantStdout: []string{
+				"spec.yaml: would migrate from cli.abcxyz.dev/v1beta5 to cli.abcxyz.dev/v1beta7",
+			},
+		},
+		{
+			name: "invalid_golden_test_writes_nothing",
+			files: map[string]string{
+				"spec.yaml":                     oldSpec,
+				"testdata/golden/bad/test.yaml": "api_version: 'cli.abcxyz.dev/v1beta3'\nkind: 'GoldenTest'\nnope: 1\n",
+			},
+			wantFiles: map[string]string{
+				"spec.yaml":                     oldSpec,
+				"testdata/golden/bad/test.yaml": "api_version: 'cli.abcxyz.dev/v1beta3'\nkind: 'GoldenTest'\nnope: 1\n",
+			},
+			wantErr: `unknown field name "nope"`,
+		},
+		{
+			name: "not_a_template",
+			files: map[string]string{
+				"README.md": "hello",
+			},
+			wantFiles: map[string]string{
+				"README.md": "hello",
+			},
+			wantErr: "has no spec.yaml",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			dir := t.TempDir()
+			abctestutil.WriteAll(t, dir, tc.files)
+
+			cmd := &Command{}
+			_, stdout, _ := cmd.Pipe()
+			err := cmd.Run(ctx, append(tc.flagArgs, dir))
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+
+			if diff := cmp.Diff(abctestutil.LoadDir(t, dir), tc.wantFiles); diff != "" {
+				t.Errorf("files were not as expected (-got,+want): %s", diff)
+			}
+			for _, want := range tc.wantStdout {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("stdout %q doesn't contain %q", stdout.String(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestRewriteAPIVersion(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "unquoted_with_crlf",
+			in:   "kind: Template\r\napi_version: cli.abcxyz.dev/v1beta1\r\ndesc: x\r\n",
+			want: "kind: Template\r\napi_version: 'cli.abcxyz.dev/v1beta7'\r\ndesc: x\r\n",
+		},
+		{
+			name: "keeps_comments",
+			in:   "# head\napi_version: 'cli.abcxyz.dev/v1beta6'  # trailing\n# tail\n",
+			want: "# head\napi_version: 'cli.abcxyz.dev/v1beta7'  # trailing\n# tail\n",
+		},
+		{
+			name:    "missing",
+			in:      "kind: Template\n",
+			wantErr: `has no "api_version" field`,
+		},
+		{
+			name:    "not_an_object",
+			in:      "- a\n",
+			wantErr: "must be a YAML object",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := rewriteAPIVersion([]byte(tc.in), "cli.abcxyz.dev/v1beta7")
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(string(got), tc.want); err == nil && diff != "" {
+				t.Errorf("output was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
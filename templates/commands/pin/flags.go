@@ -0,0 +1,87 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pin
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/posener/complete/v2/predict"
+
+	"github.com/abcxyz/abc/templates/common/flags"
+	"github.com/abcxyz/pkg/cli"
+)
+
+// Flags describes which manifests to pin or unpin.
+type Flags struct {
+	// See common/flags.LogFlags.
+	flags.LogFlags
+
+	// Location is a manifest file, or a directory to search recursively for
+	// manifests. Defaults to the current directory.
+	Location string
+
+	// DryRun only prints what would change.
+	DryRun bool
+}
+
+func (f *Flags) Register(set *cli.FlagSet) {
+	s := flags.NewSection(set, "PIN OPTIONS")
+
+	s.BoolVar(&cli.BoolVar{
+		Name:    "dry-run",
+		Target:  &f.DryRun,
+		Default: false,
+		Usage:   "Print the manifests that would be changed, without changing them.",
+	})
+
+	f.LogFlags.Register(set)
+
+	set.AfterParse(func(existingErr error) error {
+		f.Location = strings.TrimSpace(set.Arg(0))
+		if f.Location == "" {
+			f.Location = "."
+		}
+		if len(set.Args()) > 1 {
+			return fmt.Errorf("expected at most one argument, but got %q", set.Args())
+		}
+		return nil
+	})
+}
+
+// UnpinFlags are the flags for the unpin subcommand, which accepts everything
+// in Flags plus some unpin-specific flags.
+type UnpinFlags struct {
+	Flags
+
+	// UpgradeChannel is the upgrade channel for manifests that don't record
+	// the one they had before they were pinned.
+	UpgradeChannel string
+}
+
+func (f *UnpinFlags) Register(set *cli.FlagSet) {
+	s := flags.NewSection(set, "UNPIN OPTIONS")
+
+	s.StringVar(&cli.StringVar{
+		Name:    "upgrade-channel",
+		Example: "main",
+		Target:  &f.UpgradeChannel,
+		Predict: predict.Set([]string{"latest", "main"}),
+		Usage: `The upgrade channel for manifests that don't record the one they had before "abc pin", ` +
+			`such as manifests that were pinned by hand. Either a branch name or the special string "latest".`,
+	})
+
+	f.Flags.Register(set)
+}
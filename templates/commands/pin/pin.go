@@ -0,0 +1,153 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pin implements the pin and unpin subcommands, which freeze template
+// installations at their installed versions and loosen them again.
+package pin
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/abcxyz/abc-updater/pkg/metrics"
+	"github.com/abcxyz/abc/internal/metricswrap"
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/pin"
+	"github.com/abcxyz/pkg/cli"
+)
+
+type PinCommand struct {
+	cli.BaseCommand
+	flags Flags
+}
+
+// Desc implements cli.Command.
+func (c *PinCommand) Desc() string {
+	return "make template installations upgrade only to their installed versions"
+}
+
+// Help implements cli.Command.
+func (c *PinCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options] [<location>]
+
+The {{ COMMAND }} command rewrites the manifests of template installations that
+track an upgrade channel like "main" or "latest" so that they track the exact
+version that's installed instead, like "v1.2.3" or a commit SHA. After that,
+"abc upgrade" leaves them alone. This is useful to freeze a repo before a
+release; use "abc unpin" to loosen it again afterwards.
+
+The <location> is a manifest file, or a directory to search recursively for
+manifests. It defaults to the current directory.
+`
+}
+
+// Flags implements cli.Command.
+func (c *PinCommand) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+func (c *PinCommand) Run(ctx context.Context, args []string) error {
+	mClient := metrics.FromContext(ctx)
+	cleanup := metricswrap.WriteMetric(ctx, mClient, "command_pin", 1)
+	defer cleanup()
+
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	ctx = c.flags.WithLogger(ctx, c.Stderr())
+
+	results, err := pin.Pin(ctx, &pin.Params{
+		FS:       &common.RealFS{},
+		Location: c.flags.Location,
+		DryRun:   c.flags.DryRun,
+	})
+	verb := "Pinned"
+	if c.flags.DryRun {
+		verb = "Would pin"
+	}
+	printResults(c.Stdout(), results, verb)
+	return err //nolint:wrapcheck
+}
+
+type UnpinCommand struct {
+	cli.BaseCommand
+	flags UnpinFlags
+}
+
+// Desc implements cli.Command.
+func (c *UnpinCommand) Desc() string {
+	return `undo "abc pin", so template installations upgrade from their upgrade channels again`
+}
+
+// Help implements cli.Command.
+func (c *UnpinCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options] [<location>]
+
+The {{ COMMAND }} command undoes "abc pin": it rewrites the manifests of pinned
+template installations to track the upgrade channel that they had before, like
+"main" or "latest", so that "abc upgrade" upgrades them again. For a manifest
+that doesn't record its old upgrade channel, --upgrade-channel is used.
+
+The <location> is a manifest file, or a directory to search recursively for
+manifests. It defaults to the current directory.
+`
+}
+
+// Flags implements cli.Command.
+func (c *UnpinCommand) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+func (c *UnpinCommand) Run(ctx context.Context, args []string) error {
+	mClient := metrics.FromContext(ctx)
+	cleanup := metricswrap.WriteMetric(ctx, mClient, "command_unpin", 1)
+	defer cleanup()
+
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	ctx = c.flags.WithLogger(ctx, c.Stderr())
+
+	results, err := pin.Unpin(ctx, &pin.Params{
+		FS:             &common.RealFS{},
+		Location:       c.flags.Location,
+		UpgradeChannel: c.flags.UpgradeChannel,
+		DryRun:         c.flags.DryRun,
+	})
+	verb := "Unpinned"
+	if c.flags.DryRun {
+		verb = "Would unpin"
+	}
+	printResults(c.Stdout(), results, verb)
+	return err //nolint:wrapcheck
+}
+
+// printResults prints a line for each manifest saying how its upgrade channel
+// changed, or why it didn't.
+func printResults(w io.Writer, results []*pin.Result, verb string) {
+	for _, r := range results {
+		if r.Skipped != "" {
+			fmt.Fprintf(w, "Skipped %s because %s\n", r.ManifestPath, r.Skipped)
+			continue
+		}
+		fmt.Fprintf(w, "%s %s: upgrade channel %q -> %q\n", verb, r.ManifestPath, r.OldUpgradeChannel, r.NewUpgradeChannel)
+	}
+}
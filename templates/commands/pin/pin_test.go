@@ -0,0 +1,144 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pin
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+const testManifest = `# Generated by the "abc" command. Do not modify.
+api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Manifest'
+creation_time: '2024-06-25T11:00:00Z'
+modification_time: '2024-06-25T12:00:00Z'
+template_location: 'github.com/abcxyz/abc/t/rest_server'
+location_type: 'remote_git'
+template_version: 'v1.2.3'
+upgrade_channel: 'latest'
+template_dirhash: 'h1:abc'
+inputs: []
+output_files: []
+`
+
+func TestPinAndUnpinCommands(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	tempDir := t.TempDir()
+	abctestutil.WriteAll(t, tempDir, map[string]string{
+		"svc/.abc/manifest_rest_server.lock.yaml": testManifest,
+	})
+	manifestPath := filepath.Join(tempDir, "svc", ".abc", "manifest_rest_server.lock.yaml")
+
+	steps := []struct {
+		cmd        cli.Command
+		args       []string
+		wantStdout string
+	}{
+		{
+			cmd:        &PinCommand{},
+			args:       []string{"--dry-run", tempDir},
+			wantStdout: `Would pin ` + manifestPath + `: upgrade channel "latest" -> "v1.2.3"` + "\n",
+		},
+		{
+			cmd:        &PinCommand{},
+			args:       []string{tempDir},
+			wantStdout: `Pinned ` + manifestPath + `: upgrade channel "latest" -> "v1.2.3"` + "\n",
+		},
+		{
+			cmd:        &PinCommand{},
+			args:       []string{tempDir},
+			wantStdout: `Skipped ` + manifestPath + ` because it's already pinned` + "\n",
+		},
+		{
+			cmd:        &UnpinCommand{},
+			args:       []string{"--upgrade-channel=main", tempDir},
+			wantStdout: `Unpinned ` + manifestPath + `: upgrade channel "v1.2.3" -> "latest"` + "\n",
+		},
+	}
+
+	for i, step := range steps {
+		var stdout strings.Builder
+		step.cmd.SetStdout(&stdout)
+		if err := step.cmd.Run(ctx, step.args); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if diff := cmp.Diff(stdout.String(), step.wantStdout); diff != "" {
+			t.Errorf("step %d: stdout was not as expected (-got,+want): %s", i, diff)
+		}
+	}
+}
+
+func TestUnpinFlags_Parse(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		args    []string
+		want    UnpinFlags
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			want: UnpinFlags{Flags: Flags{Location: "."}},
+		},
+		{
+			name: "all_flags",
+			args: []string{"--dry-run", "--upgrade-channel=main", "some/dir"},
+			want: UnpinFlags{
+				Flags:          Flags{Location: "some/dir", DryRun: true},
+				UpgradeChannel: "main",
+			},
+		},
+		{
+			name:    "too_many_args",
+			args:    []string{"a", "b"},
+			wantErr: "expected at most one argument",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var cmd UnpinCommand
+			cmd.SetLookupEnv(cli.MapLookuper(nil))
+
+			err := cmd.Flags().Parse(tc.args)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(cmd.flags, tc.want, cmp.FilterPath(func(p cmp.Path) bool {
+				return p.String() == "Flags.LogFlags"
+			}, cmp.Ignore())); diff != "" {
+				t.Errorf("flags were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
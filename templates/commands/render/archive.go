@@ -0,0 +1,210 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+// This file implements the archive output mode, where the rendered template is
+// written as a tar or zip stream rather than into a directory.
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	archiveFormatTar = "tar"
+	archiveFormatTGZ = "tgz"
+	archiveFormatZip = "zip"
+
+	// destStdout is the special value of --dest that means "write an archive
+	// to stdout".
+	destStdout = "-"
+)
+
+var archiveFormats = []string{archiveFormatTar, archiveFormatTGZ, archiveFormatZip}
+
+// reproducibleModTime is the modification time of every archive entry when
+// --reproducible is given. It's the earliest time that a zip file can hold.
+var reproducibleModTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// archiveFormatForPath guesses the archive format from the file extension of
+// an --archive path. Returns empty string if the extension isn't recognized.
+func archiveFormatForPath(path string) string {
+	lower := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(lower, ".tgz"), strings.HasSuffix(lower, ".tar.gz"):
+		return archiveFormatTGZ
+	case strings.HasSuffix(lower, ".tar"):
+		return archiveFormatTar
+	case strings.HasSuffix(lower, ".zip"):
+		return archiveFormatZip
+	default:
+		return ""
+	}
+}
+
+// writeArchive writes the contents of srcDir to w as an archive of the given
+// format. Paths in the archive are relative to srcDir and always use forward
+// slashes. Entries are written in lexical order so that the output is stable.
+//
+// If reproducible is true, the entries' metadata doesn't depend on when or by
+// whom the files were created: every entry has the same modification time, no
+// owner, and a mode of either 0o755 or 0o644 depending on whether the owner
+// can execute it.
+func writeArchive(w io.Writer, srcDir, format string, reproducible bool) error {
+	switch format {
+	case archiveFormatTar:
+		return writeTar(w, srcDir, reproducible)
+	case archiveFormatTGZ:
+		gz := gzip.NewWriter(w)
+		if err := writeTar(gz, srcDir, reproducible); err != nil {
+			return err
+		}
+		if err := gz.Close(); err != nil {
+			return fmt.Errorf("failed closing gzip stream: %w", err)
+		}
+		return nil
+	case archiveFormatZip:
+		return writeZip(w, srcDir, reproducible)
+	default:
+		return fmt.Errorf("unknown archive format %q, must be one of %v", format, archiveFormats)
+	}
+}
+
+func writeTar(w io.Writer, srcDir string, reproducible bool) error {
+	tw := tar.NewWriter(w)
+	if err := walkForArchive(srcDir, func(relPath string, d fs.DirEntry, fi fs.FileInfo) error {
+		hdr, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return fmt.Errorf("tar.FileInfoHeader(%s): %w", relPath, err)
+		}
+		hdr.Name = relPath
+		if d.IsDir() {
+			hdr.Name += "/"
+		}
+		if reproducible {
+			hdr.Mode = int64(reproducibleMode(fi))
+			hdr.ModTime = reproducibleModTime
+			hdr.AccessTime = time.Time{}
+			hdr.ChangeTime = time.Time{}
+			hdr.Uid, hdr.Gid = 0, 0
+			hdr.Uname, hdr.Gname = "", ""
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("failed writing tar header for %q: %w", relPath, err)
+		}
+		if d.IsDir() {
+			return nil
+		}
+		return copyFileTo(tw, filepath.Join(srcDir, relPath))
+	}); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed closing tar stream: %w", err)
+	}
+	return nil
+}
+
+func writeZip(w io.Writer, srcDir string, reproducible bool) error {
+	zw := zip.NewWriter(w)
+	if err := walkForArchive(srcDir, func(relPath string, d fs.DirEntry, fi fs.FileInfo) error {
+		hdr, err := zip.FileInfoHeader(fi)
+		if err != nil {
+			return fmt.Errorf("zip.FileInfoHeader(%s): %w", relPath, err)
+		}
+		hdr.Name = relPath
+		if d.IsDir() {
+			hdr.Name += "/"
+		} else {
+			hdr.Method = zip.Deflate
+		}
+		if reproducible {
+			hdr.Modified = reproducibleModTime
+			hdr.SetMode(reproducibleMode(fi))
+		}
+		entryWriter, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return fmt.Errorf("failed writing zip header for %q: %w", relPath, err)
+		}
+		if d.IsDir() {
+			return nil
+		}
+		return copyFileTo(entryWriter, filepath.Join(srcDir, relPath))
+	}); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed closing zip stream: %w", err)
+	}
+	return nil
+}
+
+// reproducibleMode returns the mode of an archive entry for the given file when
+// --reproducible is given, which only keeps the file type and whether the owner
+// can execute it.
+func reproducibleMode(fi fs.FileInfo) fs.FileMode {
+	if fi.IsDir() {
+		return fs.ModeDir | 0o755
+	}
+	if fi.Mode().Perm()&0o100 != 0 {
+		return 0o755
+	}
+	return 0o644
+}
+
+// walkForArchive calls visit for every file and directory under srcDir, except
+// srcDir itself. The relPath passed to visit uses forward slashes.
+func walkForArchive(srcDir string, visit func(relPath string, d fs.DirEntry, fi fs.FileInfo) error) error {
+	if err := filepath.WalkDir(srcDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == srcDir {
+			return nil
+		}
+		relPath, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return fmt.Errorf("filepath.Rel(%s,%s): %w", srcDir, path, err)
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("Info(%s): %w", path, err)
+		}
+		return visit(filepath.ToSlash(relPath), d, fi)
+	}); err != nil {
+		return fmt.Errorf("failed creating archive from %q: %w", srcDir, err)
+	}
+	return nil
+}
+
+func copyFileTo(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed opening %q: %w", path, err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("failed copying %q into archive: %w", path, err)
+	}
+	return nil
+}
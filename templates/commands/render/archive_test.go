@@ -0,0 +1,301 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestWriteArchive(t *testing.T) {
+	t.Parallel()
+
+	files := map[string]string{
+		"a.txt":         "a contents",
+		"dir/b.txt":     "b contents",
+		"dir/sub/c.txt": "c contents",
+	}
+
+	cases := []struct {
+		format  string
+		wantErr string
+	}{
+		{format: archiveFormatTar},
+		{format: archiveFormatTGZ},
+		{format: archiveFormatZip},
+		{format: "rar", wantErr: `unknown archive format "rar"`},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.format, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			abctestutil.WriteAll(t, dir, files)
+
+			var buf bytes.Buffer
+			err := writeArchive(&buf, dir, tc.format, false)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			got := readArchive(t, buf.Bytes(), tc.format)
+			if diff := cmp.Diff(got, files); diff != "" {
+				t.Errorf("archive contents were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestArchiveFormatForPath(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"out.tgz":      archiveFormatTGZ,
+		"out.tar.gz":   archiveFormatTGZ,
+		"OUT.TAR":      archiveFormatTar,
+		"a/b/out.zip":  archiveFormatZip,
+		"out.txt":      "",
+		"no_extension": "",
+	}
+	for in, want := range cases {
+		if got := archiveFormatForPath(in); got != want {
+			t.Errorf("archiveFormatForPath(%q) got %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRenderArchive(t *testing.T) {
+	t.Parallel()
+
+	specContents := `
+api_version: 'cli.abcxyz.dev/v1beta6'
+kind: 'Template'
+desc: 'A template for the ages'
+steps:
+- desc: 'Include some files'
+  action: 'include'
+  params:
+    paths: ['file1.txt', 'dir1']
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'
+`
+	templateContents := map[string]string{
+		"spec.yaml":            specContents,
+		"file1.txt":            "file1 contents",
+		"dir1/file_in_dir.txt": "file_in_dir contents",
+	}
+	wantContents := map[string]string{
+		"file1.txt":            "file1 contents",
+		"dir1/file_in_dir.txt": "file_in_dir contents",
+	}
+
+	cases := []struct {
+		name        string
+		args        []string
+		archiveFile string // relative to the temp dir
+		wantFormat  string
+		wantStderr  string
+	}{
+		{
+			name:       "dest_stdout_defaults_to_tgz",
+			args:       []string{"--dest=-"},
+			wantFormat: archiveFormatTGZ,
+			wantStderr: "Hello",
+		},
+		{
+			name:       "dest_stdout_zip",
+			args:       []string{"--dest=-", "--archive-format=zip"},
+			wantFormat: archiveFormatZip,
+			wantStderr: "Hello",
+		},
+		{
+			name:        "archive_file_format_from_extension",
+			archiveFile: "out.zip",
+			wantFormat:  archiveFormatZip,
+		},
+		{
+			name:        "archive_file_explicit_format",
+			archiveFile: "out.bin",
+			args:        []string{"--archive-format=tar"},
+			wantFormat:  archiveFormatTar,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			sourceDir := filepath.Join(tempDir, "source")
+			abctestutil.WriteAll(t, sourceDir, templateContents)
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+
+			args := append([]string{"--skip-manifest"}, tc.args...)
+			if tc.archiveFile != "" {
+				args = append(args, "--archive="+filepath.Join(tempDir, tc.archiveFile))
+			}
+			args = append(args, sourceDir)
+
+			r := &Command{}
+			_, stdout, stderr := r.Pipe()
+			if err := r.Run(ctx, args); err != nil {
+				t.Fatal(err)
+			}
+
+			archiveBytes := stdout.Bytes()
+			if tc.archiveFile != "" {
+				var err error
+				archiveBytes, err = os.ReadFile(filepath.Join(tempDir, tc.archiveFile))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got := readArchive(t, archiveBytes, tc.wantFormat)
+			if diff := cmp.Diff(got, wantContents); diff != "" {
+				t.Errorf("archive contents were not as expected (-got,+want): %s", diff)
+			}
+			if !strings.Contains(stderr.String(), tc.wantStderr) {
+				t.Errorf("got stderr %q, want it to contain %q", stderr.String(), tc.wantStderr)
+			}
+		})
+	}
+}
+
+// readArchive returns the regular files in the given archive as a map of path
+// to contents.
+func readArchive(tb testing.TB, b []byte, format string) map[string]string {
+	tb.Helper()
+
+	out := map[string]string{}
+	switch format {
+	case archiveFormatZip:
+		zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+		if err != nil {
+			tb.Fatal(err)
+		}
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				tb.Fatal(err)
+			}
+			contents, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				tb.Fatal(err)
+			}
+			out[f.Name] = string(contents)
+		}
+	case archiveFormatTar, archiveFormatTGZ:
+		var r io.Reader = bytes.NewReader(b)
+		if format == archiveFormatTGZ {
+			gz, err := gzip.NewReader(r)
+			if err != nil {
+				tb.Fatal(err)
+			}
+			r = gz
+		}
+		tr := tar.NewReader(r)
+		for {
+			hdr, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				tb.Fatal(err)
+			}
+			if hdr.Typeflag != tar.TypeReg {
+				continue
+			}
+			contents, err := io.ReadAll(tr)
+			if err != nil {
+				tb.Fatal(err)
+			}
+			out[hdr.Name] = string(contents)
+		}
+	default:
+		tb.Fatalf("unknown format %q", format)
+	}
+	return out
+}
+
+func TestWriteArchive_Reproducible(t *testing.T) {
+	t.Parallel()
+
+	for _, format := range archiveFormats {
+		format := format
+
+		t.Run(format, func(t *testing.T) {
+			t.Parallel()
+
+			// The same files, but with different permissions and times, as if
+			// they were rendered on different machines.
+			var archives [][]byte
+			for i, perm := range []os.FileMode{0o600, 0o664} {
+				dir := t.TempDir()
+				abctestutil.WriteAllMode(t, dir, map[string]abctestutil.ModeAndContents{
+					"a.txt":      {Mode: perm, Contents: "a contents"},
+					"dir/run.sh": {Mode: perm | 0o100, Contents: "#!/bin/sh"},
+				})
+				mtime := time.Unix(int64(1e9*(i+1)), 0)
+				for _, name := range []string{"a.txt", "dir/run.sh", "dir"} {
+					if err := os.Chtimes(filepath.Join(dir, name), mtime, mtime); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				var buf bytes.Buffer
+				if err := writeArchive(&buf, dir, format, true); err != nil {
+					t.Fatal(err)
+				}
+				archives = append(archives, buf.Bytes())
+			}
+
+			if !bytes.Equal(archives[0], archives[1]) {
+				t.Errorf("archives of the same files weren't byte-identical")
+			}
+		})
+	}
+}
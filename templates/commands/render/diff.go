@@ -0,0 +1,105 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/stepdiff"
+)
+
+// ANSI escape codes used to color diffs, the same as "git diff --color".
+const (
+	ansiBold  = "\x1b[1m"
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiCyan  = "\x1b[36m"
+	ansiReset = "\x1b[m"
+)
+
+// writeDiffs writes a unified diff to w for each file in outDir that differs
+// from the file at the same path in destDir, in path order. A file that doesn't
+// exist in destDir is diffed against an empty file. The diffs are computed in
+// process, so no external diff or git binary is needed.
+func writeDiffs(w io.Writer, color bool, outDir, destDir string) error {
+	// WalkDir visits files in lexical order, so the output is deterministic.
+	err := filepath.WalkDir(outDir, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err // some filesystem error happened
+		}
+		if de.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(outDir, path)
+		if err != nil {
+			return fmt.Errorf("filepath.Rel(): %w", err)
+		}
+		newContents, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("ReadFile(): %w", err)
+		}
+		oldContents, err := os.ReadFile(filepath.Join(destDir, rel))
+		if err != nil && !common.IsNotExistErr(err) {
+			return fmt.Errorf("ReadFile(): %w", err)
+		}
+		slashRel := filepath.ToSlash(rel)
+		diff := stepdiff.Unified(slashRel, slashRel, string(oldContents), string(newContents))
+		if color {
+			diff = colorize(diff)
+		}
+		if _, err := io.WriteString(w, diff); err != nil {
+			return fmt.Errorf("failed writing diff: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed diffing rendered output against %q: %w", destDir, err)
+	}
+	return nil
+}
+
+// colorize adds terminal colors to a unified diff.
+func colorize(diff string) string {
+	var out strings.Builder
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		if line == "" {
+			continue
+		}
+		body := strings.TrimSuffix(line, "\n")
+		var code string
+		switch {
+		case strings.HasPrefix(body, "--- "), strings.HasPrefix(body, "+++ "):
+			code = ansiBold
+		case strings.HasPrefix(body, "@@"):
+			code = ansiCyan
+		case strings.HasPrefix(body, "-"):
+			code = ansiRed
+		case strings.HasPrefix(body, "+"):
+			code = ansiGreen
+		}
+		if code == "" {
+			out.WriteString(line)
+			continue
+		}
+		out.WriteString(code + body + ansiReset + line[len(body):])
+	}
+	return out.String()
+}
@@ -0,0 +1,148 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+)
+
+func TestRenderShowDiff(t *testing.T) {
+	t.Parallel()
+
+	specContents := `
+api_version: 'cli.abcxyz.dev/v1beta6'
+kind: 'Template'
+desc: 'A template that adds a file and edits another'
+steps:
+- desc: 'Include some files'
+  action: 'include'
+  params:
+    paths: ['new.txt', 'same.txt']
+- desc: 'Include a file from the destination'
+  action: 'include'
+  params:
+    from: 'destination'
+    paths: ['existing.txt']
+- desc: 'Edit it'
+  action: 'string_replace'
+  params:
+    paths: ['existing.txt']
+    replacements:
+    - to_replace: 'old'
+      with: 'new'
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'
+`
+	destContents := map[string]string{
+		"existing.txt": "line one\nold line\n",
+		"same.txt":     "unchanged\n",
+	}
+
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	destDir := filepath.Join(tempDir, "dest")
+	abctestutil.WriteAll(t, sourceDir, map[string]string{
+		"spec.yaml": specContents,
+		"new.txt":   "brand new\n",
+		"same.txt":  "unchanged\n",
+	})
+	abctestutil.WriteAll(t, destDir, destContents)
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+
+	r := &Command{}
+	_, stdout, stderr := r.Pipe()
+	if err := r.Run(ctx, []string{"--show-diff", "--dest", destDir, sourceDir}); err != nil {
+		t.Fatal(err)
+	}
+
+	wantStdout := `--- a/existing.txt
++++ b/existing.txt
+@@ -1,2 +1,2 @@
+ line one
+-old line
++new line
+--- a/new.txt
++++ b/new.txt
+@@ -0,0 +1 @@
++brand new
+`
+	if diff := cmp.Diff(stdout.String(), wantStdout); diff != "" {
+		t.Errorf("stdout was not as expected (-got,+want): %s", diff)
+	}
+	if !strings.Contains(stderr.String(), "Hello") {
+		t.Errorf("got stderr %q, want it to contain the print message", stderr.String())
+	}
+
+	if diff := cmp.Diff(abctestutil.LoadDir(t, destDir), destContents); diff != "" {
+		t.Errorf("the destination should not have been modified (-got,+want): %s", diff)
+	}
+}
+
+func TestRenderShowDiff_NewDest(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	destDir := filepath.Join(tempDir, "dest")
+	abctestutil.WriteAll(t, sourceDir, map[string]string{
+		"spec.yaml": `
+api_version: 'cli.abcxyz.dev/v1beta6'
+kind: 'Template'
+desc: 'A template that adds a file'
+steps:
+- desc: 'Include a file'
+  action: 'include'
+  params:
+    paths: ['new.txt']
+`,
+		"new.txt": "brand new\n",
+	})
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+
+	r := &Command{}
+	_, stdout, _ := r.Pipe()
+	if err := r.Run(ctx, []string{"--show-diff", "--dest", destDir, sourceDir}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout.String(), "+brand new") {
+		t.Errorf("got stdout %q, want a diff adding new.txt", stdout.String())
+	}
+	if _, err := os.Stat(destDir); !os.IsNotExist(err) {
+		t.Errorf("--show-diff created the destination directory, or a lock in it: Stat() returned %v", err)
+	}
+}
+
+func TestColorize(t *testing.T) {
+	t.Parallel()
+
+	diff := "--- a/f.txt\n+++ b/f.txt\n@@ -1,2 +1,2 @@\n same\n-old\n+new\n"
+	want := "\x1b[1m--- a/f.txt\x1b[m\n\x1b[1m+++ b/f.txt\x1b[m\n\x1b[36m@@ -1,2 +1,2 @@\x1b[m\n same\n\x1b[31m-old\x1b[m\n\x1b[32m+new\x1b[m\n"
+	if diff := cmp.Diff(colorize(diff), want); diff != "" {
+		t.Errorf("colorized diff was not as expected (-got,+want): %s", diff)
+	}
+}
@@ -16,16 +16,25 @@ package render
 
 import (
 	"fmt"
+	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/posener/complete/v2/predict"
 
 	"github.com/abcxyz/abc/templates/common/flags"
+	"github.com/abcxyz/abc/templates/common/githubdest"
+	"github.com/abcxyz/abc/templates/common/render"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1beta7"
 	"github.com/abcxyz/pkg/cli"
 )
 
 // RenderFlags describes what template to render and how.
 type RenderFlags struct {
+	// See common/flags.LogFlags.
+	flags.LogFlags
+
 	// See common/flags.AcceptDefaults().
 	AcceptDefaults bool
 
@@ -44,12 +53,63 @@ type RenderFlags struct {
 	// Flag arguments (--foo):
 
 	// Dest is the local directory where the template output will be written.
-	// It's OK for it to already exist or not.
+	// It's OK for it to already exist or not. The special value "-" means that
+	// the output is written to stdout as an archive; see ArchiveFormat.
 	Dest string
 
+	// AlsoRenderTo is a second directory to render the template into, sharing
+	// the download and inputs of the render into Dest.
+	AlsoRenderTo string
+
+	// AlsoRenderInputs override template inputs only for the render into
+	// AlsoRenderTo.
+	AlsoRenderInputs map[string]string
+
+	// Archive is the path of an archive file to write the template output to,
+	// instead of writing to the Dest directory.
+	Archive string
+
+	// ArchiveFormat is the format of the archive written when Dest is "-" or
+	// Archive is set. One of "tgz", "tar", or "zip".
+	ArchiveFormat string
+
 	// See common/flags.GitProtocol().
 	GitProtocol string
 
+	// See common/flags.SkipGitSubmodules().
+	SkipGitSubmodules bool
+
+	// GitInit creates a git repo at Dest (unless Dest is already inside one) and
+	// commits the rendered output.
+	GitInit bool
+
+	// GitBranch is the branch to switch to (creating it if needed) before
+	// rendering. The rendered output is committed to this branch.
+	GitBranch string
+
+	// GitHubRepo is a GitHub repo, like "my-org/my-repo", to commit the
+	// rendered output to through the GitHub API instead of writing it to a
+	// local directory. Dest is then the directory within the repo.
+	GitHubRepo string
+
+	// GitHubBranch is the branch of GitHubRepo to commit to. It's created if it
+	// doesn't exist. Empty means the repo's default branch.
+	GitHubBranch string
+
+	// GitHubBaseBranch is the branch that GitHubBranch is created from, if it
+	// doesn't exist yet. Empty means the repo's default branch.
+	GitHubBaseBranch string
+
+	// GitHubToken authenticates calls to the GitHub API.
+	GitHubToken string
+
+	// GitHubAPIURL is the base URL of the GitHub REST API.
+	GitHubAPIURL string
+
+	// FileMetadata overrides the template's file_metadata policy. One of
+	// render.FileMetadataPolicies, or empty to use the template's policy.
+	FileMetadata string
+
 	// ForceOverwrite lets existing output files in the Dest directory be
 	// overwritten with the output of the template.
 	ForceOverwrite bool
@@ -67,12 +127,36 @@ type RenderFlags struct {
 	// See common/flags.KeepTempDirs().
 	KeepTempDirs bool
 
+	// See common/flags.Strict().
+	Strict bool
+
+	// See common/flags.MaxOutputFiles().
+	MaxOutputFiles int
+
+	// See common/flags.MaxOutputBytes().
+	MaxOutputBytes int64
+
+	// See common/flags.MaxFileBytes().
+	MaxFileBytes int64
+
 	// Whether to prompt the user for template inputs.
 	Prompt bool
 
+	// See common/flags.BackupKeep().
+	BackupKeep int
+
+	// See common/flags.BackupMaxAge().
+	BackupMaxAge time.Duration
+
+	// See common/flags.Wait().
+	Wait time.Duration
+
 	// See common/flags.DebugStepDiffs().
 	DebugStepDiffs bool
 
+	// See common/flags.DebugReport().
+	DebugReport string
+
 	// See common/flags.DebugScratchContents().
 	DebugScratchContents bool
 
@@ -87,19 +171,94 @@ type RenderFlags struct {
 	// files from the template.
 	BackfillManifestOnly bool
 
+	// If a manifest from the same template already exists in Dest, then
+	// re-render the installed version of the template and rewrite any files
+	// that have drifted from the template's output.
+	Reconcile bool
+
+	// Glob patterns for files that are intentionally overridden, and are
+	// therefore not rewritten by Reconcile.
+	ReconcileKeep []string
+
+	// Reproducible makes the output identical for identical inputs, by zeroing
+	// the manifest fields and archive metadata that would otherwise differ
+	// between renders.
+	Reproducible bool
+
+	// ShowDiff prints a diff between the rendered output and the destination
+	// to stdout, instead of writing the output.
+	ShowDiff bool
+
+	// Profile prints a table to stderr of how long the download, each step,
+	// and the commit took.
+	Profile bool
+
+	// CPUProfile is the path of a file to write a pprof CPU profile of the
+	// render to.
+	CPUProfile string
+
+	// Resumable keeps the progress of the render in the temp directory, so
+	// that it can be picked up with Resume if it's interrupted.
+	Resumable bool
+
+	// Resume picks up an interrupted render into Dest after its last completed
+	// step, reusing the already-downloaded template.
+	Resume bool
+
+	// StartFromStep and StopAfterStep run a range of the template's steps,
+	// for debugging it. StopAfterStep is -1 if not given.
+	StartFromStep int
+	StopAfterStep int
+
 	// Overrides the `upgrade_channel` field in the output manifest. Can be
 	// either a branch name or the special string "latest".
 	UpgradeChannel string
+
+	// See common/flags.IgnoreUpgradeChannelPolicy().
+	IgnoreUpgradeChannelPolicy bool
+
+	// See common/flags.ConflictFileNames().
+	ConflictFileNames string
+
+	// See common/flags.ManifestSigningKey().
+	ManifestSigningKey string
+
+	// See common/flags.PolicyFiles().
+	PolicyFiles []string
+
+	// See common/flags.AllowBufGenerate().
+	AllowBufGenerate bool
+
+	// See common/flags.AuditLog().
+	AuditLog string
+
+	// Report is the path of an HTML file to write a report of the render to.
+	Report string
 }
 
 func (r *RenderFlags) Register(set *cli.FlagSet) {
-	f := set.NewSection("RENDER OPTIONS")
+	f := flags.NewSection(set, "RENDER OPTIONS")
 
 	f.StringMapVar(flags.Inputs(&r.Inputs))
 	f.StringSliceVar(flags.InputFiles(&r.InputFiles))
+	f.StringSliceVar(flags.PolicyFiles(&r.PolicyFiles))
+	f.BoolVar(flags.AllowBufGenerate(&r.AllowBufGenerate))
+	f.StringVar(flags.AuditLog(&r.AuditLog))
+	f.StringVar(&cli.StringVar{
+		Name:    "report",
+		Example: "render-report.html",
+		Target:  &r.Report,
+		Predict: predict.Files("*"),
+		Usage:   "Write a self-contained HTML report of the render to this file: the inputs used, the steps executed with their durations, the files written with their sizes and hashes, and any warnings; it's written even if the render fails.",
+	})
 	f.BoolVar(flags.KeepTempDirs(&r.KeepTempDirs))
+	f.IntVar(flags.MaxOutputFiles(&r.MaxOutputFiles))
+	f.Int64Var(flags.MaxOutputBytes(&r.MaxOutputBytes))
+	f.Int64Var(flags.MaxFileBytes(&r.MaxFileBytes))
 	f.BoolVar(flags.SkipInputValidation(&r.SkipInputValidation))
 	f.StringVar(flags.UpgradeChannel(&r.UpgradeChannel))
+	f.BoolVar(flags.IgnoreUpgradeChannelPolicy(&r.IgnoreUpgradeChannelPolicy))
+	f.StringVar(flags.ConflictFileNames(&r.ConflictFileNames))
 
 	f.StringVar(&cli.StringVar{
 		Name:    "dest",
@@ -108,7 +267,38 @@ func (r *RenderFlags) Register(set *cli.FlagSet) {
 		Target:  &r.Dest,
 		Default: ".",
 		Predict: predict.Dirs("*"),
-		Usage:   "Required. The target directory in which to write the output files.",
+		Usage:   `Required. The target directory in which to write the output files; the special value "-" writes an archive to stdout instead, see --archive-format.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "also-render-to",
+		Example: "preview",
+		Target:  &r.AlsoRenderTo,
+		Predict: predict.Dirs("*"),
+		Usage:   "Also render the template into this second directory, reusing the same download and inputs; use --also-render-input to change inputs for this directory only, e.g. to compare a preview environment side by side with production.",
+	})
+
+	f.StringMapVar(&cli.StringMapVar{
+		Name:    "also-render-input",
+		Example: "environment=preview",
+		Target:  &r.AlsoRenderInputs,
+		Usage:   "A key=val pair that overrides a template input only for the --also-render-to directory; may be repeated.",
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "archive",
+		Example: "/tmp/out.tgz",
+		Target:  &r.Archive,
+		Predict: predict.Files("*"),
+		Usage:   "Write the output files into this archive file instead of a directory; the format is guessed from the file extension unless --archive-format is given.",
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "archive-format",
+		Example: "zip",
+		Target:  &r.ArchiveFormat,
+		Predict: predict.Set(archiveFormats),
+		Usage:   fmt.Sprintf(`The format of the archive written by --archive or --dest=-, one of %v; defaults to the format implied by the --archive file extension, or else %q.`, archiveFormats, archiveFormatTGZ),
 	})
 
 	f.BoolVar(&cli.BoolVar{
@@ -118,6 +308,15 @@ func (r *RenderFlags) Register(set *cli.FlagSet) {
 		Usage:   "If an output file already exists in the destination, overwrite it instead of failing.",
 	})
 
+	f.StringVar(&cli.StringVar{
+		Name:    "file-metadata",
+		Example: render.FileMetadataPreserve,
+		Target:  &r.FileMetadata,
+		Predict: predict.Set(render.FileMetadataPolicies),
+		Usage: fmt.Sprintf(`Which metadata of template files to carry over to output files, overriding the template's file_metadata setting; %q copies the permission bits and gives files a fresh modification time, and %q also copies the setuid, setgid, and sticky bits and keeps the template's modification times, and %q also copies extended attributes where supported. On Windows, only the read-only attribute is copied.`,
+			render.FileMetadataPermissions, render.FileMetadataPreserve, render.FileMetadataXattrs),
+	})
+
 	f.BoolVar(&cli.BoolVar{
 		Name:    "ignore-unknown-inputs",
 		Target:  &r.IgnoreUnknownInputs,
@@ -126,6 +325,9 @@ func (r *RenderFlags) Register(set *cli.FlagSet) {
 	})
 
 	f.BoolVar(flags.Prompt(&r.Prompt))
+	f.IntVar(flags.BackupKeep(&r.BackupKeep))
+	f.DurationVar(flags.BackupMaxAge(&r.BackupMaxAge))
+	f.DurationVar(flags.Wait(&r.Wait))
 	f.BoolVar(flags.AcceptDefaults(&r.AcceptDefaults))
 
 	f.BoolVar(&cli.BoolVar{
@@ -137,6 +339,8 @@ func (r *RenderFlags) Register(set *cli.FlagSet) {
 		Usage: "(experimental) skip writing a manifest file containing metadata that will allow future template upgrades.",
 	})
 
+	f.StringVar(flags.ManifestSigningKey(&r.ManifestSigningKey))
+
 	f.BoolVar(&cli.BoolVar{
 		Name:    "backfill-manifest-only",
 		Target:  &r.BackfillManifestOnly,
@@ -146,6 +350,79 @@ func (r *RenderFlags) Register(set *cli.FlagSet) {
 		Usage: "(experimental) write only a manifest file and no other files; implicitly sets --skip-manifest=false; this is for the case where you have already rendered a template but there's no manifest, and you want to create just the manifest",
 	})
 
+	f.BoolVar(&cli.BoolVar{
+		Name:    "reconcile",
+		Target:  &r.Reconcile,
+		Default: false,
+		Usage:   "If the destination already contains this template, re-render the installed version with the installed inputs, rewrite files that have drifted from the template's output, and report the drift; otherwise do a normal render.",
+	})
+
+	f.StringSliceVar(&cli.StringSliceVar{
+		Name:    "reconcile-keep",
+		Example: "docs/*.md",
+		Target:  &r.ReconcileKeep,
+		Usage:   "A glob pattern, relative to the destination, of files that you've intentionally overridden; --reconcile reports their drift but doesn't rewrite them. May be repeated.",
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "resumable",
+		Target:  &r.Resumable,
+		Default: false,
+		Usage:   "Keep the progress of the render in the temp directory after each step, so that if it's interrupted it can be picked up with --resume. This costs a copy of the template output after every step.",
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "resume",
+		Target:  &r.Resume,
+		Default: false,
+		Usage:   "If an earlier render of the same template into the same destination was interrupted, pick up after its last completed step instead of starting over; the template isn't downloaded again and the inputs of the interrupted render are reused.",
+	})
+
+	f.IntVar(&cli.IntVar{
+		Name:    "start-from-step",
+		Example: "27",
+		Target:  &r.StartFromStep,
+		Default: 0,
+		Usage:   "For debugging a template: skip the steps before this index (counting from 0), restoring the scratch directory and inputs from the checkpoint kept by an earlier render into the same destination with --stop-after-step or --start-from-step. The template is downloaded again, so edits to it take effect.",
+	})
+
+	f.IntVar(&cli.IntVar{
+		Name:    "stop-after-step",
+		Example: "26",
+		Target:  &r.StopAfterStep,
+		Default: -1,
+		Usage:   "For debugging a template: stop after the step with this index (counting from 0) without writing to the destination, keeping a checkpoint after each step for a later --start-from-step.",
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "show-diff",
+		Target:  &r.ShowDiff,
+		Default: false,
+		Usage:   "Don't write anything; instead, print a unified diff for each file showing how the template would change the destination. The diff is colored when stdout is a terminal.",
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "profile",
+		Target:  &r.Profile,
+		Default: false,
+		Usage:   "After rendering, print a table to stderr showing how long the download, each step, and the commit took, slowest first.",
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "cpu-profile",
+		Target:  &r.CPUProfile,
+		Example: "/tmp/render.pprof",
+		Usage:   "Write a pprof CPU profile of the render to this file, for use with \"go tool pprof\".",
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "reproducible",
+		Target:  &r.Reproducible,
+		Default: false,
+		EnvVar:  "ABC_REPRODUCIBLE",
+		Usage:   "Make the output byte-identical for identical inputs, wherever and whenever the render happens: timestamps in the manifest and the _now_ms variable are zero, the manifest doesn't record the backup directory, and archive entries get fixed times, owners, and modes.",
+	})
+
 	f.BoolVar(&cli.BoolVar{
 		Name:    "continue-without-patches",
 		Target:  &r.ContinueWithoutPatches,
@@ -154,13 +431,70 @@ func (r *RenderFlags) Register(set *cli.FlagSet) {
 		Usage:   `only used when --backfill-manifest-only mode is set; since it's impossible to create a completely accurate manifest for a file that was modified-in-place in the past, this flag instructs the render command to proceed anyway and create a manifest missing the "patch reversal" fields; this may cause spurious merge issues in the future during upgrade operations on this manifest`,
 	})
 
-	t := set.NewSection("TEMPLATE AUTHORS")
+	t := flags.NewSection(set, "TEMPLATE AUTHORS")
 	t.BoolVar(flags.DebugScratchContents(&r.DebugScratchContents))
 	t.BoolVar(flags.DebugStepDiffs(&r.DebugStepDiffs))
+	t.StringVar(flags.DebugReport(&r.DebugReport))
+	t.BoolVar(flags.Strict(&r.Strict))
 
-	g := set.NewSection("GIT OPTIONS")
+	g := flags.NewSection(set, "GIT OPTIONS")
 
 	g.StringVar(flags.GitProtocol(&r.GitProtocol))
+	g.BoolVar(flags.SkipGitSubmodules(&r.SkipGitSubmodules))
+
+	g.BoolVar(&cli.BoolVar{
+		Name:    "git-init",
+		Target:  &r.GitInit,
+		Default: false,
+		Usage:   "Create a git repo at the destination directory if it's not already inside one, and commit the rendered output with a message naming the template source and version.",
+	})
+
+	g.StringVar(&cli.StringVar{
+		Name:    "git-branch",
+		Example: "new-service",
+		Target:  &r.GitBranch,
+		Usage:   "Before rendering, switch the destination's git repo to this branch, creating it if it doesn't exist; the rendered output is committed to this branch. The destination must be inside a git repo, or --git-init must be given.",
+	})
+
+	g.StringVar(&cli.StringVar{
+		Name:    "github-repo",
+		Example: "my-org/my-repo",
+		Target:  &r.GitHubRepo,
+		Usage:   "Instead of writing to a local directory, commit the rendered output to this GitHub repo through the GitHub API, as a single commit. --dest is then the directory within the repo.",
+	})
+
+	g.StringVar(&cli.StringVar{
+		Name:    "github-branch",
+		Example: "new-service",
+		Target:  &r.GitHubBranch,
+		Usage:   "The branch of --github-repo to commit to, which is created if it doesn't exist; defaults to the repo's default branch.",
+	})
+
+	g.StringVar(&cli.StringVar{
+		Name:    "github-base-branch",
+		Example: "main",
+		Target:  &r.GitHubBaseBranch,
+		Usage:   "The branch that --github-branch is created from if it doesn't exist yet; defaults to the repo's default branch.",
+	})
+
+	g.StringVar(&cli.StringVar{
+		Name:    "github-token",
+		Example: "ghp_...",
+		EnvVar:  "GITHUB_TOKEN",
+		Target:  &r.GitHubToken,
+		Usage:   "The token used to call the GitHub API for --github-repo; it needs permission to write the repo's contents.",
+	})
+
+	g.StringVar(&cli.StringVar{
+		Name:    "github-api-url",
+		Example: "https://github.example.com/api/v3",
+		Default: githubdest.DefaultAPIURL,
+		EnvVar:  "GITHUB_API_URL",
+		Target:  &r.GitHubAPIURL,
+		Usage:   "The base URL of the GitHub REST API; only needed for GitHub Enterprise Server.",
+	})
+
+	r.LogFlags.Register(set)
 
 	// Default source to the first CLI argument, if given
 	set.AfterParse(func(existingErr error) error {
@@ -169,6 +503,116 @@ func (r *RenderFlags) Register(set *cli.FlagSet) {
 			return fmt.Errorf("missing <source> file")
 		}
 
+		if r.gitCommit() && r.archiveMode() {
+			return fmt.Errorf("--git-init and --git-branch can't be used when writing an archive")
+		}
+		if strings.HasPrefix(r.GitBranch, "-") {
+			return fmt.Errorf("invalid --git-branch %q: branch names beginning with dash aren't supported", r.GitBranch)
+		}
+
+		if r.Reconcile && (r.archiveMode() || r.BackfillManifestOnly) {
+			return fmt.Errorf("--reconcile can't be used with --backfill-manifest-only or when writing an archive")
+		}
+		if len(r.ReconcileKeep) > 0 && !r.Reconcile {
+			return fmt.Errorf("--reconcile-keep requires --reconcile")
+		}
+
+		if r.MaxOutputFiles < 0 || r.MaxOutputBytes < 0 || r.MaxFileBytes < 0 {
+			return fmt.Errorf("--max-output-files, --max-output-bytes, and --max-file-bytes must not be negative")
+		}
+
+		if r.BackupKeep < 0 || r.BackupMaxAge < 0 {
+			return fmt.Errorf("--backup-keep and --backup-max-age must not be negative")
+		}
+
+		if r.Resume && (r.Reconcile || r.archiveMode()) {
+			return fmt.Errorf("--resume can't be used with --reconcile or when writing an archive")
+		}
+		if r.Resumable && (r.Reconcile || r.archiveMode() || r.ShowDiff || r.githubMode()) {
+			return fmt.Errorf("--resumable can't be used with --reconcile, --show-diff, --github-repo, or when writing an archive")
+		}
+
+		if r.StartFromStep < 0 || r.StopAfterStep < -1 {
+			return fmt.Errorf("--start-from-step and --stop-after-step must not be negative")
+		}
+		if r.stepRange() && (r.Resume || r.Reconcile || r.archiveMode() || r.ShowDiff || r.AlsoRenderTo != "" || r.BackfillManifestOnly) {
+			return fmt.Errorf("--start-from-step and --stop-after-step can't be used with --resume, --reconcile, --show-diff, --also-render-to, --backfill-manifest-only, or when writing an archive")
+		}
+
+		if len(r.AlsoRenderInputs) > 0 && r.AlsoRenderTo == "" {
+			return fmt.Errorf("--also-render-input requires --also-render-to")
+		}
+		if r.AlsoRenderTo != "" && (r.archiveMode() || r.gitCommit() || r.Reconcile || r.Resume || r.BackfillManifestOnly) {
+			return fmt.Errorf("--also-render-to can't be used with --reconcile, --resume, --backfill-manifest-only, --git-init, --git-branch, or when writing an archive")
+		}
+
+		if r.ShowDiff && (r.archiveMode() || r.gitCommit() || r.Reconcile || r.Resume || r.BackfillManifestOnly || r.AlsoRenderTo != "") {
+			return fmt.Errorf("--show-diff can't be used with --reconcile, --resume, --backfill-manifest-only, --also-render-to, --git-init, --git-branch, or when writing an archive")
+		}
+
+		if (r.GitHubBranch != "" || r.GitHubBaseBranch != "") && !r.githubMode() {
+			return fmt.Errorf("--github-branch and --github-base-branch require --github-repo")
+		}
+		if r.githubMode() {
+			if r.archiveMode() || r.gitCommit() || r.ShowDiff || r.Reconcile || r.Resume || r.stepRange() || r.AlsoRenderTo != "" {
+				return fmt.Errorf("--github-repo can't be used with --reconcile, --resume, --show-diff, --also-render-to, --start-from-step, --stop-after-step, --git-init, --git-branch, or when writing an archive")
+			}
+			if !filepath.IsLocal(r.Dest) {
+				return fmt.Errorf("with --github-repo, --dest must be a relative path within the repo, but got %q", r.Dest)
+			}
+			if r.GitHubToken == "" {
+				return fmt.Errorf("--github-repo requires a GitHub token; provide one with --github-token or $GITHUB_TOKEN")
+			}
+		}
+
+		if r.FileMetadata != "" && !slices.Contains(render.FileMetadataPolicies, r.FileMetadata) {
+			return fmt.Errorf("invalid --file-metadata %q, must be one of %v", r.FileMetadata, render.FileMetadataPolicies)
+		}
+
+		if r.ConflictFileNames != "" && !slices.Contains(manifest.ConflictFileNamesValues, r.ConflictFileNames) {
+			return fmt.Errorf("invalid --conflict-file-names %q, must be one of %v", r.ConflictFileNames, manifest.ConflictFileNamesValues)
+		}
+
+		if r.Archive != "" && r.Dest == destStdout {
+			return fmt.Errorf("--archive and --dest=%s are mutually exclusive", destStdout)
+		}
+		if r.archiveMode() {
+			if r.BackfillManifestOnly {
+				return fmt.Errorf("--backfill-manifest-only can't be used when writing an archive")
+			}
+			if r.ArchiveFormat == "" {
+				r.ArchiveFormat = archiveFormatForPath(r.Archive)
+			}
+			if r.ArchiveFormat == "" {
+				r.ArchiveFormat = archiveFormatTGZ
+			}
+			if !slices.Contains(archiveFormats, r.ArchiveFormat) {
+				return fmt.Errorf("invalid --archive-format %q, must be one of %v", r.ArchiveFormat, archiveFormats)
+			}
+		}
+
 		return nil
 	})
 }
+
+// archiveMode returns whether the output should be written as an archive rather
+// than into a directory.
+func (r *RenderFlags) archiveMode() bool {
+	return r.Dest == destStdout || r.Archive != ""
+}
+
+// githubMode returns whether the output should be committed to a GitHub repo
+// through the API rather than written to a local directory.
+func (r *RenderFlags) githubMode() bool {
+	return r.GitHubRepo != ""
+}
+
+// gitCommit returns whether the rendered output should be committed to git.
+func (r *RenderFlags) gitCommit() bool {
+	return r.GitInit || r.GitBranch != ""
+}
+
+// stepRange returns whether only some of the template's steps are to be run.
+func (r *RenderFlags) stepRange() bool {
+	return r.StartFromStep > 0 || r.StopAfterStep >= 0
+}
@@ -0,0 +1,110 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+// This file implements the --git-init and --git-branch flags, which commit the
+// rendered output to git.
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/git"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// prepareGit makes sure that the destination directory is in a git workspace
+// that's ready to receive a commit, and switches to the requested branch.
+// The destination is created if it doesn't exist.
+func prepareGit(ctx context.Context, destAbs string, rf *RenderFlags) error {
+	logger := logging.FromContext(ctx).With("logger", "prepareGit")
+
+	if err := os.MkdirAll(destAbs, common.OwnerRWXPerms); err != nil {
+		return fmt.Errorf("failed creating destination directory %q: %w", destAbs, err)
+	}
+
+	_, inWorkspace, err := git.Workspace(ctx, destAbs)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if !inWorkspace {
+		if !rf.GitInit {
+			return fmt.Errorf("the destination %q isn't inside a git repo; use --git-init to create one", rf.Dest)
+		}
+		logger.InfoContext(ctx, "creating git repo", "dir", destAbs)
+		if err := git.Init(ctx, destAbs); err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+
+	// Committing on top of the user's uncommitted changes would sweep them
+	// into the template's commit, so we insist on a clean starting point.
+	clean, err := git.IsClean(ctx, destAbs)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	if !clean {
+		return fmt.Errorf("the git workspace containing %q has uncommitted changes; please commit or stash them before using --git-init or --git-branch", rf.Dest)
+	}
+
+	if rf.GitBranch != "" {
+		logger.InfoContext(ctx, "switching git branch", "branch", rf.GitBranch)
+		if err := git.SwitchBranch(ctx, destAbs, rf.GitBranch); err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+	return nil
+}
+
+// commitToGit commits the rendered output in the destination directory.
+func commitToGit(ctx context.Context, destAbs, source string, dlMeta *templatesource.DownloadMetadata) error {
+	logger := logging.FromContext(ctx).With("logger", "commitToGit")
+
+	committed, err := git.CommitAll(ctx, destAbs, gitCommitMessage(source, dlMeta))
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	if !committed {
+		logger.WarnContext(ctx, "the template didn't change any files, so no git commit was made")
+	}
+	return nil
+}
+
+// gitCommitMessage returns the message for the commit containing the rendered
+// template. It names the template's canonical location and version when they're
+// known.
+func gitCommitMessage(source string, dlMeta *templatesource.DownloadMetadata) string {
+	location := source
+	var version string
+	if dlMeta != nil {
+		if dlMeta.IsCanonical {
+			location = dlMeta.CanonicalSource
+		}
+		version = dlMeta.Version
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Render template %s\n\n", location)
+	fmt.Fprintf(&sb, "Template source: %s\n", location)
+	if version != "" {
+		fmt.Fprintf(&sb, "Template version: %s\n", version)
+	}
+	return sb.String()
+}
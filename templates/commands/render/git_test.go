@@ -0,0 +1,182 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/abcxyz/abc/templates/common/run"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestGitCommitMessage(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		source string
+		dlMeta *templatesource.DownloadMetadata
+		want   string
+	}{
+		{
+			name:   "canonical_with_version",
+			source: "github.com/abcxyz/abc/t/rest_server@latest",
+			dlMeta: &templatesource.DownloadMetadata{
+				IsCanonical:     true,
+				CanonicalSource: "github.com/abcxyz/abc/t/rest_server",
+				Version:         "v0.5.0",
+			},
+			want: `Render template github.com/abcxyz/abc/t/rest_server
+
+Template source: github.com/abcxyz/abc/t/rest_server
+Template version: v0.5.0
+`,
+		},
+		{
+			name:   "non_canonical_without_version",
+			source: "/my/template",
+			dlMeta: &templatesource.DownloadMetadata{},
+			want: `Render template /my/template
+
+Template source: /my/template
+`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := gitCommitMessage(tc.source, tc.dlMeta); got != tc.want {
+				t.Errorf("got message %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// This test can't be parallel because it sets environment variables to give
+// git a committer identity.
+func TestRenderGitCommit(t *testing.T) {
+	t.Setenv("GIT_CONFIG_GLOBAL", "/dev/null")
+	t.Setenv("GIT_AUTHOR_NAME", "Nobody")
+	t.Setenv("GIT_AUTHOR_EMAIL", "nobody@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Nobody")
+	t.Setenv("GIT_COMMITTER_EMAIL", "nobody@example.com")
+
+	specContents := `
+api_version: 'cli.abcxyz.dev/v1beta6'
+kind: 'Template'
+desc: 'A template for the ages'
+steps:
+- desc: 'Include some files'
+  action: 'include'
+  params:
+    paths: ['file1.txt']
+`
+
+	cases := []struct {
+		name        string
+		args        []string
+		destGitRepo bool
+		destFiles   map[string]string
+		wantBranch  string
+		wantErr     string
+	}{
+		{
+			name: "git_init_new_dir",
+			args: []string{"--git-init"},
+		},
+		{
+			name:       "git_init_with_branch",
+			args:       []string{"--git-init", "--git-branch=new-service"},
+			wantBranch: "new-service",
+		},
+		{
+			name:        "git_branch_existing_repo",
+			args:        []string{"--git-branch=new-service"},
+			destGitRepo: true,
+			wantBranch:  "new-service",
+		},
+		{
+			name:    "git_branch_without_repo",
+			args:    []string{"--git-branch=new-service"},
+			wantErr: "isn't inside a git repo; use --git-init",
+		},
+		{
+			name:        "dirty_workspace",
+			args:        []string{"--git-init"},
+			destGitRepo: true,
+			destFiles:   map[string]string{"uncommitted.txt": "hello"},
+			wantErr:     "has uncommitted changes",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+
+			tempDir := t.TempDir()
+			sourceDir := filepath.Join(tempDir, "source")
+			dest := filepath.Join(tempDir, "dest")
+			abctestutil.WriteAll(t, sourceDir, map[string]string{
+				"spec.yaml": specContents,
+				"file1.txt": "file1 contents",
+			})
+			if tc.destGitRepo {
+				abctestutil.WriteAll(t, dest, abctestutil.WithGitRepoAt("", nil))
+			}
+			abctestutil.WriteAll(t, dest, tc.destFiles)
+
+			args := append([]string{"--skip-manifest", "--dest=" + dest}, tc.args...)
+			args = append(args, sourceDir)
+
+			r := &Command{}
+			_, _, _ = r.Pipe()
+			err := r.Run(ctx, args)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			stdout, _, err := run.Simple(ctx, "git", "-C", dest, "log", "--format=%B", "--name-only")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(stdout, "Render template "+sourceDir) || !strings.Contains(stdout, "file1.txt") {
+				t.Errorf("git log didn't show the expected commit, got:\n%s", stdout)
+			}
+
+			if tc.wantBranch != "" {
+				stdout, _, err := run.Simple(ctx, "git", "-C", dest, "branch", "--show-current")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := strings.TrimSpace(stdout); got != tc.wantBranch {
+					t.Errorf("got branch %q, want %q", got, tc.wantBranch)
+				}
+			}
+		})
+	}
+}
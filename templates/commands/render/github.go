@@ -0,0 +1,147 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+// This file implements "render --github-repo", which commits the rendered output
+// to a GitHub repo through the GitHub API instead of writing it to a local
+// checkout.
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/githubdest"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// githubClient returns a client for the GitHub API as configured by the flags.
+func (c *Command) githubClient() *githubdest.Client {
+	return &githubdest.Client{
+		HTTPClient: c.testHTTPClient,
+		APIURL:     c.flags.GitHubAPIURL,
+		Token:      c.flags.GitHubToken,
+	}
+}
+
+// writeSnapshot writes the files of the snapshot that are under dest, a
+// directory within the repo, into outDir. The template is then rendered on top
+// of them just like it would be in a local checkout.
+func writeSnapshot(rfs common.FS, outDir, dest string, snap *githubdest.Snapshot) error {
+	prefix, err := repoDir(dest)
+	if err != nil {
+		return err
+	}
+	for _, f := range snap.Files {
+		rel := strings.TrimPrefix(f.Path, prefix)
+		p := filepath.Join(outDir, filepath.FromSlash(rel))
+		if err := rfs.MkdirAll(filepath.Dir(p), common.OwnerRWXPerms); err != nil {
+			return fmt.Errorf("MkdirAll(%q): %w", filepath.Dir(p), err)
+		}
+		var mode fs.FileMode = 0o644
+		if f.Executable {
+			mode = 0o755
+		}
+		if err := rfs.WriteFile(p, f.Contents, mode); err != nil {
+			return fmt.Errorf("WriteFile(%q): %w", p, err)
+		}
+	}
+	return nil
+}
+
+// outputFiles returns every regular file under outDir, with its path within
+// the repo given that outDir holds the repo directory dest.
+func outputFiles(rfs common.FS, outDir, dest string) ([]*githubdest.File, error) {
+	prefix, err := repoDir(dest)
+	if err != nil {
+		return nil, err
+	}
+	var out []*githubdest.File
+	err = fs.WalkDir(rfs, outDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(outDir, p)
+		if err != nil {
+			return fmt.Errorf("filepath.Rel(%q, %q): %w", outDir, p, err)
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		contents, err := rfs.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("ReadFile(%q): %w", p, err)
+		}
+		out = append(out, &githubdest.File{
+			Path:       prefix + filepath.ToSlash(rel),
+			Contents:   contents,
+			Executable: fi.Mode()&0o111 != 0,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed reading rendered output: %w", err)
+	}
+	return out, nil
+}
+
+// pushToGitHub commits the rendered output in outDir on top of the snapshot
+// that it was rendered from.
+func (c *Command) pushToGitHub(ctx context.Context, rfs common.FS, snap *githubdest.Snapshot, outDir string, dlMeta *templatesource.DownloadMetadata) error {
+	logger := logging.FromContext(ctx).With("logger", "pushToGitHub")
+
+	files, err := outputFiles(rfs, outDir, c.flags.Dest)
+	if err != nil {
+		return err
+	}
+	result, err := c.githubClient().Commit(ctx, snap, gitCommitMessage(c.flags.Source, dlMeta), files)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	if result.SHA == "" {
+		logger.WarnContext(ctx, "the template didn't change any files, so no commit was pushed")
+		return nil
+	}
+	if !c.flags.Quiet {
+		fmt.Fprintf(c.Stdout(), "Pushed commit %s to branch %q of %s\n", result.SHA, snap.Branch, snap.Repo)
+		if result.URL != "" {
+			fmt.Fprintln(c.Stdout(), result.URL)
+		}
+	}
+	return nil
+}
+
+// repoDir returns the prefix of the paths within the repo that are under dest,
+// which is "" for the root of the repo and otherwise ends with a slash. It's an
+// error for dest to be absolute or to leave the root of the repo.
+func repoDir(dest string) (string, error) {
+	d := path.Clean(filepath.ToSlash(dest))
+	if path.IsAbs(d) || filepath.IsAbs(dest) || d == ".." || strings.HasPrefix(d, "../") {
+		return "", fmt.Errorf("--dest %q must be a relative path within the repo", dest)
+	}
+	if d == "." {
+		return "", nil
+	}
+	return d + "/", nil
+}
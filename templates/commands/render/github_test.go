@@ -0,0 +1,222 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestRenderGitHub(t *testing.T) {
+	t.Parallel()
+
+	specContents := `
+api_version: 'cli.abcxyz.dev/v1beta6'
+kind: 'Template'
+desc: 'A template for the ages'
+steps:
+- desc: 'Include some files'
+  action: 'include'
+  params:
+    paths: ['file1.txt', 'run.sh']
+- desc: 'Include a file from the repo'
+  action: 'include'
+  params:
+    from: 'destination'
+    paths: ['existing.txt']
+- desc: 'Append to a file from the repo'
+  action: 'append'
+  params:
+    paths: ['existing.txt']
+    with: 'appended'
+`
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	abctestutil.WriteAll(t, sourceDir, map[string]string{
+		"spec.yaml": specContents,
+		"file1.txt": "file1 contents",
+	})
+	abctestutil.WriteAllMode(t, sourceDir, map[string]abctestutil.ModeAndContents{
+		"run.sh": {Mode: 0o755, Contents: "#!/bin/sh"},
+	})
+
+	// A fake GitHub API with one commit on the default branch, containing
+	// sub/existing.txt and an identical copy of sub/file1.txt, which therefore
+	// isn't pushed again.
+	var mu sync.Mutex
+	pushed := map[string]string{}
+	var newRef string
+	blobs := map[string]string{"b1": "existing\n", "b2": "file1 contents"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/my-org/my-repo/git/ref/heads/main", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(t, w, map[string]any{"object": map[string]string{"sha": "c1"}})
+	})
+	mux.HandleFunc("GET /repos/my-org/my-repo/git/ref/heads/abc/render", http.NotFound)
+	mux.HandleFunc("GET /repos/my-org/my-repo/git/commits/c1", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(t, w, map[string]any{"tree": map[string]string{"sha": "t1"}})
+	})
+	mux.HandleFunc("GET /repos/my-org/my-repo/git/trees/t1", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(t, w, map[string]any{"tree": []map[string]string{
+			{"path": "README.md", "mode": "100644", "type": "blob", "sha": "b0"},
+			{"path": "sub/existing.txt", "mode": "100644", "type": "blob", "sha": "b1"},
+			{"path": "sub/file1.txt", "mode": "100644", "type": "blob", "sha": "b2"},
+		}})
+	})
+	mux.HandleFunc("GET /repos/my-org/my-repo/git/blobs/{sha}", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(blobs[r.PathValue("sha")]))
+	})
+	mux.HandleFunc("POST /repos/my-org/my-repo/git/blobs", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Content string `json:"content"`
+		}
+		readTestJSON(t, r, &req)
+		contents, err := base64.StdEncoding.DecodeString(req.Content)
+		if err != nil {
+			t.Error(err)
+		}
+		writeTestJSON(t, w, map[string]string{"sha": string(contents)})
+	})
+	mux.HandleFunc("POST /repos/my-org/my-repo/git/trees", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			BaseTree string `json:"base_tree"`
+			Tree     []struct {
+				Path string `json:"path"`
+				Mode string `json:"mode"`
+				SHA  string `json:"sha"`
+			} `json:"tree"`
+		}
+		readTestJSON(t, r, &req)
+		if req.BaseTree != "t1" {
+			t.Errorf("got base tree %q, want t1", req.BaseTree)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, e := range req.Tree {
+			pushed[e.Path] = e.Mode + " " + e.SHA // the fake blob SHA is the contents
+		}
+		writeTestJSON(t, w, map[string]string{"sha": "t2"})
+	})
+	mux.HandleFunc("POST /repos/my-org/my-repo/git/commits", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Message string   `json:"message"`
+			Parents []string `json:"parents"`
+		}
+		readTestJSON(t, r, &req)
+		if !strings.HasPrefix(req.Message, "Render template ") || len(req.Parents) != 1 || req.Parents[0] != "c1" {
+			t.Errorf("unexpected commit request %+v", req)
+		}
+		writeTestJSON(t, w, map[string]string{"sha": "c2", "html_url": "https://github.com/my-org/my-repo/commit/c2"})
+	})
+	mux.HandleFunc("POST /repos/my-org/my-repo/git/refs", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Ref string `json:"ref"`
+			SHA string `json:"sha"`
+		}
+		readTestJSON(t, r, &req)
+		mu.Lock()
+		defer mu.Unlock()
+		newRef = req.Ref + "=" + req.SHA
+		writeTestJSON(t, w, map[string]string{})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	r := &Command{testHTTPClient: server.Client()}
+	_, stdout, _ := r.Pipe()
+	args := []string{
+		"--skip-manifest",
+		"--dest=sub",
+		"--force-overwrite",
+		"--github-repo=my-org/my-repo",
+		"--github-branch=abc/render",
+		"--github-base-branch=main",
+		"--github-token=fake-token",
+		"--github-api-url=" + server.URL,
+		sourceDir,
+	}
+	if err := r.Run(ctx, args); err != nil {
+		t.Fatal(err)
+	}
+
+	wantPushed := map[string]string{
+		"sub/existing.txt": "100644 existing\nappended\n",
+		"sub/run.sh":       "100755 #!/bin/sh",
+	}
+	if diff := cmp.Diff(pushed, wantPushed); diff != "" {
+		t.Errorf("pushed files were not as expected (-got,+want): %s", diff)
+	}
+	if got, want := newRef, "refs/heads/abc/render=c2"; got != want {
+		t.Errorf("got new ref %q, want %q", got, want)
+	}
+	if got, want := stdout.String(), `Pushed commit c2 to branch "abc/render" of my-org/my-repo`; !strings.Contains(got, want) {
+		t.Errorf("got stdout %q, want it to contain %q", got, want)
+	}
+}
+
+func readTestJSON(tb testing.TB, r *http.Request, out any) {
+	tb.Helper()
+	if err := json.NewDecoder(r.Body).Decode(out); err != nil {
+		tb.Errorf("failed decoding request to %s: %v", r.URL.Path, err)
+	}
+}
+
+func writeTestJSON(tb testing.TB, w http.ResponseWriter, v any) {
+	tb.Helper()
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		tb.Errorf("failed encoding response: %v", err)
+	}
+}
+
+func TestRepoDir(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		dest    string
+		want    string
+		wantErr string
+	}{
+		{dest: ".", want: ""},
+		{dest: "", want: ""},
+		{dest: "svc/api", want: "svc/api/"},
+		{dest: "svc/../api/", want: "api/"},
+		{dest: "..", wantErr: "must be a relative path within the repo"},
+		{dest: "svc/../../x", wantErr: "must be a relative path within the repo"},
+		{dest: "/etc", wantErr: "must be a relative path within the repo"},
+	}
+
+	for _, tc := range cases {
+		got, err := repoDir(tc.dest)
+		if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+			t.Errorf("repoDir(%q): %s", tc.dest, diff)
+		}
+		if got != tc.want {
+			t.Errorf("repoDir(%q) got %q, want %q", tc.dest, got, tc.want)
+		}
+	}
+}
@@ -19,21 +19,37 @@ package render
 
 import (
 	"context"
+	"crypto"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
+	"net/http"
 	"os"
 	"path/filepath"
-	"time"
+	"runtime/pprof"
+	"sort"
 
 	"github.com/benbjohnson/clock"
+	"github.com/mattn/go-isatty"
 	"github.com/posener/complete/v2"
-	"github.com/posener/complete/v2/predict"
+	"golang.org/x/exp/maps"
 
 	"github.com/abcxyz/abc-updater/pkg/metrics"
 	"github.com/abcxyz/abc/internal/metricswrap"
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/auditlog"
+	"github.com/abcxyz/abc/templates/common/backups"
+	"github.com/abcxyz/abc/templates/common/completion"
+	"github.com/abcxyz/abc/templates/common/config"
+	"github.com/abcxyz/abc/templates/common/githubdest"
+	"github.com/abcxyz/abc/templates/common/registry"
 	"github.com/abcxyz/abc/templates/common/render"
+	"github.com/abcxyz/abc/templates/common/signing"
+	"github.com/abcxyz/abc/templates/common/tempdir"
 	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/abc/templates/common/upgrade"
+	"github.com/abcxyz/abc/templates/common/warnings"
 	"github.com/abcxyz/pkg/cli"
 )
 
@@ -42,6 +58,8 @@ type Command struct {
 	flags RenderFlags
 	// used in prompt UT.
 	skipPromptTTYCheck bool
+	// testHTTPClient is used for GitHub API calls in tests.
+	testHTTPClient *http.Client
 }
 
 // Desc implements cli.Command.
@@ -64,6 +82,8 @@ few forms:
     - github.com/abcxyz/abc/t/rest_server@latest
     - github.com/abcxyz/abc/t/rest_server@v0.3.1
   - A local directory, like /home/me/mydir
+  - An alias from the registry file (~/.abc/registry.yaml, or the file named
+    by $ABC_REGISTRY_FILE), like "rest_server"
   - (Deprecated) A go-getter-style location, with or without ?ref=foo. Examples:
     - github.com/abcxyz/abc.git//t/react_template?ref=latest
 	- github.com/abcxyz/abc.git//t/react_template
@@ -78,10 +98,10 @@ func (c *Command) Flags() *cli.FlagSet {
 }
 
 func (c *Command) PredictArgs() complete.Predictor {
-	return predict.Dirs("")
+	return completion.Sources()
 }
 
-func (c *Command) Run(ctx context.Context, args []string) error {
+func (c *Command) Run(ctx context.Context, args []string) (rErr error) {
 	mClient := metrics.FromContext(ctx)
 	cleanup := metricswrap.WriteMetric(ctx, mClient, "command_render", 1)
 	defer cleanup()
@@ -89,28 +109,131 @@ func (c *Command) Run(ctx context.Context, args []string) error {
 	if err := c.Flags().Parse(args); err != nil {
 		return fmt.Errorf("failed to parse flags: %w", err)
 	}
+	ctx = c.flags.WithLogger(ctx, c.Stderr())
+	warns := &warnings.Collector{}
+	ctx = warnings.WithCollector(ctx, warns)
+	defer func() { rErr = errors.Join(rErr, warns.Report(c.Stderr(), c.flags.Strict)) }()
+
+	if c.flags.CPUProfile != "" {
+		stop, err := startCPUProfile(c.flags.CPUProfile)
+		if err != nil {
+			return err
+		}
+		defer func() { rErr = errors.Join(rErr, stop()) }()
+	}
 
 	fs := &common.RealFS{}
-	if err := destOK(fs, c.flags.Dest); err != nil {
+
+	var ghSnapshot *githubdest.Snapshot
+	outDir := c.flags.Dest
+	stdout := c.Stdout()
+	if c.flags.archiveMode() {
+		// In archive mode, we render into a temp directory and then archive
+		// its contents.
+		tempTracker := tempdir.NewDirTracker(fs, c.flags.KeepTempDirs)
+		defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
+		var err error
+		outDir, err = tempTracker.MkdirTempTracked("", tempdir.ArchiveDirNamePart)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		if c.flags.Dest == destStdout {
+			// Stdout is reserved for the archive, so the output of print
+			// actions goes to stderr.
+			stdout = c.Stderr()
+		}
+	} else if c.flags.githubMode() {
+		// The existing files are fetched from GitHub into a temp directory,
+		// the template is rendered there, and the result is pushed back.
+		tempTracker := tempdir.NewDirTracker(fs, c.flags.KeepTempDirs)
+		defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
+		var err error
+		outDir, err = tempTracker.MkdirTempTracked("", tempdir.GitHubDirNamePart)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		ghSnapshot, err = c.githubClient().Snapshot(ctx, c.flags.GitHubRepo, c.flags.GitHubBranch, c.flags.GitHubBaseBranch, filepath.ToSlash(c.flags.Dest))
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		if err := writeSnapshot(fs, outDir, c.flags.Dest, ghSnapshot); err != nil {
+			return err
+		}
+	} else if err := destOK(fs, c.flags.Dest); err != nil {
 		return err
 	}
+	if c.flags.ShowDiff {
+		// The output is rendered into a temp directory and diffed against the
+		// destination, which is never written.
+		tempTracker := tempdir.NewDirTracker(fs, c.flags.KeepTempDirs)
+		defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
+		var err error
+		outDir, err = tempTracker.MkdirTempTracked("", tempdir.ShowDiffDirNamePart)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		// Stdout is reserved for the diff.
+		stdout = c.Stderr()
+	}
+	if c.flags.AlsoRenderTo != "" {
+		if err := destOK(fs, c.flags.AlsoRenderTo); err != nil {
+			return err
+		}
+	}
 
 	wd, err := c.WorkingDir()
 	if err != nil {
 		return fmt.Errorf("failed to get working directory: %w", err)
 	}
 
-	homeDir, err := os.UserHomeDir()
+	backupRoot, err := backups.DefaultRoot()
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	clk := clock.New()
+	backupDir := backups.ParentDir(backupRoot, clk.Now())
+
+	source, err := registry.ResolveSource(wd, c.flags.Source)
 	if err != nil {
-		return fmt.Errorf("failed to get home dir: %w", err)
+		return err //nolint:wrapcheck
+	}
+
+	destAbs := c.flags.Dest
+	if c.flags.githubMode() {
+		destAbs = outDir
+	} else if !filepath.IsAbs(destAbs) {
+		destAbs = filepath.Join(wd, destAbs)
+	}
+	if c.flags.gitCommit() {
+		if err := prepareGit(ctx, destAbs, &c.flags); err != nil {
+			return err
+		}
+	}
+
+	createManifest := (c.flags.BackfillManifestOnly || !c.flags.SkipManifest) && !c.flags.ShowDiff
+
+	var signer crypto.Signer
+	if c.flags.ManifestSigningKey != "" {
+		if signer, err = signing.LoadSigner(fs, c.flags.ManifestSigningKey); err != nil {
+			return err //nolint:wrapcheck
+		}
 	}
-	backupDir := filepath.Join(
-		homeDir,
-		".abc",
-		"backups",
-		fmt.Sprint(time.Now().UTC().Unix()))
 
-	createManifest := c.flags.BackfillManifestOnly || !c.flags.SkipManifest
+	var channelPolicy *config.UpgradeChannelPolicy
+	if !c.flags.IgnoreUpgradeChannelPolicy {
+		cfg, err := config.LoadForDir(destAbs)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		channelPolicy = cfg.UpgradeChannelPolicy
+	}
+
+	var auditLog auditlog.Sink
+	if c.flags.AuditLog != "" {
+		if auditLog, err = auditlog.Open(c.flags.AuditLog); err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
 
 	// We require an upgrade channel IFF we're creating a manifest; the only
 	// point of having an upgrade channel is to save it in the manifest for
@@ -118,8 +241,9 @@ func (c *Command) Run(ctx context.Context, args []string) error {
 	requireUpgradeChannel := createManifest
 	downloader, err := templatesource.ParseSource(ctx, &templatesource.ParseSourceParams{
 		CWD:                   wd,
-		Source:                c.flags.Source,
+		Source:                source,
 		FlagGitProtocol:       c.flags.GitProtocol,
+		SkipGitSubmodules:     c.flags.SkipGitSubmodules,
 		FlagUpgradeChannel:    c.flags.UpgradeChannel,
 		RequireUpgradeChannel: requireUpgradeChannel,
 	})
@@ -127,18 +251,26 @@ func (c *Command) Run(ctx context.Context, args []string) error {
 		return err //nolint:wrapcheck
 	}
 
-	_, err = render.Render(ctx, &render.Params{
+	rp := &render.Params{
 		AcceptDefaults:         c.flags.AcceptDefaults,
+		AllowBufGenerate:       c.flags.AllowBufGenerate,
+		AlsoRenderInputs:       c.flags.AlsoRenderInputs,
+		AlsoRenderTo:           c.flags.AlsoRenderTo,
+		AuditLog:               auditLog,
 		ContinueWithoutPatches: c.flags.ContinueWithoutPatches,
 		BackfillManifestOnly:   c.flags.BackfillManifestOnly,
 		BackupDir:              backupDir,
-		Backups:                true,
-		Clock:                  clock.New(),
+		Backups:                !c.flags.archiveMode() && !c.flags.ShowDiff && !c.flags.githubMode(),
+		Clock:                  clk,
+		ConflictFileNames:      c.flags.ConflictFileNames,
 		Cwd:                    wd,
 		DebugScratchContents:   c.flags.DebugScratchContents,
+		DebugReportDir:         c.flags.DebugReport,
 		DebugStepDiffs:         c.flags.DebugStepDiffs,
-		OutDir:                 c.flags.Dest,
+		OutDir:                 outDir,
+		PolicyFiles:            c.flags.PolicyFiles,
 		Downloader:             downloader,
+		FileMetadata:           c.flags.FileMetadata,
 		ForceOverwrite:         c.flags.ForceOverwrite,
 		FS:                     fs,
 		GitProtocol:            c.flags.GitProtocol,
@@ -146,17 +278,178 @@ func (c *Command) Run(ctx context.Context, args []string) error {
 		InputsFromFlags:        c.flags.Inputs,
 		InputFiles:             c.flags.InputFiles,
 		KeepTempDirs:           c.flags.KeepTempDirs,
+		LockWait:               c.flags.Wait,
+		ManifestSigner:         signer,
+		MaxFileBytes:           c.flags.MaxFileBytes,
+		MaxOutputBytes:         c.flags.MaxOutputBytes,
+		MaxOutputFiles:         c.flags.MaxOutputFiles,
 		Prompt:                 c.flags.Prompt,
 		Prompter:               c,
+		Resumable:              c.flags.Resumable,
+		ReportPath:             c.flags.Report,
+		Reproducible:           c.flags.Reproducible,
+		Resume:                 c.flags.Resume,
+		StartFromStep:          c.flags.StartFromStep,
 		SkipInputValidation:    c.flags.SkipInputValidation,
 		SkipManifest:           !createManifest,
 		SkipPromptTTYCheck:     c.skipPromptTTYCheck,
 		SourceForMessages:      c.flags.Source,
-		Stdout:                 c.Stdout(),
+		Stdout:                 stdout,
+		SuppressPrint:          c.flags.Quiet,
 		UpgradeChannel:         c.flags.UpgradeChannel,
-	})
+		UpgradeChannelPolicy:   channelPolicy,
+	}
+
+	if c.flags.StopAfterStep >= 0 {
+		rp.StopAfterStep = &c.flags.StopAfterStep
+	}
+
+	if c.flags.Profile {
+		rp.Timings = &render.Timings{}
+		defer func() {
+			fmt.Fprintln(c.Stderr(), "Render timings:")
+			rErr = errors.Join(rErr, rp.Timings.WriteTable(c.Stderr()))
+		}()
+	}
+
+	if c.flags.ShowDiff {
+		// Files included from the destination must come from the real
+		// destination, not the temp output directory.
+		rp.DestDir = destAbs
+	}
+
+	var dlMeta *templatesource.DownloadMetadata
+	var outputs map[string]string
+	if c.flags.Reconcile {
+		result, err := upgrade.Reconcile(ctx, &upgrade.ReconcileParams{
+			Keep:         c.flags.ReconcileKeep,
+			RenderParams: rp,
+		})
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		if !c.flags.Quiet {
+			printDriftReport(c.Stdout(), result)
+		}
+		dlMeta = result.DownloadMetadata
+	} else {
+		result, err := render.Render(ctx, rp)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		if result.StoppedAfterStep {
+			fmt.Fprintf(c.Stdout(), "Stopped after step index %d without writing to %s. The scratch directory is at %s.\n",
+				c.flags.StopAfterStep, c.flags.Dest, result.ScratchDir)
+			fmt.Fprintf(c.Stdout(), "To continue, re-run with --start-from-step=%d.\n", c.flags.StopAfterStep+1)
+			return nil
+		}
+		dlMeta = result.DownloadMetadata
+		outputs = result.Outputs
+	}
+
+	if c.flags.archiveMode() {
+		return c.writeArchiveOutput(outDir)
+	}
+	if c.flags.ShowDiff {
+		useColor := c.Stdout() == os.Stdout && isatty.IsTerminal(os.Stdout.Fd())
+		return writeDiffs(c.Stdout(), useColor, outDir, destAbs)
+	}
+	if c.flags.BackupKeep > 0 || c.flags.BackupMaxAge > 0 {
+		if _, err := backups.Prune(ctx, &backups.PruneParams{
+			FS:     fs,
+			Root:   backupRoot,
+			Keep:   c.flags.BackupKeep,
+			MaxAge: c.flags.BackupMaxAge,
+			Now:    clk.Now(),
+		}); err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+	if !c.flags.Quiet {
+		printOutputs(c.Stdout(), outputs)
+	}
+	if c.flags.githubMode() {
+		return c.pushToGitHub(ctx, fs, ghSnapshot, outDir, dlMeta)
+	}
+	if c.flags.gitCommit() {
+		return commitToGit(ctx, destAbs, c.flags.Source, dlMeta)
+	}
+	return nil
+}
+
+// startCPUProfile starts writing a pprof CPU profile to the given file. The
+// returned func stops profiling and closes the file.
+func startCPUProfile(path string) (func() error, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating CPU profile file: %w", err)
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed starting CPU profile: %w", err)
+	}
+	return func() error {
+		pprof.StopCPUProfile()
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("failed closing CPU profile file: %w", err)
+		}
+		return nil
+	}, nil
+}
+
+// printOutputs tells the user the values of the outputs declared by the
+// template, if any.
+func printOutputs(w io.Writer, outputs map[string]string) {
+	if len(outputs) == 0 {
+		return
+	}
+	names := maps.Keys(outputs)
+	sort.Strings(names)
+	fmt.Fprintln(w, "Template outputs:")
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s: %s\n", name, outputs[name])
+	}
+}
+
+// printDriftReport tells the user which files were found to differ from the
+// template output during --reconcile, and what was done about them.
+func printDriftReport(w io.Writer, r *upgrade.ReconcileResult) {
+	if r.ManifestPath == "" {
+		return // there was no previous installation, so this was a normal render
+	}
+	if len(r.Drift) == 0 {
+		fmt.Fprintf(w, "No drift found, all files match the template installed by %s\n", r.ManifestPath)
+		return
+	}
+	fmt.Fprintf(w, "Drift from the template installed by %s:\n", r.ManifestPath)
+	for _, d := range r.Drift {
+		action := "rewritten"
+		if !d.Rewritten {
+			action = "kept, matches --reconcile-keep"
+		}
+		fmt.Fprintf(w, "  %s (%s): %s\n", d.Path, d.Kind, action)
+	}
+}
 
-	return err //nolint:wrapcheck
+// writeArchiveOutput archives the rendered template in outDir to either the
+// --archive file or stdout.
+func (c *Command) writeArchiveOutput(outDir string) error {
+	if c.flags.Archive == "" {
+		return writeArchive(c.Stdout(), outDir, c.flags.ArchiveFormat, c.flags.Reproducible)
+	}
+
+	f, err := os.Create(c.flags.Archive)
+	if err != nil {
+		return fmt.Errorf("failed creating archive file: %w", err)
+	}
+	if err := writeArchive(f, outDir, c.flags.ArchiveFormat, c.flags.Reproducible); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed closing archive file %q: %w", c.flags.Archive, err)
+	}
+	return nil
 }
 
 // destOK makes sure that the output directory looks sane.
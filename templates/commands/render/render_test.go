@@ -20,6 +20,7 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"testing/fstest"
 
@@ -27,9 +28,10 @@ import (
 	"github.com/google/go-cmp/cmp/cmpopts"
 
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/flags"
 	"github.com/abcxyz/abc/templates/model"
 	"github.com/abcxyz/abc/templates/model/decode"
-	manifest "github.com/abcxyz/abc/templates/model/manifest/v1alpha1"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1beta7"
 	abctestutil "github.com/abcxyz/abc/templates/testutil"
 	mdl "github.com/abcxyz/abc/templates/testutil/model"
 	"github.com/abcxyz/abc/templates/testutil/prompt"
@@ -60,6 +62,11 @@ func TestRenderFlags_Parse(t *testing.T) {
 				"--input-file", "abc-inputs.yaml",
 				"--input", "x=y",
 				"--keep-temp-dirs",
+				"--log-format", "json",
+				"--max-output-files", "10",
+				"--max-output-bytes", "2000",
+				"--max-file-bytes", "1000",
+				"--quiet",
 				"--backfill-manifest-only",
 				"--skip-manifest",
 				"--skip-input-validation",
@@ -67,6 +74,11 @@ func TestRenderFlags_Parse(t *testing.T) {
 				"helloworld@v1",
 			},
 			want: RenderFlags{
+				LogFlags: flags.LogFlags{
+					LogFormat: "json",
+					LogLevel:  "warning",
+					Quiet:     true,
+				},
 				AcceptDefaults:       true,
 				BackfillManifestOnly: true,
 				DebugScratchContents: true,
@@ -74,10 +86,16 @@ func TestRenderFlags_Parse(t *testing.T) {
 				Dest:                 "my_dir",
 				ForceOverwrite:       true,
 				GitProtocol:          "https",
+				GitHubAPIURL:         "https://api.github.com",
 				IgnoreUnknownInputs:  true,
 				InputFiles:           []string{"abc-inputs.yaml"},
+				AlsoRenderInputs:     map[string]string{},
 				Inputs:               map[string]string{"x": "y"},
 				KeepTempDirs:         true,
+				MaxOutputFiles:       10,
+				MaxOutputBytes:       2000,
+				MaxFileBytes:         1000,
+				StopAfterStep:        -1,
 				SkipManifest:         true,
 				SkipInputValidation:  true,
 				Source:               "helloworld@v1",
@@ -90,14 +108,178 @@ func TestRenderFlags_Parse(t *testing.T) {
 				"helloworld@v1",
 			},
 			want: RenderFlags{
-				Source:         "helloworld@v1",
-				Dest:           ".",
-				GitProtocol:    "https",
-				Inputs:         map[string]string{},
-				ForceOverwrite: false,
-				KeepTempDirs:   false,
+				LogFlags: flags.LogFlags{
+					LogFormat: "text",
+					LogLevel:  "warning",
+				},
+				Source:           "helloworld@v1",
+				Dest:             ".",
+				GitProtocol:      "https",
+				GitHubAPIURL:     "https://api.github.com",
+				AlsoRenderInputs: map[string]string{},
+				MaxOutputFiles:   100_000,
+				MaxOutputBytes:   10 << 30,
+				MaxFileBytes:     1 << 30,
+				StopAfterStep:    -1,
+				Inputs:           map[string]string{},
+				ForceOverwrite:   false,
+				KeepTempDirs:     false,
+			},
+		},
+		{
+			name: "dest_stdout_defaults_to_tgz",
+			args: []string{"--dest=-", "helloworld@v1"},
+			want: RenderFlags{
+				LogFlags: flags.LogFlags{
+					LogFormat: "text",
+					LogLevel:  "warning",
+				},
+				ArchiveFormat:    "tgz",
+				Source:           "helloworld@v1",
+				Dest:             "-",
+				GitProtocol:      "https",
+				GitHubAPIURL:     "https://api.github.com",
+				AlsoRenderInputs: map[string]string{},
+				MaxOutputFiles:   100_000,
+				MaxOutputBytes:   10 << 30,
+				MaxFileBytes:     1 << 30,
+				StopAfterStep:    -1,
+				Inputs:           map[string]string{},
+			},
+		},
+		{
+			name: "archive_format_from_extension",
+			args: []string{"--archive=out.zip", "helloworld@v1"},
+			want: RenderFlags{
+				LogFlags: flags.LogFlags{
+					LogFormat: "text",
+					LogLevel:  "warning",
+				},
+				Archive:          "out.zip",
+				ArchiveFormat:    "zip",
+				Source:           "helloworld@v1",
+				Dest:             ".",
+				GitProtocol:      "https",
+				GitHubAPIURL:     "https://api.github.com",
+				AlsoRenderInputs: map[string]string{},
+				MaxOutputFiles:   100_000,
+				MaxOutputBytes:   10 << 30,
+				MaxFileBytes:     1 << 30,
+				StopAfterStep:    -1,
+				Inputs:           map[string]string{},
+			},
+		},
+		{
+			name:    "archive_and_dest_stdout_exclusive",
+			args:    []string{"--archive=out.zip", "--dest=-", "helloworld@v1"},
+			wantErr: "--archive and --dest=- are mutually exclusive",
+		},
+		{
+			name:    "invalid_archive_format",
+			args:    []string{"--dest=-", "--archive-format=rar", "helloworld@v1"},
+			wantErr: `invalid --archive-format "rar"`,
+		},
+		{
+			name:    "archive_with_backfill",
+			args:    []string{"--dest=-", "--backfill-manifest-only", "helloworld@v1"},
+			wantErr: "--backfill-manifest-only can't be used when writing an archive",
+		},
+		{
+			name:    "reconcile_keep_without_reconcile",
+			args:    []string{"--reconcile-keep=*.md", "helloworld@v1"},
+			wantErr: "--reconcile-keep requires --reconcile",
+		},
+		{
+			name:    "reconcile_with_archive",
+			args:    []string{"--reconcile", "--dest=-", "helloworld@v1"},
+			wantErr: "--reconcile can't be used with --backfill-manifest-only or when writing an archive",
+		},
+		{
+			name:    "show_diff_with_archive",
+			args:    []string{"--show-diff", "--dest=-", "helloworld@v1"},
+			wantErr: "--show-diff can't be used with",
+		},
+		{
+			name:    "negative_max_output_files",
+			args:    []string{"--max-output-files=-1", "helloworld@v1"},
+			wantErr: "--max-output-files, --max-output-bytes, and --max-file-bytes must not be negative",
+		},
+		{
+			name:    "stop_after_step_with_resume",
+			args:    []string{"--stop-after-step=3", "--resume", "helloworld@v1"},
+			wantErr: "--start-from-step and --stop-after-step can't be used with --resume",
+		},
+		{
+			name:    "negative_start_from_step",
+			args:    []string{"--start-from-step=-1", "helloworld@v1"},
+			wantErr: "--start-from-step and --stop-after-step must not be negative",
+		},
+		{
+			name:    "resume_with_archive",
+			args:    []string{"--resume", "--dest=-", "helloworld@v1"},
+			wantErr: "--resume can't be used with --reconcile or when writing an archive",
+		},
+		{
+			name:    "resumable_with_show_diff",
+			args:    []string{"--resumable", "--show-diff", "helloworld@v1"},
+			wantErr: "--resumable can't be used with --reconcile, --show-diff, --github-repo, or when writing an archive",
+		},
+		{
+			name: "also_render_to",
+			args: []string{"--also-render-to=preview", "--also-render-input=env=preview", "helloworld@v1"},
+			want: RenderFlags{
+				LogFlags: flags.LogFlags{
+					LogFormat: "text",
+					LogLevel:  "warning",
+				},
+				AlsoRenderInputs: map[string]string{"env": "preview"},
+				MaxOutputFiles:   100_000,
+				MaxOutputBytes:   10 << 30,
+				MaxFileBytes:     1 << 30,
+				StopAfterStep:    -1,
+				AlsoRenderTo:     "preview",
+				Source:           "helloworld@v1",
+				Dest:             ".",
+				GitProtocol:      "https",
+				GitHubAPIURL:     "https://api.github.com",
+				Inputs:           map[string]string{},
 			},
 		},
+		{
+			name:    "also_render_input_without_also_render_to",
+			args:    []string{"--also-render-input=env=preview", "helloworld@v1"},
+			wantErr: "--also-render-input requires --also-render-to",
+		},
+		{
+			name:    "also_render_to_with_archive",
+			args:    []string{"--also-render-to=preview", "--dest=-", "helloworld@v1"},
+			wantErr: "--also-render-to can't be used with",
+		},
+		{
+			name:    "github_branch_without_repo",
+			args:    []string{"--github-branch=new-service", "helloworld@v1"},
+			wantErr: "--github-branch and --github-base-branch require --github-repo",
+		},
+		{
+			name:    "github_repo_with_archive",
+			args:    []string{"--github-repo=my-org/my-repo", "--github-token=t", "--dest=-", "helloworld@v1"},
+			wantErr: "--github-repo can't be used with",
+		},
+		{
+			name:    "github_repo_with_absolute_dest",
+			args:    []string{"--github-repo=my-org/my-repo", "--github-token=t", "--dest=/foo", "helloworld@v1"},
+			wantErr: `--dest must be a relative path within the repo, but got "/foo"`,
+		},
+		{
+			name:    "github_repo_without_token",
+			args:    []string{"--github-repo=my-org/my-repo", "helloworld@v1"},
+			wantErr: "--github-repo requires a GitHub token",
+		},
+		{
+			name:    "invalid_file_metadata",
+			args:    []string{"--file-metadata=everything", "--dest=/foo", "helloworld@v1"},
+			wantErr: `invalid --file-metadata "everything", must be one of [permissions preserve xattrs]`,
+		},
 		{
 			name:    "required_source_is_missing",
 			args:    []string{},
@@ -173,6 +355,44 @@ func TestDestOK(t *testing.T) {
 	}
 }
 
+func TestPrintOutputs(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		outputs map[string]string
+		want    string
+	}{
+		{
+			name: "no_outputs",
+		},
+		{
+			name: "sorted_by_name",
+			outputs: map[string]string{
+				"service_url": "https://my-service.run.app",
+				"module_path": "github.com/foo/my-service",
+			},
+			want: `Template outputs:
+  module_path: github.com/foo/my-service
+  service_url: https://my-service.run.app
+`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf strings.Builder
+			printOutputs(&buf, tc.outputs)
+			if diff := cmp.Diff(buf.String(), tc.want); diff != "" {
+				t.Errorf("output was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
 func TestRenderPrompt(t *testing.T) {
 	t.Parallel()
 
@@ -311,6 +531,10 @@ func assertManifest(ctx context.Context, tb testing.TB, whereAreWe string, want
 
 		// Don't force test author to compute hashes when writing/updating test cases.
 		cmpopts.IgnoreFields(manifest.Manifest{}, "TemplateDirhash", "CreationTime", "ModificationTime"),
+
+		// Input provenance and the render environment are tested separately.
+		cmpopts.IgnoreFields(manifest.Manifest{}, "UpgradeChannelSource", "ConflictFileNames", "InputFiles", "RenderEnvironment"),
+		cmpopts.IgnoreFields(manifest.Input{}, "Source", "SourceFile"),
 		cmpopts.IgnoreFields(manifest.OutputFile{}, "Hash"),
 	}
 	if diff := cmp.Diff(got, want, opts...); diff != "" {
@@ -0,0 +1,85 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"fmt"
+
+	"github.com/posener/complete/v2/predict"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+
+	"github.com/abcxyz/abc/templates/common/flags"
+	"github.com/abcxyz/abc/templates/model/decode"
+	"github.com/abcxyz/pkg/cli"
+)
+
+// kinds maps the values of --kind to the "kind" field of the YAML files.
+var kinds = map[string]string{
+	"goldentest": decode.KindGoldenTest,
+	"manifest":   decode.KindManifest,
+	"spec":       decode.KindTemplate,
+}
+
+// Flags describes which JSON Schema to print.
+type Flags struct {
+	// See common/flags.LogFlags.
+	flags.LogFlags
+
+	// Kind is the kind of file to print the schema of; one of the keys of
+	// kinds.
+	Kind string
+
+	// APIVersion limits the schema to a single api_version. If empty, the
+	// schema covers every api_version.
+	APIVersion string
+}
+
+func (f *Flags) Register(set *cli.FlagSet) {
+	s := flags.NewSection(set, "SCHEMA OPTIONS")
+
+	kindNames := maps.Keys(kinds)
+	slices.Sort(kindNames)
+
+	s.StringVar(&cli.StringVar{
+		Name:    "kind",
+		Example: "spec",
+		Target:  &f.Kind,
+		Predict: predict.Set(kindNames),
+		Usage:   fmt.Sprintf("the kind of file to print the JSON Schema of; one of %v", kindNames),
+	})
+
+	s.StringVar(&cli.StringVar{
+		Name:    "api-version",
+		Example: "cli.abcxyz.dev/v1beta6",
+		Target:  &f.APIVersion,
+		Usage:   "only describe files with this api_version; by default, the schema covers every api_version that this version of abc supports",
+	})
+
+	f.LogFlags.Register(set)
+
+	set.AfterParse(func(existingErr error) error {
+		if f.Kind == "" {
+			return fmt.Errorf("missing --kind flag; it must be one of %v", kindNames)
+		}
+		if _, ok := kinds[f.Kind]; !ok {
+			return fmt.Errorf("invalid --kind %q, must be one of %v", f.Kind, kindNames)
+		}
+		if len(set.Args()) > 0 {
+			return fmt.Errorf("unexpected arguments: %q", set.Args())
+		}
+		return nil
+	})
+}
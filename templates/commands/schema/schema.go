@@ -0,0 +1,91 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package schema implements the "templates schema" subcommand.
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/abcxyz/abc-updater/pkg/metrics"
+	"github.com/abcxyz/abc/internal/metricswrap"
+	"github.com/abcxyz/abc/internal/version"
+	"github.com/abcxyz/abc/templates/model/schema"
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/logging"
+)
+
+type Command struct {
+	cli.BaseCommand
+	flags Flags
+}
+
+// Desc implements cli.Command.
+func (c *Command) Desc() string {
+	return "print the JSON Schema of spec, manifest, or golden test files"
+}
+
+// Help implements cli.Command.
+func (c *Command) Help() string {
+	return `
+Usage: {{ COMMAND }} [options] --kind=<spec|manifest|goldentest>
+
+The {{ COMMAND }} command prints a JSON Schema describing the YAML files of the
+given kind: spec.yaml files, manifests, or golden test.yaml files. Editors
+with a YAML language server can use it to validate and autocomplete these
+files, and CI can use any JSON Schema validator to check them without
+running abc.
+
+By default, the schema covers every api_version that this version of abc
+supports, and checks each file against the model of its own api_version. Use
+--api-version to describe just one.
+
+The schema checks which fields exist and their types. Some rules, like which
+fields must be set together, are only checked by abc itself.
+`
+}
+
+// Flags implements cli.Command.
+func (c *Command) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+func (c *Command) Run(ctx context.Context, args []string) error {
+	mClient := metrics.FromContext(ctx)
+	cleanup := metricswrap.WriteMetric(ctx, mClient, "command_schema", 1)
+	defer cleanup()
+
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	ctx = c.flags.WithLogger(ctx, c.Stderr())
+	logger := logging.FromContext(ctx).With("logger", "Run")
+	logger.DebugContext(ctx, "generating JSON Schema", "kind", c.flags.Kind, "api_version", c.flags.APIVersion)
+
+	s, err := schema.Generate(kinds[c.flags.Kind], c.flags.APIVersion, version.IsReleaseBuild())
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	enc := json.NewEncoder(c.Stdout())
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(s); err != nil {
+		return fmt.Errorf("failed writing schema: %w", err)
+	}
+	return nil
+}
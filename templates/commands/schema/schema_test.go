@@ -0,0 +1,98 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestCommand(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name      string
+		args      []string
+		wantTitle string
+		wantErr   string
+	}{
+		{
+			name:      "spec",
+			args:      []string{"--kind=spec"},
+			wantTitle: "abc Template file",
+		},
+		{
+			name:      "manifest_single_api_version",
+			args:      []string{"--kind=manifest", "--api-version=cli.abcxyz.dev/v1beta7"},
+			wantTitle: "abc Manifest file",
+		},
+		{
+			name:      "goldentest",
+			args:      []string{"--kind=goldentest"},
+			wantTitle: "abc GoldenTest file",
+		},
+		{
+			name:    "missing_kind",
+			wantErr: "missing --kind flag",
+		},
+		{
+			name:    "invalid_kind",
+			args:    []string{"--kind=Template"},
+			wantErr: `invalid --kind "Template"`,
+		},
+		{
+			name:    "unknown_api_version",
+			args:    []string{"--kind=spec", "--api-version=cli.abcxyz.dev/v9"},
+			wantErr: `api_version "cli.abcxyz.dev/v9" doesn't exist`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			cmd := &Command{}
+			_, stdout, _ := cmd.Pipe()
+			err := cmd.Run(ctx, tc.args)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			var got struct {
+				Schema string `json:"$schema"`
+				Title  string `json:"title"`
+			}
+			if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+				t.Fatalf("output isn't JSON: %v\n%s", err, stdout.String())
+			}
+			if got.Title != tc.wantTitle {
+				t.Errorf("got title %q, want %q", got.Title, tc.wantTitle)
+			}
+			if got.Schema == "" {
+				t.Error("the output is missing $schema")
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stacks
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/posener/complete/v2/predict"
+
+	"github.com/abcxyz/abc/templates/common/flags"
+	"github.com/abcxyz/pkg/cli"
+)
+
+// Flags describes which stack to render or upgrade and how. The same flags
+// are used by both "stacks render" and "stacks upgrade".
+type Flags struct {
+	// See common/flags.LogFlags.
+	flags.LogFlags
+
+	// StackFile is the path to the stack file, given as the positional
+	// argument.
+	StackFile string
+
+	// Dest is the directory that the members' dest directories are relative
+	// to.
+	Dest string
+
+	// See common/flags.GitProtocol().
+	GitProtocol string
+
+	// Overlays are stack overlay files to apply to the stack, in order.
+	Overlays []string
+
+	// See common/flags.KeepTempDirs().
+	KeepTempDirs bool
+
+	// See common/flags.UpgradeChannel().
+	UpgradeChannel string
+}
+
+func (s *Flags) Register(set *cli.FlagSet) {
+	f := flags.NewSection(set, "STACK OPTIONS")
+
+	f.StringVar(&cli.StringVar{
+		Name:    "dest",
+		Aliases: []string{"d"},
+		Example: "/my/git/dir",
+		Target:  &s.Dest,
+		Default: ".",
+		Predict: predict.Dirs("*"),
+		Usage:   "The directory that each member's dest directory is relative to.",
+	})
+
+	f.StringSliceVar(&cli.StringSliceVar{
+		Name:    "overlay",
+		Example: "overlays/prod.yaml",
+		Target:  &s.Overlays,
+		Predict: predict.Files("*.yaml"),
+		Usage: "A stack overlay file that adapts the stack to one environment by overriding vars and inputs and " +
+			"adding or removing members. May be repeated; overlays are applied in order.",
+	})
+
+	f.StringVar(flags.GitProtocol(&s.GitProtocol))
+	f.StringVar(flags.UpgradeChannel(&s.UpgradeChannel))
+
+	t := flags.NewSection(set, "TEMPLATE AUTHORS")
+	t.BoolVar(flags.KeepTempDirs(&s.KeepTempDirs))
+
+	s.LogFlags.Register(set)
+
+	set.AfterParse(func(existingErr error) error {
+		s.StackFile = strings.TrimSpace(set.Arg(0))
+		if s.StackFile == "" {
+			return fmt.Errorf("missing <stack_file> argument")
+		}
+		if len(set.Args()) > 1 {
+			return fmt.Errorf("expected exactly one argument, but got %q", set.Args())
+		}
+		return nil
+	})
+}
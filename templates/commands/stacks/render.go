@@ -0,0 +1,116 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package stacks implements the subcommands for rendering and upgrading
+// stacks, which are sets of templates installed together as a unit.
+package stacks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/benbjohnson/clock"
+
+	"github.com/abcxyz/abc-updater/pkg/metrics"
+	"github.com/abcxyz/abc/internal/metricswrap"
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/stack"
+	"github.com/abcxyz/pkg/cli"
+)
+
+type RenderCommand struct {
+	cli.BaseCommand
+	flags Flags
+
+	// For testing.
+	clock       clock.Clock
+	tempDirBase string
+}
+
+// Desc implements cli.Command.
+func (c *RenderCommand) Desc() string {
+	return "render every template in a stack"
+}
+
+// Help implements cli.Command.
+func (c *RenderCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options] <stack_file>
+
+The {{ COMMAND }} command renders each member of the stack described by
+<stack_file> into its own directory under --dest, in the order the members are
+listed. Each member's inputs may use the stack's shared vars, like
+{{.vars.project_id}}, and the outputs of earlier members, like
+{{.outputs.network.vpc_name}}.
+
+Members that have already been rendered must be updated with
+"abc stacks upgrade" instead.
+`
+}
+
+// Flags implements cli.Command.
+func (c *RenderCommand) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+func (c *RenderCommand) Run(ctx context.Context, args []string) error {
+	mClient := metrics.FromContext(ctx)
+	cleanup := metricswrap.WriteMetric(ctx, mClient, "command_stacks_render", 1)
+	defer cleanup()
+
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	ctx = c.flags.WithLogger(ctx, c.Stderr())
+
+	p, err := stackParams(&c.flags, c.clock, c.tempDirBase, c.Stdout())
+	if err != nil {
+		return err
+	}
+	results, err := stack.Render(ctx, p)
+	if !c.flags.Quiet {
+		for _, r := range results {
+			fmt.Fprintf(c.Stdout(), "Rendered %s into %s\n", r.Name, r.Dest)
+		}
+	}
+	return err //nolint:wrapcheck
+}
+
+// stackParams returns the parameters shared by stack renders and upgrades.
+func stackParams(f *Flags, clk clock.Clock, tempDirBase string, stdout io.Writer) (*stack.Params, error) {
+	if clk == nil {
+		clk = clock.New()
+	}
+	dest, err := filepath.Abs(f.Dest)
+	if err != nil {
+		return nil, fmt.Errorf("filepath.Abs(%q): %w", f.Dest, err)
+	}
+	return &stack.Params{
+		Clock:          clk,
+		Dest:           dest,
+		FS:             &common.RealFS{},
+		GitProtocol:    f.GitProtocol,
+		KeepTempDirs:   f.KeepTempDirs,
+		Overlays:       f.Overlays,
+		StackFile:      f.StackFile,
+		Stdout:         stdout,
+		SuppressPrint:  f.Quiet,
+		TempDirBase:    tempDirBase,
+		UpgradeChannel: f.UpgradeChannel,
+	}, nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stacks
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestFlags_Parse(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		args    []string
+		want    Flags
+		wantErr string
+	}{
+		{
+			name: "all_flags",
+			args: []string{
+				"--dest=/out", "--git-protocol=https", "--upgrade-channel=main", "--keep-temp-dirs",
+				"--overlay=base.yaml", "--overlay=prod.yaml", "stack.yaml",
+			},
+			want: Flags{
+				StackFile:      "stack.yaml",
+				Dest:           "/out",
+				GitProtocol:    "https",
+				Overlays:       []string{"base.yaml", "prod.yaml"},
+				KeepTempDirs:   true,
+				UpgradeChannel: "main",
+			},
+		},
+		{
+			name: "defaults",
+			args: []string{"stack.yaml"},
+			want: Flags{
+				StackFile:   "stack.yaml",
+				Dest:        ".",
+				GitProtocol: "https",
+			},
+		},
+		{
+			name:    "missing_stack_file",
+			args:    []string{},
+			wantErr: "missing <stack_file> argument",
+		},
+		{
+			name:    "too_many_args",
+			args:    []string{"a.yaml", "b.yaml"},
+			wantErr: "expected exactly one argument",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var cmd RenderCommand
+			cmd.SetLookupEnv(cli.MapLookuper(nil))
+
+			err := cmd.Flags().Parse(tc.args)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(cmd.flags, tc.want, cmp.FilterPath(func(p cmp.Path) bool {
+				return p.String() == "LogFlags"
+			}, cmp.Ignore())); diff != "" {
+				t.Errorf("flags were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestRenderThenUpgrade(t *testing.T) {
+	t.Parallel()
+
+	stackDir := t.TempDir()
+	destDir := t.TempDir()
+	abctestutil.WriteAll(t, stackDir, map[string]string{
+		"stack.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Stack'
+members:
+  - name: 'greeting'
+    source: './greeting'
+    dest: 'greeting'
+    inputs:
+      - name: 'name'
+        value: 'Alice'
+`,
+		"greeting/spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'a greeting'
+inputs:
+  - name: 'name'
+    desc: 'who to greet'
+steps:
+  - desc: 'include the greeting'
+    action: 'include'
+    params:
+      paths: ['hello.txt']
+  - desc: 'fill in the name'
+    action: 'go_template'
+    params:
+      paths: ['hello.txt']
+`,
+		"greeting/hello.txt": "hello {{.name}}\n",
+	})
+	stackFile := filepath.Join(stackDir, "stack.yaml")
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	clk := clock.NewMock()
+
+	renderCmd := &RenderCommand{clock: clk, tempDirBase: t.TempDir()}
+	_, stdout, _ := renderCmd.Pipe()
+	if err := renderCmd.Run(ctx, []string{"--dest=" + destDir, stackFile}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stdout.String(), "Rendered greeting into "+filepath.Join(destDir, "greeting")+"\n"; got != want {
+		t.Errorf("render stdout was %q, want %q", got, want)
+	}
+
+	// A local edit that conflicts with the upgrade makes the command stop with
+	// the same exit code as "abc upgrade".
+	abctestutil.Overwrite(t, filepath.Join(destDir, "greeting", "hello.txt"), "hi Alice\n")
+	abctestutil.Overwrite(t, filepath.Join(stackDir, "greeting", "hello.txt"), "greetings {{.name}}\n")
+	clk.Add(1)
+
+	upgradeCmd := &UpgradeCommand{clock: clk, tempDirBase: t.TempDir()}
+	_, stdout, _ = upgradeCmd.Pipe()
+	err := upgradeCmd.Run(ctx, []string{"--dest=" + destDir, stackFile})
+	var exitErr *common.ExitCodeError
+	if !errors.As(err, &exitErr) || exitErr.Code != common.ExitCodeMergeConflict {
+		t.Fatalf("got error %v, want exit code %d", err, common.ExitCodeMergeConflict)
+	}
+	if got, want := stdout.String(), "Upgrading greeting in "+filepath.Join(destDir, "greeting")+" needs manual resolution (merge_conflict)"; !strings.HasPrefix(got, want) {
+		t.Errorf("upgrade stdout was %q, want it to start with %q", got, want)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stacks
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/benbjohnson/clock"
+
+	"github.com/abcxyz/abc-updater/pkg/metrics"
+	"github.com/abcxyz/abc/internal/metricswrap"
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/stack"
+	"github.com/abcxyz/abc/templates/common/upgrade"
+	"github.com/abcxyz/pkg/cli"
+)
+
+type UpgradeCommand struct {
+	cli.BaseCommand
+	flags Flags
+
+	// For testing.
+	clock       clock.Clock
+	tempDirBase string
+}
+
+// Desc implements cli.Command.
+func (c *UpgradeCommand) Desc() string {
+	return "upgrade every template in a stack"
+}
+
+// Help implements cli.Command.
+func (c *UpgradeCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options] <stack_file>
+
+The {{ COMMAND }} command upgrades each member of the stack described by
+<stack_file>, in the order the members are listed, to the template source and
+inputs currently given in the stack file. Outputs of earlier members are
+recomputed before the inputs of later members, so a change that flows from one
+member into another is applied in a single run.
+
+If a member's upgrade has a conflict that needs manual resolution, the
+remaining members are not upgraded. Resolve the conflict as for "abc upgrade",
+then run this command again. The exit code is the same as for "abc upgrade".
+`
+}
+
+// Flags implements cli.Command.
+func (c *UpgradeCommand) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+func (c *UpgradeCommand) Run(ctx context.Context, args []string) error {
+	mClient := metrics.FromContext(ctx)
+	cleanup := metricswrap.WriteMetric(ctx, mClient, "command_stacks_upgrade", 1)
+	defer cleanup()
+
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	ctx = c.flags.WithLogger(ctx, c.Stderr())
+
+	p, err := stackParams(&c.flags, c.clock, c.tempDirBase, c.Stdout())
+	if err != nil {
+		return err
+	}
+	results, err := stack.Upgrade(ctx, p)
+	for _, r := range results {
+		if !c.flags.Quiet || r.UpgradeResult.RequiresUserAttention() {
+			printMemberResult(c.Stdout(), r)
+		}
+	}
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if len(results) > 0 {
+		switch results[len(results)-1].UpgradeResult {
+		case upgrade.AlreadyUpToDate, upgrade.Success:
+		case upgrade.MergeConflict:
+			return &common.ExitCodeError{Code: common.ExitCodeMergeConflict}
+		case upgrade.PatchReversalConflict:
+			return &common.ExitCodeError{Code: common.ExitCodePatchReversalConflict}
+		case upgrade.SourceUnavailable:
+			return &common.ExitCodeError{Code: common.ExitCodeDownload}
+		}
+	}
+	return nil
+}
+
+// printMemberResult prints a line describing the upgrade of one stack member,
+// followed by the files needing attention, if any.
+func printMemberResult(w io.Writer, r *stack.MemberResult) {
+	switch r.UpgradeResult {
+	case upgrade.AlreadyUpToDate:
+		fmt.Fprintf(w, "%s in %s is already up to date\n", r.Name, r.Dest)
+	case upgrade.Success:
+		fmt.Fprintf(w, "Upgraded %s in %s\n", r.Name, r.Dest)
+	case upgrade.MergeConflict, upgrade.PatchReversalConflict:
+		fmt.Fprintf(w, "Upgrading %s in %s needs manual resolution (%s); the remaining members were not upgraded:\n",
+			r.Name, r.Dest, r.UpgradeResult)
+		for _, mr := range r.UpgradeDetails {
+			for _, c := range mr.MergeConflicts {
+				fmt.Fprintf(w, "  %s: %s\n", c.Path, c.Action)
+			}
+			for _, c := range mr.ReversalConflicts {
+				fmt.Fprintf(w, "  %s: patch reversal conflict\n", c.RelPath)
+			}
+		}
+	case upgrade.SourceUnavailable:
+		fmt.Fprintf(w, "Upgrading %s in %s failed because its template source is unavailable; the remaining members were not upgraded:\n",
+			r.Name, r.Dest)
+		for _, mr := range r.UpgradeDetails {
+			if mr.SourceUnavailable != nil {
+				fmt.Fprintf(w, "  %s\n", mr.SourceUnavailable)
+			}
+		}
+	}
+}
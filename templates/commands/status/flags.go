@@ -0,0 +1,68 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common/flags"
+	"github.com/abcxyz/pkg/cli"
+)
+
+// Flags describes where to look for template installations.
+type Flags struct {
+	// See common/flags.LogFlags.
+	flags.LogFlags
+
+	// Location is the directory to search for manifests, or a single manifest
+	// file.
+	Location string
+
+	// If true, Location is always crawled for manifests, rather than using the
+	// .abc/index.yaml installation index.
+	IgnoreIndex bool
+
+	// If true, only deprecated installations are listed.
+	DeprecatedOnly bool
+}
+
+func (f *Flags) Register(set *cli.FlagSet) {
+	s := flags.NewSection(set, "STATUS OPTIONS")
+
+	s.BoolVar(&cli.BoolVar{
+		Name:   "ignore-index",
+		Target: &f.IgnoreIndex,
+		Usage:  "find manifests by searching the whole directory tree, rather than using the .abc/index.yaml installation index at the root of the git repo",
+	})
+	s.BoolVar(&cli.BoolVar{
+		Name:   "deprecated-only",
+		Target: &f.DeprecatedOnly,
+		Usage:  "only list installations of templates that are deprecated",
+	})
+
+	f.LogFlags.Register(set)
+
+	set.AfterParse(func(existingErr error) error {
+		f.Location = strings.TrimSpace(set.Arg(0))
+		if f.Location == "" {
+			f.Location = "."
+		}
+		if len(set.Args()) > 1 {
+			return fmt.Errorf("expected at most one argument, but got %q", set.Args())
+		}
+		return nil
+	})
+}
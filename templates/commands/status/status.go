@@ -0,0 +1,138 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package status implements the "status" subcommand, which lists the template
+// installations under a directory.
+package status
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/abcxyz/abc-updater/pkg/metrics"
+	"github.com/abcxyz/abc/internal/metricswrap"
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/indexutil"
+	manifestutil "github.com/abcxyz/abc/templates/model/manifest"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1beta7"
+	"github.com/abcxyz/pkg/cli"
+)
+
+type Command struct {
+	cli.BaseCommand
+	flags Flags
+}
+
+// Desc implements cli.Command.
+func (c *Command) Desc() string {
+	return "list the template installations under a directory"
+}
+
+// Help implements cli.Command.
+func (c *Command) Help() string {
+	return `
+Usage: {{ COMMAND }} [options] [<location>]
+
+The {{ COMMAND }} command lists each template installation under <location>
+(by default, the current directory), with the template it came from and its
+version, and flags the installations whose template was deprecated as of their
+most recent render or upgrade.
+
+The installation index at the root of the git repo is used to find manifests if
+there is one; otherwise, or with --ignore-index, the directory tree is searched.
+`
+}
+
+// Flags implements cli.Command.
+func (c *Command) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+func (c *Command) Run(ctx context.Context, args []string) error {
+	mClient := metrics.FromContext(ctx)
+	cleanup := metricswrap.WriteMetric(ctx, mClient, "command_status", 1)
+	defer cleanup()
+
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	ctx = c.flags.WithLogger(ctx, c.Stderr())
+
+	fs := &common.RealFS{}
+	paths, err := indexutil.FindManifests(ctx, fs, c.flags.Location, c.flags.IgnoreIndex)
+	if err != nil {
+		return err
+	}
+
+	installations := make([]*installation, 0, len(paths))
+	for _, p := range paths {
+		m, _, err := manifestutil.Load(ctx, fs, filepath.Join(c.flags.Location, p))
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		if c.flags.DeprecatedOnly && m.Deprecated == nil {
+			continue
+		}
+		installations = append(installations, &installation{
+			// Manifests are in the .abc directory of the directory where the
+			// template was installed.
+			dir:      filepath.Dir(filepath.Dir(p)),
+			manifest: m,
+		})
+	}
+
+	return writeStatus(c.Stdout(), installations)
+}
+
+type installation struct {
+	// The directory the template was installed into, relative to the
+	// location being searched.
+	dir      string
+	manifest *manifest.Manifest
+}
+
+// writeStatus writes a table with one row per installation.
+func writeStatus(w io.Writer, installations []*installation) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DIRECTORY\tTEMPLATE\tVERSION\tSTATUS")
+	for _, inst := range installations {
+		m := inst.manifest
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n",
+			inst.dir,
+			common.FirstNonZero(m.TemplateLocation.Val, "-"),
+			common.FirstNonZero(m.TemplateVersion.Val, "-"),
+			statusText(m))
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("failed writing status: %w", err)
+	}
+	return nil
+}
+
+func statusText(m *manifest.Manifest) string {
+	d := m.Deprecated
+	if d == nil {
+		return "ok"
+	}
+	out := "DEPRECATED: " + d.Message.Val
+	if d.ReplacedBy != nil {
+		out += fmt.Sprintf(" (replaced by %s)", d.ReplacedBy.Val)
+	}
+	return out
+}
@@ -0,0 +1,113 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+const (
+	currentManifest = `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Manifest'
+template_location: 'github.com/foo/current'
+template_version: 'v1.0.0'
+template_dirhash: 'h1:abc'
+`
+	deprecatedManifest = `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Manifest'
+template_location: 'github.com/foo/old'
+template_version: 'v0.9.0'
+template_dirhash: 'h1:def'
+deprecated:
+  message: 'no longer maintained'
+  replaced_by: 'github.com/foo/current'
+`
+)
+
+func TestStatus(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		args       []string
+		files      map[string]string
+		wantStdout string
+		wantErr    string
+	}{
+		{
+			name: "lists_installations",
+			files: map[string]string{
+				"a/.abc/manifest_a.lock.yaml": currentManifest,
+				"b/.abc/manifest_b.lock.yaml": deprecatedManifest,
+			},
+			wantStdout: `DIRECTORY  TEMPLATE                VERSION  STATUS
+a          github.com/foo/current  v1.0.0   ok
+b          github.com/foo/old      v0.9.0   DEPRECATED: no longer maintained (replaced by github.com/foo/current)
+`,
+		},
+		{
+			name: "deprecated_only",
+			args: []string{"--deprecated-only"},
+			files: map[string]string{
+				"a/.abc/manifest_a.lock.yaml": currentManifest,
+				"b/.abc/manifest_b.lock.yaml": deprecatedManifest,
+			},
+			wantStdout: `DIRECTORY  TEMPLATE            VERSION  STATUS
+b          github.com/foo/old  v0.9.0   DEPRECATED: no longer maintained (replaced by github.com/foo/current)
+`,
+		},
+		{
+			name:       "no_installations",
+			files:      map[string]string{"README.md": "hi"},
+			wantStdout: "DIRECTORY  TEMPLATE  VERSION  STATUS\n",
+		},
+		{
+			name:    "invalid_manifest",
+			files:   map[string]string{".abc/manifest_x.lock.yaml": "kind: 'Manifest'\n"},
+			wantErr: "api_version",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			abctestutil.WriteAll(t, tempDir, tc.files)
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			cmd := &Command{}
+			_, stdout, _ := cmd.Pipe()
+			err := cmd.Run(ctx, append(tc.args, tempDir))
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(stdout.String(), tc.wantStdout); diff != "" {
+				t.Errorf("stdout was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
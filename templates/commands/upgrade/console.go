@@ -0,0 +1,153 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upgrade
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/alessio/shellescape"
+	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+
+	"github.com/abcxyz/abc/templates/common/upgrade"
+)
+
+// palette holds the functions that style the upgrade command's console output.
+// When color is disabled, every function returns its argument unchanged.
+type palette struct {
+	heading func(a ...any) string
+	good    func(a ...any) string
+	warn    func(a ...any) string
+	bad     func(a ...any) string
+	command func(a ...any) string
+	faint   func(a ...any) string
+}
+
+// newPalette returns a palette that colorizes its output if useColor is true.
+func newPalette(useColor bool) *palette {
+	if !useColor {
+		return &palette{
+			heading: fmt.Sprint,
+			good:    fmt.Sprint,
+			warn:    fmt.Sprint,
+			bad:     fmt.Sprint,
+			command: fmt.Sprint,
+			faint:   fmt.Sprint,
+		}
+	}
+	sprint := func(attrs ...color.Attribute) func(a ...any) string {
+		c := color.New(attrs...)
+		// The decision to use color was already made by shouldUseColor, so
+		// override the color package's own detection.
+		c.EnableColor()
+		return c.SprintFunc()
+	}
+	return &palette{
+		heading: sprint(color.Bold),
+		good:    sprint(color.FgGreen),
+		warn:    sprint(color.FgYellow),
+		bad:     sprint(color.FgRed),
+		command: sprint(color.FgCyan),
+		faint:   sprint(color.Faint),
+	}
+}
+
+// shouldUseColor returns whether output written to w should be colorized. It
+// is only colorized when w is a terminal and the NO_COLOR environment variable
+// (https://no-color.org) is unset or empty.
+func shouldUseColor(w io.Writer, getEnv func(string) string) bool {
+	if getEnv("NO_COLOR") != "" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	return ok && isatty.IsTerminal(f.Fd())
+}
+
+// action returns the given action name, styled according to how much
+// attention it needs from the user.
+func (p *palette) action(a upgrade.Action) string {
+	switch a {
+	case upgrade.WriteNew:
+		return p.good(a)
+	case upgrade.Noop:
+		return p.faint(a)
+	case upgrade.DeleteAction, upgrade.EditDeleteConflict, upgrade.DeleteEditConflict:
+		return p.bad(a)
+	case upgrade.AddAddConflict, upgrade.EditEditConflict:
+		return p.warn(a)
+	}
+	return string(a)
+}
+
+// resolution is a shell command that resolves a merge conflict in one
+// particular way.
+type resolution struct {
+	// desc says what the command does, like "keep your version".
+	desc string
+
+	// cmd is a copy-pasteable shell command.
+	cmd string
+}
+
+// resolutions returns the shell commands that resolve the given merge
+// conflict, one for each way of resolving it. installedDir is the directory
+// where the template is installed; the paths in the conflict are relative to
+// it.
+func resolutions(installedDir string, cf *upgrade.ActionTaken) []resolution {
+	path := func(rel string) string {
+		return shellescape.Quote(filepath.Join(installedDir, rel))
+	}
+	file, ours, incoming := path(cf.Path), path(cf.OursPath), path(cf.IncomingTemplatePath)
+
+	switch cf.Action {
+	case upgrade.EditEditConflict, upgrade.AddAddConflict:
+		if cf.OursPath == "" {
+			// Your version was left in place.
+			return []resolution{
+				{desc: "compare", cmd: fmt.Sprintf("diff %s %s", file, incoming)},
+				{desc: "keep your version", cmd: fmt.Sprintf("rm %s", incoming)},
+				{desc: "take the new template version", cmd: fmt.Sprintf("mv %s %s", incoming, file)},
+			}
+		}
+		return []resolution{
+			{desc: "compare", cmd: fmt.Sprintf("diff %s %s", ours, incoming)},
+			{desc: "keep your version", cmd: fmt.Sprintf("mv %s %s && rm %s", ours, file, incoming)},
+			{desc: "take the new template version", cmd: fmt.Sprintf("mv %s %s && rm %s", incoming, file, ours)},
+		}
+	case upgrade.EditDeleteConflict:
+		return []resolution{
+			{desc: "keep your version", cmd: fmt.Sprintf("mv %s %s", ours, file)},
+			{desc: "delete the file", cmd: fmt.Sprintf("rm %s", ours)},
+		}
+	case upgrade.DeleteEditConflict:
+		return []resolution{
+			{desc: "take the new template version", cmd: fmt.Sprintf("mv %s %s", incoming, file)},
+			{desc: "keep the file deleted", cmd: fmt.Sprintf("rm %s", incoming)},
+		}
+	case upgrade.WriteNew, upgrade.DeleteAction, upgrade.Noop:
+	}
+	return nil
+}
+
+// installedDir returns the directory where the template of the given result
+// is installed, given the location that the user passed to the upgrade
+// command.
+func installedDir(r *upgrade.ManifestResult, location string) string {
+	// Manifests are always in the .abc directory under the installed dir.
+	return filepath.Dir(filepath.Dir(filepath.Join(location, r.ManifestPath)))
+}
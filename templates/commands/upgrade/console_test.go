@@ -0,0 +1,134 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upgrade
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common/upgrade"
+)
+
+func TestResolutions(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		cf   *upgrade.ActionTaken
+		want []resolution
+	}{
+		{
+			name: "edit_edit",
+			cf: &upgrade.ActionTaken{
+				Action:               upgrade.EditEditConflict,
+				Path:                 "a.txt",
+				IncomingTemplatePath: "a.txt" + upgrade.SuffixFromNewTemplate,
+			},
+			want: []resolution{
+				{desc: "compare", cmd: "diff dir/a.txt dir/a.txt.abcmerge_from_new_template"},
+				{desc: "keep your version", cmd: "rm dir/a.txt.abcmerge_from_new_template"},
+				{desc: "take the new template version", cmd: "mv dir/a.txt.abcmerge_from_new_template dir/a.txt"},
+			},
+		},
+		{
+			name: "add_add_with_renamed_local_file",
+			cf: &upgrade.ActionTaken{
+				Action:               upgrade.AddAddConflict,
+				Path:                 "a.txt",
+				OursPath:             "a.txt" + upgrade.SuffixLocallyAdded,
+				IncomingTemplatePath: "a.txt" + upgrade.SuffixFromNewTemplate,
+			},
+			want: []resolution{
+				{desc: "compare", cmd: "diff dir/a.txt.abcmerge_locally_added dir/a.txt.abcmerge_from_new_template"},
+				{desc: "keep your version", cmd: "mv dir/a.txt.abcmerge_locally_added dir/a.txt && rm dir/a.txt.abcmerge_from_new_template"},
+				{desc: "take the new template version", cmd: "mv dir/a.txt.abcmerge_from_new_template dir/a.txt && rm dir/a.txt.abcmerge_locally_added"},
+			},
+		},
+		{
+			name: "edit_delete",
+			cf: &upgrade.ActionTaken{
+				Action:   upgrade.EditDeleteConflict,
+				Path:     "a.txt",
+				OursPath: "a.txt" + upgrade.SuffixWantToDelete,
+			},
+			want: []resolution{
+				{desc: "keep your version", cmd: "mv dir/a.txt.abcmerge_template_wants_to_delete dir/a.txt"},
+				{desc: "delete the file", cmd: "rm dir/a.txt.abcmerge_template_wants_to_delete"},
+			},
+		},
+		{
+			name: "delete_edit_with_quoting",
+			cf: &upgrade.ActionTaken{
+				Action:               upgrade.DeleteEditConflict,
+				Path:                 "my file.txt",
+				IncomingTemplatePath: "my file.txt" + upgrade.SuffixFromNewTemplateLocallyDeleted,
+			},
+			want: []resolution{
+				{desc: "take the new template version", cmd: "mv 'dir/my file.txt.abcmerge_locally_deleted_vs_new_template_version' 'dir/my file.txt'"},
+				{desc: "keep the file deleted", cmd: "rm 'dir/my file.txt.abcmerge_locally_deleted_vs_new_template_version'"},
+			},
+		},
+		{
+			name: "not_a_conflict",
+			cf: &upgrade.ActionTaken{
+				Action: upgrade.WriteNew,
+				Path:   "a.txt",
+			},
+			want: nil,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := resolutions("dir", tc.cf)
+			if diff := cmp.Diff(got, tc.want, cmp.AllowUnexported(resolution{})); diff != "" {
+				t.Errorf("resolutions were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestShouldUseColor(t *testing.T) {
+	t.Parallel()
+
+	env := func(m map[string]string) func(string) string {
+		return func(k string) string { return m[k] }
+	}
+
+	if shouldUseColor(&strings.Builder{}, env(nil)) {
+		t.Errorf("got color for a non-file writer, want no color")
+	}
+	if shouldUseColor(os.Stdout, env(map[string]string{"NO_COLOR": "1"})) {
+		t.Errorf("got color with NO_COLOR set, want no color")
+	}
+}
+
+func TestPalette(t *testing.T) {
+	t.Parallel()
+
+	if got, want := newPalette(false).action(upgrade.EditEditConflict), "editEditConflict"; got != want {
+		t.Errorf("uncolored action got %q, want %q", got, want)
+	}
+	if got, want := newPalette(true).action(upgrade.EditEditConflict), "\x1b[33meditEditConflict\x1b[0m"; got != want {
+		t.Errorf("colored action got %q, want %q", got, want)
+	}
+}
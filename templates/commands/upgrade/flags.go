@@ -15,15 +15,22 @@
 package upgrade
 
 import (
+	"fmt"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/posener/complete/v2/predict"
 
 	"github.com/abcxyz/abc/templates/common/flags"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1beta7"
 	"github.com/abcxyz/pkg/cli"
 )
 
 type Flags struct {
+	// See common/flags.LogFlags.
+	flags.LogFlags
+
 	Location string
 
 	// See common/flags.AcceptDefaults().
@@ -51,15 +58,28 @@ type Flags struct {
 	// See common/flags.DebugStepDiffs().
 	DebugStepDiffs bool
 
+	// See common/flags.DebugReport().
+	DebugReport string
+
 	// Continue upgrading even if the dirhash matches between the
 	// already-installed template version and the to-be-installed template
 	// version. This is useful to for the manifest to be rewritten with a new
 	// template_location field when running with --template-location=foo.
 	ContinueIfCurrent bool
 
+	// Print, for every file, which action the merge algorithm chose and why.
+	Explain bool
+
 	// See common/flags.GitProtocol().
 	GitProtocol string
 
+	// See common/flags.SkipGitSubmodules().
+	SkipGitSubmodules bool
+
+	// Crawl the directory tree for manifests instead of using the
+	// .abc/index.yaml installation index.
+	IgnoreIndex bool
+
 	// See common/flags.Inputs().
 	Inputs map[string]string
 
@@ -69,21 +89,70 @@ type Flags struct {
 	// See common/flags.KeepTempDirs().
 	KeepTempDirs bool
 
+	// See common/flags.Wait().
+	Wait time.Duration
+
 	// An optional CEL expression which will be evaluated against each manifest
 	// that is found; only those where the expression is true will be upgraded.
 	ManifestFilter string
 
+	// See common/flags.ManifestSigningKey().
+	ManifestSigningKey string
+
+	// The path to a public key. If set, each manifest's signature is verified
+	// against it before upgrading, and the upgrade fails if the manifest is
+	// unsigned or was modified after signing.
+	ManifestVerifyKey string
+
+	// If the template is deprecated in favor of a compatible replacement,
+	// upgrade to the replacement.
+	FollowReplacement bool
+
+	// Re-read the input files recorded in the manifest, rather than using the
+	// input values saved in the manifest.
+	ReuseInputFiles bool
+
 	// The manifest to start with, when upgrading multiple manifests. This is
 	// used when a previous upgrade operation required manual intervention, and
 	// the manual intervention is done, and the user wants to resume.
 	ResumeFrom string
 
+	// See common/flags.PolicyFiles().
+	PolicyFiles []string
+
+	// See common/flags.AllowBufGenerate().
+	AllowBufGenerate bool
+
+	// See common/flags.MaxOutputFiles().
+	MaxOutputFiles int
+
+	// See common/flags.MaxOutputBytes().
+	MaxOutputBytes int64
+
+	// See common/flags.MaxFileBytes().
+	MaxFileBytes int64
+
+	// See common/flags.AuditLog().
+	AuditLog string
+
 	// See common/flags.Prompt().
 	Prompt bool
 
 	// See common/flags.SkipInputValidation().
 	SkipInputValidation bool
 
+	// Keep upgrading the other manifests when a manifest's template source
+	// no longer exists.
+	SkipUnavailable bool
+
+	// Mirrors to retry from when a template source no longer exists, in the
+	// same format as the "mirrors" in the config files.
+	FallbackMirrors map[string]string
+
+	// New template locations for individual manifests, keyed by manifest path
+	// relative to Location.
+	Relocate map[string]string
+
 	// Upgrade to the template specified by this location, rather than the
 	// template location stored in the manifest (which is the default).
 	TemplateLocation string
@@ -91,7 +160,11 @@ type Flags struct {
 	// See common/flags.UpgradeChannel().
 	UpgradeChannel string
 
-	Verbose bool
+	// See common/flags.IgnoreUpgradeChannelPolicy().
+	IgnoreUpgradeChannelPolicy bool
+
+	// See common/flags.ConflictFileNames().
+	ConflictFileNames string
 
 	// The template version to upgrade to. If not specified, the underlying
 	// upgrade library will use the upgrade track specified in the manifest.
@@ -99,7 +172,7 @@ type Flags struct {
 }
 
 func (f *Flags) Register(set *cli.FlagSet) {
-	u := set.NewSection("UPGRADE OPTIONS")
+	u := flags.NewSection(set, "UPGRADE OPTIONS")
 	u.StringSliceVar(&cli.StringSliceVar{
 		Name:    "already-resolved",
 		Example: "my_file.txt,my_dir/my_other_file.txt",
@@ -119,24 +192,79 @@ func (f *Flags) Register(set *cli.FlagSet) {
 		Target: &f.ContinueIfCurrent,
 		Usage:  "continue even if the template dirhash shows that the latest version of the template has already been installed; this is useful to force the manifest to be rewritten when used with --template-location",
 	})
+	u.BoolVar(&cli.BoolVar{
+		Name:   "explain",
+		Target: &f.Explain,
+		Usage:  "print, for every file in each upgraded template installation, the action taken (e.g. writeNew, noop, or a conflict) and why, including whether the file is in the old and new manifests and how its hashes compared",
+	})
+	u.BoolVar(&cli.BoolVar{
+		Name:   "follow-replacement",
+		Target: &f.FollowReplacement,
+		Usage:  "if the template has been deprecated, and its author named a replacement and declared it compatible, upgrade to the replacement template instead; the manifest then records the replacement as the template's location",
+	})
+	u.BoolVar(&cli.BoolVar{
+		Name:   "ignore-index",
+		Target: &f.IgnoreIndex,
+		Usage:  "find manifests to upgrade by searching the whole directory tree, rather than using the .abc/index.yaml installation index at the root of the git repo; use this if some installations aren't in the index, e.g. because they were rendered by an older abc CLI",
+	})
 	u.StringVar(&cli.StringVar{
 		Name:    "manifest-filter",
 		Example: `template_location == "github.com/abcxyz/abc/examples/templates/render/hello_jupiter"`,
 		Target:  &f.ManifestFilter,
 		Usage:   "An optional CEL expression which will be evaluated against each manifest that is found; only those where the expression is true will be upgraded. If not set, the default is to upgrade every manifest that is found in the provided location",
 	})
-	u.BoolVar(flags.Verbose(&f.Verbose))
+	u.StringVar(&cli.StringVar{
+		Name:    "manifest-verify-key",
+		Example: "/path/to/key.pub.pem",
+		Predict: predict.Files("*.pem"),
+		EnvVar:  "ABC_MANIFEST_VERIFY_KEY",
+		Target:  &f.ManifestVerifyKey,
+		Usage:   "the path to a PEM-encoded PKIX Ed25519 or ECDSA public key; if set, each manifest's .sig signature file is checked against this key before upgrading, and the upgrade fails if the manifest is unsigned or was edited after it was signed",
+	})
+	u.StringVar(flags.ManifestSigningKey(&f.ManifestSigningKey))
+	u.StringVar(flags.AuditLog(&f.AuditLog))
+	u.StringVar(flags.ConflictFileNames(&f.ConflictFileNames))
+	u.BoolVar(&cli.BoolVar{
+		Name:   "skip-unavailable",
+		Target: &f.SkipUnavailable,
+		Usage:  "if the template source of a manifest no longer exists (its repo, upgrade channel branch, or subdirectory was deleted), report it and keep upgrading the other manifests, rather than stopping",
+	})
+	u.StringMapVar(&cli.StringMapVar{
+		Name:    "fallback-mirror",
+		Example: "github.com/abcxyz/*=git.internal.corp/mirror/abcxyz/*",
+		Target:  &f.FallbackMirrors,
+		Usage:   "if a template source no longer exists, retry downloading it from this mirror, given as from=to in the same format as the \"mirrors\" in the config files; may be repeated",
+	})
+	u.StringMapVar(&cli.StringMapVar{
+		Name:    "relocate",
+		Example: "foo/.abc/manifest.yaml=github.com/abcxyz/abc/t/new_home@latest",
+		Target:  &f.Relocate,
+		Usage:   "upgrade the manifest at this path, relative to the upgrade location, from the given template location instead of the one in the manifest, and record the new location in the manifest; like --template-location, but for one manifest; may be repeated",
+	})
 
-	r := set.NewSection("RENDER OPTIONS")
+	r := flags.NewSection(set, "RENDER OPTIONS")
 
 	r.StringMapVar(flags.Inputs(&f.Inputs))
 	r.StringSliceVar(flags.InputFiles(&f.InputFiles))
+	r.StringSliceVar(flags.PolicyFiles(&f.PolicyFiles))
+	r.BoolVar(flags.AllowBufGenerate(&f.AllowBufGenerate))
+	r.BoolVar(&cli.BoolVar{
+		Name:   "reuse-input-files",
+		Target: &f.ReuseInputFiles,
+		Usage:  "re-read the --input-file files that were used when the template was rendered, as recorded in the manifest, so that changes to them take effect; by default, the input values saved in the manifest are used, and a warning is printed if an input file has changed",
+	})
 	r.BoolVar(flags.SkipInputValidation(&f.SkipInputValidation))
 	r.BoolVar(flags.DebugStepDiffs(&f.DebugStepDiffs))
+	r.StringVar(flags.DebugReport(&f.DebugReport))
 	r.BoolVar(flags.KeepTempDirs(&f.KeepTempDirs))
+	r.DurationVar(flags.Wait(&f.Wait))
+	r.IntVar(flags.MaxOutputFiles(&f.MaxOutputFiles))
+	r.Int64Var(flags.MaxOutputBytes(&f.MaxOutputBytes))
+	r.Int64Var(flags.MaxFileBytes(&f.MaxFileBytes))
 	r.BoolVar(flags.Prompt(&f.Prompt))
 	r.BoolVar(flags.AcceptDefaults(&f.AcceptDefaults))
 	r.StringVar(flags.UpgradeChannel(&f.UpgradeChannel))
+	r.BoolVar(flags.IgnoreUpgradeChannelPolicy(&f.IgnoreUpgradeChannelPolicy))
 
 	r.StringVar(&cli.StringVar{
 		Name:    "version",
@@ -154,16 +282,31 @@ func (f *Flags) Register(set *cli.FlagSet) {
 		Target:  &f.TemplateLocation,
 	})
 
-	t := set.NewSection("TEMPLATE AUTHORS")
+	t := flags.NewSection(set, "TEMPLATE AUTHORS")
 	t.BoolVar(flags.DebugScratchContents(&f.DebugScratchContents))
 
-	g := set.NewSection("GIT OPTIONS")
+	g := flags.NewSection(set, "GIT OPTIONS")
 	g.StringVar(flags.GitProtocol(&f.GitProtocol))
+	g.BoolVar(flags.SkipGitSubmodules(&f.SkipGitSubmodules))
+
+	f.LogFlags.Register(set)
 
 	set.AfterParse(func(existingErr error) error {
 		// Default location to the first CLI argument, if given.
 		// If not given, default to current directory.
 		f.Location = strings.TrimSpace(set.Arg(0))
+
+		if f.TemplateLocation != "" && len(f.Relocate) > 0 {
+			return fmt.Errorf("--template-location and --relocate must not be used together")
+		}
+
+		if f.MaxOutputFiles < 0 || f.MaxOutputBytes < 0 || f.MaxFileBytes < 0 {
+			return fmt.Errorf("--max-output-files, --max-output-bytes, and --max-file-bytes must not be negative")
+		}
+
+		if f.ConflictFileNames != "" && !slices.Contains(manifest.ConflictFileNamesValues, f.ConflictFileNames) {
+			return fmt.Errorf("invalid --conflict-file-names %q, must be one of %v", f.ConflictFileNames, manifest.ConflictFileNamesValues)
+		}
 		return nil
 	})
 }
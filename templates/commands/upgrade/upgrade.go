@@ -17,8 +17,10 @@ package upgrade
 
 import (
 	"context"
+	"crypto"
 	"fmt"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/alessio/shellescape"
@@ -29,6 +31,10 @@ import (
 	"github.com/abcxyz/abc-updater/pkg/metrics"
 	"github.com/abcxyz/abc/internal/metricswrap"
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/auditlog"
+	"github.com/abcxyz/abc/templates/common/config"
+	"github.com/abcxyz/abc/templates/common/messages"
+	"github.com/abcxyz/abc/templates/common/signing"
 	"github.com/abcxyz/abc/templates/common/upgrade"
 	"github.com/abcxyz/pkg/cli"
 )
@@ -70,64 +76,6 @@ func (c *Command) PredictArgs() complete.Predictor {
 	return predict.Files("") // "Files" will predict both files and dirs
 }
 
-const (
-	mergeInstructions = `
-Some manual conflict resolution is required because of a conflict between your
-local edits and the new version of the template. Please look at all files ending
-in .abcmerge_* and either edit, delete, or rename them to reflect your decision.
-
-Background on conflict types:
-
- - editEditConflict: you made some local edits to this file that was installed
-   by the template, which conflicts with the new version of the template which
-   wants to edit the file. Your locally edited file is unchanged, and the
-   incoming file from the template has the additional extension 
-   ".abcmerge_from_new_template". Please resolve the conflict by either
-     - selectively incorporating some of the changes from the 
-       .abcmerge_from_new_template file into your local file
-	 - rejecting this incoming change by removing the 
-	   .abcmerge_from_new_template file
-	 - overwriting your locally edit file with the .abcmerge_from_new_template
-	   incoming file. 
-
- - editDeleteConflict: you made an edit to this file that was installed by the
-   template, which conflicts with the new version of the template, which wants
-   to delete this file. Your version has been renamed to
-   "yourfile.abcmerge_template_wants_to_delete". Please resolve the conflict by
-   renaming it back to "yourfile" or deleting it.
-
- - deleteEditConflict: you deleted this file that was installed by the template,
-   which conflicts with the new version of the template which wants to edit it.
-   The new version from the template is named
-   "yourfile.abcmerge_locally_deleted_vs_new_template_version". Please resolve
-   the conflict by renaming it to "yourfile" or deleting it.
-
- - addAddConflict: you added a file which was not originally part of the
-   template, which conflicts with the new version of the template, which wants
-   to create a file of the same name. Your version of the file has been renamed
-   to "yourfile.abcmerge_locally_added", and the version of the template is
-   named "yourfile.abcmerge_from_new_template". Please resolve the conflict by
-   (1) renaming one of these files to "yourfile and deleting the other, or (2)
-   merging the two files into "yourfile".`
-
-	patchReversalInstructions = `
-There was a merge conflict when trying to undo changes to file(s) that were
-modified in-place by a previous version of the template.
-
-Background: the upgrade algorithm has a special case for files that were
-modified in place by a previous version of the template (aka "include from
-destination"). When the file was previously modified in place, a patch was saved
-to undo that modification, so a future template version could start fresh and
-redo the modification in place based on new template logic. Just now, this patch
-was applied to the file, but the patch didn't apply cleanly. This happens when
-the file was modified since the previous version of this template was installed;
-that could happen because somebody edited the file, or that same file was
-modified in place by a different template.
-
-To resolve this conflict, please manually apply the rejected hunks in the given
-.rej file, for each entry in the following list:`
-)
-
 func (c *Command) Run(ctx context.Context, args []string) error {
 	mClient := metrics.FromContext(ctx)
 	cleanup := metricswrap.WriteMetric(ctx, mClient, "command_upgrade", 1)
@@ -136,33 +84,88 @@ func (c *Command) Run(ctx context.Context, args []string) error {
 	if err := c.Flags().Parse(args); err != nil {
 		return fmt.Errorf("failed to parse flags: %w", err)
 	}
+	ctx = c.flags.WithLogger(ctx, c.Stderr())
 
 	absLocation, err := filepath.Abs(c.flags.Location)
 	if err != nil {
 		return fmt.Errorf("filepath.Abs(%q): %w", c.flags.Location, err)
 	}
 
+	fs := &common.RealFS{}
+	var signer crypto.Signer
+	if c.flags.ManifestSigningKey != "" {
+		if signer, err = signing.LoadSigner(fs, c.flags.ManifestSigningKey); err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+	var verifyKey crypto.PublicKey
+	if c.flags.ManifestVerifyKey != "" {
+		if verifyKey, err = signing.LoadPublicKey(fs, c.flags.ManifestVerifyKey); err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+
+	var channelPolicy *config.UpgradeChannelPolicy
+	if !c.flags.IgnoreUpgradeChannelPolicy {
+		cfg, err := config.LoadForDir(absLocation)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		channelPolicy = cfg.UpgradeChannelPolicy
+	}
+
+	fallbackMirrors, err := parseFallbackMirrors(c.flags.FallbackMirrors)
+	if err != nil {
+		return err
+	}
+
+	var auditLog auditlog.Sink
+	if c.flags.AuditLog != "" {
+		if auditLog, err = auditlog.Open(c.flags.AuditLog); err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+
 	result := upgrade.UpgradeAll(ctx, &upgrade.Params{
 		AcceptDefaults:       c.flags.AcceptDefaults,
+		AllowBufGenerate:     c.flags.AllowBufGenerate,
 		AlreadyResolved:      c.flags.AlreadyResolved,
+		AuditLog:             auditLog,
 		Clock:                clock.New(),
+		DebugReportDir:       c.flags.DebugReport,
 		DebugStepDiffs:       c.flags.DebugStepDiffs,
 		DebugScratchContents: c.flags.DebugScratchContents,
 		ContinueIfCurrent:    c.flags.ContinueIfCurrent,
-		FS:                   &common.RealFS{},
+		FallbackMirrors:      fallbackMirrors,
+		FollowReplacement:    c.flags.FollowReplacement,
+		FS:                   fs,
 		GitProtocol:          c.flags.GitProtocol,
+		SkipGitSubmodules:    c.flags.SkipGitSubmodules,
+		IgnoreIndex:          c.flags.IgnoreIndex,
 		InputFiles:           c.flags.InputFiles,
 		InputsFromFlags:      c.flags.Inputs,
 		KeepTempDirs:         c.flags.KeepTempDirs,
+		LockWait:             c.flags.Wait,
 		Location:             absLocation,
 		ManifestFilter:       c.flags.ManifestFilter,
+		ManifestSigner:       signer,
+		ManifestVerifyKey:    verifyKey,
+		MaxFileBytes:         c.flags.MaxFileBytes,
+		MaxOutputBytes:       c.flags.MaxOutputBytes,
+		MaxOutputFiles:       c.flags.MaxOutputFiles,
+		PolicyFiles:          c.flags.PolicyFiles,
 		Prompt:               c.flags.Prompt,
 		Prompter:             c,
+		ReuseInputFiles:      c.flags.ReuseInputFiles,
 		SkipInputValidation:  c.flags.SkipInputValidation,
 		SkipPromptTTYCheck:   c.skipPromptTTYCheck,
+		SkipUnavailable:      c.flags.SkipUnavailable,
 		Stdout:               c.Stdout(),
+		SuppressPrint:        c.flags.Quiet,
 		TemplateLocation:     c.flags.TemplateLocation,
+		TemplateLocations:    c.flags.Relocate,
 		UpgradeChannel:       c.flags.UpgradeChannel,
+		UpgradeChannelPolicy: channelPolicy,
 		Version:              c.flags.Version,
 	})
 	if result.Err != nil {
@@ -173,10 +176,24 @@ func (c *Command) Run(ctx context.Context, args []string) error {
 		return result.Err
 	}
 
+	pal := newPalette(shouldUseColor(c.Stdout(), c.GetEnv))
+	// With more than one manifest in verbose mode, each manifest's output is
+	// grouped under a heading, so it's clear which manifest it's about.
+	grouped := c.flags.Verbose && len(result.Results) > 1
 	for i, oneManifestResult := range result.Results {
+		if grouped {
+			fmt.Fprintln(c.Stdout(), pal.heading(fmt.Sprintf("== %s ==",
+				filepath.Join(absLocation, oneManifestResult.ManifestPath))))
+		}
+		if c.flags.Explain {
+			fmt.Fprintln(c.Stdout(), explainResult(oneManifestResult, absLocation, pal))
+		}
 		isLast := i == len(result.Results)-1
 		if isPrintable(c.flags.Verbose, isLast, oneManifestResult.Type) {
-			fmt.Fprintln(c.Stdout(), summarizeResult(oneManifestResult, absLocation))
+			fmt.Fprintln(c.Stdout(), summarizeResult(ctx, oneManifestResult, absLocation, pal))
+		}
+		if grouped && !isLast {
+			fmt.Fprintln(c.Stdout())
 		}
 	}
 
@@ -189,7 +206,7 @@ func (c *Command) Run(ctx context.Context, args []string) error {
 }
 
 func isPrintable(verboseFlag, isLast bool, rt upgrade.ResultType) bool {
-	if verboseFlag {
+	if verboseFlag || rt == upgrade.SourceUnavailable {
 		return true
 	}
 	if !isLast {
@@ -205,14 +222,86 @@ func exitCode(overallResult upgrade.ResultType) int {
 	case upgrade.AlreadyUpToDate, upgrade.Success:
 		return 0
 	case upgrade.MergeConflict:
-		return 1
+		return common.ExitCodeMergeConflict
 	case upgrade.PatchReversalConflict:
-		return 2
+		return common.ExitCodePatchReversalConflict
+	case upgrade.SourceUnavailable:
+		return common.ExitCodeDownload
 	}
 	panic("unreachable") // the go lint exhaustive check prevents this
 }
 
-func summarizeResult(r *upgrade.ManifestResult, location string) string {
+// parseFallbackMirrors converts the --fallback-mirror flags to mirrors,
+// validating them like the mirrors in the config files.
+func parseFallbackMirrors(m map[string]string) (config.Mirrors, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	lines := make([]string, 0, len(m))
+	for from, to := range m {
+		lines = append(lines, from+"="+to)
+	}
+	mirrors, err := config.ParseMirrors(strings.Join(lines, "\n"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid --fallback-mirror: %w", err)
+	}
+	return mirrors, nil
+}
+
+// explainResult describes, for every file in the given template installation,
+// what the merge algorithm decided and what it based that decision on.
+func explainResult(r *upgrade.ManifestResult, location string, pal *palette) string {
+	var out strings.Builder
+	fmt.Fprint(&out, pal.heading(fmt.Sprintf("Merge decisions for manifest %s:", filepath.Join(location, r.ManifestPath))))
+	if r.Type == upgrade.AlreadyUpToDate {
+		fmt.Fprintf(&out, "\n  already up to date, no files were compared\n")
+		return out.String()
+	}
+	if r.Type == upgrade.SourceUnavailable {
+		fmt.Fprintf(&out, "\n  the template source is unavailable, no files were compared\n")
+		return out.String()
+	}
+
+	actions := make([]upgrade.ActionTaken, 0, len(r.MergeConflicts)+len(r.NonConflicts))
+	actions = append(actions, r.MergeConflicts...)
+	actions = append(actions, r.NonConflicts...)
+	sort.Slice(actions, func(i, j int) bool {
+		return actions[i].Path < actions[j].Path
+	})
+
+	for _, a := range actions {
+		fmt.Fprintf(&out, "\n  %s: %s\n", a.Path, pal.action(a.Action))
+		fmt.Fprintf(&out, "    why: %s\n", a.Explanation)
+		if e := a.Evidence; e != nil {
+			fmt.Fprintf(&out, "    in old manifest: %s, in new manifest: %s\n", yesNo(e.InOldManifest), yesNo(e.InNewManifest))
+			if e.IncludedFromDestination {
+				fmt.Fprintf(&out, "    included from the destination directory\n")
+			}
+			if e.DeletedByHook {
+				fmt.Fprintf(&out, "    discarded by a pre_upgrade hook\n")
+			}
+			if e.LocalVsOldHash != "" {
+				fmt.Fprintf(&out, "    your file vs. old manifest hash: %s\n", e.LocalVsOldHash)
+			}
+			if e.NewTemplateVsOldHash != "" {
+				fmt.Fprintf(&out, "    new template output vs. old manifest hash: %s\n", e.NewTemplateVsOldHash)
+			}
+			if e.LocalVsNewHash != "" {
+				fmt.Fprintf(&out, "    your file vs. new manifest hash: %s\n", e.LocalVsNewHash)
+			}
+		}
+	}
+	return out.String()
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func summarizeResult(ctx context.Context, r *upgrade.ManifestResult, location string, pal *palette) string {
 	// You might wonder: why are the merge instructions printed here, *inside*
 	// the loop that loops over manifests? Won't that result in a large block of
 	// instructions being printed multiple times? No, because there's at most
@@ -222,26 +311,32 @@ func summarizeResult(r *upgrade.ManifestResult, location string) string {
 	switch r.Type {
 	case upgrade.AlreadyUpToDate:
 		// TODO(upgrade): show version
-		return "Already up to date with latest template version"
+		return pal.good("Already up to date with latest template version")
 	case upgrade.Success:
 		// TODO(upgrade): show version upgraded to
-		return "Upgrade complete with no conflicts"
+		return pal.good("Upgrade complete with no conflicts")
 	case upgrade.MergeConflict:
-		// TODO(upgrade):
-		//  - suggest diff / meld / vim commands?
 		var out strings.Builder
-		fmt.Fprintf(&out, "When upgrading manifest %s:\n", manifestPath)
+		fmt.Fprintf(&out, "%s\n", pal.heading(fmt.Sprintf("When upgrading manifest %s:", manifestPath)))
 
-		fmt.Fprintf(&out, mergeInstructions+"\n\nList of conflicting files:\n--")
-		for _, cf := range r.MergeConflicts {
+		fmt.Fprint(&out, messages.Get(ctx, messages.UpgradeMergeInstructions, nil)+"\n\nList of conflicting files:\n--")
+		dir := installedDir(r, location)
+		for i := range r.MergeConflicts {
+			cf := &r.MergeConflicts[i]
 			fmt.Fprintf(&out, "\nfile: %s\n", cf.Path)
-			fmt.Fprintf(&out, "conflict type: %s\n", cf.Action)
+			fmt.Fprintf(&out, "conflict type: %s\n", pal.action(cf.Action))
 			if cf.OursPath != "" {
 				fmt.Fprintf(&out, "your file was renamed to: %s\n", cf.OursPath)
 			}
 			if cf.IncomingTemplatePath != "" {
 				fmt.Fprintf(&out, "incoming file: %s\n", cf.IncomingTemplatePath)
 			}
+			if res := resolutions(dir, cf); len(res) > 0 {
+				fmt.Fprintf(&out, "to resolve:\n")
+				for _, rs := range res {
+					fmt.Fprintf(&out, "  %s  %s\n", pal.command(rs.cmd), pal.faint("# "+rs.desc))
+				}
+			}
 			fmt.Fprintf(&out, "--")
 		}
 		fmt.Fprintf(&out, `
@@ -251,10 +346,23 @@ upgrade any other rendered templates in this location that may still need
 upgrading.`)
 
 		return out.String()
+	case upgrade.SourceUnavailable:
+		var out strings.Builder
+		fmt.Fprintf(&out, "%s\n", pal.heading(fmt.Sprintf("When upgrading manifest %s:", manifestPath)))
+		fmt.Fprintf(&out, "%s\n\n", r.SourceUnavailable)
+		fmt.Fprintf(&out, `The template was not changed. If the template moved, upgrade from its new
+location with:
+
+  %s
+
+or, if a mirror still has it, retry with --fallback-mirror=<from>=<to>. To keep
+upgrading the other templates in the meantime, use --skip-unavailable.`,
+			pal.command(fmt.Sprintf("--relocate=%s=<new_location>", r.ManifestPath)))
+		return out.String()
 	case upgrade.PatchReversalConflict:
 		var out strings.Builder
-		fmt.Fprintf(&out, "When upgrading manifest %s:\n", manifestPath)
-		fmt.Fprint(&out, patchReversalInstructions+"\n\n--")
+		fmt.Fprintf(&out, "%s\n", pal.heading(fmt.Sprintf("When upgrading manifest %s:", manifestPath)))
+		fmt.Fprint(&out, messages.Get(ctx, messages.UpgradePatchReversalInstructions, nil)+"\n\n--")
 		relPaths := make([]string, 0, len(r.ReversalConflicts))
 		for _, rc := range r.ReversalConflicts {
 			fmt.Fprintf(&out, "\nyour file: %s\n", rc.AbsPath)
@@ -277,8 +385,8 @@ upgrading.`)
 After manually applying the rejected hunks, re-run the upgrade command with
 these flags:
 
-  --already-resolved=%s%s`,
-			strings.Join(relPaths, ","), resumeFrom)
+  %s`,
+			pal.command(fmt.Sprintf("--already-resolved=%s%s", strings.Join(relPaths, ","), resumeFrom)))
 		return out.String()
 	}
 	panic("unreachable") // the go lint exhaustive check prevents this
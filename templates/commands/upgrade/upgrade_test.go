@@ -28,6 +28,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/messages"
 	"github.com/abcxyz/abc/templates/common/render"
 	"github.com/abcxyz/abc/templates/common/templatesource"
 	"github.com/abcxyz/abc/templates/common/upgrade"
@@ -112,20 +113,28 @@ steps:
 				abctestutil.OverwriteJoin(tb, installedDir, "greet.txt", "hello, mars\n")
 				abctestutil.OverwriteJoin(tb, installedDir, "color.txt", "red\n")
 			},
-			wantExitCode: 1,
+			wantExitCode: common.ExitCodeMergeConflict,
 			wantErr:      []string{"exit code 1"},
 			wantStdout: `When upgrading manifest TEMPDIR/dest_dir/.abc/manifest_.._template_dir_1970-01-01T00:00:00Z.lock.yaml:
-` + mergeInstructions + `
+` + messages.Default(messages.UpgradeMergeInstructions) + `
 
 List of conflicting files:
 --
 file: color.txt
 conflict type: addAddConflict
-incoming file: color.txt.abcmerge_from_new_template
+incoming file: color.abcmerge_from_new_template.txt
+to resolve:
+  diff TEMPDIR/dest_dir/color.txt TEMPDIR/dest_dir/color.abcmerge_from_new_template.txt  # compare
+  rm TEMPDIR/dest_dir/color.abcmerge_from_new_template.txt  # keep your version
+  mv TEMPDIR/dest_dir/color.abcmerge_from_new_template.txt TEMPDIR/dest_dir/color.txt  # take the new template version
 --
 file: greet.txt
 conflict type: editEditConflict
-incoming file: greet.txt.abcmerge_from_new_template
+incoming file: greet.abcmerge_from_new_template.txt
+to resolve:
+  diff TEMPDIR/dest_dir/greet.txt TEMPDIR/dest_dir/greet.abcmerge_from_new_template.txt  # compare
+  rm TEMPDIR/dest_dir/greet.abcmerge_from_new_template.txt  # keep your version
+  mv TEMPDIR/dest_dir/greet.abcmerge_from_new_template.txt TEMPDIR/dest_dir/greet.txt  # take the new template version
 --
 
 After manually resolving the merge conflict, re-run the upgrade command to
@@ -182,9 +191,9 @@ steps:
         - to_replace: "b"
           with: "Z"`,
 			},
-			wantExitCode: 2,
+			wantExitCode: common.ExitCodePatchReversalConflict,
 			wantStdout: `When upgrading manifest TEMPDIR/dest_dir/.abc/manifest_.._template_dir_1970-01-01T00:00:00Z.lock.yaml:
-` + patchReversalInstructions + `
+` + messages.Default(messages.UpgradePatchReversalInstructions) + `
 
 --
 your file: TEMPDIR/dest_dir/hello.txt
@@ -527,6 +536,27 @@ func TestSummarizeResult(t *testing.T) {
 			},
 			wantMessage: "Already up to date with latest template version",
 		},
+		{
+			name: "source_unavailable",
+			result: &upgrade.ManifestResult{
+				Type:         upgrade.SourceUnavailable,
+				ManifestPath: "foo/.abc/my_manifest.yaml",
+				SourceUnavailable: &templatesource.SourceUnavailableError{
+					Source: "github.com/foo/bar",
+					Err:    errors.New("repository not found"),
+				},
+			},
+			wantMessage: `When upgrading manifest my-location/foo/.abc/my_manifest.yaml:
+the template github.com/foo/bar is no longer available: repository not found
+
+The template was not changed. If the template moved, upgrade from its new
+location with:
+
+  --relocate=foo/.abc/my_manifest.yaml=<new_location>
+
+or, if a mirror still has it, retry with --fallback-mirror=<from>=<to>. To keep
+upgrading the other templates in the meantime, use --skip-unavailable.`,
+		},
 		{
 			name: "conflicts",
 			result: &upgrade.ManifestResult{
@@ -549,17 +579,24 @@ func TestSummarizeResult(t *testing.T) {
 				NonConflicts: []upgrade.ActionTaken{{Path: "should_not_appear.txt", Action: upgrade.WriteNew}},
 			},
 			wantMessage: `When upgrading manifest my-location/foo/bar/my_manifest.yaml:
-` + mergeInstructions + `
+` + messages.Default(messages.UpgradeMergeInstructions) + `
 
 List of conflicting files:
 --
 file: some/file.txt
 conflict type: editEditConflict
 incoming file: some/file.txt.abcmerge_from_new_template
+to resolve:
+  diff my-location/foo/some/file.txt my-location/foo/some/file.txt.abcmerge_from_new_template  # compare
+  rm my-location/foo/some/file.txt.abcmerge_from_new_template  # keep your version
+  mv my-location/foo/some/file.txt.abcmerge_from_new_template my-location/foo/some/file.txt  # take the new template version
 --
 file: some/other/file.txt
 conflict type: deleteEditConflict
 incoming file: some/other/file.txt.abcmerge_locally_deleted_vs_new_template_version
+to resolve:
+  mv my-location/foo/some/other/file.txt.abcmerge_locally_deleted_vs_new_template_version my-location/foo/some/other/file.txt  # take the new template version
+  rm my-location/foo/some/other/file.txt.abcmerge_locally_deleted_vs_new_template_version  # keep the file deleted
 --
 
 After manually resolving the merge conflict, re-run the upgrade command to
@@ -585,7 +622,7 @@ upgrading.`,
 				},
 			},
 			wantMessage: `When upgrading manifest my-location/foo/bar/my_manifest.yaml:
-` + patchReversalInstructions + `
+` + messages.Default(messages.UpgradePatchReversalInstructions) + `
 
 --
 your file: /my/template/output/dir/some/path.txt
@@ -620,7 +657,7 @@ these flags:
 				},
 			},
 			wantMessage: `When upgrading manifest my-location/foo/bar/my_manifest.yaml:
-` + patchReversalInstructions + `
+` + messages.Default(messages.UpgradePatchReversalInstructions) + `
 
 --
 your file: /my/template/output/dir/some/?!@#$%^&*()[]{}.txt
@@ -642,7 +679,103 @@ these flags:
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
 
-			message := summarizeResult(tc.result, location)
+			message := summarizeResult(context.Background(), tc.result, location, newPalette(false))
+			if diff := cmp.Diff(message, tc.wantMessage); diff != "" {
+				t.Errorf("message was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestExplainResult(t *testing.T) {
+	t.Parallel()
+
+	const location = "my-location"
+
+	cases := []struct {
+		name        string
+		result      *upgrade.ManifestResult
+		wantMessage string
+	}{
+		{
+			name: "already_up_to_date",
+			result: &upgrade.ManifestResult{
+				Type:         upgrade.AlreadyUpToDate,
+				ManifestPath: "foo/.abc/manifest.yaml",
+			},
+			wantMessage: `Merge decisions for manifest my-location/foo/.abc/manifest.yaml:
+  already up to date, no files were compared
+`,
+		},
+		{
+			name: "conflicts_and_non_conflicts_sorted_by_path",
+			result: &upgrade.ManifestResult{
+				Type:         upgrade.MergeConflict,
+				ManifestPath: "foo/.abc/manifest.yaml",
+				MergeConflicts: []upgrade.ActionTaken{
+					{
+						Action:      upgrade.EditEditConflict,
+						Explanation: "this file was modified by the user, and the template wants to update it, so manual conflict resolution is required",
+						Path:        "b.txt",
+						Evidence: &upgrade.MergeEvidence{
+							InOldManifest:        true,
+							InNewManifest:        true,
+							LocalVsOldHash:       "mismatch",
+							NewTemplateVsOldHash: "mismatch",
+							LocalVsNewHash:       "mismatch",
+						},
+					},
+				},
+				NonConflicts: []upgrade.ActionTaken{
+					{
+						Action:      upgrade.WriteNew,
+						Explanation: "the new template version added this file, which wasn't in the old template version",
+						Path:        "a.txt",
+						Evidence: &upgrade.MergeEvidence{
+							InNewManifest:  true,
+							LocalVsNewHash: "absent",
+						},
+					},
+					{
+						Action:      upgrade.DeleteAction,
+						Explanation: "this file was output by the old template but is no longer output by the new template, and there were no local edits",
+						Path:        "c.txt",
+						Evidence: &upgrade.MergeEvidence{
+							InOldManifest:           true,
+							IncludedFromDestination: true,
+							LocalVsOldHash:          "mismatch",
+						},
+					},
+				},
+			},
+			wantMessage: `Merge decisions for manifest my-location/foo/.abc/manifest.yaml:
+  a.txt: writeNew
+    why: the new template version added this file, which wasn't in the old template version
+    in old manifest: no, in new manifest: yes
+    your file vs. new manifest hash: absent
+
+  b.txt: editEditConflict
+    why: this file was modified by the user, and the template wants to update it, so manual conflict resolution is required
+    in old manifest: yes, in new manifest: yes
+    your file vs. old manifest hash: mismatch
+    new template output vs. old manifest hash: mismatch
+    your file vs. new manifest hash: mismatch
+
+  c.txt: delete
+    why: this file was output by the old template but is no longer output by the new template, and there were no local edits
+    in old manifest: yes, in new manifest: no
+    included from the destination directory
+    your file vs. old manifest hash: mismatch
+`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			message := explainResult(tc.result, location, newPalette(false))
 			if diff := cmp.Diff(message, tc.wantMessage); diff != "" {
 				t.Errorf("message was not as expected (-got,+want): %s", diff)
 			}
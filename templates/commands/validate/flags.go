@@ -0,0 +1,84 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common/flags"
+	"github.com/abcxyz/pkg/cli"
+)
+
+// ValidateFlags describes what template to validate and how.
+type ValidateFlags struct {
+	// See common/flags.LogFlags.
+	flags.LogFlags
+
+	// Source is the location of the template to validate.
+	//
+	// Example: github.com/abcxyz/abc/t/rest_server@latest
+	Source string
+
+	// GitProtocol either https or ssh.
+	GitProtocol string
+
+	// RenderCheck also renders the template into a throwaway directory, once
+	// for each golden test or else once with the default inputs.
+	RenderCheck bool
+
+	// See common/flags.Inputs(). Only used with --render-check.
+	Inputs map[string]string
+
+	// See common/flags.InputFiles(). Only used with --render-check.
+	InputFiles []string
+
+	// See common/flags.Strict().
+	Strict bool
+}
+
+func (r *ValidateFlags) Register(set *cli.FlagSet) {
+	g := flags.NewSection(set, "GIT OPTIONS")
+	g.StringVar(flags.GitProtocol(&r.GitProtocol))
+
+	rc := flags.NewSection(set, "RENDER CHECK OPTIONS")
+	rc.BoolVar(&cli.BoolVar{
+		Name:    "render-check",
+		Target:  &r.RenderCheck,
+		Default: false,
+		Usage: "Also execute all the template's steps, discarding the output, " +
+			"using the inputs of each golden test, or the default inputs if " +
+			"there are no golden tests or --input or --input-file is given.",
+	})
+	rc.StringMapVar(flags.Inputs(&r.Inputs))
+	rc.StringSliceVar(flags.InputFiles(&r.InputFiles))
+
+	v := flags.NewSection(set, "VALIDATE OPTIONS")
+	v.BoolVar(flags.Strict(&r.Strict))
+
+	r.LogFlags.Register(set)
+
+	// Default source to the first CLI argument, if given
+	set.AfterParse(func(existingErr error) error {
+		r.Source = strings.TrimSpace(set.Arg(0))
+		if r.Source == "" {
+			return fmt.Errorf("missing <source> file")
+		}
+		if !r.RenderCheck && (len(r.Inputs) > 0 || len(r.InputFiles) > 0) {
+			return fmt.Errorf("--input and --input-file can only be used with --render-check")
+		}
+		return nil
+	})
+}
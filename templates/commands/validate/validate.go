@@ -0,0 +1,318 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package validate implements the "templates validate" subcommand.
+package validate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/benbjohnson/clock"
+	"github.com/posener/complete/v2"
+
+	"github.com/abcxyz/abc-updater/pkg/metrics"
+	"github.com/abcxyz/abc/internal/metricswrap"
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/completion"
+	"github.com/abcxyz/abc/templates/common/registry"
+	"github.com/abcxyz/abc/templates/common/render"
+	"github.com/abcxyz/abc/templates/common/specutil"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/abc/templates/common/warnings"
+	"github.com/abcxyz/abc/templates/model/decode"
+	"github.com/abcxyz/abc/templates/model/goldentest/v1beta7"
+	"github.com/abcxyz/pkg/cli"
+)
+
+const (
+	// goldenTestDir is where golden tests live, relative to the template root.
+	goldenTestDir = "testdata/golden"
+
+	// testConfigName is the name of a golden test's config file. Upgrade tests
+	// use a different file name, and aren't render-checked.
+	testConfigName = "test.yaml"
+
+	// defaultsCaseName is the name of the render check that uses the inputs
+	// from the flags plus the input defaults.
+	defaultsCaseName = "(defaults)"
+)
+
+type Command struct {
+	cli.BaseCommand
+	flags ValidateFlags
+
+	testFS common.FS
+}
+
+// Desc implements cli.Command.
+func (c *Command) Desc() string {
+	return "check that a template is valid, and optionally that it renders"
+}
+
+func (c *Command) Help() string {
+	return `
+Usage: {{ COMMAND }} [options] <source>
+
+The {{ COMMAND }} command checks that the given template's spec file is valid.
+It's meant as a cheap smoke test to run in the CI of template repos.
+
+The "<source>" is the location of the template, in any of the forms accepted by
+"abc render", such as a local directory or a remote repo with an @version.
+
+With --render-check, all the template's steps are also executed into a
+throwaway directory, and the output is discarded. The template is rendered once
+for each golden test under testdata/golden, using that test's inputs and
+builtin_vars. Tests that expect an error must fail with that error. If there are
+no golden tests, or if --input or --input-file is given, the template is also
+rendered with those inputs plus the input defaults. Unlike "abc golden-test
+verify", the rendered output isn't compared against anything.
+`
+}
+
+func (c *Command) Flags() *cli.FlagSet {
+	set := c.NewFlagSet()
+	c.flags.Register(set)
+	return set
+}
+
+func (c *Command) PredictArgs() complete.Predictor {
+	return completion.Sources()
+}
+
+type runParams struct {
+	fs     common.FS
+	stdout io.Writer
+}
+
+func (c *Command) Run(ctx context.Context, args []string) (rErr error) {
+	mClient := metrics.FromContext(ctx)
+	cleanup := metricswrap.WriteMetric(ctx, mClient, "command_validate", 1)
+	defer cleanup()
+
+	if err := c.Flags().Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	ctx = c.flags.WithLogger(ctx, c.Stderr())
+	warns := &warnings.Collector{}
+	ctx = warnings.WithCollector(ctx, warns)
+	defer func() { rErr = errors.Join(rErr, warns.Report(c.Stderr(), c.flags.Strict)) }()
+	fSys := c.testFS
+	if fSys == nil {
+		fSys = &common.RealFS{}
+	}
+	return c.realRun(ctx, &runParams{
+		fs:     fSys,
+		stdout: c.Stdout(),
+	})
+}
+
+// realRun provides a fakeable interface to test Run.
+func (c *Command) realRun(ctx context.Context, rp *runParams) (rErr error) {
+	tempTracker := tempdir.NewDirTracker(rp.fs, false)
+	defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("os.Getwd(): %w", err)
+	}
+
+	templateDir, err := tempTracker.MkdirTempTracked("", tempdir.TemplateDirNamePart)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	source, err := registry.ResolveSource(cwd, c.flags.Source)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	downloader, err := templatesource.ParseSource(ctx, &templatesource.ParseSourceParams{
+		CWD:             cwd,
+		Source:          source,
+		FlagGitProtocol: c.flags.GitProtocol,
+	})
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	dlMeta, err := downloader.Download(ctx, cwd, templateDir, "")
+	if err != nil {
+		return fmt.Errorf("failed to download/copy template: %w", err)
+	}
+
+	if _, err := specutil.Load(ctx, rp.fs, templateDir, c.flags.Source); err != nil {
+		return err //nolint:wrapcheck
+	}
+	fmt.Fprintf(rp.stdout, "spec is valid\n")
+
+	if !c.flags.RenderCheck {
+		return nil
+	}
+
+	cases, err := c.renderCases(ctx, templateDir)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, rc := range cases {
+		err := c.renderCheck(ctx, &renderCheckParams{
+			cwd:         cwd,
+			dlMeta:      dlMeta,
+			fs:          rp.fs,
+			rc:          rc,
+			templateDir: templateDir,
+			tempTracker: tempTracker,
+		})
+		if err != nil {
+			failed++
+			fmt.Fprintf(rp.stdout, "render check %s: FAILED: %v\n", rc.name, err)
+			continue
+		}
+		fmt.Fprintf(rp.stdout, "render check %s: ok\n", rc.name)
+	}
+	if failed > 0 {
+		return fmt.Errorf("render check failed for %d of %d cases", failed, len(cases))
+	}
+	return nil
+}
+
+// renderCase is one way of rendering the template for --render-check.
+type renderCase struct {
+	name string
+
+	// inputs and builtins are given to the render as InputsFromFlags and
+	// OverrideBuiltinVars.
+	inputs   map[string]string
+	builtins map[string]string
+
+	// inputFiles are given to the render as InputFiles.
+	inputFiles []string
+
+	// If non-empty, the render must fail with an error containing this.
+	wantErrContains string
+}
+
+// renderCases returns the renders to do for --render-check: one per golden
+// test, and one with the inputs from the flags if any were given or if there
+// are no golden tests.
+func (c *Command) renderCases(ctx context.Context, templateDir string) ([]*renderCase, error) {
+	configPaths, err := filepath.Glob(filepath.Join(templateDir, goldenTestDir, "*", testConfigName))
+	if err != nil {
+		return nil, fmt.Errorf("failed finding golden tests: %w", err)
+	}
+	sort.Strings(configPaths)
+
+	var out []*renderCase
+	if len(configPaths) == 0 || len(c.flags.Inputs) > 0 || len(c.flags.InputFiles) > 0 {
+		out = append(out, &renderCase{
+			name:       defaultsCaseName,
+			inputs:     c.flags.Inputs,
+			inputFiles: c.flags.InputFiles,
+		})
+	}
+	for _, configPath := range configPaths {
+		test, err := loadTestConfig(ctx, configPath)
+		if err != nil {
+			return nil, err
+		}
+		rc := &renderCase{
+			name:     filepath.Base(filepath.Dir(configPath)),
+			inputs:   varValuesToMap(test.Inputs),
+			builtins: varValuesToMap(test.BuiltinVars),
+		}
+		if test.Expect != nil {
+			rc.wantErrContains = test.Expect.ErrorContains.Val
+		}
+		out = append(out, rc)
+	}
+	return out, nil
+}
+
+type renderCheckParams struct {
+	cwd         string
+	dlMeta      *templatesource.DownloadMetadata
+	fs          common.FS
+	rc          *renderCase
+	templateDir string
+	tempTracker *tempdir.DirTracker
+}
+
+// renderCheck renders the template into a throwaway directory for one render
+// case, and returns an error if the outcome isn't what the case expects.
+func (c *Command) renderCheck(ctx context.Context, p *renderCheckParams) error {
+	outDir, err := p.tempTracker.MkdirTempTracked("", tempdir.RenderCheckDirNamePart)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	_, renderErr := render.RenderAlreadyDownloaded(ctx, p.dlMeta, p.templateDir, &render.Params{
+		AcceptDefaults:      true,
+		Clock:               clock.New(),
+		Cwd:                 p.cwd,
+		FS:                  p.fs,
+		GitProtocol:         c.flags.GitProtocol,
+		InputFiles:          p.rc.inputFiles,
+		InputsFromFlags:     p.rc.inputs,
+		OutDir:              outDir,
+		OverrideBuiltinVars: p.rc.builtins,
+		SkipManifest:        true,
+		SourceForMessages:   c.flags.Source,
+		Stdout:              io.Discard,
+	})
+
+	want := p.rc.wantErrContains
+	if want == "" {
+		return renderErr
+	}
+	if renderErr == nil {
+		return fmt.Errorf("expected rendering to fail with an error containing %q, but it succeeded", want)
+	}
+	if !strings.Contains(renderErr.Error(), want) {
+		return fmt.Errorf("expected rendering to fail with an error containing %q, but got a different error: %w", want, renderErr)
+	}
+	return nil
+}
+
+// loadTestConfig reads and validates a golden test's test.yaml.
+func loadTestConfig(ctx context.Context, path string) (*goldentest.Test, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening test config (%s): %w", path, err)
+	}
+	defer f.Close()
+
+	testI, _, err := decode.DecodeValidateUpgrade(ctx, f, path, decode.KindGoldenTest)
+	if err != nil {
+		return nil, fmt.Errorf("error reading golden test config file: %w", err)
+	}
+	out, ok := testI.(*goldentest.Test)
+	if !ok {
+		return nil, common.InternalErrorf("expected golden test config to be of type *goldentest.Test but got %T", testI)
+	}
+	return out, nil
+}
+
+func varValuesToMap(vvs []*goldentest.VarValue) map[string]string {
+	out := make(map[string]string, len(vvs))
+	for _, vv := range vvs {
+		out[vv.Name.Val] = vv.Value.Val
+	}
+	return out
+}
@@ -0,0 +1,297 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/flags"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestValidateFlags_Parse(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		args    []string
+		want    ValidateFlags
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			args: []string{
+				"helloworld@v1",
+			},
+			want: ValidateFlags{
+				LogFlags: flags.LogFlags{
+					LogFormat: "text",
+					LogLevel:  "warning",
+				},
+				Source:      "helloworld@v1",
+				GitProtocol: "https",
+				Inputs:      map[string]string{},
+			},
+		},
+		{
+			name: "render_check_with_inputs",
+			args: []string{
+				"--render-check",
+				"--input", "foo=bar",
+				"--input-file", "inputs.yaml",
+				"helloworld@v1",
+			},
+			want: ValidateFlags{
+				LogFlags: flags.LogFlags{
+					LogFormat: "text",
+					LogLevel:  "warning",
+				},
+				Source:      "helloworld@v1",
+				GitProtocol: "https",
+				RenderCheck: true,
+				Inputs:      map[string]string{"foo": "bar"},
+				InputFiles:  []string{"inputs.yaml"},
+			},
+		},
+		{
+			name: "strict",
+			args: []string{
+				"--strict",
+				"helloworld@v1",
+			},
+			want: ValidateFlags{
+				LogFlags: flags.LogFlags{
+					LogFormat: "text",
+					LogLevel:  "warning",
+				},
+				Source:      "helloworld@v1",
+				GitProtocol: "https",
+				Inputs:      map[string]string{},
+				Strict:      true,
+			},
+		},
+		{
+			name: "inputs_without_render_check",
+			args: []string{
+				"--input", "foo=bar",
+				"helloworld@v1",
+			},
+			wantErr: "--input and --input-file can only be used with --render-check",
+		},
+		{
+			name:    "required_source_is_missing",
+			args:    []string{},
+			wantErr: "missing <source> file",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var cmd Command
+			cmd.SetLookupEnv(cli.MapLookuper(nil))
+
+			err := cmd.Flags().Parse(tc.args)
+			if err != nil || tc.wantErr != "" {
+				if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+					t.Fatal(diff)
+				}
+				return
+			}
+			if diff := cmp.Diff(cmd.flags, tc.want); diff != "" {
+				t.Errorf("got %#v, want %#v, diff (-got, +want): %v", cmd.flags, tc.want, diff)
+			}
+		})
+	}
+}
+
+func TestRealRun(t *testing.T) {
+	t.Parallel()
+
+	specContents := `
+api_version: 'cli.abcxyz.dev/v1beta6'
+kind: 'Template'
+desc: 'Test Description'
+inputs:
+  - name: 'greeting'
+    desc: 'the greeting'
+    default: 'hello'
+  - name: 'service'
+    desc: 'the service name'
+    rules:
+      - rule: 'service != "forbidden"'
+steps:
+  - desc: 'Include the main file'
+    action: 'include'
+    params:
+      paths: ['main.go']
+  - desc: 'Fill in the greeting'
+    action: 'string_replace'
+    params:
+      paths: ['main.go']
+      replacements:
+        - to_replace: 'GREETING'
+          with: '{{.greeting}} {{.service}}'
+`
+	okTest := `
+api_version: 'cli.abcxyz.dev/v1beta6'
+kind: 'GoldenTest'
+inputs:
+  - name: 'service'
+    value: 'foo'
+`
+	negativeTest := `
+api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'GoldenTest'
+inputs:
+  - name: 'service'
+    value: 'forbidden'
+expect:
+  error_contains: 'service != "forbidden"'
+`
+
+	cases := []struct {
+		name             string
+		templateContents map[string]string
+		renderCheck      bool
+		inputs           map[string]string
+		wantStdout       string
+		wantErr          string
+	}{
+		{
+			name: "spec_only",
+			templateContents: map[string]string{
+				"spec.yaml": specContents,
+			},
+			wantStdout: "spec is valid\n",
+		},
+		{
+			name: "invalid_spec",
+			templateContents: map[string]string{
+				"spec.yaml": "invalid yaml",
+			},
+			wantErr: "error reading template spec file",
+		},
+		{
+			name: "render_check_golden_tests",
+			templateContents: map[string]string{
+				"spec.yaml":                                 specContents,
+				"main.go":                                   "GREETING",
+				"testdata/golden/ok/test.yaml":              okTest,
+				"testdata/golden/negative/test.yaml":        negativeTest,
+				"testdata/golden/upgrade/upgrade_test.yaml": "ignored",
+			},
+			renderCheck: true,
+			wantStdout: `spec is valid
+render check negative: ok
+render check ok: ok
+`,
+		},
+		{
+			name: "render_check_defaults_with_inputs",
+			templateContents: map[string]string{
+				"spec.yaml": specContents,
+				"main.go":   "GREETING",
+			},
+			renderCheck: true,
+			inputs:      map[string]string{"service": "foo"},
+			wantStdout: `spec is valid
+render check (defaults): ok
+`,
+		},
+		{
+			name: "render_check_defaults_missing_input",
+			templateContents: map[string]string{
+				"spec.yaml": specContents,
+				"main.go":   "GREETING",
+			},
+			renderCheck: true,
+			wantStdout: `spec is valid
+render check (defaults): FAILED: missing input(s): service, you may want to use one of the flags --prompt, --input, or --input-file
+`,
+			wantErr: "render check failed for 1 of 1 cases",
+		},
+		{
+			name: "render_check_step_fails",
+			templateContents: map[string]string{
+				"spec.yaml":                    specContents,
+				"testdata/golden/ok/test.yaml": okTest,
+			},
+			renderCheck: true,
+			wantErr:     "render check failed for 1 of 1 cases",
+		},
+		{
+			name: "render_check_negative_test_succeeds",
+			templateContents: map[string]string{
+				"spec.yaml": specContents,
+				"main.go":   "GREETING",
+				"testdata/golden/negative/test.yaml": strings.ReplaceAll(
+					negativeTest, "value: 'forbidden'", "value: 'allowed'"),
+			},
+			renderCheck: true,
+			wantStdout: `spec is valid
+render check negative: FAILED: expected rendering to fail with an error containing "service != \"forbidden\"", but it succeeded
+`,
+			wantErr: "render check failed for 1 of 1 cases",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			sourceDir := t.TempDir()
+			abctestutil.WriteAll(t, sourceDir, tc.templateContents)
+			stdoutBuf := &strings.Builder{}
+			r := &Command{
+				flags: ValidateFlags{
+					Source:      sourceDir,
+					RenderCheck: tc.renderCheck,
+					Inputs:      tc.inputs,
+				},
+			}
+
+			rp := &runParams{
+				stdout: stdoutBuf,
+				fs:     &common.RealFS{},
+			}
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			err := r.realRun(ctx, rp)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if tc.wantStdout == "" {
+				return
+			}
+			if diff := cmp.Diff(stdoutBuf.String(), tc.wantStdout); diff != "" {
+				t.Errorf("stdout was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
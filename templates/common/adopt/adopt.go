@@ -0,0 +1,221 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package adopt reads the answers files written by other scaffolding tools, so
+// that projects generated by them can be brought under abc's upgrade flow.
+package adopt
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// FormatCopier is the format of the .copier-answers.yml file written by
+	// copier.
+	FormatCopier = "copier"
+
+	// FormatCookiecutter is the format of cookiecutter's replay files, and of
+	// the .cruft.json file written by cruft.
+	FormatCookiecutter = "cookiecutter"
+)
+
+// Formats are the answers file formats that can be parsed.
+var Formats = []string{FormatCopier, FormatCookiecutter}
+
+// Answers is what another tool recorded about how it generated a project.
+type Answers struct {
+	// The template location, in the form that the other tool recorded it, like
+	// "gh:foo/bar" or "https://github.com/foo/bar.git". Empty if not recorded.
+	Source string
+
+	// The template version, like a git tag or SHA. Empty if not recorded.
+	Version string
+
+	// The answers to the template's questions. Values that aren't strings are
+	// converted to strings: booleans and numbers are formatted plainly, and
+	// lists and objects are JSON-encoded.
+	Inputs map[string]string
+}
+
+// Parse parses the contents of an answers file in the given format, which must
+// be one of Formats.
+func Parse(format string, buf []byte) (*Answers, error) {
+	switch format {
+	case FormatCopier:
+		return parseCopier(buf)
+	case FormatCookiecutter:
+		return parseCookiecutter(buf)
+	default:
+		return nil, fmt.Errorf("unknown answers file format %q, must be one of %v", format, Formats)
+	}
+}
+
+// parseCopier parses a .copier-answers.yml file. Keys beginning with
+// underscore are copier's own metadata rather than answers.
+func parseCopier(buf []byte) (*Answers, error) {
+	var raw map[string]any
+	if err := yaml.Unmarshal(buf, &raw); err != nil {
+		return nil, fmt.Errorf("failed parsing copier answers file as YAML: %w", err)
+	}
+
+	out := &Answers{Inputs: map[string]string{}}
+	for key, val := range raw {
+		if strings.HasPrefix(key, "_") {
+			continue
+		}
+		s, err := stringify(val)
+		if err != nil {
+			return nil, fmt.Errorf("answer %q: %w", key, err)
+		}
+		out.Inputs[key] = s
+	}
+
+	var err error
+	if out.Source, err = metadataString(raw, "_src_path"); err != nil {
+		return nil, err
+	}
+	if out.Version, err = metadataString(raw, "_commit"); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// parseCookiecutter parses either a cookiecutter replay file, which looks like
+// {"cookiecutter": {...}}, or a .cruft.json file, which looks like
+// {"template": "...", "commit": "...", "context": {"cookiecutter": {...}}}.
+// Keys in the "cookiecutter" object beginning with underscore are
+// cookiecutter's own settings rather than answers.
+func parseCookiecutter(buf []byte) (*Answers, error) {
+	var raw struct {
+		Template     string         `json:"template"`
+		Commit       string         `json:"commit"`
+		Cookiecutter map[string]any `json:"cookiecutter"`
+		Context      struct {
+			Cookiecutter map[string]any `json:"cookiecutter"`
+		} `json:"context"`
+	}
+	if err := json.Unmarshal(buf, &raw); err != nil {
+		return nil, fmt.Errorf("failed parsing cookiecutter answers file as JSON: %w", err)
+	}
+
+	vars := raw.Cookiecutter
+	if vars == nil {
+		vars = raw.Context.Cookiecutter
+	}
+	if vars == nil {
+		return nil, fmt.Errorf(`the cookiecutter answers file must have a "cookiecutter" object, either at the top level or under "context"`)
+	}
+
+	out := &Answers{
+		Source:  raw.Template,
+		Version: raw.Commit,
+		Inputs:  map[string]string{},
+	}
+	for key, val := range vars {
+		if strings.HasPrefix(key, "_") {
+			continue
+		}
+		s, err := stringify(val)
+		if err != nil {
+			return nil, fmt.Errorf("answer %q: %w", key, err)
+		}
+		out.Inputs[key] = s
+	}
+
+	var err error
+	if out.Source == "" {
+		if out.Source, err = metadataString(vars, "_template"); err != nil {
+			return nil, err
+		}
+	}
+	if out.Version == "" {
+		if out.Version, err = metadataString(vars, "_checkout"); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func metadataString(m map[string]any, key string) (string, error) {
+	val, ok := m[key]
+	if !ok || val == nil {
+		return "", nil
+	}
+	s, ok := val.(string)
+	if !ok {
+		return "", fmt.Errorf("%q must be a string, but was %T", key, val)
+	}
+	return s, nil
+}
+
+// stringify converts an answer to a template input value.
+func stringify(val any) (string, error) {
+	switch v := val.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		buf, err := json.Marshal(v)
+		if err != nil {
+			return "", fmt.Errorf("failed converting %T to JSON: %w", v, err)
+		}
+		return string(buf), nil
+	}
+}
+
+var (
+	// Like "gh:foo/bar" or "gl:foo/bar", which are copier and cookiecutter
+	// abbreviations.
+	abbreviatedRE = regexp.MustCompile(`^(gh|gl):([^/]+/[^/]+?)(\.git)?/?$`)
+
+	// Like "https://github.com/foo/bar.git" or "git+https://gitlab.com/foo/bar".
+	httpsRE = regexp.MustCompile(`^(?:git\+)?https://(github\.com|gitlab\.com)/([^/]+/[^/]+?)(\.git)?/?$`)
+
+	// Like "git@github.com:foo/bar.git".
+	sshRE = regexp.MustCompile(`^git@(github\.com|gitlab\.com):([^/]+/[^/]+?)(\.git)?/?$`)
+)
+
+// Location converts a template location recorded by another tool to an abc
+// template location without a version, like "github.com/foo/bar". It returns
+// false if the location isn't a GitHub or GitLab repo, e.g. because it's a
+// local directory.
+func Location(source string) (string, bool) {
+	if m := abbreviatedRE.FindStringSubmatch(source); m != nil {
+		host := "github.com"
+		if m[1] == "gl" {
+			host = "gitlab.com"
+		}
+		return host + "/" + m[2], true
+	}
+	if m := httpsRE.FindStringSubmatch(source); m != nil {
+		return m[1] + "/" + m[2], true
+	}
+	if m := sshRE.FindStringSubmatch(source); m != nil {
+		return m[1] + "/" + m[2], true
+	}
+	return "", false
+}
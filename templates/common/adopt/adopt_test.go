@@ -0,0 +1,184 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adopt
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		format  string
+		in      string
+		want    *Answers
+		wantErr string
+	}{
+		{
+			name:   "copier",
+			format: FormatCopier,
+			in: `# Changes here will be overwritten by Copier
+_commit: v1.2.3
+_src_path: gh:foo/bar
+project_name: my-project
+use_docker: true
+replicas: 3
+ratio: 0.5
+authors: [alice, bob]
+empty:
+`,
+			want: &Answers{
+				Source:  "gh:foo/bar",
+				Version: "v1.2.3",
+				Inputs: map[string]string{
+					"project_name": "my-project",
+					"use_docker":   "true",
+					"replicas":     "3",
+					"ratio":        "0.5",
+					"authors":      `["alice","bob"]`,
+					"empty":        "",
+				},
+			},
+		},
+		{
+			name:   "copier_without_metadata",
+			format: FormatCopier,
+			in:     `project_name: my-project`,
+			want: &Answers{
+				Inputs: map[string]string{"project_name": "my-project"},
+			},
+		},
+		{
+			name:    "copier_bad_metadata",
+			format:  FormatCopier,
+			in:      `_commit: [a, b]`,
+			wantErr: `"_commit" must be a string`,
+		},
+		{
+			name:    "copier_bad_yaml",
+			format:  FormatCopier,
+			in:      `[`,
+			wantErr: "failed parsing copier answers file as YAML",
+		},
+		{
+			name:   "cookiecutter_replay",
+			format: FormatCookiecutter,
+			in: `{
+  "cookiecutter": {
+    "project_name": "my-project",
+    "replicas": 3,
+    "_template": "https://github.com/foo/bar.git",
+    "_checkout": "main",
+    "_output_dir": "/tmp"
+  }
+}`,
+			want: &Answers{
+				Source:  "https://github.com/foo/bar.git",
+				Version: "main",
+				Inputs: map[string]string{
+					"project_name": "my-project",
+					"replicas":     "3",
+				},
+			},
+		},
+		{
+			name:   "cruft",
+			format: FormatCookiecutter,
+			in: `{
+  "template": "git@github.com:foo/bar.git",
+  "commit": "0123456789abcdef",
+  "checkout": null,
+  "context": {
+    "cookiecutter": {
+      "project_name": "my-project",
+      "_template": "ignored"
+    }
+  }
+}`,
+			want: &Answers{
+				Source:  "git@github.com:foo/bar.git",
+				Version: "0123456789abcdef",
+				Inputs: map[string]string{
+					"project_name": "my-project",
+				},
+			},
+		},
+		{
+			name:    "cookiecutter_no_context",
+			format:  FormatCookiecutter,
+			in:      `{"template": "gh:foo/bar"}`,
+			wantErr: `must have a "cookiecutter" object`,
+		},
+		{
+			name:    "unknown_format",
+			format:  "yeoman",
+			in:      `{}`,
+			wantErr: `unknown answers file format "yeoman"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := Parse(tc.format, []byte(tc.in))
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("answers were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestLocation(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		in     string
+		want   string
+		wantOK bool
+	}{
+		{in: "gh:foo/bar", want: "github.com/foo/bar", wantOK: true},
+		{in: "gl:foo/bar", want: "gitlab.com/foo/bar", wantOK: true},
+		{in: "https://github.com/foo/bar", want: "github.com/foo/bar", wantOK: true},
+		{in: "https://github.com/foo/bar.git", want: "github.com/foo/bar", wantOK: true},
+		{in: "git+https://gitlab.com/foo/bar.git", want: "gitlab.com/foo/bar", wantOK: true},
+		{in: "git@github.com:foo/bar.git", want: "github.com/foo/bar", wantOK: true},
+		{in: "/home/me/my_template"},
+		{in: "https://example.com/foo/bar.git"},
+		{in: "gh:foo/bar/baz"},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.in, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := Location(tc.in)
+			if got != tc.want || ok != tc.wantOK {
+				t.Errorf("Location(%q) got (%q, %t), want (%q, %t)", tc.in, got, ok, tc.want, tc.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package auditlog appends a record of every render and upgrade to a log that
+// the user's organization controls, so there's a trail of how each
+// installation of a template came to be.
+package auditlog
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/user"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2/google"
+
+	"github.com/abcxyz/abc/internal/version"
+)
+
+// The values of Record.Operation.
+const (
+	OperationRender  = "render"
+	OperationUpgrade = "upgrade"
+)
+
+// The values of Record.Result, apart from the upgrade results.
+const (
+	ResultSuccess = "success"
+	ResultError   = "error"
+)
+
+// Record describes one template operation. It's written as a single line of
+// JSON.
+type Record struct {
+	// When the operation finished.
+	Time time.Time `json:"time"`
+
+	// Who ran the operation, and where. User is the OS user name.
+	User string `json:"user"`
+	Host string `json:"host"`
+
+	// The version of abc that was used.
+	ABCVersion string `json:"abc_version"`
+
+	// One of the Operation* constants.
+	Operation string `json:"operation"`
+
+	// The template location and version. Source is what the user asked for,
+	// and CanonicalSource is where it was actually downloaded from, if that's
+	// known. Version is empty if the template isn't versioned.
+	Source          string `json:"source"`
+	CanonicalSource string `json:"canonical_source,omitempty"`
+	Version         string `json:"version,omitempty"`
+
+	// The absolute path to the directory that the template was rendered into
+	// or upgraded.
+	Dest string `json:"dest"`
+
+	// Result is ResultSuccess or ResultError for renders. For upgrades, it's
+	// ResultError or the upgrade result, like "merge_conflict".
+	Result string `json:"result"`
+
+	// The error message, if Result is ResultError.
+	Error string `json:"error,omitempty"`
+}
+
+// NewRecord returns a Record with the time and the user, host, and abc version
+// filled in.
+func NewRecord(operation string, now time.Time) *Record {
+	r := &Record{
+		Time:       now.UTC(),
+		ABCVersion: version.Version,
+		Operation:  operation,
+	}
+	if u, err := user.Current(); err == nil {
+		r.User = u.Username
+	}
+	if h, err := os.Hostname(); err == nil {
+		r.Host = h
+	}
+	return r
+}
+
+// SetErr sets Result and Error for an operation that returned err. It does
+// nothing if err is nil.
+func (r *Record) SetErr(err error) {
+	if err == nil {
+		return
+	}
+	r.Result = ResultError
+	r.Error = err.Error()
+}
+
+// Sink is somewhere that records are written.
+type Sink interface {
+	Write(ctx context.Context, r *Record) error
+}
+
+// Open returns the Sink for the given destination, which is one of:
+//
+//   - A local file path. Records are appended to the file, one per line.
+//   - A gs://bucket/prefix URL. Each record is a separate object in the
+//     bucket, since objects can't be appended to. Application default
+//     credentials are used.
+//   - An http:// or https:// URL. Each record is POSTed to the URL as JSON.
+func Open(dest string) (Sink, error) {
+	switch {
+	case strings.HasPrefix(dest, "gs://"):
+		bucket, prefix, _ := strings.Cut(strings.TrimPrefix(dest, "gs://"), "/")
+		if bucket == "" {
+			return nil, fmt.Errorf("the audit log destination %q is missing a bucket name", dest)
+		}
+		return &GCSSink{Bucket: bucket, Prefix: prefix}, nil
+	case strings.HasPrefix(dest, "http://"), strings.HasPrefix(dest, "https://"):
+		if _, err := url.Parse(dest); err != nil {
+			return nil, fmt.Errorf("the audit log destination %q isn't a valid URL: %w", dest, err)
+		}
+		return &HTTPSink{URL: dest}, nil
+	case strings.Contains(dest, "://"):
+		return nil, fmt.Errorf("the audit log destination %q has an unsupported scheme, it must be a file path, gs:// URL, or http(s):// URL", dest)
+	default:
+		return &FileSink{Path: dest}, nil
+	}
+}
+
+// FileSink appends records to a local file, creating it if needed.
+type FileSink struct {
+	Path string
+}
+
+// Write implements Sink.
+func (s *FileSink) Write(_ context.Context, r *Record) error {
+	line, err := marshalLine(r)
+	if err != nil {
+		return err
+	}
+
+	// A single write of a file opened with O_APPEND is atomic on local
+	// filesystems, so concurrent abc processes won't interleave their lines.
+	f, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed opening audit log: %w", err)
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return fmt.Errorf("failed appending to audit log: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed closing audit log: %w", err)
+	}
+	return nil
+}
+
+// HTTPSink POSTs each record as JSON to a URL.
+type HTTPSink struct {
+	URL string
+
+	// Client is the HTTP client to use. If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// Write implements Sink.
+func (s *HTTPSink) Write(ctx context.Context, r *Record) error {
+	return post(ctx, clientOrDefault(s.Client), s.URL, r)
+}
+
+// GCSSink writes each record as a separate object in a Google Cloud Storage
+// bucket.
+type GCSSink struct {
+	Bucket string
+
+	// Prefix is prepended to each object name, and may contain slashes.
+	Prefix string
+
+	// Client is the HTTP client to use, which must add credentials to each
+	// request. If nil, a client using application default credentials is
+	// created.
+	Client *http.Client
+
+	// endpoint overrides the GCS API endpoint in tests.
+	endpoint string
+
+	once      sync.Once
+	clientErr error
+}
+
+const (
+	gcsUploadEndpoint = "https://storage.googleapis.com/upload/storage/v1"
+	gcsWriteScope     = "https://www.googleapis.com/auth/devstorage.read_write"
+)
+
+// Write implements Sink.
+func (s *GCSSink) Write(ctx context.Context, r *Record) error {
+	s.once.Do(func() {
+		if s.Client == nil {
+			s.Client, s.clientErr = google.DefaultClient(ctx, gcsWriteScope)
+		}
+	})
+	if s.clientErr != nil {
+		return fmt.Errorf("failed getting Google Cloud credentials: %w", s.clientErr)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Errorf("failed generating object name: %w", err)
+	}
+	// Object names start with the time so that they're listed in order.
+	name := path.Join(s.Prefix, fmt.Sprintf("%s-%s.json",
+		r.Time.UTC().Format("20060102T150405.000000000Z"), hex.EncodeToString(suffix)))
+
+	endpoint := s.endpoint
+	if endpoint == "" {
+		endpoint = gcsUploadEndpoint
+	}
+	u := fmt.Sprintf("%s/b/%s/o?uploadType=media&name=%s",
+		endpoint, url.PathEscape(s.Bucket), url.QueryEscape(name))
+	return post(ctx, s.Client, u, r)
+}
+
+func post(ctx context.Context, client *http.Client, u string, r *Record) error {
+	body, err := marshalLine(r)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed sending audit record: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("got HTTP status %q when sending audit record: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+func clientOrDefault(c *http.Client) *http.Client {
+	if c == nil {
+		return http.DefaultClient
+	}
+	return c
+}
+
+func marshalLine(r *Record) ([]byte, error) {
+	buf, err := json.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed marshaling audit record: %w", err)
+	}
+	return append(buf, '\n'), nil
+}
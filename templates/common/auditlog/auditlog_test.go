@@ -0,0 +1,243 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditlog
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestOpen(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		dest    string
+		want    Sink
+		wantErr string
+	}{
+		{
+			name: "file",
+			dest: "/var/log/abc.jsonl",
+			want: &FileSink{Path: "/var/log/abc.jsonl"},
+		},
+		{
+			name: "relative_file",
+			dest: "abc.jsonl",
+			want: &FileSink{Path: "abc.jsonl"},
+		},
+		{
+			name: "gcs_with_prefix",
+			dest: "gs://my-bucket/abc/audit",
+			want: &GCSSink{Bucket: "my-bucket", Prefix: "abc/audit"},
+		},
+		{
+			name: "gcs_without_prefix",
+			dest: "gs://my-bucket",
+			want: &GCSSink{Bucket: "my-bucket"},
+		},
+		{
+			name:    "gcs_without_bucket",
+			dest:    "gs://",
+			wantErr: "missing a bucket name",
+		},
+		{
+			name: "https",
+			dest: "https://audit.example.com/abc",
+			want: &HTTPSink{URL: "https://audit.example.com/abc"},
+		},
+		{
+			name:    "unknown_scheme",
+			dest:    "s3://my-bucket",
+			wantErr: "unsupported scheme",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := Open(tc.dest)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			opts := cmpopts.IgnoreUnexported(GCSSink{})
+			if diff := cmp.Diff(got, tc.want, opts); diff != "" {
+				t.Errorf("sink was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func testRecord(result string) *Record {
+	return &Record{
+		Time:       time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		User:       "alice",
+		Host:       "workstation",
+		ABCVersion: "1.2.3",
+		Operation:  OperationRender,
+		Source:     "github.com/foo/bar@v1.0.0",
+		Version:    "v1.0.0",
+		Dest:       "/home/alice/repo",
+		Result:     result,
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink := &FileSink{Path: path}
+
+	want := []*Record{testRecord(ResultSuccess), testRecord(ResultError)}
+	want[1].Error = "something broke"
+	for _, r := range want {
+		if err := sink.Write(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(buf), "\n"), "\n")
+	got := make([]*Record, 0, len(lines))
+	for _, line := range lines {
+		var r Record
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("line %q isn't a JSON record: %v", line, err)
+		}
+		got = append(got, &r)
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("records were not as expected (-got,+want): %s", diff)
+	}
+}
+
+// recordingServer is an HTTP server that remembers the requests sent to it.
+type recordingServer struct {
+	mu     sync.Mutex
+	status int
+	urls   []string
+	bodies []string
+}
+
+func (s *recordingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.urls = append(s.urls, r.Method+" "+r.URL.String())
+	s.bodies = append(s.bodies, string(body))
+	w.WriteHeader(s.status)
+	_, _ = w.Write([]byte("oh no"))
+}
+
+func TestHTTPSink(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		status  int
+		wantErr string
+	}{
+		{
+			name:   "success",
+			status: http.StatusNoContent,
+		},
+		{
+			name:    "server_error",
+			status:  http.StatusInternalServerError,
+			wantErr: `got HTTP status "500 Internal Server Error" when sending audit record: oh no`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			rs := &recordingServer{status: tc.status}
+			server := httptest.NewServer(rs)
+			t.Cleanup(server.Close)
+
+			sink := &HTTPSink{URL: server.URL + "/audit"}
+			err := sink.Write(context.Background(), testRecord(ResultSuccess))
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+
+			if diff := cmp.Diff(rs.urls, []string{"POST /audit"}); diff != "" {
+				t.Errorf("requests were not as expected (-got,+want): %s", diff)
+			}
+			var got Record
+			if err := json.Unmarshal([]byte(rs.bodies[0]), &got); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(&got, testRecord(ResultSuccess)); diff != "" {
+				t.Errorf("record was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestGCSSink(t *testing.T) {
+	t.Parallel()
+
+	rs := &recordingServer{status: http.StatusOK}
+	server := httptest.NewServer(rs)
+	t.Cleanup(server.Close)
+
+	sink := &GCSSink{
+		Bucket:   "my-bucket",
+		Prefix:   "abc/audit",
+		Client:   server.Client(),
+		endpoint: server.URL,
+	}
+	for i := 0; i < 2; i++ {
+		if err := sink.Write(context.Background(), testRecord(ResultSuccess)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(rs.urls) != 2 {
+		t.Fatalf("got %d requests, want 2", len(rs.urls))
+	}
+	for _, u := range rs.urls {
+		const wantPrefix = "POST /b/my-bucket/o?uploadType=media&name=abc%2Faudit%2F20240301T120000.000000000Z-"
+		if !strings.HasPrefix(u, wantPrefix) || !strings.HasSuffix(u, ".json") {
+			t.Errorf("got request %q, want one starting with %q and ending with .json", u, wantPrefix)
+		}
+	}
+	if rs.urls[0] == rs.urls[1] {
+		t.Errorf("two records were written to the same object %q", rs.urls[0])
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package backups manages the directories where files are backed up before
+// they're overwritten by a render.
+//
+// The layout is $ROOT/$UNIX_SECONDS/$RANDOM/..., where $ROOT is normally
+// ~/.abc/backups. Each $RANDOM directory is one "backup", holding the files
+// backed up by a single render, laid out the same way as in the destination
+// directory.
+package backups
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// EnvVar is the environment variable that overrides the directory under which
+// backups are kept.
+const EnvVar = "ABC_BACKUP_DIR"
+
+// DefaultRoot returns the directory under which backups are kept. This is the
+// value of $ABC_BACKUP_DIR if set, otherwise ~/.abc/backups.
+func DefaultRoot() (string, error) {
+	if p := os.Getenv(EnvVar); p != "" {
+		return p, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home dir: %w", err)
+	}
+	return filepath.Join(homeDir, common.ABCInternalDir, "backups"), nil
+}
+
+// ParentDir returns the directory under root in which a render at the given
+// time creates its backup directory.
+func ParentDir(root string, now time.Time) string {
+	return filepath.Join(root, strconv.FormatInt(now.UTC().Unix(), 10))
+}
+
+// Backup is one backup directory.
+type Backup struct {
+	// Dir is the path of the backup directory.
+	Dir string
+
+	// Time is when the render that created this backup ran, to the second.
+	Time time.Time
+}
+
+// List returns all the backups under root, newest first. Entries under root
+// that don't look like backups are ignored. If root doesn't exist, there are no
+// backups.
+func List(fsys common.FS, root string) ([]*Backup, error) {
+	parents, err := fs.ReadDir(fsys, root)
+	if err != nil {
+		if common.IsNotExistErr(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ReadDir(%s): %w", root, err)
+	}
+
+	var out []*Backup
+	for _, parent := range parents {
+		if !parent.IsDir() {
+			continue
+		}
+		secs, err := strconv.ParseInt(parent.Name(), 10, 64)
+		if err != nil {
+			continue // not created by us
+		}
+		parentDir := filepath.Join(root, parent.Name())
+		children, err := fs.ReadDir(fsys, parentDir)
+		if err != nil {
+			return nil, fmt.Errorf("ReadDir(%s): %w", parentDir, err)
+		}
+		for _, child := range children {
+			if !child.IsDir() {
+				continue
+			}
+			out = append(out, &Backup{
+				Dir:  filepath.Join(parentDir, child.Name()),
+				Time: time.Unix(secs, 0).UTC(),
+			})
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if !out[i].Time.Equal(out[j].Time) {
+			return out[i].Time.After(out[j].Time)
+		}
+		return out[i].Dir > out[j].Dir
+	})
+	return out, nil
+}
+
+// PruneParams are the arguments to Prune.
+type PruneParams struct {
+	FS common.FS
+
+	// Root is the directory containing backups, normally DefaultRoot().
+	Root string
+
+	// Keep is the maximum number of backups to keep; older ones beyond that
+	// are removed. Zero means no limit.
+	Keep int
+
+	// MaxAge is the maximum age of backups to keep; older ones are removed.
+	// Zero means no limit.
+	MaxAge time.Duration
+
+	// Now is the current time, for calculating backup ages.
+	Now time.Time
+
+	// DryRun only returns the backups that would be removed, without removing
+	// them.
+	DryRun bool
+}
+
+// Prune removes the backups that are not allowed by the retention policy in
+// the params, and returns the ones that were removed, newest first.
+func Prune(ctx context.Context, p *PruneParams) ([]*Backup, error) {
+	logger := logging.FromContext(ctx).With("logger", "Prune")
+
+	all, err := List(p.FS, p.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []*Backup
+	for i, b := range all {
+		tooMany := p.Keep > 0 && i >= p.Keep
+		tooOld := p.MaxAge > 0 && p.Now.Sub(b.Time) > p.MaxAge
+		if tooMany || tooOld {
+			pruned = append(pruned, b)
+		}
+	}
+	if p.DryRun {
+		return pruned, nil
+	}
+
+	var merr error
+	removed := make([]*Backup, 0, len(pruned))
+	for _, b := range pruned {
+		logger.DebugContext(ctx, "removing backup", "dir", b.Dir, "time", b.Time)
+		if err := p.FS.RemoveAll(b.Dir); err != nil {
+			merr = errors.Join(merr, fmt.Errorf("failed removing backup %q: %w", b.Dir, err))
+			continue
+		}
+		removed = append(removed, b)
+		// Remove the timestamp directory if that was its last backup.
+		parent := filepath.Dir(b.Dir)
+		entries, err := fs.ReadDir(p.FS, parent)
+		if err != nil {
+			merr = errors.Join(merr, fmt.Errorf("ReadDir(%s): %w", parent, err))
+			continue
+		}
+		if len(entries) == 0 {
+			if err := p.FS.Remove(parent); err != nil {
+				merr = errors.Join(merr, fmt.Errorf("Remove(%s): %w", parent, err))
+			}
+		}
+	}
+	return removed, merr
+}
@@ -0,0 +1,195 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backups
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestPrune(t *testing.T) {
+	t.Parallel()
+
+	// Unix seconds 1000, 2000, and 3000, with two backups at 3000.
+	initialContents := map[string]string{
+		"1000/aaa/file.txt":  "oldest",
+		"2000/bbb/file.txt":  "middle",
+		"3000/ccc/file.txt":  "newest 1",
+		"3000/ddd/file.txt":  "newest 2",
+		"not_a_time/foo.txt": "ignored",
+		"4000":               "a file, not a backup directory",
+	}
+	now := time.Unix(3500, 0)
+
+	cases := []struct {
+		name        string
+		keep        int
+		maxAge      time.Duration
+		dryRun      bool
+		removeErr   error
+		wantPruned  []string
+		wantRemains map[string]string
+		wantErr     string
+	}{
+		{
+			name: "no_limits",
+			wantRemains: map[string]string{
+				"1000/aaa/file.txt":  "oldest",
+				"2000/bbb/file.txt":  "middle",
+				"3000/ccc/file.txt":  "newest 1",
+				"3000/ddd/file.txt":  "newest 2",
+				"not_a_time/foo.txt": "ignored",
+				"4000":               "a file, not a backup directory",
+			},
+		},
+		{
+			name:       "keep",
+			keep:       2,
+			wantPruned: []string{"2000/bbb", "1000/aaa"},
+			wantRemains: map[string]string{
+				"3000/ccc/file.txt":  "newest 1",
+				"3000/ddd/file.txt":  "newest 2",
+				"not_a_time/foo.txt": "ignored",
+				"4000":               "a file, not a backup directory",
+			},
+		},
+		{
+			name:       "keep_splits_timestamp_dir",
+			keep:       1,
+			wantPruned: []string{"3000/ccc", "2000/bbb", "1000/aaa"},
+			wantRemains: map[string]string{
+				"3000/ddd/file.txt":  "newest 2",
+				"not_a_time/foo.txt": "ignored",
+				"4000":               "a file, not a backup directory",
+			},
+		},
+		{
+			name:       "max_age",
+			maxAge:     2000 * time.Second,
+			wantPruned: []string{"1000/aaa"},
+			wantRemains: map[string]string{
+				"2000/bbb/file.txt":  "middle",
+				"3000/ccc/file.txt":  "newest 1",
+				"3000/ddd/file.txt":  "newest 2",
+				"not_a_time/foo.txt": "ignored",
+				"4000":               "a file, not a backup directory",
+			},
+		},
+		{
+			name:       "either_limit_prunes",
+			keep:       3,
+			maxAge:     2000 * time.Second,
+			wantPruned: []string{"1000/aaa"},
+			wantRemains: map[string]string{
+				"2000/bbb/file.txt":  "middle",
+				"3000/ccc/file.txt":  "newest 1",
+				"3000/ddd/file.txt":  "newest 2",
+				"not_a_time/foo.txt": "ignored",
+				"4000":               "a file, not a backup directory",
+			},
+		},
+		{
+			name:       "dry_run",
+			keep:       3,
+			dryRun:     true,
+			wantPruned: []string{"1000/aaa"},
+			wantRemains: map[string]string{
+				"1000/aaa/file.txt":  "oldest",
+				"2000/bbb/file.txt":  "middle",
+				"3000/ccc/file.txt":  "newest 1",
+				"3000/ddd/file.txt":  "newest 2",
+				"not_a_time/foo.txt": "ignored",
+				"4000":               "a file, not a backup directory",
+			},
+		},
+		{
+			name:      "remove_error",
+			keep:      3,
+			removeErr: fmt.Errorf("fake error for testing"),
+			wantRemains: map[string]string{
+				"1000/aaa/file.txt":  "oldest",
+				"2000/bbb/file.txt":  "middle",
+				"3000/ccc/file.txt":  "newest 1",
+				"3000/ddd/file.txt":  "newest 2",
+				"not_a_time/foo.txt": "ignored",
+				"4000":               "a file, not a backup directory",
+			},
+			wantErr: "fake error for testing",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			root := t.TempDir()
+			abctestutil.WriteAll(t, root, initialContents)
+
+			pruned, err := Prune(context.Background(), &PruneParams{
+				FS: &common.ErrorFS{
+					FS:           &common.RealFS{},
+					RemoveAllErr: tc.removeErr,
+				},
+				Root:   root,
+				Keep:   tc.keep,
+				MaxAge: tc.maxAge,
+				Now:    now,
+				DryRun: tc.dryRun,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+
+			var gotPruned []string
+			for _, b := range pruned {
+				rel, err := filepath.Rel(root, b.Dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				gotPruned = append(gotPruned, rel)
+			}
+			if diff := cmp.Diff(gotPruned, tc.wantPruned); diff != "" {
+				t.Errorf("pruned backups were not as expected (-got,+want): %s", diff)
+			}
+
+			got := abctestutil.LoadDir(t, root)
+			if diff := cmp.Diff(got, tc.wantRemains); diff != "" {
+				t.Errorf("remaining backups were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestList_MissingRoot(t *testing.T) {
+	t.Parallel()
+
+	got, err := List(&common.RealFS{}, filepath.Join(t.TempDir(), "nonexistent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("got %v, want no backups", got)
+	}
+}
@@ -44,6 +44,12 @@ const (
 	// The positional argument on the command line providing the template to be
 	// rendered.
 	FlagSource = "_flag_source"
+
+	// The template versions that "abc upgrade" is upgrading from and to.
+	// These are only in scope in the spec's pre_upgrade and post_upgrade
+	// hooks.
+	FromVersion = "_from_version"
+	ToVersion   = "_to_version"
 )
 
 // Validate returns error if any of the attemptedNames are not valid builtin
@@ -287,6 +287,22 @@ func CelCompileAndEval(ctx context.Context, scope *Scope, expr model.String, out
 	return nil
 }
 
+// CelCompileAndEvalValue is like CelCompileAndEval, but rather than converting
+// the output to a Go type chosen by the caller, it returns the output as the
+// CEL engine produced it. It's for showing the result of an arbitrary
+// expression to the user.
+func CelCompileAndEvalValue(ctx context.Context, scope *Scope, expr string) (ref.Val, error) {
+	prog, err := celCompile(ctx, scope, expr)
+	if err != nil {
+		return nil, err
+	}
+	celOut, _, err := prog.Eval(celVars(scope))
+	if err != nil {
+		return nil, fmt.Errorf("failed executing CEL expression: %w", err)
+	}
+	return celOut, nil
+}
+
 // celCompile parses and compiles the given expr into executable Program.
 func celCompile(ctx context.Context, scope *Scope, expr string) (cel.Program, error) {
 	startedAt := time.Now()
@@ -343,6 +359,17 @@ func IsCELUndeclaredRef(err error) (string, bool) {
 	return matches[1], true
 }
 
+// celVars returns the variables in scope in the form the CEL engine needs,
+// which is a map[string]any rather than our map[string]string.
+func celVars(scope *Scope) map[string]any {
+	scopeAll := scope.AllVars()
+	out := make(map[string]any, len(scopeAll))
+	for varName, varVal := range scopeAll {
+		out[varName] = varVal
+	}
+	return out
+}
+
 // celEval runs a previously-compiled CEL Program (which you can get from
 // celCompile()).
 //
@@ -354,15 +381,7 @@ func IsCELUndeclaredRef(err error) (string, bool) {
 func celEval(ctx context.Context, scope *Scope, prog cel.Program, outPtr any) error {
 	startedAt := time.Now()
 
-	// The CEL engine needs variable values as a map[string]any, but we have a
-	// map[string]string, so convert.
-	scopeAll := scope.AllVars()
-	scopeMapAny := make(map[string]any, len(scopeAll))
-	for varName, varVal := range scopeAll {
-		scopeMapAny[varName] = varVal
-	}
-
-	celOut, _, err := prog.Eval(scopeMapAny)
+	celOut, _, err := prog.Eval(celVars(scope))
 	if err != nil {
 		return fmt.Errorf("failed executing CEL expression: %w", err)
 	}
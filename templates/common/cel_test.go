@@ -125,6 +125,72 @@ func TestCompileAndEvalCEL(t *testing.T) {
 	}
 }
 
+func TestCelCompileAndEvalValue(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		in       string
+		vars     map[string]string
+		want     any
+		wantType string
+		wantErr  string
+	}{
+		{
+			name:     "string",
+			in:       `reptile + "s"`,
+			vars:     map[string]string{"reptile": "crocodile"},
+			want:     "crocodiles",
+			wantType: "string",
+		},
+		{
+			name:     "bool",
+			in:       `reptile == "alligator"`,
+			vars:     map[string]string{"reptile": "crocodile"},
+			want:     false,
+			wantType: "bool",
+		},
+		{
+			name:     "list",
+			in:       `"alligator,crocodile".split(",")`,
+			want:     []string{"alligator", "crocodile"},
+			wantType: "list",
+		},
+		{
+			name:    "unknown_var",
+			in:      `reptile`,
+			wantErr: `nonexistent variable name "reptile"`,
+		},
+		{
+			name:    "runtime_error",
+			in:      `1 / 0`,
+			wantErr: "failed executing CEL expression: division by zero",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := CelCompileAndEvalValue(context.Background(), NewScope(tc.vars, nil), tc.in)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(got.Value(), tc.want); diff != "" {
+				t.Errorf("value was not as expected (-got,+want): %s", diff)
+			}
+			if gotType := got.Type().TypeName(); gotType != tc.wantType {
+				t.Errorf("got type %q, want %q", gotType, tc.wantType)
+			}
+		})
+	}
+}
+
 // Tests for all of our custom functions that we add to CEL.
 func TestCELFuncs(t *testing.T) {
 	t.Parallel()
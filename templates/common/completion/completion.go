@@ -0,0 +1,183 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package completion contains shell completion predictors that are smarter
+// than plain file and directory completion. They know about template aliases
+// from the registry file, and can look inside a template's spec.yaml to
+// suggest --input names.
+package completion
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/posener/complete/v2"
+	"github.com/posener/complete/v2/predict"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/registry"
+	"github.com/abcxyz/abc/templates/common/specutil"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// downloadTimeout bounds how long we'll wait to fetch a remote template while
+// the user is waiting for completions. It's better to return no suggestions
+// than to hang the user's shell.
+const downloadTimeout = 5 * time.Second
+
+// Sources predicts the template source argument. It suggests local
+// directories and the aliases from the registry file.
+func Sources() complete.Predictor {
+	return predict.Or(predict.Dirs(""), complete.PredictFunc(func(string) []string {
+		reg, err := registry.LoadDefault()
+		if err != nil {
+			return nil
+		}
+		return reg.Names()
+	}))
+}
+
+// InputKeys predicts the "key=" part of --input values. The template source is
+// taken from the command line being completed; the template is fetched and
+// the input names are read from its spec.yaml.
+//
+// Completion must never fail loudly, so all errors result in no suggestions.
+func InputKeys() complete.Predictor {
+	return complete.PredictFunc(func(prefix string) []string {
+		if strings.Contains(prefix, "=") {
+			// The user already typed the key and is typing the value, which we
+			// can't predict.
+			return nil
+		}
+
+		line := os.Getenv("COMP_LINE")
+		if point, err := strconv.Atoi(os.Getenv("COMP_POINT")); err == nil && point < len(line) {
+			line = line[:point]
+		}
+		cwd, err := os.Getwd()
+		if err != nil {
+			return nil
+		}
+		reg, err := registry.LoadDefault()
+		if err != nil {
+			return nil
+		}
+		source := sourceFromLine(line, cwd, reg)
+		if source == "" {
+			return nil
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), downloadTimeout)
+		defer cancel()
+		// Log messages would be printed in the middle of the user's command
+		// line, so discard them.
+		ctx = logging.WithLogger(ctx, logging.New(io.Discard, logging.LevelError, logging.FormatText, false))
+
+		keys, err := inputKeys(ctx, cwd, source)
+		if err != nil {
+			return nil
+		}
+		return keys
+	})
+}
+
+// sourceFromLine finds the template source in a partially typed command line.
+// Since we don't know which flags take values, we pick the last positional
+// word that looks like a template source (after resolving aliases). Returns
+// empty string if there's no such word.
+func sourceFromLine(line, cwd string, reg *registry.Registry) string {
+	words := strings.Fields(line)
+	if len(words) == 0 {
+		return ""
+	}
+	words = words[1:] // the program name
+	if !strings.HasSuffix(line, " ") && len(words) > 0 {
+		// The last word is still being typed, so it's not the source.
+		words = words[:len(words)-1]
+	}
+
+	for i := len(words) - 1; i >= 0; i-- {
+		w := words[i]
+		if strings.HasPrefix(w, "-") {
+			continue
+		}
+		resolved := reg.Resolve(cwd, w)
+		if looksLikeSource(cwd, resolved) {
+			return resolved
+		}
+	}
+	return ""
+}
+
+// looksLikeSource returns whether the given string is plausibly a template
+// source: either a remote location or a local directory containing a spec
+// file.
+func looksLikeSource(cwd, s string) bool {
+	if strings.Contains(s, "@") || strings.Contains(s, ".git") {
+		return true
+	}
+	path := s
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(cwd, path)
+	}
+	_, err := os.Stat(filepath.Join(path, specutil.SpecFileName))
+	return err == nil
+}
+
+// inputKeys downloads the template at source and returns its input names, each
+// followed by "=", ready to be completed as an --input value.
+func inputKeys(ctx context.Context, cwd, source string) (_ []string, rErr error) {
+	fs := &common.RealFS{}
+	tempTracker := tempdir.NewDirTracker(fs, false)
+	defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
+
+	templateDir, err := tempTracker.MkdirTempTracked("", tempdir.TemplateDirNamePart)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	gitProtocol := os.Getenv("ABC_GIT_PROTOCOL")
+	if gitProtocol == "" {
+		gitProtocol = "https"
+	}
+	downloader, err := templatesource.ParseSource(ctx, &templatesource.ParseSourceParams{
+		CWD:             cwd,
+		Source:          source,
+		FlagGitProtocol: gitProtocol,
+	})
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	if _, err := downloader.Download(ctx, cwd, templateDir, ""); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	spec, err := specutil.Load(ctx, fs, templateDir, source)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	out := make([]string, 0, len(spec.Inputs))
+	for _, in := range spec.Inputs {
+		out = append(out, in.Name.Val+"=")
+	}
+	return out, nil
+}
@@ -0,0 +1,164 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package completion
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common/registry"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+const testSpec = `api_version: 'cli.abcxyz.dev/v1beta6'
+kind: 'Template'
+desc: 'A template for testing completion'
+inputs:
+- name: 'person_name'
+  desc: 'A name'
+- name: 'dog_name'
+  desc: 'Another name'
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'
+`
+
+func TestSourceFromLine(t *testing.T) {
+	t.Parallel()
+
+	reg := &registry.Registry{
+		Aliases: map[string]string{
+			"remote": "github.com/abcxyz/abc/t/rest_server@latest",
+		},
+	}
+
+	cases := []struct {
+		name string
+		line string
+		want string
+	}{
+		{
+			name: "local_source_before_flag",
+			line: "abc render mytemplate --input=",
+			want: "mytemplate",
+		},
+		{
+			name: "local_source_after_flags",
+			line: "abc render --dest out mytemplate --input=",
+			want: "mytemplate",
+		},
+		{
+			name: "flag_value_after_source_is_skipped",
+			line: "abc render mytemplate --dest out --input=",
+			want: "mytemplate",
+		},
+		{
+			name: "alias_is_resolved",
+			line: "abc render remote --input=",
+			want: "github.com/abcxyz/abc/t/rest_server@latest",
+		},
+		{
+			name: "remote_source",
+			line: "abc render --input=foo=bar github.com/foo/bar@v1.2.3 --input ",
+			want: "github.com/foo/bar@v1.2.3",
+		},
+		{
+			name: "word_being_typed_is_not_source",
+			line: "abc render mytempl",
+			want: "",
+		},
+		{
+			name: "no_source",
+			line: "abc render --input=",
+			want: "",
+		},
+		{
+			name: "empty_line",
+			line: "",
+			want: "",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			cwd := t.TempDir()
+			abctestutil.WriteAll(t, cwd, map[string]string{
+				"mytemplate/spec.yaml": testSpec,
+				"out/file.txt":         "",
+			})
+
+			if got := sourceFromLine(tc.line, cwd, reg); got != tc.want {
+				t.Errorf("sourceFromLine(%q) got %q, want %q", tc.line, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestInputKeys(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		files   map[string]string
+		source  string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "simple_success",
+			files: map[string]string{
+				"mytemplate/spec.yaml": testSpec,
+			},
+			source: "mytemplate",
+			want:   []string{"person_name=", "dog_name="},
+		},
+		{
+			name:    "missing_spec",
+			files:   map[string]string{"mytemplate/file.txt": ""},
+			source:  "mytemplate",
+			wantErr: "couldn't find spec.yaml",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			cwd := t.TempDir()
+			abctestutil.WriteAll(t, cwd, tc.files)
+
+			got, err := inputKeys(ctx, cwd, filepath.Join(cwd, tc.source))
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("input keys were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,355 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package config reads abc's config files, which set defaults for flags so
+// they don't have to be passed on every command. There are two config files:
+//
+//   - The user config file, ~/.config/abc/config.yaml (or the file named by
+//     $ABC_CONFIG_FILE).
+//   - The repo config file, .abc.yaml, in the current directory or the nearest
+//     parent directory up to the root of the git repo.
+//
+// The repo config file takes precedence over the user config file. Both are
+// lower precedence than environment variables and flags.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/backups"
+	"github.com/abcxyz/abc/templates/common/messages"
+)
+
+const (
+	// EnvVar is the environment variable that overrides the location of the
+	// user config file.
+	EnvVar = "ABC_CONFIG_FILE"
+
+	// RepoFileName is the name of the repo config file.
+	RepoFileName = ".abc.yaml"
+)
+
+// Config is the parsed contents of a config file.
+type Config struct {
+	// GitProtocol is the default for --git-protocol.
+	GitProtocol string `yaml:"git_protocol"`
+
+	// BackupDir is the directory under which backups are kept, instead of
+	// ~/.abc/backups. A relative path is relative to the config file.
+	BackupDir string `yaml:"backup_dir"`
+
+	// MessagesFile is the messages file that replaces or adds to abc's
+	// user-facing text. A relative path is relative to the config file. See
+	// the messages package.
+	MessagesFile string `yaml:"messages_file"`
+
+	// UpgradeChannel is the default for --upgrade-channel.
+	UpgradeChannel string `yaml:"upgrade_channel"`
+
+	// Aliases are template aliases, in addition to those in the registry file.
+	// See the registry package.
+	Aliases map[string]string `yaml:"aliases"`
+
+	// Mirrors are the repos that template sources are downloaded from instead
+	// of their upstream repos. See Mirrors.
+	Mirrors Mirrors `yaml:"mirrors"`
+
+	// Proxy configures the proxy for network access, both abc's own and that
+	// of the git commands that it runs.
+	Proxy Proxy `yaml:"proxy"`
+
+	// UpgradeChannelPolicy restricts the upgrade channels that templates may
+	// be installed with.
+	UpgradeChannelPolicy *UpgradeChannelPolicy `yaml:"upgrade_channel_policy"`
+
+	// Env sets defaults for any other flag that has an environment variable,
+	// keyed by the environment variable name, like ABC_LOG_LEVEL. Only
+	// variables starting with ABC_ are allowed.
+	Env map[string]string `yaml:"env"`
+}
+
+// Proxy is the proxy part of a config file. Each field is the default for the
+// environment variable of the same name.
+type Proxy struct {
+	HTTPProxy  string `yaml:"http_proxy"`
+	HTTPSProxy string `yaml:"https_proxy"`
+	NoProxy    string `yaml:"no_proxy"`
+}
+
+// UpgradeChannelPolicy restricts the upgrade channels that templates may be
+// installed with, e.g. so that production repos track release tags rather than
+// a branch.
+type UpgradeChannelPolicy struct {
+	// Allowed are the allowed upgrade channels, which may be glob patterns as
+	// in path.Match, like "release-*". The special channel "latest" tracks the
+	// latest release tag.
+	Allowed []string `yaml:"allowed"`
+
+	// File is the config file that the policy came from, for error messages.
+	File string `yaml:"-"`
+}
+
+// Check returns an error if the given upgrade channel isn't allowed by the
+// policy. A nil policy allows every channel, and an empty channel (as for a
+// template on the local filesystem, which can't be upgraded from a remote) is
+// always allowed.
+func (p *UpgradeChannelPolicy) Check(channel string) error {
+	if p == nil || channel == "" {
+		return nil
+	}
+	for _, pattern := range p.Allowed {
+		if ok, _ := path.Match(pattern, channel); ok {
+			return nil
+		}
+	}
+	allowed := "no channels"
+	if len(p.Allowed) > 0 {
+		allowed = strings.Join(p.Allowed, ", ")
+	}
+	return fmt.Errorf("the upgrade channel %q isn't allowed by the upgrade_channel_policy in %q, which only allows %s; use --ignore-upgrade-channel-policy to override",
+		channel, p.File, allowed)
+}
+
+func (p *UpgradeChannelPolicy) validate() error {
+	for _, pattern := range p.Allowed {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("config file %q has an invalid upgrade channel pattern %q: %w", p.File, pattern, err)
+		}
+	}
+	return nil
+}
+
+// UserPath returns the location of the user config file. This is the value of
+// $ABC_CONFIG_FILE if set, otherwise config.yaml in the abc directory under
+// $XDG_CONFIG_HOME or ~/.config.
+func UserPath() (string, error) {
+	if p := os.Getenv(EnvVar); p != "" {
+		return p, nil
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "abc", "config.yaml"), nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home dir: %w", err)
+	}
+	return filepath.Join(homeDir, ".config", "abc", "config.yaml"), nil
+}
+
+// FindRepoFile returns the path of the repo config file that applies in the
+// directory cwd, or "" if there isn't one. The search goes up from cwd, and
+// stops after the root of the git repo containing cwd. If cwd is a file, the
+// search starts in its directory.
+func FindRepoFile(cwd string) (string, error) {
+	dir := cwd
+	if fi, err := os.Stat(cwd); err == nil && !fi.IsDir() {
+		dir = filepath.Dir(cwd)
+	}
+	for {
+		path := filepath.Join(dir, RepoFileName)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		} else if !common.IsNotExistErr(err) {
+			return "", fmt.Errorf("failed checking for config file: %w", err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return "", nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// LoadDefault loads the user config file and the repo config file for the
+// current directory, and merges them.
+func LoadDefault() (*Config, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current working directory: %w", err)
+	}
+	return LoadForDir(cwd)
+}
+
+// LoadForDir is like LoadDefault, but uses the repo config file for the given
+// directory instead of the current directory. This is used for settings that
+// belong to the repo being rendered into, which isn't necessarily the current
+// one.
+func LoadForDir(dir string) (*Config, error) {
+	userPath, err := UserPath()
+	if err != nil {
+		return nil, err
+	}
+	repoPath, err := FindRepoFile(dir)
+	if err != nil {
+		return nil, err
+	}
+	return LoadFiles(userPath, repoPath)
+}
+
+// LoadFiles loads each of the given config files and merges them, with later
+// files taking precedence over earlier ones. Empty paths are skipped.
+func LoadFiles(paths ...string) (*Config, error) {
+	out := &Config{}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		c, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		out.merge(c)
+	}
+	return out, nil
+}
+
+// Load reads the config file at the given path. A nonexistent config file is
+// not an error; it's treated the same as an empty one.
+func Load(path string) (*Config, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		if common.IsNotExistErr(err) {
+			return &Config{}, nil
+		}
+		return nil, fmt.Errorf("failed reading config file: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(buf))
+	dec.KnownFields(true)
+	out := &Config{}
+	if err := dec.Decode(out); err != nil {
+		if errors.Is(err, io.EOF) { // an empty file sets nothing
+			return out, nil
+		}
+		return nil, fmt.Errorf("failed parsing config file %q: %w", path, err)
+	}
+
+	for name := range out.Env {
+		if !strings.HasPrefix(name, "ABC_") {
+			return nil, fmt.Errorf("config file %q sets the environment variable %q, but only variables starting with ABC_ may be set", path, name)
+		}
+	}
+	if err := out.Mirrors.validate(); err != nil {
+		return nil, fmt.Errorf("config file %q: %w", path, err)
+	}
+	if out.BackupDir != "" {
+		out.BackupDir = common.JoinIfRelative(filepath.Dir(path), out.BackupDir)
+	}
+	if out.MessagesFile != "" {
+		out.MessagesFile = common.JoinIfRelative(filepath.Dir(path), out.MessagesFile)
+	}
+	if out.UpgradeChannelPolicy != nil {
+		out.UpgradeChannelPolicy.File = path
+		if err := out.UpgradeChannelPolicy.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// merge overwrites the settings in c with those that are set in other.
+func (c *Config) merge(other *Config) {
+	setIfNonEmpty(&c.GitProtocol, other.GitProtocol)
+	setIfNonEmpty(&c.BackupDir, other.BackupDir)
+	setIfNonEmpty(&c.MessagesFile, other.MessagesFile)
+	setIfNonEmpty(&c.UpgradeChannel, other.UpgradeChannel)
+	setIfNonEmpty(&c.Proxy.HTTPProxy, other.Proxy.HTTPProxy)
+	setIfNonEmpty(&c.Proxy.HTTPSProxy, other.Proxy.HTTPSProxy)
+	setIfNonEmpty(&c.Proxy.NoProxy, other.Proxy.NoProxy)
+	if other.UpgradeChannelPolicy != nil {
+		c.UpgradeChannelPolicy = other.UpgradeChannelPolicy
+	}
+	c.Aliases = mergeMaps(c.Aliases, other.Aliases)
+	c.Mirrors = mergeMaps(c.Mirrors, other.Mirrors)
+	c.Env = mergeMaps(c.Env, other.Env)
+}
+
+func setIfNonEmpty(dst *string, val string) {
+	if val != "" {
+		*dst = val
+	}
+}
+
+func mergeMaps(a, b map[string]string) map[string]string {
+	if len(b) == 0 {
+		return a
+	}
+	out := maps.Clone(a)
+	if out == nil {
+		out = make(map[string]string, len(b))
+	}
+	maps.Copy(out, b)
+	return out
+}
+
+// EnvDefaults returns the environment variables that c sets defaults for.
+func (c *Config) EnvDefaults() map[string]string {
+	out := maps.Clone(c.Env)
+	if out == nil {
+		out = make(map[string]string)
+	}
+	for name, val := range map[string]string{
+		"ABC_GIT_PROTOCOL":    c.GitProtocol,
+		backups.EnvVar:        c.BackupDir,
+		messages.EnvVar:       c.MessagesFile,
+		"ABC_UPGRADE_CHANNEL": c.UpgradeChannel,
+		"HTTP_PROXY":          c.Proxy.HTTPProxy,
+		"HTTPS_PROXY":         c.Proxy.HTTPSProxy,
+		"NO_PROXY":            c.Proxy.NoProxy,
+	} {
+		if val != "" {
+			out[name] = val
+		}
+	}
+	if len(c.Mirrors) > 0 {
+		out[MirrorsEnvVar] = c.Mirrors.String()
+	}
+	return out
+}
+
+// ApplyEnvDefaults sets each environment variable that c has a default for,
+// unless it's already set. This is how config files take effect: every flag
+// with an environment variable falls back to it.
+func (c *Config) ApplyEnvDefaults(lookupEnv func(string) (string, bool), setenv func(string, string) error) error {
+	for name, val := range c.EnvDefaults() {
+		if _, ok := lookupEnv(name); ok {
+			continue
+		}
+		// The proxy variables are also commonly set in lowercase, which takes
+		// effect the same way.
+		if strings.HasSuffix(name, "_PROXY") {
+			if _, ok := lookupEnv(strings.ToLower(name)); ok {
+				continue
+			}
+		}
+		if err := setenv(name, val); err != nil {
+			return fmt.Errorf("failed setting %s from config file: %w", name, err)
+		}
+	}
+	return nil
+}
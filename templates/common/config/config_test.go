@@ -0,0 +1,346 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestLoadFiles(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		missing bool
+		user    string
+		repo    string
+		want    *Config
+		wantErr string
+	}{
+		{
+			name:    "nonexistent_files",
+			missing: true,
+			want:    &Config{},
+		},
+		{
+			name: "empty_files",
+			user: "",
+			repo: "",
+			want: &Config{},
+		},
+		{
+			name: "user_only",
+			user: `git_protocol: 'ssh'
+upgrade_channel: 'main'
+aliases:
+  rest: 'github.com/abcxyz/abc/t/rest_server@latest'
+proxy:
+  https_proxy: 'http://proxy:3128'
+env:
+  ABC_LOG_LEVEL: 'debug'
+`,
+			want: &Config{
+				GitProtocol:    "ssh",
+				UpgradeChannel: "main",
+				Aliases:        map[string]string{"rest": "github.com/abcxyz/abc/t/rest_server@latest"},
+				Proxy:          Proxy{HTTPSProxy: "http://proxy:3128"},
+				Env:            map[string]string{"ABC_LOG_LEVEL": "debug"},
+			},
+		},
+		{
+			name: "repo_overrides_user",
+			user: `git_protocol: 'ssh'
+upgrade_channel: 'main'
+aliases:
+  rest: 'user-rest'
+  react: 'user-react'
+env:
+  ABC_LOG_LEVEL: 'debug'
+`,
+			repo: `git_protocol: 'https'
+aliases:
+  rest: 'repo-rest'
+env:
+  ABC_ACCEPT_DEFAULTS: 'true'
+`,
+			want: &Config{
+				GitProtocol:    "https",
+				UpgradeChannel: "main",
+				Aliases:        map[string]string{"rest": "repo-rest", "react": "user-react"},
+				Env:            map[string]string{"ABC_LOG_LEVEL": "debug", "ABC_ACCEPT_DEFAULTS": "true"},
+			},
+		},
+		{
+			name: "repo_policy_replaces_user_policy",
+			user: "upgrade_channel_policy:\n  allowed: ['main', 'latest']\n",
+			repo: "upgrade_channel_policy:\n  allowed: ['latest']\n",
+			want: &Config{
+				UpgradeChannelPolicy: &UpgradeChannelPolicy{
+					Allowed: []string{"latest"},
+					File:    "REPO/.abc.yaml",
+				},
+			},
+		},
+		{
+			name:    "invalid_policy_pattern",
+			repo:    "upgrade_channel_policy:\n  allowed: ['release-[']\n",
+			wantErr: `has an invalid upgrade channel pattern "release-["`,
+		},
+		{
+			name: "mirrors_merge",
+			user: "mirrors:\n  'github.com/abcxyz/*': 'user-mirror/abcxyz/*'\n  'github.com/foo/bar': 'user-mirror/bar'\n",
+			repo: "mirrors:\n  'github.com/abcxyz/*': 'repo-mirror/abcxyz/*'\n",
+			want: &Config{
+				Mirrors: Mirrors{
+					"github.com/abcxyz/*": "repo-mirror/abcxyz/*",
+					"github.com/foo/bar":  "user-mirror/bar",
+				},
+			},
+		},
+		{
+			name:    "invalid_mirror",
+			repo:    "mirrors:\n  'github.com/abcxyz/*': 'repo-mirror/abcxyz'\n",
+			wantErr: `must either end in "*" on both sides or neither`,
+		},
+		{
+			name: "relative_backup_dir",
+			repo: "backup_dir: 'backups'\n",
+			want: &Config{BackupDir: "REPO/backups"},
+		},
+		{
+			name: "relative_messages_file",
+			repo: "messages_file: 'messages.yaml'\n",
+			want: &Config{MessagesFile: "REPO/messages.yaml"},
+		},
+		{
+			name:    "unknown_field",
+			user:    "git_protocl: 'ssh'\n",
+			wantErr: "field git_protocl not found",
+		},
+		{
+			name:    "non_abc_env",
+			repo:    "env:\n  PATH: '/evil'\n",
+			wantErr: `sets the environment variable "PATH", but only variables starting with ABC_ may be set`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			if !tc.missing {
+				abctestutil.WriteAll(t, tempDir, map[string]string{
+					"user/config.yaml": tc.user,
+					"repo/.abc.yaml":   tc.repo,
+				})
+			}
+
+			got, err := LoadFiles(
+				filepath.Join(tempDir, "user", "config.yaml"),
+				filepath.Join(tempDir, "repo", ".abc.yaml"))
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			if tc.want.BackupDir != "" {
+				tc.want.BackupDir = filepath.Join(tempDir, "repo", filepath.Base(tc.want.BackupDir))
+			}
+			if tc.want.MessagesFile != "" {
+				tc.want.MessagesFile = filepath.Join(tempDir, "repo", filepath.Base(tc.want.MessagesFile))
+			}
+			if p := tc.want.UpgradeChannelPolicy; p != nil {
+				p.File = filepath.Join(tempDir, "repo", filepath.Base(p.File))
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("config was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestFindRepoFile(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name  string
+		files map[string]string
+		cwd   string
+		want  string
+	}{
+		{
+			name:  "in_cwd",
+			files: map[string]string{"repo/.git/HEAD": "", "repo/.abc.yaml": ""},
+			cwd:   "repo",
+			want:  "repo/.abc.yaml",
+		},
+		{
+			name:  "in_parent",
+			files: map[string]string{"repo/.git/HEAD": "", "repo/.abc.yaml": "", "repo/a/b/file.txt": ""},
+			cwd:   "repo/a/b",
+			want:  "repo/.abc.yaml",
+		},
+		{
+			name:  "nearest_wins",
+			files: map[string]string{"repo/.git/HEAD": "", "repo/.abc.yaml": "", "repo/a/.abc.yaml": "", "repo/a/b/file.txt": ""},
+			cwd:   "repo/a/b",
+			want:  "repo/a/.abc.yaml",
+		},
+		{
+			name:  "stops_at_git_root",
+			files: map[string]string{".abc.yaml": "", "repo/.git/HEAD": "", "repo/a/file.txt": ""},
+			cwd:   "repo/a",
+			want:  "",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			abctestutil.WriteAll(t, tempDir, tc.files)
+
+			got, err := FindRepoFile(filepath.Join(tempDir, tc.cwd))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tc.want
+			if want != "" {
+				want = filepath.Join(tempDir, want)
+			}
+			if got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestApplyEnvDefaults(t *testing.T) {
+	t.Parallel()
+
+	cfg := &Config{
+		GitProtocol:    "ssh",
+		BackupDir:      "/backups",
+		MessagesFile:   "/messages.yaml",
+		UpgradeChannel: "main",
+		Proxy: Proxy{
+			HTTPProxy:  "http://proxy:3128",
+			HTTPSProxy: "http://proxy:3128",
+		},
+		Env: map[string]string{
+			"ABC_LOG_LEVEL":       "debug",
+			"ABC_ACCEPT_DEFAULTS": "true",
+		},
+	}
+	env := map[string]string{
+		"ABC_GIT_PROTOCOL": "https",
+		"ABC_LOG_LEVEL":    "warn",
+		"https_proxy":      "http://other:3128",
+	}
+
+	if err := cfg.ApplyEnvDefaults(cli.MapLookuper(env), func(name, val string) error {
+		env[name] = val
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		// Already set, so not overridden.
+		"ABC_GIT_PROTOCOL": "https",
+		"ABC_LOG_LEVEL":    "warn",
+		"https_proxy":      "http://other:3128",
+
+		// Set from the config.
+		"ABC_BACKUP_DIR":      "/backups",
+		"ABC_MESSAGES_FILE":   "/messages.yaml",
+		"ABC_UPGRADE_CHANNEL": "main",
+		"ABC_ACCEPT_DEFAULTS": "true",
+		"HTTP_PROXY":          "http://proxy:3128",
+	}
+	if diff := cmp.Diff(env, want); diff != "" {
+		t.Errorf("environment was not as expected (-got,+want): %s", diff)
+	}
+}
+
+func TestUpgradeChannelPolicy_Check(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		policy  *UpgradeChannelPolicy
+		channel string
+		wantErr string
+	}{
+		{
+			name:    "nil_policy",
+			channel: "main",
+		},
+		{
+			name:    "exact_match",
+			policy:  &UpgradeChannelPolicy{Allowed: []string{"latest"}},
+			channel: "latest",
+		},
+		{
+			name:    "pattern_match",
+			policy:  &UpgradeChannelPolicy{Allowed: []string{"latest", "release/*"}},
+			channel: "release/v2",
+		},
+		{
+			name:    "empty_channel",
+			policy:  &UpgradeChannelPolicy{Allowed: []string{"latest"}},
+			channel: "",
+		},
+		{
+			name:    "not_allowed",
+			policy:  &UpgradeChannelPolicy{Allowed: []string{"latest"}, File: "/repo/.abc.yaml"},
+			channel: "main",
+			wantErr: `the upgrade channel "main" isn't allowed by the upgrade_channel_policy in "/repo/.abc.yaml", which only allows latest`,
+		},
+		{
+			name:    "empty_allowed_list",
+			policy:  &UpgradeChannelPolicy{File: "/repo/.abc.yaml"},
+			channel: "latest",
+			wantErr: `the upgrade channel "latest" isn't allowed`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tc.policy.Check(tc.channel)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MirrorsEnvVar is the environment variable through which the mirrors from
+// config files reach the code that downloads templates. Its value is one
+// "from=to" pair per line.
+const MirrorsEnvVar = "ABC_SOURCE_MIRRORS"
+
+// Mirrors maps the git repos of template sources, like
+// "github.com/abcxyz/abc", to the repos that they're actually downloaded from,
+// like "git.internal.corp/mirror/abcxyz/abc". This lets environments without
+// access to the upstream repo use an internal mirror, while manifests still
+// record the upstream location.
+//
+// A key ending in "/*" matches every repo under that prefix, and its value
+// must also end in "*", which is replaced by the rest of the repo path. The
+// most specific key wins. A value containing "://" is used as the git remote
+// as-is; otherwise it's a "host/path" that's combined with --git-protocol.
+type Mirrors map[string]string
+
+// Rewrite returns the mirror for the given repo, like "github.com/abcxyz/abc",
+// or false if there's no mirror for it.
+func (m Mirrors) Rewrite(repo string) (string, bool) {
+	if to, ok := m[repo]; ok {
+		return to, true
+	}
+	var bestPrefix, bestTo string
+	for from, to := range m {
+		prefix, ok := strings.CutSuffix(from, "*")
+		if !ok || !strings.HasPrefix(repo, prefix) || len(prefix) <= len(bestPrefix) {
+			continue
+		}
+		bestPrefix, bestTo = prefix, to
+	}
+	if bestPrefix == "" {
+		return "", false
+	}
+	return strings.TrimSuffix(bestTo, "*") + repo[len(bestPrefix):], true
+}
+
+// String returns the mirrors in the format of MirrorsEnvVar, sorted so the
+// output is deterministic.
+func (m Mirrors) String() string {
+	lines := make([]string, 0, len(m))
+	for from, to := range m {
+		lines = append(lines, from+"="+to)
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+func (m Mirrors) validate() error {
+	for from, to := range m {
+		if from == "" || to == "" {
+			return fmt.Errorf("the mirror %q -> %q must have both a source and a destination", from, to)
+		}
+		fromWild := strings.HasSuffix(from, "/*")
+		toWild := strings.HasSuffix(to, "*")
+		if strings.Count(from, "*") > 1 || (strings.Contains(from, "*") && !fromWild) || strings.Count(to, "*") > 1 || (strings.Contains(to, "*") && !toWild) {
+			return fmt.Errorf(`the mirror %q -> %q may only use "*" at the end of a path, like "github.com/abcxyz/*"`, from, to)
+		}
+		if fromWild != toWild {
+			return fmt.Errorf(`the mirror %q -> %q must either end in "*" on both sides or neither`, from, to)
+		}
+	}
+	return nil
+}
+
+// ParseMirrors parses mirrors in the format of MirrorsEnvVar.
+func ParseMirrors(s string) (Mirrors, error) {
+	out := Mirrors{}
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("the mirror %q must look like from=to", line)
+		}
+		out[strings.TrimSpace(from)] = strings.TrimSpace(to)
+	}
+	if err := out.validate(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MirrorsFromEnv returns the mirrors in $ABC_SOURCE_MIRRORS, or nil if it's
+// not set.
+func MirrorsFromEnv(lookupEnv func(string) (string, bool)) (Mirrors, error) {
+	val, ok := lookupEnv(MirrorsEnvVar)
+	if !ok || val == "" {
+		return nil, nil
+	}
+	out, err := ParseMirrors(val)
+	if err != nil {
+		return nil, fmt.Errorf("invalid $%s: %w", MirrorsEnvVar, err)
+	}
+	return out, nil
+}
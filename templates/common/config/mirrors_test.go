@@ -0,0 +1,159 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestMirrors_Rewrite(t *testing.T) {
+	t.Parallel()
+
+	mirrors := Mirrors{
+		"github.com/abcxyz/*":      "git.internal.corp/mirror/abcxyz/*",
+		"github.com/abcxyz/abc":    "git.internal.corp/special/abc",
+		"github.com/abcxyz/team/*": "git.internal.corp/team/*",
+		"gitlab.com/*":             "file:///srv/gitlab/*",
+	}
+
+	cases := []struct {
+		name   string
+		repo   string
+		want   string
+		wantOK bool
+	}{
+		{
+			name:   "wildcard",
+			repo:   "github.com/abcxyz/pkg",
+			want:   "git.internal.corp/mirror/abcxyz/pkg",
+			wantOK: true,
+		},
+		{
+			name:   "exact_beats_wildcard",
+			repo:   "github.com/abcxyz/abc",
+			want:   "git.internal.corp/special/abc",
+			wantOK: true,
+		},
+		{
+			name:   "longest_wildcard_wins",
+			repo:   "github.com/abcxyz/team/repo",
+			want:   "git.internal.corp/team/repo",
+			wantOK: true,
+		},
+		{
+			name:   "url",
+			repo:   "gitlab.com/foo/bar",
+			want:   "file:///srv/gitlab/foo/bar",
+			wantOK: true,
+		},
+		{
+			name: "no_match",
+			repo: "github.com/other/repo",
+		},
+		{
+			name: "prefix_is_not_a_match",
+			repo: "github.com/abcxyzzz/repo",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := mirrors.Rewrite(tc.repo)
+			if got != tc.want || ok != tc.wantOK {
+				t.Errorf("Rewrite(%q)=(%q, %t), want (%q, %t)", tc.repo, got, ok, tc.want, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestParseMirrors(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		in      string
+		want    Mirrors
+		wantErr string
+	}{
+		{
+			name: "success",
+			in:   "github.com/abcxyz/*=git.internal.corp/abcxyz/*\n\n github.com/foo/bar = git.internal.corp/bar \n",
+			want: Mirrors{
+				"github.com/abcxyz/*": "git.internal.corp/abcxyz/*",
+				"github.com/foo/bar":  "git.internal.corp/bar",
+			},
+		},
+		{
+			name: "empty",
+			want: Mirrors{},
+		},
+		{
+			name:    "missing_equals",
+			in:      "github.com/foo/bar",
+			wantErr: "must look like from=to",
+		},
+		{
+			name:    "empty_destination",
+			in:      "github.com/foo/bar=",
+			wantErr: "must have both a source and a destination",
+		},
+		{
+			name:    "wildcard_on_one_side",
+			in:      "github.com/foo/*=git.internal.corp/foo",
+			wantErr: `must either end in "*" on both sides or neither`,
+		},
+		{
+			name:    "wildcard_in_the_middle",
+			in:      "github.com/*/bar=git.internal.corp/*/bar",
+			wantErr: `may only use "*" at the end of a path`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseMirrors(tc.in)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("mirrors were not as expected (-got,+want): %s", diff)
+			}
+			if tc.wantErr != "" {
+				return
+			}
+
+			// The String() form must parse back to the same mirrors.
+			roundTrip, err := ParseMirrors(got.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(roundTrip, got); diff != "" {
+				t.Errorf("mirrors didn't round trip through String() (-got,+want): %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,327 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package destlock is an advisory lock on a destination directory, so that
+// two renders or upgrades of the same directory, like two CI jobs, don't
+// interleave their writes and corrupt the manifest.
+//
+// The lock is a file at .abc/lock in the destination directory, created
+// exclusively. It records who holds the lock, so that a lock left behind by a
+// process that crashed can be detected as stale and broken. A stale lock is
+// broken by renaming it aside and checking that it's still the one that was
+// found stale, so that two processes breaking the same stale lock can't delete
+// each other's fresh locks.
+package destlock
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/pkg/logging"
+)
+
+const (
+	// FileName is the name of the lock file in the .abc directory.
+	FileName = "lock"
+
+	// DefaultStaleAfter is how old a lock must be before it's considered
+	// stale even if its holder might still be running, e.g. on another host.
+	DefaultStaleAfter = time.Hour
+
+	// pollInterval is how often to retry while waiting for the lock.
+	pollInterval = 500 * time.Millisecond
+)
+
+// ErrLocked is returned, wrapped, when the lock is held by someone else and
+// Params.Wait was exceeded.
+var ErrLocked = errors.New("destination is locked by another abc process")
+
+// Holder is the contents of the lock file.
+type Holder struct {
+	// Operation is what the holder is doing, like "render" or "upgrade".
+	Operation string `yaml:"operation"`
+
+	// PID is the process ID of the holder, on Hostname.
+	PID int `yaml:"pid"`
+
+	Hostname string `yaml:"hostname"`
+
+	AcquiredAt time.Time `yaml:"acquired_at"`
+}
+
+// Params contains the arguments to Acquire.
+type Params struct {
+	// Clock is optional, and defaults to the real clock. Callers shouldn't
+	// pass a clock that's frozen, like the one used by --reproducible, since
+	// lock ages are compared across processes.
+	Clock clock.Clock
+
+	FS common.FS
+
+	// Dir is the destination directory to lock.
+	Dir string
+
+	// Operation is recorded in the lock file, for error messages.
+	Operation string
+
+	// Wait is how long to wait for a lock held by someone else to be
+	// released. Zero means fail immediately.
+	Wait time.Duration
+
+	// StaleAfter overrides DefaultStaleAfter. Optional.
+	StaleAfter time.Duration
+}
+
+// Lock is a held lock. Call Release when done.
+type Lock struct {
+	fs         common.FS
+	dir        string
+	path       string
+	createdDir string
+}
+
+// Path returns the path of the lock file.
+func Path(dir string) string {
+	return filepath.Join(dir, common.ABCInternalDir, FileName)
+}
+
+// Acquire takes the lock on p.Dir, waiting up to p.Wait for a lock held by
+// someone else to be released. A lock whose holder is no longer running on
+// this host, or that is older than p.StaleAfter, is broken.
+func Acquire(ctx context.Context, p *Params) (*Lock, error) {
+	logger := logging.FromContext(ctx).With("logger", "destlock.Acquire")
+
+	clk := p.Clock
+	if clk == nil {
+		clk = clock.New()
+	}
+	staleAfter := common.FirstNonZero(p.StaleAfter, DefaultStaleAfter)
+	lockPath := Path(p.Dir)
+
+	hostname, _ := os.Hostname() //nolint:errcheck // an empty hostname only means the lock can't be found stale by PID
+	buf, err := yaml.Marshal(&Holder{
+		Operation:  p.Operation,
+		PID:        os.Getpid(),
+		Hostname:   hostname,
+		AcquiredAt: clk.Now().UTC(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed marshaling lock file contents: %w", err)
+	}
+
+	deadline := clk.Now().Add(p.Wait)
+	for {
+		// The .abc directory is created each time around, since another
+		// process releasing its lock may have removed it.
+		createdDir, err := ensureDir(p.FS, filepath.Dir(lockPath))
+		if err != nil {
+			return nil, err
+		}
+		created, err := createExclusive(p.FS, lockPath, buf)
+		if err != nil {
+			return nil, err
+		}
+		if created {
+			return &Lock{fs: p.FS, dir: p.Dir, path: lockPath, createdDir: createdDir}, nil
+		}
+
+		holder, raw, err := readHolder(p.FS, lockPath)
+		if err != nil {
+			if common.IsNotExistErr(err) {
+				continue // released between our create and read
+			}
+			return nil, err
+		}
+		if reason := staleReason(clk.Now(), holder, hostname, staleAfter); reason != "" {
+			logger.WarnContext(ctx, "breaking stale lock",
+				"path", lockPath,
+				"reason", reason,
+				"holder_pid", holder.PID,
+				"holder_hostname", holder.Hostname,
+				"acquired_at", holder.AcquiredAt)
+			if err := breakStale(ctx, p.FS, lockPath, raw); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if !clk.Now().Before(deadline) {
+			return nil, fmt.Errorf("%w: %s is held by %q (pid %d on host %q) since %s; wait for it to finish, use --wait, or delete the lock file if that process is gone",
+				ErrLocked, lockPath, holder.Operation, holder.PID, holder.Hostname, holder.AcquiredAt.Format(time.RFC3339))
+		}
+		logger.InfoContext(ctx, "waiting for lock",
+			"path", lockPath,
+			"holder_operation", holder.Operation,
+			"holder_pid", holder.PID)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("interrupted while waiting for lock %s: %w", lockPath, ctx.Err())
+		case <-clk.After(pollInterval):
+		}
+	}
+}
+
+// Release removes the lock file, and the .abc directory if Acquire created it
+// and it's still empty. If keepDir is false, the locked directory and its
+// parents are also removed if Acquire created them and they're empty, so that
+// a failed render into a new destination directory doesn't leave it behind.
+func (l *Lock) Release(keepDir bool) error {
+	if err := l.fs.Remove(l.path); err != nil && !common.IsNotExistErr(err) {
+		return fmt.Errorf("failed releasing lock: Remove(%s): %w", l.path, err)
+	}
+	if l.createdDir == "" {
+		return nil
+	}
+	for d := filepath.Dir(l.path); ; d = filepath.Dir(d) {
+		if keepDir && d == l.dir {
+			break
+		}
+		// This fails harmlessly if something was written to the directory.
+		if err := l.fs.Remove(d); err != nil || d == l.createdDir {
+			break
+		}
+	}
+	return nil
+}
+
+// ensureDir creates dir and any missing parents, returning the outermost
+// directory that it created, or "" if dir already existed.
+func ensureDir(fs common.FS, dir string) (string, error) {
+	var created string
+	for d := dir; ; d = filepath.Dir(d) {
+		_, err := fs.Stat(d)
+		if err == nil {
+			break
+		}
+		if !common.IsNotExistErr(err) {
+			return "", fmt.Errorf("Stat(%s): %w", d, err)
+		}
+		created = d
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	if created == "" {
+		return "", nil
+	}
+	if err := fs.MkdirAll(dir, common.OwnerRWXPerms); err != nil {
+		return "", fmt.Errorf("MkdirAll(%s): %w", dir, err)
+	}
+	return created, nil
+}
+
+// createExclusive creates the lock file with the given contents, returning
+// false if it already exists.
+func createExclusive(fs common.FS, path string, buf []byte) (bool, error) {
+	fh, err := fs.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, common.OwnerRWPerms)
+	if err != nil {
+		// ErrNotExist means the directory was removed by another process
+		// releasing its lock since we created it, so try again.
+		if errors.Is(err, os.ErrExist) || errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed creating lock file: %w", err)
+	}
+	_, err = fh.Write(buf)
+	if err = errors.Join(err, fh.Close()); err != nil {
+		return false, fmt.Errorf("failed writing lock file %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// readHolder reads the lock file, returning both the parsed holder and the raw
+// contents. A lock file that can't be parsed, like one that was only partly
+// written, is treated as held by an unknown process since the time it was last
+// modified.
+func readHolder(fs common.FS, path string) (*Holder, []byte, error) {
+	buf, err := fs.ReadFile(path)
+	if err != nil {
+		return nil, nil, err //nolint:wrapcheck // the caller checks for not-exist
+	}
+	holder := &Holder{}
+	if err := yaml.Unmarshal(buf, holder); err != nil || holder.AcquiredAt.IsZero() {
+		fi, statErr := fs.Stat(path)
+		if statErr != nil {
+			return nil, nil, statErr //nolint:wrapcheck
+		}
+		return &Holder{AcquiredAt: fi.ModTime()}, buf, nil
+	}
+	return holder, buf, nil
+}
+
+// breakStale removes the stale lock file whose contents were staleContents.
+// Removing it by path would race with another process that broke the same
+// stale lock first and then created its own lock: we'd delete that fresh lock,
+// and both processes would think they hold it. So the lock file is atomically
+// renamed to a unique name first, which only one process can do, and then
+// checked. If what was renamed is a fresh lock rather than the stale one, it's
+// put back.
+func breakStale(ctx context.Context, fs common.FS, lockPath string, staleContents []byte) error {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Errorf("failed generating a name for the stale lock file: %w", err)
+	}
+	asidePath := lockPath + ".stale-" + hex.EncodeToString(suffix)
+	if err := fs.Rename(lockPath, asidePath); err != nil {
+		if common.IsNotExistErr(err) {
+			return nil // someone else broke or released it first
+		}
+		return fmt.Errorf("failed renaming stale lock file: %w", err)
+	}
+
+	got, err := fs.ReadFile(asidePath)
+	if err != nil {
+		return fmt.Errorf("failed reading stale lock file: %w", err)
+	}
+	if !bytes.Equal(got, staleContents) {
+		// Another process broke the stale lock and took the lock between our
+		// read and our rename. Give it back. This only fails if yet another
+		// process created a lock in the instant since our rename.
+		logging.FromContext(ctx).WarnContext(ctx, "lock changed while breaking it, restoring it",
+			"path", lockPath)
+		created, err := createExclusive(fs, lockPath, got)
+		if err != nil {
+			return err
+		}
+		if !created {
+			return fmt.Errorf("failed restoring lock file %s after it was taken while breaking a stale lock; another abc process may be running on this destination", lockPath)
+		}
+	}
+	if err := fs.Remove(asidePath); err != nil && !common.IsNotExistErr(err) {
+		return fmt.Errorf("failed removing stale lock file: %w", err)
+	}
+	return nil
+}
+
+// staleReason returns why the lock is stale, or "" if it isn't.
+func staleReason(now time.Time, h *Holder, hostname string, staleAfter time.Duration) string {
+	if age := now.Sub(h.AcquiredAt); age > staleAfter {
+		return fmt.Sprintf("older than %s", staleAfter)
+	}
+	if h.PID != 0 && hostname != "" && h.Hostname == hostname && !processExists(h.PID) {
+		return "holder process is no longer running"
+	}
+	return ""
+}
@@ -0,0 +1,316 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destlock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/common"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestAcquire(t *testing.T) {
+	t.Parallel()
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 3, 1, 4, 5, 6, 0, time.UTC)
+
+	cases := []struct {
+		name     string
+		existing *Holder
+		wait     time.Duration
+		wantErr  string
+	}{
+		{
+			name: "unlocked",
+		},
+		{
+			name: "held_by_running_process",
+			existing: &Holder{
+				Operation:  "upgrade",
+				PID:        os.Getpid(),
+				Hostname:   hostname,
+				AcquiredAt: now.Add(-time.Minute),
+			},
+			wantErr: `is held by "upgrade"`,
+		},
+		{
+			name: "held_on_other_host",
+			existing: &Holder{
+				Operation:  "render",
+				PID:        1 << 30,
+				Hostname:   "some-other-host",
+				AcquiredAt: now.Add(-time.Minute),
+			},
+			wantErr: `is held by "render"`,
+		},
+		{
+			name: "stale_because_process_is_gone",
+			existing: &Holder{
+				Operation:  "upgrade",
+				PID:        1 << 30,
+				Hostname:   hostname,
+				AcquiredAt: now.Add(-time.Minute),
+			},
+		},
+		{
+			name: "stale_because_old",
+			existing: &Holder{
+				Operation:  "upgrade",
+				PID:        os.Getpid(),
+				Hostname:   "some-other-host",
+				AcquiredAt: now.Add(-2 * DefaultStaleAfter),
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if tc.name == "stale_because_process_is_gone" && !processExists(os.Getpid()) {
+				t.Skip("can't detect running processes on this platform")
+			}
+
+			ctx := context.Background()
+			dir := t.TempDir()
+			if tc.existing != nil {
+				buf, err := yaml.Marshal(tc.existing)
+				if err != nil {
+					t.Fatal(err)
+				}
+				abctestutil.WriteAll(t, dir, map[string]string{
+					filepath.Join(common.ABCInternalDir, FileName): string(buf),
+				})
+			}
+
+			clk := clock.NewMock()
+			clk.Set(now)
+			lock, err := Acquire(ctx, &Params{
+				Clock:     clk,
+				FS:        &common.RealFS{},
+				Dir:       dir,
+				Operation: "render",
+				Wait:      tc.wait,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrLocked) {
+					t.Errorf("got error %v, want one wrapping ErrLocked", err)
+				}
+				return
+			}
+
+			holder, _, err := readHolder(&common.RealFS{}, Path(dir))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if holder.PID != os.Getpid() || holder.Operation != "render" || !holder.AcquiredAt.Equal(now) {
+				t.Errorf("lock file has holder %+v, want this process doing a render at %s", holder, now)
+			}
+
+			if err := lock.Release(true); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(Path(dir)); !common.IsNotExistErr(err) {
+				t.Errorf("lock file still exists after Release(): %v", err)
+			}
+		})
+	}
+}
+
+func TestAcquire_Wait(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	params := &Params{
+		Clock:     clock.New(),
+		FS:        &common.RealFS{},
+		Dir:       dir,
+		Operation: "upgrade",
+	}
+	first, err := Acquire(ctx, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(2 * pollInterval)
+		if err := first.Release(true); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	waitParams := *params
+	waitParams.Wait = time.Minute
+	second, err := Acquire(ctx, &waitParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Release(true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAcquire_ConcurrentWithStaleLock(t *testing.T) {
+	t.Parallel()
+
+	// Several processes all find the same stale lock and try to break it. Only
+	// one of them at a time may ever think it holds the lock.
+	const acquirers = 4
+	for round := 0; round < 3; round++ {
+		dir := t.TempDir()
+		buf, err := yaml.Marshal(&Holder{
+			Operation:  "upgrade",
+			PID:        1 << 30,
+			Hostname:   "some-other-host",
+			AcquiredAt: time.Now().Add(-2 * DefaultStaleAfter),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		abctestutil.WriteAll(t, dir, map[string]string{
+			filepath.Join(common.ABCInternalDir, FileName): string(buf),
+		})
+
+		var holding atomic.Int32
+		var wg sync.WaitGroup
+		for i := 0; i < acquirers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				lock, err := Acquire(context.Background(), &Params{
+					Clock:     clock.New(),
+					FS:        &common.RealFS{},
+					Dir:       dir,
+					Operation: "render",
+					Wait:      time.Minute,
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if n := holding.Add(1); n > 1 {
+					t.Errorf("%d acquirers hold the lock at once, want at most 1", n)
+				}
+				time.Sleep(10 * time.Millisecond)
+				holding.Add(-1)
+				if err := lock.Release(true); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		entries, err := os.ReadDir(filepath.Join(dir, common.ABCInternalDir))
+		if err != nil && !common.IsNotExistErr(err) {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			t.Errorf("file %q was left behind in the .abc directory", e.Name())
+		}
+	}
+}
+
+func TestRelease_RemovesCreatedDirs(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name        string
+		destDir     string
+		existingDir bool
+		keepDir     bool
+		wantDir     string
+	}{
+		{
+			name: "created",
+		},
+		{
+			name:        "already_existed",
+			existingDir: true,
+			wantDir:     common.ABCInternalDir,
+		},
+		{
+			name:    "dest_dir_created",
+			destDir: "new/dest",
+		},
+		{
+			name:    "dest_dir_created_and_kept",
+			destDir: "new/dest",
+			keepDir: true,
+			wantDir: "new",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			dir := filepath.Join(tempDir, tc.destDir)
+			internalDir := filepath.Join(dir, common.ABCInternalDir)
+			if tc.existingDir {
+				if err := os.Mkdir(internalDir, common.OwnerRWXPerms); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			lock, err := Acquire(context.Background(), &Params{
+				Clock: clock.NewMock(),
+				FS:    &common.RealFS{},
+				Dir:   dir,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := lock.Release(tc.keepDir); err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := os.ReadDir(tempDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var gotDir string
+			if len(entries) > 0 {
+				gotDir = entries[0].Name()
+			}
+			if gotDir != tc.wantDir {
+				t.Errorf("after Release(), got directory %q left behind, want %q", gotDir, tc.wantDir)
+			}
+		})
+	}
+}
@@ -15,22 +15,101 @@
 package dirhash
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	"golang.org/x/mod/sumdb/dirhash"
+
+	"github.com/abcxyz/abc/templates/common"
 )
 
-var latestHash = dirhash.Hash1
+var latestHash dirhash.Hash = hash1Parallel
+
+// hash1Parallel computes the same "h1:" hash as dirhash.Hash1, but hashes the
+// files concurrently, since hashing dominates the time taken to upgrade and
+// render large templates.
+func hash1Parallel(files []string, open func(string) (io.ReadCloser, error)) (string, error) {
+	files = append([]string(nil), files...)
+	sort.Strings(files)
+
+	sums := make([][]byte, len(files))
+	if err := common.ForEachParallel(len(files), 0, func(i int) error {
+		if strings.Contains(files[i], "\n") {
+			return errors.New("dirhash: filenames with newlines are not supported")
+		}
+		r, err := open(files[i])
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		h := sha256.New()
+		if _, err := common.PooledCopy(h, r); err != nil {
+			return err //nolint:wrapcheck
+		}
+		sums[i] = h.Sum(nil)
+		return nil
+	}); err != nil {
+		return "", err //nolint:wrapcheck
+	}
+
+	// The per-file hashes are combined in sorted filename order, exactly like
+	// dirhash.Hash1.
+	h := sha256.New()
+	for i, file := range files {
+		fmt.Fprintf(h, "%x  %s\n", sums[i], file)
+	}
+	return "h1:" + base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
 
 // HashLatest computes a dirhash of the given directory using the latest/best
 // hash algorithm.
 func HashLatest(dir string) (string, error) {
-	out, err := dirhash.HashDir(dir, "", latestHash)
+	return HashLatestWithSubmodules(dir, nil)
+}
+
+// HashLatestWithSubmodules is like HashLatest, but the hash also covers the
+// given git submodule commit SHAs, which are keyed by slash-separated path
+// relative to dir. This way, bumping a submodule changes the hash even when
+// the submodule's files weren't downloaded.
+func HashLatestWithSubmodules(dir string, submodules map[string]string) (string, error) {
+	return hashDir(&common.RealFS{}, dir, submodules, latestHash)
+}
+
+// HashLatestFS is like HashLatestWithSubmodules, but reads dir from the given
+// FS, which might not be the local disk.
+func HashLatestFS(fsys common.FS, dir string, submodules map[string]string) (string, error) {
+	return hashDir(fsys, dir, submodules, latestHash)
+}
+
+// hashDir is like dirhash.HashDir, except that each of the given submodules
+// is hashed as if it were a file at the submodule path containing its SHA.
+// That can't collide with a real file, because the submodule path is a
+// directory. With no submodules, the result is the same as dirhash.HashDir.
+func hashDir(fsys common.FS, dir string, submodules map[string]string, hash dirhash.Hash) (string, error) {
+	files, err := dirFiles(fsys, dir)
+	if err != nil {
+		return "", fmt.Errorf("dirhash.DirFiles: %w", err)
+	}
+	for path := range submodules {
+		files = append(files, path)
+	}
+	open := func(name string) (io.ReadCloser, error) {
+		if sha, ok := submodules[name]; ok {
+			return io.NopCloser(strings.NewReader(sha)), nil
+		}
+		return fsys.Open(filepath.Join(dir, filepath.FromSlash(name))) //nolint:wrapcheck
+	}
+	out, err := hash(files, open)
 	if err != nil {
 		return "", fmt.Errorf("dirhash.HashDir: %w", err)
 	}
-
 	return out, nil
 }
 
@@ -38,6 +117,12 @@ func HashLatest(dir string) (string, error) {
 // hash value. It detects which hash algorithm to use based on a prefix of
 // wantHash, e.g. "h1:0a1b2d3c..." .
 func Verify(wantHash, dir string) (bool, error) {
+	return VerifyWithSubmodules(wantHash, dir, nil)
+}
+
+// VerifyWithSubmodules is like Verify, but for a hash that was computed by
+// HashLatestWithSubmodules.
+func VerifyWithSubmodules(wantHash, dir string, submodules map[string]string) (bool, error) {
 	// The hash should start with a string like "h1:" indicating the hash algorithm
 	tokens := strings.SplitN(wantHash, ":", 2)
 	if len(tokens) != 2 {
@@ -48,15 +133,43 @@ func Verify(wantHash, dir string) (bool, error) {
 	switch tokens[0] {
 	// We could theoretically add other hash algorithms in the future if needed.
 	case "h1":
-		hash = dirhash.Hash1
+		hash = hash1Parallel
 	default:
 		return false, fmt.Errorf("unknown hash algorithm %q", tokens[0])
 	}
 
-	gotHash, err := dirhash.HashDir(dir, "", hash)
+	gotHash, err := hashDir(&common.RealFS{}, dir, submodules, hash)
 	if err != nil {
-		return false, fmt.Errorf("dirhash.HashDir: %w", err)
+		return false, err
 	}
 
 	return gotHash == wantHash, nil
 }
+
+// dirFiles is like dirhash.DirFiles with an empty prefix, but reads from the
+// given FS. It returns the slash-separated paths of the regular files under
+// dir, and fails on anything that's neither a regular file nor a directory.
+func dirFiles(fsys common.FS, dir string) ([]string, error) {
+	var files []string
+	err := fs.WalkDir(fsys, dir, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if de.IsDir() {
+			return nil
+		}
+		if !de.Type().IsRegular() {
+			return fmt.Errorf("%s is not a regular file", path)
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return fmt.Errorf("filepath.Rel(%s,%s): %w", dir, path, err)
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	return files, nil
+}
@@ -15,9 +15,14 @@
 package dirhash
 
 import (
+	"fmt"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 
+	"golang.org/x/mod/sumdb/dirhash"
+
 	abctestutil "github.com/abcxyz/abc/templates/testutil"
 	"github.com/abcxyz/pkg/testutil"
 )
@@ -67,6 +72,63 @@ func TestHashLatest(t *testing.T) {
 	}
 }
 
+func TestHashLatestWithSubmodules(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	abctestutil.WriteAll(t, tempDir, map[string]string{
+		"a.txt":    "hello",
+		"b/c.yaml": "foo: bar",
+	})
+
+	withoutSubmodules, err := HashLatest(tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name       string
+		submodules map[string]string
+		wantSame   bool
+	}{
+		{
+			name:     "nil",
+			wantSame: true,
+		},
+		{
+			name:       "one_submodule",
+			submodules: map[string]string{"shared": "0123456789012345678901234567890123456789"},
+		},
+		{
+			name:       "bumped_submodule",
+			submodules: map[string]string{"shared": "9876543210987654321098765432109876543210"},
+		},
+	}
+
+	seen := map[string]string{}
+	for _, tc := range cases {
+		got, err := HashLatestWithSubmodules(tempDir, tc.submodules)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if same := got == withoutSubmodules; same != tc.wantSame {
+			t.Errorf("%s: got hash %q, HashLatest() is %q, want same=%t", tc.name, got, withoutSubmodules, tc.wantSame)
+		}
+		if other, ok := seen[got]; ok {
+			t.Errorf("%s: got the same hash as %s", tc.name, other)
+		}
+		seen[got] = tc.name
+
+		ok, err := VerifyWithSubmodules(got, tempDir, tc.submodules)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Errorf("%s: VerifyWithSubmodules() didn't match the hash from HashLatestWithSubmodules()", tc.name)
+		}
+	}
+}
+
 func TestVerify(t *testing.T) {
 	t.Parallel()
 
@@ -126,3 +188,84 @@ func TestVerify(t *testing.T) {
 		})
 	}
 }
+
+func TestHash1Parallel(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name: "many_files",
+			files: func() map[string]string {
+				out := make(map[string]string, 100)
+				for i := 0; i < 100; i++ {
+					out[fmt.Sprintf("dir%d/file%d.txt", i%7, i)] = strings.Repeat("x", i*1000)
+				}
+				return out
+			}(),
+		},
+		{
+			name:  "empty_dir",
+			files: map[string]string{},
+		},
+		{
+			name: "newline_in_filename",
+			files: map[string]string{
+				"a\nb.txt": "hello",
+			},
+			wantErr: "filenames with newlines are not supported",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			abctestutil.WriteAll(t, tempDir, tc.files)
+
+			got, err := dirhash.HashDir(tempDir, "", hash1Parallel)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			want, err := dirhash.HashDir(tempDir, "", dirhash.Hash1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("hash1Parallel()=%q, but dirhash.Hash1()=%q", got, want)
+			}
+		})
+	}
+}
+
+func BenchmarkHashLatest(b *testing.B) {
+	const numFiles = 256
+	contents := make(map[string]string, numFiles)
+	for i := 0; i < numFiles; i++ {
+		contents[fmt.Sprintf("dir%d/file%d.txt", i%8, i)] = strings.Repeat("abc foo def\n", 4096)
+	}
+	dir := b.TempDir()
+	abctestutil.WriteAll(b, dir, contents)
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("gomaxprocs_%d", workers), func(b *testing.B) {
+			defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(workers))
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := HashLatest(dir); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
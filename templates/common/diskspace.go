@@ -0,0 +1,42 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"errors"
+	"path/filepath"
+)
+
+// ErrDiskSpaceUnsupported is returned by FreeDiskBytes on platforms where abc
+// doesn't know how to query the free space of a filesystem.
+var ErrDiskSpaceUnsupported = errors.New("checking free disk space isn't supported on this platform")
+
+// FreeDiskBytes returns the number of bytes available to unprivileged users on
+// the filesystem that path is on. The path doesn't need to exist yet; if it
+// doesn't, its nearest existing ancestor is used instead.
+func FreeDiskBytes(path string) (uint64, error) {
+	path = filepath.Clean(path)
+	for {
+		free, err := freeDiskBytes(path)
+		if err == nil || !IsNotExistErr(err) {
+			return free, err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return free, err
+		}
+		path = parent
+	}
+}
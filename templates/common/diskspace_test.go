@@ -0,0 +1,43 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestFreeDiskBytes(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	free, err := FreeDiskBytes(filepath.Join(tempDir, "does", "not", "exist"))
+	if errors.Is(err, ErrDiskSpaceUnsupported) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	freeInTemp, err := FreeDiskBytes(tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Other tests may be writing files concurrently, so only check that the
+	// nonexistent path resolved to a real filesystem.
+	if free == 0 || freeInTemp == 0 {
+		t.Errorf("got %d and %d free bytes, wanted both to be nonzero", free, freeInTemp)
+	}
+}
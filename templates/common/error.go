@@ -14,7 +14,53 @@
 
 package common
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
+
+// These are the process exit codes returned by the abc CLI. They're part of the
+// CLI's public contract, so that scripts can branch on the class of failure.
+// Never change the meaning of an existing exit code; only add new ones.
+const (
+	// ExitCodeGeneric is used for any error that doesn't have a more specific
+	// category.
+	ExitCodeGeneric = 1
+
+	// ExitCodePatchReversalConflict means that an upgrade couldn't cleanly
+	// undo a previous in-place modification and needs manual resolution.
+	ExitCodePatchReversalConflict = 2
+
+	// ExitCodeInputValidation means that the template inputs were missing,
+	// unknown, or failed validation rules.
+	ExitCodeInputValidation = 3
+
+	// ExitCodeDownload means that the template couldn't be downloaded or
+	// copied from its source.
+	ExitCodeDownload = 4
+
+	// ExitCodeOverwriteRefused means that the operation would have overwritten
+	// an existing file, and overwriting wasn't enabled.
+	ExitCodeOverwriteRefused = 5
+
+	// ExitCodeInternal means that there's a bug in abc.
+	ExitCodeInternal = 6
+
+	// ExitCodePolicyViolation means that the rendered output violated a rule
+	// in a policy file, so it wasn't written.
+	ExitCodePolicyViolation = 7
+
+	// ExitCodeOutputLimit means that the template's output exceeded one of the
+	// limits on the number or size of output files.
+	ExitCodeOutputLimit = 8
+
+	// ExitCodeGoldenTestFailure means that one or more golden tests failed.
+	ExitCodeGoldenTestFailure = 9
+
+	// ExitCodeMergeConflict means that an upgrade finished, but some files
+	// have merge conflicts that need manual resolution.
+	ExitCodeMergeConflict = 10
+)
 
 // An implementation of error that contains an command exit status. This is
 // intended to be returned from a Run() function when a command wants to
@@ -32,3 +78,126 @@ func (e *ExitCodeError) Error() string {
 func (e *ExitCodeError) Unwrap() error {
 	return e.Err
 }
+
+// ErrorCategory is a broad class of failure. Each category maps to a distinct
+// exit code.
+type ErrorCategory int
+
+const (
+	// CategoryUnknown is the zero value, for errors that haven't been
+	// categorized.
+	CategoryUnknown ErrorCategory = iota
+	CategoryInputValidation
+	CategoryDownload
+	CategoryOverwriteRefused
+	CategoryInternal
+	CategoryPolicyViolation
+	CategoryOutputLimit
+	CategoryGoldenTestFailure
+)
+
+// ExitCode returns the process exit code for this category of error.
+func (c ErrorCategory) ExitCode() int {
+	switch c {
+	case CategoryUnknown:
+		return ExitCodeGeneric
+	case CategoryInputValidation:
+		return ExitCodeInputValidation
+	case CategoryDownload:
+		return ExitCodeDownload
+	case CategoryOverwriteRefused:
+		return ExitCodeOverwriteRefused
+	case CategoryInternal:
+		return ExitCodeInternal
+	case CategoryPolicyViolation:
+		return ExitCodePolicyViolation
+	case CategoryOutputLimit:
+		return ExitCodeOutputLimit
+	case CategoryGoldenTestFailure:
+		return ExitCodeGoldenTestFailure
+	}
+	panic("unreachable") // the go lint exhaustive check prevents this
+}
+
+func (c ErrorCategory) String() string {
+	switch c {
+	case CategoryUnknown:
+		return "unknown"
+	case CategoryInputValidation:
+		return "input_validation"
+	case CategoryDownload:
+		return "download"
+	case CategoryOverwriteRefused:
+		return "overwrite_refused"
+	case CategoryInternal:
+		return "internal"
+	case CategoryPolicyViolation:
+		return "policy_violation"
+	case CategoryOutputLimit:
+		return "output_limit"
+	case CategoryGoldenTestFailure:
+		return "golden_test_failure"
+	}
+	panic("unreachable") // the go lint exhaustive check prevents this
+}
+
+// CategorizedError annotates an error with its ErrorCategory. The error message
+// is unchanged, so wrapping is invisible to the user except for the exit code.
+type CategorizedError struct {
+	Category ErrorCategory
+	Err      error
+}
+
+func (e *CategorizedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CategorizedError) Unwrap() error {
+	return e.Err
+}
+
+// WithCategory wraps err with the given category. It returns nil if err is nil.
+// If err was already categorized, the innermost (most specific) category is
+// kept, since the code that detected the problem knows best what it was.
+func WithCategory(c ErrorCategory, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ErrorCategoryOf(err) != CategoryUnknown {
+		return err
+	}
+	return &CategorizedError{Category: c, Err: err}
+}
+
+// InternalErrorf is like fmt.Errorf, but the returned error has the category
+// CategoryInternal and the message is prefixed with "internal error: ".
+func InternalErrorf(format string, args ...any) error {
+	return &CategorizedError{
+		Category: CategoryInternal,
+		Err:      fmt.Errorf("internal error: "+format, args...),
+	}
+}
+
+// ErrorCategoryOf returns the category of the given error, or CategoryUnknown
+// if it was never categorized.
+func ErrorCategoryOf(err error) ErrorCategory {
+	var ce *CategorizedError
+	if errors.As(err, &ce) {
+		return ce.Category
+	}
+	return CategoryUnknown
+}
+
+// ExitCodeOf returns the process exit code that should be used when a command
+// fails with the given error. An ExitCodeError takes precedence over the
+// error's category. Returns 0 if err is nil.
+func ExitCodeOf(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *ExitCodeError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	return ErrorCategoryOf(err).ExitCode()
+}
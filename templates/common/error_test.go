@@ -0,0 +1,102 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestExitCodeOf(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{
+			name: "nil",
+			err:  nil,
+			want: 0,
+		},
+		{
+			name: "uncategorized",
+			err:  errors.New("oops"),
+			want: ExitCodeGeneric,
+		},
+		{
+			name: "categorized",
+			err:  WithCategory(CategoryDownload, errors.New("oops")),
+			want: ExitCodeDownload,
+		},
+		{
+			name: "categorized_then_wrapped",
+			err:  fmt.Errorf("outer: %w", WithCategory(CategoryInputValidation, errors.New("oops"))),
+			want: ExitCodeInputValidation,
+		},
+		{
+			name: "innermost_category_wins",
+			err: WithCategory(CategoryDownload,
+				fmt.Errorf("outer: %w", WithCategory(CategoryOverwriteRefused, errors.New("oops")))),
+			want: ExitCodeOverwriteRefused,
+		},
+		{
+			name: "golden_test_failure",
+			err:  WithCategory(CategoryGoldenTestFailure, errors.New("oops")),
+			want: ExitCodeGoldenTestFailure,
+		},
+		{
+			name: "internal",
+			err:  InternalErrorf("bad thing %d", 1),
+			want: ExitCodeInternal,
+		},
+		{
+			name: "exit_code_error_takes_precedence",
+			err:  &ExitCodeError{Code: 42, Err: WithCategory(CategoryDownload, errors.New("oops"))},
+			want: 42,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := ExitCodeOf(tc.err); got != tc.want {
+				t.Errorf("ExitCodeOf(%v) got %d, want %d", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWithCategory_PreservesMessage(t *testing.T) {
+	t.Parallel()
+
+	if got := WithCategory(CategoryDownload, nil); got != nil {
+		t.Errorf("WithCategory(nil) got %v, want nil", got)
+	}
+
+	err := WithCategory(CategoryDownload, errors.New("oops"))
+	if got, want := err.Error(), "oops"; got != want {
+		t.Errorf("got message %q, want %q", got, want)
+	}
+
+	if got, want := InternalErrorf("x=%d", 1).Error(), "internal error: x=1"; got != want {
+		t.Errorf("got message %q, want %q", got, want)
+	}
+}
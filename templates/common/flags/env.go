@@ -0,0 +1,134 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flags
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/abcxyz/pkg/cli"
+)
+
+// EnvVarName returns the name of the environment variable for the flag with
+// the given name, like ABC_GIT_PROTOCOL for --git-protocol.
+func EnvVarName(flagName string) string {
+	return "ABC_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// Section is a flag section that gives every flag registered in it that
+// doesn't set its own EnvVar the environment variable named by EnvVarName, so
+// that abc can be configured without passing flags, e.g. in a container.
+// Commands create their flag sections with NewSection rather than
+// cli.FlagSet.NewSection.
+//
+// A flag given on the command line takes precedence over its environment
+// variable. For a flag that can be repeated, the values from the command line
+// are added to those from the environment variable, which may hold several
+// values: comma-separated for lists, and one per line for key=value pairs.
+type Section struct {
+	*cli.FlagSection
+
+	set *cli.FlagSet
+}
+
+// NewSection creates a flag section like set.NewSection.
+func NewSection(set *cli.FlagSet, name string) *Section {
+	return &Section{FlagSection: set.NewSection(name), set: set}
+}
+
+func (s *Section) BoolVar(i *cli.BoolVar) {
+	s.FlagSection.BoolVar(i)
+	s.bindEnv(i.Name, i.EnvVar)
+}
+
+func (s *Section) DurationVar(i *cli.DurationVar) {
+	s.FlagSection.DurationVar(i)
+	s.bindEnv(i.Name, i.EnvVar)
+}
+
+func (s *Section) Float64Var(i *cli.Float64Var) {
+	s.FlagSection.Float64Var(i)
+	s.bindEnv(i.Name, i.EnvVar)
+}
+
+func (s *Section) IntVar(i *cli.IntVar) {
+	s.FlagSection.IntVar(i)
+	s.bindEnv(i.Name, i.EnvVar)
+}
+
+func (s *Section) Int64Var(i *cli.Int64Var) {
+	s.FlagSection.Int64Var(i)
+	s.bindEnv(i.Name, i.EnvVar)
+}
+
+func (s *Section) StringVar(i *cli.StringVar) {
+	s.FlagSection.StringVar(i)
+	s.bindEnv(i.Name, i.EnvVar)
+}
+
+func (s *Section) StringMapVar(i *cli.StringMapVar) {
+	s.FlagSection.StringMapVar(i)
+	s.bindEnv(i.Name, i.EnvVar)
+}
+
+func (s *Section) StringSliceVar(i *cli.StringSliceVar) {
+	s.FlagSection.StringSliceVar(i)
+	s.bindEnv(i.Name, i.EnvVar)
+}
+
+func (s *Section) TimeVar(layout string, i *cli.TimeVar) {
+	s.FlagSection.TimeVar(layout, i)
+	s.bindEnv(i.Name, i.EnvVar)
+}
+
+func (s *Section) UintVar(i *cli.UintVar) {
+	s.FlagSection.UintVar(i)
+	s.bindEnv(i.Name, i.EnvVar)
+}
+
+func (s *Section) Uint64Var(i *cli.Uint64Var) {
+	s.FlagSection.Uint64Var(i)
+	s.bindEnv(i.Name, i.EnvVar)
+}
+
+// bindEnv gives the flag that was just registered the environment variable
+// named by EnvVarName, unless it has its own, envVar. The cli package has
+// already read envVar and mentioned it in the usage.
+func (s *Section) bindEnv(flagName, envVar string) {
+	if envVar != "" {
+		return
+	}
+	f := s.set.Lookup(flagName)
+	name := EnvVarName(flagName)
+	f.Usage += fmt.Sprintf(" This option can also be specified with the %s environment variable.", name)
+
+	val, ok := s.set.LookupEnv(name)
+	if !ok {
+		return
+	}
+	vals := []string{val}
+	if g, ok := f.Value.(flag.Getter); ok {
+		if _, isMap := g.Get().(map[string]string); isMap {
+			vals = strings.Split(strings.TrimSpace(val), "\n")
+		}
+	}
+	for _, v := range vals {
+		if err := f.Value.Set(v); err != nil {
+			err = fmt.Errorf("invalid value %q in environment variable %s: %w", v, name, err)
+			s.set.AfterParse(func(error) error { return err })
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flags
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+type envTestFlags struct {
+	Dest        string
+	Force       bool
+	Inputs      map[string]string
+	PolicyFiles []string
+	Protocol    string
+	Token       string
+}
+
+func (f *envTestFlags) register(set *cli.FlagSet) {
+	s := NewSection(set, "TEST OPTIONS")
+	s.StringVar(&cli.StringVar{Name: "dest", Aliases: []string{"d"}, Target: &f.Dest, Default: ".", Usage: "The destination."})
+	s.BoolVar(&cli.BoolVar{Name: "force-overwrite", Target: &f.Force, Usage: "Overwrite."})
+	s.StringMapVar(Inputs(&f.Inputs))
+	s.StringSliceVar(&cli.StringSliceVar{Name: "policy-file", Target: &f.PolicyFiles, Usage: "Policies."})
+	s.StringVar(GitProtocol(&f.Protocol))
+	s.StringVar(&cli.StringVar{Name: "token", EnvVar: "TEST_TOKEN", Target: &f.Token, Usage: "The token."})
+}
+
+func TestSection(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		env     map[string]string
+		args    []string
+		want    *envTestFlags
+		wantErr string
+	}{
+		{
+			name: "no_env",
+			want: &envTestFlags{Dest: ".", Protocol: "https"},
+		},
+		{
+			name: "from_env",
+			env: map[string]string{
+				"ABC_DEST":            "out",
+				"ABC_FORCE_OVERWRITE": "true",
+				"ABC_INPUT":           "a=1\nb=2=3\n",
+				"ABC_POLICY_FILE":     "x.rego,y.rego",
+				"ABC_GIT_PROTOCOL":    "ssh",
+			},
+			want: &envTestFlags{
+				Dest:        "out",
+				Force:       true,
+				Inputs:      map[string]string{"a": "1", "b": "2=3"},
+				PolicyFiles: []string{"x.rego", "y.rego"},
+				Protocol:    "ssh",
+			},
+		},
+		{
+			name: "flags_take_precedence",
+			env: map[string]string{
+				"ABC_DEST":        "out",
+				"ABC_INPUT":       "a=1\nb=2",
+				"ABC_POLICY_FILE": "x.rego",
+			},
+			args: []string{"--dest=other", "--input=b=flag", "--policy-file=z.rego"},
+			want: &envTestFlags{
+				Dest:        "other",
+				Inputs:      map[string]string{"a": "1", "b": "flag"},
+				PolicyFiles: []string{"x.rego", "z.rego"},
+				Protocol:    "https",
+			},
+		},
+		{
+			name:    "invalid_value",
+			env:     map[string]string{"ABC_FORCE_OVERWRITE": "maybe"},
+			wantErr: `invalid value "maybe" in environment variable ABC_FORCE_OVERWRITE`,
+		},
+		{
+			name: "alias_not_bound",
+			env:  map[string]string{"ABC_D": "out"},
+			want: &envTestFlags{Dest: ".", Protocol: "https"},
+		},
+		{
+			name: "own_env_var",
+			env:  map[string]string{"ABC_TOKEN": "abc", "TEST_TOKEN": "own"},
+			want: &envTestFlags{Dest: ".", Protocol: "https", Token: "own"},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := &envTestFlags{}
+			set := cli.NewFlagSet(cli.WithLookupEnv(cli.MapLookuper(tc.env)))
+			got.register(set)
+
+			err := set.Parse(tc.args)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(got, tc.want, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("flags were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestSection_Help(t *testing.T) {
+	t.Parallel()
+
+	set := cli.NewFlagSet(cli.WithLookupEnv(cli.MapLookuper(nil)))
+	(&envTestFlags{}).register(set)
+
+	for name, wantEnv := range map[string]string{
+		"dest":         "ABC_DEST",
+		"input":        "ABC_INPUT",
+		"git-protocol": "ABC_GIT_PROTOCOL",
+		"token":        "TEST_TOKEN",
+	} {
+		usage := set.Lookup(name).Usage
+		if got := strings.Count(usage, wantEnv+" environment variable"); got != 1 {
+			t.Errorf("usage of --%s mentions %s %d times, want once: %q", name, wantEnv, got, usage)
+		}
+	}
+}
@@ -16,8 +16,11 @@
 package flags
 
 import (
+	"time"
+
 	"github.com/posener/complete/v2/predict"
 
+	"github.com/abcxyz/abc/templates/common/completion"
 	"github.com/abcxyz/pkg/cli"
 )
 
@@ -35,16 +38,30 @@ func GitProtocol(target *string) *cli.StringVar {
 	}
 }
 
+// SkipGitSubmodules disables initializing the git submodules of a template
+// that's downloaded from a git repo.
+func SkipGitSubmodules(target *bool) *cli.BoolVar {
+	return &cli.BoolVar{
+		Name:   "skip-git-submodules",
+		Target: target,
+		Usage:  "Don't download the git submodules of a template that comes from a git repo; the submodule directories will be empty. Their commit SHAs are still recorded in the manifest.",
+	}
+}
+
 // Inputs provide values that are substituted into the template. The keys in
 // this map must match the input names in the Source template's spec.yaml
 // file.
 //
+// During shell completion, the input names are suggested by reading the spec
+// of the template source on the command line.
+//
 // These are just the --input values from flags. It doesn't include inputs
 // from config files, defaults, or prompts.
 func Inputs(inputs *map[string]string) *cli.StringMapVar {
 	return &cli.StringMapVar{
 		Name:    "input",
 		Example: "foo=bar",
+		Predict: completion.InputKeys(),
 		Target:  inputs,
 		Usage:   "The key=val pairs of template values; may be repeated.",
 	}
@@ -94,13 +111,25 @@ func DebugScratchContents(d *bool) *cli.BoolVar {
 	}
 }
 
-// DebugStepDiffs causes the diffs between steps to be logged as git commits.
+// DebugStepDiffs causes the diffs between steps to be logged as git commits,
+// or as patch files if git isn't installed.
 func DebugStepDiffs(d *bool) *cli.BoolVar {
 	return &cli.BoolVar{
 		Name:    "debug-step-diffs",
 		Target:  d,
 		Default: false,
-		Usage:   "Commit the diffs between steps for debugging.",
+		Usage:   "Commit the diffs between steps for debugging; if git isn't installed, write them as patch files instead.",
+	}
+}
+
+// DebugReport causes an HTML report of the diffs between steps to be written
+// to the given directory.
+func DebugReport(d *string) *cli.StringVar {
+	return &cli.StringVar{
+		Name:    "debug-report",
+		Example: "/tmp/abc-report",
+		Target:  d,
+		Usage:   "Write a browsable HTML report of the diffs made by each step to index.html in this directory, for debugging.",
 	}
 }
 
@@ -162,3 +191,160 @@ func UpgradeChannel(u *string) *cli.StringVar {
 		Usage:   `overrides the "upgrade_channel" field in the output manifest, which controls where upgraded template versions will be pulled from in the future by "abc uprade". Can be either a branch name or the special string "latest". The default is to upgrade from the branch that the template was originally rendered from if rendered from a branch, or in any other case to use the value "latest" to upgrade to the latest release tag by semver order.`,
 	}
 }
+
+// IgnoreUpgradeChannelPolicy disables the upgrade_channel_policy in config
+// files.
+func IgnoreUpgradeChannelPolicy(b *bool) *cli.BoolVar {
+	return &cli.BoolVar{
+		Name:   "ignore-upgrade-channel-policy",
+		Target: b,
+		Usage:  `allow an upgrade channel that the "upgrade_channel_policy" in a config file doesn't allow`,
+	}
+}
+
+// BackupKeep is the maximum number of backup directories to keep; older ones
+// are pruned.
+func BackupKeep(k *int) *cli.IntVar {
+	return &cli.IntVar{
+		Name:    "backup-keep",
+		Example: "10",
+		Target:  k,
+		Default: 0,
+		EnvVar:  "ABC_BACKUP_KEEP",
+		Usage:   "The maximum number of backup directories to keep under ~/.abc/backups, newest first; older ones are deleted. Zero means no limit.",
+	}
+}
+
+// BackupMaxAge is the maximum age of backup directories to keep; older ones are
+// pruned.
+func BackupMaxAge(d *time.Duration) *cli.DurationVar {
+	return &cli.DurationVar{
+		Name:    "backup-max-age",
+		Example: "720h",
+		Target:  d,
+		Default: 0,
+		EnvVar:  "ABC_BACKUP_MAX_AGE",
+		Usage:   "Backup directories under ~/.abc/backups older than this are deleted. Zero means no limit.",
+	}
+}
+
+// ManifestSigningKey is the path to a private key used to sign manifests.
+func ManifestSigningKey(k *string) *cli.StringVar {
+	return &cli.StringVar{
+		Name:    "manifest-signing-key",
+		Example: "/path/to/key.pem",
+		Target:  k,
+		Default: "",
+		EnvVar:  "ABC_MANIFEST_SIGNING_KEY",
+		Usage:   "The path to a PEM-encoded PKCS #8 Ed25519 or ECDSA private key. If set, each manifest written is signed with this key, and the signature is written next to it with a .sig suffix.",
+	}
+}
+
+// PolicyFiles are the files containing rules that rendered output must obey.
+func PolicyFiles(p *[]string) *cli.StringSliceVar {
+	return &cli.StringSliceVar{
+		Name:    "policy-file",
+		Example: "/my/org/abc-policy.yaml",
+		Predict: predict.Files("*.yaml"),
+		Target:  p,
+		EnvVar:  "ABC_POLICY_FILES",
+		Usage:   "A YAML policy file whose rules are checked against every rendered file before anything is written; if any file breaks a rule, the render fails and lists the violations. May be repeated.",
+	}
+}
+
+// AllowBufGenerate permits templates to use the buf_generate action, which
+// runs the buf CLI installed on this machine.
+func AllowBufGenerate(target *bool) *cli.BoolVar {
+	return &cli.BoolVar{
+		Name:   "allow-buf-generate",
+		Target: target,
+		EnvVar: "ABC_ALLOW_BUF_GENERATE",
+		Usage:  "Allow the template's buf_generate actions, which run the buf CLI installed on this machine outside of abc's sandbox. abc only lets the template's buf.gen.yaml use remote plugins and paths inside the scratch directory, but buf itself runs natively and uses the network, so only use this with templates you trust.",
+	}
+}
+
+// AuditLog is where to append a record of each render or upgrade.
+func AuditLog(p *string) *cli.StringVar {
+	return &cli.StringVar{
+		Name:    "audit-log",
+		Example: "gs://my-bucket/abc-audit/",
+		Predict: predict.Files("*"),
+		Target:  p,
+		EnvVar:  "ABC_AUDIT_LOG",
+		Usage:   "Where to append a JSON record of this operation saying who ran it, when, with which template version, and whether it succeeded; a local file path, a gs://bucket/prefix URL, or an http(s):// URL to POST to.",
+	}
+}
+
+// MaxOutputFiles is the maximum number of files a template may output.
+func MaxOutputFiles(m *int) *cli.IntVar {
+	return &cli.IntVar{
+		Name:    "max-output-files",
+		Example: "1000",
+		Target:  m,
+		Default: 100_000,
+		EnvVar:  "ABC_MAX_OUTPUT_FILES",
+		Usage:   "Fail if the template outputs more than this many files, to catch runaway templates before they fill the disk. Zero means no limit.",
+	}
+}
+
+// MaxOutputBytes is the maximum total size of the files a template may output.
+func MaxOutputBytes(m *int64) *cli.Int64Var {
+	return &cli.Int64Var{
+		Name:    "max-output-bytes",
+		Example: "1073741824",
+		Target:  m,
+		Default: 10 << 30, // 10 GiB
+		EnvVar:  "ABC_MAX_OUTPUT_BYTES",
+		Usage:   "Fail if the total size of the template's output files is more than this many bytes. Zero means no limit.",
+	}
+}
+
+// MaxFileBytes is the maximum size of any single file a template may output.
+func MaxFileBytes(m *int64) *cli.Int64Var {
+	return &cli.Int64Var{
+		Name:    "max-file-bytes",
+		Example: "104857600",
+		Target:  m,
+		Default: 1 << 30, // 1 GiB
+		EnvVar:  "ABC_MAX_FILE_BYTES",
+		Usage:   "Fail if any single output file is larger than this many bytes. Zero means no limit.",
+	}
+}
+
+// ConflictFileNames chooses how "abc upgrade" names the files it creates for
+// merge conflicts.
+func ConflictFileNames(target *string) *cli.StringVar {
+	return &cli.StringVar{
+		Name:    "conflict-file-names",
+		Target:  target,
+		EnvVar:  "ABC_CONFLICT_FILE_NAMES",
+		Example: "keep_extension",
+		Predict: predict.Set([]string{"keep_extension", "suffix"}),
+		Usage:   `How "abc upgrade" names the files it creates for merge conflicts, which is saved in the manifest: "keep_extension" names them like main.abcmerge_from_new_template.go so that tools still recognize the file type, and "suffix" names them like main.go.abcmerge_from_new_template. The default is "keep_extension" for new installations, and whatever the manifest says when upgrading; manifests from older versions of abc use "suffix".`,
+	}
+}
+
+// Wait is how long to wait for another render or upgrade of the same
+// destination to finish. See the destlock package.
+func Wait(d *time.Duration) *cli.DurationVar {
+	return &cli.DurationVar{
+		Name:    "wait",
+		Example: "5m",
+		Target:  d,
+		Default: 0,
+		EnvVar:  "ABC_WAIT",
+		Usage:   "If another render or upgrade of the same destination is running, wait up to this long for it to finish instead of failing right away.",
+	}
+}
+
+// Strict turns warnings, like uses of deprecated fields and old api_versions,
+// into errors. It's meant for template CI.
+func Strict(s *bool) *cli.BoolVar {
+	return &cli.BoolVar{
+		Name:    "strict",
+		Target:  s,
+		Default: false,
+		EnvVar:  "ABC_STRICT",
+		Usage:   "Fail if there are any warnings, like uses of deprecated fields or old api_versions; useful in template CI.",
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flags
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/posener/complete/v2/predict"
+
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// LogFlags are the flags that control logging and other diagnostic output.
+// They're registered by every command, so that every command configures its
+// logger the same way.
+type LogFlags struct {
+	// See LogFormat().
+	LogFormat string
+
+	// See LogLevel().
+	LogLevel string
+
+	// See Quiet().
+	Quiet bool
+
+	// See Verbose().
+	Verbose bool
+}
+
+// Register adds the logging flags to the given flag set in their own section.
+func (l *LogFlags) Register(set *cli.FlagSet) {
+	f := NewSection(set, "LOGGING OPTIONS")
+
+	f.StringVar(LogFormat(&l.LogFormat))
+	f.StringVar(LogLevel(&l.LogLevel))
+	f.BoolVar(Quiet(&l.Quiet))
+	f.BoolVar(Verbose(&l.Verbose))
+
+	set.AfterParse(func(existingErr error) error {
+		if l.Quiet && l.Verbose {
+			return fmt.Errorf("--quiet and --verbose are mutually exclusive")
+		}
+		if _, err := logging.LookupFormat(l.LogFormat); err != nil {
+			return fmt.Errorf("invalid --log-format: %w", err)
+		}
+		if _, err := logging.LookupLevel(l.LogLevel); err != nil {
+			return fmt.Errorf("invalid --log-level: %w", err)
+		}
+		return nil
+	})
+}
+
+// Level returns the effective log level after taking --quiet and --verbose
+// into account. --verbose lowers the threshold to at least INFO, and --quiet
+// raises it to at least ERROR.
+func (l *LogFlags) Level() slog.Level {
+	level, err := logging.LookupLevel(l.LogLevel)
+	if err != nil {
+		// Can't happen after flag parsing, because the AfterParse function
+		// validates the level.
+		level = logging.LevelWarning
+	}
+	if l.Verbose && level > logging.LevelInfo {
+		level = logging.LevelInfo
+	}
+	if l.Quiet && level < logging.LevelError {
+		level = logging.LevelError
+	}
+	return level
+}
+
+// WithLogger returns a context containing a logger that writes to w and is
+// configured according to these flags. Commands should call this right after
+// parsing flags, so that all log messages are formatted consistently.
+func (l *LogFlags) WithLogger(ctx context.Context, w io.Writer) context.Context {
+	format, err := logging.LookupFormat(l.LogFormat)
+	if err != nil {
+		// Can't happen after flag parsing, see Register().
+		format = logging.FormatText
+	}
+	return logging.WithLogger(ctx, logging.New(w, l.Level(), format, false))
+}
+
+// LogFormat controls whether log messages are printed as JSON or as text.
+func LogFormat(f *string) *cli.StringVar {
+	return &cli.StringVar{
+		Name:    "log-format",
+		Example: "json",
+		Default: "text",
+		Predict: predict.Set([]string{"json", "text"}),
+		Target:  f,
+		EnvVar:  "ABC_LOG_FORMAT",
+		Usage:   "The format of log messages, either json or text.",
+	}
+}
+
+// LogLevel is the minimum severity of log messages to be printed.
+func LogLevel(l *string) *cli.StringVar {
+	names := logging.LevelNames()
+	for i, n := range names {
+		names[i] = strings.ToLower(n)
+	}
+	return &cli.StringVar{
+		Name:    "log-level",
+		Example: "info",
+		Default: "warning",
+		Predict: predict.Set(names),
+		Target:  l,
+		EnvVar:  "ABC_LOG_LEVEL",
+		Usage:   fmt.Sprintf("The minimum severity of log messages to print; one of %v.", names),
+	}
+}
+
+// Quiet suppresses the output of "print" actions and all log messages less
+// severe than ERROR.
+func Quiet(q *bool) *cli.BoolVar {
+	return &cli.BoolVar{
+		Name:    "quiet",
+		Aliases: []string{"q"},
+		Target:  q,
+		Default: false,
+		EnvVar:  "ABC_QUIET",
+		Usage:   "Suppress the output of print actions and all log messages below ERROR; useful when running abc inside other tools.",
+	}
+}
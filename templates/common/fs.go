@@ -21,8 +21,11 @@ import (
 	"hash"
 	"io"
 	"io/fs"
+	"maps"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/abcxyz/abc/templates/model"
 	"github.com/abcxyz/pkg/logging"
@@ -33,6 +36,10 @@ const (
 	OwnerRWXPerms = 0o700
 	// Permission bits: rw------- .
 	OwnerRWPerms = 0o600
+
+	// DefaultCopyProgressInterval is the minimum time between progress reports
+	// from CopyRecursive, unless CopyParams.ProgressInterval says otherwise.
+	DefaultCopyProgressInterval = 5 * time.Second
 )
 
 // Abstracts filesystem operations.
@@ -43,19 +50,40 @@ type FS interface {
 	fs.StatFS
 
 	// These methods correspond to methods in the "os" package of the same name.
+	Chmod(string, os.FileMode) error
+	Chtimes(string, time.Time, time.Time) error
 	MkdirAll(string, os.FileMode) error
 	MkdirTemp(string, string) (string, error)
-	OpenFile(string, int, os.FileMode) (*os.File, error)
+	OpenFile(string, int, os.FileMode) (io.WriteCloser, error)
 	ReadFile(string) ([]byte, error)
 	Rename(string, string) error
 	Remove(string) error
 	RemoveAll(string) error
 	WriteFile(string, []byte, os.FileMode) error
+
+	// ListXattrs returns the extended attributes of a file, by name, and
+	// SetXattr sets one of them. They return an error wrapping
+	// ErrXattrsUnsupported if the platform or filesystem doesn't support
+	// extended attributes.
+	ListXattrs(string) (map[string][]byte, error)
+	SetXattr(string, string, []byte) error
 }
 
 // This is the non-test implementation of the filesystem interface.
 type RealFS struct{}
 
+func (r *RealFS) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(name, mode) //nolint:wrapcheck
+}
+
+func (r *RealFS) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime) //nolint:wrapcheck
+}
+
+func (r *RealFS) ListXattrs(name string) (map[string][]byte, error) {
+	return listXattrs(name)
+}
+
 func (r *RealFS) MkdirAll(name string, perm os.FileMode) error {
 	return os.MkdirAll(name, perm) //nolint:wrapcheck
 }
@@ -68,10 +96,15 @@ func (r *RealFS) Open(name string) (fs.File, error) {
 	return os.Open(name) //nolint:wrapcheck
 }
 
-func (r *RealFS) OpenFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+func (r *RealFS) OpenFile(name string, flag int, perm os.FileMode) (io.WriteCloser, error) {
 	return os.OpenFile(name, flag, perm) //nolint:wrapcheck
 }
 
+// ReadDir implements fs.ReadDirFS.
+func (r *RealFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name) //nolint:wrapcheck
+}
+
 func (r *RealFS) ReadFile(name string) ([]byte, error) {
 	return os.ReadFile(name) //nolint:wrapcheck
 }
@@ -88,6 +121,10 @@ func (r *RealFS) Rename(from, to string) error {
 	return os.Rename(from, to) //nolint:wrapcheck
 }
 
+func (r *RealFS) SetXattr(name, attr string, value []byte) error {
+	return setXattr(name, attr, value)
+}
+
 func (r *RealFS) Stat(name string) (fs.FileInfo, error) {
 	return os.Stat(name) //nolint:wrapcheck
 }
@@ -96,6 +133,37 @@ func (r *RealFS) WriteFile(name string, data []byte, perm os.FileMode) error {
 	return os.WriteFile(name, data, perm) //nolint:wrapcheck
 }
 
+func (r *RealFS) Getwd() (string, error) {
+	return os.Getwd() //nolint:wrapcheck
+}
+
+func (r *RealFS) Lstat(name string) (fs.FileInfo, error) {
+	return os.Lstat(name) //nolint:wrapcheck
+}
+
+func (r *RealFS) Readlink(name string) (string, error) {
+	return os.Readlink(name) //nolint:wrapcheck
+}
+
+// LinkFS is implemented by an FS that can say how its paths resolve: what
+// relative paths are relative to, and where its symlinks point. JailFS uses
+// it to check paths. Like Glob, an FS that doesn't implement it is assumed to
+// be backed by the local disk.
+type LinkFS interface {
+	// These methods correspond to methods in the "os" package of the same name.
+	Getwd() (string, error)
+	Lstat(string) (fs.FileInfo, error)
+	Readlink(string) (string, error)
+}
+
+// linkFSOf returns fsys as a LinkFS, or the local disk if it isn't one.
+func linkFSOf(fsys FS) LinkFS {
+	if l, ok := fsys.(LinkFS); ok {
+		return l
+	}
+	return &RealFS{}
+}
+
 // CopyParams contains most of the parameters to CopyRecursive(). There were too
 // many of these, so they've been factored out into a struct to avoid having the
 // function parameter list be really long.
@@ -130,6 +198,50 @@ type CopyParams struct {
 	// mode, the hash will be computed normally.
 	Hasher    func() hash.Hash
 	OutHashes map[string][]byte
+
+	// PreserveMetadata gives each copied file the full mode bits of its source
+	// file (including setuid, setgid, and sticky, and regardless of umask) and
+	// the source file's modification time. Otherwise, only the permission bits
+	// are copied (subject to umask), and the file's modification time is the
+	// time of the copy. On Windows, the only mode bit that exists is the
+	// owner-writable bit, which controls whether the file is read-only; that's
+	// the only mode bit copied in either case, while the modification time is
+	// preserved as on other platforms.
+	PreserveMetadata bool
+
+	// PreserveXattrs also gives each copied file the extended attributes of
+	// its source file; see CopyXattrs. Those that can't be set are recorded in
+	// CopyStats.DroppedXattrs and logged, rather than failing the copy.
+	PreserveXattrs bool
+
+	// Progress, if not nil, is called with the stats so far every
+	// ProgressInterval while files are being copied, so that callers can show
+	// the progress of large copies. Calls are never concurrent. Progress is
+	// also logged at the info level every ProgressInterval.
+	Progress func(CopyStats)
+
+	// ProgressInterval is the minimum time between progress reports. If zero,
+	// DefaultCopyProgressInterval is used.
+	ProgressInterval time.Duration
+}
+
+// CopyStats describes the work done by CopyRecursive.
+type CopyStats struct {
+	// Files is the number of files copied, not counting skipped files. In dry
+	// run mode, it's the number of files that would have been copied.
+	Files int
+
+	// Bytes is the total size of the copied files.
+	Bytes int64
+
+	// Duration is how long the copy took, including checking the files before
+	// copying them.
+	Duration time.Duration
+
+	// DroppedXattrs has the names of the extended attributes that couldn't be
+	// preserved with CopyParams.PreserveXattrs, keyed by the path of the file
+	// relative to SrcRoot.
+	DroppedXattrs map[string][]string
 }
 
 // CopyVisitor is the type for callback functions that are called by
@@ -173,15 +285,34 @@ func (e *SymlinkForbiddenError) Error() string {
 //
 // If the source directory contains a symlink, then [SymlinkForbiddenError] will
 // be returned.
-func CopyRecursive(ctx context.Context, pos *model.ConfigPos, p *CopyParams) (outErr error) {
+//
+// Files are copied (and hashed, if requested) concurrently after all of them
+// have been checked, so a problem detected during the checks means that no
+// files are copied. Errors during copying are returned in walk order.
+//
+// The copy stops between files if ctx is canceled, leaving the files that were
+// already copied in place.
+func CopyRecursive(ctx context.Context, pos *model.ConfigPos, p *CopyParams) (*CopyStats, error) {
 	logger := logging.FromContext(ctx).With("logger", "CopyRecursive")
+	progress := newCopyProgress(ctx, p)
 
 	backupDir := "" // will be set once the backup dir is actually created
 
-	return fs.WalkDir(p.FS, p.SrcRoot, func(path string, de fs.DirEntry, err error) error { //nolint:wrapcheck
+	// The walk checks every file and makes backups, but doesn't copy anything.
+	// The copying and hashing is done afterward in parallel, since that's where
+	// the time goes for large templates.
+	type fileToCopy struct {
+		src, dst, relToSrc string
+	}
+	var files []fileToCopy
+
+	if err := fs.WalkDir(p.FS, p.SrcRoot, func(path string, de fs.DirEntry, err error) error {
 		if err != nil {
 			return err // There was some filesystem error. Give up.
 		}
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("copy interrupted: %w", err)
+		}
 
 		logger.DebugContext(ctx, "handling directory entry",
 			"path", path)
@@ -235,7 +366,8 @@ func CopyRecursive(ctx context.Context, pos *model.ConfigPos, p *CopyParams) (ou
 				return pos.Errorf("cannot overwrite a directory with a file of the same name; destination is %q, source is %q", dst, path)
 			}
 			if !ch.AllowPreexisting {
-				return pos.Errorf("destination file %s already exists and overwriting was not enabled with --force-overwrite", relToSrc)
+				return WithCategory(CategoryOverwriteRefused,
+					pos.Errorf("destination file %s already exists and overwriting was not enabled with --force-overwrite", relToSrc))
 			}
 			if ch.BackupIfExists && !p.DryRun {
 				if backupDir == "" {
@@ -251,18 +383,139 @@ func CopyRecursive(ctx context.Context, pos *model.ConfigPos, p *CopyParams) (ou
 			return pos.Errorf("Stat(): %w", err)
 		}
 
+		files = append(files, fileToCopy{src: path, dst: dst, relToSrc: relToSrc})
+		return nil
+	}); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	var hashesMu sync.Mutex
+	err := ForEachParallel(len(files), 0, func(i int) error {
+		if ctx.Err() != nil {
+			return nil // Reported once below, rather than once per file.
+		}
+		f := files[i]
 		var hash hash.Hash
 		if p.Hasher != nil {
 			hash = p.Hasher()
 		}
-		if err := CopyFile(ctx, pos, p.FS, path, dst, p.DryRun, hash); err != nil {
+		n, err := copyFile(ctx, pos, p.FS, f.src, f.dst, p.DryRun, hash)
+		if err != nil {
 			return err
 		}
+		if p.PreserveMetadata && !p.DryRun {
+			if err := CopyMetadata(p.FS, f.src, f.dst); err != nil {
+				return pos.Errorf("failed preserving metadata of %q: %w", f.dst, err)
+			}
+		}
+		if p.PreserveXattrs && !p.DryRun {
+			dropped, err := CopyXattrs(p.FS, f.src, f.dst)
+			if err != nil {
+				return pos.Errorf("failed preserving extended attributes of %q: %w", f.dst, err)
+			}
+			if len(dropped) > 0 {
+				logger.WarnContext(ctx, "some extended attributes couldn't be preserved because the destination doesn't support them or they require more privileges",
+					"path", f.relToSrc,
+					"xattrs", dropped)
+				progress.dropXattrs(f.relToSrc, dropped)
+			}
+		}
 		if hash != nil && p.OutHashes != nil {
-			p.OutHashes[relToSrc] = hash.Sum(nil)
+			hashesMu.Lock()
+			p.OutHashes[f.relToSrc] = hash.Sum(nil)
+			hashesMu.Unlock()
 		}
+		progress.add(n)
 		return nil
 	})
+	stats := progress.done()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, fmt.Errorf("copy interrupted after %d of %d files: %w", stats.Files, len(files), ctxErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	logger.DebugContext(ctx, "copied files",
+		"files", stats.Files,
+		"bytes", stats.Bytes,
+		"duration", stats.Duration)
+	return stats, nil
+}
+
+// copyProgress accumulates CopyStats from concurrent file copies and reports
+// them periodically.
+type copyProgress struct {
+	ctx      context.Context //nolint:containedctx // Only used for logging.
+	report   func(CopyStats)
+	interval time.Duration
+
+	mu         sync.Mutex
+	stats      CopyStats
+	start      time.Time
+	lastReport time.Time
+}
+
+func newCopyProgress(ctx context.Context, p *CopyParams) *copyProgress {
+	interval := p.ProgressInterval
+	if interval == 0 {
+		interval = DefaultCopyProgressInterval
+	}
+	now := time.Now()
+	return &copyProgress{
+		ctx:        ctx,
+		report:     p.Progress,
+		interval:   interval,
+		start:      now,
+		lastReport: now,
+	}
+}
+
+// add records that a file of the given size was copied, and reports progress
+// if it's been long enough since the last report.
+func (c *copyProgress) add(bytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats.Files++
+	c.stats.Bytes += bytes
+	now := time.Now()
+	if now.Sub(c.lastReport) < c.interval {
+		return
+	}
+	c.lastReport = now
+	stats := c.stats
+	stats.Duration = now.Sub(c.start)
+	stats.DroppedXattrs = maps.Clone(stats.DroppedXattrs)
+
+	logger := logging.FromContext(c.ctx).With("logger", "CopyRecursive")
+	logger.InfoContext(c.ctx, "still copying files",
+		"files", stats.Files,
+		"bytes", stats.Bytes,
+		"duration", stats.Duration)
+	if c.report != nil {
+		c.report(stats)
+	}
+}
+
+// dropXattrs records extended attributes that couldn't be preserved.
+func (c *copyProgress) dropXattrs(relPath string, names []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stats.DroppedXattrs == nil {
+		c.stats.DroppedXattrs = make(map[string][]string)
+	}
+	c.stats.DroppedXattrs[relPath] = names
+}
+
+// done returns the final stats.
+func (c *copyProgress) done() *CopyStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Duration = time.Since(c.start)
+	return &stats
 }
 
 // Copy copies the file src to dst. It's a wrapper around CopyFile that hides
@@ -277,20 +530,26 @@ func Copy(ctx context.Context, fs FS, src, dst string) error {
 // If the target directory doesn't exist, it will be automatically created.
 //
 // tee is nil-able. If not nil, it will be written to with the file contents.
-func CopyFile(ctx context.Context, pos *model.ConfigPos, rfs FS, src, dst string, dryRun bool, tee io.Writer) (outErr error) {
+func CopyFile(ctx context.Context, pos *model.ConfigPos, rfs FS, src, dst string, dryRun bool, tee io.Writer) error {
+	_, err := copyFile(ctx, pos, rfs, src, dst, dryRun, tee)
+	return err
+}
+
+// copyFile is CopyFile that also returns the number of bytes copied.
+func copyFile(ctx context.Context, pos *model.ConfigPos, rfs FS, src, dst string, dryRun bool, tee io.Writer) (_ int64, outErr error) {
 	logger := logging.FromContext(ctx).With("logger", "copyFile")
 
 	// The permission bits on the output file are copied from the input file.
 	// This preserves the execute bit on executable files.
 	srcInfo, err := rfs.Stat(src)
 	if err != nil {
-		return fmt.Errorf("Stat(): %w", err)
+		return 0, fmt.Errorf("Stat(): %w", err)
 	}
 	mode := srcInfo.Mode().Perm()
 
 	readFile, err := rfs.Open(src)
 	if err != nil {
-		return pos.Errorf("Open(): %w", err)
+		return 0, pos.Errorf("Open(): %w", err)
 	}
 	defer func() { outErr = errors.Join(outErr, readFile.Close()) }()
 	var reader io.Reader = readFile
@@ -301,27 +560,70 @@ func CopyFile(ctx context.Context, pos *model.ConfigPos, rfs FS, src, dst string
 	} else {
 		parentDir := filepath.Dir(dst)
 		if err := rfs.MkdirAll(parentDir, OwnerRWXPerms); err != nil {
-			return fmt.Errorf("fs.MkdirAll(%s): %w", parentDir, err)
+			return 0, fmt.Errorf("fs.MkdirAll(%s): %w", parentDir, err)
 		}
 
 		writeFile, err := rfs.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
 		if err != nil {
-			return pos.Errorf("OpenFile(): %w", err)
+			return 0, pos.Errorf("OpenFile(): %w", err)
 		}
 		defer func() { outErr = errors.Join(outErr, writeFile.Close()) }()
 		writer = writeFile
 	}
 
+	// Without a tee, io.Copy can use a fast path like copy_file_range that
+	// doesn't need a buffer at all.
+	copyFunc := io.Copy
 	if tee != nil {
 		reader = io.TeeReader(readFile, tee)
+		copyFunc = PooledCopy
 	}
 
-	if _, err := io.Copy(writer, reader); err != nil {
-		return fmt.Errorf("Copy(): %w", err)
+	n, err := copyFunc(writer, reader)
+	if err != nil {
+		return 0, fmt.Errorf("Copy(): %w", err)
 	}
 	logger.DebugContext(ctx, "copied file",
 		"source", src,
 		"destination", dst)
+	return n, nil
+}
+
+// copyBufPool holds buffers for PooledCopy, so that copying and hashing many
+// files doesn't allocate a buffer per file.
+var copyBufPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, 32*1024)
+		return &buf
+	},
+}
+
+// PooledCopy is like io.Copy, but always copies through a buffer taken from a
+// pool that's shared across calls. Unlike io.Copy, it never lets src or dst
+// do the copy themselves with WriteTo or ReadFrom, since those would allocate
+// their own buffer when they can't use a faster path.
+func PooledCopy(dst io.Writer, src io.Reader) (int64, error) {
+	bufPtr := copyBufPool.Get().(*[]byte) //nolint:forcetypeassert
+	defer copyBufPool.Put(bufPtr)
+
+	// The anonymous structs hide any WriteTo and ReadFrom methods.
+	return io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{src}, *bufPtr) //nolint:wrapcheck
+}
+
+// CopyMetadata sets the mode bits and modification time of dst to be the same
+// as those of src. The access time is set to the modification time, since
+// reading src for the copy may have changed its access time.
+func CopyMetadata(rfs FS, src, dst string) error {
+	srcInfo, err := rfs.Stat(src)
+	if err != nil {
+		return fmt.Errorf("Stat(): %w", err)
+	}
+	if err := rfs.Chmod(dst, srcInfo.Mode()&(fs.ModePerm|fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky)); err != nil {
+		return fmt.Errorf("Chmod(): %w", err)
+	}
+	if err := rfs.Chtimes(dst, srcInfo.ModTime(), srcInfo.ModTime()); err != nil {
+		return fmt.Errorf("Chtimes(): %w", err)
+	}
 	return nil
 }
 
@@ -386,6 +688,18 @@ type ErrorFS struct {
 	WriteFileErr error
 }
 
+func (e *ErrorFS) Getwd() (string, error) {
+	return linkFSOf(e.FS).Getwd() //nolint:wrapcheck
+}
+
+func (e *ErrorFS) Lstat(name string) (fs.FileInfo, error) {
+	return linkFSOf(e.FS).Lstat(name) //nolint:wrapcheck
+}
+
+func (e *ErrorFS) Readlink(name string) (string, error) {
+	return linkFSOf(e.FS).Readlink(name) //nolint:wrapcheck
+}
+
 func (e *ErrorFS) MkdirAll(name string, mode fs.FileMode) error {
 	if e.MkdirAllErr != nil {
 		return e.MkdirAllErr
@@ -400,13 +714,23 @@ func (e *ErrorFS) Open(name string) (fs.File, error) {
 	return e.FS.Open(name) //nolint:wrapcheck
 }
 
-func (e *ErrorFS) OpenFile(name string, flag int, mode os.FileMode) (*os.File, error) {
+func (e *ErrorFS) OpenFile(name string, flag int, mode os.FileMode) (io.WriteCloser, error) {
 	if e.OpenFileErr != nil {
 		return nil, e.OpenFileErr
 	}
 	return e.FS.OpenFile(name, flag, mode) //nolint:wrapcheck
 }
 
+func (e *ErrorFS) Glob(pattern string) ([]string, error) {
+	return Glob(e.FS, pattern)
+}
+
+// ReadDir implements fs.ReadDirFS. It isn't affected by OpenErr, so a
+// directory can still be walked when opening its files fails.
+func (e *ErrorFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(e.FS, name) //nolint:wrapcheck
+}
+
 func (e *ErrorFS) ReadFile(name string) ([]byte, error) {
 	if e.ReadFileErr != nil {
 		return nil, e.ReadFileErr
@@ -453,6 +777,18 @@ func JoinIfRelative(cwd, path string) string {
 	return filepath.Join(cwd, path)
 }
 
+// Glob is like filepath.Glob, but searches the given FS. An FS with its own
+// Glob method, like MemFS, is searched with that method; any other FS is
+// assumed to be backed by the local disk.
+func Glob(fsys FS, pattern string) ([]string, error) {
+	if g, ok := fsys.(interface {
+		Glob(string) ([]string, error)
+	}); ok {
+		return g.Glob(pattern) //nolint:wrapcheck
+	}
+	return filepath.Glob(pattern) //nolint:wrapcheck
+}
+
 // Exists returns whether the given path is a file or directory that exists. We
 // wrote this wrapper because it's a little complex and irritating to deal with
 // the way that os.Stat() considers nonexistence to be an error.
@@ -462,7 +798,7 @@ func Exists(path string) (bool, error) {
 
 // Exists is like Exists, but takes a FS as a parameter for error injection.
 func ExistsFS(fs FS, path string) (bool, error) {
-	_, err := os.Stat(path)
+	_, err := fs.Stat(path)
 	if err != nil {
 		if IsNotExistErr(err) {
 			return false, nil
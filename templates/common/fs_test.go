@@ -27,6 +27,7 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
@@ -444,7 +445,7 @@ func TestCopyRecursive(t *testing.T) {
 				hashes = make(map[string][]byte)
 			}
 
-			err := CopyRecursive(ctx, &model.ConfigPos{}, &CopyParams{
+			_, err := CopyRecursive(ctx, &model.ConfigPos{}, &CopyParams{
 				BackupDirMaker: func(rf FS) (string, error) { return backupDir, nil },
 				SrcRoot:        from,
 				DstRoot:        to,
@@ -483,6 +484,80 @@ func TestCopyRecursive(t *testing.T) {
 	}
 }
 
+func BenchmarkCopyRecursive(b *testing.B) {
+	const numFiles = 256
+	contents := make(map[string]string, numFiles)
+	for i := 0; i < numFiles; i++ {
+		contents[fmt.Sprintf("dir%d/file%d.txt", i%8, i)] = strings.Repeat("abc foo def\n", 4096)
+	}
+	srcRoot := b.TempDir()
+	abctestutil.WriteAll(b, srcRoot, contents)
+	ctx := context.Background()
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("gomaxprocs_%d", workers), func(b *testing.B) {
+			defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(workers))
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				dstRoot := b.TempDir()
+				b.StartTimer()
+
+				if _, err := CopyRecursive(ctx, nil, &CopyParams{
+					DstRoot:   dstRoot,
+					SrcRoot:   srcRoot,
+					FS:        &RealFS{},
+					Hasher:    sha256.New,
+					OutHashes: map[string][]byte{},
+				}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestPooledCopy(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		in   string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "smaller_than_buffer",
+			in:   "hello",
+		},
+		{
+			name: "larger_than_buffer",
+			in:   strings.Repeat("abc foo def\n", 10000),
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var sb strings.Builder
+			n, err := PooledCopy(&sb, strings.NewReader(tc.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(len(tc.in)) {
+				t.Errorf("PooledCopy() returned %d, want %d", n, len(tc.in))
+			}
+			if diff := cmp.Diff(sb.String(), tc.in); diff != "" {
+				t.Errorf("copied contents were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
 func TestCopyRecursive_ForbidSymlinks(t *testing.T) {
 	t.Parallel()
 
@@ -546,7 +621,7 @@ func TestCopyRecursive_ForbidSymlinks(t *testing.T) {
 
 			destTempDir := t.TempDir()
 			ctx := context.Background()
-			err := CopyRecursive(ctx, nil, &CopyParams{
+			_, err := CopyRecursive(ctx, nil, &CopyParams{
 				FS:      &RealFS{},
 				SrcRoot: sourceTempDir,
 				DstRoot: destTempDir,
@@ -571,6 +646,186 @@ func TestCopyRecursive_ForbidSymlinks(t *testing.T) {
 	}
 }
 
+func TestCopyRecursive_PreserveMetadata(t *testing.T) {
+	t.Parallel()
+
+	srcMtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	cases := []struct {
+		name             string
+		preserveMetadata bool
+		wantMode         fs.FileMode
+		wantSrcMtime     bool
+	}{
+		{
+			name:     "permissions_only",
+			wantMode: 0o700,
+		},
+		{
+			name:             "preserve",
+			preserveMetadata: true,
+			wantMode:         0o700 | fs.ModeSetuid,
+			wantSrcMtime:     true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			srcDir := t.TempDir()
+			dstDir := t.TempDir()
+			srcFile := filepath.Join(srcDir, "dir", "run.sh")
+			abctestutil.WriteAll(t, srcDir, map[string]string{"dir/run.sh": "#!/bin/sh"})
+			if err := os.Chmod(srcFile, 0o700|fs.ModeSetuid); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(srcFile, srcMtime, srcMtime); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := CopyRecursive(context.Background(), nil, &CopyParams{
+				FS:               &RealFS{},
+				SrcRoot:          srcDir,
+				DstRoot:          dstDir,
+				PreserveMetadata: tc.preserveMetadata,
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			info, err := os.Stat(filepath.Join(dstDir, "dir", "run.sh"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantMode := tc.wantMode
+			if runtime.GOOS == "windows" {
+				// Windows has no setuid bit or execute bits, and os.Stat
+				// reports every writable file as 0o666.
+				wantMode = 0o666
+			}
+			if got := info.Mode() &^ fs.ModeType; got != wantMode {
+				t.Errorf("got mode %v, want %v", got, wantMode)
+			}
+			if got := info.ModTime().Equal(srcMtime); got != tc.wantSrcMtime {
+				t.Errorf("got mtime %v, wanted source mtime (%v) to be preserved: %t", info.ModTime(), srcMtime, tc.wantSrcMtime)
+			}
+		})
+	}
+}
+
+func TestCopyRecursive_Stats(t *testing.T) {
+	t.Parallel()
+
+	srcRoot := t.TempDir()
+	abctestutil.WriteAll(t, srcRoot, map[string]string{
+		"a.txt":         "hello",
+		"dir/b.txt":     "goodbye",
+		"skip/skip.txt": "not copied",
+	})
+
+	var progress []CopyStats
+	stats, err := CopyRecursive(context.Background(), nil, &CopyParams{
+		DstRoot: t.TempDir(),
+		SrcRoot: srcRoot,
+		FS:      &RealFS{},
+		Visitor: func(relPath string, de fs.DirEntry) (CopyHint, error) {
+			return CopyHint{Skip: relPath == "skip"}, nil
+		},
+		Progress:         func(s CopyStats) { progress = append(progress, s) },
+		ProgressInterval: time.Nanosecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := stats.Files, 2; got != want {
+		t.Errorf("got %d files copied, want %d", got, want)
+	}
+	if got, want := stats.Bytes, int64(len("hello")+len("goodbye")); got != want {
+		t.Errorf("got %d bytes copied, want %d", got, want)
+	}
+	if stats.Duration <= 0 {
+		t.Errorf("got duration %v, want a positive duration", stats.Duration)
+	}
+	if len(progress) == 0 {
+		t.Fatal("the progress callback was never called")
+	}
+	if got := progress[len(progress)-1]; got.Files != stats.Files || got.Bytes != stats.Bytes {
+		t.Errorf("the last progress report was %+v, want it to match the final stats %+v", got, stats)
+	}
+}
+
+func TestCopyRecursive_Canceled(t *testing.T) {
+	t.Parallel()
+
+	srcRoot := t.TempDir()
+	abctestutil.WriteAll(t, srcRoot, map[string]string{"a.txt": "hello"})
+	dstRoot := t.TempDir()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := CopyRecursive(ctx, nil, &CopyParams{
+		DstRoot: dstRoot,
+		SrcRoot: srcRoot,
+		FS:      &RealFS{},
+	})
+	if diff := testutil.DiffErrString(err, "copy interrupted"); diff != "" {
+		t.Error(diff)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want it to wrap context.Canceled", err)
+	}
+	if got := abctestutil.LoadDir(t, dstRoot); len(got) > 0 {
+		t.Errorf("a canceled copy shouldn't have copied anything, but got %v", got)
+	}
+}
+
+func TestCopyRecursive_PreserveXattrs(t *testing.T) {
+	t.Parallel()
+
+	srcRoot := t.TempDir()
+	abctestutil.WriteAll(t, srcRoot, map[string]string{"a.txt": "hello"})
+	rfs := &RealFS{}
+	const name, value = "user.abc_test", "some value"
+	if err := rfs.SetXattr(filepath.Join(srcRoot, "a.txt"), name, []byte(value)); err != nil {
+		if errors.Is(err, ErrXattrsUnsupported) {
+			t.Skipf("this filesystem doesn't support xattrs: %v", err)
+		}
+		t.Fatal(err)
+	}
+
+	for _, preserve := range []bool{false, true} {
+		dstRoot := t.TempDir()
+		stats, err := CopyRecursive(context.Background(), nil, &CopyParams{
+			DstRoot:        dstRoot,
+			SrcRoot:        srcRoot,
+			FS:             rfs,
+			PreserveXattrs: preserve,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stats.DroppedXattrs) > 0 {
+			t.Errorf("got dropped xattrs %v, want none", stats.DroppedXattrs)
+		}
+
+		got, err := rfs.ListXattrs(filepath.Join(dstRoot, "a.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want map[string][]byte
+		if preserve {
+			want = map[string][]byte{name: []byte(value)}
+		}
+		if diff := cmp.Diff(got, want, cmpopts.EquateEmpty()); diff != "" {
+			t.Errorf("with PreserveXattrs=%t, xattrs were not as expected (-got,+want): %s", preserve, diff)
+		}
+	}
+}
+
 func TestCopyFile(t *testing.T) {
 	t.Parallel()
 
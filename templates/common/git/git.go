@@ -16,12 +16,14 @@ package git
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 
@@ -42,6 +44,91 @@ func Clone(ctx context.Context, remote, outDir string) error {
 	return nil
 }
 
+// FetchSHA downloads the single commit with the given full SHA from the given
+// remote into outDir, which must already exist, and leaves it checked out as a
+// detached HEAD. Unlike Clone followed by Checkout, this works even if the
+// commit isn't reachable from any branch or tag that a clone would fetch.
+//
+// It first tries a shallow fetch of exactly that commit. Some servers refuse
+// to serve a commit by SHA, so if that fails, it falls back to fetching all
+// branches and tags. After a shallow fetch, any remote tags pointing at the
+// commit are recreated locally so that HeadTags works as it would after a
+// full clone.
+//
+// If the commit doesn't exist in the remote, *NoSuchVersionError will be
+// returned.
+func FetchSHA(ctx context.Context, remote, sha, outDir string) error {
+	if _, _, err := run.Many(ctx,
+		[]string{"git", "-C", outDir, "init", "--quiet"},
+		[]string{"git", "-C", outDir, "remote", "add", "origin", "--", remote},
+	); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	shallow := true
+	if _, _, err := run.Simple(ctx, "git", "-C", outDir, "fetch", "--quiet", "--depth=1", "origin", sha); err != nil {
+		shallow = false
+		if _, _, err := run.Simple(ctx, "git", "-C", outDir, "fetch", "--quiet", "--tags", "origin", "+refs/heads/*:refs/remotes/origin/*"); err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+
+	if _, _, err := run.Simple(ctx, "git", "-C", outDir, "checkout", "--quiet", "--detach", sha); err != nil {
+		exitErr := &exec.ExitError{}
+		if errors.As(err, &exitErr) {
+			return &NoSuchVersionError{
+				Version: sha,
+			}
+		}
+		return err //nolint:wrapcheck
+	}
+
+	if !shallow {
+		return nil
+	}
+
+	tags, err := remoteTagsAt(ctx, outDir, sha)
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, _, err := run.Simple(ctx, "git", "-C", outDir, "tag", "--", tag, sha); err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+	return nil
+}
+
+// remoteTagsAt returns the names of the tags in the "origin" remote of the
+// given workspace that point to the given commit SHA. Annotated tags are
+// matched by the commit they point to.
+func remoteTagsAt(ctx context.Context, dir, sha string) ([]string, error) {
+	stdout, _, err := run.Simple(ctx, "git", "-C", dir, "ls-remote", "--tags", "origin")
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	lineScanner := bufio.NewScanner(strings.NewReader(stdout))
+	var tags []string
+	for lineScanner.Scan() {
+		// Each line looks like "<sha>\trefs/tags/<tag>", or
+		// "<sha>\trefs/tags/<tag>^{}" for the commit an annotated tag points to.
+		lineSHA, ref, ok := strings.Cut(lineScanner.Text(), "\t")
+		if !ok || lineSHA != sha {
+			continue
+		}
+		tag, ok := strings.CutPrefix(ref, "refs/tags/")
+		if !ok {
+			continue
+		}
+		tag = strings.TrimSuffix(tag, "^{}")
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
 // Checkout checks out the provided version (branch, tag, or SHA) from the
 // already-cloned given git workspace. It uses the git CLI already installed on
 // the system.
@@ -79,8 +166,47 @@ func Checkout(ctx context.Context, version, workspaceDir string) error {
 	return nil
 }
 
-// NoSuchVersionError is returned from Checkout when the requested version
-// doesn't exist.
+// UpdateSubmodules initializes and checks out all git submodules, recursively,
+// at the SHAs recorded by the current HEAD of the given git workspace. It's a
+// no-op if the repo has no submodules.
+func UpdateSubmodules(ctx context.Context, dir string) error {
+	if _, _, err := run.Simple(ctx, "git", "-C", dir, "submodule", "update", "--init", "--recursive"); err != nil {
+		return err //nolint:wrapcheck
+	}
+	return nil
+}
+
+// Submodules returns the commit SHAs of the git submodules recorded by the
+// current HEAD of the given git workspace, keyed by the slash-separated path
+// of the submodule relative to the root of the workspace. Submodules nested
+// inside other submodules aren't included, since their SHAs are already
+// pinned by the commit of the outer submodule. This works whether or not the
+// submodules have been initialized. If there are no submodules, the returned
+// map is empty.
+func Submodules(ctx context.Context, dir string) (map[string]string, error) {
+	stdout, _, err := run.Simple(ctx, "git", "-C", dir, "ls-tree", "-r", "-z", "HEAD")
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	out := map[string]string{}
+	for _, entry := range strings.Split(stdout, "\x00") {
+		// Each entry looks like "<mode> <type> <sha>\t<path>". Submodules
+		// have the type "commit".
+		meta, path, ok := strings.Cut(entry, "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(meta)
+		if len(fields) != 3 || fields[1] != "commit" {
+			continue
+		}
+		out[path] = fields[2]
+	}
+	return out, nil
+}
+
+// NoSuchVersionError is returned from Checkout, and when resolving a version
+// to check out, when the requested version doesn't exist.
 type NoSuchVersionError struct {
 	Version string
 }
@@ -109,6 +235,33 @@ func LocalTags(ctx context.Context, tmpDir string) ([]string, error) {
 	return tags, nil
 }
 
+// RemoteTags looks up the tags in the given remote repo without cloning it. The
+// remote may be any format accepted by git, including a local path. If there
+// are no tags, that's not an error, and the returned slice is len 0. The return
+// values are sorted lexicographically.
+func RemoteTags(ctx context.Context, remote string) ([]string, error) {
+	stdout, _, err := run.Simple(ctx, "git", "ls-remote", "--tags", "--refs", "--", remote)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	lineScanner := bufio.NewScanner(strings.NewReader(stdout))
+	var tags []string
+	for lineScanner.Scan() {
+		// Each line looks like "<sha>\trefs/tags/<tag>".
+		_, ref, ok := strings.Cut(lineScanner.Text(), "\t")
+		if !ok {
+			continue
+		}
+		if tag, ok := strings.CutPrefix(ref, "refs/tags/"); ok {
+			tags = append(tags, tag)
+		}
+	}
+
+	sort.Strings(tags)
+
+	return tags, nil
+}
+
 // Workspace looks for the presence of a .git directory in parent directories
 // to determine the root directory of the git workspace containing "path".
 // Returns false if the given path is not inside a git workspace.
@@ -182,7 +335,7 @@ func HeadTags(ctx context.Context, dir string) ([]string, error) {
 		tokens := strings.Split(line, "\t")
 		const tagPrefix = "refs/tags/"
 		if len(tokens) != 2 || !strings.HasPrefix(tokens[1], tagPrefix) {
-			return nil, fmt.Errorf("internal error: unexpected output format from \"git for-each-ref\": %s", trimmed)
+			return nil, common.InternalErrorf("unexpected output format from \"git for-each-ref\": %s", trimmed)
 		}
 
 		tag := tokens[1]
@@ -203,3 +356,80 @@ func CurrentSHA(ctx context.Context, dir string) (string, error) {
 	}
 	return strings.TrimSpace(stdout), nil
 }
+
+// Init creates a new git repo in the given directory, which must already
+// exist.
+func Init(ctx context.Context, dir string) error {
+	if _, _, err := run.Simple(ctx, "git", "-C", dir, "init"); err != nil {
+		return err //nolint:wrapcheck
+	}
+	return nil
+}
+
+// SwitchBranch checks out the given branch in the git workspace containing dir,
+// creating it from the current HEAD if it doesn't already exist. This also
+// works in a freshly initialized repo that has no commits yet.
+func SwitchBranch(ctx context.Context, dir, branch string) error {
+	if branch == "" {
+		return fmt.Errorf("empty string is not a valid branch name")
+	}
+	if branch[0] == '-' {
+		return fmt.Errorf("branch names beginning with dash aren't supported")
+	}
+
+	exitCode, err := run.Run(ctx, []*run.Option{run.AllowNonzeroExit()},
+		"git", "-C", dir, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	args := []string{"git", "-C", dir, "checkout", branch}
+	if exitCode != 0 {
+		// The branch doesn't exist yet.
+		args = []string{"git", "-C", dir, "checkout", "-b", branch}
+	}
+	if _, _, err := run.Simple(ctx, args...); err != nil {
+		return err //nolint:wrapcheck
+	}
+	return nil
+}
+
+// CommitAll stages every change (including new and deleted files) beneath dir
+// and commits them with the given message. Changes in the workspace outside of
+// dir are not committed. Returns false if there was nothing to commit.
+func CommitAll(ctx context.Context, dir, message string) (bool, error) {
+	if _, _, err := run.Simple(ctx, "git", "-C", dir, "add", "--all", "--", "."); err != nil {
+		return false, err //nolint:wrapcheck
+	}
+
+	// "git diff --quiet" exits 1 if there are differences.
+	exitCode, err := run.Run(ctx, []*run.Option{run.AllowNonzeroExit()},
+		"git", "-C", dir, "diff", "--cached", "--quiet", "--", ".")
+	if err != nil {
+		return false, err //nolint:wrapcheck
+	}
+	if exitCode == 0 {
+		return false, nil
+	}
+
+	if _, _, err := run.Simple(ctx, "git", "-C", dir, "commit", "--message", message, "--", "."); err != nil {
+		return false, err //nolint:wrapcheck
+	}
+	return true, nil
+}
+
+// OriginURL returns the URL of the "origin" remote of the given git workspace.
+// Returns false if the workspace has no remote named "origin", which is common
+// for repos that were created locally and never pushed.
+func OriginURL(ctx context.Context, dir string) (string, bool, error) {
+	var stdout bytes.Buffer
+	exitCode, err := run.Run(ctx, []*run.Option{run.AllowNonzeroExit(), run.WithStdout(&stdout)},
+		"git", "-C", dir, "remote", "get-url", "origin")
+	if err != nil {
+		return "", false, err //nolint:wrapcheck
+	}
+	if exitCode != 0 {
+		return "", false, nil
+	}
+	return strings.TrimSpace(stdout.String()), true, nil
+}
@@ -18,6 +18,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -95,6 +96,45 @@ func TestLocalTags(t *testing.T) {
 	}
 }
 
+func TestRemoteTags(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	tempDir := t.TempDir()
+
+	abctestutil.WriteAll(t, tempDir, abctestutil.WithGitRepoAt("", nil))
+
+	got, err := RemoteTags(ctx, tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("got %d tags, but expected 0 tags in an empty repo", len(got))
+	}
+
+	abctestutil.OverwriteJoin(t, tempDir, "myfile1.txt", "some contents")
+	mustRun(ctx, t, "git", "config", "-f", tempDir+"/.git/config", "user.email", "fake@example.com")
+	mustRun(ctx, t, "git", "config", "-f", tempDir+"/.git/config", "user.name", "Nobody")
+	mustRun(ctx, t, "git", "-C", tempDir, "add", "-A")
+	mustRun(ctx, t, "git", "-C", tempDir, "commit", "--no-gpg-sign", "--author", "nobody <nobody>", "-m", "my first commit")
+	mustRun(ctx, t, "git", "-C", tempDir, "tag", "v1.0.0")
+	mustRun(ctx, t, "git", "-C", tempDir, "tag", "-a", "-m", "annotated", "mytag")
+
+	got, err = RemoteTags(ctx, tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"mytag", "v1.0.0"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("got tags %v, want %v", got, want)
+	}
+
+	if _, err := RemoteTags(ctx, filepath.Join(tempDir, "nonexistent")); err == nil {
+		t.Fatal("got no error for a nonexistent repo, want one")
+	}
+}
+
 func TestClone(t *testing.T) {
 	skipUnlessEnvEnabled(t)
 
@@ -147,6 +187,158 @@ func TestClone(t *testing.T) {
 	}
 }
 
+func TestFetchSHA(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	remoteDir := t.TempDir()
+	mustRun(ctx, t, "git", "-C", remoteDir, "init", "--quiet", "--initial-branch=main")
+	mustRun(ctx, t, "git", "-C", remoteDir, "config", "user.email", "fake@example.com")
+	mustRun(ctx, t, "git", "-C", remoteDir, "config", "user.name", "Nobody")
+	// Without this, whether an unreachable commit can be fetched depends on
+	// the git version and protocol.
+	mustRun(ctx, t, "git", "-C", remoteDir, "config", "uploadpack.allowAnySHA1InWant", "true")
+
+	commit := func(contents string) string {
+		t.Helper()
+		abctestutil.OverwriteJoin(t, remoteDir, "myfile.txt", contents)
+		mustRun(ctx, t, "git", "-C", remoteDir, "add", "-A")
+		mustRun(ctx, t, "git", "-C", remoteDir, "commit", "--quiet", "--no-gpg-sign", "-m", contents)
+		sha, err := CurrentSHA(ctx, remoteDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sha
+	}
+
+	taggedSHA := commit("tagged")
+	mustRun(ctx, t, "git", "-C", remoteDir, "tag", "v1.0.0")
+	mustRun(ctx, t, "git", "-C", remoteDir, "tag", "-a", "-m", "annotated", "v1.0.1")
+	headSHA := commit("head")
+
+	// Create a commit that no branch or tag points to.
+	mustRun(ctx, t, "git", "-C", remoteDir, "checkout", "--quiet", "-b", "doomed")
+	unreachableSHA := commit("unreachable")
+	mustRun(ctx, t, "git", "-C", remoteDir, "checkout", "--quiet", "main")
+	mustRun(ctx, t, "git", "-C", remoteDir, "branch", "--quiet", "-D", "doomed")
+
+	remote := "file://" + remoteDir
+
+	cases := []struct {
+		name         string
+		sha          string
+		wantContents string
+		wantTags     []string
+		wantErr      string
+	}{
+		{
+			name:         "tagged_commit",
+			sha:          taggedSHA,
+			wantContents: "tagged",
+			wantTags:     []string{"v1.0.0", "v1.0.1"},
+		},
+		{
+			name:         "untagged_commit",
+			sha:          headSHA,
+			wantContents: "head",
+		},
+		{
+			name:         "unreachable_commit",
+			sha:          unreachableSHA,
+			wantContents: "unreachable",
+		},
+		{
+			name:    "nonexistent_commit",
+			sha:     "0123456789012345678901234567890123456789",
+			wantErr: "doesn't exist",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			outDir := t.TempDir()
+			err := FetchSHA(ctx, remote, tc.sha, outDir)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if tc.wantErr != "" {
+				return
+			}
+
+			gotSHA, err := CurrentSHA(ctx, outDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotSHA != tc.sha {
+				t.Errorf("got HEAD %q, want %q", gotSHA, tc.sha)
+			}
+			gotContents, err := os.ReadFile(filepath.Join(outDir, "myfile.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(gotContents) != tc.wantContents {
+				t.Errorf("got file contents %q, want %q", gotContents, tc.wantContents)
+			}
+			gotTags, err := HeadTags(ctx, outDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(gotTags, tc.wantTags) {
+				t.Errorf("got tags %v, want %v", gotTags, tc.wantTags)
+			}
+		})
+	}
+}
+
+func TestSubmodules(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	tempDir := t.TempDir()
+	mustRun(ctx, t, "git", "-C", tempDir, "init", "--quiet")
+	mustRun(ctx, t, "git", "-C", tempDir, "config", "user.email", "fake@example.com")
+	mustRun(ctx, t, "git", "-C", tempDir, "config", "user.name", "Nobody")
+	abctestutil.OverwriteJoin(t, tempDir, "myfile.txt", "some contents")
+	mustRun(ctx, t, "git", "-C", tempDir, "add", "-A")
+	mustRun(ctx, t, "git", "-C", tempDir, "commit", "--quiet", "--no-gpg-sign", "-m", "no submodules")
+
+	got, err := Submodules(ctx, tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("got submodules %v, want none", got)
+	}
+
+	// A gitlink entry in the index is what "git submodule add" creates. We
+	// don't need the submodule to actually exist to record it.
+	const (
+		sha1 = "0123456789012345678901234567890123456789"
+		sha2 = "9876543210987654321098765432109876543210"
+	)
+	mustRun(ctx, t, "git", "-C", tempDir, "update-index", "--add", "--cacheinfo", "160000,"+sha1+",shared")
+	mustRun(ctx, t, "git", "-C", tempDir, "update-index", "--add", "--cacheinfo", "160000,"+sha2+",sub/dir/other")
+	mustRun(ctx, t, "git", "-C", tempDir, "commit", "--quiet", "--no-gpg-sign", "-m", "add submodules")
+
+	got, err = Submodules(ctx, tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"shared":        sha1,
+		"sub/dir/other": sha2,
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("submodules were not as expected (-got,+want): %s", diff)
+	}
+}
+
 func TestHeadTags(t *testing.T) {
 	t.Parallel()
 
@@ -295,3 +487,112 @@ func mustRun(ctx context.Context, tb testing.TB, args ...string) {
 		tb.Fatal(err)
 	}
 }
+
+func TestSwitchBranchAndCommitAll(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	tempDir := t.TempDir()
+
+	if err := Init(ctx, tempDir); err != nil {
+		t.Fatal(err)
+	}
+	mustRun(ctx, t, "git", "config", "-f", tempDir+"/.git/config", "user.email", "fake@example.com")
+	mustRun(ctx, t, "git", "config", "-f", tempDir+"/.git/config", "user.name", "Nobody")
+	mustRun(ctx, t, "git", "config", "-f", tempDir+"/.git/config", "commit.gpgsign", "false")
+
+	// Switching branches works before the first commit.
+	if err := SwitchBranch(ctx, tempDir, "first"); err != nil {
+		t.Fatal(err)
+	}
+
+	abctestutil.WriteAll(t, tempDir, map[string]string{
+		"subdir/a.txt": "a",
+		"other.txt":    "other",
+	})
+
+	committed, err := CommitAll(ctx, filepath.Join(tempDir, "subdir"), "my commit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !committed {
+		t.Fatal("CommitAll returned false, wanted a commit")
+	}
+
+	stdout, _, err := run.Simple(ctx, "git", "-C", tempDir, "log", "--format=%s", "--name-only", "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "my commit\n\nsubdir/a.txt\n"; stdout != want {
+		t.Errorf("got git log %q, want %q", stdout, want)
+	}
+
+	// Files outside the directory were left uncommitted.
+	clean, err := IsClean(ctx, tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clean {
+		t.Error("got a clean workspace, but other.txt should be uncommitted")
+	}
+
+	// Nothing left to commit in subdir.
+	committed, err = CommitAll(ctx, filepath.Join(tempDir, "subdir"), "empty commit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if committed {
+		t.Error("CommitAll returned true, but there was nothing to commit")
+	}
+
+	// Create a second branch, then switch back to the existing first one.
+	if err := SwitchBranch(ctx, tempDir, "second"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SwitchBranch(ctx, tempDir, "first"); err != nil {
+		t.Fatal(err)
+	}
+	stdout, _, err = run.Simple(ctx, "git", "-C", tempDir, "branch", "--show-current")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(stdout); got != "first" {
+		t.Errorf("got current branch %q, want %q", got, "first")
+	}
+
+	if err := SwitchBranch(ctx, tempDir, "-foo"); err == nil {
+		t.Error("got no error for branch name beginning with dash")
+	}
+}
+
+func TestOriginURL(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	tempDir := t.TempDir()
+
+	if err := Init(ctx, tempDir); err != nil {
+		t.Fatal(err)
+	}
+
+	_, ok, err := OriginURL(ctx, tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("OriginURL returned true for a repo with no origin remote")
+	}
+
+	const want = "https://github.com/abcxyz/abc.git"
+	mustRun(ctx, t, "git", "-C", tempDir, "remote", "add", "origin", want)
+	got, ok, err := OriginURL(ctx, tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("OriginURL returned false, but an origin remote was added")
+	}
+	if got != want {
+		t.Errorf("got origin URL %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,534 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package githubdest writes rendered files to a branch of a GitHub repo
+// through the GitHub REST API, so that no local checkout is needed.
+package githubdest
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/abcxyz/pkg/logging"
+)
+
+// DefaultAPIURL is the base URL of the public GitHub REST API.
+const DefaultAPIURL = "https://api.github.com"
+
+// DefaultMaxSnapshotFiles is the default for Client.MaxSnapshotFiles.
+const DefaultMaxSnapshotFiles = 500
+
+const (
+	modeRegular    = "100644"
+	modeExecutable = "100755"
+)
+
+// errNotFound is returned by the HTTP helpers when the API responds with 404.
+var errNotFound = errors.New("not found")
+
+// errConflict is returned by the HTTP helpers when the API responds with 409.
+var errConflict = errors.New("conflict")
+
+// errEmptyRepo is returned by branchHead when the API responds with 409, which
+// GitHub does for ref lookups in a repo with no commits. A 409 from any other
+// endpoint, like a conflicting ref update, is just an error.
+var errEmptyRepo = errors.New("the repo is empty")
+
+// Client calls the parts of the GitHub REST API needed to commit files to a
+// branch.
+type Client struct {
+	// HTTPClient is used for all requests. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// APIURL is the base URL of the API, like DefaultAPIURL. It's configurable
+	// for GitHub Enterprise Server and for testing.
+	APIURL string
+
+	// Token authenticates requests. It needs permission to write the repo's
+	// contents.
+	Token string
+
+	// MaxSnapshotFiles is the most files that Snapshot will download. Each
+	// file is a separate API request, so a large directory would use up the
+	// API rate limit; it's an error instead. If zero,
+	// DefaultMaxSnapshotFiles is used.
+	MaxSnapshotFiles int
+}
+
+// File is a regular file in a GitHub repo.
+type File struct {
+	// Path is slash-separated and relative to the root of the repo.
+	Path       string
+	Contents   []byte
+	Executable bool
+}
+
+// Snapshot is the state of a branch that a new commit will be made on top of.
+type Snapshot struct {
+	// Repo is the repo name, like "my-org/my-repo".
+	Repo string
+
+	// Branch is the branch that the commit will be pushed to.
+	Branch string
+
+	// BranchExists is false when Branch will be created by the commit, starting
+	// from ParentSHA.
+	BranchExists bool
+
+	// ParentSHA is the commit that the new commit will have as its parent. It's
+	// empty if the repo has no commits yet.
+	ParentSHA string
+
+	// TreeSHA is the tree of ParentSHA.
+	TreeSHA string
+
+	// Files are the existing files under the directory that was requested.
+	Files []*File
+}
+
+// CommitResult describes a commit that was pushed.
+type CommitResult struct {
+	// SHA is the ID of the new commit. It's empty if no commit was needed
+	// because nothing changed.
+	SHA string
+
+	// URL is the web URL of the new commit, if GitHub returned one.
+	URL string
+}
+
+// Snapshot fetches the head of the given branch of repo and the files under
+// dir, which is slash-separated and relative to the repo root ("" or "." means
+// the whole repo). If branch doesn't exist yet, the snapshot is of baseBranch,
+// and the commit will create branch. An empty branch or baseBranch means the
+// repo's default branch.
+func (c *Client) Snapshot(ctx context.Context, repo, branch, baseBranch, dir string) (*Snapshot, error) {
+	logger := logging.FromContext(ctx).With("logger", "Snapshot")
+
+	if err := validateRepo(repo); err != nil {
+		return nil, err
+	}
+
+	var defaultBranch string
+	if branch == "" || baseBranch == "" {
+		var err error
+		if defaultBranch, err = c.defaultBranch(ctx, repo); err != nil {
+			return nil, err
+		}
+		if branch == "" {
+			branch = defaultBranch
+		}
+		if baseBranch == "" {
+			baseBranch = defaultBranch
+		}
+	}
+
+	out := &Snapshot{
+		Repo:         repo,
+		Branch:       branch,
+		BranchExists: true,
+	}
+
+	sha, err := c.branchHead(ctx, repo, branch)
+	if errors.Is(err, errNotFound) && baseBranch != branch {
+		logger.DebugContext(ctx, "branch doesn't exist yet, starting from the base branch",
+			"branch", branch,
+			"base_branch", baseBranch)
+		out.BranchExists = false
+		sha, err = c.branchHead(ctx, repo, baseBranch)
+	}
+	if errors.Is(err, errEmptyRepo) {
+		logger.DebugContext(ctx, "repo has no commits yet", "repo", repo)
+		out.BranchExists = false
+		return out, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	out.ParentSHA = sha
+
+	var commit struct {
+		Tree struct {
+			SHA string `json:"sha"`
+		} `json:"tree"`
+	}
+	if err := c.getJSON(ctx, c.repoURL(repo, "git", "commits", sha), &commit); err != nil {
+		return nil, fmt.Errorf("failed reading commit %s: %w", sha, err)
+	}
+	out.TreeSHA = commit.Tree.SHA
+
+	if out.Files, err = c.treeFiles(ctx, repo, out.TreeSHA, dir); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Commit pushes a single commit containing files on top of the snapshot. The
+// files are added to or replace the files in the snapshot; files that aren't
+// mentioned are left alone. Files whose contents are identical to the snapshot
+// are skipped, and if nothing is left then no commit is made.
+func (c *Client) Commit(ctx context.Context, s *Snapshot, message string, files []*File) (*CommitResult, error) {
+	logger := logging.FromContext(ctx).With("logger", "Commit")
+
+	existing := make(map[string]*File, len(s.Files))
+	for _, f := range s.Files {
+		existing[f.Path] = f
+	}
+	var changed []*File
+	for _, f := range files {
+		if old, ok := existing[f.Path]; ok && bytes.Equal(old.Contents, f.Contents) && old.Executable == f.Executable {
+			continue
+		}
+		changed = append(changed, f)
+	}
+	if len(changed) == 0 {
+		logger.DebugContext(ctx, "no files changed, not making a commit")
+		return &CommitResult{}, nil
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i].Path < changed[j].Path })
+
+	parents := []string{}
+	treeSHA := s.TreeSHA
+	replaceBootstrap := false
+	if s.ParentSHA == "" {
+		// The git database API refuses to work with a repo that has no commits,
+		// so a first commit is made through the contents API. If there's more
+		// than one file, that commit is then replaced by a root commit with all
+		// of them, so the branch still ends up with a single commit.
+		sha, err := c.bootstrap(ctx, s, message, changed)
+		if err != nil {
+			return nil, err
+		}
+		if len(changed) == 1 {
+			return &CommitResult{SHA: sha}, nil
+		}
+		replaceBootstrap = true
+	} else {
+		parents = append(parents, s.ParentSHA)
+	}
+
+	type treeEntry struct {
+		Path string `json:"path"`
+		Mode string `json:"mode"`
+		Type string `json:"type"`
+		SHA  string `json:"sha"`
+	}
+	entries := make([]*treeEntry, 0, len(changed))
+	for _, f := range changed {
+		var blob struct {
+			SHA string `json:"sha"`
+		}
+		req := map[string]string{
+			"content":  base64.StdEncoding.EncodeToString(f.Contents),
+			"encoding": "base64",
+		}
+		if err := c.sendJSON(ctx, http.MethodPost, c.repoURL(s.Repo, "git", "blobs"), req, &blob); err != nil {
+			return nil, fmt.Errorf("failed uploading %q: %w", f.Path, err)
+		}
+		mode := modeRegular
+		if f.Executable {
+			mode = modeExecutable
+		}
+		entries = append(entries, &treeEntry{Path: f.Path, Mode: mode, Type: "blob", SHA: blob.SHA})
+	}
+
+	var tree struct {
+		SHA string `json:"sha"`
+	}
+	treeReq := map[string]any{
+		"tree": entries,
+	}
+	if treeSHA != "" {
+		treeReq["base_tree"] = treeSHA
+	}
+	if err := c.sendJSON(ctx, http.MethodPost, c.repoURL(s.Repo, "git", "trees"), treeReq, &tree); err != nil {
+		return nil, fmt.Errorf("failed creating tree: %w", err)
+	}
+
+	var commit struct {
+		SHA     string `json:"sha"`
+		HTMLURL string `json:"html_url"`
+	}
+	commitReq := map[string]any{
+		"message": message,
+		"tree":    tree.SHA,
+		"parents": parents,
+	}
+	if err := c.sendJSON(ctx, http.MethodPost, c.repoURL(s.Repo, "git", "commits"), commitReq, &commit); err != nil {
+		return nil, fmt.Errorf("failed creating commit: %w", err)
+	}
+
+	if err := c.updateBranch(ctx, s, commit.SHA, replaceBootstrap); err != nil {
+		return nil, err
+	}
+	logger.DebugContext(ctx, "pushed commit",
+		"repo", s.Repo,
+		"branch", s.Branch,
+		"sha", commit.SHA,
+		"files", len(entries))
+	return &CommitResult{SHA: commit.SHA, URL: commit.HTMLURL}, nil
+}
+
+// updateBranch points the snapshot's branch at the given commit, creating the
+// branch if needed. Unless force is set, which is only done to replace the
+// commit made by bootstrap moments earlier, it's not a force-push, so if
+// someone else pushed to the branch since the snapshot was taken, this fails
+// rather than losing their work.
+func (c *Client) updateBranch(ctx context.Context, s *Snapshot, sha string, force bool) error {
+	if !s.BranchExists {
+		req := map[string]string{
+			"ref": "refs/heads/" + s.Branch,
+			"sha": sha,
+		}
+		if err := c.sendJSON(ctx, http.MethodPost, c.repoURL(s.Repo, "git", "refs"), req, nil); err != nil {
+			return fmt.Errorf("failed creating branch %q: %w", s.Branch, err)
+		}
+		return nil
+	}
+	req := map[string]any{
+		"sha":   sha,
+		"force": force,
+	}
+	if err := c.sendJSON(ctx, http.MethodPatch, c.repoURL(s.Repo, refElems("refs", s.Branch)...), req, nil); err != nil {
+		return fmt.Errorf("failed updating branch %q (was it changed by someone else while rendering?): %w", s.Branch, err)
+	}
+	return nil
+}
+
+// bootstrap creates the first commit in an empty repo, containing just one of
+// files, and returns the new commit. The contents API can't create executable
+// files, so the first regular file is used.
+func (c *Client) bootstrap(ctx context.Context, s *Snapshot, message string, files []*File) (string, error) {
+	var f *File
+	for _, candidate := range files {
+		if !candidate.Executable {
+			f = candidate
+			break
+		}
+	}
+	if f == nil {
+		return "", fmt.Errorf("can't create only executable files in empty repo %q; add any commit to the repo first", s.Repo)
+	}
+	req := map[string]string{
+		"message": message,
+		"content": base64.StdEncoding.EncodeToString(f.Contents),
+		"branch":  s.Branch,
+	}
+	var resp struct {
+		Commit struct {
+			SHA string `json:"sha"`
+		} `json:"commit"`
+	}
+	u := c.repoURL(s.Repo, append([]string{"contents"}, strings.Split(f.Path, "/")...)...)
+	if err := c.sendJSON(ctx, http.MethodPut, u, req, &resp); err != nil {
+		return "", fmt.Errorf("failed creating the first commit in empty repo %q: %w", s.Repo, err)
+	}
+	s.BranchExists = true
+	return resp.Commit.SHA, nil
+}
+
+// defaultBranch returns the name of the repo's default branch.
+func (c *Client) defaultBranch(ctx context.Context, repo string) (string, error) {
+	var resp struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	if err := c.getJSON(ctx, c.repoURL(repo), &resp); err != nil {
+		return "", fmt.Errorf("failed looking up repo %q: %w", repo, err)
+	}
+	return resp.DefaultBranch, nil
+}
+
+// branchHead returns the commit SHA that the branch points to.
+func (c *Client) branchHead(ctx context.Context, repo, branch string) (string, error) {
+	var resp struct {
+		Object struct {
+			SHA string `json:"sha"`
+		} `json:"object"`
+	}
+	if err := c.getJSON(ctx, c.repoURL(repo, refElems("ref", branch)...), &resp); err != nil {
+		if errors.Is(err, errConflict) {
+			err = fmt.Errorf("%w: %w", errEmptyRepo, err)
+		}
+		return "", fmt.Errorf("failed looking up branch %q: %w", branch, err)
+	}
+	return resp.Object.SHA, nil
+}
+
+// treeFiles returns the regular files under dir in the given tree, with their
+// contents.
+func (c *Client) treeFiles(ctx context.Context, repo, treeSHA, dir string) ([]*File, error) {
+	var resp struct {
+		Truncated bool `json:"truncated"`
+		Tree      []struct {
+			Path string `json:"path"`
+			Mode string `json:"mode"`
+			Type string `json:"type"`
+			SHA  string `json:"sha"`
+		} `json:"tree"`
+	}
+	if err := c.getJSON(ctx, c.repoURL(repo, "git", "trees", treeSHA)+"?recursive=1", &resp); err != nil {
+		return nil, fmt.Errorf("failed listing files: %w", err)
+	}
+	if resp.Truncated {
+		return nil, fmt.Errorf("repo %q has too many files for GitHub to list at once", repo)
+	}
+
+	prefix := ""
+	if dir = path.Clean(dir); dir != "." {
+		prefix = dir + "/"
+	}
+	entries := resp.Tree[:0]
+	for _, entry := range resp.Tree {
+		if entry.Type != "blob" || !strings.HasPrefix(entry.Path, prefix) {
+			continue
+		}
+		if entry.Mode != modeRegular && entry.Mode != modeExecutable {
+			continue // symlinks aren't supported
+		}
+		entries = append(entries, entry)
+	}
+
+	// Check before downloading anything, so a too-large directory fails fast
+	// rather than after using up the rate limit.
+	maxFiles := c.MaxSnapshotFiles
+	if maxFiles == 0 {
+		maxFiles = DefaultMaxSnapshotFiles
+	}
+	if len(entries) > maxFiles {
+		return nil, fmt.Errorf("directory %q of repo %q has %d files, more than the %d that can be downloaded through the GitHub API; render into a smaller directory of the repo", dir, repo, len(entries), maxFiles)
+	}
+
+	out := make([]*File, 0, len(entries))
+	for _, entry := range entries {
+		contents, err := c.do(ctx, http.MethodGet, c.repoURL(repo, "git", "blobs", entry.SHA), "application/vnd.github.raw", nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed downloading %q: %w", entry.Path, err)
+		}
+		out = append(out, &File{
+			Path:       entry.Path,
+			Contents:   contents,
+			Executable: entry.Mode == modeExecutable,
+		})
+	}
+	return out, nil
+}
+
+func (c *Client) repoURL(repo string, elems ...string) string {
+	u := strings.TrimSuffix(c.APIURL, "/") + "/repos/" + repo
+	for _, e := range elems {
+		u += "/" + url.PathEscape(e)
+	}
+	return u
+}
+
+func (c *Client) getJSON(ctx context.Context, u string, out any) error {
+	body, err := c.do(ctx, http.MethodGet, u, "application/vnd.github+json", nil)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed parsing GitHub API response: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) sendJSON(ctx context.Context, method, u string, in, out any) error {
+	reqBody, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("failed marshaling request: %w", err)
+	}
+	body, err := c.do(ctx, method, u, "application/vnd.github+json", reqBody)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed parsing GitHub API response: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, method, u, accept string, reqBody []byte) ([]byte, error) {
+	var r io.Reader
+	if reqBody != nil {
+		r = bytes.NewReader(reqBody)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating request: %w", err)
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed calling the GitHub API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		err := fmt.Errorf("got HTTP status %q from %s %s: %s", resp.Status, method, u, bytes.TrimSpace(msg))
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			err = fmt.Errorf("%w: %w", errNotFound, err)
+		case resp.StatusCode == http.StatusConflict:
+			err = fmt.Errorf("%w: %w", errConflict, err)
+		case resp.Header.Get("X-RateLimit-Remaining") == "0":
+			err = fmt.Errorf("%w; the GitHub API rate limit was exceeded, try again later", err)
+		}
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading GitHub API response: %w", err)
+	}
+	return body, nil
+}
+
+// refElems returns the URL path elements for a branch in the git refs API.
+// Slashes in branch names are kept as path separators, as GitHub expects.
+func refElems(endpoint, branch string) []string {
+	return append([]string{"git", endpoint, "heads"}, strings.Split(branch, "/")...)
+}
+
+// validateRepo checks that repo looks like "owner/name".
+func validateRepo(repo string) error {
+	owner, name, ok := strings.Cut(repo, "/")
+	if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("GitHub repo %q must be of the form OWNER/NAME", repo)
+	}
+	return nil
+}
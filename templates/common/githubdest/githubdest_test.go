@@ -0,0 +1,520 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubdest
+
+import (
+	"context"
+	"crypto/sha1" //nolint:gosec // only used to make fake object IDs
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestSnapshotAndCommit(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name         string
+		initial      map[string]string // nil means an empty repo
+		branch       string
+		baseBranch   string
+		dir          string
+		maxFiles     int
+		files        []*File
+		wantSnapshot map[string]string
+		wantBranches map[string]map[string]string
+		wantHistory  int // the number of commits on "main", if nonzero
+		wantNoCommit bool
+		wantErr      string
+	}{
+		{
+			name:         "update_existing_branch",
+			initial:      map[string]string{"README.md": "hi", "sub/a.txt": "old"},
+			dir:          "sub",
+			files:        []*File{{Path: "sub/a.txt", Contents: []byte("new")}, {Path: "sub/run.sh", Contents: []byte("#!/bin/sh"), Executable: true}},
+			wantSnapshot: map[string]string{"sub/a.txt": "old"},
+			wantBranches: map[string]map[string]string{
+				"main": {"README.md": "hi", "sub/a.txt": "new", "sub/run.sh": "#!/bin/sh (executable)"},
+			},
+		},
+		{
+			name:         "new_branch_from_default",
+			initial:      map[string]string{"README.md": "hi"},
+			branch:       "abc/render",
+			files:        []*File{{Path: "out.txt", Contents: []byte("rendered")}},
+			wantSnapshot: map[string]string{"README.md": "hi"},
+			wantBranches: map[string]map[string]string{
+				"main":       {"README.md": "hi"},
+				"abc/render": {"README.md": "hi", "out.txt": "rendered"},
+			},
+		},
+		{
+			name:         "unchanged_files_make_no_commit",
+			initial:      map[string]string{"a.txt": "same"},
+			files:        []*File{{Path: "a.txt", Contents: []byte("same")}},
+			wantSnapshot: map[string]string{"a.txt": "same"},
+			wantBranches: map[string]map[string]string{"main": {"a.txt": "same"}},
+			wantNoCommit: true,
+		},
+		{
+			name:         "empty_repo",
+			files:        []*File{{Path: "a.txt", Contents: []byte("first")}, {Path: "b.txt", Contents: []byte("second")}},
+			wantSnapshot: map[string]string{},
+			wantBranches: map[string]map[string]string{"main": {"a.txt": "first", "b.txt": "second"}},
+			wantHistory:  1,
+		},
+		{
+			name:         "empty_repo_single_file",
+			files:        []*File{{Path: "a.txt", Contents: []byte("first")}},
+			wantSnapshot: map[string]string{},
+			wantBranches: map[string]map[string]string{"main": {"a.txt": "first"}},
+			wantHistory:  1,
+		},
+		{
+			name: "empty_repo_executable_first",
+			files: []*File{
+				{Path: "a.sh", Contents: []byte("#!/bin/sh"), Executable: true},
+				{Path: "b.txt", Contents: []byte("second")},
+			},
+			wantSnapshot: map[string]string{},
+			wantBranches: map[string]map[string]string{"main": {"a.sh": "#!/bin/sh (executable)", "b.txt": "second"}},
+			wantHistory:  1,
+		},
+		{
+			name:         "existing_branch_adds_one_commit",
+			initial:      map[string]string{"a.txt": "a"},
+			files:        []*File{{Path: "a.txt", Contents: []byte("b")}, {Path: "c.txt", Contents: []byte("c")}},
+			wantSnapshot: map[string]string{"a.txt": "a"},
+			wantBranches: map[string]map[string]string{"main": {"a.txt": "b", "c.txt": "c"}},
+			wantHistory:  2,
+		},
+		{
+			name:         "files_under_dir_within_limit",
+			initial:      map[string]string{"sub/a.txt": "a", "sub/b.txt": "b", "other/c.txt": "c", "other/d.txt": "d"},
+			dir:          "sub",
+			maxFiles:     2,
+			wantSnapshot: map[string]string{"sub/a.txt": "a", "sub/b.txt": "b"},
+			wantBranches: map[string]map[string]string{"main": {"sub/a.txt": "a", "sub/b.txt": "b", "other/c.txt": "c", "other/d.txt": "d"}},
+			wantNoCommit: true,
+		},
+		{
+			name:     "too_many_files",
+			initial:  map[string]string{"a.txt": "a", "b.txt": "b", "c.txt": "c"},
+			maxFiles: 2,
+			wantErr:  `directory "." of repo "my-org/my-repo" has 3 files, more than the 2 that can be downloaded`,
+		},
+		{
+			name:       "missing_base_branch",
+			initial:    map[string]string{"a.txt": "a"},
+			branch:     "new",
+			baseBranch: "nonexistent",
+			wantErr:    `failed looking up branch "nonexistent"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			fake := newFakeGitHub(t, tc.initial)
+			client := &Client{
+				HTTPClient:       fake.server.Client(),
+				APIURL:           fake.server.URL,
+				Token:            "fake-token",
+				MaxSnapshotFiles: tc.maxFiles,
+			}
+
+			snap, err := client.Snapshot(ctx, "my-org/my-repo", tc.branch, tc.baseBranch, tc.dir)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(filesToMap(snap.Files), tc.wantSnapshot); diff != "" {
+				t.Errorf("snapshot files were not as expected (-got,+want): %s", diff)
+			}
+
+			result, err := client.Commit(ctx, snap, "Render template", tc.files)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := result.SHA == ""; got != tc.wantNoCommit {
+				t.Errorf("got commit SHA %q, wanted no commit: %t", result.SHA, tc.wantNoCommit)
+			}
+			if diff := cmp.Diff(fake.branchContents(), tc.wantBranches); diff != "" {
+				t.Errorf("branch contents were not as expected (-got,+want): %s", diff)
+			}
+			if got := fake.historyLen("main"); tc.wantHistory != 0 && got != tc.wantHistory {
+				t.Errorf("got %d commits on main, want %d", got, tc.wantHistory)
+			}
+		})
+	}
+}
+
+func TestCommit_BranchMovedSinceSnapshot(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	fake := newFakeGitHub(t, map[string]string{"a.txt": "a"})
+	client := &Client{HTTPClient: fake.server.Client(), APIURL: fake.server.URL}
+
+	snap, err := client.Snapshot(ctx, "my-org/my-repo", "main", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.commitDirect("main", map[string]string{"a.txt": "someone else's change"})
+
+	_, err = client.Commit(ctx, snap, "Render template", []*File{{Path: "a.txt", Contents: []byte("mine")}})
+	if diff := testutil.DiffErrString(err, `failed updating branch "main"`); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestConflictIsOnlyEmptyRepoForRefLookup(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/git/ref/") {
+			_ = json.NewEncoder(w).Encode(map[string]any{"object": map[string]string{"sha": "abc123"}})
+			return
+		}
+		http.Error(w, "Conflict", http.StatusConflict)
+	}))
+	t.Cleanup(server.Close)
+	client := &Client{HTTPClient: server.Client(), APIURL: server.URL}
+
+	_, err := client.Snapshot(ctx, "my-org/my-repo", "main", "main", "")
+	if diff := testutil.DiffErrString(err, "failed reading commit abc123"); diff != "" {
+		t.Error(diff)
+	}
+	if errors.Is(err, errEmptyRepo) {
+		t.Errorf("a 409 from the commits endpoint was treated as an empty repo: %v", err)
+	}
+
+	err = client.updateBranch(ctx, &Snapshot{Repo: "my-org/my-repo", Branch: "main", BranchExists: true}, "def456", false)
+	if diff := testutil.DiffErrString(err, `failed updating branch "main"`); diff != "" {
+		t.Error(diff)
+	}
+	if errors.Is(err, errEmptyRepo) {
+		t.Errorf("a 409 from updating a ref was treated as an empty repo: %v", err)
+	}
+}
+
+func TestValidateRepo(t *testing.T) {
+	t.Parallel()
+
+	for _, repo := range []string{"", "foo", "/foo", "foo/", "foo/bar/baz"} {
+		if err := validateRepo(repo); err == nil {
+			t.Errorf("validateRepo(%q) got no error, wanted one", repo)
+		}
+	}
+	if err := validateRepo("foo/bar"); err != nil {
+		t.Errorf("validateRepo(%q) got unexpected error: %v", "foo/bar", err)
+	}
+}
+
+func filesToMap(files []*File) map[string]string {
+	out := make(map[string]string, len(files))
+	for _, f := range files {
+		out[f.Path] = string(f.Contents)
+	}
+	return out
+}
+
+type fakeTreeEntry struct {
+	mode string
+	sha  string
+}
+
+// fakeGitHub is an in-memory implementation of the parts of the git database
+// and contents APIs that Client uses, for a single repo.
+type fakeGitHub struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu      sync.Mutex
+	blobs   map[string][]byte
+	trees   map[string]map[string]*fakeTreeEntry
+	commits map[string]string // commit SHA to tree SHA
+	parents map[string]string // commit SHA to parent commit SHA
+	refs    map[string]string // branch to commit SHA
+}
+
+func newFakeGitHub(t *testing.T, initial map[string]string) *fakeGitHub {
+	t.Helper()
+
+	f := &fakeGitHub{
+		t:       t,
+		blobs:   map[string][]byte{},
+		trees:   map[string]map[string]*fakeTreeEntry{},
+		commits: map[string]string{},
+		parents: map[string]string{},
+		refs:    map[string]string{},
+	}
+	if initial != nil {
+		f.commitDirect("main", initial)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/my-org/my-repo", func(w http.ResponseWriter, r *http.Request) {
+		f.writeJSON(w, map[string]string{"default_branch": "main"})
+	})
+	mux.HandleFunc("GET /repos/my-org/my-repo/git/ref/heads/{branch...}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if len(f.refs) == 0 {
+			http.Error(w, "Git Repository is empty.", http.StatusConflict)
+			return
+		}
+		sha, ok := f.refs[r.PathValue("branch")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		f.writeJSON(w, map[string]any{"object": map[string]string{"sha": sha}})
+	})
+	mux.HandleFunc("GET /repos/my-org/my-repo/git/commits/{sha}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.writeJSON(w, map[string]any{"tree": map[string]string{"sha": f.commits[r.PathValue("sha")]}})
+	})
+	mux.HandleFunc("GET /repos/my-org/my-repo/git/trees/{sha}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		var entries []map[string]string
+		for p, e := range f.trees[r.PathValue("sha")] {
+			entries = append(entries, map[string]string{"path": p, "mode": e.mode, "type": "blob", "sha": e.sha})
+		}
+		f.writeJSON(w, map[string]any{"tree": entries})
+	})
+	mux.HandleFunc("GET /repos/my-org/my-repo/git/blobs/{sha}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		_, _ = w.Write(f.blobs[r.PathValue("sha")])
+	})
+	mux.HandleFunc("POST /repos/my-org/my-repo/git/blobs", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Content string `json:"content"`
+		}
+		f.readJSON(r, &req)
+		contents, err := base64.StdEncoding.DecodeString(req.Content)
+		if err != nil {
+			t.Errorf("invalid base64 in blob: %v", err)
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.writeJSON(w, map[string]string{"sha": f.putBlob(contents)})
+	})
+	mux.HandleFunc("POST /repos/my-org/my-repo/git/trees", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			BaseTree string `json:"base_tree"`
+			Tree     []struct {
+				Path string `json:"path"`
+				Mode string `json:"mode"`
+				SHA  string `json:"sha"`
+			} `json:"tree"`
+		}
+		f.readJSON(r, &req)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		tree := map[string]*fakeTreeEntry{}
+		for p, e := range f.trees[req.BaseTree] {
+			tree[p] = e
+		}
+		for _, e := range req.Tree {
+			tree[e.Path] = &fakeTreeEntry{mode: e.Mode, sha: e.SHA}
+		}
+		f.writeJSON(w, map[string]string{"sha": f.putTree(tree)})
+	})
+	mux.HandleFunc("POST /repos/my-org/my-repo/git/commits", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Tree    string   `json:"tree"`
+			Parents []string `json:"parents"`
+		}
+		f.readJSON(r, &req)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		sha := fakeSHA(fmt.Sprintf("commit %s %v", req.Tree, req.Parents))
+		f.commits[sha] = req.Tree
+		if len(req.Parents) > 0 {
+			f.parents[sha] = req.Parents[0]
+		}
+		f.writeJSON(w, map[string]string{"sha": sha})
+	})
+	mux.HandleFunc("POST /repos/my-org/my-repo/git/refs", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Ref string `json:"ref"`
+			SHA string `json:"sha"`
+		}
+		f.readJSON(r, &req)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.refs[strings.TrimPrefix(req.Ref, "refs/heads/")] = req.SHA
+		w.WriteHeader(http.StatusCreated)
+		f.writeJSON(w, map[string]string{})
+	})
+	mux.HandleFunc("PATCH /repos/my-org/my-repo/git/refs/heads/{branch...}", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			SHA   string `json:"sha"`
+			Force bool   `json:"force"`
+		}
+		f.readJSON(r, &req)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		// Real GitHub allows any fast-forward, but here it's enough to check
+		// that the new commit's parent is the current head.
+		branch := r.PathValue("branch")
+		if !req.Force && f.parents[req.SHA] != f.refs[branch] {
+			http.Error(w, "Update is not a fast forward", http.StatusUnprocessableEntity)
+			return
+		}
+		f.refs[branch] = req.SHA
+		f.writeJSON(w, map[string]string{})
+	})
+	mux.HandleFunc("PUT /repos/my-org/my-repo/contents/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Content string `json:"content"`
+			Branch  string `json:"branch"`
+		}
+		f.readJSON(r, &req)
+		contents, err := base64.StdEncoding.DecodeString(req.Content)
+		if err != nil {
+			t.Errorf("invalid base64 in contents: %v", err)
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		sha := f.commitLocked(req.Branch, map[string]string{r.PathValue("path"): string(contents)})
+		f.writeJSON(w, map[string]any{"commit": map[string]any{"sha": sha, "tree": map[string]string{"sha": f.commits[sha]}}})
+	})
+
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.Header.Get("X-GitHub-Api-Version"), "2022-11-28"; got != want {
+			t.Errorf("got API version header %q, want %q", got, want)
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// commitDirect makes a commit on the branch as if someone else pushed it.
+func (f *fakeGitHub) commitDirect(branch string, files map[string]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commitLocked(branch, files)
+}
+
+func (f *fakeGitHub) commitLocked(branch string, files map[string]string) string {
+	tree := map[string]*fakeTreeEntry{}
+	parent := f.refs[branch]
+	for p, e := range f.trees[f.commits[parent]] {
+		tree[p] = e
+	}
+	for p, contents := range files {
+		tree[p] = &fakeTreeEntry{mode: modeRegular, sha: f.putBlob([]byte(contents))}
+	}
+	treeSHA := f.putTree(tree)
+	sha := fakeSHA(fmt.Sprintf("commit %s [%s] direct", treeSHA, parent))
+	f.commits[sha] = treeSHA
+	f.parents[sha] = parent
+	f.refs[branch] = sha
+	return sha
+}
+
+func (f *fakeGitHub) putBlob(contents []byte) string {
+	sha := fakeSHA("blob " + string(contents))
+	f.blobs[sha] = contents
+	return sha
+}
+
+func (f *fakeGitHub) putTree(tree map[string]*fakeTreeEntry) string {
+	paths := make([]string, 0, len(tree))
+	for p := range tree {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	var sb strings.Builder
+	for _, p := range paths {
+		fmt.Fprintf(&sb, "%s %s %s\n", tree[p].mode, tree[p].sha, p)
+	}
+	sha := fakeSHA("tree " + sb.String())
+	f.trees[sha] = tree
+	return sha
+}
+
+// branchContents returns the files in every branch, with " (executable)"
+// appended to the contents of executable files.
+func (f *fakeGitHub) branchContents() map[string]map[string]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := map[string]map[string]string{}
+	for branch, sha := range f.refs {
+		files := map[string]string{}
+		for p, e := range f.trees[f.commits[sha]] {
+			contents := string(f.blobs[e.sha])
+			if e.mode == modeExecutable {
+				contents += " (executable)"
+			}
+			files[p] = contents
+		}
+		out[branch] = files
+	}
+	return out
+}
+
+// historyLen returns the number of commits reachable from the branch.
+func (f *fakeGitHub) historyLen(branch string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for sha := f.refs[branch]; sha != ""; sha = f.parents[sha] {
+		n++
+	}
+	return n
+}
+
+func (f *fakeGitHub) readJSON(r *http.Request, out any) {
+	if err := json.NewDecoder(r.Body).Decode(out); err != nil {
+		f.t.Errorf("failed decoding request to %s: %v", r.URL.Path, err)
+	}
+}
+
+func (f *fakeGitHub) writeJSON(w http.ResponseWriter, v any) {
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		f.t.Errorf("failed encoding response: %v", err)
+	}
+}
+
+func fakeSHA(s string) string {
+	sum := sha1.Sum([]byte(s)) //nolint:gosec // only used to make fake object IDs
+	return hex.EncodeToString(sum[:])
+}
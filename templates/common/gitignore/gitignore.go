@@ -0,0 +1,272 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gitignore matches paths against .gitignore-style patterns, following
+// the rules in https://git-scm.com/docs/gitignore.
+package gitignore
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// FileName is the name of the files that hold gitignore patterns.
+const FileName = ".gitignore"
+
+// Pattern is a single parsed line of a .gitignore file.
+type Pattern struct {
+	// base is the directory, relative to the root of the tree and using
+	// forward slashes, containing the .gitignore file that this pattern came
+	// from. The pattern only applies to paths under base. Empty for the root.
+	base string
+
+	// segments are the slash-separated parts of the pattern, after removing the
+	// "!" prefix and any leading or trailing slash.
+	segments []string
+
+	// negate is true for patterns beginning with "!", which re-include paths
+	// that an earlier pattern excluded.
+	negate bool
+
+	// dirOnly is true for patterns ending in "/", which only match
+	// directories.
+	dirOnly bool
+
+	// anchored is true for patterns with a slash at the beginning or middle,
+	// which are matched relative to base rather than against the last
+	// component of the path at any depth.
+	anchored bool
+}
+
+// ParsePattern parses a single line of a .gitignore file in the directory
+// base (relative to the root of the tree, using forward slashes). It returns
+// nil for blank lines and comments.
+func ParsePattern(line, base string) *Pattern {
+	line = strings.TrimSuffix(line, "\r")
+	line = trimTrailingSpaces(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	p := &Pattern{base: strings.Trim(base, "/")}
+	if p.base == "." {
+		p.base = ""
+	}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return nil
+	}
+	p.anchored = strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	for _, s := range strings.Split(line, "/") {
+		if s != "" {
+			p.segments = append(p.segments, gitToGoGlob(s))
+		}
+	}
+	return p
+}
+
+// trimTrailingSpaces removes trailing spaces unless they're escaped with a
+// backslash.
+func trimTrailingSpaces(s string) string {
+	for strings.HasSuffix(s, " ") && !strings.HasSuffix(s, `\ `) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// gitToGoGlob converts the "[!...]" negated character classes of gitignore to
+// the "[^...]" syntax understood by path.Match.
+func gitToGoGlob(s string) string {
+	return strings.ReplaceAll(s, "[!", "[^")
+}
+
+// Parse parses the contents of a .gitignore file in the directory base.
+func Parse(buf []byte, base string) []*Pattern {
+	var out []*Pattern
+	sc := bufio.NewScanner(bytes.NewReader(buf))
+	for sc.Scan() {
+		if p := ParsePattern(sc.Text(), base); p != nil {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// match reports whether relPath (relative to the root of the tree, using
+// forward slashes) matches this pattern, ignoring negation.
+func (p *Pattern) match(relPath string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.base != "" {
+		if !strings.HasPrefix(relPath, p.base+"/") {
+			return false
+		}
+		relPath = relPath[len(p.base)+1:]
+	}
+	parts := strings.Split(relPath, "/")
+	if !p.anchored {
+		ok, _ := path.Match(p.segments[0], parts[len(parts)-1])
+		return ok
+	}
+	return matchSegments(p.segments, parts)
+}
+
+// matchSegments matches the parts of a path against the parts of a pattern,
+// where a "**" part matches zero or more path parts.
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				// A trailing "/**" matches everything inside, but not the
+				// directory itself.
+				return len(parts) > 0
+			}
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// Matcher decides whether paths are ignored by a list of patterns.
+type Matcher struct {
+	patterns []*Pattern
+}
+
+// NewMatcher returns a Matcher for the given patterns. When more than one
+// pattern matches a path, the last one wins, so patterns from .gitignore files
+// in deeper directories must come after those from shallower ones.
+func NewMatcher(patterns []*Pattern) *Matcher {
+	return &Matcher{patterns: patterns}
+}
+
+// Match reports whether relPath, which is relative to the root of the tree
+// and uses forward slashes, is ignored. Like git, a path is ignored if any of
+// its parent directories is ignored, even if a negated pattern matches the
+// path itself.
+func (m *Matcher) Match(relPath string, isDir bool) bool {
+	relPath = strings.Trim(relPath, "/")
+	if relPath == "" || relPath == "." {
+		return false
+	}
+	for i, c := range relPath {
+		if c == '/' && m.matchOne(relPath[:i], true) {
+			return true
+		}
+	}
+	return m.matchOne(relPath, isDir)
+}
+
+func (m *Matcher) matchOne(relPath string, isDir bool) bool {
+	for i := len(m.patterns) - 1; i >= 0; i-- {
+		if p := m.patterns[i]; p.match(relPath, isDir) {
+			return !p.negate
+		}
+	}
+	return false
+}
+
+// Tree answers whether paths in a directory tree are ignored by the .gitignore
+// files in that tree. The .gitignore files are read lazily, and only once.
+// Like git, it always ignores .git directories.
+type Tree struct {
+	fsys fs.ReadFileFS
+	root string
+
+	// patterns caches the patterns of the .gitignore file in each directory,
+	// keyed by the directory's path relative to root with forward slashes.
+	patterns map[string][]*Pattern
+}
+
+// NewTree returns a Tree for the directory root. fsys is used to read the
+// .gitignore files, and should accept OS-native paths.
+func NewTree(fsys fs.ReadFileFS, root string) *Tree {
+	return &Tree{
+		fsys:     fsys,
+		root:     root,
+		patterns: make(map[string][]*Pattern),
+	}
+}
+
+// Ignored reports whether relPath, which is relative to the root of the tree,
+// is ignored.
+func (t *Tree) Ignored(relPath string, isDir bool) (bool, error) {
+	relPath = filepath.ToSlash(filepath.Clean(relPath))
+	if relPath == "." {
+		return false, nil
+	}
+	parts := strings.Split(relPath, "/")
+	for _, p := range parts {
+		if p == ".git" {
+			return true, nil
+		}
+	}
+
+	// Every .gitignore from the root down to the path's parent directory
+	// applies, with deeper ones taking precedence.
+	var patterns []*Pattern
+	dirs := append([]string{""}, parts[:len(parts)-1]...)
+	for i := range dirs {
+		dir := strings.Join(dirs[1:i+1], "/")
+		ps, err := t.load(dir)
+		if err != nil {
+			return false, err
+		}
+		patterns = append(patterns, ps...)
+	}
+	return NewMatcher(patterns).Match(relPath, isDir), nil
+}
+
+// load returns the patterns of the .gitignore file in dir, if there is one.
+func (t *Tree) load(dir string) ([]*Pattern, error) {
+	if ps, ok := t.patterns[dir]; ok {
+		return ps, nil
+	}
+	p := filepath.Join(t.root, filepath.FromSlash(dir), FileName)
+	buf, err := t.fsys.ReadFile(p)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed reading %s: %w", p, err)
+	}
+	ps := Parse(buf, dir)
+	t.patterns[dir] = ps
+	return ps, nil
+}
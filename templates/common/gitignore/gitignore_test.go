@@ -0,0 +1,235 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitignore
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/abcxyz/abc/templates/common"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+)
+
+func TestMatcher(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		patterns string
+		path     string
+		isDir    bool
+		want     bool
+	}{
+		{
+			name:     "basename_at_any_depth",
+			patterns: "*.log",
+			path:     "a/b/debug.log",
+			want:     true,
+		},
+		{
+			name:     "basename_no_match",
+			patterns: "*.log",
+			path:     "a/b/debug.txt",
+			want:     false,
+		},
+		{
+			name:     "comments_and_blank_lines",
+			patterns: "# *.txt\n\n",
+			path:     "a.txt",
+			want:     false,
+		},
+		{
+			name:     "escaped_hash",
+			patterns: `\#notes`,
+			path:     "#notes",
+			want:     true,
+		},
+		{
+			name:     "trailing_spaces_trimmed",
+			patterns: "a.txt   ",
+			path:     "a.txt",
+			want:     true,
+		},
+		{
+			name:     "dir_only_matches_dir",
+			patterns: "build/",
+			path:     "build",
+			isDir:    true,
+			want:     true,
+		},
+		{
+			name:     "dir_only_doesnt_match_file",
+			patterns: "build/",
+			path:     "build",
+			want:     false,
+		},
+		{
+			name:     "contents_of_ignored_dir",
+			patterns: "build/",
+			path:     "sub/build/out/a.o",
+			want:     true,
+		},
+		{
+			name:     "leading_slash_anchors",
+			patterns: "/vendor",
+			path:     "sub/vendor",
+			isDir:    true,
+			want:     false,
+		},
+		{
+			name:     "leading_slash_matches_root",
+			patterns: "/vendor",
+			path:     "vendor/x.go",
+			want:     true,
+		},
+		{
+			name:     "middle_slash_anchors",
+			patterns: "doc/frotz",
+			path:     "a/doc/frotz",
+			want:     false,
+		},
+		{
+			name:     "leading_double_star",
+			patterns: "**/foo/bar",
+			path:     "a/b/foo/bar",
+			want:     true,
+		},
+		{
+			name:     "trailing_double_star",
+			patterns: "abc/**",
+			path:     "abc/x/y",
+			want:     true,
+		},
+		{
+			name:     "trailing_double_star_not_dir_itself",
+			patterns: "abc/**",
+			path:     "abc",
+			isDir:    true,
+			want:     false,
+		},
+		{
+			name:     "middle_double_star_zero_dirs",
+			patterns: "a/**/b",
+			path:     "a/b",
+			want:     true,
+		},
+		{
+			name:     "middle_double_star_many_dirs",
+			patterns: "a/**/b",
+			path:     "a/x/y/b",
+			want:     true,
+		},
+		{
+			name:     "star_doesnt_cross_slash",
+			patterns: "a/*.txt",
+			path:     "a/b/c.txt",
+			want:     false,
+		},
+		{
+			name:     "negated_char_class",
+			patterns: "file[!0-9].txt",
+			path:     "filex.txt",
+			want:     true,
+		},
+		{
+			name:     "negation_reincludes",
+			patterns: "*.log\n!keep.log",
+			path:     "keep.log",
+			want:     false,
+		},
+		{
+			name:     "last_match_wins",
+			patterns: "!keep.log\n*.log",
+			path:     "keep.log",
+			want:     true,
+		},
+		{
+			name:     "negation_cant_reinclude_in_ignored_dir",
+			patterns: "build/\n!build/keep.txt",
+			path:     "build/keep.txt",
+			want:     true,
+		},
+		{
+			name:     "negation_of_dir_contents_pattern",
+			patterns: "/*\n!/src/",
+			path:     "src/main.go",
+			want:     false,
+		},
+		{
+			name:     "escaped_bang",
+			patterns: `\!important`,
+			path:     "!important",
+			want:     true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			m := NewMatcher(Parse([]byte(tc.patterns), ""))
+			if got := m.Match(tc.path, tc.isDir); got != tc.want {
+				t.Errorf("Match(%q, %t) with patterns %q = %t, want %t", tc.path, tc.isDir, tc.patterns, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTree(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	abctestutil.WriteAll(t, root, map[string]string{
+		".gitignore":          "*.log\nnode_modules/\n",
+		"a.log":               "",
+		"src/.gitignore":      "!keep.log\n/generated\n",
+		"src/keep.log":        "",
+		"src/other.log":       "",
+		"src/generated/x.go":  "",
+		"src/sub/generated":   "",
+		"node_modules/x/y.js": "",
+		"main.go":             "",
+	})
+
+	cases := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{path: "a.log", want: true},
+		{path: "main.go", want: false},
+		{path: "src/keep.log", want: false},
+		{path: "src/other.log", want: true},
+		{path: "src/generated", isDir: true, want: true},
+		{path: "src/sub/generated", want: false},
+		{path: "node_modules", isDir: true, want: true},
+		{path: "node_modules/x/y.js", want: true},
+		{path: ".git", isDir: true, want: true},
+		{path: ".git/config", want: true},
+		{path: "nonexistent/dir/file.txt", want: false},
+	}
+
+	tree := NewTree(&common.RealFS{}, root)
+	for _, tc := range cases {
+		got, err := tree.Ignored(filepath.FromSlash(tc.path), tc.isDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("Ignored(%q) = %t, want %t", tc.path, got, tc.want)
+		}
+	}
+}
@@ -18,17 +18,29 @@ import (
 	"cmp"
 	"fmt"
 	"slices"
+	"strings"
 
 	"golang.org/x/exp/maps"
 )
 
 // CyclicError is returned when the input graph has a cycle.
 type CyclicError[T comparable] struct {
+	// Cycle is the nodes in the cycle in edge order, starting and ending with
+	// the same node, like [a b c a] for the edges a->b, b->c, and c->a.
 	Cycle []T
 }
 
 func (e *CyclicError[T]) Error() string {
-	return fmt.Sprintf("cycle detected: %v", e.Cycle)
+	return "cycle detected: " + Chain(e.Cycle)
+}
+
+// Chain formats a path through a graph as "a -> b -> c".
+func Chain[T any](path []T) string {
+	parts := make([]string, 0, len(path))
+	for _, n := range path {
+		parts = append(parts, fmt.Sprint(n))
+	}
+	return strings.Join(parts, " -> ")
 }
 
 // Graph represents a directed graph.
@@ -79,7 +91,7 @@ func (g *Graph[T]) EdgesFrom(n T) []T {
 func (g *Graph[T]) TopologicalSort() ([]T, error) {
 	visited := make(map[T]struct{})
 	out := make([]T, 0, len(g.edges))
-	cycleDetect := make(map[T]struct{})
+	var path []T
 
 	// Output order must be the same across multiple CLI invocations. If we
 	// care about the inefficient asymptotic runtime of this approach, we could
@@ -89,7 +101,7 @@ func (g *Graph[T]) TopologicalSort() ([]T, error) {
 
 	for _, node := range nodes {
 		if _, ok := visited[node]; !ok {
-			if err := g.dfs(node, visited, &out, cycleDetect); err != nil {
+			if err := g.dfs(node, visited, &out, &path); err != nil {
 				return nil, err
 			}
 		}
@@ -100,29 +112,58 @@ func (g *Graph[T]) TopologicalSort() ([]T, error) {
 
 // dfs is the heart of the topological sort. See
 // https://en.wikipedia.org/wiki/Topological_sorting#Depth-first_search.
-func (g *Graph[T]) dfs(node T, visited map[T]struct{}, stack *[]T, cycleDetect map[T]struct{}) error {
+//
+// path is the recursion stack, the nodes from the root of this DFS to node.
+func (g *Graph[T]) dfs(node T, visited map[T]struct{}, stack, path *[]T) error {
 	visited[node] = struct{}{}
-	cycleDetect[node] = struct{}{}
+	*path = append(*path, node)
 
 	neighbors := g.edges[node]
 	slices.Sort(neighbors) // output order must be the same across multiple CLI invocations
 	for _, neighbor := range neighbors {
 		if _, ok := visited[neighbor]; !ok {
-			if err := g.dfs(neighbor, visited, stack, cycleDetect); err != nil {
+			if err := g.dfs(neighbor, visited, stack, path); err != nil {
 				return err
 			}
-		} else if _, ok := cycleDetect[neighbor]; ok {
-			// Cycle detected!
-			cycle := []T{node, neighbor}
-			for current := neighbor; current != node; current = g.edges[current][0] {
-				cycle = append(cycle, g.edges[current][0])
-			}
-			return &CyclicError[T]{cycle}
+		} else if i := slices.Index(*path, neighbor); i >= 0 {
+			// Cycle detected! It's the part of the path from neighbor to here,
+			// plus the edge back to neighbor.
+			cycle := slices.Clone((*path)[i:])
+			return &CyclicError[T]{append(cycle, neighbor)}
 		}
 	}
 
-	delete(cycleDetect, node)     // Remove node from recursion stack
-	*stack = append(*stack, node) // Add node to the output list
+	*path = (*path)[:len(*path)-1] // Remove node from recursion stack
+	*stack = append(*stack, node)  // Add node to the output list
 
 	return nil
 }
+
+// LongestPath returns the longest path following edges through the graph, like
+// [a b c] for the edges a->b and b->c. The graph must not have cycles; see
+// [TopologicalSort]. Among paths of the same length, the result is the same
+// across calls.
+func (g *Graph[T]) LongestPath() []T {
+	sorted, err := g.TopologicalSort()
+	if err != nil {
+		return nil
+	}
+
+	// Since sorted has each node after the nodes it has edges to, the longest
+	// path starting at each neighbor is known when a node is reached.
+	longest := make(map[T][]T, len(sorted))
+	var out []T
+	for _, node := range sorted {
+		var next []T
+		for _, neighbor := range g.edges[node] {
+			if len(longest[neighbor]) > len(next) {
+				next = longest[neighbor]
+			}
+		}
+		longest[node] = append([]T{node}, next...)
+		if len(longest[node]) > len(out) {
+			out = longest[node]
+		}
+	}
+	return out
+}
@@ -16,9 +16,11 @@ package graph
 
 import (
 	"cmp"
+	"errors"
 	"fmt"
 	"math"
 	"math/rand"
+	"slices"
 	"testing"
 
 	gocmp "github.com/google/go-cmp/cmp"
@@ -126,7 +128,7 @@ func TestTopoSort(t *testing.T) {
 				g.AddEdge("c", "a")
 				return g
 			}(),
-			wantErr: &CyclicError[string]{Cycle: []string{"a", "b", "c"}},
+			wantErr: &CyclicError[string]{Cycle: []string{"a", "b", "c", "a"}},
 		},
 		{
 			name: "3_cycle_with_unconnected_node",
@@ -138,7 +140,7 @@ func TestTopoSort(t *testing.T) {
 				g.AddNode("d")
 				return g
 			}(),
-			wantErr: &CyclicError[string]{Cycle: []string{"a", "b", "c"}},
+			wantErr: &CyclicError[string]{Cycle: []string{"a", "b", "c", "a"}},
 		},
 		{
 			name: "self_edge",
@@ -159,7 +161,19 @@ func TestTopoSort(t *testing.T) {
 				g.AddEdge("d", "e")
 				return g
 			}(),
-			wantErr: &CyclicError[string]{Cycle: []string{"a", "b", "c"}},
+			wantErr: &CyclicError[string]{Cycle: []string{"a", "b", "c", "a"}},
+		},
+		{
+			name: "cycle_not_through_first_edges",
+			g: func() *Graph[string] {
+				g := NewGraph[string]()
+				g.AddEdge("a", "b")
+				g.AddEdge("b", "c")
+				g.AddEdge("b", "d")
+				g.AddEdge("d", "b")
+				return g
+			}(),
+			wantErr: &CyclicError[string]{Cycle: []string{"b", "d", "b"}},
 		},
 		{
 			name: "many_edges_in_linear_order",
@@ -193,7 +207,7 @@ func TestTopoSort(t *testing.T) {
 
 			got, err := tc.g.TopologicalSort()
 
-			gocmp.Equal(err, tc.wantErr,
+			if diff := gocmp.Diff(err, tc.wantErr,
 				// Cycles can appear in a variety of forms ({a b c a} or
 				// {c a b c}), so we canonicalize by just checking the *set* of
 				// nodes involved in the cycle.
@@ -204,7 +218,19 @@ func TestTopoSort(t *testing.T) {
 					}
 					return out
 				}),
-			)
+			); diff != "" {
+				t.Errorf("error was not as expected (-got,+want): %s", diff)
+			}
+			if cycleErr := (*CyclicError[string])(nil); errors.As(err, &cycleErr) {
+				if c := cycleErr.Cycle; c[0] != c[len(c)-1] {
+					t.Errorf("cycle %v doesn't end where it starts", c)
+				}
+				for i := 0; i+1 < len(cycleErr.Cycle); i++ {
+					if !slices.Contains(tc.g.edges[cycleErr.Cycle[i]], cycleErr.Cycle[i+1]) {
+						t.Errorf("cycle %v has a nonexistent edge %s->%s", cycleErr.Cycle, cycleErr.Cycle[i], cycleErr.Cycle[i+1])
+					}
+				}
+			}
 
 			anyMatched := false
 			if len(tc.want) == 0 && len(got) == 0 {
@@ -223,6 +249,66 @@ func TestTopoSort(t *testing.T) {
 	}
 }
 
+func TestLongestPath(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name  string
+		edges [][2]string
+		nodes []string
+		want  []string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:  "no_edges",
+			nodes: []string{"a", "b"},
+			want:  []string{"a"},
+		},
+		{
+			name:  "chain",
+			edges: [][2]string{{"a", "b"}, {"b", "c"}, {"c", "d"}},
+			want:  []string{"a", "b", "c", "d"},
+		},
+		{
+			name:  "diamond_with_tail",
+			edges: [][2]string{{"a", "b"}, {"a", "c"}, {"b", "d"}, {"c", "d"}, {"c", "e"}, {"e", "f"}},
+			want:  []string{"a", "c", "e", "f"},
+		},
+		{
+			name:  "cycle",
+			edges: [][2]string{{"a", "b"}, {"b", "a"}},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewGraph[string]()
+			for _, n := range tc.nodes {
+				g.AddNode(n)
+			}
+			for _, e := range tc.edges {
+				g.AddEdge(e[0], e[1])
+			}
+			if diff := gocmp.Diff(g.LongestPath(), tc.want, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("LongestPath() was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	t.Parallel()
+
+	if got, want := Chain([]string{"a", "b", "a"}), "a -> b -> a"; got != want {
+		t.Errorf("Chain() = %q, want %q", got, want)
+	}
+}
+
 func TestTopoSortRandomGraph(t *testing.T) {
 	t.Parallel()
 	const numTests = 1000
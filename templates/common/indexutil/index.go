@@ -0,0 +1,334 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package indexutil maintains the installation index, .abc/index.yaml, which
+// lists every template installation in a git repo so they can be found
+// without walking the whole directory tree.
+package indexutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/internal/version"
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/git"
+	"github.com/abcxyz/abc/templates/model"
+	"github.com/abcxyz/abc/templates/model/decode"
+	"github.com/abcxyz/abc/templates/model/header"
+	index "github.com/abcxyz/abc/templates/model/index/v1beta7"
+	manifestutil "github.com/abcxyz/abc/templates/model/manifest"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// FileName is the name of the index file, which lives in the .abc directory
+// at the root of the git repo.
+const FileName = "index.yaml"
+
+// Entry is a template installation to add to the index or update.
+type Entry struct {
+	// The absolute path to the installation's manifest file.
+	ManifestPath string
+
+	// These are copied from the manifest.
+	TemplateLocation string
+	TemplateVersion  string
+	ModificationTime time.Time
+}
+
+// Record adds the given installation to the index of the git repo that
+// contains its manifest, or updates it if it's already there. Installations
+// whose manifests no longer exist are dropped.
+//
+// If the index doesn't exist yet, it's created, and any manifests that were
+// already in the repo are added to it, so the index is complete from the
+// start.
+//
+// Record does nothing if the manifest isn't inside a git repo, or if this
+// build of the CLI writes an api_version that doesn't support the index.
+//
+// The index file is replaced atomically, so readers never see a partially
+// written index.
+func Record(ctx context.Context, rfs common.FS, e *Entry) error {
+	apiVersion := decode.LatestSupportedAPIVersion(version.IsReleaseBuild())
+	if !decode.ModelIs(apiVersion, decode.KindIndex, &index.Index{}) {
+		return nil
+	}
+
+	root, ok, err := git.Workspace(ctx, filepath.Dir(e.ManifestPath))
+	if err != nil {
+		return fmt.Errorf("failed finding the git repo containing %q: %w", e.ManifestPath, err)
+	}
+	if !ok {
+		return nil
+	}
+
+	idx, ok, err := load(ctx, rfs, root)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if idx, err = seed(ctx, rfs, root); err != nil {
+			return err
+		}
+	}
+
+	relPath, err := filepath.Rel(root, e.ManifestPath)
+	if err != nil {
+		return fmt.Errorf("failed determining relative path for manifest: %w", err)
+	}
+	relPath = filepath.ToSlash(relPath)
+
+	installations := make([]*index.Installation, 0, len(idx.Installations)+1)
+	for _, inst := range idx.Installations {
+		if inst.ManifestPath.Val == relPath {
+			continue
+		}
+		exists, err := common.ExistsFS(rfs, filepath.Join(root, filepath.FromSlash(inst.ManifestPath.Val)))
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		if exists {
+			installations = append(installations, inst)
+		}
+	}
+	installations = append(installations, &index.Installation{
+		ManifestPath:     model.String{Val: relPath},
+		TemplateLocation: model.String{Val: e.TemplateLocation},
+		TemplateVersion:  model.String{Val: e.TemplateVersion},
+		ModificationTime: e.ModificationTime.UTC(),
+	})
+	idx.Installations = installations
+
+	return write(rfs, root, apiVersion, idx)
+}
+
+// ManifestPaths returns the manifest files underneath dir according to the
+// index of the git repo containing dir. The returned paths are relative to
+// dir and sorted, like those from CrawlManifests. Manifests that are in the
+// index but no longer exist are skipped.
+//
+// The returned bool is false if there's no index, in which case the caller
+// should fall back to CrawlManifests.
+func ManifestPaths(ctx context.Context, rfs common.FS, dir string) ([]string, bool, error) {
+	root, ok, err := git.Workspace(ctx, dir)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed finding the git repo containing %q: %w", dir, err)
+	}
+	if !ok {
+		return nil, false, nil
+	}
+	idx, ok, err := load(ctx, rfs, root)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	out := make([]string, 0, len(idx.Installations))
+	for _, inst := range idx.Installations {
+		absPath := filepath.Join(root, filepath.FromSlash(inst.ManifestPath.Val))
+		relToDir, err := filepath.Rel(dir, absPath)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed determining relative path for manifest: %w", err)
+		}
+		if relToDir == ".." || strings.HasPrefix(relToDir, ".."+string(filepath.Separator)) {
+			continue // not underneath dir
+		}
+		exists, err := common.ExistsFS(rfs, absPath)
+		if err != nil {
+			return nil, false, err //nolint:wrapcheck
+		}
+		if exists {
+			out = append(out, relToDir)
+		}
+	}
+	sort.Strings(out)
+	return out, true, nil
+}
+
+// FindManifests returns the manifests underneath location, as paths relative
+// to location. If location is a directory in a git repo that has an
+// installation index, the index is used instead of walking the directory tree,
+// unless ignoreIndex is true.
+func FindManifests(ctx context.Context, rfs common.FS, location string, ignoreIndex bool) ([]string, error) {
+	logger := logging.FromContext(ctx).With("logger", "FindManifests")
+
+	if !ignoreIndex {
+		fi, err := rfs.Stat(location)
+		if err != nil && !common.IsNotExistErr(err) {
+			return nil, err //nolint:wrapcheck
+		}
+		if fi != nil && fi.IsDir() {
+			paths, ok, err := ManifestPaths(ctx, rfs, location)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				logger.DebugContext(ctx, "found manifests using the installation index",
+					"count", len(paths))
+				return paths, nil
+			}
+		}
+	}
+
+	paths, err := CrawlManifests(location)
+	if err != nil {
+		return nil, fmt.Errorf("while crawling manifests: %w", err)
+	}
+	return paths, nil
+}
+
+// CrawlManifests finds all the template manifest files underneath the given
+// file or directory. startFrom can be either a single manifest file or a
+// directory to search recursively. Returned paths are relative to startFrom.
+// The returned slice is sorted lexicographically.
+func CrawlManifests(startFrom string) ([]string, error) {
+	var manifests []string
+	err := filepath.WalkDir(startFrom, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if common.IsNotExistErr(err) {
+				// If the user provides a nonexistent path to upgrade, then
+				// we'll just return an empty list of manifests from this
+				// function and let a higher level function say "no manifests
+				// were found."
+				return nil
+			}
+			return err
+		}
+
+		if d.IsDir() && strings.HasPrefix(d.Name(), common.ABCStagingDirPrefix) &&
+			filepath.Base(filepath.Dir(path)) == common.ABCInternalDir {
+			return fs.SkipDir // an unfinished render's staged files
+		}
+
+		baseName := filepath.Base(path)
+		ext := filepath.Ext(path)
+		parentDir := filepath.Base(filepath.Dir(path))
+		isManifest := strings.HasPrefix(baseName, "manifest") && ext == ".yaml" && parentDir == common.ABCInternalDir
+		if !isManifest {
+			return nil
+		}
+
+		relToStart, err := filepath.Rel(startFrom, path)
+		if err != nil {
+			return fmt.Errorf("failed determining relative path for manifest: %w", err)
+		}
+		manifests = append(manifests, relToStart)
+		return nil
+	})
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	sort.Strings(manifests)
+
+	return manifests, nil
+}
+
+// load reads the index at the root of the given git repo. The returned bool is
+// false if there's no index.
+func load(ctx context.Context, rfs common.FS, root string) (*index.Index, bool, error) {
+	path := filepath.Join(root, common.ABCInternalDir, FileName)
+	f, err := rfs.Open(path)
+	if err != nil {
+		if common.IsNotExistErr(err) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("failed to open index file at %q: %w", path, err)
+	}
+	defer f.Close()
+
+	idxI, _, err := decode.DecodeValidateUpgrade(ctx, f, path, decode.KindIndex)
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading index file: %w", err)
+	}
+	idx, ok := idxI.(*index.Index)
+	if !ok {
+		return nil, false, common.InternalErrorf("index file did not decode to *index.Index")
+	}
+	return idx, true, nil
+}
+
+// seed creates an index of the manifests that already exist in the given git
+// repo. Manifests that can't be read are left out, with a warning.
+func seed(ctx context.Context, rfs common.FS, root string) (*index.Index, error) {
+	logger := logging.FromContext(ctx).With("logger", "seed")
+
+	relPaths, err := CrawlManifests(root)
+	if err != nil {
+		return nil, fmt.Errorf("while crawling manifests: %w", err)
+	}
+
+	idx := &index.Index{Installations: make([]*index.Installation, 0, len(relPaths))}
+	for _, relPath := range relPaths {
+		m, _, err := manifestutil.Load(ctx, rfs, filepath.Join(root, relPath))
+		if err != nil {
+			logger.WarnContext(ctx, "leaving an unreadable manifest out of the installation index",
+				"manifest", relPath, "error", err)
+			continue
+		}
+		idx.Installations = append(idx.Installations, &index.Installation{
+			ManifestPath:     model.String{Val: filepath.ToSlash(relPath)},
+			TemplateLocation: m.TemplateLocation,
+			TemplateVersion:  m.TemplateVersion,
+			ModificationTime: m.ModificationTime,
+		})
+	}
+	return idx, nil
+}
+
+// write replaces the index at the root of the given git repo. It writes to a
+// temp file and renames it into place, so the index is never half-written.
+func write(rfs common.FS, root, apiVersion string, idx *index.Index) error {
+	sort.Slice(idx.Installations, func(l, r int) bool {
+		return idx.Installations[l].ManifestPath.Val < idx.Installations[r].ManifestPath.Val
+	})
+
+	forMarshaling := index.ForMarshaling(*idx)
+	buf, err := yaml.Marshal(&index.WithHeader{
+		Header: &header.Fields{
+			NewStyleAPIVersion: model.String{Val: apiVersion},
+			Kind:               model.String{Val: decode.KindIndex},
+		},
+		Wrapped: &forMarshaling,
+	})
+	if err != nil {
+		return fmt.Errorf("failed marshaling Index when writing: %w", err)
+	}
+	buf = append(common.DoNotModifyHeader, buf...)
+
+	dir := filepath.Join(root, common.ABCInternalDir)
+	if err := rfs.MkdirAll(dir, common.OwnerRWXPerms); err != nil {
+		return fmt.Errorf("failed creating %s directory to contain index: %w", dir, err)
+	}
+
+	path := filepath.Join(dir, FileName)
+	tempPath := path + ".tmp"
+	if err := rfs.WriteFile(tempPath, buf, common.OwnerRWPerms); err != nil {
+		return fmt.Errorf("WriteFile(%q): %w", tempPath, err)
+	}
+	if err := rfs.Rename(tempPath, path); err != nil {
+		return errors.Join(
+			fmt.Errorf("Rename(%q, %q): %w", tempPath, path, err),
+			rfs.Remove(tempPath))
+	}
+	return nil
+}
@@ -0,0 +1,354 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package indexutil
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+)
+
+const manifestContents = `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Manifest'
+creation_time: '2024-06-25T11:00:00Z'
+modification_time: '2024-06-25T12:00:00Z'
+template_location: 'github.com/foo/bar'
+location_type: 'remote_git'
+template_version: 'v1.0.0'
+upgrade_channel: 'latest'
+template_dirhash: 'h1:abc'
+inputs: []
+output_files: []
+`
+
+func TestRecord(t *testing.T) {
+	t.Parallel()
+
+	ts := time.Date(2024, time.July, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name     string
+		files    map[string]string
+		noGit    bool
+		manifest string
+		want     map[string]string
+	}{
+		{
+			name: "new_index_is_seeded_with_existing_manifests",
+			files: map[string]string{
+				"old/.abc/manifest_old.lock.yaml": manifestContents,
+				"new/.abc/manifest_new.lock.yaml": manifestContents,
+			},
+			manifest: "new/.abc/manifest_new.lock.yaml",
+			want: map[string]string{
+				"old/.abc/manifest_old.lock.yaml": manifestContents,
+				"new/.abc/manifest_new.lock.yaml": manifestContents,
+				".abc/index.yaml": `# Generated by the "abc" command. Do not modify.
+api_version: cli.abcxyz.dev/v1beta7
+kind: Index
+installations:
+    - manifest_path: new/.abc/manifest_new.lock.yaml
+      template_location: github.com/foo/baz
+      template_version: v2.0.0
+      modification_time: 2024-07-01T00:00:00Z
+    - manifest_path: old/.abc/manifest_old.lock.yaml
+      template_location: github.com/foo/bar
+      template_version: v1.0.0
+      modification_time: 2024-06-25T12:00:00Z
+`,
+			},
+		},
+		{
+			name: "existing_entry_is_updated_and_missing_manifests_dropped",
+			files: map[string]string{
+				"new/.abc/manifest_new.lock.yaml": manifestContents,
+				".abc/index.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Index'
+installations:
+  - manifest_path: 'deleted/.abc/manifest.lock.yaml'
+    template_location: 'github.com/foo/deleted'
+    template_version: 'v1.0.0'
+    modification_time: '2024-06-25T12:00:00Z'
+  - manifest_path: 'new/.abc/manifest_new.lock.yaml'
+    template_location: 'github.com/foo/baz'
+    template_version: 'v1.0.0'
+    modification_time: '2024-06-25T12:00:00Z'
+`,
+			},
+			manifest: "new/.abc/manifest_new.lock.yaml",
+			want: map[string]string{
+				"new/.abc/manifest_new.lock.yaml": manifestContents,
+				".abc/index.yaml": `# Generated by the "abc" command. Do not modify.
+api_version: cli.abcxyz.dev/v1beta7
+kind: Index
+installations:
+    - manifest_path: new/.abc/manifest_new.lock.yaml
+      template_location: github.com/foo/baz
+      template_version: v2.0.0
+      modification_time: 2024-07-01T00:00:00Z
+`,
+			},
+		},
+		{
+			name:  "not_in_git_repo",
+			noGit: true,
+			files: map[string]string{
+				"new/.abc/manifest_new.lock.yaml": manifestContents,
+			},
+			manifest: "new/.abc/manifest_new.lock.yaml",
+			want: map[string]string{
+				"new/.abc/manifest_new.lock.yaml": manifestContents,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			root := t.TempDir()
+			files := tc.files
+			if !tc.noGit {
+				files = abctestutil.WithGitRepoAt("", files)
+			}
+			abctestutil.WriteAll(t, root, files)
+
+			err := Record(context.Background(), &common.RealFS{}, &Entry{
+				ManifestPath:     filepath.Join(root, tc.manifest),
+				TemplateLocation: "github.com/foo/baz",
+				TemplateVersion:  "v2.0.0",
+				ModificationTime: ts,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := abctestutil.LoadDir(t, root, abctestutil.SkipGlob(".git/*"))
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("directory contents were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestManifestPaths(t *testing.T) {
+	t.Parallel()
+
+	index := `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Index'
+installations:
+  - manifest_path: '.abc/manifest_root.lock.yaml'
+  - manifest_path: 'a/.abc/manifest_a.lock.yaml'
+  - manifest_path: 'a/b/.abc/manifest_b.lock.yaml'
+  - manifest_path: 'a/deleted/.abc/manifest.lock.yaml'
+  - manifest_path: 'c/.abc/manifest_c.lock.yaml'
+`
+
+	cases := []struct {
+		name   string
+		files  map[string]string
+		dir    string
+		want   []string
+		wantOK bool
+	}{
+		{
+			name: "whole_repo",
+			files: map[string]string{
+				".abc/index.yaml":                index,
+				".abc/manifest_root.lock.yaml":   manifestContents,
+				"a/.abc/manifest_a.lock.yaml":    manifestContents,
+				"a/b/.abc/manifest_b.lock.yaml":  manifestContents,
+				"c/.abc/manifest_c.lock.yaml":    manifestContents,
+				"d/.abc/manifest_unindexed.yaml": manifestContents,
+			},
+			want: []string{
+				".abc/manifest_root.lock.yaml",
+				"a/.abc/manifest_a.lock.yaml",
+				"a/b/.abc/manifest_b.lock.yaml",
+				"c/.abc/manifest_c.lock.yaml",
+			},
+			wantOK: true,
+		},
+		{
+			name: "subdirectory",
+			files: map[string]string{
+				".abc/index.yaml":               index,
+				".abc/manifest_root.lock.yaml":  manifestContents,
+				"a/.abc/manifest_a.lock.yaml":   manifestContents,
+				"a/b/.abc/manifest_b.lock.yaml": manifestContents,
+				"c/.abc/manifest_c.lock.yaml":   manifestContents,
+			},
+			dir: "a",
+			want: []string{
+				".abc/manifest_a.lock.yaml",
+				"b/.abc/manifest_b.lock.yaml",
+			},
+			wantOK: true,
+		},
+		{
+			name: "no_index",
+			files: map[string]string{
+				"a/.abc/manifest_a.lock.yaml": manifestContents,
+			},
+			wantOK: false,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			root := t.TempDir()
+			abctestutil.WriteAll(t, root, abctestutil.WithGitRepoAt("", tc.files))
+
+			got, gotOK, err := ManifestPaths(context.Background(), &common.RealFS{}, filepath.Join(root, tc.dir))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotOK != tc.wantOK {
+				t.Errorf("got ok=%t, want %t", gotOK, tc.wantOK)
+			}
+			for i := range got {
+				got[i] = filepath.ToSlash(got[i])
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("manifest paths were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestFindManifests(t *testing.T) {
+	t.Parallel()
+
+	files := abctestutil.WithGitRepoAt("", map[string]string{
+		".abc/index.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Index'
+installations:
+  - manifest_path: 'indexed/.abc/manifest_indexed.lock.yaml'
+`,
+		"indexed/.abc/manifest_indexed.lock.yaml":       "unused",
+		"not_indexed/.abc/manifest_unindexed.lock.yaml": "unused",
+	})
+
+	cases := []struct {
+		name        string
+		ignoreIndex bool
+		want        []string
+	}{
+		{
+			name: "uses_index",
+			want: []string{"indexed/.abc/manifest_indexed.lock.yaml"},
+		},
+		{
+			name:        "ignore_index_crawls",
+			ignoreIndex: true,
+			want: []string{
+				"indexed/.abc/manifest_indexed.lock.yaml",
+				"not_indexed/.abc/manifest_unindexed.lock.yaml",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			root := t.TempDir()
+			abctestutil.WriteAll(t, root, files)
+
+			got, err := FindManifests(context.Background(), &common.RealFS{}, root, tc.ignoreIndex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("manifests were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestCrawlManifests(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name: "nested",
+			files: map[string]string{
+				".abc/manifest_root.lock.yaml":  manifestContents,
+				"a/.abc/manifest_a.lock.yaml":   manifestContents,
+				"a/b/.abc/manifest_b.lock.yaml": manifestContents,
+				"a/not_a_manifest.yaml":         manifestContents,
+			},
+			want: []string{
+				".abc/manifest_root.lock.yaml",
+				"a/.abc/manifest_a.lock.yaml",
+				"a/b/.abc/manifest_b.lock.yaml",
+			},
+		},
+		{
+			name: "leftover_staging_dir_is_skipped",
+			files: map[string]string{
+				"a/.abc/manifest_a.lock.yaml":                                  manifestContents,
+				"a/.abc/staging-123/journal.yaml":                              "files: []",
+				"a/.abc/staging-123/files/.abc/manifest_a.lock.yaml":           manifestContents,
+				"a/.abc/staging-123/files/sub/.abc/manifest_sub.lock.yaml":     manifestContents,
+				"b/staging-not-internal/.abc/manifest_staging_named.lock.yaml": manifestContents,
+			},
+			want: []string{
+				"a/.abc/manifest_a.lock.yaml",
+				"b/staging-not-internal/.abc/manifest_staging_named.lock.yaml",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			root := t.TempDir()
+			abctestutil.WriteAll(t, root, tc.files)
+
+			got, err := CrawlManifests(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range got {
+				got[i] = filepath.ToSlash(got[i])
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("manifest paths were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
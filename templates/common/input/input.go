@@ -28,8 +28,11 @@ import (
 	"gopkg.in/yaml.v3"
 
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/messages"
 	"github.com/abcxyz/abc/templates/common/rules"
-	spec "github.com/abcxyz/abc/templates/model/spec/v1beta6"
+	"github.com/abcxyz/abc/templates/common/secrets"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1beta7"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
 	"github.com/abcxyz/pkg/sets"
 )
 
@@ -66,6 +69,11 @@ type ResolveParams struct {
 	Prompter            Prompter
 	SkipInputValidation bool
 
+	// SecretResolvers are used to look up input values that are secret
+	// references like "secret://gcp-sm/projects/p/secrets/api-key", by
+	// provider name. If nil, secret references are used as literal values.
+	SecretResolvers map[string]secrets.SecretResolver
+
 	// Normally, we'll only prompt if the input is a TTY. For testing, this
 	// can be set to true to bypass the check and allow stdin to be something
 	// other than a TTY, like an os.Pipe.
@@ -82,23 +90,45 @@ type Prompter interface {
 	Stdin() io.Reader
 }
 
+// Source describes where a resolved input value came from.
+type Source struct {
+	// Kind is one of the manifest.InputSource* constants, e.g. "flag".
+	Kind string
+
+	// File is the --input-file that the value came from, if Kind is
+	// manifest.InputSourceInputFile.
+	File string
+
+	// SecretRef is the secret reference that the value was resolved from, if
+	// any. Such values are sensitive; the reference should be shown or saved
+	// in place of the value.
+	SecretRef string
+}
+
 // Resolve combines flags, user prompts, and defaults to get the full set
 // of template inputs.
 func Resolve(ctx context.Context, rp *ResolveParams) (map[string]string, error) {
+	inputs, _, err := ResolveWithSources(ctx, rp)
+	return inputs, err
+}
+
+// ResolveWithSources is like Resolve, but also returns, for each input, where
+// its value came from. The two returned maps have the same keys.
+func ResolveWithSources(ctx context.Context, rp *ResolveParams) (map[string]string, map[string]*Source, error) {
 	if badInputs := checkReservedInputs(rp.Inputs); len(badInputs) > 0 {
-		return nil, fmt.Errorf(`input names beginning with underscore cannot be overridden by a normal user input; the bad input names were: %v`, badInputs)
+		return nil, nil, fmt.Errorf(`input names beginning with underscore cannot be overridden by a normal user input; the bad input names were: %v`, badInputs)
 	}
 
 	if !rp.IgnoreUnknownInputs {
 		if unknownInputs := checkUnknownInputs(rp.Spec, rp.Inputs); len(unknownInputs) > 0 {
-			return nil, fmt.Errorf("unknown input(s): %s", strings.Join(unknownInputs, ", "))
+			return nil, nil, fmt.Errorf("unknown input(s): %s", strings.Join(unknownInputs, ", "))
 		}
 	}
 	cliInputs := filterUnknownInputs(rp.Spec, rp.Inputs)
 
-	fileInputs, err := loadInputFiles(rp.FS, rp.InputFiles)
+	fileInputs, fileForInput, err := loadInputFiles(rp.FS, rp.InputFiles)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// Unknown inputs from --input-file files are always ignored regardless of
@@ -115,6 +145,18 @@ func Resolve(ctx context.Context, rp *ResolveParams) (map[string]string, error)
 	// which in turn take precedence over manifest inputs.
 	inputs := sets.UnionMapKeys(cliInputs, knownFileInputs, knownInputsFromManifest)
 
+	sources := make(map[string]*Source, len(inputs))
+	for name := range inputs {
+		switch {
+		case hasKey(cliInputs, name):
+			sources[name] = &Source{Kind: manifest.InputSourceFlag}
+		case hasKey(knownFileInputs, name):
+			sources[name] = &Source{Kind: manifest.InputSourceInputFile, File: fileForInput[name]}
+		default:
+			sources[name] = &Source{Kind: manifest.InputSourceManifest}
+		}
+	}
+
 	if rp.Prompt {
 		_, ok := rp.Prompter.(fakePrompter)
 		runningUnderTest := ok || rp.SkipPromptTTYCheck
@@ -125,17 +167,25 @@ func Resolve(ctx context.Context, rp *ResolveParams) (map[string]string, error)
 		if !runningUnderTest {
 			isATTY := (rp.Prompter.Stdin() == os.Stdin && isatty.IsTerminal(os.Stdin.Fd()))
 			if !isATTY {
-				return nil, fmt.Errorf("the flag --prompt was provided, but standard input is not a terminal")
+				return nil, nil, fmt.Errorf("the flag --prompt was provided, but standard input is not a terminal")
 			}
 		}
 
 		if err := promptForInputs(ctx, rp.Prompter, rp.Spec, inputs); err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+		for name := range inputs {
+			if _, ok := sources[name]; !ok {
+				sources[name] = &Source{Kind: manifest.InputSourcePrompt}
+			}
 		}
 	} else {
 		defaulted := insertDefaultInputs(rp.Spec, inputs)
+		for _, name := range defaulted {
+			sources[name] = &Source{Kind: manifest.InputSourceDefault}
+		}
 		if missing := checkInputsMissing(rp.Spec, inputs); len(missing) > 0 {
-			return nil, fmt.Errorf("missing input(s): %s, you may want to use one of the flags --prompt, --input, or --input-file", strings.Join(missing, ", "))
+			return nil, nil, fmt.Errorf("missing input(s): %s, you may want to use one of the flags --prompt, --input, or --input-file", strings.Join(missing, ", "))
 		}
 		if len(defaulted) > 0 && !rp.AcceptDefaults {
 			// This avoids a specific poor user experience. Suppose the user
@@ -149,19 +199,32 @@ func Resolve(ctx context.Context, rp *ResolveParams) (map[string]string, error)
 			// be that diligent. So we'll reject the current operation and ask
 			// the user to clarify their intent with either --prompt or
 			// --accept-defaults.
-			return nil, fmt.Errorf("there are some inputs for which a value was not provided but a default is available; please use either --prompt or --accept-defaults: %v", defaulted)
+			return nil, nil, fmt.Errorf("there are some inputs for which a value was not provided but a default is available; please use either --prompt or --accept-defaults: %v", defaulted)
 		}
 	}
 
+	inputs, refs, err := secrets.ResolveRefs(ctx, rp.SecretResolvers, inputs)
+	if err != nil {
+		return nil, nil, err //nolint:wrapcheck
+	}
+	for name, ref := range refs {
+		sources[name].SecretRef = ref
+	}
+
 	if rp.SkipInputValidation {
-		return inputs, nil
+		return inputs, sources, nil
 	}
 
-	if err := validateInputs(ctx, rp.Spec.Inputs, inputs); err != nil {
-		return nil, err
+	if err := validateInputs(ctx, rp.Spec.Inputs, inputs, refs); err != nil {
+		return nil, nil, err
 	}
 
-	return inputs, nil
+	return inputs, sources, nil
+}
+
+func hasKey(m map[string]string, key string) bool {
+	_, ok := m[key]
+	return ok
 }
 
 // This interface is satisfied by *prompt.FakePrompter.
@@ -169,8 +232,12 @@ type fakePrompter interface {
 	IsTestFake()
 }
 
-func validateInputs(ctx context.Context, specInputs []*spec.Input, inputVals map[string]string) error {
+// validateInputs checks inputVals against the rules in specInputs. The values
+// of the inputs named in secretRefs are secret, so their references are shown
+// in error messages instead.
+func validateInputs(ctx context.Context, specInputs []*spec.Input, inputVals, secretRefs map[string]string) error {
 	scope := common.NewScope(inputVals, nil)
+	shownVals := secrets.Redact(inputVals, secretRefs)
 
 	sb := &strings.Builder{}
 	tw := tabwriter.NewWriter(sb, 8, 0, 2, ' ', 0)
@@ -178,8 +245,8 @@ func validateInputs(ctx context.Context, specInputs []*spec.Input, inputVals map
 	for _, input := range specInputs {
 		input := input
 		rules.ValidateRulesWithMessage(ctx, scope, input.Rules, tw, func() {
-			fmt.Fprintf(tw, "\nInput name:\t%s", input.Name.Val)
-			fmt.Fprintf(tw, "\nInput value:\t%s", inputVals[input.Name.Val])
+			fmt.Fprintf(tw, "\n%s:\t%s", messages.Get(ctx, messages.InputLabelName, nil), input.Name.Val)
+			fmt.Fprintf(tw, "\n%s:\t%s", messages.Get(ctx, messages.InputLabelValue, nil), shownVals[input.Name.Val])
 		})
 	}
 
@@ -203,8 +270,8 @@ func promptForInputs(ctx context.Context, prompter Prompter, spec *spec.Spec, in
 		}
 		sb := &strings.Builder{}
 		tw := tabwriter.NewWriter(sb, 8, 0, 2, ' ', 0)
-		fmt.Fprintf(tw, "\nInput name:\t%s", i.Name.Val)
-		fmt.Fprintf(tw, "\nDescription:\t%s", i.Desc.Val)
+		fmt.Fprintf(tw, "\n%s:\t%s", messages.Get(ctx, messages.InputLabelName, nil), i.Name.Val)
+		fmt.Fprintf(tw, "\n%s:\t%s", messages.Get(ctx, messages.InputLabelDescription, nil), i.Desc.Val)
 		for idx, rule := range i.Rules {
 			printRuleIndex := len(i.Rules) > 1
 			rules.WriteRule(tw, rule, printRuleIndex, idx)
@@ -217,15 +284,15 @@ func promptForInputs(ctx context.Context, prompter Prompter, spec *spec.Spec, in
 				// the user can actually see what's happening.
 				defaultStr = `""`
 			}
-			fmt.Fprintf(tw, "\nDefault:\t%s", defaultStr)
+			fmt.Fprintf(tw, "\n%s:\t%s", messages.Get(ctx, messages.InputLabelDefault, nil), defaultStr)
 		}
 
 		tw.Flush()
 
 		if i.Default != nil {
-			fmt.Fprintf(sb, "\n\nEnter value, or leave empty to accept default: ")
+			fmt.Fprintf(sb, "\n\n%s", messages.Get(ctx, messages.InputPromptWithDefault, nil))
 		} else {
-			fmt.Fprintf(sb, "\n\nEnter value: ")
+			fmt.Fprintf(sb, "\n\n%s", messages.Get(ctx, messages.InputPrompt, nil))
 		}
 
 		inputVal, err := prompter.Prompt(ctx, sb.String())
@@ -286,20 +353,21 @@ func filterUnknownInputs(spec *spec.Spec, inputs map[string]string) map[string]s
 	return out
 }
 
-// loadInputFiles iterates over each --input-file and combines them all into a map.
-func loadInputFiles(fs common.FS, paths []string) (map[string]string, error) {
+// loadInputFiles iterates over each --input-file and combines them all into a
+// map. The second return value maps each input name to the file it came from.
+func loadInputFiles(fs common.FS, paths []string) (map[string]string, map[string]string, error) {
 	out := make(map[string]string)
 	sourceFileForInput := make(map[string]string)
 
 	for _, f := range paths {
 		inputsThisFile, err := loadInputFile(fs, f)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		for key, val := range inputsThisFile {
 			if _, ok := out[key]; ok {
-				return nil, fmt.Errorf("input key %q appears in multiple input files %q and %q; there must not be any overlap between input files",
+				return nil, nil, fmt.Errorf("input key %q appears in multiple input files %q and %q; there must not be any overlap between input files",
 					key, f, sourceFileForInput[key])
 			}
 
@@ -307,7 +375,7 @@ func loadInputFiles(fs common.FS, paths []string) (map[string]string, error) {
 			sourceFileForInput[key] = f
 		}
 	}
-	return out, nil
+	return out, sourceFileForInput, nil
 }
 
 // insertDefaultInputs defaults any missing inputs for which a default exists.
@@ -17,11 +17,20 @@ package input
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
-	spec "github.com/abcxyz/abc/templates/model/spec/v1beta6"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/secrets"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1beta7"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
 	mdl "github.com/abcxyz/abc/templates/testutil/model"
 	"github.com/abcxyz/pkg/cli"
 	"github.com/abcxyz/pkg/testutil"
@@ -336,10 +345,171 @@ CEL error:    CEL expression result couldn't be converted to bool. The CEL engin
 			t.Parallel()
 
 			ctx := context.Background()
-			err := validateInputs(ctx, tc.inputModels, tc.inputVals)
+			err := validateInputs(ctx, tc.inputModels, tc.inputVals, nil)
 			if diff := testutil.DiffErrString(err, tc.want); diff != "" {
 				t.Error(diff)
 			}
 		})
 	}
 }
+
+func TestResolveWithSources(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	abctestutil.WriteAll(t, tempDir, map[string]string{
+		"inputs.yaml": "from_file: file_value\nfrom_flag: overridden_by_flag\n",
+	})
+	inputFile := filepath.Join(tempDir, "inputs.yaml")
+
+	sp := &spec.Spec{
+		Inputs: []*spec.Input{
+			{Name: mdl.S("from_flag")},
+			{Name: mdl.S("from_file")},
+			{Name: mdl.S("from_manifest")},
+			{Name: mdl.S("from_default"), Default: mdl.SP("default_value")},
+		},
+	}
+
+	gotInputs, gotSources, err := ResolveWithSources(context.Background(), &ResolveParams{
+		AcceptDefaults:     true,
+		FS:                 &common.RealFS{},
+		InputFiles:         []string{inputFile},
+		Inputs:             map[string]string{"from_flag": "flag_value"},
+		InputsFromManifest: map[string]string{"from_manifest": "manifest_value", "from_file": "overridden_by_file"},
+		Spec:               sp,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantInputs := map[string]string{
+		"from_flag":     "flag_value",
+		"from_file":     "file_value",
+		"from_manifest": "manifest_value",
+		"from_default":  "default_value",
+	}
+	if diff := cmp.Diff(gotInputs, wantInputs); diff != "" {
+		t.Errorf("inputs were not as expected (-got,+want): %s", diff)
+	}
+
+	wantSources := map[string]*Source{
+		"from_flag":     {Kind: manifest.InputSourceFlag},
+		"from_file":     {Kind: manifest.InputSourceInputFile, File: inputFile},
+		"from_manifest": {Kind: manifest.InputSourceManifest},
+		"from_default":  {Kind: manifest.InputSourceDefault},
+	}
+	if diff := cmp.Diff(gotSources, wantSources); diff != "" {
+		t.Errorf("sources were not as expected (-got,+want): %s", diff)
+	}
+}
+
+type fakeSecretResolver map[string]string
+
+func (f fakeSecretResolver) Resolve(ctx context.Context, path string) (string, error) {
+	val, ok := f[path]
+	if !ok {
+		return "", fmt.Errorf("no secret %q", path)
+	}
+	return val, nil
+}
+
+func TestResolveWithSources_Secrets(t *testing.T) {
+	t.Parallel()
+
+	sp := &spec.Spec{
+		Inputs: []*spec.Input{
+			{Name: mdl.S("plain")},
+			{
+				Name: mdl.S("api_key"),
+				Rules: []*spec.Rule{
+					{Rule: mdl.S(`size(api_key) > 10`)},
+				},
+			},
+		},
+	}
+	resolvers := map[string]secrets.SecretResolver{
+		"fake": fakeSecretResolver{
+			"long":  "a-long-secret-value",
+			"short": "tiny",
+		},
+	}
+
+	cases := []struct {
+		name        string
+		inputs      map[string]string
+		resolvers   map[string]secrets.SecretResolver
+		wantInputs  map[string]string
+		wantSources map[string]*Source
+		wantErr     string
+	}{
+		{
+			name:      "resolved",
+			inputs:    map[string]string{"plain": "hello", "api_key": "secret://fake/long"},
+			resolvers: resolvers,
+			wantInputs: map[string]string{
+				"plain":   "hello",
+				"api_key": "a-long-secret-value",
+			},
+			wantSources: map[string]*Source{
+				"plain":   {Kind: manifest.InputSourceFlag},
+				"api_key": {Kind: manifest.InputSourceFlag, SecretRef: "secret://fake/long"},
+			},
+		},
+		{
+			name:      "nil_resolvers_leave_references_alone",
+			inputs:    map[string]string{"plain": "hello", "api_key": "secret://fake/long"},
+			resolvers: nil,
+			wantInputs: map[string]string{
+				"plain":   "hello",
+				"api_key": "secret://fake/long",
+			},
+			wantSources: map[string]*Source{
+				"plain":   {Kind: manifest.InputSourceFlag},
+				"api_key": {Kind: manifest.InputSourceFlag},
+			},
+		},
+		{
+			name:      "unknown_secret",
+			inputs:    map[string]string{"plain": "hello", "api_key": "secret://fake/nope"},
+			resolvers: resolvers,
+			wantErr:   `input "api_key": failed resolving secret reference "secret://fake/nope": no secret "nope"`,
+		},
+		{
+			name:      "validation_failure_does_not_show_secret",
+			inputs:    map[string]string{"plain": "hello", "api_key": "secret://fake/short"},
+			resolvers: resolvers,
+			wantErr:   "secret://fake/short",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			gotInputs, gotSources, err := ResolveWithSources(context.Background(), &ResolveParams{
+				FS:              &common.RealFS{},
+				Inputs:          tc.inputs,
+				SecretResolvers: tc.resolvers,
+				Spec:            sp,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				if strings.Contains(err.Error(), "tiny") {
+					t.Errorf("error message %q revealed the secret value", err)
+				}
+				return
+			}
+			if diff := cmp.Diff(gotInputs, tc.wantInputs); diff != "" {
+				t.Errorf("inputs were not as expected (-got,+want): %s", diff)
+			}
+			if diff := cmp.Diff(gotSources, tc.wantSources); diff != "" {
+				t.Errorf("sources were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
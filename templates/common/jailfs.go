@@ -0,0 +1,291 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxSymlinks is how many symlinks may be followed while resolving one path,
+// the same limit that Linux uses.
+const maxSymlinks = 40
+
+var _ FS = (*JailFS)(nil)
+
+// JailFS is an FS that only allows access to paths inside a fixed set of root
+// directories. It's used while running spec steps, so that no matter how a
+// template's paths are written, the template can't read or write anything
+// besides the scratch, template, and destination directories.
+//
+// Each path is checked after resolving ".." and symlinks, so neither a
+// traversal like "a/../../x" nor a symlink that points outside of the roots can
+// escape. Paths that don't exist yet are checked as far as they exist, so
+// writes to new files are allowed inside the roots. Relative paths and
+// symlinks are resolved by the wrapped FS if it's a LinkFS, so for a MemFS the
+// local disk is never consulted.
+//
+// The jail only knows about the set of roots, not which root an action meant
+// to use, so it doesn't replace the ".." checks on action params (see
+// SafeRelPath). Those keep a path that's meant to be in the scratch directory
+// from reaching the template directory, which is a sibling in the same temp
+// directory and also a root. They also report the problem at the position of
+// the offending param in spec.yaml.
+type JailFS struct {
+	fs    FS
+	links LinkFS
+	roots []string // absolute, with symlinks resolved
+}
+
+// NewJailFS returns a JailFS that wraps inner and allows access to the given
+// directories and everything under them. Relative roots are resolved against
+// the working directory.
+func NewJailFS(inner FS, roots ...string) (*JailFS, error) {
+	j := &JailFS{fs: inner, links: linkFSOf(inner)}
+	for _, root := range roots {
+		resolved, err := resolvePath(j.links, root)
+		if err != nil {
+			return nil, fmt.Errorf("failed resolving %q: %w", root, err)
+		}
+		j.roots = append(j.roots, resolved)
+	}
+	return j, nil
+}
+
+// PathOutsideJailError is returned by JailFS for a path that's outside all of
+// its roots.
+type PathOutsideJailError struct {
+	Path string
+}
+
+func (e *PathOutsideJailError) Error() string {
+	return fmt.Sprintf("access to %q was blocked because it's outside of the directories that a template may use", e.Path)
+}
+
+// check returns an error if name is outside the roots.
+func (j *JailFS) check(name string) error {
+	resolved, err := resolvePath(j.links, name)
+	if err != nil {
+		return fmt.Errorf("failed resolving %q: %w", name, err)
+	}
+	for _, root := range j.roots {
+		if isWithin(root, resolved) {
+			return nil
+		}
+	}
+	return &PathOutsideJailError{Path: name}
+}
+
+func (j *JailFS) Chmod(name string, mode os.FileMode) error {
+	if err := j.check(name); err != nil {
+		return err
+	}
+	return j.fs.Chmod(name, mode) //nolint:wrapcheck
+}
+
+func (j *JailFS) Chtimes(name string, atime, mtime time.Time) error {
+	if err := j.check(name); err != nil {
+		return err
+	}
+	return j.fs.Chtimes(name, atime, mtime) //nolint:wrapcheck
+}
+
+func (j *JailFS) ListXattrs(name string) (map[string][]byte, error) {
+	if err := j.check(name); err != nil {
+		return nil, err
+	}
+	return j.fs.ListXattrs(name) //nolint:wrapcheck
+}
+
+func (j *JailFS) MkdirAll(name string, perm os.FileMode) error {
+	if err := j.check(name); err != nil {
+		return err
+	}
+	return j.fs.MkdirAll(name, perm) //nolint:wrapcheck
+}
+
+func (j *JailFS) MkdirTemp(dir, pattern string) (string, error) {
+	if err := j.check(dir); err != nil {
+		return "", err
+	}
+	if strings.ContainsRune(pattern, filepath.Separator) {
+		return "", fmt.Errorf("MkdirTemp pattern %q must not contain a path separator", pattern)
+	}
+	return j.fs.MkdirTemp(dir, pattern) //nolint:wrapcheck
+}
+
+func (j *JailFS) Open(name string) (fs.File, error) {
+	if err := j.check(name); err != nil {
+		return nil, err
+	}
+	return j.fs.Open(name) //nolint:wrapcheck
+}
+
+func (j *JailFS) OpenFile(name string, flag int, perm os.FileMode) (io.WriteCloser, error) {
+	if err := j.check(name); err != nil {
+		return nil, err
+	}
+	return j.fs.OpenFile(name, flag, perm) //nolint:wrapcheck
+}
+
+// Glob searches the wrapped FS. The matches aren't checked against the roots,
+// since any later access to them is.
+func (j *JailFS) Glob(pattern string) ([]string, error) {
+	return Glob(j.fs, pattern)
+}
+
+// ReadDir implements fs.ReadDirFS.
+func (j *JailFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if err := j.check(name); err != nil {
+		return nil, err
+	}
+	return fs.ReadDir(j.fs, name) //nolint:wrapcheck
+}
+
+func (j *JailFS) ReadFile(name string) ([]byte, error) {
+	if err := j.check(name); err != nil {
+		return nil, err
+	}
+	return j.fs.ReadFile(name) //nolint:wrapcheck
+}
+
+func (j *JailFS) RemoveAll(name string) error {
+	if err := j.check(name); err != nil {
+		return err
+	}
+	return j.fs.RemoveAll(name) //nolint:wrapcheck
+}
+
+func (j *JailFS) Remove(name string) error {
+	if err := j.check(name); err != nil {
+		return err
+	}
+	return j.fs.Remove(name) //nolint:wrapcheck
+}
+
+func (j *JailFS) Rename(from, to string) error {
+	if err := j.check(from); err != nil {
+		return err
+	}
+	if err := j.check(to); err != nil {
+		return err
+	}
+	return j.fs.Rename(from, to) //nolint:wrapcheck
+}
+
+func (j *JailFS) SetXattr(name, attr string, value []byte) error {
+	if err := j.check(name); err != nil {
+		return err
+	}
+	return j.fs.SetXattr(name, attr, value) //nolint:wrapcheck
+}
+
+func (j *JailFS) Stat(name string) (fs.FileInfo, error) {
+	if err := j.check(name); err != nil {
+		return nil, err
+	}
+	return j.fs.Stat(name) //nolint:wrapcheck
+}
+
+func (j *JailFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	if err := j.check(name); err != nil {
+		return err
+	}
+	return j.fs.WriteFile(name, data, perm) //nolint:wrapcheck
+}
+
+// resolvePath is like filepath.EvalSymlinks on the given FS, except that the
+// path doesn't have to exist. The part of the path that exists has its
+// symlinks resolved, and the rest is cleaned. Components are resolved one at a
+// time, so ".." after a symlink goes to the parent of the symlink's target,
+// like the OS does.
+func resolvePath(lfs LinkFS, path string) (string, error) {
+	// Don't use filepath.Abs() or Join(), because they clean the path, and
+	// cleaning ".." before resolving symlinks can give the wrong answer.
+	abs := path
+	if !filepath.IsAbs(path) {
+		wd, err := lfs.Getwd()
+		if err != nil {
+			return "", fmt.Errorf("Getwd(): %w", err)
+		}
+		abs = wd + string(filepath.Separator) + path
+	}
+	vol := filepath.VolumeName(abs)
+	root := vol + string(filepath.Separator)
+
+	cur := root
+	pending := splitPath(abs[len(vol):])
+	links := 0
+	for len(pending) > 0 {
+		part := pending[0]
+		pending = pending[1:]
+
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			cur = filepath.Dir(cur)
+			continue
+		}
+
+		next := filepath.Join(cur, part)
+		fi, err := lfs.Lstat(next)
+		if err != nil || fi.Mode()&fs.ModeSymlink == 0 {
+			// Either a real file or directory, or it doesn't exist (yet). In
+			// the latter case, the following components won't exist either,
+			// unless a ".." climbs back out of it.
+			cur = next
+			continue
+		}
+
+		links++
+		if links > maxSymlinks {
+			return "", fmt.Errorf("too many levels of symbolic links")
+		}
+		target, err := lfs.Readlink(next)
+		if err != nil {
+			return "", fmt.Errorf("Readlink(): %w", err)
+		}
+		if filepath.IsAbs(target) {
+			tvol := filepath.VolumeName(target)
+			cur = tvol + string(filepath.Separator)
+			target = target[len(tvol):]
+		}
+		pending = append(splitPath(target), pending...)
+	}
+	return cur, nil
+}
+
+func splitPath(path string) []string {
+	return strings.FieldsFunc(path, func(r rune) bool {
+		return r < utf8.RuneSelf && os.IsPathSeparator(uint8(r))
+	})
+}
+
+// isWithin returns whether path is dir or is under dir. Both must be absolute
+// and clean.
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
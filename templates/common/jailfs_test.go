@@ -0,0 +1,321 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+// setUpJail creates a directory tree with symlinks that point inside and
+// outside of the jail root, and returns the temp dir and a JailFS rooted at
+// its "root" subdirectory.
+func setUpJail(tb testing.TB) (string, *JailFS) {
+	tb.Helper()
+
+	tempDir := tb.TempDir()
+	for path, contents := range map[string]string{
+		"root/file.txt":       "inside",
+		"root/sub/nested.txt": "nested",
+		"outside/secret.txt":  "secret",
+	} {
+		path = filepath.Join(tempDir, path)
+		if err := os.MkdirAll(filepath.Dir(path), OwnerRWXPerms); err != nil {
+			tb.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), OwnerRWPerms); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		"root/link_in":       "sub",
+		"root/link_out":      "../outside",
+		"root/link_abs_out":  filepath.Join(tempDir, "outside", "secret.txt"),
+		"root/dangling_out":  "../outside/new.txt",
+		"root/sub/link_up":   "..",
+		"root/loop":          "loop",
+		"root/link_dot_dot":  "link_in/../../outside",
+		"root/sub/link_deep": "../../outside",
+	} {
+		if err := os.Symlink(target, filepath.Join(tempDir, link)); err != nil {
+			tb.Fatal(err)
+		}
+	}
+
+	j, err := NewJailFS(&RealFS{}, filepath.Join(tempDir, "root"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return tempDir, j
+}
+
+func TestJailFS(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		op      func(j *JailFS, dir string) error
+		wantErr string
+	}{
+		{
+			name: "read_inside",
+			op:   readOp("root/file.txt"),
+		},
+		{
+			name: "read_inside_with_dot_dot",
+			op:   readOp("root/sub/../file.txt"),
+		},
+		{
+			name: "read_through_symlink_inside",
+			op:   readOp("root/link_in/nested.txt"),
+		},
+		{
+			name: "read_through_symlink_to_parent_inside",
+			op:   readOp("root/sub/link_up/file.txt"),
+		},
+		{
+			name:    "read_outside_with_dot_dot",
+			op:      readOp("root/../outside/secret.txt"),
+			wantErr: "outside of the directories that a template may use",
+		},
+		{
+			name:    "read_through_relative_symlink_out",
+			op:      readOp("root/link_out/secret.txt"),
+			wantErr: "outside of the directories that a template may use",
+		},
+		{
+			name:    "read_through_absolute_symlink_out",
+			op:      readOp("root/link_abs_out"),
+			wantErr: "outside of the directories that a template may use",
+		},
+		{
+			name:    "read_through_symlink_with_dot_dot",
+			op:      readOp("root/link_dot_dot/secret.txt"),
+			wantErr: "outside of the directories that a template may use",
+		},
+		{
+			name:    "read_through_nested_symlink_out",
+			op:      readOp("root/sub/link_deep/secret.txt"),
+			wantErr: "outside of the directories that a template may use",
+		},
+		{
+			name:    "symlink_loop",
+			op:      readOp("root/loop/file.txt"),
+			wantErr: "too many levels of symbolic links",
+		},
+		{
+			name: "write_new_file_inside",
+			op: func(j *JailFS, dir string) error {
+				path := filepath.Join(dir, "root", "new", "dir", "file.txt")
+				if err := j.MkdirAll(filepath.Dir(path), OwnerRWXPerms); err != nil {
+					return err
+				}
+				return j.WriteFile(path, []byte("new"), OwnerRWPerms)
+			},
+		},
+		{
+			name: "write_through_dangling_symlink_out",
+			op: func(j *JailFS, dir string) error {
+				return j.WriteFile(filepath.Join(dir, "root", "dangling_out"), []byte("new"), OwnerRWPerms)
+			},
+			wantErr: "outside of the directories that a template may use",
+		},
+		{
+			name: "rename_out",
+			op: func(j *JailFS, dir string) error {
+				return j.Rename(filepath.Join(dir, "root", "file.txt"), filepath.Join(dir, "outside", "file.txt"))
+			},
+			wantErr: "outside of the directories that a template may use",
+		},
+		{
+			name: "remove_all_out",
+			op: func(j *JailFS, dir string) error {
+				return j.RemoveAll(filepath.Join(dir, "root", "link_out", "secret.txt"))
+			},
+			wantErr: "outside of the directories that a template may use",
+		},
+		{
+			name: "mkdir_temp_out",
+			op: func(j *JailFS, dir string) error {
+				_, err := j.MkdirTemp(filepath.Join(dir, "outside"), "tmp-")
+				return err
+			},
+			wantErr: "outside of the directories that a template may use",
+		},
+		{
+			name: "mkdir_temp_pattern_with_separator",
+			op: func(j *JailFS, dir string) error {
+				_, err := j.MkdirTemp(filepath.Join(dir, "root"), "../tmp-")
+				return err
+			},
+			wantErr: "must not contain a path separator",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir, j := setUpJail(t)
+			err := tc.op(j, dir)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			if tc.wantErr != "" && strings.Contains(tc.wantErr, "outside") {
+				var jailErr *PathOutsideJailError
+				if !errors.As(err, &jailErr) {
+					t.Errorf("got error of type %T, want *PathOutsideJailError", err)
+				}
+			}
+			assertOutsideUnchanged(t, dir)
+		})
+	}
+}
+
+func TestJailFS_MemFS(t *testing.T) {
+	t.Parallel()
+
+	// The local disk has symlinks at the same paths as the MemFS's files,
+	// which must not be consulted.
+	dir, _ := setUpJail(t)
+	mfs, err := NewMemFS(map[string]string{
+		filepath.Join(dir, "root", "link_out", "secret.txt"): "in memory",
+		filepath.Join(dir, "outside", "secret.txt"):          "secret",
+		filepath.Join("rel", "file.txt"):                     "relative",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		root    string
+		path    string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "disk_symlink_is_ignored",
+			root: filepath.Join(dir, "root"),
+			path: filepath.Join(dir, "root", "link_out", "secret.txt"),
+			want: "in memory",
+		},
+		{
+			name:    "dot_dot_out",
+			root:    filepath.Join(dir, "root"),
+			path:    filepath.Join(dir, "root") + string(filepath.Separator) + filepath.Join("..", "outside", "secret.txt"),
+			wantErr: "outside of the directories that a template may use",
+		},
+		{
+			name: "relative_to_memfs_root",
+			root: "rel",
+			path: filepath.Join("rel", "file.txt"),
+			want: "relative",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			j, err := NewJailFS(mfs, tc.root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := j.ReadFile(tc.path)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			if string(got) != tc.want {
+				t.Errorf("got contents %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func readOp(rel string) func(j *JailFS, dir string) error {
+	return func(j *JailFS, dir string) error {
+		_, err := j.ReadFile(filepath.Join(dir, filepath.FromSlash(rel)))
+		return err
+	}
+}
+
+// FuzzJailFS checks that no path, however it's written, lets a JailFS read
+// or write a file outside of its root.
+func FuzzJailFS(f *testing.F) {
+	for _, seed := range []string{
+		"file.txt",
+		"../outside/secret.txt",
+		"link_out/secret.txt",
+		"link_abs_out",
+		"dangling_out",
+		"sub/link_up/../outside/secret.txt",
+		"link_in/../../outside/secret.txt",
+		"sub/link_deep/secret.txt",
+		"/../../outside/secret.txt",
+		"new/../../outside/new.txt",
+		"./.././outside//secret.txt",
+		"link_dot_dot/new.txt",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, rel string) {
+		dir, j := setUpJail(t)
+		path := filepath.Join(dir, "root") + string(filepath.Separator) + rel
+
+		if buf, err := j.ReadFile(path); err == nil && string(buf) == "secret" {
+			t.Fatalf("ReadFile(%q) read a file outside of the jail", rel)
+		}
+		_ = j.WriteFile(path, []byte("new"), OwnerRWPerms)
+		_ = j.MkdirAll(path, OwnerRWXPerms)
+		_ = j.RemoveAll(path)
+		assertOutsideUnchanged(t, dir)
+	})
+}
+
+// assertOutsideUnchanged fails the test if the "outside" directory created
+// by setUpJail was modified.
+func assertOutsideUnchanged(tb testing.TB, dir string) {
+	tb.Helper()
+
+	entries, err := os.ReadDir(filepath.Join(dir, "outside"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "secret.txt" {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		tb.Fatalf("the directory outside of the jail was modified, it now has %v", names)
+	}
+	buf, err := os.ReadFile(filepath.Join(dir, "outside", "secret.txt"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if string(buf) != "secret" {
+		tb.Fatalf("a file outside of the jail was modified, it now has %q", buf)
+	}
+}
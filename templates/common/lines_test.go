@@ -0,0 +1,63 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSplitLines(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{
+			name: "empty",
+			in:   "",
+			want: nil,
+		},
+		{
+			name: "final_newline",
+			in:   "a\nb\n",
+			want: []string{"a\n", "b\n"},
+		},
+		{
+			name: "no_final_newline",
+			in:   "a\nb",
+			want: []string{"a\n", "b"},
+		},
+		{
+			name: "blank_lines",
+			in:   "\n\na\n",
+			want: []string{"\n", "\n", "a\n"},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if diff := cmp.Diff(SplitLines(tc.in), tc.want); diff != "" {
+				t.Errorf("SplitLines(%q) returned unexpected lines (-got,+want): %s", tc.in, diff)
+			}
+		})
+	}
+}
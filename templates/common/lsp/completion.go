@@ -0,0 +1,247 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsp
+
+import (
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
+)
+
+// actionParams maps each action name to the struct that its "params" are
+// decoded into. This must be kept in sync with spec.Step.UnmarshalYAML().
+var actionParams = map[string]reflect.Type{
+	"append":            reflect.TypeOf(spec.Append{}),
+	"buf_generate":      reflect.TypeOf(spec.BufGenerate{}),
+	"for_each":          reflect.TypeOf(spec.ForEach{}),
+	"go_mod_edit":       reflect.TypeOf(spec.GoModEdit{}),
+	"go_template":       reflect.TypeOf(spec.GoTemplate{}),
+	"hcl_modify":        reflect.TypeOf(spec.HCLModify{}),
+	"include":           reflect.TypeOf(spec.Include{}),
+	"license_header":    reflect.TypeOf(spec.LicenseHeader{}),
+	"print":             reflect.TypeOf(spec.Print{}),
+	"regex_name_lookup": reflect.TypeOf(spec.RegexNameLookup{}),
+	"regex_replace":     reflect.TypeOf(spec.RegexReplace{}),
+	"string_replace":    reflect.TypeOf(spec.StringReplace{}),
+	"wasm":              reflect.TypeOf(spec.Wasm{}),
+}
+
+var (
+	specKindRE = regexp.MustCompile(`(?m)^kind:\s*['"]?Template\b`)
+
+	// Matches a line that's being completed as the value of "action".
+	actionValueRE = regexp.MustCompile(`^[\s-]*action:\s*\w*$`)
+
+	// Matches a line that's being completed as a mapping key.
+	keyPrefixRE = regexp.MustCompile(`^[\s-]*\w*$`)
+
+	// Matches the key on a YAML line, like "foo" in "  - foo: bar".
+	keyRE = regexp.MustCompile(`^[\s-]*(\w+):`)
+
+	stepType = reflect.TypeOf(spec.Step{})
+)
+
+// Complete returns the completions for the given position in a spec file:
+// action names after "action:", and field names when starting a new key. The
+// fields under "params" depend on the step's action. Other files get no
+// completions.
+func Complete(text string, pos Position) []CompletionItem {
+	if !specKindRE.MatchString(text) {
+		return nil
+	}
+	lines := strings.Split(text, "\n")
+	if pos.Line >= len(lines) {
+		return nil
+	}
+	line := strings.TrimRight(lines[pos.Line], "\r")
+	prefix := line[:min(pos.Character, len(line))]
+
+	if actionValueRE.MatchString(prefix) {
+		out := make([]CompletionItem, 0, len(actionParams))
+		for _, name := range sortedKeys(actionParams) {
+			out = append(out, CompletionItem{Label: name, Kind: KindEnum, Detail: "action"})
+		}
+		return out
+	}
+
+	if !keyPrefixRE.MatchString(prefix) {
+		return nil
+	}
+	t := typeAt(lines, pos.Line, keyIndent(prefix))
+	if t == nil {
+		return nil
+	}
+	var out []CompletionItem
+	for _, name := range fieldNames(t) {
+		out = append(out, CompletionItem{Label: name, Kind: KindField, Detail: t.Name()})
+	}
+	return out
+}
+
+// typeAt returns the struct type of the YAML mapping that a key at the given
+// line and indentation belongs to, or nil if it isn't known. It does this by
+// finding the chain of parent keys and following them down from spec.Spec.
+func typeAt(lines []string, lineNum, indent int) reflect.Type {
+	// Each parent is a key with less indentation than its child, on an
+	// earlier line.
+	type parent struct {
+		key  string
+		line int
+	}
+	var parents []parent
+	for i := lineNum - 1; i >= 0 && indent > 0; i-- {
+		l := strings.TrimRight(lines[i], "\r")
+		if isBlankOrComment(l) {
+			continue
+		}
+		ind := keyIndent(l)
+		if ind >= indent {
+			continue
+		}
+		m := keyRE.FindStringSubmatch(l)
+		if m == nil {
+			return nil
+		}
+		parents = append(parents, parent{key: m[1], line: i})
+		indent = ind
+	}
+
+	t := reflect.TypeOf(spec.Spec{})
+	for i := len(parents) - 1; i >= 0; i-- {
+		p := parents[i]
+		if t == stepType && p.key == "params" {
+			t = actionParams[stepAction(lines, p.line)]
+		} else {
+			t = fieldType(t, p.key)
+		}
+		if t == nil {
+			return nil
+		}
+	}
+	return t
+}
+
+// stepAction returns the value of the "action" key in the step that has the
+// key on the given line, or "" if there isn't one.
+func stepAction(lines []string, lineNum int) string {
+	indent := keyIndent(lines[lineNum])
+	check := func(l string) (action string, stop bool) {
+		if isBlankOrComment(l) {
+			return "", false
+		}
+		if keyIndent(l) < indent {
+			return "", true
+		}
+		if keyIndent(l) == indent {
+			if v, ok := strings.CutPrefix(strings.TrimLeft(l, " -"), "action:"); ok {
+				return strings.Trim(strings.TrimSpace(v), `'"`), true
+			}
+		}
+		return "", false
+	}
+
+	// Look upward until the start of the list item, then downward until the
+	// next list item.
+	for i := lineNum; i >= 0; i-- {
+		l := strings.TrimRight(lines[i], "\r")
+		action, stop := check(l)
+		if action != "" || stop {
+			return action
+		}
+		if strings.HasPrefix(strings.TrimSpace(l), "-") {
+			break
+		}
+	}
+	for i := lineNum + 1; i < len(lines); i++ {
+		l := strings.TrimRight(lines[i], "\r")
+		if strings.HasPrefix(strings.TrimSpace(l), "-") && keyIndent(l) <= indent {
+			return ""
+		}
+		action, stop := check(l)
+		if action != "" || stop {
+			return action
+		}
+	}
+	return ""
+}
+
+// fieldType returns the struct type of the field with the given YAML key,
+// looking through pointers and slices, or nil if there isn't one.
+func fieldType(t reflect.Type, key string) reflect.Type {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if yamlName(f) != key {
+			continue
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer || ft.Kind() == reflect.Slice {
+			ft = ft.Elem()
+		}
+		if ft.Kind() != reflect.Struct || len(fieldNames(ft)) == 0 {
+			return nil
+		}
+		return ft
+	}
+	return nil
+}
+
+// fieldNames returns the YAML keys of the given struct type.
+func fieldNames(t reflect.Type) []string {
+	var out []string
+	if t == reflect.TypeOf(spec.Spec{}) {
+		out = append(out, "api_version", "kind")
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if name := yamlName(t.Field(i)); name != "" {
+			out = append(out, name)
+		}
+	}
+	if t == stepType {
+		// "params" is decoded by hand, so it's not a field of Step.
+		out = append(out, "params")
+	}
+	return out
+}
+
+func yamlName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// keyIndent returns the column where the key on the given line starts, after
+// any indentation and list item dashes.
+func keyIndent(l string) int {
+	return len(l) - len(strings.TrimLeft(l, " -"))
+}
+
+func isBlankOrComment(l string) bool {
+	s := strings.TrimSpace(l)
+	return s == "" || strings.HasPrefix(s, "#")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,175 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestComplete(t *testing.T) {
+	t.Parallel()
+
+	// The "|" in each input marks the cursor position.
+	cases := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{
+			name: "action_names",
+			in: `api_version: cli.abcxyz.dev/v1beta7
+kind: Template
+steps:
+  - desc: a step
+    action: |`,
+			want: []string{
+				"append", "buf_generate", "for_each", "go_mod_edit", "go_template", "hcl_modify", "include", "license_header", "print",
+				"regex_name_lookup", "regex_replace", "string_replace", "wasm",
+			},
+		},
+		{
+			name: "action_names_partial",
+			in: `api_version: cli.abcxyz.dev/v1beta7
+kind: Template
+steps:
+  - action: inc|`,
+			want: []string{
+				"append", "buf_generate", "for_each", "go_mod_edit", "go_template", "hcl_modify", "include", "license_header", "print",
+				"regex_name_lookup", "regex_replace", "string_replace", "wasm",
+			},
+		},
+		{
+			name: "top_level",
+			in: `api_version: cli.abcxyz.dev/v1beta7
+kind: Template
+|`,
+			want: []string{"api_version", "kind", "desc", "inputs", "rules", "steps", "ignore", "file_metadata", "deprecated", "input_migrations", "outputs", "merge_strategies", "pre_upgrade", "post_upgrade", "template_engine"},
+		},
+		{
+			name: "step_fields",
+			in: `api_version: cli.abcxyz.dev/v1beta7
+kind: Template
+steps:
+  - desc: a step
+    |`,
+			want: []string{"desc", "if", "action", "timeout", "retries", "params"},
+		},
+		{
+			name: "params_action_before",
+			in: `api_version: cli.abcxyz.dev/v1beta7
+kind: Template
+steps:
+  - desc: a step
+    action: append
+    params:
+      |`,
+			want: []string{"paths", "with", "skip_ensure_newline"},
+		},
+		{
+			name: "params_action_after",
+			in: `api_version: cli.abcxyz.dev/v1beta7
+kind: Template
+steps:
+  - desc: first step
+    action: print
+    params:
+      message: hi
+  - params:
+      |
+    action: include
+  - desc: third step
+    action: print`,
+			want: []string{"paths"},
+		},
+		{
+			name: "nested_params",
+			in: `api_version: cli.abcxyz.dev/v1beta7
+kind: Template
+steps:
+  - desc: a step
+    action: include
+    params:
+      paths:
+        - paths: ['.']
+          |`,
+			want: []string{"as", "from", "on_conflict", "paths", "skip", "skip_gitignore", "source", "version"},
+		},
+		{
+			name: "for_each_steps",
+			in: `api_version: cli.abcxyz.dev/v1beta7
+kind: Template
+steps:
+  - desc: a step
+    action: for_each
+    params:
+      iterator:
+        key: env
+        values: [dev]
+      steps:
+        - desc: inner
+          action: string_replace
+          params:
+            |`,
+			want: []string{"paths", "replacements"},
+		},
+		{
+			name: "value_position",
+			in: `api_version: cli.abcxyz.dev/v1beta7
+kind: Template
+desc: |`,
+			want: nil,
+		},
+		{
+			name: "unknown_action",
+			in: `api_version: cli.abcxyz.dev/v1beta7
+kind: Template
+steps:
+  - action: nope
+    params:
+      |`,
+			want: nil,
+		},
+		{
+			name: "not_a_spec",
+			in: `api_version: cli.abcxyz.dev/v1beta7
+kind: GoldenTest
+|`,
+			want: nil,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			before, after, _ := strings.Cut(tc.in, "|")
+			lines := strings.Split(before, "\n")
+			pos := Position{Line: len(lines) - 1, Character: len(lines[len(lines)-1])}
+
+			var got []string
+			for _, item := range Complete(before+after, pos) {
+				got = append(got, item.Label)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("completions were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/common/builtinvar"
+	"github.com/abcxyz/abc/templates/model"
+	"github.com/abcxyz/abc/templates/model/decode"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
+)
+
+// diagnosticSource is shown by editors next to each diagnostic.
+const diagnosticSource = "abc"
+
+var (
+	// Matches the position prefix added by model.ConfigPos.Errorf().
+	posRE = regexp.MustCompile(`at line (\d+) column (\d+)`)
+
+	// Matches the position in YAML syntax errors.
+	yamlPosRE = regexp.MustCompile(`yaml: line (\d+)`)
+
+	// Matches one {{...}} Go template action.
+	actionRE = regexp.MustCompile(`\{\{-?(.*?)-?\}\}`)
+
+	// Matches a reference to a top-level template variable like ".foo" inside
+	// a Go template action. Field accesses like ".foo.bar" only report "foo",
+	// and method calls on other values like "(x).foo" are skipped.
+	varRefRE = regexp.MustCompile(`(?:^|[^\w.)\]])\.([A-Za-z_]\w*)`)
+
+	// Matches a named capturing group in a regex, which becomes a variable in
+	// the regex_name_lookup and regex_replace actions.
+	namedGroupRE = regexp.MustCompile(`\(\?P?<([A-Za-z_]\w*)>`)
+)
+
+// Diagnose decodes and validates the given YAML file the same way that abc
+// does, and returns its problems. Spec files are also checked for references
+// to template variables that are never defined.
+func Diagnose(ctx context.Context, filename string, buf []byte) []Diagnostic {
+	lines := strings.Split(string(buf), "\n")
+
+	vu, _, err := decode.DecodeValidateUpgrade(ctx, bytes.NewReader(buf), filename, "")
+	if err != nil {
+		// The editor shows the error at its position, so the excerpts would
+		// just be noise.
+		var ee *model.ExcerptError
+		if errors.As(err, &ee) {
+			err = ee.Err
+		}
+		return errDiagnostics(lines, err)
+	}
+
+	s, ok := vu.(*spec.Spec)
+	if !ok {
+		return nil
+	}
+	return unknownVarDiagnostics(lines, buf, s)
+}
+
+// errDiagnostics turns an error into diagnostics, one per position mentioned
+// in the error message. Joined errors have one error per line, and lines
+// without a position are added to the diagnostic before them.
+func errDiagnostics(lines []string, err error) []Diagnostic {
+	var out []Diagnostic
+	for _, msgLine := range strings.Split(err.Error(), "\n") {
+		if strings.TrimSpace(msgLine) == "" {
+			continue
+		}
+		line, col, ok := errPos(msgLine)
+		if !ok && len(out) > 0 {
+			out[len(out)-1].Message += "\n" + msgLine
+			continue
+		}
+		out = append(out, Diagnostic{
+			Range:    lineRange(lines, line, col),
+			Severity: SeverityError,
+			Source:   diagnosticSource,
+			Message:  msgLine,
+		})
+	}
+	return out
+}
+
+// errPos returns the zero-based line and column of the last position in the
+// given error message. Errors are wrapped from the outside in, so the last
+// position is the most specific one.
+func errPos(msg string) (line, col int, ok bool) {
+	if m := posRE.FindAllStringSubmatch(msg, -1); m != nil {
+		last := m[len(m)-1]
+		line, _ = strconv.Atoi(last[1])
+		col, _ = strconv.Atoi(last[2])
+		return max(line-1, 0), max(col-1, 0), true
+	}
+	if m := yamlPosRE.FindAllStringSubmatch(msg, -1); m != nil {
+		line, _ = strconv.Atoi(m[len(m)-1][1])
+		return max(line-1, 0), 0, true
+	}
+	return 0, 0, false
+}
+
+// lineRange returns the range from the given zero-based position to the end
+// of its line.
+func lineRange(lines []string, line, col int) Range {
+	end := col
+	if line < len(lines) {
+		end = max(len(strings.TrimRight(lines[line], "\r")), col)
+	}
+	return Range{
+		Start: Position{Line: line, Character: col},
+		End:   Position{Line: line, Character: end},
+	}
+}
+
+// unknownVarDiagnostics warns about Go template actions in the spec file that
+// reference a variable that isn't an input, a builtin, a for_each key, or a
+// regex named group. This can't be an error because the check is approximate;
+// for example, the meaning of "." changes inside {{range}} and {{with}}.
+func unknownVarDiagnostics(lines []string, buf []byte, s *spec.Spec) []Diagnostic {
+	var root yaml.Node
+	if err := yaml.Unmarshal(buf, &root); err != nil {
+		return nil // can't happen, the file was already decoded successfully
+	}
+
+	known := map[string]struct{}{}
+	for _, input := range s.Inputs {
+		known[input.Name.Val] = struct{}{}
+	}
+	for _, name := range builtinvar.NamesInScope(s.Features) {
+		known[name] = struct{}{}
+	}
+	addStepVars(known, s.Steps)
+
+	var out []Diagnostic
+	walkScalars(&root, func(n *yaml.Node) {
+		seen := map[string]struct{}{}
+		for _, action := range actionRE.FindAllStringSubmatch(n.Value, -1) {
+			for _, ref := range varRefRE.FindAllStringSubmatch(action[1], -1) {
+				name := ref[1]
+				if _, ok := known[name]; ok {
+					continue
+				}
+				if _, ok := seen[name]; ok {
+					continue
+				}
+				seen[name] = struct{}{}
+				out = append(out, Diagnostic{
+					Range:    lineRange(lines, n.Line-1, n.Column-1),
+					Severity: SeverityWarning,
+					Source:   diagnosticSource,
+					Message:  fmt.Sprintf("template variable %q isn't defined as an input or builtin variable", name),
+				})
+			}
+		}
+	})
+	return out
+}
+
+// addStepVars adds the variables defined by steps, including nested ones, to
+// the known set. The scope of these variables isn't tracked, so a variable
+// that's defined anywhere is treated as known everywhere.
+func addStepVars(known map[string]struct{}, steps []*spec.Step) {
+	for _, step := range steps {
+		switch {
+		case step.ForEach != nil:
+			if it := step.ForEach.Iterator; it != nil {
+				known[it.Key.Val] = struct{}{}
+			}
+			addStepVars(known, step.ForEach.Steps)
+		case step.RegexNameLookup != nil:
+			for _, r := range step.RegexNameLookup.Replacements {
+				addNamedGroups(known, r.Regex.Val)
+			}
+		case step.RegexReplace != nil:
+			for _, r := range step.RegexReplace.Replacements {
+				addNamedGroups(known, r.Regex.Val)
+			}
+		}
+	}
+}
+
+func addNamedGroups(known map[string]struct{}, regex string) {
+	for _, m := range namedGroupRE.FindAllStringSubmatch(regex, -1) {
+		known[m[1]] = struct{}{}
+	}
+}
+
+// walkScalars calls f for every scalar node under n that contains a Go
+// template action.
+func walkScalars(n *yaml.Node, f func(*yaml.Node)) {
+	if n.Kind == yaml.ScalarNode && strings.Contains(n.Value, "{{") {
+		f(n)
+	}
+	for _, c := range n.Content {
+		walkScalars(c, f)
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiagnose(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		filename string
+		in       string
+		want     []Diagnostic
+	}{
+		{
+			name:     "valid_spec",
+			filename: "spec.yaml",
+			in: `api_version: cli.abcxyz.dev/v1beta7
+kind: Template
+desc: mydesc
+inputs:
+  - name: person
+    desc: who to greet
+steps:
+  - desc: print a greeting
+    action: print
+    params:
+      message: hello {{.person}}, from {{._git_tag}} and {{._flag_dest}}
+`,
+		},
+		{
+			name:     "unknown_action",
+			filename: "spec.yaml",
+			in: `api_version: cli.abcxyz.dev/v1beta7
+kind: Template
+desc: mydesc
+steps:
+  - desc: a step
+    action: nope
+`,
+			want: []Diagnostic{
+				{
+					Range:    Range{Start: Position{Line: 4, Character: 4}, End: Position{Line: 4, Character: 16}},
+					Severity: SeverityError,
+					Source:   "abc",
+					Message:  `error parsing YAML file spec.yaml: at line 5 column 5: unknown action type "nope"`,
+				},
+			},
+		},
+		{
+			name:     "yaml_syntax_error",
+			filename: "spec.yaml",
+			in: `api_version: cli.abcxyz.dev/v1beta7
+kind: Template
+  desc: [
+`,
+			want: []Diagnostic{
+				{
+					Range:    Range{Start: Position{Line: 2, Character: 0}, End: Position{Line: 2, Character: 9}},
+					Severity: SeverityError,
+					Source:   "abc",
+					Message:  "error parsing file spec.yaml: yaml: line 3: mapping values are not allowed in this context",
+				},
+			},
+		},
+		{
+			name:     "unknown_variables",
+			filename: "spec.yaml",
+			in: `api_version: cli.abcxyz.dev/v1beta7
+kind: Template
+desc: mydesc
+inputs:
+  - name: person
+    desc: who to greet
+steps:
+  - desc: print a greeting
+    action: print
+    params:
+      message: hello {{.person}} and {{.nobody}} and {{.nobody}}
+  - desc: look up names
+    action: regex_name_lookup
+    params:
+      paths: ['.']
+      replacements:
+        - regex: (?P<group>x)
+  - desc: loop
+    action: for_each
+    params:
+      iterator:
+        key: env
+        values: [dev]
+      steps:
+        - desc: print in a loop
+          action: print
+          params:
+            message: '{{.env}} {{.group}} {{.missing | toUpper}} {{.person.field}}'
+`,
+			want: []Diagnostic{
+				{
+					Range:    Range{Start: Position{Line: 10, Character: 15}, End: Position{Line: 10, Character: 64}},
+					Severity: SeverityWarning,
+					Source:   "abc",
+					Message:  `template variable "nobody" isn't defined as an input or builtin variable`,
+				},
+				{
+					Range:    Range{Start: Position{Line: 27, Character: 21}, End: Position{Line: 27, Character: 83}},
+					Severity: SeverityWarning,
+					Source:   "abc",
+					Message:  `template variable "missing" isn't defined as an input or builtin variable`,
+				},
+			},
+		},
+		{
+			name:     "not_a_spec",
+			filename: "test.yaml",
+			in: `api_version: cli.abcxyz.dev/v1beta7
+kind: GoldenTest
+inputs:
+  - name: greeting
+    value: '{{.foo}}'
+`,
+			want: nil,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := Diagnose(context.Background(), tc.filename, []byte(tc.in))
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("diagnostics were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
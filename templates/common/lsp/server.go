@@ -0,0 +1,176 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lsp is a language server for abc's YAML files. Editors talk to it
+// over stdin and stdout using the Language Server Protocol. It reports decode
+// and validation errors and unknown template variables as diagnostics, and
+// completes action names and their params in spec.yaml files.
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/abcxyz/pkg/logging"
+)
+
+// Serve runs the language server, reading requests from r and writing
+// responses to w, until the client sends "exit", r is closed, or ctx is
+// canceled.
+func Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	s := &server{
+		docs: map[string]string{},
+		w:    w,
+	}
+	br := bufio.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		msg, err := readMessage(br)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		done, err := s.handle(ctx, msg)
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// server holds the state of one session. Requests are handled one at a time,
+// in order, so there's no locking.
+type server struct {
+	// The text of each open document, by URI.
+	docs map[string]string
+
+	w io.Writer
+}
+
+// handle handles one message. It returns true if the server should exit.
+func (s *server) handle(ctx context.Context, msg *message) (bool, error) {
+	logger := logging.FromContext(ctx).With("logger", "lsp")
+	logger.DebugContext(ctx, "received message", "method", msg.Method)
+
+	switch msg.Method {
+	case "initialize":
+		return false, s.reply(msg, map[string]any{
+			"capabilities": map[string]any{
+				// 1 means the client sends the full text on every change.
+				"textDocumentSync": 1,
+				"completionProvider": map[string]any{
+					"triggerCharacters": []string{":", " "},
+				},
+			},
+			"serverInfo": map[string]string{"name": "abc"},
+		})
+	case "shutdown":
+		return false, s.reply(msg, nil)
+	case "exit":
+		return true, nil
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return false, s.replyErr(msg, codeInvalidParams, err.Error())
+		}
+		s.docs[p.TextDocument.URI] = p.TextDocument.Text
+		return false, s.publishDiagnostics(ctx, p.TextDocument.URI)
+	case "textDocument/didChange":
+		var p didChangeParams
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return false, s.replyErr(msg, codeInvalidParams, err.Error())
+		}
+		if n := len(p.ContentChanges); n > 0 {
+			s.docs[p.TextDocument.URI] = p.ContentChanges[n-1].Text
+		}
+		return false, s.publishDiagnostics(ctx, p.TextDocument.URI)
+	case "textDocument/didClose":
+		var p didCloseParams
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return false, s.replyErr(msg, codeInvalidParams, err.Error())
+		}
+		delete(s.docs, p.TextDocument.URI)
+		// Clear the closed document's diagnostics.
+		return false, s.notify("textDocument/publishDiagnostics", &publishDiagnosticsParams{
+			URI:         p.TextDocument.URI,
+			Diagnostics: []Diagnostic{},
+		})
+	case "textDocument/completion":
+		var p completionParams
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return false, s.replyErr(msg, codeInvalidParams, err.Error())
+		}
+		items := Complete(s.docs[p.TextDocument.URI], p.Position)
+		if items == nil {
+			items = []CompletionItem{}
+		}
+		return false, s.reply(msg, items)
+	}
+
+	if msg.ID != nil {
+		return false, s.replyErr(msg, codeMethodNotFound, fmt.Sprintf("method %q isn't supported", msg.Method))
+	}
+	// Unknown notifications, like "initialized" and "$/cancelRequest", are
+	// ignored.
+	return false, nil
+}
+
+func (s *server) publishDiagnostics(ctx context.Context, uri string) error {
+	diags := Diagnose(ctx, uriBase(uri), []byte(s.docs[uri]))
+	if diags == nil {
+		diags = []Diagnostic{}
+	}
+	return s.notify("textDocument/publishDiagnostics", &publishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: diags,
+	})
+}
+
+func (s *server) reply(req *message, result any) error {
+	if req.ID == nil {
+		return nil // it was a notification, there's no one to reply to
+	}
+	buf, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed marshaling result: %w", err)
+	}
+	return writeMessage(s.w, &message{ID: req.ID, Result: buf})
+}
+
+func (s *server) replyErr(req *message, code int, msg string) error {
+	if req.ID == nil {
+		return nil
+	}
+	return writeMessage(s.w, &message{ID: req.ID, Error: &responseError{Code: code, Message: msg}})
+}
+
+func (s *server) notify(method string, params any) error {
+	buf, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed marshaling params: %w", err)
+	}
+	return writeMessage(s.w, &message{Method: method, Params: buf})
+}
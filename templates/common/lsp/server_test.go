@@ -0,0 +1,95 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestServe(t *testing.T) {
+	t.Parallel()
+
+	const uri = "file:///tmp/mytemplate/spec.yaml"
+	invalidSpec := "api_version: cli.abcxyz.dev/v1beta7\nkind: Template\ndesc: mydesc\nsteps:\n  - desc: a step\n    action: nope\n"
+	validSpec := "api_version: cli.abcxyz.dev/v1beta7\nkind: Template\ndesc: mydesc\nsteps:\n  - desc: a step\n    action: \n"
+
+	var in bytes.Buffer
+	for _, req := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","method":"initialized","params":{}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"` + uri + `","text":` + quote(t, invalidSpec) + `}}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/didChange","params":{"textDocument":{"uri":"` + uri + `"},"contentChanges":[{"text":` + quote(t, validSpec) + `}]}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"textDocument/completion","params":{"textDocument":{"uri":"` + uri + `"},"position":{"line":5,"character":12}}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"textDocument/hover","params":{}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/didClose","params":{"textDocument":{"uri":"` + uri + `"}}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	} {
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(req), req)
+	}
+
+	var out bytes.Buffer
+	if err := Serve(context.Background(), &in, &out); err != nil {
+		t.Fatalf("Serve() failed: %v", err)
+	}
+
+	var got []string
+	br := bufio.NewReader(&out)
+	for {
+		msg, err := readMessage(br)
+		if err == io.EOF { //nolint:errorlint
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(buf))
+	}
+
+	want := []string{
+		`{"jsonrpc":"2.0","id":1,"result":{"capabilities":{"completionProvider":{"triggerCharacters":[":"," "]},"textDocumentSync":1},"serverInfo":{"name":"abc"}}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/publishDiagnostics","params":{"uri":"` + uri + `","diagnostics":[{"range":{"start":{"line":4,"character":4},"end":{"line":4,"character":16}},"severity":1,"source":"abc","message":"error parsing YAML file spec.yaml: at line 5 column 5: unknown action type \"nope\""}]}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/publishDiagnostics","params":{"uri":"` + uri + `","diagnostics":[{"range":{"start":{"line":4,"character":4},"end":{"line":4,"character":16}},"severity":1,"source":"abc","message":"error parsing YAML file spec.yaml: at line 5 column 5: missing \"action\" field in this step"}]}}`,
+		`{"jsonrpc":"2.0","id":2,"result":[{"label":"append","kind":13,"detail":"action"},{"label":"buf_generate","kind":13,"detail":"action"},{"label":"for_each","kind":13,"detail":"action"},{"label":"go_mod_edit","kind":13,"detail":"action"},{"label":"go_template","kind":13,"detail":"action"},{"label":"hcl_modify","kind":13,"detail":"action"},{"label":"include","kind":13,"detail":"action"},{"label":"license_header","kind":13,"detail":"action"},{"label":"print","kind":13,"detail":"action"},{"label":"regex_name_lookup","kind":13,"detail":"action"},{"label":"regex_replace","kind":13,"detail":"action"},{"label":"string_replace","kind":13,"detail":"action"},{"label":"wasm","kind":13,"detail":"action"}]}`,
+		`{"jsonrpc":"2.0","id":3,"error":{"code":-32601,"message":"method \"textDocument/hover\" isn't supported"}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/publishDiagnostics","params":{"uri":"` + uri + `","diagnostics":[]}}`,
+		`{"jsonrpc":"2.0","id":4,"result":null}`,
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("responses were not as expected (-got,+want): %s", diff)
+	}
+}
+
+func quote(tb testing.TB, s string) string {
+	tb.Helper()
+
+	buf, err := json.Marshal(s)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return string(buf)
+}
@@ -0,0 +1,584 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ FS = (*MemFS)(nil)
+
+// MemFS is an FS that keeps all files in memory and never touches the local
+// disk. It lets a program render templates without a writable filesystem,
+// like a web service that renders a template for each request, and makes
+// tests that don't need real files faster.
+//
+// Paths are interpreted like on the local OS, except that relative paths are
+// relative to the root directory, since a MemFS has no working directory. It
+// doesn't support symlinks. The zero value is an empty filesystem that's
+// ready to use, and all methods are safe for concurrent use.
+type MemFS struct {
+	mu sync.Mutex
+
+	// nodes has every file and directory, keyed by cleaned absolute path. The
+	// root directory is implicit.
+	nodes map[string]*memNode
+
+	// tempSeq makes MkdirTemp's names unique.
+	tempSeq int
+}
+
+type memNode struct {
+	mode    fs.FileMode // has fs.ModeDir for directories
+	data    []byte
+	modTime time.Time
+	xattrs  map[string][]byte
+}
+
+// IsInMemory returns whether the files in fsys are kept in memory by a MemFS
+// rather than being on the local disk, looking through any JailFS or ErrorFS
+// that wraps it. Code that hands paths to another program must check this,
+// since the other program can't see the files.
+func IsInMemory(fsys FS) bool {
+	for {
+		switch f := fsys.(type) {
+		case *MemFS:
+			return true
+		case *JailFS:
+			fsys = f.fs
+		case *ErrorFS:
+			fsys = f.FS
+		default:
+			return false
+		}
+	}
+}
+
+// NewMemFS returns a MemFS containing the given files, keyed by path, which
+// is convenient for tests. Their parent directories are created as needed.
+func NewMemFS(files map[string]string) (*MemFS, error) {
+	m := &MemFS{}
+	for path, contents := range files {
+		if err := m.MkdirAll(filepath.Dir(path), OwnerRWXPerms); err != nil {
+			return nil, err
+		}
+		if err := m.WriteFile(path, []byte(contents), OwnerRWPerms); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// key returns the map key for name.
+func (m *MemFS) key(name string) string {
+	if !filepath.IsAbs(name) {
+		name = string(filepath.Separator) + name
+	}
+	return filepath.Clean(name)
+}
+
+func (m *MemFS) isRoot(key string) bool {
+	return filepath.Dir(key) == key
+}
+
+// lookup returns the node for key. The root directory is made up on the fly.
+// The caller must hold m.mu.
+func (m *MemFS) lookup(key string) (*memNode, bool) {
+	if m.isRoot(key) {
+		return &memNode{mode: fs.ModeDir | 0o755}, true
+	}
+	n, ok := m.nodes[key]
+	return n, ok
+}
+
+// parentDir returns an error unless the parent of key is an existing
+// directory. The caller must hold m.mu.
+func (m *MemFS) parentDir(op, name, key string) error {
+	if m.isRoot(key) {
+		return nil
+	}
+	parent, ok := m.lookup(filepath.Dir(key))
+	if !ok {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	if !parent.mode.IsDir() {
+		return &fs.PathError{Op: op, Path: name, Err: errNotDir}
+	}
+	return nil
+}
+
+var errNotDir = fmt.Errorf("not a directory")
+
+// children returns the keys of the direct children of dirKey, sorted by
+// name. The caller must hold m.mu.
+func (m *MemFS) children(dirKey string) []string {
+	var out []string
+	for k := range m.nodes {
+		if k != dirKey && filepath.Dir(k) == dirKey {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// descendants returns the keys of everything under dirKey, not including
+// dirKey itself. The caller must hold m.mu.
+func (m *MemFS) descendants(dirKey string) []string {
+	prefix := dirKey + string(filepath.Separator)
+	if m.isRoot(dirKey) {
+		prefix = dirKey
+	}
+	var out []string
+	for k := range m.nodes {
+		if k != dirKey && strings.HasPrefix(k, prefix) {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+func (m *MemFS) Chmod(name string, mode os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.lookup(m.key(name))
+	if !ok {
+		return &fs.PathError{Op: "chmod", Path: name, Err: fs.ErrNotExist}
+	}
+	n.mode = n.mode.Type() | mode&^fs.ModeType
+	return nil
+}
+
+func (m *MemFS) Chtimes(name string, _, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.lookup(m.key(name))
+	if !ok {
+		return &fs.PathError{Op: "chtimes", Path: name, Err: fs.ErrNotExist}
+	}
+	n.modTime = mtime
+	return nil
+}
+
+func (m *MemFS) ListXattrs(name string) (map[string][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.lookup(m.key(name))
+	if !ok {
+		return nil, &fs.PathError{Op: "listxattr", Path: name, Err: fs.ErrNotExist}
+	}
+	out := make(map[string][]byte, len(n.xattrs))
+	for k, v := range n.xattrs {
+		out[k] = bytes.Clone(v)
+	}
+	return out, nil
+}
+
+func (m *MemFS) SetXattr(name, attr string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.lookup(m.key(name))
+	if !ok {
+		return &fs.PathError{Op: "setxattr", Path: name, Err: fs.ErrNotExist}
+	}
+	if n.xattrs == nil {
+		n.xattrs = make(map[string][]byte)
+	}
+	n.xattrs[attr] = bytes.Clone(value)
+	return nil
+}
+
+func (m *MemFS) MkdirAll(name string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mkdirAll(name, m.key(name), perm)
+}
+
+// mkdirAll is MkdirAll for a caller that holds m.mu.
+func (m *MemFS) mkdirAll(name, key string, perm os.FileMode) error {
+	if n, ok := m.lookup(key); ok {
+		if !n.mode.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: name, Err: errNotDir}
+		}
+		return nil
+	}
+	if err := m.mkdirAll(name, filepath.Dir(key), perm); err != nil {
+		return err
+	}
+	if m.nodes == nil {
+		m.nodes = make(map[string]*memNode)
+	}
+	m.nodes[key] = &memNode{mode: fs.ModeDir | perm.Perm(), modTime: time.Now()}
+	return nil
+}
+
+// MkdirTemp is like os.MkdirTemp. Unlike os.MkdirTemp, the parent directory is
+// created if it doesn't exist, and if dir is empty, os.TempDir() is used
+// without touching the local disk.
+func (m *MemFS) MkdirTemp(dir, pattern string) (string, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	if strings.ContainsRune(pattern, filepath.Separator) {
+		return "", &fs.PathError{Op: "mkdirtemp", Path: pattern, Err: fs.ErrInvalid}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.mkdirAll(dir, m.key(dir), OwnerRWXPerms); err != nil {
+		return "", err
+	}
+	prefix, suffix := pattern, ""
+	if i := strings.LastIndex(pattern, "*"); i >= 0 {
+		prefix, suffix = pattern[:i], pattern[i+1:]
+	}
+	for {
+		m.tempSeq++
+		name := filepath.Join(dir, prefix+strconv.Itoa(m.tempSeq)+suffix)
+		key := m.key(name)
+		if _, ok := m.nodes[key]; ok {
+			continue
+		}
+		m.nodes[key] = &memNode{mode: fs.ModeDir | OwnerRWXPerms, modTime: time.Now()}
+		return name, nil
+	}
+}
+
+func (m *MemFS) Open(name string) (fs.File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := m.key(name)
+	n, ok := m.lookup(key)
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	f := &memFile{info: memFileInfo{name: filepath.Base(key), node: *n, size: int64(len(n.data))}}
+	if n.mode.IsDir() {
+		for _, k := range m.children(key) {
+			c := m.nodes[k]
+			f.entries = append(f.entries, fs.FileInfoToDirEntry(&memFileInfo{name: filepath.Base(k), node: *c, size: int64(len(c.data))}))
+		}
+	} else {
+		f.r = bytes.NewReader(n.data)
+	}
+	return f, nil
+}
+
+// OpenFile is like os.OpenFile, for writing only. It supports the O_CREATE,
+// O_EXCL, O_TRUNC, and O_APPEND flags. The written data is visible to other
+// callers as soon as it's written.
+func (m *MemFS) OpenFile(name string, flag int, perm os.FileMode) (io.WriteCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := m.key(name)
+	n, ok := m.lookup(key)
+	switch {
+	case ok && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case ok && n.mode.IsDir():
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("is a directory")}
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case !ok:
+		if err := m.parentDir("open", name, key); err != nil {
+			return nil, err
+		}
+		if m.nodes == nil {
+			m.nodes = make(map[string]*memNode)
+		}
+		n = &memNode{mode: perm.Perm()}
+		m.nodes[key] = n
+	}
+	if flag&os.O_TRUNC != 0 {
+		n.data = nil
+	}
+	n.modTime = time.Now()
+	return &memWriter{fs: m, node: n, append: flag&os.O_APPEND != 0}, nil
+}
+
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.lookup(m.key(name))
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if n.mode.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fmt.Errorf("is a directory")}
+	}
+	return bytes.Clone(n.data), nil
+}
+
+// ReadDir implements fs.ReadDirFS.
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	f, err := m.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	mf := f.(*memFile) //nolint:forcetypeassert // Open always returns a *memFile
+	if !mf.info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+	return mf.entries, nil
+}
+
+// Glob is like filepath.Glob, but matches the files in m. See the Glob
+// function.
+func (m *MemFS) Glob(pattern string) ([]string, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := m.key(pattern)
+	depth := strings.Count(key, string(filepath.Separator))
+	var out []string
+	for k := range m.nodes {
+		if strings.Count(k, string(filepath.Separator)) != depth {
+			continue
+		}
+		if ok, _ := filepath.Match(key, k); ok {
+			if !filepath.IsAbs(pattern) {
+				// Relative patterns give relative matches, as if the root
+				// were the working directory.
+				k = k[len(string(filepath.Separator)):]
+			}
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := m.key(name)
+	n, ok := m.lookup(key)
+	if !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if n.mode.IsDir() && len(m.children(key)) > 0 {
+		return &fs.PathError{Op: "remove", Path: name, Err: fmt.Errorf("directory not empty")}
+	}
+	delete(m.nodes, key)
+	return nil
+}
+
+func (m *MemFS) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := m.key(name)
+	for _, k := range m.descendants(key) {
+		delete(m.nodes, k)
+	}
+	delete(m.nodes, key)
+	return nil
+}
+
+// Rename is like os.Rename on Unix: a file replaces any existing file, and a
+// directory replaces any existing empty directory.
+func (m *MemFS) Rename(from, to string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fromKey, toKey := m.key(from), m.key(to)
+	src, ok := m.lookup(fromKey)
+	if !ok || m.isRoot(fromKey) {
+		return &os.LinkError{Op: "rename", Old: from, New: to, Err: fs.ErrNotExist}
+	}
+	if fromKey == toKey {
+		return nil
+	}
+	if err := m.parentDir("rename", to, toKey); err != nil {
+		return &os.LinkError{Op: "rename", Old: from, New: to, Err: err}
+	}
+	if dst, ok := m.lookup(toKey); ok {
+		switch {
+		case src.mode.IsDir() && !dst.mode.IsDir():
+			return &os.LinkError{Op: "rename", Old: from, New: to, Err: errNotDir}
+		case !src.mode.IsDir() && dst.mode.IsDir():
+			return &os.LinkError{Op: "rename", Old: from, New: to, Err: fmt.Errorf("file exists")}
+		case dst.mode.IsDir() && len(m.children(toKey)) > 0:
+			return &os.LinkError{Op: "rename", Old: from, New: to, Err: fmt.Errorf("directory not empty")}
+		}
+	}
+	if src.mode.IsDir() && strings.HasPrefix(toKey, fromKey+string(filepath.Separator)) {
+		return &os.LinkError{Op: "rename", Old: from, New: to, Err: fs.ErrInvalid}
+	}
+
+	for _, k := range m.descendants(fromKey) {
+		m.nodes[toKey+strings.TrimPrefix(k, fromKey)] = m.nodes[k]
+		delete(m.nodes, k)
+	}
+	m.nodes[toKey] = src
+	delete(m.nodes, fromKey)
+	return nil
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := m.key(name)
+	n, ok := m.lookup(key)
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return &memFileInfo{name: filepath.Base(key), node: *n, size: int64(len(n.data))}, nil
+}
+
+// Getwd returns the root directory, since relative paths in a MemFS are
+// relative to it.
+func (m *MemFS) Getwd() (string, error) {
+	return string(filepath.Separator), nil
+}
+
+// Lstat is the same as Stat, since a MemFS has no symlinks.
+func (m *MemFS) Lstat(name string) (fs.FileInfo, error) {
+	return m.Stat(name)
+}
+
+// Readlink always fails, since a MemFS has no symlinks.
+func (m *MemFS) Readlink(name string) (string, error) {
+	return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+}
+
+func (m *MemFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	w, err := m.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err //nolint:wrapcheck
+	}
+	return w.Close() //nolint:wrapcheck
+}
+
+// memWriter is returned by MemFS.OpenFile.
+type memWriter struct {
+	fs     *MemFS
+	node   *memNode
+	append bool
+	pos    int
+	closed bool
+}
+
+func (w *memWriter) Write(b []byte) (int, error) {
+	w.fs.mu.Lock()
+	defer w.fs.mu.Unlock()
+
+	if w.closed {
+		return 0, fs.ErrClosed
+	}
+	if w.append {
+		w.pos = len(w.node.data)
+	}
+	if end := w.pos + len(b); end > len(w.node.data) {
+		w.node.data = append(w.node.data, make([]byte, end-len(w.node.data))...)
+	}
+	copy(w.node.data[w.pos:], b)
+	w.pos += len(b)
+	w.node.modTime = time.Now()
+	return len(b), nil
+}
+
+func (w *memWriter) Close() error {
+	w.fs.mu.Lock()
+	defer w.fs.mu.Unlock()
+
+	if w.closed {
+		return fs.ErrClosed
+	}
+	w.closed = true
+	return nil
+}
+
+// memFile is returned by MemFS.Open. It has a snapshot of the file's contents,
+// or of the directory's entries, as of when it was opened.
+type memFile struct {
+	info    memFileInfo
+	r       *bytes.Reader
+	entries []fs.DirEntry
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	return &f.info, nil
+}
+
+func (f *memFile) Read(b []byte) (int, error) {
+	if f.r == nil {
+		return 0, &fs.PathError{Op: "read", Path: f.info.name, Err: fmt.Errorf("is a directory")}
+	}
+	return f.r.Read(b) //nolint:wrapcheck
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (f *memFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !f.info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: f.info.name, Err: errNotDir}
+	}
+	if n <= 0 {
+		out := f.entries
+		f.entries = nil
+		return out, nil
+	}
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(f.entries))
+	out := f.entries[:n]
+	f.entries = f.entries[n:]
+	return out, nil
+}
+
+type memFileInfo struct {
+	name string
+	node memNode
+	size int64
+}
+
+func (i *memFileInfo) Name() string       { return i.name }
+func (i *memFileInfo) Size() int64        { return i.size }
+func (i *memFileInfo) Mode() fs.FileMode  { return i.node.mode }
+func (i *memFileInfo) ModTime() time.Time { return i.node.modTime }
+func (i *memFileInfo) IsDir() bool        { return i.node.mode.IsDir() }
+func (i *memFileInfo) Sys() any           { return nil }
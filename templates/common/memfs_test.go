@@ -0,0 +1,212 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestMemFS_Operations(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		files   map[string]string
+		op      func(m *MemFS) error
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name:  "write_and_overwrite",
+			files: map[string]string{"/d/a.txt": "old"},
+			op: func(m *MemFS) error {
+				return m.WriteFile("/d/a.txt", []byte("new"), OwnerRWPerms)
+			},
+			want: map[string]string{"/d/a.txt": "new"},
+		},
+		{
+			name: "write_needs_parent_dir",
+			op: func(m *MemFS) error {
+				return m.WriteFile("/d/a.txt", []byte("new"), OwnerRWPerms)
+			},
+			want:    map[string]string{},
+			wantErr: "file does not exist",
+		},
+		{
+			name:  "open_excl_fails_if_exists",
+			files: map[string]string{"/a.txt": "a"},
+			op: func(m *MemFS) error {
+				_, err := m.OpenFile("/a.txt", os.O_CREATE|os.O_EXCL|os.O_WRONLY, OwnerRWPerms)
+				return err
+			},
+			want:    map[string]string{"/a.txt": "a"},
+			wantErr: "file already exists",
+		},
+		{
+			name:  "open_append",
+			files: map[string]string{"/a.txt": "a"},
+			op: func(m *MemFS) error {
+				w, err := m.OpenFile("/a.txt", os.O_APPEND|os.O_WRONLY, OwnerRWPerms)
+				if err != nil {
+					return err
+				}
+				if _, err := w.Write([]byte("bc")); err != nil {
+					return err //nolint:wrapcheck
+				}
+				return w.Close() //nolint:wrapcheck
+			},
+			want: map[string]string{"/a.txt": "abc"},
+		},
+		{
+			name:  "rename_dir",
+			files: map[string]string{"/from/a.txt": "a", "/from/sub/b.txt": "b", "/to/placeholder": ""},
+			op: func(m *MemFS) error {
+				return m.Rename("/from", "/to/moved")
+			},
+			want: map[string]string{"/to/moved/a.txt": "a", "/to/moved/sub/b.txt": "b", "/to/placeholder": ""},
+		},
+		{
+			name:  "rename_file_over_file",
+			files: map[string]string{"/a.txt": "a", "/b.txt": "b"},
+			op: func(m *MemFS) error {
+				return m.Rename("/a.txt", "/b.txt")
+			},
+			want: map[string]string{"/b.txt": "a"},
+		},
+		{
+			name:  "rename_dir_over_nonempty_dir",
+			files: map[string]string{"/a/x": "x", "/b/y": "y"},
+			op: func(m *MemFS) error {
+				return m.Rename("/a", "/b")
+			},
+			want:    map[string]string{"/a/x": "x", "/b/y": "y"},
+			wantErr: "directory not empty",
+		},
+		{
+			name:  "remove_nonempty_dir",
+			files: map[string]string{"/d/a.txt": "a"},
+			op: func(m *MemFS) error {
+				return m.Remove("/d")
+			},
+			want:    map[string]string{"/d/a.txt": "a"},
+			wantErr: "directory not empty",
+		},
+		{
+			name:  "remove_all",
+			files: map[string]string{"/d/a.txt": "a", "/d/sub/b.txt": "b", "/dd/c.txt": "c"},
+			op: func(m *MemFS) error {
+				return m.RemoveAll("/d")
+			},
+			want: map[string]string{"/dd/c.txt": "c"},
+		},
+		{
+			name:  "copy_recursive",
+			files: map[string]string{"/src/a.txt": "a", "/src/sub/b.txt": "b"},
+			op: func(m *MemFS) error {
+				_, err := CopyRecursive(context.Background(), nil, &CopyParams{
+					FS:      m,
+					SrcRoot: "/src",
+					DstRoot: "/dst",
+				})
+				return err
+			},
+			want: map[string]string{"/src/a.txt": "a", "/src/sub/b.txt": "b", "/dst/a.txt": "a", "/dst/sub/b.txt": "b"},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			m, err := NewMemFS(tc.files)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = tc.op(m)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			if diff := cmp.Diff(memFSContents(t, m), tc.want); diff != "" {
+				t.Errorf("files were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestMemFS_MkdirTempAndGlob(t *testing.T) {
+	t.Parallel()
+
+	m := &MemFS{}
+	dir1, err := m.MkdirTemp("/tmp/base", "scratch-*-dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir2, err := m.MkdirTemp("/tmp/base", "scratch-*-dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir1 == dir2 {
+		t.Errorf("MkdirTemp returned %q twice", dir1)
+	}
+	if _, err := os.Stat("/tmp/base"); err == nil {
+		t.Errorf("MkdirTemp touched the local disk")
+	}
+
+	got, err := m.Glob("/tmp/base/scratch-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(got, []string{dir1, dir2}); diff != "" {
+		t.Errorf("Glob results were not as expected (-got,+want): %s", diff)
+	}
+	got, err = Glob(m, "tmp/base/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(got, []string{filepath.Join("tmp", "base", filepath.Base(dir1)), filepath.Join("tmp", "base", filepath.Base(dir2))}); diff != "" {
+		t.Errorf("relative Glob results were not as expected (-got,+want): %s", diff)
+	}
+	if got, err := Glob(m, "/tmp/*/nothing"); err != nil || len(got) != 0 {
+		t.Errorf("got %v, %v, wanted no matches", got, err)
+	}
+}
+
+// memFSContents returns all the files in m, keyed by path.
+func memFSContents(tb testing.TB, m *MemFS) map[string]string {
+	tb.Helper()
+
+	out := map[string]string{}
+	root := string(filepath.Separator)
+	if err := fs.WalkDir(m, root, func(path string, de fs.DirEntry, err error) error {
+		if err != nil || de.IsDir() {
+			return err
+		}
+		buf, err := m.ReadFile(path)
+		out[filepath.ToSlash(path)] = string(buf)
+		return err
+	}); err != nil {
+		tb.Fatal(err)
+	}
+	return out
+}
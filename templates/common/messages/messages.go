@@ -0,0 +1,319 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package messages is the catalog of abc's longer user-facing text, like the
+// interactive input prompts and the explanations of what to do after an error.
+// Each message has an ID and a default text. A messages file can replace any
+// message, or append to it, so that an organization can localize abc or point
+// its users at internal documentation.
+//
+// The messages file is named by $ABC_MESSAGES_FILE, which can also be set with
+// the messages_file setting of a config file. It looks like:
+//
+//	replace:
+//	  input_prompt: 'Valeur : '
+//	append:
+//	  upgrade_merge_instructions: 'See https://wiki.example.com/abc-upgrades for help.'
+//
+// Messages are Go templates. Some of them are given data, as described along
+// with their IDs below.
+package messages
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvVar is the environment variable that names the messages file.
+const EnvVar = "ABC_MESSAGES_FILE"
+
+// ID identifies a message in the catalog. IDs are part of the format of
+// messages files, so they must not change.
+type ID string
+
+const (
+	// InputPrompt asks the user for the value of an input that has no
+	// default, after the input has been described.
+	InputPrompt ID = "input_prompt"
+
+	// InputPromptWithDefault asks the user for the value of an input that has
+	// a default.
+	InputPromptWithDefault ID = "input_prompt_with_default"
+
+	// InputLabelName, InputLabelDescription, InputLabelDefault and
+	// InputLabelValue are the labels used when describing an input, both when
+	// prompting for it and when it fails validation.
+	InputLabelName        ID = "input_label_name"
+	InputLabelDescription ID = "input_label_description"
+	InputLabelDefault     ID = "input_label_default"
+	InputLabelValue       ID = "input_label_value"
+
+	// BackfillNeedsPatches explains why --backfill-manifest-only can't create
+	// a complete manifest for a template that modifies files in place. Its data
+	// has a Files field, the list of those files.
+	BackfillNeedsPatches ID = "backfill_manifest_needs_patches"
+
+	// UpgradeMergeInstructions explains how to resolve the merge conflicts of
+	// an upgrade.
+	UpgradeMergeInstructions ID = "upgrade_merge_instructions"
+
+	// UpgradePatchReversalInstructions explains how to resolve a conflict
+	// when undoing the in-place modifications of a previous template version
+	// during an upgrade.
+	UpgradePatchReversalInstructions ID = "upgrade_patch_reversal_instructions"
+)
+
+var defaults = map[ID]string{
+	InputPrompt:            "Enter value: ",
+	InputPromptWithDefault: "Enter value, or leave empty to accept default: ",
+	InputLabelName:         "Input name",
+	InputLabelDescription:  "Description",
+	InputLabelDefault:      "Default",
+	InputLabelValue:        "Input value",
+
+	BackfillNeedsPatches: `
+We're running in --backfill-manifest-only mode with a template that modifies
+files in place (using the "from: destination" feature in spec.yaml). Normally,
+the manifest is supposed to store a patch for each file modified in place that
+will undo the modification. This is used later during the template upgrade
+process. We can't generate a complete manifest retrospectively for this template
+installation because generating a patch would require the former contents of the
+file(s) (before they were modified in place), but we the old version of the file
+isn't available anymore. You have
+two options:
+
+ - Re-run this command with "--continue-without-patches" to proceed anyway,
+   creating a manifest that might cause problems. This means that when you run
+   "abc upgrade" on this manifest in the future, there may be some spurious
+   edits that will require manual correction. For example, there may be duplicate
+   edits in the given file(s). If you don't care about upgrading this template
+   installation later, or if you're confident in handling the merge conflict
+   later, then this is a good option.
+
+ - Revert the commit that rendered this template in the past. Re-render it using
+   "abc render" (which now defaults to '--skip-manifest=false') to generate a
+   fully correct manifest.
+
+The files in question that are modified in place are: {{.Files}}`,
+
+	UpgradeMergeInstructions: `
+Some manual conflict resolution is required because of a conflict between your
+local edits and the new version of the template. Please look at all files whose
+names contain .abcmerge_ and either edit, delete, or rename them to reflect your
+decision. The suffixes below are inserted before the file extension, so
+"main.go" becomes "main.abcmerge_from_new_template.go", unless the template was
+installed with --conflict-file-names=suffix.
+
+Background on conflict types:
+
+ - editEditConflict: you made some local edits to this file that was installed
+   by the template, which conflicts with the new version of the template which
+   wants to edit the file. Your locally edited file is unchanged, and the
+   incoming file from the template has the additional extension 
+   ".abcmerge_from_new_template". Please resolve the conflict by either
+     - selectively incorporating some of the changes from the 
+       .abcmerge_from_new_template file into your local file
+	 - rejecting this incoming change by removing the 
+	   .abcmerge_from_new_template file
+	 - overwriting your locally edit file with the .abcmerge_from_new_template
+	   incoming file. 
+
+ - editDeleteConflict: you made an edit to this file that was installed by the
+   template, which conflicts with the new version of the template, which wants
+   to delete this file. Your version has been renamed to
+   "yourfile.abcmerge_template_wants_to_delete". Please resolve the conflict by
+   renaming it back to "yourfile" or deleting it.
+
+ - deleteEditConflict: you deleted this file that was installed by the template,
+   which conflicts with the new version of the template which wants to edit it.
+   The new version from the template is named
+   "yourfile.abcmerge_locally_deleted_vs_new_template_version". Please resolve
+   the conflict by renaming it to "yourfile" or deleting it.
+
+ - addAddConflict: you added a file which was not originally part of the
+   template, which conflicts with the new version of the template, which wants
+   to create a file of the same name. Your version of the file has been renamed
+   to "yourfile.abcmerge_locally_added", and the version of the template is
+   named "yourfile.abcmerge_from_new_template". Please resolve the conflict by
+   (1) renaming one of these files to "yourfile and deleting the other, or (2)
+   merging the two files into "yourfile".`,
+
+	UpgradePatchReversalInstructions: `
+There was a merge conflict when trying to undo changes to file(s) that were
+modified in-place by a previous version of the template.
+
+Background: the upgrade algorithm has a special case for files that were
+modified in place by a previous version of the template (aka "include from
+destination"). When the file was previously modified in place, a patch was saved
+to undo that modification, so a future template version could start fresh and
+redo the modification in place based on new template logic. Just now, this patch
+was applied to the file, but the patch didn't apply cleanly. This happens when
+the file was modified since the previous version of this template was installed;
+that could happen because somebody edited the file, or that same file was
+modified in place by a different template.
+
+To resolve this conflict, please manually apply the rejected hunks in the given
+.rej file, for each entry in the following list:`,
+}
+
+// defaultTmpls are the parsed defaults.
+var defaultTmpls = func() map[ID]*template.Template {
+	out := make(map[ID]*template.Template, len(defaults))
+	for id, text := range defaults {
+		out[id] = template.Must(parse(id, text))
+	}
+	return out
+}()
+
+// Default returns the default text of the message with the given ID, for a
+// message that has no data. It's mostly for tests.
+func Default(id ID) string {
+	out, _ := execute(defaultTmpls[id], nil)
+	return out
+}
+
+// Catalog holds the messages that a messages file replaces or appends to. The
+// nil *Catalog has only the defaults.
+type Catalog struct {
+	replace map[ID]*template.Template
+	append  map[ID]*template.Template
+}
+
+// messagesFile is the format of a messages file.
+type messagesFile struct {
+	Replace map[ID]string `yaml:"replace"`
+	Append  map[ID]string `yaml:"append"`
+}
+
+// Load reads the messages file at the given path.
+func Load(path string) (*Catalog, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading messages file: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(buf))
+	dec.KnownFields(true)
+	mf := &messagesFile{}
+	if err := dec.Decode(mf); err != nil && !errors.Is(err, io.EOF) { // an empty file changes nothing
+		return nil, fmt.Errorf("failed parsing messages file %q: %w", path, err)
+	}
+
+	out := &Catalog{}
+	if out.replace, err = parseAll(path, mf.Replace); err != nil {
+		return nil, err
+	}
+	if out.append, err = parseAll(path, mf.Append); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// LoadFromEnv loads the messages file named by $ABC_MESSAGES_FILE. It returns
+// nil, which has only the defaults, if that isn't set.
+func LoadFromEnv(lookupEnv func(string) (string, bool)) (*Catalog, error) {
+	path, ok := lookupEnv(EnvVar)
+	if !ok || path == "" {
+		return nil, nil
+	}
+	return Load(path)
+}
+
+func parseAll(path string, texts map[ID]string) (map[ID]*template.Template, error) {
+	out := make(map[ID]*template.Template, len(texts))
+	for id, text := range texts {
+		if _, ok := defaults[id]; !ok {
+			return nil, fmt.Errorf("messages file %q has unknown message ID %q; the known IDs are %s",
+				path, id, strings.Join(knownIDs(), ", "))
+		}
+		tmpl, err := parse(id, text)
+		if err != nil {
+			return nil, fmt.Errorf("messages file %q: %w", path, err)
+		}
+		out[id] = tmpl
+	}
+	return out, nil
+}
+
+func parse(id ID, text string) (*template.Template, error) {
+	tmpl, err := template.New(string(id)).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing message %q as a Go template: %w", id, err)
+	}
+	return tmpl, nil
+}
+
+func knownIDs() []string {
+	out := make([]string, 0, len(defaults))
+	for id := range defaults {
+		out = append(out, string(id))
+	}
+	sort.Strings(out)
+	return out
+}
+
+// execute returns the output of tmpl, and false if it fails. Only replacement
+// and appended messages can fail, for example by referencing a nonexistent
+// field of the data.
+func execute(tmpl *template.Template, data any) (string, bool) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", false
+	}
+	return b.String(), true
+}
+
+// get returns the text of the message with the given ID. A replacement or
+// appended message that fails to execute is ignored, so that the user still
+// sees the default.
+func (c *Catalog) get(id ID, data any) string {
+	out, _ := execute(defaultTmpls[id], data)
+	if c == nil {
+		return out
+	}
+	if tmpl, ok := c.replace[id]; ok {
+		if s, ok := execute(tmpl, data); ok {
+			out = s
+		}
+	}
+	if tmpl, ok := c.append[id]; ok {
+		if s, ok := execute(tmpl, data); ok {
+			out = strings.TrimRight(out, "\n") + "\n\n" + s
+		}
+	}
+	return out
+}
+
+type catalogKey struct{}
+
+// WithCatalog returns a context whose messages come from c.
+func WithCatalog(ctx context.Context, c *Catalog) context.Context {
+	return context.WithValue(ctx, catalogKey{}, c)
+}
+
+// Get returns the text of the message with the given ID, from the catalog in
+// ctx, or the default if there's none. data is passed to the message template.
+func Get(ctx context.Context, id ID, data any) string {
+	c, _ := ctx.Value(catalogKey{}).(*Catalog)
+	return c.get(id, data)
+}
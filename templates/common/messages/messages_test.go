@@ -0,0 +1,154 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package messages
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestGet(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		file    string // if empty, no catalog is used
+		id      ID
+		data    any
+		want    string
+		wantErr string
+	}{
+		{
+			name: "default",
+			id:   InputPrompt,
+			want: "Enter value: ",
+		},
+		{
+			name: "default_with_data",
+			id:   BackfillNeedsPatches,
+			data: struct{ Files []string }{[]string{"a.txt", "b.txt"}},
+			want: "The files in question that are modified in place are: [a.txt b.txt]",
+		},
+		{
+			name: "replace",
+			file: "replace:\n  input_prompt: 'Valeur : '\n",
+			id:   InputPrompt,
+			want: "Valeur : ",
+		},
+		{
+			name: "replace_with_data",
+			file: "replace:\n  backfill_manifest_needs_patches: 'Voir {{.Files}}'\n",
+			id:   BackfillNeedsPatches,
+			data: struct{ Files []string }{[]string{"a.txt"}},
+			want: "Voir [a.txt]",
+		},
+		{
+			name: "append",
+			file: "append:\n  upgrade_merge_instructions: 'See https://wiki.example.com/abc for help.'\n",
+			id:   UpgradeMergeInstructions,
+			want: `merging the two files into "yourfile".` + "\n\nSee https://wiki.example.com/abc for help.",
+		},
+		{
+			name: "replace_and_append",
+			file: "replace:\n  input_label_name: 'Nom'\nappend:\n  input_label_name: '(obligatoire)'\n",
+			id:   InputLabelName,
+			want: "Nom\n\n(obligatoire)",
+		},
+		{
+			name: "failing_replacement_falls_back_to_default",
+			file: "replace:\n  input_prompt: '{{.Nonexistent}}'\n",
+			id:   InputPrompt,
+			want: "Enter value: ",
+		},
+		{
+			name: "other_messages_unchanged",
+			file: "replace:\n  input_prompt: 'Valeur : '\n",
+			id:   InputLabelName,
+			want: "Input name",
+		},
+		{
+			name: "empty_file",
+			file: "# nothing\n",
+			id:   InputPrompt,
+			want: "Enter value: ",
+		},
+		{
+			name:    "unknown_id",
+			file:    "replace:\n  input_promt: 'Valeur : '\n",
+			wantErr: `unknown message ID "input_promt"; the known IDs are backfill_manifest_needs_patches, input_label_default`,
+		},
+		{
+			name:    "bad_template",
+			file:    "append:\n  input_prompt: '{{'\n",
+			wantErr: `failed parsing message "input_prompt" as a Go template`,
+		},
+		{
+			name:    "unknown_field",
+			file:    "replaces:\n  input_prompt: 'Valeur : '\n",
+			wantErr: "field replaces not found",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			if tc.file != "" {
+				dir := t.TempDir()
+				abctestutil.WriteAll(t, dir, map[string]string{"messages.yaml": tc.file})
+				c, err := LoadFromEnv(func(name string) (string, bool) {
+					if name == EnvVar {
+						return filepath.Join(dir, "messages.yaml"), true
+					}
+					return "", false
+				})
+				if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+					t.Fatal(diff)
+				}
+				if err != nil {
+					return
+				}
+				ctx = WithCatalog(ctx, c)
+			}
+
+			got := Get(ctx, tc.id, tc.data)
+			if !strings.HasSuffix(got, tc.want) {
+				t.Errorf("got message %q, wanted it to end with %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadFromEnv_Unset(t *testing.T) {
+	t.Parallel()
+
+	c, err := LoadFromEnv(func(string) (string, bool) { return "", false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(Get(WithCatalog(context.Background(), c), InputPrompt, nil), Default(InputPrompt)); diff != "" {
+		t.Errorf("message was not as expected (-got,+want): %s", diff)
+	}
+}
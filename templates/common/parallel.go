@@ -0,0 +1,70 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+)
+
+// Parallelism returns the number of workers to use for CPU- and IO-bound work
+// on a set of files. It's keyed off GOMAXPROCS so that users can tune it with
+// the GOMAXPROCS environment variable.
+func Parallelism() int {
+	return runtime.GOMAXPROCS(0)
+}
+
+// ForEachParallel calls f(i) for every i in [0,n), using a pool of at most
+// "workers" goroutines. If workers is less than 1, then Parallelism() is used.
+//
+// Every f(i) is called even if some of them fail. The returned error is the
+// errors.Join of all non-nil errors, in order of increasing i, so the result
+// is deterministic regardless of how the work was scheduled.
+func ForEachParallel(n, workers int, f func(i int) error) error {
+	if workers < 1 {
+		workers = Parallelism()
+	}
+	workers = min(workers, n)
+
+	errs := make([]error, n)
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			errs[i] = f(i)
+		}
+		return errors.Join(errs...)
+	}
+
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				// Each index is only handled by one goroutine, so there's no
+				// race writing to errs.
+				errs[i] = f(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,87 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestForEachParallel(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		n       int
+		workers int
+		failAt  map[int]bool
+		wantErr string
+	}{
+		{
+			name:    "no_work",
+			n:       0,
+			workers: 4,
+		},
+		{
+			name:    "sequential",
+			n:       10,
+			workers: 1,
+		},
+		{
+			name:    "parallel",
+			n:       100,
+			workers: 8,
+		},
+		{
+			name:    "default_workers",
+			n:       100,
+			workers: 0,
+		},
+		{
+			name:    "errors_joined_in_index_order",
+			n:       100,
+			workers: 8,
+			failAt:  map[int]bool{3: true, 42: true, 97: true},
+			wantErr: "failed 3\nfailed 42\nfailed 97",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			calls := make([]atomic.Int32, tc.n)
+			err := ForEachParallel(tc.n, tc.workers, func(i int) error {
+				calls[i].Add(1)
+				if tc.failAt[i] {
+					return fmt.Errorf("failed %d", i)
+				}
+				return nil
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			for i := range calls {
+				if got := calls[i].Load(); got != 1 {
+					t.Errorf("f(%d) was called %d times, want exactly once", i, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package patch applies unified diffs, like those created by "diff -u" or "git
+// diff", without exec'ing the "patch" command, which isn't available
+// everywhere (e.g. on Windows).
+package patch
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common"
+)
+
+// noNewlineMarker follows a diff line that has no trailing newline.
+const noNewlineMarker = `\ No newline at end of file`
+
+var hunkHeaderRE = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// Patch is a parsed unified diff for a single file.
+type Patch struct {
+	// The "---" and "+++" lines, if any, including their trailing newlines.
+	Header string
+
+	Hunks []*Hunk
+}
+
+// Hunk is one "@@"-delimited section of a unified diff.
+type Hunk struct {
+	// The 1-based line numbers and line counts from the "@@" line.
+	OldStart, OldLines, NewStart, NewLines int
+
+	// The "@@" line itself, without its trailing newline.
+	header string
+
+	lines []hunkLine
+}
+
+// hunkLine is one line in the body of a hunk.
+type hunkLine struct {
+	// One of ' ', '-', or '+'.
+	op byte
+
+	// The contents of the line, including its trailing newline unless it was
+	// followed by a "\ No newline at end of file" marker.
+	text string
+}
+
+// Parse parses a unified diff that changes a single file.
+func Parse(diff string) (*Patch, error) {
+	out := &Patch{}
+	lines := common.SplitLines(diff)
+	var hunk *Hunk
+	for i, line := range lines {
+		switch {
+		case hunk == nil && (strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "+++ ")):
+			out.Header += line
+		case strings.HasPrefix(line, "@@"):
+			var err error
+			if hunk, err = parseHunkHeader(line); err != nil {
+				return nil, fmt.Errorf("line %d of patch: %w", i+1, err)
+			}
+			out.Hunks = append(out.Hunks, hunk)
+		case hunk == nil:
+			// Ignore anything before the first hunk, like "diff --git" lines.
+		case strings.HasPrefix(line, `\`):
+			if len(hunk.lines) == 0 {
+				return nil, fmt.Errorf("line %d of patch: %q doesn't follow a line", i+1, noNewlineMarker)
+			}
+			last := &hunk.lines[len(hunk.lines)-1]
+			last.text = strings.TrimSuffix(last.text, "\n")
+		case line == "\n":
+			// Some tools strip the trailing space from empty context lines.
+			hunk.lines = append(hunk.lines, hunkLine{op: ' ', text: "\n"})
+		case line[0] == ' ' || line[0] == '-' || line[0] == '+':
+			text := line[1:]
+			if !strings.HasSuffix(text, "\n") {
+				text += "\n"
+			}
+			hunk.lines = append(hunk.lines, hunkLine{op: line[0], text: text})
+		default:
+			return nil, fmt.Errorf("line %d of patch: unexpected line %q", i+1, strings.TrimSuffix(line, "\n"))
+		}
+	}
+
+	for _, h := range out.Hunks {
+		oldLines, newLines := h.sides(0, 0)
+		if len(oldLines) != h.OldLines || len(newLines) != h.NewLines {
+			return nil, fmt.Errorf("hunk %q has %d old and %d new lines, but its header says %d and %d",
+				h.header, len(oldLines), len(newLines), h.OldLines, h.NewLines)
+		}
+	}
+	return out, nil
+}
+
+func parseHunkHeader(line string) (*Hunk, error) {
+	m := hunkHeaderRE.FindStringSubmatch(line)
+	if m == nil {
+		return nil, fmt.Errorf("malformed hunk header %q", strings.TrimSuffix(line, "\n"))
+	}
+	nums := make([]int, 4)
+	for i, s := range m[1:] {
+		if s == "" {
+			nums[i] = 1 // a missing count means one line
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("malformed hunk header %q: %w", strings.TrimSuffix(line, "\n"), err)
+		}
+		nums[i] = n
+	}
+	return &Hunk{
+		OldStart: nums[0],
+		OldLines: nums[1],
+		NewStart: nums[2],
+		NewLines: nums[3],
+		header:   strings.TrimSuffix(line, "\n"),
+	}, nil
+}
+
+// String returns the hunk in unified diff format.
+func (h *Hunk) String() string {
+	var sb strings.Builder
+	sb.WriteString(h.header)
+	sb.WriteString("\n")
+	for _, l := range h.lines {
+		sb.WriteByte(l.op)
+		sb.WriteString(l.text)
+		if !strings.HasSuffix(l.text, "\n") {
+			sb.WriteString("\n" + noNewlineMarker + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// sides returns the lines that the hunk expects to find, and the lines that it
+// replaces them with, after dropping the given number of leading and trailing
+// context lines.
+func (h *Hunk) sides(dropLeading, dropTrailing int) (oldLines, newLines []string) {
+	for _, l := range h.lines[dropLeading : len(h.lines)-dropTrailing] {
+		if l.op != '+' {
+			oldLines = append(oldLines, l.text)
+		}
+		if l.op != '-' {
+			newLines = append(newLines, l.text)
+		}
+	}
+	return oldLines, newLines
+}
+
+// context returns the number of context lines at the beginning and end of the
+// hunk.
+func (h *Hunk) context() (leading, trailing int) {
+	for leading < len(h.lines) && h.lines[leading].op == ' ' {
+		leading++
+	}
+	for trailing < len(h.lines)-leading && h.lines[len(h.lines)-1-trailing].op == ' ' {
+		trailing++
+	}
+	return leading, trailing
+}
+
+// Result is the outcome of applying a patch.
+type Result struct {
+	// The patched contents. Rejected hunks are left unapplied.
+	Patched []byte
+
+	// The hunks that couldn't be applied, if any.
+	Rejected []*Hunk
+}
+
+// Rejects returns the rejected hunks in unified diff format, under the header
+// of the given patch, like the ".rej" file written by the "patch" command.
+// Returns empty string if there were no rejected hunks.
+func (r *Result) Rejects(p *Patch) string {
+	if len(r.Rejected) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString(p.Header)
+	for _, h := range r.Rejected {
+		sb.WriteString(h.String())
+	}
+	return sb.String()
+}
+
+// Apply applies the patch to the given contents.
+//
+// Like the "patch" command, a hunk that doesn't apply at the line numbers in
+// its header is looked for elsewhere in the file. If it isn't found, up to
+// "fuzz" context lines are ignored at its beginning and end, and it's looked
+// for again. Hunks that still can't be found are rejected.
+func Apply(contents []byte, p *Patch, fuzz int) *Result {
+	lines := common.SplitLines(string(contents))
+	var out []string
+	var rejected []*Hunk
+	copied := 0 // lines[:copied] have been handled
+	offset := 0 // how far the previous hunk was from where its header said
+	for _, h := range p.Hunks {
+		// For a hunk that only adds lines, the old start line is the line
+		// after which they're added.
+		start := h.OldStart - 1
+		if h.OldLines == 0 {
+			start = h.OldStart
+		}
+
+		at, oldLines, newLines, ok := locate(lines, copied, start+offset, h, fuzz)
+		if !ok {
+			rejected = append(rejected, h)
+			continue
+		}
+		out = append(out, lines[copied:at]...)
+		out = append(out, newLines...)
+		copied = at + len(oldLines)
+		offset = at - start
+	}
+	out = append(out, lines[copied:]...)
+
+	return &Result{
+		Patched:  []byte(strings.Join(out, "")),
+		Rejected: rejected,
+	}
+}
+
+// locate finds where the hunk applies in lines, at or after index from,
+// preferring locations close to the expected index. It returns the index of
+// the first line to replace, and the old and new lines of the hunk after
+// removing any context lines that were ignored due to fuzz.
+func locate(lines []string, from, expected int, h *Hunk, fuzz int) (_ int, oldLines, newLines []string, _ bool) {
+	leading, trailing := h.context()
+	for f := 0; f <= fuzz; f++ {
+		dropLeading, dropTrailing := min(f, leading), min(f, trailing)
+		if f > 0 && dropLeading == min(f-1, leading) && dropTrailing == min(f-1, trailing) {
+			break // more fuzz wouldn't drop any more context
+		}
+		oldLines, newLines = h.sides(dropLeading, dropTrailing)
+		want := expected + dropLeading
+		maxAt := len(lines) - len(oldLines)
+		if len(oldLines) == 0 {
+			// Lines are only being added, so they can go anywhere; put them
+			// as close as possible to where the header says.
+			return clamp(want, from, len(lines)), oldLines, newLines, true
+		}
+		for dist := 0; ; dist++ {
+			below, above := want-dist, want+dist
+			if below < from && above > maxAt {
+				break
+			}
+			if below >= from && below <= maxAt && matches(lines[below:], oldLines) {
+				return below, oldLines, newLines, true
+			}
+			if dist > 0 && above >= from && above <= maxAt && matches(lines[above:], oldLines) {
+				return above, oldLines, newLines, true
+			}
+		}
+	}
+	return 0, nil, nil, false
+}
+
+// matches returns whether lines begins with want.
+func matches(lines, want []string) bool {
+	if len(lines) < len(want) {
+		return false
+	}
+	for i, w := range want {
+		if lines[i] != w {
+			return false
+		}
+	}
+	return true
+}
+
+func clamp(n, lo, hi int) int {
+	return min(max(n, lo), hi)
+}
@@ -0,0 +1,226 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package patch
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestApply(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name        string
+		contents    string
+		patch       string
+		fuzz        int
+		want        string
+		wantRejects string
+	}{
+		{
+			name:     "clean",
+			contents: "red is my favorite color\n",
+			patch: `--- a/file.txt
++++ b/file.txt
+@@ -1 +1 @@
+-red is my favorite color
++purple is my favorite color
+`,
+			want: "purple is my favorite color\n",
+		},
+		{
+			name:     "multiple_hunks",
+			contents: "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n",
+			patch: `--- a/file.txt
++++ b/file.txt
+@@ -1,2 +1,2 @@
+-a
++A
+ b
+@@ -9,2 +9,3 @@
+ i
+-j
++J
++k
+`,
+			want: "A\nb\nc\nd\ne\nf\ng\nh\ni\nJ\nk\n",
+		},
+		{
+			name:     "offset",
+			contents: "new line\nnew line\na\nb\nc\n",
+			patch: `--- a/file.txt
++++ b/file.txt
+@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+`,
+			want: "new line\nnew line\na\nB\nc\n",
+		},
+		{
+			name:     "fuzz_ignores_changed_context",
+			contents: "x\nb\nc\n",
+			patch: `--- a/file.txt
++++ b/file.txt
+@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+`,
+			fuzz: 1,
+			want: "x\nB\nc\n",
+		},
+		{
+			name:     "no_fuzz_rejects_changed_context",
+			contents: "x\nb\nc\n",
+			patch: `--- a/file.txt
++++ b/file.txt
+@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+`,
+			want: "x\nb\nc\n",
+			wantRejects: `--- a/file.txt
++++ b/file.txt
+@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+`,
+		},
+		{
+			name:     "reject_one_of_two_hunks",
+			contents: "green is my favorite color\n\n\n\n\n\n\n\nthe end\n",
+			patch: `--- a/file.txt
++++ b/file.txt
+@@ -1 +1 @@
+-red is my favorite color
++purple is my favorite color
+@@ -9 +9 @@
+-the end
++THE END
+`,
+			fuzz: 999,
+			want: "green is my favorite color\n\n\n\n\n\n\n\nTHE END\n",
+			wantRejects: `--- a/file.txt
++++ b/file.txt
+@@ -1 +1 @@
+-red is my favorite color
++purple is my favorite color
+`,
+		},
+		{
+			name:     "no_newline_at_end",
+			contents: "a\nb",
+			patch: `--- a/file.txt
++++ b/file.txt
+@@ -1,2 +1,2 @@
+ a
+-b
+\ No newline at end of file
++c
+`,
+			want: "a\nc\n",
+		},
+		{
+			name:     "add_to_empty_file",
+			contents: "",
+			patch: `--- a/file.txt
++++ b/file.txt
+@@ -0,0 +1,2 @@
++hello
++world
+`,
+			want: "hello\nworld\n",
+		},
+		{
+			name:     "crlf_preserved",
+			contents: "a\r\nb\r\n",
+			patch:    "--- a/file.txt\n+++ b/file.txt\n@@ -1,2 +1,2 @@\n a\r\n-b\r\n+c\r\n",
+			want:     "a\r\nc\r\n",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := Parse(tc.patch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := Apply([]byte(tc.contents), p, tc.fuzz)
+			if diff := cmp.Diff(string(got.Patched), tc.want); diff != "" {
+				t.Errorf("patched contents were not as expected (-got,+want): %s", diff)
+			}
+			if diff := cmp.Diff(got.Rejects(p), tc.wantRejects); diff != "" {
+				t.Errorf("rejects were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		patch   string
+		wantErr string
+	}{
+		{
+			name:    "malformed_header",
+			patch:   "@@ -x +1 @@\n",
+			wantErr: "malformed hunk header",
+		},
+		{
+			name:    "wrong_line_count",
+			patch:   "@@ -1,2 +1 @@\n-a\n+b\n",
+			wantErr: "has 1 old and 1 new lines, but its header says 2 and 1",
+		},
+		{
+			name:    "unexpected_line",
+			patch:   "@@ -1 +1 @@\n-a\n*b\n",
+			wantErr: `line 3 of patch: unexpected line "*b"`,
+		},
+		{
+			name:    "dangling_no_newline_marker",
+			patch:   "@@ -0,0 +0,0 @@\n\\ No newline at end of file\n",
+			wantErr: "doesn't follow a line",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Parse(tc.patch)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
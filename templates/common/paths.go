@@ -27,6 +27,12 @@ const (
 	ABCInternalStdout = "stdout"
 )
 
+// ABCStagingDirPrefix is the prefix of the staging directories that render
+// creates under $dest/.abc while committing its output. A staging directory
+// left behind by an interrupted commit contains copies of manifests, which
+// must not be mistaken for real ones.
+const ABCStagingDirPrefix = "staging-"
+
 // IsReservedInDest returns true if the given path cannot be created in the
 // destination directory because that name is reserved for internal purposes.
 //
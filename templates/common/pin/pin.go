@@ -0,0 +1,185 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pin rewrites template manifests so that they're upgraded from the
+// exact template version that's installed, or from the upgrade channel they
+// had before that.
+package pin
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/internal/version"
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/indexutil"
+	"github.com/abcxyz/abc/templates/common/signing"
+	"github.com/abcxyz/abc/templates/model"
+	"github.com/abcxyz/abc/templates/model/decode"
+	"github.com/abcxyz/abc/templates/model/header"
+	manifestutil "github.com/abcxyz/abc/templates/model/manifest"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1beta7"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// Params contains the arguments to Pin and Unpin.
+type Params struct {
+	FS common.FS
+
+	// Location is a manifest file, or a directory to search recursively for
+	// manifests.
+	Location string
+
+	// UpgradeChannel is only used by Unpin, for manifests that don't record
+	// the upgrade channel that they had before they were pinned, such as
+	// manifests that were pinned by hand.
+	UpgradeChannel string
+
+	// DryRun reports what would change without writing anything.
+	DryRun bool
+}
+
+// Result describes what happened to one manifest.
+type Result struct {
+	// ManifestPath is the path of the manifest, starting with
+	// Params.Location.
+	ManifestPath string
+
+	// The upgrade channel before and after. They're the same if the manifest
+	// was skipped.
+	OldUpgradeChannel string
+	NewUpgradeChannel string
+
+	// Skipped is the reason that the manifest wasn't changed, or empty if it
+	// was.
+	Skipped string
+}
+
+// Pin sets the upgrade channel of each manifest to the exact template version
+// that's installed, like a tag or SHA, so that upgrades don't move it to a
+// newer version. The old upgrade channel is recorded in the manifest so that
+// Unpin can restore it.
+func Pin(ctx context.Context, p *Params) ([]*Result, error) {
+	return rewriteAll(ctx, p, func(m *manifest.Manifest, recordPinned bool) string {
+		switch {
+		case m.UpgradeChannel.Val == "":
+			return "it has no upgrade channel"
+		case m.TemplateVersion.Val == "":
+			return "it has no template version"
+		case m.UpgradeChannel.Val == m.TemplateVersion.Val:
+			return "it's already pinned"
+		}
+		// If a pinned manifest was upgraded to another version with --version,
+		// keep the channel from before the first pin rather than the old pin.
+		if recordPinned && m.PinnedUpgradeChannel.Val == "" {
+			m.PinnedUpgradeChannel = m.UpgradeChannel
+		}
+		m.UpgradeChannel = model.String{Val: m.TemplateVersion.Val}
+		return ""
+	})
+}
+
+// Unpin restores the upgrade channel that each manifest had before Pin. If
+// that wasn't recorded, Params.UpgradeChannel is used instead.
+func Unpin(ctx context.Context, p *Params) ([]*Result, error) {
+	return rewriteAll(ctx, p, func(m *manifest.Manifest, _ bool) string {
+		channel := common.FirstNonZero(m.PinnedUpgradeChannel.Val, p.UpgradeChannel)
+		switch {
+		case channel == "":
+			return `it wasn't pinned by "abc pin"; use --upgrade-channel to choose an upgrade channel`
+		case channel == m.UpgradeChannel.Val && m.PinnedUpgradeChannel.Val == "":
+			return "it's not pinned"
+		}
+		m.UpgradeChannel = model.String{Val: channel}
+		m.PinnedUpgradeChannel = model.String{}
+		return ""
+	})
+}
+
+// rewriteAll calls rewrite on each manifest under p.Location and writes back
+// the ones that it changed. rewrite returns the reason for skipping the
+// manifest, or empty string if it changed it. recordPinned is false if the
+// api_version that will be written doesn't have the pinned_upgrade_channel
+// field.
+func rewriteAll(ctx context.Context, p *Params, rewrite func(m *manifest.Manifest, recordPinned bool) string) ([]*Result, error) {
+	paths, err := indexutil.CrawlManifests(p.Location)
+	if err != nil {
+		return nil, fmt.Errorf("failed searching for manifests in %q: %w", p.Location, err)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no manifests were found in %q", p.Location)
+	}
+
+	apiVersion := decode.LatestSupportedAPIVersion(version.IsReleaseBuild())
+	recordPinned := decode.ModelIs(apiVersion, decode.KindManifest, &manifest.Manifest{})
+
+	out := make([]*Result, 0, len(paths))
+	for _, relPath := range paths {
+		path := filepath.Join(p.Location, relPath)
+		m, _, err := manifestutil.Load(ctx, p.FS, path)
+		if err != nil {
+			return out, err //nolint:wrapcheck
+		}
+
+		result := &Result{
+			ManifestPath:      path,
+			OldUpgradeChannel: m.UpgradeChannel.Val,
+		}
+		result.Skipped = rewrite(m, recordPinned)
+		result.NewUpgradeChannel = m.UpgradeChannel.Val
+		out = append(out, result)
+		if result.Skipped != "" || p.DryRun {
+			continue
+		}
+
+		if err := write(ctx, p.FS, path, apiVersion, m); err != nil {
+			return out, err
+		}
+	}
+	return out, nil
+}
+
+// write overwrites the manifest at path with m. Since the manifest's signature
+// won't match anymore, it's removed.
+func write(ctx context.Context, fs common.FS, path, apiVersion string, m *manifest.Manifest) error {
+	forMarshaling := manifest.ForMarshaling(*m)
+	buf, err := yaml.Marshal(&manifest.WithHeader{
+		Header: &header.Fields{
+			NewStyleAPIVersion: model.String{Val: apiVersion},
+			Kind:               model.String{Val: decode.KindManifest},
+		},
+		Wrapped: &forMarshaling,
+	})
+	if err != nil {
+		return fmt.Errorf("failed marshaling manifest: %w", err)
+	}
+	buf = append(common.DoNotModifyHeader, buf...)
+	if err := fs.WriteFile(path, buf, common.OwnerRWPerms); err != nil {
+		return fmt.Errorf("WriteFile(%q): %w", path, err)
+	}
+
+	removed, err := signing.RemoveSig(fs, path)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	if removed {
+		logger := logging.FromContext(ctx).With("logger", "pin")
+		logger.WarnContext(ctx, "removed the manifest's signature because it no longer matches the rewritten manifest",
+			"signature", path+signing.SigSuffix)
+	}
+	return nil
+}
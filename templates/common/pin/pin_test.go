@@ -0,0 +1,219 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pin
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/signing"
+	manifestutil "github.com/abcxyz/abc/templates/model/manifest"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func testManifest(version, channel, pinned string) string {
+	out := fmt.Sprintf(`api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Manifest'
+creation_time: '2024-06-25T11:00:00Z'
+modification_time: '2024-06-25T12:00:00Z'
+template_location: 'github.com/abcxyz/abc/t/rest_server'
+location_type: 'remote_git'
+template_version: '%s'
+upgrade_channel: '%s'
+template_dirhash: 'h1:abc'
+inputs: []
+output_files: []
+`, version, channel)
+	if pinned != "" {
+		out += fmt.Sprintf("pinned_upgrade_channel: '%s'\n", pinned)
+	}
+	return out
+}
+
+func TestPinAndUnpin(t *testing.T) {
+	t.Parallel()
+
+	const manifestPath = ".abc/manifest_rest_server.lock.yaml"
+
+	cases := []struct {
+		name           string
+		unpin          bool
+		manifest       string
+		upgradeChannel string
+		dryRun         bool
+		wantResult     *Result
+		wantChannel    string
+		wantPinned     string
+		wantErr        string
+	}{
+		{
+			name:        "pin_latest",
+			manifest:    testManifest("v1.2.3", "latest", ""),
+			wantResult:  &Result{OldUpgradeChannel: "latest", NewUpgradeChannel: "v1.2.3"},
+			wantChannel: "v1.2.3",
+			wantPinned:  "latest",
+		},
+		{
+			name:        "pin_branch_to_sha",
+			manifest:    testManifest("0123456789012345678901234567890123456789", "main", ""),
+			wantResult:  &Result{OldUpgradeChannel: "main", NewUpgradeChannel: "0123456789012345678901234567890123456789"},
+			wantChannel: "0123456789012345678901234567890123456789",
+			wantPinned:  "main",
+		},
+		{
+			name:        "pin_after_upgrade_keeps_original_channel",
+			manifest:    testManifest("v1.3.0", "v1.2.3", "latest"),
+			wantResult:  &Result{OldUpgradeChannel: "v1.2.3", NewUpgradeChannel: "v1.3.0"},
+			wantChannel: "v1.3.0",
+			wantPinned:  "latest",
+		},
+		{
+			name:        "pin_already_pinned",
+			manifest:    testManifest("v1.2.3", "v1.2.3", "latest"),
+			wantResult:  &Result{OldUpgradeChannel: "v1.2.3", NewUpgradeChannel: "v1.2.3", Skipped: "it's already pinned"},
+			wantChannel: "v1.2.3",
+			wantPinned:  "latest",
+		},
+		{
+			name:       "pin_no_upgrade_channel",
+			manifest:   testManifest("", "", ""),
+			wantResult: &Result{Skipped: "it has no upgrade channel"},
+		},
+		{
+			name:        "pin_dry_run",
+			manifest:    testManifest("v1.2.3", "latest", ""),
+			dryRun:      true,
+			wantResult:  &Result{OldUpgradeChannel: "latest", NewUpgradeChannel: "v1.2.3"},
+			wantChannel: "latest",
+		},
+		{
+			name:        "unpin",
+			unpin:       true,
+			manifest:    testManifest("v1.2.3", "v1.2.3", "latest"),
+			wantResult:  &Result{OldUpgradeChannel: "v1.2.3", NewUpgradeChannel: "latest"},
+			wantChannel: "latest",
+		},
+		{
+			name:           "unpin_prefers_recorded_channel",
+			unpin:          true,
+			manifest:       testManifest("v1.2.3", "v1.2.3", "latest"),
+			upgradeChannel: "main",
+			wantResult:     &Result{OldUpgradeChannel: "v1.2.3", NewUpgradeChannel: "latest"},
+			wantChannel:    "latest",
+		},
+		{
+			name:           "unpin_hand_pinned_to_flag",
+			unpin:          true,
+			manifest:       testManifest("v1.2.3", "v1.2.3", ""),
+			upgradeChannel: "main",
+			wantResult:     &Result{OldUpgradeChannel: "v1.2.3", NewUpgradeChannel: "main"},
+			wantChannel:    "main",
+		},
+		{
+			name:        "unpin_without_recorded_channel",
+			unpin:       true,
+			manifest:    testManifest("v1.2.3", "v1.2.3", ""),
+			wantResult:  &Result{OldUpgradeChannel: "v1.2.3", NewUpgradeChannel: "v1.2.3", Skipped: `it wasn't pinned by "abc pin"; use --upgrade-channel to choose an upgrade channel`},
+			wantChannel: "v1.2.3",
+		},
+		{
+			name:        "unpin_not_pinned",
+			unpin:       true,
+			manifest:    testManifest("v1.2.3", "latest", ""),
+			wantResult:  &Result{OldUpgradeChannel: "latest", NewUpgradeChannel: "latest", Skipped: `it wasn't pinned by "abc pin"; use --upgrade-channel to choose an upgrade channel`},
+			wantChannel: "latest",
+		},
+		{
+			name:           "unpin_not_pinned_to_same_channel",
+			unpin:          true,
+			manifest:       testManifest("v1.2.3", "latest", ""),
+			upgradeChannel: "latest",
+			wantResult:     &Result{OldUpgradeChannel: "latest", NewUpgradeChannel: "latest", Skipped: "it's not pinned"},
+			wantChannel:    "latest",
+		},
+		{
+			name:    "no_manifests",
+			wantErr: "no manifests were found",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			tempDir := t.TempDir()
+			if tc.manifest != "" {
+				abctestutil.WriteAll(t, tempDir, map[string]string{
+					manifestPath:                     tc.manifest,
+					manifestPath + signing.SigSuffix: "some signature",
+				})
+			}
+
+			fn := Pin
+			if tc.unpin {
+				fn = Unpin
+			}
+			fs := &common.RealFS{}
+			got, err := fn(ctx, &Params{
+				FS:             fs,
+				Location:       tempDir,
+				UpgradeChannel: tc.upgradeChannel,
+				DryRun:         tc.dryRun,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if tc.wantErr != "" {
+				return
+			}
+
+			path := filepath.Join(tempDir, manifestPath)
+			tc.wantResult.ManifestPath = path
+			if diff := cmp.Diff(got, []*Result{tc.wantResult}); diff != "" {
+				t.Errorf("results were not as expected (-got,+want): %s", diff)
+			}
+
+			m, _, err := manifestutil.Load(ctx, fs, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.UpgradeChannel.Val != tc.wantChannel {
+				t.Errorf("got upgrade_channel %q, want %q", m.UpgradeChannel.Val, tc.wantChannel)
+			}
+			if m.PinnedUpgradeChannel.Val != tc.wantPinned {
+				t.Errorf("got pinned_upgrade_channel %q, want %q", m.PinnedUpgradeChannel.Val, tc.wantPinned)
+			}
+
+			// The signature is removed if and only if the manifest changed.
+			changed := tc.wantResult.Skipped == "" && !tc.dryRun
+			sigExists, err := common.Exists(path + signing.SigSuffix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sigExists == changed {
+				t.Errorf("got signature exists=%t, but the manifest changed=%t", sigExists, changed)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package policyutil loads policy files and checks rendered output against
+// them, so that organizations can enforce rules on what every template writes.
+package policyutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/model/decode"
+	policy "github.com/abcxyz/abc/templates/model/policy/v1beta7"
+)
+
+// Load reads the policy file at the given path, validating it and upgrading it
+// to the newest policy model.
+func Load(ctx context.Context, fs common.FS, path string) (*policy.Policy, error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open policy file at %q: %w", path, err)
+	}
+	defer f.Close()
+
+	policyI, _, err := decode.DecodeValidateUpgrade(ctx, f, path, decode.KindPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("error reading policy file: %w", err)
+	}
+
+	out, ok := policyI.(*policy.Policy)
+	if !ok {
+		return nil, common.InternalErrorf("policy file did not decode to *policy.Policy")
+	}
+	return out, nil
+}
+
+// violation is a rule that one or more files broke.
+type violation struct {
+	policyFile string
+	rule       *policy.Rule
+	files      []string
+
+	// The first error from evaluating the rule, if any. A file whose
+	// evaluation fails counts as violating the rule.
+	celErr error
+}
+
+// Check evaluates every rule in the given policy files against every file
+// under dir, which holds rendered output that hasn't been written to its
+// destination yet. If any file breaks any rule, the returned error lists all
+// the violations and has the category CategoryPolicyViolation.
+func Check(ctx context.Context, fsys common.FS, policyFiles []string, dir string) error {
+	if len(policyFiles) == 0 {
+		return nil
+	}
+
+	policies := make([]*policy.Policy, 0, len(policyFiles))
+	for _, path := range policyFiles {
+		p, err := Load(ctx, fsys, path)
+		if err != nil {
+			return err
+		}
+		policies = append(policies, p)
+	}
+
+	var relPaths []string
+	if err := fs.WalkDir(fsys, dir, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if de.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return fmt.Errorf("filepath.Rel(%s,%s): %w", dir, path, err)
+		}
+		relPaths = append(relPaths, rel)
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed listing rendered files: %w", err)
+	}
+	sort.Strings(relPaths)
+
+	var candidates []*violation
+	for i, p := range policies {
+		for _, rule := range p.Rules {
+			candidates = append(candidates, &violation{policyFile: policyFiles[i], rule: rule})
+		}
+	}
+
+	for _, rel := range relPaths {
+		contents, err := fsys.ReadFile(filepath.Join(dir, rel))
+		if err != nil {
+			return fmt.Errorf("failed reading rendered file: %w", err)
+		}
+		slashPath := filepath.ToSlash(rel)
+		scope := common.NewScope(map[string]string{
+			"path":     slashPath,
+			"contents": string(contents),
+		}, nil)
+
+		for _, v := range candidates {
+			var ok bool
+			if err := common.CelCompileAndEval(ctx, scope, v.rule.Rule, &ok); err != nil {
+				if v.celErr == nil {
+					v.celErr = err
+				}
+			} else if ok {
+				continue
+			}
+			v.files = append(v.files, slashPath)
+		}
+	}
+
+	var violations []*violation
+	for _, v := range candidates {
+		if len(v.files) > 0 {
+			violations = append(violations, v)
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+	return common.WithCategory(common.CategoryPolicyViolation, errors.New(formatViolations(violations)))
+}
+
+func formatViolations(violations []*violation) string {
+	sb := &strings.Builder{}
+	noun := "rule"
+	if len(violations) > 1 {
+		noun = "rules"
+	}
+	fmt.Fprintf(sb, "the rendered output violated %d policy %s, so it wasn't written:\n", len(violations), noun)
+
+	tw := tabwriter.NewWriter(sb, 8, 0, 2, ' ', 0)
+	for _, v := range violations {
+		fmt.Fprintf(tw, "\nPolicy file:\t%s", v.policyFile)
+		fmt.Fprintf(tw, "\nRule:\t%s", v.rule.Rule.Val)
+		if v.rule.Message.Val != "" {
+			fmt.Fprintf(tw, "\nRule msg:\t%s", v.rule.Message.Val)
+		}
+		if v.celErr != nil {
+			fmt.Fprintf(tw, "\nCEL error:\t%s", v.celErr.Error())
+		}
+		fmt.Fprintf(tw, "\nFiles:\t%s", strings.Join(v.files, ", "))
+		fmt.Fprintf(tw, "\n") // Add vertical relief between violations
+	}
+	tw.Flush()
+	return sb.String()
+}
@@ -0,0 +1,148 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policyutil
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/abcxyz/abc/templates/common"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+const locationPolicy = `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Policy'
+rules:
+  - rule: 'path.startsWith("src/") || path.startsWith("infra/")'
+    message: 'Files may only be written under src/ and infra/'
+`
+
+const terraformPolicy = `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Policy'
+rules:
+  - rule: '!path.endsWith(".tf") || !contents.matches("source\\s*=\\s*\"[^\"]*\\?ref=main\"")'
+    message: 'Terraform module sources must be pinned to a tag or SHA'
+`
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name         string
+		policies     map[string]string
+		rendered     map[string]string
+		wantErr      string
+		wantExitCode int
+	}{
+		{
+			name:     "no_policies",
+			rendered: map[string]string{"anywhere.txt": "hi"},
+		},
+		{
+			name:     "all_files_comply",
+			policies: map[string]string{"location.yaml": locationPolicy, "terraform.yaml": terraformPolicy},
+			rendered: map[string]string{
+				"src/main.go":     "package main",
+				"infra/main.tf":   `module "x" { source = "git::https://example.com/x?ref=v1.2.3" }`,
+				"infra/README.md": "docs",
+			},
+		},
+		{
+			name:     "files_outside_allowed_dirs",
+			policies: map[string]string{"location.yaml": locationPolicy},
+			rendered: map[string]string{
+				"src/main.go": "package main",
+				"README.md":   "docs",
+				"tmp/a.txt":   "a",
+			},
+			wantErr: `the rendered output violated 1 policy rule, so it wasn't written:
+
+Policy file:  POLICY_DIR/location.yaml
+Rule:         path.startsWith("src/") || path.startsWith("infra/")
+Rule msg:     Files may only be written under src/ and infra/
+Files:        README.md, tmp/a.txt
+`,
+			wantExitCode: common.ExitCodePolicyViolation,
+		},
+		{
+			name:     "violations_of_several_policies",
+			policies: map[string]string{"location.yaml": locationPolicy, "terraform.yaml": terraformPolicy},
+			rendered: map[string]string{
+				"main.tf": `module "x" { source = "git::https://example.com/x?ref=main" }`,
+			},
+			wantErr:      "violated 2 policy rules",
+			wantExitCode: common.ExitCodePolicyViolation,
+		},
+		{
+			name: "cel_error",
+			policies: map[string]string{"bad.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Policy'
+rules:
+  - rule: 'nonexistent_var == "x"'
+`},
+			rendered:     map[string]string{"a.txt": "a"},
+			wantErr:      "CEL error:",
+			wantExitCode: common.ExitCodePolicyViolation,
+		},
+		{
+			name: "invalid_policy_file",
+			policies: map[string]string{"bad.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Policy'
+rules: []
+`},
+			rendered:     map[string]string{"a.txt": "a"},
+			wantErr:      `field "rules" is required`,
+			wantExitCode: common.ExitCodeGeneric,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			policyDir := filepath.Join(tempDir, "policies")
+			renderedDir := filepath.Join(tempDir, "rendered")
+			abctestutil.WriteAll(t, policyDir, tc.policies)
+			abctestutil.WriteAll(t, renderedDir, tc.rendered)
+
+			var policyFiles []string
+			for name := range tc.policies {
+				policyFiles = append(policyFiles, filepath.Join(policyDir, name))
+			}
+			// Sort so violations are listed in a predictable order.
+			sort.Strings(policyFiles)
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			err := Check(ctx, &common.RealFS{}, policyFiles, renderedDir)
+
+			wantErr := strings.ReplaceAll(tc.wantErr, "POLICY_DIR", policyDir)
+			if diff := testutil.DiffErrString(err, wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				if got := common.ExitCodeOf(err); got != tc.wantExitCode {
+					t.Errorf("got exit code %d, want %d", got, tc.wantExitCode)
+				}
+			}
+		})
+	}
+}
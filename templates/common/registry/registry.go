@@ -0,0 +1,176 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package registry reads the user's template registry file, which maps short
+// template aliases to full template locations. For example, with this registry
+// file:
+//
+//	aliases:
+//	  rest_server: github.com/abcxyz/abc/t/rest_server@latest
+//
+// the user can run "abc render rest_server" instead of typing the full
+// template location.
+package registry
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/config"
+)
+
+// EnvVar is the environment variable that overrides the location of the
+// registry file.
+const EnvVar = "ABC_REGISTRY_FILE"
+
+// Registry is the parsed contents of a registry file.
+type Registry struct {
+	// Aliases maps a short template name, like "rest_server", to a template
+	// location that's accepted by "abc render", like
+	// "github.com/abcxyz/abc/t/rest_server@latest".
+	Aliases map[string]string `yaml:"aliases"`
+}
+
+// DefaultPath returns the location of the registry file. This is the value of
+// $ABC_REGISTRY_FILE if set, otherwise ~/.abc/registry.yaml.
+func DefaultPath() (string, error) {
+	if p := os.Getenv(EnvVar); p != "" {
+		return p, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home dir: %w", err)
+	}
+	return filepath.Join(homeDir, ".abc", "registry.yaml"), nil
+}
+
+// LoadDefault loads the registry file from DefaultPath(), and adds the aliases
+// from the config files (see the config package). Aliases in the registry file
+// take precedence over those in config files.
+func LoadDefault() (*Registry, error) {
+	path, err := DefaultPath()
+	if err != nil {
+		return nil, err
+	}
+	r, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.LoadDefault()
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	if len(cfg.Aliases) > 0 {
+		aliases := maps.Clone(cfg.Aliases)
+		maps.Copy(aliases, r.Aliases)
+		r.Aliases = aliases
+	}
+	return r, nil
+}
+
+// Load reads the registry file at the given path. A nonexistent registry file
+// is not an error; it's treated the same as a registry with no aliases.
+func Load(path string) (*Registry, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		if common.IsNotExistErr(err) {
+			return &Registry{}, nil
+		}
+		return nil, fmt.Errorf("failed reading registry file: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(buf))
+	dec.KnownFields(true)
+	out := &Registry{}
+	if err := dec.Decode(out); err != nil {
+		if errors.Is(err, io.EOF) { // an empty file has no aliases
+			return out, nil
+		}
+		return nil, fmt.Errorf("failed parsing registry file %q: %w", path, err)
+	}
+	return out, nil
+}
+
+// Names returns the alias names in sorted order.
+func (r *Registry) Names() []string {
+	out := make([]string, 0, len(r.Aliases))
+	for name := range r.Aliases {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Resolve returns the template location for the given template source. If the
+// source is an alias in the registry, the aliased location is returned.
+// Otherwise the source is returned unchanged.
+//
+// A local directory takes precedence over an alias of the same name, so that
+// adding an alias never changes the meaning of a command that used to work.
+// Relative paths are resolved against cwd.
+func (r *Registry) Resolve(cwd, source string) string {
+	location, ok := r.Aliases[source]
+	if !ok {
+		return source
+	}
+	if localPathExists(cwd, source) {
+		return source
+	}
+	return location
+}
+
+// mayBeAlias returns false if the given template source is certainly not an
+// alias: a local path that exists, a URL, or a remote template location with
+// a version, like "github.com/foo/bar@v1.2.3".
+func mayBeAlias(cwd, source string) bool {
+	if strings.Contains(source, "://") || strings.Contains(source, "@") {
+		return false
+	}
+	return !localPathExists(cwd, source)
+}
+
+// localPathExists returns whether the given path exists. Relative paths are
+// resolved against cwd.
+func localPathExists(cwd, path string) bool {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(cwd, path)
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// ResolveSource is a convenience wrapper that loads the default registry file
+// and resolves the given source against it. The registry file is only loaded
+// if the source could be an alias, so that a malformed registry file doesn't
+// break commands that use a local directory or a remote template location.
+func ResolveSource(cwd, source string) (string, error) {
+	if !mayBeAlias(cwd, source) {
+		return source, nil
+	}
+	r, err := LoadDefault()
+	if err != nil {
+		return "", err
+	}
+	return r.Resolve(cwd, source), nil
+}
@@ -0,0 +1,194 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name      string
+		files     map[string]string
+		wantNames []string
+		wantErr   string
+	}{
+		{
+			name: "simple_success",
+			files: map[string]string{
+				"registry.yaml": `aliases:
+  rest_server: github.com/abcxyz/abc/t/rest_server@latest
+  react: github.com/abcxyz/abc/t/react_template@v0.5.0
+`,
+			},
+			wantNames: []string{"react", "rest_server"},
+		},
+		{
+			name:      "missing_file_is_empty",
+			files:     map[string]string{},
+			wantNames: []string{},
+		},
+		{
+			name: "empty_file_is_empty",
+			files: map[string]string{
+				"registry.yaml": "",
+			},
+			wantNames: []string{},
+		},
+		{
+			name: "unknown_field",
+			files: map[string]string{
+				"registry.yaml": "templates:\n  foo: bar\n",
+			},
+			wantErr: "failed parsing registry file",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			abctestutil.WriteAll(t, dir, tc.files)
+
+			reg, err := Load(filepath.Join(dir, "registry.yaml"))
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(reg.Names(), tc.wantNames); diff != "" {
+				t.Errorf("names were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	t.Parallel()
+
+	reg := &Registry{
+		Aliases: map[string]string{
+			"rest_server": "github.com/abcxyz/abc/t/rest_server@latest",
+			"mydir":       "github.com/abcxyz/abc/t/mydir@latest",
+		},
+	}
+
+	cases := []struct {
+		name   string
+		source string
+		files  map[string]string
+		want   string
+	}{
+		{
+			name:   "alias",
+			source: "rest_server",
+			want:   "github.com/abcxyz/abc/t/rest_server@latest",
+		},
+		{
+			name:   "not_an_alias",
+			source: "github.com/foo/bar@v1.2.3",
+			want:   "github.com/foo/bar@v1.2.3",
+		},
+		{
+			name:   "local_dir_shadows_alias",
+			source: "mydir",
+			files: map[string]string{
+				"mydir/spec.yaml": "",
+			},
+			want: "mydir",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			cwd := t.TempDir()
+			abctestutil.WriteAll(t, cwd, tc.files)
+
+			if got := reg.Resolve(cwd, tc.source); got != tc.want {
+				t.Errorf("Resolve(%q) got %q, want %q", tc.source, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestResolveSourceMalformedRegistry(t *testing.T) {
+	// Not parallel, because it sets an environment variable.
+
+	tempDir := t.TempDir()
+	abctestutil.WriteAll(t, tempDir, map[string]string{
+		"registry.yaml":        "aliases: [this is not a map",
+		"mytemplate/spec.yaml": "",
+	})
+	t.Setenv(EnvVar, filepath.Join(tempDir, "registry.yaml"))
+
+	cases := []struct {
+		name    string
+		source  string
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "local_dir",
+			source: "mytemplate",
+			want:   "mytemplate",
+		},
+		{
+			name:   "absolute_local_dir",
+			source: filepath.Join(tempDir, "mytemplate"),
+			want:   filepath.Join(tempDir, "mytemplate"),
+		},
+		{
+			name:   "remote_location",
+			source: "github.com/abcxyz/abc/t/rest_server@latest",
+			want:   "github.com/abcxyz/abc/t/rest_server@latest",
+		},
+		{
+			name:   "url",
+			source: "https://github.com/abcxyz/abc.git",
+			want:   "https://github.com/abcxyz/abc.git",
+		},
+		{
+			name:    "possible_alias",
+			source:  "rest_server",
+			wantErr: "failed parsing registry file",
+		},
+	}
+
+	for _, tc := range cases {
+		got, err := ResolveSource(tempDir, tc.source)
+		if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+			t.Errorf("%s: %s", tc.name, diff)
+		}
+		if got != tc.want {
+			t.Errorf("%s: ResolveSource(%q) got %q, want %q", tc.name, tc.source, got, tc.want)
+		}
+	}
+}
@@ -33,6 +33,11 @@ import (
 // to be written.
 type walkAndModifyVisitor func([]byte) ([]byte, error)
 
+// Like walkAndModifyVisitor, but also called with the file's path relative to
+// the scratch directory, using forward slashes, for actions whose changes
+// depend on the kind of file.
+type walkAndModifyPathVisitor func(relPath string, buf []byte) ([]byte, error)
+
 // For each given path, recursively traverses the directory or file
 // scratchDir/relPath, calling the given visitor for each file. If relPath is a
 // single file, then the visitor will be called for just that one file. If
@@ -40,9 +45,44 @@ type walkAndModifyVisitor func([]byte) ([]byte, error)
 // that directory, recursively. A file will only be visited once per call, even
 // if multiple paths include it.
 //
+// Files are visited concurrently by a bounded pool of workers, so the visitor
+// must be safe for concurrent use. If multiple files fail, all their errors are
+// returned, in the order that the files were found.
+//
 // rawPaths is a list of path strings that will be processed (processPaths,
 // processGlobs) before walking through.
+//
+// The visitor receives the whole file in memory. For actions that can work on
+// a stream, use walkAndModifyStreaming instead so that large files don't have
+// to fit in memory.
 func walkAndModify(ctx context.Context, sp *stepParams, rawPaths []model.String, v walkAndModifyVisitor) error {
+	return walkAndModifyStreaming(ctx, sp, rawPaths, v, nil)
+}
+
+// walkAndModifyStreaming is like walkAndModify, but files that are at least
+// sp.streamThreshold() bytes are processed by the streamer rather than being
+// read into memory and passed to the visitor. The streamer and visitor must
+// make the same changes. The streamer may be nil, in which case this is the
+// same as walkAndModify.
+func walkAndModifyStreaming(ctx context.Context, sp *stepParams, rawPaths []model.String, v walkAndModifyVisitor, s walkAndModifyStreamer) error {
+	return walkAndModifyExcept(ctx, sp, rawPaths, nil, v, s)
+}
+
+// Called with a file's path relative to the scratch directory, using forward
+// slashes. Returns true if the file should be left untouched.
+type walkAndModifySkipper func(relPath string) (bool, error)
+
+// walkAndModifyExcept is like walkAndModifyStreaming, but files for which the
+// skipper returns true are not visited. The skipper may be nil.
+func walkAndModifyExcept(ctx context.Context, sp *stepParams, rawPaths []model.String, skip walkAndModifySkipper, v walkAndModifyVisitor, s walkAndModifyStreamer) error {
+	return walkAndModifyPaths(ctx, sp, rawPaths, skip, func(_ string, buf []byte) ([]byte, error) {
+		return v(buf)
+	}, s)
+}
+
+// walkAndModifyPaths is like walkAndModifyExcept, but the visitor is also
+// given the path of each file.
+func walkAndModifyPaths(ctx context.Context, sp *stepParams, rawPaths []model.String, skip walkAndModifySkipper, v walkAndModifyPathVisitor, s walkAndModifyStreamer) error {
 	logger := logging.FromContext(ctx).With("logger", "walkAndModify")
 	seen := map[string]struct{}{}
 
@@ -50,7 +90,7 @@ func walkAndModify(ctx context.Context, sp *stepParams, rawPaths []model.String,
 	if err != nil {
 		return err
 	}
-	globbedPaths, err := processGlobs(ctx, paths, sp.scratchDir, sp.features.SkipGlobs)
+	globbedPaths, err := processGlobs(ctx, sp.rp.FS, paths, sp.scratchDir, sp.features.SkipGlobs)
 	if err != nil {
 		return err
 	}
@@ -62,12 +102,35 @@ func walkAndModify(ctx context.Context, sp *stepParams, rawPaths []model.String,
 		return fmt.Errorf("no paths were matched by: %v", pathStrings)
 	}
 
+	// First, find all the files to visit, in walk order. Then visit them in
+	// parallel; each file is independent of the others.
+	type fileToVisit struct {
+		path string
+		pos  *model.ConfigPos
+	}
+	var files []fileToVisit
+	ig := sp.ignorer()
 	for _, absPath := range globbedPaths {
-		err := filepath.WalkDir(absPath.Val, func(path string, d fs.DirEntry, err error) error {
+		err := fs.WalkDir(sp.rp.FS, absPath.Val, func(path string, d fs.DirEntry, err error) error {
 			if err != nil {
 				// There was some filesystem error. Give up.
 				return absPath.Pos.Errorf("%w", err)
 			}
+			if ig.appliesToScratch() {
+				rel, err := filepath.Rel(sp.scratchDir, path)
+				if err != nil {
+					return fmt.Errorf("filepath.Rel(%s,%s): %w", sp.scratchDir, path, err)
+				}
+				if ignored, err := ig.ignored(rel, d.IsDir()); err != nil {
+					return err
+				} else if ignored {
+					logger.DebugContext(ctx, "skipping ignored path", "path", rel)
+					if d.IsDir() {
+						return fs.SkipDir
+					}
+					return nil
+				}
+			}
 			if d.IsDir() {
 				return nil
 			}
@@ -77,44 +140,86 @@ func walkAndModify(ctx context.Context, sp *stepParams, rawPaths []model.String,
 				logger.DebugContext(ctx, "skipping file as already seen", "path", path)
 				return nil
 			}
-			oldBuf, err := sp.rp.FS.ReadFile(path)
-			if err != nil {
-				return absPath.Pos.Errorf("Readfile(): %w", err)
-			}
-
-			relToScratchDir, err := filepath.Rel(sp.scratchDir, path)
-			if err != nil {
-				return absPath.Pos.Errorf("Rel(): %w", err)
-			}
-
-			// We must clone oldBuf to guarantee that the callee won't change the
-			// underlying bytes. We rely on an unmodified oldBuf below in the call
-			// to bytes.Equal.
-			newBuf, err := v(bytes.Clone(oldBuf))
-			if err != nil {
-				return fmt.Errorf("when processing template file %q: %w", relToScratchDir, err)
-			}
-
 			seen[path] = struct{}{}
-
-			if bytes.Equal(oldBuf, newBuf) {
-				// If file contents are unchanged, there's no need to write.
-				return nil
-			}
-
-			// The permissions in the following WriteFile call will be ignored
-			// because the file already exists.
-			if err := sp.rp.FS.WriteFile(path, newBuf, common.OwnerRWXPerms); err != nil {
-				return absPath.Pos.Errorf("Writefile(): %w", err)
+			if skip != nil {
+				rel, err := filepath.Rel(sp.scratchDir, path)
+				if err != nil {
+					return fmt.Errorf("filepath.Rel(%s,%s): %w", sp.scratchDir, path, err)
+				}
+				if skipped, err := skip(filepath.ToSlash(rel)); err != nil {
+					return err
+				} else if skipped {
+					logger.DebugContext(ctx, "skipping file as requested by the action", "path", rel)
+					return nil
+				}
 			}
-			logger.DebugContext(ctx, "wrote modification", "path", path)
-
+			files = append(files, fileToVisit{path: path, pos: absPath.Pos})
 			return nil
 		})
 		if err != nil {
 			return err //nolint:wrapcheck
 		}
 	}
+
+	return common.ForEachParallel(len(files), 0, func(i int) error { //nolint:wrapcheck
+		return modifyFile(ctx, sp, files[i].path, files[i].pos, v, s)
+	})
+}
+
+// modifyFile calls the visitor on the contents of a single file and writes back
+// the result if it changed. It may be called concurrently for different files.
+// If the streamer is non-nil and the file is large, the streamer is used
+// instead of the visitor.
+func modifyFile(ctx context.Context, sp *stepParams, path string, pos *model.ConfigPos, v walkAndModifyPathVisitor, s walkAndModifyStreamer) error {
+	logger := logging.FromContext(ctx).With("logger", "modifyFile")
+
+	// Stop promptly if the render was canceled or the step timed out, rather
+	// than after every file has been visited.
+	if err := ctx.Err(); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if s != nil {
+		fi, err := sp.rp.FS.Stat(path)
+		if err != nil {
+			return pos.Errorf("Stat(): %w", err)
+		}
+		if fi.Size() >= sp.streamThreshold() {
+			logger.DebugContext(ctx, "streaming large file", "path", path, "size", fi.Size())
+			return streamFile(ctx, sp, path, pos, s)
+		}
+	}
+
+	oldBuf, err := sp.rp.FS.ReadFile(path)
+	if err != nil {
+		return pos.Errorf("Readfile(): %w", err)
+	}
+
+	relToScratchDir, err := filepath.Rel(sp.scratchDir, path)
+	if err != nil {
+		return pos.Errorf("Rel(): %w", err)
+	}
+
+	// We must clone oldBuf to guarantee that the callee won't change the
+	// underlying bytes. We rely on an unmodified oldBuf below in the call
+	// to bytes.Equal.
+	newBuf, err := v(filepath.ToSlash(relToScratchDir), bytes.Clone(oldBuf))
+	if err != nil {
+		return fmt.Errorf("when processing template file %q: %w", relToScratchDir, err)
+	}
+
+	if bytes.Equal(oldBuf, newBuf) {
+		// If file contents are unchanged, there's no need to write.
+		return nil
+	}
+
+	// The permissions in the following WriteFile call will be ignored
+	// because the file already exists.
+	if err := sp.rp.FS.WriteFile(path, newBuf, common.OwnerRWXPerms); err != nil {
+		return pos.Errorf("Writefile(): %w", err)
+	}
+	logger.DebugContext(ctx, "wrote modification", "path", path)
+
 	return nil
 }
 
@@ -148,7 +253,7 @@ func templateAndCompileRegexes(regexes []model.String, scope *common.Scope) ([]*
 //
 // When processPaths and processGlobs are both used, processPaths should be
 // called first.
-func processGlobs(ctx context.Context, paths []model.String, fromDir string, skipGlobs bool) ([]model.String, error) {
+func processGlobs(ctx context.Context, rfs common.FS, paths []model.String, fromDir string, skipGlobs bool) ([]model.String, error) {
 	logger := logging.FromContext(ctx).With("logger", "processGlobs")
 	seenPaths := map[string]struct{}{}
 	out := make([]model.String, 0, len(paths))
@@ -161,7 +266,7 @@ func processGlobs(ctx context.Context, paths []model.String, fromDir string, ski
 				continue
 			}
 			seenPaths[absPath] = struct{}{}
-			exists, err := common.Exists(absPath)
+			exists, err := common.ExistsFS(rfs, absPath)
 			if err != nil {
 				return nil, err //nolint:wrapcheck
 			}
@@ -174,7 +279,7 @@ func processGlobs(ctx context.Context, paths []model.String, fromDir string, ski
 			})
 			continue
 		}
-		globPaths, err := filepath.Glob(filepath.Join(fromDir, p.Val))
+		globPaths, err := common.Glob(rfs, filepath.Join(fromDir, p.Val))
 		if err != nil {
 			return nil, p.Pos.Errorf("file globbing error: %w", err)
 		}
@@ -16,10 +16,12 @@ package render
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"strings"
 
 	"github.com/abcxyz/abc/templates/common/render/gotmpl"
-	spec "github.com/abcxyz/abc/templates/model/spec/v1beta6"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
 )
 
 func actionAppend(ctx context.Context, ap *spec.Append, sp *stepParams) error {
@@ -34,8 +36,16 @@ func actionAppend(ctx context.Context, ap *spec.Append, sp *stepParams) error {
 		}
 	}
 
-	if err := walkAndModify(ctx, sp, ap.Paths, func(buf []byte) ([]byte, error) {
+	if err := walkAndModifyStreaming(ctx, sp, ap.Paths, func(buf []byte) ([]byte, error) {
 		return append(buf, []byte(with)...), nil
+	}, func(r io.Reader, w io.Writer) (bool, error) {
+		if _, err := io.Copy(w, r); err != nil {
+			return false, fmt.Errorf("Copy(): %w", err)
+		}
+		if _, err := io.WriteString(w, with); err != nil {
+			return false, fmt.Errorf("WriteString(): %w", err)
+		}
+		return with != "", nil
 	}); err != nil {
 		return err
 	}
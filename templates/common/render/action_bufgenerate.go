@@ -0,0 +1,232 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/render/gotmpl"
+	"github.com/abcxyz/abc/templates/common/run"
+	"github.com/abcxyz/abc/templates/model"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
+)
+
+const (
+	// The name of the buf CLI executable, which is looked up in $PATH.
+	bufCommand = "buf"
+
+	// How long buf may run before it's killed. Code generation with remote
+	// plugins can be slow, so this is longer than run.DefaultRunTimeout.
+	bufTimeout = 5 * time.Minute
+
+	// The generation template that buf uses if --template isn't given.
+	defaultBufGenTemplate = "buf.gen.yaml"
+)
+
+// actionBufGenerate runs "buf generate" in the scratch directory, so the
+// generated code becomes part of the template output. buf is the host's
+// binary, not sandboxed like a wasm module, so before running it the template's
+// buf.gen.yaml is checked: it may only use remote plugins, which run on the
+// Buf Schema Registry rather than on this machine, and its outputs and inputs
+// must be inside the scratch directory. Because buf still runs natively and
+// uses the network, the action also requires Params.AllowBufGenerate.
+func actionBufGenerate(ctx context.Context, b *spec.BufGenerate, sp *stepParams) error {
+	if common.IsInMemory(sp.rp.FS) {
+		return b.Pos.Errorf("the buf_generate action can't be used when rendering to memory, because buf needs the files on the local disk")
+	}
+	if !sp.rp.AllowBufGenerate {
+		return b.Pos.Errorf("the buf_generate action runs the buf CLI outside of abc's sandbox, which lets the template run any program on this machine; if you trust this template, rerun with --allow-buf-generate")
+	}
+
+	command := bufCommand
+	if sp.bufCommand != "" {
+		command = sp.bufCommand
+	}
+	bufPath, err := exec.LookPath(command)
+	if err != nil {
+		return b.Pos.Errorf("the buf_generate action requires the buf CLI, but it wasn't found (see https://buf.build/docs/installation): %w", err)
+	}
+
+	input, err := bufRelPath(b.Input, sp)
+	if err != nil {
+		return err
+	}
+	args := []string{bufPath, "generate", input}
+	template := defaultBufGenTemplate
+	if b.Template.Val != "" {
+		if template, err = bufRelPath(b.Template, sp); err != nil {
+			return err
+		}
+		args = append(args, "--template", template)
+	}
+	if b.Output.Val != "" {
+		output, err := bufRelPath(b.Output, sp)
+		if err != nil {
+			return err
+		}
+		args = append(args, "--output", output)
+	}
+	for _, p := range b.Paths {
+		rel, err := bufRelPath(p, sp)
+		if err != nil {
+			return err
+		}
+		args = append(args, "--path", rel)
+	}
+
+	if err := checkBufGenTemplate(sp.rp.FS, sp.scratchDir, template); err != nil {
+		return b.Pos.Errorf("%w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, bufTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	if _, err := run.Run(ctx, []*run.Option{
+		run.WithCwd(sp.scratchDir),
+		run.WithStdout(&stdout),
+		run.WithStderr(&stderr),
+	}, args...); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return b.Pos.Errorf("buf generate didn't finish within %s", bufTimeout)
+		}
+		return b.Pos.Errorf("buf generate failed: %w", err)
+	}
+	return nil
+}
+
+// bufRelPath templates a path param of the buf_generate action, and checks
+// that it's inside the scratch directory. The result is relative to the
+// scratch directory, or "." if the param is empty.
+func bufRelPath(p model.String, sp *stepParams) (string, error) {
+	templated, err := gotmpl.ParseExec(p.Pos, p.Val, sp.scope)
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+	if templated == "" {
+		return ".", nil
+	}
+	if filepath.IsAbs(templated) {
+		return "", p.Pos.Errorf("path %q must be relative to the scratch directory", templated)
+	}
+	rel, err := common.SafeRelPath(p.Pos, templated)
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+	return filepath.Clean(rel), nil
+}
+
+// bufGenTemplate is the part of a buf.gen.yaml file that checkBufGenTemplate
+// looks at. Fields are kept as maps since the allowed keys differ between
+// versions v1 and v2 of the file.
+type bufGenTemplate struct {
+	Plugins []map[string]any `yaml:"plugins"`
+	Inputs  []map[string]any `yaml:"inputs"`
+}
+
+// checkBufGenTemplate checks that the buf.gen.yaml at rel in the scratch
+// directory can't make buf run a program on this machine, or write or read
+// outside of the scratch directory. Only remote plugins are allowed, every
+// plugin's "out" must be inside the scratch directory, and inputs must be
+// remote modules or paths inside the scratch directory.
+func checkBufGenTemplate(fs common.FS, scratchDir, rel string) error {
+	buf, err := fs.ReadFile(filepath.Join(scratchDir, rel))
+	if err != nil {
+		return fmt.Errorf("failed reading buf generation template %q from the scratch directory: %w", rel, err)
+	}
+	cfg := &bufGenTemplate{}
+	if err := yaml.Unmarshal(buf, cfg); err != nil {
+		return fmt.Errorf("failed parsing buf generation template %q: %w", rel, err)
+	}
+
+	for i, p := range cfg.Plugins {
+		for _, key := range []string{"local", "name", "path", "protoc_builtin", "protoc_path"} {
+			if _, ok := p[key]; ok {
+				return fmt.Errorf("plugin %d in %q uses %q, which would run a program on this machine; only remote plugins, like buf.build/protocolbuffers/go, are allowed", i+1, rel, key)
+			}
+		}
+		// "remote" is used by v2 of buf.gen.yaml, and "plugin" by v1.
+		ref, ok := p["remote"].(string)
+		if !ok {
+			ref, _ = p["plugin"].(string)
+		}
+		if !isRemoteBufPlugin(ref) {
+			return fmt.Errorf("plugin %d in %q must be a remote plugin, like buf.build/protocolbuffers/go, but got %q", i+1, rel, ref)
+		}
+		out, _ := p["out"].(string)
+		if err := checkBufGenPath(out); err != nil {
+			return fmt.Errorf("plugin %d in %q has an invalid \"out\": %w", i+1, rel, err)
+		}
+	}
+
+	for i, in := range cfg.Inputs {
+		if _, ok := in["module"]; ok {
+			continue
+		}
+		p, ok := in["directory"].(string)
+		if !ok {
+			p, ok = in["proto_file"].(string)
+		}
+		if !ok {
+			return fmt.Errorf("input %d in %q must be a directory, proto_file, or module; other kinds of inputs aren't allowed", i+1, rel)
+		}
+		if err := checkBufGenPath(p); err != nil {
+			return fmt.Errorf("input %d in %q is invalid: %w", i+1, rel, err)
+		}
+	}
+	return nil
+}
+
+// isRemoteBufPlugin returns whether ref names a remote plugin, which has the
+// form host/owner/name, optionally followed by ":version".
+func isRemoteBufPlugin(ref string) bool {
+	parts := strings.Split(ref, "/")
+	if len(parts) != 3 || !strings.Contains(parts[0], ".") {
+		return false
+	}
+	for _, part := range parts {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// checkBufGenPath checks that a path from buf.gen.yaml is relative and doesn't
+// leave the directory it's relative to.
+func checkBufGenPath(p string) error {
+	if p == "" {
+		return fmt.Errorf("it must not be empty")
+	}
+	if filepath.IsAbs(p) || strings.HasPrefix(p, "/") {
+		return fmt.Errorf("path %q must be relative to the scratch directory", p)
+	}
+	for _, elem := range strings.Split(filepath.ToSlash(p), "/") {
+		if elem == ".." {
+			return fmt.Errorf("path %q must not contain \"..\"", p)
+		}
+	}
+	return nil
+}
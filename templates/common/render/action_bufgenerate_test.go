@@ -0,0 +1,329 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/abc/templates/model"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	mdl "github.com/abcxyz/abc/templates/testutil/model"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+// fakeBuf is a shell script that stands in for the buf CLI. It writes its
+// arguments to a file in the scratch directory, like generated code.
+const fakeBuf = `#!/bin/sh
+if [ "$1" != "generate" ]; then
+  echo "unexpected command $1" >&2
+  exit 1
+fi
+if [ -f fail.txt ]; then
+  echo "a plugin failed" >&2
+  exit 1
+fi
+mkdir -p gen
+echo "$@" > gen/args.txt
+`
+
+// remoteBufGen is a buf.gen.yaml that only uses remote plugins.
+const remoteBufGen = `version: v2
+plugins:
+  - remote: buf.build/protocolbuffers/go
+    out: gen
+inputs:
+  - directory: proto
+  - module: buf.build/googleapis/googleapis
+`
+
+func TestActionBufGenerate(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake buf is a shell script")
+	}
+
+	cases := []struct {
+		name            string
+		bufGenerate     *spec.BufGenerate
+		inputs          map[string]string
+		initialContents map[string]string
+		missingBuf      bool
+		memFS           bool
+		notAllowed      bool
+
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name:        "defaults",
+			bufGenerate: &spec.BufGenerate{},
+			initialContents: map[string]string{
+				"api.proto":    "syntax = \"proto3\";",
+				"buf.gen.yaml": remoteBufGen,
+			},
+			want: map[string]string{
+				"api.proto":    "syntax = \"proto3\";",
+				"buf.gen.yaml": remoteBufGen,
+				"gen/args.txt": "generate .\n",
+			},
+		},
+		{
+			name:        "v1_remote_plugin",
+			bufGenerate: &spec.BufGenerate{},
+			initialContents: map[string]string{
+				"buf.gen.yaml": "version: v1\nplugins:\n  - plugin: buf.build/connectrpc/go:v1.14.0\n    out: gen/go\n",
+			},
+			want: map[string]string{
+				"buf.gen.yaml": "version: v1\nplugins:\n  - plugin: buf.build/connectrpc/go:v1.14.0\n    out: gen/go\n",
+				"gen/args.txt": "generate .\n",
+			},
+		},
+		{
+			name:        "local_plugin",
+			bufGenerate: &spec.BufGenerate{},
+			initialContents: map[string]string{
+				"buf.gen.yaml": "version: v2\nplugins:\n  - local: ./evil\n    out: gen\n",
+			},
+			want: map[string]string{
+				"buf.gen.yaml": "version: v2\nplugins:\n  - local: ./evil\n    out: gen\n",
+			},
+			wantErr: `plugin 1 in "buf.gen.yaml" uses "local", which would run a program on this machine`,
+		},
+		{
+			name:        "v1_local_plugin",
+			bufGenerate: &spec.BufGenerate{},
+			initialContents: map[string]string{
+				"buf.gen.yaml": "version: v1\nplugins:\n  - plugin: go\n    out: gen\n",
+			},
+			want: map[string]string{
+				"buf.gen.yaml": "version: v1\nplugins:\n  - plugin: go\n    out: gen\n",
+			},
+			wantErr: `plugin 1 in "buf.gen.yaml" must be a remote plugin`,
+		},
+		{
+			name:        "out_outside_scratch_dir",
+			bufGenerate: &spec.BufGenerate{},
+			initialContents: map[string]string{
+				"buf.gen.yaml": "version: v2\nplugins:\n  - remote: buf.build/protocolbuffers/go\n    out: ../../home\n",
+			},
+			want: map[string]string{
+				"buf.gen.yaml": "version: v2\nplugins:\n  - remote: buf.build/protocolbuffers/go\n    out: ../../home\n",
+			},
+			wantErr: `must not contain ".."`,
+		},
+		{
+			name:        "absolute_out",
+			bufGenerate: &spec.BufGenerate{},
+			initialContents: map[string]string{
+				"buf.gen.yaml": "version: v2\nplugins:\n  - remote: buf.build/protocolbuffers/go\n    out: /tmp/gen\n",
+			},
+			want: map[string]string{
+				"buf.gen.yaml": "version: v2\nplugins:\n  - remote: buf.build/protocolbuffers/go\n    out: /tmp/gen\n",
+			},
+			wantErr: `path "/tmp/gen" must be relative to the scratch directory`,
+		},
+		{
+			name:        "input_outside_scratch_dir",
+			bufGenerate: &spec.BufGenerate{},
+			initialContents: map[string]string{
+				"buf.gen.yaml": "version: v2\ninputs:\n  - directory: ../secrets\n",
+			},
+			want: map[string]string{
+				"buf.gen.yaml": "version: v2\ninputs:\n  - directory: ../secrets\n",
+			},
+			wantErr: `input 1 in "buf.gen.yaml" is invalid`,
+		},
+		{
+			name:        "git_repo_input",
+			bufGenerate: &spec.BufGenerate{},
+			initialContents: map[string]string{
+				"buf.gen.yaml": "version: v2\ninputs:\n  - git_repo: file:///home/me/repo\n",
+			},
+			want: map[string]string{
+				"buf.gen.yaml": "version: v2\ninputs:\n  - git_repo: file:///home/me/repo\n",
+			},
+			wantErr: "must be a directory, proto_file, or module",
+		},
+		{
+			name:        "missing_buf_gen_yaml",
+			bufGenerate: &spec.BufGenerate{},
+			wantErr:     `failed reading buf generation template "buf.gen.yaml"`,
+		},
+		{
+			name: "all_params_templated",
+			bufGenerate: &spec.BufGenerate{
+				Input:    mdl.S("proto"),
+				Template: mdl.S("buf.gen.{{.lang}}.yaml"),
+				Output:   mdl.S("{{.out}}/"),
+				Paths:    mdl.Strings("proto/a.proto", "proto/b"),
+			},
+			inputs: map[string]string{"lang": "go", "out": "internal"},
+			initialContents: map[string]string{
+				"proto/a.proto":   "",
+				"buf.gen.go.yaml": "version: v2",
+			},
+			want: map[string]string{
+				"proto/a.proto":   "",
+				"buf.gen.go.yaml": "version: v2",
+				"gen/args.txt":    "generate proto --template buf.gen.go.yaml --output internal --path proto/a.proto --path proto/b\n",
+			},
+		},
+		{
+			name: "path_outside_scratch_dir",
+			bufGenerate: &spec.BufGenerate{
+				Output: mdl.S("../elsewhere"),
+			},
+			wantErr: `must not contain ".."`,
+		},
+		{
+			name: "absolute_path",
+			bufGenerate: &spec.BufGenerate{
+				Input: mdl.S("/etc"),
+			},
+			wantErr: `path "/etc" must be relative to the scratch directory`,
+		},
+		{
+			name:            "buf_fails",
+			bufGenerate:     &spec.BufGenerate{},
+			initialContents: map[string]string{"buf.gen.yaml": remoteBufGen, "fail.txt": ""},
+			want:            map[string]string{"buf.gen.yaml": remoteBufGen, "fail.txt": ""},
+			wantErr:         "a plugin failed",
+		},
+		{
+			name:        "buf_not_installed",
+			bufGenerate: &spec.BufGenerate{},
+			missingBuf:  true,
+			wantErr:     "the buf_generate action requires the buf CLI",
+		},
+		{
+			name:        "memfs",
+			bufGenerate: &spec.BufGenerate{},
+			memFS:       true,
+			wantErr:     "can't be used when rendering to memory",
+		},
+		{
+			name:            "not_allowed",
+			bufGenerate:     &spec.BufGenerate{},
+			initialContents: map[string]string{"api.proto": ""},
+			notAllowed:      true,
+			want:            map[string]string{"api.proto": ""},
+			wantErr:         "rerun with --allow-buf-generate",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			scratchDir := filepath.Join(tempDir, "scratch")
+			abctestutil.WriteAll(t, scratchDir, tc.initialContents)
+			bufPath := filepath.Join(tempDir, "bin", "buf")
+			if !tc.missingBuf {
+				abctestutil.WriteAllMode(t, filepath.Dir(bufPath), map[string]abctestutil.ModeAndContents{
+					"buf": {Mode: 0o755, Contents: fakeBuf},
+				})
+			}
+
+			tc.bufGenerate.Pos = model.ConfigPos{Line: 1}
+			sp := &stepParams{
+				bufCommand: bufPath,
+				scope:      common.NewScope(tc.inputs, nil),
+				scratchDir: scratchDir,
+				rp: &Params{
+					AllowBufGenerate: !tc.notAllowed,
+					FS:               &common.RealFS{},
+				},
+			}
+			if tc.memFS {
+				memFS, err := common.NewMemFS(nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// Like in a real render, the FS is wrapped in a JailFS.
+				jailFS, err := common.NewJailFS(memFS, scratchDir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				sp.rp.FS = jailFS
+			}
+			err := actionBufGenerate(context.Background(), tc.bufGenerate, sp)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+
+			got := abctestutil.LoadDir(t, scratchDir)
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("scratch directory contents were not as expected (-got,+want): %v", diff)
+			}
+		})
+	}
+}
+
+func TestRender_BufGenerateNotAllowed(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	abctestutil.WriteAll(t, sourceDir, map[string]string{
+		"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'A template'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['api.proto']
+  - desc: 'Generate'
+    action: 'buf_generate'
+    params: {}
+`,
+		"api.proto": `syntax = "proto3";`,
+	})
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	outDir := filepath.Join(tempDir, "out")
+	_, err := Render(ctx, &Params{
+		Clock:             clock.NewMock(),
+		Cwd:               tempDir,
+		Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+		FS:                &common.RealFS{},
+		OutDir:            outDir,
+		SourceForMessages: sourceDir,
+		Stdout:            io.Discard,
+		TempDirBase:       tempDir,
+	})
+	if diff := testutil.DiffErrString(err, "rerun with --allow-buf-generate"); diff != "" {
+		t.Error(diff)
+	}
+	if _, err := os.Stat(outDir); !common.IsNotExistErr(err) {
+		t.Errorf("output directory %s was written, but rendering failed (Stat error: %v)", outDir, err)
+	}
+}
@@ -19,7 +19,7 @@ import (
 
 	"github.com/abcxyz/abc/templates/common"
 	"github.com/abcxyz/abc/templates/common/render/gotmpl"
-	spec "github.com/abcxyz/abc/templates/model/spec/v1beta6"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
 )
 
 func actionForEach(ctx context.Context, fe *spec.ForEach, sp *stepParams) error {
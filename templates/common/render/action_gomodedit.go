@@ -0,0 +1,147 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+
+	"github.com/abcxyz/abc/templates/common/render/gotmpl"
+	"github.com/abcxyz/abc/templates/model"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
+)
+
+// goModRequire is a GoModRequire after templating.
+type goModRequire struct {
+	path, version string
+}
+
+// goModReplace is a GoModReplace after templating.
+type goModReplace struct {
+	old, oldVersion, new, newVersion string
+}
+
+func actionGoModEdit(ctx context.Context, g *spec.GoModEdit, sp *stepParams) error {
+	modulePath, err := gotmpl.ParseExec(g.Module.Pos, g.Module.Val, sp.scope)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	if modulePath != "" {
+		if err := module.CheckImportPath(modulePath); err != nil {
+			return g.Module.Pos.Errorf("invalid module path: %w", err)
+		}
+	}
+	goVersion, err := gotmpl.ParseExec(g.GoVersion.Pos, g.GoVersion.Val, sp.scope)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	if goVersion != "" && !modfile.GoVersionRE.MatchString(goVersion) {
+		return g.GoVersion.Pos.Errorf("invalid go version %q, it must be like 1.22 or 1.22.1", goVersion)
+	}
+
+	requires := make([]*goModRequire, 0, len(g.Requires))
+	for _, r := range g.Requires {
+		req, err := parseGoModRequire(r, sp)
+		if err != nil {
+			return err
+		}
+		requires = append(requires, req)
+	}
+	replaces := make([]*goModReplace, 0, len(g.Replaces))
+	for _, r := range g.Replaces {
+		repl, err := parseGoModReplace(r, sp)
+		if err != nil {
+			return err
+		}
+		replaces = append(replaces, repl)
+	}
+
+	return walkAndModify(ctx, sp, g.Paths, func(buf []byte) ([]byte, error) {
+		f, err := modfile.Parse("go.mod", buf, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing go.mod: %w", err)
+		}
+		if modulePath != "" {
+			if err := f.AddModuleStmt(modulePath); err != nil {
+				return nil, fmt.Errorf("failed setting module path: %w", err)
+			}
+		}
+		if goVersion != "" {
+			if err := f.AddGoStmt(goVersion); err != nil {
+				return nil, fmt.Errorf("failed setting go version: %w", err)
+			}
+		}
+		for _, r := range requires {
+			if err := f.AddRequire(r.path, r.version); err != nil {
+				return nil, fmt.Errorf("failed adding require %s %s: %w", r.path, r.version, err)
+			}
+		}
+		for _, r := range replaces {
+			if err := f.AddReplace(r.old, r.oldVersion, r.new, r.newVersion); err != nil {
+				return nil, fmt.Errorf("failed adding replace of %s: %w", r.old, err)
+			}
+		}
+		f.Cleanup()
+		out, err := f.Format()
+		if err != nil {
+			return nil, fmt.Errorf("failed formatting go.mod: %w", err)
+		}
+		return out, nil
+	})
+}
+
+func parseGoModRequire(r *spec.GoModRequire, sp *stepParams) (*goModRequire, error) {
+	vals, err := gotmpl.ParseExecAll([]model.String{r.Path, r.Version}, sp.scope)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	out := &goModRequire{path: vals[0], version: vals[1]}
+	if err := module.Check(out.path, out.version); err != nil {
+		return nil, r.Pos.Errorf("invalid require: %w", err)
+	}
+	return out, nil
+}
+
+func parseGoModReplace(r *spec.GoModReplace, sp *stepParams) (*goModReplace, error) {
+	vals, err := gotmpl.ParseExecAll([]model.String{r.Old, r.OldVersion, r.New, r.NewVersion}, sp.scope)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	out := &goModReplace{old: vals[0], oldVersion: vals[1], new: vals[2], newVersion: vals[3]}
+	if err := module.CheckImportPath(out.old); err != nil {
+		return nil, r.Old.Pos.Errorf("invalid module path in \"old\": %w", err)
+	}
+	if out.oldVersion != "" {
+		if err := module.Check(out.old, out.oldVersion); err != nil {
+			return nil, r.OldVersion.Pos.Errorf("invalid \"old_version\": %w", err)
+		}
+	}
+	isLocal := strings.HasPrefix(out.new, "./") || strings.HasPrefix(out.new, "../") || out.new == "." || out.new == ".."
+	switch {
+	case isLocal && out.newVersion != "":
+		return nil, r.NewVersion.Pos.Errorf(`"new_version" must not be set when "new" is a local directory`)
+	case !isLocal && out.newVersion == "":
+		return nil, r.Pos.Errorf(`"new_version" is required unless "new" is a local directory starting with "./" or "../"`)
+	case !isLocal:
+		if err := module.Check(out.new, out.newVersion); err != nil {
+			return nil, r.Pos.Errorf("invalid replacement: %w", err)
+		}
+	}
+	return out, nil
+}
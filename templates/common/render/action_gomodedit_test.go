@@ -0,0 +1,189 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	mdl "github.com/abcxyz/abc/templates/testutil/model"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestActionGoModEdit(t *testing.T) {
+	t.Parallel()
+
+	goMod := `module github.com/example/template
+
+go 1.21
+
+// Keep this comment.
+require github.com/abcxyz/pkg v1.0.0
+`
+
+	cases := []struct {
+		name   string
+		edit   *spec.GoModEdit
+		inputs map[string]string
+
+		initialContents map[string]string
+		want            map[string]string
+		wantErr         string
+	}{
+		{
+			name: "rename_module_and_set_go_version",
+			edit: &spec.GoModEdit{
+				Module:    mdl.S("github.com/{{.org}}/{{.name}}"),
+				GoVersion: mdl.S("1.22"),
+			},
+			inputs:          map[string]string{"org": "my-org", "name": "my-service"},
+			initialContents: map[string]string{"go.mod": goMod},
+			want: map[string]string{"go.mod": `module github.com/my-org/my-service
+
+go 1.22
+
+// Keep this comment.
+require github.com/abcxyz/pkg v1.0.0
+`},
+		},
+		{
+			name: "add_and_update_requires",
+			edit: &spec.GoModEdit{
+				Requires: []*spec.GoModRequire{
+					{Path: mdl.S("github.com/abcxyz/pkg"), Version: mdl.S("v1.2.0")},
+					{Path: mdl.S("golang.org/x/mod"), Version: mdl.S("v0.18.0")},
+				},
+			},
+			initialContents: map[string]string{"go.mod": goMod},
+			want: map[string]string{"go.mod": `module github.com/example/template
+
+go 1.21
+
+require (
+	// Keep this comment.
+	github.com/abcxyz/pkg v1.2.0
+	golang.org/x/mod v0.18.0
+)
+`},
+		},
+		{
+			name: "add_replaces",
+			edit: &spec.GoModEdit{
+				Replaces: []*spec.GoModReplace{
+					{Old: mdl.S("github.com/abcxyz/pkg"), New: mdl.S("../pkg")},
+					{Old: mdl.S("golang.org/x/mod"), OldVersion: mdl.S("v0.17.0"), New: mdl.S("github.com/my-org/mod"), NewVersion: mdl.S("v0.17.1")},
+				},
+			},
+			initialContents: map[string]string{"go.mod": goMod},
+			want: map[string]string{"go.mod": goMod + `
+replace github.com/abcxyz/pkg => ../pkg
+
+replace golang.org/x/mod v0.17.0 => github.com/my-org/mod v0.17.1
+`},
+		},
+		{
+			name: "invalid_module_path",
+			edit: &spec.GoModEdit{
+				Module: mdl.S("not a module"),
+			},
+			initialContents: map[string]string{"go.mod": goMod},
+			want:            map[string]string{"go.mod": goMod},
+			wantErr:         "invalid module path",
+		},
+		{
+			name: "invalid_go_version",
+			edit: &spec.GoModEdit{
+				GoVersion: mdl.S("go1.22"),
+			},
+			initialContents: map[string]string{"go.mod": goMod},
+			want:            map[string]string{"go.mod": goMod},
+			wantErr:         `invalid go version "go1.22"`,
+		},
+		{
+			name: "invalid_require_version",
+			edit: &spec.GoModEdit{
+				Requires: []*spec.GoModRequire{
+					{Path: mdl.S("github.com/abcxyz/pkg"), Version: mdl.S("latest")},
+				},
+			},
+			initialContents: map[string]string{"go.mod": goMod},
+			want:            map[string]string{"go.mod": goMod},
+			wantErr:         "invalid require",
+		},
+		{
+			name: "replace_missing_new_version",
+			edit: &spec.GoModEdit{
+				Replaces: []*spec.GoModReplace{
+					{Old: mdl.S("github.com/abcxyz/pkg"), New: mdl.S("github.com/my-org/pkg")},
+				},
+			},
+			initialContents: map[string]string{"go.mod": goMod},
+			want:            map[string]string{"go.mod": goMod},
+			wantErr:         `"new_version" is required unless "new" is a local directory`,
+		},
+		{
+			name: "replace_local_dir_with_version",
+			edit: &spec.GoModEdit{
+				Replaces: []*spec.GoModReplace{
+					{Old: mdl.S("github.com/abcxyz/pkg"), New: mdl.S("./pkg"), NewVersion: mdl.S("v1.0.0")},
+				},
+			},
+			initialContents: map[string]string{"go.mod": goMod},
+			want:            map[string]string{"go.mod": goMod},
+			wantErr:         `"new_version" must not be set when "new" is a local directory`,
+		},
+		{
+			name: "invalid_go_mod_file",
+			edit: &spec.GoModEdit{
+				GoVersion: mdl.S("1.22"),
+			},
+			initialContents: map[string]string{"go.mod": "modul github.com/foo\n"},
+			want:            map[string]string{"go.mod": "modul github.com/foo\n"},
+			wantErr:         `when processing template file "go.mod": failed parsing go.mod`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			scratchDir := t.TempDir()
+			abctestutil.WriteAll(t, scratchDir, tc.initialContents)
+
+			tc.edit.Paths = mdl.Strings("go.mod")
+			sp := &stepParams{
+				scope:      common.NewScope(tc.inputs, nil),
+				scratchDir: scratchDir,
+				rp:         &Params{FS: &common.RealFS{}},
+			}
+			err := actionGoModEdit(context.Background(), tc.edit, sp)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+
+			got := abctestutil.LoadDir(t, scratchDir)
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("scratch directory contents were not as expected (-got,+want): %v", diff)
+			}
+		})
+	}
+}
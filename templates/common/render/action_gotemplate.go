@@ -16,22 +16,152 @@ package render
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
 
+	"golang.org/x/exp/maps"
+
+	"github.com/abcxyz/abc/templates/common/errs"
 	"github.com/abcxyz/abc/templates/common/render/gotmpl"
-	spec "github.com/abcxyz/abc/templates/model/spec/v1beta6"
+	"github.com/abcxyz/abc/templates/common/render/jinja"
+	"github.com/abcxyz/abc/templates/model"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
+	"github.com/abcxyz/pkg/logging"
 )
 
 func actionGoTemplate(ctx context.Context, p *spec.GoTemplate, sp *stepParams) error {
-	if err := walkAndModify(ctx, sp, p.Paths, func(b []byte) ([]byte, error) {
-		executed, err := gotmpl.ParseExec(nil, string(b), sp.scope)
+	engine := p.TemplateEngine.Val
+	if engine == "" {
+		engine = sp.templateEngine
+	}
+
+	opts := &gotmpl.Options{
+		MissingKeyZero: p.MissingKeys.Val == spec.MissingKeysZero,
+	}
+	if len(p.Delimiters) == 2 {
+		if engine == spec.TemplateEngineJinja2 {
+			return p.Delimiters[0].Pos.Errorf(`"delimiters" can't be used with template_engine %q`, spec.TemplateEngineJinja2)
+		}
+		opts.LeftDelim, opts.RightDelim = p.Delimiters[0].Val, p.Delimiters[1].Val
+	}
+	if p.MissingKeys.Val != "" && p.MissingKeys.Val != spec.MissingKeysError && engine == spec.TemplateEngineJinja2 {
+		return p.MissingKeys.Pos.Errorf(`"missing_keys" can't be used with template_engine %q`, spec.TemplateEngineJinja2)
+	}
+
+	if engine != spec.TemplateEngineJinja2 && !sp.features.SkipPartials {
+		partials, err := loadPartials(sp)
+		if err != nil {
+			return p.Pos.Errorf("%w", err)
+		}
+		opts.Partials = partials
+	}
+
+	skip := func(relPath string) (bool, error) {
+		return matchesVerbatim(p.Verbatim, relPath)
+	}
+
+	// Files are visited concurrently, so the names of missing variables are
+	// collected under a lock and warned about once at the end.
+	var mu sync.Mutex
+	missing := map[string]struct{}{}
+
+	if err := walkAndModifyExcept(ctx, sp, p.Paths, skip, func(b []byte) ([]byte, error) {
+		if engine == spec.TemplateEngineJinja2 {
+			executed, err := jinja.Render(string(b), sp.scope.AllVars())
+			if err != nil {
+				return nil, fmt.Errorf("failed executing file as Jinja2 template: %w", err)
+			}
+			return []byte(executed), nil
+		}
+		if p.MissingKeys.Val == spec.MissingKeysWarn {
+			executed, names, err := parseExecWarnMissing(string(b), sp, opts)
+			if err != nil {
+				return nil, fmt.Errorf("failed executing file as Go template: %w", err)
+			}
+			mu.Lock()
+			for _, name := range names {
+				missing[name] = struct{}{}
+			}
+			mu.Unlock()
+			return []byte(executed), nil
+		}
+		executed, err := gotmpl.ParseExecOpts(nil, string(b), sp.scope, opts)
 		if err != nil {
 			return nil, fmt.Errorf("failed executing file as Go template: %w", err)
 		}
 		return []byte(executed), nil
-	}); err != nil {
+	}, nil); err != nil {
 		return err
 	}
 
+	if len(missing) > 0 {
+		names := maps.Keys(missing)
+		sort.Strings(names)
+		logging.FromContext(ctx).WarnContext(ctx, "go_template referenced variables that don't exist, and they were rendered as empty strings",
+			"line", p.Pos.Line,
+			"variables", names)
+	}
+
 	return nil
 }
+
+// parseExecWarnMissing executes a Go template like gotmpl.ParseExecOpts, but
+// each nonexistent variable is rendered as the empty string. It returns the
+// names of those variables.
+func parseExecWarnMissing(tmpl string, sp *stepParams, opts *gotmpl.Options) (string, []string, error) {
+	// Rather than using "missingkey=zero", which can't report which keys were
+	// missing, retry with each missing variable bound to the empty string
+	// until the template executes. Each retry binds a new variable, so this
+	// terminates.
+	filled := map[string]string{}
+	var names []string
+	for {
+		executed, err := gotmpl.ParseExecOpts(nil, tmpl, sp.scope.With(filled), opts)
+		var uve *errs.UnknownVarError
+		if err == nil || !errors.As(err, &uve) {
+			return executed, names, err //nolint:wrapcheck
+		}
+		if _, ok := filled[uve.VarName]; ok {
+			return "", nil, err //nolint:wrapcheck
+		}
+		filled[uve.VarName] = ""
+		names = append(names, uve.VarName)
+	}
+}
+
+// matchesVerbatim returns whether the given file, relative to the scratch dir
+// and using forward slashes, matches one of the go_template "verbatim"
+// patterns. A pattern without a slash is matched against each path component;
+// otherwise it's matched against the file path and each of its parent
+// directories. A leading slash is allowed and has no effect except to anchor a
+// single-component pattern to the root.
+func matchesVerbatim(patterns []model.String, relPath string) (bool, error) {
+	for _, p := range patterns {
+		anchored := strings.Contains(p.Val, "/")
+		pattern := strings.TrimPrefix(p.Val, "/")
+		candidate := relPath
+		for {
+			subject := candidate
+			if !anchored {
+				subject = path.Base(candidate)
+			}
+			matched, err := path.Match(pattern, subject)
+			if err != nil {
+				return false, p.Pos.Errorf("failed to match path (%q) with pattern (%q): %w", relPath, p.Val, err)
+			}
+			if matched {
+				return true, nil
+			}
+			parent := path.Dir(candidate)
+			if parent == "." || parent == candidate {
+				break
+			}
+			candidate = parent
+		}
+	}
+	return false, nil
+}
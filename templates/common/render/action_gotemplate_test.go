@@ -23,7 +23,7 @@ import (
 	"github.com/abcxyz/abc/templates/common"
 	"github.com/abcxyz/abc/templates/common/render/gotmpl/funcs"
 	"github.com/abcxyz/abc/templates/model/spec/features"
-	spec "github.com/abcxyz/abc/templates/model/spec/v1beta6"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
 	abctestutil "github.com/abcxyz/abc/templates/testutil"
 	mdl "github.com/abcxyz/abc/templates/testutil/model"
 	"github.com/abcxyz/pkg/testutil"
@@ -37,6 +37,9 @@ func TestActionGoTemplate(t *testing.T) {
 		inputs       map[string]string
 		initContents map[string]string
 		gt           *spec.GoTemplate
+		specEngine   string
+		templateDir  map[string]string
+		features     features.Features
 		want         map[string]string
 		wantErr      string
 	}{
@@ -158,6 +161,347 @@ func TestActionGoTemplate(t *testing.T) {
 				"suffix.txt":       `test`,
 			},
 		},
+		{
+			name: "jinja2_action_engine",
+			inputs: map[string]string{
+				"person": "Alice",
+				"list":   "one,two",
+			},
+			initContents: map[string]string{
+				"a.txt": "Hello, {{ person | upper }}!{% for x in list.split(',') %} {{ x }}{% endfor %}",
+			},
+			gt: &spec.GoTemplate{
+				Paths:          mdl.Strings("."),
+				TemplateEngine: mdl.S("jinja2"),
+			},
+			want: map[string]string{
+				"a.txt": "Hello, ALICE! one two",
+			},
+		},
+		{
+			name: "jinja2_spec_engine",
+			inputs: map[string]string{
+				"person": "Alice",
+			},
+			initContents: map[string]string{
+				"a.txt": "{% if person == 'Alice' %}Hi {{ person }}{% endif %}",
+			},
+			gt: &spec.GoTemplate{
+				Paths: mdl.Strings("."),
+			},
+			specEngine: "jinja2",
+			want: map[string]string{
+				"a.txt": "Hi Alice",
+			},
+		},
+		{
+			name: "action_engine_overrides_spec_engine",
+			inputs: map[string]string{
+				"person": "Alice",
+			},
+			initContents: map[string]string{
+				"a.txt": "Hello, {{.person}}!",
+			},
+			gt: &spec.GoTemplate{
+				Paths:          mdl.Strings("."),
+				TemplateEngine: mdl.S("go"),
+			},
+			specEngine: "jinja2",
+			want: map[string]string{
+				"a.txt": "Hello, Alice!",
+			},
+		},
+		{
+			name: "jinja2_cookiecutter_namespace",
+			inputs: map[string]string{
+				"project_name": "My App",
+			},
+			initContents: map[string]string{
+				"a.txt": "{{ cookiecutter.project_name.lower().replace(' ', '_') }}",
+			},
+			gt: &spec.GoTemplate{
+				Paths:          mdl.Strings("."),
+				TemplateEngine: mdl.S("jinja2"),
+			},
+			want: map[string]string{
+				"a.txt": "my_app",
+			},
+		},
+		{
+			name: "jinja2_syntax_error",
+			initContents: map[string]string{
+				"a.txt": "Hello, {% if %}!",
+			},
+			gt: &spec.GoTemplate{
+				Paths:          mdl.Strings("."),
+				TemplateEngine: mdl.S("jinja2"),
+			},
+			want: map[string]string{
+				"a.txt": "Hello, {% if %}!",
+			},
+			wantErr: `failed executing file as Jinja2 template: error compiling as Jinja2 template`,
+		},
+		{
+			name: "custom_delimiters",
+			inputs: map[string]string{
+				"chart": "mychart",
+			},
+			initContents: map[string]string{
+				"deployment.yaml": "name: [[ .chart ]]\nimage: {{ .Values.image }}",
+			},
+			gt: &spec.GoTemplate{
+				Paths:      mdl.Strings("."),
+				Delimiters: mdl.Strings("[[", "]]"),
+			},
+			want: map[string]string{
+				"deployment.yaml": "name: mychart\nimage: {{ .Values.image }}",
+			},
+		},
+		{
+			name: "delimiters_with_jinja2_spec_engine",
+			initContents: map[string]string{
+				"a.txt": "[[ x ]]",
+			},
+			gt: &spec.GoTemplate{
+				Paths:      mdl.Strings("."),
+				Delimiters: mdl.Strings("[[", "]]"),
+			},
+			specEngine: "jinja2",
+			want: map[string]string{
+				"a.txt": "[[ x ]]",
+			},
+			wantErr: `"delimiters" can't be used with template_engine "jinja2"`,
+		},
+		{
+			name: "verbatim",
+			inputs: map[string]string{
+				"person": "Alice",
+			},
+			initContents: map[string]string{
+				"a.txt":                         "Hello, {{.person}}!",
+				"chart/templates/service.yaml":  "name: {{ .Release.Name }}",
+				"chart/templates/_helpers.tpl":  `{{- define "name" -}}`,
+				"chart/values.yaml":             "owner: {{.person}}",
+				"docs/example.tmpl":             "{{ .Example }}",
+				"docs/nested/other/guide.tmpl":  "{{ .Example }}",
+				"docs/nested/other/readme.txt":  "By {{.person}}",
+				"scripts/render.sh":             "echo {{.person}}",
+				"scripts/templates/keep/a.yaml": "{{ .Keep }}",
+			},
+			gt: &spec.GoTemplate{
+				Paths:    mdl.Strings("."),
+				Verbatim: mdl.Strings("chart/templates", "*.tmpl", "scripts/*/keep"),
+			},
+			want: map[string]string{
+				"a.txt":                         "Hello, Alice!",
+				"chart/templates/service.yaml":  "name: {{ .Release.Name }}",
+				"chart/templates/_helpers.tpl":  `{{- define "name" -}}`,
+				"chart/values.yaml":             "owner: Alice",
+				"docs/example.tmpl":             "{{ .Example }}",
+				"docs/nested/other/guide.tmpl":  "{{ .Example }}",
+				"docs/nested/other/readme.txt":  "By Alice",
+				"scripts/render.sh":             "echo Alice",
+				"scripts/templates/keep/a.yaml": "{{ .Keep }}",
+			},
+		},
+		{
+			name: "missing_keys_error",
+			initContents: map[string]string{
+				"a.txt": "Hello, {{.person}}!",
+			},
+			gt: &spec.GoTemplate{
+				Paths:       mdl.Strings("."),
+				MissingKeys: mdl.S("error"),
+			},
+			want: map[string]string{
+				"a.txt": "Hello, {{.person}}!",
+			},
+			wantErr: `nonexistent variable name "person"`,
+		},
+		{
+			name: "missing_keys_zero",
+			inputs: map[string]string{
+				"greeting": "Hello",
+			},
+			initContents: map[string]string{
+				"a.txt": "{{.greeting}}, {{.person}}!",
+			},
+			gt: &spec.GoTemplate{
+				Paths:       mdl.Strings("."),
+				MissingKeys: mdl.S("zero"),
+			},
+			want: map[string]string{
+				"a.txt": "Hello, !",
+			},
+		},
+		{
+			name: "missing_keys_warn",
+			inputs: map[string]string{
+				"greeting": "Hello",
+			},
+			initContents: map[string]string{
+				"a.txt": "{{.greeting}}, {{.person}} and {{.other}} and {{.person}}!",
+				"b.txt": "{{.greeting}}, {{.third}}!",
+			},
+			gt: &spec.GoTemplate{
+				Paths:       mdl.Strings("."),
+				MissingKeys: mdl.S("warn"),
+			},
+			want: map[string]string{
+				"a.txt": "Hello,  and  and !",
+				"b.txt": "Hello, !",
+			},
+		},
+		{
+			name: "missing_keys_warn_other_error",
+			initContents: map[string]string{
+				"a.txt": "{{.person.name}}",
+			},
+			gt: &spec.GoTemplate{
+				Paths:       mdl.Strings("."),
+				MissingKeys: mdl.S("warn"),
+			},
+			want: map[string]string{
+				"a.txt": "{{.person.name}}",
+			},
+			wantErr: "can't evaluate field name in type string",
+		},
+		{
+			name: "missing_keys_with_jinja2_spec_engine",
+			initContents: map[string]string{
+				"a.txt": "{{ x }}",
+			},
+			gt: &spec.GoTemplate{
+				Paths:       mdl.Strings("."),
+				MissingKeys: mdl.S("zero"),
+			},
+			specEngine: "jinja2",
+			want: map[string]string{
+				"a.txt": "{{ x }}",
+			},
+			wantErr: `"missing_keys" can't be used with template_engine "jinja2"`,
+		},
+		{
+			name: "partials",
+			inputs: map[string]string{
+				"owner": "Alice",
+			},
+			templateDir: map[string]string{
+				"_partials/license_header.tmpl": "// Copyright {{.owner}}",
+				"_partials/go/package.txt":      `{{define "pkgline"}}package {{.}}{{end}}`,
+			},
+			initContents: map[string]string{
+				"main.go": "{{template \"license_header\" .}}\n{{template \"pkgline\" \"main\"}}",
+			},
+			gt: &spec.GoTemplate{
+				Paths: mdl.Strings("."),
+			},
+			want: map[string]string{
+				"main.go": "// Copyright Alice\npackage main",
+			},
+		},
+		{
+			name: "partials_nested_name",
+			templateDir: map[string]string{
+				"_partials/go/header.tmpl": "// generated",
+			},
+			initContents: map[string]string{
+				"main.go": `{{template "go/header" .}}`,
+			},
+			gt: &spec.GoTemplate{
+				Paths: mdl.Strings("."),
+			},
+			want: map[string]string{
+				"main.go": "// generated",
+			},
+		},
+		{
+			name: "partials_with_delimiters",
+			inputs: map[string]string{
+				"owner": "Alice",
+			},
+			templateDir: map[string]string{
+				"_partials/header.tmpl": "# [[.owner]] {{ .Values.x }}",
+			},
+			initContents: map[string]string{
+				"values.yaml": `[[template "header" .]]`,
+			},
+			gt: &spec.GoTemplate{
+				Paths:      mdl.Strings("."),
+				Delimiters: mdl.Strings("[[", "]]"),
+			},
+			want: map[string]string{
+				"values.yaml": "# Alice {{ .Values.x }}",
+			},
+		},
+		{
+			name: "partials_name_collision",
+			templateDir: map[string]string{
+				"_partials/header.tmpl": "a",
+				"_partials/header.txt":  "b",
+			},
+			initContents: map[string]string{
+				"a.txt": `{{template "header" .}}`,
+			},
+			gt: &spec.GoTemplate{
+				Paths: mdl.Strings("."),
+			},
+			want: map[string]string{
+				"a.txt": `{{template "header" .}}`,
+			},
+			wantErr: `the partials "header.tmpl" and "header.txt" in the _partials directory would both be named "header"`,
+		},
+		{
+			name: "partials_parse_error",
+			templateDir: map[string]string{
+				"_partials/header.tmpl": "{{ .x",
+			},
+			initContents: map[string]string{
+				"a.txt": `{{template "header" .}}`,
+			},
+			gt: &spec.GoTemplate{
+				Paths: mdl.Strings("."),
+			},
+			want: map[string]string{
+				"a.txt": `{{template "header" .}}`,
+			},
+			wantErr: `error compiling partial "header" as go-template`,
+		},
+		{
+			name: "partials_unsupported_api_version",
+			templateDir: map[string]string{
+				"_partials/header.tmpl": "// header",
+			},
+			initContents: map[string]string{
+				"a.txt": `{{template "header" .}}`,
+			},
+			gt: &spec.GoTemplate{
+				Paths: mdl.Strings("."),
+			},
+			features: features.Features{SkipPartials: true},
+			want: map[string]string{
+				"a.txt": `{{template "header" .}}`,
+			},
+			wantErr: `template "header" not defined`,
+		},
+		{
+			name: "verbatim_leading_slash",
+			inputs: map[string]string{
+				"person": "Alice",
+			},
+			initContents: map[string]string{
+				"a.txt":     "{{ .Raw }}",
+				"sub/a.txt": "Hello, {{.person}}!",
+			},
+			gt: &spec.GoTemplate{
+				Paths:    mdl.Strings("."),
+				Verbatim: mdl.Strings("/a.txt"),
+			},
+			want: map[string]string{
+				"a.txt":     "{{ .Raw }}",
+				"sub/a.txt": "Hello, Alice!",
+			},
+		},
 	}
 
 	for _, tc := range cases {
@@ -168,11 +512,16 @@ func TestActionGoTemplate(t *testing.T) {
 
 			scratchDir := t.TempDir()
 			abctestutil.WriteAll(t, scratchDir, tc.initContents)
+			templateDir := t.TempDir()
+			abctestutil.WriteAll(t, templateDir, tc.templateDir)
 
 			ctx := context.Background()
 			sp := &stepParams{
-				scope:      common.NewScope(tc.inputs, funcs.Funcs(features.Features{})),
-				scratchDir: scratchDir,
+				scope:          common.NewScope(tc.inputs, funcs.Funcs(features.Features{})),
+				features:       tc.features,
+				scratchDir:     scratchDir,
+				templateDir:    templateDir,
+				templateEngine: tc.specEngine,
 				rp: &Params{
 					FS: &common.RealFS{},
 				},
@@ -0,0 +1,221 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+
+	"github.com/abcxyz/abc/templates/common/render/gotmpl"
+	"github.com/abcxyz/abc/templates/model"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
+)
+
+// hclAddBlock is an HCLAddBlock after templating and parsing.
+type hclAddBlock struct {
+	pos      *model.ConfigPos
+	parent   []string
+	typ      string
+	labels   []string
+	body     hclwrite.Tokens
+	ifExists string
+}
+
+// hclSetAttribute is an HCLSetAttribute after templating and parsing.
+type hclSetAttribute struct {
+	pos   *model.ConfigPos
+	block []string
+	name  string
+	value hclwrite.Tokens
+}
+
+func actionHCLModify(ctx context.Context, h *spec.HCLModify, sp *stepParams) error {
+	adds := make([]*hclAddBlock, 0, len(h.AddBlocks))
+	for _, a := range h.AddBlocks {
+		add, err := parseHCLAddBlock(a, sp)
+		if err != nil {
+			return err
+		}
+		adds = append(adds, add)
+	}
+	sets := make([]*hclSetAttribute, 0, len(h.SetAttributes))
+	for _, s := range h.SetAttributes {
+		set, err := parseHCLSetAttribute(s, sp)
+		if err != nil {
+			return err
+		}
+		sets = append(sets, set)
+	}
+
+	return walkAndModify(ctx, sp, h.Paths, func(buf []byte) ([]byte, error) {
+		f, diags := hclwrite.ParseConfig(buf, "", hcl.InitialPos)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("failed parsing HCL: %w", diags)
+		}
+		for _, add := range adds {
+			if err := add.apply(f.Body()); err != nil {
+				return nil, err
+			}
+		}
+		for _, set := range sets {
+			body := findHCLBlock(f.Body(), set.block)
+			if body == nil {
+				return nil, set.pos.Errorf("there's no block %q to set attribute %q in", strings.Join(set.block, "."), set.name)
+			}
+			body.SetAttributeRaw(set.name, set.value)
+		}
+		return hclwrite.Format(f.Bytes()), nil
+	})
+}
+
+func parseHCLAddBlock(a *spec.HCLAddBlock, sp *stepParams) (*hclAddBlock, error) {
+	parent, err := gotmpl.ParseExec(a.Parent.Pos, a.Parent.Val, sp.scope)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	typ, err := gotmpl.ParseExec(a.Type.Pos, a.Type.Val, sp.scope)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	labels, err := gotmpl.ParseExecAll(a.Labels, sp.scope)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	bodySrc, err := gotmpl.ParseExec(a.Body.Pos, a.Body.Val, sp.scope)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	body, diags := hclwrite.ParseConfig([]byte(bodySrc), "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, a.Body.Pos.Errorf("invalid HCL in \"body\": %w", diags)
+	}
+	bodyTokens := body.BuildTokens(nil)
+	if len(bodyTokens) > 0 && bodyTokens[len(bodyTokens)-1].Type == hclsyntax.TokenEOF {
+		bodyTokens = bodyTokens[:len(bodyTokens)-1]
+	}
+	if len(bodyTokens) > 0 && bodyTokens[len(bodyTokens)-1].Type != hclsyntax.TokenNewline {
+		bodyTokens = append(bodyTokens, &hclwrite.Token{Type: hclsyntax.TokenNewline, Bytes: []byte("\n")})
+	}
+	ifExists := a.IfExists.Val
+	if ifExists == "" {
+		ifExists = spec.HCLIfExistsError
+	}
+	return &hclAddBlock{
+		pos:      &a.Pos,
+		parent:   splitHCLAddress(parent),
+		typ:      typ,
+		labels:   labels,
+		body:     bodyTokens,
+		ifExists: ifExists,
+	}, nil
+}
+
+func parseHCLSetAttribute(s *spec.HCLSetAttribute, sp *stepParams) (*hclSetAttribute, error) {
+	block, err := gotmpl.ParseExec(s.Block.Pos, s.Block.Val, sp.scope)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	name, err := gotmpl.ParseExec(s.Name.Pos, s.Name.Val, sp.scope)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	if !hclsyntax.ValidIdentifier(name) {
+		return nil, s.Name.Pos.Errorf("%q isn't a valid HCL attribute name", name)
+	}
+	valueSrc, err := gotmpl.ParseExec(s.Value.Pos, s.Value.Val, sp.scope)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	// hclwrite can only parse whole files, so the expression is parsed as the
+	// value of a placeholder attribute.
+	f, diags := hclwrite.ParseConfig([]byte("v = "+valueSrc+"\n"), "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, s.Value.Pos.Errorf("invalid HCL expression %q: %w", valueSrc, diags)
+	}
+	attr := f.Body().GetAttribute("v")
+	if attr == nil || len(f.Body().Attributes()) != 1 || len(f.Body().Blocks()) != 0 {
+		return nil, s.Value.Pos.Errorf("invalid HCL expression %q", valueSrc)
+	}
+	return &hclSetAttribute{
+		pos:   &s.Pos,
+		block: splitHCLAddress(block),
+		name:  name,
+		value: attr.Expr().BuildTokens(nil),
+	}, nil
+}
+
+// apply adds the block to the given file body.
+func (a *hclAddBlock) apply(root *hclwrite.Body) error {
+	parent := findHCLBlock(root, a.parent)
+	if parent == nil {
+		return a.pos.Errorf("there's no block %q to add a %q block to", strings.Join(a.parent, "."), a.typ)
+	}
+	if existing := parent.FirstMatchingBlock(a.typ, a.labels); existing != nil {
+		switch a.ifExists {
+		case spec.HCLIfExistsSkip:
+			return nil
+		case spec.HCLIfExistsReplace:
+			// The block's contents are replaced in place, so it keeps its
+			// position and any comments before it.
+			existing.Body().Clear()
+			existing.Body().AppendNewline()
+			existing.Body().AppendUnstructuredTokens(a.body)
+			return nil
+		default:
+			return a.pos.Errorf("there's already a block %q; to change this, set if_exists", strings.Join(append([]string{a.typ}, a.labels...), "."))
+		}
+	}
+	if len(parent.Attributes()) > 0 || len(parent.Blocks()) > 0 {
+		parent.AppendNewline()
+	}
+	block := parent.AppendNewBlock(a.typ, a.labels)
+	block.Body().AppendUnstructuredTokens(a.body)
+	return nil
+}
+
+// findHCLBlock returns the body of the block with the given address, or nil if
+// there isn't one. An empty address is the body itself. An address is a block
+// type followed by the block's labels, then the same for each nested block,
+// like ["terraform", "backend", "gcs"].
+func findHCLBlock(body *hclwrite.Body, addr []string) *hclwrite.Body {
+	if len(addr) == 0 {
+		return body
+	}
+	for _, b := range body.Blocks() {
+		labels := b.Labels()
+		if b.Type() != addr[0] || len(addr) < 1+len(labels) || !slices.Equal(labels, addr[1:1+len(labels)]) {
+			continue
+		}
+		if found := findHCLBlock(b.Body(), addr[1+len(labels):]); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// splitHCLAddress splits a dotted block address like "terraform.backend.gcs"
+// into its parts. The empty string is the address of the top level.
+func splitHCLAddress(addr string) []string {
+	if addr == "" {
+		return nil
+	}
+	return strings.Split(addr, ".")
+}
@@ -0,0 +1,227 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	mdl "github.com/abcxyz/abc/templates/testutil/model"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestActionHCLModify(t *testing.T) {
+	t.Parallel()
+
+	mainTF := `# The backend is configured by the template.
+terraform {
+  required_version = ">= 1.5"
+
+  backend "gcs" {
+    bucket = "placeholder" # replaced at render time
+  }
+}
+
+variable "region" {
+  type = string
+}
+`
+
+	cases := []struct {
+		name          string
+		addBlocks     []*spec.HCLAddBlock
+		setAttributes []*spec.HCLSetAttribute
+		inputs        map[string]string
+
+		initialContents map[string]string
+		want            map[string]string
+		wantErr         string
+	}{
+		{
+			name: "set_attribute_in_nested_block",
+			setAttributes: []*spec.HCLSetAttribute{
+				{Block: mdl.S("terraform.backend.gcs"), Name: mdl.S("bucket"), Value: mdl.S(`"{{.bucket}}"`)},
+				{Block: mdl.S("terraform.backend.gcs"), Name: mdl.S("prefix"), Value: mdl.S(`"tfstate"`)},
+			},
+			inputs:          map[string]string{"bucket": "my-bucket"},
+			initialContents: map[string]string{"main.tf": mainTF},
+			want: map[string]string{"main.tf": `# The backend is configured by the template.
+terraform {
+  required_version = ">= 1.5"
+
+  backend "gcs" {
+    bucket = "my-bucket" # replaced at render time
+    prefix = "tfstate"
+  }
+}
+
+variable "region" {
+  type = string
+}
+`},
+		},
+		{
+			name: "set_top_level_attribute_with_expression",
+			setAttributes: []*spec.HCLSetAttribute{
+				{Name: mdl.S("project_id"), Value: mdl.S(`var.project_id`)},
+			},
+			initialContents: map[string]string{"terraform.tfvars": "region = \"us-central1\"\n"},
+			want: map[string]string{"terraform.tfvars": `region     = "us-central1"
+project_id = var.project_id
+`},
+		},
+		{
+			name: "add_block_then_set_attribute_in_it",
+			addBlocks: []*spec.HCLAddBlock{
+				{Type: mdl.S("variable"), Labels: mdl.Strings("{{.var_name}}"), Body: mdl.S("type = string\n")},
+			},
+			setAttributes: []*spec.HCLSetAttribute{
+				{Block: mdl.S("variable.{{.var_name}}"), Name: mdl.S("default"), Value: mdl.S(`"abc"`)},
+			},
+			inputs:          map[string]string{"var_name": "project_id"},
+			initialContents: map[string]string{"main.tf": mainTF},
+			want: map[string]string{"main.tf": mainTF + `
+variable "project_id" {
+  type    = string
+  default = "abc"
+}
+`},
+		},
+		{
+			name: "add_nested_block",
+			addBlocks: []*spec.HCLAddBlock{
+				{Parent: mdl.S("terraform"), Type: mdl.S("required_providers"), Body: mdl.S(`google = { source = "hashicorp/google" }`)},
+			},
+			initialContents: map[string]string{"versions.tf": "terraform {\n  required_version = \">= 1.5\"\n}\n"},
+			want: map[string]string{"versions.tf": `terraform {
+  required_version = ">= 1.5"
+
+  required_providers {
+    google = { source = "hashicorp/google" }
+  }
+}
+`},
+		},
+		{
+			name: "add_existing_block_skip",
+			addBlocks: []*spec.HCLAddBlock{
+				{Type: mdl.S("variable"), Labels: mdl.Strings("region"), Body: mdl.S("type = number"), IfExists: mdl.S("skip")},
+			},
+			initialContents: map[string]string{"main.tf": mainTF},
+			want:            map[string]string{"main.tf": mainTF},
+		},
+		{
+			name: "add_existing_block_replace",
+			addBlocks: []*spec.HCLAddBlock{
+				{Type: mdl.S("variable"), Labels: mdl.Strings("region"), Body: mdl.S(`default = "us-east1"`), IfExists: mdl.S("replace")},
+			},
+			initialContents: map[string]string{"vars.tf": "# The region.\nvariable \"region\" {\n  type = string\n}\n\noutput \"x\" {\n  value = 1\n}\n"},
+			want: map[string]string{"vars.tf": `# The region.
+variable "region" {
+  default = "us-east1"
+}
+
+output "x" {
+  value = 1
+}
+`},
+		},
+		{
+			name: "add_existing_block_error",
+			addBlocks: []*spec.HCLAddBlock{
+				{Type: mdl.S("variable"), Labels: mdl.Strings("region")},
+			},
+			initialContents: map[string]string{"main.tf": mainTF},
+			want:            map[string]string{"main.tf": mainTF},
+			wantErr:         `there's already a block "variable.region"`,
+		},
+		{
+			name: "missing_block_should_fail",
+			setAttributes: []*spec.HCLSetAttribute{
+				{Block: mdl.S("terraform.backend.s3"), Name: mdl.S("bucket"), Value: mdl.S(`"b"`)},
+			},
+			initialContents: map[string]string{"main.tf": mainTF},
+			want:            map[string]string{"main.tf": mainTF},
+			wantErr:         `there's no block "terraform.backend.s3" to set attribute "bucket" in`,
+		},
+		{
+			name: "invalid_expression_should_fail",
+			setAttributes: []*spec.HCLSetAttribute{
+				{Name: mdl.S("bucket"), Value: mdl.S(`my-bucket"`)},
+			},
+			initialContents: map[string]string{"main.tf": mainTF},
+			want:            map[string]string{"main.tf": mainTF},
+			wantErr:         `invalid HCL expression "my-bucket\""`,
+		},
+		{
+			name: "invalid_attribute_name_should_fail",
+			setAttributes: []*spec.HCLSetAttribute{
+				{Name: mdl.S("my bucket"), Value: mdl.S(`"b"`)},
+			},
+			initialContents: map[string]string{"main.tf": mainTF},
+			want:            map[string]string{"main.tf": mainTF},
+			wantErr:         `"my bucket" isn't a valid HCL attribute name`,
+		},
+		{
+			name: "invalid_file_should_fail",
+			setAttributes: []*spec.HCLSetAttribute{
+				{Name: mdl.S("bucket"), Value: mdl.S(`"b"`)},
+			},
+			initialContents: map[string]string{"main.tf": "terraform {"},
+			want:            map[string]string{"main.tf": "terraform {"},
+			wantErr:         `when processing template file "main.tf": failed parsing HCL`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			scratchDir := t.TempDir()
+			abctestutil.WriteAll(t, scratchDir, tc.initialContents)
+
+			paths := make([]string, 0, len(tc.initialContents))
+			for p := range tc.initialContents {
+				paths = append(paths, p)
+			}
+			h := &spec.HCLModify{
+				Paths:         mdl.Strings(paths...),
+				AddBlocks:     tc.addBlocks,
+				SetAttributes: tc.setAttributes,
+			}
+			sp := &stepParams{
+				scope:      common.NewScope(tc.inputs, nil),
+				scratchDir: scratchDir,
+				rp:         &Params{FS: &common.RealFS{}},
+			}
+			err := actionHCLModify(context.Background(), h, sp)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+
+			got := abctestutil.LoadDir(t, scratchDir)
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("scratch directory contents were not as expected (-got,+want): %v", diff)
+			}
+		})
+	}
+}
@@ -19,11 +19,14 @@ import (
 	"fmt"
 	"io/fs"
 	"path/filepath"
+	"strings"
 
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/gitignore"
+	"github.com/abcxyz/abc/templates/common/render/gotmpl"
 	"github.com/abcxyz/abc/templates/common/specutil"
 	"github.com/abcxyz/abc/templates/model"
-	spec "github.com/abcxyz/abc/templates/model/spec/v1beta6"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
 	"github.com/abcxyz/pkg/logging"
 )
 
@@ -43,23 +46,35 @@ func actionInclude(ctx context.Context, inc *spec.Include, sp *stepParams) error
 	return nil
 }
 
-func copyToDst(ctx context.Context, sp *stepParams, skipPaths []model.String, pos *model.ConfigPos, absDst, absSrc, relSrc, fromVal, fromDir string) error {
+// copyToDst copies the given file or directory into the scratch directory. It
+// returns the paths, relative to the scratch directory, of the copied files
+// whose names contain Go templates; see renderTemplatedNames.
+func copyToDst(ctx context.Context, sp *stepParams, skipPaths []model.String, gitignores *gitignore.Tree, pos *model.ConfigPos, absDst, absSrc, relSrc, fromVal, fromDir string) (templatedNames []string, _ error) {
 	logger := logging.FromContext(ctx).With("logger", "includePath")
 
 	exists, err := common.ExistsFS(sp.rp.FS, absSrc)
 	if err != nil {
-		return err //nolint:wrapcheck
+		return nil, err //nolint:wrapcheck
 	}
 	if !exists {
-		return pos.Errorf("include path doesn't exist: %q", absSrc)
+		return nil, pos.Errorf("include path doesn't exist: %q", absSrc)
 	}
 
+	ig := sp.ignorer()
+	limits := sp.rp.outputLimits()
+	tally := &outputTally{limits: limits}
 	params := &common.CopyParams{
-		DryRun:  false, // This copy targets a temp directory, so always do it.
-		DstRoot: absDst,
-		FS:      sp.rp.FS,
-		SrcRoot: absSrc,
+		DryRun:           false, // This copy targets a temp directory, so always do it.
+		DstRoot:          absDst,
+		FS:               sp.rp.FS,
+		PreserveMetadata: sp.preserveMetadata,
+		PreserveXattrs:   sp.preserveXattrs,
+		SrcRoot:          absSrc,
 		Visitor: func(relToSrcRoot string, de fs.DirEntry) (common.CopyHint, error) {
+			// Stop promptly if the render was canceled or the step timed out.
+			if err := ctx.Err(); err != nil {
+				return common.CopyHint{}, err //nolint:wrapcheck
+			}
 			for _, skipPath := range skipPaths {
 				matched := (skipPath.Val == filepath.Join(relSrc, relToSrcRoot))
 				if !sp.features.SkipGlobs {
@@ -81,7 +96,7 @@ func copyToDst(ctx context.Context, sp *stepParams, skipPaths []model.String, po
 			if err != nil {
 				return common.CopyHint{}, fmt.Errorf("filepath.Rel(%s,%s)=%w", fromDir, absSrc, err)
 			}
-			matched, err := checkIgnore(sp.ignorePatterns, relToFromDir)
+			matched, err := ig.ignored(relToFromDir, de.IsDir())
 			if err != nil {
 				return common.CopyHint{},
 					fmt.Errorf("failed to match path(%q) with ignore patterns: %w", relToFromDir, err)
@@ -92,9 +107,30 @@ func copyToDst(ctx context.Context, sp *stepParams, skipPaths []model.String, po
 					Skip: true,
 				}, nil
 			}
+			if gitignores != nil {
+				ignored, err := gitignores.Ignored(relToFromDir, de.IsDir())
+				if err != nil {
+					return common.CopyHint{}, err //nolint:wrapcheck
+				}
+				if ignored {
+					logger.DebugContext(ctx, "path ignored by .gitignore", "path", relToFromDir)
+					return common.CopyHint{
+						Skip: true,
+					}, nil
+				}
+			}
 			if !de.IsDir() {
+				// This may differ from relToFromDir if the include used "as".
+				relToScratch, err := filepath.Rel(sp.scratchDir, filepath.Join(absDst, relToSrcRoot))
+				if err != nil {
+					return common.CopyHint{}, fmt.Errorf("filepath.Rel(%s,%s)=%w", sp.scratchDir, absDst, err)
+				}
+				delete(sp.movedFromDest, relToScratch)
 				if fromVal == "destination" {
-					sp.includedFromDest[relToFromDir] = fromDir
+					sp.includedFromDest[relToScratch] = fromDir
+					if relToScratch != relToFromDir {
+						sp.movedFromDest[relToScratch] = relToFromDir
+					}
 				} else {
 					// Edge case: suppose this sequence of events occurs:
 					//  1. A given path is `include`d with from==destination
@@ -108,7 +144,24 @@ func copyToDst(ctx context.Context, sp *stepParams, skipPaths []model.String, po
 					//     first. In the metadata that tracks whether the file
 					//     was included from destination, we should delete the
 					//     record of this path being included from destination.
-					delete(sp.includedFromDest, relToFromDir)
+					delete(sp.includedFromDest, relToScratch)
+
+					if !sp.features.SkipConditionalPaths && strings.Contains(relToScratch, "{{") {
+						templatedNames = append(templatedNames, relToScratch)
+					}
+				}
+
+				// Check the limits as each file is copied, rather than only
+				// after the step, so that including a huge directory fails
+				// before it fills the disk.
+				if limits.enabled() {
+					info, err := de.Info()
+					if err != nil {
+						return common.CopyHint{}, err //nolint:wrapcheck
+					}
+					if err := tally.add(relToScratch, info.Size()); err != nil {
+						return common.CopyHint{}, err
+					}
 				}
 			}
 
@@ -121,8 +174,61 @@ func copyToDst(ctx context.Context, sp *stepParams, skipPaths []model.String, po
 			}, nil
 		},
 	}
-	if err := common.CopyRecursive(ctx, pos, params); err != nil {
-		return pos.Errorf("copying failed: %w", err)
+	if _, err := common.CopyRecursive(ctx, pos, params); err != nil {
+		return nil, pos.Errorf("copying failed: %w", err)
+	}
+	return templatedNames, nil
+}
+
+// renderTemplatedNames executes the Go templates in the names of the given
+// files in the scratch directory, and moves each file to its rendered name.
+// Only the path components containing "{{" are rendered. If any component
+// renders to an empty string, the file is removed instead; this allows names
+// like "{{if .use_docker}}Dockerfile{{end}}" to include a file conditionally
+// without a separate step.
+func renderTemplatedNames(ctx context.Context, sp *stepParams, pos *model.ConfigPos, relPaths []string) error {
+	logger := logging.FromContext(ctx).With("logger", "renderTemplatedNames")
+
+	for _, relPath := range relPaths {
+		parts := strings.Split(relPath, string(filepath.Separator))
+		keep := true
+		for i, part := range parts {
+			if !strings.Contains(part, "{{") {
+				continue
+			}
+			rendered, err := gotmpl.ParseExec(pos, part, sp.scope)
+			if err != nil {
+				return pos.Errorf("failed rendering the templated file name %q: %w", relPath, err)
+			}
+			rendered = strings.TrimSpace(rendered)
+			if rendered == "" {
+				keep = false
+				break
+			}
+			if rendered == "." || rendered == ".." || strings.ContainsAny(rendered, `/\`) {
+				return pos.Errorf("the templated file name %q rendered to %q, which is not a valid name for a single file or directory", part, rendered)
+			}
+			parts[i] = rendered
+		}
+
+		oldPath := filepath.Join(sp.scratchDir, relPath)
+		if !keep {
+			logger.DebugContext(ctx, "templated file name rendered to empty, not including it", "path", relPath)
+			if err := sp.rp.FS.Remove(oldPath); err != nil {
+				return pos.Errorf("failed removing %q: %w", relPath, err)
+			}
+			continue
+		}
+
+		newRelPath := filepath.Join(parts...)
+		logger.DebugContext(ctx, "renaming file with templated name", "from", relPath, "to", newRelPath)
+		newPath := filepath.Join(sp.scratchDir, newRelPath)
+		if err := sp.rp.FS.MkdirAll(filepath.Dir(newPath), common.OwnerRWXPerms); err != nil {
+			return pos.Errorf("failed creating directory for %q: %w", newRelPath, err)
+		}
+		if err := sp.rp.FS.Rename(oldPath, newPath); err != nil {
+			return pos.Errorf("failed renaming %q to %q: %w", relPath, newRelPath, err)
+		}
 	}
 	return nil
 }
@@ -142,6 +248,16 @@ func isGlob(matchedPaths []model.String, originalPath, matchedPath string) bool
 func includePath(ctx context.Context, inc *spec.IncludePath, sp *stepParams) error {
 	// By default, we copy from the template directory.
 	fromDirs := []string{sp.templateDir}
+	if inc.From.Val == "remote" {
+		if sp.remoteIncludes == nil {
+			return inc.Pos.Errorf(`internal error: no downloader for "from: remote"`)
+		}
+		dir, err := sp.remoteIncludes.dir(ctx, inc, sp)
+		if err != nil {
+			return err
+		}
+		fromDirs = []string{dir}
+	}
 	if inc.From.Val == "destination" {
 		// We also support including files from the destination directory, so we
 		// can modify files that already exist in the destination.
@@ -154,9 +270,17 @@ func includePath(ctx context.Context, inc *spec.IncludePath, sp *stepParams) err
 		}
 	}
 
+	// Files that git ignores in the destination, like build outputs and
+	// vendored dependencies, are almost never what the template wants to
+	// modify, and there may be a lot of them.
+	var gitignores *gitignore.Tree
+	if inc.From.Val == "destination" && !inc.SkipGitignore.Val && !sp.features.SkipGitignore {
+		gitignores = gitignore.NewTree(sp.rp.FS, sp.rp.DestDir)
+	}
+
 	anyMatches := false
 	for _, fromDir := range fromDirs {
-		matched, err := includeFromOneDir(ctx, inc, sp, fromDir)
+		matched, err := includeFromOneDir(ctx, inc, sp, fromDir, gitignores)
 		if err != nil {
 			return err
 		}
@@ -178,7 +302,7 @@ func includePath(ctx context.Context, inc *spec.IncludePath, sp *stepParams) err
 // include action. The multiple source directories are effectively "overlaid" so
 // that we're actually including from all of them, with later ones taking
 // precedence over earlier ones, if the same file exists in all of them.
-func includeFromOneDir(ctx context.Context, inc *spec.IncludePath, sp *stepParams, fromDir string) (matchedAny bool, _ error) {
+func includeFromOneDir(ctx context.Context, inc *spec.IncludePath, sp *stepParams, fromDir string, gitignores *gitignore.Tree) (matchedAny bool, _ error) {
 	skipPaths, err := processPaths(inc.Skip, sp.scope)
 	if err != nil {
 		return false, err
@@ -196,6 +320,16 @@ func includeFromOneDir(ctx context.Context, inc *spec.IncludePath, sp *stepParam
 				Val: filepath.Join("testdata", "golden"),
 			},
 		)
+		// 3. the _partials directory, which holds named templates for
+		// go_template rather than output files.
+		if !sp.features.SkipPartials {
+			skipPaths = append(skipPaths, model.String{Val: partialsDir})
+		}
+	}
+	if inc.From.Val == "destination" {
+		// The .abc directory holds abc's own state, like manifests and the
+		// lock file, rather than anything the template should process.
+		skipPaths = append(skipPaths, model.String{Val: common.ABCInternalDir})
 	}
 
 	// During validation in spec.go, we've already enforced that either:
@@ -212,7 +346,7 @@ func includeFromOneDir(ctx context.Context, inc *spec.IncludePath, sp *stepParam
 
 	anyMatches := false
 	for i, p := range incPaths {
-		matchedPaths, err := processGlobs(ctx, []model.String{p}, fromDir, sp.features.SkipGlobs)
+		matchedPaths, err := processGlobs(ctx, sp.rp.FS, []model.String{p}, fromDir, sp.features.SkipGlobs)
 		if err != nil {
 			return false, err
 		}
@@ -238,7 +372,11 @@ func includeFromOneDir(ctx context.Context, inc *spec.IncludePath, sp *stepParam
 			}
 			absDst := filepath.Join(sp.scratchDir, relDst)
 
-			if err := copyToDst(ctx, sp, skipPaths, absSrc.Pos, absDst, absSrc.Val, relSrc, inc.From.Val, fromDir); err != nil {
+			templatedNames, err := copyToDst(ctx, sp, skipPaths, gitignores, absSrc.Pos, absDst, absSrc.Val, relSrc, inc.From.Val, fromDir)
+			if err != nil {
+				return false, err
+			}
+			if err := renderTemplatedNames(ctx, sp, absSrc.Pos, templatedNames); err != nil {
 				return false, err
 			}
 		}
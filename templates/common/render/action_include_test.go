@@ -26,7 +26,8 @@ import (
 	"github.com/abcxyz/abc/templates/common"
 	"github.com/abcxyz/abc/templates/common/tempdir"
 	"github.com/abcxyz/abc/templates/model"
-	spec "github.com/abcxyz/abc/templates/model/spec/v1beta6"
+	"github.com/abcxyz/abc/templates/model/spec/features"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
 	abctestutil "github.com/abcxyz/abc/templates/testutil"
 	mdl "github.com/abcxyz/abc/templates/testutil/model"
 	"github.com/abcxyz/pkg/logging"
@@ -45,8 +46,10 @@ func TestActionInclude(t *testing.T) {
 		destDirContents      map[string]string
 		inputs               map[string]string
 		ignorePatterns       []model.String
+		features             features.Features
 		wantScratchContents  map[string]string
 		wantIncludedFromDest map[string]string
+		wantMovedFromDest    map[string]string
 		statErr              error
 		wantErr              string
 	}{
@@ -480,6 +483,44 @@ func TestActionInclude(t *testing.T) {
 				"subdir/testdata/golden/test.yaml": "some yaml",
 			},
 		},
+		{
+			name: "partials_should_be_skipped",
+			include: &spec.Include{
+				Paths: []*spec.IncludePath{
+					{
+						Paths: mdl.Strings("."),
+					},
+				},
+			},
+			templateContents: map[string]string{
+				"file1.txt":                  "my file contents",
+				"_partials/header.tmpl":      "// header",
+				"subdir/_partials/file.tmpl": "not a partial",
+			},
+			wantScratchContents: map[string]string{
+				"file1.txt":                  "my file contents",
+				"subdir/_partials/file.tmpl": "not a partial",
+			},
+		},
+		{
+			name: "partials_included_for_old_api_version",
+			include: &spec.Include{
+				Paths: []*spec.IncludePath{
+					{
+						Paths: mdl.Strings("."),
+					},
+				},
+			},
+			templateContents: map[string]string{
+				"file1.txt":             "my file contents",
+				"_partials/header.tmpl": "// header",
+			},
+			features: features.Features{SkipPartials: true},
+			wantScratchContents: map[string]string{
+				"file1.txt":             "my file contents",
+				"_partials/header.tmpl": "// header",
+			},
+		},
 		{
 			name: "skip_file",
 			include: &spec.Include{
@@ -911,6 +952,134 @@ func TestActionInclude(t *testing.T) {
 			},
 			wantIncludedFromDest: map[string]string{},
 		},
+		{
+			name: "include_from_dest_with_as",
+			include: &spec.Include{
+				Paths: []*spec.IncludePath{
+					{
+						Paths: mdl.Strings("legacy/config.yaml"),
+						As:    mdl.Strings("config/config.yaml"),
+						From:  mdl.S("destination"),
+					},
+				},
+			},
+			destDirContents: map[string]string{
+				"legacy/config.yaml": "legacy contents",
+			},
+			wantScratchContents: map[string]string{
+				"config/config.yaml": "legacy contents",
+			},
+			wantIncludedFromDest: map[string]string{"config/config.yaml": destDirBaseName},
+			wantMovedFromDest:    map[string]string{"config/config.yaml": "legacy/config.yaml"},
+		},
+		{
+			name: "include_from_dest_dir_with_as",
+			include: &spec.Include{
+				Paths: []*spec.IncludePath{
+					{
+						Paths: mdl.Strings("legacy"),
+						As:    mdl.Strings("config"),
+						From:  mdl.S("destination"),
+					},
+				},
+			},
+			destDirContents: map[string]string{
+				"legacy/a.yaml":     "a contents",
+				"legacy/sub/b.yaml": "b contents",
+			},
+			wantScratchContents: map[string]string{
+				"config/a.yaml":     "a contents",
+				"config/sub/b.yaml": "b contents",
+			},
+			wantIncludedFromDest: map[string]string{
+				"config/a.yaml":     destDirBaseName,
+				"config/sub/b.yaml": destDirBaseName,
+			},
+			wantMovedFromDest: map[string]string{
+				"config/a.yaml":     "legacy/a.yaml",
+				"config/sub/b.yaml": "legacy/sub/b.yaml",
+			},
+		},
+		{
+			name: "include_from_template_replaces_include_from_dest_with_as",
+			include: &spec.Include{
+				Paths: []*spec.IncludePath{
+					{
+						Paths: mdl.Strings("legacy.txt"),
+						As:    mdl.Strings("new.txt"),
+						From:  mdl.S("destination"),
+					},
+					{
+						Paths: mdl.Strings("new.txt"),
+					},
+				},
+			},
+			templateContents: map[string]string{
+				"new.txt": "template contents",
+			},
+			destDirContents: map[string]string{
+				"legacy.txt": "legacy contents",
+			},
+			wantScratchContents: map[string]string{
+				"new.txt": "template contents",
+			},
+		},
+		{
+			name: "include_from_dest_respects_gitignore",
+			include: &spec.Include{
+				Paths: []*spec.IncludePath{
+					{
+						Paths: mdl.Strings("."),
+						From:  mdl.S("destination"),
+					},
+				},
+			},
+			destDirContents: map[string]string{
+				".gitignore":          "node_modules/\n*.o\n",
+				"main.c":              "main",
+				"main.o":              "object",
+				"node_modules/x/y.js": "dep",
+				"sub/.gitignore":      "!keep.o\n",
+				"sub/keep.o":          "kept",
+				"sub/other.o":         "object",
+			},
+			wantScratchContents: map[string]string{
+				".gitignore":     "node_modules/\n*.o\n",
+				"main.c":         "main",
+				"sub/.gitignore": "!keep.o\n",
+				"sub/keep.o":     "kept",
+			},
+			wantIncludedFromDest: map[string]string{
+				".gitignore":     destDirBaseName,
+				"main.c":         destDirBaseName,
+				"sub/.gitignore": destDirBaseName,
+				"sub/keep.o":     destDirBaseName,
+			},
+		},
+		{
+			name: "include_from_dest_skip_gitignore",
+			include: &spec.Include{
+				Paths: []*spec.IncludePath{
+					{
+						Paths:         mdl.Strings("."),
+						From:          mdl.S("destination"),
+						SkipGitignore: model.Bool{Val: true},
+					},
+				},
+			},
+			destDirContents: map[string]string{
+				".gitignore": "*.o\n",
+				"main.o":     "object",
+			},
+			wantScratchContents: map[string]string{
+				".gitignore": "*.o\n",
+				"main.o":     "object",
+			},
+			wantIncludedFromDest: map[string]string{
+				".gitignore": destDirBaseName,
+				"main.o":     destDirBaseName,
+			},
+		},
 		{
 			name: "include_from_dest_matches_no_files",
 			include: &spec.Include{
@@ -923,6 +1092,90 @@ func TestActionInclude(t *testing.T) {
 			},
 			wantErr: "include paths did not match any files: [nonexistent.txt]",
 		},
+		{
+			name: "conditional_file_names",
+			include: &spec.Include{
+				Paths: []*spec.IncludePath{
+					{
+						Paths: mdl.Strings("."),
+					},
+				},
+			},
+			templateContents: map[string]string{
+				"{{if .use_docker}}Dockerfile{{end}}":         "FROM scratch",
+				"{{if .use_bazel}}BUILD.bazel{{end}}":         "bazel",
+				"cmd/{{.service_name}}/main.go":               "package main",
+				"{{ if .use_bazel }}bazel{{ end }}/WORKSPACE": "workspace",
+				"README.md": "readme",
+			},
+			inputs: map[string]string{
+				"use_docker":   "true",
+				"use_bazel":    "",
+				"service_name": "api",
+			},
+			wantScratchContents: map[string]string{
+				"Dockerfile":      "FROM scratch",
+				"cmd/api/main.go": "package main",
+				"README.md":       "readme",
+			},
+		},
+		{
+			name: "conditional_file_names_disabled_by_feature",
+			include: &spec.Include{
+				Paths: []*spec.IncludePath{
+					{
+						Paths: mdl.Strings("."),
+					},
+				},
+			},
+			features: features.Features{SkipConditionalPaths: true},
+			templateContents: map[string]string{
+				"{{if .use_docker}}Dockerfile{{end}}": "FROM scratch",
+			},
+			inputs: map[string]string{
+				"use_docker": "true",
+			},
+			wantScratchContents: map[string]string{
+				"{{if .use_docker}}Dockerfile{{end}}": "FROM scratch",
+			},
+		},
+		{
+			name: "conditional_file_name_renders_to_path",
+			include: &spec.Include{
+				Paths: []*spec.IncludePath{
+					{
+						Paths: mdl.Strings("."),
+					},
+				},
+			},
+			templateContents: map[string]string{
+				"{{.name}}.txt": "contents",
+			},
+			inputs: map[string]string{
+				"name": "../escape",
+			},
+			wantScratchContents: map[string]string{
+				"{{.name}}.txt": "contents",
+			},
+			wantErr: `the templated file name "{{.name}}.txt" rendered to "../escape.txt", which is not a valid name`,
+		},
+		{
+			name: "conditional_file_name_unknown_var",
+			include: &spec.Include{
+				Paths: []*spec.IncludePath{
+					{
+						Paths: mdl.Strings("."),
+					},
+				},
+			},
+			templateContents: map[string]string{
+				"{{if .nope}}x{{end}}": "contents",
+			},
+			wantScratchContents: map[string]string{
+				"{{if .nope}}x{{end}}": "contents",
+			},
+			wantErr: `failed rendering the templated file name`,
+		},
 	}
 
 	for _, tc := range cases {
@@ -944,8 +1197,10 @@ func TestActionInclude(t *testing.T) {
 			abctestutil.WriteAll(t, destDir, tc.destDirContents)
 
 			sp := &stepParams{
+				features:         tc.features,
 				ignorePatterns:   tc.ignorePatterns,
 				includedFromDest: make(map[string]string),
+				movedFromDest:    make(map[string]string),
 				scope:            common.NewScope(tc.inputs, nil),
 				scratchDir:       scratchDir,
 				templateDir:      templateDir,
@@ -981,6 +1236,9 @@ func TestActionInclude(t *testing.T) {
 			if diff := cmp.Diff(sp.includedFromDest, tc.wantIncludedFromDest, opts...); diff != "" {
 				t.Errorf("includedFromDest was not as expected (-got,+want): %s", diff)
 			}
+			if diff := cmp.Diff(sp.movedFromDest, tc.wantMovedFromDest, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("movedFromDest was not as expected (-got,+want): %s", diff)
+			}
 		})
 	}
 }
@@ -0,0 +1,210 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"bytes"
+	"context"
+	"path"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common/render/gotmpl"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
+)
+
+// commentStyle is how to write a multi-line comment in some language. Either
+// linePrefix is set, for languages with line comments, or blockStart and
+// blockEnd are set, for languages that only have block comments.
+type commentStyle struct {
+	linePrefix string
+
+	blockStart      string
+	blockLinePrefix string
+	blockEnd        string
+}
+
+var (
+	slashComments = &commentStyle{linePrefix: "//"}
+	hashComments  = &commentStyle{linePrefix: "#"}
+	dashComments  = &commentStyle{linePrefix: "--"}
+	cssComments   = &commentStyle{blockStart: "/*", blockLinePrefix: " *", blockEnd: " */"}
+	htmlComments  = &commentStyle{blockStart: "<!--", blockLinePrefix: "", blockEnd: "-->"}
+)
+
+// commentStylesByExt are the comment styles of the languages that the
+// license_header action knows, by lowercase file extension.
+var commentStylesByExt = map[string]*commentStyle{
+	".c":      slashComments,
+	".cc":     slashComments,
+	".cpp":    slashComments,
+	".cs":     slashComments,
+	".dart":   slashComments,
+	".go":     slashComments,
+	".gradle": slashComments,
+	".groovy": slashComments,
+	".h":      slashComments,
+	".hpp":    slashComments,
+	".java":   slashComments,
+	".js":     slashComments,
+	".jsx":    slashComments,
+	".kt":     slashComments,
+	".kts":    slashComments,
+	".mjs":    slashComments,
+	".php":    slashComments,
+	".proto":  slashComments,
+	".rs":     slashComments,
+	".scala":  slashComments,
+	".swift":  slashComments,
+	".ts":     slashComments,
+	".tsx":    slashComments,
+
+	".bash":   hashComments,
+	".bzl":    hashComments,
+	".hcl":    hashComments,
+	".mk":     hashComments,
+	".pl":     hashComments,
+	".ps1":    hashComments,
+	".py":     hashComments,
+	".r":      hashComments,
+	".rb":     hashComments,
+	".sh":     hashComments,
+	".tf":     hashComments,
+	".tfvars": hashComments,
+	".toml":   hashComments,
+	".yaml":   hashComments,
+	".yml":    hashComments,
+	".zsh":    hashComments,
+
+	".hs":  dashComments,
+	".lua": dashComments,
+	".sql": dashComments,
+
+	".css":  cssComments,
+	".less": cssComments,
+	".scss": cssComments,
+
+	".htm":  htmlComments,
+	".html": htmlComments,
+	".md":   htmlComments,
+	".vue":  htmlComments,
+	".xml":  htmlComments,
+}
+
+// commentStylesByName are the comment styles for files that are recognized by
+// their whole name rather than their extension.
+var commentStylesByName = map[string]*commentStyle{
+	"BUILD":          hashComments,
+	"BUILD.bazel":    hashComments,
+	"CMakeLists.txt": hashComments,
+	"Dockerfile":     hashComments,
+	"Makefile":       hashComments,
+	"WORKSPACE":      hashComments,
+}
+
+// headerPreamblePrefixes are the beginnings of first lines that must stay at
+// the top of the file, above the header.
+var headerPreamblePrefixes = []string{"#!", "<?xml", "<?php"}
+
+// commentStyleFor returns the comment style for the file at the given
+// slash-separated path, or nil if the language isn't known.
+func commentStyleFor(relPath string) *commentStyle {
+	base := path.Base(relPath)
+	if s, ok := commentStylesByName[base]; ok {
+		return s
+	}
+	if strings.HasPrefix(base, "Dockerfile.") {
+		return hashComments
+	}
+	return commentStylesByExt[strings.ToLower(path.Ext(base))]
+}
+
+// comment returns text as a comment in this style, ending with a newline.
+func (c *commentStyle) comment(text string) string {
+	var sb strings.Builder
+	lines := strings.Split(text, "\n")
+	if c.linePrefix != "" {
+		for _, line := range lines {
+			sb.WriteString(strings.TrimRight(c.linePrefix+" "+line, " "))
+			sb.WriteByte('\n')
+		}
+		return sb.String()
+	}
+	sb.WriteString(c.blockStart + "\n")
+	for _, line := range lines {
+		sb.WriteString(strings.TrimRight(c.blockLinePrefix+" "+line, " "))
+		sb.WriteByte('\n')
+	}
+	sb.WriteString(c.blockEnd + "\n")
+	return sb.String()
+}
+
+func actionLicenseHeader(ctx context.Context, l *spec.LicenseHeader, sp *stepParams) error {
+	text, err := gotmpl.ParseExec(l.Text.Pos, l.Text.Val, sp.scope)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	text = strings.Trim(text, "\n")
+	if text == "" {
+		return l.Text.Pos.Errorf(`"text" must not be empty`)
+	}
+	skipIfContains, err := gotmpl.ParseExec(l.SkipIfContains.Pos, l.SkipIfContains.Val, sp.scope)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	skip := func(relPath string) (bool, error) {
+		// Files in languages that aren't known are left alone, so that
+		// "paths" can be a whole directory.
+		return commentStyleFor(relPath) == nil, nil
+	}
+	return walkAndModifyPaths(ctx, sp, l.Paths, skip, func(relPath string, buf []byte) ([]byte, error) {
+		header := []byte(commentStyleFor(relPath).comment(text))
+		if bytes.Contains(buf, header) || (skipIfContains != "" && bytes.Contains(buf, []byte(skipIfContains))) {
+			return buf, nil
+		}
+		return prependHeader(buf, header), nil
+	}, nil)
+}
+
+// prependHeader adds the header to the top of the file, followed by a blank
+// line, keeping any line that must come first (like a shebang) above it.
+func prependHeader(buf, header []byte) []byte {
+	var preamble []byte
+	for _, prefix := range headerPreamblePrefixes {
+		if !bytes.HasPrefix(buf, []byte(prefix)) {
+			continue
+		}
+		end := bytes.IndexByte(buf, '\n')
+		if end < 0 {
+			preamble, buf = append(buf, '\n'), nil
+		} else {
+			preamble, buf = buf[:end+1], buf[end+1:]
+		}
+		break
+	}
+	buf = bytes.TrimLeft(buf, "\n")
+
+	out := make([]byte, 0, len(preamble)+len(header)+len(buf)+2)
+	if len(preamble) > 0 {
+		out = append(out, preamble...)
+		out = append(out, '\n')
+	}
+	out = append(out, header...)
+	if len(buf) > 0 {
+		out = append(out, '\n')
+		out = append(out, buf...)
+	}
+	return out
+}
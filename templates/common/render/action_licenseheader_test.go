@@ -0,0 +1,163 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	mdl "github.com/abcxyz/abc/templates/testutil/model"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestActionLicenseHeader(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name           string
+		paths          []string
+		text           string
+		skipIfContains string
+		inputs         map[string]string
+
+		initialContents map[string]string
+		want            map[string]string
+		wantErr         string
+	}{
+		{
+			name:  "comment_style_by_language",
+			paths: []string{"."},
+			text:  "Copyright {{.year}} Example\n\nLicensed under the Apache License.\n",
+			inputs: map[string]string{
+				"year": "2024",
+			},
+			initialContents: map[string]string{
+				"main.go":       "package main\n",
+				"run.py":        "print('hi')\n",
+				"query.sql":     "SELECT 1;\n",
+				"style.css":     "body {}\n",
+				"index.html":    "<p>hi</p>\n",
+				"Dockerfile":    "FROM scratch\n",
+				"data.json":     "{}\n",
+				"sub/lib.TS":    "export {};\n",
+				"empty_file.sh": "",
+			},
+			want: map[string]string{
+				"main.go":       "// Copyright 2024 Example\n//\n// Licensed under the Apache License.\n\npackage main\n",
+				"run.py":        "# Copyright 2024 Example\n#\n# Licensed under the Apache License.\n\nprint('hi')\n",
+				"query.sql":     "-- Copyright 2024 Example\n--\n-- Licensed under the Apache License.\n\nSELECT 1;\n",
+				"style.css":     "/*\n * Copyright 2024 Example\n *\n * Licensed under the Apache License.\n */\n\nbody {}\n",
+				"index.html":    "<!--\n Copyright 2024 Example\n\n Licensed under the Apache License.\n-->\n\n<p>hi</p>\n",
+				"Dockerfile":    "# Copyright 2024 Example\n#\n# Licensed under the Apache License.\n\nFROM scratch\n",
+				"data.json":     "{}\n",
+				"sub/lib.TS":    "// Copyright 2024 Example\n//\n// Licensed under the Apache License.\n\nexport {};\n",
+				"empty_file.sh": "# Copyright 2024 Example\n#\n# Licensed under the Apache License.\n",
+			},
+		},
+		{
+			name:  "preamble_stays_first",
+			paths: []string{"."},
+			text:  "Copyright Example",
+			initialContents: map[string]string{
+				"run.sh":     "#!/bin/bash\nset -e\n",
+				"pom.xml":    "<?xml version=\"1.0\"?>\n<project/>\n",
+				"no_body.sh": "#!/bin/sh",
+			},
+			want: map[string]string{
+				"run.sh":     "#!/bin/bash\n\n# Copyright Example\n\nset -e\n",
+				"pom.xml":    "<?xml version=\"1.0\"?>\n\n<!--\n Copyright Example\n-->\n\n<project/>\n",
+				"no_body.sh": "#!/bin/sh\n\n# Copyright Example\n",
+			},
+		},
+		{
+			name:  "existing_header_is_skipped",
+			paths: []string{"main.go"},
+			text:  "Copyright Example",
+			initialContents: map[string]string{
+				"main.go": "// Copyright Example\n\npackage main\n",
+			},
+			want: map[string]string{
+				"main.go": "// Copyright Example\n\npackage main\n",
+			},
+		},
+		{
+			name:           "skip_if_contains",
+			paths:          []string{"."},
+			text:           "Copyright 2024 Example",
+			skipIfContains: "Copyright",
+			initialContents: map[string]string{
+				"old.go": "// Copyright 2019 Example\n\npackage main\n",
+				"new.go": "package main\n",
+			},
+			want: map[string]string{
+				"old.go": "// Copyright 2019 Example\n\npackage main\n",
+				"new.go": "// Copyright 2024 Example\n\npackage main\n",
+			},
+		},
+		{
+			name:            "empty_text_should_fail",
+			paths:           []string{"main.go"},
+			text:            "{{.nothing}}",
+			inputs:          map[string]string{"nothing": ""},
+			initialContents: map[string]string{"main.go": "package main\n"},
+			want:            map[string]string{"main.go": "package main\n"},
+			wantErr:         `"text" must not be empty`,
+		},
+		{
+			name:            "missing_file_should_fail",
+			paths:           []string{"main.go"},
+			text:            "Copyright Example",
+			initialContents: map[string]string{},
+			want:            map[string]string{},
+			wantErr:         "no paths were matched by: [main.go]",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			scratchDir := t.TempDir()
+			abctestutil.WriteAll(t, scratchDir, tc.initialContents)
+
+			l := &spec.LicenseHeader{
+				Paths:          mdl.Strings(tc.paths...),
+				Text:           mdl.S(tc.text),
+				SkipIfContains: mdl.S(tc.skipIfContains),
+			}
+			sp := &stepParams{
+				scope:      common.NewScope(tc.inputs, nil),
+				scratchDir: scratchDir,
+				rp:         &Params{FS: &common.RealFS{}},
+			}
+			err := actionLicenseHeader(context.Background(), l, sp)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+
+			got := abctestutil.LoadDir(t, scratchDir)
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("scratch directory contents were not as expected (-got,+want): %v", diff)
+			}
+		})
+	}
+}
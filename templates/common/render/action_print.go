@@ -17,10 +17,11 @@ package render
 import (
 	"context"
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/abcxyz/abc/templates/common/render/gotmpl"
-	spec "github.com/abcxyz/abc/templates/model/spec/v1beta6"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
 )
 
 func actionPrint(_ context.Context, p *spec.Print, sp *stepParams) error {
@@ -30,6 +31,9 @@ func actionPrint(_ context.Context, p *spec.Print, sp *stepParams) error {
 	if err != nil {
 		return err //nolint:wrapcheck
 	}
+	if p.Format.Val == spec.PrintFormatMarkdown && shouldStyleMarkdown(sp.rp.Stdout, os.Getenv) {
+		msg = renderMarkdown(msg)
+	}
 	if !strings.HasSuffix(msg, "\n") {
 		msg += "\n"
 	}
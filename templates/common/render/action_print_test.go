@@ -22,7 +22,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 
 	"github.com/abcxyz/abc/templates/common"
-	spec "github.com/abcxyz/abc/templates/model/spec/v1beta6"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
 	mdl "github.com/abcxyz/abc/templates/testutil/model"
 	"github.com/abcxyz/pkg/logging"
 	"github.com/abcxyz/pkg/testutil"
@@ -34,6 +34,7 @@ func TestActionPrint(t *testing.T) {
 	cases := []struct {
 		name           string
 		in             string
+		format         string
 		inputs         map[string]string
 		extraPrintVars map[string]string
 		want           string
@@ -67,6 +68,15 @@ func TestActionPrint(t *testing.T) {
 			},
 			want: "mydest mysource\n",
 		},
+		{
+			name:   "markdown_is_raw_when_not_a_terminal",
+			in:     "# Next steps\n\nRun `make` in [the dir]({{._flag_dest}})",
+			format: "markdown",
+			extraPrintVars: map[string]string{
+				"_flag_dest": "mydest",
+			},
+			want: "# Next steps\n\nRun `make` in [the dir](mydest)\n",
+		},
 	}
 
 	for _, tc := range cases {
@@ -88,6 +98,7 @@ func TestActionPrint(t *testing.T) {
 			}
 			pr := &spec.Print{
 				Message: mdl.S(tc.in),
+				Format:  mdl.S(tc.format),
 			}
 			err := actionPrint(ctx, pr, sp)
 			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
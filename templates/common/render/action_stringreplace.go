@@ -19,7 +19,7 @@ import (
 	"strings"
 
 	"github.com/abcxyz/abc/templates/common/render/gotmpl"
-	spec "github.com/abcxyz/abc/templates/model/spec/v1beta6"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
 )
 
 func actionStringReplace(ctx context.Context, sr *spec.StringReplace, sp *stepParams) error {
@@ -37,9 +37,16 @@ func actionStringReplace(ctx context.Context, sr *spec.StringReplace, sp *stepPa
 	}
 	replacer := strings.NewReplacer(replacerArgs...)
 
-	if err := walkAndModify(ctx, sp, sr.Paths, func(buf []byte) ([]byte, error) {
+	// Streaming isn't possible if a to_replace templated to the empty string;
+	// in that case, large files are processed in memory like all others.
+	var streamer walkAndModifyStreamer
+	if streamRepl, ok := newStreamReplacer(replacerArgs...); ok {
+		streamer = streamRepl.replace
+	}
+
+	if err := walkAndModifyStreaming(ctx, sp, sr.Paths, func(buf []byte) ([]byte, error) {
 		return []byte(replacer.Replace(string(buf))), nil
-	}); err != nil {
+	}, streamer); err != nil {
 		return err
 	}
 
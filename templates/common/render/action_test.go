@@ -19,7 +19,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -29,6 +32,7 @@ import (
 	"github.com/abcxyz/abc/templates/common/errs"
 	"github.com/abcxyz/abc/templates/common/render/gotmpl"
 	"github.com/abcxyz/abc/templates/model"
+	"github.com/abcxyz/abc/templates/model/spec/features"
 	abctestutil "github.com/abcxyz/abc/templates/testutil"
 	mdl "github.com/abcxyz/abc/templates/testutil/model"
 	"github.com/abcxyz/pkg/logging"
@@ -53,6 +57,8 @@ func TestWalkAndModify(t *testing.T) {
 		initialContents map[string]string
 		want            map[string]string
 		wantErr         string
+		ignorePatterns  []model.String
+		features        features.Features
 
 		// fakeable errors
 		readFileErr  error
@@ -65,6 +71,39 @@ func TestWalkAndModify(t *testing.T) {
 			initialContents: map[string]string{"my_file.txt": "abc foo def"},
 			want:            map[string]string{"my_file.txt": "abc bar def"},
 		},
+		{
+			name:     "ignored_paths_not_modified",
+			visitor:  fooToBarVisitor,
+			relPaths: []string{"."},
+			initialContents: map[string]string{
+				"a.txt":          "foo",
+				"b.log":          "foo",
+				"keep.log":       "foo",
+				"vendor/x/c.txt": "foo",
+			},
+			ignorePatterns: mdl.Strings("*.log", "!keep.log", "vendor/"),
+			want: map[string]string{
+				"a.txt":          "bar",
+				"b.log":          "foo",
+				"keep.log":       "bar",
+				"vendor/x/c.txt": "foo",
+			},
+		},
+		{
+			name:     "ignored_paths_modified_with_old_api_version",
+			visitor:  fooToBarVisitor,
+			relPaths: []string{"."},
+			initialContents: map[string]string{
+				"a.txt": "foo",
+				"b.log": "foo",
+			},
+			ignorePatterns: mdl.Strings("*.log"),
+			features:       features.Features{SkipGitignorePatterns: true},
+			want: map[string]string{
+				"a.txt": "bar",
+				"b.log": "bar",
+			},
+		},
 		{
 			name:            "repeated_file_only_visited_once",
 			visitor:         fooToFooFooVisitor,
@@ -212,6 +251,30 @@ func TestWalkAndModify(t *testing.T) {
 			initialContents: map[string]string{"my_file.txt": "abc foo def"},
 			want:            map[string]string{"my_file.txt": "abc bar def"},
 		},
+		{
+			name: "errors_from_all_files_returned_in_walk_order",
+			visitor: func(buf []byte) ([]byte, error) {
+				if bytes.HasPrefix(buf, []byte("fail")) {
+					return nil, fmt.Errorf("fake error %s", buf)
+				}
+				return bytes.ReplaceAll(buf, []byte("foo"), []byte("bar")), nil
+			},
+			relPaths: []string{"."},
+			initialContents: map[string]string{
+				"a.txt": "fail1",
+				"b.txt": "foo",
+				"c.txt": "fail2",
+				"d.txt": "foo",
+			},
+			want: map[string]string{
+				"a.txt": "fail1",
+				"b.txt": "bar",
+				"c.txt": "fail2",
+				"d.txt": "bar",
+			},
+			wantErr: "when processing template file \"a.txt\": fake error fail1\n" +
+				"when processing template file \"c.txt\": fake error fail2",
+		},
 	}
 
 	for _, tc := range cases {
@@ -223,6 +286,8 @@ func TestWalkAndModify(t *testing.T) {
 			abctestutil.WriteAll(t, scratchDir, tc.initialContents)
 
 			sp := &stepParams{
+				features:         tc.features,
+				ignorePatterns:   tc.ignorePatterns,
 				scope:            common.NewScope(nil, nil),
 				scratchDir:       scratchDir,
 				includedFromDest: make(map[string]string),
@@ -255,6 +320,45 @@ func TestWalkAndModify(t *testing.T) {
 	}
 }
 
+func BenchmarkWalkAndModify(b *testing.B) {
+	// Enough files, with enough work per file, that the per-file cost
+	// dominates and the benefit of visiting files in parallel is visible.
+	const numFiles = 256
+	contents := make(map[string]string, numFiles)
+	for i := 0; i < numFiles; i++ {
+		contents[fmt.Sprintf("dir%d/file%d.txt", i%8, i)] = strings.Repeat("abc foo def\n", 4096)
+	}
+	visitor := func(buf []byte) ([]byte, error) {
+		return bytes.ReplaceAll(buf, []byte("foo"), []byte("bar")), nil
+	}
+
+	ctx := logging.WithLogger(context.Background(), logging.New(io.Discard, logging.LevelError, logging.FormatText, false))
+	paths := []model.String{mdl.S(".")}
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("gomaxprocs_%d", workers), func(b *testing.B) {
+			defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(workers))
+
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				scratchDir := b.TempDir()
+				abctestutil.WriteAll(b, scratchDir, contents)
+				sp := &stepParams{
+					scope:            common.NewScope(nil, nil),
+					scratchDir:       scratchDir,
+					includedFromDest: make(map[string]string),
+					rp:               &Params{FS: &common.RealFS{}},
+				}
+				b.StartTimer()
+
+				if err := walkAndModify(ctx, sp, paths, visitor); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
 func TestParseAndExecuteGoTmpl(t *testing.T) {
 	t.Parallel()
 
@@ -536,7 +640,7 @@ func TestProcessGlobs(t *testing.T) {
 			abctestutil.WriteAllMode(t, tempDir, tc.dirContents)
 			ctx := context.Background()
 
-			gotPaths, err := processGlobs(ctx, tc.paths, tempDir, tc.skipGlobs)
+			gotPaths, err := processGlobs(ctx, &common.RealFS{}, tc.paths, tempDir, tc.skipGlobs)
 			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
 				t.Error(diff)
 			}
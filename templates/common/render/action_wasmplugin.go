@@ -0,0 +1,265 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	experimentalsys "github.com/tetratelabs/wazero/experimental/sys"
+	"github.com/tetratelabs/wazero/experimental/sysfs"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/render/gotmpl"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
+)
+
+const (
+	// The most memory that a wasm module may use, in 64KiB pages (256MiB).
+	wasmMemoryLimitPages = 4096
+
+	// How long a wasm action may run before it's killed.
+	wasmTimeout = 5 * time.Minute
+)
+
+// actionWasm runs a custom action implemented as a WASI command module. The
+// module's host API is deliberately small:
+//
+//   - The scratch directory is its whole filesystem, mounted at "/" and
+//     writable. It can't create symlinks or follow any that are there, since
+//     wazero's directory mounts don't stop a symlink from pointing outside.
+//   - Every template variable in scope is an environment variable of the same
+//     name.
+//   - Its args are the templated "args" param, after the module path.
+//   - Its stdout is printed like a print action, and its stderr is included in
+//     the error if it exits with a nonzero code.
+//
+// It has no network access, and its clock and random source are
+// deterministic, because wazero doesn't give modules the real ones unless
+// asked.
+func actionWasm(ctx context.Context, w *spec.Wasm, sp *stepParams) error {
+	relModule, err := common.SafeRelPath(w.Module.Pos, w.Module.Val)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	buf, err := sp.rp.FS.ReadFile(filepath.Join(sp.templateDir, relModule))
+	if err != nil {
+		return w.Module.Pos.Errorf("failed reading wasm module: %w", err)
+	}
+	args, err := gotmpl.ParseExecAll(w.Args, sp.scope)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, wasmTimeout)
+	defer cancel()
+
+	rt := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(wasmMemoryLimitPages).
+		WithCloseOnContextDone(true))
+	defer rt.Close(ctx)
+
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, rt); err != nil {
+		return fmt.Errorf("failed setting up WASI: %w", err)
+	}
+
+	compiled, err := rt.CompileModule(ctx, buf)
+	if err != nil {
+		return w.Module.Pos.Errorf("invalid wasm module %q: %w", relModule, err)
+	}
+	if err := validateWasmModule(compiled); err != nil {
+		return w.Module.Pos.Errorf("invalid wasm module %q: %w", relModule, err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cfg := wazero.NewModuleConfig().
+		WithArgs(append([]string{relModule}, args...)...).
+		WithFSConfig(wazero.NewFSConfig().(sysfs.FSConfig).WithSysFSMount(
+			&noSymlinkFS{FS: sysfs.DirFS(sp.scratchDir)}, "/")).
+		WithStdout(&stdout).
+		WithStderr(&stderr)
+	vars := sp.scope.AllVars()
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cfg = cfg.WithEnv(name, vars[name])
+	}
+
+	if _, err := rt.InstantiateModule(ctx, compiled, cfg); err != nil {
+		exitErr := &sys.ExitError{}
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 0 {
+			msg := fmt.Sprintf("wasm module %q failed: %v", relModule, err)
+			if s := strings.TrimSpace(stderr.String()); s != "" {
+				msg += "; its stderr was:\n" + s
+			}
+			return w.Pos.Errorf("%s", msg)
+		}
+	}
+
+	if sp.suppressPrint || stdout.Len() == 0 {
+		return nil
+	}
+	if _, err := sp.rp.Stdout.Write(stdout.Bytes()); err != nil {
+		return fmt.Errorf("error writing to stdout: %w", err)
+	}
+	return nil
+}
+
+// validateWasmModule checks that the module is a WASI command that doesn't
+// need anything from the host besides WASI.
+func validateWasmModule(m wazero.CompiledModule) error {
+	if _, ok := m.ExportedFunctions()["_start"]; !ok {
+		return fmt.Errorf(`it must be a WASI command that exports a "_start" function`)
+	}
+	for _, f := range m.ImportedFunctions() {
+		if mod, name, _ := f.Import(); mod != wasi_snapshot_preview1.ModuleName {
+			return fmt.Errorf("it imports %s.%s, but only %s functions are available", mod, name, wasi_snapshot_preview1.ModuleName)
+		}
+	}
+	return nil
+}
+
+// noSymlinkFS is the filesystem given to wasm modules. It refuses to create
+// symlinks, and fails with ELOOP for any name that goes through one, so a
+// module can't use a symlink to reach files outside of the mount.
+type noSymlinkFS struct {
+	experimentalsys.FS
+}
+
+// checkPath returns ELOOP if any element of the path is a symlink. Paths are
+// relative to the root of the mount, and already cleaned by wazero.
+func (n *noSymlinkFS) checkPath(name string) experimentalsys.Errno {
+	prefix := ""
+	for _, elem := range strings.Split(name, "/") {
+		if elem == "" || elem == "." {
+			continue
+		}
+		prefix += elem
+		st, errno := n.FS.Lstat(prefix)
+		if errno == experimentalsys.ENOENT {
+			// The rest of the path doesn't exist yet, so it can't hold
+			// symlinks either.
+			return 0
+		}
+		if errno != 0 {
+			return errno
+		}
+		if st.Mode&fs.ModeSymlink != 0 {
+			return experimentalsys.ELOOP
+		}
+		prefix += "/"
+	}
+	return 0
+}
+
+func (n *noSymlinkFS) OpenFile(name string, flag experimentalsys.Oflag, perm fs.FileMode) (experimentalsys.File, experimentalsys.Errno) {
+	if errno := n.checkPath(name); errno != 0 {
+		return nil, errno
+	}
+	return n.FS.OpenFile(name, flag, perm) //nolint:wrapcheck
+}
+
+func (n *noSymlinkFS) Lstat(name string) (sys.Stat_t, experimentalsys.Errno) {
+	if errno := n.checkPath(path.Dir(name)); errno != 0 {
+		return sys.Stat_t{}, errno
+	}
+	return n.FS.Lstat(name) //nolint:wrapcheck
+}
+
+func (n *noSymlinkFS) Stat(name string) (sys.Stat_t, experimentalsys.Errno) {
+	if errno := n.checkPath(name); errno != 0 {
+		return sys.Stat_t{}, errno
+	}
+	return n.FS.Stat(name) //nolint:wrapcheck
+}
+
+func (n *noSymlinkFS) Mkdir(name string, perm fs.FileMode) experimentalsys.Errno {
+	if errno := n.checkPath(name); errno != 0 {
+		return errno
+	}
+	return n.FS.Mkdir(name, perm) //nolint:wrapcheck
+}
+
+func (n *noSymlinkFS) Chmod(name string, perm fs.FileMode) experimentalsys.Errno {
+	if errno := n.checkPath(name); errno != 0 {
+		return errno
+	}
+	return n.FS.Chmod(name, perm) //nolint:wrapcheck
+}
+
+func (n *noSymlinkFS) Rename(from, to string) experimentalsys.Errno {
+	if errno := n.checkPath(path.Dir(from)); errno != 0 {
+		return errno
+	}
+	if errno := n.checkPath(to); errno != 0 {
+		return errno
+	}
+	return n.FS.Rename(from, to) //nolint:wrapcheck
+}
+
+func (n *noSymlinkFS) Rmdir(name string) experimentalsys.Errno {
+	if errno := n.checkPath(name); errno != 0 {
+		return errno
+	}
+	return n.FS.Rmdir(name) //nolint:wrapcheck
+}
+
+// Unlink checks only the parent directory, so that a symlink can still be
+// deleted.
+func (n *noSymlinkFS) Unlink(name string) experimentalsys.Errno {
+	if errno := n.checkPath(path.Dir(name)); errno != 0 {
+		return errno
+	}
+	return n.FS.Unlink(name) //nolint:wrapcheck
+}
+
+func (n *noSymlinkFS) Link(oldPath, newPath string) experimentalsys.Errno {
+	if errno := n.checkPath(oldPath); errno != 0 {
+		return errno
+	}
+	if errno := n.checkPath(newPath); errno != 0 {
+		return errno
+	}
+	return n.FS.Link(oldPath, newPath) //nolint:wrapcheck
+}
+
+func (n *noSymlinkFS) Symlink(oldPath, linkName string) experimentalsys.Errno {
+	return experimentalsys.EPERM
+}
+
+func (n *noSymlinkFS) Readlink(name string) (string, experimentalsys.Errno) {
+	return "", experimentalsys.EPERM
+}
+
+func (n *noSymlinkFS) Utimens(name string, atim, mtim int64) experimentalsys.Errno {
+	if errno := n.checkPath(name); errno != 0 {
+		return errno
+	}
+	return n.FS.Utimens(name, atim, mtim) //nolint:wrapcheck
+}
@@ -0,0 +1,215 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/abcxyz/abc/templates/common"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	mdl "github.com/abcxyz/abc/templates/testutil/model"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+var (
+	buildWasmPluginOnce sync.Once
+	wasmPlugin          []byte
+	wasmPluginErr       error
+)
+
+// testWasmPlugin compiles testdata/wasmplugin to WebAssembly, once per test
+// run, and returns the module.
+func testWasmPlugin(tb testing.TB) []byte {
+	tb.Helper()
+
+	buildWasmPluginOnce.Do(func() {
+		dir, err := os.MkdirTemp("", "wasmplugin-")
+		if err != nil {
+			wasmPluginErr = err
+			return
+		}
+		defer os.RemoveAll(dir)
+
+		out := filepath.Join(dir, "plugin.wasm")
+		cmd := exec.Command("go", "build", "-o", out, "./testdata/wasmplugin")
+		cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm", "CGO_ENABLED=0")
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			wasmPluginErr = &buildError{err: err, stderr: stderr.String()}
+			return
+		}
+		wasmPlugin, wasmPluginErr = os.ReadFile(out)
+	})
+	if wasmPluginErr != nil {
+		tb.Fatalf("failed building the test wasm plugin: %v", wasmPluginErr)
+	}
+	return wasmPlugin
+}
+
+type buildError struct {
+	err    error
+	stderr string
+}
+
+func (b *buildError) Error() string {
+	return b.err.Error() + ": " + b.stderr
+}
+
+func TestActionWasm(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name            string
+		module          string
+		moduleContents  []byte // if nil, the test plugin
+		args            []string
+		inputs          map[string]string
+		suppressPrint   bool
+		initialContents map[string]string
+		want            map[string]string
+		wantStdout      string
+		wantErr         string
+	}{
+		{
+			name:            "modifies_scratch_files",
+			args:            []string{"upper", "{{.file}}", "dir/b.txt"},
+			inputs:          map[string]string{"file": "a.txt"},
+			initialContents: map[string]string{"a.txt": "aaa", "dir/b.txt": "bbb", "c.txt": "ccc"},
+			want:            map[string]string{"a.txt": "AAA", "dir/b.txt": "BBB", "c.txt": "ccc"},
+			wantStdout:      "uppercased a.txt\nuppercased dir/b.txt\n",
+		},
+		{
+			name:            "suppress_print",
+			args:            []string{"upper", "a.txt"},
+			suppressPrint:   true,
+			initialContents: map[string]string{"a.txt": "aaa"},
+			want:            map[string]string{"a.txt": "AAA"},
+		},
+		{
+			name:   "reads_inputs",
+			args:   []string{"greet", "greeting.txt"},
+			inputs: map[string]string{"person": "alice"},
+			want:   map[string]string{"greeting.txt": "hello, alice\n"},
+		},
+		{
+			name: "cannot_escape_scratch_dir",
+			args: []string{"escape"},
+		},
+		{
+			name:            "module_error",
+			args:            []string{"fail"},
+			initialContents: map[string]string{"a.txt": "aaa"},
+			want:            map[string]string{"a.txt": "aaa"},
+			wantErr:         "its stderr was:\nfailing on purpose",
+		},
+		{
+			name:    "templated_arg_missing_input",
+			args:    []string{"upper", "{{.nope}}"},
+			wantErr: `nonexistent variable name "nope"`,
+		},
+		{
+			name:           "invalid_module",
+			moduleContents: []byte("not wasm"),
+			wantErr:        `invalid wasm module "plugin.wasm"`,
+		},
+		{
+			name: "not_a_command",
+			// The smallest valid module: just the magic number and version.
+			moduleContents: []byte("\x00asm\x01\x00\x00\x00"),
+			wantErr:        `must be a WASI command that exports a "_start" function`,
+		},
+		{
+			name:    "missing_module",
+			module:  "nonexistent.wasm",
+			wantErr: "failed reading wasm module",
+		},
+		{
+			name:    "module_outside_template_dir",
+			module:  "../plugin.wasm",
+			wantErr: `must not contain ".."`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			scratchDir := filepath.Join(tempDir, "scratch")
+			templateDir := filepath.Join(tempDir, "template")
+			module := tc.moduleContents
+			if module == nil {
+				module = testWasmPlugin(t)
+			}
+			abctestutil.WriteAll(t, tempDir, map[string]string{
+				"outside.txt":          "secret",
+				"template/plugin.wasm": string(module),
+			})
+			if err := os.MkdirAll(scratchDir, 0o700); err != nil {
+				t.Fatal(err)
+			}
+			abctestutil.WriteAll(t, scratchDir, tc.initialContents)
+
+			moduleName := tc.module
+			if moduleName == "" {
+				moduleName = "plugin.wasm"
+			}
+			var stdout bytes.Buffer
+			sp := &stepParams{
+				scope:         common.NewScope(tc.inputs, nil),
+				scratchDir:    scratchDir,
+				templateDir:   templateDir,
+				suppressPrint: tc.suppressPrint,
+				rp: &Params{
+					FS:     &common.RealFS{},
+					Stdout: &stdout,
+				},
+			}
+			w := &spec.Wasm{
+				Module: mdl.S(moduleName),
+				Args:   mdl.Strings(tc.args...),
+			}
+			err := actionWasm(context.Background(), w, sp)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+
+			got := abctestutil.LoadDir(t, scratchDir)
+			want := tc.want
+			if want == nil {
+				want = map[string]string{}
+			}
+			if diff := cmp.Diff(got, want, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("scratch directory contents were not as expected (-got,+want): %v", diff)
+			}
+			if diff := cmp.Diff(stdout.String(), tc.wantStdout); diff != "" {
+				t.Errorf("stdout was not as expected (-got,+want): %v", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// renderAlso renders an already-downloaded template a second time, into
+// p.AlsoRenderTo. The inputs are the ones that the first render resolved
+// (so the user isn't prompted twice), overlaid with p.AlsoRenderInputs.
+func renderAlso(ctx context.Context, dlMeta *templatesource.DownloadMetadata, templateDir string, p *Params, inputs map[string]string) (*Result, error) {
+	logger := logging.FromContext(ctx).With("logger", "renderAlso")
+
+	also := *p
+	also.AlsoRenderTo = ""
+	also.AlsoRenderInputs = nil
+	also.OutDir = p.AlsoRenderTo
+	also.DestDir = p.AlsoRenderTo
+	also.InputsFromFlags = maps.Clone(inputs)
+	maps.Copy(also.InputsFromFlags, p.AlsoRenderInputs)
+	also.InputFiles = nil
+	also.InputsFromManifest = nil
+	also.Prompt = false
+	also.Resumable = false
+	also.Resume = false
+	also.StartFromStep = 0
+	also.StopAfterStep = nil
+
+	// Whether a local template is canonical depends on where it's rendered to,
+	// so its metadata can't be reused as-is.
+	if ld, ok := p.Downloader.(*templatesource.LocalDownloader); ok {
+		var err error
+		if dlMeta, err = ld.MetadataFor(ctx, p.Cwd, also.DestDir); err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+	}
+
+	logger.DebugContext(ctx, "rendering template a second time", "dest", also.DestDir)
+	if err := FinishInterruptedCommits(ctx, also.FS, also.OutDir); err != nil {
+		return nil, err
+	}
+	out, err := renderDownloaded(ctx, dlMeta, templateDir, &also, nil)
+	if err != nil {
+		return nil, fmt.Errorf("rendering into --also-render-to directory %q: %w", p.AlsoRenderTo, err)
+	}
+	return out, nil
+}
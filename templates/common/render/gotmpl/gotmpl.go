@@ -34,16 +34,47 @@ var templateKeyErrRegex = regexp.MustCompile(`map has no entry for key "([^"]*)"
 // template execution fails because of a missing input variable, the error will
 // be wrapped in a UnknownVarErr.
 func ParseExec(pos *model.ConfigPos, tmpl string, scope *common.Scope) (string, error) {
+	return ParseExecOpts(pos, tmpl, scope, &Options{})
+}
+
+// Options changes how ParseExecOpts parses and executes a template.
+type Options struct {
+	// LeftDelim and RightDelim replace the "{{" and "}}" action delimiters.
+	// Empty means the default.
+	LeftDelim, RightDelim string
+
+	// MissingKeyZero makes references to nonexistent variables render as the
+	// empty string, rather than failing.
+	MissingKeyZero bool
+
+	// Partials are extra named templates that the template can invoke with
+	// {{template "name" .}}. The map keys are the template names.
+	Partials map[string]string
+}
+
+// ParseExecOpts is like ParseExec, but with options.
+func ParseExecOpts(pos *model.ConfigPos, tmpl string, scope *common.Scope, opts *Options) (string, error) {
+	missingKey := "missingkey=error"
+	if opts.MissingKeyZero {
+		missingKey = "missingkey=zero"
+	}
 	// As of go1.20, if the template references a nonexistent variable, then the
 	// returned error will be of type *errors.errorString; unfortunately there's
 	// no distinctive error type we can use to detect this particular error.
 	//
 	// We only get this error because we ask for Option("missingkey=error") when
 	// parsing the template. Otherwise it would silently insert "<no value>".
-	parsedTmpl, err := template.New("").Funcs(scope.GoTmplFuncs()).Option("missingkey=error").Parse(tmpl)
+	parsedTmpl, err := template.New("").Delims(opts.LeftDelim, opts.RightDelim).Funcs(scope.GoTmplFuncs()).Option(missingKey).Parse(tmpl)
 	if err != nil {
 		return "", pos.Errorf(`error compiling as go-template: %w`, err)
 	}
+	partialNames := maps.Keys(opts.Partials)
+	sort.Strings(partialNames)
+	for _, name := range partialNames {
+		if _, err := parsedTmpl.New(name).Parse(opts.Partials[name]); err != nil {
+			return "", pos.Errorf(`error compiling partial %q as go-template: %w`, name, err)
+		}
+	}
 	var sb strings.Builder
 	vars := scope.AllVars()
 	if err := parsedTmpl.Execute(&sb, vars); err != nil {
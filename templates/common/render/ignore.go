@@ -0,0 +1,75 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"path/filepath"
+
+	"github.com/abcxyz/abc/templates/common/gitignore"
+	"github.com/abcxyz/abc/templates/model"
+	"github.com/abcxyz/abc/templates/model/spec/features"
+)
+
+// ignorer decides which paths are left out of the template output by the
+// spec's ignore patterns.
+type ignorer struct {
+	// patterns are matched as simple globs by checkIgnore() for api_versions
+	// before gitignore semantics were supported.
+	patterns []model.String
+
+	// matcher is nil for api_versions before gitignore semantics were
+	// supported.
+	matcher *gitignore.Matcher
+}
+
+func newIgnorer(patterns []model.String, f features.Features) *ignorer {
+	if len(patterns) == 0 {
+		patterns = defaultIgnorePatterns
+	}
+	out := &ignorer{patterns: patterns}
+	if f.SkipGitignorePatterns {
+		return out
+	}
+	parsed := make([]*gitignore.Pattern, 0, len(patterns))
+	for _, p := range patterns {
+		if gp := gitignore.ParsePattern(p.Val, ""); gp != nil {
+			parsed = append(parsed, gp)
+		}
+	}
+	out.matcher = gitignore.NewMatcher(parsed)
+	return out
+}
+
+// ignored reports whether relPath, which is relative to the template,
+// destination, or scratch directory, is ignored.
+func (ig *ignorer) ignored(relPath string, isDir bool) (bool, error) {
+	if ig.matcher == nil {
+		return checkIgnore(ig.patterns, relPath)
+	}
+	return ig.matcher.Match(filepath.ToSlash(relPath), isDir), nil
+}
+
+// appliesToScratch reports whether the patterns also filter the files that
+// steps modify and the files that are written to the destination, and not just
+// the files that are included. That's only the case with gitignore semantics,
+// to keep the behavior of older api_versions.
+func (ig *ignorer) appliesToScratch() bool {
+	return ig.matcher != nil
+}
+
+// ignorer returns the ignorer for the spec's ignore patterns.
+func (s *stepParams) ignorer() *ignorer {
+	return newIgnorer(s.ignorePatterns, s.features)
+}
@@ -0,0 +1,91 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jinja renders Jinja2 templates, so that templates migrated from
+// tools like cookiecutter and copier don't have to rewrite every file in Go
+// template syntax. The heavy lifting is done by the gonja library; this package
+// only configures it the way abc needs.
+package jinja
+
+import (
+	"fmt"
+
+	"github.com/nikolalohinski/gonja/v2/builtins"
+	"github.com/nikolalohinski/gonja/v2/config"
+	"github.com/nikolalohinski/gonja/v2/exec"
+	"github.com/nikolalohinski/gonja/v2/loaders"
+	"github.com/nikolalohinski/gonja/v2/parser"
+	"github.com/nikolalohinski/gonja/v2/tokens"
+)
+
+// CookiecutterNamespace is the name under which every variable is also
+// available, because cookiecutter templates refer to their inputs as
+// {{ cookiecutter.project_slug }} rather than {{ project_slug }}.
+const CookiecutterNamespace = "cookiecutter"
+
+// templateName is the name of the single template known to the loader. Since
+// no other templates exist, {% include %} and {% extends %} can't read files.
+const templateName = "/template"
+
+var (
+	filters = newFilters()
+	methods = newMethods()
+)
+
+// Render executes the given Jinja2 template with the given variables. Each
+// variable is available both by its own name and as an attribute of
+// "cookiecutter". A variable that is itself named "cookiecutter" takes
+// precedence over the namespace.
+func Render(tmpl string, vars map[string]string) (string, error) {
+	cfg := config.New()
+
+	env := &exec.Environment{
+		Context:           exec.EmptyContext().Update(builtins.GlobalFunctions).Update(builtins.GlobalVariables),
+		Filters:           filters,
+		Tests:             builtins.Tests,
+		ControlStructures: builtins.ControlStructures,
+		Methods:           methods,
+	}
+
+	loader, err := loaders.NewMemoryLoader(map[string]string{templateName: tmpl})
+	if err != nil {
+		return "", fmt.Errorf("loaders.NewMemoryLoader: %w", err)
+	}
+
+	// exec.NewTemplate also parses, but its error message includes the entire
+	// template source. Parse first so that syntax errors are readable.
+	p := parser.NewParser(templateName, tokens.Lex(tmpl, cfg), cfg, loader, env.ControlStructures)
+	if _, err := p.Parse(); err != nil {
+		return "", fmt.Errorf("error compiling as Jinja2 template: %w", err)
+	}
+
+	t, err := exec.NewTemplate(templateName, cfg, loader, env)
+	if err != nil {
+		return "", fmt.Errorf("exec.NewTemplate: %w", err)
+	}
+
+	namespace := make(map[string]any, len(vars))
+	data := make(map[string]any, len(vars)+1)
+	data[CookiecutterNamespace] = namespace
+	for k, v := range vars {
+		namespace[k] = v
+		data[k] = v
+	}
+
+	out, err := t.ExecuteToString(exec.NewContext(data))
+	if err != nil {
+		return "", fmt.Errorf("template execution failed: %w", err)
+	}
+	return out, nil
+}
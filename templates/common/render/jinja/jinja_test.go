@@ -0,0 +1,241 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jinja
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestRender(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		tmpl    string
+		vars    map[string]string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "plain_text",
+			tmpl: "hello world\n",
+			want: "hello world\n",
+		},
+		{
+			name: "variable",
+			tmpl: "hello {{ name }}!\n",
+			vars: map[string]string{"name": "Alice"},
+			want: "hello Alice!\n",
+		},
+		{
+			name: "cookiecutter_namespace",
+			tmpl: "{{ cookiecutter.project_slug }}/{{ cookiecutter['project_slug'] }}",
+			vars: map[string]string{"project_slug": "my_app"},
+			want: "my_app/my_app",
+		},
+		{
+			name: "input_named_cookiecutter_wins",
+			tmpl: "{{ cookiecutter }}",
+			vars: map[string]string{"cookiecutter": "mine"},
+			want: "mine",
+		},
+		{
+			name: "undefined_renders_empty",
+			tmpl: "[{{ nope }}][{{ cookiecutter.nope }}]",
+			want: "[][]",
+		},
+		{
+			name: "if_elif_else",
+			tmpl: `{% if db == "postgres" %}pg{% elif db == "mysql" %}my{% else %}none{% endif %}`,
+			vars: map[string]string{"db": "mysql"},
+			want: "my",
+		},
+		{
+			name: "boolean_operators",
+			tmpl: `{% if a and not b %}yes{% endif %}{% if b or a %}!{% endif %}`,
+			vars: map[string]string{"a": "x", "b": ""},
+			want: "yes!",
+		},
+		{
+			name: "inputs_are_strings",
+			tmpl: `{% if use_db %}truthy{% endif %} {% if use_db == "false" %}compared{% endif %}`,
+			vars: map[string]string{"use_db": "false"},
+			want: "truthy compared",
+		},
+		{
+			name: "arithmetic_after_int",
+			tmpl: `{% if replicas | int > 9 %}many{% endif %} {{ (replicas | int) + 1 }}`,
+			vars: map[string]string{"replicas": "10"},
+			want: "many 11",
+		},
+		{
+			name: "for_loop_variable",
+			tmpl: `{% for s in services.split(",") %}{{ loop.index }}:{{ s }}{% if not loop.last %}, {% endif %}{% endfor %}`,
+			vars: map[string]string{"services": "api,web,worker"},
+			want: "1:api, 2:web, 3:worker",
+		},
+		{
+			name: "for_else",
+			tmpl: `{% for x in [] %}{{ x }}{% else %}empty{% endfor %}`,
+			want: "empty",
+		},
+		{
+			name: "in_operator",
+			tmpl: `{{ "b" in ["a", "b"] }} {{ "z" not in "abc" }} {{ "ell" in name }}`,
+			vars: map[string]string{"name": "hello"},
+			want: "True True True",
+		},
+		{
+			name: "set_and_concat",
+			tmpl: `{% set full = first ~ " " ~ last %}{{ full }}`,
+			vars: map[string]string{"first": "Ada", "last": "Lovelace"},
+			want: "Ada Lovelace",
+		},
+		{
+			name: "macro",
+			tmpl: `{% macro greet(who) %}hi {{ who }}{% endmacro %}{{ greet(name) }}`,
+			vars: map[string]string{"name": "Bob"},
+			want: "hi Bob",
+		},
+		{
+			name: "whitespace_control",
+			tmpl: "a\n  {%- if true -%}\n  b\n  {%- endif %}\nc",
+			want: "ab\nc",
+		},
+		{
+			name: "comments",
+			tmpl: "a{# this is a {{ comment }} #}b",
+			want: "ab",
+		},
+		{
+			name: "raw",
+			tmpl: `{% raw %}{{ .Values.name }}{% if %}{% endraw %}{{ x }}`,
+			vars: map[string]string{"x": "!"},
+			want: "{{ .Values.name }}{% if %}!",
+		},
+		{
+			name:    "include_cant_read_files",
+			tmpl:    `{% include "/etc/passwd" %}`,
+			wantErr: "unknown path: '/etc/passwd'",
+		},
+		{
+			name:    "unclosed_if",
+			tmpl:    "{% if true %}x",
+			wantErr: "error compiling as Jinja2 template",
+		},
+		{
+			name:    "syntax_error_reports_line",
+			tmpl:    "line one\n{{ 1 + }}",
+			wantErr: "Line: 2",
+		},
+		{
+			name:    "unknown_filter",
+			tmpl:    "{{ x | nope }}",
+			vars:    map[string]string{"x": "y"},
+			wantErr: "nope",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := Render(tc.tmpl, tc.vars)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("output was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestRender_FiltersTestsAndMethods(t *testing.T) {
+	t.Parallel()
+
+	vars := map[string]string{
+		"name":  "My-Project",
+		"csv":   "b,a,c",
+		"empty": "",
+		"num":   "7",
+	}
+
+	cases := []struct {
+		tmpl string
+		want string
+	}{
+		// Filters.
+		{tmpl: `{{ name | capitalize }}`, want: "My-project"},
+		{tmpl: `{{ nope | default("d") }}`, want: "d"},
+		{tmpl: `{{ nope | d("d") }}`, want: "d"},
+		{tmpl: `{{ empty | default("d", true) }}`, want: "d"},
+		{tmpl: `{{ csv.split(",") | first }}`, want: "b"},
+		{tmpl: `{{ (num | int) + 1 }}`, want: "8"},
+		{tmpl: `{{ csv.split(",") | join("-") }}`, want: "b-a-c"},
+		{tmpl: `{{ csv.split(",") | last }}`, want: "c"},
+		{tmpl: `{{ name | length }}`, want: "10"},
+		{tmpl: `{{ name | lower }}`, want: "my-project"},
+		{tmpl: `{{ name | replace("-", "_") }}`, want: "My_Project"},
+		{tmpl: `{{ csv.split(",") | reverse | join }}`, want: "cab"},
+		{tmpl: `{{ "abc" | reverse }}`, want: "cba"},
+		{tmpl: `{{ csv.split(",") | sort | join }}`, want: "abc"},
+		{tmpl: `{{ name | title }}`, want: "My-Project"},
+		{tmpl: `{{ "  x  " | trim }}`, want: "x"},
+		{tmpl: `{{ name | upper }}`, want: "MY-PROJECT"},
+		{tmpl: `{{ "a,a,b".split(",") | unique | join }}`, want: "ab"},
+		{tmpl: `{{ name | truncate(5, true, "") }}`, want: "My-Pr"},
+		{tmpl: `{{ "one two" | wordcount }}`, want: "2"},
+
+		// Tests.
+		{tmpl: `{{ name is defined }} {{ nope is defined }}`, want: "True False"},
+		{tmpl: `{{ nope is undefined }}`, want: "True"},
+		{tmpl: `{{ name is string }}`, want: "True"},
+		{tmpl: `{{ num | int is number }}`, want: "True"},
+		{tmpl: `{{ num | int is odd }} {{ num | int is even }}`, want: "True False"},
+		{tmpl: `{{ 9 is divisibleby 3 }}`, want: "True"},
+
+		// Python string methods, as used by cookiecutter templates.
+		{tmpl: `{{ name.lower() }}`, want: "my-project"},
+		{tmpl: `{{ name.upper() }}`, want: "MY-PROJECT"},
+		{tmpl: `{{ name.replace("-", "_") }}`, want: "My_Project"},
+		{tmpl: `{{ cookiecutter.name.lower().replace("-", "_") }}`, want: "my_project"},
+		{tmpl: `{{ csv.split(",") | length }}`, want: "3"},
+		{tmpl: `{{ "  x ".strip() }}|{{ "  x ".lstrip() }}|{{ "  x ".rstrip() }}`, want: "x|x |  x"},
+		{tmpl: `{{ "xxyxx".strip("x") }}`, want: "y"},
+		{tmpl: `{{ "a-b-c".replace("-", "", 1) }}`, want: "ab-c"},
+		{tmpl: `{{ name.startswith("My") }}`, want: "True"},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.tmpl, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := Render(tc.tmpl, vars)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jinja
+
+import (
+	"fmt"
+
+	"github.com/nikolalohinski/gonja/v2/builtins"
+	"github.com/nikolalohinski/gonja/v2/builtins/methods/pystring"
+	"github.com/nikolalohinski/gonja/v2/exec"
+)
+
+// The gonja builtins that behave differently than Jinja2 in ways that break
+// common cookiecutter templates are replaced here. For example,
+// {{ cookiecutter.project_name.lower().replace(' ', '_') }} fails with stock
+// gonja because it requires the optional "count" argument of replace().
+
+// strMethodNames are the Python string methods that gonja implements.
+var strMethodNames = []string{
+	"capitalize", "capwords", "casefold", "center", "count", "encode",
+	"endswith", "expandtabs", "find", "format", "format_map", "isalnum",
+	"isalpha", "isascii", "isdecimal", "isdigit", "islower", "isnumeric",
+	"isprintable", "isspace", "istitle", "isupper", "join", "ljust", "lower",
+	"lstrip", "partition", "removeprefix", "removesuffix", "replace", "rfind",
+	"rjust", "rpartition", "rsplit", "rstrip", "split", "splitlines",
+	"startswith", "strip", "swapcase", "title", "upper", "zfill",
+}
+
+// strMethodOverrides fix string methods whose optional arguments are
+// mandatory in gonja.
+var strMethodOverrides = map[string]exec.Method[string]{
+	"replace": func(self string, _ *exec.Value, arguments *exec.VarArgs) (any, error) {
+		var old, replacement string
+		var count int
+		if err := arguments.Take(
+			exec.PositionalArgument("old", nil, exec.StringArgument(&old)),
+			exec.PositionalArgument("new", nil, exec.StringArgument(&replacement)),
+			exec.PositionalArgument("count", exec.AsValue(-1), exec.IntArgument(&count)),
+		); err != nil {
+			return nil, exec.ErrInvalidCall(err)
+		}
+		return pystring.Replace(self, old, replacement, count), nil
+	},
+	"strip":  stripMethod(pystring.Strip),
+	"lstrip": stripMethod(pystring.LStrip),
+	"rstrip": stripMethod(pystring.RStrip),
+}
+
+// stripMethod returns a string method that removes the characters in its
+// optional argument, or whitespace if it's omitted.
+func stripMethod(strip func(s, cutset string) string) exec.Method[string] {
+	return func(self string, _ *exec.Value, arguments *exec.VarArgs) (any, error) {
+		var cutset string
+		if err := arguments.Take(
+			exec.PositionalArgument("chars", exec.AsValue(""), exec.StringArgument(&cutset)),
+		); err != nil {
+			return nil, exec.ErrInvalidCall(err)
+		}
+		return strip(self, cutset), nil
+	}
+}
+
+// filterOverrides fix filters that return different results than Jinja2.
+var filterOverrides = map[string]exec.FilterFunction{
+	// gonja's reverse sorts lists in descending order instead of reversing
+	// them.
+	"reverse": func(_ *exec.Evaluator, in *exec.Value, params *exec.VarArgs) *exec.Value {
+		if in.IsError() {
+			return in
+		}
+		if p := params.ExpectNothing(); p.IsError() {
+			return exec.AsValue(fmt.Errorf("wrong signature for 'reverse': %s", p.Error()))
+		}
+		if in.IsString() {
+			r := []rune(in.String())
+			for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+				r[i], r[j] = r[j], r[i]
+			}
+			return exec.AsValue(string(r))
+		}
+		var out []any
+		in.Iterate(func(_, _ int, key, _ *exec.Value) bool {
+			out = append([]any{key.Interface()}, out...)
+			return true
+		}, func() {})
+		return exec.AsValue(out)
+	},
+}
+
+// newMethods returns gonja's builtin methods with strMethodOverrides applied.
+func newMethods() exec.Methods {
+	str := make(map[string]exec.Method[string], len(strMethodNames))
+	for _, name := range strMethodNames {
+		if m, ok := builtins.Methods.Str.Get(name); ok {
+			str[name] = m
+		}
+	}
+	for name, m := range strMethodOverrides {
+		str[name] = m
+	}
+
+	methods := builtins.Methods
+	methods.Str = exec.NewMethodSet(str)
+	return methods
+}
+
+// newFilters returns gonja's builtin filters with filterOverrides applied.
+func newFilters() *exec.FilterSet {
+	return exec.NewFilterSet(map[string]exec.FilterFunction{}).
+		Update(builtins.Filters).
+		Update(exec.NewFilterSet(filterOverrides))
+}
@@ -0,0 +1,108 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/abcxyz/abc/templates/common"
+)
+
+// outputLimits caps the size of a template's output, so that a buggy template
+// (e.g. a runaway for_each, or an include of a huge destination tree) fails
+// quickly with a clear error rather than filling the disk. A zero value for any
+// field means no limit.
+type outputLimits struct {
+	maxFiles     int
+	maxBytes     int64
+	maxFileBytes int64
+}
+
+func (p *Params) outputLimits() *outputLimits {
+	return &outputLimits{
+		maxFiles:     p.MaxOutputFiles,
+		maxBytes:     p.MaxOutputBytes,
+		maxFileBytes: p.MaxFileBytes,
+	}
+}
+
+func (l *outputLimits) enabled() bool {
+	return l.maxFiles > 0 || l.maxBytes > 0 || l.maxFileBytes > 0
+}
+
+// outputTally counts files and bytes as they're written, and fails as soon as
+// one of the outputLimits is exceeded.
+type outputTally struct {
+	limits *outputLimits
+	files  int
+	bytes  int64
+}
+
+// add records one file of the given size, named by relPath for error messages.
+func (t *outputTally) add(relPath string, size int64) error {
+	t.files++
+	t.bytes += size
+
+	l := t.limits
+	switch {
+	case l.maxFileBytes > 0 && size > l.maxFileBytes:
+		return limitErrorf("output file %q is %d bytes, which is more than the limit of %d bytes per file (see --max-file-bytes)",
+			relPath, size, l.maxFileBytes)
+	case l.maxFiles > 0 && t.files > l.maxFiles:
+		return limitErrorf("the template output more than the limit of %d files (see --max-output-files)",
+			l.maxFiles)
+	case l.maxBytes > 0 && t.bytes > l.maxBytes:
+		return limitErrorf("the template output more than the limit of %d bytes in total (see --max-output-bytes)",
+			l.maxBytes)
+	}
+	return nil
+}
+
+func limitErrorf(format string, args ...any) error {
+	return common.WithCategory(common.CategoryOutputLimit, fmt.Errorf(format, args...))
+}
+
+// checkOutputLimits walks the scratch directory and returns an error if its
+// contents exceed the output limits.
+func checkOutputLimits(sp *stepParams) error {
+	limits := sp.rp.outputLimits()
+	if !limits.enabled() {
+		return nil
+	}
+	tally := &outputTally{limits: limits}
+	err := fs.WalkDir(sp.rp.FS, sp.scratchDir, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err // some filesystem error happened
+		}
+		if de.IsDir() {
+			return nil
+		}
+		info, err := de.Info()
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		rel, err := filepath.Rel(sp.scratchDir, path)
+		if err != nil {
+			return fmt.Errorf("filepath.Rel(): %w", err)
+		}
+		return tally.add(rel, info.Size())
+	})
+	if err != nil {
+		return fmt.Errorf("error checking output limits: %w", err)
+	}
+	return nil
+}
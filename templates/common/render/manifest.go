@@ -15,12 +15,15 @@
 package render
 
 import (
+	"crypto"
+	"crypto/sha256"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"sort"
 	"strings"
 	"time"
@@ -31,16 +34,23 @@ import (
 	"github.com/abcxyz/abc/internal/version"
 	"github.com/abcxyz/abc/templates/common"
 	"github.com/abcxyz/abc/templates/common/dirhash"
+	"github.com/abcxyz/abc/templates/common/input"
+	"github.com/abcxyz/abc/templates/common/signing"
 	"github.com/abcxyz/abc/templates/common/templatesource"
 	"github.com/abcxyz/abc/templates/model"
 	"github.com/abcxyz/abc/templates/model/decode"
 	"github.com/abcxyz/abc/templates/model/header"
-	manifest "github.com/abcxyz/abc/templates/model/manifest/v1alpha1"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1beta7"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
 )
 
 // writeManifestParams are all the argument to writeManifest, wrapped in a
 // struct because there are so many.
 type writeManifestParams struct {
+	// backupDir is the directory where files overwritten by this render were
+	// backed up, relative to the backup root, or empty if there weren't any.
+	backupDir string
+
 	// Fakeable time for testing.
 	clock clock.Clock
 
@@ -64,16 +74,55 @@ type writeManifestParams struct {
 
 	includeFromDestPatches map[string]string
 
+	// For files that were included from the destination under a different
+	// name, the path that each one was included from. See
+	// stepParams.movedFromDest.
+	movedFromDest map[string]string
+
+	// The "deprecated" field from the spec, if any.
+	deprecated *spec.Deprecated
+
+	// The values of the outputs declared by the spec, keyed by output name.
+	outputs map[string]string
+
+	// The sources downloaded by includes with "from: remote".
+	remoteIncludes []*manifest.RemoteInclude
+
 	// The set of values that were used as the template inputs; combined from
 	// --input, --input-file, prompts, and defaults.
 	inputs map[string]string
 
+	// Where each of the inputs came from. May be nil if unknown, as when
+	// resuming an interrupted render.
+	inputSources map[string]*input.Source
+
+	// The --input-file files that were read, with their hashes.
+	inputFiles []*manifest.InputFile
+
 	// The SHA256 hash of each file created by the template rendering process
 	// in the destination directory.
 	outputHashes map[string][]byte
 
+	// If non-nil, the manifest is signed with this key.
+	signer crypto.Signer
+
+	// reproducible omits the render environment from the manifest, since it
+	// differs from machine to machine.
+	reproducible bool
+
+	// When the render started, for computing the render duration.
+	startTime time.Time
+
 	// The temp directory where the template was downloaded.
 	templateDir string
+
+	// Whether the upgrade channel came from the --upgrade-channel flag rather
+	// than being autodetected.
+	upgradeChannelFromFlag bool
+
+	// How future upgrades name their merge conflict files, like
+	// "keep_extension".
+	conflictFileNames string
 }
 
 // writeManifest creates a manifest struct, marshals it as YAML, and writes it
@@ -99,7 +148,8 @@ func writeManifest(p *writeManifestParams) (path string, rErr error) {
 			return "", err //nolint:wrapcheck
 		}
 		if exists {
-			return "", fmt.Errorf("dry run failed, the output manifest file %q already exists", manifestPath)
+			return "", common.WithCategory(common.CategoryOverwriteRefused,
+				fmt.Errorf("dry run failed, the output manifest file %q already exists", manifestPath))
 		}
 		// This is good. We don't want to overwrite an existing manifest file,
 		// so that fact that it doesn't already exist is good news.
@@ -126,6 +176,12 @@ func writeManifest(p *writeManifestParams) (path string, rErr error) {
 		return "", fmt.Errorf("Write(%q): %w", manifestPath, err)
 	}
 
+	if p.signer != nil {
+		if err := signing.WriteSig(p.fs, p.signer, manifestPath, buf); err != nil {
+			return "", err //nolint:wrapcheck
+		}
+	}
+
 	return filepath.Join(common.ABCInternalDir, baseName), nil
 }
 
@@ -155,17 +211,29 @@ func manifestBaseName(p *writeManifestParams) string {
 // canonicalSource is optional, it will be empty in the case where the template
 // location is non-canonical (i.e. installing from ~/mytemplate).
 func buildManifest(p *writeManifestParams) (*manifest.WithHeader, error) {
-	templateDirhash, err := dirhash.HashLatest(p.templateDir)
+	templateDirhash, err := dirhash.HashLatestFS(p.fs, p.templateDir, p.dlMeta.Submodules)
 	if err != nil {
 		return nil, err //nolint:wrapcheck
 	}
 
+	now := p.clock.Now().UTC()
+	apiVersion := decode.LatestSupportedAPIVersion(version.IsReleaseBuild())
+
+	// Release builds may write an older api_version whose manifest model
+	// doesn't have the provenance and environment fields.
+	withProvenance := decode.ModelIs(apiVersion, decode.KindManifest, &manifest.Manifest{})
+
 	inputList := make([]*manifest.Input, 0, len(p.inputs))
 	for name, val := range p.inputs {
-		inputList = append(inputList, &manifest.Input{
+		in := &manifest.Input{
 			Name:  model.String{Val: name},
 			Value: model.String{Val: val},
-		})
+		}
+		if src := p.inputSources[name]; withProvenance && src != nil {
+			in.Source = model.String{Val: src.Kind}
+			in.SourceFile = model.String{Val: src.File}
+		}
+		inputList = append(inputList, in)
 	}
 
 	outputList := make([]*manifest.OutputFile, 0, len(p.outputHashes))
@@ -180,10 +248,18 @@ func buildManifest(p *writeManifestParams) (*manifest.WithHeader, error) {
 			patchModel = &model.String{Val: patch}
 		}
 
+		var includedFrom *model.String
+		if movedFrom, ok := p.movedFromDest[filepath.FromSlash(file)]; ok && withProvenance {
+			includedFrom = &model.String{Val: filepath.ToSlash(movedFrom)}
+		}
+
 		outputList = append(outputList, &manifest.OutputFile{
-			File:  model.String{Val: file},
-			Hash:  model.String{Val: hashStr},
-			Patch: patchModel,
+			// Manifests use forward slashes on every OS, so that a manifest
+			// written on Windows can be upgraded elsewhere and vice versa.
+			File:         model.String{Val: filepath.ToSlash(file)},
+			Hash:         model.String{Val: hashStr},
+			Patch:        patchModel,
+			IncludedFrom: includedFrom,
 		})
 	}
 
@@ -196,29 +272,114 @@ func buildManifest(p *writeManifestParams) (*manifest.WithHeader, error) {
 		return outputList[l].File.Val < outputList[r].File.Val
 	})
 
-	now := p.clock.Now().UTC()
-	apiVersion := decode.LatestSupportedAPIVersion(version.IsReleaseBuild())
-
 	locType := string(p.dlMeta.LocationType)
 	if p.dlMeta.CanonicalSource == "" {
 		locType = "" // we only save the location type in the manifest if the location is canonical
 	}
 
+	var backupDir *model.String
+	var channelSource model.String
+	var conflictFileNames model.String
+	var deprecated *manifest.Deprecated
+	var outputs []*manifest.Output
+	var renderEnv *manifest.RenderEnvironment
+	var inputFiles []*manifest.InputFile
+	var remoteIncludes []*manifest.RemoteInclude
+	var templateRepo *manifest.TemplateRepo
+	if withProvenance {
+		if p.backupDir != "" {
+			backupDir = &model.String{Val: p.backupDir}
+		}
+		inputFiles = p.inputFiles
+		if r := p.dlMeta.Repo; r != nil && locType != "" {
+			templateRepo = &manifest.TemplateRepo{
+				Path:      model.String{Val: r.Path},
+				RemoteURL: model.String{Val: r.RemoteURL},
+			}
+		}
+		remoteIncludes = p.remoteIncludes
+		channelSource.Val = manifest.UpgradeChannelSourceAutodetected
+		if p.upgradeChannelFromFlag {
+			channelSource.Val = manifest.UpgradeChannelSourceFlag
+		}
+		conflictFileNames.Val = p.conflictFileNames
+		if d := p.deprecated; d != nil {
+			deprecated = &manifest.Deprecated{Message: d.Message}
+			if d.ReplacedBy.Val != "" {
+				deprecated.ReplacedBy = &d.ReplacedBy
+			}
+		}
+		for name, val := range p.outputs {
+			outputs = append(outputs, &manifest.Output{
+				Name:  model.String{Val: name},
+				Value: model.String{Val: val},
+			})
+		}
+		sort.Slice(outputs, func(l, r int) bool {
+			return outputs[l].Name.Val < outputs[r].Name.Val
+		})
+		if !p.reproducible {
+			renderEnv = &manifest.RenderEnvironment{
+				CLIVersion:           model.String{Val: version.Version},
+				OS:                   model.String{Val: runtime.GOOS},
+				Arch:                 model.String{Val: runtime.GOARCH},
+				RenderDurationMillis: model.Int{Val: int(p.clock.Since(p.startTime).Milliseconds())},
+			}
+		}
+	}
+
 	return &manifest.WithHeader{
 		Header: &header.Fields{
 			NewStyleAPIVersion: model.String{Val: apiVersion},
 			Kind:               model.String{Val: decode.KindManifest},
 		},
 		Wrapped: &manifest.ForMarshaling{
-			TemplateLocation: model.String{Val: p.dlMeta.CanonicalSource}, // may be empty string if location isn't canonical
-			LocationType:     model.String{Val: locType},                  // may be empty string if location isn't canonical
-			TemplateDirhash:  model.String{Val: templateDirhash},
-			TemplateVersion:  model.String{Val: p.dlMeta.Version},
-			UpgradeChannel:   model.String{Val: p.dlMeta.UpgradeChannel},
-			CreationTime:     now,
-			ModificationTime: now,
-			Inputs:           inputList,
-			OutputFiles:      outputList,
+			TemplateLocation:     model.String{Val: p.dlMeta.CanonicalSource}, // may be empty string if location isn't canonical
+			LocationType:         model.String{Val: locType},                  // may be empty string if location isn't canonical
+			TemplateRepo:         templateRepo,
+			TemplateDirhash:      model.String{Val: templateDirhash},
+			TemplateVersion:      model.String{Val: p.dlMeta.Version},
+			UpgradeChannel:       model.String{Val: p.dlMeta.UpgradeChannel},
+			UpgradeChannelSource: channelSource,
+			ConflictFileNames:    conflictFileNames,
+			CreationTime:         now,
+			ModificationTime:     now,
+			Inputs:               inputList,
+			InputFiles:           inputFiles,
+			OutputFiles:          outputList,
+			BackupDir:            backupDir,
+			RenderEnvironment:    renderEnv,
+			Deprecated:           deprecated,
+			Outputs:              outputs,
+			RemoteIncludes:       remoteIncludes,
 		},
 	}, nil
 }
+
+// inputFileRefs reads and hashes each of the given --input-file paths, and
+// returns their paths relative to destDir, where the manifest will be written.
+// Paths are interpreted relative to cwd.
+func inputFileRefs(fs common.FS, cwd, destDir string, paths []string) ([]*manifest.InputFile, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	out := make([]*manifest.InputFile, 0, len(paths))
+	for _, path := range paths {
+		buf, err := fs.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading input file: %w", err)
+		}
+		hash := sha256.Sum256(buf)
+
+		relPath, err := filepath.Rel(common.JoinIfRelative(cwd, destDir), common.JoinIfRelative(cwd, path))
+		if err != nil {
+			return nil, fmt.Errorf("filepath.Rel: %w", err)
+		}
+		out = append(out, &manifest.InputFile{
+			Path: model.String{Val: filepath.ToSlash(relPath)},
+			// The same format as the output file hashes.
+			Hash: model.String{Val: "h1:" + base64.StdEncoding.EncodeToString(hash[:])},
+		})
+	}
+	return out, nil
+}
@@ -15,15 +15,22 @@
 package render
 
 import (
+	"runtime"
 	"testing"
 	"time"
 
 	"github.com/benbjohnson/clock"
 	"github.com/google/go-cmp/cmp"
 
+	"github.com/abcxyz/abc/internal/version"
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/input"
 	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/abc/templates/model"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1beta7"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
 	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	mdl "github.com/abcxyz/abc/templates/testutil/model"
 	"github.com/abcxyz/pkg/testutil"
 )
 
@@ -39,6 +46,9 @@ func TestWriteManifest(t *testing.T) {
 		templateContents map[string]string
 		destDirContents  map[string]string
 		inputs           map[string]string
+		inputSources     map[string]*input.Source
+		channelFromFlag  bool
+		deprecated       *spec.Deprecated
 		outputHashes     map[string][]byte
 		want             map[string]string
 		wantPath         string
@@ -68,7 +78,7 @@ func TestWriteManifest(t *testing.T) {
 			want: map[string]string{
 				"a.txt": "some other stuff",
 				".abc/manifest_nolocation_2023-12-08T23:59:02.000000013Z.lock.yaml": `# Generated by the "abc" command. Do not modify.
-api_version: cli.abcxyz.dev/v1beta6
+api_version: cli.abcxyz.dev/v1beta7
 kind: Manifest
 creation_time: 2023-12-08T23:59:02.000000013Z
 modification_time: 2023-12-08T23:59:02.000000013Z
@@ -76,6 +86,7 @@ template_location: ""
 location_type: ""
 template_version: ""
 upgrade_channel: ""
+upgrade_channel_source: autodetected
 template_dirhash: h1:uh/nUYc3HpipWEon9kYOsvSrEadfu8Q9TdfBuHcnF3o=
 inputs:
     - name: pineapple
@@ -115,7 +126,7 @@ output_files:
 			want: map[string]string{
 				"a.txt": "some other stuff",
 				".abc/manifest_github.com_foo_bar_2023-12-08T23:59:02.000000013Z.lock.yaml": `# Generated by the "abc" command. Do not modify.
-api_version: cli.abcxyz.dev/v1beta6
+api_version: cli.abcxyz.dev/v1beta7
 kind: Manifest
 creation_time: 2023-12-08T23:59:02.000000013Z
 modification_time: 2023-12-08T23:59:02.000000013Z
@@ -123,6 +134,7 @@ template_location: github.com/foo/bar
 location_type: remote_git
 template_version: v1.2.3
 upgrade_channel: latest
+upgrade_channel_source: autodetected
 template_dirhash: h1:uh/nUYc3HpipWEon9kYOsvSrEadfu8Q9TdfBuHcnF3o=
 inputs:
     - name: pineapple
@@ -132,6 +144,68 @@ inputs:
 output_files:
     - file: a.txt
       hash: h1:ZmFrZV9vdXRwdXRfaGFzaF8zMl9ieXRlc19zaGEyNTY=
+`,
+			},
+		},
+		{
+			name: "input_provenance_and_channel_from_flag",
+			templateContents: map[string]string{
+				"spec.yaml": "some stuff",
+			},
+			dlMeta: &templatesource.DownloadMetadata{
+				IsCanonical:     true,
+				CanonicalSource: "github.com/foo/bar",
+				LocationType:    templatesource.RemoteGit,
+				Version:         "v1.2.3",
+				UpgradeChannel:  "main",
+			},
+			inputs: map[string]string{
+				"a_flag":     "1",
+				"b_file":     "2",
+				"c_manifest": "3",
+				"d_prompt":   "4",
+				"e_default":  "5",
+			},
+			inputSources: map[string]*input.Source{
+				"a_flag":     {Kind: manifest.InputSourceFlag},
+				"b_file":     {Kind: manifest.InputSourceInputFile, File: "my_inputs.yaml"},
+				"c_manifest": {Kind: manifest.InputSourceManifest},
+				"d_prompt":   {Kind: manifest.InputSourcePrompt},
+				"e_default":  {Kind: manifest.InputSourceDefault},
+			},
+			channelFromFlag: true,
+			outputHashes:    map[string][]byte{},
+			wantPath:        ".abc/manifest_github.com_foo_bar_2023-12-08T23:59:02.000000013Z.lock.yaml",
+			want: map[string]string{
+				".abc/manifest_github.com_foo_bar_2023-12-08T23:59:02.000000013Z.lock.yaml": `# Generated by the "abc" command. Do not modify.
+api_version: cli.abcxyz.dev/v1beta7
+kind: Manifest
+creation_time: 2023-12-08T23:59:02.000000013Z
+modification_time: 2023-12-08T23:59:02.000000013Z
+template_location: github.com/foo/bar
+location_type: remote_git
+template_version: v1.2.3
+upgrade_channel: main
+upgrade_channel_source: flag
+template_dirhash: h1:dFZ7azGmuLnpl0f8FnGsa+SvnwVjP4VGQxDV8UCWqpI=
+inputs:
+    - name: a_flag
+      value: "1"
+      source: flag
+    - name: b_file
+      value: "2"
+      source: input_file
+      source_file: my_inputs.yaml
+    - name: c_manifest
+      value: "3"
+      source: manifest
+    - name: d_prompt
+      value: "4"
+      source: prompt
+    - name: e_default
+      value: "5"
+      source: default
+output_files: []
 `,
 			},
 		},
@@ -180,7 +254,46 @@ output_files:
 			want: map[string]string{
 				"a.txt": "some other stuff",
 				".abc/manifest_nolocation_2023-12-08T23:59:02.000000013Z.lock.yaml": `# Generated by the "abc" command. Do not modify.
-api_version: cli.abcxyz.dev/v1beta6
+api_version: cli.abcxyz.dev/v1beta7
+kind: Manifest
+creation_time: 2023-12-08T23:59:02.000000013Z
+modification_time: 2023-12-08T23:59:02.000000013Z
+template_location: ""
+location_type: ""
+template_version: ""
+upgrade_channel: ""
+upgrade_channel_source: autodetected
+template_dirhash: h1:uh/nUYc3HpipWEon9kYOsvSrEadfu8Q9TdfBuHcnF3o=
+inputs: []
+output_files:
+    - file: a.txt
+      hash: h1:ZmFrZV9vdXRwdXRfaGFzaF8zMl9ieXRlc19zaGEyNTY=
+`,
+			},
+		},
+		{
+			name: "deprecated",
+			templateContents: map[string]string{
+				"spec.yaml": "some stuff",
+				"a.txt":     "some other stuff",
+			},
+			destDirContents: map[string]string{
+				"a.txt": "some other stuff",
+			},
+			dlMeta: &templatesource.DownloadMetadata{},
+			deprecated: &spec.Deprecated{
+				Message:    mdl.S("Use the new one"),
+				ReplacedBy: mdl.S("github.com/foo/new"),
+				Compatible: model.Bool{Val: true},
+			},
+			outputHashes: map[string][]byte{
+				"a.txt": []byte("fake_output_hash_32_bytes_sha256"),
+			},
+			wantPath: ".abc/manifest_nolocation_2023-12-08T23:59:02.000000013Z.lock.yaml",
+			want: map[string]string{
+				"a.txt": "some other stuff",
+				".abc/manifest_nolocation_2023-12-08T23:59:02.000000013Z.lock.yaml": `# Generated by the "abc" command. Do not modify.
+api_version: cli.abcxyz.dev/v1beta7
 kind: Manifest
 creation_time: 2023-12-08T23:59:02.000000013Z
 modification_time: 2023-12-08T23:59:02.000000013Z
@@ -188,11 +301,15 @@ template_location: ""
 location_type: ""
 template_version: ""
 upgrade_channel: ""
+upgrade_channel_source: autodetected
 template_dirhash: h1:uh/nUYc3HpipWEon9kYOsvSrEadfu8Q9TdfBuHcnF3o=
 inputs: []
 output_files:
     - file: a.txt
       hash: h1:ZmFrZV9vdXRwdXRfaGFzaF8zMl9ieXRlc19zaGEyNTY=
+deprecated:
+    message: Use the new one
+    replaced_by: github.com/foo/new
 `,
 			},
 		},
@@ -212,7 +329,7 @@ output_files:
 			wantPath:     ".abc/manifest_nolocation_2023-12-08T23:59:02.000000013Z.lock.yaml",
 			want: map[string]string{
 				".abc/manifest_nolocation_2023-12-08T23:59:02.000000013Z.lock.yaml": `# Generated by the "abc" command. Do not modify.
-api_version: cli.abcxyz.dev/v1beta6
+api_version: cli.abcxyz.dev/v1beta7
 kind: Manifest
 creation_time: 2023-12-08T23:59:02.000000013Z
 modification_time: 2023-12-08T23:59:02.000000013Z
@@ -220,6 +337,7 @@ template_location: ""
 location_type: ""
 template_version: ""
 upgrade_channel: ""
+upgrade_channel_source: autodetected
 template_dirhash: h1:uh/nUYc3HpipWEon9kYOsvSrEadfu8Q9TdfBuHcnF3o=
 inputs:
     - name: pineapple
@@ -246,13 +364,21 @@ output_files: []
 
 			gotPath, err := writeManifest(&writeManifestParams{
 				clock:        clk,
+				deprecated:   tc.deprecated,
 				destDir:      destDir,
 				dlMeta:       tc.dlMeta,
 				dryRun:       tc.dryRun,
 				fs:           &common.RealFS{},
 				inputs:       tc.inputs,
+				inputSources: tc.inputSources,
 				outputHashes: tc.outputHashes,
-				templateDir:  templateDir,
+
+				// The render environment varies from machine to machine; it's
+				// tested in TestBuildManifest_RenderEnvironment.
+				reproducible: true,
+
+				templateDir:            templateDir,
+				upgradeChannelFromFlag: tc.channelFromFlag,
 			})
 
 			if gotPath != tc.wantPath {
@@ -285,3 +411,42 @@ func mockClock(t *testing.T) *clock.Mock {
 	clk.Set(time.Date(2023, 12, 8, 15, 59, 2, 13, loc))
 	return clk
 }
+
+func TestBuildManifest_RenderEnvironment(t *testing.T) {
+	t.Parallel()
+
+	clk := mockClock(t)
+	templateDir := t.TempDir()
+	abctestutil.WriteAll(t, templateDir, map[string]string{"spec.yaml": "some stuff"})
+
+	params := &writeManifestParams{
+		clock:       clk,
+		dlMeta:      &templatesource.DownloadMetadata{},
+		fs:          &common.RealFS{},
+		startTime:   clk.Now().Add(-1500 * time.Millisecond),
+		templateDir: templateDir,
+	}
+
+	got, err := buildManifest(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &manifest.RenderEnvironment{
+		CLIVersion:           model.String{Val: version.Version},
+		OS:                   model.String{Val: runtime.GOOS},
+		Arch:                 model.String{Val: runtime.GOARCH},
+		RenderDurationMillis: model.Int{Val: 1500},
+	}
+	if diff := cmp.Diff(got.Wrapped.RenderEnvironment, want); diff != "" {
+		t.Errorf("render environment was not as expected (-got,+want): %s", diff)
+	}
+
+	params.reproducible = true
+	got, err = buildManifest(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Wrapped.RenderEnvironment != nil {
+		t.Errorf("got render environment %v for a reproducible render, want none", got.Wrapped.RenderEnvironment)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/telemetry"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// RenderMany is like calling Render once for each of ps, but the renders run
+// concurrently, and the template is only downloaded once for all the Params
+// that share the same Downloader. This is for tools that scaffold many
+// destinations from the same template in one run.
+//
+// Downloaders are shared by identity: to download once, pass the same
+// Downloader value (e.g. the same pointer returned by ParseSource) in each
+// Params. The temp directory settings of the first Params in each group are
+// used for the shared download.
+//
+// The returned slice has one entry per Params, in the same order; the entry
+// is nil if that render failed. Every render is attempted even if some of
+// them fail, and the returned error is the errors.Join of all the failures,
+// each naming its destination. Resume, Resumable, StartFromStep,
+// StopAfterStep and Prompt aren't supported.
+func RenderMany(ctx context.Context, ps []*Params) (_ []*Result, rErr error) {
+	for _, p := range ps {
+		if p.Resume || p.Resumable || p.StartFromStep != 0 || p.StopAfterStep != nil || p.Prompt {
+			return nil, fmt.Errorf("RenderMany doesn't support resumable or interactive renders; the render into %q sets Resume, Resumable, StartFromStep, StopAfterStep or Prompt", p.DestDir)
+		}
+	}
+
+	groups := groupByDownloader(ps)
+	downloads := make([]*sharedDownload, len(groups))
+	tempTrackers := make([]*tempdir.DirTracker, len(groups))
+	defer func() {
+		for _, t := range tempTrackers {
+			if t != nil {
+				t.DeferMaybeRemoveAll(ctx, &rErr)
+			}
+		}
+	}()
+	// A failed download is reported by each render that needed it, below.
+	_ = common.ForEachParallel(len(groups), 0, func(i int) error {
+		first := ps[groups[i][0]]
+		tempTrackers[i] = tempdir.NewDirTracker(first.FS, first.KeepTempDirs)
+		downloads[i] = download(ctx, first, tempTrackers[i])
+		return downloads[i].err
+	})
+
+	shared := make([]*sharedDownload, len(ps))
+	for i, group := range groups {
+		for _, psIdx := range group {
+			shared[psIdx] = downloads[i]
+		}
+	}
+
+	out := make([]*Result, len(ps))
+	err := common.ForEachParallel(len(ps), 0, func(i int) error {
+		result, err := recorded(ctx, ps[i], func(ctx context.Context, p *Params) (*Result, error) {
+			return shared[i].render(ctx, p)
+		})
+		if err != nil {
+			return fmt.Errorf("rendering into %q: %w", ps[i].DestDir, err)
+		}
+		out[i] = result
+		return nil
+	})
+	return out, err
+}
+
+// sharedDownload is a template that was downloaded once on behalf of one or
+// more renders.
+type sharedDownload struct {
+	dlMeta      *templatesource.DownloadMetadata
+	templateDir string
+	err         error
+}
+
+// render renders the shared download into p's destination.
+func (s *sharedDownload) render(ctx context.Context, p *Params) (*Result, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	dlMeta := s.dlMeta
+	// Whether a local template is canonical depends on where it's rendered to,
+	// so its metadata can't be reused as-is.
+	if ld, ok := p.Downloader.(*templatesource.LocalDownloader); ok {
+		var err error
+		if dlMeta, err = ld.MetadataFor(ctx, p.Cwd, p.DestDir); err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+	}
+	return renderWithAlso(ctx, dlMeta, s.templateDir, p, nil)
+}
+
+// download downloads p's template into a new temp dir that's tracked by
+// tempTracker.
+func download(ctx context.Context, p *Params, tempTracker *tempdir.DirTracker) *sharedDownload {
+	logger := logging.FromContext(ctx).With("logger", "RenderMany")
+
+	templateDir, err := tempTracker.MkdirTempTracked(p.TempDirBase, tempdir.TemplateDirNamePart)
+	if err != nil {
+		return &sharedDownload{err: err}
+	}
+
+	logger.DebugContext(ctx, "downloading/copying template to share between renders",
+		"destination", templateDir)
+	dlStart := time.Now()
+	stopTimer := p.Timings.start(PhaseDownload)
+	dlMeta, err := p.Downloader.Download(ctx, p.Cwd, templateDir, p.DestDir)
+	stopTimer()
+	if err != nil {
+		err = common.WithCategory(common.CategoryDownload,
+			fmt.Errorf("failed to download/copy template: %w", err))
+	}
+	telemetry.Measure(ctx, telemetry.Downloads, telemetry.DownloadDuration, dlStart, err)
+	return &sharedDownload{dlMeta: dlMeta, templateDir: templateDir, err: err}
+}
+
+// groupByDownloader groups the indices of ps by Downloader, in order of first
+// appearance. A Downloader whose type can't be compared is never shared.
+func groupByDownloader(ps []*Params) [][]int {
+	var groups [][]int
+	groupOf := make(map[templatesource.Downloader]int)
+	for i, p := range ps {
+		if p.Downloader == nil || !reflect.TypeOf(p.Downloader).Comparable() {
+			groups = append(groups, []int{i})
+			continue
+		}
+		g, ok := groupOf[p.Downloader]
+		if !ok {
+			g = len(groups)
+			groupOf[p.Downloader] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+	return groups
+}
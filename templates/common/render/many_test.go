@@ -0,0 +1,125 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestRenderMany(t *testing.T) {
+	t.Parallel()
+
+	specContents := `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'A template for testing RenderMany'
+inputs:
+  - name: 'name'
+    desc: 'A name'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['greeting.txt']
+  - desc: 'Greet'
+    action: 'string_replace'
+    params:
+      paths: ['greeting.txt']
+      replacements:
+        - to_replace: 'NAME'
+          with: '{{.name}}'
+`
+
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	abctestutil.WriteAll(t, sourceDir, map[string]string{
+		"spec.yaml":    specContents,
+		"greeting.txt": "hello NAME\n",
+	})
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	dl := &countingDownloader{Downloader: &templatesource.LocalDownloader{SrcPath: sourceDir}}
+
+	names := []string{"alice", "bob", "", "carol"}
+	ps := make([]*Params, len(names))
+	for i, name := range names {
+		inputs := map[string]string{}
+		if name != "" {
+			inputs["name"] = name
+		}
+		outDir := filepath.Join(tempDir, fmt.Sprintf("out%d", i))
+		ps[i] = &Params{
+			Clock:             clock.NewMock(),
+			Cwd:               tempDir,
+			DestDir:           outDir,
+			Downloader:        dl,
+			FS:                &common.RealFS{},
+			InputsFromFlags:   inputs,
+			OutDir:            outDir,
+			SkipManifest:      true,
+			SourceForMessages: sourceDir,
+			Stdout:            io.Discard,
+			TempDirBase:       tempDir,
+		}
+	}
+
+	results, err := RenderMany(ctx, ps)
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("rendering into %q", ps[2].DestDir)) {
+		t.Errorf("got error %v, want one about the render into %q", err, ps[2].DestDir)
+	}
+	if got := dl.calls; got != 1 {
+		t.Errorf("template was downloaded %d times, want 1", got)
+	}
+	for i, name := range names {
+		if name == "" {
+			if results[i] != nil {
+				t.Errorf("got a result for the failed render into %q", ps[i].DestDir)
+			}
+			continue
+		}
+		if results[i] == nil {
+			t.Errorf("got no result for the render into %q", ps[i].DestDir)
+			continue
+		}
+		got := abctestutil.LoadDir(t, ps[i].OutDir)
+		want := map[string]string{"greeting.txt": "hello " + name + "\n"}
+		if diff := cmp.Diff(got, want); diff != "" {
+			t.Errorf("output of render %d was not as expected (-got,+want): %s", i, diff)
+		}
+	}
+}
+
+func TestRenderMany_RejectsPrompt(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	_, err := RenderMany(ctx, []*Params{{DestDir: "dest", Prompt: true}})
+	if diff := testutil.DiffErrString(err, "doesn't support resumable or interactive renders"); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+)
+
+var (
+	mdHeadingRE    = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	mdFenceRE      = regexp.MustCompile("^\\s*(```|~~~)")
+	mdBulletRE     = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	mdQuoteRE      = regexp.MustCompile(`^\s*>\s?(.*)$`)
+	mdCodeSpanRE   = regexp.MustCompile("`([^`]+)`")
+	mdLinkRE       = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	mdAutolinkRE   = regexp.MustCompile(`<((?:https?|mailto):[^>\s]+)>`)
+	mdBoldRE       = regexp.MustCompile(`(\*\*|__)(\S(?:.*?\S)?)(\*\*|__)`)
+	mdItalicStarRE = regexp.MustCompile(`\*(\S(?:[^*]*?\S)?)\*`)
+	mdItalicUndRE  = regexp.MustCompile(`(^|[^\w])_(\S(?:[^_]*?\S)?)_([^\w]|$)`)
+)
+
+// markdownStyles holds the functions that style the parts of a markdown
+// message.
+type markdownStyles struct {
+	heading    func(a ...any) string
+	subheading func(a ...any) string
+	code       func(a ...any) string
+	bold       func(a ...any) string
+	italic     func(a ...any) string
+	link       func(a ...any) string
+	faint      func(a ...any) string
+}
+
+func newMarkdownStyles() *markdownStyles {
+	sprint := func(attrs ...color.Attribute) func(a ...any) string {
+		c := color.New(attrs...)
+		// The caller already decided that styling is wanted, so override the
+		// color package's own detection.
+		c.EnableColor()
+		return c.SprintFunc()
+	}
+	return &markdownStyles{
+		heading:    sprint(color.Bold, color.Underline),
+		subheading: sprint(color.Bold),
+		code:       sprint(color.FgCyan),
+		bold:       sprint(color.Bold),
+		italic:     sprint(color.Italic),
+		link:       sprint(color.Underline, color.FgBlue),
+		faint:      sprint(color.Faint),
+	}
+}
+
+// shouldStyleMarkdown returns whether markdown written to w should be rendered
+// with ANSI styling. That's only the case when w is a terminal and the
+// NO_COLOR environment variable (https://no-color.org) is unset or empty.
+func shouldStyleMarkdown(w io.Writer, getEnv func(string) string) bool {
+	if getEnv("NO_COLOR") != "" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	return ok && isatty.IsTerminal(f.Fd())
+}
+
+// renderMarkdown renders the most commonly used parts of markdown with ANSI
+// styling for display on a terminal: headings, code fences, inline code,
+// bold and italic text, bullet lists, block quotes, and links. Anything else
+// is passed through unchanged. This is not a full CommonMark implementation;
+// the goal is just for "next steps" messages to be pleasant to read.
+func renderMarkdown(msg string) string {
+	st := newMarkdownStyles()
+
+	lines := strings.Split(msg, "\n")
+	out := make([]string, 0, len(lines))
+	inFence := false
+	for _, line := range lines {
+		if mdFenceRE.MatchString(line) {
+			// The fence lines themselves are dropped; the indentation of the
+			// code block is enough to set it apart.
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			out = append(out, "    "+st.code(line))
+			continue
+		}
+		if m := mdHeadingRE.FindStringSubmatch(line); m != nil {
+			style := st.subheading
+			if len(m[1]) == 1 {
+				style = st.heading
+			}
+			out = append(out, style(renderMarkdownInline(m[2], st)))
+			continue
+		}
+		if m := mdBulletRE.FindStringSubmatch(line); m != nil {
+			out = append(out, m[1]+"• "+renderMarkdownInline(m[2], st))
+			continue
+		}
+		if m := mdQuoteRE.FindStringSubmatch(line); m != nil {
+			out = append(out, st.faint("│ ")+renderMarkdownInline(m[1], st))
+			continue
+		}
+		out = append(out, renderMarkdownInline(line, st))
+	}
+	return strings.Join(out, "\n")
+}
+
+// renderMarkdownInline styles the inline markdown elements in a single line.
+// The contents of code spans are left alone.
+func renderMarkdownInline(line string, st *markdownStyles) string {
+	var sb strings.Builder
+	last := 0
+	for _, loc := range mdCodeSpanRE.FindAllStringSubmatchIndex(line, -1) {
+		sb.WriteString(renderMarkdownText(line[last:loc[0]], st))
+		sb.WriteString(st.code(line[loc[2]:loc[3]]))
+		last = loc[1]
+	}
+	sb.WriteString(renderMarkdownText(line[last:], st))
+	return sb.String()
+}
+
+// renderMarkdownText styles the emphasis and links in a piece of text that
+// contains no code spans. Links are shown as their text followed by the URL,
+// because not every terminal supports clickable hyperlinks.
+func renderMarkdownText(s string, st *markdownStyles) string {
+	s = mdLinkRE.ReplaceAllStringFunc(s, func(m string) string {
+		sub := mdLinkRE.FindStringSubmatch(m)
+		text, url := sub[1], sub[2]
+		if text == url {
+			return st.link(url)
+		}
+		return text + " (" + st.link(url) + ")"
+	})
+	s = mdAutolinkRE.ReplaceAllStringFunc(s, func(m string) string {
+		return st.link(mdAutolinkRE.FindStringSubmatch(m)[1])
+	})
+	s = mdBoldRE.ReplaceAllStringFunc(s, func(m string) string {
+		sub := mdBoldRE.FindStringSubmatch(m)
+		if sub[1] != sub[3] {
+			return m
+		}
+		return st.bold(sub[2])
+	})
+	s = mdItalicStarRE.ReplaceAllStringFunc(s, func(m string) string {
+		return st.italic(mdItalicStarRE.FindStringSubmatch(m)[1])
+	})
+	s = mdItalicUndRE.ReplaceAllStringFunc(s, func(m string) string {
+		sub := mdItalicUndRE.FindStringSubmatch(m)
+		return sub[1] + st.italic(sub[2]) + sub[3]
+	})
+	return s
+}
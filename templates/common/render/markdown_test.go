@@ -0,0 +1,123 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	t.Parallel()
+
+	st := newMarkdownStyles()
+	bulletDot := "• "
+
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "plain_text",
+			in:   "hello world",
+			want: "hello world",
+		},
+		{
+			name: "headings",
+			in:   "# Next steps\n## Deploy ##",
+			want: st.heading("Next steps") + "\n" + st.bold("Deploy"),
+		},
+		{
+			name: "code_fence",
+			in:   "Run:\n```shell\ncd foo\nmake\n```\nDone",
+			want: "Run:\n    " + st.code("cd foo") + "\n    " + st.code("make") + "\nDone",
+		},
+		{
+			name: "markdown_inside_code_fence_is_untouched",
+			in:   "```\n# not a heading *a*\n```",
+			want: "    " + st.code("# not a heading *a*"),
+		},
+		{
+			name: "inline_code",
+			in:   "run `make **all**` now",
+			want: "run " + st.code("make **all**") + " now",
+		},
+		{
+			name: "emphasis",
+			in:   "a **strong** and *soft* and _also soft_ word",
+			want: "a " + st.bold("strong") + " and " + st.italic("soft") + " and " + st.italic("also soft") + " word",
+		},
+		{
+			name: "underscores_inside_words",
+			in:   "my_snake_case_name",
+			want: "my_snake_case_name",
+		},
+		{
+			name: "links",
+			in:   "see [the docs](https://example.com/docs) or <https://example.com>",
+			want: "see the docs (" + st.link("https://example.com/docs") + ") or " + st.link("https://example.com"),
+		},
+		{
+			name: "link_text_same_as_url",
+			in:   "[https://example.com](https://example.com)",
+			want: st.link("https://example.com"),
+		},
+		{
+			name: "bullets_and_quotes",
+			in:   "- one\n  * two\n> note",
+			want: bulletDot + "one\n  " + bulletDot + "two\n" + st.faint("│ ") + "note",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := renderMarkdown(tc.in)
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("output was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestShouldStyleMarkdown(t *testing.T) {
+	t.Parallel()
+
+	noEnv := func(string) string { return "" }
+	noColor := func(k string) string {
+		if k == "NO_COLOR" {
+			return "1"
+		}
+		return ""
+	}
+
+	f, err := os.CreateTemp(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if shouldStyleMarkdown(f, noEnv) {
+		t.Errorf("got true for a regular file, wanted false")
+	}
+	if shouldStyleMarkdown(os.Stdout, noColor) {
+		t.Errorf("got true with NO_COLOR set, wanted false")
+	}
+}
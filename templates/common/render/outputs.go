@@ -0,0 +1,63 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/errs"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
+)
+
+// evalOutputs computes the values of the outputs declared in the spec, keyed by
+// output name. Returns nil if there are no outputs.
+//
+// Outputs are saved in the manifest, so they must not reveal secrets. An
+// output that refers to one of the inputs in secretRefs (which were resolved
+// from secret references) is an error.
+func evalOutputs(ctx context.Context, scope *common.Scope, outputs []*spec.Output, secretRefs map[string]string) (map[string]string, error) {
+	if len(outputs) == 0 {
+		return nil, nil
+	}
+
+	// Hiding the secret inputs from the CEL expressions means referencing one
+	// fails to compile, no matter how the expression uses it.
+	if len(secretRefs) > 0 {
+		vars := scope.AllVars()
+		for name := range secretRefs {
+			delete(vars, name)
+		}
+		scope = common.NewScope(vars, scope.GoTmplFuncs())
+	}
+
+	out := make(map[string]string, len(outputs))
+	for _, o := range outputs {
+		var val string
+		if err := common.CelCompileAndEval(ctx, scope, o.Value, &val); err != nil {
+			var unknownVar *errs.UnknownVarError
+			if errors.As(err, &unknownVar) {
+				if _, ok := secretRefs[unknownVar.VarName]; ok {
+					return nil, o.Value.Pos.Errorf("output %q can't use the input %q, because that input is a secret and outputs are saved in the manifest", o.Name.Val, unknownVar.VarName)
+				}
+			}
+			return nil, fmt.Errorf("failed computing the value of output %q: %w", o.Name.Val, err)
+		}
+		out[o.Name.Val] = val
+	}
+	return out, nil
+}
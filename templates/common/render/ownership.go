@@ -0,0 +1,123 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common"
+	manifestutil "github.com/abcxyz/abc/templates/model/manifest"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// fileOwner is a template installation in the destination directory that
+// output a given file.
+type fileOwner struct {
+	// The path of the installation's manifest, relative to the destination
+	// directory.
+	manifestPath string
+
+	// The template location from the manifest. Empty if the template was
+	// installed from a non-canonical location.
+	templateLocation string
+}
+
+func (o *fileOwner) String() string {
+	if o.templateLocation == "" {
+		return fmt.Sprintf("the template installed by %s", o.manifestPath)
+	}
+	return fmt.Sprintf("the template %q installed by %s", o.templateLocation, o.manifestPath)
+}
+
+// loadFileOwners reads the manifests of the other template installations in
+// p.DestDir and returns which installation owns each output file. The keys are
+// slash-separated paths relative to p.DestDir. The manifest at
+// p.OwnManifestPath, if any, is left out, since those files belong to the
+// installation that's being rendered.
+//
+// A manifest that can't be read is skipped with a warning rather than
+// blocking the render.
+func loadFileOwners(ctx context.Context, p *Params) (map[string]*fileOwner, error) {
+	logger := logging.FromContext(ctx).With("logger", "loadFileOwners")
+
+	manifestDir := filepath.Join(p.DestDir, common.ABCInternalDir)
+	entries, err := fs.ReadDir(p.FS, manifestDir)
+	if err != nil {
+		if common.IsNotExistErr(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ReadDir(%q): %w", manifestDir, err)
+	}
+
+	out := make(map[string]*fileOwner)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, "manifest") || filepath.Ext(name) != ".yaml" {
+			continue
+		}
+		path := filepath.Join(manifestDir, name)
+		if p.OwnManifestPath != "" && sameFile(path, p.OwnManifestPath) {
+			continue
+		}
+
+		m, _, err := manifestutil.Load(ctx, p.FS, path)
+		if err != nil {
+			logger.WarnContext(ctx, "couldn't read the manifest of another template installation in the destination directory, so the files it owns aren't known",
+				"path", path,
+				"error", err)
+			continue
+		}
+		owner := &fileOwner{
+			manifestPath:     filepath.Join(common.ABCInternalDir, name),
+			templateLocation: m.TemplateLocation.Val,
+		}
+		for _, f := range m.OutputFiles {
+			out[f.File.Val] = owner
+		}
+	}
+	return out, nil
+}
+
+// sameFile reports whether the two paths name the same file, comparing their
+// absolute forms.
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// checkOwner returns an error if relPath, a file that the template is about to
+// write, is owned by another template installation. With --force-overwrite,
+// it's only a warning.
+func checkOwner(ctx context.Context, p *Params, owners map[string]*fileOwner, relPath string) error {
+	owner, ok := owners[filepath.ToSlash(relPath)]
+	if !ok {
+		return nil
+	}
+	if p.ForceOverwrite {
+		logging.FromContext(ctx).WarnContext(ctx, "overwriting a file that's owned by another template installation, because of --force-overwrite; upgrading either template may clobber the other's changes",
+			"path", relPath,
+			"owner_manifest", owner.manifestPath,
+			"owner_template", owner.templateLocation)
+		return nil
+	}
+	return common.WithCategory(common.CategoryOverwriteRefused,
+		fmt.Errorf("the template would write %q, but that file is owned by %s; templates rendered into the same directory can't output the same file (use --force-overwrite to write it anyway)",
+			relPath, owner))
+}
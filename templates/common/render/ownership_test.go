@@ -0,0 +1,138 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestRender_FileOwnership(t *testing.T) {
+	t.Parallel()
+
+	specContents := func(file string) string {
+		return `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'A template'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['` + file + `']
+`
+	}
+
+	cases := []struct {
+		name           string
+		firstFile      string
+		secondFile     string
+		forceOverwrite bool
+		want           map[string]string
+		wantErr        string
+	}{
+		{
+			name:       "distinct_files",
+			firstFile:  "a.txt",
+			secondFile: "b.txt",
+			want: map[string]string{
+				"a.txt": "first",
+				"b.txt": "second",
+			},
+		},
+		{
+			name:       "shared_file",
+			firstFile:  "shared.txt",
+			secondFile: "shared.txt",
+			want: map[string]string{
+				"shared.txt": "first",
+			},
+			wantErr: `the template would write "shared.txt", but that file is owned by the template installed by .abc/manifest_nolocation_2024-03-01T00:00:00Z.lock.yaml; templates rendered into the same directory can't output the same file`,
+		},
+		{
+			name:           "shared_file_with_force_overwrite",
+			firstFile:      "shared.txt",
+			secondFile:     "shared.txt",
+			forceOverwrite: true,
+			want: map[string]string{
+				"shared.txt": "second",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			firstDir := filepath.Join(tempDir, "first")
+			secondDir := filepath.Join(tempDir, "second")
+			outDir := filepath.Join(tempDir, "out")
+			abctestutil.WriteAll(t, firstDir, map[string]string{
+				"spec.yaml":  specContents(tc.firstFile),
+				tc.firstFile: "first",
+			})
+			abctestutil.WriteAll(t, secondDir, map[string]string{
+				"spec.yaml":   specContents(tc.secondFile),
+				tc.secondFile: "second",
+			})
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			clk := clock.NewMock()
+			clk.Set(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+			render := func(srcDir string, forceOverwrite bool) error {
+				_, err := Render(ctx, &Params{
+					Clock:             clk,
+					Cwd:               tempDir,
+					Downloader:        &templatesource.LocalDownloader{SrcPath: srcDir},
+					ForceOverwrite:    forceOverwrite,
+					FS:                &common.RealFS{},
+					OutDir:            outDir,
+					SourceForMessages: srcDir,
+					Stdout:            io.Discard,
+					TempDirBase:       tempDir,
+					UpgradeChannel:    "main",
+				})
+				return err //nolint:wrapcheck
+			}
+
+			if err := render(firstDir, false); err != nil {
+				t.Fatal(err)
+			}
+			clk.Add(time.Second)
+			err := render(secondDir, tc.forceOverwrite)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+
+			got := abctestutil.LoadDir(t, outDir, abctestutil.SkipGlob(".abc/*"))
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("output was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
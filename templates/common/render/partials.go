@@ -0,0 +1,74 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// partialsDir is the directory, relative to the template root, that holds the
+// named templates that go_template actions can invoke.
+const partialsDir = "_partials"
+
+// loadPartials reads the template's _partials directory. Each file becomes a
+// named template whose name is its path relative to the _partials directory,
+// using forward slashes, with the file extension removed. For example,
+// _partials/go/license_header.tmpl is named "go/license_header". Returns nil if
+// the template has no _partials directory.
+func loadPartials(sp *stepParams) (map[string]string, error) {
+	root := filepath.Join(sp.templateDir, partialsDir)
+	if _, err := sp.rp.FS.Stat(root); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("Stat(%s): %w", root, err)
+	}
+
+	partials := map[string]string{}
+	sources := map[string]string{}
+	if err := fs.WalkDir(sp.rp.FS, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return fmt.Errorf("filepath.Rel(%s,%s): %w", root, p, err)
+		}
+		rel = filepath.ToSlash(rel)
+		name := strings.TrimSuffix(rel, path.Ext(rel))
+		if other, ok := sources[name]; ok {
+			return fmt.Errorf("the partials %q and %q in the %s directory would both be named %q; rename one of them",
+				other, rel, partialsDir, name)
+		}
+		buf, err := sp.rp.FS.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("ReadFile(%s): %w", p, err)
+		}
+		sources[name] = rel
+		partials[name] = string(buf)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed loading partials: %w", err)
+	}
+	return partials, nil
+}
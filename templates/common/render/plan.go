@@ -0,0 +1,197 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/benbjohnson/clock"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/render/gotmpl"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/abc/templates/model"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
+)
+
+// PlanParams are the parameters to Plan.
+type PlanParams struct {
+	// The template spec whose steps are planned.
+	Spec *spec.Spec
+
+	// The fully resolved template inputs, as returned by input.Resolve.
+	Inputs map[string]string
+
+	// The builtin _git_* variables of the downloaded template.
+	DownloaderVars templatesource.DownloaderVars
+
+	// Used for the _now_ms builtin variable. Optional, defaults to the real
+	// clock.
+	Clock clock.Clock
+}
+
+// PlannedStep is a single step of a template, as it would be executed for a
+// given set of inputs.
+type PlannedStep struct {
+	// The step number, counting from 1. Steps inside a for_each are numbered
+	// like "2.1", with their parent's number as a prefix.
+	Number string
+
+	// The action name, like "include".
+	Action string
+
+	// The step's "desc" field.
+	Desc string
+
+	// The line of the step in spec.yaml.
+	Line int
+
+	// The step's "if" expression, or empty if it has none.
+	If string
+
+	// Whether the step would execute, which is false only if its "if"
+	// expression evaluated to false.
+	Runs bool
+
+	// For steps inside a for_each, the iterator variable binding, like
+	// "env=prod".
+	Iteration string
+
+	// The paths that the step would read or write, relative to the template
+	// output, after Go template expansion. Only set for steps that run.
+	Targets []string
+}
+
+// Plan works out which steps of a template would execute for the given inputs,
+// and which files they'd touch, without executing any of them. The "if"
+// conditions are evaluated and for_each loops are expanded just as they are
+// during a render.
+func Plan(ctx context.Context, pp *PlanParams) ([]*PlannedStep, error) {
+	scope, err := NewScope(&ScopeParams{
+		Spec:           pp.Spec,
+		Inputs:         pp.Inputs,
+		DownloaderVars: pp.DownloaderVars,
+		Clock:          pp.Clock,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return planSteps(ctx, pp.Spec.Steps, scope, "", "")
+}
+
+func planSteps(ctx context.Context, steps []*spec.Step, scope *common.Scope, numberPrefix, iteration string) ([]*PlannedStep, error) {
+	var out []*PlannedStep
+	for i, step := range steps {
+		ps := &PlannedStep{
+			Number:    fmt.Sprintf("%s%d", numberPrefix, i+1),
+			Action:    step.Action.Val,
+			Desc:      step.Desc.Val,
+			Line:      step.Pos.Line,
+			If:        step.If.Val,
+			Runs:      true,
+			Iteration: iteration,
+		}
+		out = append(out, ps)
+
+		if step.If.Val != "" {
+			if err := common.CelCompileAndEval(ctx, scope, step.If, &ps.Runs); err != nil {
+				return nil, fmt.Errorf(`failed to evaluate CEL expression in "if" field of step %s: %w`, ps.Number, err)
+			}
+		}
+		if !ps.Runs {
+			continue
+		}
+
+		if step.ForEach != nil {
+			children, err := planForEach(ctx, step.ForEach, scope, ps.Number+".")
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, children...)
+			continue
+		}
+
+		targets, err := stepTargets(step, scope)
+		if err != nil {
+			return nil, err
+		}
+		ps.Targets = targets
+	}
+	return out, nil
+}
+
+func planForEach(ctx context.Context, fe *spec.ForEach, scope *common.Scope, numberPrefix string) ([]*PlannedStep, error) {
+	key, err := gotmpl.ParseExec(fe.Iterator.Key.Pos, fe.Iterator.Key.Val, scope)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	var values []string
+	if len(fe.Iterator.Values) > 0 {
+		values, err = gotmpl.ParseExecAll(fe.Iterator.Values, scope)
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+	} else if err := common.CelCompileAndEval(ctx, scope, *fe.Iterator.ValuesFrom, &values); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	var out []*PlannedStep
+	for _, keyVal := range values {
+		children, err := planSteps(ctx, fe.Steps, scope.With(map[string]string{key: keyVal}), numberPrefix, key+"="+keyVal)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, children...)
+	}
+	return out, nil
+}
+
+// stepTargets returns the paths named by the given step, after templating.
+func stepTargets(step *spec.Step, scope *common.Scope) ([]string, error) {
+	var paths []model.String
+	switch {
+	case step.Append != nil:
+		paths = step.Append.Paths
+	case step.GoTemplate != nil:
+		paths = step.GoTemplate.Paths
+	case step.Include != nil:
+		for _, ip := range step.Include.Paths {
+			// When "as" is given, it names the output paths.
+			if len(ip.As) > 0 {
+				paths = append(paths, ip.As...)
+			} else {
+				paths = append(paths, ip.Paths...)
+			}
+		}
+	case step.RegexNameLookup != nil:
+		paths = step.RegexNameLookup.Paths
+	case step.RegexReplace != nil:
+		paths = step.RegexReplace.Paths
+	case step.StringReplace != nil:
+		paths = step.StringReplace.Paths
+	}
+
+	processed, err := processPaths(paths, scope)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(processed))
+	for _, p := range processed {
+		out = append(out, p.Val)
+	}
+	return out, nil
+}
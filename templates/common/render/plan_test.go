@@ -0,0 +1,149 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/specutil"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestPlan(t *testing.T) {
+	t.Parallel()
+
+	specContents := `api_version: 'cli.abcxyz.dev/v1beta6'
+kind: 'Template'
+desc: 'A template'
+inputs:
+  - name: 'with_docs'
+    desc: 'whether to include docs'
+    default: 'false'
+  - name: 'service'
+    desc: 'the service name'
+steps:
+  - desc: 'Include the sources'
+    action: 'include'
+    params:
+      paths:
+        - paths: ['main.go']
+          as: ['cmd/{{.service}}/main.go']
+        - paths: ['go.mod']
+  - desc: 'Include the docs'
+    if: 'bool(with_docs)'
+    action: 'include'
+    params:
+      paths: ['docs']
+  - desc: 'Per environment'
+    action: 'for_each'
+    params:
+      iterator:
+        key: 'env'
+        values: ['dev', 'prod']
+      steps:
+        - desc: 'Replace the env'
+          action: 'string_replace'
+          params:
+            paths: ['config/{{.env}}.yaml']
+            replacements:
+              - to_replace: 'ENV'
+                with: '{{.env}}'
+        - desc: 'Announce prod'
+          action: 'print'
+          if: 'env == "prod"'
+          params:
+            message: 'prod!'
+`
+
+	cases := []struct {
+		name    string
+		inputs  map[string]string
+		want    []*PlannedStep
+		wantErr string
+	}{
+		{
+			name: "docs_skipped",
+			inputs: map[string]string{
+				"with_docs": "false",
+				"service":   "foo",
+			},
+			want: []*PlannedStep{
+				{Number: "1", Action: "include", Desc: "Include the sources", Line: 11, Runs: true, Targets: []string{"cmd/foo/main.go", "go.mod"}},
+				{Number: "2", Action: "include", Desc: "Include the docs", Line: 18, If: "bool(with_docs)", Runs: false},
+				{Number: "3", Action: "for_each", Desc: "Per environment", Line: 23, Runs: true},
+				{Number: "3.1", Action: "string_replace", Desc: "Replace the env", Line: 30, Runs: true, Iteration: "env=dev", Targets: []string{"config/dev.yaml"}},
+				{Number: "3.2", Action: "print", Desc: "Announce prod", Line: 37, If: `env == "prod"`, Runs: false, Iteration: "env=dev"},
+				{Number: "3.1", Action: "string_replace", Desc: "Replace the env", Line: 30, Runs: true, Iteration: "env=prod", Targets: []string{"config/prod.yaml"}},
+				{Number: "3.2", Action: "print", Desc: "Announce prod", Line: 37, If: `env == "prod"`, Runs: true, Iteration: "env=prod", Targets: []string{}},
+			},
+		},
+		{
+			name: "docs_included",
+			inputs: map[string]string{
+				"with_docs": "true",
+				"service":   "foo",
+			},
+			want: []*PlannedStep{
+				{Number: "1", Action: "include", Desc: "Include the sources", Line: 11, Runs: true, Targets: []string{"cmd/foo/main.go", "go.mod"}},
+				{Number: "2", Action: "include", Desc: "Include the docs", Line: 18, If: "bool(with_docs)", Runs: true, Targets: []string{"docs"}},
+				{Number: "3", Action: "for_each", Desc: "Per environment", Line: 23, Runs: true},
+				{Number: "3.1", Action: "string_replace", Desc: "Replace the env", Line: 30, Runs: true, Iteration: "env=dev", Targets: []string{"config/dev.yaml"}},
+				{Number: "3.2", Action: "print", Desc: "Announce prod", Line: 37, If: `env == "prod"`, Runs: false, Iteration: "env=dev"},
+				{Number: "3.1", Action: "string_replace", Desc: "Replace the env", Line: 30, Runs: true, Iteration: "env=prod", Targets: []string{"config/prod.yaml"}},
+				{Number: "3.2", Action: "print", Desc: "Announce prod", Line: 37, If: `env == "prod"`, Runs: true, Iteration: "env=prod", Targets: []string{}},
+			},
+		},
+		{
+			name: "bad_if_expression",
+			inputs: map[string]string{
+				"with_docs": "not a bool",
+				"service":   "foo",
+			},
+			wantErr: `failed to evaluate CEL expression in "if" field of step 2`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			templateDir := t.TempDir()
+			abctestutil.WriteAll(t, templateDir, map[string]string{"spec.yaml": specContents})
+			sp, err := specutil.Load(ctx, &common.RealFS{}, templateDir, templateDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := Plan(ctx, &PlanParams{
+				Spec:   sp,
+				Inputs: tc.inputs,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("plan was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
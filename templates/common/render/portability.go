@@ -0,0 +1,148 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// windowsMaxPath is MAX_PATH on Windows, the longest path that many Windows
+// programs can handle, including the terminating NUL character.
+const windowsMaxPath = 260
+
+// checkPortablePaths looks for output paths that can't be written on some
+// filesystems, so that the user gets a clear error rather than a cryptic OS
+// error partway through writing the output:
+//
+//   - Paths that differ only by case, like "README.md" and "readme.md", which
+//     are the same file on case-insensitive filesystems (the default on macOS
+//     and Windows).
+//   - Paths that are too long for Windows.
+//
+// Each problem is an error if it would actually break this render, and only a
+// warning if it would break rendering the same template elsewhere.
+func checkPortablePaths(ctx context.Context, p *Params, scratchDir string) error {
+	// The destination is where the files end up, even when they're first
+	// written to a temporary OutDir, as for an upgrade.
+	return checkPortablePathsOn(ctx, p.FS, scratchDir, p.DestDir, runtime.GOOS, caseInsensitive(ctx, p.FS, p.DestDir))
+}
+
+// checkPortablePathsOn is checkPortablePaths with the facts about the OS and
+// filesystem provided by the caller, for testing.
+func checkPortablePathsOn(ctx context.Context, rfs common.FS, scratchDir, destDir, goos string, caseInsensitiveFS bool) error {
+	logger := logging.FromContext(ctx).With("logger", "checkPortablePaths")
+
+	byFoldedPath := map[string]string{}
+	var longest string
+	if err := fs.WalkDir(rfs, scratchDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == scratchDir {
+			return nil
+		}
+		relPath, err := filepath.Rel(scratchDir, path)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		folded := strings.ToLower(relPath)
+		if other, ok := byFoldedPath[folded]; ok {
+			if caseInsensitiveFS {
+				return fmt.Errorf("the template output both %q and %q, but they'd be the same file on the case-insensitive destination filesystem; the template should be changed to output only one of them",
+					other, relPath)
+			}
+			logger.WarnContext(ctx, "the template output files whose names differ only by case, which will fail on case-insensitive filesystems like the defaults on macOS and Windows",
+				"path", relPath,
+				"other_path", other)
+		}
+		byFoldedPath[folded] = relPath
+
+		if len(relPath) > len(longest) {
+			longest = relPath
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed checking output paths: %w", err)
+	}
+
+	if longest == "" {
+		return nil
+	}
+	absLen := len(filepath.Join(destDir, longest))
+	switch {
+	case goos == "windows" && absLen >= windowsMaxPath:
+		return fmt.Errorf("the output path %q would be %d characters long in the destination directory, but paths on Windows are limited to %d characters unless long paths are enabled; use a destination directory with a shorter path",
+			longest, absLen, windowsMaxPath-1)
+	case len(longest) >= windowsMaxPath:
+		logger.WarnContext(ctx, "the template output a path that is too long to be written on Windows",
+			"path", longest,
+			"length", len(longest),
+			"windows_limit", windowsMaxPath-1)
+	}
+	return nil
+}
+
+// caseInsensitive returns whether the filesystem that dir is on (or would be
+// on, if it doesn't exist yet) treats file names case-insensitively. It checks
+// by creating a temporary file in the nearest existing ancestor of dir. If that
+// fails, it assumes the default for the OS. A MemFS is always case-sensitive.
+func caseInsensitive(ctx context.Context, rfs common.FS, dir string) bool {
+	logger := logging.FromContext(ctx).With("logger", "caseInsensitive")
+
+	if common.IsInMemory(rfs) {
+		return false
+	}
+
+	osDefault := runtime.GOOS == "darwin" || runtime.GOOS == "windows"
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		} else if !common.IsNotExistErr(err) {
+			return osDefault
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return osDefault
+		}
+		dir = parent
+	}
+
+	f, err := os.CreateTemp(dir, ".abc_case_probe_")
+	if err != nil {
+		logger.DebugContext(ctx, "couldn't create a file to check case sensitivity, assuming the OS default",
+			"dir", dir,
+			"error", err)
+		return osDefault
+	}
+	name := f.Name()
+	f.Close()
+	defer os.Remove(name)
+
+	// The random part of the temp file name is digits, so upper-casing the
+	// base name changes only the prefix.
+	upper := filepath.Join(dir, strings.ToUpper(filepath.Base(name)))
+	_, err = os.Stat(upper)
+	return err == nil
+}
@@ -0,0 +1,146 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/abcxyz/abc/templates/common"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestCheckPortablePathsOn(t *testing.T) {
+	t.Parallel()
+
+	longName := strings.Repeat("x", 200)
+
+	cases := []struct {
+		name              string
+		files             map[string]string
+		destDir           string
+		goos              string
+		caseInsensitiveFS bool
+		wantErr           string
+	}{
+		{
+			name: "no_problems",
+			files: map[string]string{
+				"README.md":   "",
+				"src/main.go": "",
+			},
+			destDir: "/dest",
+			goos:    "linux",
+		},
+		{
+			name: "case_collision_on_case_insensitive_fs",
+			files: map[string]string{
+				"README.md": "",
+				"readme.md": "",
+			},
+			destDir:           "/dest",
+			goos:              "darwin",
+			caseInsensitiveFS: true,
+			wantErr:           `the template output both "README.md" and "readme.md", but they'd be the same file on the case-insensitive destination filesystem`,
+		},
+		{
+			name: "case_collision_in_dir_names",
+			files: map[string]string{
+				"Docs/a.md": "",
+				"docs/b.md": "",
+			},
+			destDir:           "/dest",
+			goos:              "windows",
+			caseInsensitiveFS: true,
+			wantErr:           `the template output both "Docs" and "docs"`,
+		},
+		{
+			name: "case_collision_on_case_sensitive_fs_is_only_a_warning",
+			files: map[string]string{
+				"README.md": "",
+				"readme.md": "",
+			},
+			destDir: "/dest",
+			goos:    "linux",
+		},
+		{
+			name: "long_path_on_windows",
+			files: map[string]string{
+				longName + "/" + longName + ".txt": "",
+			},
+			destDir: `C:\Users\me\dest`,
+			goos:    "windows",
+			wantErr: "paths on Windows are limited to 259 characters",
+		},
+		{
+			name: "long_path_elsewhere_is_only_a_warning",
+			files: map[string]string{
+				longName + "/" + longName + ".txt": "",
+			},
+			destDir: "/dest",
+			goos:    "linux",
+		},
+		{
+			name: "short_enough_on_windows",
+			files: map[string]string{
+				longName + ".txt": "",
+			},
+			destDir: `C:\dest`,
+			goos:    "windows",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			scratchDir := t.TempDir()
+			if caseInsensitive(ctx, &common.RealFS{}, scratchDir) {
+				t.Skip("the temp dir is on a case-insensitive filesystem, so colliding test files can't be created")
+			}
+			abctestutil.WriteAll(t, scratchDir, tc.files)
+
+			err := checkPortablePathsOn(ctx, &common.RealFS{}, scratchDir, tc.destDir, tc.goos, tc.caseInsensitiveFS)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestCaseInsensitive_LeavesNoProbeFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+
+	// The check walks up to the nearest directory that exists.
+	caseInsensitive(ctx, &common.RealFS{}, filepath.Join(dir, "does", "not", "exist"))
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("got %d leftover files in %s, want none", len(entries), dir)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/render/gotmpl"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/abc/templates/model"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1beta7"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// remoteIncludes downloads the sources of "include" actions with "from:
+// remote". Each source is downloaded at most once per render, into its own
+// subdirectory of baseDir.
+type remoteIncludes struct {
+	// A temp directory that's within the render's jail.
+	baseDir string
+
+	mu        sync.Mutex
+	downloads map[string]*remoteDownload // keyed by source, including version
+}
+
+type remoteDownload struct {
+	dir    string
+	dlMeta *templatesource.DownloadMetadata
+}
+
+// specHasRemoteIncludes returns whether any of the given steps, including
+// nested for_each steps, is an include with "from: remote".
+func specHasRemoteIncludes(steps []*spec.Step) bool {
+	for _, step := range steps {
+		if step.ForEach != nil && specHasRemoteIncludes(step.ForEach.Steps) {
+			return true
+		}
+		if step.Include == nil {
+			continue
+		}
+		for _, inc := range step.Include.Paths {
+			if inc.From.Val == "remote" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dir returns the directory that the given include's source was downloaded
+// to, downloading it if this render hasn't already.
+func (r *remoteIncludes) dir(ctx context.Context, inc *spec.IncludePath, sp *stepParams) (string, error) {
+	source, err := remoteIncludeSource(inc, sp.scope)
+	if err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if d, ok := r.downloads[source]; ok {
+		return d.dir, nil
+	}
+
+	logger := logging.FromContext(ctx).With("logger", "remoteIncludes.dir")
+	logger.DebugContext(ctx, "downloading remote include source", "source", source)
+
+	downloader, err := templatesource.ParseSource(ctx, &templatesource.ParseSourceParams{
+		CWD:             sp.rp.Cwd,
+		Source:          source,
+		FlagGitProtocol: sp.rp.GitProtocol,
+	})
+	if err != nil {
+		return "", inc.Source.Pos.Errorf("failed parsing remote include source: %w", err)
+	}
+	dir, err := sp.rp.FS.MkdirTemp(r.baseDir, "")
+	if err != nil {
+		return "", fmt.Errorf("MkdirTemp: %w", err)
+	}
+	dlMeta, err := downloader.Download(ctx, sp.rp.Cwd, dir, sp.rp.DestDir)
+	if err != nil {
+		return "", common.WithCategory(common.CategoryDownload,
+			inc.Source.Pos.Errorf("failed downloading remote include source %q: %w", source, err))
+	}
+	if r.downloads == nil {
+		r.downloads = map[string]*remoteDownload{}
+	}
+	r.downloads[source] = &remoteDownload{dir: dir, dlMeta: dlMeta}
+	return dir, nil
+}
+
+// remoteIncludeSource returns the include's source, with its template
+// expressions evaluated and its version appended.
+func remoteIncludeSource(inc *spec.IncludePath, scope *common.Scope) (string, error) {
+	source, err := gotmpl.ParseExec(inc.Source.Pos, inc.Source.Val, scope)
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+	if inc.Version.Val == "" {
+		return source, nil
+	}
+	version, err := gotmpl.ParseExec(inc.Version.Pos, inc.Version.Val, scope)
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+	return source + "@" + version, nil
+}
+
+// manifestEntries returns the sources that were downloaded, in the form that
+// they're recorded in the manifest, sorted by source. It's nil-safe.
+func (r *remoteIncludes) manifestEntries() []*manifest.RemoteInclude {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make([]*manifest.RemoteInclude, 0, len(r.downloads))
+	for source, d := range r.downloads {
+		out = append(out, &manifest.RemoteInclude{
+			Source:   model.String{Val: source},
+			Location: model.String{Val: d.dlMeta.CanonicalSource},
+			Version:  model.String{Val: d.dlMeta.Version},
+		})
+	}
+	sort.Slice(out, func(l, r int) bool {
+		return out[l].Source.Val < out[r].Source.Val
+	})
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
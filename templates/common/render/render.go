@@ -16,7 +16,9 @@ package render
 
 import (
 	"context"
+	"crypto"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
@@ -24,38 +26,81 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/benbjohnson/clock"
 	"golang.org/x/exp/maps"
 
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/auditlog"
 	"github.com/abcxyz/abc/templates/common/builtinvar"
+	"github.com/abcxyz/abc/templates/common/config"
+	"github.com/abcxyz/abc/templates/common/destlock"
+	"github.com/abcxyz/abc/templates/common/indexutil"
 	"github.com/abcxyz/abc/templates/common/input"
+	"github.com/abcxyz/abc/templates/common/messages"
+	"github.com/abcxyz/abc/templates/common/policyutil"
 	"github.com/abcxyz/abc/templates/common/render/gotmpl/funcs"
 	"github.com/abcxyz/abc/templates/common/rules"
 	"github.com/abcxyz/abc/templates/common/run"
+	"github.com/abcxyz/abc/templates/common/secrets"
 	"github.com/abcxyz/abc/templates/common/specutil"
+	"github.com/abcxyz/abc/templates/common/telemetry"
 	"github.com/abcxyz/abc/templates/common/tempdir"
 	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/abc/templates/common/warnings"
 	"github.com/abcxyz/abc/templates/model"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1beta7"
 	"github.com/abcxyz/abc/templates/model/spec/features"
-	spec "github.com/abcxyz/abc/templates/model/spec/v1beta6"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
 	"github.com/abcxyz/pkg/logging"
 	"github.com/abcxyz/pkg/sets"
 )
 
+const (
+	// FileMetadataPermissions gives output files the permission bits of the
+	// template files they came from, and a fresh modification time. This is the
+	// default.
+	FileMetadataPermissions = "permissions"
+
+	// FileMetadataPreserve gives output files the full mode bits (including
+	// setuid, setgid, and sticky) and the modification time of the template
+	// files they came from. Files that are modified by a step get the time of
+	// the modification.
+	FileMetadataPreserve = "preserve"
+
+	// FileMetadataXattrs is like FileMetadataPreserve, but also gives output
+	// files the extended attributes (xattrs) of the template files they came
+	// from, like SELinux labels and POSIX ACLs. Xattrs that can't be set on
+	// the destination are logged and listed in Result.CopyStats, rather than
+	// failing the render.
+	FileMetadataXattrs = "xattrs"
+)
+
+// FileMetadataPolicies are the valid values of Params.FileMetadata.
+var FileMetadataPolicies = []string{FileMetadataPermissions, FileMetadataPreserve, FileMetadataXattrs}
+
 // Params contains the arguments to Render().
 type Params struct {
 	// The value of --accept-defaults.
 	AcceptDefaults bool
 
+	// The value of --allow-buf-generate. The buf_generate action runs the buf
+	// CLI outside of the wasm sandbox. Its buf.gen.yaml is checked so that buf
+	// only runs remote plugins and only writes inside the scratch directory,
+	// but buf itself still runs natively and uses the network, so the action
+	// fails unless the user allowed it.
+	AllowBufGenerate bool
+
 	// Only used when BackfillManifestOnly is set. The user acknowledges that
 	// the backfilled manifest file will be missing patches for files that were
 	// "included from destination".
 	ContinueWithoutPatches bool
 
 	// BackupDir is the directory where overwritten files will be backed up.
-	// BackupDir is ignored if Backups is false.
+	// BackupDir is ignored if Backups is false. It should be a subdirectory of
+	// the backup root, like the result of backups.ParentDir, because the
+	// manifest records the backup's location relative to BackupDir's parent.
 	BackupDir string
 	Backups   bool
 
@@ -64,9 +109,30 @@ type Params struct {
 	// underscore.
 	OverrideBuiltinVars map[string]string
 
+	// The value of --also-render-to. If set, the template is rendered a second
+	// time into this directory, reusing the same download and the inputs of the
+	// first render, except for those overridden by AlsoRenderInputs. This is
+	// for comparing variants of the output side by side, like a preview
+	// environment next to production. Resume doesn't apply to the second
+	// render.
+	AlsoRenderTo string
+
+	// The value of --also-render-input. Inputs that take precedence over all
+	// others, only for the render into AlsoRenderTo.
+	AlsoRenderInputs map[string]string
+
 	// Fakeable time for testing.
 	Clock clock.Clock
 
+	// The value of --conflict-file-names, saved in the manifest. Defaults to
+	// "keep_extension".
+	ConflictFileNames string
+
+	// CopyProgress, if not nil, is called periodically while the rendered files
+	// are copied into the destination directory; see
+	// [common.CopyParams.Progress].
+	CopyProgress func(common.CopyStats)
+
 	// The fakeable working directory for testing.
 	Cwd string
 
@@ -76,6 +142,20 @@ type Params struct {
 	// The value of --debug-step-diffs.
 	DebugStepDiffs bool
 
+	// The value of --debug-report. If set, an HTML report of the diffs made
+	// by each step is written to this directory.
+	DebugReportDir string
+
+	// The value of --report. If set, a self-contained HTML report of the
+	// render is written to this file: the inputs, the steps executed and how
+	// long they took, the files written, and any warnings. It's written
+	// whether or not the render succeeds. Only Render() writes the report.
+	ReportPath string
+
+	// report collects the contents of the --report file. It's set by Render()
+	// when ReportPath is given.
+	report *report
+
 	// The directory that this operation is targeting, from the user's point of
 	// view. It's sometimes the same as OutDir:
 	//   - When Render() is being called as part of `abc render`,
@@ -90,6 +170,11 @@ type Params struct {
 	// The downloader that will provide the template.
 	Downloader templatesource.Downloader
 
+	// The value of --file-metadata, either FileMetadataPermissions or
+	// FileMetadataPreserve. Overrides the template's file_metadata field. Leave
+	// blank to use the template's setting.
+	FileMetadata string
+
 	// The value of --force-overwrite.
 	ForceOverwrite bool
 
@@ -127,10 +212,19 @@ type Params struct {
 	// The value of --keep-temp-dirs.
 	KeepTempDirs bool
 
+	// The value of --wait. How long Render() waits for another render or
+	// upgrade of OutDir to finish, rather than failing. See the destlock
+	// package. RenderAlreadyDownloaded() doesn't take the lock.
+	LockWait time.Duration
+
 	// Override the default behavior of outputting a manifest for the rendered
 	// template.
 	SkipManifest bool
 
+	// If non-nil, the manifest is signed with this key, and the signature is
+	// written next to it. See the signing package.
+	ManifestSigner crypto.Signer
+
 	// The value of --backfill-manifest-only. Whether to *only* create a
 	// manifest file without outputting any other files from the template.
 	BackfillManifestOnly bool
@@ -143,6 +237,27 @@ type Params struct {
 	// The directory where the rendered output will be written.
 	OutDir string
 
+	// When Render() is being called as part of `abc upgrade`, the manifest of
+	// the template installation being upgraded. The files it lists aren't
+	// treated as owned by another template installation. Optional.
+	OwnManifestPath string
+
+	// The values of --max-output-files, --max-output-bytes, and
+	// --max-file-bytes. The render fails as soon as the template's output
+	// exceeds any of these. Zero means no limit.
+	MaxOutputFiles int
+	MaxOutputBytes int64
+	MaxFileBytes   int64
+
+	// The value of --policy-file. The rendered output is checked against the
+	// rules in these policy files before it's committed.
+	PolicyFiles []string
+
+	// If non-nil, a record of the render is written to this sink when Render()
+	// finishes, whether or not it succeeded. RenderAlreadyDownloaded() doesn't
+	// write one.
+	AuditLog auditlog.Sink
+
 	// Whether to prompt the user for inputs on stdin in the case where they're
 	// not all provided in Inputs or InputFiles.
 	Prompt bool
@@ -151,6 +266,13 @@ type Params struct {
 	// any missing inputs. If Prompt is false, this is ignored.
 	Prompter input.Prompter
 
+	// SecretResolvers look up input values that are secret references like
+	// "secret://gcp-sm/projects/p/secrets/api-key", by provider name. The
+	// manifest, the resume journal, and the report record the references
+	// rather than the secret values. If nil, secrets.DefaultResolvers() is
+	// used.
+	SecretResolvers map[string]secrets.SecretResolver
+
 	// The value of --skip-input-validation.
 	SkipInputValidation bool
 
@@ -167,6 +289,50 @@ type Params struct {
 	// The output stream used by "print" actions.
 	Stdout io.Writer
 
+	// The value of --reproducible. Makes the output identical for identical
+	// inputs, no matter when or where the render happens, by zeroing the
+	// values that would otherwise differ: the clock is frozen at the Unix
+	// epoch (so the manifest's timestamps and the _now_ms variable are zero),
+	// and the manifest doesn't record the backup directory or the render
+	// environment.
+	Reproducible bool
+
+	// The value of --quiet. If true, "print" actions don't print anything.
+	SuppressPrint bool
+
+	// StepObserver, if set, is called each time a step is reached, including
+	// steps nested inside a for_each. executed is false if the step was skipped
+	// because its "if" expression evaluated to false. This is used to measure
+	// golden test coverage.
+	StepObserver func(step *spec.Step, executed bool)
+
+	// Timings, if set, collects how long the download, each step, and the
+	// commit took, for --profile.
+	Timings *Timings
+
+	// Resumable makes the render keep a journal of its progress in the temp
+	// directory, so that it can be picked up later with Resume if it's
+	// interrupted. This costs a copy of the scratch directory after each step.
+	Resumable bool
+
+	// The value of --resume. Instead of downloading the template and running
+	// every step, pick up an interrupted render into OutDir after its last
+	// completed step. Implies Resumable.
+	Resume bool
+
+	// The value of --start-from-step, for debugging a template. If nonzero,
+	// the steps before this index (counting from 0) aren't run. Instead, the
+	// scratch directory and inputs are restored from the checkpoint kept by an
+	// earlier render into OutDir with StopAfterStep or StartFromStep. The
+	// template is downloaded again, so edits to it take effect.
+	StartFromStep int
+
+	// The value of --stop-after-step, for debugging a template. If non-nil,
+	// the render stops after the step with this index (counting from 0),
+	// without writing anything to the destination. The checkpoint after each
+	// step is kept for a later render with StartFromStep.
+	StopAfterStep *int
+
 	// The directory under which to create temp directories. Normally empty,
 	// except in testing.
 	TempDirBase string
@@ -174,6 +340,11 @@ type Params struct {
 	// The value of the --upgrade-channel flag. Leave blank to use the
 	// autodetected upgrade channel (most common).
 	UpgradeChannel string
+
+	// UpgradeChannelPolicy, if non-nil, restricts the upgrade channel that
+	// may be saved in the manifest. It comes from the config files, and is nil
+	// if --ignore-upgrade-channel-policy was given.
+	UpgradeChannelPolicy *config.UpgradeChannelPolicy
 }
 
 // Result gives some metadata about the outcome of the render operation.
@@ -190,9 +361,39 @@ type Result struct {
 	// will be empty.
 	ManifestPath string
 
+	// DownloadMetadata describes the template that was rendered, like its
+	// canonical location and version.
+	DownloadMetadata *templatesource.DownloadMetadata
+
+	// Outputs are the values of the outputs declared by the template's spec,
+	// keyed by output name.
+	Outputs map[string]string
+
+	// CopyStats describes the copy of the rendered files into the destination
+	// directory.
+	CopyStats *common.CopyStats
+
+	// Resources describes how many files and bytes the render wrote, and how
+	// much disk space its temp dirs and backups used.
+	Resources *ResourceSummary
+
 	// This is set to true when the render operation was aborted because the
 	// template inputs matched [Params.NoopIfInputsMatch].
 	NoopInputsMatched bool
+
+	// AlsoRendered is the result of the second render into
+	// [Params.AlsoRenderTo], if there was one.
+	AlsoRendered *Result
+
+	// StoppedAfterStep is true when the render stopped early because of
+	// [Params.StopAfterStep]. Nothing was written to the destination, and
+	// ScratchDir has the scratch directory as of the last step that ran.
+	StoppedAfterStep bool
+	ScratchDir       string
+
+	// The inputs that the template was rendered with, so a second render can
+	// reuse them without prompting again.
+	inputs map[string]string
 }
 
 // Render does the full sequence of steps involved in rendering a template. It
@@ -203,28 +404,132 @@ type Result struct {
 // This is a library function because template rendering is a reusable operation
 // that is called as a subroutine by "golden-test" and "upgrade" commands.
 func Render(ctx context.Context, p *Params) (_ *Result, rErr error) {
+	// Only the directory that's written is locked. DestDir is only read when
+	// it's different, like for --show-diff, and mustn't be written to.
+	lock, err := destlock.Acquire(ctx, &destlock.Params{
+		FS:        p.FS,
+		Dir:       p.OutDir,
+		Operation: "render",
+		Wait:      p.LockWait,
+	})
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	defer func() { rErr = errors.Join(rErr, lock.Release(rErr == nil)) }()
+
+	// This must happen before any step runs, since steps like "include" with
+	// "from: destination" read the destination.
+	if err := FinishInterruptedCommits(ctx, p.FS, p.OutDir); err != nil {
+		return nil, err
+	}
+
+	return recorded(ctx, p, downloadAndRender)
+}
+
+// recorded calls render, then writes the report and audit record that p asks
+// for, if any.
+func recorded(ctx context.Context, p *Params, render func(context.Context, *Params) (*Result, error)) (out *Result, rErr error) {
+	if p.ReportPath != "" {
+		ctx, p = withReport(ctx, p)
+		defer func() { rErr = errors.Join(rErr, writeReport(p, out, rErr)) }()
+	}
+	if p.AuditLog != nil {
+		defer func() { rErr = errors.Join(rErr, writeAuditRecord(ctx, p, out, rErr)) }()
+	}
+	return render(ctx, p)
+}
+
+// downloadAndRender is Render without the report and audit record.
+func downloadAndRender(ctx context.Context, p *Params) (out *Result, rErr error) {
 	logger := logging.FromContext(ctx).With("logger", "Render")
 
-	tempTracker := tempdir.NewDirTracker(p.FS, p.KeepTempDirs)
-	defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
+	if p.Resume {
+		rs, err := loadResumeState(p)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { rErr = errors.Join(rErr, rs.finish(ctx, rErr)) }()
 
-	templateDir, err := tempTracker.MkdirTempTracked(p.TempDirBase, tempdir.TemplateDirNamePart)
-	if err != nil {
-		return nil, err //nolint:wrapcheck
+		logger.InfoContext(ctx, "resuming interrupted render, reusing the already-downloaded template",
+			"completed_steps", rs.journal.CompletedSteps)
+		return renderDownloaded(ctx, rs.journal.DownloadMetadata, rs.templateDir(), p, rs)
+	}
+
+	var rs *resumeState
+	var templateDir string
+	switch {
+	case p.StartFromStep > 0:
+		var err error
+		rs, err = loadStartFromStep(p)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { rErr = errors.Join(rErr, rs.finish(ctx, rErr)) }()
+		templateDir = rs.templateDir()
+		// The template is downloaded again rather than reused, because the
+		// point of starting from a step is usually to try an edit to it.
+		if err := p.FS.RemoveAll(templateDir); err != nil {
+			return nil, fmt.Errorf("failed removing old template directory: %w", err)
+		}
+		if err := p.FS.MkdirAll(templateDir, common.OwnerRWXPerms); err != nil {
+			return nil, fmt.Errorf("failed creating template directory: %w", err)
+		}
+	case p.Resumable || p.StopAfterStep != nil:
+		var err error
+		rs, err = newResumeState(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		rs.keepAll = p.StopAfterStep != nil
+		defer func() { rErr = errors.Join(rErr, rs.finish(ctx, rErr)) }()
+		templateDir = rs.templateDir()
+	default:
+		tempTracker := tempdir.NewDirTracker(p.FS, p.KeepTempDirs)
+		defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
+
+		var err error
+		templateDir, err = tempTracker.MkdirTempTracked(p.TempDirBase, tempdir.TemplateDirNamePart)
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+		logger.DebugContext(ctx, "created temporary template directory",
+			"path", templateDir)
 	}
-	logger.DebugContext(ctx, "created temporary template directory",
-		"path", templateDir)
 
 	logger.DebugContext(ctx, "downloading/copying template")
 
+	dlStart := time.Now()
+	stopTimer := p.Timings.start(PhaseDownload)
 	dlMeta, err := p.Downloader.Download(ctx, p.Cwd, templateDir, p.DestDir)
+	stopTimer()
+	if err != nil {
+		err = common.WithCategory(common.CategoryDownload,
+			fmt.Errorf("failed to download/copy template: %w", err))
+	}
+	telemetry.Measure(ctx, telemetry.Downloads, telemetry.DownloadDuration, dlStart, err)
 	if err != nil {
-		return nil, fmt.Errorf("failed to download/copy template: %w", err)
+		return nil, err
 	}
 	logger.DebugContext(ctx, "downloaded source template to temporary directory",
 		"destination", templateDir)
+	if p.StartFromStep > 0 {
+		rs.journal.DownloadMetadata = dlMeta
+	}
 
-	return RenderAlreadyDownloaded(ctx, dlMeta, templateDir, p)
+	return renderWithAlso(ctx, dlMeta, templateDir, p, rs)
+}
+
+// renderWithAlso is renderDownloaded followed by the second render into
+// p.AlsoRenderTo, if there is one.
+func renderWithAlso(ctx context.Context, dlMeta *templatesource.DownloadMetadata, templateDir string, p *Params, rs *resumeState) (*Result, error) {
+	out, err := renderDownloaded(ctx, dlMeta, templateDir, p, rs)
+	if err != nil || p.AlsoRenderTo == "" || out.NoopInputsMatched {
+		return out, err
+	}
+	if out.AlsoRendered, err = renderAlso(ctx, dlMeta, templateDir, p, out.inputs); err != nil {
+		return nil, err
+	}
+	return out, nil
 }
 
 // RenderAlreadyDownloaded is for the unusual case where the template has
@@ -232,39 +537,111 @@ func Render(ctx context.Context, p *Params) (_ *Result, rErr error) {
 // to call Render() instead.
 //
 // The Params.Downloader field is ignored by this function.
-func RenderAlreadyDownloaded(ctx context.Context, dlMeta *templatesource.DownloadMetadata, templateDir string, p *Params) (_ *Result, rErr error) {
-	logger := logging.FromContext(ctx).With("logger", "RenderAlreadyDownloaded")
+func RenderAlreadyDownloaded(ctx context.Context, dlMeta *templatesource.DownloadMetadata, templateDir string, p *Params) (*Result, error) {
+	return renderDownloaded(ctx, dlMeta, templateDir, p, nil)
+}
+
+// renderDownloaded is RenderAlreadyDownloaded with support for resumable
+// renders. If rs is nil, the render isn't resumable.
+func renderDownloaded(ctx context.Context, dlMeta *templatesource.DownloadMetadata, templateDir string, p *Params, rs *resumeState) (_ *Result, rErr error) {
+	logger := logging.FromContext(ctx).With("logger", "renderDownloaded")
+
+	defer func(start time.Time) {
+		telemetry.Measure(ctx, telemetry.Renders, telemetry.RenderDuration, start, rErr)
+	}(time.Now())
 
 	if err := validate(p); err != nil {
 		return nil, err
 	}
+	if !p.SkipManifest {
+		if err := p.UpgradeChannelPolicy.Check(dlMeta.UpgradeChannel); err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+	}
 	p = fillDefaults(p)
+	startTime := p.Clock.Now()
 
 	logger.DebugContext(ctx, "loading spec file")
 	spec, err := specutil.Load(ctx, p.FS, templateDir, p.SourceForMessages)
 	if err != nil {
 		return nil, err //nolint:wrapcheck
 	}
+	// Errors in the spec's CEL expressions and Go templates point at a line
+	// of spec.yaml; show it.
+	defer func() { rErr = specutil.WithExcerpt(p.FS, templateDir, rErr) }()
+	if d := spec.Deprecated; d != nil {
+		msg := "this template is deprecated"
+		if d.Message.Val != "" {
+			msg += ": " + d.Message.Val
+		}
+		if d.ReplacedBy.Val != "" {
+			msg += fmt.Sprintf(" (replaced by %s)", d.ReplacedBy.Val)
+		}
+		warnings.Add(ctx, &warnings.Warning{
+			Code:    warnings.CodeDeprecatedTemplate,
+			Source:  p.SourceForMessages,
+			Message: msg,
+		})
+	}
 
-	logger.DebugContext(ctx, "resolving inputs")
-	resolvedInputs, err := input.Resolve(ctx, &input.ResolveParams{
-		AcceptDefaults:      p.AcceptDefaults,
-		FS:                  p.FS,
-		IgnoreUnknownInputs: p.IgnoreUnknownInputs,
-		InputFiles:          p.InputFiles,
-		Inputs:              p.InputsFromFlags,
-		InputsFromManifest:  p.InputsFromManifest,
-		Prompt:              p.Prompt,
-		Prompter:            p.Prompter,
-		SkipInputValidation: p.SkipInputValidation,
-		SkipPromptTTYCheck:  p.SkipPromptTTYCheck,
-		Spec:                spec,
-	})
+	resuming := rs != nil && rs.resuming
+	if resuming && rs.journal.CompletedSteps > len(spec.Steps) {
+		return nil, fmt.Errorf("the resume journal says %d steps completed, but the template only has %d steps",
+			rs.journal.CompletedSteps, len(spec.Steps))
+	}
+	steps, err := stepRange(p, rs, spec.Steps)
 	if err != nil {
-		return nil, err //nolint:wrapcheck
+		return nil, err
 	}
 
-	if p.NoopIfInputsMatch != nil && maps.Equal(resolvedInputs, p.NoopIfInputsMatch) {
+	var resolvedInputs map[string]string
+	var inputSources map[string]*input.Source // nil when resuming, since the sources weren't journaled
+	var inputFiles []*manifest.InputFile
+
+	// The secret references that inputs were resolved from. Everywhere the
+	// inputs are saved or shown, the references stand in for the secrets.
+	var secretRefs map[string]string
+	if resuming {
+		if len(p.InputsFromFlags) > 0 || len(p.InputFiles) > 0 {
+			logger.WarnContext(ctx, "when resuming, the inputs of the interrupted render are used; --input and --input-file are ignored")
+		}
+		// The journal has the secret references, not the secrets, so they're
+		// looked up again.
+		resolvedInputs, secretRefs, err = secrets.ResolveRefs(ctx, p.SecretResolvers, rs.journal.Inputs)
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+		p.report.setInputs(rs.journal.Inputs, nil)
+	} else {
+		logger.DebugContext(ctx, "resolving inputs")
+		resolvedInputs, inputSources, err = input.ResolveWithSources(ctx, &input.ResolveParams{
+			AcceptDefaults:      p.AcceptDefaults,
+			FS:                  p.FS,
+			IgnoreUnknownInputs: p.IgnoreUnknownInputs,
+			InputFiles:          p.InputFiles,
+			Inputs:              p.InputsFromFlags,
+			InputsFromManifest:  p.InputsFromManifest,
+			Prompt:              p.Prompt,
+			Prompter:            p.Prompter,
+			SecretResolvers:     p.SecretResolvers,
+			SkipInputValidation: p.SkipInputValidation,
+			SkipPromptTTYCheck:  p.SkipPromptTTYCheck,
+			Spec:                spec,
+		})
+		if err != nil {
+			return nil, common.WithCategory(common.CategoryInputValidation, err)
+		}
+		secretRefs = secretRefsFromSources(inputSources)
+		p.report.setInputs(secrets.Redact(resolvedInputs, secretRefs), inputSources)
+		if inputFiles, err = inputFileRefs(p.FS, p.Cwd, p.DestDir, p.InputFiles); err != nil {
+			return nil, err
+		}
+	}
+
+	// The manifest inputs in NoopIfInputsMatch have secret references, not
+	// secrets.
+	savedInputs := secrets.Redact(resolvedInputs, secretRefs)
+	if p.NoopIfInputsMatch != nil && maps.Equal(savedInputs, p.NoopIfInputsMatch) {
 		return &Result{NoopInputsMatched: true}, nil
 	}
 
@@ -278,7 +655,7 @@ func RenderAlreadyDownloaded(ctx context.Context, dlMeta *templatesource.Downloa
 	logger.DebugContext(ctx, "created temporary scratch directory",
 		"path", scratchDir)
 
-	debugStepDiffsDir, err := initDebugStepDiffsDir(ctx, p, scratchDir)
+	diffs, err := initStepDiffs(ctx, p, scratchDir, p.DebugStepDiffs && gitInstalled())
 	if err != nil {
 		return nil, err
 	}
@@ -287,60 +664,217 @@ func RenderAlreadyDownloaded(ctx context.Context, dlMeta *templatesource.Downloa
 	if err != nil {
 		return nil, err
 	}
+	if resuming {
+		// Builtins like _now_ms must have the same values as they did in the
+		// interrupted render.
+		vars := maps.Clone(rs.journal.Vars)
+		for name := range secretRefs {
+			vars[name] = resolvedInputs[name]
+		}
+		scope = common.NewScope(vars, scope.GoTmplFuncs())
+	}
 
 	if err := rules.ValidateRules(ctx, scope, spec.Rules); err != nil {
-		return nil, err //nolint:wrapcheck
+		return nil, common.WithCategory(common.CategoryInputValidation, err)
+	}
+
+	firstStep := 0
+	includedFromDest := make(map[string]string)
+	movedFromDest := make(map[string]string)
+	var afterStep func(ctx context.Context, completedSteps int) error
+	if rs != nil {
+		if resuming {
+			if err := rs.restore(ctx, scratchDir); err != nil {
+				return nil, err
+			}
+			firstStep = rs.journal.CompletedSteps
+			maps.Copy(includedFromDest, rs.journal.IncludedFromDest)
+			maps.Copy(movedFromDest, rs.journal.MovedFromDest)
+		} else if err := rs.start(p, dlMeta, savedInputs, secrets.Redact(scope.AllVars(), secretRefs)); err != nil {
+			return nil, err
+		}
+		afterStep = func(ctx context.Context, completedSteps int) error {
+			return rs.checkpoint(ctx, scratchDir, completedSteps, includedFromDest, movedFromDest)
+		}
+	}
+
+	preserveMetadata, preserveXattrs, err := preserveFileMetadata(ctx, p, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	var remote *remoteIncludes
+	if specHasRemoteIncludes(spec.Steps) {
+		remoteDir, err := tempTracker.MkdirTempTracked(p.TempDirBase, tempdir.RemoteIncludeDirNamePart)
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+		remote = &remoteIncludes{baseDir: remoteDir}
+	}
+
+	var remoteDir string
+	if remote != nil {
+		remoteDir = remote.baseDir
+	}
+	jailed, err := jailedParams(p, append([]string{scratchDir, templateDir, remoteDir}, diffs.dirs()...)...)
+	if err != nil {
+		return nil, err
 	}
 
 	sp := &stepParams{
-		debugDiffsDir:    debugStepDiffsDir,
 		ignorePatterns:   spec.Ignore,
-		includedFromDest: make(map[string]string),
+		includedFromDest: includedFromDest,
+		movedFromDest:    movedFromDest,
 		extraPrintVars:   extraPrintVars,
 		features:         spec.Features,
-		rp:               p,
+		preserveMetadata: preserveMetadata,
+		preserveXattrs:   preserveXattrs,
+		remoteIncludes:   remote,
+		rp:               jailed,
+		stepDiffs:        diffs,
 		scope:            scope,
 		scratchDir:       scratchDir,
-		suppressPrint:    p.BackfillManifestOnly, // if --backfill-manifest-only was given, then the user doesn't want printed output.
+		suppressPrint:    p.BackfillManifestOnly || p.SuppressPrint, // if --backfill-manifest-only or --quiet was given, then the user doesn't want printed output.
 		templateDir:      templateDir,
+		templateEngine:   spec.TemplateEngine.Val,
 	}
 
 	logger.DebugContext(ctx, "executing template steps")
 
-	if err := executeSteps(ctx, spec.Steps, sp); err != nil {
+	err = executeStepsFrom(ctx, steps, firstStep, sp, afterStep)
+	if err := errors.Join(err, diffs.finish(ctx, p.FS, p.SourceForMessages)); err != nil {
+		return nil, err
+	}
+	if p.StopAfterStep != nil {
+		logger.InfoContext(ctx, "stopped early because of --stop-after-step, the destination is unchanged",
+			"last_step", *p.StopAfterStep)
+		return &Result{
+			DownloadMetadata: dlMeta,
+			StoppedAfterStep: true,
+			ScratchDir:       rs.checkpointDir(),
+		}, nil
+	}
+
+	outputs, err := evalOutputs(ctx, scope, spec.Outputs, secretRefs)
+	if err != nil {
+		return nil, err
+	}
+
+	// A backfilled manifest doesn't write any output, so there's nothing for
+	// the policies to object to.
+	if !p.BackfillManifestOnly {
+		if err := policyutil.Check(ctx, p.FS, p.PolicyFiles, scratchDir); err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+		if err := checkPortablePaths(ctx, p, scratchDir); err != nil {
+			return nil, err
+		}
+	}
+
+	resources := &ResourceSummary{}
+	if _, resources.TemplateDirBytes, err = dirUsage(p.FS, templateDir); err != nil {
+		return nil, err
+	}
+	if _, resources.ScratchDirBytes, err = dirUsage(p.FS, scratchDir); err != nil {
 		return nil, err
 	}
 
 	logger.DebugContext(ctx, "committing rendered output")
-	manifestRelPath, err := commitTentatively(ctx, p, &commitParams{
+	stopTimer := p.Timings.start(PhaseCommit)
+	cp := &commitParams{
 		dlMeta:           dlMeta,
+		ignore:           sp.ignorer(),
 		includedFromDest: sp.includedFromDest,
-		inputs:           resolvedInputs,
+		movedFromDest:    sp.movedFromDest,
+		inputs:           savedInputs,
+		inputFiles:       inputFiles,
+		inputSources:     inputSources,
+		deprecated:       spec.Deprecated,
+		outputs:          outputs,
+		preserveMetadata: preserveMetadata,
+		preserveXattrs:   preserveXattrs,
+		remoteIncludes:   remote.manifestEntries(),
+		resources:        resources,
 		scratchDir:       scratchDir,
+		startTime:        startTime,
 		templateDir:      templateDir,
-	})
+	}
+	manifestRelPath, err := commitTentatively(ctx, p, cp)
+	stopTimer()
 	if err != nil {
 		return nil, err
 	}
 
-	if p.DebugStepDiffs {
-		// Use default log level.
-		logger.WarnContext(
-			ctx,
-			fmt.Sprintf(
-				"Please navigate to '%s' or use 'git --git-dir=%s log' to see commits/diffs for each step",
-				debugStepDiffsDir, debugStepDiffsDir),
-		)
+	if manifestRelPath != "" {
+		recordInIndex(ctx, p, dlMeta, manifestRelPath)
 	}
 
 	logger.DebugContext(ctx, "render operation complete", "source", p.SourceForMessages)
+	logger.InfoContext(ctx, "render resource usage", resources.logAttrs()...)
+
+	includedFromDestination := maps.Keys(sp.includedFromDest)
+	sort.Strings(includedFromDestination)
 
 	return &Result{
-		IncludedFromDestination: maps.Keys(sp.includedFromDest),
+		CopyStats:               cp.copyStats,
+		DownloadMetadata:        dlMeta,
+		IncludedFromDestination: includedFromDestination,
 		ManifestPath:            manifestRelPath,
+		Outputs:                 outputs,
+		Resources:               resources,
+		inputs:                  savedInputs,
 	}, nil
 }
 
+// jailedParams returns a copy of p whose FS refuses to touch anything outside
+// of the directories that the spec's steps are allowed to use. This is the
+// central defense against templates that try to escape using "..", absolute
+// paths, or symlinks.
+func jailedParams(p *Params, dirs ...string) (*Params, error) {
+	roots := []string{p.DestDir}
+	if p.IncludeFromDestExtraDir != "" {
+		roots = append(roots, p.IncludeFromDestExtraDir)
+	}
+	for _, d := range dirs {
+		if d != "" {
+			roots = append(roots, d)
+		}
+	}
+	jfs, err := common.NewJailFS(p.FS, roots...)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	out := *p
+	out.FS = jfs
+	return &out, nil
+}
+
+// preserveFileMetadata returns whether output files should get the full mode
+// bits and modification times of the template files they came from, and
+// whether they should also get their extended attributes. The
+// --file-metadata flag takes precedence over the spec's file_metadata field.
+func preserveFileMetadata(ctx context.Context, p *Params, spec *spec.Spec) (preserve, xattrs bool, _ error) {
+	policy := p.FileMetadata
+	if policy == "" && !spec.Features.SkipFileMetadata {
+		policy = spec.FileMetadata.Val
+	}
+	switch policy {
+	case "", FileMetadataPermissions:
+		return false, false, nil
+	case FileMetadataPreserve:
+		return true, false, nil
+	case FileMetadataXattrs:
+		if !common.XattrsSupported {
+			logger := logging.FromContext(ctx).With("logger", "preserveFileMetadata")
+			logger.WarnContext(ctx, "extended attributes aren't supported on this platform, so they won't be preserved",
+				"file_metadata", policy)
+		}
+		return true, common.XattrsSupported, nil
+	default:
+		return false, false, fmt.Errorf("invalid file metadata policy %q, must be one of %v", policy, FileMetadataPolicies)
+	}
+}
+
 // scopes returns two things:
 //
 //   - a Scope object that has all variable bindings that are in scope for the
@@ -360,6 +894,36 @@ func scopes(resolvedInputs map[string]string, rp *Params, f features.Features, d
 	return common.NewScope(vars, goTmplFuncs), extraPrintVars, nil
 }
 
+// ScopeParams are the parameters to NewScope.
+type ScopeParams struct {
+	// The template spec, whose api_version decides which builtins and
+	// functions are in scope.
+	Spec *spec.Spec
+
+	// The fully resolved template inputs, as returned by input.Resolve.
+	Inputs map[string]string
+
+	// The builtin _git_* variables of the downloaded template.
+	DownloaderVars templatesource.DownloaderVars
+
+	// Used for the _now_ms builtin variable. Optional, defaults to the real
+	// clock.
+	Clock clock.Clock
+}
+
+// NewScope returns the scope that a template's expressions are evaluated in
+// during a render: its inputs, the builtin variables, and the Go template
+// functions. It's for tools like "abc templates console" that evaluate
+// expressions outside of a render.
+func NewScope(sp *ScopeParams) (*common.Scope, error) {
+	clk := sp.Clock
+	if clk == nil {
+		clk = clock.New()
+	}
+	scope, _, err := scopes(sp.Inputs, &Params{Clock: clk}, sp.Spec.Features, sp.DownloaderVars)
+	return scope, err
+}
+
 func scopeVars(resolvedInputs map[string]string, rp *Params, f features.Features, dlVars templatesource.DownloaderVars) (_, extraPrintVars map[string]string, _ error) {
 	out := maps.Clone(resolvedInputs)
 
@@ -416,35 +980,6 @@ func scopeVars(resolvedInputs map[string]string, rp *Params, f features.Features
 	return out, extraPrintVars, nil
 }
 
-// Configure the git directory that will contain a commit per step for debugging
-// purposes. If --debug-step-diffs is false, this is a noop.
-func initDebugStepDiffsDir(ctx context.Context, p *Params, scratchDir string) (string, error) {
-	if !p.DebugStepDiffs {
-		return "", nil // This particular debugging feature isn't enabled
-	}
-
-	out, err := p.FS.MkdirTemp(p.TempDirBase, tempdir.DebugStepDiffsDirNamePart)
-	if err != nil {
-		return "", fmt.Errorf("failed to create temp directory for debug directory: %w", err)
-	}
-
-	cmds := [][]string{
-		// Make debug dir a git repository with a detached work tree in scratch
-		// dir, meaning it will track the file changes in scratch dir without
-		// affecting the scratch dir.
-		{"git", "--git-dir", out, "--work-tree", scratchDir, "init"},
-
-		// Set git user name and email, required for ubuntu.
-		{"git", "--git-dir", out, "config", "user.name", "abc CLI"},
-		{"git", "--git-dir", out, "config", "user.email", "abc@abcxyz.com"},
-	}
-
-	if _, _, err := run.Many(ctx, cmds...); err != nil {
-		return "", fmt.Errorf("failed initializing git repo for --debug-step-diffs: %w", err)
-	}
-	return out, nil
-}
-
 // stepParams contains all the values provided to the action* functions that
 // are needed to do their job.
 type stepParams struct {
@@ -454,7 +989,7 @@ type stepParams struct {
 	features features.Features
 
 	// Files and directories included in spec that match ignorePatterns will be
-	// ignored while being copied to destination directory.
+	// ignored while being copied to destination directory. See ignorer().
 	ignorePatterns []model.String
 
 	// includedFromDest tracks files (no directories) that were copied from the
@@ -470,6 +1005,13 @@ type stepParams struct {
 	// that already exist in the destination.
 	includedFromDest map[string]string
 
+	// movedFromDest is the subset of includedFromDest that was included from
+	// the destination under a different name, using "as". The map keys are
+	// the location of the file in the scratch directory, and the map values
+	// are the location of the file it came from, relative to its directory in
+	// includedFromDest.
+	movedFromDest map[string]string
+
 	// scope contains all variable names that are in scope. This includes
 	// user-provided scope, as well as any programmatically created variables
 	// like for_each keys.
@@ -478,11 +1020,56 @@ type stepParams struct {
 	// If true, print actions will not actually print anything.
 	suppressPrint bool
 
+	// The spec's template_engine, used by go_template actions that don't set
+	// their own.
+	templateEngine string
+
+	// Whether included files get the full mode bits and modification times of
+	// the template files. See FileMetadataPreserve.
+	preserveMetadata bool
+
+	// Whether included files also get the extended attributes of the template
+	// files. See FileMetadataXattrs.
+	preserveXattrs bool
+
+	// Downloads the sources of includes with "from: remote". Nil if the spec
+	// has no such includes.
+	remoteIncludes *remoteIncludes
+
 	extraPrintVars map[string]string
 
-	debugDiffsDir string
-	scratchDir    string
-	templateDir   string
+	// stepDiffs records the diffs made by each step. It's nil unless
+	// --debug-step-diffs or --debug-report was given.
+	stepDiffs *stepDiffs
+
+	scratchDir  string
+	templateDir string
+
+	// streamThresholdBytes overrides defaultStreamThreshold when positive. It
+	// only exists so that tests can exercise streaming with small files.
+	streamThresholdBytes int64
+
+	// retryBaseDelay overrides defaultRetryBaseDelay when positive. It only
+	// exists so that tests of step retries don't have to wait.
+	retryBaseDelay time.Duration
+
+	// bufCommand overrides the buf executable run by the buf_generate action
+	// when non-empty. It only exists so that tests can use a fake buf.
+	bufCommand string
+}
+
+// defaultRetryBaseDelay is how long to wait before the first retry of a step.
+// Each later retry waits twice as long as the one before.
+const defaultRetryBaseDelay = time.Second
+
+// retryDelay returns how long to wait before retrying a step that has failed
+// attempt+1 times.
+func (s *stepParams) retryDelay(attempt int) time.Duration {
+	base := defaultRetryBaseDelay
+	if s.retryBaseDelay > 0 {
+		base = s.retryBaseDelay
+	}
+	return base << min(attempt, 6)
 }
 
 // WithScope returns a copy of this stepParams with a new inner variable scope
@@ -496,26 +1083,38 @@ func (s *stepParams) WithScope(vars map[string]string) *stepParams {
 // executeSteps is the heart of template rendering. It executes each action in
 // the spec sequentially.
 func executeSteps(ctx context.Context, steps []*spec.Step, sp *stepParams) error {
+	return executeStepsFrom(ctx, steps, 0, sp, nil)
+}
+
+// executeStepsFrom is like executeSteps, but skips the steps before firstStep,
+// which were already done by an interrupted render that's being resumed. If
+// afterStep is non-nil, it's called after each step with the number of steps
+// that have completed so far.
+func executeStepsFrom(ctx context.Context, steps []*spec.Step, firstStep int, sp *stepParams, afterStep func(ctx context.Context, completedSteps int) error) error {
 	logger := logging.FromContext(ctx).With("logger", "executeSteps")
 
-	for i, step := range steps {
+	for i := firstStep; i < len(steps); i++ {
+		step := steps[i]
+		// Stop between steps if the user hit Ctrl-C. A resumable render picks
+		// up from here.
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("render canceled before step index %d: %w", i, err)
+		}
+
 		logger.DebugContext(ctx, "Starting step %d action %s",
 			"step", i,
 			"action", step.Action.Val)
 		if err := executeOneStep(ctx, i, step, sp); err != nil {
 			return err
 		}
+		// Nested steps, like those in a for_each, are checked too, so a
+		// runaway loop is stopped early.
+		if err := checkOutputLimits(sp); err != nil {
+			return fmt.Errorf("after step index %d action %q: %w", i, step.Action.Val, err)
+		}
 
-		if sp.debugDiffsDir != "" {
-			// Commit the diffs after each step.
-			m := fmt.Sprintf("action %s at line %d", step.Action.Val, step.Pos.Line)
-			cmds := [][]string{
-				{"git", "--git-dir", sp.debugDiffsDir, "add", "-A"},
-				{"git", "--git-dir", sp.debugDiffsDir, "commit", "-a", "-m", m, "--allow-empty", "--no-gpg-sign"},
-			}
-			if _, _, err := run.Many(ctx, cmds...); err != nil {
-				return fmt.Errorf("failed committing to git for --debug-step-diffs: %w", err)
-			}
+		if err := sp.stepDiffs.record(ctx, step); err != nil {
+			return err
 		}
 
 		logger.DebugContext(ctx, "completed template action", "action", step.Action.Val)
@@ -526,6 +1125,12 @@ func executeSteps(ctx context.Context, steps []*spec.Step, sp *stepParams) error
 			}
 			logger.WarnContext(ctx, contents)
 		}
+
+		if afterStep != nil {
+			if err := afterStep(ctx, i+1); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
@@ -545,6 +1150,9 @@ func executeOneStep(ctx context.Context, stepIdx int, step *spec.Step, sp *stepP
 				"step_index_from_zero", stepIdx,
 				"action", step.Action.Val,
 				"cel_expr", step.If.Val)
+			if sp.rp.StepObserver != nil {
+				sp.rp.StepObserver(step, false)
+			}
 			return nil
 		}
 		logger.DebugContext(ctx, `proceeding to execute step because "if" expression evaluated to true`,
@@ -553,15 +1161,96 @@ func executeOneStep(ctx context.Context, stepIdx int, step *spec.Step, sp *stepP
 			"cel_expr", step.If.Val)
 	}
 
+	if sp.rp.StepObserver != nil {
+		sp.rp.StepObserver(step, true)
+	}
+	defer sp.rp.Timings.startStep(PhaseStep, step)()
+
+	return runWithRetries(ctx, stepIdx, step, sp, func(ctx context.Context) error {
+		return executeAction(ctx, step, sp)
+	})
+}
+
+// runWithRetries calls the given function, which runs the step's action,
+// applying the step's timeout and retries.
+func runWithRetries(ctx context.Context, stepIdx int, step *spec.Step, sp *stepParams, action func(context.Context) error) error {
+	logger := logging.FromContext(ctx).With("logger", "runWithRetries")
+
+	var timeout time.Duration
+	if step.Timeout.Val != "" {
+		var err error
+		if timeout, err = time.ParseDuration(step.Timeout.Val); err != nil {
+			return step.Timeout.Pos.Errorf("invalid timeout: %w", err)
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := runWithTimeout(ctx, step, timeout, action)
+		if err == nil || attempt >= step.Retries.Val || !isRetryable(ctx, err) {
+			return err
+		}
+		delay := sp.retryDelay(attempt)
+		logger.WarnContext(ctx, "step failed with a transient error, retrying",
+			"step_index_from_zero", stepIdx,
+			"action", step.Action.Val,
+			"attempt", attempt+1,
+			"retries", step.Retries.Val,
+			"delay", delay.String(),
+			"error", err.Error())
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("render canceled while waiting to retry step index %d: %w", stepIdx, errors.Join(ctx.Err(), err))
+		case <-time.After(delay):
+		}
+	}
+}
+
+// runWithTimeout runs the step's action once. If timeout is positive, the
+// action is canceled if it runs longer than that.
+func runWithTimeout(ctx context.Context, step *spec.Step, timeout time.Duration, action func(context.Context) error) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	err := action(ctx)
+	if err != nil && timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return step.Pos.Errorf("action %q timed out after %s: %w", step.Action.Val, timeout, err)
+	}
+	return err
+}
+
+// isRetryable returns whether a step that failed with the given error may be
+// tried again. Only transient failures, like downloads, are retried; most
+// errors, like a bad template, would just happen again. Nothing is retried
+// after the user hits Ctrl-C.
+func isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	return common.ErrorCategoryOf(err) == common.CategoryDownload
+}
+
+// executeAction dispatches to the function for the step's action type.
+func executeAction(ctx context.Context, step *spec.Step, sp *stepParams) error {
 	switch {
 	case step.Append != nil:
 		return actionAppend(ctx, step.Append, sp)
+	case step.BufGenerate != nil:
+		return actionBufGenerate(ctx, step.BufGenerate, sp)
 	case step.ForEach != nil:
 		return actionForEach(ctx, step.ForEach, sp)
+	case step.GoModEdit != nil:
+		return actionGoModEdit(ctx, step.GoModEdit, sp)
 	case step.GoTemplate != nil:
 		return actionGoTemplate(ctx, step.GoTemplate, sp)
+	case step.HCLModify != nil:
+		return actionHCLModify(ctx, step.HCLModify, sp)
 	case step.Include != nil:
 		return actionInclude(ctx, step.Include, sp)
+	case step.LicenseHeader != nil:
+		return actionLicenseHeader(ctx, step.LicenseHeader, sp)
 	case step.Print != nil:
 		return actionPrint(ctx, step.Print, sp)
 	case step.RegexNameLookup != nil:
@@ -570,8 +1259,10 @@ func executeOneStep(ctx context.Context, stepIdx int, step *spec.Step, sp *stepP
 		return actionRegexReplace(ctx, step.RegexReplace, sp)
 	case step.StringReplace != nil:
 		return actionStringReplace(ctx, step.StringReplace, sp)
+	case step.Wasm != nil:
+		return actionWasm(ctx, step.Wasm, sp)
 	default:
-		return fmt.Errorf("internal error: unknown step action type %q", step.Action.Val)
+		return common.InternalErrorf("unknown step action type %q", step.Action.Val)
 	}
 }
 
@@ -581,7 +1272,7 @@ func scratchContents(_ context.Context, stepIdx int, step *spec.Step, sp *stepPa
 	sb := &strings.Builder{}
 	fmt.Fprintf(sb, "Scratch dir contents after step %d (starting from 0), which is action type %q, defined at spec file line %d:\n",
 		stepIdx, step.Action.Val, step.Action.Pos.Line)
-	err := filepath.WalkDir(sp.scratchDir, func(path string, d fs.DirEntry, err error) error {
+	err := fs.WalkDir(sp.rp.FS, sp.scratchDir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err // some filesystem error happened
 		}
@@ -610,45 +1301,221 @@ type commitParams struct {
 	dlMeta           *templatesource.DownloadMetadata
 	scratchDir       string
 	templateDir      string
+	ignore           *ignorer
 	includedFromDest map[string]string
+	movedFromDest    map[string]string
+	deprecated       *spec.Deprecated
+	outputs          map[string]string
 	inputs           map[string]string
+	inputFiles       []*manifest.InputFile
+	inputSources     map[string]*input.Source
+	preserveMetadata bool
+	preserveXattrs   bool
+	remoteIncludes   []*manifest.RemoteInclude
+	startTime        time.Time
+
+	// The other template installations in the destination directory, by the
+	// files they own. Loaded by commitTentatively.
+	owners map[string]*fileOwner
+
+	// Stats for copying the rendered output into the staging directory. Set
+	// by commitTentatively.
+	copyStats *common.CopyStats
+
+	// resources has the sizes of the temp dirs on the way in, and
+	// commitTentatively fills in the rest.
+	resources *ResourceSummary
 }
 
 // commitTentatively writes the contents of the scratch directory to the output
 // directory. We first do a dry-run to check that the copy is likely to succeed,
-// so we don't leave a half-done mess in the user's dest directory.
-func commitTentatively(ctx context.Context, p *Params, cp *commitParams) (manifestPath string, _ error) {
+// so we don't leave a half-done mess in the user's dest directory. Then the
+// output is staged and moved into place atomically; see stage.go.
+func commitTentatively(ctx context.Context, p *Params, cp *commitParams) (manifestPath string, rErr error) {
 	includeFromDestPatches, err := ifdPatches(ctx, p, cp)
 	if err != nil {
 		return "", err
 	}
 
-	for _, dryRun := range []bool{true, false} {
-		outputHashes, err := commit(ctx, dryRun, p, cp.scratchDir, cp.includedFromDest)
-		if err != nil {
+	if cp.owners, err = loadFileOwners(ctx, p); err != nil {
+		return "", err
+	}
+
+	wmp := &writeManifestParams{
+		clock:                  p.Clock,
+		cwd:                    p.Cwd,
+		dlMeta:                 cp.dlMeta,
+		destDir:                p.OutDir,
+		dryRun:                 true,
+		fs:                     p.FS,
+		includeFromDestPatches: includeFromDestPatches,
+		movedFromDest:          cp.movedFromDest,
+		deprecated:             cp.deprecated,
+		outputs:                cp.outputs,
+		inputs:                 cp.inputs,
+		inputFiles:             cp.inputFiles,
+		inputSources:           cp.inputSources,
+		remoteIncludes:         cp.remoteIncludes,
+		reproducible:           p.Reproducible,
+		signer:                 p.ManifestSigner,
+		startTime:              cp.startTime,
+		templateDir:            cp.templateDir,
+		upgradeChannelFromFlag: p.UpgradeChannel != "",
+		conflictFileNames:      common.FirstNonZero(p.ConflictFileNames, manifest.ConflictFileNamesKeepExtension),
+	}
+
+	if _, _, err := commit(ctx, true, p, cp, ""); err != nil {
+		return "", err
+	}
+	if !p.SkipManifest {
+		if _, err := writeManifest(wmp); err != nil {
 			return "", err
 		}
+	}
+	if !p.BackfillManifestOnly {
+		warnIfLowDiskSpace(ctx, common.JoinIfRelative(p.Cwd, p.OutDir), cp.resources.ScratchDirBytes)
+	}
+
+	stage, err := newStaging(p.FS, p.OutDir)
+	if err != nil {
+		return "", err
+	}
+	journaled := false
+	defer func() {
+		// Until the journal is written, nothing in the destination has
+		// changed, so it's safe to throw away the staged files.
+		if !journaled {
+			rErr = errors.Join(rErr, stage.remove())
+		}
+	}()
 
-		if !p.SkipManifest {
-			if manifestPath, err = writeManifest(&writeManifestParams{
-				clock:                  p.Clock,
-				cwd:                    p.Cwd,
-				dlMeta:                 cp.dlMeta,
-				destDir:                p.OutDir,
-				dryRun:                 dryRun,
-				fs:                     p.FS,
-				includeFromDestPatches: includeFromDestPatches,
-				inputs:                 cp.inputs,
-				outputHashes:           outputHashes,
-				templateDir:            cp.templateDir,
-			}); err != nil {
-				return "", err
+	outputHashes, copyStats, err := commit(ctx, false, p, cp, stage.filesDir())
+	if err != nil {
+		return "", err
+	}
+	// Backups come before the manifest so that the manifest can say where they
+	// are. The backup directory's name is random, so a reproducible manifest
+	// leaves it out.
+	if p.Backups {
+		backupDir, err := backUpOverwritten(ctx, stage, backupDirMaker(ctx, p))
+		if err != nil {
+			return "", err
+		}
+		if cp.resources.BackupFiles, cp.resources.BackupBytes, err = dirUsage(p.FS, backupDir); err != nil {
+			return "", err
+		}
+		if backupDir != "" && !p.Reproducible {
+			// The manifest is usually committed, so it doesn't record a path
+			// that's only meaningful on this machine.
+			rel, err := filepath.Rel(filepath.Dir(p.BackupDir), backupDir)
+			if err != nil {
+				return "", fmt.Errorf("filepath.Rel(%s,%s): %w", filepath.Dir(p.BackupDir), backupDir, err)
 			}
+			wmp.backupDir = filepath.ToSlash(rel)
+		}
+	}
+	if !p.SkipManifest {
+		wmp.destDir = stage.filesDir()
+		wmp.dryRun = false
+		wmp.outputHashes = outputHashes
+		if manifestPath, err = writeManifest(wmp); err != nil {
+			return "", err
 		}
 	}
+
+	if err := stage.writeJournal(); err != nil {
+		return "", err
+	}
+	journaled = true
+
+	if err := stage.apply(ctx); err != nil {
+		return "", fmt.Errorf("failed moving rendered files into %q; the next render into that directory will finish the job: %w", p.OutDir, err)
+	}
+	if !p.BackfillManifestOnly {
+		if err := p.report.setFiles(p.FS, p.OutDir, outputHashes); err != nil {
+			return "", err
+		}
+	}
+	cp.copyStats = copyStats
+	if copyStats != nil {
+		cp.resources.FilesWritten = copyStats.Files
+		cp.resources.BytesWritten = copyStats.Bytes
+	}
+	logger := logging.FromContext(ctx).With("logger", "commitTentatively")
+	logger.InfoContext(ctx, "template render succeeded")
 	return manifestPath, nil
 }
 
+// recordInIndex adds a newly written manifest to the installation index of the
+// git repo that it's in, if any. The render is already done by this point, so
+// failing to update the index is only a warning.
+func recordInIndex(ctx context.Context, p *Params, dlMeta *templatesource.DownloadMetadata, manifestRelPath string) {
+	logger := logging.FromContext(ctx).With("logger", "recordInIndex")
+
+	manifestPath := filepath.Join(p.OutDir, manifestRelPath)
+	if !filepath.IsAbs(manifestPath) {
+		manifestPath = filepath.Join(p.Cwd, manifestPath)
+	}
+	if err := indexutil.Record(ctx, p.FS, &indexutil.Entry{
+		ManifestPath:     manifestPath,
+		TemplateLocation: dlMeta.CanonicalSource,
+		TemplateVersion:  dlMeta.Version,
+		ModificationTime: p.Clock.Now().UTC(),
+	}); err != nil {
+		logger.WarnContext(ctx, "failed updating the installation index; use --ignore-index if upgrades can't find this installation",
+			"error", err)
+	}
+}
+
+// writeAuditRecord writes a record of a finished render to p.AuditLog. Unlike
+// the installation index, the audit log exists for compliance, so failing to
+// write it is an error.
+func writeAuditRecord(ctx context.Context, p *Params, result *Result, renderErr error) error {
+	now := time.Now()
+	if p.Clock != nil {
+		now = p.Clock.Now()
+	}
+	dest := p.DestDir
+	if dest == "" {
+		dest = p.OutDir
+	}
+
+	r := auditlog.NewRecord(auditlog.OperationRender, now)
+	r.Source = p.SourceForMessages
+	r.Dest = common.JoinIfRelative(p.Cwd, dest)
+	r.Result = auditlog.ResultSuccess
+	if result != nil && result.DownloadMetadata != nil {
+		r.CanonicalSource = result.DownloadMetadata.CanonicalSource
+		r.Version = result.DownloadMetadata.Version
+	}
+	r.SetErr(renderErr)
+
+	if err := p.AuditLog.Write(ctx, r); err != nil {
+		return fmt.Errorf("failed writing audit record: %w", err)
+	}
+	return nil
+}
+
+// backupDirMaker returns a function that creates the backup directory the
+// first time it's called, and returns the same directory on later calls.
+func backupDirMaker(ctx context.Context, p *Params) func(common.FS) (string, error) {
+	logger := logging.FromContext(ctx).With("logger", "backupDirMaker")
+
+	var backupDir string
+	return func(rfs common.FS) (string, error) {
+		if backupDir != "" {
+			return backupDir, nil
+		}
+		if err := rfs.MkdirAll(p.BackupDir, common.OwnerRWXPerms); err != nil {
+			return "", err //nolint:wrapcheck // err already contains path, and it will be wrapped later
+		}
+		var err error
+		backupDir, err = rfs.MkdirTemp(p.BackupDir, "")
+		logger.DebugContext(ctx, "created backup directory", "path", backupDir)
+		return backupDir, err //nolint:wrapcheck // err already contains path, and it will be wrapped later
+	}
+}
+
 func ifdPatches(ctx context.Context, p *Params, cp *commitParams) (map[string]string, error) {
 	if p.BackfillManifestOnly {
 		if len(cp.includedFromDest) == 0 || p.ContinueWithoutPatches {
@@ -658,31 +1525,7 @@ func ifdPatches(ctx context.Context, p *Params, cp *commitParams) (map[string]st
 		sortedFiles := maps.Keys(cp.includedFromDest)
 		sort.Strings(sortedFiles)
 
-		return nil, fmt.Errorf(`
-We're running in --backfill-manifest-only mode with a template that modifies
-files in place (using the "from: destination" feature in spec.yaml). Normally,
-the manifest is supposed to store a patch for each file modified in place that
-will undo the modification. This is used later during the template upgrade
-process. We can't generate a complete manifest retrospectively for this template
-installation because generating a patch would require the former contents of the
-file(s) (before they were modified in place), but we the old version of the file
-isn't available anymore. You have
-two options:
-
- - Re-run this command with "--continue-without-patches" to proceed anyway,
-   creating a manifest that might cause problems. This means that when you run
-   "abc upgrade" on this manifest in the future, there may be some spurious
-   edits that will require manual correction. For example, there may be duplicate
-   edits in the given file(s). If you don't care about upgrading this template
-   installation later, or if you're confident in handling the merge conflict
-   later, then this is a good option.
-
- - Revert the commit that rendered this template in the past. Re-render it using
-   "abc render" (which now defaults to '--skip-manifest=false') to generate a
-   fully correct manifest.
-
-The files in question that are modified in place are: %s`,
-			sortedFiles)
+		return nil, errors.New(messages.Get(ctx, messages.BackfillNeedsPatches, struct{ Files []string }{sortedFiles}))
 	}
 
 	// Design decision: it's OK to hold these patches in memory. It's unlikely
@@ -695,6 +1538,9 @@ The files in question that are modified in place are: %s`,
 	// upgrade operation.
 	for relPath, fromDir := range cp.includedFromDest {
 		destPath := filepath.Join(fromDir, relPath)
+		if movedFrom, ok := cp.movedFromDest[relPath]; ok {
+			destPath = filepath.Join(fromDir, movedFrom)
+		}
 		srcPath := filepath.Join(cp.scratchDir, relPath)
 		diff, err := run.RunDiff(ctx, false, srcPath, cp.scratchDir, destPath, fromDir)
 		if err != nil {
@@ -709,39 +1555,59 @@ The files in question that are modified in place are: %s`,
 	return out, nil
 }
 
-// commit copies the contents of scratchDir to rp.Dest. If dryRun==true, then
-// files are read but nothing is written to the destination. includedFromDest is
-// a set of files that were the subject of an "include" action that set "from:
+// commit copies the contents of scratchDir to stagingDir, from where it will
+// later be moved into p.OutDir. If dryRun==true, then files are read and
+// checked against p.OutDir, but nothing is written. includedFromDest is a set
+// of files that were the subject of an "include" action that set "from:
 // destination".
 //
 // The return value is a map containing a SHA256 hash of each file in
 // scratchDir. The keys are paths relative to scratchDir, using forward slashes
 // regardless of the OS.
-func commit(ctx context.Context, commitDryRun bool, p *Params, scratchDir string, includedFromDest map[string]string) (map[string][]byte, error) {
+func commit(ctx context.Context, commitDryRun bool, p *Params, cp *commitParams, stagingDir string) (map[string][]byte, *common.CopyStats, error) {
 	logger := logging.FromContext(ctx).With("logger", "commit")
 
-	if !commitDryRun {
-		// Output dirs will be created as needed, but we'll still create the
-		// output dir here to handle the edge case where the template generates
-		// no output files. In that case, the output directory should be created
-		// but empty.
-		if err := p.FS.MkdirAll(p.OutDir, common.OwnerRWXPerms); err != nil {
-			return nil, fmt.Errorf("failed creating template output directory: %w", err)
+	visitor := func(relPath string, de fs.DirEntry) (common.CopyHint, error) {
+		// Paths that steps created or renamed into an ignored location are
+		// left out, just like ignored paths are when they're included.
+		if cp.ignore != nil && cp.ignore.appliesToScratch() {
+			ignored, err := cp.ignore.ignored(relPath, de.IsDir())
+			if err != nil {
+				return common.CopyHint{}, err
+			}
+			if ignored {
+				return common.CopyHint{Skip: true}, nil
+			}
 		}
-	}
 
-	visitor := func(relPath string, _ fs.DirEntry) (common.CopyHint, error) {
 		if common.IsReservedInDest(relPath) {
 			// Users aren't allowed to output to ".abc" in the destination root.
 			return common.CopyHint{}, fmt.Errorf("the destination path %q uses the reserved name %q",
 				relPath, common.ABCInternalDir)
 		}
 
+		// The real (non-dry-run) copy goes to the empty staging directory,
+		// where nothing preexists and backups don't apply. The checks against
+		// the real destination were done in the dry run.
+		if !commitDryRun {
+			return common.CopyHint{AllowPreexisting: true}, nil
+		}
+
+		// A file that was included from the destination is being modified in
+		// place on purpose, even if another template owns it.
+		_, ok := cp.includedFromDest[relPath]
+		_, moved := cp.movedFromDest[relPath]
+		if !de.IsDir() && (!ok || moved) {
+			if err := checkOwner(ctx, p, cp.owners, relPath); err != nil {
+				return common.CopyHint{}, err
+			}
+		}
+
 		// In any of these cases, we enable overwriting:
 		//
 		// Edge case 1: this file was "include"d from the *destination*
-		// directory (rather than the template directory), and is therefore
-		// always allowed to be overwritten. For example, if we grab
+		// directory (rather than the template directory) under the same name,
+		// and is therefore always allowed to be overwritten. For example, if we grab
 		// file_to_modify.txt from the --dest dir, then we always allow ourself
 		// to write back to that file, even when --force-overwrite=false. When
 		// the template uses this feature, we know that the intent is to modify
@@ -751,31 +1617,13 @@ func commit(ctx context.Context, commitDryRun bool, p *Params, scratchDir string
 		//
 		// Edge case 3: we're in "manifest only" mode, which means that we don't
 		// want to output any files except the manifest.
-		_, ok := includedFromDest[relPath]
-		allowPreexisting := ok || p.ForceOverwrite || p.BackfillManifestOnly
+		allowPreexisting := (ok && !moved) || p.ForceOverwrite || p.BackfillManifestOnly
 
 		return common.CopyHint{
-			BackupIfExists:   p.Backups,
 			AllowPreexisting: allowPreexisting,
 		}, nil
 	}
 
-	// We only want to call MkdirTemp once, and use the resulting backup
-	// directory for every step in this rendering operation.
-	var backupDir string
-	var err error
-	backupDirMaker := func(rfs common.FS) (string, error) {
-		if backupDir != "" {
-			return backupDir, nil
-		}
-		if err := rfs.MkdirAll(p.BackupDir, common.OwnerRWXPerms); err != nil {
-			return "", err //nolint:wrapcheck // err already contains path, and it will be wrapped later
-		}
-		backupDir, err = rfs.MkdirTemp(p.BackupDir, "")
-		logger.DebugContext(ctx, "created backup directory", "path", backupDir)
-		return backupDir, err //nolint:wrapcheck // err already contains path, and it will be wrapped later
-	}
-
 	// Perhaps confusing: there are two separate concepts of "dry run" happening
 	// here. There's the "commit dry run mode" and the "CopyRecursive dry run
 	// mode." If the commit dry run mode is enabled, then the CopyRecursive dry
@@ -784,25 +1632,35 @@ func commit(ctx context.Context, commitDryRun bool, p *Params, scratchDir string
 	// which means we never write any output files except the manifest.
 	copyDryRun := commitDryRun || p.BackfillManifestOnly
 
+	dstRoot := stagingDir
+	if commitDryRun {
+		dstRoot = p.OutDir
+	}
+
 	params := &common.CopyParams{
-		BackupDirMaker: backupDirMaker,
-		DryRun:         copyDryRun,
-		DstRoot:        p.OutDir,
-		Hasher:         sha256.New,
-		OutHashes:      map[string][]byte{},
-		SrcRoot:        scratchDir,
-		FS:             p.FS,
-		Visitor:        visitor,
-	}
-	if err := common.CopyRecursive(ctx, nil, params); err != nil {
-		return nil, fmt.Errorf("failed writing to --dest directory: %w", err)
+		DryRun:           copyDryRun,
+		DstRoot:          dstRoot,
+		Hasher:           sha256.New,
+		OutHashes:        map[string][]byte{},
+		PreserveMetadata: cp.preserveMetadata,
+		PreserveXattrs:   cp.preserveXattrs,
+		SrcRoot:          cp.scratchDir,
+		FS:               p.FS,
+		Visitor:          visitor,
+	}
+	if !commitDryRun {
+		params.Progress = p.CopyProgress
+	}
+	stats, err := common.CopyRecursive(ctx, nil, params)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed writing to --dest directory: %w", err)
 	}
 	if commitDryRun {
 		logger.DebugContext(ctx, "template render (dry run) succeeded")
 	} else {
-		logger.InfoContext(ctx, "template render succeeded")
+		logger.DebugContext(ctx, "staged rendered output", "staging_dir", stagingDir)
 	}
-	return params.OutHashes, nil
+	return params.OutHashes, stats, nil
 }
 
 // fillDefaults takes the user-provided upgrade parameters and inserts default
@@ -814,9 +1672,59 @@ func fillDefaults(p *Params) *Params {
 	if out.DestDir == "" {
 		out.DestDir = out.OutDir
 	}
+	if out.Reproducible {
+		// A new mock clock is set to the Unix epoch and never advances.
+		out.Clock = clock.NewMock()
+	}
+	if out.SecretResolvers == nil {
+		out.SecretResolvers = secrets.DefaultResolvers()
+	}
 	return &out
 }
 
+// secretRefsFromSources returns the secret references that inputs were
+// resolved from, by input name.
+func secretRefsFromSources(sources map[string]*input.Source) map[string]string {
+	var out map[string]string
+	for name, src := range sources {
+		if src.SecretRef == "" {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]string)
+		}
+		out[name] = src.SecretRef
+	}
+	return out
+}
+
+// stepRange returns the top-level steps that p asks to run, which is all of
+// them unless p.StopAfterStep is set.
+func stepRange(p *Params, rs *resumeState, steps []*spec.Step) ([]*spec.Step, error) {
+	if p.StartFromStep == 0 && p.StopAfterStep == nil {
+		return steps, nil
+	}
+	if rs == nil {
+		return nil, fmt.Errorf("--start-from-step and --stop-after-step aren't supported for this kind of render")
+	}
+	if p.StartFromStep >= len(steps) {
+		return nil, fmt.Errorf("--start-from-step=%d is out of range, the template has %d steps (indices 0 to %d)",
+			p.StartFromStep, len(steps), len(steps)-1)
+	}
+	if p.StopAfterStep == nil {
+		return steps, nil
+	}
+	stop := *p.StopAfterStep
+	if stop >= len(steps) {
+		return nil, fmt.Errorf("--stop-after-step=%d is out of range, the template has %d steps (indices 0 to %d)",
+			stop, len(steps), len(steps)-1)
+	}
+	if stop < p.StartFromStep {
+		return nil, fmt.Errorf("--stop-after-step=%d is before --start-from-step=%d", stop, p.StartFromStep)
+	}
+	return steps[:stop+1], nil
+}
+
 func validate(p *Params) error {
 	if p.BackfillManifestOnly && p.SkipManifest {
 		return fmt.Errorf("if the --backfill-manifest-only flag is true, then the --skip-manifest flag must be false")
@@ -16,27 +16,45 @@ package render
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/benbjohnson/clock"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"golang.org/x/exp/maps"
 
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/auditlog"
 	"github.com/abcxyz/abc/templates/common/builtinvar"
+	"github.com/abcxyz/abc/templates/common/config"
+	"github.com/abcxyz/abc/templates/common/indexutil"
 	"github.com/abcxyz/abc/templates/common/input"
+	"github.com/abcxyz/abc/templates/common/signing"
+	"github.com/abcxyz/abc/templates/common/telemetry"
 	"github.com/abcxyz/abc/templates/common/tempdir"
 	"github.com/abcxyz/abc/templates/common/templatesource"
 	"github.com/abcxyz/abc/templates/model"
 	"github.com/abcxyz/abc/templates/model/decode"
-	manifest "github.com/abcxyz/abc/templates/model/manifest/v1alpha1"
-	spec "github.com/abcxyz/abc/templates/model/spec/v1beta6"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1beta7"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
 	abctestutil "github.com/abcxyz/abc/templates/testutil"
 	mdl "github.com/abcxyz/abc/templates/testutil/model"
 	"github.com/abcxyz/abc/templates/testutil/prompt"
@@ -1929,44 +1947,1229 @@ steps:
 			if diff := cmp.Diff(gotBackupContents, tc.wantBackupContents, cmpopts.EquateEmpty()); diff != "" {
 				t.Errorf("backups directory contents were not as expected (-got,+want): %s", diff)
 			}
+			if err == nil && result.ManifestPath != "" {
+				var gotManifestBackupDir string
+				if m := mustLoadManifest(ctx, t, filepath.Join(outDir, result.ManifestPath)); m.BackupDir != nil {
+					gotManifestBackupDir = m.BackupDir.Val
+				}
+				// The manifest records the backup relative to the backup
+				// root, which is the parent of Params.BackupDir.
+				var wantManifestBackupDir string
+				if backupSubdir != "" {
+					wantManifestBackupDir = path.Join(filepath.Base(backupDir), filepath.Base(backupSubdir))
+				}
+				if gotManifestBackupDir != wantManifestBackupDir {
+					t.Errorf("manifest backup_dir was %q, want %q", gotManifestBackupDir, wantManifestBackupDir)
+				}
+			}
+
+			var gotDebugContents map[string]string
+			debugDir, ok := abctestutil.TestMustGlob(t, filepath.Join(tempDir, tempdir.DebugStepDiffsDirNamePart+"*"))
+			if ok {
+				gotDebugContents = abctestutil.LoadDir(t, debugDir)
+			}
+			gotDebugDirExists := len(gotDebugContents) > 0
+			if tc.flagDebugStepDiffs != gotDebugDirExists {
+				t.Errorf("debug directory existence is %t but should be %t", gotDebugDirExists, tc.flagDebugStepDiffs)
+			}
+		})
+	}
+}
+
+func verifyManifest(ctx context.Context, tb testing.TB, gotManifest bool, manifestPath string, want *manifest.Manifest) {
+	tb.Helper()
+
+	if !gotManifest {
+		if want == nil {
+			// No manifest was outputted, and none was expected, so that's a success
+			return
+		}
+		tb.Errorf("got no manifest, but wanted %v", want)
+		return
+	}
+
+	got := mustLoadManifest(ctx, tb, manifestPath)
+
+	opts := []cmp.Option{
+		// Don't force test authors to assert the line and column numbers
+		cmpopts.IgnoreTypes(&model.ConfigPos{}, model.ConfigPos{}),
+		cmpopts.IgnoreFields(manifest.Manifest{}, "TemplateDirhash", "BackupDir"), // BackupDir has a random name, it's checked separately
+
+		// Input provenance and the render environment are tested separately.
+		cmpopts.IgnoreFields(manifest.Manifest{}, "UpgradeChannelSource", "ConflictFileNames", "InputFiles", "RenderEnvironment"),
+		cmpopts.IgnoreFields(manifest.Input{}, "Source", "SourceFile"),
+		cmpopts.IgnoreFields(manifest.OutputFile{}, "Hash"),
+		cmpopts.EquateEmpty(),
+	}
+
+	if diff := cmp.Diff(got, want, opts...); diff != "" {
+		tb.Errorf("the outputted manifest was not as expected (-got,+want): %s", diff)
+	}
+}
+
+func TestRender_FileMetadata(t *testing.T) {
+	t.Parallel()
+
+	templateMtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	cases := []struct {
+		name             string
+		specFileMetadata string
+		flagFileMetadata string
+		wantPreserved    bool
+	}{
+		{
+			name: "default",
+		},
+		{
+			name:             "spec_permissions",
+			specFileMetadata: FileMetadataPermissions,
+		},
+		{
+			name:             "spec_preserve",
+			specFileMetadata: FileMetadataPreserve,
+			wantPreserved:    true,
+		},
+		{
+			name:             "flag_preserve",
+			flagFileMetadata: FileMetadataPreserve,
+			wantPreserved:    true,
+		},
+		{
+			name:             "flag_overrides_spec",
+			specFileMetadata: FileMetadataPreserve,
+			flagFileMetadata: FileMetadataPermissions,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			specContents := `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'A template for testing file metadata'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['unmodified.sh', 'modified.sh']
+  - desc: 'Modify'
+    action: 'string_replace'
+    params:
+      paths: ['modified.sh']
+      replacements:
+        - to_replace: 'foo'
+          with: 'bar'
+`
+			if tc.specFileMetadata != "" {
+				specContents += fmt.Sprintf("file_metadata: '%s'\n", tc.specFileMetadata)
+			}
+
+			tempDir := t.TempDir()
+			sourceDir := filepath.Join(tempDir, "source")
+			outDir := filepath.Join(tempDir, "out")
+			abctestutil.WriteAll(t, sourceDir, map[string]string{
+				"spec.yaml":     specContents,
+				"unmodified.sh": "foo",
+				"modified.sh":   "foo",
+			})
+			for _, name := range []string{"unmodified.sh", "modified.sh"} {
+				path := filepath.Join(sourceDir, name)
+				if err := os.Chmod(path, 0o700|os.ModeSetgid); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(path, templateMtime, templateMtime); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			if _, err := Render(ctx, &Params{
+				Clock:             clock.NewMock(),
+				Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+				FileMetadata:      tc.flagFileMetadata,
+				FS:                &common.RealFS{},
+				OutDir:            outDir,
+				SkipManifest:      true,
+				SourceForMessages: sourceDir,
+				Stdout:            io.Discard,
+				TempDirBase:       tempDir,
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			wantMode := os.FileMode(0o700)
+			if tc.wantPreserved {
+				wantMode |= os.ModeSetgid
+			}
+			if runtime.GOOS == "windows" {
+				// Windows only has a read-only attribute, which os.Stat
+				// reports as the absence of the write bits.
+				wantMode = 0o666
+			}
+			for _, name := range []string{"unmodified.sh", "modified.sh"} {
+				info, err := os.Stat(filepath.Join(outDir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := info.Mode() &^ os.ModeType; got != wantMode {
+					t.Errorf("%s: got mode %v, want %v", name, got, wantMode)
+				}
+
+				// A file that's modified by a step gets a fresh modification
+				// time regardless of the policy.
+				wantTemplateMtime := tc.wantPreserved && name == "unmodified.sh"
+				if got := info.ModTime().Equal(templateMtime); got != wantTemplateMtime {
+					t.Errorf("%s: got mtime %v, wanted the template mtime (%v): %t", name, info.ModTime(), templateMtime, wantTemplateMtime)
+				}
+			}
+		})
+	}
+}
+
+func TestRender_Reproducible(t *testing.T) {
+	t.Parallel()
+
+	specContents := `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'A template for testing reproducibility'
+inputs:
+  - name: 'b_input'
+    desc: 'An input'
+  - name: 'a_input'
+    desc: 'Another input'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['z.txt', 'a.txt']
+  - desc: 'Include from destination'
+    action: 'include'
+    params:
+      from: 'destination'
+      paths: ['existing.txt']
+  - desc: 'Modify'
+    action: 'append'
+    params:
+      paths: ['existing.txt', 'a.txt']
+      with: '{{.a_input}} {{.b_input}} {{._now_ms}}'
+`
+
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	abctestutil.WriteAll(t, sourceDir, map[string]string{
+		"spec.yaml": specContents,
+		"a.txt":     "a",
+		"z.txt":     "z",
+	})
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	var outputs []map[string]string
+	for i, clk := range []clock.Clock{clock.New(), clock.NewMock()} {
+		outDir := filepath.Join(tempDir, fmt.Sprintf("out%d", i))
+		abctestutil.WriteAll(t, outDir, map[string]string{"existing.txt": "existing\n"})
+
+		if _, err := Render(ctx, &Params{
+			BackupDir:         filepath.Join(tempDir, "backups"),
+			Backups:           true,
+			Clock:             clk,
+			Cwd:               tempDir,
+			Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+			FS:                &common.RealFS{},
+			InputsFromFlags:   map[string]string{"a_input": "A", "b_input": "B"},
+			OutDir:            outDir,
+			Reproducible:      true,
+			SourceForMessages: sourceDir,
+			Stdout:            io.Discard,
+			TempDirBase:       tempDir,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, abctestutil.LoadDir(t, outDir))
+	}
+
+	if diff := cmp.Diff(outputs[0], outputs[1]); diff != "" {
+		t.Errorf("two renders with the same inputs had different output (-first,+second): %s", diff)
+	}
+
+	manifestName := ".abc/manifest_nolocation_1970-01-01T00:00:00Z.lock.yaml"
+	manifestContents, ok := outputs[0][manifestName]
+	if !ok {
+		t.Fatalf("manifest %q wasn't found in %v", manifestName, maps.Keys(outputs[0]))
+	}
+	for _, want := range []string{
+		"creation_time: 1970-01-01T00:00:00Z",
+		"modification_time: 1970-01-01T00:00:00Z",
+		"patch: |",
+	} {
+		if !strings.Contains(manifestContents, want) {
+			t.Errorf("manifest didn't contain %q:\n%s", want, manifestContents)
+		}
+	}
+	if strings.Contains(manifestContents, "backup_dir") {
+		t.Errorf("a reproducible manifest shouldn't record the backup dir:\n%s", manifestContents)
+	}
+	if got, want := outputs[0]["a.txt"], "aA B 0\n"; got != want {
+		t.Errorf("got a.txt contents %q, want %q", got, want)
+	}
+}
+
+func TestRender_ManifestProvenance(t *testing.T) {
+	t.Parallel()
+
+	specContents := `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'A template for testing input provenance'
+inputs:
+  - name: 'from_flag'
+    desc: 'an input given by --input'
+  - name: 'from_file'
+    desc: 'an input given by --input-file'
+  - name: 'from_default'
+    desc: 'an input with a default'
+    default: 'default_value'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+`
+
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	inputFile := filepath.Join(tempDir, "inputs.yaml")
+	abctestutil.WriteAll(t, tempDir, map[string]string{
+		"source/spec.yaml": specContents,
+		"source/a.txt":     "a",
+		"inputs.yaml":      "from_file: file_value",
+	})
+	outDir := filepath.Join(tempDir, "out")
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	result, err := Render(ctx, &Params{
+		AcceptDefaults:    true,
+		Clock:             clock.NewMock(),
+		Cwd:               tempDir,
+		Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+		FS:                &common.RealFS{},
+		InputFiles:        []string{inputFile},
+		InputsFromFlags:   map[string]string{"from_flag": "flag_value"},
+		OutDir:            outDir,
+		SourceForMessages: sourceDir,
+		Stdout:            io.Discard,
+		TempDirBase:       tempDir,
+		UpgradeChannel:    "main",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := mustLoadManifest(ctx, t, filepath.Join(outDir, result.ManifestPath))
+
+	if got, want := got.UpgradeChannelSource.Val, manifest.UpgradeChannelSourceFlag; got != want {
+		t.Errorf("got upgrade_channel_source %q, want %q", got, want)
+	}
+	if got, want := got.ConflictFileNames.Val, manifest.ConflictFileNamesKeepExtension; got != want {
+		t.Errorf("got conflict_file_names %q, want %q", got, want)
+	}
+
+	wantInputs := []*manifest.Input{
+		{Name: mdl.S("from_default"), Value: mdl.S("default_value"), Source: mdl.S(manifest.InputSourceDefault)},
+		{Name: mdl.S("from_file"), Value: mdl.S("file_value"), Source: mdl.S(manifest.InputSourceInputFile), SourceFile: mdl.S(inputFile)},
+		{Name: mdl.S("from_flag"), Value: mdl.S("flag_value"), Source: mdl.S(manifest.InputSourceFlag)},
+	}
+	opts := []cmp.Option{
+		cmpopts.IgnoreTypes(&model.ConfigPos{}, model.ConfigPos{}),
+		cmpopts.EquateEmpty(),
+	}
+	if diff := cmp.Diff(got.Inputs, wantInputs, opts...); diff != "" {
+		t.Errorf("manifest inputs were not as expected (-got,+want): %s", diff)
+	}
+
+	inputFileHash := sha256.Sum256([]byte("from_file: file_value"))
+	wantInputFiles := []*manifest.InputFile{
+		{Path: mdl.S("../inputs.yaml"), Hash: mdl.S("h1:" + base64.StdEncoding.EncodeToString(inputFileHash[:]))},
+	}
+	if diff := cmp.Diff(got.InputFiles, wantInputFiles, opts...); diff != "" {
+		t.Errorf("manifest input files were not as expected (-got,+want): %s", diff)
+	}
+
+	if got.RenderEnvironment == nil {
+		t.Fatal("got no render_environment in the manifest, but wanted one")
+	}
+	if got, want := got.RenderEnvironment.OS.Val, runtime.GOOS; got != want {
+		t.Errorf("got render_environment.os %q, want %q", got, want)
+	}
+}
+
+func TestRender_Outputs(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name         string
+		outputs      string
+		want         map[string]string
+		wantManifest []*manifest.Output
+		wantErr      string
+	}{
+		{
+			name: "outputs_computed",
+			outputs: `outputs:
+  - name: 'service_url'
+    desc: 'where the service runs'
+    value: '"https://" + service_name + ".run.app"'
+  - name: 'module_path'
+    value: '"github.com/foo/" + service_name'
+`,
+			want: map[string]string{
+				"module_path": "github.com/foo/my-service",
+				"service_url": "https://my-service.run.app",
+			},
+			wantManifest: []*manifest.Output{
+				{Name: mdl.S("module_path"), Value: mdl.S("github.com/foo/my-service")},
+				{Name: mdl.S("service_url"), Value: mdl.S("https://my-service.run.app")},
+			},
+		},
+		{
+			name: "no_outputs",
+		},
+		{
+			name: "unknown_variable",
+			outputs: `outputs:
+  - name: 'service_url'
+    value: 'nonexistent'
+`,
+			wantErr: `failed computing the value of output "service_url"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			sourceDir := filepath.Join(tempDir, "source")
+			abctestutil.WriteAll(t, sourceDir, map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'A template with outputs'
+inputs:
+  - name: 'service_name'
+    desc: 'the name of the service'
+` + tc.outputs + `steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+`,
+				"a.txt": "a",
+			})
+			outDir := filepath.Join(tempDir, "out")
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			result, err := Render(ctx, &Params{
+				Clock:             clock.NewMock(),
+				Cwd:               tempDir,
+				Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+				FS:                &common.RealFS{},
+				InputsFromFlags:   map[string]string{"service_name": "my-service"},
+				OutDir:            outDir,
+				SourceForMessages: sourceDir,
+				Stdout:            io.Discard,
+				TempDirBase:       tempDir,
+				UpgradeChannel:    "main",
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			if diff := cmp.Diff(result.Outputs, tc.want, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("result outputs were not as expected (-got,+want): %s", diff)
+			}
+
+			got := mustLoadManifest(ctx, t, filepath.Join(outDir, result.ManifestPath))
+			opts := []cmp.Option{
+				cmpopts.IgnoreTypes(&model.ConfigPos{}, model.ConfigPos{}),
+				cmpopts.EquateEmpty(),
+			}
+			if diff := cmp.Diff(got.Outputs, tc.wantManifest, opts...); diff != "" {
+				t.Errorf("manifest outputs were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestRender_RemoteInclude(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name         string
+		steps        string
+		want         map[string]string
+		wantManifest func(sharedDir string) []*manifest.RemoteInclude
+		wantErr      string
+	}{
+		{
+			name: "includes_from_remote_once",
+			steps: `  - desc: 'Include the Makefile'
+    action: 'include'
+    params:
+      paths:
+        - paths: ['Makefile']
+          from: 'remote'
+          source: '{{.shared_dir}}'
+        - paths: ['lint/config.yaml']
+          as: ['.lint.yaml']
+          from: 'remote'
+          source: '{{.shared_dir}}'
+  - desc: 'Include a template file'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+`,
+			want: map[string]string{
+				"Makefile":   "all: build",
+				".lint.yaml": "strict: true",
+				"a.txt":      "a",
+			},
+			wantManifest: func(sharedDir string) []*manifest.RemoteInclude {
+				return []*manifest.RemoteInclude{{Source: mdl.S(sharedDir)}}
+			},
+		},
+		{
+			name: "inside_for_each",
+			steps: `  - desc: 'For each'
+    action: 'for_each'
+    params:
+      iterator:
+        key: 'f'
+        values: ['Makefile']
+      steps:
+        - desc: 'Include'
+          action: 'include'
+          params:
+            paths:
+              - paths: ['{{.f}}']
+                from: 'remote'
+                source: '{{.shared_dir}}'
+`,
+			want: map[string]string{
+				"Makefile": "all: build",
+			},
+			wantManifest: func(sharedDir string) []*manifest.RemoteInclude {
+				return []*manifest.RemoteInclude{{Source: mdl.S(sharedDir)}}
+			},
+		},
+		{
+			name: "no_remote_includes",
+			steps: `  - desc: 'Include a template file'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+`,
+			want: map[string]string{
+				"a.txt": "a",
+			},
+			wantManifest: func(string) []*manifest.RemoteInclude { return nil },
+		},
+		{
+			name: "missing_file_in_remote",
+			steps: `  - desc: 'Include'
+    action: 'include'
+    params:
+      paths:
+        - paths: ['nonexistent']
+          from: 'remote'
+          source: '{{.shared_dir}}'
+`,
+			wantErr: "include paths did not match any files: [nonexistent]",
+		},
+		{
+			name: "bad_source",
+			steps: `  - desc: 'Include'
+    action: 'include'
+    params:
+      paths:
+        - paths: ['Makefile']
+          from: 'remote'
+          source: '{{.shared_dir}}/nonexistent'
+`,
+			wantErr: "failed parsing remote include source",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			sharedDir := filepath.Join(tempDir, "shared")
+			abctestutil.WriteAll(t, sharedDir, map[string]string{
+				"Makefile":         "all: build",
+				"lint/config.yaml": "strict: true",
+			})
+			sourceDir := filepath.Join(tempDir, "source")
+			abctestutil.WriteAll(t, sourceDir, map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'A template with remote includes'
+inputs:
+  - name: 'shared_dir'
+    desc: 'where the shared files are'
+steps:
+` + tc.steps,
+				"a.txt": "a",
+			})
+			outDir := filepath.Join(tempDir, "out")
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			result, err := Render(ctx, &Params{
+				Clock:             clock.NewMock(),
+				Cwd:               tempDir,
+				Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+				FS:                &common.RealFS{},
+				InputsFromFlags:   map[string]string{"shared_dir": sharedDir},
+				OutDir:            outDir,
+				SourceForMessages: sourceDir,
+				Stdout:            io.Discard,
+				TempDirBase:       tempDir,
+				UpgradeChannel:    "main",
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			got := abctestutil.LoadDir(t, outDir, abctestutil.SkipGlob(".abc/*"))
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("output was not as expected (-got,+want): %s", diff)
+			}
+
+			gotManifest := mustLoadManifest(ctx, t, filepath.Join(outDir, result.ManifestPath))
+			opts := []cmp.Option{
+				cmpopts.IgnoreTypes(&model.ConfigPos{}, model.ConfigPos{}),
+				cmpopts.EquateEmpty(),
+			}
+			if diff := cmp.Diff(gotManifest.RemoteIncludes, tc.wantManifest(sharedDir), opts...); diff != "" {
+				t.Errorf("manifest remote includes were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestRender_RecordsInIndex(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	repoDir := filepath.Join(tempDir, "repo")
+	abctestutil.WriteAll(t, tempDir, map[string]string{
+		"source/spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'A template for testing the installation index'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+`,
+		"source/a.txt": "a",
+	})
+	abctestutil.WriteAll(t, repoDir, abctestutil.WithGitRepoAt("", nil))
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	result, err := Render(ctx, &Params{
+		Clock:             clock.NewMock(),
+		Cwd:               tempDir,
+		Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+		FS:                &common.RealFS{},
+		OutDir:            filepath.Join(repoDir, "subdir"),
+		SourceForMessages: sourceDir,
+		Stdout:            io.Discard,
+		TempDirBase:       tempDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok, err := indexutil.ManifestPaths(ctx, &common.RealFS{}, repoDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("render didn't create an installation index")
+	}
+	want := []string{filepath.Join("subdir", result.ManifestPath)}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("indexed manifests were not as expected (-got,+want): %s", diff)
+	}
+}
+
+func TestRender_SignsManifest(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	destDir := filepath.Join(tempDir, "dest")
+	abctestutil.WriteAll(t, sourceDir, map[string]string{
+		"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'A template for testing manifest signing'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+`,
+		"a.txt": "a",
+	})
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	result, err := Render(ctx, &Params{
+		Clock:             clock.NewMock(),
+		Cwd:               tempDir,
+		Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+		FS:                &common.RealFS{},
+		ManifestSigner:    priv,
+		OutDir:            destDir,
+		SourceForMessages: sourceDir,
+		Stdout:            io.Discard,
+		TempDirBase:       tempDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifestPath := filepath.Join(destDir, result.ManifestPath)
+	if err := signing.VerifyFile(&common.RealFS{}, pub, manifestPath); err != nil {
+		t.Errorf("VerifyFile(%q): %v", manifestPath, err)
+	}
+}
+
+func TestRender_PolicyViolation(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	destDir := filepath.Join(tempDir, "dest")
+	policyPath := filepath.Join(tempDir, "policy.yaml")
+	abctestutil.WriteAll(t, tempDir, map[string]string{
+		"policy.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Policy'
+rules:
+  - rule: 'path.startsWith("src/")'
+    message: 'Files may only be written under src/'
+`,
+	})
+	abctestutil.WriteAll(t, sourceDir, map[string]string{
+		"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'A template for testing policies'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['a.txt', 'src']
+`,
+		"a.txt":     "a",
+		"src/b.txt": "b",
+	})
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	_, err := Render(ctx, &Params{
+		Clock:             clock.NewMock(),
+		Cwd:               tempDir,
+		Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+		FS:                &common.RealFS{},
+		OutDir:            destDir,
+		PolicyFiles:       []string{policyPath},
+		SourceForMessages: sourceDir,
+		Stdout:            io.Discard,
+		TempDirBase:       tempDir,
+	})
+	if diff := testutil.DiffErrString(err, "Files:        a.txt"); diff != "" {
+		t.Fatal(diff)
+	}
+	if got := common.ExitCodeOf(err); got != common.ExitCodePolicyViolation {
+		t.Errorf("got exit code %d, want %d", got, common.ExitCodePolicyViolation)
+	}
+	if _, err := os.Stat(destDir); !os.IsNotExist(err) {
+		t.Errorf("output dir %q should not have been created, but Stat returned %v", destDir, err)
+	}
+}
+
+func TestRender_SymlinkEscapeBlocked(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	destDir := filepath.Join(tempDir, "dest")
+	abctestutil.WriteAll(t, tempDir, map[string]string{
+		"outside/secret.txt": "secret",
+		"dest/README.md":     "readme",
+	})
+	if err := os.Symlink(filepath.Join(tempDir, "outside"), filepath.Join(destDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	abctestutil.WriteAll(t, sourceDir, map[string]string{
+		"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'A template that tries to read outside of the destination'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      from: 'destination'
+      paths: ['link/secret.txt']
+`,
+	})
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	_, err := Render(ctx, &Params{
+		Clock:             clock.NewMock(),
+		Cwd:               tempDir,
+		Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+		FS:                &common.RealFS{},
+		OutDir:            destDir,
+		SourceForMessages: sourceDir,
+		Stdout:            io.Discard,
+		TempDirBase:       tempDir,
+	})
+	if diff := testutil.DiffErrString(err, "outside of the directories that a template may use"); diff != "" {
+		t.Fatal(diff)
+	}
+	var jailErr *common.PathOutsideJailError
+	if !errors.As(err, &jailErr) {
+		t.Errorf("got error %v, want a PathOutsideJailError", err)
+	}
+}
+
+func TestRender_FinishesInterruptedCommitFirst(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	destDir := filepath.Join(tempDir, "dest")
+	// An earlier render was interrupted after staging a new version of
+	// existing.txt, but before moving it into place.
+	abctestutil.WriteAll(t, destDir, map[string]string{
+		"existing.txt":                      "old\n",
+		".abc/staging-1/files/existing.txt": "new\n",
+		".abc/staging-1/journal.yaml":       "files:\n  - existing.txt\n",
+	})
+	abctestutil.WriteAll(t, sourceDir, map[string]string{
+		"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'A template that modifies a file in the destination'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      from: 'destination'
+      paths: ['existing.txt']
+  - desc: 'Append'
+    action: 'append'
+    params:
+      paths: ['existing.txt']
+      with: 'appended'
+`,
+	})
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	if _, err := Render(ctx, &Params{
+		Clock:             clock.NewMock(),
+		Cwd:               tempDir,
+		Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+		FS:                &common.RealFS{},
+		OutDir:            destDir,
+		SkipManifest:      true,
+		SourceForMessages: sourceDir,
+		Stdout:            io.Discard,
+		TempDirBase:       tempDir,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The template must have seen the interrupted render's version of the file.
+	got := abctestutil.LoadDir(t, destDir)
+	want := map[string]string{"existing.txt": "new\nappended\n"}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("dest contents were not as expected (-got,+want): %s", diff)
+	}
+}
+
+func TestRender_IgnorePatterns(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	destDir := filepath.Join(tempDir, "dest")
+	abctestutil.WriteAll(t, sourceDir, map[string]string{
+		"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'A template with gitignore-style ignore patterns'
+ignore:
+  - '*.tmp'
+  - '!keep.tmp'
+  - 'cache/'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['.']
+  - desc: 'Rename into an ignored location'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+      as: ['renamed.tmp']
+`,
+		"a.txt":           "a",
+		"b.tmp":           "b",
+		"keep.tmp":        "keep",
+		"cache/c.txt":     "c",
+		"sub/cache/d.txt": "d",
+	})
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	if _, err := Render(ctx, &Params{
+		Clock:             clock.NewMock(),
+		Cwd:               tempDir,
+		Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+		FS:                &common.RealFS{},
+		OutDir:            destDir,
+		SkipManifest:      true,
+		SourceForMessages: sourceDir,
+		Stdout:            io.Discard,
+		TempDirBase:       tempDir,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := abctestutil.LoadDir(t, destDir)
+	want := map[string]string{
+		"a.txt":    "a",
+		"keep.tmp": "keep",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("dest contents were not as expected (-got,+want): %s", diff)
+	}
+}
+
+// countingDownloader is a Downloader that counts the calls to Download.
+type countingDownloader struct {
+	templatesource.Downloader
+	calls int
+}
+
+func (c *countingDownloader) Download(ctx context.Context, cwd, templateDir, destDir string) (*templatesource.DownloadMetadata, error) {
+	c.calls++
+	return c.Downloader.Download(ctx, cwd, templateDir, destDir) //nolint:wrapcheck
+}
+
+func TestRender_AlsoRenderTo(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	destDir := filepath.Join(tempDir, "dest")
+	previewDir := filepath.Join(tempDir, "preview")
+	abctestutil.WriteAll(t, sourceDir, map[string]string{
+		"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'A template with an environment'
+inputs:
+  - name: 'env'
+    desc: 'The environment'
+  - name: 'region'
+    desc: 'The region'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['config.txt']
+  - desc: 'Fill in'
+    action: 'go_template'
+    params:
+      paths: ['config.txt']
+`,
+		"config.txt": "{{.env}} in {{.region}}",
+	})
+
+	dl := &countingDownloader{Downloader: &templatesource.LocalDownloader{SrcPath: sourceDir}}
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	result, err := Render(ctx, &Params{
+		AlsoRenderInputs:  map[string]string{"env": "preview"},
+		AlsoRenderTo:      previewDir,
+		Clock:             clock.NewMock(),
+		Cwd:               tempDir,
+		Downloader:        dl,
+		FS:                &common.RealFS{},
+		InputsFromFlags:   map[string]string{"env": "prod", "region": "us"},
+		OutDir:            destDir,
+		SourceForMessages: sourceDir,
+		Stdout:            io.Discard,
+		TempDirBase:       tempDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dl.calls != 1 {
+		t.Errorf("got %d downloads, want 1", dl.calls)
+	}
+	if result.AlsoRendered == nil || result.AlsoRendered.ManifestPath == "" {
+		t.Errorf("got AlsoRendered %+v, want a result with a manifest", result.AlsoRendered)
+	}
+
+	for dir, want := range map[string]string{
+		destDir:    "prod in us",
+		previewDir: "preview in us",
+	} {
+		got := abctestutil.LoadDir(t, dir, abctestutil.SkipGlob(".abc/manifest*"))
+		if diff := cmp.Diff(got, map[string]string{"config.txt": want}); diff != "" {
+			t.Errorf("%s contents were not as expected (-got,+want): %s", dir, diff)
+		}
+	}
+}
+
+// countingMetrics is a telemetry.Metrics that remembers the counters.
+type countingMetrics struct {
+	telemetry.Nop
+
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func (c *countingMetrics) Count(_ context.Context, name string, n int64, attrs ...telemetry.Attr) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := name
+	for _, a := range attrs {
+		key += fmt.Sprintf(" %s=%s", a.Key, a.Value)
+	}
+	c.counts[key] += n
+}
+
+func TestRender_Metrics(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	abctestutil.WriteAll(t, sourceDir, map[string]string{
+		"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'A template for testing metrics'
+inputs:
+  - name: 'n'
+    desc: 'a number'
+    rules:
+      - rule: 'int(n) > 0'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+`,
+		"a.txt": "a",
+	})
 
-			var gotDebugContents map[string]string
-			debugDir, ok := abctestutil.TestMustGlob(t, filepath.Join(tempDir, tempdir.DebugStepDiffsDirNamePart+"*"))
-			if ok {
-				gotDebugContents = abctestutil.LoadDir(t, debugDir)
-			}
-			gotDebugDirExists := len(gotDebugContents) > 0
-			if tc.flagDebugStepDiffs != gotDebugDirExists {
-				t.Errorf("debug directory existence is %t but should be %t", gotDebugDirExists, tc.flagDebugStepDiffs)
-			}
-		})
+	m := &countingMetrics{counts: map[string]int64{}}
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	ctx = telemetry.WithMetrics(ctx, m)
+
+	for i, n := range []string{"1", "0"} {
+		if _, err := Render(ctx, &Params{
+			Clock:             clock.NewMock(),
+			Cwd:               tempDir,
+			Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+			FS:                &common.RealFS{},
+			InputsFromFlags:   map[string]string{"n": n},
+			OutDir:            filepath.Join(tempDir, fmt.Sprintf("dest%d", i)),
+			SourceForMessages: sourceDir,
+			Stdout:            io.Discard,
+			TempDirBase:       tempDir,
+		}); (err != nil) != (n == "0") {
+			t.Fatalf("Render() with n=%s returned unexpected error: %v", n, err)
+		}
+	}
+
+	want := map[string]int64{
+		"abc.downloads outcome=success":        2,
+		"abc.renders outcome=success":          1,
+		"abc.renders outcome=input_validation": 1,
+	}
+	if diff := cmp.Diff(m.counts, want); diff != "" {
+		t.Errorf("counts were not as expected (-got,+want): %s", diff)
 	}
 }
 
-func verifyManifest(ctx context.Context, tb testing.TB, gotManifest bool, manifestPath string, want *manifest.Manifest) {
-	tb.Helper()
+func TestRender_AuditLog(t *testing.T) {
+	t.Parallel()
 
-	if !gotManifest {
-		if want == nil {
-			// No manifest was outputted, and none was expected, so that's a success
-			return
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	abctestutil.WriteAll(t, sourceDir, map[string]string{
+		"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'A template for testing the audit log'
+inputs:
+  - name: 'n'
+    desc: 'a number'
+    rules:
+      - rule: 'int(n) > 0'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+`,
+		"a.txt": "a",
+	})
+
+	auditPath := filepath.Join(tempDir, "audit.jsonl")
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	for i, n := range []string{"1", "0"} {
+		if _, err := Render(ctx, &Params{
+			AuditLog:          &auditlog.FileSink{Path: auditPath},
+			Clock:             clock.NewMock(),
+			Cwd:               tempDir,
+			Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+			FS:                &common.RealFS{},
+			InputsFromFlags:   map[string]string{"n": n},
+			OutDir:            filepath.Join(tempDir, fmt.Sprintf("dest%d", i)),
+			SourceForMessages: sourceDir,
+			Stdout:            io.Discard,
+			TempDirBase:       tempDir,
+		}); (err != nil) != (n == "0") {
+			t.Fatalf("Render() with n=%s returned unexpected error: %v", n, err)
 		}
-		tb.Errorf("got no manifest, but wanted %v", want)
-		return
 	}
 
-	got := mustLoadManifest(ctx, tb, manifestPath)
+	buf, err := os.ReadFile(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []*auditlog.Record
+	for _, line := range strings.Split(strings.TrimSpace(string(buf)), "\n") {
+		r := &auditlog.Record{}
+		if err := json.Unmarshal([]byte(line), r); err != nil {
+			t.Fatalf("line %q isn't a JSON record: %v", line, err)
+		}
+		got = append(got, r)
+	}
 
+	want := []*auditlog.Record{
+		{
+			Time:      time.Unix(0, 0).UTC(),
+			Operation: auditlog.OperationRender,
+			Source:    sourceDir,
+			Dest:      filepath.Join(tempDir, "dest0"),
+			Result:    auditlog.ResultSuccess,
+		},
+		{
+			Time:      time.Unix(0, 0).UTC(),
+			Operation: auditlog.OperationRender,
+			Source:    sourceDir,
+			Dest:      filepath.Join(tempDir, "dest1"),
+			Result:    auditlog.ResultError,
+		},
+	}
 	opts := []cmp.Option{
-		// Don't force test authors to assert the line and column numbers
-		cmpopts.IgnoreTypes(&model.ConfigPos{}, model.ConfigPos{}),
-		cmpopts.IgnoreFields(manifest.Manifest{}, "TemplateDirhash"),
-		cmpopts.IgnoreFields(manifest.OutputFile{}, "Hash"),
-		cmpopts.EquateEmpty(),
+		// User, Host, and ABCVersion depend on the machine that the test runs
+		// on. Error is checked separately below.
+		cmpopts.IgnoreFields(auditlog.Record{}, "User", "Host", "ABCVersion", "Error"),
 	}
-
 	if diff := cmp.Diff(got, want, opts...); diff != "" {
-		tb.Errorf("the outputted manifest was not as expected (-got,+want): %s", diff)
+		t.Errorf("audit records were not as expected (-got,+want): %s", diff)
+	}
+	if len(got) == 2 && !strings.Contains(got[1].Error, "int(n) > 0") {
+		t.Errorf("got error %q in the audit record, want one about the failed input rule", got[1].Error)
+	}
+}
+
+func TestRender_StepObserver(t *testing.T) {
+	t.Parallel()
+
+	specContents := `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'A template for testing step observation'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+  - desc: 'Skipped'
+    if: 'false'
+    action: 'print'
+    params:
+      message: 'never'
+  - desc: 'Loop'
+    action: 'for_each'
+    params:
+      iterator:
+        key: 'x'
+        values: ['1', '2']
+      steps:
+        - desc: 'Print in loop'
+          action: 'print'
+          params:
+            message: '{{.x}}'
+`
+
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	abctestutil.WriteAll(t, sourceDir, map[string]string{
+		"spec.yaml": specContents,
+		"a.txt":     "a",
+	})
+
+	type observation struct {
+		Desc     string
+		Executed bool
+	}
+	var got []observation
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	if _, err := Render(ctx, &Params{
+		Clock:             clock.NewMock(),
+		Cwd:               tempDir,
+		Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+		FS:                &common.RealFS{},
+		OutDir:            filepath.Join(tempDir, "out"),
+		SkipManifest:      true,
+		SourceForMessages: sourceDir,
+		StepObserver: func(step *spec.Step, executed bool) {
+			got = append(got, observation{Desc: step.Desc.Val, Executed: executed})
+		},
+		Stdout:      io.Discard,
+		TempDirBase: tempDir,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []observation{
+		{Desc: "Include", Executed: true},
+		{Desc: "Skipped", Executed: false},
+		{Desc: "Loop", Executed: true},
+		{Desc: "Print in loop", Executed: true},
+		{Desc: "Print in loop", Executed: true},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("observed steps were not as expected (-got,+want): %s", diff)
 	}
 }
 
@@ -2304,3 +3507,450 @@ func mustLoadManifest(ctx context.Context, tb testing.TB, path string) *manifest
 
 	return out
 }
+
+func TestRender_OutputLimits(t *testing.T) {
+	t.Parallel()
+
+	forEachSpec := `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'A template that copies a file once per value'
+steps:
+  - desc: 'Loop'
+    action: 'for_each'
+    params:
+      iterator:
+        key: 'x'
+        values: ['1', '2', '3', '4', '5']
+      steps:
+        - desc: 'Copy'
+          action: 'include'
+          params:
+            paths: ['a.txt']
+            as: ['out/{{.x}}.txt']
+`
+	includeSpec := `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'A template that includes a directory'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['big']
+`
+
+	cases := []struct {
+		name           string
+		spec           string
+		maxOutputFiles int
+		maxOutputBytes int64
+		maxFileBytes   int64
+		wantErr        string
+	}{
+		{
+			name:           "within_limits",
+			spec:           forEachSpec,
+			maxOutputFiles: 5,
+			maxOutputBytes: 50,
+			maxFileBytes:   10,
+		},
+		{
+			name: "no_limits",
+			spec: forEachSpec,
+		},
+		{
+			name:           "for_each_too_many_files",
+			spec:           forEachSpec,
+			maxOutputFiles: 3,
+			wantErr:        "more than the limit of 3 files (see --max-output-files)",
+		},
+		{
+			name:           "for_each_too_many_bytes",
+			spec:           forEachSpec,
+			maxOutputBytes: 25,
+			wantErr:        "more than the limit of 25 bytes in total (see --max-output-bytes)",
+		},
+		{
+			name:           "include_too_many_files",
+			spec:           includeSpec,
+			maxOutputFiles: 1,
+			wantErr:        "more than the limit of 1 files (see --max-output-files)",
+		},
+		{
+			name:         "include_file_too_large",
+			spec:         includeSpec,
+			maxFileBytes: 15,
+			wantErr:      `output file "big/large.txt" is 20 bytes, which is more than the limit of 15 bytes per file (see --max-file-bytes)`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			sourceDir := filepath.Join(tempDir, "source")
+			destDir := filepath.Join(tempDir, "dest")
+			abctestutil.WriteAll(t, sourceDir, map[string]string{
+				"spec.yaml":     tc.spec,
+				"a.txt":         "ten bytes!",
+				"big/small.txt": "tiny",
+				"big/large.txt": "twenty bytes exactly",
+			})
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			_, err := Render(ctx, &Params{
+				Clock:             clock.NewMock(),
+				Cwd:               tempDir,
+				Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+				FS:                &common.RealFS{},
+				MaxFileBytes:      tc.maxFileBytes,
+				MaxOutputBytes:    tc.maxOutputBytes,
+				MaxOutputFiles:    tc.maxOutputFiles,
+				OutDir:            destDir,
+				SkipManifest:      true,
+				SourceForMessages: sourceDir,
+				Stdout:            io.Discard,
+				TempDirBase:       tempDir,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err == nil {
+				return
+			}
+			if got := common.ExitCodeOf(err); got != common.ExitCodeOutputLimit {
+				t.Errorf("got exit code %d, want %d", got, common.ExitCodeOutputLimit)
+			}
+			if _, err := os.Stat(destDir); !os.IsNotExist(err) {
+				t.Errorf("dest dir should not have been created, but Stat returned %v", err)
+			}
+		})
+	}
+}
+
+func TestRunWithRetries(t *testing.T) {
+	t.Parallel()
+
+	transient := common.WithCategory(common.CategoryDownload, fmt.Errorf("connection reset"))
+	permanent := fmt.Errorf("bad template")
+
+	cases := []struct {
+		name         string
+		step         *spec.Step
+		errs         []error // returned by successive attempts; nil after they run out
+		blockOnFirst bool    // the first attempt waits until its context is done
+		wantAttempts int
+		wantErr      string
+	}{
+		{
+			name:         "success",
+			step:         &spec.Step{Action: mdl.S("include")},
+			wantAttempts: 1,
+		},
+		{
+			name:         "no_retries_by_default",
+			step:         &spec.Step{Action: mdl.S("include")},
+			errs:         []error{transient},
+			wantAttempts: 1,
+			wantErr:      "connection reset",
+		},
+		{
+			name: "retries_transient_error",
+			step: &spec.Step{
+				Action:  mdl.S("include"),
+				Retries: model.Int{Val: 3},
+			},
+			errs:         []error{transient, transient},
+			wantAttempts: 3,
+		},
+		{
+			name: "gives_up_after_retries",
+			step: &spec.Step{
+				Action:  mdl.S("include"),
+				Retries: model.Int{Val: 2},
+			},
+			errs:         []error{transient, transient, transient, transient},
+			wantAttempts: 3,
+			wantErr:      "connection reset",
+		},
+		{
+			name: "permanent_error_not_retried",
+			step: &spec.Step{
+				Action:  mdl.S("include"),
+				Retries: model.Int{Val: 3},
+			},
+			errs:         []error{permanent},
+			wantAttempts: 1,
+			wantErr:      "bad template",
+		},
+		{
+			name: "timeout",
+			step: &spec.Step{
+				Action:  mdl.S("include"),
+				Timeout: mdl.S("10ms"),
+			},
+			blockOnFirst: true,
+			wantAttempts: 1,
+			wantErr:      `action "include" timed out after 10ms: context deadline exceeded`,
+		},
+		{
+			name: "timed_out_download_is_retried",
+			step: &spec.Step{
+				Action:  mdl.S("include"),
+				Timeout: mdl.S("10ms"),
+				Retries: model.Int{Val: 1},
+			},
+			blockOnFirst: true,
+			wantAttempts: 2,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			sp := &stepParams{retryBaseDelay: time.Millisecond}
+			attempts := 0
+			action := func(ctx context.Context) error {
+				attempts++
+				if tc.blockOnFirst && attempts == 1 {
+					<-ctx.Done()
+					return common.WithCategory(common.CategoryDownload, ctx.Err())
+				}
+				if attempts <= len(tc.errs) {
+					return tc.errs[attempts-1]
+				}
+				return nil
+			}
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			err := runWithRetries(ctx, 0, tc.step, sp, action)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			if attempts != tc.wantAttempts {
+				t.Errorf("got %d attempts, want %d", attempts, tc.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRunWithRetries_CanceledWhileWaiting(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(logging.WithLogger(context.Background(), logging.TestLogger(t)))
+	sp := &stepParams{retryBaseDelay: time.Hour}
+	step := &spec.Step{Action: mdl.S("include"), Retries: model.Int{Val: 1}}
+	attempts := 0
+	err := runWithRetries(ctx, 0, step, sp, func(context.Context) error {
+		attempts++
+		cancel()
+		return common.WithCategory(common.CategoryDownload, fmt.Errorf("connection reset"))
+	})
+	if diff := testutil.DiffErrString(err, "connection reset"); diff != "" {
+		t.Error(diff)
+	}
+	if attempts != 1 {
+		t.Errorf("got %d attempts, want 1", attempts)
+	}
+}
+
+func TestRenderAlreadyDownloaded_UpgradeChannelPolicy(t *testing.T) {
+	t.Parallel()
+
+	policy := &config.UpgradeChannelPolicy{
+		Allowed: []string{"latest", "release-*"},
+		File:    "/repo/.abc.yaml",
+	}
+
+	cases := []struct {
+		name         string
+		channel      string
+		policy       *config.UpgradeChannelPolicy
+		skipManifest bool
+		wantErr      string
+	}{
+		{
+			name:    "allowed",
+			channel: "latest",
+			policy:  policy,
+		},
+		{
+			name:    "allowed_by_pattern",
+			channel: "release-1.x",
+			policy:  policy,
+		},
+		{
+			name:    "disallowed",
+			channel: "main",
+			policy:  policy,
+			wantErr: `the upgrade channel "main" isn't allowed by the upgrade_channel_policy in "/repo/.abc.yaml", which only allows latest, release-*; use --ignore-upgrade-channel-policy to override`,
+		},
+		{
+			name:         "disallowed_but_no_manifest",
+			channel:      "main",
+			policy:       policy,
+			skipManifest: true,
+		},
+		{
+			name:    "no_policy",
+			channel: "main",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			templateDir := filepath.Join(tempDir, "template")
+			abctestutil.WriteAll(t, templateDir, map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta6'
+kind: 'Template'
+desc: 'A template'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+`,
+				"a.txt": "hello\n",
+			})
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			_, err := RenderAlreadyDownloaded(ctx, &templatesource.DownloadMetadata{UpgradeChannel: tc.channel}, templateDir, &Params{
+				Clock:                clock.NewMock(),
+				Cwd:                  tempDir,
+				FS:                   &common.RealFS{},
+				OutDir:               filepath.Join(tempDir, "out"),
+				SkipManifest:         tc.skipManifest,
+				Stdout:               io.Discard,
+				TempDirBase:          tempDir,
+				UpgradeChannelPolicy: tc.policy,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestRender_MemFS(t *testing.T) {
+	t.Parallel()
+
+	src := fstest.MapFS{
+		"templates/hello/spec.yaml": &fstest.MapFile{Data: []byte(`api_version: 'cli.abcxyz.dev/v1beta6'
+kind: 'Template'
+desc: 'A template rendered entirely in memory'
+inputs:
+  - name: 'name'
+    desc: 'A name'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['*.txt', 'dir']
+  - desc: 'Replace'
+    action: 'string_replace'
+    params:
+      paths: ['.']
+      replacements:
+        - to_replace: 'NAME'
+          with: '{{.name}}'
+  - desc: 'Print'
+    action: 'print'
+    params:
+      message: 'Hello, {{.name}}'
+`)},
+		"templates/hello/a.txt":     &fstest.MapFile{Data: []byte("hi NAME\n")},
+		"templates/hello/b.txt":     &fstest.MapFile{Data: []byte("bye NAME\n")},
+		"templates/hello/dir/c.md":  &fstest.MapFile{Data: []byte("# NAME\n")},
+		"templates/hello/other.dat": &fstest.MapFile{Data: []byte("not included\n")},
+	}
+
+	// A root directory that doesn't exist on the local disk, to check that
+	// nothing is written there.
+	root := filepath.Join(string(filepath.Separator), "abc-memfs-test-"+strconv.FormatInt(time.Now().UnixNano(), 10))
+	mfs := &common.MemFS{}
+	outDir := filepath.Join(root, "out")
+	if err := mfs.MkdirAll(outDir, common.OwnerRWXPerms); err != nil {
+		t.Fatal(err)
+	}
+	if err := mfs.WriteFile(filepath.Join(outDir, "existing.txt"), []byte("existing\n"), common.OwnerRWPerms); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	stdout := &strings.Builder{}
+	result, err := Render(ctx, &Params{
+		Clock:             clock.NewMock(),
+		Cwd:               root,
+		Downloader:        &templatesource.FSDownloader{Src: src, Dir: "templates/hello", FS: mfs, Version: "v1.2.3"},
+		FS:                mfs,
+		InputsFromFlags:   map[string]string{"name": "Alice"},
+		OutDir:            outDir,
+		SourceForMessages: "hello",
+		Stdout:            stdout,
+		TempDirBase:       filepath.Join(root, "tmp"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(root); !common.IsNotExistErr(err) {
+		t.Errorf("rendering into a MemFS touched the local disk at %q (Stat error: %v)", root, err)
+	}
+	if got, want := stdout.String(), "Hello, Alice\n"; got != want {
+		t.Errorf("got stdout %q, want %q", got, want)
+	}
+	if got, want := result.DownloadMetadata.Version, "v1.2.3"; got != want {
+		t.Errorf("got version %q, want %q", got, want)
+	}
+
+	want := map[string]string{
+		"a.txt":        "hi Alice\n",
+		"b.txt":        "bye Alice\n",
+		"dir/c.md":     "# Alice\n",
+		"existing.txt": "existing\n",
+	}
+	got := map[string]string{}
+	if err := fs.WalkDir(mfs, outDir, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(outDir, path)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		if de.IsDir() {
+			if rel == common.ABCInternalDir {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		buf, err := mfs.ReadFile(path)
+		got[filepath.ToSlash(rel)] = string(buf)
+		return err //nolint:wrapcheck
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("dest contents were not as expected (-got,+want): %s", diff)
+	}
+	if _, err := mfs.Stat(filepath.Join(outDir, result.ManifestPath)); err != nil {
+		t.Errorf("the manifest wasn't written: %v", err)
+	}
+
+	// The temp dirs were cleaned up.
+	entries, err := mfs.ReadDir(filepath.Join(root, "tmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) > 0 {
+		t.Errorf("temp dirs weren't removed: %v", entries)
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/input"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// report collects what happened during a render, for the HTML report written
+// by --report. Its methods are safe to call on a nil *report, which does
+// nothing.
+type report struct {
+	mu           sync.Mutex
+	inputs       map[string]string
+	inputSources map[string]*input.Source
+	files        []*reportFile
+	warnings     []string
+}
+
+// reportFile is one file written by the render.
+type reportFile struct {
+	Path string
+	Size int64
+
+	// Hash is the hex-encoded SHA256 of the file contents.
+	Hash string
+}
+
+func (r *report) setInputs(inputs map[string]string, sources map[string]*input.Source) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inputs = inputs
+	r.inputSources = sources
+}
+
+// setFiles records the files that were written to outDir, given their hashes.
+func (r *report) setFiles(fs common.FS, outDir string, hashes map[string][]byte) error {
+	if r == nil {
+		return nil
+	}
+	files := make([]*reportFile, 0, len(hashes))
+	for relPath, hash := range hashes {
+		fi, err := fs.Stat(filepath.Join(outDir, relPath))
+		if err != nil {
+			return fmt.Errorf("failed reading the size of %q for --report: %w", relPath, err)
+		}
+		files = append(files, &reportFile{
+			Path: filepath.ToSlash(relPath),
+			Size: fi.Size(),
+			Hash: hex.EncodeToString(hash),
+		})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.files = files
+	return nil
+}
+
+func (r *report) addWarning(msg string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.warnings = append(r.warnings, msg)
+}
+
+// withReport returns a copy of p that collects a report, and a context whose
+// logger also records warnings in the report.
+func withReport(ctx context.Context, p *Params) (context.Context, *Params) {
+	out := *p
+	out.report = &report{}
+	if out.Timings == nil {
+		out.Timings = &Timings{}
+	}
+	logger := logging.FromContext(ctx)
+	ctx = logging.WithLogger(ctx, slog.New(&warningCollector{
+		next:   logger.Handler(),
+		report: out.report,
+	}))
+	return ctx, &out
+}
+
+// warningCollector is a slog.Handler that records the messages of warnings
+// and errors in a report, and passes every record on to the next handler.
+type warningCollector struct {
+	next   slog.Handler
+	report *report
+}
+
+func (w *warningCollector) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelWarn || w.next.Enabled(ctx, level)
+}
+
+func (w *warningCollector) Handle(ctx context.Context, rec slog.Record) error {
+	if rec.Level >= slog.LevelWarn {
+		var msg strings.Builder
+		msg.WriteString(rec.Message)
+		rec.Attrs(func(a slog.Attr) bool {
+			fmt.Fprintf(&msg, " %s=%v", a.Key, a.Value)
+			return true
+		})
+		w.report.addWarning(msg.String())
+	}
+	if !w.next.Enabled(ctx, rec.Level) {
+		return nil
+	}
+	return w.next.Handle(ctx, rec) //nolint:wrapcheck
+}
+
+func (w *warningCollector) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &warningCollector{next: w.next.WithAttrs(attrs), report: w.report}
+}
+
+func (w *warningCollector) WithGroup(name string) slog.Handler {
+	return &warningCollector{next: w.next.WithGroup(name), report: w.report}
+}
+
+// writeReport writes the HTML report of a finished render to p.ReportPath.
+// Like the audit log, it's written whether or not the render succeeded.
+func writeReport(p *Params, result *Result, renderErr error) error {
+	r := p.report
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if p.Clock != nil {
+		now = p.Clock.Now()
+	}
+	dest := p.DestDir
+	if dest == "" {
+		dest = p.OutDir
+	}
+
+	data := &reportData{
+		Source:   p.SourceForMessages,
+		Dest:     common.JoinIfRelative(p.Cwd, dest),
+		Time:     now.UTC().Format(time.RFC3339),
+		Files:    r.files,
+		Warnings: r.warnings,
+	}
+	if result != nil && result.DownloadMetadata != nil {
+		data.Version = result.DownloadMetadata.Version
+	}
+	if renderErr != nil {
+		data.Error = renderErr.Error()
+	}
+	names := make([]string, 0, len(r.inputs))
+	for name := range r.inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ri := &reportInput{Name: name, Value: r.inputs[name]}
+		if src := r.inputSources[name]; src != nil {
+			ri.Source = src.Kind
+			if src.File != "" {
+				ri.Source += " " + src.File
+			}
+		}
+		data.Inputs = append(data.Inputs, ri)
+	}
+	for _, e := range p.Timings.Entries() {
+		if e.Phase != PhaseStep {
+			continue
+		}
+		data.Steps = append(data.Steps, &reportStep{
+			Action:   e.Action,
+			Line:     e.Line,
+			Count:    e.Count,
+			Duration: e.Duration.Round(time.Millisecond).String(),
+		})
+	}
+
+	var buf strings.Builder
+	if err := reportTmpl.Execute(&buf, data); err != nil {
+		return fmt.Errorf("failed generating --report: %w", err)
+	}
+	path := common.JoinIfRelative(p.Cwd, p.ReportPath)
+	if err := p.FS.WriteFile(path, []byte(buf.String()), common.OwnerRWPerms); err != nil {
+		return fmt.Errorf("failed writing --report file %q: %w", path, err)
+	}
+	return nil
+}
+
+type reportData struct {
+	Source   string
+	Version  string
+	Dest     string
+	Time     string
+	Error    string
+	Inputs   []*reportInput
+	Steps    []*reportStep
+	Files    []*reportFile
+	Warnings []string
+}
+
+type reportInput struct {
+	Name   string
+	Value  string
+	Source string
+}
+
+type reportStep struct {
+	Action   string
+	Line     int
+	Count    int
+	Duration string
+}
+
+var reportTmpl = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>abc render report: {{.Source}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #d0d7de; padding: 0.25em 0.75em; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; }
+td.num { text-align: right; }
+code { font-family: monospace; }
+.success { color: #1a7f37; }
+.failure { color: #cf222e; }
+</style>
+</head>
+<body>
+<h1>abc render report</h1>
+<table>
+<tr><th>Template</th><td><code>{{.Source}}</code></td></tr>
+{{- if .Version}}
+<tr><th>Version</th><td><code>{{.Version}}</code></td></tr>
+{{- end}}
+<tr><th>Destination</th><td><code>{{.Dest}}</code></td></tr>
+<tr><th>Time</th><td>{{.Time}}</td></tr>
+<tr><th>Result</th><td>{{if .Error}}<span class="failure">failed</span>: <code>{{.Error}}</code>{{else}}<span class="success">success</span>{{end}}</td></tr>
+</table>
+
+<h2>Inputs</h2>
+{{- if .Inputs}}
+<table>
+<tr><th>Name</th><th>Value</th><th>Source</th></tr>
+{{- range .Inputs}}
+<tr><td><code>{{.Name}}</code></td><td><code>{{.Value}}</code></td><td>{{.Source}}</td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p>None.</p>
+{{- end}}
+
+<h2>Steps executed</h2>
+{{- if .Steps}}
+<table>
+<tr><th>Action</th><th>Line</th><th>Runs</th><th>Duration</th></tr>
+{{- range .Steps}}
+<tr><td><code>{{.Action}}</code></td><td class="num">{{.Line}}</td><td class="num">{{.Count}}</td><td class="num">{{.Duration}}</td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p>None.</p>
+{{- end}}
+
+<h2>Files written</h2>
+{{- if .Files}}
+<table>
+<tr><th>Path</th><th>Size (bytes)</th><th>SHA256</th></tr>
+{{- range .Files}}
+<tr><td><code>{{.Path}}</code></td><td class="num">{{.Size}}</td><td><code>{{.Hash}}</code></td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p>None.</p>
+{{- end}}
+
+<h2>Warnings</h2>
+{{- if .Warnings}}
+<ul>
+{{- range .Warnings}}
+<li><code>{{.}}</code></li>
+{{- end}}
+</ul>
+{{- else}}
+<p>None.</p>
+{{- end}}
+</body>
+</html>
+`))
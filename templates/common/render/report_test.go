@@ -0,0 +1,171 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestRender_Report(t *testing.T) {
+	t.Parallel()
+
+	specContents := `api_version: 'cli.abcxyz.dev/v1beta6'
+kind: 'Template'
+desc: 'A template'
+inputs:
+  - name: 'name'
+    desc: 'who to greet'
+  - name: 'punctuation'
+    desc: 'the punctuation'
+    default: '!'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+  - desc: 'Replace'
+    action: 'string_replace'
+    params:
+      paths: ['a.txt']
+      replacements:
+        - to_replace: 'NAME'
+          with: '{{.name}}{{.punctuation}}'
+`
+
+	cases := []struct {
+		name            string
+		inputs          map[string]string
+		wantContains    []string
+		wantNotContains []string
+		wantErr         string
+	}{
+		{
+			name:   "success",
+			inputs: map[string]string{"name": "Bob"},
+			wantContains: []string{
+				`<span class="success">success</span>`,
+				`<tr><td><code>name</code></td><td><code>Bob</code></td><td>flag</td></tr>`,
+				`<tr><td><code>punctuation</code></td><td><code>!</code></td><td>default</td></tr>`,
+				`<tr><td><code>include</code></td><td class="num">11</td><td class="num">1</td>`,
+				`<tr><td><code>string_replace</code></td><td class="num">15</td><td class="num">1</td>`,
+				// The SHA256 of "hello Bob!\n".
+				`<tr><td><code>a.txt</code></td><td class="num">11</td><td><code>e0f6849d2507d7de259ca176f9cb4b194b08ef8be4a8f456ef31f49abbb56aff</code></td></tr>`,
+			},
+		},
+		{
+			name:   "failure",
+			inputs: map[string]string{},
+			wantContains: []string{
+				`<span class="failure">failed</span>: <code>missing input(s): name`,
+			},
+			wantNotContains: []string{
+				"<td><code>a.txt</code></td>",
+			},
+			wantErr: "missing input(s): name",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			sourceDir := filepath.Join(tempDir, "source")
+			abctestutil.WriteAll(t, sourceDir, map[string]string{
+				"spec.yaml": specContents,
+				"a.txt":     "hello NAME\n",
+			})
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			_, err := Render(ctx, &Params{
+				AcceptDefaults:    true,
+				Clock:             clock.NewMock(),
+				Cwd:               tempDir,
+				Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+				FS:                &common.RealFS{},
+				InputsFromFlags:   tc.inputs,
+				OutDir:            filepath.Join(tempDir, "out"),
+				ReportPath:        "report.html",
+				SkipManifest:      true,
+				SourceForMessages: sourceDir,
+				Stdout:            io.Discard,
+				TempDirBase:       tempDir,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+
+			report, err := os.ReadFile(filepath.Join(tempDir, "report.html"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tc.wantContains {
+				if !strings.Contains(string(report), want) {
+					t.Errorf("report doesn't contain %q:\n%s", want, report)
+				}
+			}
+			for _, notWant := range tc.wantNotContains {
+				if strings.Contains(string(report), notWant) {
+					t.Errorf("report unexpectedly contains %q:\n%s", notWant, report)
+				}
+			}
+		})
+	}
+}
+
+func TestWithReport_CollectsWarnings(t *testing.T) {
+	t.Parallel()
+
+	var logs strings.Builder
+	ctx := logging.WithLogger(context.Background(), logging.New(&logs, slog.LevelError, logging.FormatText, false))
+	ctx, p := withReport(ctx, &Params{})
+
+	logger := logging.FromContext(ctx).With("logger", "test")
+	logger.InfoContext(ctx, "not a warning")
+	logger.WarnContext(ctx, "this template is deprecated", "replaced_by", "other")
+	logger.ErrorContext(ctx, "something failed")
+
+	want := []string{
+		"this template is deprecated replaced_by=other",
+		"something failed",
+	}
+	if diff := cmp.Diff(p.report.warnings, want); diff != "" {
+		t.Errorf("warnings were not as expected (-got,+want): %s", diff)
+	}
+	// The warning is below the logger's level, so it's only in the report.
+	if strings.Contains(logs.String(), "deprecated") {
+		t.Errorf("the warning was logged even though the log level is error: %s", logs.String())
+	}
+	if !strings.Contains(logs.String(), "something failed") {
+		t.Errorf("the error wasn't logged: %s", logs.String())
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// lowDiskSpaceMargin is how much free space, beyond the size of the rendered
+// output, the destination filesystem should have before committing. Less than
+// this causes a warning, since the commit might fail partway through staging.
+const lowDiskSpaceMargin = 100 << 20 // 100 MiB
+
+// ResourceSummary describes the files and disk space used by a render.
+type ResourceSummary struct {
+	// FilesWritten and BytesWritten count the files that were written to the
+	// destination directory, not counting the manifest.
+	FilesWritten int
+	BytesWritten int64
+
+	// TemplateDirBytes is the size of the downloaded template, and
+	// ScratchDirBytes is the size of the scratch directory after all the
+	// steps ran. These are temporary directories that are removed when the
+	// render finishes, unless --keep-temp-dirs was given.
+	TemplateDirBytes int64
+	ScratchDirBytes  int64
+
+	// BackupFiles and BackupBytes count the preexisting destination files
+	// that were backed up before being overwritten.
+	BackupFiles int
+	BackupBytes int64
+}
+
+// logAttrs returns the summary as key/value pairs for logging.
+func (r *ResourceSummary) logAttrs() []any {
+	return []any{
+		"files_written", r.FilesWritten,
+		"bytes_written", r.BytesWritten,
+		"template_dir_bytes", r.TemplateDirBytes,
+		"scratch_dir_bytes", r.ScratchDirBytes,
+		"backup_files", r.BackupFiles,
+		"backup_bytes", r.BackupBytes,
+	}
+}
+
+// dirUsage returns the number of regular files under dir and their total size.
+// A nonexistent dir is empty.
+func dirUsage(rfs common.FS, dir string) (files int, bytes int64, _ error) {
+	if dir == "" {
+		return 0, 0, nil
+	}
+	err := fs.WalkDir(rfs, dir, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			if common.IsNotExistErr(err) && path == dir {
+				return nil
+			}
+			return err
+		}
+		if !de.Type().IsRegular() {
+			return nil
+		}
+		info, err := de.Info()
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		files++
+		bytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed measuring the size of %q: %w", dir, err)
+	}
+	return files, bytes, nil
+}
+
+// warnIfLowDiskSpace logs a warning if the filesystem that destDir is on
+// doesn't have room for needBytes of output plus lowDiskSpaceMargin. Failing
+// to find out how much space is free isn't an error, since this is only
+// advice.
+func warnIfLowDiskSpace(ctx context.Context, destDir string, needBytes int64) {
+	logger := logging.FromContext(ctx).With("logger", "warnIfLowDiskSpace")
+
+	free, err := common.FreeDiskBytes(destDir)
+	if err != nil {
+		logger.DebugContext(ctx, "couldn't check free disk space", "error", err)
+		return
+	}
+	if need := uint64(needBytes) + lowDiskSpaceMargin; free < need { //nolint:gosec // sizes are never negative
+		logger.WarnContext(ctx, "the destination filesystem is low on space, the render may fail partway through writing its output",
+			"dest", destDir,
+			"free_bytes", free,
+			"output_bytes", needBytes)
+	}
+}
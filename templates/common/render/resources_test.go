@@ -0,0 +1,129 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+)
+
+func TestRender_Resources(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	outDir := filepath.Join(tempDir, "out")
+	abctestutil.WriteAll(t, sourceDir, map[string]string{
+		"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta6'
+kind: 'Template'
+desc: 'A template for testing resource accounting'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['a.txt', 'b.txt']
+`,
+		"a.txt": "aaaa\n",
+		"b.txt": "bb\n",
+	})
+	abctestutil.WriteAll(t, outDir, map[string]string{"a.txt": "old\n"})
+	specSize := int64(len(abctestutil.LoadDir(t, sourceDir)["spec.yaml"]))
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	result, err := Render(ctx, &Params{
+		BackupDir:         filepath.Join(tempDir, "backups"),
+		Backups:           true,
+		Clock:             clock.NewMock(),
+		Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+		ForceOverwrite:    true,
+		FS:                &common.RealFS{},
+		OutDir:            outDir,
+		SkipManifest:      true,
+		SourceForMessages: sourceDir,
+		Stdout:            io.Discard,
+		TempDirBase:       tempDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &ResourceSummary{
+		FilesWritten:     2,
+		BytesWritten:     8,
+		TemplateDirBytes: specSize + 8,
+		ScratchDirBytes:  8,
+		BackupFiles:      1,
+		BackupBytes:      4,
+	}
+	if diff := cmp.Diff(result.Resources, want); diff != "" {
+		t.Errorf("resource summary was not as expected (-got,+want): %s", diff)
+	}
+}
+
+func TestDirUsage(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	abctestutil.WriteAll(t, tempDir, map[string]string{
+		"a.txt":     "12345",
+		"dir/b.txt": "123",
+	})
+
+	cases := []struct {
+		name      string
+		dir       string
+		wantFiles int
+		wantBytes int64
+	}{
+		{
+			name:      "files_in_subdirs_count",
+			dir:       tempDir,
+			wantFiles: 2,
+			wantBytes: 8,
+		},
+		{
+			name: "nonexistent_dir_is_empty",
+			dir:  filepath.Join(tempDir, "nonexistent"),
+		},
+		{
+			name: "no_dir",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			files, bytes, err := dirUsage(&common.RealFS{}, tc.dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if files != tc.wantFiles || bytes != tc.wantBytes {
+				t.Errorf("got %d files and %d bytes, wanted %d files and %d bytes", files, bytes, tc.wantFiles, tc.wantBytes)
+			}
+		})
+	}
+}
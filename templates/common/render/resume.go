@@ -0,0 +1,360 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+// This file implements resumable renders (the --resumable and --resume flags).
+// While a resumable render runs, it keeps a "resume directory" in the temp dir
+// containing the downloaded template, a checkpoint of the scratch directory as
+// of the last completed step, and a journal describing the progress so far. If
+// the render is interrupted, "abc render --resume" picks up after the last
+// completed step instead of downloading the template and running every step
+// again.
+//
+// The resume directory has a fixed name derived from the destination
+// directory, so the resuming render can find it without the user having to
+// tell us where it is.
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/pkg/logging"
+)
+
+const (
+	// resumeJournalFileName is the name of the journal file in the resume
+	// directory.
+	resumeJournalFileName = "journal.yaml"
+
+	// resumeTemplateDir is the subdirectory of the resume directory that
+	// contains the downloaded template.
+	resumeTemplateDir = "template"
+
+	// resumeCheckpointPrefix is the prefix of the subdirectories of the resume
+	// directory containing a copy of the scratch directory after some step.
+	resumeCheckpointPrefix = "checkpoint-"
+)
+
+// resumeJournal is the contents of the journal file in the resume directory.
+type resumeJournal struct {
+	// Source is the template location given by the user, used to make sure
+	// that --resume is resuming the same template.
+	Source string `yaml:"source"`
+
+	DownloadMetadata *templatesource.DownloadMetadata `yaml:"download_metadata"`
+
+	// Inputs are the resolved template inputs, and Vars are all the variables
+	// in scope (inputs plus builtins like _now_ms). Both are saved so the
+	// resumed render sees exactly the same values as the interrupted one.
+	Inputs map[string]string `yaml:"inputs"`
+	Vars   map[string]string `yaml:"vars"`
+
+	// CompletedSteps is the number of top-level steps that finished.
+	CompletedSteps int `yaml:"completed_steps"`
+
+	// Checkpoint is the name of the subdirectory of the resume directory
+	// containing the scratch directory as of the end of the last completed
+	// step. Empty if no steps have completed.
+	Checkpoint string `yaml:"checkpoint,omitempty"`
+
+	// IncludedFromDest is stepParams.includedFromDest as of the checkpoint.
+	IncludedFromDest map[string]string `yaml:"included_from_dest,omitempty"`
+
+	// MovedFromDest is stepParams.movedFromDest as of the checkpoint.
+	MovedFromDest map[string]string `yaml:"moved_from_dest,omitempty"`
+
+	// KeptCheckpoints is written by renders with --start-from-step or
+	// --stop-after-step, which keep the checkpoint after every step rather
+	// than only the last one, so that a later render can start from any of
+	// them. It's keyed by the number of completed steps.
+	KeptCheckpoints map[int]*keptCheckpoint `yaml:"kept_checkpoints,omitempty"`
+}
+
+// keptCheckpoint records the state that goes with a checkpoint directory
+// other than the latest one.
+type keptCheckpoint struct {
+	IncludedFromDest map[string]string `yaml:"included_from_dest,omitempty"`
+	MovedFromDest    map[string]string `yaml:"moved_from_dest,omitempty"`
+}
+
+// resumeState tracks the resume directory of one render.
+type resumeState struct {
+	fs  common.FS
+	dir string
+
+	// resuming is true if this render is picking up from an interrupted one,
+	// false if it's a fresh render that might be resumed later.
+	resuming bool
+
+	// journaled is true once the journal file has been written. Before that,
+	// there's nothing worth resuming.
+	journaled bool
+
+	// keepAll is true when debugging a range of steps. Every checkpoint is
+	// kept, and the resume directory isn't removed when the render ends.
+	keepAll bool
+
+	journal resumeJournal
+}
+
+// resumeDirPath returns the resume directory for renders into p.OutDir.
+func resumeDirPath(p *Params) string {
+	base := p.TempDirBase
+	if base == "" {
+		base = os.TempDir()
+	}
+	outDir := filepath.Clean(common.JoinIfRelative(p.Cwd, p.OutDir))
+	sum := sha256.Sum256([]byte(outDir))
+	return filepath.Join(base, tempdir.ResumeDirNamePart+hex.EncodeToString(sum[:8]))
+}
+
+// newResumeState prepares the resume directory for a fresh render. Any resume
+// directory left behind by an earlier interrupted render into the same
+// destination is discarded, since the user chose not to resume it.
+func newResumeState(ctx context.Context, p *Params) (*resumeState, error) {
+	logger := logging.FromContext(ctx).With("logger", "newResumeState")
+
+	rs := &resumeState{fs: p.FS, dir: resumeDirPath(p)}
+	if err := rs.fs.RemoveAll(rs.dir); err != nil {
+		return nil, fmt.Errorf("failed removing stale resume directory %q: %w", rs.dir, err)
+	}
+	if err := rs.fs.MkdirAll(rs.templateDir(), common.OwnerRWXPerms); err != nil {
+		return nil, fmt.Errorf("failed creating resume directory: %w", err)
+	}
+	logger.DebugContext(ctx, "created resume directory", "path", rs.dir)
+	return rs, nil
+}
+
+// loadResumeState reads the journal left behind by an interrupted render into
+// p.OutDir.
+func loadResumeState(p *Params) (*resumeState, error) {
+	rs := &resumeState{fs: p.FS, dir: resumeDirPath(p), resuming: true, journaled: true}
+	buf, err := rs.fs.ReadFile(filepath.Join(rs.dir, resumeJournalFileName))
+	if err != nil {
+		if common.IsNotExistErr(err) {
+			return nil, fmt.Errorf("there's no interrupted render into %q to resume; only renders with --resumable can be resumed, run again without --resume", p.OutDir)
+		}
+		return nil, fmt.Errorf("failed reading resume journal: %w", err)
+	}
+	if err := yaml.Unmarshal(buf, &rs.journal); err != nil {
+		return nil, fmt.Errorf("failed parsing resume journal %q: %w", filepath.Join(rs.dir, resumeJournalFileName), err)
+	}
+	if rs.journal.Source != p.SourceForMessages {
+		return nil, fmt.Errorf("the interrupted render into %q was of template %q, not %q; run again without --resume to start over",
+			p.OutDir, rs.journal.Source, p.SourceForMessages)
+	}
+	if rs.journal.DownloadMetadata == nil {
+		return nil, fmt.Errorf("resume journal %q is missing download metadata", filepath.Join(rs.dir, resumeJournalFileName))
+	}
+	return rs, nil
+}
+
+// loadStartFromStep prepares to run the steps of a render into p.OutDir
+// starting at p.StartFromStep, from the checkpoint that an earlier render into
+// the same destination left just before that step. Checkpoints after that
+// step are discarded, since they're about to be redone.
+func loadStartFromStep(p *Params) (*resumeState, error) {
+	n := p.StartFromStep
+	if _, err := p.FS.Stat(filepath.Join(resumeDirPath(p), resumeJournalFileName)); err != nil {
+		if common.IsNotExistErr(err) {
+			return nil, fmt.Errorf("--start-from-step needs the checkpoints of an earlier render into %q, but there are none; run first with --stop-after-step=%d", p.OutDir, n-1)
+		}
+		return nil, fmt.Errorf("failed reading resume journal: %w", err)
+	}
+	rs, err := loadResumeState(p)
+	if err != nil {
+		return nil, err
+	}
+	j := &rs.journal
+
+	var kc *keptCheckpoint
+	switch {
+	case j.KeptCheckpoints[n] != nil:
+		kc = j.KeptCheckpoints[n]
+	case j.CompletedSteps == n && j.Checkpoint != "":
+		kc = &keptCheckpoint{IncludedFromDest: j.IncludedFromDest, MovedFromDest: j.MovedFromDest}
+	default:
+		return nil, fmt.Errorf("the earlier render into %q didn't keep a checkpoint from before step index %d; run first with --stop-after-step=%d",
+			p.OutDir, n, n-1)
+	}
+
+	for k := range j.KeptCheckpoints {
+		if k > n {
+			delete(j.KeptCheckpoints, k)
+			if err := rs.fs.RemoveAll(filepath.Join(rs.dir, checkpointName(k))); err != nil {
+				return nil, fmt.Errorf("failed removing checkpoint directory: %w", err)
+			}
+		}
+	}
+	if j.Checkpoint != "" && j.Checkpoint != checkpointName(n) {
+		if err := rs.fs.RemoveAll(filepath.Join(rs.dir, j.Checkpoint)); err != nil {
+			return nil, fmt.Errorf("failed removing checkpoint directory: %w", err)
+		}
+	}
+	j.Checkpoint = checkpointName(n)
+	j.CompletedSteps = n
+	j.IncludedFromDest = kc.IncludedFromDest
+	j.MovedFromDest = kc.MovedFromDest
+	rs.keepAll = true
+	if err := rs.writeJournal(); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+func checkpointName(completedSteps int) string {
+	return fmt.Sprintf("%s%d", resumeCheckpointPrefix, completedSteps)
+}
+
+// checkpointDir returns the directory containing the scratch directory as of
+// the last completed step.
+func (rs *resumeState) checkpointDir() string {
+	return filepath.Join(rs.dir, rs.journal.Checkpoint)
+}
+
+func (rs *resumeState) templateDir() string {
+	return filepath.Join(rs.dir, resumeTemplateDir)
+}
+
+// start writes the initial journal, before any steps have run.
+func (rs *resumeState) start(p *Params, dlMeta *templatesource.DownloadMetadata, inputs, vars map[string]string) error {
+	rs.journal = resumeJournal{
+		Source:           p.SourceForMessages,
+		DownloadMetadata: dlMeta,
+		Inputs:           inputs,
+		Vars:             vars,
+	}
+	return rs.writeJournal()
+}
+
+// restore copies the last checkpoint, if any, into the scratch directory.
+func (rs *resumeState) restore(ctx context.Context, scratchDir string) error {
+	if rs.journal.Checkpoint == "" {
+		return nil
+	}
+	if _, err := common.CopyRecursive(ctx, nil, &common.CopyParams{
+		FS:               rs.fs,
+		PreserveMetadata: true,
+		SrcRoot:          filepath.Join(rs.dir, rs.journal.Checkpoint),
+		DstRoot:          scratchDir,
+	}); err != nil {
+		return fmt.Errorf("failed restoring checkpoint into scratch directory: %w", err)
+	}
+	return nil
+}
+
+// checkpoint records that the first completedSteps steps are done, and that
+// scratchDir contains their output. A new checkpoint directory is written
+// before the journal points to it, and the old one is only removed afterward,
+// so an interruption at any point leaves a consistent journal and checkpoint.
+func (rs *resumeState) checkpoint(ctx context.Context, scratchDir string, completedSteps int, includedFromDest, movedFromDest map[string]string) error {
+	name := checkpointName(completedSteps)
+	dir := filepath.Join(rs.dir, name)
+	if err := rs.fs.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed removing checkpoint directory: %w", err)
+	}
+	if err := rs.fs.MkdirAll(dir, common.OwnerRWXPerms); err != nil {
+		return fmt.Errorf("failed creating checkpoint directory: %w", err)
+	}
+	// The step is already done, so its checkpoint is finished even if the
+	// render is being canceled; the cancellation takes effect before the next
+	// step.
+	if _, err := common.CopyRecursive(context.WithoutCancel(ctx), nil, &common.CopyParams{
+		FS:               rs.fs,
+		PreserveMetadata: true,
+		SrcRoot:          scratchDir,
+		DstRoot:          dir,
+	}); err != nil {
+		return fmt.Errorf("failed checkpointing scratch directory: %w", err)
+	}
+
+	old := rs.journal.Checkpoint
+	rs.journal.Checkpoint = name
+	rs.journal.CompletedSteps = completedSteps
+	rs.journal.IncludedFromDest = includedFromDest
+	rs.journal.MovedFromDest = movedFromDest
+	if rs.keepAll {
+		if rs.journal.KeptCheckpoints == nil {
+			rs.journal.KeptCheckpoints = make(map[int]*keptCheckpoint)
+		}
+		rs.journal.KeptCheckpoints[completedSteps] = &keptCheckpoint{
+			IncludedFromDest: maps.Clone(includedFromDest),
+			MovedFromDest:    maps.Clone(movedFromDest),
+		}
+	}
+	if err := rs.writeJournal(); err != nil {
+		return err
+	}
+
+	if old != "" && old != name && !rs.keepAll {
+		if err := rs.fs.RemoveAll(filepath.Join(rs.dir, old)); err != nil {
+			return fmt.Errorf("failed removing old checkpoint directory: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeJournal writes the journal to a temp file and renames it into place,
+// so the journal file is never partially written.
+func (rs *resumeState) writeJournal() error {
+	buf, err := yaml.Marshal(&rs.journal)
+	if err != nil {
+		return fmt.Errorf("failed marshaling resume journal: %w", err)
+	}
+	journalPath := filepath.Join(rs.dir, resumeJournalFileName)
+	tempPath := journalPath + ".tmp"
+	if err := rs.fs.WriteFile(tempPath, buf, common.OwnerRWPerms); err != nil {
+		return fmt.Errorf("failed writing resume journal: %w", err)
+	}
+	if err := rs.fs.Rename(tempPath, journalPath); err != nil {
+		return fmt.Errorf("failed writing resume journal: %w", err)
+	}
+	rs.journaled = true
+	return nil
+}
+
+// finish is called when the render is over. If the render was interrupted, the
+// resume directory is kept if there's anything to resume, and the user is told
+// how to resume. Otherwise it's deleted; resuming after an ordinary error,
+// like a template bug or an invalid input, would only hit the same error.
+func (rs *resumeState) finish(ctx context.Context, renderErr error) error {
+	if rs.keepAll {
+		logging.FromContext(ctx).InfoContext(ctx, "keeping the checkpoints of each step for --start-from-step",
+			"path", rs.dir)
+		return nil
+	}
+	interrupted := errors.Is(renderErr, context.Canceled) || ctx.Err() != nil
+	if interrupted && rs.journaled {
+		logging.FromContext(ctx).WarnContext(ctx,
+			"the render was interrupted; fix the problem if needed, then re-run the same command with --resume to pick up after the last completed step",
+			"completed_steps", rs.journal.CompletedSteps)
+		return nil
+	}
+	if err := rs.fs.RemoveAll(rs.dir); err != nil {
+		return fmt.Errorf("failed removing resume directory %q: %w", rs.dir, err)
+	}
+	return nil
+}
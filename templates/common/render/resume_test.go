@@ -0,0 +1,348 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestRender_Resume(t *testing.T) {
+	t.Parallel()
+
+	specContents := `api_version: 'cli.abcxyz.dev/v1beta6'
+kind: 'Template'
+desc: 'A template for testing resume'
+inputs:
+  - name: 'name'
+    desc: 'A name'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['file.txt']
+  - desc: 'Append'
+    action: 'append'
+    params:
+      paths: ['file.txt']
+      with: 'appended once'
+  - desc: 'Print'
+    action: 'print'
+    params:
+      message: 'printing'
+  - desc: 'Replace'
+    action: 'string_replace'
+    params:
+      paths: ['file.txt']
+      replacements:
+        - to_replace: 'NAME'
+          with: '{{.name}}'
+`
+
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	outDir := filepath.Join(tempDir, "out")
+	abctestutil.WriteAll(t, sourceDir, map[string]string{
+		"spec.yaml": specContents,
+		"file.txt":  "hello NAME\n",
+	})
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	newParams := func() *Params {
+		return &Params{
+			Clock:             clock.NewMock(),
+			FS:                &common.RealFS{},
+			InputsFromFlags:   map[string]string{"name": "Alice"},
+			OutDir:            outDir,
+			Resumable:         true,
+			SkipManifest:      true,
+			SourceForMessages: sourceDir,
+			TempDirBase:       tempDir,
+		}
+	}
+
+	// The first render is interrupted by canceling its context while the print
+	// step runs, as if the user hit Ctrl-C.
+	cancelCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	p := newParams()
+	p.Downloader = &templatesource.LocalDownloader{SrcPath: sourceDir}
+	p.Stdout = &cancelingWriter{cancel: cancel}
+	if _, err := Render(cancelCtx, p); err == nil || !strings.Contains(err.Error(), "render canceled before step index 3") {
+		t.Fatalf("got error %v, wanted a cancellation error", err)
+	}
+	if got := abctestutil.LoadDir(t, outDir); len(got) > 0 {
+		t.Errorf("the interrupted render shouldn't have written any output, but got %v", got)
+	}
+
+	// The resumed render must neither download the template again nor rerun
+	// the steps that already completed.
+	p = newParams()
+	p.Resume = true
+	p.Downloader = &failingDownloader{}
+	p.InputsFromFlags = nil // the inputs come from the journal
+	stdout := &strings.Builder{}
+	p.Stdout = stdout
+	if _, err := Render(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+
+	got := abctestutil.LoadDir(t, outDir)
+	want := map[string]string{
+		"file.txt": "hello Alice\nappended once\n",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("dest contents were not as expected (-got,+want): %s", diff)
+	}
+	if stdout.Len() > 0 {
+		t.Errorf("the print step shouldn't have run again, but got output %q", stdout.String())
+	}
+
+	leftovers, err := filepath.Glob(filepath.Join(tempDir, tempdir.ResumeDirNamePart+"*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leftovers) > 0 {
+		t.Errorf("resume directory wasn't removed after success: %v", leftovers)
+	}
+
+	// There's nothing left to resume.
+	p = newParams()
+	p.Resume = true
+	_, err = Render(ctx, p)
+	if diff := testutil.DiffErrString(err, "there's no interrupted render"); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestRender_ResumableError(t *testing.T) {
+	t.Parallel()
+
+	// The second step fails with an ordinary error rather than an interruption,
+	// so there's nothing worth resuming.
+	specContents := `api_version: 'cli.abcxyz.dev/v1beta6'
+kind: 'Template'
+desc: 'A template with a bug'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['file.txt']
+  - desc: 'Replace'
+    action: 'string_replace'
+    params:
+      paths: ['file.txt']
+      replacements:
+        - to_replace: 'NAME'
+          with: '{{.nonexistent_input}}'
+`
+
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	abctestutil.WriteAll(t, sourceDir, map[string]string{
+		"spec.yaml": specContents,
+		"file.txt":  "hello NAME\n",
+	})
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	p := &Params{
+		Clock:             clock.NewMock(),
+		Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+		FS:                &common.RealFS{},
+		OutDir:            filepath.Join(tempDir, "out"),
+		Resumable:         true,
+		SkipManifest:      true,
+		SourceForMessages: sourceDir,
+		Stdout:            &strings.Builder{},
+		TempDirBase:       tempDir,
+	}
+	_, err := Render(ctx, p)
+	if diff := testutil.DiffErrString(err, "nonexistent_input"); diff != "" {
+		t.Fatal(diff)
+	}
+
+	leftovers, err := filepath.Glob(filepath.Join(tempDir, tempdir.ResumeDirNamePart+"*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leftovers) > 0 {
+		t.Errorf("resume directory wasn't removed after a non-interruption error: %v", leftovers)
+	}
+}
+
+func TestLoadResumeState_SourceMismatch(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	p := &Params{
+		FS:                &common.RealFS{},
+		OutDir:            filepath.Join(tempDir, "out"),
+		SourceForMessages: "github.com/foo/bar@v1",
+		TempDirBase:       tempDir,
+	}
+	abctestutil.WriteAll(t, resumeDirPath(p), map[string]string{
+		resumeJournalFileName: "source: 'github.com/foo/other@v1'\ndownload_metadata: {}\n",
+	})
+
+	_, err := loadResumeState(p)
+	if diff := testutil.DiffErrString(err, `was of template "github.com/foo/other@v1", not "github.com/foo/bar@v1"`); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestRender_StepRange(t *testing.T) {
+	t.Parallel()
+
+	specContents := func(suffix string) string {
+		return `api_version: 'cli.abcxyz.dev/v1beta6'
+kind: 'Template'
+desc: 'A template for testing step ranges'
+inputs:
+  - name: 'name'
+    desc: 'A name'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['file.txt']
+  - desc: 'Append'
+    action: 'append'
+    params:
+      paths: ['file.txt']
+      with: 'appended once'
+  - desc: 'Replace'
+    action: 'string_replace'
+    params:
+      paths: ['file.txt']
+      replacements:
+        - to_replace: 'NAME'
+          with: '{{.name}}` + suffix + `'
+`
+	}
+
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	outDir := filepath.Join(tempDir, "out")
+	abctestutil.WriteAll(t, sourceDir, map[string]string{
+		"spec.yaml": specContents(""),
+		"file.txt":  "hello NAME\n",
+	})
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	newParams := func() *Params {
+		return &Params{
+			Clock:             clock.NewMock(),
+			Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+			FS:                &common.RealFS{},
+			InputsFromFlags:   map[string]string{"name": "Alice"},
+			OutDir:            outDir,
+			SkipManifest:      true,
+			SourceForMessages: sourceDir,
+			TempDirBase:       tempDir,
+		}
+	}
+
+	// Nothing to start from yet.
+	p := newParams()
+	p.StartFromStep = 1
+	_, err := Render(ctx, p)
+	if diff := testutil.DiffErrString(err, "run first with --stop-after-step=0"); diff != "" {
+		t.Error(diff)
+	}
+
+	stop := 1
+	p = newParams()
+	p.StopAfterStep = &stop
+	result, err := Render(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.StoppedAfterStep {
+		t.Errorf("got StoppedAfterStep=false, wanted true")
+	}
+	if got := abctestutil.LoadDir(t, outDir); len(got) > 0 {
+		t.Errorf("a render with StopAfterStep shouldn't have written any output, but got %v", got)
+	}
+	gotScratch := abctestutil.LoadDir(t, result.ScratchDir)
+	wantScratch := map[string]string{"file.txt": "hello NAME\nappended once\n"}
+	if diff := cmp.Diff(gotScratch, wantScratch); diff != "" {
+		t.Errorf("scratch contents were not as expected (-got,+want): %s", diff)
+	}
+
+	// An edit to the template takes effect when starting from a step.
+	abctestutil.WriteAll(t, sourceDir, map[string]string{"spec.yaml": specContents("!")})
+	p = newParams()
+	p.StartFromStep = 2
+	p.InputsFromFlags = nil // the inputs come from the journal
+	if _, err := Render(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	got := abctestutil.LoadDir(t, outDir)
+	want := map[string]string{"file.txt": "hello Alice!\nappended once\n"}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("dest contents were not as expected (-got,+want): %s", diff)
+	}
+
+	// The checkpoints from the first render are still there, so it's possible
+	// to start from an earlier step.
+	abctestutil.WriteAll(t, sourceDir, map[string]string{"spec.yaml": specContents("?")})
+	p = newParams()
+	p.StartFromStep = 1
+	p.ForceOverwrite = true
+	if _, err := Render(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	got = abctestutil.LoadDir(t, outDir)
+	want = map[string]string{"file.txt": "hello Alice?\nappended once\n"}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("dest contents were not as expected (-got,+want): %s", diff)
+	}
+
+	p = newParams()
+	p.StartFromStep = 3
+	_, err = Render(ctx, p)
+	if diff := testutil.DiffErrString(err, "--start-from-step=3 is out of range, the template has 3 steps"); diff != "" {
+		t.Error(diff)
+	}
+}
+
+// cancelingWriter cancels a context when it's written to.
+type cancelingWriter struct {
+	cancel context.CancelFunc
+}
+
+func (c *cancelingWriter) Write(b []byte) (int, error) {
+	c.cancel()
+	return len(b), nil
+}
+
+type failingDownloader struct{}
+
+func (f *failingDownloader) Download(context.Context, string, string, string) (*templatesource.DownloadMetadata, error) {
+	return nil, fmt.Errorf("the template shouldn't be downloaded again")
+}
@@ -0,0 +1,212 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/secrets"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+type fakeSecretResolver map[string]string
+
+func (f fakeSecretResolver) Resolve(ctx context.Context, path string) (string, error) {
+	val, ok := f[path]
+	if !ok {
+		return "", fmt.Errorf("no secret %q", path)
+	}
+	return val, nil
+}
+
+func TestRender_SecretInputs(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	abctestutil.WriteAll(t, sourceDir, map[string]string{
+		"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta6'
+kind: 'Template'
+desc: 'A template'
+inputs:
+  - name: 'api_key'
+    desc: 'the API key'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+  - desc: 'Replace'
+    action: 'string_replace'
+    params:
+      paths: ['a.txt']
+      replacements:
+        - to_replace: 'KEY'
+          with: '{{.api_key}}'
+`,
+		"a.txt": "key=KEY\n",
+	})
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	outDir := filepath.Join(tempDir, "out")
+	if _, err := Render(ctx, &Params{
+		Clock:             clock.NewMock(),
+		Cwd:               tempDir,
+		Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+		FS:                &common.RealFS{},
+		InputsFromFlags:   map[string]string{"api_key": "secret://fake/api-key"},
+		OutDir:            outDir,
+		ReportPath:        "report.html",
+		SecretResolvers:   map[string]secrets.SecretResolver{"fake": fakeSecretResolver{"api-key": "hunter2"}},
+		SourceForMessages: sourceDir,
+		Stdout:            io.Discard,
+		TempDirBase:       tempDir,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(outDir, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(got), "key=hunter2\n"); diff != "" {
+		t.Errorf("rendered output was not as expected (-got,+want): %s", diff)
+	}
+
+	manifests, err := filepath.Glob(filepath.Join(outDir, common.ABCInternalDir, "manifest*.yaml"))
+	if err != nil || len(manifests) != 1 {
+		t.Fatalf("got manifests %v (err %v), want exactly one", manifests, err)
+	}
+	for _, path := range []string{manifests[0], filepath.Join(tempDir, "report.html")} {
+		buf, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(buf), "hunter2") {
+			t.Errorf("%s contains the secret value:\n%s", path, buf)
+		}
+		if !strings.Contains(string(buf), "secret://fake/api-key") {
+			t.Errorf("%s doesn't contain the secret reference:\n%s", path, buf)
+		}
+	}
+}
+
+func TestRender_SecretInputsInOutputs(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		value   string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name:  "output_without_secret",
+			value: `"https://" + region + ".example.com"`,
+			want:  map[string]string{"url": "https://us-east1.example.com"},
+		},
+		{
+			name:    "output_uses_secret",
+			value:   `"https://" + region + ".example.com/?key=" + api_key`,
+			wantErr: `output "url" can't use the input "api_key", because that input is a secret`,
+		},
+		{
+			name:    "output_derived_from_secret",
+			value:   `api_key.size() > 3 ? "long" : "short"`,
+			wantErr: `output "url" can't use the input "api_key", because that input is a secret`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			sourceDir := filepath.Join(tempDir, "source")
+			abctestutil.WriteAll(t, sourceDir, map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'A template'
+inputs:
+  - name: 'api_key'
+    desc: 'the API key'
+  - name: 'region'
+    desc: 'the region'
+outputs:
+  - name: 'url'
+    value: '` + tc.value + `'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+`,
+				"a.txt": "a\n",
+			})
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			outDir := filepath.Join(tempDir, "out")
+			result, err := Render(ctx, &Params{
+				Clock:      clock.NewMock(),
+				Cwd:        tempDir,
+				Downloader: &templatesource.LocalDownloader{SrcPath: sourceDir},
+				FS:         &common.RealFS{},
+				InputsFromFlags: map[string]string{
+					"api_key": "secret://fake/api-key",
+					"region":  "us-east1",
+				},
+				OutDir:            outDir,
+				SecretResolvers:   map[string]secrets.SecretResolver{"fake": fakeSecretResolver{"api-key": "hunter2"}},
+				SourceForMessages: sourceDir,
+				Stdout:            io.Discard,
+				TempDirBase:       tempDir,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				if _, statErr := os.Stat(outDir); statErr == nil {
+					t.Errorf("output directory %s was created, but rendering failed", outDir)
+				}
+				return
+			}
+
+			if diff := cmp.Diff(result.Outputs, tc.want); diff != "" {
+				t.Errorf("result outputs were not as expected (-got,+want): %s", diff)
+			}
+			buf, err := os.ReadFile(filepath.Join(outDir, result.ManifestPath))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(buf), "hunter2") {
+				t.Errorf("manifest contains the secret value:\n%s", buf)
+			}
+		})
+	}
+}
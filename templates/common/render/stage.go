@@ -0,0 +1,272 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+// This file implements the atomic commit of rendered output into the
+// destination directory. The output is first copied into a staging directory
+// inside the destination's .abc directory, which is on the same filesystem as
+// the destination. Then a journal listing the staged files is written, and
+// finally each file is moved into place with a rename.
+//
+// If the process dies before the journal is written, nothing in the
+// destination has changed, and the staging directory is simply deleted the next
+// time. If it dies after the journal is written, the next render or upgrade of
+// the same destination finishes moving the remaining files into place, as soon
+// as it takes the destination lock and before any step reads the destination.
+// Either way, the destination never stays half-rendered.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/pkg/logging"
+)
+
+const (
+	// stagingFilesDir is the subdirectory of the staging directory containing
+	// the files to be moved into the destination, laid out the same way as in
+	// the destination.
+	stagingFilesDir = "files"
+
+	// journalFileName is the name of the journal file in the staging
+	// directory. Its existence means that staging completed and the files are
+	// ready to be moved into place.
+	journalFileName = "journal.yaml"
+)
+
+// stagingJournal is the contents of the journal file.
+type stagingJournal struct {
+	// Files are the paths of the staged files, relative to both the staging
+	// files directory and the destination directory.
+	Files []string `yaml:"files"`
+}
+
+// staging is a staging directory for one commit.
+type staging struct {
+	fs      common.FS
+	dir     string
+	destDir string
+}
+
+func (s *staging) filesDir() string {
+	return filepath.Join(s.dir, stagingFilesDir)
+}
+
+// newStaging creates a new staging directory for committing into destDir.
+func newStaging(rfs common.FS, destDir string) (*staging, error) {
+	abcDir := filepath.Join(destDir, common.ABCInternalDir)
+	if err := rfs.MkdirAll(abcDir, common.OwnerRWXPerms); err != nil {
+		return nil, fmt.Errorf("failed creating template output directory: %w", err)
+	}
+	dir, err := rfs.MkdirTemp(abcDir, common.ABCStagingDirPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating staging directory: %w", err)
+	}
+	return &staging{fs: rfs, dir: dir, destDir: destDir}, nil
+}
+
+// writeJournal lists the staged files in the journal. Once this returns
+// successfully, the commit is guaranteed to complete eventually, even if it's
+// interrupted.
+func (s *staging) writeJournal() error {
+	var files []string
+	if err := fs.WalkDir(s.fs, s.filesDir(), func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if de.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.filesDir(), path)
+		if err != nil {
+			return fmt.Errorf("filepath.Rel(%s,%s): %w", s.filesDir(), path, err)
+		}
+		files = append(files, rel)
+		return nil
+	}); err != nil && !common.IsNotExistErr(err) {
+		return fmt.Errorf("failed listing staged files: %w", err)
+	}
+	sort.Strings(files)
+
+	buf, err := yaml.Marshal(&stagingJournal{Files: files})
+	if err != nil {
+		return fmt.Errorf("failed marshaling journal: %w", err)
+	}
+
+	// Write then rename, so that a journal file that exists is always complete.
+	journalPath := filepath.Join(s.dir, journalFileName)
+	tempPath := journalPath + ".tmp"
+	if err := s.fs.WriteFile(tempPath, buf, common.OwnerRWPerms); err != nil {
+		return fmt.Errorf("failed writing journal: %w", err)
+	}
+	if err := s.fs.Rename(tempPath, journalPath); err != nil {
+		return fmt.Errorf("failed writing journal: %w", err)
+	}
+	return nil
+}
+
+// apply moves each staged file listed in the journal into the destination,
+// then removes the staging directory. It's idempotent: files that were already
+// moved by an earlier interrupted attempt are skipped.
+func (s *staging) apply(ctx context.Context) error {
+	logger := logging.FromContext(ctx).With("logger", "staging.apply")
+
+	buf, err := s.fs.ReadFile(filepath.Join(s.dir, journalFileName))
+	if err != nil {
+		return fmt.Errorf("failed reading journal: %w", err)
+	}
+	var journal stagingJournal
+	if err := yaml.Unmarshal(buf, &journal); err != nil {
+		return fmt.Errorf("failed parsing journal %q: %w", filepath.Join(s.dir, journalFileName), err)
+	}
+
+	for _, rel := range journal.Files {
+		src := filepath.Join(s.filesDir(), rel)
+		dst := filepath.Join(s.destDir, rel)
+
+		if _, err := s.fs.Stat(src); err != nil {
+			if common.IsNotExistErr(err) {
+				continue // already moved into place
+			}
+			return fmt.Errorf("Stat(): %w", err)
+		}
+		if err := s.fs.MkdirAll(filepath.Dir(dst), common.OwnerRWXPerms); err != nil {
+			return fmt.Errorf("failed creating directory for %q: %w", rel, err)
+		}
+		if err := s.fs.Rename(src, dst); err != nil {
+			return fmt.Errorf("failed moving %q into place: %w", rel, err)
+		}
+		logger.DebugContext(ctx, "moved staged file into place", "path", rel)
+	}
+
+	return s.remove()
+}
+
+// remove deletes the staging directory, and also the .abc directory if that
+// leaves it empty (which happens when no manifest is being written).
+func (s *staging) remove() error {
+	if err := s.fs.RemoveAll(s.dir); err != nil {
+		return fmt.Errorf("failed removing staging directory: %w", err)
+	}
+	abcDir := filepath.Dir(s.dir)
+	entries, err := fs.ReadDir(s.fs, abcDir)
+	if err != nil {
+		return fmt.Errorf("ReadDir(%s): %w", abcDir, err)
+	}
+	if len(entries) == 0 {
+		if err := s.fs.Remove(abcDir); err != nil {
+			return fmt.Errorf("Remove(%s): %w", abcDir, err)
+		}
+	}
+	return nil
+}
+
+// FinishInterruptedCommits looks for staging directories left behind in
+// destDir by earlier renders that were interrupted. Staging directories with a
+// journal are applied, completing the interrupted commit. Those without a
+// journal never touched the destination and are deleted.
+//
+// The caller must hold the lock on destDir (see the destlock package), so that
+// another render can't be staging into it at the same time.
+func FinishInterruptedCommits(ctx context.Context, rfs common.FS, destDir string) error {
+	logger := logging.FromContext(ctx).With("logger", "FinishInterruptedCommits")
+
+	abcDir := filepath.Join(destDir, common.ABCInternalDir)
+	entries, err := fs.ReadDir(rfs, abcDir)
+	if err != nil {
+		if common.IsNotExistErr(err) {
+			return nil
+		}
+		return fmt.Errorf("ReadDir(%s): %w", abcDir, err)
+	}
+
+	var merr error
+	for _, e := range entries {
+		if !e.IsDir() || !strings.HasPrefix(e.Name(), common.ABCStagingDirPrefix) {
+			continue
+		}
+		s := &staging{fs: rfs, dir: filepath.Join(abcDir, e.Name()), destDir: destDir}
+
+		_, err := rfs.Stat(filepath.Join(s.dir, journalFileName))
+		switch {
+		case err == nil:
+			logger.WarnContext(ctx, "finishing an earlier render into this directory that was interrupted",
+				"staging_dir", s.dir)
+			if err := s.apply(ctx); err != nil {
+				merr = errors.Join(merr, fmt.Errorf("failed finishing interrupted render from %q: %w", s.dir, err))
+			}
+		case common.IsNotExistErr(err):
+			logger.DebugContext(ctx, "removing incomplete staging directory from an interrupted render",
+				"staging_dir", s.dir)
+			if err := s.remove(); err != nil {
+				merr = errors.Join(merr, err)
+			}
+		default:
+			merr = errors.Join(merr, fmt.Errorf("Stat(): %w", err))
+		}
+	}
+	return merr
+}
+
+// backUpOverwritten backs up every file in the destination that's about to be
+// replaced by a staged file. It returns the backup directory, or "" if there
+// was nothing to back up.
+func backUpOverwritten(ctx context.Context, s *staging, backupDirMaker func(common.FS) (string, error)) (string, error) {
+	var backupDir string
+	err := fs.WalkDir(s.fs, s.filesDir(), func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			if common.IsNotExistErr(err) && path == s.filesDir() {
+				return nil // nothing staged
+			}
+			return err
+		}
+		if de.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.filesDir(), path)
+		if err != nil {
+			return fmt.Errorf("filepath.Rel(%s,%s): %w", s.filesDir(), path, err)
+		}
+		dst := filepath.Join(s.destDir, rel)
+		if _, err := s.fs.Stat(dst); err != nil {
+			if common.IsNotExistErr(err) {
+				return nil
+			}
+			return fmt.Errorf("Stat(): %w", err)
+		}
+
+		backupDir, err = backupDirMaker(s.fs)
+		if err != nil {
+			return fmt.Errorf("failed making backup directory: %w", err)
+		}
+		backupFile := filepath.Join(backupDir, rel)
+		if err := common.CopyFile(ctx, nil, s.fs, dst, backupFile, false, nil); err != nil {
+			return fmt.Errorf("failed backing up file %q at %q before overwriting: %w", dst, backupFile, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+	return backupDir, nil
+}
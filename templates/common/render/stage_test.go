@@ -0,0 +1,179 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+)
+
+func TestFinishInterruptedCommits(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name            string
+		initialContents map[string]string
+		want            map[string]string
+	}{
+		{
+			name: "no_abc_dir",
+			initialContents: map[string]string{
+				"a.txt": "a",
+			},
+			want: map[string]string{
+				"a.txt": "a",
+			},
+		},
+		{
+			name: "journaled_staging_dir_is_applied",
+			initialContents: map[string]string{
+				"a.txt":                                "old a",
+				".abc/staging-1/files/a.txt":           "new a",
+				".abc/staging-1/files/dir/b.txt":       "new b",
+				".abc/staging-1/files/.abc/manifest.x": "manifest",
+				".abc/staging-1/journal.yaml":          "files:\n  - .abc/manifest.x\n  - a.txt\n  - dir/b.txt\n",
+			},
+			want: map[string]string{
+				"a.txt":           "new a",
+				"dir/b.txt":       "new b",
+				".abc/manifest.x": "manifest",
+			},
+		},
+		{
+			name: "partially_applied_staging_dir_is_finished",
+			initialContents: map[string]string{
+				// a.txt was already moved into place before the interruption.
+				"a.txt":                          "new a",
+				".abc/staging-1/files/dir/b.txt": "new b",
+				".abc/staging-1/journal.yaml":    "files:\n  - a.txt\n  - dir/b.txt\n",
+			},
+			want: map[string]string{
+				"a.txt":     "new a",
+				"dir/b.txt": "new b",
+			},
+		},
+		{
+			name: "unjournaled_staging_dir_is_removed",
+			initialContents: map[string]string{
+				"a.txt":                      "old a",
+				".abc/staging-1/files/a.txt": "new a",
+			},
+			want: map[string]string{
+				"a.txt": "old a",
+			},
+		},
+		{
+			name: "other_abc_files_are_kept",
+			initialContents: map[string]string{
+				".abc/manifest.yaml":         "manifest",
+				".abc/staging-1/files/a.txt": "new a",
+			},
+			want: map[string]string{
+				".abc/manifest.yaml": "manifest",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			destDir := t.TempDir()
+			abctestutil.WriteAll(t, destDir, tc.initialContents)
+
+			if err := FinishInterruptedCommits(context.Background(), &common.RealFS{}, destDir); err != nil {
+				t.Fatal(err)
+			}
+
+			got := abctestutil.LoadDir(t, destDir)
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("dest contents were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestStaging(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rfs := &common.RealFS{}
+	destDir := t.TempDir()
+	abctestutil.WriteAll(t, destDir, map[string]string{
+		"a.txt":     "old a",
+		"other.txt": "untouched",
+	})
+
+	s, err := newStaging(rfs, destDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	abctestutil.WriteAll(t, s.filesDir(), map[string]string{
+		"a.txt":     "new a",
+		"dir/b.txt": "new b",
+	})
+
+	backupDir := t.TempDir()
+	gotBackupDir, err := backUpOverwritten(ctx, s, func(common.FS) (string, error) { return backupDir, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotBackupDir != backupDir {
+		t.Errorf("got backup dir %q, want %q", gotBackupDir, backupDir)
+	}
+	if err := s.writeJournal(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing in the destination changes until the journal is applied.
+	got := abctestutil.LoadDir(t, destDir, abctestutil.SkipGlob(".abc/*"))
+	want := map[string]string{
+		"a.txt":     "old a",
+		"other.txt": "untouched",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("dest contents before apply were not as expected (-got,+want): %s", diff)
+	}
+
+	if err := s.apply(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	got = abctestutil.LoadDir(t, destDir)
+	want = map[string]string{
+		"a.txt":     "new a",
+		"dir/b.txt": "new b",
+		"other.txt": "untouched",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("dest contents after apply were not as expected (-got,+want): %s", diff)
+	}
+	if ok, err := common.Exists(filepath.Join(destDir, common.ABCInternalDir)); err != nil || ok {
+		t.Errorf("the empty .abc directory should have been removed (exists=%t, err=%v)", ok, err)
+	}
+
+	gotBackups := abctestutil.LoadDir(t, backupDir)
+	wantBackups := map[string]string{"a.txt": "old a"}
+	if diff := cmp.Diff(gotBackups, wantBackups); diff != "" {
+		t.Errorf("backups were not as expected (-got,+want): %s", diff)
+	}
+}
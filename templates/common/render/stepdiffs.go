@@ -0,0 +1,192 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/run"
+	"github.com/abcxyz/abc/templates/common/stepdiff"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// reportFileName is the name of the HTML file written to --debug-report.
+const reportFileName = "index.html"
+
+// stepDiffs records the changes that each step makes to the scratch
+// directory, for --debug-step-diffs and --debug-report.
+type stepDiffs struct {
+	// gitDir, if set, is a git directory with its work tree in the scratch
+	// directory, which gets a commit after each step.
+	gitDir string
+
+	// recorder, if set, records the diffs in memory. It's used when git isn't
+	// installed, and for --debug-report.
+	recorder *stepdiff.Recorder
+
+	// patchDir, if set, is where the recorder's diffs are written as patch
+	// files, when --debug-step-diffs is used without git.
+	patchDir string
+
+	// reportDir, if set, is where the recorder's diffs are written as an HTML
+	// report.
+	reportDir string
+}
+
+// initStepDiffs sets up the recording of per-step diffs. If neither
+// --debug-step-diffs nor --debug-report is given, it returns nil. hasGit says
+// whether the git binary is available; if it isn't, --debug-step-diffs falls
+// back to writing patch files.
+func initStepDiffs(ctx context.Context, p *Params, scratchDir string, hasGit bool) (*stepDiffs, error) {
+	if !p.DebugStepDiffs && p.DebugReportDir == "" {
+		return nil, nil //nolint:nilnil
+	}
+
+	out := &stepDiffs{reportDir: p.DebugReportDir}
+	if out.reportDir != "" && !filepath.IsAbs(out.reportDir) {
+		out.reportDir = filepath.Join(p.Cwd, out.reportDir)
+	}
+	if p.DebugStepDiffs {
+		dir, err := p.FS.MkdirTemp(p.TempDirBase, tempdir.DebugStepDiffsDirNamePart)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temp directory for debug directory: %w", err)
+		}
+		if hasGit {
+			if err := initDebugGitDir(ctx, dir, scratchDir); err != nil {
+				return nil, err
+			}
+			out.gitDir = dir
+		} else {
+			out.patchDir = dir
+		}
+	}
+	if out.patchDir != "" || out.reportDir != "" {
+		rec, err := stepdiff.NewRecorder(p.FS, scratchDir)
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+		out.recorder = rec
+	}
+	return out, nil
+}
+
+// gitInstalled returns whether the git binary is on the PATH.
+func gitInstalled() bool {
+	_, err := exec.LookPath("git")
+	return err == nil
+}
+
+// initDebugGitDir makes gitDir a git repository with a detached work tree in
+// scratchDir, meaning it will track the file changes in scratchDir without
+// affecting it.
+func initDebugGitDir(ctx context.Context, gitDir, scratchDir string) error {
+	cmds := [][]string{
+		{"git", "--git-dir", gitDir, "--work-tree", scratchDir, "init"},
+
+		// Set git user name and email, required for ubuntu.
+		{"git", "--git-dir", gitDir, "config", "user.name", "abc CLI"},
+		{"git", "--git-dir", gitDir, "config", "user.email", "abc@abcxyz.com"},
+	}
+
+	if _, _, err := run.Many(ctx, cmds...); err != nil {
+		return fmt.Errorf("failed initializing git repo for --debug-step-diffs: %w", err)
+	}
+	return nil
+}
+
+// dirs returns the directories that the recording writes to, so they can be
+// allowed by the jailed filesystem.
+func (s *stepDiffs) dirs() []string {
+	if s == nil {
+		return nil
+	}
+	return []string{s.gitDir, s.patchDir, s.reportDir}
+}
+
+// record records the diffs made by the given step.
+func (s *stepDiffs) record(ctx context.Context, step *spec.Step) error {
+	if s == nil {
+		return nil
+	}
+	m := fmt.Sprintf("action %s at line %d", step.Action.Val, step.Pos.Line)
+	if s.gitDir != "" {
+		cmds := [][]string{
+			{"git", "--git-dir", s.gitDir, "add", "-A"},
+			{"git", "--git-dir", s.gitDir, "commit", "-a", "-m", m, "--allow-empty", "--no-gpg-sign"},
+		}
+		if _, _, err := run.Many(ctx, cmds...); err != nil {
+			return fmt.Errorf("failed committing to git for --debug-step-diffs: %w", err)
+		}
+	}
+	if s.recorder != nil {
+		if err := s.recorder.Record(m); err != nil {
+			return fmt.Errorf("failed recording diffs for --debug-step-diffs: %w", err)
+		}
+	}
+	return nil
+}
+
+// finish writes out the recorded diffs and tells the user where to find them.
+// It's called whether or not the steps succeeded, since the diffs are most
+// useful for debugging a failing spec.
+func (s *stepDiffs) finish(ctx context.Context, fs common.FS, source string) error {
+	if s == nil {
+		return nil
+	}
+	logger := logging.FromContext(ctx).With("logger", "stepDiffs.finish")
+
+	// These messages use the warning level so they're shown at the default
+	// log level.
+	switch {
+	case s.gitDir != "":
+		logger.WarnContext(ctx, fmt.Sprintf(
+			"Please navigate to '%s' or use 'git --git-dir=%s log' to see commits/diffs for each step",
+			s.gitDir, s.gitDir))
+	case s.patchDir != "":
+		if err := s.recorder.WritePatches(s.patchDir); err != nil {
+			return err //nolint:wrapcheck
+		}
+		logger.WarnContext(ctx, fmt.Sprintf(
+			"git isn't installed, so the diffs for each step were written as patch files in '%s'",
+			s.patchDir))
+	}
+
+	if s.reportDir != "" {
+		if err := fs.MkdirAll(s.reportDir, common.OwnerRWXPerms); err != nil {
+			return fmt.Errorf("failed creating directory %q: %w", s.reportDir, err)
+		}
+		path := filepath.Join(s.reportDir, reportFileName)
+		f, err := fs.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, common.OwnerRWPerms)
+		if err != nil {
+			return fmt.Errorf("failed creating %q: %w", path, err)
+		}
+		defer f.Close()
+		if err := s.recorder.WriteHTML(f, "Step diffs for "+source); err != nil {
+			return err //nolint:wrapcheck
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("failed closing %q: %w", path, err)
+		}
+		logger.WarnContext(ctx, fmt.Sprintf("The report of the diffs for each step is at '%s'", path))
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/abc/templates/model"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	mdl "github.com/abcxyz/abc/templates/testutil/model"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestRender_DebugReport(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name         string
+		replaceWith  string
+		wantContains []string
+		wantErr      string
+	}{
+		{
+			name:        "success",
+			replaceWith: "world",
+			wantContains: []string{
+				`<a href="#step-1">action include at line 5</a> (1 files changed)`,
+				`<a href="#step-2">action string_replace at line 9</a> (1 files changed)`,
+				`<span class="add">&#43;hello world</span>`,
+			},
+		},
+		{
+			name:        "report_written_when_a_step_fails",
+			replaceWith: "{{.nonexistent}}",
+			wantContains: []string{
+				`<a href="#step-1">action include at line 5</a> (1 files changed)`,
+			},
+			wantErr: `nonexistent`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			sourceDir := filepath.Join(tempDir, "source")
+			abctestutil.WriteAll(t, sourceDir, map[string]string{
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta6'
+kind: 'Template'
+desc: 'A template'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+  - desc: 'Replace'
+    action: 'string_replace'
+    params:
+      paths: ['a.txt']
+      replacements:
+        - to_replace: 'NAME'
+          with: '` + tc.replaceWith + `'
+`,
+				"a.txt": "hello NAME\n",
+			})
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			_, err := Render(ctx, &Params{
+				Clock:             clock.NewMock(),
+				Cwd:               tempDir,
+				DebugReportDir:    "report",
+				Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+				FS:                &common.RealFS{},
+				OutDir:            filepath.Join(tempDir, "out"),
+				SkipManifest:      true,
+				SourceForMessages: sourceDir,
+				Stdout:            io.Discard,
+				TempDirBase:       tempDir,
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+
+			report, err := os.ReadFile(filepath.Join(tempDir, "report", reportFileName))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tc.wantContains {
+				if !strings.Contains(string(report), want) {
+					t.Errorf("report doesn't contain %q:\n%s", want, report)
+				}
+			}
+		})
+	}
+}
+
+func TestStepDiffs_WithoutGit(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	scratchDir := filepath.Join(tempDir, "scratch")
+	abctestutil.WriteAll(t, scratchDir, map[string]string{"a.txt": "one\n"})
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	sd, err := initStepDiffs(ctx, &Params{
+		DebugStepDiffs: true,
+		FS:             &common.RealFS{},
+		TempDirBase:    tempDir,
+	}, scratchDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sd.gitDir != "" || sd.patchDir == "" {
+		t.Fatalf("got gitDir %q and patchDir %q, want only a patch dir", sd.gitDir, sd.patchDir)
+	}
+
+	abctestutil.WriteAll(t, scratchDir, map[string]string{"a.txt": "two\n"})
+	step := &spec.Step{
+		Pos:    model.ConfigPos{Line: 5},
+		Action: mdl.S("string_replace"),
+	}
+	if err := sd.record(ctx, step); err != nil {
+		t.Fatal(err)
+	}
+	if err := sd.finish(ctx, &common.RealFS{}, "my-template"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"001-action-string-replace-at-line-5.patch": "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-one\n+two\n",
+	}
+	if diff := cmp.Diff(abctestutil.LoadDir(t, sd.patchDir), want); diff != "" {
+		t.Errorf("patch files were not as expected (-got,+want): %s", diff)
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+// This file implements streaming file transformations. Most actions read the
+// whole file into memory, which is fine for source code but not for a
+// multi-gigabyte data file. The actions that can work on a stream (append and
+// string_replace) do so for files larger than a threshold.
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/abcxyz/abc/templates/model"
+	"github.com/abcxyz/pkg/logging"
+)
+
+const (
+	// defaultStreamThreshold is the file size at and above which a file is
+	// processed as a stream rather than being read into memory, for actions
+	// that support streaming.
+	defaultStreamThreshold = 64 << 20 // 64 MiB
+
+	// streamChunkSize is the number of bytes read from the input file at a
+	// time when streaming.
+	streamChunkSize = 1 << 20 // 1 MiB
+)
+
+// A walkAndModifyStreamer is the streaming equivalent of a
+// walkAndModifyVisitor. It reads the old contents of the file from r, writes
+// the new contents of the file to w, and returns whether the contents changed.
+type walkAndModifyStreamer func(r io.Reader, w io.Writer) (changed bool, _ error)
+
+// streamThreshold returns the file size at and above which the streamer is
+// used instead of the in-memory visitor.
+func (s *stepParams) streamThreshold() int64 {
+	if s.streamThresholdBytes > 0 {
+		return s.streamThresholdBytes
+	}
+	return defaultStreamThreshold
+}
+
+// streamFile transforms the file at path using the given streamer. The output
+// is written to a temporary file in the same directory, which then replaces
+// the original file. If the streamer reports that nothing changed, the
+// original file is left untouched.
+func streamFile(ctx context.Context, sp *stepParams, path string, pos *model.ConfigPos, s walkAndModifyStreamer) (rErr error) {
+	logger := logging.FromContext(ctx).With("logger", "streamFile")
+
+	fi, err := sp.rp.FS.Stat(path)
+	if err != nil {
+		return pos.Errorf("Stat(): %w", err)
+	}
+
+	// A temp dir rather than a temp file, because the FS interface has no
+	// CreateTemp. It's in the same directory as the file so that the final
+	// Rename doesn't cross filesystems.
+	tempDir, err := sp.rp.FS.MkdirTemp(filepath.Dir(path), ".abc-stream-")
+	if err != nil {
+		return pos.Errorf("MkdirTemp(): %w", err)
+	}
+	defer func() {
+		if err := sp.rp.FS.RemoveAll(tempDir); err != nil {
+			rErr = errors.Join(rErr, pos.Errorf("RemoveAll(): %w", err))
+		}
+	}()
+	tempPath := filepath.Join(tempDir, filepath.Base(path))
+
+	changed, err := streamToFile(sp, path, tempPath, fi.Mode().Perm(), s)
+	if err != nil {
+		relToScratchDir, relErr := filepath.Rel(sp.scratchDir, path)
+		if relErr != nil {
+			return pos.Errorf("Rel(): %w", relErr)
+		}
+		return fmt.Errorf("when processing template file %q: %w", relToScratchDir, err)
+	}
+	if !changed {
+		return nil
+	}
+
+	if err := sp.rp.FS.Rename(tempPath, path); err != nil {
+		return pos.Errorf("Rename(): %w", err)
+	}
+	logger.DebugContext(ctx, "wrote streamed modification", "path", path)
+	return nil
+}
+
+// streamToFile runs the streamer with src as input and a newly created file
+// at dst as output.
+func streamToFile(sp *stepParams, src, dst string, mode os.FileMode, s walkAndModifyStreamer) (_ bool, rErr error) {
+	in, err := sp.rp.FS.Open(src)
+	if err != nil {
+		return false, fmt.Errorf("Open(): %w", err)
+	}
+	defer func() { rErr = errors.Join(rErr, in.Close()) }()
+
+	out, err := sp.rp.FS.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return false, fmt.Errorf("OpenFile(): %w", err)
+	}
+	defer func() { rErr = errors.Join(rErr, out.Close()) }()
+
+	bw := bufio.NewWriterSize(out, streamChunkSize)
+	changed, err := s(in, bw)
+	if err != nil {
+		return false, err
+	}
+	if err := bw.Flush(); err != nil {
+		return false, fmt.Errorf("Flush(): %w", err)
+	}
+	return changed, nil
+}
+
+// streamReplacer does the same replacements as strings.NewReplacer, but on a
+// stream, using memory proportional to the chunk size rather than the size of
+// the input.
+//
+// Like strings.Replacer, replacements are performed in the order they appear
+// in the input, without overlapping matches, and when more than one old string
+// matches at the same position, the one that comes first in the argument list
+// wins.
+type streamReplacer struct {
+	olds, news [][]byte
+	maxOldLen  int
+	chunkSize  int
+
+	// isFirstByte[b] is true if some old string starts with byte b. This lets
+	// us skip quickly over bytes that can't start a match.
+	isFirstByte [256]bool
+}
+
+// newStreamReplacer returns a streamReplacer for the given old, new string
+// pairs. It returns false if any old string is empty, since the semantics of
+// replacing the empty string (inserting between every byte) aren't worth
+// supporting when streaming; callers should fall back to strings.Replacer.
+func newStreamReplacer(oldnew ...string) (*streamReplacer, bool) {
+	if len(oldnew)%2 == 1 {
+		panic("newStreamReplacer: odd argument count")
+	}
+	sr := &streamReplacer{chunkSize: streamChunkSize}
+	for i := 0; i < len(oldnew); i += 2 {
+		if oldnew[i] == "" {
+			return nil, false
+		}
+		sr.olds = append(sr.olds, []byte(oldnew[i]))
+		sr.news = append(sr.news, []byte(oldnew[i+1]))
+		sr.maxOldLen = max(sr.maxOldLen, len(oldnew[i]))
+		sr.isFirstByte[oldnew[i][0]] = true
+	}
+	return sr, true
+}
+
+// replace copies r to w, doing replacements along the way, and returns whether
+// any replacements were made.
+func (sr *streamReplacer) replace(r io.Reader, w io.Writer) (bool, error) {
+	changed := false
+	// pending holds input bytes that have been read but not yet written. After
+	// each chunk, it holds only the tail that might be the start of a match
+	// that continues into the next chunk.
+	pending := make([]byte, 0, sr.chunkSize+sr.maxOldLen)
+	atEOF := false
+	for !atEOF {
+		n, err := io.ReadFull(r, pending[len(pending):cap(pending)])
+		pending = pending[:len(pending)+n]
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			atEOF = true
+		} else if err != nil {
+			return false, fmt.Errorf("Read(): %w", err)
+		}
+
+		// Scan positions that have enough lookahead to know for sure whether
+		// a match starts there. At EOF, that's all of them.
+		limit := len(pending) - sr.maxOldLen + 1
+		if atEOF {
+			limit = len(pending)
+		}
+
+		unwritten := 0
+		i := 0
+		for i < limit {
+			oldIdx := -1
+			if sr.isFirstByte[pending[i]] {
+				oldIdx = sr.matchAt(pending[i:])
+			}
+			if oldIdx < 0 {
+				i++
+				continue
+			}
+			if _, err := w.Write(pending[unwritten:i]); err != nil {
+				return false, fmt.Errorf("Write(): %w", err)
+			}
+			if _, err := w.Write(sr.news[oldIdx]); err != nil {
+				return false, fmt.Errorf("Write(): %w", err)
+			}
+			changed = true
+			i += len(sr.olds[oldIdx])
+			unwritten = i
+		}
+
+		// A match may have consumed bytes past the limit, so "i" may be past
+		// it. Everything before "i" is final.
+		if _, err := w.Write(pending[unwritten:i]); err != nil {
+			return false, fmt.Errorf("Write(): %w", err)
+		}
+		pending = pending[:copy(pending, pending[i:])]
+	}
+	return changed, nil
+}
+
+// matchAt returns the index of the first old string that is a prefix of b, or
+// -1 if none is.
+func (sr *streamReplacer) matchAt(b []byte) int {
+	for i, old := range sr.olds {
+		if bytes.HasPrefix(b, old) {
+			return i
+		}
+	}
+	return -1
+}
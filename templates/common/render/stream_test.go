@@ -0,0 +1,283 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	mdl "github.com/abcxyz/abc/templates/testutil/model"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestStreamReplacer(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		oldnew []string
+		inputs []string
+	}{
+		{
+			name:   "single_replacement",
+			oldnew: []string{"foo", "bar"},
+			inputs: []string{"", "foo", "abc foo def", "foofoofoo", "fo", "ffoo", "fofoo"},
+		},
+		{
+			name:   "single_byte",
+			oldnew: []string{"a", "xyz"},
+			inputs: []string{"", "a", "aaa", "bab", "banana"},
+		},
+		{
+			name:   "replace_with_empty",
+			oldnew: []string{"ab", ""},
+			inputs: []string{"abab", "aabb", "xaby"},
+		},
+		{
+			name:   "first_argument_wins",
+			oldnew: []string{"a", "1", "ab", "2", "abc", "3"},
+			inputs: []string{"abc", "aabbcc", "cba"},
+		},
+		{
+			name:   "longer_first_argument_wins",
+			oldnew: []string{"abc", "3", "ab", "2", "a", "1"},
+			inputs: []string{"abc", "abab", "aabcab", "ab"},
+		},
+		{
+			name:   "overlapping_matches",
+			oldnew: []string{"aba", "X", "bab", "Y"},
+			inputs: []string{"ababababab", "babababa", "abaaba"},
+		},
+		{
+			name:   "replacement_contains_old",
+			oldnew: []string{"foo", "foofoo"},
+			inputs: []string{"foo foo", "ffoooo"},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			want := strings.NewReplacer(tc.oldnew...)
+			for _, input := range tc.inputs {
+				// Small chunk sizes put matches across chunk boundaries.
+				for chunkSize := 1; chunkSize <= 8; chunkSize++ {
+					sr, ok := newStreamReplacer(tc.oldnew...)
+					if !ok {
+						t.Fatalf("newStreamReplacer(%q) returned false", tc.oldnew)
+					}
+					sr.chunkSize = chunkSize
+
+					var out bytes.Buffer
+					changed, err := sr.replace(strings.NewReader(input), &out)
+					if err != nil {
+						t.Fatal(err)
+					}
+					wantOut := want.Replace(input)
+					if diff := cmp.Diff(out.String(), wantOut); diff != "" {
+						t.Errorf("input %q, chunk size %d: output was not as expected (-got,+want): %s", input, chunkSize, diff)
+					}
+					if wantOut != input && !changed {
+						t.Errorf("input %q, chunk size %d: got changed=false, want true", input, chunkSize)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestNewStreamReplacer_EmptyOld(t *testing.T) {
+	t.Parallel()
+
+	if _, ok := newStreamReplacer("foo", "bar", "", "x"); ok {
+		t.Errorf("newStreamReplacer() returned true for an empty old string, want false")
+	}
+}
+
+func TestWalkAndModifyStreaming(t *testing.T) {
+	t.Parallel()
+
+	visitor := func(buf []byte) ([]byte, error) {
+		return append(buf, []byte(" in-memory")...), nil
+	}
+	streamer := func(r io.Reader, w io.Writer) (bool, error) {
+		if _, err := io.Copy(w, r); err != nil {
+			return false, err //nolint:wrapcheck
+		}
+		if _, err := io.WriteString(w, " streamed"); err != nil {
+			return false, err //nolint:wrapcheck
+		}
+		return true, nil
+	}
+	unchangedStreamer := func(r io.Reader, w io.Writer) (bool, error) {
+		_, err := io.Copy(w, r)
+		return false, err //nolint:wrapcheck
+	}
+
+	cases := []struct {
+		name            string
+		streamer        walkAndModifyStreamer
+		initialContents map[string]abctestutil.ModeAndContents
+		want            map[string]abctestutil.ModeAndContents
+		openErr         error
+		wantErr         string
+	}{
+		{
+			name:     "large_files_are_streamed",
+			streamer: streamer,
+			initialContents: map[string]abctestutil.ModeAndContents{
+				"small.txt":     {Mode: 0o600, Contents: "tiny"},
+				"large.txt":     {Mode: 0o600, Contents: "larger than threshold"},
+				"dir/large.txt": {Mode: 0o600, Contents: "also larger than threshold"},
+			},
+			want: map[string]abctestutil.ModeAndContents{
+				"small.txt":     {Mode: 0o600, Contents: "tiny in-memory"},
+				"large.txt":     {Mode: 0o600, Contents: "larger than threshold streamed"},
+				"dir/large.txt": {Mode: 0o600, Contents: "also larger than threshold streamed"},
+			},
+		},
+		{
+			name:     "nil_streamer_means_in_memory",
+			streamer: nil,
+			initialContents: map[string]abctestutil.ModeAndContents{
+				"large.txt": {Mode: 0o600, Contents: "larger than threshold"},
+			},
+			want: map[string]abctestutil.ModeAndContents{
+				"large.txt": {Mode: 0o600, Contents: "larger than threshold in-memory"},
+			},
+		},
+		{
+			name:     "mode_is_preserved",
+			streamer: streamer,
+			initialContents: map[string]abctestutil.ModeAndContents{
+				"run.sh": {Mode: 0o700, Contents: "#!/bin/sh\necho hello"},
+			},
+			want: map[string]abctestutil.ModeAndContents{
+				"run.sh": {Mode: 0o700, Contents: "#!/bin/sh\necho hello streamed"},
+			},
+		},
+		{
+			name:     "unchanged_file_is_left_alone",
+			streamer: unchangedStreamer,
+			initialContents: map[string]abctestutil.ModeAndContents{
+				"large.txt": {Mode: 0o600, Contents: "larger than threshold"},
+			},
+			want: map[string]abctestutil.ModeAndContents{
+				"large.txt": {Mode: 0o600, Contents: "larger than threshold"},
+			},
+		},
+		{
+			name:     "open_error_is_returned",
+			streamer: streamer,
+			initialContents: map[string]abctestutil.ModeAndContents{
+				"large.txt": {Mode: 0o600, Contents: "larger than threshold"},
+			},
+			want: map[string]abctestutil.ModeAndContents{
+				"large.txt": {Mode: 0o600, Contents: "larger than threshold"},
+			},
+			openErr: fmt.Errorf("fake error for testing"),
+			wantErr: `when processing template file "large.txt": Open(): fake error for testing`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			scratchDir := t.TempDir()
+			abctestutil.WriteAllMode(t, scratchDir, tc.initialContents)
+
+			sp := &stepParams{
+				scope:      common.NewScope(nil, nil),
+				scratchDir: scratchDir,
+				rp: &Params{
+					FS: &common.ErrorFS{
+						FS:      &common.RealFS{},
+						OpenErr: tc.openErr,
+					},
+				},
+				streamThresholdBytes: 10,
+			}
+
+			err := walkAndModifyStreaming(context.Background(), sp, mdl.Strings("."), visitor, tc.streamer)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+
+			// LoadDirMode would also show any temp files left behind.
+			got := abctestutil.LoadDirMode(t, scratchDir)
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("scratch directory contents were not as expected (-got,+want): %v", diff)
+			}
+		})
+	}
+}
+
+func TestActionsStreamLargeFiles(t *testing.T) {
+	t.Parallel()
+
+	large := strings.Repeat("Hello, Alice. ", 1000)
+	scratchDir := t.TempDir()
+	abctestutil.WriteAll(t, scratchDir, map[string]string{
+		"small.txt": "Hello, Alice. ",
+		"large.txt": large,
+	})
+
+	sp := &stepParams{
+		scope:      common.NewScope(map[string]string{"name": "Bob"}, nil),
+		scratchDir: scratchDir,
+		rp: &Params{
+			FS: &common.RealFS{},
+		},
+		streamThresholdBytes: 100,
+	}
+	ctx := context.Background()
+
+	if err := actionStringReplace(ctx, &spec.StringReplace{
+		Paths: mdl.Strings("."),
+		Replacements: []*spec.StringReplacement{
+			{ToReplace: mdl.S("Alice"), With: mdl.S("{{.name}}")},
+		},
+	}, sp); err != nil {
+		t.Fatal(err)
+	}
+	if err := actionAppend(ctx, &spec.Append{
+		Paths: mdl.Strings("."),
+		With:  mdl.S("Goodbye."),
+	}, sp); err != nil {
+		t.Fatal(err)
+	}
+
+	got := abctestutil.LoadDir(t, scratchDir)
+	want := map[string]string{
+		"small.txt": "Hello, Bob. Goodbye.\n",
+		"large.txt": strings.Repeat("Hello, Bob. ", 1000) + "Goodbye.\n",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("scratch directory contents were not as expected (-got,+want): %v", diff)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command wasmplugin is a custom action used to test the wasm action. It's
+// built with GOOS=wasip1 GOARCH=wasm by the test. Its first arg is the mode:
+//
+//   - "upper <file>...": uppercases each file, and prints what it did.
+//   - "greet <file>": writes a greeting to the person named by the "person"
+//     template variable.
+//   - "escape": tries to read a file outside of the scratch directory, both
+//     directly and by creating symlinks.
+//   - "fail": exits with an error.
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing mode")
+	}
+	switch args[0] {
+	case "upper":
+		for _, path := range args[1:] {
+			buf, err := os.ReadFile(path)
+			if err != nil {
+				return err //nolint:wrapcheck
+			}
+			if err := os.WriteFile(path, []byte(strings.ToUpper(string(buf))), 0o600); err != nil {
+				return err //nolint:wrapcheck
+			}
+			fmt.Printf("uppercased %s\n", path)
+		}
+		return nil
+	case "greet":
+		return os.WriteFile(args[1], []byte("hello, "+os.Getenv("person")+"\n"), 0o600) //nolint:wrapcheck
+	case "escape":
+		if _, err := os.ReadFile("../outside.txt"); err == nil {
+			return fmt.Errorf("read a file outside of the scratch directory")
+		}
+		if _, err := os.ReadFile("/../outside.txt"); err == nil {
+			return fmt.Errorf("read a file outside of the scratch directory")
+		}
+		if err := os.Symlink("../outside.txt", "link"); err == nil {
+			return fmt.Errorf("created a symlink to a file outside of the scratch directory")
+		}
+		if err := os.Symlink("..", "dirlink"); err == nil {
+			return fmt.Errorf("created a symlink to a directory outside of the scratch directory")
+		}
+		// In case the symlinks were created anyway, make sure they can't be
+		// followed.
+		if _, err := os.ReadFile("link"); err == nil {
+			return fmt.Errorf("read a file outside of the scratch directory through a symlink")
+		}
+		if err := os.WriteFile("dirlink/outside.txt", []byte("overwritten"), 0o600); err == nil {
+			return fmt.Errorf("wrote a file outside of the scratch directory through a symlink")
+		}
+		return nil
+	case "fail":
+		return fmt.Errorf("failing on purpose")
+	}
+	return fmt.Errorf("unknown mode %q", args[0])
+}
@@ -0,0 +1,136 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
+)
+
+// The phases of a render that are timed.
+const (
+	PhaseDownload = "download"
+	PhaseStep     = "step"
+	PhaseCommit   = "commit"
+)
+
+// Timings collects how long each phase of a render took, so that template
+// authors can find out what makes a render slow. A nil *Timings records
+// nothing. It's safe for concurrent use.
+type Timings struct {
+	mu      sync.Mutex
+	entries []*TimingEntry
+}
+
+// TimingEntry is the total time spent in one phase of a render.
+type TimingEntry struct {
+	// One of the Phase* constants.
+	Phase string
+
+	// For steps, the action name and the spec.yaml line where the step is
+	// defined. Empty otherwise.
+	Action string
+	Line   int
+
+	// How many times the phase ran. A step inside a for_each runs once per
+	// iteration.
+	Count int
+
+	// The total time spent in the phase. A for_each step's time includes
+	// that of its nested steps.
+	Duration time.Duration
+}
+
+// start begins timing a phase. The returned func stops timing and records the
+// elapsed time.
+func (t *Timings) start(phase string) func() {
+	return t.startStep(phase, nil)
+}
+
+// startStep is like start, but for a step of the spec.
+func (t *Timings) startStep(phase string, step *spec.Step) func() {
+	if t == nil {
+		return func() {}
+	}
+	begin := time.Now()
+	return func() {
+		t.record(phase, step, time.Since(begin))
+	}
+}
+
+func (t *Timings) record(phase string, step *spec.Step, d time.Duration) {
+	var action string
+	var line int
+	if step != nil {
+		action, line = step.Action.Val, step.Pos.Line
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, e := range t.entries {
+		if e.Phase == phase && e.Action == action && e.Line == line {
+			e.Count++
+			e.Duration += d
+			return
+		}
+	}
+	t.entries = append(t.entries, &TimingEntry{
+		Phase:    phase,
+		Action:   action,
+		Line:     line,
+		Count:    1,
+		Duration: d,
+	})
+}
+
+// Entries returns the recorded entries in the order that they first
+// occurred.
+func (t *Timings) Entries() []TimingEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]TimingEntry, 0, len(t.entries))
+	for _, e := range t.entries {
+		out = append(out, *e)
+	}
+	return out
+}
+
+// WriteTable writes the recorded entries as a table, slowest first.
+func (t *Timings) WriteTable(w io.Writer) error {
+	entries := t.Entries()
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Duration > entries[j].Duration
+	})
+
+	tw := tabwriter.NewWriter(w, 8, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PHASE\tACTION\tLINE\tCOUNT\tDURATION")
+	for _, e := range entries {
+		line := ""
+		if e.Line > 0 {
+			line = fmt.Sprint(e.Line)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n", e.Phase, e.Action, line, e.Count, e.Duration.Round(time.Millisecond))
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("failed writing timing table: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	mdl "github.com/abcxyz/abc/templates/testutil/model"
+	"github.com/abcxyz/pkg/logging"
+)
+
+func TestTimings_WriteTable(t *testing.T) {
+	t.Parallel()
+
+	step := func(action string, line int) *spec.Step {
+		s := &spec.Step{Action: mdl.S(action)}
+		s.Pos.Line = line
+		return s
+	}
+
+	timings := &Timings{}
+	timings.record(PhaseDownload, nil, 2*time.Second)
+	timings.record(PhaseStep, step("include", 5), 100*time.Millisecond)
+	timings.record(PhaseStep, step("regex_replace", 9), 20*time.Second)
+	timings.record(PhaseStep, step("regex_replace", 9), 20*time.Second)
+	timings.record(PhaseCommit, nil, time.Second)
+
+	var sb strings.Builder
+	if err := timings.WriteTable(&sb); err != nil {
+		t.Fatal(err)
+	}
+	want := `PHASE     ACTION         LINE    COUNT   DURATION
+step      regex_replace  9       2       40s
+download                         1       2s
+commit                           1       1s
+step      include        5       1       100ms
+`
+	if diff := cmp.Diff(sb.String(), want); diff != "" {
+		t.Errorf("table was not as expected (-got,+want): %s", diff)
+	}
+}
+
+func TestTimings_NilRecordsNothing(t *testing.T) {
+	t.Parallel()
+
+	var timings *Timings
+	timings.start(PhaseDownload)()
+	timings.startStep(PhaseStep, &spec.Step{})()
+}
+
+func TestRender_Timings(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	abctestutil.WriteAll(t, sourceDir, map[string]string{
+		"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'A template for testing timings'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['a.txt']
+  - desc: 'Loop'
+    action: 'for_each'
+    params:
+      iterator:
+        key: 'x'
+        values: ['a', 'b']
+      steps:
+        - desc: 'Replace'
+          action: 'string_replace'
+          params:
+            paths: ['a.txt']
+            replacements:
+              - to_replace: 'a'
+                with: 'b'
+`,
+		"a.txt": "a",
+	})
+
+	timings := &Timings{}
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	if _, err := Render(ctx, &Params{
+		Clock:             clock.NewMock(),
+		Cwd:               tempDir,
+		Downloader:        &templatesource.LocalDownloader{SrcPath: sourceDir},
+		FS:                &common.RealFS{},
+		OutDir:            filepath.Join(tempDir, "out"),
+		SourceForMessages: sourceDir,
+		Stdout:            io.Discard,
+		TempDirBase:       tempDir,
+		Timings:           timings,
+		UpgradeChannel:    "main",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []TimingEntry{
+		{Phase: PhaseDownload, Count: 1},
+		{Phase: PhaseStep, Action: "include", Line: 5, Count: 1},
+		{Phase: PhaseStep, Action: "string_replace", Line: 16, Count: 2},
+		{Phase: PhaseStep, Action: "for_each", Line: 9, Count: 1},
+		{Phase: PhaseCommit, Count: 1},
+	}
+	if diff := cmp.Diff(timings.Entries(), want, cmpopts.IgnoreFields(TimingEntry{}, "Duration")); diff != "" {
+		t.Errorf("timings were not as expected (-got,+want): %s", diff)
+	}
+}
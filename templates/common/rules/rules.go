@@ -22,7 +22,7 @@ import (
 	"text/tabwriter"
 
 	"github.com/abcxyz/abc/templates/common"
-	spec "github.com/abcxyz/abc/templates/model/spec/v1beta6"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
 )
 
 // ValidateRules validates the given rules using the given context and scope.
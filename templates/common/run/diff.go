@@ -55,8 +55,10 @@ func RunDiff(ctx context.Context, color bool, file1, file1RelTo, file2, file2Rel
 		return "", err //nolint:wrapcheck
 	}
 
-	srcRelPath := "a/" + file1Label
-	dstRelPath := "b/" + file2Label
+	// The labels use forward slashes on every OS, since patches are saved in
+	// manifests.
+	srcRelPath := "a/" + filepath.ToSlash(file1Label)
+	dstRelPath := "b/" + filepath.ToSlash(file2Label)
 	if err := copyToTempIfExists(ctx, file1, tempDir, srcRelPath); err != nil {
 		return "", err
 	}
@@ -69,10 +71,19 @@ func RunDiff(ctx context.Context, color bool, file1, file1RelTo, file2, file2Rel
 		colorParam = "always"
 	}
 
+	// The diff options are all given explicitly, rather than inherited from the
+	// user's git config, so that the same two files always produce the same
+	// patch. Patches are saved in manifests, which must be reproducible.
 	args := []string{
 		"git",
+		"-c", "core.quotePath=true",
 		"diff",
 		"--no-index", // Ignore the git repo and use "git diff" as a plain diff tool
+		"--no-ext-diff",
+		"--no-textconv",
+		"--diff-algorithm=myers",
+		"--unified=3",
+		"--indent-heuristic",
 		fmt.Sprintf("--color=%s", colorParam),
 		"--src-prefix", "", // we created a/ and b/ dirs in the temp dir, so no need for prefixes.
 		"--dst-prefix", "",
@@ -0,0 +1,114 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sync"
+
+	"golang.org/x/oauth2/google"
+)
+
+// GCPSecretManagerProvider is the provider name of Google Secret Manager in
+// secret references, as in
+// "secret://gcp-sm/projects/my-project/secrets/api-key".
+const GCPSecretManagerProvider = "gcp-sm"
+
+const (
+	secretManagerEndpoint = "https://secretmanager.googleapis.com/v1"
+	cloudPlatformScope    = "https://www.googleapis.com/auth/cloud-platform"
+)
+
+// secretNameRE matches the resource name of a secret, optionally with a
+// version. The latest version is used if none is given.
+var secretNameRE = regexp.MustCompile(`^projects/[^/]+/secrets/[^/]+(/versions/[^/]+)?$`)
+
+// GCPSecretManager resolves secrets stored in Google Secret Manager. The path
+// of a reference is the secret's resource name, like
+// "projects/my-project/secrets/api-key" or
+// "projects/my-project/secrets/api-key/versions/3".
+type GCPSecretManager struct {
+	// Client is the HTTP client to use, which must add credentials to each
+	// request. If nil, a client using application default credentials is
+	// created.
+	Client *http.Client
+
+	// endpoint overrides the Secret Manager API endpoint in tests.
+	endpoint string
+
+	once      sync.Once
+	clientErr error
+}
+
+// Resolve implements SecretResolver.
+func (g *GCPSecretManager) Resolve(ctx context.Context, path string) (string, error) {
+	m := secretNameRE.FindStringSubmatch(path)
+	if m == nil {
+		return "", fmt.Errorf("%q isn't a Secret Manager secret name like projects/<project>/secrets/<secret>[/versions/<version>]", path)
+	}
+	if m[1] == "" {
+		path += "/versions/latest"
+	}
+
+	g.once.Do(func() {
+		if g.Client == nil {
+			g.Client, g.clientErr = google.DefaultClient(ctx, cloudPlatformScope)
+		}
+	})
+	if g.clientErr != nil {
+		return "", fmt.Errorf("failed getting Google Cloud credentials: %w", g.clientErr)
+	}
+
+	endpoint := g.endpoint
+	if endpoint == "" {
+		endpoint = secretManagerEndpoint
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/%s:access", endpoint, path), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed creating request: %w", err)
+	}
+
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed accessing secret: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("got HTTP status %q when accessing secret: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	var body struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed parsing Secret Manager response: %w", err)
+	}
+	data, err := base64.StdEncoding.DecodeString(body.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("failed decoding secret payload: %w", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestGCPSecretManager(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/projects/p/secrets/api-key/versions/latest:access":
+			fmt.Fprintf(w, `{"payload":{"data":%q}}`, base64.StdEncoding.EncodeToString([]byte("latest-value")))
+		case "/projects/p/secrets/api-key/versions/3:access":
+			fmt.Fprintf(w, `{"payload":{"data":%q}}`, base64.StdEncoding.EncodeToString([]byte("v3-value")))
+		default:
+			http.Error(w, "secret not found", http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	cases := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "latest",
+			path: "projects/p/secrets/api-key",
+			want: "latest-value",
+		},
+		{
+			name: "version",
+			path: "projects/p/secrets/api-key/versions/3",
+			want: "v3-value",
+		},
+		{
+			name:    "not_found",
+			path:    "projects/p/secrets/nope",
+			wantErr: `got HTTP status "404 Not Found" when accessing secret: secret not found`,
+		},
+		{
+			name:    "bad_name",
+			path:    "p/api-key",
+			wantErr: `"p/api-key" isn't a Secret Manager secret name`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			sm := &GCPSecretManager{Client: server.Client(), endpoint: server.URL}
+			got, err := sm.Resolve(context.Background(), tc.path)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if got != tc.want {
+				t.Errorf("got secret %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secrets resolves template input values of the form
+// "secret://<provider>/<path>" by looking them up in a secret store at render
+// time, so the secret values never have to be passed on the command line or
+// saved in a manifest.
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+)
+
+// Scheme is the prefix of an input value that refers to a secret rather than
+// being a literal value.
+const Scheme = "secret://"
+
+// SecretResolver looks up secrets in one secret store.
+type SecretResolver interface {
+	// Resolve returns the value of the secret at path, which is the part of
+	// the reference after "secret://<provider>/".
+	Resolve(ctx context.Context, path string) (string, error)
+}
+
+// DefaultResolvers returns the resolvers that abc supports out of the box, by
+// provider name.
+func DefaultResolvers() map[string]SecretResolver {
+	return map[string]SecretResolver{
+		GCPSecretManagerProvider: &GCPSecretManager{},
+	}
+}
+
+// IsRef returns whether the given input value is a secret reference.
+func IsRef(val string) bool {
+	return strings.HasPrefix(val, Scheme)
+}
+
+// Resolve returns the value of the secret that ref refers to, using the
+// resolver for the provider named in ref.
+func Resolve(ctx context.Context, resolvers map[string]SecretResolver, ref string) (string, error) {
+	provider, path, _ := strings.Cut(strings.TrimPrefix(ref, Scheme), "/")
+	if provider == "" || path == "" {
+		return "", fmt.Errorf("secret reference %q must look like %s<provider>/<path>", ref, Scheme)
+	}
+	resolver, ok := resolvers[provider]
+	if !ok {
+		return "", fmt.Errorf("secret reference %q uses the unknown provider %q, the supported providers are: %s",
+			ref, provider, strings.Join(providerNames(resolvers), ", "))
+	}
+	val, err := resolver.Resolve(ctx, path)
+	if err != nil {
+		return "", fmt.Errorf("failed resolving secret reference %q: %w", ref, err)
+	}
+	return val, nil
+}
+
+// ResolveRefs returns a copy of vals in which each secret reference is
+// replaced by the secret's value. The returned refs map the names of the
+// values that were secret references to the references themselves. If
+// resolvers is nil, secret references are left as they are.
+func ResolveRefs(ctx context.Context, resolvers map[string]SecretResolver, vals map[string]string) (resolved, refs map[string]string, _ error) {
+	resolved = maps.Clone(vals)
+	if resolvers == nil {
+		return resolved, nil, nil
+	}
+	for name, val := range vals {
+		if !IsRef(val) {
+			continue
+		}
+		secret, err := Resolve(ctx, resolvers, val)
+		if err != nil {
+			return nil, nil, fmt.Errorf("input %q: %w", name, err)
+		}
+		resolved[name] = secret
+		if refs == nil {
+			refs = make(map[string]string)
+		}
+		refs[name] = val
+	}
+	return resolved, refs, nil
+}
+
+// Redact returns a copy of vals in which the values named in refs are
+// replaced by their secret references, so they can be saved or shown without
+// revealing the secrets.
+func Redact(vals, refs map[string]string) map[string]string {
+	if len(refs) == 0 {
+		return vals
+	}
+	out := maps.Clone(vals)
+	for name, ref := range refs {
+		if _, ok := out[name]; ok {
+			out[name] = ref
+		}
+	}
+	return out
+}
+
+func providerNames(resolvers map[string]SecretResolver) []string {
+	names := make([]string, 0, len(resolvers))
+	for name := range resolvers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
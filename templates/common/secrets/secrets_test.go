@@ -0,0 +1,122 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+type fakeResolver map[string]string
+
+func (f fakeResolver) Resolve(ctx context.Context, path string) (string, error) {
+	val, ok := f[path]
+	if !ok {
+		return "", fmt.Errorf("no secret %q", path)
+	}
+	return val, nil
+}
+
+func TestResolveRefs(t *testing.T) {
+	t.Parallel()
+
+	resolvers := map[string]SecretResolver{
+		"fake":  fakeResolver{"a/b": "secret_ab"},
+		"other": fakeResolver{},
+	}
+
+	cases := []struct {
+		name      string
+		vals      map[string]string
+		resolvers map[string]SecretResolver
+		want      map[string]string
+		wantRefs  map[string]string
+		wantErr   string
+	}{
+		{
+			name:      "no_refs",
+			vals:      map[string]string{"x": "plain"},
+			resolvers: resolvers,
+			want:      map[string]string{"x": "plain"},
+		},
+		{
+			name:      "ref_resolved",
+			vals:      map[string]string{"x": "plain", "y": "secret://fake/a/b"},
+			resolvers: resolvers,
+			want:      map[string]string{"x": "plain", "y": "secret_ab"},
+			wantRefs:  map[string]string{"y": "secret://fake/a/b"},
+		},
+		{
+			name: "nil_resolvers",
+			vals: map[string]string{"y": "secret://fake/a/b"},
+			want: map[string]string{"y": "secret://fake/a/b"},
+		},
+		{
+			name:      "unknown_provider",
+			vals:      map[string]string{"y": "secret://nope/a/b"},
+			resolvers: resolvers,
+			wantErr:   `input "y": secret reference "secret://nope/a/b" uses the unknown provider "nope", the supported providers are: fake, other`,
+		},
+		{
+			name:      "missing_path",
+			vals:      map[string]string{"y": "secret://fake"},
+			resolvers: resolvers,
+			wantErr:   `must look like secret://<provider>/<path>`,
+		},
+		{
+			name:      "resolver_error",
+			vals:      map[string]string{"y": "secret://other/a/b"},
+			resolvers: resolvers,
+			wantErr:   `failed resolving secret reference "secret://other/a/b": no secret "a/b"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, gotRefs, err := ResolveRefs(context.Background(), tc.resolvers, tc.vals)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("resolved values were not as expected (-got,+want): %s", diff)
+			}
+			if diff := cmp.Diff(gotRefs, tc.wantRefs); diff != "" {
+				t.Errorf("refs were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestRedact(t *testing.T) {
+	t.Parallel()
+
+	got := Redact(
+		map[string]string{"x": "plain", "y": "secret_ab"},
+		map[string]string{"y": "secret://fake/a/b", "z": "secret://fake/c"},
+	)
+	want := map[string]string{"x": "plain", "y": "secret://fake/a/b"}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("redacted values were not as expected (-got,+want): %s", diff)
+	}
+}
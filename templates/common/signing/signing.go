@@ -0,0 +1,193 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package signing signs manifests and verifies their signatures, so that hand
+// edits to a manifest can be detected.
+//
+// A manifest's signature is stored next to it in a file of the same name plus
+// ".sig", containing the base64-encoded signature of the manifest file's exact
+// bytes. Ed25519 and ECDSA keys are supported, in PEM-encoded PKCS #8 (private)
+// and PKIX (public) format, as produced by "openssl genpkey" and
+// "openssl pkey -pubout".
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common"
+)
+
+// SigSuffix is appended to a manifest's path to get the path of its signature.
+const SigSuffix = ".sig"
+
+// ErrNotSigned is returned by Verify when the manifest has no signature.
+var ErrNotSigned = errors.New("the manifest isn't signed")
+
+// LoadSigner reads a PEM-encoded PKCS #8 private key from the given file.
+func LoadSigner(fs common.FS, path string) (crypto.Signer, error) {
+	block, err := readPEM(fs, path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing private key in %q: %w", path, err)
+	}
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		return k, nil
+	default:
+		return nil, fmt.Errorf("the private key in %q has unsupported type %T; only Ed25519 and ECDSA keys are supported", path, key)
+	}
+}
+
+// LoadPublicKey reads a PEM-encoded PKIX public key from the given file.
+func LoadPublicKey(fs common.FS, path string) (crypto.PublicKey, error) {
+	block, err := readPEM(fs, path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing public key in %q: %w", path, err)
+	}
+	switch key.(type) {
+	case ed25519.PublicKey, *ecdsa.PublicKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("the public key in %q has unsupported type %T; only Ed25519 and ECDSA keys are supported", path, key)
+	}
+}
+
+func readPEM(fs common.FS, path string) (*pem.Block, error) {
+	buf, err := fs.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading key file: %w", err)
+	}
+	block, _ := pem.Decode(buf)
+	if block == nil {
+		return nil, fmt.Errorf("the key file %q doesn't contain a PEM block", path)
+	}
+	return block, nil
+}
+
+// Sign returns the signature file contents for the given manifest contents.
+func Sign(signer crypto.Signer, manifest []byte) ([]byte, error) {
+	var sig []byte
+	var err error
+	switch signer.(type) {
+	case ed25519.PrivateKey:
+		// Ed25519 signs the whole message rather than a digest.
+		sig, err = signer.Sign(rand.Reader, manifest, crypto.Hash(0))
+	default:
+		digest := sha256.Sum256(manifest)
+		sig, err = signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed signing manifest: %w", err)
+	}
+	return []byte(base64.StdEncoding.EncodeToString(sig) + "\n"), nil
+}
+
+// Verify checks the signature file contents for the given manifest contents.
+func Verify(pub crypto.PublicKey, manifest, sigFile []byte) error {
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sigFile)))
+	if err != nil {
+		return fmt.Errorf("the signature isn't valid base64: %w", err)
+	}
+
+	var ok bool
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(k, manifest, sig)
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(manifest)
+		ok = ecdsa.VerifyASN1(k, digest[:], sig)
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
+	}
+	if !ok {
+		return fmt.Errorf("the signature doesn't match; the manifest was modified after it was signed, or it was signed with a different key")
+	}
+	return nil
+}
+
+// WriteSig signs the manifest contents and writes the signature next to the
+// manifest at manifestPath.
+func WriteSig(fs common.FS, signer crypto.Signer, manifestPath string, manifest []byte) error {
+	sig, err := Sign(signer, manifest)
+	if err != nil {
+		return err
+	}
+	sigPath := manifestPath + SigSuffix
+	if err := fs.WriteFile(sigPath, sig, common.OwnerRWPerms); err != nil {
+		return fmt.Errorf("WriteFile(%q): %w", sigPath, err)
+	}
+	return nil
+}
+
+// RemoveSig removes the signature of the manifest at manifestPath, because the
+// manifest was rewritten and the signature no longer matches. It reports
+// whether there was a signature.
+func RemoveSig(fs common.FS, manifestPath string) (bool, error) {
+	sigPath := manifestPath + SigSuffix
+	if err := fs.Remove(sigPath); err != nil {
+		if common.IsNotExistErr(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("Remove(%q): %w", sigPath, err)
+	}
+	return true, nil
+}
+
+// Resign updates the signature of the manifest at manifestPath after the
+// manifest was rewritten with the given contents. If signer is nil, the stale
+// signature is removed with RemoveSig instead, and removed reports whether
+// there was one.
+func Resign(fs common.FS, signer crypto.Signer, manifestPath string, manifest []byte) (removed bool, _ error) {
+	if signer != nil {
+		return false, WriteSig(fs, signer, manifestPath, manifest)
+	}
+	return RemoveSig(fs, manifestPath)
+}
+
+// VerifyFile checks the signature of the manifest file at manifestPath. It
+// returns ErrNotSigned if there's no signature file.
+func VerifyFile(fs common.FS, pub crypto.PublicKey, manifestPath string) error {
+	manifest, err := fs.ReadFile(manifestPath)
+	if err != nil {
+		return fmt.Errorf("failed reading manifest: %w", err)
+	}
+	sigPath := manifestPath + SigSuffix
+	sig, err := fs.ReadFile(sigPath)
+	if err != nil {
+		if common.IsNotExistErr(err) {
+			return fmt.Errorf("%w: there's no signature file %q", ErrNotSigned, sigPath)
+		}
+		return fmt.Errorf("failed reading signature: %w", err)
+	}
+	return Verify(pub, manifest, sig)
+}
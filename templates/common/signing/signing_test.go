@@ -0,0 +1,372 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+const manifestContents = `# Generated by the "abc" command. Do not modify.
+api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Manifest'
+template_location: 'github.com/foo/bar'
+`
+
+func TestSignVerify(t *testing.T) {
+	t.Parallel()
+
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherEdPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name       string
+		signer     crypto.Signer
+		verifyWith crypto.PublicKey
+		modify     func([]byte) []byte
+		wantErr    string
+	}{
+		{
+			name:       "ed25519",
+			signer:     edPriv,
+			verifyWith: edPub,
+		},
+		{
+			name:       "ecdsa",
+			signer:     ecPriv,
+			verifyWith: ecPriv.Public(),
+		},
+		{
+			name:       "tampered",
+			signer:     edPriv,
+			verifyWith: edPub,
+			modify: func(b []byte) []byte {
+				return append(b, []byte("upgrade_channel: 'main'\n")...)
+			},
+			wantErr: "the signature doesn't match",
+		},
+		{
+			name:       "tampered_ecdsa",
+			signer:     ecPriv,
+			verifyWith: ecPriv.Public(),
+			modify: func(b []byte) []byte {
+				return b[1:]
+			},
+			wantErr: "the signature doesn't match",
+		},
+		{
+			name:       "wrong_key",
+			signer:     edPriv,
+			verifyWith: otherEdPub,
+			wantErr:    "the signature doesn't match",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			sig, err := Sign(tc.signer, []byte(manifestContents))
+			if err != nil {
+				t.Fatal(err)
+			}
+			manifest := []byte(manifestContents)
+			if tc.modify != nil {
+				manifest = tc.modify(manifest)
+			}
+			err = Verify(tc.verifyWith, manifest, sig)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestWriteSigVerifyFile(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name          string
+		keyType       string
+		skipSign      bool
+		wantErr       string
+		wantNotSigned bool
+	}{
+		{
+			name:    "ed25519",
+			keyType: "ed25519",
+		},
+		{
+			name:    "ecdsa",
+			keyType: "ecdsa",
+		},
+		{
+			name:          "not_signed",
+			keyType:       "ed25519",
+			skipSign:      true,
+			wantErr:       "the manifest isn't signed",
+			wantNotSigned: true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			fs := &common.RealFS{}
+			privPath, pubPath := writeKeyPair(t, dir, tc.keyType)
+
+			signer, err := LoadSigner(fs, privPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pub, err := LoadPublicKey(fs, pubPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			manifestPath := filepath.Join(dir, "manifest.yaml")
+			if err := os.WriteFile(manifestPath, []byte(manifestContents), common.OwnerRWPerms); err != nil {
+				t.Fatal(err)
+			}
+			if !tc.skipSign {
+				if err := WriteSig(fs, signer, manifestPath, []byte(manifestContents)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = VerifyFile(fs, pub, manifestPath)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			if got := errors.Is(err, ErrNotSigned); got != tc.wantNotSigned {
+				t.Errorf("errors.Is(err, ErrNotSigned) got %t, want %t", got, tc.wantNotSigned)
+			}
+		})
+	}
+}
+
+func TestResign(t *testing.T) {
+	t.Parallel()
+
+	const rewritten = manifestContents + "template_version: 'abc123'\n"
+
+	cases := []struct {
+		name        string
+		signed      bool
+		withSigner  bool
+		wantRemoved bool
+		wantSig     bool
+	}{
+		{
+			name:       "resigned",
+			signed:     true,
+			withSigner: true,
+			wantSig:    true,
+		},
+		{
+			name:        "removed",
+			signed:      true,
+			wantRemoved: true,
+		},
+		{
+			name: "never_signed",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			fs := &common.RealFS{}
+			privPath, pubPath := writeKeyPair(t, dir, "ed25519")
+			signer, err := LoadSigner(fs, privPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pub, err := LoadPublicKey(fs, pubPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			manifestPath := filepath.Join(dir, "manifest.yaml")
+			if tc.signed {
+				if err := WriteSig(fs, signer, manifestPath, []byte(manifestContents)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.WriteFile(manifestPath, []byte(rewritten), common.OwnerRWPerms); err != nil {
+				t.Fatal(err)
+			}
+
+			var resignWith crypto.Signer
+			if tc.withSigner {
+				resignWith = signer
+			}
+			removed, err := Resign(fs, resignWith, manifestPath, []byte(rewritten))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if removed != tc.wantRemoved {
+				t.Errorf("Resign() removed got %t, want %t", removed, tc.wantRemoved)
+			}
+
+			err = VerifyFile(fs, pub, manifestPath)
+			if tc.wantSig && err != nil {
+				t.Errorf("VerifyFile() got error %v, want the new signature to match", err)
+			}
+			if !tc.wantSig && !errors.Is(err, ErrNotSigned) {
+				t.Errorf("VerifyFile() got error %v, want ErrNotSigned", err)
+			}
+		})
+	}
+}
+
+func TestLoadKeys_Errors(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024) //nolint:gosec // The key is never used to sign.
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPriv, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPub, err := x509.MarshalPKIXPublicKey(rsaKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name          string
+		contents      string
+		wantSignerErr string
+		wantPubErr    string
+	}{
+		{
+			name:          "not_pem",
+			contents:      "hello",
+			wantSignerErr: "doesn't contain a PEM block",
+			wantPubErr:    "doesn't contain a PEM block",
+		},
+		{
+			name:          "rsa_private",
+			contents:      string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: rsaPriv})),
+			wantSignerErr: "only Ed25519 and ECDSA keys are supported",
+			wantPubErr:    "failed parsing public key",
+		},
+		{
+			name:          "rsa_public",
+			contents:      string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rsaPub})),
+			wantSignerErr: "failed parsing private key",
+			wantPubErr:    "only Ed25519 and ECDSA keys are supported",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "key.pem")
+			if err := os.WriteFile(path, []byte(tc.contents), common.OwnerRWPerms); err != nil {
+				t.Fatal(err)
+			}
+			fs := &common.RealFS{}
+
+			_, err := LoadSigner(fs, path)
+			if diff := testutil.DiffErrString(err, tc.wantSignerErr); diff != "" {
+				t.Errorf("LoadSigner: %s", diff)
+			}
+			_, err = LoadPublicKey(fs, path)
+			if diff := testutil.DiffErrString(err, tc.wantPubErr); diff != "" {
+				t.Errorf("LoadPublicKey: %s", diff)
+			}
+		})
+	}
+}
+
+// writeKeyPair generates a key pair of the given type ("ed25519" or "ecdsa")
+// and writes it to dir in PEM format, returning the private and public key
+// paths.
+func writeKeyPair(tb testing.TB, dir, keyType string) (privPath, pubPath string) {
+	tb.Helper()
+
+	var priv crypto.Signer
+	switch keyType {
+	case "ed25519":
+		_, k, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		priv = k
+	case "ecdsa":
+		k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		priv = k
+	default:
+		tb.Fatalf("unknown key type %q", keyType)
+	}
+
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(priv.Public())
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	privPath = filepath.Join(dir, "key.pem")
+	pubPath = filepath.Join(dir, "key.pub.pem")
+	if err := os.WriteFile(privPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), common.OwnerRWPerms); err != nil {
+		tb.Fatal(err)
+	}
+	if err := os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), common.OwnerRWPerms); err != nil {
+		tb.Fatal(err)
+	}
+	return privPath, pubPath
+}
@@ -24,8 +24,9 @@ import (
 	"text/tabwriter"
 
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/model"
 	"github.com/abcxyz/abc/templates/model/decode"
-	spec "github.com/abcxyz/abc/templates/model/spec/v1beta6"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
 )
 
 const (
@@ -131,8 +132,22 @@ func Load(ctx context.Context, fs common.FS, templateDir, source string) (*spec.
 
 	spec, ok := specI.(*spec.Spec)
 	if !ok {
-		return nil, fmt.Errorf("internal error: spec file did not decode to *spec.Spec, got %T", specI)
+		return nil, common.InternalErrorf("spec file did not decode to *spec.Spec, got %T", specI)
 	}
 
 	return spec, nil
 }
+
+// WithExcerpt adds excerpts of the spec file in templateDir to err, showing
+// the parts of the spec that err points at, if any. See model.WithExcerpt.
+// err is returned unchanged if the spec file can't be read.
+func WithExcerpt(fs common.FS, templateDir string, err error) error {
+	if err == nil {
+		return nil
+	}
+	buf, readErr := fs.ReadFile(filepath.Join(templateDir, SpecFileName))
+	if readErr != nil {
+		return err
+	}
+	return model.WithExcerpt(err, SpecFileName, buf)
+}
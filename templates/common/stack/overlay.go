@@ -0,0 +1,103 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/model/decode"
+	stack "github.com/abcxyz/abc/templates/model/stack/v1beta7"
+)
+
+// LoadOverlay reads the stack overlay file at the given path, validating it
+// and upgrading it to the newest overlay model.
+func LoadOverlay(ctx context.Context, fs common.FS, path string) (*stack.Overlay, error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stack overlay file at %q: %w", path, err)
+	}
+	defer f.Close()
+
+	overlayI, _, err := decode.DecodeValidateUpgrade(ctx, f, path, decode.KindStackOverlay)
+	if err != nil {
+		return nil, fmt.Errorf("error reading stack overlay file: %w", err)
+	}
+
+	out, ok := overlayI.(*stack.Overlay)
+	if !ok {
+		return nil, common.InternalErrorf("stack overlay file did not decode to *stack.Overlay")
+	}
+	return out, nil
+}
+
+// applyOverlay modifies the given stack in place according to the overlay:
+// members are removed first, then existing members are patched, then new
+// members are appended. The result must be validated again, since the overlay
+// may have, for example, removed a member whose outputs another member uses.
+func applyOverlay(s *stack.Stack, o *stack.Overlay) error {
+	s.Vars = setValues(s.Vars, o.Vars)
+
+	var merr error
+	for _, r := range o.RemoveMembers {
+		idx := memberIndex(s.Members, r.Val)
+		if idx < 0 {
+			merr = errors.Join(merr, r.Pos.Errorf("can't remove member %q because the stack has no member with that name", r.Val))
+			continue
+		}
+		s.Members = slices.Delete(s.Members, idx, idx+1)
+	}
+
+	for _, patch := range o.Members {
+		idx := memberIndex(s.Members, patch.Name.Val)
+		if idx < 0 {
+			merr = errors.Join(merr, patch.Name.Pos.Errorf("can't change member %q because the stack has no member with that name; use add_members to add it", patch.Name.Val))
+			continue
+		}
+		m := s.Members[idx]
+		if patch.Source.Val != "" {
+			m.Source = patch.Source
+		}
+		if patch.Dest.Val != "" {
+			m.Dest = patch.Dest
+		}
+		m.Inputs = setValues(m.Inputs, patch.Inputs)
+	}
+
+	s.Members = append(s.Members, o.AddMembers...)
+	return merr
+}
+
+// setValues returns the values in base, with those that have the same name as
+// one in overrides replaced by it, followed by the rest of overrides.
+func setValues(base, overrides []*stack.VarValue) []*stack.VarValue {
+	out := slices.Clone(base)
+	for _, o := range overrides {
+		idx := slices.IndexFunc(out, func(v *stack.VarValue) bool { return v.Name.Val == o.Name.Val })
+		if idx < 0 {
+			out = append(out, o)
+			continue
+		}
+		out[idx] = o
+	}
+	return out
+}
+
+func memberIndex(members []*stack.Member, name string) int {
+	return slices.IndexFunc(members, func(m *stack.Member) bool { return m.Name.Val == name })
+}
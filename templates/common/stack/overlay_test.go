@@ -0,0 +1,168 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/abcxyz/abc/templates/model"
+	stack "github.com/abcxyz/abc/templates/model/stack/v1beta7"
+	mdl "github.com/abcxyz/abc/templates/testutil/model"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestApplyOverlay(t *testing.T) {
+	t.Parallel()
+
+	base := func() *stack.Stack {
+		return &stack.Stack{
+			Vars: []*stack.VarValue{
+				{Name: mdl.S("project_id"), Value: mdl.S("base-project")},
+				{Name: mdl.S("region"), Value: mdl.S("us-west1")},
+			},
+			Members: []*stack.Member{
+				{
+					Name:   mdl.S("network"),
+					Source: mdl.S("./network"),
+					Dest:   mdl.S("network"),
+					Inputs: []*stack.VarValue{
+						{Name: mdl.S("project_id"), Value: mdl.S("{{.vars.project_id}}")},
+					},
+				},
+				{
+					Name:   mdl.S("monitoring"),
+					Source: mdl.S("./monitoring"),
+					Dest:   mdl.S("monitoring"),
+				},
+			},
+		}
+	}
+
+	cases := []struct {
+		name    string
+		overlay *stack.Overlay
+		want    *stack.Stack
+		wantErr string
+	}{
+		{
+			name:    "empty_overlay",
+			overlay: &stack.Overlay{},
+			want:    base(),
+		},
+		{
+			name: "vars_and_inputs",
+			overlay: &stack.Overlay{
+				Vars: []*stack.VarValue{
+					{Name: mdl.S("project_id"), Value: mdl.S("prod-project")},
+					{Name: mdl.S("tier"), Value: mdl.S("prod")},
+				},
+				Members: []*stack.MemberPatch{
+					{
+						Name:   mdl.S("network"),
+						Source: mdl.S("./network-v2"),
+						Inputs: []*stack.VarValue{
+							{Name: mdl.S("project_id"), Value: mdl.S("override")},
+							{Name: mdl.S("ha"), Value: mdl.S("true")},
+						},
+					},
+				},
+			},
+			want: &stack.Stack{
+				Vars: []*stack.VarValue{
+					{Name: mdl.S("project_id"), Value: mdl.S("prod-project")},
+					{Name: mdl.S("region"), Value: mdl.S("us-west1")},
+					{Name: mdl.S("tier"), Value: mdl.S("prod")},
+				},
+				Members: []*stack.Member{
+					{
+						Name:   mdl.S("network"),
+						Source: mdl.S("./network-v2"),
+						Dest:   mdl.S("network"),
+						Inputs: []*stack.VarValue{
+							{Name: mdl.S("project_id"), Value: mdl.S("override")},
+							{Name: mdl.S("ha"), Value: mdl.S("true")},
+						},
+					},
+					{
+						Name:   mdl.S("monitoring"),
+						Source: mdl.S("./monitoring"),
+						Dest:   mdl.S("monitoring"),
+					},
+				},
+			},
+		},
+		{
+			name: "add_and_remove_members",
+			overlay: &stack.Overlay{
+				RemoveMembers: []model.String{mdl.S("monitoring")},
+				AddMembers: []*stack.Member{
+					{
+						Name:   mdl.S("debug_tools"),
+						Source: mdl.S("./debug"),
+						Dest:   mdl.S("debug"),
+					},
+				},
+			},
+			want: &stack.Stack{
+				Vars: base().Vars,
+				Members: []*stack.Member{
+					base().Members[0],
+					{
+						Name:   mdl.S("debug_tools"),
+						Source: mdl.S("./debug"),
+						Dest:   mdl.S("debug"),
+					},
+				},
+			},
+		},
+		{
+			name: "remove_nonexistent",
+			overlay: &stack.Overlay{
+				RemoveMembers: []model.String{mdl.S("nope")},
+			},
+			wantErr: `can't remove member "nope" because the stack has no member with that name`,
+		},
+		{
+			name: "patch_nonexistent",
+			overlay: &stack.Overlay{
+				Members: []*stack.MemberPatch{{Name: mdl.S("nope")}},
+			},
+			wantErr: `can't change member "nope" because the stack has no member with that name; use add_members`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := base()
+			err := applyOverlay(got, tc.overlay)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			opt := cmpopts.IgnoreTypes(&model.ConfigPos{}, model.ConfigPos{})
+			if diff := cmp.Diff(got, tc.want, opt); diff != "" {
+				t.Errorf("stack after overlay was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
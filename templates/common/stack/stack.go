@@ -0,0 +1,375 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package stack renders and upgrades stacks, which are sets of templates that
+// are installed together and may feed the outputs of one template into the
+// inputs of another.
+package stack
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/benbjohnson/clock"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/indexutil"
+	"github.com/abcxyz/abc/templates/common/registry"
+	"github.com/abcxyz/abc/templates/common/render"
+	"github.com/abcxyz/abc/templates/common/render/gotmpl/funcs"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/abc/templates/common/upgrade"
+	"github.com/abcxyz/abc/templates/model/decode"
+	manifestutil "github.com/abcxyz/abc/templates/model/manifest"
+	"github.com/abcxyz/abc/templates/model/spec/features"
+	stack "github.com/abcxyz/abc/templates/model/stack/v1beta7"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// Params contains the arguments to Render and Upgrade.
+type Params struct {
+	Clock clock.Clock
+
+	// The directory that the members' dest directories are relative to.
+	Dest string
+
+	FS common.FS
+
+	// The value of --git-protocol.
+	GitProtocol string
+
+	// The value of --keep-temp-dirs.
+	KeepTempDirs bool
+
+	// The path to the stack file. Relative template locations in the stack
+	// file are relative to the directory containing it.
+	StackFile string
+
+	// The output stream used by "print" actions in the member templates.
+	Stdout io.Writer
+
+	// The values of --overlay. The overlay files are applied to the stack in
+	// this order before anything is rendered or upgraded.
+	Overlays []string
+
+	// The value of --quiet. If true, "print" actions don't print anything.
+	SuppressPrint bool
+
+	// Empty string, except in tests. Will be used as the parent of temp dirs.
+	TempDirBase string
+
+	// The value of --upgrade-channel.
+	UpgradeChannel string
+}
+
+// MemberResult is the outcome of rendering or upgrading one member of a stack.
+type MemberResult struct {
+	// The member's name from the stack file.
+	Name string
+
+	// The directory the member was rendered into.
+	Dest string
+
+	// The values of the outputs declared by the member's template.
+	Outputs map[string]string
+
+	// Only set by Upgrade. The "most severe" result of upgrading this member;
+	// see upgrade.Result.Overall.
+	UpgradeResult upgrade.ResultType
+
+	// Only set by Upgrade, and only if the upgrade needs the user's attention.
+	// The per-manifest details of the upgrade.
+	UpgradeDetails []*upgrade.ManifestResult
+}
+
+// Load reads the stack file at the given path, validating it and upgrading it
+// to the newest stack model.
+func Load(ctx context.Context, fs common.FS, path string) (*stack.Stack, error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stack file at %q: %w", path, err)
+	}
+	defer f.Close()
+
+	stackI, _, err := decode.DecodeValidateUpgrade(ctx, f, path, decode.KindStack)
+	if err != nil {
+		return nil, fmt.Errorf("error reading stack file: %w", err)
+	}
+
+	out, ok := stackI.(*stack.Stack)
+	if !ok {
+		return nil, common.InternalErrorf("stack file did not decode to *stack.Stack")
+	}
+	return out, nil
+}
+
+// Render renders every member of the stack into its dest directory, in the
+// order they're listed in the stack file. Members that have already been
+// rendered must be upgraded instead. Stops at the first error; the results of
+// the members rendered so far are returned along with it.
+func Render(ctx context.Context, p *Params) ([]*MemberResult, error) {
+	logger := logging.FromContext(ctx).With("logger", "stack.Render")
+
+	s, stackDir, err := loadForRun(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fail before rendering anything if any member was already installed, so
+	// that we don't leave the stack half-rendered.
+	for _, m := range s.Members {
+		dest := filepath.Join(p.Dest, filepath.FromSlash(m.Dest.Val))
+		manifests, err := indexutil.CrawlManifests(filepath.Join(dest, common.ABCInternalDir))
+		if err != nil {
+			return nil, fmt.Errorf("while crawling manifests: %w", err)
+		}
+		if len(manifests) > 0 {
+			return nil, m.Dest.Pos.Errorf(`member %q has already been rendered into %q; use "abc stacks upgrade" instead`, m.Name.Val, dest)
+		}
+	}
+
+	w := newWiring(s)
+	var out []*MemberResult
+	for _, m := range s.Members {
+		inputs, err := w.inputs(m)
+		if err != nil {
+			return out, err
+		}
+
+		source, err := registry.ResolveSource(stackDir, m.Source.Val)
+		if err != nil {
+			return out, err //nolint:wrapcheck
+		}
+		downloader, err := templatesource.ParseSource(ctx, &templatesource.ParseSourceParams{
+			CWD:                   stackDir,
+			Source:                source,
+			FlagGitProtocol:       p.GitProtocol,
+			FlagUpgradeChannel:    p.UpgradeChannel,
+			RequireUpgradeChannel: true,
+		})
+		if err != nil {
+			return out, fmt.Errorf("member %q: %w", m.Name.Val, err)
+		}
+
+		dest := filepath.Join(p.Dest, filepath.FromSlash(m.Dest.Val))
+		logger.DebugContext(ctx, "rendering stack member",
+			"member", m.Name.Val,
+			"source", source,
+			"dest", dest)
+
+		result, err := render.Render(ctx, &render.Params{
+			Clock:             p.Clock,
+			Cwd:               stackDir,
+			Downloader:        downloader,
+			FS:                p.FS,
+			GitProtocol:       p.GitProtocol,
+			InputsFromFlags:   inputs,
+			KeepTempDirs:      p.KeepTempDirs,
+			OutDir:            dest,
+			SourceForMessages: m.Source.Val,
+			Stdout:            p.Stdout,
+			SuppressPrint:     p.SuppressPrint,
+			TempDirBase:       p.TempDirBase,
+			UpgradeChannel:    p.UpgradeChannel,
+		})
+		if err != nil {
+			return out, fmt.Errorf("failed rendering member %q: %w", m.Name.Val, err)
+		}
+
+		w.outputs[m.Name.Val] = result.Outputs
+		out = append(out, &MemberResult{
+			Name:    m.Name.Val,
+			Dest:    dest,
+			Outputs: result.Outputs,
+		})
+	}
+	return out, nil
+}
+
+// Upgrade upgrades every member of the stack to the template location given
+// in the stack file, in the order they're listed, and with the inputs given in
+// the stack file. Stops at the first error or at the first member that needs
+// the user's attention (like a merge conflict), since later members may depend
+// on its outputs.
+func Upgrade(ctx context.Context, p *Params) ([]*MemberResult, error) {
+	logger := logging.FromContext(ctx).With("logger", "stack.Upgrade")
+
+	s, stackDir, err := loadForRun(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	w := newWiring(s)
+	var out []*MemberResult
+	for _, m := range s.Members {
+		inputs, err := w.inputs(m)
+		if err != nil {
+			return out, err
+		}
+
+		dest := filepath.Join(p.Dest, filepath.FromSlash(m.Dest.Val))
+		manifestPath, err := memberManifest(m, dest)
+		if err != nil {
+			return out, err
+		}
+
+		source, err := registry.ResolveSource(stackDir, m.Source.Val)
+		if err != nil {
+			return out, err //nolint:wrapcheck
+		}
+
+		logger.DebugContext(ctx, "upgrading stack member",
+			"member", m.Name.Val,
+			"source", source,
+			"manifest", manifestPath)
+
+		result := upgrade.UpgradeAll(ctx, &upgrade.Params{
+			Clock:            p.Clock,
+			CWD:              stackDir,
+			FS:               p.FS,
+			GitProtocol:      p.GitProtocol,
+			InputsFromFlags:  inputs,
+			KeepTempDirs:     p.KeepTempDirs,
+			Location:         manifestPath,
+			Stdout:           p.Stdout,
+			SuppressPrint:    p.SuppressPrint,
+			TempDirBase:      p.TempDirBase,
+			TemplateLocation: source,
+			UpgradeChannel:   p.UpgradeChannel,
+		})
+		if result.Err != nil {
+			return out, fmt.Errorf("failed upgrading member %q: %w", m.Name.Val, result.Err)
+		}
+
+		mr := &MemberResult{
+			Name:          m.Name.Val,
+			Dest:          dest,
+			UpgradeResult: result.Overall,
+		}
+		out = append(out, mr)
+		if result.Overall.RequiresUserAttention() {
+			mr.UpgradeDetails = result.Results
+			return out, nil
+		}
+
+		// The outputs aren't part of the upgrade result, but they're recorded
+		// in the manifest, which may have been rewritten by the upgrade.
+		manifestPath, err = memberManifest(m, dest)
+		if err != nil {
+			return out, err
+		}
+		mf, _, err := manifestutil.Load(ctx, p.FS, manifestPath)
+		if err != nil {
+			return out, err //nolint:wrapcheck
+		}
+		for _, o := range mf.Outputs {
+			if mr.Outputs == nil {
+				mr.Outputs = make(map[string]string, len(mf.Outputs))
+			}
+			mr.Outputs[o.Name.Val] = o.Value.Val
+		}
+		w.outputs[m.Name.Val] = mr.Outputs
+	}
+	return out, nil
+}
+
+// loadForRun loads the stack file and applies the overlays to it, returning
+// the result along with the absolute path of the directory containing the
+// stack file.
+func loadForRun(ctx context.Context, p *Params) (*stack.Stack, string, error) {
+	s, err := Load(ctx, p.FS, p.StackFile)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, path := range p.Overlays {
+		o, err := LoadOverlay(ctx, p.FS, path)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := applyOverlay(s, o); err != nil {
+			return nil, "", fmt.Errorf("failed applying stack overlay %q: %w", path, err)
+		}
+		if err := s.Validate(); err != nil {
+			return nil, "", fmt.Errorf("the stack is invalid after applying overlay %q: %w", path, err)
+		}
+	}
+	stackDir, err := filepath.Abs(filepath.Dir(p.StackFile))
+	if err != nil {
+		return nil, "", fmt.Errorf("filepath.Abs(%q): %w", filepath.Dir(p.StackFile), err)
+	}
+	return s, stackDir, nil
+}
+
+// memberManifest returns the path of the manifest of the given member, which
+// must be the only manifest in its dest directory.
+func memberManifest(m *stack.Member, dest string) (string, error) {
+	abcDir := filepath.Join(dest, common.ABCInternalDir)
+	manifests, err := indexutil.CrawlManifests(abcDir)
+	if err != nil {
+		return "", fmt.Errorf("while crawling manifests: %w", err)
+	}
+	switch len(manifests) {
+	case 0:
+		return "", m.Dest.Pos.Errorf(`member %q has not been rendered into %q yet; use "abc stacks render" first`, m.Name.Val, dest)
+	case 1:
+		return filepath.Join(abcDir, manifests[0]), nil
+	default:
+		return "", m.Dest.Pos.Errorf("member %q can't be upgraded because %q contains more than one manifest: %q", m.Name.Val, abcDir, manifests)
+	}
+}
+
+// wiring computes the inputs of each member from the stack's vars and the
+// outputs of the members that came before it.
+type wiring struct {
+	vars map[string]string
+
+	// Keyed by member name, then output name.
+	outputs map[string]map[string]string
+}
+
+func newWiring(s *stack.Stack) *wiring {
+	vars := make(map[string]string, len(s.Vars))
+	for _, v := range s.Vars {
+		vars[v.Name.Val] = v.Value.Val
+	}
+	return &wiring{
+		vars:    vars,
+		outputs: make(map[string]map[string]string, len(s.Members)),
+	}
+}
+
+// inputs executes the Go templates in the input values of the given member.
+func (w *wiring) inputs(m *stack.Member) (map[string]string, error) {
+	data := map[string]any{
+		"vars":    w.vars,
+		"outputs": w.outputs,
+	}
+	out := make(map[string]string, len(m.Inputs))
+	for _, in := range m.Inputs {
+		tmpl, err := template.New("").Funcs(funcs.Funcs(features.Features{})).Option("missingkey=error").Parse(in.Value.Val)
+		if err != nil {
+			return nil, in.Value.Pos.Errorf("error compiling input %q of member %q as go-template: %w", in.Name.Val, m.Name.Val, err)
+		}
+		var sb strings.Builder
+		if err := tmpl.Execute(&sb, data); err != nil {
+			return nil, in.Value.Pos.Errorf("failed computing input %q of member %q: %w", in.Name.Val, m.Name.Val, err)
+		}
+		out[in.Name.Val] = sb.String()
+	}
+	return out, nil
+}
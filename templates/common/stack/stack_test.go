@@ -0,0 +1,306 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/upgrade"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+const (
+	networkSpec = `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'a network'
+inputs:
+  - name: 'project_id'
+    desc: 'the project'
+steps:
+  - desc: 'include the network config'
+    action: 'include'
+    params:
+      paths: ['network.txt']
+  - desc: 'fill in the project'
+    action: 'go_template'
+    params:
+      paths: ['network.txt']
+outputs:
+  - name: 'vpc_name'
+    value: 'project_id + "-vpc"'
+`
+	serviceSpec = `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'a service'
+inputs:
+  - name: 'vpc'
+    desc: 'the network to attach to'
+steps:
+  - desc: 'include the service config'
+    action: 'include'
+    params:
+      paths: ['service.txt']
+  - desc: 'fill in the network'
+    action: 'go_template'
+    params:
+      paths: ['service.txt']
+`
+	stackYAML = `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Stack'
+vars:
+  - name: 'project_id'
+    value: '%s'
+members:
+  - name: 'network'
+    source: './templates/network'
+    dest: 'infra/network'
+    inputs:
+      - name: 'project_id'
+        value: '{{.vars.project_id}}'
+  - name: 'service'
+    source: './templates/service'
+    dest: 'services/api'
+    inputs:
+      - name: 'vpc'
+        value: '{{.outputs.network.vpc_name | toUpper}}'
+`
+)
+
+func TestRenderAndUpgrade(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	clk := clock.NewMock()
+	stackDir := t.TempDir()
+	destDir := t.TempDir()
+	abctestutil.WriteAll(t, stackDir, map[string]string{
+		"stack.yaml":                    stackWithProject("proj1"),
+		"templates/network/spec.yaml":   networkSpec,
+		"templates/network/network.txt": "project {{.project_id}}\n",
+		"templates/service/spec.yaml":   serviceSpec,
+		"templates/service/service.txt": "attached to {{.vpc}}\n",
+	})
+
+	p := &Params{
+		Clock:       clk,
+		Dest:        destDir,
+		FS:          &common.RealFS{},
+		StackFile:   filepath.Join(stackDir, "stack.yaml"),
+		Stdout:      io.Discard,
+		TempDirBase: t.TempDir(),
+	}
+
+	results, err := Render(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantResults := []*MemberResult{
+		{
+			Name:    "network",
+			Dest:    filepath.Join(destDir, "infra", "network"),
+			Outputs: map[string]string{"vpc_name": "proj1-vpc"},
+		},
+		{
+			Name: "service",
+			Dest: filepath.Join(destDir, "services", "api"),
+		},
+	}
+	if diff := cmp.Diff(results, wantResults); diff != "" {
+		t.Errorf("render results were not as expected (-got,+want): %s", diff)
+	}
+	wantDest := map[string]string{
+		"infra/network/network.txt": "project proj1\n",
+		"services/api/service.txt":  "attached to PROJ1-VPC\n",
+	}
+	got := abctestutil.LoadDir(t, destDir, abctestutil.SkipGlob("*/*/.abc/manifest*"))
+	if diff := cmp.Diff(got, wantDest); diff != "" {
+		t.Errorf("destination contents were not as expected after render (-got,+want): %s", diff)
+	}
+
+	// Rendering a second time is refused, since the members are installed.
+	_, err = Render(ctx, p)
+	if diff := testutil.DiffErrString(err, `member "network" has already been rendered`); diff != "" {
+		t.Error(diff)
+	}
+
+	// Changing a shared var flows through the first member's output into the
+	// second member's input.
+	abctestutil.Overwrite(t, filepath.Join(stackDir, "stack.yaml"), stackWithProject("proj2"))
+	clk.Add(1)
+	results, err = Upgrade(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantResults = []*MemberResult{
+		{
+			Name:          "network",
+			Dest:          filepath.Join(destDir, "infra", "network"),
+			Outputs:       map[string]string{"vpc_name": "proj2-vpc"},
+			UpgradeResult: upgrade.Success,
+		},
+		{
+			Name:          "service",
+			Dest:          filepath.Join(destDir, "services", "api"),
+			UpgradeResult: upgrade.Success,
+		},
+	}
+	if diff := cmp.Diff(results, wantResults); diff != "" {
+		t.Errorf("upgrade results were not as expected (-got,+want): %s", diff)
+	}
+	wantDest = map[string]string{
+		"infra/network/network.txt": "project proj2\n",
+		"services/api/service.txt":  "attached to PROJ2-VPC\n",
+	}
+	got = abctestutil.LoadDir(t, destDir, abctestutil.SkipGlob("*/*/.abc/manifest*"))
+	if diff := cmp.Diff(got, wantDest); diff != "" {
+		t.Errorf("destination contents were not as expected after upgrade (-got,+want): %s", diff)
+	}
+}
+
+func TestUpgrade_NotRendered(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	stackDir := t.TempDir()
+	abctestutil.WriteAll(t, stackDir, map[string]string{
+		"stack.yaml":                    stackWithProject("proj1"),
+		"templates/network/spec.yaml":   networkSpec,
+		"templates/network/network.txt": "project {{.project_id}}\n",
+	})
+
+	_, err := Upgrade(ctx, &Params{
+		Clock:       clock.NewMock(),
+		Dest:        t.TempDir(),
+		FS:          &common.RealFS{},
+		StackFile:   filepath.Join(stackDir, "stack.yaml"),
+		Stdout:      io.Discard,
+		TempDirBase: t.TempDir(),
+	})
+	if diff := testutil.DiffErrString(err, `member "network" has not been rendered into`); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func stackWithProject(projectID string) string {
+	return fmt.Sprintf(stackYAML, projectID)
+}
+
+func TestRender_Overlays(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		overlay  string
+		wantDest map[string]string
+		wantErr  string
+	}{
+		{
+			name: "override_var",
+			overlay: `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'StackOverlay'
+vars:
+  - name: 'project_id'
+    value: 'dev-project'
+`,
+			wantDest: map[string]string{
+				"infra/network/network.txt": "project dev-project\n",
+				"services/api/service.txt":  "attached to DEV-PROJECT-VPC\n",
+			},
+		},
+		{
+			name: "override_input",
+			overlay: `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'StackOverlay'
+members:
+  - name: 'service'
+    dest: 'services/api-dev'
+    inputs:
+      - name: 'vpc'
+        value: 'default'
+`,
+			wantDest: map[string]string{
+				"infra/network/network.txt":    "project proj1\n",
+				"services/api-dev/service.txt": "attached to default\n",
+			},
+		},
+		{
+			name: "remove_member",
+			overlay: `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'StackOverlay'
+remove_members: ['service']
+`,
+			wantDest: map[string]string{
+				"infra/network/network.txt": "project proj1\n",
+			},
+		},
+		{
+			name: "remove_member_whose_outputs_are_used",
+			overlay: `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'StackOverlay'
+remove_members: ['network']
+`,
+			wantErr: `references the outputs of "network", which is not a member of this stack`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			stackDir := t.TempDir()
+			destDir := t.TempDir()
+			abctestutil.WriteAll(t, stackDir, map[string]string{
+				"stack.yaml":                    stackWithProject("proj1"),
+				"overlay.yaml":                  tc.overlay,
+				"templates/network/spec.yaml":   networkSpec,
+				"templates/network/network.txt": "project {{.project_id}}\n",
+				"templates/service/spec.yaml":   serviceSpec,
+				"templates/service/service.txt": "attached to {{.vpc}}\n",
+			})
+
+			_, err := Render(ctx, &Params{
+				Clock:       clock.NewMock(),
+				Dest:        destDir,
+				FS:          &common.RealFS{},
+				Overlays:    []string{filepath.Join(stackDir, "overlay.yaml")},
+				StackFile:   filepath.Join(stackDir, "stack.yaml"),
+				Stdout:      io.Discard,
+				TempDirBase: t.TempDir(),
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			got := abctestutil.LoadDir(t, destDir, abctestutil.SkipGlob("*/*/.abc/manifest*"))
+			if diff := cmp.Diff(got, tc.wantDest); diff != "" {
+				t.Errorf("destination contents were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
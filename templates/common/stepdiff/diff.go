@@ -0,0 +1,207 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stepdiff
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common"
+)
+
+// contextLines is the number of unchanged lines shown around each change in a
+// unified diff, the same as the default for "diff -u" and "git diff".
+const contextLines = 3
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+// op is one line of an edit script. oldIdx and newIdx are the 0-based
+// positions in the old and new lines just before this op is applied.
+type op struct {
+	kind           opKind
+	line           string
+	oldIdx, newIdx int
+}
+
+// Unified returns a unified diff of the two versions of the file at path, in
+// the same format as "git diff". An empty old or new path means that the file
+// was added or deleted, respectively. Returns "" if nothing changed.
+func Unified(oldPath, newPath, oldContents, newContents string) string {
+	if oldPath == newPath && oldContents == newContents {
+		return ""
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", diffPath("a/", oldPath), diffPath("b/", newPath))
+	if isBinary(oldContents) || isBinary(newContents) {
+		fmt.Fprintf(&out, "Binary files differ\n")
+		return out.String()
+	}
+
+	ops := diffLines(common.SplitLines(oldContents), common.SplitLines(newContents))
+	for _, h := range hunks(ops) {
+		writeHunk(&out, ops[h[0]:h[1]])
+	}
+	return out.String()
+}
+
+func diffPath(prefix, path string) string {
+	if path == "" {
+		return "/dev/null"
+	}
+	return prefix + path
+}
+
+// isBinary uses the same heuristic as git: a file is binary if it contains a
+// NUL byte.
+func isBinary(s string) bool {
+	return strings.IndexByte(s, 0) >= 0
+}
+
+// diffLines returns a shortest edit script that turns a into b, using Myers'
+// algorithm.
+func diffLines(a, b []string) []op {
+	n, m := len(a), len(b)
+	offset := n + m
+	v := make([]int, 2*offset+2)
+	var trace [][]int
+	for d := 0; d <= offset; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1] // down: an insertion
+			} else {
+				x = v[offset+k-1] + 1 // right: a deletion
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b, offset)
+			}
+		}
+	}
+	panic("unreachable") // there's always an edit script of length n+m
+}
+
+// backtrack walks the trace from diffLines backwards to recover the edit
+// script.
+func backtrack(trace [][]int, a, b []string, offset int) []op {
+	x, y := len(a), len(b)
+	var ops []op
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, op{kind: opEqual, line: a[x], oldIdx: x, newIdx: y})
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, op{kind: opInsert, line: b[y-1], oldIdx: x, newIdx: y - 1})
+			} else {
+				ops = append(ops, op{kind: opDelete, line: a[x-1], oldIdx: x - 1, newIdx: y})
+			}
+		}
+		x, y = prevX, prevY
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// hunks returns the [start, end) ranges of ops that make up each hunk of a
+// unified diff. Changes separated by no more than 2*contextLines unchanged
+// lines share a hunk.
+func hunks(ops []op) [][2]int {
+	var out [][2]int
+	for i := 0; i < len(ops); i++ {
+		if ops[i].kind == opEqual {
+			continue
+		}
+		start := max(0, i-contextLines)
+		end := i + 1
+		for j := end; j < len(ops); j++ {
+			if ops[j].kind != opEqual {
+				end = j + 1
+			} else if j+1-end > 2*contextLines {
+				break
+			}
+		}
+		end = min(len(ops), end+contextLines)
+		out = append(out, [2]int{start, end})
+		i = end - 1
+	}
+	return out
+}
+
+func writeHunk(out *strings.Builder, ops []op) {
+	var oldLen, newLen int
+	for _, o := range ops {
+		if o.kind != opInsert {
+			oldLen++
+		}
+		if o.kind != opDelete {
+			newLen++
+		}
+	}
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(ops[0].oldIdx, oldLen), hunkRange(ops[0].newIdx, newLen))
+	for _, o := range ops {
+		prefix := " "
+		switch o.kind {
+		case opDelete:
+			prefix = "-"
+		case opInsert:
+			prefix = "+"
+		case opEqual:
+		}
+		out.WriteString(prefix + o.line)
+		if !strings.HasSuffix(o.line, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange formats one side of a hunk header. As in "diff -u", an empty range
+// starts at the line before it.
+func hunkRange(idx, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", idx)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", idx+1)
+	}
+	return fmt.Sprintf("%d,%d", idx+1, length)
+}
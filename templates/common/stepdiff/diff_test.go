@@ -0,0 +1,171 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stepdiff
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestUnified(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name             string
+		oldPath, newPath string
+		oldContents      string
+		newContents      string
+		want             string
+	}{
+		{
+			name:        "unchanged",
+			oldPath:     "a.txt",
+			newPath:     "a.txt",
+			oldContents: "one\n",
+			newContents: "one\n",
+			want:        "",
+		},
+		{
+			name:        "added",
+			newPath:     "a.txt",
+			newContents: "one\ntwo\n",
+			want: `--- /dev/null
++++ b/a.txt
+@@ -0,0 +1,2 @@
++one
++two
+`,
+		},
+		{
+			name:    "added_empty",
+			newPath: "a.txt",
+			want: `--- /dev/null
++++ b/a.txt
+`,
+		},
+		{
+			name:        "deleted",
+			oldPath:     "a.txt",
+			oldContents: "one\n",
+			want: `--- a/a.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-one
+`,
+		},
+		{
+			name:        "modified_middle_line",
+			oldPath:     "a.txt",
+			newPath:     "a.txt",
+			oldContents: "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			newContents: "1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			want: `--- a/a.txt
++++ b/a.txt
+@@ -2,7 +2,7 @@
+ 2
+ 3
+ 4
+-5
++five
+ 6
+ 7
+ 8
+`,
+		},
+		{
+			name:        "two_hunks",
+			oldPath:     "a.txt",
+			newPath:     "a.txt",
+			oldContents: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			newContents: "one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve\n",
+			want: `--- a/a.txt
++++ b/a.txt
+@@ -1,4 +1,4 @@
+-1
++one
+ 2
+ 3
+ 4
+@@ -9,4 +9,4 @@
+ 9
+ 10
+ 11
+-12
++twelve
+`,
+		},
+		{
+			name:        "nearby_changes_share_a_hunk",
+			oldPath:     "a.txt",
+			newPath:     "a.txt",
+			oldContents: "1\n2\n3\n4\n5\n6\n7\n8\n",
+			newContents: "one\n2\n3\n4\n5\n6\n7\neight\n",
+			want: `--- a/a.txt
++++ b/a.txt
+@@ -1,8 +1,8 @@
+-1
++one
+ 2
+ 3
+ 4
+ 5
+ 6
+ 7
+-8
++eight
+`,
+		},
+		{
+			name:        "no_newline_at_end",
+			oldPath:     "a.txt",
+			newPath:     "a.txt",
+			oldContents: "one\ntwo",
+			newContents: "one\ntwo\n",
+			want: `--- a/a.txt
++++ b/a.txt
+@@ -1,2 +1,2 @@
+ one
+-two
+\ No newline at end of file
++two
+`,
+		},
+		{
+			name:        "binary",
+			oldPath:     "a.bin",
+			newPath:     "a.bin",
+			oldContents: "\x00\x01",
+			newContents: "\x00\x02",
+			want: `--- a/a.bin
++++ b/a.bin
+Binary files differ
+`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := Unified(tc.oldPath, tc.newPath, tc.oldContents, tc.newContents)
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("unified diff was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package stepdiff records the changes that each step of a render makes to
+// the scratch directory, in pure Go, so that debugging a spec doesn't require
+// git to be installed.
+package stepdiff
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+
+	"github.com/abcxyz/abc/templates/common"
+)
+
+// Change is how a step changed a file.
+type Change string
+
+const (
+	Added    Change = "added"
+	Deleted  Change = "deleted"
+	Modified Change = "modified"
+)
+
+// FileDiff is the change that a step made to one file.
+type FileDiff struct {
+	// Path is relative to the scratch directory, with forward slashes.
+	Path   string
+	Change Change
+
+	// Unified is the unified diff of the file, as produced by Unified().
+	Unified string
+}
+
+// Step is the changes that one step made.
+type Step struct {
+	// Name describes the step, like "action include at line 12".
+	Name string
+
+	// Files is sorted by Path. It's empty if the step didn't change anything.
+	Files []*FileDiff
+}
+
+// Recorder takes a snapshot of a directory after each step, and records the
+// differences from the previous snapshot. It keeps file contents in memory,
+// which is fine for a debugging feature.
+type Recorder struct {
+	fs   common.FS
+	dir  string
+	prev map[string]string
+
+	steps []*Step
+}
+
+// NewRecorder returns a Recorder for the given directory, taking the initial
+// snapshot that the first step is compared against.
+func NewRecorder(fs common.FS, dir string) (*Recorder, error) {
+	r := &Recorder{fs: fs, dir: dir}
+	snap, err := r.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	r.prev = snap
+	return r, nil
+}
+
+// Record snapshots the directory, and records the differences since the last
+// snapshot as a step with the given name.
+func (r *Recorder) Record(name string) error {
+	snap, err := r.snapshot()
+	if err != nil {
+		return err
+	}
+	r.steps = append(r.steps, &Step{
+		Name:  name,
+		Files: diffSnapshots(r.prev, snap),
+	})
+	r.prev = snap
+	return nil
+}
+
+// Steps returns the steps recorded so far, in order.
+func (r *Recorder) Steps() []*Step {
+	return r.steps
+}
+
+// snapshot returns the contents of every file in the directory, keyed by
+// slash-separated relative path.
+func (r *Recorder) snapshot() (map[string]string, error) {
+	out := make(map[string]string)
+	err := filepath.WalkDir(r.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(r.dir, path)
+		if err != nil {
+			return fmt.Errorf("filepath.Rel(%q, %q): %w", r.dir, path, err)
+		}
+		buf, err := r.fs.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed reading %q: %w", path, err)
+		}
+		out[filepath.ToSlash(rel)] = string(buf)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed taking a snapshot of %q: %w", r.dir, err)
+	}
+	return out, nil
+}
+
+func diffSnapshots(before, after map[string]string) []*FileDiff {
+	var out []*FileDiff
+	for path, newContents := range after {
+		oldContents, ok := before[path]
+		switch {
+		case !ok:
+			out = append(out, &FileDiff{Path: path, Change: Added, Unified: Unified("", path, "", newContents)})
+		case oldContents != newContents:
+			out = append(out, &FileDiff{Path: path, Change: Modified, Unified: Unified(path, path, oldContents, newContents)})
+		}
+	}
+	for path, oldContents := range before {
+		if _, ok := after[path]; !ok {
+			out = append(out, &FileDiff{Path: path, Change: Deleted, Unified: Unified(path, "", oldContents, "")})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Path < out[j].Path
+	})
+	return out
+}
@@ -0,0 +1,117 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stepdiff
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+)
+
+func TestRecorder(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	abctestutil.WriteAll(t, dir, map[string]string{
+		"keep.txt":   "unchanged\n",
+		"edit.txt":   "old\n",
+		"delete.txt": "bye\n",
+	})
+
+	fs := &common.RealFS{}
+	rec, err := NewRecorder(fs, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	abctestutil.WriteAll(t, dir, map[string]string{
+		"edit.txt":    "new\n",
+		"sub/new.txt": "hi\n",
+	})
+	if err := os.Remove(filepath.Join(dir, "delete.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Record("action include at line 3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Record("action print at line 7"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*Step{
+		{
+			Name: "action include at line 3",
+			Files: []*FileDiff{
+				{
+					Path:    "delete.txt",
+					Change:  Deleted,
+					Unified: "--- a/delete.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-bye\n",
+				},
+				{
+					Path:    "edit.txt",
+					Change:  Modified,
+					Unified: "--- a/edit.txt\n+++ b/edit.txt\n@@ -1 +1 @@\n-old\n+new\n",
+				},
+				{
+					Path:    "sub/new.txt",
+					Change:  Added,
+					Unified: "--- /dev/null\n+++ b/sub/new.txt\n@@ -0,0 +1 @@\n+hi\n",
+				},
+			},
+		},
+		{
+			Name: "action print at line 7",
+		},
+	}
+	if diff := cmp.Diff(rec.Steps(), want); diff != "" {
+		t.Errorf("recorded steps were not as expected (-got,+want): %s", diff)
+	}
+
+	patchDir := t.TempDir()
+	if err := rec.WritePatches(patchDir); err != nil {
+		t.Fatal(err)
+	}
+	wantPatches := map[string]string{
+		"001-action-include-at-line-3.patch": want[0].Files[0].Unified + want[0].Files[1].Unified + want[0].Files[2].Unified,
+		"002-action-print-at-line-7.patch":   "",
+	}
+	if diff := cmp.Diff(abctestutil.LoadDir(t, patchDir), wantPatches); diff != "" {
+		t.Errorf("patch files were not as expected (-got,+want): %s", diff)
+	}
+
+	var html strings.Builder
+	if err := rec.WriteHTML(&html, "my report"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<title>my report</title>",
+		`<a href="#step-1">action include at line 3</a> (3 files changed)`,
+		`<span class="modified">modified</span> edit.txt`,
+		`<span class="add">&#43;new</span>`,
+		`<span class="del">-old</span>`,
+		`<li class="unchanged"><a href="#step-2">action print at line 7</a>`,
+		"<p>No changes.</p>",
+	} {
+		if !strings.Contains(html.String(), want) {
+			t.Errorf("HTML report doesn't contain %q:\n%s", want, html.String())
+		}
+	}
+}
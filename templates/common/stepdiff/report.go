@@ -0,0 +1,139 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stepdiff
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common"
+)
+
+// WritePatches writes the diffs of each step to dir, one patch file per step,
+// named like "001-action-include-at-line-12.patch". Steps that didn't change
+// anything get an empty patch file, so the numbering matches the steps.
+func (r *Recorder) WritePatches(dir string) error {
+	for i, s := range r.steps {
+		var patch strings.Builder
+		for _, f := range s.Files {
+			patch.WriteString(f.Unified)
+		}
+		name := fmt.Sprintf("%03d-%s.patch", i+1, slug(s.Name))
+		path := filepath.Join(dir, name)
+		if err := r.fs.WriteFile(path, []byte(patch.String()), common.OwnerRWPerms); err != nil {
+			return fmt.Errorf("failed writing %q: %w", path, err)
+		}
+	}
+	return nil
+}
+
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+func slug(s string) string {
+	return strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
+
+// WriteHTML writes a self-contained HTML page that shows the diffs made by
+// each step.
+func (r *Recorder) WriteHTML(w io.Writer, title string) error {
+	if err := reportTmpl.Execute(w, &reportData{Title: title, Steps: r.steps}); err != nil {
+		return fmt.Errorf("failed writing HTML report: %w", err)
+	}
+	return nil
+}
+
+type reportData struct {
+	Title string
+	Steps []*Step
+}
+
+// diffLine is one line of a unified diff, with the CSS class to show it with.
+type diffLine struct {
+	Class string
+	Text  string
+}
+
+func diffLinesForHTML(unified string) []diffLine {
+	lines := common.SplitLines(unified)
+	out := make([]diffLine, 0, len(lines))
+	for _, l := range lines {
+		class := ""
+		switch {
+		case strings.HasPrefix(l, "+++ "), strings.HasPrefix(l, "--- "):
+			class = "hdr"
+		case strings.HasPrefix(l, "@@"):
+			class = "hunk"
+		case strings.HasPrefix(l, "+"):
+			class = "add"
+		case strings.HasPrefix(l, "-"):
+			class = "del"
+		}
+		out = append(out, diffLine{Class: class, Text: strings.TrimSuffix(l, "\n")})
+	}
+	return out
+}
+
+var reportTmpl = template.Must(template.New("report").Funcs(template.FuncMap{
+	"lines": diffLinesForHTML,
+	"inc":   func(i int) int { return i + 1 },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+nav li.unchanged a { color: #888; }
+details { margin: 0.5em 0; }
+summary { cursor: pointer; font-family: monospace; }
+pre { background: #f6f8fa; padding: 0.5em; overflow-x: auto; }
+pre span { display: block; }
+.hdr { font-weight: bold; }
+.hunk { color: #6f42c1; }
+.add { background: #e6ffec; }
+.del { background: #ffebe9; }
+.added { color: #1a7f37; }
+.deleted { color: #cf222e; }
+.modified { color: #9a6700; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<nav><ol>
+{{- range $i, $s := .Steps}}
+<li{{if not $s.Files}} class="unchanged"{{end}}><a href="#step-{{inc $i}}">{{$s.Name}}</a> ({{len $s.Files}} files changed)</li>
+{{- end}}
+</ol></nav>
+{{- range $i, $s := .Steps}}
+<section id="step-{{inc $i}}">
+<h2>{{inc $i}}. {{$s.Name}}</h2>
+{{- if not $s.Files}}
+<p>No changes.</p>
+{{- end}}
+{{- range $s.Files}}
+<details open>
+<summary><span class="{{.Change}}">{{.Change}}</span> {{.Path}}</summary>
+<pre>{{range lines .Unified}}<span class="{{.Class}}">{{.Text}}</span>{{end}}</pre>
+</details>
+{{- end}}
+</section>
+{{- end}}
+</body>
+</html>
+`))
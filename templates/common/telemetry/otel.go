@@ -0,0 +1,123 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"github.com/abcxyz/pkg/logging"
+)
+
+// OTel is a Metrics that reports to an OpenTelemetry meter. Counts become
+// Int64Counters, and durations become Float64Histograms in seconds.
+type OTel struct {
+	meter metric.Meter
+
+	mu         sync.Mutex
+	counters   map[string]metric.Int64Counter
+	histograms map[string]metric.Float64Histogram
+}
+
+// NewOTel returns a Metrics that reports to the given meter.
+func NewOTel(meter metric.Meter) *OTel {
+	return &OTel{
+		meter:      meter,
+		counters:   make(map[string]metric.Int64Counter),
+		histograms: make(map[string]metric.Float64Histogram),
+	}
+}
+
+// Count implements Metrics.
+func (o *OTel) Count(ctx context.Context, name string, n int64, attrs ...Attr) {
+	o.mu.Lock()
+	c, ok := o.counters[name]
+	if !ok {
+		var err error
+		c, err = o.meter.Int64Counter(name)
+		if err != nil {
+			o.mu.Unlock()
+			logging.FromContext(ctx).DebugContext(ctx, "failed creating OpenTelemetry counter",
+				"name", name, "error", err)
+			return
+		}
+		o.counters[name] = c
+	}
+	o.mu.Unlock()
+
+	c.Add(ctx, n, metric.WithAttributes(otelAttrs(attrs)...))
+}
+
+// Duration implements Metrics.
+func (o *OTel) Duration(ctx context.Context, name string, d time.Duration, attrs ...Attr) {
+	o.mu.Lock()
+	h, ok := o.histograms[name]
+	if !ok {
+		var err error
+		h, err = o.meter.Float64Histogram(name, metric.WithUnit("s"))
+		if err != nil {
+			o.mu.Unlock()
+			logging.FromContext(ctx).DebugContext(ctx, "failed creating OpenTelemetry histogram",
+				"name", name, "error", err)
+			return
+		}
+		o.histograms[name] = h
+	}
+	o.mu.Unlock()
+
+	h.Record(ctx, d.Seconds(), metric.WithAttributes(otelAttrs(attrs)...))
+}
+
+func otelAttrs(attrs []Attr) []attribute.KeyValue {
+	out := make([]attribute.KeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		out = append(out, attribute.String(a.Key, a.Value))
+	}
+	return out
+}
+
+// NewOTLPExporter returns an OTel that sends metrics to an OTLP/HTTP collector,
+// along with a shutdown function that must be called to flush them before the
+// program exits. The collector's address and other settings are taken from the
+// standard OTEL_EXPORTER_OTLP_* environment variables.
+func NewOTLPExporter(ctx context.Context, serviceName, serviceVersion string) (*OTel, func(context.Context) error, error) {
+	exporter, err := otlpmetrichttp.New(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed creating OTLP metrics exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+		semconv.ServiceVersion(serviceVersion),
+	))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed creating OpenTelemetry resource: %w", err)
+	}
+
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)),
+		sdkmetric.WithResource(res),
+	)
+	return NewOTel(provider.Meter("github.com/abcxyz/abc")), provider.Shutdown, nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package telemetry is an opt-in hook for measuring how templates are used.
+// Renders, upgrades, and template downloads report counters and durations to
+// whatever Metrics implementation is in the context. By default that's Nop,
+// which discards them.
+package telemetry
+
+import (
+	"context"
+	"time"
+
+	"github.com/abcxyz/abc/templates/common"
+)
+
+// The names of the metrics that abc reports. Every metric carries an
+// "outcome" attribute; see Outcome().
+const (
+	// Downloads counts template downloads, and DownloadDuration measures them.
+	// Upgrades that reuse an already-downloaded template aren't counted.
+	Downloads        = "abc.downloads"
+	DownloadDuration = "abc.download.duration"
+
+	// Renders counts renders, including the ones done as part of an upgrade,
+	// and RenderDuration measures them.
+	Renders        = "abc.renders"
+	RenderDuration = "abc.render.duration"
+
+	// Upgrades counts the upgrade of each template installation, and
+	// UpgradeDuration measures it. The outcome of a successful upgrade is one
+	// of "success", "already_up_to_date", "merge_conflict", and
+	// "patch_reversal_conflict".
+	Upgrades        = "abc.upgrades"
+	UpgradeDuration = "abc.upgrade.duration"
+
+	// Conflicts counts the files that need manual resolution after an
+	// upgrade, whether merge conflicts or patch reversal conflicts.
+	Conflicts = "abc.upgrade.conflicts"
+)
+
+// OutcomeKey is the name of the attribute that says how an operation ended.
+const OutcomeKey = "outcome"
+
+// Attr is a key/value pair that's attached to a metric data point.
+type Attr struct {
+	Key   string
+	Value string
+}
+
+// Outcome returns the outcome attribute for an operation that returned err.
+// It's "success" if err is nil, and otherwise the name of the error's
+// category, like "download" or "input_validation".
+func Outcome(err error) Attr {
+	if err == nil {
+		return Attr{Key: OutcomeKey, Value: "success"}
+	}
+	return Attr{Key: OutcomeKey, Value: common.ErrorCategoryOf(err).String()}
+}
+
+// Metrics receives the metrics that abc reports. Implementations must be safe
+// for concurrent use, and must not block for long; there's no way for them to
+// fail the operation being measured.
+type Metrics interface {
+	// Count adds n to the counter with the given name.
+	Count(ctx context.Context, name string, n int64, attrs ...Attr)
+
+	// Duration records how long one run of an operation took.
+	Duration(ctx context.Context, name string, d time.Duration, attrs ...Attr)
+}
+
+// Nop is a Metrics that discards everything.
+type Nop struct{}
+
+// Count implements Metrics.
+func (Nop) Count(context.Context, string, int64, ...Attr) {}
+
+// Duration implements Metrics.
+func (Nop) Duration(context.Context, string, time.Duration, ...Attr) {}
+
+type metricsKey struct{}
+
+// WithMetrics returns a context that reports metrics to m.
+func WithMetrics(ctx context.Context, m Metrics) context.Context {
+	return context.WithValue(ctx, metricsKey{}, m)
+}
+
+// FromContext returns the Metrics that was stored in the context by
+// WithMetrics, or Nop if there isn't one.
+func FromContext(ctx context.Context) Metrics {
+	if m, ok := ctx.Value(metricsKey{}).(Metrics); ok && m != nil {
+		return m
+	}
+	return Nop{}
+}
+
+// Measure reports the count and duration of an operation that started at
+// start and returned err. It's meant to be deferred:
+//
+//	defer func(start time.Time) {
+//		telemetry.Measure(ctx, telemetry.Renders, telemetry.RenderDuration, start, rErr)
+//	}(time.Now())
+func Measure(ctx context.Context, countName, durationName string, start time.Time, err error, attrs ...Attr) {
+	m := FromContext(ctx)
+	attrs = append([]Attr{Outcome(err)}, attrs...)
+	m.Count(ctx, countName, 1, attrs...)
+	m.Duration(ctx, durationName, time.Since(start), attrs...)
+}
@@ -0,0 +1,173 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/abcxyz/abc/templates/common"
+)
+
+type fakeMetrics struct {
+	mu        sync.Mutex
+	counts    map[string]int64
+	durations []string
+}
+
+func (f *fakeMetrics) Count(_ context.Context, name string, n int64, attrs ...Attr) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.counts == nil {
+		f.counts = map[string]int64{}
+	}
+	f.counts[fmt.Sprintf("%s%v", name, attrs)] += n
+}
+
+func (f *fakeMetrics) Duration(_ context.Context, name string, _ time.Duration, attrs ...Attr) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.durations = append(f.durations, fmt.Sprintf("%s%v", name, attrs))
+}
+
+func TestFromContext_DefaultsToNop(t *testing.T) {
+	t.Parallel()
+
+	if got, want := FromContext(context.Background()), (Nop{}); got != want {
+		t.Errorf("FromContext() = %#v, want %#v", got, want)
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name          string
+		err           error
+		wantCounts    map[string]int64
+		wantDurations []string
+	}{
+		{
+			name:          "success",
+			wantCounts:    map[string]int64{"abc.renders[{outcome success}]": 1},
+			wantDurations: []string{"abc.render.duration[{outcome success}]"},
+		},
+		{
+			name:          "uncategorized_error",
+			err:           errors.New("oops"),
+			wantCounts:    map[string]int64{"abc.renders[{outcome unknown}]": 1},
+			wantDurations: []string{"abc.render.duration[{outcome unknown}]"},
+		},
+		{
+			name:          "categorized_error",
+			err:           common.WithCategory(common.CategoryInputValidation, errors.New("oops")),
+			wantCounts:    map[string]int64{"abc.renders[{outcome input_validation}]": 1},
+			wantDurations: []string{"abc.render.duration[{outcome input_validation}]"},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			m := &fakeMetrics{}
+			ctx := WithMetrics(context.Background(), m)
+			Measure(ctx, Renders, RenderDuration, time.Now(), tc.err)
+
+			if diff := cmp.Diff(m.counts, tc.wantCounts); diff != "" {
+				t.Errorf("counts were not as expected (-got,+want): %s", diff)
+			}
+			if diff := cmp.Diff(m.durations, tc.wantDurations); diff != "" {
+				t.Errorf("durations were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestOTel(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	o := NewOTel(provider.Meter("test"))
+
+	outcome := Attr{Key: OutcomeKey, Value: "merge_conflict"}
+	o.Count(ctx, Conflicts, 2, outcome)
+	o.Count(ctx, Conflicts, 3, outcome)
+	o.Duration(ctx, UpgradeDuration, 1500*time.Millisecond, outcome)
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatal(err)
+	}
+	if len(rm.ScopeMetrics) != 1 {
+		t.Fatalf("got %d scopes, want 1", len(rm.ScopeMetrics))
+	}
+
+	got := map[string]any{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		switch data := m.Data.(type) {
+		case metricdata.Sum[int64]:
+			for _, dp := range data.DataPoints {
+				v, _ := dp.Attributes.Value(OutcomeKey)
+				got[m.Name+"/"+v.AsString()] = dp.Value
+			}
+		case metricdata.Histogram[float64]:
+			for _, dp := range data.DataPoints {
+				v, _ := dp.Attributes.Value(OutcomeKey)
+				got[m.Name+"/"+v.AsString()] = dp.Sum
+			}
+			if m.Unit != "s" {
+				t.Errorf("got unit %q for %s, want \"s\"", m.Unit, m.Name)
+			}
+		default:
+			t.Errorf("unexpected data type %T for %s", m.Data, m.Name)
+		}
+	}
+
+	want := map[string]any{
+		"abc.upgrade.conflicts/merge_conflict": int64(5),
+		"abc.upgrade.duration/merge_conflict":  1.5,
+	}
+	if diff := cmp.Diff(got, want, cmpopts.EquateApprox(0, 0.001)); diff != "" {
+		t.Errorf("collected metrics were not as expected (-got,+want): %s", diff)
+	}
+}
+
+func TestNewOTLPExporter(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	o, shutdown, err := NewOTLPExporter(ctx, "abc", "0.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o == nil {
+		t.Fatal("got nil OTel")
+	}
+	// There's no collector to flush to, so the error is expected.
+	_ = shutdown(ctx)
+}
@@ -18,6 +18,10 @@ const (
 	// These will be used as part of the names of the temporary directories to
 	// make them identifiable.
 
+	// The temp directory where "render --dest=-" or "render --archive" writes
+	// the output files before they're packed into an archive.
+	ArchiveDirNamePart = "archive-"
+
 	// The directory that contains a diff for each template rendering step to
 	// help with template debugging. Must be enabled by command line flag.
 	DebugStepDiffsDirNamePart = "debug-step-diffs-"
@@ -26,13 +30,41 @@ const (
 	// output before comparing to the "wanted" output.
 	GoldenTestRenderNamePart = "golden-test-"
 
+	// The temp directory where "render --show-diff" renders the template
+	// before diffing it against the destination directory.
+	ShowDiffDirNamePart = "show-diff-"
+
+	// The temp directory where "render --github-repo" puts the existing files
+	// from the GitHub repo and renders the template before committing the
+	// output through the GitHub API.
+	GitHubDirNamePart = "github-"
+
+	// The temp directory where "render --reconcile" renders the template
+	// before comparing it with the destination directory.
+	ReconcileDirNamePart = "reconcile-"
+
+	// The directory where a render keeps its progress so it can be picked up
+	// with --resume if it's interrupted. Unlike the other directories here,
+	// the rest of its name isn't random; it's derived from the destination
+	// directory, so that the resuming render can find it.
+	ResumeDirNamePart = "resume-"
+
 	// The temp directory where templates perform their actions and "include"
 	// into, before it is committed to the user-visible destination directory.
 	ScratchDirNamePart = "scratch-"
 
+	// The temp directory where "abc templates validate --render-check" renders
+	// a template, discarding the output.
+	RenderCheckDirNamePart = "render-check-"
+
 	// The temp directory that contains the downloaded template.
 	TemplateDirNamePart = "template-copy-"
 
+	// The temp directory where an upgrade of many manifests keeps a pristine
+	// copy of a downloaded template, so other manifests installed from the
+	// same template don't have to download it again.
+	TemplateCacheDirNamePart = "template-cache-"
+
 	// The temp directory where the upgrade operation renders the upgraded
 	// version of the template, before it is merged with the user-visible
 	// destination directory.
@@ -44,6 +76,10 @@ const (
 	// included-from-destination file.
 	ReversedPatchDirNamePart = "reversed-patch-"
 
+	// The temp directory where "include" actions with "from: remote" download
+	// the sources they include files from.
+	RemoteIncludeDirNamePart = "remote-include-"
+
 	// The temp directory where files are staged before feeding them to "git
 	// diff --no-index". This is needed because git diff doesn't have the
 	// ability to override the filename labels in the diff output, you have to
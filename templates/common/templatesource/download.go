@@ -80,6 +80,17 @@ type DownloadMetadata struct {
 
 	// Values for template variables like _git_tag and _git_sha.
 	Vars DownloaderVars
+
+	// The commit SHAs of the git submodules inside the downloaded template
+	// directory, keyed by slash-separated path relative to that directory.
+	// These are part of the template's dirhash, so that bumping a submodule
+	// counts as a template change. Empty if the template has no submodules.
+	Submodules map[string]string
+
+	// Set when the template was taken from the same git repo as the
+	// destination directory, which is the common monorepo layout where
+	// templates live under e.g. "templates/". Nil otherwise.
+	Repo *RepoLocation
 }
 
 // Values for template variables like _git_tag and _git_sha.
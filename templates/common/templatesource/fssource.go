@@ -0,0 +1,97 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templatesource
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/pkg/logging"
+)
+
+var _ Downloader = (*FSDownloader)(nil)
+
+// FSDownloader implements Downloader for a template in an fs.FS, like an
+// embed.FS compiled into the program or an fstest.MapFS. Together with
+// common.MemFS, it lets a program render templates without touching the local
+// disk. It's only for library users; there's no template location syntax that
+// refers to it.
+type FSDownloader struct {
+	// Src has the template.
+	Src fs.FS
+
+	// Dir is the slash-separated path of the template directory within Src,
+	// like "templates/hello". If empty, the root of Src is used.
+	Dir string
+
+	// FS is the filesystem that the template is copied into. It should be the
+	// same as the FS that the template is rendered with.
+	FS common.FS
+
+	// Version, if set, is reported as the template's version, since an fs.FS
+	// has no version of its own.
+	Version string
+}
+
+// Download implements Downloader.
+func (d *FSDownloader) Download(ctx context.Context, cwd, templateDir, _ string) (*DownloadMetadata, error) {
+	logger := logging.FromContext(ctx).With("logger", "FSDownloader.Download")
+
+	templateDir = common.JoinIfRelative(cwd, templateDir)
+	root := path.Clean(d.Dir)
+	if d.Dir == "" {
+		root = "."
+	}
+
+	logger.DebugContext(ctx, "copying template from fs.FS",
+		"dir", root,
+		"template_dir", templateDir)
+	if err := fs.WalkDir(d.Src, root, func(p string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel := "."
+		if p != root {
+			rel = p[len(root)+1:]
+			if root == "." {
+				rel = p
+			}
+		}
+		dst := filepath.Join(templateDir, filepath.FromSlash(rel))
+		if de.IsDir() {
+			return d.FS.MkdirAll(dst, common.OwnerRWXPerms) //nolint:wrapcheck
+		}
+		if !de.Type().IsRegular() {
+			return fmt.Errorf("%q isn't a regular file or directory", p)
+		}
+		info, err := de.Info()
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		buf, err := fs.ReadFile(d.Src, p)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		return d.FS.WriteFile(dst, buf, info.Mode().Perm()|common.OwnerRWPerms) //nolint:wrapcheck
+	}); err != nil {
+		return nil, fmt.Errorf("failed copying template from %q: %w", root, err)
+	}
+
+	return &DownloadMetadata{Version: d.Version}, nil
+}
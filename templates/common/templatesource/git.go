@@ -23,25 +23,27 @@ import (
 
 	"github.com/Masterminds/semver/v3"
 
-	"github.com/abcxyz/abc/templates/common/git"
+	"github.com/abcxyz/abc/templates/common/vcs"
 )
 
 var sha = regexp.MustCompile("^[0-9a-f]{40}$")
 
-// gitCanonicalVersion examines a template directory and tries to determine the
-// "best" template version by looking at .git. The "best" template version is
-// defined as (in decreasing order of precedence):
+// canonicalVersion examines a template directory and tries to determine the
+// "best" template version by looking at the version control system of the
+// workspace containing it. The "best" template version is defined as (in
+// decreasing order of precedence):
 //
 //   - tags in decreasing order of semver (recent releases first)
 //   - other non-semver tags in reverse alphabetical order
-//   - the HEAD SHA
+//   - the current revision, like the HEAD SHA in git
 //
-// It returns false if the given directory is not in a git workspace.
+// It returns false if the given directory is not in a version-controlled
+// workspace, or if the workspace's VCS can't provide a version (see vcs.None).
 //
-// It returns error only if something weird happened when running git commands.
+// It returns error only if something weird happened when running VCS commands.
 // The returned string is always empty if the boolean is false.
-func gitCanonicalVersion(ctx context.Context, dir string) (string, bool, error) {
-	_, ok, err := git.Workspace(ctx, dir)
+func canonicalVersion(ctx context.Context, dir string) (string, bool, error) {
+	ws, ok, err := vcs.Detect(ctx, dir)
 	if err != nil {
 		return "", false, err //nolint:wrapcheck
 	}
@@ -49,7 +51,7 @@ func gitCanonicalVersion(ctx context.Context, dir string) (string, bool, error)
 		return "", false, nil
 	}
 
-	tag, ok, err := bestHeadTag(ctx, dir)
+	tag, ok, err := bestHeadTag(ctx, ws.VCS, dir)
 	if err != nil {
 		return "", false, err
 	}
@@ -57,21 +59,17 @@ func gitCanonicalVersion(ctx context.Context, dir string) (string, bool, error)
 		return tag, true, nil
 	}
 
-	sha, err := git.CurrentSHA(ctx, dir)
-	if err != nil {
-		return "", false, err //nolint:wrapcheck
-	}
-	return sha, true, nil
+	return ws.VCS.HeadRevision(ctx, dir) //nolint:wrapcheck
 }
 
-// bestHeadTag returns the tag that points to the current HEAD SHA. If there are
-// multiple such tags, the precedence order is:
+// bestHeadTag returns the tag that points to the current revision. If there
+// are multiple such tags, the precedence order is:
 //   - tags in decreasing order of semver (recent releases first)
 //   - other non-semver tags in reverse alphabetical order
 //
-// Returns false if there are no tags pointing to HEAD.
-func bestHeadTag(ctx context.Context, dir string) (string, bool, error) {
-	tags, err := git.HeadTags(ctx, dir)
+// Returns false if there are no tags pointing to the current revision.
+func bestHeadTag(ctx context.Context, v vcs.VCS, dir string) (string, bool, error) {
+	tags, err := v.HeadTags(ctx, dir)
 	if err != nil {
 		return "", false, err //nolint:wrapcheck
 	}
@@ -0,0 +1,115 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templatesource
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/git"
+)
+
+// RepoLocation describes a template that lives in the same git repo as the
+// directory it was rendered into. Recording the template's path relative to
+// the repo root, rather than only relative to the destination, lets upgrades
+// find the template even after the destination has moved within the repo, and
+// lets them read older or newer versions of the template from the repo's own
+// history without needing a separate checkout.
+type RepoLocation struct {
+	// The slash-separated path of the template directory relative to the
+	// root of the repo, e.g. "templates/my-service".
+	Path string
+
+	// The URL of the repo's "origin" remote, if it has one. This is purely
+	// informational; it identifies which repo Path is relative to.
+	RemoteURL string
+}
+
+// inRepoLocation returns the RepoLocation of the given template directory, or
+// nil if it's not in a git repo.
+func inRepoLocation(ctx context.Context, srcPath string) (*RepoLocation, error) {
+	root, ok, err := git.Workspace(ctx, srcPath)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	if !ok {
+		return nil, nil
+	}
+	relPath, err := filepath.Rel(root, srcPath)
+	if err != nil {
+		return nil, fmt.Errorf("filepath.Rel(%q,%q): %w", root, srcPath, err)
+	}
+	remoteURL, _, err := git.OriginURL(ctx, root)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	return &RepoLocation{
+		Path:      filepath.ToSlash(relPath),
+		RemoteURL: remoteURL,
+	}, nil
+}
+
+// repoHistoryDownloader implements Downloader. It reads a template that's
+// stored in the destination's own git repo at some committed version (a tag,
+// branch, SHA, or "latest"), rather than from the working tree.
+type repoHistoryDownloader struct {
+	// The absolute path of the root of the git workspace.
+	repoRoot string
+
+	repo RepoLocation
+
+	// A tag, branch, SHA, or the magic value "latest".
+	version string
+
+	// The value of --upgrade-channel.
+	flagUpgradeChannel string
+
+	skipSubmodules bool
+}
+
+// Download implements Downloader.
+func (r *repoHistoryDownloader) Download(ctx context.Context, cwd, templateDir, destDir string) (*DownloadMetadata, error) {
+	absSrcPath := filepath.Join(r.repoRoot, filepath.FromSlash(r.repo.Path))
+	absDestDir := common.JoinIfRelative(cwd, destDir)
+	canonicalSource, err := filepath.Rel(absDestDir, absSrcPath)
+	if err != nil {
+		return nil, fmt.Errorf("filepath.Rel(%q,%q): %w", absDestDir, absSrcPath, err)
+	}
+	canonicalSource = filepath.ToSlash(canonicalSource)
+
+	// The local repo is cloned just like a remote one would be. Cloning from a
+	// local path is cheap because git hardlinks the objects, and it means the
+	// working tree (which may have uncommitted changes) is never touched.
+	g := &remoteGitDownloader{
+		remote:             r.repoRoot,
+		subdir:             r.repo.Path,
+		version:            r.version,
+		canonicalSource:    canonicalSource,
+		cloner:             &realCloner{},
+		flagUpgradeChannel: r.flagUpgradeChannel,
+		skipSubmodules:     r.skipSubmodules,
+	}
+	dlMeta, err := g.Download(ctx, cwd, templateDir, destDir)
+	if err != nil {
+		return nil, err
+	}
+
+	dlMeta.LocationType = LocalGit
+	repo := r.repo
+	dlMeta.Repo = &repo
+	return dlMeta, nil
+}
@@ -0,0 +1,169 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templatesource
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common/run"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestRepoHistoryDownloader_Download(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	// The repo has the template at v1 in the tagged first commit, at v2 in
+	// the second commit on main, and at v3 as an uncommitted change.
+	repoRoot := t.TempDir()
+	abctestutil.WriteAll(t, repoRoot, abctestutil.WithGitRepoAt("", map[string]string{
+		"templates/foo/spec.yaml": "v1",
+	}))
+	mustGit := func(args ...string) string {
+		t.Helper()
+		stdout, _, err := run.Simple(ctx, append([]string{"git", "-C", repoRoot}, args...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(stdout)
+	}
+	mustGit("config", "user.email", "fake@example.com")
+	mustGit("config", "user.name", "Nobody")
+	mustGit("add", "-A")
+	mustGit("commit", "--no-gpg-sign", "-m", "v1")
+	mustGit("tag", "v1.0.0")
+	sha1 := mustGit("rev-parse", "HEAD")
+	abctestutil.WriteAll(t, repoRoot, map[string]string{"templates/foo/spec.yaml": "v2"})
+	mustGit("commit", "--no-gpg-sign", "-am", "v2")
+	sha2 := mustGit("rev-parse", "HEAD")
+	abctestutil.WriteAll(t, repoRoot, map[string]string{"templates/foo/spec.yaml": "v3"})
+
+	repo := &RepoLocation{
+		Path:      "templates/foo",
+		RemoteURL: "https://github.com/myorg/monorepo.git",
+	}
+
+	cases := []struct {
+		name       string
+		version    string
+		wantSpec   string
+		wantDLMeta *DownloadMetadata
+		wantErr    string
+	}{
+		{
+			name:     "semver_tag",
+			version:  "v1.0.0",
+			wantSpec: "v1",
+			wantDLMeta: &DownloadMetadata{
+				Version:        "v1.0.0",
+				UpgradeChannel: Latest,
+				Vars: DownloaderVars{
+					GitTag:      "v1.0.0",
+					GitSHA:      sha1,
+					GitShortSHA: sha1[:7],
+				},
+			},
+		},
+		{
+			name:     "latest",
+			version:  Latest,
+			wantSpec: "v1",
+			wantDLMeta: &DownloadMetadata{
+				Version:        "v1.0.0",
+				UpgradeChannel: Latest,
+				Vars: DownloaderVars{
+					GitTag:      "v1.0.0",
+					GitSHA:      sha1,
+					GitShortSHA: sha1[:7],
+				},
+			},
+		},
+		{
+			name:     "branch",
+			version:  "main",
+			wantSpec: "v2",
+			wantDLMeta: &DownloadMetadata{
+				Version:        sha2,
+				UpgradeChannel: "main",
+				Vars: DownloaderVars{
+					GitSHA:      sha2,
+					GitShortSHA: sha2[:7],
+				},
+			},
+		},
+		{
+			name:     "sha",
+			version:  sha1,
+			wantSpec: "v1",
+			wantDLMeta: &DownloadMetadata{
+				Version: sha1,
+				Vars: DownloaderVars{
+					GitTag:      "v1.0.0",
+					GitSHA:      sha1,
+					GitShortSHA: sha1[:7],
+				},
+			},
+		},
+		{
+			name:    "nonexistent_version",
+			version: "v9.9.9",
+			wantErr: "the template ../templates/foo is no longer available",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			templateDir := t.TempDir()
+			d := &repoHistoryDownloader{
+				repoRoot: repoRoot,
+				repo:     *repo,
+				version:  tc.version,
+			}
+			got, err := d.Download(ctx, repoRoot, templateDir, filepath.Join(repoRoot, "dest"))
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			// Every successful download is from the same place.
+			want := *tc.wantDLMeta
+			want.IsCanonical = true
+			want.CanonicalSource = "../templates/foo"
+			want.LocationType = LocalGit
+			want.Repo = repo
+			if diff := cmp.Diff(got, &want); diff != "" {
+				t.Errorf("DownloadMetadata was not as expected (-got,+want): %s", diff)
+			}
+
+			gotFiles := abctestutil.LoadDir(t, templateDir)
+			if diff := cmp.Diff(gotFiles, map[string]string{"spec.yaml": tc.wantSpec}); diff != "" {
+				t.Errorf("template files were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
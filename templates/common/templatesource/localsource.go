@@ -23,7 +23,7 @@ import (
 	"path/filepath"
 
 	"github.com/abcxyz/abc/templates/common"
-	"github.com/abcxyz/abc/templates/common/git"
+	"github.com/abcxyz/abc/templates/common/vcs"
 	"github.com/abcxyz/pkg/logging"
 )
 
@@ -90,21 +90,39 @@ func (l *LocalDownloader) Download(ctx context.Context, cwd, templateDir, destDi
 
 	templateDir = common.JoinIfRelative(cwd, templateDir)
 
+	if _, err := os.Stat(l.SrcPath); err != nil {
+		if common.IsNotExistErr(err) {
+			return nil, &SourceUnavailableError{Source: l.SrcPath, Err: err}
+		}
+		return nil, err //nolint:wrapcheck
+	}
+
 	logger.DebugContext(ctx, "copying local template source",
 		"src_path", l.SrcPath,
 		"template_dir", templateDir)
-	if err := common.CopyRecursive(ctx, nil, &common.CopyParams{
+	if _, err := common.CopyRecursive(ctx, nil, &common.CopyParams{
 		SrcRoot: l.SrcPath,
 		DstRoot: templateDir,
 		FS:      &common.RealFS{},
+		// Keep the template's modification times, in case the template uses
+		// file_metadata: 'preserve'.
+		PreserveMetadata: true,
 		Visitor: func(relPath string, de fs.DirEntry) (common.CopyHint, error) {
 			return common.CopyHint{
-				Skip: relPath == ".git",
+				Skip: vcs.IsMetadataDir(relPath),
 			}, nil
 		},
 	}); err != nil {
 		return nil, err //nolint:wrapcheck
 	}
+	return l.MetadataFor(ctx, cwd, destDir)
+}
+
+// MetadataFor returns the DownloadMetadata that Download would return for the
+// given destDir, without copying anything. Whether a local source is canonical
+// depends on the destination, so a template that's downloaded once and
+// rendered into more than one destination needs this for each of them.
+func (l *LocalDownloader) MetadataFor(ctx context.Context, cwd, destDir string) (*DownloadMetadata, error) {
 	gitVars, err := gitTemplateVars(ctx, l.SrcPath)
 	if err != nil {
 		return nil, err
@@ -113,12 +131,19 @@ func (l *LocalDownloader) Download(ctx context.Context, cwd, templateDir, destDi
 	if err != nil {
 		return nil, err
 	}
+	var repo *RepoLocation
+	if canonicalSource != "" {
+		if repo, err = inRepoLocation(ctx, l.SrcPath); err != nil {
+			return nil, err
+		}
+	}
 	dlMeta := &DownloadMetadata{
 		IsCanonical:     canonicalSource != "",
 		CanonicalSource: canonicalSource,
 		LocationType:    locType,
 		Version:         version,
 		Vars:            *gitVars,
+		Repo:            repo,
 	}
 	return dlMeta, nil
 }
@@ -133,38 +158,44 @@ func canonicalize(ctx context.Context, cwd, source, destDir string) (canonicalSo
 	absSource := common.JoinIfRelative(cwd, source)
 	absDestDir := common.JoinIfRelative(cwd, destDir)
 
-	// See the docs on DownloadMetadata for an explanation of why we compare the git
+	// See the docs on DownloadMetadata for an explanation of why we compare the
 	// workspaces to decide if source is canonical.
-	sourceGitWorkspace, sourceIsGit, err := git.Workspace(ctx, absSource)
+	sourceWorkspace, sourceIsVCS, err := vcs.Detect(ctx, absSource)
 	if err != nil {
 		return "", "", "", err //nolint:wrapcheck
 	}
-	destGitWorkspace, destIsGit, err := git.Workspace(ctx, absDestDir)
+	destWorkspace, destIsVCS, err := vcs.Detect(ctx, absDestDir)
 	if err != nil {
 		return "", "", "", err //nolint:wrapcheck
 	}
-	if !sourceIsGit {
+	if !sourceIsVCS {
 		return "", "", LocalNonGit, nil
 	}
-	if !destIsGit || sourceGitWorkspace != destGitWorkspace {
-		logger.DebugContext(ctx, "local template source is not canonical, template dir and dest dir do not share a git workspace",
+	if !destIsVCS || sourceWorkspace.Root != destWorkspace.Root {
+		var destRoot string
+		if destIsVCS {
+			destRoot = destWorkspace.Root
+		}
+		logger.DebugContext(ctx, "local template source is not canonical, template dir and dest dir do not share a workspace",
 			"source_dir", absSource,
 			"dest_dir", absDestDir,
-			"source_git_workspace", sourceGitWorkspace,
-			"dest_git_workspace", destGitWorkspace)
+			"source_workspace", sourceWorkspace.Root,
+			"dest_workspace", destRoot)
 		return "", "", LocalGit, nil
 	}
 
-	logger.DebugContext(ctx, "local template source is canonical because template dir and dest dir are both in the same git workspace",
+	logger.DebugContext(ctx, "local template source is canonical because template dir and dest dir are both in the same workspace",
 		"source_dir", absSource,
 		"dest", absDestDir,
-		"git_workspace", destGitWorkspace)
+		"workspace", destWorkspace.Root,
+		"vcs", destWorkspace.VCS.Name())
 	out, err := filepath.Rel(absDestDir, absSource)
 	if err != nil {
 		return "", "", "", fmt.Errorf("filepath.Rel(%q,%q): %w", absDestDir, absSource, err)
 	}
 
-	version, _, err = gitCanonicalVersion(ctx, sourceGitWorkspace)
+	// The version may be empty if the VCS can't provide one.
+	version, _, err = canonicalVersion(ctx, sourceWorkspace.Root)
 	if err != nil {
 		return "", "", "", err
 	}
@@ -59,7 +59,7 @@ func TestLocalDownloader_Download(t *testing.T) {
 		{
 			name:        "nonexistent_source",
 			copyFromDir: "nonexistent",
-			wantErr:     "nonexistent",
+			wantErr:     "is no longer available",
 		},
 		{
 			name:                     "dest_dir_in_same_git_workspace",
@@ -84,6 +84,7 @@ func TestLocalDownloader_Download(t *testing.T) {
 					GitShortSHA: abctestutil.MinimalGitHeadShortSHA,
 					GitTag:      "",
 				},
+				Repo: &RepoLocation{Path: "copy_from"},
 			},
 		},
 		{
@@ -114,6 +115,34 @@ func TestLocalDownloader_Download(t *testing.T) {
 					GitShortSHA: abctestutil.MinimalGitHeadShortSHA,
 					GitTag:      "mytag",
 				},
+				Repo: &RepoLocation{Path: "copy_from"},
+			},
+		},
+		{
+			name:                     "dest_dir_in_same_git_workspace_with_origin_remote",
+			copyFromDir:              "templates/copy_from",
+			destDirForCanonicalCheck: "services/dest",
+			initialTempDirContents: abctestutil.WithGitRepoAt("",
+				map[string]string{
+					"templates/copy_from/spec.yaml": "spec contents",
+					".git/config":                   "[remote \"origin\"]\n\turl = https://github.com/myorg/monorepo.git\n",
+				}),
+			wantTemplateDirFiles: map[string]string{
+				"spec.yaml": "spec contents",
+			},
+			wantDLMeta: &DownloadMetadata{
+				IsCanonical:     true,
+				CanonicalSource: "../../templates/copy_from",
+				LocationType:    "local_git",
+				Version:         abctestutil.MinimalGitHeadSHA,
+				Vars: DownloaderVars{
+					GitSHA:      abctestutil.MinimalGitHeadSHA,
+					GitShortSHA: abctestutil.MinimalGitHeadShortSHA,
+				},
+				Repo: &RepoLocation{
+					Path:      "templates/copy_from",
+					RemoteURL: "https://github.com/myorg/monorepo.git",
+				},
 			},
 		},
 		{
@@ -147,6 +176,24 @@ func TestLocalDownloader_Download(t *testing.T) {
 					GitShortSHA: abctestutil.MinimalGitHeadShortSHA,
 					GitTag:      "",
 				},
+				Repo: &RepoLocation{Path: "copy_from"},
+			},
+		},
+		{
+			name:                     "dest_dir_in_same_mercurial_workspace",
+			copyFromDir:              "copy_from",
+			destDirForCanonicalCheck: "dest",
+			initialTempDirContents: map[string]string{
+				".hg/requires":        "store",
+				"copy_from/spec.yaml": "spec contents",
+			},
+			wantTemplateDirFiles: map[string]string{
+				"spec.yaml": "spec contents",
+			},
+			wantDLMeta: &DownloadMetadata{
+				IsCanonical:     true,
+				CanonicalSource: "../copy_from",
+				LocationType:    "local_git",
 			},
 		},
 		{
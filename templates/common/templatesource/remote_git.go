@@ -16,18 +16,22 @@ package templatesource
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 
 	"github.com/Masterminds/semver/v3"
 	"golang.org/x/exp/slices"
 
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/config"
 	"github.com/abcxyz/abc/templates/common/git"
 	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/abc/templates/common/vcs"
 	"github.com/abcxyz/pkg/logging"
 	"github.com/abcxyz/pkg/sets"
 )
@@ -68,6 +72,8 @@ func (g *remoteGitSourceParser) sourceParse(ctx context.Context, params *ParseSo
 		defaultVersion:        g.defaultVersion,
 		flagUpgradeChannel:    params.FlagUpgradeChannel,
 		requireUpgradeChannel: params.RequireUpgradeChannel,
+		skipSubmodules:        params.SkipGitSubmodules,
+		mirrors:               params.Mirrors,
 	})
 }
 
@@ -82,6 +88,8 @@ type newRemoteGitDownloaderParams struct {
 	input                 string
 	flagUpgradeChannel    string
 	requireUpgradeChannel bool
+	skipSubmodules        bool
+	mirrors               config.Mirrors
 	re                    *regexp.Regexp
 }
 
@@ -99,6 +107,16 @@ func newRemoteGitDownloader(p *newRemoteGitDownloaderParams) (Downloader, bool,
 		return nil, false, err
 	}
 
+	mirrors := p.mirrors
+	if mirrors == nil {
+		if mirrors, err = config.MirrorsFromEnv(os.LookupEnv); err != nil {
+			return nil, false, err //nolint:wrapcheck
+		}
+	}
+	if mirror, ok := mirrors.Rewrite(string(p.re.ExpandString(nil, "${host}/${org}/${repo}", p.input, match))); ok {
+		remote = mirrorRemote(mirror, p.gitProtocol)
+	}
+
 	version := string(p.re.ExpandString(nil, "${version}", p.input, match))
 	if version == "" {
 		version = p.defaultVersion
@@ -119,6 +137,7 @@ func newRemoteGitDownloader(p *newRemoteGitDownloaderParams) (Downloader, bool,
 		version:               version,
 		flagUpgradeChannel:    p.flagUpgradeChannel,
 		requireUpgradeChannel: p.requireUpgradeChannel,
+		skipSubmodules:        p.skipSubmodules,
 	}, true, nil
 }
 
@@ -143,6 +162,10 @@ type remoteGitDownloader struct {
 	// Return an error if we can't infer an upgrade channel to put in the
 	// manifest.
 	requireUpgradeChannel bool
+
+	// Don't initialize git submodules. Their SHAs are still recorded in the
+	// DownloadMetadata.
+	skipSubmodules bool
 }
 
 // Download implements Downloader.
@@ -167,13 +190,39 @@ func (g *remoteGitDownloader) Download(ctx context.Context, _, templateDir, _ st
 	}
 	subdirToCopy := filepath.Join(tmpDir, subdir)
 
-	if err := g.cloner.Clone(ctx, g.remote, tmpDir); err != nil {
-		return nil, fmt.Errorf("Clone() of %s: %w", g.remote, err)
-	}
+	// A full commit SHA is fetched directly rather than cloned, because the
+	// commit might not be reachable from any branch or tag that a clone would
+	// download.
+	pinnedSHA := sha.MatchString(g.version)
+
+	versionToCheckout := g.version
+	var defaultUpgradeChannel string
+	if pinnedSHA {
+		if err := g.cloner.FetchSHA(ctx, g.remote, g.version, tmpDir); err != nil {
+			err = fmt.Errorf("FetchSHA() of %s at %s: %w", g.remote, g.version, err)
+			noSuchVersion := &git.NoSuchVersionError{}
+			if errors.As(err, &noSuchVersion) || isRepoMissing(err) {
+				return nil, &SourceUnavailableError{Source: g.canonicalSource, Err: err}
+			}
+			return nil, err
+		}
+	} else {
+		if err := g.cloner.Clone(ctx, g.remote, tmpDir); err != nil {
+			err = fmt.Errorf("Clone() of %s: %w", g.remote, err)
+			if isRepoMissing(err) {
+				return nil, &SourceUnavailableError{Source: g.canonicalSource, Err: err}
+			}
+			return nil, err
+		}
 
-	versionToCheckout, defaultUpgradeChannel, err := resolveVersion(ctx, tmpDir, g.version)
-	if err != nil {
-		return nil, err
+		versionToCheckout, defaultUpgradeChannel, err = resolveVersion(ctx, tmpDir, g.version)
+		if err != nil {
+			noSuchVersion := &git.NoSuchVersionError{}
+			if errors.As(err, &noSuchVersion) {
+				return nil, &SourceUnavailableError{Source: g.canonicalSource, Err: err}
+			}
+			return nil, err
+		}
 	}
 
 	upgradeChannel := defaultUpgradeChannel
@@ -189,14 +238,34 @@ func (g *remoteGitDownloader) Download(ctx context.Context, _, templateDir, _ st
 		"input", g.version,
 		"to", versionToCheckout)
 
-	if err := git.Checkout(ctx, versionToCheckout, tmpDir); err != nil {
-		return nil, fmt.Errorf("Checkout(): %w", err)
+	if !pinnedSHA {
+		if err := git.Checkout(ctx, versionToCheckout, tmpDir); err != nil {
+			err = fmt.Errorf("Checkout(): %w", err)
+			noSuchVersion := &git.NoSuchVersionError{}
+			if errors.As(err, &noSuchVersion) {
+				return nil, &SourceUnavailableError{Source: g.canonicalSource, Err: err}
+			}
+			return nil, err
+		}
+	}
+
+	if !g.skipSubmodules {
+		if err := g.cloner.UpdateSubmodules(ctx, tmpDir); err != nil {
+			return nil, fmt.Errorf("UpdateSubmodules(): %w", err)
+		}
+	}
+	submodules, err := submodulesIn(ctx, tmpDir, subdir)
+	if err != nil {
+		return nil, err
 	}
 
 	fi, err := os.Stat(subdirToCopy)
 	if err != nil {
 		if common.IsNotExistErr(err) {
-			return nil, fmt.Errorf(`the repo %q at version %q doesn't contain a subdirectory named %q; it's possible that the template exists in the "main" branch but is not part of the release %q`, g.remote, versionToCheckout, subdir, versionToCheckout)
+			return nil, &SourceUnavailableError{
+				Source: g.canonicalSource,
+				Err:    fmt.Errorf(`the repo %q at version %q doesn't contain a subdirectory named %q; it's possible that the template exists in the "main" branch but is not part of the release %q`, g.remote, versionToCheckout, subdir, versionToCheckout),
+			}
 		}
 		return nil, err //nolint:wrapcheck // Stat() returns a decently informative error
 	}
@@ -208,13 +277,14 @@ func (g *remoteGitDownloader) Download(ctx context.Context, _, templateDir, _ st
 		"version", versionToCheckout)
 
 	// Copy only the requested subdir to templateDir.
-	if err := common.CopyRecursive(ctx, nil, &common.CopyParams{
+	if _, err := common.CopyRecursive(ctx, nil, &common.CopyParams{
 		DstRoot: templateDir,
 		SrcRoot: subdirToCopy,
 		FS:      &common.RealFS{},
 		Visitor: func(relPath string, de fs.DirEntry) (common.CopyHint, error) {
 			return common.CopyHint{
-				Skip: relPath == ".git",
+				// Initialized submodules contain their own ".git".
+				Skip: filepath.Base(relPath) == ".git",
 			}, nil
 		},
 	}); err != nil {
@@ -223,18 +293,26 @@ func (g *remoteGitDownloader) Download(ctx context.Context, _, templateDir, _ st
 
 	// You might wonder: why don't we just use the downloaded branch/tag/SHA as
 	// the template version for the manifest? Multiple reasons:
-	//   - There might be a "better" name. E.g. the user specified a SHA
-	//     but there exists a semver tag pointing to the same SHA, which is
+	//   - There might be a "better" name. E.g. the user specified a tag but
+	//     there exists a semver tag pointing to the same SHA, which is
 	//     "better."
 	//   - The user may have specified a branch name, but we don't allow branches
 	//     to be used as template versions in manifests because they change
 	//     frequently.
-	canonicalVersion, ok, err := gitCanonicalVersion(ctx, tmpDir)
-	if err != nil {
-		return nil, err
-	}
-	if !ok {
-		return nil, fmt.Errorf("internal error: no version number was available after git clone")
+	//
+	// The exception is when the user pinned an exact SHA. That SHA is recorded
+	// as-is, so the manifest always refers to exactly what was rendered even
+	// if tags are later moved or deleted.
+	version := g.version
+	if !pinnedSHA {
+		var ok bool
+		version, ok, err = canonicalVersion(ctx, tmpDir)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, common.InternalErrorf("no version number was available after git clone")
+		}
 	}
 
 	vars, err := gitTemplateVars(ctx, tmpDir)
@@ -246,9 +324,10 @@ func (g *remoteGitDownloader) Download(ctx context.Context, _, templateDir, _ st
 		IsCanonical:     true, // Remote git sources are always canonical.
 		CanonicalSource: g.canonicalSource,
 		LocationType:    RemoteGit,
-		Version:         canonicalVersion,
+		Version:         version,
 		UpgradeChannel:  upgradeChannel,
 		Vars:            *vars,
+		Submodules:      submodules,
 	}
 
 	return dlMeta, nil
@@ -275,7 +354,7 @@ func gitTemplateVars(ctx context.Context, srcDir string) (*DownloaderVars, error
 	}
 
 	// The boolean return is ignored because we want empty string in the case where there's no tag.
-	tag, _, err := bestHeadTag(ctx, srcDir)
+	tag, _, err := bestHeadTag(ctx, &vcs.Git{}, srcDir)
 	if err != nil {
 		return nil, err
 	}
@@ -341,7 +420,7 @@ func resolveVersion(ctx context.Context, tmpDir, version string) (tagBranchOrSHA
 		// we should upgrade to the latest tag.
 		return version, Latest, nil
 	}
-	return "", "", fmt.Errorf("%q is not a tag, branch, or SHA that exists in this repo", version)
+	return "", "", &git.NoSuchVersionError{Version: version}
 }
 
 // resolveLatest retrieves the tags from the locally cloned repository and returns the
@@ -386,6 +465,8 @@ func resolveLatest(ctx context.Context, tmpDir string) (string, error) {
 // A fakeable interface around the lower-level git Clone function, for testing.
 type cloner interface {
 	Clone(ctx context.Context, remote, destDir string) error
+	FetchSHA(ctx context.Context, remote, sha, destDir string) error
+	UpdateSubmodules(ctx context.Context, dir string) error
 }
 
 type realCloner struct{}
@@ -394,6 +475,40 @@ func (r *realCloner) Clone(ctx context.Context, remote, destDir string) error {
 	return git.Clone(ctx, remote, destDir) //nolint:wrapcheck
 }
 
+func (r *realCloner) FetchSHA(ctx context.Context, remote, sha, destDir string) error {
+	return git.FetchSHA(ctx, remote, sha, destDir) //nolint:wrapcheck
+}
+
+func (r *realCloner) UpdateSubmodules(ctx context.Context, dir string) error {
+	return git.UpdateSubmodules(ctx, dir) //nolint:wrapcheck
+}
+
+// submodulesIn returns the SHAs of the git submodules of the given workspace
+// that are inside subdir, keyed by path relative to subdir. Returns nil if
+// there are none.
+func submodulesIn(ctx context.Context, workspaceDir, subdir string) (map[string]string, error) {
+	all, err := git.Submodules(ctx, workspaceDir)
+	if err != nil {
+		return nil, fmt.Errorf("Submodules(): %w", err)
+	}
+	prefix := ""
+	if subdir != "" && subdir != "." {
+		prefix = filepath.ToSlash(subdir) + "/"
+	}
+	var out map[string]string
+	for path, sha := range all {
+		rel, ok := strings.CutPrefix(path, prefix)
+		if !ok {
+			continue
+		}
+		if out == nil {
+			out = map[string]string{}
+		}
+		out[rel] = sha
+	}
+	return out, nil
+}
+
 // gitRemote returns a git remote string (see "man git-remote") for the given
 // remote git repo.
 //
@@ -405,12 +520,25 @@ func (r *realCloner) Clone(ctx context.Context, remote, destDir string) error {
 //
 // The given regex must have matching groups (i.e. P<foo>) named "host", "org",
 // and "repo".
+// mirrorRemote returns a git remote string for the given mirror from
+// config.Mirrors.Rewrite.
+func mirrorRemote(mirror, gitProtocol string) string {
+	if strings.Contains(mirror, "://") {
+		return mirror
+	}
+	if gitProtocol == "ssh" {
+		host, path, _ := strings.Cut(mirror, "/")
+		return "git@" + host + ":" + path + ".git"
+	}
+	return "https://" + mirror + ".git"
+}
+
 func gitRemote(re *regexp.Regexp, match []int, reInput, gitProtocol string) (string, error) {
 	// Sanity check that the regular expression has the necessary named subgroups.
 	wantSubexps := []string{"host", "org", "repo"}
 	missingSubexps := sets.Subtract(wantSubexps, re.SubexpNames())
 	if len(missingSubexps) > 0 {
-		return "", fmt.Errorf("internal error: regexp expansion didn't have a named subgroup for: %v", missingSubexps)
+		return "", common.InternalErrorf("regexp expansion didn't have a named subgroup for: %v", missingSubexps)
 	}
 
 	switch gitProtocol {
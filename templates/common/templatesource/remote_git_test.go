@@ -16,11 +16,15 @@ package templatesource
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 
+	"github.com/abcxyz/abc/templates/common/git"
+	"github.com/abcxyz/abc/templates/common/run"
 	abctestutil "github.com/abcxyz/abc/templates/testutil"
 	"github.com/abcxyz/pkg/testutil"
 )
@@ -40,6 +44,9 @@ func TestRemoteGitDownloader_Download(t *testing.T) {
 		want       map[string]string
 		wantDLMeta *DownloadMetadata
 		wantErr    string
+
+		// Whether the error should be a *SourceUnavailableError.
+		wantUnavailable bool
 	}{
 		{
 			name: "no_subdir",
@@ -214,8 +221,54 @@ func TestRemoteGitDownloader_Download(t *testing.T) {
 					wantRemote: "fake-remote",
 				},
 			},
-			wantErr: `doesn't contain a subdirectory named "nonexistent"`,
-			want:    map[string]string{},
+			wantErr:         `doesn't contain a subdirectory named "nonexistent"`,
+			wantUnavailable: true,
+			want:            map[string]string{},
+		},
+		{
+			name: "missing_repo",
+			dl: &remoteGitDownloader{
+				canonicalSource: "github.com/foo/gone",
+				remote:          "fake-remote",
+				version:         "v1.2.3",
+				cloner: &fakeCloner{
+					tb:         t,
+					cloneErr:   fmt.Errorf("exec of [git clone] failed\nstderr: remote: Repository not found.\nfatal: repository 'https://github.com/foo/gone.git/' not found"),
+					wantRemote: "fake-remote",
+				},
+			},
+			wantErr:         "the template github.com/foo/gone is no longer available",
+			wantUnavailable: true,
+		},
+		{
+			name: "clone_failure_not_unavailable",
+			dl: &remoteGitDownloader{
+				remote:  "fake-remote",
+				version: "v1.2.3",
+				cloner: &fakeCloner{
+					tb:         t,
+					cloneErr:   fmt.Errorf("exec of [git clone] failed\nstderr: fatal: unable to access: Could not resolve host: github.com"),
+					wantRemote: "fake-remote",
+				},
+			},
+			wantErr: "Could not resolve host",
+		},
+		{
+			name: "missing_version",
+			dl: &remoteGitDownloader{
+				canonicalSource: "mysource",
+				remote:          "fake-remote",
+				version:         "deleted-branch",
+				cloner: &fakeCloner{
+					tb:         t,
+					out:        basicFiles,
+					addTags:    []string{"v1.2.3"},
+					wantRemote: "fake-remote",
+				},
+			},
+			wantErr:         `the requested version "deleted-branch" doesn't exist`,
+			wantUnavailable: true,
+			want:            map[string]string{},
 		},
 		{
 			name: "file_instead_of_dir",
@@ -278,6 +331,24 @@ func TestRemoteGitDownloader_Download(t *testing.T) {
 			},
 			wantErr: "you must provide the --upgrade-channel flag",
 		},
+		{
+			name: "clone_by_nonexistent_sha",
+			dl: &remoteGitDownloader{
+				canonicalSource:       "mysource",
+				remote:                "fake-remote",
+				subdir:                "",
+				version:               "0123456789012345678901234567890123456789",
+				requireUpgradeChannel: true,
+				flagUpgradeChannel:    "main",
+				cloner: &fakeCloner{
+					tb:         t,
+					out:        basicFiles,
+					wantRemote: "fake-remote",
+				},
+			},
+			wantErr:         `the requested version "0123456789012345678901234567890123456789" doesn't exist`,
+			wantUnavailable: true,
+		},
 		{
 			name: "clone_by_sha_with_detected_tag",
 			dl: &remoteGitDownloader{
@@ -299,7 +370,7 @@ func TestRemoteGitDownloader_Download(t *testing.T) {
 				IsCanonical:     true,
 				CanonicalSource: "mysource",
 				LocationType:    RemoteGit,
-				Version:         "v1.2.3",
+				Version:         abctestutil.MinimalGitHeadSHA,
 				UpgradeChannel:  "latest",
 				Vars: DownloaderVars{
 					GitTag:      "v1.2.3",
@@ -322,6 +393,10 @@ func TestRemoteGitDownloader_Download(t *testing.T) {
 			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
 				t.Fatal(diff)
 			}
+			unavailable := &SourceUnavailableError{}
+			if got := errors.As(err, &unavailable); got != tc.wantUnavailable {
+				t.Errorf("got SourceUnavailableError %t, want %t; the error was: %v", got, tc.wantUnavailable, err)
+			}
 			got := abctestutil.LoadDir(t, tempDir)
 			if diff := cmp.Diff(got, tc.want, cmpopts.EquateEmpty()); diff != "" {
 				t.Errorf("output files were not as expected (-got, +want): %s", diff)
@@ -462,18 +537,33 @@ type fakeCloner struct {
 	addTags     []string
 	addBranches []string
 	wantRemote  string
+	cloneErr    error
 }
 
 func (f *fakeCloner) Clone(ctx context.Context, remote, outDir string) error {
 	if remote != f.wantRemote {
 		f.tb.Errorf("got remote %q, want %q", remote, f.wantRemote)
 	}
+	if f.cloneErr != nil {
+		return f.cloneErr
+	}
 
 	createFakeGitRepo(f.tb, f.addBranches, f.addTags, outDir)
 	abctestutil.WriteAll(f.tb, outDir, f.out)
 	return nil
 }
 
+func (f *fakeCloner) FetchSHA(ctx context.Context, remote, sha, outDir string) error {
+	if sha != abctestutil.MinimalGitHeadSHA {
+		return &git.NoSuchVersionError{Version: sha}
+	}
+	return f.Clone(ctx, remote, outDir)
+}
+
+func (f *fakeCloner) UpdateSubmodules(ctx context.Context, dir string) error {
+	return nil
+}
+
 func createFakeGitRepo(tb testing.TB, branches, tags []string, outDir string) {
 	tb.Helper()
 
@@ -490,3 +580,72 @@ func createFakeGitRepo(tb testing.TB, branches, tags []string, outDir string) {
 
 	abctestutil.WriteAll(tb, outDir, files)
 }
+
+func TestSubmodulesIn(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	const (
+		sha1 = "0123456789012345678901234567890123456789"
+		sha2 = "9876543210987654321098765432109876543210"
+	)
+
+	workspace := t.TempDir()
+	abctestutil.WriteAll(t, workspace, abctestutil.WithGitRepoAt("", map[string]string{
+		"tmpl/spec.yaml": "some contents",
+	}))
+	for _, args := range [][]string{
+		{"config", "user.email", "fake@example.com"},
+		{"config", "user.name", "Nobody"},
+		{"add", "-A"},
+		{"update-index", "--add", "--cacheinfo", "160000," + sha1 + ",tmpl/shared"},
+		{"update-index", "--add", "--cacheinfo", "160000," + sha2 + ",other"},
+		{"commit", "--no-gpg-sign", "-m", "my first commit"},
+	} {
+		if _, _, err := run.Simple(ctx, append([]string{"git", "-C", workspace}, args...)...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name   string
+		subdir string
+		want   map[string]string
+	}{
+		{
+			name: "no_subdir",
+			want: map[string]string{
+				"tmpl/shared": sha1,
+				"other":       sha2,
+			},
+		},
+		{
+			name:   "subdir",
+			subdir: "tmpl",
+			want: map[string]string{
+				"shared": sha1,
+			},
+		},
+		{
+			name:   "subdir_without_submodules",
+			subdir: "nonexistent",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := submodulesIn(ctx, workspace, tc.subdir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("submodules were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
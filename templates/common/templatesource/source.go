@@ -20,6 +20,7 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/abcxyz/abc/templates/common/config"
 	"github.com/abcxyz/abc/templates/common/specutil"
 )
 
@@ -114,6 +115,13 @@ type ParseSourceParams struct {
 	// can't be determined from the combination of the location string and
 	// flags.
 	RequireUpgradeChannel bool
+
+	// The value of --skip-git-submodules.
+	SkipGitSubmodules bool
+
+	// Mirrors to download remote git template sources from. If nil, they're
+	// read from $ABC_SOURCE_MIRRORS, which is set from the config files.
+	Mirrors config.Mirrors
 }
 
 // ParseSource maps the input template source to a particular kind of
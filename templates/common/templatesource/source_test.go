@@ -21,6 +21,7 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 
+	"github.com/abcxyz/abc/templates/common/config"
 	abctestutil "github.com/abcxyz/abc/templates/testutil"
 	"github.com/abcxyz/pkg/testutil"
 )
@@ -33,6 +34,7 @@ func TestParseSource(t *testing.T) {
 		source              string
 		flagGitProtocol     string
 		flagUpgradeChannel  string
+		mirrors             config.Mirrors
 		tempDirContents     map[string]string
 		dest                string
 		want                Downloader
@@ -247,6 +249,59 @@ func TestParseSource(t *testing.T) {
 				cloner:          &realCloner{},
 			},
 		},
+		{
+			name:                "mirror_wildcard",
+			source:              "github.com/myorg/myrepo/mysubdir@v1.2.3",
+			mirrors:             config.Mirrors{"github.com/myorg/*": "git.internal.corp/mirror/myorg/*"},
+			wantCanonicalSource: "github.com/myorg/myrepo/mysubdir",
+			want: &remoteGitDownloader{
+				canonicalSource: "github.com/myorg/myrepo/mysubdir",
+				remote:          "https://git.internal.corp/mirror/myorg/myrepo.git",
+				subdir:          "mysubdir",
+				version:         "v1.2.3",
+				cloner:          &realCloner{},
+			},
+		},
+		{
+			name:                "mirror_ssh",
+			source:              "github.com/myorg/myrepo@v1.2.3",
+			flagGitProtocol:     "ssh",
+			mirrors:             config.Mirrors{"github.com/myorg/myrepo": "git.internal.corp/mirror/myrepo"},
+			wantCanonicalSource: "github.com/myorg/myrepo",
+			want: &remoteGitDownloader{
+				canonicalSource: "github.com/myorg/myrepo",
+				remote:          "git@git.internal.corp:mirror/myrepo.git",
+				subdir:          "",
+				version:         "v1.2.3",
+				cloner:          &realCloner{},
+			},
+		},
+		{
+			name:                "mirror_url",
+			source:              "github.com/myorg/myrepo@v1.2.3",
+			mirrors:             config.Mirrors{"github.com/*": "file:///srv/git/*"},
+			wantCanonicalSource: "github.com/myorg/myrepo",
+			want: &remoteGitDownloader{
+				canonicalSource: "github.com/myorg/myrepo",
+				remote:          "file:///srv/git/myorg/myrepo",
+				subdir:          "",
+				version:         "v1.2.3",
+				cloner:          &realCloner{},
+			},
+		},
+		{
+			name:                "mirror_not_matching",
+			source:              "github.com/otherorg/myrepo@v1.2.3",
+			mirrors:             config.Mirrors{"github.com/myorg/*": "git.internal.corp/mirror/myorg/*"},
+			wantCanonicalSource: "github.com/otherorg/myrepo",
+			want: &remoteGitDownloader{
+				canonicalSource: "github.com/otherorg/myrepo",
+				remote:          "https://github.com/otherorg/myrepo.git",
+				subdir:          "",
+				version:         "v1.2.3",
+				cloner:          &realCloner{},
+			},
+		},
 		{
 			name:                "go_getter_semver_ref",
 			source:              "github.com/myorg/myrepo.git?ref=v1.2.3",
@@ -278,6 +333,7 @@ func TestParseSource(t *testing.T) {
 				Source:             tc.source,
 				FlagGitProtocol:    tc.flagGitProtocol,
 				FlagUpgradeChannel: tc.flagUpgradeChannel,
+				Mirrors:            tc.mirrors,
 			}
 			got, err := ParseSource(ctx, params)
 			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
@@ -299,7 +355,7 @@ func TestParseSource(t *testing.T) {
 	}
 }
 
-func TestGitCanonicalVersion(t *testing.T) {
+func TestCanonicalVersion(t *testing.T) {
 	t.Parallel()
 
 	cases := []struct {
@@ -374,6 +430,14 @@ func TestGitCanonicalVersion(t *testing.T) {
 			dir:   ".",
 			files: nil,
 		},
+		{
+			name: "mercurial_workspace_has_no_version",
+			dir:  "subdir",
+			files: map[string]string{
+				".hg/requires":     "store",
+				"subdir/spec.yaml": "spec contents",
+			},
+		},
 		{
 			name: "dirty_workspace_allowed",
 			dir:  ".",
@@ -393,7 +457,7 @@ func TestGitCanonicalVersion(t *testing.T) {
 			tmp := t.TempDir()
 			abctestutil.WriteAll(t, tmp, tc.files)
 			ctx := context.Background()
-			got, gotOK, err := gitCanonicalVersion(ctx, filepath.Join(tmp, tc.dir))
+			got, gotOK, err := canonicalVersion(ctx, filepath.Join(tmp, tc.dir))
 			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
 				t.Error(diff)
 			}
@@ -0,0 +1,65 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templatesource
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SourceUnavailableError is returned by Download when the template doesn't
+// exist anymore: its repo or directory is gone, the version to download (like
+// the branch of an upgrade channel) was deleted, or the repo no longer
+// contains the template's subdirectory. Unlike other download errors,
+// retrying won't help; the template has to be found somewhere else.
+type SourceUnavailableError struct {
+	// Source is the template location that couldn't be found, like
+	// "github.com/foo/bar/baz".
+	Source string
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *SourceUnavailableError) Error() string {
+	return fmt.Sprintf("the template %s is no longer available: %v", e.Source, e.Err)
+}
+
+func (e *SourceUnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// repoMissingMessages are the messages, in lowercase, that git and the common
+// git hosting services print when a repo doesn't exist. Some services print
+// the same message for private repos that the user can't access, since they
+// don't reveal whether those exist.
+var repoMissingMessages = []string{
+	"repository not found",
+	"does not appear to be a git repository",
+	"the project you were looking for could not be found",
+	"' does not exist",
+}
+
+// isRepoMissing returns whether the given error from running git means that
+// the remote repo doesn't exist.
+func isRepoMissing(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, m := range repoMissingMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
@@ -20,7 +20,10 @@ import (
 	"path/filepath"
 	"regexp"
 
+	"github.com/abcxyz/abc/templates/common/config"
 	"github.com/abcxyz/abc/templates/common/git"
+	"github.com/abcxyz/abc/templates/common/vcs"
+	"github.com/abcxyz/pkg/logging"
 )
 
 var (
@@ -85,6 +88,19 @@ type ForUpgradeParams struct {
 	// --upgrade-channel or from the manifest being upgraded. Leave empty to
 	// autodetect the upgrade channel based on the Version field.
 	UpgradeChannel string
+
+	// The value of --skip-git-submodules.
+	SkipGitSubmodules bool
+
+	// Mirrors to download remote git template sources from. If nil, they're
+	// read from $ABC_SOURCE_MIRRORS, which is set from the config files.
+	Mirrors config.Mirrors
+
+	// Optional: for a local_git template stored in the same repo as
+	// InstalledDir, the slash-separated path of the template relative to the
+	// repo root, and the repo's remote URL, as recorded in the manifest.
+	RepoPath      string
+	RepoRemoteURL string
 }
 
 func remoteGitUpgradeDownloaderFactory(ctx context.Context, f *ForUpgradeParams) (Downloader, error) {
@@ -94,6 +110,8 @@ func remoteGitUpgradeDownloaderFactory(ctx context.Context, f *ForUpgradeParams)
 		gitProtocol:        f.GitProtocol,
 		defaultVersion:     f.Version,
 		flagUpgradeChannel: f.UpgradeChannel,
+		skipSubmodules:     f.SkipGitSubmodules,
+		mirrors:            f.Mirrors,
 	})
 	if err != nil {
 		return nil, err
@@ -108,10 +126,10 @@ func remoteGitUpgradeDownloaderFactory(ctx context.Context, f *ForUpgradeParams)
 
 func localGitUpgradeDownloaderFactory(ctx context.Context, f *ForUpgradeParams) (Downloader, error) {
 	// When upgrading from a local directory, we enforce that the upgrade source
-	// and destination dirs are in the same git workspace. This is a security
-	// consideration: if you clone a git workspace that contains a malicious
-	// manifest, that manifest shouldn't be able to touch any files outside of
-	// the git workspace that it's in.
+	// and destination dirs are in the same version-controlled workspace. This
+	// is a security consideration: if you clone a workspace that contains a
+	// malicious manifest, that manifest shouldn't be able to touch any files
+	// outside of the workspace that it's in.
 	//
 	// We could relax this in the future if we encounter a legitimate use case.
 	absInstalledDir, err := filepath.Abs(f.InstalledDir)
@@ -120,25 +138,83 @@ func localGitUpgradeDownloaderFactory(ctx context.Context, f *ForUpgradeParams)
 	}
 	absSrcPath := filepath.Join(absInstalledDir, f.CanonicalLocation)
 
-	sourceGitWorkspace, ok, err := git.Workspace(ctx, absSrcPath)
+	var repoRoot string
+	if f.RepoPath != "" {
+		if !filepath.IsLocal(filepath.FromSlash(f.RepoPath)) {
+			return nil, fmt.Errorf("the template repo path %q must be a relative path inside the repo", f.RepoPath)
+		}
+		var ok bool
+		repoRoot, ok, err = git.Workspace(ctx, absInstalledDir)
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+		if ok {
+			// Look for the template relative to the repo root rather than the
+			// installed dir, so this keeps working if the installed dir was
+			// moved to a different place in the repo.
+			absSrcPath = filepath.Join(repoRoot, filepath.FromSlash(f.RepoPath))
+			warnIfRemoteChanged(ctx, repoRoot, f.RepoRemoteURL)
+		}
+	}
+
+	sourceWorkspace, ok, err := vcs.Detect(ctx, absSrcPath)
 	if err != nil {
 		return nil, err //nolint:wrapcheck
 	}
 	if !ok {
-		return nil, fmt.Errorf("for now, upgrading is currently only supported in a git workspace, and %q is not in a git workspace", absSrcPath)
+		return nil, fmt.Errorf("for now, upgrading is currently only supported in a version-controlled workspace, and %q is not in one", absSrcPath)
 	}
-	destGitWorkspace, ok, err := git.Workspace(ctx, absInstalledDir)
+	destWorkspace, ok, err := vcs.Detect(ctx, absInstalledDir)
 	if err != nil {
 		return nil, err //nolint:wrapcheck
 	}
 	if !ok {
-		return nil, fmt.Errorf("for now, when upgrading, the upgrade template source must in a git workspace, and %q is not in a git workspace", absInstalledDir)
+		return nil, fmt.Errorf("for now, when upgrading, the upgrade template source must in a version-controlled workspace, and %q is not in one", absInstalledDir)
+	}
+	if sourceWorkspace.Root != destWorkspace.Root {
+		return nil, fmt.Errorf("for now, when upgrading, the template source and destination directories must be in the same workspace, but they are %q and %q respectively", sourceWorkspace.Root, destWorkspace.Root)
 	}
-	if sourceGitWorkspace != destGitWorkspace {
-		return nil, fmt.Errorf("for now, when upgrading, the template source and destination directories must be in the same git workspace, but they are %q and %q respectively", sourceGitWorkspace, destGitWorkspace)
+
+	if repoRoot != "" && f.Version != "" {
+		// The template is in the same repo as the destination, and a specific
+		// version was asked for, so read it from the repo's history.
+		relPath, err := filepath.Rel(repoRoot, absSrcPath)
+		if err != nil {
+			return nil, fmt.Errorf("filepath.Rel(%q,%q): %w", repoRoot, absSrcPath, err)
+		}
+		return &repoHistoryDownloader{
+			repoRoot: repoRoot,
+			repo: RepoLocation{
+				Path:      filepath.ToSlash(relPath),
+				RemoteURL: f.RepoRemoteURL,
+			},
+			version:            f.Version,
+			flagUpgradeChannel: f.UpgradeChannel,
+			skipSubmodules:     f.SkipGitSubmodules,
+		}, nil
 	}
 
 	return &LocalDownloader{
 		SrcPath: absSrcPath,
 	}, nil
 }
+
+// warnIfRemoteChanged logs a warning if the repo's origin remote isn't the
+// one recorded in the manifest, which suggests that the manifest was copied
+// from a different repo and the template path may not mean what it used to.
+func warnIfRemoteChanged(ctx context.Context, repoRoot, recordedURL string) {
+	logger := logging.FromContext(ctx).With("logger", "warnIfRemoteChanged")
+	if recordedURL == "" {
+		return
+	}
+	originURL, ok, err := git.OriginURL(ctx, repoRoot)
+	if err != nil {
+		logger.WarnContext(ctx, "failed looking up the repo's origin remote", "repo", repoRoot, "error", err)
+		return
+	}
+	if ok && originURL != recordedURL {
+		logger.WarnContext(ctx, "the template was installed from a repo with a different origin remote than this one; the template path is being interpreted relative to this repo",
+			"recorded_remote", recordedURL,
+			"current_remote", originURL)
+	}
+}
@@ -37,6 +37,7 @@ func TestForUpgrade(t *testing.T) {
 		installedInSubdir  string
 		dirContents        map[string]string
 		version            string
+		repoPath           string
 		wantDownloader     Downloader
 		wantErr            string
 	}{
@@ -133,7 +134,7 @@ func TestForUpgrade(t *testing.T) {
 			name:              "local_dir_no_git_repo",
 			canonicalLocation: "my/dir",
 			locType:           "local_git",
-			wantErr:           `my/dir" is not in a git workspace`,
+			wantErr:           `my/dir" is not in one`,
 		},
 		{
 			name:              "simple_local_git_repo",
@@ -144,6 +145,17 @@ func TestForUpgrade(t *testing.T) {
 				SrcPath: "my/dir",
 			},
 		},
+		{
+			name:              "simple_local_mercurial_repo",
+			canonicalLocation: "my/dir",
+			locType:           "local_git",
+			dirContents: map[string]string{
+				".hg/requires": "store",
+			},
+			wantDownloader: &LocalDownloader{
+				SrcPath: "my/dir",
+			},
+		},
 		{
 			name:              "different_git_workspaces",
 			canonicalLocation: "../template_dir",
@@ -151,7 +163,40 @@ func TestForUpgrade(t *testing.T) {
 			installedInSubdir: "installed_dir",
 			dirContents: abctestutil.WithGitRepoAt("template_dir",
 				abctestutil.WithGitRepoAt("installed_dir", nil)),
-			wantErr: "must be in the same git workspace",
+			wantErr: "must be in the same workspace",
+		},
+		{
+			name:              "in_repo_template_after_dest_moved",
+			canonicalLocation: "../template_dir", // stale, the dest used to be one level up
+			locType:           "local_git",
+			installedInSubdir: "moved/installed_dir",
+			repoPath:          "template_dir",
+			dirContents:       abctestutil.WithGitRepoAt("", nil),
+			wantDownloader: &LocalDownloader{
+				SrcPath: "template_dir",
+			},
+		},
+		{
+			name:              "in_repo_template_with_version",
+			canonicalLocation: "../template_dir",
+			locType:           "local_git",
+			installedInSubdir: "installed_dir",
+			repoPath:          "template_dir",
+			version:           "v1.2.3",
+			dirContents:       abctestutil.WithGitRepoAt("", nil),
+			wantDownloader: &repoHistoryDownloader{
+				repo:    RepoLocation{Path: "template_dir"},
+				version: "v1.2.3",
+			},
+		},
+		{
+			name:              "in_repo_template_path_outside_repo",
+			canonicalLocation: "../template_dir",
+			locType:           "local_git",
+			installedInSubdir: "installed_dir",
+			repoPath:          "../template_dir",
+			dirContents:       abctestutil.WithGitRepoAt("", nil),
+			wantErr:           "must be a relative path inside the repo",
 		},
 		{
 			name:              "unknown_loc_type",
@@ -191,18 +236,24 @@ func TestForUpgrade(t *testing.T) {
 				GitProtocol:       tc.gitProtocol,
 				Version:           tc.version,
 				UpgradeChannel:    tc.flagUpgradeChannel,
+				RepoPath:          tc.repoPath,
 			})
 			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
 				t.Fatal(diff)
 			}
 
 			opts := []cmp.Option{
-				cmp.AllowUnexported(remoteGitDownloader{}, LocalDownloader{}),
+				cmp.AllowUnexported(remoteGitDownloader{}, LocalDownloader{}, repoHistoryDownloader{}),
 				abctestutil.TransformStructFields(
 					abctestutil.TrimStringPrefixTransformer(tempDir+"/"),
 					LocalDownloader{},
 					"SrcPath",
 				),
+				abctestutil.TransformStructFields(
+					abctestutil.TrimStringPrefixTransformer(tempDir),
+					repoHistoryDownloader{},
+					"repoRoot",
+				),
 			}
 			if diff := cmp.Diff(downloader, tc.wantDownloader, opts...); diff != "" {
 				t.Errorf("downloader was not as expected: %s", diff)
@@ -0,0 +1,78 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templatesource
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"golang.org/x/exp/slices"
+
+	"github.com/abcxyz/abc/templates/common/git"
+)
+
+// ListVersions returns the release versions of the template at the given
+// location, which are its vX.Y.Z semver tags, newest first. Any @version in the
+// location is ignored, and may be left out. Only remote git templates have
+// versions; for a template on the local filesystem, this returns an error.
+func ListVersions(ctx context.Context, params *ParseSourceParams) ([]string, error) {
+	if !strings.Contains(params.Source, "@") {
+		// "github.com/foo/bar" without a version would otherwise be treated as
+		// a local directory.
+		withVersion := *params
+		withVersion.Source += "@" + Latest
+		if d, err := ParseSource(ctx, &withVersion); err == nil {
+			if g, ok := d.(*remoteGitDownloader); ok {
+				return g.versions(ctx)
+			}
+		}
+	}
+
+	downloader, err := ParseSource(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	g, ok := downloader.(*remoteGitDownloader)
+	if !ok {
+		return nil, fmt.Errorf("the template location %q isn't a remote git repo, so it has no versions to list", params.Source)
+	}
+	return g.versions(ctx)
+}
+
+func (g *remoteGitDownloader) versions(ctx context.Context) ([]string, error) {
+	tags, err := git.RemoteTags(ctx, g.remote)
+	if err != nil {
+		return nil, fmt.Errorf("failed listing tags of %s: %w", g.remote, err)
+	}
+	return semverTagsNewestFirst(tags), nil
+}
+
+// semverTagsNewestFirst returns the tags that parse as semver, sorted in
+// descending semver order. Other tags are dropped.
+func semverTagsNewestFirst(tags []string) []string {
+	out := make([]string, 0, len(tags))
+	for _, t := range tags {
+		if _, err := parseSemverTag(t); err == nil {
+			out = append(out, t)
+		}
+	}
+	slices.SortFunc(out, func(l, r string) int {
+		lv, _ := parseSemverTag(l)
+		rv, _ := parseSemverTag(r)
+		return rv.Compare(lv)
+	})
+	return out
+}
@@ -0,0 +1,74 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templatesource
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common/run"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestListVersions_Local(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	_, err := ListVersions(context.Background(), &ParseSourceParams{
+		CWD:    tempDir,
+		Source: tempDir,
+	})
+	if diff := testutil.DiffErrString(err, "isn't a remote git repo"); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestRemoteGitDownloaderVersions(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	remote := t.TempDir()
+	abctestutil.WriteAll(t, remote, abctestutil.WithGitRepoAt("", map[string]string{
+		"spec.yaml": "some contents",
+	}))
+	for _, args := range [][]string{
+		{"config", "user.email", "fake@example.com"},
+		{"config", "user.name", "Nobody"},
+		{"add", "-A"},
+		{"commit", "--no-gpg-sign", "-m", "my first commit"},
+		{"tag", "v1.0.0"},
+		{"tag", "v1.10.0"},
+		{"tag", "v1.2.0"},
+		{"tag", "v2.0.0-alpha1"},
+		{"tag", "not-semver"},
+	} {
+		if _, _, err := run.Simple(ctx, append([]string{"git", "-C", remote}, args...)...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	g := &remoteGitDownloader{remote: remote}
+	got, err := g.versions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"v2.0.0-alpha1", "v1.10.0", "v1.2.0", "v1.0.0"}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("versions were not as expected (-got,+want): %s", diff)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upgrade
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/dirhash"
+	"github.com/abcxyz/abc/templates/common/telemetry"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// templateCache remembers the templates that were downloaded during a single
+// UpgradeAll operation, along with their dirhashes. In a large repo, many
+// manifests are typically installed from the same template, and without the
+// cache we'd clone and hash that template once per manifest.
+//
+// Only remote git templates are cached. Their download metadata doesn't
+// depend on the installation directory, and they're the expensive ones to
+// download.
+//
+// A nil *templateCache is valid and caches nothing.
+type templateCache struct {
+	fs          common.FS
+	tempTracker *tempdir.DirTracker
+	tempDirBase string
+
+	entries map[templateCacheKey]*templateCacheEntry
+}
+
+// templateCacheKey is everything that determines which template version a
+// downloader will fetch, other than the installation directory.
+type templateCacheKey struct {
+	location       string
+	locType        string
+	gitProtocol    string
+	version        string
+	upgradeChannel string
+
+	// mirrors is non-empty when the template was downloaded from fallback
+	// mirrors instead of the configured ones. See config.Mirrors.String().
+	mirrors string
+}
+
+type templateCacheEntry struct {
+	// dir is a pristine copy of the downloaded template.
+	dir     string
+	dlMeta  *templatesource.DownloadMetadata
+	dirhash string
+}
+
+func newTemplateCache(fs common.FS, tempTracker *tempdir.DirTracker, tempDirBase string) *templateCache {
+	return &templateCache{
+		fs:          fs,
+		tempTracker: tempTracker,
+		tempDirBase: tempDirBase,
+		entries:     map[templateCacheKey]*templateCacheEntry{},
+	}
+}
+
+// download puts the template identified by key into templateDir, either by
+// copying it from the cache or by calling the downloader. Besides the download
+// metadata, it returns the dirhash of the template, or empty string if the
+// template wasn't hashed because it isn't cacheable.
+func (c *templateCache) download(ctx context.Context, key templateCacheKey, downloader templatesource.Downloader, cwd, templateDir, installedDir string) (*templatesource.DownloadMetadata, string, error) {
+	logger := logging.FromContext(ctx).With("logger", "templateCache.download")
+
+	if c != nil {
+		if entry, ok := c.entries[key]; ok {
+			logger.DebugContext(ctx, "using cached template download",
+				"location", key.location,
+				"version", entry.dlMeta.Version)
+			if _, err := common.CopyRecursive(ctx, nil, &common.CopyParams{
+				DstRoot:          templateDir,
+				SrcRoot:          entry.dir,
+				FS:               c.fs,
+				PreserveMetadata: true,
+			}); err != nil {
+				return nil, "", err //nolint:wrapcheck
+			}
+			dlMeta := *entry.dlMeta
+			return &dlMeta, entry.dirhash, nil
+		}
+	}
+
+	dlStart := time.Now()
+	dlMeta, err := downloader.Download(ctx, cwd, templateDir, installedDir)
+	telemetry.Measure(ctx, telemetry.Downloads, telemetry.DownloadDuration, dlStart,
+		common.WithCategory(common.CategoryDownload, err))
+	if err != nil {
+		return nil, "", err //nolint:wrapcheck
+	}
+	if c == nil || dlMeta.LocationType != templatesource.RemoteGit {
+		return dlMeta, "", nil
+	}
+
+	hash, err := dirhash.HashLatestWithSubmodules(templateDir, dlMeta.Submodules)
+	if err != nil {
+		return nil, "", err //nolint:wrapcheck
+	}
+	cacheDir, err := c.tempTracker.MkdirTempTracked(c.tempDirBase, tempdir.TemplateCacheDirNamePart)
+	if err != nil {
+		return nil, "", err //nolint:wrapcheck
+	}
+	if _, err := common.CopyRecursive(ctx, nil, &common.CopyParams{
+		DstRoot:          cacheDir,
+		SrcRoot:          templateDir,
+		FS:               c.fs,
+		PreserveMetadata: true,
+	}); err != nil {
+		return nil, "", err //nolint:wrapcheck
+	}
+	cachedDLMeta := *dlMeta
+	c.entries[key] = &templateCacheEntry{
+		dir:     cacheDir,
+		dlMeta:  &cachedDLMeta,
+		dirhash: hash,
+	}
+	return dlMeta, hash, nil
+}
+
+// dirhashMatches returns whether the template in dir, with the given git
+// submodule SHAs, has the dirhash wantHash. If knownHash is nonempty, it's the
+// already-computed dirhash of dir, and is used to avoid hashing the directory
+// again when the algorithms are the same.
+func dirhashMatches(wantHash, knownHash, dir string, submodules map[string]string) (bool, error) {
+	wantAlgo, _, _ := strings.Cut(wantHash, ":")
+	knownAlgo, _, _ := strings.Cut(knownHash, ":")
+	if knownHash != "" && wantAlgo == knownAlgo {
+		return wantHash == knownHash, nil
+	}
+	return dirhash.VerifyWithSubmodules(wantHash, dir, submodules) //nolint:wrapcheck
+}
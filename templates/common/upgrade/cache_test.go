@@ -0,0 +1,286 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upgrade
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+)
+
+func TestUpgradeAll_TemplateCache(t *testing.T) {
+	t.Parallel()
+
+	specFile := `api_version: 'cli.abcxyz.dev/v1beta6'
+kind: 'Template'
+desc: 'my template'
+inputs:
+  - name: "my_input"
+    desc: "An arbitrary input"
+steps:
+  - desc: 'include .'
+    action: 'include'
+    params:
+      paths: ['.']
+`
+
+	cases := []struct {
+		name          string
+		locationType  templatesource.LocationType
+		upgradeFiles  map[string]string
+		wantDownloads int
+		wantType      ResultType
+		wantContents  map[string]string
+	}{
+		{
+			name:         "remote_template_downloaded_once",
+			locationType: templatesource.RemoteGit,
+			upgradeFiles: map[string]string{
+				"spec.yaml":  specFile,
+				"myfile.txt": "new contents",
+			},
+			wantDownloads: 1,
+			wantType:      Success,
+			wantContents: map[string]string{
+				"dest1/myfile.txt": "new contents",
+				"dest2/myfile.txt": "new contents",
+				"dest3/myfile.txt": "new contents",
+			},
+		},
+		{
+			name:         "remote_template_unchanged_uses_cached_dirhash",
+			locationType: templatesource.RemoteGit,
+			upgradeFiles: map[string]string{
+				"spec.yaml":  specFile,
+				"myfile.txt": "old contents",
+			},
+			wantDownloads: 1,
+			wantType:      AlreadyUpToDate,
+			wantContents: map[string]string{
+				"dest1/myfile.txt": "old contents",
+				"dest2/myfile.txt": "old contents",
+				"dest3/myfile.txt": "old contents",
+			},
+		},
+		{
+			name:         "other_location_types_not_cached",
+			locationType: "fake_location_type",
+			upgradeFiles: map[string]string{
+				"spec.yaml":  specFile,
+				"myfile.txt": "new contents",
+			},
+			wantDownloads: 3,
+			wantType:      Success,
+			wantContents: map[string]string{
+				"dest1/myfile.txt": "new contents",
+				"dest2/myfile.txt": "new contents",
+				"dest3/myfile.txt": "new contents",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			clk := clock.NewMock()
+			tempBase := t.TempDir()
+			templateDir := filepath.Join(tempBase, "template")
+			destBase := filepath.Join(tempBase, "dest")
+
+			abctestutil.WriteAll(t, templateDir, map[string]string{
+				"spec.yaml":  specFile,
+				"myfile.txt": "old contents",
+			})
+			initialDL := &fakeDownloader{
+				sourceDir: templateDir,
+				outDLMeta: &templatesource.DownloadMetadata{
+					IsCanonical:     true,
+					CanonicalSource: "github.com/fake/repo",
+					LocationType:    tc.locationType,
+					Version:         "v1.0.0",
+					UpgradeChannel:  "latest",
+				},
+			}
+			for _, dest := range []string{"dest1", "dest2", "dest3"} {
+				mustRender(t, ctx, clk, initialDL, tempBase, templateDir, filepath.Join(destBase, dest),
+					map[string]string{"my_input": "some_value"})
+			}
+
+			if err := os.RemoveAll(templateDir); err != nil {
+				t.Fatal(err)
+			}
+			abctestutil.WriteAll(t, templateDir, tc.upgradeFiles)
+
+			upgradeDL := &countingDownloader{
+				fakeDownloader: fakeDownloader{
+					sourceDir: templateDir,
+					outDLMeta: &templatesource.DownloadMetadata{
+						IsCanonical:     true,
+						CanonicalSource: "github.com/fake/repo",
+						LocationType:    tc.locationType,
+						Version:         "v2.0.0",
+						UpgradeChannel:  "latest",
+					},
+				},
+			}
+
+			result := UpgradeAll(ctx, &Params{
+				Clock:       clk,
+				CWD:         tempBase,
+				FS:          &common.RealFS{},
+				Location:    destBase,
+				Stdout:      os.Stdout,
+				TempDirBase: tempBase,
+				downloaderFactory: func(context.Context, *templatesource.ForUpgradeParams) (templatesource.Downloader, error) {
+					return upgradeDL, nil
+				},
+			})
+			if result.Err != nil {
+				t.Fatal(result.Err)
+			}
+
+			if upgradeDL.calls != tc.wantDownloads {
+				t.Errorf("got %d downloads, want %d", upgradeDL.calls, tc.wantDownloads)
+			}
+			if len(result.Results) != 3 {
+				t.Fatalf("got %d results, want 3", len(result.Results))
+			}
+			for _, r := range result.Results {
+				if r.Type != tc.wantType {
+					t.Errorf("manifest %s: got result type %q, want %q", r.ManifestPath, r.Type, tc.wantType)
+				}
+			}
+
+			got := abctestutil.LoadDir(t, destBase, abctestutil.SkipGlob("*/.abc/manifest*"))
+			if diff := cmp.Diff(got, tc.wantContents); diff != "" {
+				t.Errorf("dest contents were not as expected (-got,+want):\n%s", diff)
+			}
+
+			// The cache's temp dirs, like all other temp dirs, should be
+			// cleaned up.
+			leftovers, err := filepath.Glob(filepath.Join(tempBase, "template-cache-*"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(leftovers) > 0 {
+				t.Errorf("template cache dirs weren't removed: %v", leftovers)
+			}
+		})
+	}
+}
+
+type countingDownloader struct {
+	fakeDownloader
+	calls int
+}
+
+func (c *countingDownloader) Download(ctx context.Context, cwd, templateDir, destDir string) (*templatesource.DownloadMetadata, error) {
+	c.calls++
+	return c.fakeDownloader.Download(ctx, cwd, templateDir, destDir) //nolint:wrapcheck
+}
+
+func TestCompareHashes(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		got    string
+		want   string
+		wantOK bool
+		wantHR hashResult
+	}{
+		{
+			name:   "equal",
+			got:    "h1:abc",
+			want:   "h1:abc",
+			wantOK: true,
+			wantHR: match,
+		},
+		{
+			name:   "different",
+			got:    "h1:abc",
+			want:   "h1:def",
+			wantOK: true,
+			wantHR: mismatch,
+		},
+		{
+			name: "different_algorithms",
+			got:  "h1:abc",
+			want: "h2:abc",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			gotHR, gotOK := compareHashes(tc.got, tc.want)
+			if gotOK != tc.wantOK || gotHR != tc.wantHR {
+				t.Errorf("compareHashes(%q, %q) = (%q, %t), want (%q, %t)", tc.got, tc.want, gotHR, gotOK, tc.wantHR, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestFileHashCache(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file.txt")
+	abctestutil.WriteAll(t, dir, map[string]string{"file.txt": "hello"})
+
+	// The h1 hash of "hello".
+	const helloHash = "h1:LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ="
+
+	c := newFileHashCache()
+	got, err := c.hashAndCompare(path, helloHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != match {
+		t.Errorf("got %q, want %q", got, match)
+	}
+
+	// Change the file behind the cache's back. The cached hash should be used,
+	// proving that the file wasn't read again.
+	abctestutil.OverwriteJoin(t, dir, "file.txt", "goodbye")
+	got, err = c.hashAndCompare(path, helloHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != match {
+		t.Errorf("got %q from cache, want %q", got, match)
+	}
+
+	got, err = c.hashAndCompare(filepath.Join(dir, "nonexistent.txt"), helloHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != absent {
+		t.Errorf("got %q for a missing file, want %q", got, absent)
+	}
+}
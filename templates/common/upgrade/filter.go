@@ -24,7 +24,7 @@ import (
 	"gopkg.in/yaml.v3"
 
 	"github.com/abcxyz/abc/templates/common"
-	manifest "github.com/abcxyz/abc/templates/model/manifest/v1alpha1"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1beta7"
 	"github.com/abcxyz/pkg/logging"
 )
 
@@ -67,7 +67,7 @@ func filterOneManifest(ctx context.Context, path, filterCELExpr string, buf []by
 	// confusing the user with magically changing field values.
 	var asMap map[string]any
 	if err := yaml.Unmarshal(buf, &asMap); err != nil {
-		return false, fmt.Errorf("internal error: failed unmarshaling YAML back to map: %w", err)
+		return false, common.InternalErrorf("failed unmarshaling YAML back to map: %w", err)
 	}
 
 	celOpts := make([]cel.EnvOption, 0, len(asMap))
@@ -76,7 +76,7 @@ func filterOneManifest(ctx context.Context, path, filterCELExpr string, buf []by
 	}
 	celEnv, err := cel.NewEnv(celOpts...)
 	if err != nil {
-		return false, fmt.Errorf("internal error: cel.NewEnv(): %w", err)
+		return false, common.InternalErrorf("cel.NewEnv(): %w", err)
 	}
 
 	ast, issues := celEnv.Compile(filterCELExpr)
@@ -111,7 +111,7 @@ func filterOneManifest(ctx context.Context, path, filterCELExpr string, buf []by
 
 	result, ok := boolI.(bool)
 	if !ok {
-		return false, fmt.Errorf("internal error: CEL filter evaluation should return bool, got %T: %w", boolI, err)
+		return false, common.InternalErrorf("CEL filter evaluation should return bool, got %T: %w", boolI, err)
 	}
 
 	return result, nil
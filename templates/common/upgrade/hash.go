@@ -20,7 +20,6 @@ import (
 	"encoding/base64"
 	"fmt"
 	"hash"
-	"io"
 	"os"
 	"strings"
 
@@ -47,43 +46,117 @@ const (
 // hashAndCompare extracts the hash algorithm (e.g. "h1:" from wantHash, then
 // hashes the given path with that algorithm.
 func hashAndCompare(path, wantHash string) (hashResult, error) {
+	return (*fileHashCache)(nil).hashAndCompare(path, wantHash)
+}
+
+// fileHashCache remembers the hashes of files that were already read, so that
+// comparing one file against several expected hashes only reads it once. A nil
+// *fileHashCache is valid and caches nothing.
+type fileHashCache struct {
+	// The keys are file path and hash algorithm name. A nil value means the
+	// file doesn't exist.
+	hashes map[fileHashKey][]byte
+}
+
+type fileHashKey struct {
+	path, algo string
+}
+
+func newFileHashCache() *fileHashCache {
+	return &fileHashCache{hashes: map[fileHashKey][]byte{}}
+}
+
+// hashAndCompare is like the package-level hashAndCompare, but uses the cache.
+func (c *fileHashCache) hashAndCompare(path, wantHash string) (hashResult, error) {
+	algo, wantHashUnmarshaled, err := parseHash(wantHash)
+	if err != nil {
+		return "", err
+	}
+
+	key := fileHashKey{path: path, algo: algo}
+	gotHash, ok := []byte(nil), false
+	if c != nil {
+		gotHash, ok = c.hashes[key]
+	}
+	if !ok {
+		gotHash, err = hashFile(path, algo)
+		if err != nil {
+			return "", err
+		}
+		if c != nil {
+			c.hashes[key] = gotHash
+		}
+	}
+
+	if gotHash == nil {
+		return absent, nil
+	}
+	if !bytes.Equal(gotHash, wantHashUnmarshaled) {
+		return mismatch, nil
+	}
+	return match, nil
+}
+
+// compareHashes compares two hashes from manifests without reading any files.
+// This is valid when the file that was hashed to produce gotHash still has the
+// same contents, e.g. a file in the merge directory that was hashed when it was
+// rendered. The returned bool is false if the hashes used different
+// algorithms and so can't be compared.
+func compareHashes(gotHash, wantHash string) (hashResult, bool) {
+	gotAlgo, _, _ := strings.Cut(gotHash, ":")
+	wantAlgo, _, _ := strings.Cut(wantHash, ":")
+	if gotAlgo != wantAlgo {
+		return "", false
+	}
+	if gotHash == wantHash {
+		return match, true
+	}
+	return mismatch, true
+}
+
+// parseHash splits a hash like "h1:0a1b2d3c..." into the algorithm name and
+// the decoded hash bytes.
+func parseHash(h string) (string, []byte, error) {
 	// The hash should start with a string like "h1:" indicating the hash algorithm
-	tokens := strings.SplitN(wantHash, ":", 2)
+	tokens := strings.SplitN(h, ":", 2)
 	if len(tokens) != 2 {
-		return "", fmt.Errorf("malformed hash, expected it to begin with hash name followed by colon: %q", wantHash)
+		return "", nil, fmt.Errorf("malformed hash, expected it to begin with hash name followed by colon: %q", h)
 	}
 
-	var hasher hash.Hash
-	var wantHashUnmarshaled []byte
 	switch tokens[0] {
 	case "h1":
-		hasher = sha256.New()
-		var err error
-		wantHashUnmarshaled, err = base64.StdEncoding.DecodeString(tokens[1])
+		decoded, err := base64.StdEncoding.DecodeString(tokens[1])
 		if err != nil {
-			return "", fmt.Errorf("failed unmarshaling hash %q as base64: %w", tokens[1], err)
+			return "", nil, fmt.Errorf("failed unmarshaling hash %q as base64: %w", tokens[1], err)
 		}
+		return tokens[0], decoded, nil
 	default:
-		return "", fmt.Errorf("unknown hash algorithm %q", tokens[0])
+		return "", nil, fmt.Errorf("unknown hash algorithm %q", tokens[0])
+	}
+}
+
+// hashFile hashes the file at path with the given algorithm, which must have
+// been validated by parseHash. Returns nil if the file doesn't exist.
+func hashFile(path, algo string) ([]byte, error) {
+	var hasher hash.Hash
+	switch algo {
+	case "h1":
+		hasher = sha256.New()
+	default:
+		return nil, fmt.Errorf("unknown hash algorithm %q", algo)
 	}
 
 	inFile, err := os.Open(path)
 	if err != nil {
 		if common.IsNotExistErr(err) {
-			return absent, nil
+			return nil, nil
 		}
-		return "", fmt.Errorf("Open(%q): %w", path, err)
+		return nil, fmt.Errorf("Open(%q): %w", path, err)
 	}
 	defer inFile.Close()
 
-	if _, err := io.Copy(hasher, inFile); err != nil {
-		return "", fmt.Errorf("Copy(): %w", err)
-	}
-	gotHash := hasher.Sum(nil)
-
-	if !bytes.Equal(gotHash, wantHashUnmarshaled) {
-		return mismatch, nil
+	if _, err := common.PooledCopy(hasher, inFile); err != nil {
+		return nil, fmt.Errorf("Copy(): %w", err)
 	}
-
-	return match, nil
+	return hasher.Sum(nil), nil
 }
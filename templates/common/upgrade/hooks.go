@@ -0,0 +1,142 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/builtinvar"
+	"github.com/abcxyz/abc/templates/common/render/gotmpl"
+	"github.com/abcxyz/abc/templates/common/render/gotmpl/funcs"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1beta7"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// hookScope returns the variables that are in scope in the spec's pre_upgrade
+// and post_upgrade hooks: the inputs of the new template version, plus the
+// versions being upgraded from and to.
+func hookScope(s *spec.Spec, oldManifest, newManifest *manifest.Manifest) *common.Scope {
+	vars := inputsToMap(newManifest.Inputs)
+	vars[builtinvar.FromVersion] = oldManifest.TemplateVersion.Val
+	vars[builtinvar.ToVersion] = newManifest.TemplateVersion.Val
+	return common.NewScope(vars, funcs.Funcs(s.Features))
+}
+
+// runHooksParams contains the inputs to runHooks().
+type runHooksParams struct {
+	hooks []*spec.UpgradeHook
+	scope *common.Scope
+
+	// The files output by the old template version, which are the only files
+	// that "delete" hooks may match.
+	oldManifest *manifest.Manifest
+
+	// Where "print" hooks write, unless suppressPrint is true.
+	stdout        io.Writer
+	suppressPrint bool
+}
+
+// runHooks runs the given upgrade hooks in order, skipping those whose "if"
+// expression is false. It returns the slash-separated paths of the files
+// matched by "delete" hooks, which the merge then treats as discarded.
+func runHooks(ctx context.Context, p *runHooksParams) (map[string]struct{}, error) {
+	logger := logging.FromContext(ctx).With("logger", "runHooks")
+
+	deleted := make(map[string]struct{})
+	for i, hook := range p.hooks {
+		if hook.If.Val != "" {
+			var celResult bool
+			if err := common.CelCompileAndEval(ctx, p.scope, hook.If, &celResult); err != nil {
+				return nil, fmt.Errorf(`"if" expression "%s" failed at upgrade hook index %d action %q: %w`,
+					hook.If.Val, i, hook.Action.Val, err)
+			}
+			if !celResult {
+				logger.DebugContext(ctx, `skipping upgrade hook because "if" expression evaluated to false`,
+					"hook_index_from_zero", i,
+					"action", hook.Action.Val,
+					"cel_expr", hook.If.Val)
+				continue
+			}
+		}
+
+		switch {
+		case hook.Delete != nil:
+			matched, err := hookDelete(hook.Delete, p.scope, p.oldManifest)
+			if err != nil {
+				return nil, err
+			}
+			for _, m := range matched {
+				logger.DebugContext(ctx, "upgrade hook discarded file", "path", m)
+				deleted[m] = struct{}{}
+			}
+		case hook.Print != nil:
+			if err := hookPrint(hook.Print, p.scope, p.stdout, p.suppressPrint); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, common.InternalErrorf("unknown upgrade hook action type %q", hook.Action.Val)
+		}
+	}
+	return deleted, nil
+}
+
+// hookDelete returns the paths of the files output by the old template version
+// that match any of the delete action's glob patterns. The patterns may
+// contain Go templates.
+func hookDelete(d *spec.DeleteFiles, scope *common.Scope, oldManifest *manifest.Manifest) ([]string, error) {
+	patterns, err := gotmpl.ParseExecAll(d.Paths, scope)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	var out []string
+	for _, f := range oldManifest.OutputFiles {
+		for i, pattern := range patterns {
+			ok, err := path.Match(pattern, f.File.Val)
+			if err != nil {
+				return nil, d.Paths[i].Pos.Errorf("invalid glob pattern %q: %w", pattern, err)
+			}
+			if ok {
+				out = append(out, f.File.Val)
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+// hookPrint writes the print action's message, which may contain Go
+// templates.
+func hookPrint(pr *spec.Print, scope *common.Scope, stdout io.Writer, suppressPrint bool) error {
+	msg, err := gotmpl.ParseExec(pr.Message.Pos, pr.Message.Val, scope)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	if !strings.HasSuffix(msg, "\n") {
+		msg += "\n"
+	}
+	if suppressPrint || stdout == nil {
+		return nil
+	}
+	if _, err := stdout.Write([]byte(msg)); err != nil {
+		return fmt.Errorf("error writing to stdout: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upgrade
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/vcs"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1beta7"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// inputFilesForRender checks whether the input files recorded in the old
+// manifest have changed since they were read, and returns the input files to
+// use when rendering the new template version. Those are the --input-file
+// files, plus the recorded input files if --reuse-input-files was given.
+//
+// A changed input file is only worth a warning, since its values were frozen
+// into the manifest and are still used unless the file is reused.
+//
+// Like a local template location (see templatesource.ForUpgrade), a recorded
+// input file must be in the same version-controlled workspace as the manifest,
+// or underneath the installed directory if it's not in a workspace. Otherwise a
+// malicious manifest in a cloned repo could read any file on the machine.
+// Input files outside of that boundary are ignored with a warning.
+func inputFilesForRender(ctx context.Context, p *Params, installedDir string, oldManifest *manifest.Manifest) ([]string, error) {
+	logger := logging.FromContext(ctx).With("logger", "inputFilesForRender")
+
+	out := append([]string(nil), p.InputFiles...)
+	alreadyGiven := make(map[string]struct{}, len(p.InputFiles))
+	for _, f := range p.InputFiles {
+		alreadyGiven[common.JoinIfRelative(p.CWD, f)] = struct{}{}
+	}
+	if len(oldManifest.InputFiles) == 0 {
+		return out, nil
+	}
+
+	boundary := installedDir
+	ws, ok, err := vcs.Detect(ctx, installedDir)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	if ok {
+		boundary = ws.Root
+	}
+
+	for _, recorded := range oldManifest.InputFiles {
+		path := filepath.Join(installedDir, filepath.FromSlash(recorded.Path.Val))
+		if rel, err := filepath.Rel(boundary, path); err != nil || !filepath.IsLocal(rel) {
+			logger.WarnContext(ctx, "ignoring an input file recorded in the manifest, because it's outside of the workspace containing the manifest; pass it with --input-file if it should be used",
+				"input_file", path,
+				"workspace", boundary)
+			continue
+		}
+
+		result, err := hashAndCompareFS(p.FS, path, recorded.Hash.Val)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case result == absent:
+			logger.WarnContext(ctx, "an input file that was used when rendering this template no longer exists; the input values saved in the manifest will be used",
+				"input_file", path)
+			continue
+		case result == mismatch && !p.ReuseInputFiles:
+			logger.WarnContext(ctx, "an input file that was used when rendering this template has changed since; the input values saved in the manifest will be used, unless --reuse-input-files is given",
+				"input_file", path)
+		}
+
+		if !p.ReuseInputFiles {
+			continue
+		}
+		if _, ok := alreadyGiven[path]; ok {
+			continue
+		}
+		alreadyGiven[path] = struct{}{}
+		out = append(out, path)
+	}
+	return out, nil
+}
+
+// hashAndCompareFS is like hashAndCompare, but reads the file through the
+// given FS. Input files are small, so they're read all at once.
+func hashAndCompareFS(fsys common.FS, path, wantHash string) (hashResult, error) {
+	_, wantHashUnmarshaled, err := parseHash(wantHash) // only h1 is supported
+	if err != nil {
+		return "", err
+	}
+	buf, err := fsys.ReadFile(path)
+	if err != nil {
+		if common.IsNotExistErr(err) {
+			return absent, nil
+		}
+		return "", fmt.Errorf("ReadFile(%q): %w", path, err)
+	}
+	gotHash := sha256.Sum256(buf)
+	if !bytes.Equal(gotHash[:], wantHashUnmarshaled) {
+		return mismatch, nil
+	}
+	return match, nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	"github.com/Masterminds/semver/v3"
+
+	"github.com/abcxyz/abc/templates/common"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1beta7"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// migrateInputs returns the input values from the old manifest, plus the
+// values computed by the input_migrations in the spec of the new template
+// version that apply to the old template version. The old input values are
+// in scope in the migrations' CEL expressions.
+//
+// A migration never overwrites an input value that's already in the old
+// manifest, so that a migration that was already applied by an earlier
+// upgrade doesn't clobber the user's value.
+func migrateInputs(ctx context.Context, spec *spec.Spec, oldManifest *manifest.Manifest) (map[string]string, error) {
+	logger := logging.FromContext(ctx).With("logger", "migrateInputs")
+
+	oldInputs := inputsToMap(oldManifest.Inputs)
+	if len(spec.InputMigrations) == 0 {
+		return oldInputs, nil
+	}
+
+	oldVersion := oldManifest.TemplateVersion.Val
+	scope := common.NewScope(oldInputs, nil)
+	out := maps.Clone(oldInputs)
+	for _, migration := range spec.InputMigrations {
+		ok, err := versionMatches(migration.FromVersions.Val, oldVersion)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		for _, mapping := range migration.Inputs {
+			name := mapping.Name.Val
+			if _, ok := out[name]; ok {
+				continue
+			}
+			var val string
+			if err := common.CelCompileAndEval(ctx, scope, mapping.Value, &val); err != nil {
+				return nil, fmt.Errorf("failed migrating input %q from template version %q: %w", name, oldVersion, err)
+			}
+			logger.InfoContext(ctx, "migrated input value from the old template version",
+				"input", name,
+				"old_version", oldVersion)
+			out[name] = val
+		}
+	}
+	return out, nil
+}
+
+// versionMatches returns whether the given template version satisfies the
+// given semver constraint. An empty constraint matches every version. A version
+// that isn't a semver version, like a git SHA, matches no constraint.
+func versionMatches(constraint, version string) (bool, error) {
+	if constraint == "" {
+		return true, nil
+	}
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return false, fmt.Errorf("invalid from_versions constraint %q: %w", constraint, err)
+	}
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return false, nil //nolint:nilerr
+	}
+	return c.Check(v), nil
+}
@@ -19,11 +19,13 @@ import (
 	"fmt"
 	"path/filepath"
 	"sort"
+	"strings"
 
 	"golang.org/x/exp/maps"
 
 	"github.com/abcxyz/abc/templates/common"
 	manifestutil "github.com/abcxyz/abc/templates/model/manifest"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1beta7"
 	"github.com/abcxyz/pkg/logging"
 	"github.com/abcxyz/pkg/sets"
 )
@@ -87,6 +89,11 @@ const (
 type mergeDecision struct {
 	action           Action
 	humanExplanation string
+
+	// Only used with the WriteNew action. If non-nil, these contents are
+	// written instead of the new template's output, because a merge strategy
+	// combined the two versions of the file.
+	contents []byte
 }
 
 // decideMergeParams are the inputs to decideMerge(). It contains information
@@ -124,6 +131,33 @@ type decideMergeParams struct {
 	// True if this file was included by the "include" action from the
 	// destination folder rather than the template folder (somewhat rare).
 	isIncludedFromDestination bool
+
+	// True if a pre_upgrade hook of the new template discarded the local copy
+	// of this file, so any local edits don't matter.
+	isDeletedByHook bool
+}
+
+// evidence returns the parts of the decideMergeParams that are relevant to the
+// decision, for explaining it to the user.
+func (o *decideMergeParams) evidence() *MergeEvidence {
+	out := &MergeEvidence{
+		InOldManifest:           o.isInOldManifest,
+		InNewManifest:           o.isInNewManifest,
+		IncludedFromDestination: o.isIncludedFromDestination,
+		DeletedByHook:           o.isDeletedByHook,
+	}
+	// These are the same conditions under which mergeAll computes each hash
+	// comparison.
+	if o.isInOldManifest {
+		out.LocalVsOldHash = string(o.oldFileMatchesOldHash)
+		if o.isInNewManifest {
+			out.NewTemplateVsOldHash = string(o.newFileMatchesOldHash)
+		}
+	}
+	if o.isInNewManifest {
+		out.LocalVsNewHash = string(o.oldFileMatchesNewHash)
+	}
+	return out
 }
 
 // decideMerge is the core of the algorithm that merges the template output with
@@ -134,6 +168,27 @@ type decideMergeParams struct {
 // conflict resolution as possible.
 func decideMerge(o *decideMergeParams) (*mergeDecision, error) {
 	switch {
+	// Case: a pre_upgrade hook discarded the local copy of this file, which was
+	// output by the old template version.
+	case o.isDeletedByHook && o.isInOldManifest:
+		switch {
+		case o.isInNewManifest:
+			return &mergeDecision{
+				action:           WriteNew,
+				humanExplanation: "a pre_upgrade hook of the new template discarded this file, so the new template's version is written regardless of local edits",
+			}, nil
+		case o.oldFileMatchesOldHash == absent:
+			return &mergeDecision{
+				action:           Noop,
+				humanExplanation: "a pre_upgrade hook of the new template discarded this file, which was already deleted locally, and the new template no longer outputs it",
+			}, nil
+		default:
+			return &mergeDecision{
+				action:           DeleteAction,
+				humanExplanation: "a pre_upgrade hook of the new template discarded this file, and the new template no longer outputs it",
+			}, nil
+		}
+
 	// Case: this file was not output by the old template version, but is output by this template version.
 	case !o.isInOldManifest && o.isInNewManifest:
 		switch o.oldFileMatchesNewHash {
@@ -230,6 +285,10 @@ func mergeAll(ctx context.Context, p *commitParams, dryRun bool) ([]ActionTaken,
 
 	actionsTaken := make([]ActionTaken, 0, len(filesUnion))
 
+	// Each locally installed file may be compared against both its old and new
+	// hash; this makes sure it's only read once.
+	hashCache := newFileHashCache()
+
 	for _, relPath := range filesUnion {
 		oldHash, isInOldManifest := oldHashes[relPath]
 		newHash, isInNewManifest := newHashes[relPath]
@@ -244,18 +303,27 @@ func mergeAll(ctx context.Context, p *commitParams, dryRun bool) ([]ActionTaken,
 
 		if isInOldManifest {
 			var err error
-			oldFileMatchesOldHash, err = hashAndCompare(paths.fromOldLocal, oldHash)
+			oldFileMatchesOldHash, err = hashCache.hashAndCompare(paths.fromOldLocal, oldHash)
 			if err != nil {
 				return nil, err
 			}
 
-			newFileMatchesOldHash, err = hashAndCompare(paths.fromNewTemplate, oldHash)
-			if err != nil {
-				return nil, err
+			// The new manifest's hash was computed from the file in the merge
+			// directory, so when the template's output for this file is
+			// unchanged, we know that without reading the file again.
+			var ok bool
+			if isInNewManifest {
+				newFileMatchesOldHash, ok = compareHashes(newHash, oldHash)
+			}
+			if !ok {
+				newFileMatchesOldHash, err = hashCache.hashAndCompare(paths.fromNewTemplate, oldHash)
+				if err != nil {
+					return nil, err
+				}
 			}
 		}
 		if isInNewManifest {
-			oldFileMatchesNewHash, err = hashAndCompare(paths.fromOldLocal, newHash)
+			oldFileMatchesNewHash, err = hashCache.hashAndCompare(paths.fromOldLocal, newHash)
 			if err != nil {
 				return nil, err
 			}
@@ -268,22 +336,36 @@ func mergeAll(ctx context.Context, p *commitParams, dryRun bool) ([]ActionTaken,
 			newFileMatchesOldHash:     newFileMatchesOldHash,
 			oldFileMatchesNewHash:     oldFileMatchesNewHash,
 			isIncludedFromDestination: paths.fromReversed != "",
+			isDeletedByHook:           isDeletedByHook(p, relPath),
 		}
 
 		decision, err := decideMerge(hr)
 		if err != nil {
 			return nil, err
 		}
+		if strategy := strategyFor(p.mergeStrategies, relPath); strategy != "" && decision.action.IsConflict() {
+			if decision, err = applyStrategy(ctx, p.fs, strategy, decision, paths); err != nil {
+				return nil, err
+			}
+		}
 
 		action, err := actuateMergeDecision(ctx, p, dryRun, decision, paths)
 		if err != nil {
 			return nil, fmt.Errorf("failed filesystem operation during merge: %w", err)
 		}
+		action.Evidence = hr.evidence()
 		actionsTaken = append(actionsTaken, action)
 	}
 	return actionsTaken, nil
 }
 
+// isDeletedByHook returns whether a pre_upgrade hook discarded the local copy of
+// the file at the given path.
+func isDeletedByHook(p *commitParams, relPath string) bool {
+	_, ok := p.deletedByHooks[filepath.ToSlash(relPath)]
+	return ok
+}
+
 const (
 	// These are appended to files that need manual merge conflict resolution.
 	SuffixLocallyAdded                  = ".abcmerge_locally_added"
@@ -295,6 +377,32 @@ const (
 	ConflictSuffixBegins = ".abcmerge_"
 )
 
+// ConflictFilePath returns the path of the file that a merge conflict in the
+// file at relPath creates, given one of the Suffix* constants and one of the
+// manifest.ConflictFileNames* values. With "suffix" naming, the suffix is
+// appended, like main.go.abcmerge_from_new_template. With "keep_extension"
+// naming, it goes before the file extension, like
+// main.abcmerge_from_new_template.go, so that editors and formatters still
+// recognize the file type. Files without an extension, like Makefile or
+// .gitignore, are named the same way under both namings.
+func ConflictFilePath(relPath, suffix, naming string) string {
+	if naming != manifest.ConflictFileNamesKeepExtension {
+		return relPath + suffix
+	}
+	base := filepath.Base(relPath)
+	ext := filepath.Ext(base)
+	if ext == "" || ext == base {
+		return relPath + suffix
+	}
+	return strings.TrimSuffix(relPath, ext) + suffix + ext
+}
+
+// IsConflictFile returns whether the file at the given path was created by a
+// merge conflict, under either conflict file naming.
+func IsConflictFile(path string) bool {
+	return strings.Contains(filepath.Base(path), ConflictSuffixBegins)
+}
+
 // oneFileMergePaths contains the paths for all the different versions of a
 // file, used by the merge logic that merges the output of the new template with
 // the user's existing template output directory.
@@ -320,7 +428,14 @@ type oneFileMergePaths struct {
 // newMergePaths locates the various files that might be needed by the merge
 // algorithm.
 func newMergePaths(p *commitParams, relPath string) (*oneFileMergePaths, error) {
-	fromReversed := filepath.Join(p.reversedPatchDir, relPath)
+	reversedRel := relPath
+	for _, f := range p.oldManifest.OutputFiles {
+		if f.File.Val == filepath.ToSlash(relPath) {
+			reversedRel = reversedRelPath(f)
+			break
+		}
+	}
+	fromReversed := filepath.Join(p.reversedPatchDir, reversedRel)
 	if ok, err := common.Exists(fromReversed); err != nil {
 		return nil, err //nolint:wrapcheck
 	} else if !ok {
@@ -359,6 +474,12 @@ func actuateMergeDecision(ctx context.Context, p *commitParams, dryRun bool, dec
 
 	switch decision.action {
 	case WriteNew:
+		if decision.contents != nil {
+			if err := writeOrDryRun(p.fs, dryRun, paths.fromNewTemplate, installedPath, decision.contents); err != nil {
+				return ActionTaken{}, err
+			}
+			return actionTaken, nil
+		}
 		if err := common.CopyFile(ctx, nil, p.fs, paths.fromNewTemplate, installedPath, dryRun, nil); err != nil {
 			return ActionTaken{}, err //nolint:wrapcheck
 		}
@@ -371,38 +492,34 @@ func actuateMergeDecision(ctx context.Context, p *commitParams, dryRun bool, dec
 		}
 		return actionTaken, nil
 	case DeleteEditConflict:
-		dstPath := installedPath + SuffixFromNewTemplateLocallyDeleted
+		relIncoming := ConflictFilePath(paths.relative, SuffixFromNewTemplateLocallyDeleted, p.conflictFileNames)
+		dstPath := filepath.Join(p.installedDir, relIncoming)
 		if err := common.CopyFile(ctx, nil, p.fs, paths.fromNewTemplate, dstPath, dryRun, nil); err != nil {
 			return ActionTaken{}, err //nolint:wrapcheck
 		}
-		actionTaken.IncomingTemplatePath = paths.relative + SuffixFromNewTemplateLocallyDeleted
+		actionTaken.IncomingTemplatePath = relIncoming
 		return actionTaken, nil
 	case EditDeleteConflict:
-		renamedPath := installedPath + SuffixWantToDelete
+		relRenamed := ConflictFilePath(paths.relative, SuffixWantToDelete, p.conflictFileNames)
+		renamedPath := filepath.Join(p.installedDir, relRenamed)
 		if err := common.CopyFile(ctx, nil, p.fs, paths.fromOldLocal, renamedPath, dryRun, nil); err != nil {
 			return ActionTaken{}, err //nolint:wrapcheck
 		}
 		if err := removeOrDryRun(p.fs, dryRun, installedPath); err != nil {
 			return ActionTaken{}, err
 		}
-		actionTaken.OursPath = paths.relative + SuffixWantToDelete
+		actionTaken.OursPath = relRenamed
 		return actionTaken, nil
-	case EditEditConflict:
-		incomingPath := installedPath + SuffixFromNewTemplate
+	case EditEditConflict, AddAddConflict:
+		relIncoming := ConflictFilePath(paths.relative, SuffixFromNewTemplate, p.conflictFileNames)
+		incomingPath := filepath.Join(p.installedDir, relIncoming)
 		if err := common.CopyFile(ctx, nil, p.fs, paths.fromNewTemplate, incomingPath, dryRun, nil); err != nil {
 			return ActionTaken{}, err //nolint:wrapcheck
 		}
-		actionTaken.IncomingTemplatePath = paths.relative + SuffixFromNewTemplate
-		return actionTaken, nil
-	case AddAddConflict:
-		incomingPath := installedPath + SuffixFromNewTemplate
-		if err := common.CopyFile(ctx, nil, p.fs, paths.fromNewTemplate, incomingPath, dryRun, nil); err != nil {
-			return ActionTaken{}, err //nolint:wrapcheck
-		}
-		actionTaken.IncomingTemplatePath = paths.relative + SuffixFromNewTemplate
+		actionTaken.IncomingTemplatePath = relIncoming
 		return actionTaken, nil
 	default:
-		return ActionTaken{}, fmt.Errorf("internal error: unrecognized merged action %v", decision.action)
+		return ActionTaken{}, common.InternalErrorf("unrecognized merged action %v", decision.action)
 	}
 }
 
@@ -412,3 +529,19 @@ func removeOrDryRun(fs common.FS, dryRun bool, path string) error {
 	}
 	return fs.Remove(path) //nolint:wrapcheck
 }
+
+// writeOrDryRun writes the given contents to dst, with the permissions of the
+// file modeFrom.
+func writeOrDryRun(fs common.FS, dryRun bool, modeFrom, dst string, contents []byte) error {
+	fi, err := fs.Stat(modeFrom)
+	if err != nil {
+		return fmt.Errorf("Stat(%q): %w", modeFrom, err)
+	}
+	if dryRun {
+		return nil
+	}
+	if err := fs.WriteFile(dst, contents, fi.Mode().Perm()); err != nil {
+		return fmt.Errorf("WriteFile(%q): %w", dst, err)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upgrade
+
+import (
+	"testing"
+
+	"github.com/abcxyz/abc/templates/model/manifest/v1beta7"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDecideMergeParams_Evidence(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		in   *decideMergeParams
+		want *MergeEvidence
+	}{
+		{
+			name: "added_by_new_template",
+			in: &decideMergeParams{
+				isInNewManifest:       true,
+				oldFileMatchesOldHash: absent,
+				newFileMatchesOldHash: absent,
+				oldFileMatchesNewHash: absent,
+			},
+			want: &MergeEvidence{
+				InNewManifest:  true,
+				LocalVsNewHash: "absent",
+			},
+		},
+		{
+			name: "removed_by_new_template",
+			in: &decideMergeParams{
+				isInOldManifest:           true,
+				isIncludedFromDestination: true,
+				oldFileMatchesOldHash:     mismatch,
+				newFileMatchesOldHash:     absent,
+				oldFileMatchesNewHash:     absent,
+			},
+			want: &MergeEvidence{
+				InOldManifest:           true,
+				IncludedFromDestination: true,
+				LocalVsOldHash:          "mismatch",
+			},
+		},
+		{
+			name: "deleted_by_hook",
+			in: &decideMergeParams{
+				isInOldManifest:       true,
+				isDeletedByHook:       true,
+				oldFileMatchesOldHash: mismatch,
+				newFileMatchesOldHash: absent,
+				oldFileMatchesNewHash: absent,
+			},
+			want: &MergeEvidence{
+				InOldManifest:  true,
+				DeletedByHook:  true,
+				LocalVsOldHash: "mismatch",
+			},
+		},
+		{
+			name: "in_both",
+			in: &decideMergeParams{
+				isInOldManifest:       true,
+				isInNewManifest:       true,
+				oldFileMatchesOldHash: mismatch,
+				newFileMatchesOldHash: mismatch,
+				oldFileMatchesNewHash: match,
+			},
+			want: &MergeEvidence{
+				InOldManifest:        true,
+				InNewManifest:        true,
+				LocalVsOldHash:       "mismatch",
+				NewTemplateVsOldHash: "mismatch",
+				LocalVsNewHash:       "match",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if diff := cmp.Diff(tc.in.evidence(), tc.want); diff != "" {
+				t.Errorf("evidence was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestConflictFilePath(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		relPath string
+		suffix  string
+		naming  string
+		want    string
+	}{
+		{
+			name:    "keep_extension",
+			relPath: "main.go",
+			suffix:  SuffixFromNewTemplate,
+			naming:  manifest.ConflictFileNamesKeepExtension,
+			want:    "main.abcmerge_from_new_template.go",
+		},
+		{
+			name:    "keep_extension_subdir",
+			relPath: "dir/a.tar.gz",
+			suffix:  SuffixLocallyAdded,
+			naming:  manifest.ConflictFileNamesKeepExtension,
+			want:    "dir/a.tar.abcmerge_locally_added.gz",
+		},
+		{
+			name:    "keep_extension_no_extension",
+			relPath: "Makefile",
+			suffix:  SuffixWantToDelete,
+			naming:  manifest.ConflictFileNamesKeepExtension,
+			want:    "Makefile.abcmerge_template_wants_to_delete",
+		},
+		{
+			name:    "keep_extension_dotfile",
+			relPath: "dir/.gitignore",
+			suffix:  SuffixFromNewTemplate,
+			naming:  manifest.ConflictFileNamesKeepExtension,
+			want:    "dir/.gitignore.abcmerge_from_new_template",
+		},
+		{
+			name:    "suffix",
+			relPath: "main.go",
+			suffix:  SuffixFromNewTemplate,
+			naming:  manifest.ConflictFileNamesSuffix,
+			want:    "main.go.abcmerge_from_new_template",
+		},
+		{
+			name:    "unset_means_suffix",
+			relPath: "main.go",
+			suffix:  SuffixFromNewTemplateLocallyDeleted,
+			want:    "main.go.abcmerge_locally_deleted_vs_new_template_version",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := ConflictFilePath(tc.relPath, tc.suffix, tc.naming)
+			if got != tc.want {
+				t.Errorf("ConflictFilePath(%q, %q, %q) = %q, want %q", tc.relPath, tc.suffix, tc.naming, got, tc.want)
+			}
+			if !IsConflictFile(got) {
+				t.Errorf("IsConflictFile(%q) = false, want true", got)
+			}
+			if IsConflictFile(tc.relPath) {
+				t.Errorf("IsConflictFile(%q) = true, want false", tc.relPath)
+			}
+		})
+	}
+}
@@ -0,0 +1,378 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upgrade
+
+// This file implements "abc render --reconcile", which re-renders a template
+// on top of a previous installation of the *same* template version, restoring
+// any files that have drifted from the template's output.
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/indexutil"
+	"github.com/abcxyz/abc/templates/common/render"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1beta7"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// ReconcileParams contains the arguments to Reconcile().
+type ReconcileParams struct {
+	// The parameters that would be used for a normal render. RenderParams.OutDir
+	// is the destination directory that's reconciled.
+	RenderParams *render.Params
+
+	// Glob patterns (in the style of path.Match, relative to the destination
+	// directory) of files that the user has intentionally overridden. Drift in
+	// these files is reported but not rewritten. This is the value of
+	// --reconcile-keep.
+	Keep []string
+}
+
+// DriftKind describes how a file differs from the template output.
+type DriftKind string
+
+const (
+	// DriftModified means the file exists, but its contents differ from what
+	// the template outputs.
+	DriftModified DriftKind = "modified"
+
+	// DriftMissing means the template outputs the file, but it doesn't exist in
+	// the destination directory.
+	DriftMissing DriftKind = "missing"
+)
+
+// DriftedFile is a file in the destination directory that doesn't match the
+// output of the template.
+type DriftedFile struct {
+	// The path relative to the destination directory, using forward slashes.
+	Path string
+
+	Kind DriftKind
+
+	// Whether the file was restored to the template's output. This is false for
+	// files that matched one of the ReconcileParams.Keep patterns.
+	Rewritten bool
+}
+
+// ReconcileResult is the outcome of Reconcile().
+type ReconcileResult struct {
+	// The manifest of the installation that was reconciled, relative to the
+	// destination directory. Empty if there was no previous installation of
+	// this template, in which case a normal render was done instead.
+	ManifestPath string
+
+	// The files that differed from the template output, sorted by path.
+	Drift []*DriftedFile
+
+	// DownloadMetadata describes the template that was rendered.
+	DownloadMetadata *templatesource.DownloadMetadata
+}
+
+// Reconcile looks for a manifest in the destination directory that was created
+// by the same template that's being rendered. If there is one, then the
+// template is rendered again at the version and with the inputs recorded in
+// that manifest, and every file whose contents have drifted from the template
+// output is rewritten, unless it matches one of the Keep patterns. Files that
+// were "included from destination" belong to the user and are never touched,
+// and the manifest is left as is, since the template version doesn't change.
+//
+// If there's no such manifest, Reconcile does a normal render.
+func Reconcile(ctx context.Context, p *ReconcileParams) (_ *ReconcileResult, rErr error) {
+	logger := logging.FromContext(ctx).With("logger", "Reconcile")
+	rp := p.RenderParams
+
+	for _, k := range p.Keep {
+		if _, err := path.Match(k, ""); err != nil {
+			return nil, fmt.Errorf("invalid --reconcile-keep pattern %q: %w", k, err)
+		}
+	}
+
+	// The manifest and files are read from the destination below, so an
+	// interrupted render into it is finished first.
+	if err := render.FinishInterruptedCommits(ctx, rp.FS, rp.OutDir); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	tempTracker := tempdir.NewDirTracker(rp.FS, rp.KeepTempDirs)
+	defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
+
+	templateDir, err := tempTracker.MkdirTempTracked(rp.TempDirBase, tempdir.TemplateDirNamePart)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	dlMeta, err := rp.Downloader.Download(ctx, rp.Cwd, templateDir, rp.OutDir)
+	if err != nil {
+		return nil, common.WithCategory(common.CategoryDownload,
+			fmt.Errorf("failed to download/copy template: %w", err))
+	}
+
+	manifestRelPath, oldManifest, err := findManifestForTemplate(ctx, rp.FS, rp.OutDir, dlMeta)
+	if err != nil {
+		return nil, err
+	}
+	if oldManifest == nil {
+		logger.InfoContext(ctx, "no previous installation of this template was found, doing a normal render",
+			"dest", rp.OutDir)
+		if _, err := render.RenderAlreadyDownloaded(ctx, dlMeta, templateDir, rp); err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+		return &ReconcileResult{DownloadMetadata: dlMeta}, nil
+	}
+
+	if v := oldManifest.TemplateVersion.Val; v != "" && v != dlMeta.Version {
+		// Reconciling is always against the version that's already installed,
+		// not whatever version the user asked for on the command line.
+		logger.InfoContext(ctx, "downloading the installed template version",
+			"version", v)
+		if templateDir, dlMeta, err = downloadInstalledVersion(ctx, rp, tempTracker, oldManifest); err != nil {
+			return nil, err
+		}
+	}
+
+	renderDir, err := tempTracker.MkdirTempTracked(rp.TempDirBase, tempdir.ReconcileDirNamePart)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	renderParams := *rp
+	renderParams.Backups = false
+	renderParams.DestDir = rp.OutDir
+	renderParams.InputsFromManifest = inputsToMap(oldManifest.Inputs)
+	renderParams.OutDir = renderDir
+	renderParams.OwnManifestPath = filepath.Join(rp.OutDir, manifestRelPath)
+	renderParams.SkipManifest = true
+	renderResult, err := render.RenderAlreadyDownloaded(ctx, dlMeta, templateDir, &renderParams)
+	if err != nil {
+		return nil, fmt.Errorf("failed rendering template: %w", err)
+	}
+
+	// Files that the template modifies in place are owned by the user, so
+	// they're not subject to reconciliation.
+	userOwned := make(map[string]struct{}, len(renderResult.IncludedFromDestination))
+	for _, f := range renderResult.IncludedFromDestination {
+		userOwned[f] = struct{}{}
+	}
+	for _, f := range oldManifest.OutputFiles {
+		if f.Patch != nil && f.Patch.Val != "" {
+			userOwned[filepath.FromSlash(f.File.Val)] = struct{}{}
+		}
+	}
+
+	drift, err := detectDrift(rp.FS, renderDir, rp.OutDir, userOwned, p.Keep)
+	if err != nil {
+		return nil, err
+	}
+
+	rewrite := make(map[string]struct{}, len(drift))
+	for _, d := range drift {
+		if d.Rewritten {
+			rewrite[filepath.FromSlash(d.Path)] = struct{}{}
+		}
+	}
+	if err := rewriteDrifted(ctx, rp, renderDir, rewrite); err != nil {
+		return nil, err
+	}
+
+	return &ReconcileResult{
+		DownloadMetadata: dlMeta,
+		Drift:            drift,
+		ManifestPath:     manifestRelPath,
+	}, nil
+}
+
+// findManifestForTemplate looks in the .abc directory of destDir for a manifest
+// created by the template described by dlMeta. Returns a nil manifest if there
+// isn't one. Templates without a canonical location can't be matched with a
+// manifest, so they never have one.
+func findManifestForTemplate(ctx context.Context, fs common.FS, destDir string, dlMeta *templatesource.DownloadMetadata) (string, *manifest.Manifest, error) {
+	if !dlMeta.IsCanonical {
+		return "", nil, nil
+	}
+
+	manifestDir := filepath.Join(destDir, common.ABCInternalDir)
+	paths, err := indexutil.CrawlManifests(manifestDir)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var foundPath string
+	var found *manifest.Manifest
+	for _, p := range paths {
+		m, _, err := loadManifest(ctx, fs, filepath.Join(manifestDir, p))
+		if err != nil {
+			return "", nil, err
+		}
+		if m.TemplateLocation.Val != dlMeta.CanonicalSource {
+			continue
+		}
+		if found != nil {
+			return "", nil, fmt.Errorf("there are multiple manifests for template %q in %q, so it's ambiguous which one to reconcile: %q and %q",
+				dlMeta.CanonicalSource, manifestDir, foundPath, p)
+		}
+		foundPath, found = p, m
+	}
+	if found == nil {
+		return "", nil, nil
+	}
+	return filepath.Join(common.ABCInternalDir, foundPath), found, nil
+}
+
+// downloadInstalledVersion downloads the template version recorded in the
+// given manifest into a new temp directory.
+func downloadInstalledVersion(ctx context.Context, rp *render.Params, tempTracker *tempdir.DirTracker, m *manifest.Manifest) (string, *templatesource.DownloadMetadata, error) {
+	downloader, err := templatesource.ForUpgrade(ctx, &templatesource.ForUpgradeParams{
+		InstalledDir:      rp.OutDir,
+		CanonicalLocation: m.TemplateLocation.Val,
+		LocType:           templatesource.LocationType(m.LocationType.Val),
+		GitProtocol:       rp.GitProtocol,
+		Version:           m.TemplateVersion.Val,
+		UpgradeChannel:    m.UpgradeChannel.Val,
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed creating downloader for manifest location %q: %w", m.TemplateLocation.Val, err)
+	}
+
+	templateDir, err := tempTracker.MkdirTempTracked(rp.TempDirBase, tempdir.TemplateDirNamePart)
+	if err != nil {
+		return "", nil, err //nolint:wrapcheck
+	}
+	dlMeta, err := downloader.Download(ctx, rp.Cwd, templateDir, rp.OutDir)
+	if err != nil {
+		return "", nil, common.WithCategory(common.CategoryDownload,
+			fmt.Errorf("failed to download/copy template: %w", err))
+	}
+	return templateDir, dlMeta, nil
+}
+
+// detectDrift compares each file rendered into renderDir with the file of the
+// same name in destDir. Files in userOwned are skipped. Files matching a keep
+// pattern are reported but not marked to be rewritten.
+func detectDrift(rfs common.FS, renderDir, destDir string, userOwned map[string]struct{}, keep []string) ([]*DriftedFile, error) {
+	var out []*DriftedFile
+	if err := fs.WalkDir(rfs, renderDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(renderDir, p)
+		if err != nil {
+			return fmt.Errorf("filepath.Rel(%s,%s): %w", renderDir, p, err)
+		}
+		if _, ok := userOwned[relPath]; ok {
+			return nil
+		}
+
+		want, err := rfs.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("ReadFile(%q): %w", p, err)
+		}
+		var kind DriftKind
+		got, err := rfs.ReadFile(filepath.Join(destDir, relPath))
+		switch {
+		case common.IsNotExistErr(err):
+			kind = DriftMissing
+		case err != nil:
+			return fmt.Errorf("ReadFile(%q): %w", filepath.Join(destDir, relPath), err)
+		case !bytes.Equal(got, want):
+			kind = DriftModified
+		default:
+			return nil // in sync
+		}
+
+		slashPath := filepath.ToSlash(relPath)
+		out = append(out, &DriftedFile{
+			Path:      slashPath,
+			Kind:      kind,
+			Rewritten: !matchesAny(keep, slashPath),
+		})
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed comparing rendered template with %q: %w", destDir, err)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Path < out[j].Path
+	})
+	return out, nil
+}
+
+// rewriteDrifted copies the files named in rewrite from renderDir to the
+// destination directory, backing up the existing files if backups are enabled.
+func rewriteDrifted(ctx context.Context, rp *render.Params, renderDir string, rewrite map[string]struct{}) error {
+	if len(rewrite) == 0 {
+		return nil
+	}
+
+	var backupDir string
+	backupDirMaker := func(rfs common.FS) (string, error) {
+		if backupDir != "" {
+			return backupDir, nil
+		}
+		if err := rfs.MkdirAll(rp.BackupDir, common.OwnerRWXPerms); err != nil {
+			return "", err //nolint:wrapcheck // err already contains path, and it will be wrapped later
+		}
+		var err error
+		backupDir, err = rfs.MkdirTemp(rp.BackupDir, "")
+		return backupDir, err //nolint:wrapcheck // err already contains path, and it will be wrapped later
+	}
+
+	for _, dryRun := range []bool{true, false} {
+		if _, err := common.CopyRecursive(ctx, nil, &common.CopyParams{
+			BackupDirMaker: backupDirMaker,
+			DryRun:         dryRun,
+			DstRoot:        rp.OutDir,
+			SrcRoot:        renderDir,
+			FS:             rp.FS,
+			// The render already applied the template's file metadata policy.
+			PreserveMetadata: true,
+			Visitor: func(relPath string, de fs.DirEntry) (common.CopyHint, error) {
+				if de.IsDir() {
+					return common.CopyHint{}, nil
+				}
+				_, ok := rewrite[relPath]
+				return common.CopyHint{
+					AllowPreexisting: true,
+					BackupIfExists:   rp.Backups,
+					Skip:             !ok,
+				}, nil
+			},
+		}); err != nil {
+			return fmt.Errorf("failed rewriting drifted files: %w", err)
+		}
+	}
+	return nil
+}
+
+// matchesAny returns whether relPath matches any of the given path.Match
+// patterns. The patterns have already been validated.
+func matchesAny(patterns []string, relPath string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, relPath); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,225 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upgrade
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/render"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestReconcile(t *testing.T) {
+	t.Parallel()
+
+	templateContents := map[string]string{
+		"spec.yaml": `
+api_version: 'cli.abcxyz.dev/v1beta6'
+kind: 'Template'
+desc: 'my template'
+inputs:
+  - name: 'color'
+    desc: 'a color'
+steps:
+  - desc: 'include some files'
+    action: 'include'
+    params:
+      paths: ['a.txt', 'dir']
+  - desc: 'include a file to be modified in place'
+    action: 'include'
+    params:
+      from: 'destination'
+      paths: ['in_place.txt']
+  - desc: 'Set favorite color'
+    action: 'string_replace'
+    params:
+      paths: ['a.txt', 'in_place.txt']
+      replacements:
+        - to_replace: 'purple'
+          with: '{{.color}}'
+`,
+		"a.txt":         "my favorite color is purple\n",
+		"dir/b.txt":     "b contents\n",
+		"dir/sub/c.txt": "c contents\n",
+	}
+	origDestContents := map[string]string{
+		"in_place.txt":  "purple\n",
+		"unrelated.txt": "not from the template\n",
+	}
+	renderedContents := map[string]string{
+		"a.txt":         "my favorite color is red\n",
+		"dir/b.txt":     "b contents\n",
+		"dir/sub/c.txt": "c contents\n",
+		"in_place.txt":  "red\n",
+		"unrelated.txt": "not from the template\n",
+	}
+
+	cases := []struct {
+		name              string
+		skipInitialRender bool
+		editDest          map[string]string
+		deleteFromDest    []string
+		keep              []string
+		inputs            map[string]string
+		want              *ReconcileResult
+		wantDestContents  map[string]string
+		wantErr           string
+	}{
+		{
+			name:             "no_drift",
+			want:             &ReconcileResult{},
+			wantDestContents: renderedContents,
+		},
+		{
+			name: "modified_and_missing_files_rewritten",
+			editDest: map[string]string{
+				"a.txt":        "my favorite color is blue\n",
+				"in_place.txt": "user edits are left alone\n",
+			},
+			deleteFromDest: []string{"dir/sub/c.txt"},
+			want: &ReconcileResult{
+				Drift: []*DriftedFile{
+					{Path: "a.txt", Kind: DriftModified, Rewritten: true},
+					{Path: "dir/sub/c.txt", Kind: DriftMissing, Rewritten: true},
+				},
+			},
+			wantDestContents: mapWith(renderedContents, map[string]string{
+				"in_place.txt": "user edits are left alone\n",
+			}),
+		},
+		{
+			name: "keep_pattern",
+			editDest: map[string]string{
+				"a.txt":     "my favorite color is blue\n",
+				"dir/b.txt": "customized\n",
+			},
+			keep: []string{"dir/*"},
+			want: &ReconcileResult{
+				Drift: []*DriftedFile{
+					{Path: "a.txt", Kind: DriftModified, Rewritten: true},
+					{Path: "dir/b.txt", Kind: DriftModified, Rewritten: false},
+				},
+			},
+			wantDestContents: mapWith(renderedContents, map[string]string{
+				"dir/b.txt": "customized\n",
+			}),
+		},
+		{
+			name:              "no_previous_installation_renders_normally",
+			skipInitialRender: true,
+			inputs:            map[string]string{"color": "red"},
+			want:              &ReconcileResult{},
+			wantDestContents:  renderedContents,
+		},
+		{
+			name:    "invalid_keep_pattern",
+			keep:    []string{"["},
+			wantErr: "invalid --reconcile-keep pattern",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			clk := clock.NewMock()
+
+			tempBase := t.TempDir()
+			abctestutil.WriteAll(t, tempBase, abctestutil.WithGitRepoAt("", nil))
+			templateDir := filepath.Join(tempBase, "template_dir")
+			destDir := filepath.Join(tempBase, "dest_dir")
+			abctestutil.WriteAll(t, templateDir, templateContents)
+			abctestutil.WriteAll(t, destDir, origDestContents)
+
+			var manifestPath string
+			if !tc.skipInitialRender {
+				renderResult := mustRender(t, ctx, clk, nil, tempBase, templateDir, destDir, map[string]string{"color": "red"})
+				manifestPath = renderResult.ManifestPath
+			}
+
+			abctestutil.WriteAll(t, destDir, tc.editDest)
+			for _, f := range tc.deleteFromDest {
+				if err := os.Remove(filepath.Join(destDir, f)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			downloader, err := templatesource.ParseSource(ctx, &templatesource.ParseSourceParams{
+				CWD:    tempBase,
+				Source: templateDir,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := Reconcile(ctx, &ReconcileParams{
+				Keep: tc.keep,
+				RenderParams: &render.Params{
+					Clock:           clk,
+					Cwd:             tempBase,
+					Downloader:      downloader,
+					FS:              &common.RealFS{},
+					InputsFromFlags: tc.inputs,
+					OutDir:          destDir,
+					TempDirBase:     tempBase,
+				},
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			tc.want.ManifestPath = manifestPath
+			if diff := cmp.Diff(got, tc.want, cmpIgnoreDLMeta); diff != "" {
+				t.Errorf("result was not as expected (-got,+want): %s", diff)
+			}
+
+			gotDestContents := abctestutil.LoadDir(t, destDir, abctestutil.SkipGlob(".abc/*"))
+			if diff := cmp.Diff(gotDestContents, tc.wantDestContents); diff != "" {
+				t.Errorf("dest contents were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+var cmpIgnoreDLMeta = cmp.FilterPath(func(p cmp.Path) bool {
+	return p.Last().String() == ".DownloadMetadata"
+}, cmp.Ignore())
+
+// mapWith returns a copy of m with the entries from overrides added.
+func mapWith(m, overrides map[string]string) map[string]string {
+	out := make(map[string]string, len(m)+len(overrides))
+	for k, v := range m {
+		out[k] = v
+	}
+	for k, v := range overrides {
+		out[k] = v
+	}
+	return out
+}
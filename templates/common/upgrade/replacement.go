@@ -0,0 +1,100 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upgrade
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/specutil"
+	"github.com/abcxyz/abc/templates/common/tempdir"
+	"github.com/abcxyz/abc/templates/common/templatesource"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// maxReplacementHops limits how many replacements are followed in one upgrade,
+// so that templates that name each other as replacements can't loop forever.
+const maxReplacementHops = 10
+
+// downloadedTemplate is a template that has been downloaded into dir.
+type downloadedTemplate struct {
+	dir     string
+	dlMeta  *templatesource.DownloadMetadata
+	dirhash string
+}
+
+// followReplacements checks whether the downloaded template is deprecated in
+// favor of a replacement that its author declared compatible. If so, and
+// --follow-replacement was given, the replacement is downloaded and returned
+// in place of the original, repeating until a template that isn't replaced is
+// reached. Otherwise the original is returned, with a warning if it could have
+// been replaced.
+func followReplacements(ctx context.Context, p *Params, tempTracker *tempdir.DirTracker, installedDir string, dl *downloadedTemplate) (*downloadedTemplate, error) {
+	logger := logging.FromContext(ctx).With("logger", "followReplacements")
+
+	seen := map[string]struct{}{}
+	for hops := 0; ; hops++ {
+		spec, err := specutil.Load(ctx, p.FS, dl.dir, dl.dlMeta.CanonicalSource)
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+		d := spec.Deprecated
+		if d == nil || !d.Compatible.Val {
+			return dl, nil
+		}
+		replacedBy := d.ReplacedBy.Val
+		if !p.FollowReplacement {
+			logger.WarnContext(ctx, "this template has a compatible replacement; use --follow-replacement to upgrade to it",
+				"template", dl.dlMeta.CanonicalSource,
+				"replaced_by", replacedBy)
+			return dl, nil
+		}
+		if _, ok := seen[replacedBy]; ok || hops == maxReplacementHops {
+			return nil, fmt.Errorf("gave up following template replacements after reaching %q again or following %d of them; the templates may name each other as replacements",
+				replacedBy, hops)
+		}
+		seen[replacedBy] = struct{}{}
+
+		logger.InfoContext(ctx, "upgrading to the template's replacement",
+			"template", dl.dlMeta.CanonicalSource,
+			"replaced_by", replacedBy)
+
+		downloader, err := templatesource.ParseSource(ctx, &templatesource.ParseSourceParams{
+			CWD:                p.CWD,
+			Source:             replacedBy,
+			FlagGitProtocol:    p.GitProtocol,
+			FlagUpgradeChannel: p.UpgradeChannel,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing the location of the replacement template %q: %w", replacedBy, err)
+		}
+		dir, err := tempTracker.MkdirTempTracked(p.TempDirBase, tempdir.TemplateDirNamePart)
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+		key := templateCacheKey{
+			location:       replacedBy,
+			gitProtocol:    p.GitProtocol,
+			upgradeChannel: p.UpgradeChannel,
+		}
+		dlMeta, dirhash, err := p.templateCache.download(ctx, key, downloader, p.CWD, dir, installedDir)
+		if err != nil {
+			return nil, common.WithCategory(common.CategoryDownload,
+				fmt.Errorf("failed downloading the replacement template %q: %w", replacedBy, err))
+		}
+		dl = &downloadedTemplate{dir: dir, dlMeta: dlMeta, dirhash: dirhash}
+	}
+}
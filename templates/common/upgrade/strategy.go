@@ -0,0 +1,208 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upgrade
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/abcxyz/abc/templates/common"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// strategyFor returns the merge strategy that the template author chose for
+// the given output file, or "" if there isn't one. The first matching entry
+// wins.
+func strategyFor(strategies []*spec.MergeStrategy, relPath string) string {
+	slashPath := filepath.ToSlash(relPath)
+	for _, s := range strategies {
+		for _, pattern := range s.Paths {
+			// The pattern was validated when the spec was loaded.
+			if ok, _ := path.Match(pattern.Val, slashPath); ok {
+				return s.Strategy.Val
+			}
+		}
+	}
+	return ""
+}
+
+// applyStrategy resolves a merge conflict using the given strategy, returning
+// a non-conflicting decision. If the strategy can't resolve this conflict, the
+// original decision is returned.
+func applyStrategy(ctx context.Context, fs common.FS, strategy string, decision *mergeDecision, paths *oneFileMergePaths) (*mergeDecision, error) {
+	logger := logging.FromContext(ctx).With("logger", "applyStrategy")
+
+	resolved := func(action Action, contents []byte) *mergeDecision {
+		return &mergeDecision{
+			action:           action,
+			humanExplanation: fmt.Sprintf("%s; the template's %q merge strategy for this file resolved the %s", decision.humanExplanation, strategy, decision.action),
+			contents:         contents,
+		}
+	}
+
+	switch decision.action {
+	case EditDeleteConflict:
+		// The template wants to delete a file that the user edited.
+		if strategy == spec.MergeStrategyTheirs {
+			return resolved(DeleteAction, nil), nil
+		}
+		return resolved(Noop, nil), nil
+	case DeleteEditConflict:
+		// The template changed a file that the user deleted.
+		if strategy == spec.MergeStrategyOurs {
+			return resolved(Noop, nil), nil
+		}
+		return resolved(WriteNew, nil), nil
+	case AddAddConflict, EditEditConflict:
+		// Handled below.
+	case WriteNew, DeleteAction, Noop:
+		return decision, nil
+	}
+
+	switch strategy {
+	case spec.MergeStrategyOurs:
+		return resolved(Noop, nil), nil
+	case spec.MergeStrategyTheirs:
+		return resolved(WriteNew, nil), nil
+	}
+
+	ours, err := fs.ReadFile(paths.fromOldLocal)
+	if err != nil {
+		return nil, fmt.Errorf("ReadFile(%q): %w", paths.fromOldLocal, err)
+	}
+	theirs, err := fs.ReadFile(paths.fromNewTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("ReadFile(%q): %w", paths.fromNewTemplate, err)
+	}
+
+	switch strategy {
+	case spec.MergeStrategyUnion:
+		return resolved(WriteNew, unionLines(ours, theirs)), nil
+	case spec.MergeStrategyJSONDeepMerge:
+		merged, err := jsonDeepMerge(ours, theirs)
+		if err != nil {
+			logger.WarnContext(ctx, "couldn't apply the json-deep-merge strategy, leaving the conflict for manual resolution",
+				"path", paths.relative,
+				"error", err)
+			return decision, nil
+		}
+		return resolved(WriteNew, merged), nil
+	}
+	return nil, common.InternalErrorf("unrecognized merge strategy %q", strategy)
+}
+
+// unionLines merges two versions of a file by keeping every line of both, like
+// git's "union" merge driver. Lines that the two versions have in common (by
+// longest common subsequence) appear once; where they differ, our lines come
+// before theirs.
+func unionLines(ours, theirs []byte) []byte {
+	a, b := common.SplitLines(string(ours)), common.SplitLines(string(theirs))
+
+	// A missing newline at the end of either version is added, so that its
+	// last line doesn't run into a line of the other version.
+	for _, lines := range [][]string{a, b} {
+		if n := len(lines); n > 0 && !strings.HasSuffix(lines[n-1], "\n") {
+			lines[n-1] += "\n"
+		}
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and
+	// b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			out.WriteString(a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out.WriteString(a[i])
+			i++
+		default:
+			out.WriteString(b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		out.WriteString(a[i])
+	}
+	for ; j < len(b); j++ {
+		out.WriteString(b[j])
+	}
+	return []byte(out.String())
+}
+
+// jsonDeepMerge merges two JSON documents. Objects are merged key by key,
+// recursively. Where both documents have a non-object value for the same key,
+// theirs (the template's) wins; keys that only one document has are kept.
+func jsonDeepMerge(ours, theirs []byte) ([]byte, error) {
+	var o, t any
+	if err := json.Unmarshal(ours, &o); err != nil {
+		return nil, fmt.Errorf("your file isn't valid JSON: %w", err)
+	}
+	if err := json.Unmarshal(theirs, &t); err != nil {
+		return nil, fmt.Errorf("the new template's file isn't valid JSON: %w", err)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(deepMerge(o, t)); err != nil {
+		return nil, fmt.Errorf("failed encoding merged JSON: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func deepMerge(ours, theirs any) any {
+	o, ok1 := ours.(map[string]any)
+	t, ok2 := theirs.(map[string]any)
+	if !ok1 || !ok2 {
+		return theirs
+	}
+	out := make(map[string]any, len(o)+len(t))
+	for k, v := range o {
+		out[k] = v
+	}
+	for k, v := range t {
+		if existing, ok := out[k]; ok {
+			out[k] = deepMerge(existing, v)
+		} else {
+			out[k] = v
+		}
+	}
+	return out
+}
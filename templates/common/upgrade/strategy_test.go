@@ -0,0 +1,305 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upgrade
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/model"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+	mdl "github.com/abcxyz/abc/templates/testutil/model"
+	"github.com/abcxyz/pkg/logging"
+)
+
+func TestStrategyFor(t *testing.T) {
+	t.Parallel()
+
+	strategies := []*spec.MergeStrategy{
+		{Paths: []model.String{mdl.S("package-lock.json")}, Strategy: mdl.S("theirs")},
+		{Paths: []model.String{mdl.S("gen/*.json"), mdl.S("*.json")}, Strategy: mdl.S("json-deep-merge")},
+	}
+
+	cases := []struct {
+		name    string
+		relPath string
+		want    string
+	}{
+		{
+			name:    "first_match_wins",
+			relPath: "package-lock.json",
+			want:    "theirs",
+		},
+		{
+			name:    "glob_in_subdir",
+			relPath: filepath.Join("gen", "x.json"),
+			want:    "json-deep-merge",
+		},
+		{
+			name:    "star_does_not_cross_dirs",
+			relPath: filepath.Join("other", "x.json"),
+			want:    "",
+		},
+		{
+			name:    "no_match",
+			relPath: "main.go",
+			want:    "",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := strategyFor(strategies, tc.relPath); got != tc.want {
+				t.Errorf("strategyFor(%q) = %q, want %q", tc.relPath, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestApplyStrategy(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name         string
+		strategy     string
+		action       Action
+		local        string
+		template     string
+		wantAction   Action
+		wantContents string
+	}{
+		{
+			name:       "ours_edit_delete_keeps_local",
+			strategy:   "ours",
+			action:     EditDeleteConflict,
+			wantAction: Noop,
+		},
+		{
+			name:       "theirs_edit_delete_deletes",
+			strategy:   "theirs",
+			action:     EditDeleteConflict,
+			wantAction: DeleteAction,
+		},
+		{
+			name:       "union_edit_delete_keeps_local",
+			strategy:   "union",
+			action:     EditDeleteConflict,
+			wantAction: Noop,
+		},
+		{
+			name:       "ours_delete_edit_leaves_deleted",
+			strategy:   "ours",
+			action:     DeleteEditConflict,
+			wantAction: Noop,
+		},
+		{
+			name:       "json_deep_merge_delete_edit_writes_new",
+			strategy:   "json-deep-merge",
+			action:     DeleteEditConflict,
+			wantAction: WriteNew,
+		},
+		{
+			name:       "ours_add_add",
+			strategy:   "ours",
+			action:     AddAddConflict,
+			local:      "mine\n",
+			template:   "theirs\n",
+			wantAction: Noop,
+		},
+		{
+			name:       "theirs_add_add",
+			strategy:   "theirs",
+			action:     AddAddConflict,
+			local:      "mine\n",
+			template:   "theirs\n",
+			wantAction: WriteNew,
+		},
+		{
+			name:         "union_add_add",
+			strategy:     "union",
+			action:       AddAddConflict,
+			local:        "common\nmine\n",
+			template:     "common\ntheirs\n",
+			wantAction:   WriteNew,
+			wantContents: "common\nmine\ntheirs\n",
+		},
+		{
+			name:       "not_a_conflict",
+			strategy:   "theirs",
+			action:     Noop,
+			wantAction: Noop,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+			tempDir := t.TempDir()
+			abctestutil.WriteAll(t, tempDir, map[string]string{
+				"local/f.txt":    tc.local,
+				"template/f.txt": tc.template,
+			})
+			paths := &oneFileMergePaths{
+				relative:        "f.txt",
+				fromOldLocal:    filepath.Join(tempDir, "local", "f.txt"),
+				fromNewTemplate: filepath.Join(tempDir, "template", "f.txt"),
+			}
+
+			got, err := applyStrategy(ctx, &common.RealFS{}, tc.strategy, &mergeDecision{action: tc.action}, paths)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.action != tc.wantAction {
+				t.Errorf("got action %q, want %q", got.action, tc.wantAction)
+			}
+			if diff := cmp.Diff(string(got.contents), tc.wantContents); diff != "" {
+				t.Errorf("merged contents were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestUnionLines(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		ours   string
+		theirs string
+		want   string
+	}{
+		{
+			name:   "both_empty",
+			ours:   "",
+			theirs: "",
+			want:   "",
+		},
+		{
+			name:   "identical",
+			ours:   "a\nb\n",
+			theirs: "a\nb\n",
+			want:   "a\nb\n",
+		},
+		{
+			name:   "additions_on_both_sides",
+			ours:   "a\nmine\nb\n",
+			theirs: "a\nb\ntheirs\n",
+			want:   "a\nmine\nb\ntheirs\n",
+		},
+		{
+			name:   "same_position_ours_first",
+			ours:   "a\nmine\nc\n",
+			theirs: "a\ntheirs\nc\n",
+			want:   "a\nmine\ntheirs\nc\n",
+		},
+		{
+			name:   "missing_final_newline",
+			ours:   "a",
+			theirs: "a\nb",
+			want:   "a\nb\n",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := string(unionLines([]byte(tc.ours), []byte(tc.theirs)))
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("union was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestJSONDeepMerge(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		ours    string
+		theirs  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "nested_objects",
+			ours:   `{"a": {"x": 1, "y": 2}, "mine": true}`,
+			theirs: `{"a": {"x": 10, "z": 3}}`,
+			want: `{
+  "a": {
+    "x": 10,
+    "y": 2,
+    "z": 3
+  },
+  "mine": true
+}
+`,
+		},
+		{
+			name:   "arrays_are_replaced",
+			ours:   `{"list": [1, 2]}`,
+			theirs: `{"list": [3]}`,
+			want: `{
+  "list": [
+    3
+  ]
+}
+`,
+		},
+		{
+			name:   "top_level_not_object",
+			ours:   `[1]`,
+			theirs: `{"a": "<b>"}`,
+			want: `{
+  "a": "<b>"
+}
+`,
+		},
+		{
+			name:    "invalid",
+			ours:    `{`,
+			theirs:  `{}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := jsonDeepMerge([]byte(tc.ours), []byte(tc.theirs))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v, want error: %t", err, tc.wantErr)
+			}
+			if diff := cmp.Diff(string(got), tc.want); diff != "" {
+				t.Errorf("merged JSON was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
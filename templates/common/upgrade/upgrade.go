@@ -17,8 +17,9 @@
 package upgrade
 
 import (
-	"bytes"
 	"context"
+	"crypto"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
@@ -27,22 +28,30 @@ import (
 	"slices"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/benbjohnson/clock"
 	"gopkg.in/yaml.v3"
 
 	"github.com/abcxyz/abc/internal/version"
 	"github.com/abcxyz/abc/templates/common"
-	"github.com/abcxyz/abc/templates/common/dirhash"
+	"github.com/abcxyz/abc/templates/common/auditlog"
+	"github.com/abcxyz/abc/templates/common/config"
+	"github.com/abcxyz/abc/templates/common/destlock"
+	"github.com/abcxyz/abc/templates/common/indexutil"
 	"github.com/abcxyz/abc/templates/common/input"
+	"github.com/abcxyz/abc/templates/common/patch"
 	"github.com/abcxyz/abc/templates/common/render"
-	"github.com/abcxyz/abc/templates/common/run"
+	"github.com/abcxyz/abc/templates/common/signing"
+	"github.com/abcxyz/abc/templates/common/specutil"
 	"github.com/abcxyz/abc/templates/common/tempdir"
 	"github.com/abcxyz/abc/templates/common/templatesource"
 	"github.com/abcxyz/abc/templates/model"
 	"github.com/abcxyz/abc/templates/model/decode"
 	"github.com/abcxyz/abc/templates/model/header"
-	manifest "github.com/abcxyz/abc/templates/model/manifest/v1alpha1"
+	manifestutil "github.com/abcxyz/abc/templates/model/manifest"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1beta7"
+	spec "github.com/abcxyz/abc/templates/model/spec/v1beta7"
 	"github.com/abcxyz/pkg/logging"
 	"github.com/abcxyz/pkg/sets"
 )
@@ -58,9 +67,16 @@ import (
 //   - support --merge-strategy=ours|theirs to resolve conflicts
 //   - support --merge-strategy=ai to try to get an LLM to semantically resolve the diff
 //   - interactive conflict resolution
-//   - patch .rej files look the same on all platforms (mac and Linux differ)
 
-const rejectedPatchSuffix = ".patch.rej"
+const (
+	rejectedPatchSuffix = ".patch.rej"
+
+	// reversalFuzz is how many context lines at the start and end of a hunk
+	// may be ignored when reversing a patch. It's big enough to ignore all of
+	// them, since a reversal that applies in a slightly wrong place is
+	// usually easier to fix up than a rejected hunk.
+	reversalFuzz = 999
+)
 
 // Params contains all the arguments to Upgrade().
 type Params struct {
@@ -74,6 +90,10 @@ type Params struct {
 
 	Clock clock.Clock
 
+	// The value of --conflict-file-names. If empty, each installation keeps the
+	// naming recorded in its manifest.
+	ConflictFileNames string
+
 	// The directory that relative paths are interpreted as being relative to.
 	// In testing, this is a temp directory. If empty, the value of os.Getwd()
 	// will be used.
@@ -85,18 +105,39 @@ type Params struct {
 	// The value of --debug-step-diffs.
 	DebugStepDiffs bool
 
+	// The value of --debug-report.
+	DebugReportDir string
+
 	// Continue upgrading even if the dirhash matches between the
 	// already-installed template version and the to-be-installed template
 	// version. This is useful to for the manifest to be rewritten with a new
 	// template_location field when running with --template-location=foo.
 	ContinueIfCurrent bool
 
+	// The value of --follow-replacement. If true, and the new version of the
+	// template is deprecated in favor of a replacement that its author has
+	// declared compatible, the installation is upgraded to the replacement
+	// instead.
+	FollowReplacement bool
+
+	// Mirrors to retry the download from when a manifest's template source
+	// is unavailable. See templatesource.SourceUnavailableError. They replace
+	// the mirrors from the config files for the retry.
+	FallbackMirrors config.Mirrors
+
 	// FS abstracts filesystem operations for error injection testing.
 	FS common.FS
 
 	// The value of --git-protocol.
 	GitProtocol string
 
+	// The value of --skip-git-submodules.
+	SkipGitSubmodules bool
+
+	// The value of --ignore-index. If true, Location is always crawled for
+	// manifests, rather than using the .abc/index.yaml installation index.
+	IgnoreIndex bool
+
 	// The value of --input-file.
 	InputFiles []string
 
@@ -106,21 +147,63 @@ type Params struct {
 	// The value of --keep-temp-dirs.
 	KeepTempDirs bool
 
+	// The value of --wait. How long to wait for another render or upgrade of
+	// a template installation's directory to finish, rather than failing.
+	// See the destlock package.
+	LockWait time.Duration
+
 	// The path to either a directory or file. If a directory, it will be
 	// crawled looking for manifests to upgrade. If a single manifest file,
 	// that single template will be upgraded.
 	Location string
 
+	// The maximum length of a chain of templates that output templates, like
+	// a template that was installed from the output of another template,
+	// which was itself output by a third template. The upgrade fails if the
+	// manifests being upgraded are nested deeper than this. Zero means
+	// DefaultMaxDependencyDepth.
+	MaxDependencyDepth int
+
 	// A CEL expression to filter the manifests found. If this is set, then it
 	// will be executed against each manifest YAML model, and the manifest will
 	// upgraded IFF the expression returns true. If unset, then no filtering
 	// will be done and every manifest found under Location will be upgraded.
 	ManifestFilter string
 
+	// If non-nil, each upgraded manifest is signed with this key. See the
+	// signing package.
+	ManifestSigner crypto.Signer
+
+	// If non-nil, each manifest's signature is checked against this key before
+	// upgrading, and the upgrade fails if the manifest is unsigned or was
+	// modified after it was signed.
+	ManifestVerifyKey crypto.PublicKey
+
+	// The value of --policy-file.
+	PolicyFiles []string
+
+	// The value of --allow-buf-generate.
+	AllowBufGenerate bool
+
+	// The values of --max-output-files, --max-output-bytes, and
+	// --max-file-bytes. See render.Params.
+	MaxOutputFiles int
+	MaxOutputBytes int64
+	MaxFileBytes   int64
+
+	// If non-nil, a record of the upgrade of each manifest is written to this
+	// sink, whether or not it succeeded.
+	AuditLog auditlog.Sink
+
 	// The value of --prompt.
 	Prompt   bool
 	Prompter input.Prompter
 
+	// The value of --reuse-input-files. If true, the input files recorded in
+	// the manifest are read again, so that their current values are used
+	// rather than the values saved in the manifest.
+	ReuseInputFiles bool
+
 	// The value of --resume-from. Used after a patch reversal conflict to
 	// continue upgrading at the point where the conflict occurred.
 	ResumeFrom string
@@ -128,6 +211,12 @@ type Params struct {
 	// The value of --skip-input-validation.
 	SkipInputValidation bool
 
+	// The value of --skip-unavailable. If true, a manifest whose template
+	// source is unavailable is reported with the SourceUnavailable result, and
+	// the other manifests are still upgraded. Otherwise the upgrade stops
+	// there, like it does for conflicts.
+	SkipUnavailable bool
+
 	// Used in tests to do prompting for inputs even though the input is not a
 	// TTY.
 	SkipPromptTTYCheck bool
@@ -135,6 +224,10 @@ type Params struct {
 	// The output stream used to print prompts when Prompt==true.
 	Stdout io.Writer
 
+	// The value of --quiet. If true, "print" actions in the template don't
+	// print anything.
+	SuppressPrint bool
+
 	// Empty string, except in tests. Will be used as the parent of temp dirs.
 	TempDirBase string
 
@@ -142,10 +235,21 @@ type Params struct {
 	// template location stored in the manifest (which is the default).
 	TemplateLocation string
 
+	// The values of --relocate. Like TemplateLocation, but only for a single
+	// manifest: the keys are manifest paths relative to Location, as in
+	// ManifestResult.ManifestPath, and the values are the template locations
+	// to upgrade them from. The new location is recorded in the manifest.
+	TemplateLocations map[string]string
+
 	// The value of --upgrade-channel. The branch to pull upgrades from, or the
 	// special string "latest".
 	UpgradeChannel string
 
+	// UpgradeChannelPolicy, if non-nil, restricts the upgrade channels that
+	// may be upgraded from. It comes from the config files, and is nil if
+	// --ignore-upgrade-channel-policy was given.
+	UpgradeChannelPolicy *config.UpgradeChannelPolicy
+
 	// An optional version to update to, overriding the upgrade_channel field in
 	// the manifest.
 	//
@@ -159,6 +263,10 @@ type Params struct {
 	// In tests, this can be overridden to provide a downloader that pretends to
 	// download a remote template. Otherwise nil.
 	downloaderFactory func(context.Context, *templatesource.ForUpgradeParams) (templatesource.Downloader, error)
+
+	// Set by UpgradeAll so that a template shared by many manifests is only
+	// downloaded and hashed once. May be nil.
+	templateCache *templateCache
 }
 
 // This is the type of templatesource.ForUpgrade, but abstracted so it can be
@@ -187,6 +295,11 @@ const (
 	// The new version of the template conflicted with local modifications and
 	// manual resolution is required. The Conflicts field should be used.
 	MergeConflict ResultType = iota
+
+	// The template couldn't be downloaded because it doesn't exist anymore,
+	// e.g. its repo or upgrade channel branch was deleted. Nothing was
+	// changed. The SourceUnavailable field should be used.
+	SourceUnavailable ResultType = iota
 )
 
 func (r ResultType) String() string {
@@ -199,6 +312,8 @@ func (r ResultType) String() string {
 		return "patch_reversal_conflict"
 	case MergeConflict:
 		return "merge_conflict"
+	case SourceUnavailable:
+		return "source_unavailable"
 	}
 	panic("unreachable") // the go lint exhaustive check prevents this
 }
@@ -207,14 +322,14 @@ func (r ResultType) RequiresUserAttention() bool {
 	switch r {
 	case AlreadyUpToDate, Success:
 		return false
-	case PatchReversalConflict, MergeConflict:
+	case PatchReversalConflict, MergeConflict, SourceUnavailable:
 		return true
 	}
 	panic("unreachable") // the go lint exhaustive check prevents this
 }
 
 // The upgrade results, sorted in increasing order of severity.
-var resultSeverityOrder = []ResultType{AlreadyUpToDate, Success, PatchReversalConflict, MergeConflict}
+var resultSeverityOrder = []ResultType{AlreadyUpToDate, Success, SourceUnavailable, PatchReversalConflict, MergeConflict}
 
 func resultTypeLess(l, r ResultType) bool {
 	// Subtle note: this will sort the zero value "" as the least/smallest,
@@ -247,6 +362,11 @@ type ManifestResult struct {
 	// The metadata returned by the template downloader.
 	DLMeta *templatesource.DownloadMetadata
 
+	// CopyStats describes the copy of the upgraded template's rendered files,
+	// before they were merged into the installation. It's nil unless the
+	// template was rendered.
+	CopyStats *common.CopyStats
+
 	// The relative path to the manifest file of this template installation
 	// that's being upgraded. It's relative to the path that the user provided
 	// to the "upgrade" commnd. If the user provided a path to a manifest file,
@@ -269,6 +389,11 @@ type ManifestResult struct {
 	// This field should only be used when Type is Success or MergeConflict.
 	NonConflicts []ActionTaken
 
+	// SourceUnavailable explains why the template couldn't be downloaded.
+	//
+	// This field should only be used when Type==SourceUnavailable.
+	SourceUnavailable *templatesource.SourceUnavailableError
+
 	// If no upgrade was done because this installation of the template is
 	// already on the latest version, then this will be true and all other
 	// fields in this struct will have zero values.
@@ -302,6 +427,10 @@ type ActionTaken struct {
 	// for this path.
 	Explanation string
 
+	// Evidence is the manifest state and hash comparisons that the Action was
+	// chosen from. It is always set.
+	Evidence *MergeEvidence
+
 	// This is the Path to the single file that this ActionTaken is about. It is
 	// always set.
 	//
@@ -326,6 +455,41 @@ type ActionTaken struct {
 	IncomingTemplatePath string
 }
 
+// MergeEvidence is the information about a single file that the merge
+// algorithm based its decision on. It's the structured counterpart to
+// ActionTaken.Explanation.
+//
+// Each of the hash comparisons is "match", "mismatch", or "absent" (the file
+// doesn't exist), or empty if that comparison wasn't needed.
+type MergeEvidence struct {
+	// Whether the file was output by the previously installed template
+	// version, according to the old manifest.
+	InOldManifest bool
+
+	// Whether the file is output by the new template version.
+	InNewManifest bool
+
+	// Whether the file was brought in by an "include" action from the
+	// destination directory, rather than from the template.
+	IncludedFromDestination bool
+
+	// The local file compared to the hash in the old manifest. A mismatch
+	// means the user edited the file.
+	LocalVsOldHash string
+
+	// The new template's output compared to the hash in the old manifest. A
+	// match means the template didn't change this file.
+	NewTemplateVsOldHash string
+
+	// The local file compared to the hash in the new manifest. A match means
+	// the local file already has the new template's contents.
+	LocalVsNewHash string
+
+	// Whether a pre_upgrade hook of the new template discarded the local
+	// file.
+	DeletedByHook bool
+}
+
 // upgrade takes a directory containing previously rendered template output and
 // updates it using the newest version of the template, which is pointed to by
 // the manifest file.
@@ -342,29 +506,91 @@ func upgrade(ctx context.Context, p *Params, absManifestPath string, oldManifest
 	// the directory where they were installed.
 	installedDir := filepath.Join(filepath.Dir(absManifestPath), "..")
 
-	if err := detectUnmergedConflicts(installedDir); err != nil {
-		return nil, err
+	lock, err := destlock.Acquire(ctx, &destlock.Params{
+		FS:        p.FS,
+		Dir:       installedDir,
+		Operation: "upgrade",
+		Wait:      p.LockWait,
+	})
+	if err != nil {
+		return nil, err //nolint:wrapcheck
 	}
+	defer func() { rErr = errors.Join(rErr, lock.Release(true)) }()
 
-	downloader, err := makeDownloader(ctx, p, installedDir, oldManifest)
+	// An interrupted render may have been partway through writing the
+	// destination, including its manifests, so it's finished before anything
+	// is read.
+	if err := render.FinishInterruptedCommits(ctx, p.FS, installedDir); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	// The manifest is read again now that we hold the lock, in case another
+	// process upgraded this installation since it was first read.
+	oldManifest, _, err = loadManifest(ctx, p.FS, absManifestPath)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := detectUnmergedConflicts(installedDir); err != nil {
+		return nil, err
+	}
+
+	if p.ManifestVerifyKey != nil {
+		if err := signing.VerifyFile(p.FS, p.ManifestVerifyKey, absManifestPath); err != nil {
+			return nil, fmt.Errorf("refusing to upgrade %q because its signature couldn't be verified; it may have been edited by hand: %w", absManifestPath, err)
+		}
+	}
+
 	tempTracker := tempdir.NewDirTracker(p.FS, p.KeepTempDirs)
 	defer tempTracker.DeferMaybeRemoveAll(ctx, &rErr)
 
-	templateDir, err := tempTracker.MkdirTempTracked(p.TempDirBase, tempdir.TemplateDirNamePart)
+	downloader, templateDir, dlMeta, templateDirhash, err := download(ctx, p, tempTracker, installedDir, oldManifest, nil)
+	unavailable := &templatesource.SourceUnavailableError{}
+	if err != nil && errors.As(err, &unavailable) && len(p.FallbackMirrors) > 0 && p.TemplateLocation == "" {
+		logger.WarnContext(ctx, "the template source is unavailable, retrying with the fallback mirrors",
+			"template_location", oldManifest.TemplateLocation.Val,
+			"error", err)
+		downloader, templateDir, dlMeta, templateDirhash, err = download(ctx, p, tempTracker, installedDir, oldManifest, p.FallbackMirrors)
+	}
+	if err != nil {
+		if errors.As(err, &unavailable) {
+			logger.WarnContext(ctx, "the template source is unavailable",
+				"manifest_path", absManifestPath,
+				"error", err)
+			return &ManifestResult{
+				SourceUnavailable: unavailable,
+				Type:              SourceUnavailable,
+			}, nil
+		}
+		return nil, err
+	}
+
+	dl, err := followReplacements(ctx, p, tempTracker, installedDir, &downloadedTemplate{
+		dir:     templateDir,
+		dlMeta:  dlMeta,
+		dirhash: templateDirhash,
+	})
+	if err != nil {
+		return nil, err
+	}
+	templateDir, dlMeta, templateDirhash = dl.dir, dl.dlMeta, dl.dirhash
+
+	inputFiles, err := inputFilesForRender(ctx, p, installedDir, oldManifest)
+	if err != nil {
+		return nil, err
+	}
+
+	newSpec, err := specutil.Load(ctx, p.FS, templateDir, dlMeta.CanonicalSource)
 	if err != nil {
 		return nil, err //nolint:wrapcheck
 	}
 
-	dlMeta, err := downloader.Download(ctx, p.CWD, templateDir, installedDir)
+	inputsFromManifest, err := migrateInputs(ctx, newSpec, oldManifest)
 	if err != nil {
-		return nil, fmt.Errorf("failed downloading template: %w", err)
+		return nil, err
 	}
 
-	noopIfInputsMatch, err := inputsForNoopCheck(ctx, p, templateDir, oldManifest)
+	noopIfInputsMatch, err := inputsForNoopCheck(ctx, p, templateDir, templateDirhash, dlMeta.Submodules, oldManifest)
 	if err != nil {
 		return nil, err
 	}
@@ -401,30 +627,44 @@ func upgrade(ctx context.Context, p *Params, absManifestPath string, oldManifest
 		}, nil
 	}
 
+	// Installations from before conflict_file_names existed keep the naming
+	// that their users are used to.
+	conflictFileNames := common.FirstNonZero(p.ConflictFileNames, oldManifest.ConflictFileNames.Val, manifest.ConflictFileNamesSuffix)
+
 	renderResult, err := render.RenderAlreadyDownloaded(ctx, dlMeta, templateDir, &render.Params{
 		AcceptDefaults:          p.AcceptDefaults,
+		AllowBufGenerate:        p.AllowBufGenerate,
 		Clock:                   p.Clock,
+		ConflictFileNames:       conflictFileNames,
 		Cwd:                     p.CWD,
+		DebugReportDir:          p.DebugReportDir,
 		DebugStepDiffs:          p.DebugStepDiffs,
 		DestDir:                 installedDir,
 		Downloader:              downloader,
 		FS:                      p.FS,
 		GitProtocol:             p.GitProtocol,
-		InputFiles:              p.InputFiles,
-		InputsFromManifest:      inputsToMap(oldManifest.Inputs),
+		InputFiles:              inputFiles,
+		InputsFromManifest:      inputsFromManifest,
 		IncludeFromDestExtraDir: reversedDir,
 		InputsFromFlags:         p.InputsFromFlags,
 		KeepTempDirs:            p.KeepTempDirs,
+		MaxFileBytes:            p.MaxFileBytes,
+		MaxOutputBytes:          p.MaxOutputBytes,
+		MaxOutputFiles:          p.MaxOutputFiles,
 		NoopIfInputsMatch:       noopIfInputsMatch,
 		OutDir:                  mergeDir,
+		OwnManifestPath:         absManifestPath,
+		PolicyFiles:             p.PolicyFiles,
 		Prompt:                  p.Prompt,
 		Prompter:                p.Prompter,
 		SkipInputValidation:     p.SkipInputValidation,
 		SkipPromptTTYCheck:      p.SkipPromptTTYCheck,
 		SourceForMessages:       oldManifest.TemplateLocation.Val,
 		Stdout:                  p.Stdout,
+		SuppressPrint:           p.SuppressPrint,
 		TempDirBase:             p.TempDirBase,
 		UpgradeChannel:          p.UpgradeChannel,
+		UpgradeChannelPolicy:    p.UpgradeChannelPolicy,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed rendering template: %w", err)
@@ -441,14 +681,30 @@ func upgrade(ctx context.Context, p *Params, absManifestPath string, oldManifest
 		return nil, err
 	}
 
+	scope := hookScope(newSpec, oldManifest, newManifest)
+	deletedByHooks, err := runHooks(ctx, &runHooksParams{
+		hooks:         newSpec.PreUpgrade,
+		scope:         scope,
+		oldManifest:   oldManifest,
+		stdout:        p.Stdout,
+		suppressPrint: p.SuppressPrint,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed running pre_upgrade hooks: %w", err)
+	}
+
 	commitParams := &commitParams{
-		fs:               p.FS,
-		installedDir:     installedDir,
-		mergeDir:         mergeDir,
-		oldManifestPath:  absManifestPath,
-		oldManifest:      oldManifest,
-		newManifest:      newManifest,
-		reversedPatchDir: reversedDir,
+		conflictFileNames: conflictFileNames,
+		deletedByHooks:    deletedByHooks,
+		fs:                p.FS,
+		installedDir:      installedDir,
+		mergeDir:          mergeDir,
+		oldManifestPath:   absManifestPath,
+		oldManifest:       oldManifest,
+		newManifest:       newManifest,
+		reversedPatchDir:  reversedDir,
+		signer:            p.ManifestSigner,
+		mergeStrategies:   newSpec.MergeStrategies,
 	}
 	actionsTaken, err := mergeTentatively(ctx, commitParams)
 	if err != nil {
@@ -462,8 +718,19 @@ func upgrade(ctx context.Context, p *Params, absManifestPath string, oldManifest
 		resultType = Success
 		logger.InfoContext(ctx, "successfully upgraded template installation",
 			"manifest_path", absManifestPath)
+
+		if _, err := runHooks(ctx, &runHooksParams{
+			hooks:         newSpec.PostUpgrade,
+			scope:         scope,
+			oldManifest:   oldManifest,
+			stdout:        p.Stdout,
+			suppressPrint: p.SuppressPrint,
+		}); err != nil {
+			return nil, fmt.Errorf("failed running post_upgrade hooks: %w", err)
+		}
 	}
 	return &ManifestResult{
+		CopyStats:      renderResult.CopyStats,
 		MergeConflicts: conflicts,
 		DLMeta:         dlMeta,
 		NonConflicts:   nonConflicts,
@@ -478,15 +745,19 @@ func upgrade(ctx context.Context, p *Params, absManifestPath string, oldManifest
 //
 // Returns nil if we don't want to do a noop, because --continue-if-current was
 // true or because there's a new version of the template.
-func inputsForNoopCheck(ctx context.Context, p *Params, templateDir string, oldManifest *manifest.Manifest) (map[string]string, error) {
+//
+// templateDirhash is the dirhash of templateDir if it's already known, or empty
+// string otherwise. submodules are the template's git submodule SHAs, which are
+// part of its dirhash.
+func inputsForNoopCheck(ctx context.Context, p *Params, templateDir, templateDirhash string, submodules map[string]string, oldManifest *manifest.Manifest) (map[string]string, error) {
 	logger := logging.FromContext(ctx).With("logger", "inputsForNoopCheck")
 	if p.ContinueIfCurrent {
 		return nil, nil
 	}
 
-	hashMatch, err := dirhash.Verify(oldManifest.TemplateDirhash.Val, templateDir)
+	hashMatch, err := dirhashMatches(oldManifest.TemplateDirhash.Val, templateDirhash, templateDir, submodules)
 	if err != nil {
-		return nil, err //nolint:wrapcheck
+		return nil, err
 	}
 
 	if !hashMatch {
@@ -495,30 +766,68 @@ func inputsForNoopCheck(ctx context.Context, p *Params, templateDir string, oldM
 	}
 	logger.InfoContext(ctx, "template dirhash matched")
 
+	// The dirhash doesn't cover the files that the template includes from
+	// remote sources, which may have changed even though the template didn't.
+	if len(oldManifest.RemoteIncludes) > 0 {
+		logger.InfoContext(ctx, "template has remote includes, so it must be rendered to know whether it changed")
+		return nil, nil
+	}
+
 	// We don't make the noop decision yet, but return a set of inputs that will
 	// conditional cause a noop depending on whether they match the new inputs.
 	return inputsToMap(oldManifest.Inputs), nil
 }
 
-func makeDownloader(ctx context.Context, p *Params, installedDir string, oldManifest *manifest.Manifest) (templatesource.Downloader, error) {
+// download downloads the template for the given manifest into a new temp
+// directory, and returns the downloader, that directory, the download
+// metadata, and the template's dirhash if it's known. mirrors, if non-nil,
+// replace the mirrors from the config files.
+func download(ctx context.Context, p *Params, tempTracker *tempdir.DirTracker, installedDir string, oldManifest *manifest.Manifest, mirrors config.Mirrors) (templatesource.Downloader, string, *templatesource.DownloadMetadata, string, error) {
+	downloader, cacheKey, err := makeDownloader(ctx, p, installedDir, oldManifest, mirrors)
+	if err != nil {
+		return nil, "", nil, "", err
+	}
+
+	templateDir, err := tempTracker.MkdirTempTracked(p.TempDirBase, tempdir.TemplateDirNamePart)
+	if err != nil {
+		return nil, "", nil, "", err //nolint:wrapcheck
+	}
+
+	dlMeta, templateDirhash, err := p.templateCache.download(ctx, cacheKey, downloader, p.CWD, templateDir, installedDir)
+	if err != nil {
+		return nil, "", nil, "", common.WithCategory(common.CategoryDownload,
+			fmt.Errorf("failed downloading template: %w", err))
+	}
+	return downloader, templateDir, dlMeta, templateDirhash, nil
+}
+
+func makeDownloader(ctx context.Context, p *Params, installedDir string, oldManifest *manifest.Manifest, mirrors config.Mirrors) (templatesource.Downloader, templateCacheKey, error) {
 	if p.TemplateLocation != "" { // the user provided --template-location
 		if p.Version != "" { // the user provided --version
-			return nil, fmt.Errorf("--template-location and --version must not be used together; to specify the version with --template-version, use the @version syntax, like github.com/foo/bar@main")
+			return nil, templateCacheKey{}, fmt.Errorf("--template-location and --version must not be used together; to specify the version with --template-version, use the @version syntax, like github.com/foo/bar@main")
+		}
+		if err := p.UpgradeChannelPolicy.Check(p.UpgradeChannel); err != nil {
+			return nil, templateCacheKey{}, err //nolint:wrapcheck
 		}
 		downloader, err := templatesource.ParseSource(ctx, &templatesource.ParseSourceParams{
 			CWD:                p.CWD,
 			Source:             p.TemplateLocation,
 			FlagGitProtocol:    p.GitProtocol,
 			FlagUpgradeChannel: p.UpgradeChannel,
+			SkipGitSubmodules:  p.SkipGitSubmodules,
 		})
 		if err != nil {
-			return nil, err //nolint:wrapcheck
+			return nil, templateCacheKey{}, err //nolint:wrapcheck
 		}
-		return downloader, nil
+		return downloader, templateCacheKey{
+			location:       p.TemplateLocation,
+			gitProtocol:    p.GitProtocol,
+			upgradeChannel: p.UpgradeChannel,
+		}, nil
 	}
 
 	if oldManifest.TemplateLocation.Val == "" {
-		return nil, fmt.Errorf("this template was installed without a canonical location; please use the --template-location flag to specify where to upgrade from")
+		return nil, templateCacheKey{}, fmt.Errorf("this template was installed without a canonical location; please use the --template-location flag to specify where to upgrade from")
 	}
 
 	version := oldManifest.UpgradeChannel.Val
@@ -534,6 +843,13 @@ func makeDownloader(ctx context.Context, p *Params, installedDir string, oldMani
 	}
 
 	upgradeChannel := common.FirstNonZero(p.UpgradeChannel, oldManifest.UpgradeChannel.Val)
+	if err := p.UpgradeChannelPolicy.Check(upgradeChannel); err != nil {
+		return nil, templateCacheKey{}, err //nolint:wrapcheck
+	}
+	var repoPath, repoRemoteURL string
+	if r := oldManifest.TemplateRepo; r != nil {
+		repoPath, repoRemoteURL = r.Path.Val, r.RemoteURL.Val
+	}
 	downloader, err := downloaderFactory(ctx, &templatesource.ForUpgradeParams{
 		InstalledDir:      installedDir,
 		CanonicalLocation: oldManifest.TemplateLocation.Val,
@@ -541,13 +857,24 @@ func makeDownloader(ctx context.Context, p *Params, installedDir string, oldMani
 		GitProtocol:       p.GitProtocol,
 		Version:           version,
 		UpgradeChannel:    upgradeChannel,
+		SkipGitSubmodules: p.SkipGitSubmodules,
+		Mirrors:           mirrors,
+		RepoPath:          repoPath,
+		RepoRemoteURL:     repoRemoteURL,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed creating downloader for manifest location %q of type %q with git protocol %q: %w",
+		return nil, templateCacheKey{}, fmt.Errorf("failed creating downloader for manifest location %q of type %q with git protocol %q: %w",
 			oldManifest.TemplateLocation.Val, oldManifest.LocationType.Val, p.GitProtocol, err)
 	}
 
-	return downloader, nil
+	return downloader, templateCacheKey{
+		location:       oldManifest.TemplateLocation.Val,
+		locType:        oldManifest.LocationType.Val,
+		gitProtocol:    p.GitProtocol,
+		version:        version,
+		upgradeChannel: upgradeChannel,
+		mirrors:        mirrors.String(),
+	}, nil
 }
 
 // mergeTentatively does a dry-run commit followed by a real commit.
@@ -598,6 +925,22 @@ type commitParams struct {
 
 	// The new contents of the manifest, loaded from mergeDir.
 	newManifest *manifest.Manifest
+
+	// If non-nil, the new manifest is signed with this key.
+	signer crypto.Signer
+
+	// The merge strategies from the new template's spec, which resolve
+	// conflicts in certain files automatically.
+	mergeStrategies []*spec.MergeStrategy
+
+	// How to name the files created for merge conflicts, one of the
+	// manifest.ConflictFileNames* values.
+	conflictFileNames string
+
+	// The slash-separated paths of the files that the new template's
+	// pre_upgrade hooks discarded. The merge treats them as though the user
+	// never edited them.
+	deletedByHooks map[string]struct{}
 }
 
 // commit merges the contents of the merge directory into the installed
@@ -624,9 +967,41 @@ func commit(ctx context.Context, p *commitParams, dryRun bool) ([]ActionTaken, e
 		return nil, fmt.Errorf("WriteFile(%q): %w", p.oldManifestPath, err)
 	}
 
+	if err := updateSig(ctx, p, buf); err != nil {
+		return nil, err
+	}
+
+	if err := indexutil.Record(ctx, p.fs, &indexutil.Entry{
+		ManifestPath:     p.oldManifestPath,
+		TemplateLocation: mergedManifest.Wrapped.TemplateLocation.Val,
+		TemplateVersion:  mergedManifest.Wrapped.TemplateVersion.Val,
+		ModificationTime: mergedManifest.Wrapped.ModificationTime,
+	}); err != nil {
+		// The upgrade itself is done, so this isn't worth failing over.
+		logger := logging.FromContext(ctx).With("logger", "commit")
+		logger.WarnContext(ctx, "failed updating the installation index; use --ignore-index if upgrades can't find this installation",
+			"error", err)
+	}
+
 	return actionsTaken, nil
 }
 
+// updateSig signs the newly written manifest if there's a signer. Otherwise it
+// removes any signature left over from the old manifest, since it would no
+// longer match.
+func updateSig(ctx context.Context, p *commitParams, manifestBuf []byte) error {
+	removed, err := signing.Resign(p.fs, p.signer, p.oldManifestPath, manifestBuf)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	if removed {
+		logger := logging.FromContext(ctx).With("logger", "updateSig")
+		logger.WarnContext(ctx, "removed the manifest's signature because it no longer matches the upgraded manifest; use --manifest-signing-key to re-sign it",
+			"signature", p.oldManifestPath+signing.SigSuffix)
+	}
+	return nil
+}
+
 // mergeManifest creates a new manifest for writing to the filesystem. It takes
 // mostly the fields from the new manifest, with a little bit from the old
 // manifest.
@@ -639,6 +1014,26 @@ func mergeManifest(old, newManifest *manifest.Manifest) *manifest.WithHeader {
 	forMarshaling := manifest.ForMarshaling(*newManifest)
 	forMarshaling.CreationTime = old.CreationTime
 
+	// Unless --upgrade-channel was given, the upgrade reused the old manifest's
+	// upgrade channel, so the old manifest knows better where it came from.
+	if forMarshaling.UpgradeChannelSource.Val == manifest.UpgradeChannelSourceAutodetected &&
+		old.UpgradeChannelSource.Val != "" &&
+		old.UpgradeChannel.Val == newManifest.UpgradeChannel.Val {
+		forMarshaling.UpgradeChannelSource = old.UpgradeChannelSource
+	}
+
+	// A pinned manifest is upgraded from its pinned version, so it stays
+	// pinned unless --upgrade-channel moved it elsewhere.
+	if old.PinnedUpgradeChannel.Val != "" && old.UpgradeChannel.Val == newManifest.UpgradeChannel.Val {
+		forMarshaling.PinnedUpgradeChannel = old.PinnedUpgradeChannel
+	}
+
+	// The old input files are still where the reused input values came from,
+	// unless this upgrade read some input files of its own.
+	if len(forMarshaling.InputFiles) == 0 {
+		forMarshaling.InputFiles = old.InputFiles
+	}
+
 	return &manifest.WithHeader{
 		Header: &header.Fields{
 			NewStyleAPIVersion: model.String{Val: decode.LatestSupportedAPIVersion(version.IsReleaseBuild())},
@@ -650,23 +1045,7 @@ func mergeManifest(old, newManifest *manifest.Manifest) *manifest.WithHeader {
 
 // loadManifest reads and unmarshals the manifest at the given path.
 func loadManifest(ctx context.Context, fs common.FS, path string) (*manifest.Manifest, []byte, error) {
-	f, err := fs.Open(path)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to open manifest file at %q: %w", path, err)
-	}
-	defer f.Close()
-
-	manifestI, buf, err := decode.DecodeValidateUpgrade(ctx, f, path, decode.KindManifest)
-	if err != nil {
-		return nil, nil, fmt.Errorf("error reading manifest file: %w", err)
-	}
-
-	out, ok := manifestI.(*manifest.Manifest)
-	if !ok {
-		return nil, nil, fmt.Errorf("internal error: manifest file did not decode to *manifest.Manifest")
-	}
-
-	return out, buf, nil
+	return manifestutil.Load(ctx, fs, path) //nolint:wrapcheck
 }
 
 // inputsToMap takes the list of input values (e.g. "service_account" was "my-service-account")
@@ -695,7 +1074,7 @@ func detectUnmergedConflicts(installedDir string) error {
 		if relPath == common.ABCInternalDir && d.IsDir() {
 			return fs.SkipDir
 		}
-		if strings.Contains(path, ConflictSuffixBegins) || strings.HasSuffix(path, rejectedPatchSuffix) {
+		if IsConflictFile(path) || strings.HasSuffix(path, rejectedPatchSuffix) {
 			unmergedFiles = append(unmergedFiles, path)
 		}
 		return nil
@@ -752,7 +1131,13 @@ func reversePatches(ctx context.Context, p *reversePatchesParams) ([]*ReversalCo
 	for _, f := range p.oldManifest.OutputFiles {
 		filesInManifest = append(filesInManifest, f.File.Val)
 	}
-	if unknownFiles := sets.Subtract(p.alreadyResolved, filesInManifest); len(unknownFiles) > 0 {
+	// The manifest uses forward slashes, but users on Windows may give
+	// --already-resolved paths with backslashes.
+	alreadyResolved := make([]string, 0, len(p.alreadyResolved))
+	for _, r := range p.alreadyResolved {
+		alreadyResolved = append(alreadyResolved, filepath.ToSlash(r))
+	}
+	if unknownFiles := sets.Subtract(alreadyResolved, filesInManifest); len(unknownFiles) > 0 {
 		return nil, fmt.Errorf("you specified --already-resolved file(s) that were not part of this template's manifest: %s", strings.Join(unknownFiles, ", "))
 	}
 
@@ -761,9 +1146,12 @@ func reversePatches(ctx context.Context, p *reversePatchesParams) ([]*ReversalCo
 			continue
 		}
 
-		outPath := filepath.Join(p.reversedDir, f.File.Val)
+		// A file that was included from the destination using "as" is
+		// reversed back to the path that it was included from, which is where
+		// the template's include action will look for it.
+		outPath := filepath.Join(p.reversedDir, reversedRelPath(f))
 
-		if slices.Contains(p.alreadyResolved, f.File.Val) {
+		if slices.Contains(alreadyResolved, f.File.Val) {
 			// The p.reversedDir directory doesn't contain any subdirs until we
 			// create them here.
 			dirToCreate := filepath.Dir(outPath)
@@ -777,7 +1165,7 @@ func reversePatches(ctx context.Context, p *reversePatchesParams) ([]*ReversalCo
 			// the patch from the manifest. Because it has already been applied
 			// by the user. So we just copy the already-patched file into the
 			// directory for patched files.
-			if err := common.Copy(ctx, p.fs, filepath.Join(p.installedDir, f.File.Val), outPath); err != nil {
+			if err := common.Copy(ctx, p.fs, filepath.Join(p.installedDir, filepath.FromSlash(f.File.Val)), outPath); err != nil {
 				return nil, err //nolint:wrapcheck
 			}
 			continue
@@ -795,6 +1183,15 @@ func reversePatches(ctx context.Context, p *reversePatchesParams) ([]*ReversalCo
 	return out, nil
 }
 
+// reversedRelPath returns the path, relative to the reversed patch directory,
+// where the reversal of f's patch is written.
+func reversedRelPath(f *manifest.OutputFile) string {
+	if f.IncludedFrom != nil && f.IncludedFrom.Val != "" {
+		return filepath.FromSlash(f.IncludedFrom.Val)
+	}
+	return filepath.FromSlash(f.File.Val)
+}
+
 // reverseOnePatch is a helper for reversePatches that applies a single patch
 // to a single file.
 func reverseOnePatch(ctx context.Context, installedDir, outPath string, f *manifest.OutputFile) (*ReversalConflict, error) {
@@ -803,54 +1200,44 @@ func reverseOnePatch(ctx context.Context, installedDir, outPath string, f *manif
 	if err := os.MkdirAll(filepath.Dir(outPath), common.OwnerRWXPerms); err != nil {
 		return nil, fmt.Errorf("failed creating output directory for patch reversal: %w", err)
 	}
-	installedPath := filepath.Join(installedDir, f.File.Val)
+	installedPath := filepath.Join(installedDir, filepath.FromSlash(f.File.Val))
 	rejectPath := installedPath + rejectedPatchSuffix
 
-	var stdout, stderr bytes.Buffer
-	opts := []*run.Option{
-		run.AllowNonzeroExit(),
-		run.WithStdinStr(f.Patch.Val),
-		run.WithStdout(&stdout),
-		run.WithStderr(&stderr),
-	}
-	// Alternative considered: use the --merge flag to the patch command to put
-	// merge conflicts inline in the target file. Why don't we? Two reasons:
-	//  - the --merge flag doesn't exist on mac
-	//  - the --merge flag is mutually exclusive with the --fuzz flag
-	exitCode, err := run.Run(ctx, opts,
-		"patch",
-		"--unified",    // the diff was originally generated with "diff -u"
-		"--strip", "1", // the diff has prefixes like "a/" in "a/file.txt" that need to be removed
-		"--output", outPath, // write the patched file to the reversedDir
-		"--fuzz", "999", // try super hard to patch even if surrounding context has changed and the patch doesn't apply cleanly. Number was chosen arbitrarily.
-		"--reject-file", rejectPath, // Patch hunks that fail to apply will be saved here
-		installedPath,
-	)
+	p, err := patch.Parse(f.Patch.Val)
 	if err != nil {
-		return nil, fmt.Errorf("error running patch command on included-from-destination file %q: %w", f.File.Val, err)
-	}
-	// TODO(upgrade): support backups, maybe with patch -b
-	switch exitCode {
-	case 0:
-		if stdout.Len() > 0 {
-			logger.DebugContext(ctx, "exec of patch to reverse include-from-destination succeeded",
-				"stdout", stdout.String())
-		}
+		return nil, fmt.Errorf("failed parsing the patch in the manifest for included-from-destination file %q: %w", f.File.Val, err)
+	}
+	info, err := os.Stat(installedPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading included-from-destination file %q to reverse its patch: %w", f.File.Val, err)
+	}
+	contents, err := os.ReadFile(installedPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading included-from-destination file %q to reverse its patch: %w", f.File.Val, err)
+	}
+
+	// Try super hard to patch even if surrounding context has changed and the
+	// patch doesn't apply cleanly, by ignoring as much context as needed.
+	result := patch.Apply(contents, p, reversalFuzz)
+	if err := os.WriteFile(outPath, result.Patched, info.Mode().Perm()); err != nil {
+		return nil, fmt.Errorf("failed writing reversed included-from-destination file: %w", err)
+	}
+	// TODO(upgrade): support backups
+	if len(result.Rejected) == 0 {
 		return nil, nil
-	case 1:
-		logger.WarnContext(ctx, "reversal patch didn't apply cleanly",
-			"stdout", stdout.String(),
-			"stderr", stderr.String(),
-			"installed_path", installedPath,
-			"reject_path", rejectPath,
-		)
-		return &ReversalConflict{
-			RelPath:       f.File.Val,
-			AbsPath:       installedPath,
-			RejectedHunks: rejectPath,
-		}, nil
+	}
 
-	default:
-		return nil, fmt.Errorf("when reversing a patch from the manifest for included-from-destination files, the patch command failed unexpectedly: %s", stderr.String())
+	if err := os.WriteFile(rejectPath, []byte(result.Rejects(p)), common.OwnerRWPerms); err != nil {
+		return nil, fmt.Errorf("failed writing rejected patch hunks: %w", err)
 	}
+	logger.WarnContext(ctx, "reversal patch didn't apply cleanly",
+		"rejected_hunks", len(result.Rejected),
+		"installed_path", installedPath,
+		"reject_path", rejectPath,
+	)
+	return &ReversalConflict{
+		RelPath:       f.File.Val,
+		AbsPath:       installedPath,
+		RejectedHunks: rejectPath,
+	}, nil
 }
@@ -15,9 +15,20 @@
 package upgrade
 
 import (
+	"bytes"
 	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"regexp"
 	"slices"
 	"strings"
 	"testing"
@@ -28,11 +39,14 @@ import (
 	"github.com/google/go-cmp/cmp/cmpopts"
 
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/destlock"
+	"github.com/abcxyz/abc/templates/common/indexutil"
 	"github.com/abcxyz/abc/templates/common/input"
 	"github.com/abcxyz/abc/templates/common/render"
+	"github.com/abcxyz/abc/templates/common/signing"
 	"github.com/abcxyz/abc/templates/common/templatesource"
 	"github.com/abcxyz/abc/templates/model"
-	manifest "github.com/abcxyz/abc/templates/model/manifest/v1alpha1"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1beta7"
 	abctestutil "github.com/abcxyz/abc/templates/testutil"
 	mdl "github.com/abcxyz/abc/templates/testutil/model"
 	"github.com/abcxyz/abc/templates/testutil/prompt"
@@ -67,6 +81,7 @@ func TestUpgradeAll(t *testing.T) {
 		TemplateLocation: mdl.S("../template_dir"),
 		TemplateVersion:  mdl.S(abctestutil.MinimalGitHeadSHA),
 		LocationType:     mdl.S("local_git"),
+		TemplateRepo:     &manifest.TemplateRepo{Path: mdl.S("template_dir")},
 		Inputs:           []*manifest.Input{},
 		OutputFiles: []*manifest.OutputFile{
 			{
@@ -79,6 +94,7 @@ func TestUpgradeAll(t *testing.T) {
 		IsCanonical:     true,
 		CanonicalSource: "../template_dir",
 		LocationType:    templatesource.LocalGit,
+		Repo:            &templatesource.RepoLocation{Path: "template_dir"},
 		Version:         abctestutil.MinimalGitHeadSHA,
 		Vars: templatesource.DownloaderVars{
 			GitSHA:      abctestutil.MinimalGitHeadSHA,
@@ -644,7 +660,7 @@ steps:
 							{
 								Action:   EditDeleteConflict,
 								Path:     "another_file.txt",
-								OursPath: "another_file.txt.abcmerge_template_wants_to_delete",
+								OursPath: "another_file.abcmerge_template_wants_to_delete.txt",
 							},
 						},
 						DLMeta: wantDLMeta,
@@ -652,7 +668,7 @@ steps:
 				},
 			},
 			wantDestContentsAfterUpgrade: map[string]string{
-				"another_file.txt.abcmerge_template_wants_to_delete": "my edited contents",
+				"another_file.abcmerge_template_wants_to_delete.txt": "my edited contents",
 				"out.txt": "hello\n",
 			},
 			wantManifestAfterUpgrade: manifestWith(outTxtOnlyManifest, func(m *manifest.Manifest) {
@@ -747,7 +763,7 @@ steps:
 							{
 								Action:               EditEditConflict,
 								Path:                 "out.txt",
-								IncomingTemplatePath: "out.txt.abcmerge_from_new_template",
+								IncomingTemplatePath: "out.abcmerge_from_new_template.txt",
 							},
 						},
 						DLMeta: wantDLMeta,
@@ -756,7 +772,7 @@ steps:
 			},
 			wantDestContentsAfterUpgrade: map[string]string{
 				"out.txt":                            "my edited contents",
-				"out.txt.abcmerge_from_new_template": "goodbye",
+				"out.abcmerge_from_new_template.txt": "goodbye",
 			},
 			wantManifestAfterUpgrade: manifestWith(outTxtOnlyManifest, func(m *manifest.Manifest) {
 				m.ModificationTime = afterUpgradeTime
@@ -849,7 +865,7 @@ steps:
 							{
 								Action:               DeleteEditConflict,
 								Path:                 "out.txt",
-								IncomingTemplatePath: "out.txt.abcmerge_locally_deleted_vs_new_template_version",
+								IncomingTemplatePath: "out.abcmerge_locally_deleted_vs_new_template_version.txt",
 							},
 						},
 						DLMeta: wantDLMeta,
@@ -857,7 +873,7 @@ steps:
 				},
 			},
 			wantDestContentsAfterUpgrade: map[string]string{
-				"out.txt.abcmerge_locally_deleted_vs_new_template_version": "goodbye",
+				"out.abcmerge_locally_deleted_vs_new_template_version.txt": "goodbye",
 			},
 			wantManifestAfterUpgrade: manifestWith(outTxtOnlyManifest, func(m *manifest.Manifest) {
 				m.ModificationTime = afterUpgradeTime
@@ -1030,7 +1046,7 @@ steps:
 							{
 								Action:               "addAddConflict",
 								Path:                 "out.txt",
-								IncomingTemplatePath: "out.txt.abcmerge_from_new_template",
+								IncomingTemplatePath: "out.abcmerge_from_new_template.txt",
 							},
 						},
 						DLMeta: wantDLMeta,
@@ -1039,7 +1055,7 @@ steps:
 			},
 			wantDestContentsAfterUpgrade: map[string]string{
 				"out.txt":                            "my cool new file",
-				"out.txt.abcmerge_from_new_template": "template now outputs this",
+				"out.abcmerge_from_new_template.txt": "template now outputs this",
 				"some_other_file.txt":                "some other file contents",
 			},
 			wantManifestAfterUpgrade: manifestWith(outTxtOnlyManifest, func(m *manifest.Manifest) {
@@ -1133,6 +1149,7 @@ steps:
 			wantManifestBeforeUpgrade: manifestWith(outTxtOnlyManifest, func(m *manifest.Manifest) {
 				m.TemplateLocation.Val = "fake_canonical_source"
 				m.LocationType.Val = "fake_location_type"
+				m.TemplateRepo = nil
 				m.TemplateVersion.Val = "fake_version"
 				m.UpgradeChannel.Val = "initial_upgrade_channel"
 				m.OutputFiles = []*manifest.OutputFile{
@@ -1163,6 +1180,7 @@ steps:
 			wantManifestAfterUpgrade: manifestWith(outTxtOnlyManifest, func(m *manifest.Manifest) {
 				m.TemplateLocation.Val = "fake_canonical_source"
 				m.LocationType.Val = "fake_location_type"
+				m.TemplateRepo = nil
 				m.TemplateVersion.Val = "fake_version"
 				m.UpgradeChannel.Val = "upgrade_channel_from_flag"
 				m.ModificationTime = afterUpgradeTime.UTC()
@@ -1206,6 +1224,7 @@ steps:
 			wantManifestBeforeUpgrade: manifestWith(outTxtOnlyManifest, func(m *manifest.Manifest) {
 				m.TemplateLocation.Val = "fake_canonical_source"
 				m.LocationType.Val = "fake_location_type"
+				m.TemplateRepo = nil
 				m.TemplateVersion.Val = "fake_version"
 				m.UpgradeChannel.Val = "fake_upgrade_channel"
 				m.OutputFiles = []*manifest.OutputFile{
@@ -1273,6 +1292,7 @@ steps:
 			wantManifestAfterUpgrade: manifestWith(outTxtOnlyManifest, func(m *manifest.Manifest) {
 				m.TemplateLocation.Val = "fake_canonical_source"
 				m.LocationType.Val = "fake_location_type"
+				m.TemplateRepo = nil
 				m.TemplateVersion.Val = "fake_version"
 				m.UpgradeChannel.Val = "fake_upgrade_channel"
 				m.ModificationTime = afterUpgradeTime.UTC()
@@ -1295,6 +1315,7 @@ steps:
 			wantManifestBeforeUpgrade: manifestWith(outTxtOnlyManifest, func(m *manifest.Manifest) {
 				m.TemplateLocation.Val = "fake_canonical_source"
 				m.LocationType.Val = "fake_location_type"
+				m.TemplateRepo = nil
 				m.TemplateVersion.Val = "fake_version"
 				m.UpgradeChannel.Val = "upgrade_channel_from_initial_render"
 				m.OutputFiles = []*manifest.OutputFile{
@@ -1363,6 +1384,7 @@ steps:
 			wantManifestAfterUpgrade: manifestWith(outTxtOnlyManifest, func(m *manifest.Manifest) {
 				m.TemplateLocation.Val = "fake_canonical_source"
 				m.LocationType.Val = "fake_location_type"
+				m.TemplateRepo = nil
 				m.TemplateVersion.Val = "version-from-flag"
 				m.UpgradeChannel.Val = "upgrade_channel_from_initial_render"
 				m.ModificationTime = afterUpgradeTime.UTC()
@@ -1385,6 +1407,7 @@ steps:
 			wantManifestBeforeUpgrade: manifestWith(outTxtOnlyManifest, func(m *manifest.Manifest) {
 				m.TemplateLocation.Val = "fake_canonical_source"
 				m.LocationType.Val = "fake_location_type"
+				m.TemplateRepo = nil
 				m.TemplateVersion.Val = "fake_version"
 				m.UpgradeChannel.Val = "upgrade_channel_from_initial_render"
 				m.OutputFiles = []*manifest.OutputFile{
@@ -1454,6 +1477,7 @@ steps:
 			wantManifestAfterUpgrade: manifestWith(outTxtOnlyManifest, func(m *manifest.Manifest) {
 				m.TemplateLocation.Val = "fake_canonical_source"
 				m.LocationType.Val = "fake_location_type"
+				m.TemplateRepo = nil
 				m.TemplateVersion.Val = "version-from-flag"
 				m.UpgradeChannel.Val = "channel-from-flag"
 				m.ModificationTime = afterUpgradeTime.UTC()
@@ -1520,6 +1544,7 @@ steps:
 				ModificationTime: beforeUpgradeTime,
 				TemplateLocation: mdl.S("../template_dir"),
 				LocationType:     mdl.S("local_git"),
+				TemplateRepo:     &manifest.TemplateRepo{Path: mdl.S("template_dir")},
 				TemplateVersion:  mdl.S(abctestutil.MinimalGitHeadSHA),
 				Inputs:           []*manifest.Input{},
 				OutputFiles: []*manifest.OutputFile{
@@ -1575,6 +1600,7 @@ steps:
 				ModificationTime: afterUpgradeTime,
 				TemplateLocation: mdl.S("../template_dir"),
 				LocationType:     mdl.S("local_git"),
+				TemplateRepo:     &manifest.TemplateRepo{Path: mdl.S("template_dir")},
 				TemplateVersion:  mdl.S(abctestutil.MinimalGitHeadSHA),
 				Inputs:           []*manifest.Input{},
 				OutputFiles: []*manifest.OutputFile{
@@ -1593,6 +1619,121 @@ steps:
 				"file.txt": "yellow is my favorite color\n",
 			},
 		},
+		{
+			name: "include_from_destination_with_as",
+			origTemplateDirContents: map[string]string{
+				"spec.yaml": `
+api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'my template'
+steps:
+  - desc: 'include a file to be modified and moved'
+    action: 'include'
+    params:
+        from: 'destination'
+        paths: ['legacy/file.txt']
+        as: ['new/file.txt']
+  - desc: 'Change favorite color'
+    action: 'string_replace'
+    params:
+        paths: ['new/file.txt']
+        replacements:
+          - to_replace: 'purple'
+            with: 'red'`,
+			},
+			origDestContents: map[string]string{
+				"legacy/file.txt": "purple is my favorite color\n",
+			},
+			wantManifestBeforeUpgrade: &manifest.Manifest{
+				CreationTime:     beforeUpgradeTime,
+				ModificationTime: beforeUpgradeTime,
+				TemplateLocation: mdl.S("../template_dir"),
+				LocationType:     mdl.S("local_git"),
+				TemplateRepo:     &manifest.TemplateRepo{Path: mdl.S("template_dir")},
+				TemplateVersion:  mdl.S(abctestutil.MinimalGitHeadSHA),
+				Inputs:           []*manifest.Input{},
+				OutputFiles: []*manifest.OutputFile{
+					{
+						File:         mdl.S("new/file.txt"),
+						IncludedFrom: mdl.SP("legacy/file.txt"),
+						Patch: mdl.SP(`--- a/new/file.txt
++++ b/legacy/file.txt
+@@ -1 +1 @@
+-red is my favorite color
++purple is my favorite color
+`),
+					},
+				},
+			},
+			localEdits: func(tb testing.TB, installedDir string) { //nolint:thelper
+				// The user finishes the move by deleting the old file, so the
+				// upgrade must recover it by reversing the patch.
+				if err := os.Remove(filepath.Join(installedDir, "legacy", "file.txt")); err != nil {
+					tb.Fatal(err)
+				}
+			},
+			templateReplacementForUpgrade: map[string]string{
+				"spec.yaml": `
+api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'my template'
+steps:
+  - desc: 'include a file to be modified and moved'
+    action: 'include'
+    params:
+      from: 'destination'
+      paths: ['legacy/file.txt']
+      as: ['new/file.txt']
+  - desc: 'Change favorite color'
+    action: 'string_replace'
+    params:
+      paths: ['new/file.txt']
+      replacements:
+        - to_replace: 'purple'
+          with: 'yellow'
+`,
+			},
+			want: &Result{
+				Overall: Success,
+				Results: []*ManifestResult{
+					{
+						ManifestPath: ".",
+						Type:         Success,
+						NonConflicts: []ActionTaken{
+							{
+								Action: WriteNew,
+								Path:   "new/file.txt",
+							},
+						},
+						DLMeta: wantDLMeta,
+					},
+				},
+			},
+			wantManifestAfterUpgrade: &manifest.Manifest{
+				CreationTime:     beforeUpgradeTime,
+				ModificationTime: afterUpgradeTime,
+				TemplateLocation: mdl.S("../template_dir"),
+				LocationType:     mdl.S("local_git"),
+				TemplateRepo:     &manifest.TemplateRepo{Path: mdl.S("template_dir")},
+				TemplateVersion:  mdl.S(abctestutil.MinimalGitHeadSHA),
+				Inputs:           []*manifest.Input{},
+				OutputFiles: []*manifest.OutputFile{
+					{
+						File:         mdl.S("new/file.txt"),
+						IncludedFrom: mdl.SP("legacy/file.txt"),
+						Patch: mdl.SP(`--- a/new/file.txt
++++ b/legacy/file.txt
+@@ -1 +1 @@
+-yellow is my favorite color
++purple is my favorite color
+`),
+					},
+				},
+			},
+			wantDestContentsAfterUpgrade: map[string]string{
+				"new/file.txt": "yellow is my favorite color\n",
+			},
+		},
 		{
 			name: "rejected_reversal_include_from_destination_with_local_edits",
 			origTemplateDirContents: map[string]string{
@@ -1623,6 +1764,7 @@ steps:
 				ModificationTime: beforeUpgradeTime,
 				TemplateLocation: mdl.S("../template_dir"),
 				LocationType:     mdl.S("local_git"),
+				TemplateRepo:     &manifest.TemplateRepo{Path: mdl.S("template_dir")},
 				TemplateVersion:  mdl.S(abctestutil.MinimalGitHeadSHA),
 				Inputs:           []*manifest.Input{},
 				OutputFiles: []*manifest.OutputFile{
@@ -1684,6 +1826,7 @@ steps:
 				ModificationTime: beforeUpgradeTime,
 				TemplateLocation: mdl.S("../template_dir"),
 				LocationType:     mdl.S("local_git"),
+				TemplateRepo:     &manifest.TemplateRepo{Path: mdl.S("template_dir")},
 				TemplateVersion:  mdl.S(abctestutil.MinimalGitHeadSHA),
 				Inputs:           []*manifest.Input{},
 				OutputFiles: []*manifest.OutputFile{
@@ -1734,6 +1877,7 @@ steps:
 				ModificationTime: beforeUpgradeTime,
 				TemplateLocation: mdl.S("../template_dir"),
 				LocationType:     mdl.S("local_git"),
+				TemplateRepo:     &manifest.TemplateRepo{Path: mdl.S("template_dir")},
 				TemplateVersion:  mdl.S(abctestutil.MinimalGitHeadSHA),
 				Inputs:           []*manifest.Input{},
 				OutputFiles: []*manifest.OutputFile{
@@ -1798,6 +1942,7 @@ yellow is my favorite color
 				ModificationTime: afterUpgradeTime,
 				TemplateLocation: mdl.S("../template_dir"),
 				LocationType:     mdl.S("local_git"),
+				TemplateRepo:     &manifest.TemplateRepo{Path: mdl.S("template_dir")},
 				TemplateVersion:  mdl.S(abctestutil.MinimalGitHeadSHA),
 				Inputs:           []*manifest.Input{},
 				OutputFiles: []*manifest.OutputFile{
@@ -1920,10 +2065,11 @@ yellow is my favorite color
 
 			opts := []cmp.Option{
 				cmpopts.EquateEmpty(),
-				cmpopts.IgnoreFields(ActionTaken{}, "Explanation"), // don't assert on debugging messages. That would make test cases overly verbose.
-				cmpopts.IgnoreFields(Result{}, "Err"),              // errors are verified separately
+				cmpopts.IgnoreFields(ActionTaken{}, "Explanation", "Evidence"), // don't assert on debugging messages. That would make test cases overly verbose.
+				cmpopts.IgnoreFields(Result{}, "Err"),                          // errors are verified separately
+				cmpopts.IgnoreFields(ManifestResult{}, "CopyStats"),            // timing dependent
 				abctestutil.TransformStructFields(
-					abctestutil.TrimStringPrefixTransformer(destDir+"/"),
+					abctestutil.TrimStringPrefixTransformer(destDir+string(filepath.Separator)),
 					ReversalConflict{},
 					"AbsPath", "RejectedHunks",
 				),
@@ -1976,7 +2122,7 @@ type fakeDownloader struct {
 }
 
 func (f *fakeDownloader) Download(ctx context.Context, cwd, templateDir, destDir string) (*templatesource.DownloadMetadata, error) {
-	if err := common.CopyRecursive(ctx, nil, &common.CopyParams{
+	if _, err := common.CopyRecursive(ctx, nil, &common.CopyParams{
 		SrcRoot: f.sourceDir,
 		DstRoot: templateDir,
 		FS:      &common.RealFS{},
@@ -1991,56 +2137,1146 @@ func (f *fakeDownloader) Download(ctx context.Context, cwd, templateDir, destDir
 func TestUpgrade_NonCanonical(t *testing.T) {
 	t.Parallel()
 
-	ctx := context.Background()
-	tempBase := t.TempDir()
-	templateDir := filepath.Join(tempBase, "template_dir")
-	destDir := filepath.Join(tempBase, "dest")
-	if err := os.MkdirAll(templateDir, common.OwnerRWXPerms); err != nil {
-		t.Fatal(err)
+	ctx := context.Background()
+	tempBase := t.TempDir()
+	templateDir := filepath.Join(tempBase, "template_dir")
+	destDir := filepath.Join(tempBase, "dest")
+	if err := os.MkdirAll(templateDir, common.OwnerRWXPerms); err != nil {
+		t.Fatal(err)
+	}
+
+	origTemplateDirContents := map[string]string{
+		"out.txt":   "hello\n",
+		"spec.yaml": includeDotSpec,
+	}
+	abctestutil.WriteAll(t, templateDir, origTemplateDirContents)
+	clk := clock.NewMock()
+	clk.Set(time.Date(2024, 3, 1, 4, 5, 6, 7, time.UTC))
+	mustRender(t, ctx, clk, nil, tempBase, templateDir, destDir, nil)
+
+	clk.Add(time.Second)
+	params := &Params{
+		Clock:    clk,
+		CWD:      tempBase,
+		FS:       &common.RealFS{},
+		Location: destDir,
+	}
+
+	// Attempting to upgrade without a canonical location should fail
+	result := UpgradeAll(ctx, params)
+	wantErr := "this template was installed without a canonical location; please use the --template-location flag to specify where to upgrade from"
+	if diff := testutil.DiffErrString(result.Err, wantErr); diff != "" {
+		t.Fatal(diff)
+	}
+
+	// "Upgrading" to the original template should return "already up to date"
+	params.TemplateLocation = templateDir
+	result = UpgradeAll(ctx, params)
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if result.Overall != AlreadyUpToDate {
+		t.Fatalf("got result.Overall %q, want %q", result.Overall, AlreadyUpToDate)
+	}
+
+	// Now modify the template so there's something to actually do during upgrade
+	abctestutil.OverwriteJoin(t, templateDir, "out.txt", "new contents")
+	result = UpgradeAll(ctx, params)
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if result.Overall != Success {
+		t.Fatalf("got result.Overall %q, want %q", result.Overall, Success)
+	}
+}
+
+func TestUpgrade_OutputLimits(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	tempBase := t.TempDir()
+	templateDir := filepath.Join(tempBase, "template_dir")
+	destDir := filepath.Join(tempBase, "dest")
+	abctestutil.WriteAll(t, templateDir, map[string]string{
+		"out.txt":   "hello\n",
+		"spec.yaml": includeDotSpec,
+	})
+	clk := clock.NewMock()
+	clk.Set(time.Date(2024, 3, 1, 4, 5, 6, 7, time.UTC))
+	mustRender(t, ctx, clk, nil, tempBase, templateDir, destDir, nil)
+
+	// The new template version outputs one more file than the limit allows.
+	abctestutil.WriteAll(t, templateDir, map[string]string{
+		"another.txt": "another\n",
+	})
+	clk.Add(time.Second)
+	result := UpgradeAll(ctx, &Params{
+		Clock:            clk,
+		CWD:              tempBase,
+		FS:               &common.RealFS{},
+		Location:         destDir,
+		MaxOutputFiles:   1,
+		TemplateLocation: templateDir,
+	})
+	wantErr := "more than the limit of 1 files (see --max-output-files)"
+	if diff := testutil.DiffErrString(result.Err, wantErr); diff != "" {
+		t.Fatal(diff)
+	}
+	if got := common.ExitCodeOf(result.Err); got != common.ExitCodeOutputLimit {
+		t.Errorf("got exit code %d, want %d", got, common.ExitCodeOutputLimit)
+	}
+
+	got := abctestutil.LoadDir(t, destDir, abctestutil.SkipGlob(".abc/manifest*"))
+	want := map[string]string{
+		"out.txt": "hello\n",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("dest contents should be unchanged (-got,+want): %s", diff)
+	}
+}
+
+func TestUpgrade_FollowReplacement(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name              string
+		followReplacement bool
+		compatible        bool
+		want              map[string]string
+		wantDeprecated    bool
+	}{
+		{
+			name:              "follow_compatible_replacement",
+			followReplacement: true,
+			compatible:        true,
+			want: map[string]string{
+				"out.txt": "hello from the replacement\n",
+			},
+		},
+		{
+			name:       "flag_not_given",
+			compatible: true,
+			want: map[string]string{
+				"out.txt": "hello\n",
+			},
+			wantDeprecated: true,
+		},
+		{
+			name:              "replacement_not_compatible",
+			followReplacement: true,
+			want: map[string]string{
+				"out.txt": "hello\n",
+			},
+			wantDeprecated: true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			tempBase := t.TempDir()
+			oldTemplateDir := filepath.Join(tempBase, "old_template")
+			newTemplateDir := filepath.Join(tempBase, "new_template")
+			destDir := filepath.Join(tempBase, "dest")
+			abctestutil.WriteAll(t, oldTemplateDir, map[string]string{
+				"out.txt":   "hello\n",
+				"spec.yaml": includeDotSpec,
+			})
+			abctestutil.WriteAll(t, newTemplateDir, map[string]string{
+				"out.txt":   "hello from the replacement\n",
+				"spec.yaml": includeDotSpec,
+			})
+			clk := clock.NewMock()
+			clk.Set(time.Date(2024, 3, 1, 4, 5, 6, 7, time.UTC))
+			mustRender(t, ctx, clk, nil, tempBase, oldTemplateDir, destDir, nil)
+
+			// Now the old template is deprecated.
+			abctestutil.OverwriteJoin(t, oldTemplateDir, "spec.yaml", fmt.Sprintf(`api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'my old template'
+deprecated:
+  message: 'Use the new template'
+  replaced_by: '%s'
+  compatible: %t
+steps:
+  - desc: 'include .'
+    action: 'include'
+    params:
+      paths: ['out.txt']
+`, newTemplateDir, tc.compatible))
+
+			clk.Add(time.Second)
+			result := UpgradeAll(ctx, &Params{
+				Clock:             clk,
+				CWD:               tempBase,
+				FollowReplacement: tc.followReplacement,
+				FS:                &common.RealFS{},
+				Location:          destDir,
+				TemplateLocation:  oldTemplateDir,
+			})
+			if result.Err != nil {
+				t.Fatal(result.Err)
+			}
+
+			got := abctestutil.LoadDir(t, destDir, abctestutil.SkipGlob(".abc/manifest*"))
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("dest contents were not as expected (-got,+want): %s", diff)
+			}
+
+			manifestPaths, err := indexutil.CrawlManifests(destDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(manifestPaths) != 1 {
+				t.Fatalf("got manifests %q, want exactly one", manifestPaths)
+			}
+			m, _, err := loadManifest(ctx, &common.RealFS{}, filepath.Join(destDir, manifestPaths[0]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := m.Deprecated != nil; got != tc.wantDeprecated {
+				t.Errorf("got manifest deprecated=%t, want %t", got, tc.wantDeprecated)
+			}
+		})
+	}
+}
+
+func TestUpgrade_InputMigrations(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name         string
+		fromVersions string
+		want         map[string]string
+		wantErr      string
+	}{
+		{
+			name:         "version_in_range",
+			fromVersions: "< 2.0.0",
+			want: map[string]string{
+				"out.txt": "my-service-app\n",
+			},
+		},
+		{
+			name: "any_version",
+			want: map[string]string{
+				"out.txt": "my-service-app\n",
+			},
+		},
+		{
+			name:         "version_out_of_range",
+			fromVersions: ">= 2.0.0",
+			wantErr:      "missing input(s): app_name",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			tempBase := t.TempDir()
+			templateDir := filepath.Join(tempBase, "template")
+			destDir := filepath.Join(tempBase, "dest")
+			abctestutil.WriteAll(t, templateDir, map[string]string{
+				"out.txt": "{{.service_name}}\n",
+				"spec.yaml": `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'my template'
+inputs:
+  - name: 'service_name'
+    desc: 'the name of the service'
+steps:
+  - desc: 'include .'
+    action: 'include'
+    params:
+      paths: ['out.txt']
+  - desc: 'fill in the name'
+    action: 'go_template'
+    params:
+      paths: ['out.txt']
+`,
+			})
+			clk := clock.NewMock()
+			clk.Set(time.Date(2024, 3, 1, 4, 5, 6, 7, time.UTC))
+			mustRender(t, ctx, clk, &fakeDownloader{
+				sourceDir: templateDir,
+				outDLMeta: &templatesource.DownloadMetadata{
+					IsCanonical:     true,
+					CanonicalSource: templateDir,
+					LocationType:    "local_git",
+					Version:         "v1.2.0",
+				},
+			}, tempBase, templateDir, destDir, map[string]string{"service_name": "my-service"})
+
+			// The new template version renames the input.
+			migration := "  - inputs:"
+			if tc.fromVersions != "" {
+				migration = fmt.Sprintf("  - from_versions: '%s'\n    inputs:", tc.fromVersions)
+			}
+			abctestutil.WriteAll(t, templateDir, map[string]string{
+				"out.txt": "{{.app_name}}\n",
+				"spec.yaml": fmt.Sprintf(`api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'my template'
+inputs:
+  - name: 'app_name'
+    desc: 'the name of the app'
+input_migrations:
+%s
+      - name: 'app_name'
+        value: 'service_name + "-app"'
+steps:
+  - desc: 'include .'
+    action: 'include'
+    params:
+      paths: ['out.txt']
+  - desc: 'fill in the name'
+    action: 'go_template'
+    params:
+      paths: ['out.txt']
+`, migration),
+			})
+
+			clk.Add(time.Second)
+			result := UpgradeAll(ctx, &Params{
+				Clock:            clk,
+				CWD:              tempBase,
+				FS:               &common.RealFS{},
+				Location:         destDir,
+				TemplateLocation: templateDir,
+			})
+			if diff := testutil.DiffErrString(result.Err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if result.Err != nil {
+				return
+			}
+
+			got := abctestutil.LoadDir(t, destDir, abctestutil.SkipGlob(".abc/manifest*"))
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("dest contents were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestUpgrade_MergeStrategies(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name        string
+		strategy    string
+		fileName    string
+		oldTemplate string
+		localEdit   string
+		newTemplate string
+		want        map[string]string
+		wantType    ResultType
+	}{
+		{
+			name:        "no_strategy",
+			fileName:    "f.txt",
+			oldTemplate: "a\n",
+			localEdit:   "a\nlocal\n",
+			newTemplate: "a\nnew\n",
+			want: map[string]string{
+				"f.txt":                            "a\nlocal\n",
+				"f.abcmerge_from_new_template.txt": "a\nnew\n",
+			},
+			wantType: MergeConflict,
+		},
+		{
+			name:        "ours",
+			strategy:    "ours",
+			fileName:    "f.txt",
+			oldTemplate: "a\n",
+			localEdit:   "a\nlocal\n",
+			newTemplate: "a\nnew\n",
+			want: map[string]string{
+				"f.txt": "a\nlocal\n",
+			},
+			wantType: Success,
+		},
+		{
+			name:        "theirs",
+			strategy:    "theirs",
+			fileName:    "f.txt",
+			oldTemplate: "a\n",
+			localEdit:   "a\nlocal\n",
+			newTemplate: "a\nnew\n",
+			want: map[string]string{
+				"f.txt": "a\nnew\n",
+			},
+			wantType: Success,
+		},
+		{
+			name:        "union",
+			strategy:    "union",
+			fileName:    "f.txt",
+			oldTemplate: "a\nb\n",
+			localEdit:   "a\nlocal\nb\n",
+			newTemplate: "a\nb\nnew\n",
+			want: map[string]string{
+				"f.txt": "a\nlocal\nb\nnew\n",
+			},
+			wantType: Success,
+		},
+		{
+			name:        "json_deep_merge",
+			strategy:    "json-deep-merge",
+			fileName:    "f.json",
+			oldTemplate: `{"version": 1, "deps": {"a": "1.0"}}`,
+			localEdit:   `{"version": 1, "deps": {"a": "1.0", "mine": "2.0"}}`,
+			newTemplate: `{"version": 2, "deps": {"a": "1.1"}}`,
+			want: map[string]string{
+				"f.json": `{
+  "deps": {
+    "a": "1.1",
+    "mine": "2.0"
+  },
+  "version": 2
+}
+`,
+			},
+			wantType: Success,
+		},
+		{
+			name:        "json_deep_merge_invalid_json_is_a_conflict",
+			strategy:    "json-deep-merge",
+			fileName:    "f.json",
+			oldTemplate: `{"version": 1}`,
+			localEdit:   `not json`,
+			newTemplate: `{"version": 2}`,
+			want: map[string]string{
+				"f.json":                            `not json`,
+				"f.abcmerge_from_new_template.json": `{"version": 2}`,
+			},
+			wantType: MergeConflict,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			tempBase := t.TempDir()
+			templateDir := filepath.Join(tempBase, "template")
+			destDir := filepath.Join(tempBase, "dest")
+			specContents := fmt.Sprintf(`api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'my template'
+steps:
+  - desc: 'include .'
+    action: 'include'
+    params:
+      paths: ['%s']
+`, tc.fileName)
+			abctestutil.WriteAll(t, templateDir, map[string]string{
+				tc.fileName: tc.oldTemplate,
+				"spec.yaml": specContents,
+			})
+			clk := clock.NewMock()
+			clk.Set(time.Date(2024, 3, 1, 4, 5, 6, 7, time.UTC))
+			mustRender(t, ctx, clk, &fakeDownloader{
+				sourceDir: templateDir,
+				outDLMeta: &templatesource.DownloadMetadata{
+					IsCanonical:     true,
+					CanonicalSource: templateDir,
+					LocationType:    "local_git",
+				},
+			}, tempBase, templateDir, destDir, nil)
+
+			abctestutil.WriteAll(t, destDir, map[string]string{tc.fileName: tc.localEdit})
+
+			if tc.strategy != "" {
+				specContents += fmt.Sprintf(`merge_strategies:
+  - paths: ['*.json', '*.txt']
+    strategy: '%s'
+`, tc.strategy)
+			}
+			abctestutil.WriteAll(t, templateDir, map[string]string{
+				tc.fileName: tc.newTemplate,
+				"spec.yaml": specContents,
+			})
+
+			clk.Add(time.Second)
+			result := UpgradeAll(ctx, &Params{
+				Clock:            clk,
+				CWD:              tempBase,
+				FS:               &common.RealFS{},
+				Location:         destDir,
+				TemplateLocation: templateDir,
+			})
+			if result.Err != nil {
+				t.Fatal(result.Err)
+			}
+			if result.Overall != tc.wantType {
+				t.Errorf("got result type %q, want %q", result.Overall, tc.wantType)
+			}
+
+			got := abctestutil.LoadDir(t, destDir, abctestutil.SkipGlob(".abc/manifest*"))
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("dest contents were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestUpgrade_Hooks(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		hooks      string
+		newFiles   map[string]string
+		want       map[string]string
+		wantType   ResultType
+		wantStdout string
+		wantErr    string
+	}{
+		{
+			name: "no_hooks",
+			newFiles: map[string]string{
+				"gen/out.lock": "new lock\n",
+			},
+			want: map[string]string{
+				"gen/out.lock": "local lock\n",
+				"gen/out.abcmerge_from_new_template.lock": "new lock\n",
+			},
+			wantType: MergeConflict,
+		},
+		{
+			name: "delete_and_print",
+			hooks: `pre_upgrade:
+  - desc: 'discard the lockfile'
+    action: 'delete'
+    params:
+      paths: ['gen/*.lock']
+post_upgrade:
+  - desc: 'print notes'
+    action: 'print'
+    params:
+      message: 'upgraded {{.service_name}} from {{._from_version}} to {{._to_version}}'
+`,
+			newFiles: map[string]string{
+				"gen/out.lock": "new lock\n",
+			},
+			want: map[string]string{
+				"gen/out.lock": "new lock\n",
+			},
+			wantType:   Success,
+			wantStdout: "upgraded my-service from v1.2.0 to v2.0.0\n",
+		},
+		{
+			name: "delete_file_no_longer_output",
+			hooks: `pre_upgrade:
+  - desc: 'discard the lockfile'
+    action: 'delete'
+    params:
+      paths: ['gen/*.lock']
+`,
+			want:     map[string]string{},
+			wantType: Success,
+		},
+		{
+			name: "if_false",
+			hooks: `pre_upgrade:
+  - desc: 'discard the lockfile'
+    if: '_from_version == "v0.1.0"'
+    action: 'delete'
+    params:
+      paths: ['gen/*.lock']
+`,
+			newFiles: map[string]string{
+				"gen/out.lock": "new lock\n",
+			},
+			want: map[string]string{
+				"gen/out.lock": "local lock\n",
+				"gen/out.abcmerge_from_new_template.lock": "new lock\n",
+			},
+			wantType: MergeConflict,
+		},
+		{
+			name: "post_upgrade_skipped_on_conflict",
+			hooks: `post_upgrade:
+  - desc: 'print notes'
+    action: 'print'
+    params:
+      message: 'upgraded'
+`,
+			newFiles: map[string]string{
+				"gen/out.lock": "new lock\n",
+			},
+			want: map[string]string{
+				"gen/out.lock": "local lock\n",
+				"gen/out.abcmerge_from_new_template.lock": "new lock\n",
+			},
+			wantType: MergeConflict,
+		},
+		{
+			name: "bad_if",
+			hooks: `pre_upgrade:
+  - desc: 'discard the lockfile'
+    if: 'nonexistent_var'
+    action: 'delete'
+    params:
+      paths: ['gen/*.lock']
+`,
+			newFiles: map[string]string{
+				"gen/out.lock": "new lock\n",
+			},
+			wantErr: "failed running pre_upgrade hooks",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			tempBase := t.TempDir()
+			templateDir := filepath.Join(tempBase, "template")
+			destDir := filepath.Join(tempBase, "dest")
+			specHeader := `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: 'my template'
+inputs:
+  - name: 'service_name'
+    desc: 'the name of the service'
+steps:
+  - desc: 'include .'
+    action: 'include'
+    params:
+      paths: ['.']
+      skip: ['spec.yaml']
+`
+			abctestutil.WriteAll(t, templateDir, map[string]string{
+				"gen/out.lock": "old lock\n",
+				"spec.yaml":    specHeader,
+			})
+			clk := clock.NewMock()
+			clk.Set(time.Date(2024, 3, 1, 4, 5, 6, 7, time.UTC))
+			mustRender(t, ctx, clk, &fakeDownloader{
+				sourceDir: templateDir,
+				outDLMeta: &templatesource.DownloadMetadata{
+					IsCanonical:     true,
+					CanonicalSource: templateDir,
+					LocationType:    "local_git",
+					Version:         "v1.2.0",
+				},
+			}, tempBase, templateDir, destDir, map[string]string{"service_name": "my-service"})
+
+			abctestutil.WriteAll(t, destDir, map[string]string{"gen/out.lock": "local lock\n"})
+
+			if err := os.RemoveAll(templateDir); err != nil {
+				t.Fatal(err)
+			}
+			newFiles := map[string]string{"spec.yaml": specHeader + tc.hooks}
+			maps.Copy(newFiles, tc.newFiles)
+			abctestutil.WriteAll(t, templateDir, newFiles)
+
+			clk.Add(time.Second)
+			var stdout bytes.Buffer
+			result := UpgradeAll(ctx, &Params{
+				Clock:    clk,
+				CWD:      tempBase,
+				FS:       &common.RealFS{},
+				Location: destDir,
+				Stdout:   &stdout,
+				downloaderFactory: func(context.Context, *templatesource.ForUpgradeParams) (templatesource.Downloader, error) {
+					return &fakeDownloader{
+						sourceDir: templateDir,
+						outDLMeta: &templatesource.DownloadMetadata{
+							IsCanonical:     true,
+							CanonicalSource: templateDir,
+							LocationType:    "local_git",
+							Version:         "v2.0.0",
+						},
+					}, nil
+				},
+			})
+			if diff := testutil.DiffErrString(result.Err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if result.Err != nil {
+				return
+			}
+			if result.Overall != tc.wantType {
+				t.Errorf("got result type %q, want %q", result.Overall, tc.wantType)
+			}
+			if diff := cmp.Diff(stdout.String(), tc.wantStdout); diff != "" {
+				t.Errorf("stdout was not as expected (-got,+want): %s", diff)
+			}
+
+			got := abctestutil.LoadDir(t, destDir, abctestutil.SkipGlob(".abc/manifest*"))
+			if diff := cmp.Diff(got, tc.want, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("dest contents were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestUpgrade_ConflictFileNames(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name              string
+		legacyManifest    bool
+		conflictFileNames string
+		want              map[string]string
+	}{
+		{
+			name: "new_manifest_keeps_extension",
+			want: map[string]string{
+				"out.txt":                            "local\n",
+				"out.abcmerge_from_new_template.txt": "new\n",
+			},
+		},
+		{
+			name:           "legacy_manifest_keeps_suffix",
+			legacyManifest: true,
+			want: map[string]string{
+				"out.txt":                            "local\n",
+				"out.txt.abcmerge_from_new_template": "new\n",
+			},
+		},
+		{
+			name:              "flag_overrides_legacy_manifest",
+			legacyManifest:    true,
+			conflictFileNames: manifest.ConflictFileNamesKeepExtension,
+			want: map[string]string{
+				"out.txt":                            "local\n",
+				"out.abcmerge_from_new_template.txt": "new\n",
+			},
+		},
+		{
+			name:              "flag_overrides_new_manifest",
+			conflictFileNames: manifest.ConflictFileNamesSuffix,
+			want: map[string]string{
+				"out.txt":                            "local\n",
+				"out.txt.abcmerge_from_new_template": "new\n",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			tempBase := t.TempDir()
+			templateDir := filepath.Join(tempBase, "template")
+			destDir := filepath.Join(tempBase, "dest")
+			abctestutil.WriteAll(t, templateDir, map[string]string{
+				"out.txt":   "old\n",
+				"spec.yaml": includeDotSpec,
+			})
+			clk := clock.NewMock()
+			clk.Set(time.Date(2024, 3, 1, 4, 5, 6, 7, time.UTC))
+			dl := &fakeDownloader{
+				sourceDir: templateDir,
+				outDLMeta: &templatesource.DownloadMetadata{
+					IsCanonical:     true,
+					CanonicalSource: templateDir,
+					LocationType:    "local_git",
+				},
+			}
+			mustRender(t, ctx, clk, dl, tempBase, templateDir, destDir, nil)
+
+			if tc.legacyManifest {
+				manifestPaths, err := filepath.Glob(filepath.Join(destDir, common.ABCInternalDir, "manifest*.yaml"))
+				if err != nil || len(manifestPaths) != 1 {
+					t.Fatalf("couldn't find manifest: %v %v", manifestPaths, err)
+				}
+				buf, err := os.ReadFile(manifestPaths[0])
+				if err != nil {
+					t.Fatal(err)
+				}
+				stripped := regexp.MustCompile(`(?m)^conflict_file_names:.*\n`).ReplaceAll(buf, nil)
+				if err := os.WriteFile(manifestPaths[0], stripped, common.OwnerRWPerms); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			abctestutil.WriteAll(t, destDir, map[string]string{"out.txt": "local\n"})
+			abctestutil.WriteAll(t, templateDir, map[string]string{"out.txt": "new\n"})
+
+			clk.Add(time.Second)
+			result := UpgradeAll(ctx, &Params{
+				Clock:             clk,
+				ConflictFileNames: tc.conflictFileNames,
+				CWD:               tempBase,
+				FS:                &common.RealFS{},
+				Location:          destDir,
+				Stdout:            io.Discard,
+				downloaderFactory: func(context.Context, *templatesource.ForUpgradeParams) (templatesource.Downloader, error) {
+					return dl, nil
+				},
+			})
+			if result.Err != nil {
+				t.Fatal(result.Err)
+			}
+			if result.Overall != MergeConflict {
+				t.Errorf("got result type %q, want %q", result.Overall, MergeConflict)
+			}
+
+			got := abctestutil.LoadDir(t, destDir, abctestutil.SkipGlob(".abc/manifest*"))
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("dest contents were not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestUpgrade_Locked(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	tempBase := t.TempDir()
+	templateDir := filepath.Join(tempBase, "template")
+	destDir := filepath.Join(tempBase, "dest")
+	abctestutil.WriteAll(t, templateDir, map[string]string{
+		"out.txt":   "old\n",
+		"spec.yaml": includeDotSpec,
+	})
+	clk := clock.NewMock()
+	clk.Set(time.Date(2024, 3, 1, 4, 5, 6, 7, time.UTC))
+	mustRender(t, ctx, clk, nil, tempBase, templateDir, destDir, nil)
+	abctestutil.WriteAll(t, templateDir, map[string]string{"out.txt": "new\n"})
+
+	// Another upgrade of the same installation holds the lock.
+	lock, err := destlock.Acquire(ctx, &destlock.Params{
+		FS:        &common.RealFS{},
+		Dir:       destDir,
+		Operation: "upgrade",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := &Params{
+		Clock:            clk,
+		CWD:              tempBase,
+		FS:               &common.RealFS{},
+		Location:         destDir,
+		TemplateLocation: templateDir,
+	}
+	result := UpgradeAll(ctx, params)
+	if !errors.Is(result.Err, destlock.ErrLocked) {
+		t.Fatalf("got error %v, want one wrapping destlock.ErrLocked", result.Err)
+	}
+	got := abctestutil.LoadDir(t, destDir, abctestutil.SkipGlob(".abc/*"))
+	if diff := cmp.Diff(got, map[string]string{"out.txt": "old\n"}); diff != "" {
+		t.Errorf("dest contents were changed while locked (-got,+want): %s", diff)
+	}
+
+	if err := lock.Release(true); err != nil {
+		t.Fatal(err)
+	}
+	result = UpgradeAll(ctx, params)
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if result.Overall != Success {
+		t.Errorf("got result type %q, want %q", result.Overall, Success)
+	}
+	if _, err := os.Stat(destlock.Path(destDir)); !common.IsNotExistErr(err) {
+		t.Errorf("lock file still exists after upgrade: %v", err)
+	}
+}
+
+func TestUpgrade_FinishesInterruptedCommitFirst(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	tempBase := t.TempDir()
+	templateDir := filepath.Join(tempBase, "template")
+	destDir := filepath.Join(tempBase, "dest")
+	abctestutil.WriteAll(t, templateDir, map[string]string{
+		"out.txt":   "old\n",
+		"spec.yaml": includeDotSpec,
+	})
+	clk := clock.NewMock()
+	clk.Set(time.Date(2024, 3, 1, 4, 5, 6, 7, time.UTC))
+	mustRender(t, ctx, clk, nil, tempBase, templateDir, destDir, nil)
+	abctestutil.WriteAll(t, templateDir, map[string]string{"out.txt": "new\n"})
+
+	// A render of some other template into the same directory was
+	// interrupted before all of its files were moved into place.
+	abctestutil.WriteAll(t, destDir, map[string]string{
+		".abc/staging-1/files/other.txt": "other\n",
+		".abc/staging-1/journal.yaml":    "files:\n  - other.txt\n",
+	})
+
+	result := UpgradeAll(ctx, &Params{
+		Clock:            clk,
+		CWD:              tempBase,
+		FS:               &common.RealFS{},
+		Location:         destDir,
+		TemplateLocation: templateDir,
+	})
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+
+	got := abctestutil.LoadDir(t, destDir, abctestutil.SkipGlob(".abc/manifest*"))
+	want := map[string]string{
+		"out.txt":   "new\n",
+		"other.txt": "other\n",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("dest contents were not as expected (-got,+want): %s", diff)
+	}
+}
+
+func TestUpgrade_ManifestSignature(t *testing.T) {
+	t.Parallel()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name        string
+		unsigned    bool
+		tamper      bool
+		signer      crypto.Signer
+		wantErr     string
+		wantSigned  bool
+		wantSigGone bool
+	}{
+		{
+			name:       "verified_and_resigned",
+			signer:     priv,
+			wantSigned: true,
+		},
+		{
+			name:        "verified_and_stale_signature_removed",
+			wantSigGone: true,
+		},
+		{
+			name:    "tampered",
+			tamper:  true,
+			signer:  priv,
+			wantErr: "refusing to upgrade",
+		},
+		{
+			name:     "unsigned",
+			unsigned: true,
+			signer:   priv,
+			wantErr:  "the manifest isn't signed",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			tempBase := t.TempDir()
+			templateDir := filepath.Join(tempBase, "template_dir")
+			destDir := filepath.Join(tempBase, "dest")
+			abctestutil.WriteAll(t, templateDir, map[string]string{
+				"out.txt":   "hello\n",
+				"spec.yaml": includeDotSpec,
+			})
+			clk := clock.NewMock()
+			clk.Set(time.Date(2024, 3, 1, 4, 5, 6, 7, time.UTC))
+			renderResult := mustRender(t, ctx, clk, nil, tempBase, templateDir, destDir, nil)
+
+			fs := &common.RealFS{}
+			manifestPath := filepath.Join(destDir, renderResult.ManifestPath)
+			buf, err := os.ReadFile(manifestPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tc.unsigned {
+				if err := signing.WriteSig(fs, priv, manifestPath, buf); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tc.tamper {
+				abctestutil.Overwrite(t, manifestPath, string(buf)+"# hand edit\n")
+			}
+
+			abctestutil.OverwriteJoin(t, templateDir, "out.txt", "new contents")
+			clk.Add(time.Second)
+			result := UpgradeAll(ctx, &Params{
+				Clock:             clk,
+				CWD:               tempBase,
+				FS:                fs,
+				Location:          destDir,
+				ManifestSigner:    tc.signer,
+				ManifestVerifyKey: pub,
+				TemplateLocation:  templateDir,
+			})
+			if diff := testutil.DiffErrString(result.Err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if tc.wantErr != "" {
+				return
+			}
+
+			verifyErr := signing.VerifyFile(fs, pub, manifestPath)
+			if tc.wantSigned && verifyErr != nil {
+				t.Errorf("the upgraded manifest's signature didn't verify: %v", verifyErr)
+			}
+			if gotSigGone := errors.Is(verifyErr, signing.ErrNotSigned); gotSigGone != tc.wantSigGone {
+				t.Errorf("got signature removed %t, want %t (error: %v)", gotSigGone, tc.wantSigGone, verifyErr)
+			}
+		})
+	}
+}
+
+func TestUpgrade_InputFiles(t *testing.T) {
+	t.Parallel()
+
+	specContents := `api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Template'
+desc: '%s'
+inputs:
+  - name: 'name'
+    desc: 'who to greet'
+steps:
+  - desc: 'Include'
+    action: 'include'
+    params:
+      paths: ['greeting.txt']
+  - desc: 'Template'
+    action: 'go_template'
+    params:
+      paths: ['greeting.txt']
+`
+
+	cases := []struct {
+		name            string
+		reuseInputFiles bool
+		newInputFile    string // empty means delete the input file
+		repoAtDest      bool   // if false, the repo contains both dest and the input file
+		wantGreeting    string
+		wantInputFile   string // the contents whose hash should be in the new manifest
+	}{
+		{
+			name:          "saved_values_used_by_default",
+			newInputFile:  "name: 'Bob'",
+			wantGreeting:  "hello Alice\n",
+			wantInputFile: "name: 'Alice'",
+		},
+		{
+			name:            "reused_input_file_is_reread",
+			reuseInputFiles: true,
+			newInputFile:    "name: 'Bob'",
+			wantGreeting:    "hello Bob\n",
+			wantInputFile:   "name: 'Bob'",
+		},
+		{
+			name:            "missing_input_file_falls_back_to_saved_values",
+			reuseInputFiles: true,
+			wantGreeting:    "hello Alice\n",
+			wantInputFile:   "name: 'Alice'",
+		},
+		{
+			name:            "input_file_outside_workspace_is_ignored",
+			reuseInputFiles: true,
+			newInputFile:    "name: 'Bob'",
+			repoAtDest:      true,
+			wantGreeting:    "hello Alice\n",
+			wantInputFile:   "name: 'Alice'",
+		},
 	}
 
-	origTemplateDirContents := map[string]string{
-		"out.txt":   "hello\n",
-		"spec.yaml": includeDotSpec,
-	}
-	abctestutil.WriteAll(t, templateDir, origTemplateDirContents)
-	clk := clock.NewMock()
-	clk.Set(time.Date(2024, 3, 1, 4, 5, 6, 7, time.UTC))
-	mustRender(t, ctx, clk, nil, tempBase, templateDir, destDir, nil)
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
 
-	clk.Add(time.Second)
-	params := &Params{
-		Clock:    clk,
-		CWD:      tempBase,
-		FS:       &common.RealFS{},
-		Location: destDir,
-	}
+			ctx := context.Background()
+			tempBase := t.TempDir()
+			templateDir := filepath.Join(tempBase, "template_dir")
+			destDir := filepath.Join(tempBase, "dest")
+			inputFile := filepath.Join(tempBase, "inputs.yaml")
+			abctestutil.WriteAll(t, tempBase, map[string]string{
+				"template_dir/spec.yaml":    fmt.Sprintf(specContents, "version 1"),
+				"template_dir/greeting.txt": "hello {{.name}}\n",
+				"inputs.yaml":               "name: 'Alice'",
+			})
+			if tc.repoAtDest {
+				abctestutil.WriteAll(t, destDir, abctestutil.WithGitRepoAt("", nil))
+			} else {
+				abctestutil.WriteAll(t, tempBase, abctestutil.WithGitRepoAt("", nil))
+			}
 
-	// Attempting to upgrade without a canonical location should fail
-	result := UpgradeAll(ctx, params)
-	wantErr := "this template was installed without a canonical location; please use the --template-location flag to specify where to upgrade from"
-	if diff := testutil.DiffErrString(result.Err, wantErr); diff != "" {
-		t.Fatal(diff)
-	}
+			clk := clock.NewMock()
+			clk.Set(time.Date(2024, 3, 1, 4, 5, 6, 7, time.UTC))
+			renderResult, err := render.Render(ctx, &render.Params{
+				Clock:       clk,
+				Cwd:         tempBase,
+				Downloader:  &templatesource.LocalDownloader{SrcPath: templateDir},
+				FS:          &common.RealFS{},
+				InputFiles:  []string{inputFile},
+				OutDir:      destDir,
+				TempDirBase: tempBase,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
 
-	// "Upgrading" to the original template should return "already up to date"
-	params.TemplateLocation = templateDir
-	result = UpgradeAll(ctx, params)
-	if result.Err != nil {
-		t.Fatal(result.Err)
-	}
-	if result.Overall != AlreadyUpToDate {
-		t.Fatalf("got result.Overall %q, want %q", result.Overall, AlreadyUpToDate)
-	}
+			if tc.newInputFile == "" {
+				if err := os.Remove(inputFile); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				abctestutil.Overwrite(t, inputFile, tc.newInputFile)
+			}
+			abctestutil.OverwriteJoin(t, templateDir, "spec.yaml", fmt.Sprintf(specContents, "version 2"))
+
+			clk.Add(time.Second)
+			result := UpgradeAll(ctx, &Params{
+				Clock:            clk,
+				CWD:              tempBase,
+				FS:               &common.RealFS{},
+				Location:         destDir,
+				ReuseInputFiles:  tc.reuseInputFiles,
+				TemplateLocation: templateDir,
+			})
+			if result.Err != nil {
+				t.Fatal(result.Err)
+			}
+			if result.Overall != Success {
+				t.Fatalf("got result.Overall %q, want %q", result.Overall, Success)
+			}
 
-	// Now modify the template so there's something to actually do during upgrade
-	abctestutil.OverwriteJoin(t, templateDir, "out.txt", "new contents")
-	result = UpgradeAll(ctx, params)
-	if result.Err != nil {
-		t.Fatal(result.Err)
-	}
-	if result.Overall != Success {
-		t.Fatalf("got result.Overall %q, want %q", result.Overall, Success)
+			gotGreeting, err := os.ReadFile(filepath.Join(destDir, "greeting.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(gotGreeting); got != tc.wantGreeting {
+				t.Errorf("got greeting %q, want %q", got, tc.wantGreeting)
+			}
+
+			gotManifest, _, err := loadManifest(ctx, &common.RealFS{}, filepath.Join(destDir, renderResult.ManifestPath))
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantHash := sha256.Sum256([]byte(tc.wantInputFile))
+			wantInputFiles := []*manifest.InputFile{
+				{Path: mdl.S("../inputs.yaml"), Hash: mdl.S("h1:" + base64.StdEncoding.EncodeToString(wantHash[:]))},
+			}
+			if diff := cmp.Diff(gotManifest.InputFiles, wantInputFiles, cmpopts.IgnoreTypes(&model.ConfigPos{}, model.ConfigPos{})); diff != "" {
+				t.Errorf("manifest input files were not as expected (-got,+want): %s", diff)
+			}
+		})
 	}
 }
 
@@ -2104,6 +3340,7 @@ steps:
 		ModificationTime: renderTime1,
 		TemplateLocation: mdl.S("../../template_dir"),
 		LocationType:     mdl.S("local_git"),
+		TemplateRepo:     &manifest.TemplateRepo{Path: mdl.S("template_dir")},
 		TemplateVersion:  mdl.S(abctestutil.MinimalGitHeadSHA),
 		Inputs:           []*manifest.Input{},
 		OutputFiles: []*manifest.OutputFile{
@@ -2186,13 +3423,15 @@ steps:
 						GitSHA:      abctestutil.MinimalGitHeadSHA,
 						GitShortSHA: abctestutil.MinimalGitHeadShortSHA,
 					},
+					Repo: &templatesource.RepoLocation{Path: "template_dir"},
 				},
 			},
 		},
 	}
 	opts := []cmp.Option{
 		cmpopts.EquateEmpty(),
-		cmpopts.IgnoreFields(ActionTaken{}, "Explanation"), // don't assert on debugging messages. That would make test cases overly verbose.
+		cmpopts.IgnoreFields(ActionTaken{}, "Explanation", "Evidence"), // don't assert on debugging messages. That would make test cases overly verbose.
+		cmpopts.IgnoreFields(ManifestResult{}, "CopyStats"),            // timing dependent
 	}
 	if diff := cmp.Diff(result, wantResult, opts...); diff != "" {
 		t.Errorf("result was not as expected, diff is (-got, +want): %v", diff)
@@ -2201,31 +3440,23 @@ steps:
 	// manifest should be unchanged if there's a reversal conflict
 	wantDestContentsAfterFailedUpgrade := map[string]string{
 		"dir/file.txt": "green is my favorite color\n",
-
-		// Don't assert the contents of the .rej file, because its contents vary
-		// between macos and linux due to the differences between freebsd patch
-		// and GNU patch.
-		//
-		// "file.txt.patch.rej": ... ,
+		"dir/file.txt.patch.rej": `--- a/dir/file.txt
++++ b/dir/file.txt
+@@ -1 +1 @@
+-red is my favorite color
++purple is my favorite color
+`,
 	}
 
 	wantManifestAfterFailedUpgrade := wantManifestBeforeUpgrade
 	assertManifest(ctx, t, "after upgrade", wantManifestAfterFailedUpgrade, manifestFullPath)
 
 	gotDestContentsAfterFailedUpgrade := abctestutil.LoadDir(t, destDir1,
-		abctestutil.SkipGlob(".abc/manifest*"),         // the manifest is verified separately
-		abctestutil.SkipGlob("dir/file.txt.patch.rej"), // the patch reject file is just checked for presence, separately
+		abctestutil.SkipGlob(".abc/manifest*"), // the manifest is verified separately
 	)
 	if diff := cmp.Diff(gotDestContentsAfterFailedUpgrade, wantDestContentsAfterFailedUpgrade); diff != "" {
 		t.Errorf("installed directory contents after upgrading were not as expected (-got,+want): %s", diff)
 	}
-	ok, err := common.Exists(filepath.Join(destDir1, "dir/file.txt.patch.rej"))
-	if err != nil {
-		t.Fatal(err)
-	}
-	if !ok {
-		t.Fatal("got no dir/file.txt.patch.rej rejected patch file, but wanted one")
-	}
 
 	// Resolve the merge conflict
 	abctestutil.OverwriteJoin(t, destDir1, "dir/file.txt", "purple is my favorite color\n")
@@ -2260,6 +3491,7 @@ steps:
 						GitSHA:      abctestutil.MinimalGitHeadSHA,
 						GitShortSHA: abctestutil.MinimalGitHeadShortSHA,
 					},
+					Repo: &templatesource.RepoLocation{Path: "template_dir"},
 				},
 			},
 			{
@@ -2281,6 +3513,7 @@ steps:
 						GitSHA:      abctestutil.MinimalGitHeadSHA,
 						GitShortSHA: abctestutil.MinimalGitHeadShortSHA,
 					},
+					Repo: &templatesource.RepoLocation{Path: "template_dir"},
 				},
 			},
 		},
@@ -2331,6 +3564,7 @@ steps:
 						GitSHA:      abctestutil.MinimalGitHeadSHA,
 						GitShortSHA: abctestutil.MinimalGitHeadShortSHA,
 					},
+					Repo: &templatesource.RepoLocation{Path: "template_dir"},
 				},
 			},
 		},
@@ -2363,6 +3597,11 @@ func TestDetectUnmergedConflicts(t *testing.T) {
 			files:   map[string]string{"dir1/file.txt.abcmerge_locally_added": ""},
 			wantErr: "dir1/file.txt.abcmerge_locally_added",
 		},
+		{
+			name:    "keep_extension_naming_detected",
+			files:   map[string]string{"dir1/file.abcmerge_from_new_template.txt": ""},
+			wantErr: "dir1/file.abcmerge_from_new_template.txt",
+		},
 		{
 			name:    "rejected_patch",
 			files:   map[string]string{"file.txt.patch.rej": ""},
@@ -2566,6 +3805,165 @@ steps:
 	}
 }
 
+func TestUpgradeAll_SourceUnavailable(t *testing.T) {
+	t.Parallel()
+
+	specFile := `api_version: 'cli.abcxyz.dev/v1beta6'
+kind: 'Template'
+desc: 'my template'
+steps:
+  - desc: 'include .'
+    action: 'include'
+    params:
+      paths: ['.']
+`
+
+	cases := []struct {
+		name             string
+		skipUnavailable  bool
+		relocate         bool
+		relocateKey      string
+		wantOverall      ResultType
+		wantResultTypes  []ResultType
+		wantDestContents map[string]string
+		wantErr          string
+	}{
+		{
+			name:            "stops_at_unavailable",
+			wantOverall:     SourceUnavailable,
+			wantResultTypes: []ResultType{SourceUnavailable},
+			wantDestContents: map[string]string{
+				"destDir1/myfile.txt": "my old template1 file contents",
+				"destDir2/myfile.txt": "my old template2 file contents",
+			},
+		},
+		{
+			name:            "skip_unavailable",
+			skipUnavailable: true,
+			wantOverall:     Success,
+			wantResultTypes: []ResultType{SourceUnavailable, Success},
+			wantDestContents: map[string]string{
+				"destDir1/myfile.txt": "my old template1 file contents",
+				"destDir2/myfile.txt": "my new template2 file contents",
+			},
+		},
+		{
+			name:            "relocate",
+			relocate:        true,
+			wantOverall:     Success,
+			wantResultTypes: []ResultType{Success, Success},
+			wantDestContents: map[string]string{
+				"destDir1/myfile.txt": "my relocated template1 file contents",
+				"destDir2/myfile.txt": "my new template2 file contents",
+			},
+		},
+		{
+			name:        "relocate_unknown_manifest",
+			relocateKey: "nonexistent/.abc/manifest.lock.yaml",
+			wantErr:     `the --relocate manifest path "nonexistent/.abc/manifest.lock.yaml" is not one of the manifests to upgrade`,
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			clk := clock.NewMock()
+
+			tempBase := t.TempDir()
+
+			// Make the temp dir into a git repo so template locations will be treated
+			// as canonical.
+			abctestutil.WriteAll(t, tempBase, abctestutil.WithGitRepoAt("", nil))
+
+			templateDir1 := filepath.Join(tempBase, "templateDir1")
+			templateDir2 := filepath.Join(tempBase, "templateDir2")
+			relocatedDir := filepath.Join(tempBase, "relocatedDir")
+			destBase := filepath.Join(tempBase, "dest")
+			destDir1 := filepath.Join(destBase, "destDir1")
+			destDir2 := filepath.Join(destBase, "destDir2")
+			abctestutil.WriteAll(t, templateDir1, map[string]string{
+				"spec.yaml":  specFile,
+				"myfile.txt": "my old template1 file contents",
+			})
+			abctestutil.WriteAll(t, templateDir2, map[string]string{
+				"spec.yaml":  specFile,
+				"myfile.txt": "my old template2 file contents",
+			})
+			mustRender(t, ctx, clk, nil, tempBase, templateDir1, destDir1, nil)
+			mustRender(t, ctx, clk, nil, tempBase, templateDir2, destDir2, nil)
+
+			// The first template goes away, and reappears somewhere else.
+			if err := os.RemoveAll(templateDir1); err != nil {
+				t.Fatal(err)
+			}
+			abctestutil.WriteAll(t, relocatedDir, map[string]string{
+				"spec.yaml":  specFile,
+				"myfile.txt": "my relocated template1 file contents",
+			})
+			abctestutil.WriteAll(t, templateDir2, map[string]string{
+				"myfile.txt": "my new template2 file contents",
+			})
+
+			var templateLocations map[string]string
+			if tc.relocate {
+				manifests, err := filepath.Glob(filepath.Join(destDir1, ".abc", "manifest*"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(manifests) != 1 {
+					t.Fatalf("got manifests %q, want exactly one", manifests)
+				}
+				rel, err := filepath.Rel(tempBase, manifests[0])
+				if err != nil {
+					t.Fatal(err)
+				}
+				templateLocations = map[string]string{rel: relocatedDir}
+			}
+			if tc.relocateKey != "" {
+				templateLocations = map[string]string{tc.relocateKey: relocatedDir}
+			}
+
+			allResult := UpgradeAll(ctx, &Params{
+				Clock:             clk,
+				CWD:               tempBase,
+				FS:                &common.RealFS{},
+				Location:          tempBase,
+				SkipUnavailable:   tc.skipUnavailable,
+				Stdout:            os.Stdout,
+				TemplateLocations: templateLocations,
+			})
+			if diff := testutil.DiffErrString(allResult.Err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if tc.wantErr != "" {
+				return
+			}
+
+			if allResult.Overall != tc.wantOverall {
+				t.Errorf("got overall result %q, want %q", allResult.Overall, tc.wantOverall)
+			}
+			gotResultTypes := make([]ResultType, 0, len(allResult.Results))
+			for _, result := range allResult.Results {
+				gotResultTypes = append(gotResultTypes, result.Type)
+				if result.Type == SourceUnavailable && result.SourceUnavailable == nil {
+					t.Errorf("result for %q had type %q but no SourceUnavailable error", result.ManifestPath, result.Type)
+				}
+			}
+			if diff := cmp.Diff(gotResultTypes, tc.wantResultTypes); diff != "" {
+				t.Errorf("result types were not as expected (-got,+want):\n%s", diff)
+			}
+
+			opt := abctestutil.SkipGlob("*/.abc/manifest*") // manifests are too unpredictable, don't assert their contents
+			gotDestContents := abctestutil.LoadDir(t, destBase, opt)
+			if diff := cmp.Diff(gotDestContents, tc.wantDestContents); diff != "" {
+				t.Errorf("dest contents were not as expected (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestUpgradeAll_MultipleTemplatesWithResumedConflict(t *testing.T) {
 	t.Parallel()
 
@@ -2636,9 +4034,9 @@ func TestUpgradeAll_MultipleTemplatesWithResumedConflict(t *testing.T) {
 	}
 
 	wantDestContents := map[string]string{
-		"destDir1/myfile.txt" + SuffixFromNewTemplate: "my new template1 file contents",
-		"destDir1/myfile.txt":                         "my local edits",
-		"destDir2/myfile.txt":                         "my old template2 file contents",
+		"destDir1/myfile.abcmerge_from_new_template.txt": "my new template1 file contents",
+		"destDir1/myfile.txt":                            "my local edits",
+		"destDir2/myfile.txt":                            "my old template2 file contents",
 	}
 	opt := abctestutil.SkipGlob("*/.abc/manifest*") // manifest are too unpredictable, don't assert their contents
 	gotDestContents := abctestutil.LoadDir(t, destBase, opt)
@@ -2647,7 +4045,7 @@ func TestUpgradeAll_MultipleTemplatesWithResumedConflict(t *testing.T) {
 	}
 
 	abctestutil.OverwriteJoin(t, destDir1, "myfile.txt", "my resolved contents")
-	abctestutil.Remove(t, destDir1, "myfile.txt"+SuffixFromNewTemplate)
+	abctestutil.Remove(t, destDir1, "myfile.abcmerge_from_new_template.txt")
 
 	allResult = UpgradeAll(ctx, upgradeParams)
 	if allResult.Err != nil {
@@ -2798,6 +4196,84 @@ func TestUpgradeAll_Dependency(t *testing.T) {
 	}
 }
 
+func TestDepOrder(t *testing.T) {
+	t.Parallel()
+
+	// depManifest returns a manifest for a template installed from the given
+	// local template location, that output the given files.
+	depManifest := func(templateLocation string, outputFiles ...string) *manifest.Manifest {
+		m := &manifest.Manifest{
+			LocationType:     mdl.S(string(templatesource.LocalGit)),
+			TemplateLocation: mdl.S(templateLocation),
+		}
+		for _, f := range outputFiles {
+			m.OutputFiles = append(m.OutputFiles, &manifest.OutputFile{File: mdl.S(f)})
+		}
+		return m
+	}
+
+	cases := []struct {
+		name      string
+		manifests map[string]*manifest.Manifest
+		maxDepth  int
+		want      []string
+		wantErr   string
+	}{
+		{
+			name: "chain",
+			manifests: map[string]*manifest.Manifest{
+				"a/.abc/manifest.yaml": depManifest("../b/tmpl"),
+				"b/.abc/manifest.yaml": depManifest("../c/tmpl", "tmpl/spec.yaml"),
+				"c/.abc/manifest.yaml": depManifest("../templates", "tmpl/spec.yaml"),
+			},
+			maxDepth: 3,
+			want:     []string{"c/.abc/manifest.yaml", "b/.abc/manifest.yaml", "a/.abc/manifest.yaml"},
+		},
+		{
+			name: "too_deep",
+			manifests: map[string]*manifest.Manifest{
+				"a/.abc/manifest.yaml": depManifest("../b/tmpl"),
+				"b/.abc/manifest.yaml": depManifest("../c/tmpl", "tmpl/spec.yaml"),
+				"c/.abc/manifest.yaml": depManifest("../templates", "tmpl/spec.yaml"),
+			},
+			maxDepth: 2,
+			wantErr:  "nested 3 deep, which is more than the limit of 2; each template was installed from a template that was output by the next one: a/.abc/manifest.yaml -> b/.abc/manifest.yaml -> c/.abc/manifest.yaml",
+		},
+		{
+			name: "cycle",
+			manifests: map[string]*manifest.Manifest{
+				"a/.abc/manifest.yaml": depManifest("../b/tmpl", "tmpl/spec.yaml"),
+				"b/.abc/manifest.yaml": depManifest("../a/tmpl", "tmpl/spec.yaml"),
+			},
+			maxDepth: DefaultMaxDependencyDepth,
+			wantErr:  "cyclic dependency, so there's no order to upgrade them in; each template was installed from a template that was output by the next one: a/.abc/manifest.yaml -> b/.abc/manifest.yaml -> a/.abc/manifest.yaml",
+		},
+		{
+			name: "self_cycle",
+			manifests: map[string]*manifest.Manifest{
+				"a/.abc/manifest.yaml": depManifest("tmpl", "tmpl/spec.yaml"),
+			},
+			maxDepth: DefaultMaxDependencyDepth,
+			wantErr:  "a/.abc/manifest.yaml -> a/.abc/manifest.yaml",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, _, err := depOrder("", tc.maxDepth, tc.manifests)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("order was not as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
 // mustIndexFunc is a wrapper around slices.IndexFunc that saves the caller from
 // worrying about the case where nothing is found and -1 is returned.
 func mustIndexFunc[T any](t *testing.T, s []T, f func(T) bool) int {
@@ -2824,6 +4300,10 @@ func assertManifest(ctx context.Context, tb testing.TB, whereAreWe string, want
 
 		// Don't force test author to compute hashes when writing/updating test cases.
 		cmpopts.IgnoreFields(manifest.Manifest{}, "TemplateDirhash"),
+
+		// Input provenance and the render environment are tested separately.
+		cmpopts.IgnoreFields(manifest.Manifest{}, "UpgradeChannelSource", "ConflictFileNames", "InputFiles", "RenderEnvironment"),
+		cmpopts.IgnoreFields(manifest.Input{}, "Source", "SourceFile"),
 		cmpopts.IgnoreFields(manifest.OutputFile{}, "Hash"),
 	}
 	if diff := cmp.Diff(got, want, opts...); diff != "" {
@@ -2882,3 +4362,69 @@ func manifestWith(m *manifest.Manifest, change func(*manifest.Manifest)) *manife
 	change(&out)
 	return &out
 }
+
+func TestMergeManifest_UpgradeChannelSource(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		oldChannel string
+		oldSource  string
+		newChannel string
+		newSource  string
+		want       string
+	}{
+		{
+			name:       "reused_channel_keeps_old_source",
+			oldChannel: "main",
+			oldSource:  manifest.UpgradeChannelSourceFlag,
+			newChannel: "main",
+			newSource:  manifest.UpgradeChannelSourceAutodetected,
+			want:       manifest.UpgradeChannelSourceFlag,
+		},
+		{
+			name:       "new_flag_wins",
+			oldChannel: "latest",
+			oldSource:  manifest.UpgradeChannelSourceAutodetected,
+			newChannel: "main",
+			newSource:  manifest.UpgradeChannelSourceFlag,
+			want:       manifest.UpgradeChannelSourceFlag,
+		},
+		{
+			name:       "changed_channel_uses_new_source",
+			oldChannel: "main",
+			oldSource:  manifest.UpgradeChannelSourceFlag,
+			newChannel: "latest",
+			newSource:  manifest.UpgradeChannelSourceAutodetected,
+			want:       manifest.UpgradeChannelSourceAutodetected,
+		},
+		{
+			name:       "old_manifest_without_source",
+			oldChannel: "main",
+			newChannel: "main",
+			newSource:  manifest.UpgradeChannelSourceAutodetected,
+			want:       manifest.UpgradeChannelSourceAutodetected,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			old := &manifest.Manifest{
+				UpgradeChannel:       mdl.S(tc.oldChannel),
+				UpgradeChannelSource: mdl.S(tc.oldSource),
+			}
+			newManifest := &manifest.Manifest{
+				UpgradeChannel:       mdl.S(tc.newChannel),
+				UpgradeChannelSource: mdl.S(tc.newSource),
+			}
+			got := mergeManifest(old, newManifest).Wrapped.UpgradeChannelSource.Val
+			if got != tc.want {
+				t.Errorf("got upgrade_channel_source %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
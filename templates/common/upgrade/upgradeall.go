@@ -18,20 +18,23 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io/fs"
 	"os"
 	"path/filepath"
 	"slices"
-	"sort"
 	"strings"
+	"time"
 
 	"golang.org/x/exp/maps"
 
 	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/auditlog"
 	"github.com/abcxyz/abc/templates/common/graph"
+	"github.com/abcxyz/abc/templates/common/indexutil"
 	"github.com/abcxyz/abc/templates/common/specutil"
+	"github.com/abcxyz/abc/templates/common/telemetry"
+	"github.com/abcxyz/abc/templates/common/tempdir"
 	"github.com/abcxyz/abc/templates/common/templatesource"
-	manifest "github.com/abcxyz/abc/templates/model/manifest/v1alpha1"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1beta7"
 	"github.com/abcxyz/pkg/logging"
 )
 
@@ -41,7 +44,9 @@ import (
 type Result struct {
 	// The "most severe" or "most interesting" upgrade result out of all the
 	// upgrades attempted. The ascending order of severity is None ->
-	// AlreadyUpToDate -> Success -> PatchReversalConflict -> MergeConflict
+	// AlreadyUpToDate -> Success -> SourceUnavailable -> PatchReversalConflict
+	// -> MergeConflict. With Params.SkipUnavailable, SourceUnavailable results
+	// don't count.
 	//
 	// For example, if we ran an upgrade on a directory containing three
 	// installed templates, and the results of the upgrades were Success,
@@ -69,6 +74,9 @@ type Result struct {
 	ErrManifestPath string // The optional path to the manifest whose upgrade resulted in error
 }
 
+// DefaultMaxDependencyDepth is the default for Params.MaxDependencyDepth.
+const DefaultMaxDependencyDepth = 10
+
 // ErrNoManifests is returned when upgrade is called with a directory that
 // contains no manifest, or a filename that is not a manifest. Nothing could be
 // found to be upgraded.
@@ -79,7 +87,7 @@ var ErrNoManifests error = fmt.Errorf("found no template manifests to upgrade")
 // if any errors are encountered.
 //
 // If no manifests could be found, then ErrNoManifests is returned.
-func UpgradeAll(ctx context.Context, p *Params) *Result {
+func UpgradeAll(ctx context.Context, p *Params) (out *Result) {
 	logger := logging.FromContext(ctx).With("logger", "UpgradeAll")
 
 	var err error
@@ -88,12 +96,25 @@ func UpgradeAll(ctx context.Context, p *Params) *Result {
 		return &Result{Err: err}
 	}
 
+	cacheTracker := tempdir.NewDirTracker(p.FS, p.KeepTempDirs)
+	defer func() {
+		var cleanupErr error
+		cacheTracker.DeferMaybeRemoveAll(ctx, &cleanupErr)
+		out.Err = errors.Join(out.Err, cleanupErr)
+	}()
+	p.templateCache = newTemplateCache(p.FS, cacheTracker, p.TempDirBase)
+
 	manifests, sorted, depGraph, err := manifestsToUpgrade(ctx, p)
 	if err != nil {
 		return &Result{Err: err}
 	}
+	for manifestPath := range p.TemplateLocations {
+		if _, ok := manifests[manifestPath]; !ok {
+			return &Result{Err: fmt.Errorf("the --relocate manifest path %q is not one of the manifests to upgrade, which are %q", manifestPath, sorted)}
+		}
+	}
 
-	out := &Result{
+	out = &Result{
 		Results: make([]*ManifestResult, 0, len(sorted)),
 	}
 
@@ -105,9 +126,16 @@ func UpgradeAll(ctx context.Context, p *Params) *Result {
 		logger.InfoContext(ctx, "beginning upgrade of manifest",
 			"manifest", absManifestPath)
 		manifest := manifests[manifestPath]
-		result, err := upgrade(ctx, p, absManifestPath, manifest)
+		start := time.Now()
+		result, err := upgrade(ctx, paramsForManifest(p, manifestPath), absManifestPath, manifest)
+		recordMetrics(ctx, start, result, err)
+		auditErr := writeAuditRecord(ctx, p, absManifestPath, manifest, result, err)
 		if err != nil {
-			out.Err = fmt.Errorf("when upgrading the manifest at %s:\n%w", absManifestPath, err)
+			out.Err = errors.Join(fmt.Errorf("when upgrading the manifest at %s:\n%w", absManifestPath, err), auditErr)
+			break
+		}
+		if auditErr != nil {
+			out.Err = auditErr
 			break
 		}
 
@@ -123,16 +151,81 @@ func UpgradeAll(ctx context.Context, p *Params) *Result {
 
 		out.Results = append(out.Results, result)
 
+		if result.Type == SourceUnavailable && p.SkipUnavailable {
+			continue
+		}
 		if result.Type.RequiresUserAttention() {
 			break
 		}
 	}
 
-	out.Overall = overallResult(out.Results)
+	out.Overall = overallResult(out.Results, p.SkipUnavailable)
 
 	return out
 }
 
+// paramsForManifest returns the params for upgrading the manifest at the given
+// path, which differ from p if the manifest was given a new template location
+// with --relocate.
+func paramsForManifest(p *Params, manifestPath string) *Params {
+	loc, ok := p.TemplateLocations[manifestPath]
+	if !ok {
+		return p
+	}
+	out := *p // shallow copy
+	out.TemplateLocation = loc
+	// Rewrite the manifest with the new location even if the template didn't
+	// change, like --continue-if-current does.
+	out.ContinueIfCurrent = true
+	return &out
+}
+
+// recordMetrics reports the outcome of upgrading one manifest, and the number
+// of conflicts it left for the user to resolve.
+func recordMetrics(ctx context.Context, start time.Time, result *ManifestResult, err error) {
+	if err != nil {
+		telemetry.Measure(ctx, telemetry.Upgrades, telemetry.UpgradeDuration, start, err)
+		return
+	}
+
+	m := telemetry.FromContext(ctx)
+	outcome := telemetry.Attr{Key: telemetry.OutcomeKey, Value: result.Type.String()}
+	m.Count(ctx, telemetry.Upgrades, 1, outcome)
+	m.Duration(ctx, telemetry.UpgradeDuration, time.Since(start), outcome)
+	if n := len(result.MergeConflicts) + len(result.ReversalConflicts); n > 0 {
+		m.Count(ctx, telemetry.Conflicts, int64(n), outcome)
+	}
+}
+
+// writeAuditRecord writes a record of the upgrade of one manifest to
+// p.AuditLog, if it's set.
+func writeAuditRecord(ctx context.Context, p *Params, absManifestPath string, oldManifest *manifest.Manifest, result *ManifestResult, upgradeErr error) error {
+	if p.AuditLog == nil {
+		return nil
+	}
+
+	now := time.Now()
+	if p.Clock != nil {
+		now = p.Clock.Now()
+	}
+	r := auditlog.NewRecord(auditlog.OperationUpgrade, now)
+	r.Source = oldManifest.TemplateLocation.Val
+	r.Dest = filepath.Dir(filepath.Dir(absManifestPath))
+	if result != nil {
+		r.Result = result.Type.String()
+		if result.DLMeta != nil {
+			r.CanonicalSource = result.DLMeta.CanonicalSource
+			r.Version = result.DLMeta.Version
+		}
+	}
+	r.SetErr(upgradeErr)
+
+	if err := p.AuditLog.Write(ctx, r); err != nil {
+		return fmt.Errorf("failed writing audit record for the upgrade of %s: %w", absManifestPath, err)
+	}
+	return nil
+}
+
 // manifestsToUpgrade finds all the all the manifests that are in scope for this
 // upgrade operation.
 //
@@ -144,7 +237,7 @@ func UpgradeAll(ctx context.Context, p *Params) *Result {
 //
 // The set of keys is guaranteed to be the same in all the returned values.
 func manifestsToUpgrade(ctx context.Context, p *Params) (map[string]*manifest.Manifest, []string, *graph.Graph[string], error) {
-	manifestPaths, err := crawlManifests(p.Location)
+	manifestPaths, err := indexutil.FindManifests(ctx, p.FS, p.Location, p.IgnoreIndex)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("while crawling manifests: %w", err)
 	}
@@ -166,7 +259,7 @@ func manifestsToUpgrade(ctx context.Context, p *Params) (map[string]*manifest.Ma
 		return nil, nil, nil, err
 	}
 
-	sorted, depGraph, err := depOrder(p.TemplateLocation, manifestsFiltered)
+	sorted, depGraph, err := depOrder(p.TemplateLocation, common.FirstNonZero(p.MaxDependencyDepth, DefaultMaxDependencyDepth), manifestsFiltered)
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -201,9 +294,15 @@ func loadManifests(ctx context.Context, cwd, startFrom string, paths []string) (
 	return outManifests, outBufs, nil
 }
 
-func overallResult(results []*ManifestResult) ResultType {
+// overallResult returns the most severe of the given results. If
+// skipUnavailable is true, SourceUnavailable results are left out, since the
+// user asked for them not to stop the upgrade.
+func overallResult(results []*ManifestResult, skipUnavailable bool) ResultType {
 	var out ResultType
 	for _, result := range results {
+		if skipUnavailable && result.Type == SourceUnavailable {
+			continue
+		}
 		if resultTypeLess(out, result.Type) {
 			out = result.Type
 		}
@@ -211,49 +310,10 @@ func overallResult(results []*ManifestResult) ResultType {
 	return out
 }
 
-// crawlManifests finds all the template manifest files underneath the given
-// file or directory. startFrom can be either a single manifest file or a
-// directory to search recursively. Returned paths are relative to startFrom.
-// The returned slice is sorted lexicographically.
-func crawlManifests(startFrom string) ([]string, error) {
-	var manifests []string
-	err := filepath.WalkDir(startFrom, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			if common.IsNotExistErr(err) {
-				// If the user provides a nonexistent path to upgrade, then
-				// we'll just return an empty list of manifests from this
-				// function and let a higher level function say "no manifests
-				// were found."
-				return nil
-			}
-			return err
-		}
-
-		baseName := filepath.Base(path)
-		ext := filepath.Ext(path)
-		parentDir := filepath.Base(filepath.Dir(path))
-		isManifest := strings.HasPrefix(baseName, "manifest") && ext == ".yaml" && parentDir == common.ABCInternalDir
-		if !isManifest {
-			return nil
-		}
-
-		relToStart, err := filepath.Rel(startFrom, path)
-		if err != nil {
-			return fmt.Errorf("failed determining relative path for manifest: %w", err)
-		}
-		manifests = append(manifests, relToStart)
-		return nil
-	})
-	if err != nil {
-		return nil, err //nolint:wrapcheck
-	}
-
-	sort.Strings(manifests)
-
-	return manifests, nil
-}
-
-func depOrder(localTemplateLocationOverride string, manifests map[string]*manifest.Manifest) ([]string, *graph.Graph[string], error) {
+// depOrder returns the order to upgrade the manifests in, so that a template
+// that was output by another template is upgraded after it. It fails if the
+// dependencies form a cycle, or are nested more than maxDepth deep.
+func depOrder(localTemplateLocationOverride string, maxDepth int, manifests map[string]*manifest.Manifest) ([]string, *graph.Graph[string], error) {
 	if localTemplateLocationOverride != "" {
 		// Subtle point: when the user provides --template-location, then that
 		// means that all the manifest cannot logically have any dependencies
@@ -270,10 +330,15 @@ func depOrder(localTemplateLocationOverride string, manifests map[string]*manife
 	if err != nil {
 		errCycle := &graph.CyclicError[string]{}
 		if errors.As(err, &errCycle) {
-			return nil, nil, fmt.Errorf("there is somehow a cyclic dependency among these manifests: %v", errCycle.Cycle)
+			return nil, nil, fmt.Errorf("the manifests have a cyclic dependency, so there's no order to upgrade them in; "+
+				"each template was installed from a template that was output by the next one: %s", graph.Chain(errCycle.Cycle))
 		}
 		return nil, nil, fmt.Errorf("topological sorting of manifest depencies gave an unexpected error: %w", err)
 	}
+	if chain := deps.LongestPath(); len(chain) > maxDepth {
+		return nil, nil, fmt.Errorf("templates that output templates are nested %d deep, which is more than the limit of %d; "+
+			"each template was installed from a template that was output by the next one: %s", len(chain), maxDepth, graph.Chain(chain))
+	}
 	return sorted, deps, nil
 }
 
@@ -0,0 +1,163 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package vcs abstracts over the version control system of the workspace that
+// contains a directory, so that features like canonical template locations
+// aren't limited to git workspaces.
+package vcs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/common/git"
+)
+
+// VCS is a version control system.
+type VCS interface {
+	// Name is a short name for the VCS, like "git", for use in messages.
+	Name() string
+
+	// HeadRevision returns the identifier of the revision that's currently
+	// checked out in the workspace containing dir. Returns false if this VCS
+	// can't determine it.
+	HeadRevision(ctx context.Context, dir string) (string, bool, error)
+
+	// HeadTags returns the names of all tags that point to the revision that's
+	// currently checked out in the workspace containing dir. If there are no
+	// such tags, or this VCS can't determine them, returns an empty slice.
+	HeadTags(ctx context.Context, dir string) ([]string, error)
+}
+
+// Workspace is the root directory of a version-controlled workspace, along
+// with the VCS that controls it.
+type Workspace struct {
+	Root string
+	VCS  VCS
+}
+
+// noneMarkerDirs are the names of the directories that mark the root of a
+// workspace of a VCS that's handled by None.
+var noneMarkerDirs = []string{
+	".hg", // Mercurial
+	".jj", // Jujutsu
+	".sl", // Sapling
+}
+
+// Detect returns the innermost workspace that contains path. Returns false if
+// path is not inside a workspace of any recognized VCS.
+//
+// Like git.Workspace, path need not actually exist yet. A workspace's root is
+// recognized by the directory where its VCS keeps its data, like ".git". Git
+// takes precedence, so a Jujutsu workspace that's colocated with a git repo is
+// treated as a git workspace.
+func Detect(ctx context.Context, path string) (*Workspace, bool, error) {
+	for {
+		isGit, err := isDir(filepath.Join(path, ".git"))
+		if err != nil {
+			return nil, false, err
+		}
+		if isGit {
+			return &Workspace{Root: path, VCS: &Git{}}, true, nil
+		}
+		for _, marker := range noneMarkerDirs {
+			isNone, err := isDir(filepath.Join(path, marker))
+			if err != nil {
+				return nil, false, err
+			}
+			if isNone {
+				return &Workspace{Root: path, VCS: &None{}}, true, nil
+			}
+		}
+
+		pathBefore := path
+		path = filepath.Dir(path)
+		if path == pathBefore || len(path) <= 1 {
+			// We crawled to the root of the filesystem without finding a
+			// workspace.
+			return nil, false, nil
+		}
+	}
+}
+
+func isDir(path string) (bool, error) {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		if common.IsNotExistErr(err) {
+			return false, nil
+		}
+		return false, err //nolint:wrapcheck
+	}
+	return fileInfo.IsDir(), nil
+}
+
+// IsMetadataDir returns whether the given file name is that of a directory
+// where a recognized VCS keeps its own data, like ".git". These should never be
+// copied out of a template.
+func IsMetadataDir(name string) bool {
+	if name == ".git" {
+		return true
+	}
+	for _, marker := range noneMarkerDirs {
+		if name == marker {
+			return true
+		}
+	}
+	return false
+}
+
+// Git implements VCS for git workspaces, using the git CLI.
+type Git struct{}
+
+// Name implements VCS.
+func (g *Git) Name() string {
+	return "git"
+}
+
+// HeadRevision implements VCS. The revision is the full SHA of HEAD.
+func (g *Git) HeadRevision(ctx context.Context, dir string) (string, bool, error) {
+	sha, err := git.CurrentSHA(ctx, dir)
+	if err != nil {
+		return "", false, err //nolint:wrapcheck
+	}
+	return sha, true, nil
+}
+
+// HeadTags implements VCS.
+func (g *Git) HeadTags(ctx context.Context, dir string) ([]string, error) {
+	return git.HeadTags(ctx, dir) //nolint:wrapcheck
+}
+
+// None implements VCS for the workspaces of version control systems that abc
+// doesn't otherwise support, like Mercurial and Jujutsu. It only knows where
+// those workspaces are, which is enough to keep track of canonical template
+// locations, but it knows nothing about their revisions or tags.
+type None struct{}
+
+// Name implements VCS.
+func (n *None) Name() string {
+	return "none"
+}
+
+// HeadRevision implements VCS. It always returns false.
+func (n *None) HeadRevision(context.Context, string) (string, bool, error) {
+	return "", false, nil
+}
+
+// HeadTags implements VCS. It always returns no tags.
+func (n *None) HeadTags(context.Context, string) ([]string, error) {
+	return nil, nil
+}
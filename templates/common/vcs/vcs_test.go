@@ -0,0 +1,126 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vcs
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	abctestutil "github.com/abcxyz/abc/templates/testutil"
+)
+
+func TestDetect(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		files    map[string]string
+		path     string
+		wantRoot string // relative to the temp dir
+		wantName string // empty means no workspace
+	}{
+		{
+			name:  "no_workspace",
+			files: map[string]string{"a/file.txt": "contents"},
+			path:  "a",
+		},
+		{
+			name:     "git",
+			files:    abctestutil.WithGitRepoAt("repo", nil),
+			path:     "repo/a/b",
+			wantRoot: "repo",
+			wantName: "git",
+		},
+		{
+			name:     "mercurial",
+			files:    map[string]string{"repo/.hg/requires": "store"},
+			path:     "repo/nonexistent",
+			wantRoot: "repo",
+			wantName: "none",
+		},
+		{
+			name:     "jujutsu",
+			files:    map[string]string{"repo/.jj/repo/store/type": "git"},
+			path:     "repo/a",
+			wantRoot: "repo",
+			wantName: "none",
+		},
+		{
+			name: "colocated_jujutsu_is_git",
+			files: abctestutil.WithGitRepoAt("repo", map[string]string{
+				"repo/.jj/repo/store/type": "git",
+			}),
+			path:     "repo/a",
+			wantRoot: "repo",
+			wantName: "git",
+		},
+		{
+			name: "innermost_workspace_wins",
+			files: abctestutil.WithGitRepoAt("outer", map[string]string{
+				"outer/inner/.hg/requires": "store",
+			}),
+			path:     "outer/inner/a",
+			wantRoot: "outer/inner",
+			wantName: "none",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tempDir := t.TempDir()
+			abctestutil.WriteAll(t, tempDir, tc.files)
+
+			ws, ok, err := Detect(context.Background(), filepath.Join(tempDir, tc.path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != (tc.wantName != "") {
+				t.Fatalf("got ok=%t, want %t", ok, tc.wantName != "")
+			}
+			if !ok {
+				return
+			}
+			if got, want := ws.Root, filepath.Join(tempDir, tc.wantRoot); got != want {
+				t.Errorf("got root %q, want %q", got, want)
+			}
+			if got := ws.VCS.Name(); got != tc.wantName {
+				t.Errorf("got VCS %q, want %q", got, tc.wantName)
+			}
+		})
+	}
+}
+
+func TestIsMetadataDir(t *testing.T) {
+	t.Parallel()
+
+	for name, want := range map[string]bool{
+		".git":   true,
+		".hg":    true,
+		".jj":    true,
+		".sl":    true,
+		".abc":   false,
+		"src":    false,
+		"a/.git": false,
+	} {
+		if got := IsMetadataDir(name); got != want {
+			t.Errorf("IsMetadataDir(%q)=%t, want %t", name, got, want)
+		}
+	}
+}
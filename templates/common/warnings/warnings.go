@@ -0,0 +1,138 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package warnings collects warnings about things that still work but will
+// stop working or change behavior in the future, like deprecated fields and
+// old api_versions, so they can be reported together at the end of a command,
+// or turned into errors with --strict.
+package warnings
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/abcxyz/pkg/logging"
+)
+
+// Codes for the kinds of warnings.
+const (
+	// CodeOldAPIVersion is for a file whose api_version is older than the
+	// newest released one, so some features are turned off.
+	CodeOldAPIVersion = "old_api_version"
+
+	// CodeDeprecatedField is for a field that is deprecated in favor of
+	// another one.
+	CodeDeprecatedField = "deprecated_field"
+
+	// CodeDeprecatedTemplate is for a template whose author has declared it
+	// deprecated.
+	CodeDeprecatedTemplate = "deprecated_template"
+)
+
+// Warning is a single warning.
+type Warning struct {
+	// Code is one of the Code* constants.
+	Code string
+
+	// Source is the file or template that the warning is about, like
+	// "spec.yaml" or "github.com/foo/bar@v1".
+	Source string
+
+	// Message explains the problem and, where possible, how to fix it.
+	Message string
+}
+
+func (w *Warning) String() string {
+	if w.Source == "" {
+		return fmt.Sprintf("%s (%s)", w.Message, w.Code)
+	}
+	return fmt.Sprintf("%s: %s (%s)", w.Source, w.Message, w.Code)
+}
+
+// Collector accumulates warnings. It's safe for concurrent use.
+type Collector struct {
+	mu       sync.Mutex
+	warnings []*Warning
+	seen     map[Warning]struct{}
+}
+
+// Add records w, unless an identical warning was already recorded. The same
+// file can be loaded many times during a command, and each problem should
+// only be reported once.
+func (c *Collector) Add(w *Warning) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.seen[*w]; ok {
+		return
+	}
+	if c.seen == nil {
+		c.seen = make(map[Warning]struct{})
+	}
+	c.seen[*w] = struct{}{}
+	c.warnings = append(c.warnings, w)
+}
+
+// Warnings returns the recorded warnings in the order they were added.
+func (c *Collector) Warnings() []*Warning {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*Warning(nil), c.warnings...)
+}
+
+// Report writes the recorded warnings to w, if there are any. When strict is
+// true and there are warnings, it returns an error, so that template CI can
+// fail on them.
+func (c *Collector) Report(w io.Writer, strict bool) error {
+	ws := c.Warnings()
+	if len(ws) == 0 {
+		return nil
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\n%d warning(s):\n", len(ws))
+	for _, warn := range ws {
+		fmt.Fprintf(&sb, "  - %s\n", warn)
+	}
+	if _, err := io.WriteString(w, sb.String()); err != nil {
+		return fmt.Errorf("failed writing warnings: %w", err)
+	}
+
+	if strict {
+		return fmt.Errorf("--strict was given, and there were %d warning(s), the first being: %s", len(ws), ws[0])
+	}
+	return nil
+}
+
+type collectorKey struct{}
+
+// WithCollector returns a context that records warnings in c.
+func WithCollector(ctx context.Context, c *Collector) context.Context {
+	return context.WithValue(ctx, collectorKey{}, c)
+}
+
+// Add records a warning in the Collector stored in ctx by WithCollector. If
+// there isn't one, for example when abc is used as a library, the warning is
+// logged instead.
+func Add(ctx context.Context, w *Warning) {
+	if c, ok := ctx.Value(collectorKey{}).(*Collector); ok && c != nil {
+		logging.FromContext(ctx).DebugContext(ctx, "recorded warning", "warning", w.String())
+		c.Add(w)
+		return
+	}
+	logging.FromContext(ctx).WarnContext(ctx, w.Message, "source", w.Source, "code", w.Code)
+}
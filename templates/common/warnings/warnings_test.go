@@ -0,0 +1,107 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package warnings
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestCollector_Report(t *testing.T) {
+	t.Parallel()
+
+	deprecated := &Warning{
+		Code:    CodeDeprecatedTemplate,
+		Source:  "github.com/foo/bar@v1",
+		Message: "this template is deprecated",
+	}
+	oldVersion := &Warning{
+		Code:    CodeOldAPIVersion,
+		Source:  "spec.yaml",
+		Message: "api_version is old",
+	}
+
+	cases := []struct {
+		name    string
+		add     []*Warning
+		strict  bool
+		want    string
+		wantErr string
+	}{
+		{
+			name: "no_warnings",
+		},
+		{
+			name:   "no_warnings_strict",
+			strict: true,
+		},
+		{
+			name: "duplicates_reported_once",
+			add:  []*Warning{deprecated, oldVersion, {Code: deprecated.Code, Source: deprecated.Source, Message: deprecated.Message}},
+			want: `
+2 warning(s):
+  - github.com/foo/bar@v1: this template is deprecated (deprecated_template)
+  - spec.yaml: api_version is old (old_api_version)
+`,
+		},
+		{
+			name:   "strict",
+			add:    []*Warning{oldVersion},
+			strict: true,
+			want: `
+1 warning(s):
+  - spec.yaml: api_version is old (old_api_version)
+`,
+			wantErr: "--strict was given, and there were 1 warning(s), the first being: spec.yaml: api_version is old",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			c := &Collector{}
+			ctx := WithCollector(context.Background(), c)
+			for _, w := range tc.add {
+				Add(ctx, w)
+			}
+
+			var out bytes.Buffer
+			err := c.Report(&out, tc.strict)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			if diff := cmp.Diff(out.String(), tc.want); diff != "" {
+				t.Errorf("report wasn't as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestAdd_NoCollector(t *testing.T) {
+	t.Parallel()
+
+	// Without a collector, the warning is logged, which must not panic.
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+	Add(ctx, &Warning{Code: CodeDeprecatedField, Message: "hello"})
+}
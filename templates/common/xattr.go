@@ -0,0 +1,55 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+)
+
+// ErrXattrsUnsupported is returned when the platform or the filesystem
+// doesn't support extended attributes.
+var ErrXattrsUnsupported = errors.New("extended attributes aren't supported")
+
+// CopyXattrs gives dst the extended attributes (xattrs) of src. On Linux these
+// include POSIX ACLs and SELinux labels.
+//
+// An xattr that can't be set on dst, because dst's filesystem doesn't support
+// xattrs or because the user isn't allowed to set that xattr, isn't an error.
+// Instead, the names of those xattrs are returned, sorted, so the caller can
+// tell the user what was lost. If src's filesystem doesn't support xattrs,
+// then src has none, and nothing is copied.
+func CopyXattrs(rfs FS, src, dst string) (dropped []string, _ error) {
+	xattrs, err := rfs.ListXattrs(src)
+	if err != nil {
+		if errors.Is(err, ErrXattrsUnsupported) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ListXattrs(%q): %w", src, err)
+	}
+	for name, value := range xattrs {
+		if err := rfs.SetXattr(dst, name, value); err != nil {
+			if errors.Is(err, ErrXattrsUnsupported) || errors.Is(err, fs.ErrPermission) {
+				dropped = append(dropped, name)
+				continue
+			}
+			return nil, fmt.Errorf("SetXattr(%q, %q): %w", dst, name, err)
+		}
+	}
+	sort.Strings(dropped)
+	return dropped, nil
+}
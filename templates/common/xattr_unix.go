@@ -0,0 +1,86 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || darwin || freebsd || netbsd
+
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// XattrsSupported is whether this platform has extended attributes. Even
+// then, some filesystems may not support them.
+const XattrsSupported = true
+
+// listXattrs returns the names and values of all the extended attributes of
+// path.
+func listXattrs(path string) (map[string][]byte, error) {
+	size, err := unix.Listxattr(path, nil)
+	if err != nil {
+		return nil, xattrErr("Listxattr", err)
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	buf := make([]byte, size)
+	if size, err = unix.Listxattr(path, buf); err != nil {
+		return nil, xattrErr("Listxattr", err)
+	}
+
+	out := make(map[string][]byte)
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		value, err := getXattr(path, string(name))
+		if err != nil {
+			return nil, err
+		}
+		out[string(name)] = value
+	}
+	return out, nil
+}
+
+func getXattr(path, name string) ([]byte, error) {
+	size, err := unix.Getxattr(path, name, nil)
+	if err != nil {
+		return nil, xattrErr("Getxattr", err)
+	}
+	value := make([]byte, size)
+	if size, err = unix.Getxattr(path, name, value); err != nil {
+		return nil, xattrErr("Getxattr", err)
+	}
+	return value[:size], nil
+}
+
+func setXattr(path, name string, value []byte) error {
+	if err := unix.Setxattr(path, name, value, 0); err != nil {
+		return xattrErr("Setxattr", err)
+	}
+	return nil
+}
+
+// xattrErr wraps err, adding ErrXattrsUnsupported if err means that the
+// filesystem doesn't support extended attributes.
+func xattrErr(op string, err error) error {
+	if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EOPNOTSUPP) {
+		return fmt.Errorf("%s(): %w: %w", op, ErrXattrsUnsupported, err)
+	}
+	return fmt.Errorf("%s(): %w", op, err)
+}
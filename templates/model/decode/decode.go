@@ -25,24 +25,37 @@ import (
 	"gopkg.in/yaml.v3"
 
 	"github.com/abcxyz/abc/internal/version"
+	"github.com/abcxyz/abc/templates/common/warnings"
 	"github.com/abcxyz/abc/templates/model"
 	goldentestv1alpha1 "github.com/abcxyz/abc/templates/model/goldentest/v1alpha1"
 	goldentestv1beta3 "github.com/abcxyz/abc/templates/model/goldentest/v1beta3"
 	goldentestv1beta4 "github.com/abcxyz/abc/templates/model/goldentest/v1beta4"
+	goldentestv1beta7 "github.com/abcxyz/abc/templates/model/goldentest/v1beta7"
 	"github.com/abcxyz/abc/templates/model/header"
+	indexv1beta7 "github.com/abcxyz/abc/templates/model/index/v1beta7"
 	manifestv1alpha1 "github.com/abcxyz/abc/templates/model/manifest/v1alpha1"
+	manifestv1beta7 "github.com/abcxyz/abc/templates/model/manifest/v1beta7"
+	policyv1beta7 "github.com/abcxyz/abc/templates/model/policy/v1beta7"
 	specv1alpha1 "github.com/abcxyz/abc/templates/model/spec/v1alpha1"
 	specv1beta1 "github.com/abcxyz/abc/templates/model/spec/v1beta1"
 	specv1beta2 "github.com/abcxyz/abc/templates/model/spec/v1beta2"
 	specv1beta3 "github.com/abcxyz/abc/templates/model/spec/v1beta3"
 	specv1beta4 "github.com/abcxyz/abc/templates/model/spec/v1beta4"
 	specv1beta6 "github.com/abcxyz/abc/templates/model/spec/v1beta6"
+	specv1beta7 "github.com/abcxyz/abc/templates/model/spec/v1beta7"
+	stackv1beta7 "github.com/abcxyz/abc/templates/model/stack/v1beta7"
 )
 
 var (
 	KindTemplate   = "Template"   // the value of the "kind" field in a spec.yaml file
 	KindGoldenTest = "GoldenTest" // ... a test.yaml file
 	KindManifest   = "Manifest"   // ... a manifest.yaml file
+
+	KindUpgradeTest  = "UpgradeTest"  // ... an upgrade_test.yaml file
+	KindIndex        = "Index"        // ... an .abc/index.yaml file
+	KindPolicy       = "Policy"       // ... a policy file given by --policy-file
+	KindStack        = "Stack"        // ... a stack.yaml file
+	KindStackOverlay = "StackOverlay" // ... a stack overlay file given by --overlay
 )
 
 type apiVersionDef struct {
@@ -127,6 +140,20 @@ var apiVersions = []apiVersionDef{
 			KindManifest:   &manifestv1alpha1.Manifest{},
 		},
 	},
+	{
+		apiVersion: "cli.abcxyz.dev/v1beta7",
+		unreleased: true,
+		kinds: map[string]model.ValidatorUpgrader{
+			KindTemplate:     &specv1beta7.Spec{},
+			KindGoldenTest:   &goldentestv1beta7.Test{},
+			KindManifest:     &manifestv1beta7.Manifest{},
+			KindUpgradeTest:  &goldentestv1beta7.UpgradeTest{},
+			KindIndex:        &indexv1beta7.Index{},
+			KindPolicy:       &policyv1beta7.Policy{},
+			KindStack:        &stackv1beta7.Stack{},
+			KindStackOverlay: &stackv1beta7.Overlay{},
+		},
+	},
 }
 
 // Decode parses the given YAML contents of r into a struct and returns it. The
@@ -135,11 +162,15 @@ var apiVersions = []apiVersionDef{
 // non-empty, then we'll also validate that the "kind" of the YAML file matches
 // requireKind, and return error if not. This also calls Validate() on
 // the returned struct and returns error if invalid.
-func Decode(r io.Reader, filename, requireKind string, isReleaseBuild bool) (model.ValidatorUpgrader, string, []byte, error) {
+//
+// Errors that point at a position in the file come with an excerpt of the
+// file at that position; see model.WithExcerpt.
+func Decode(r io.Reader, filename, requireKind string, isReleaseBuild bool) (_ model.ValidatorUpgrader, _ string, _ []byte, rErr error) {
 	buf, err := io.ReadAll(r)
 	if err != nil {
 		return nil, "", nil, fmt.Errorf("error reading file %s: %w", filename, err)
 	}
+	defer func() { rErr = model.WithExcerpt(rErr, filename, buf) }()
 
 	cf := &header.Fields{}
 	if err := yaml.Unmarshal(buf, cf); err != nil {
@@ -203,6 +234,7 @@ func DecodeValidateUpgrade(ctx context.Context, r io.Reader, filename, requireKi
 	if err != nil {
 		return nil, nil, err
 	}
+	addWarnings(ctx, filename, apiVersion, buf)
 
 	for {
 		upgraded, err := vu.Upgrade(ctx)
@@ -225,6 +257,39 @@ func DecodeValidateUpgrade(ctx context.Context, r io.Reader, filename, requireKi
 
 // decodeFromVersionKind returns an instance of the YAML struct for the given API version and kind.
 // It also validates the resulting struct.
+// addWarnings records warnings for deprecated things in the header of a file
+// that was decoded successfully. Only the kinds of files that template authors
+// write are checked, since the others are written by abc itself.
+func addWarnings(ctx context.Context, filename, apiVersion string, buf []byte) {
+	cf := &header.Fields{}
+	if err := yaml.Unmarshal(buf, cf); err != nil {
+		return // can't happen, Decode() already parsed it
+	}
+	if cf.Kind.Val != KindTemplate && cf.Kind.Val != KindGoldenTest {
+		return
+	}
+
+	if cf.OldStyleAPIVersion.Val != "" {
+		warnings.Add(ctx, &warnings.Warning{
+			Code:    warnings.CodeDeprecatedField,
+			Source:  filename,
+			Message: `the "apiVersion" field is deprecated, please use "api_version" instead`,
+		})
+	}
+
+	// Compare against the newest released api_version rather than the newest
+	// one, so that dev builds don't warn about templates that are up to date
+	// as far as users are concerned.
+	if latest := LatestSupportedAPIVersion(true); apiVersion < latest {
+		warnings.Add(ctx, &warnings.Warning{
+			Code:   warnings.CodeOldAPIVersion,
+			Source: filename,
+			Message: fmt.Sprintf("api_version %q is older than %q, so some features are turned off, and turning them on "+
+				`will change the template's behavior; see "abc templates migrate-spec"`, apiVersion, latest),
+		})
+	}
+}
+
 func decodeFromVersionKind(filename, apiVersion, kind string, buf []byte) (model.ValidatorUpgrader, error) {
 	idx := slices.IndexFunc(apiVersions, func(v apiVersionDef) bool {
 		return v.apiVersion == apiVersion
@@ -258,6 +323,49 @@ func decodeFromVersionKind(filename, apiVersion, kind string, buf []byte) (model
 	return vu, nil
 }
 
+// ModelIs returns whether files with the given api_version and kind are decoded
+// into the same Go type as example. This lets writers of a file check whether
+// the api_version they're about to write supports a field that was added in a
+// newer model; for example, release builds may write an older api_version
+// whose model doesn't have that field.
+func ModelIs(apiVersion, kind string, example model.ValidatorUpgrader) bool {
+	idx := slices.IndexFunc(apiVersions, func(v apiVersionDef) bool {
+		return v.apiVersion == apiVersion
+	})
+	if idx == -1 {
+		return false
+	}
+	archetype, ok := apiVersions[idx].kinds[kind]
+	if !ok {
+		return false
+	}
+	return reflect.TypeOf(archetype) == reflect.TypeOf(example)
+}
+
+// APIVersionModel is an api_version, together with an example of the Go type
+// that files of some kind with that api_version are decoded into.
+type APIVersionModel struct {
+	APIVersion string
+	Model      model.ValidatorUpgrader
+}
+
+// Models returns an APIVersionModel for each api_version that has the given
+// kind, oldest first. API versions newer than
+// LatestSupportedAPIVersion(isReleaseBuild) are left out.
+func Models(kind string, isReleaseBuild bool) []*APIVersionModel {
+	latest := LatestSupportedAPIVersion(isReleaseBuild)
+	var out []*APIVersionModel
+	for _, v := range apiVersions {
+		if v.apiVersion > latest {
+			break
+		}
+		if m, ok := v.kinds[kind]; ok {
+			out = append(out, &APIVersionModel{APIVersion: v.apiVersion, Model: m})
+		}
+	}
+	return out
+}
+
 // LatestSupportedAPIVersion is the most up-to-date API version. It's
 // in the format "cli.abcxyz.dev/v1beta4".
 //
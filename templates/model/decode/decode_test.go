@@ -24,14 +24,16 @@ import (
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"golang.org/x/exp/maps"
 
+	"github.com/abcxyz/abc/templates/common/warnings"
 	"github.com/abcxyz/abc/templates/model"
 	goldentestfeatures "github.com/abcxyz/abc/templates/model/goldentest/features"
 	goldentestv1alpha1 "github.com/abcxyz/abc/templates/model/goldentest/v1alpha1"
-	goldentestv1beta4 "github.com/abcxyz/abc/templates/model/goldentest/v1beta4"
+	goldentestv1beta7 "github.com/abcxyz/abc/templates/model/goldentest/v1beta7"
 	manifestv1alpha1 "github.com/abcxyz/abc/templates/model/manifest/v1alpha1"
+	manifestv1beta7 "github.com/abcxyz/abc/templates/model/manifest/v1beta7"
 	specfeatures "github.com/abcxyz/abc/templates/model/spec/features"
 	specv1alpha1 "github.com/abcxyz/abc/templates/model/spec/v1alpha1"
-	specv1beta6 "github.com/abcxyz/abc/templates/model/spec/v1beta6"
+	specv1beta7 "github.com/abcxyz/abc/templates/model/spec/v1beta7"
 	mdl "github.com/abcxyz/abc/templates/testutil/model"
 	"github.com/abcxyz/pkg/sets"
 	"github.com/abcxyz/pkg/testutil"
@@ -112,7 +114,7 @@ template_dirhash: 'bar'`,
 		{
 			name:        "newest_template",
 			requireKind: KindTemplate,
-			fileContents: `api_version: 'cli.abcxyz.dev/v1beta6'
+			fileContents: `api_version: 'cli.abcxyz.dev/v1beta7'
 kind: 'Template'
 desc: 'mydesc'
 steps:
@@ -121,15 +123,15 @@ steps:
     if: 'true'
     params:
       paths: ['.']`,
-			want: &specv1beta6.Spec{
+			want: &specv1beta7.Spec{
 				Desc: mdl.S("mydesc"),
-				Steps: []*specv1beta6.Step{
+				Steps: []*specv1beta7.Step{
 					{
 						Action: mdl.S("include"),
 						If:     mdl.S("true"),
 						Desc:   mdl.S("include all files"),
-						Include: &specv1beta6.Include{
-							Paths: []*specv1beta6.IncludePath{
+						Include: &specv1beta7.Include{
+							Paths: []*specv1beta7.IncludePath{
 								{
 									Paths: mdl.Strings("."),
 								},
@@ -138,12 +140,12 @@ steps:
 					},
 				},
 			},
-			wantVersion: "cli.abcxyz.dev/v1beta6",
+			wantVersion: "cli.abcxyz.dev/v1beta7",
 		},
 		{
 			name:        "newest_golden_test",
 			requireKind: KindGoldenTest,
-			fileContents: `api_version: 'cli.abcxyz.dev/v1beta5'
+			fileContents: `api_version: 'cli.abcxyz.dev/v1beta7'
 kind: 'GoldenTest'
 inputs:
   - name: 'foo'
@@ -151,34 +153,60 @@ inputs:
 builtin_vars:
   - name: '_git_tag'
     value: 'my-cool-tag'`,
-			want: &goldentestv1beta4.Test{
-				Inputs: []*goldentestv1beta4.VarValue{
+			want: &goldentestv1beta7.Test{
+				Inputs: []*goldentestv1beta7.VarValue{
 					{
 						Name:  mdl.S("foo"),
 						Value: mdl.S("bar"),
 					},
 				},
-				BuiltinVars: []*goldentestv1beta4.VarValue{
+				BuiltinVars: []*goldentestv1beta7.VarValue{
 					{
 						Name:  mdl.S("_git_tag"),
 						Value: mdl.S("my-cool-tag"),
 					},
 				},
 			},
-			wantVersion: "cli.abcxyz.dev/v1beta5",
+			wantVersion: "cli.abcxyz.dev/v1beta7",
 		},
 		{
 			name:        "newest_manifest",
 			requireKind: KindManifest,
-			fileContents: `api_version: 'cli.abcxyz.dev/v1beta1'
+			fileContents: `api_version: 'cli.abcxyz.dev/v1beta7'
 kind: 'Manifest'
 template_location: 'foo'
-template_dirhash: 'bar'`,
-			want: &manifestv1alpha1.Manifest{
-				TemplateLocation: mdl.S("foo"),
-				TemplateDirhash:  mdl.S("bar"),
+template_dirhash: 'bar'
+upgrade_channel_source: 'flag'
+inputs:
+  - name: 'my_input'
+    value: 'my_value'
+    source: 'input_file'
+    source_file: 'inputs.yaml'
+render_environment:
+  cli_version: '1.2.3'
+  os: 'linux'
+  arch: 'amd64'
+  render_duration_ms: 1500`,
+			want: &manifestv1beta7.Manifest{
+				TemplateLocation:     mdl.S("foo"),
+				TemplateDirhash:      mdl.S("bar"),
+				UpgradeChannelSource: mdl.S("flag"),
+				Inputs: []*manifestv1beta7.Input{
+					{
+						Name:       mdl.S("my_input"),
+						Value:      mdl.S("my_value"),
+						Source:     mdl.S("input_file"),
+						SourceFile: mdl.S("inputs.yaml"),
+					},
+				},
+				RenderEnvironment: &manifestv1beta7.RenderEnvironment{
+					CLIVersion:           mdl.S("1.2.3"),
+					OS:                   mdl.S("linux"),
+					Arch:                 mdl.S("amd64"),
+					RenderDurationMillis: model.Int{Val: 1500},
+				},
 			},
-			wantVersion: "cli.abcxyz.dev/v1beta1",
+			wantVersion: "cli.abcxyz.dev/v1beta7",
 		},
 		{
 			name:        "requireKind_is_empty",
@@ -270,15 +298,15 @@ steps:
     if: 'true'
     params:
       paths: ['.']`,
-			want: &specv1beta6.Spec{
+			want: &specv1beta7.Spec{
 				Desc: mdl.S("mydesc"),
-				Steps: []*specv1beta6.Step{
+				Steps: []*specv1beta7.Step{
 					{
 						Action: mdl.S("include"),
 						If:     mdl.S("true"),
 						Desc:   mdl.S("include all files"),
-						Include: &specv1beta6.Include{
-							Paths: []*specv1beta6.IncludePath{
+						Include: &specv1beta7.Include{
+							Paths: []*specv1beta7.IncludePath{
 								{
 									Paths: mdl.Strings("."),
 								},
@@ -297,8 +325,8 @@ kind: 'GoldenTest'
 builtin_vars:
 - name: '_git_tag'
   value: 'foo'`,
-			want: &goldentestv1beta4.Test{
-				BuiltinVars: []*goldentestv1beta4.VarValue{
+			want: &goldentestv1beta7.Test{
+				BuiltinVars: []*goldentestv1beta7.VarValue{
 					{
 						Name:  mdl.S("_git_tag"),
 						Value: mdl.S("foo"),
@@ -382,19 +410,24 @@ steps:
     desc: 'step desc'
     params:
       paths: ['.']`,
-			want: &specv1beta6.Spec{
+			want: &specv1beta7.Spec{
 				Desc: mdl.S("mydesc"),
 				Features: specfeatures.Features{
-					SkipGlobs:   true,
-					SkipGitVars: true,
-					SkipTime:    true,
+					SkipGlobs:             true,
+					SkipGitVars:           true,
+					SkipTime:              true,
+					SkipFileMetadata:      true,
+					SkipGitignore:         true,
+					SkipGitignorePatterns: true,
+					SkipConditionalPaths:  true,
+					SkipPartials:          true,
 				},
-				Steps: []*specv1beta6.Step{
+				Steps: []*specv1beta7.Step{
 					{
 						Action: mdl.S("include"),
 						Desc:   mdl.S("step desc"),
-						Include: &specv1beta6.Include{
-							Paths: []*specv1beta6.IncludePath{
+						Include: &specv1beta7.Include{
+							Paths: []*specv1beta7.IncludePath{
 								{
 									Paths: mdl.Strings("."),
 								},
@@ -411,8 +444,8 @@ kind: 'GoldenTest'
 inputs:
   - name: 'foo'
     value: 'bar'`,
-			want: &goldentestv1beta4.Test{
-				Inputs: []*goldentestv1beta4.VarValue{
+			want: &goldentestv1beta7.Test{
+				Inputs: []*goldentestv1beta7.VarValue{
 					{
 						Name:  mdl.S("foo"),
 						Value: mdl.S("bar"),
@@ -430,7 +463,7 @@ inputs:
 kind: 'Manifest'
 template_location: 'foo'
 template_dirhash: 'bar'`,
-			want: &manifestv1alpha1.Manifest{
+			want: &manifestv1beta7.Manifest{
 				TemplateLocation: mdl.S("foo"),
 				TemplateDirhash:  mdl.S("bar"),
 			},
@@ -465,18 +498,23 @@ steps:
     desc: 'step desc'
     params:
       paths: ['.']`,
-			want: &specv1beta6.Spec{
+			want: &specv1beta7.Spec{
 				Desc: mdl.S("mydesc"),
 				Features: specfeatures.Features{
-					SkipGlobs:   true,
-					SkipGitVars: true,
-					SkipTime:    true,
+					SkipGlobs:             true,
+					SkipGitVars:           true,
+					SkipTime:              true,
+					SkipFileMetadata:      true,
+					SkipGitignore:         true,
+					SkipGitignorePatterns: true,
+					SkipConditionalPaths:  true,
+					SkipPartials:          true,
 				},
-				Inputs: []*specv1beta6.Input{
+				Inputs: []*specv1beta7.Input{
 					{
 						Name: mdl.S("foo"),
 						Desc: mdl.S("The name parameter"),
-						Rules: []*specv1beta6.Rule{
+						Rules: []*specv1beta7.Rule{
 							{
 								Rule:    mdl.S("size(foo) < 10"),
 								Message: mdl.S("name length must be less than 10"),
@@ -484,12 +522,12 @@ steps:
 						},
 					},
 				},
-				Steps: []*specv1beta6.Step{
+				Steps: []*specv1beta7.Step{
 					{
 						Action: mdl.S("include"),
 						Desc:   mdl.S("step desc"),
-						Include: &specv1beta6.Include{
-							Paths: []*specv1beta6.IncludePath{
+						Include: &specv1beta7.Include{
+							Paths: []*specv1beta7.IncludePath{
 								{
 									Paths: mdl.Strings("."),
 								},
@@ -528,6 +566,63 @@ steps:
 	}
 }
 
+func TestDecodeValidateUpgrade_Warnings(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name         string
+		fileContents string
+		want         []*warnings.Warning
+	}{
+		{
+			name: "old_style_old_api_version",
+			fileContents: `apiVersion: 'cli.abcxyz.dev/v1beta3'
+kind: 'GoldenTest'`,
+			want: []*warnings.Warning{
+				{
+					Code:    warnings.CodeDeprecatedField,
+					Source:  "file.yaml",
+					Message: `the "apiVersion" field is deprecated, please use "api_version" instead`,
+				},
+				{
+					Code:    warnings.CodeOldAPIVersion,
+					Source:  "file.yaml",
+					Message: `api_version "cli.abcxyz.dev/v1beta3" is older than "` + LatestSupportedAPIVersion(true) + `", so some features are turned off, and turning them on will change the template's behavior; see "abc templates migrate-spec"`,
+				},
+			},
+		},
+		{
+			name: "latest_released_api_version",
+			fileContents: `api_version: '` + LatestSupportedAPIVersion(true) + `'
+kind: 'GoldenTest'`,
+		},
+		{
+			name: "manifests_are_written_by_abc_and_not_warned_about",
+			fileContents: `api_version: 'cli.abcxyz.dev/v1alpha1'
+kind: 'Manifest'
+template_location: 'foo'
+template_dirhash: 'bar'`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			warns := &warnings.Collector{}
+			ctx := warnings.WithCollector(context.Background(), warns)
+			if _, _, err := DecodeValidateUpgrade(ctx, strings.NewReader(tc.fileContents), "file.yaml", ""); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(warns.Warnings(), tc.want, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("warnings weren't as expected (-got,+want): %s", diff)
+			}
+		})
+	}
+}
+
 // The list of API versions should not have any entries with the same version
 // string.
 func TestAPIVersions_NoDupes(t *testing.T) {
@@ -588,7 +683,7 @@ func TestLatestSupportedAPIVersion(t *testing.T) {
 		{
 			name:           "not_release_build",
 			isReleaseBuild: false,
-			want:           "cli.abcxyz.dev/v1beta6", // update for creation of a new api_version
+			want:           "cli.abcxyz.dev/v1beta7", // update for creation of a new api_version
 		},
 	}
 
@@ -606,3 +701,56 @@ func TestLatestSupportedAPIVersion(t *testing.T) {
 		})
 	}
 }
+
+func TestModelIs(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		apiVersion string
+		kind       string
+		example    model.ValidatorUpgrader
+		want       bool
+	}{
+		{
+			name:       "same_model",
+			apiVersion: "cli.abcxyz.dev/v1beta7",
+			kind:       KindManifest,
+			example:    &manifestv1beta7.Manifest{},
+			want:       true,
+		},
+		{
+			name:       "older_model",
+			apiVersion: "cli.abcxyz.dev/v1beta6",
+			kind:       KindManifest,
+			example:    &manifestv1beta7.Manifest{},
+			want:       false,
+		},
+		{
+			name:       "unknown_api_version",
+			apiVersion: "cli.abcxyz.dev/nonexistent",
+			kind:       KindManifest,
+			example:    &manifestv1beta7.Manifest{},
+			want:       false,
+		},
+		{
+			name:       "unknown_kind",
+			apiVersion: "cli.abcxyz.dev/v1beta7",
+			kind:       "Nonexistent",
+			example:    &manifestv1beta7.Manifest{},
+			want:       false,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := ModelIs(tc.apiVersion, tc.kind, tc.example); got != tc.want {
+				t.Errorf("ModelIs(%q, %q, %T)=%t, want %t", tc.apiVersion, tc.kind, tc.example, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ExcerptError is an error along with excerpts of the config file that it
+// points at, like:
+//
+//	at line 12 column 13: unknown action "inclde"
+//	spec.yaml:12:13
+//	  11 |   - desc: 'Include the README'
+//	  12 |     action: 'inclde'
+//	     |             ^
+type ExcerptError struct {
+	Err      error
+	Excerpts []string
+}
+
+func (e *ExcerptError) Error() string {
+	return e.Err.Error() + "\n" + strings.Join(e.Excerpts, "\n")
+}
+
+func (e *ExcerptError) Unwrap() error {
+	return e.Err
+}
+
+// WithExcerpt adds excerpts of src, the contents of the config file named
+// filename, to err. Each excerpt shows a line that err points at, with a caret
+// under the column. Where a *PosError wraps another, only the inner one is
+// shown, since it's the more specific; joined errors get one excerpt each.
+// YAML syntax errors, which have a line but no column, get an excerpt without
+// the caret.
+//
+// err is returned unchanged if it doesn't point at a line of src, or if it
+// already has excerpts.
+func WithExcerpt(err error, filename string, src []byte) error {
+	if err == nil || len(src) == 0 {
+		return err
+	}
+	var ee *ExcerptError
+	if errors.As(err, &ee) {
+		return err
+	}
+	var excerpts []string
+	for _, pos := range errorPositions(err) {
+		if excerpt := Excerpt(filename, src, pos); excerpt != "" {
+			excerpts = append(excerpts, excerpt)
+		}
+	}
+	if len(excerpts) == 0 {
+		return err
+	}
+	return &ExcerptError{Err: err, Excerpts: excerpts}
+}
+
+// yamlLineRE matches the errors returned by the YAML parser, like
+// "yaml: line 3: mapping values are not allowed in this context", which don't
+// have a ConfigPos.
+var yamlLineRE = regexp.MustCompile(`yaml: (?:unmarshal errors:\s+)?line (\d+):`)
+
+// errorPositions returns the distinct positions of the innermost *PosErrors in
+// err's tree, in order.
+func errorPositions(err error) []ConfigPos {
+	var out []ConfigPos
+	var walk func(error) bool
+	walk = func(e error) bool {
+		found := false
+		switch u := e.(type) {
+		case interface{ Unwrap() []error }:
+			for _, child := range u.Unwrap() {
+				found = walk(child) || found
+			}
+		case interface{ Unwrap() error }:
+			if child := u.Unwrap(); child != nil {
+				found = walk(child)
+			}
+		}
+		if pe, ok := e.(*PosError); ok && !found {
+			if !slices.Contains(out, pe.Pos) {
+				out = append(out, pe.Pos)
+			}
+			return true
+		}
+		return found
+	}
+	if walk(err) {
+		return out
+	}
+
+	if m := yamlLineRE.FindStringSubmatch(err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[1]) //nolint:errcheck // the regex only matches digits
+		return []ConfigPos{{Line: line}}
+	}
+	return nil
+}
+
+// Excerpt returns the line of src at pos and the line before it, with a caret
+// under pos's column if it has one. It returns "" if pos isn't a line of src.
+func Excerpt(filename string, src []byte, pos ConfigPos) string {
+	lines := strings.Split(string(src), "\n")
+	if pos.Line < 1 || pos.Line > len(lines) {
+		return ""
+	}
+
+	var b strings.Builder
+	if pos.Column > 0 {
+		fmt.Fprintf(&b, "%s:%d:%d\n", filename, pos.Line, pos.Column)
+	} else {
+		fmt.Fprintf(&b, "%s:%d\n", filename, pos.Line)
+	}
+	width := len(strconv.Itoa(pos.Line))
+	for n := max(pos.Line-1, 1); n <= pos.Line; n++ {
+		fmt.Fprintf(&b, "  %*d | %s\n", width, n, strings.TrimRight(lines[n-1], "\r"))
+	}
+	if pos.Column > 0 {
+		fmt.Fprintf(&b, "  %*s | %s^\n", width, "", caretIndent(lines[pos.Line-1], pos.Column))
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// caretIndent returns the whitespace that puts a caret under the given
+// 1-based column of line. Tabs are kept, so the caret lines up however wide
+// the terminal shows them.
+func caretIndent(line string, column int) string {
+	var b strings.Builder
+	i := 1
+	for _, r := range line {
+		if i >= column {
+			break
+		}
+		if r == '\t' {
+			b.WriteRune('\t')
+		} else {
+			b.WriteRune(' ')
+		}
+		i++
+	}
+	for ; i < column; i++ {
+		b.WriteRune(' ')
+	}
+	return b.String()
+}
@@ -0,0 +1,133 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWithExcerpt(t *testing.T) {
+	t.Parallel()
+
+	src := []byte(`steps:
+  - desc: 'Include'
+    action: 'inclde'
+  - desc: 'Print'
+	action: 'print'
+`)
+
+	cases := []struct {
+		name string
+		err  error
+		want string // comparison is exact
+	}{
+		{
+			name: "nil",
+			err:  nil,
+			want: "",
+		},
+		{
+			name: "no_position",
+			err:  fmt.Errorf("something failed"),
+			want: "something failed",
+		},
+		{
+			name: "simple",
+			err:  (&ConfigPos{Line: 3, Column: 13}).Errorf(`unknown action "inclde"`),
+			want: `at line 3 column 13: unknown action "inclde"
+spec.yaml:3:13
+  2 |   - desc: 'Include'
+  3 |     action: 'inclde'
+    |             ^`,
+		},
+		{
+			name: "first_line_and_wrapped",
+			err:  fmt.Errorf("failed reading spec: %w", (&ConfigPos{Line: 1, Column: 1}).Errorf("bad")),
+			want: `failed reading spec: at line 1 column 1: bad
+spec.yaml:1:1
+  1 | steps:
+    | ^`,
+		},
+		{
+			name: "innermost_position_wins",
+			err: (&ConfigPos{Line: 2, Column: 5}).Errorf("step failed: %w",
+				(&ConfigPos{Line: 3, Column: 5}).Errorf("bad action")),
+			want: `at line 2 column 5: step failed: at line 3 column 5: bad action
+spec.yaml:3:5
+  2 |   - desc: 'Include'
+  3 |     action: 'inclde'
+    |     ^`,
+		},
+		{
+			name: "joined_errors_and_tabs",
+			err: errors.Join(
+				(&ConfigPos{Line: 3, Column: 13}).Errorf("first"),
+				(&ConfigPos{Line: 5, Column: 10}).Errorf("second"),
+			),
+			want: "at line 3 column 13: first\n" +
+				"at line 5 column 10: second\n" +
+				"spec.yaml:3:13\n" +
+				"  2 |   - desc: 'Include'\n" +
+				"  3 |     action: 'inclde'\n" +
+				"    |             ^\n" +
+				"spec.yaml:5:10\n" +
+				"  4 |   - desc: 'Print'\n" +
+				"  5 | \taction: 'print'\n" +
+				"    | \t        ^",
+		},
+		{
+			name: "yaml_syntax_error",
+			err:  fmt.Errorf("error parsing file spec.yaml: yaml: line 4: did not find expected key"),
+			want: `error parsing file spec.yaml: yaml: line 4: did not find expected key
+spec.yaml:4
+  3 |     action: 'inclde'
+  4 |   - desc: 'Print'`,
+		},
+		{
+			name: "line_out_of_range",
+			err:  (&ConfigPos{Line: 100, Column: 1}).Errorf("bad"),
+			want: "at line 100 column 1: bad",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := WithExcerpt(tc.err, "spec.yaml", src)
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("error message was not as expected (-got,+want): %s", diff)
+			}
+			if tc.err != nil && !errors.Is(err, tc.err) {
+				t.Errorf("the returned error doesn't wrap the original one")
+			}
+
+			// Adding excerpts twice is a no-op.
+			if again := WithExcerpt(err, "spec.yaml", src); again != err { //nolint:errorlint
+				t.Errorf("WithExcerpt added excerpts twice: %v", again)
+			}
+		})
+	}
+}
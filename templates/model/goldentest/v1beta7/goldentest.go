@@ -0,0 +1,209 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldentest
+
+import (
+	"errors"
+	"path"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/model"
+	"github.com/abcxyz/abc/templates/model/goldentest/features"
+	"github.com/abcxyz/abc/templates/model/header"
+)
+
+// This file parses a YAML file that describes test configs.
+
+// VarValue represents one of the parsed "input" fields from the inputs.yaml file.
+type VarValue struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	Name  model.String `yaml:"name"`
+	Value model.String `yaml:"value"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (i *VarValue) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, i, &i.Pos) //nolint:wrapcheck
+}
+
+func (i *VarValue) Validate() error {
+	return errors.Join(
+		model.NotZeroModel(&i.Pos, i.Name, "name"),
+	)
+}
+
+// Test represents a parsed test.yaml describing test configs.
+type Test struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	Inputs      []*VarValue `yaml:"inputs,omitempty"`
+	BuiltinVars []*VarValue `yaml:"builtin_vars,omitempty"`
+
+	// Expect holds assertions about the render beyond the contents of the
+	// output files. Optional.
+	Expect *Expect `yaml:"expect,omitempty"`
+
+	// Normalize is a list of rewrites applied to the rendered output before
+	// it's compared against (or recorded as) the golden data. This is for
+	// templates whose output legitimately contains values that change from run
+	// to run, like timestamps or absolute paths. Optional.
+	Normalize []*Normalizer `yaml:"normalize,omitempty"`
+
+	// Features configures which features to use depending on goldentest API version.
+	Features features.Features `yaml:"-"`
+}
+
+// Validate implements model.Validator.
+func (t *Test) Validate() error {
+	var expectErr error
+	if t.Expect != nil {
+		expectErr = t.Expect.Validate()
+	}
+	return errors.Join(
+		model.ValidateEach(t.Inputs),
+		expectErr,
+		model.ValidateEach(t.Normalize),
+	)
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (t *Test) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, t, &t.Pos, "api_version", "apiVersion", "kind") //nolint:wrapcheck
+}
+
+// Expect is the "expect" section of a test.yaml, containing assertions that
+// are checked in addition to comparing the output files against the recorded
+// output.
+type Expect struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// StdoutContains is a list of strings that must each appear somewhere in
+	// the output of the template's print actions.
+	StdoutContains []model.String `yaml:"stdout_contains,omitempty"`
+
+	// ErrorContains, if set, makes this a negative test: rendering must fail
+	// with an error whose message contains this string. The output files of a
+	// failed render aren't compared.
+	ErrorContains model.String `yaml:"error_contains,omitempty"`
+
+	// Manifest holds assertions about the manifest that the render creates.
+	Manifest *ManifestExpect `yaml:"manifest,omitempty"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (e *Expect) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, e, &e.Pos) //nolint:wrapcheck
+}
+
+// Validate implements model.Validator.
+func (e *Expect) Validate() error {
+	var merr error
+	if e.ErrorContains.Val != "" && e.Manifest != nil {
+		merr = e.ErrorContains.Pos.Errorf(`"error_contains" can't be used together with "manifest", because a failed render doesn't create a manifest`)
+	}
+	var manifestErr error
+	if e.Manifest != nil {
+		manifestErr = e.Manifest.Validate()
+	}
+	return errors.Join(merr, manifestErr)
+}
+
+// ManifestExpect lists manifest contents that a test expects. Manifest contents
+// that aren't listed aren't checked.
+type ManifestExpect struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// Inputs are input values that must be recorded in the manifest. This
+	// includes inputs that took their default values.
+	Inputs []*VarValue `yaml:"inputs,omitempty"`
+
+	// OutputFiles are paths, relative to the destination directory, that must
+	// be listed as output files in the manifest.
+	OutputFiles []model.String `yaml:"output_files,omitempty"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (m *ManifestExpect) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, m, &m.Pos) //nolint:wrapcheck
+}
+
+// Validate implements model.Validator.
+func (m *ManifestExpect) Validate() error {
+	return errors.Join(
+		model.ValidateEach(m.Inputs),
+	)
+}
+
+// Normalizer replaces every match of a regular expression in the rendered
+// output.
+type Normalizer struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// Regex is the regular expression to search for, in RE2 syntax.
+	Regex model.String `yaml:"regex"`
+
+	// With is the replacement for each match. Capturing groups can be
+	// referenced like $1 or ${name}, as in regexp.Regexp.Expand. May be empty
+	// to delete the matches.
+	With model.String `yaml:"with,omitempty"`
+
+	// Paths are glob patterns, matched against slash-separated paths relative
+	// to the output directory, that limit which files are normalized. The
+	// output of print actions has the path ".abc/stdout". If empty, all files
+	// are normalized.
+	Paths []model.String `yaml:"paths,omitempty"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (n *Normalizer) UnmarshalYAML(node *yaml.Node) error {
+	return model.UnmarshalPlain(node, n, &n.Pos) //nolint:wrapcheck
+}
+
+// Validate implements model.Validator.
+func (n *Normalizer) Validate() error {
+	var merr error
+	if n.Regex.Val != "" {
+		if _, err := regexp.Compile(n.Regex.Val); err != nil {
+			merr = n.Regex.Pos.Errorf("invalid regex %q: %w", n.Regex.Val, err)
+		}
+	}
+	for _, p := range n.Paths {
+		if _, err := path.Match(p.Val, ""); err != nil {
+			merr = errors.Join(merr, p.Pos.Errorf("invalid glob %q: %w", p.Val, err))
+		}
+	}
+	return errors.Join(
+		model.NotZeroModel(&n.Pos, n.Regex, "regex"),
+		merr,
+	)
+}
+
+// This absurdity is a workaround for a bug github.com/go-yaml/yaml/issues/817
+// in the YAML library. We want to inline a Test in a WithHeader when
+// marshaling. But the bug prevents that, because anything that implements
+// Unmarshaler cannot be inlined. As a workaround, we create a new type with the
+// same fields but without the Unmarshal method.
+type (
+	ForMarshaling Test
+	WithHeader    header.With[*ForMarshaling]
+)
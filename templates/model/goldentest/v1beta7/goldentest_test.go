@@ -0,0 +1,204 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldentest
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/model"
+	mdl "github.com/abcxyz/abc/templates/testutil/model"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestTestUnmarshal(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		in      string
+		want    *Test
+		wantErr string
+	}{
+		{
+			name: "simple_test_should_succeed",
+			in: `inputs:
+- name: 'person_name'
+  value: 'iron_man'
+- name: 'dog_name'
+  value: 'iron_dog'`,
+			want: &Test{
+				Inputs: []*VarValue{
+					{
+						Name:  mdl.S("person_name"),
+						Value: mdl.S("iron_man"),
+					},
+					{
+						Name:  mdl.S("dog_name"),
+						Value: mdl.S("iron_dog"),
+					},
+				},
+			},
+		},
+		{
+			name: "no_inputs_should_succeed",
+			in:   "",
+			want: &Test{},
+		},
+		{
+			name: "empty_string_value",
+			in: `inputs:
+- name: 'person_name'
+  value: ''`,
+			want: &Test{
+				Inputs: []*VarValue{
+					{
+						Name:  mdl.S("person_name"),
+						Value: mdl.S(""),
+					},
+				},
+			},
+		},
+		{
+			name: "expect",
+			in: `expect:
+  stdout_contains: ['Hello', 'world']
+  manifest:
+    inputs:
+      - name: 'person_name'
+        value: 'iron_man'
+    output_files: ['a.txt']`,
+			want: &Test{
+				Expect: &Expect{
+					StdoutContains: []model.String{mdl.S("Hello"), mdl.S("world")},
+					Manifest: &ManifestExpect{
+						Inputs: []*VarValue{
+							{
+								Name:  mdl.S("person_name"),
+								Value: mdl.S("iron_man"),
+							},
+						},
+						OutputFiles: []model.String{mdl.S("a.txt")},
+					},
+				},
+			},
+		},
+		{
+			name: "expect_error",
+			in: `expect:
+  error_contains: 'must be a valid email'`,
+			want: &Test{
+				Expect: &Expect{
+					ErrorContains: mdl.S("must be a valid email"),
+				},
+			},
+		},
+		{
+			name: "expect_error_and_manifest_should_fail",
+			in: `expect:
+  error_contains: 'some error'
+  manifest:
+    output_files: ['a.txt']`,
+			wantErr: `"error_contains" can't be used together with "manifest"`,
+		},
+		{
+			name: "expect_manifest_input_without_name_should_fail",
+			in: `expect:
+  manifest:
+    inputs:
+      - value: 'iron_man'`,
+			wantErr: `field "name" is required`,
+		},
+		{
+			name: "unknown_expect_field_should_fail",
+			in: `expect:
+  stderr_contains: ['Hello']`,
+			wantErr: `unknown field name "stderr_contains"`,
+		},
+		{
+			name: "normalize",
+			in: `normalize:
+  - regex: '\d{4}-\d{2}-\d{2}'
+    with: '<DATE>'
+    paths: ['*.json', '.abc/stdout']
+  - regex: 'sha256:[0-9a-f]+'`,
+			want: &Test{
+				Normalize: []*Normalizer{
+					{
+						Regex: mdl.S(`\d{4}-\d{2}-\d{2}`),
+						With:  mdl.S("<DATE>"),
+						Paths: mdl.Strings("*.json", ".abc/stdout"),
+					},
+					{
+						Regex: mdl.S("sha256:[0-9a-f]+"),
+					},
+				},
+			},
+		},
+		{
+			name: "normalize_invalid_regex_should_fail",
+			in: `normalize:
+  - regex: '(unclosed'`,
+			wantErr: `invalid regex "(unclosed"`,
+		},
+		{
+			name: "normalize_invalid_glob_should_fail",
+			in: `normalize:
+  - regex: 'foo'
+    paths: ['[']`,
+			wantErr: `invalid glob "["`,
+		},
+		{
+			name: "normalize_without_regex_should_fail",
+			in: `normalize:
+  - with: 'foo'`,
+			wantErr: `field "regex" is required`,
+		},
+		{
+			name: "unknown_field_should_fail",
+			in: `inputs:
+- name: 'person_name'
+  value: 'iron_man'
+  pet: 'iron_dog'`,
+			wantErr: `at line 4 column 3: unknown field name "pet"; valid choices are [name value]`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			got := &Test{}
+			err := yaml.Unmarshal([]byte(tc.in), got)
+			if err == nil {
+				err = got.Validate()
+			}
+			if err != nil {
+				if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+					t.Fatal(diff)
+				}
+				return
+			}
+
+			opt := cmpopts.IgnoreTypes(&model.ConfigPos{}, model.ConfigPos{})
+			if diff := cmp.Diff(got, tc.want, opt); diff != "" {
+				t.Fatalf("unmarshaling didn't yield expected struct. Diff (-got +want): %s", diff)
+			}
+		})
+	}
+}
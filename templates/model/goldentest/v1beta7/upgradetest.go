@@ -0,0 +1,120 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldentest
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/model"
+)
+
+// This file parses an upgrade_test.yaml file, which describes a golden test of
+// upgrading an existing render of an older template version to the current
+// template version.
+
+// UpgradeTest represents a parsed upgrade_test.yaml describing an upgrade test.
+// The test renders the template as of FromRef, applies Edits to simulate a
+// user's changes, then upgrades to the current version of the template.
+type UpgradeTest struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// FromRef is the git ref (a tag, branch, or commit SHA) of the old
+	// template version to upgrade from. It's resolved in the git repo that
+	// contains the template.
+	FromRef model.String `yaml:"from_ref"`
+
+	// Inputs are the input values used when rendering the old template version.
+	Inputs []*VarValue `yaml:"inputs,omitempty"`
+
+	// UpgradeInputs are values for inputs that were added in the current
+	// template version. Inputs that were already recorded in the manifest by
+	// the old render don't need to be repeated.
+	UpgradeInputs []*VarValue `yaml:"upgrade_inputs,omitempty"`
+
+	// Edits are changes made to the rendered output of the old template
+	// version before upgrading, simulating a user who has modified their
+	// project.
+	Edits []*Edit `yaml:"edits,omitempty"`
+
+	// ExpectConflicts lists the paths, relative to the destination directory,
+	// that are expected to have conflicts after upgrading. If empty, the
+	// upgrade must merge cleanly.
+	ExpectConflicts []model.String `yaml:"expect_conflicts,omitempty"`
+}
+
+// Validate implements model.Validator.
+func (u *UpgradeTest) Validate() error {
+	return errors.Join(
+		model.NotZeroModel(&u.Pos, u.FromRef, "from_ref"),
+		model.ValidateEach(u.Inputs),
+		model.ValidateEach(u.UpgradeInputs),
+		model.ValidateEach(u.Edits),
+	)
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (u *UpgradeTest) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, u, &u.Pos, "api_version", "apiVersion", "kind") //nolint:wrapcheck
+}
+
+// Edit is a single change to a file in the rendered output of the old template
+// version.
+type Edit struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// Path is the file to change, relative to the destination directory.
+	Path model.String `yaml:"path"`
+
+	// Contents replaces the contents of the file, creating it if needed.
+	Contents model.String `yaml:"contents,omitempty"`
+
+	// Delete removes the file. Can't be used together with Contents.
+	Delete model.Bool `yaml:"delete,omitempty"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (e *Edit) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, e, &e.Pos) //nolint:wrapcheck
+}
+
+// Validate implements model.Validator.
+func (e *Edit) Validate() error {
+	var merr error
+	if e.Path.Val != "" {
+		cleaned := filepath.ToSlash(filepath.Clean(e.Path.Val))
+		if filepath.IsAbs(e.Path.Val) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+			merr = e.Path.Pos.Errorf(`the edit path %q must be a relative path inside the destination directory`, e.Path.Val)
+		}
+	}
+	if e.Delete.Val && e.Contents.Val != "" {
+		merr = errors.Join(merr, e.Pos.Errorf(`"contents" can't be used together with "delete"`))
+	}
+	return errors.Join(
+		model.NotZeroModel(&e.Pos, e.Path, "path"),
+		merr,
+	)
+}
+
+// Upgrade implements model.ValidatorUpgrader.
+func (u *UpgradeTest) Upgrade(ctx context.Context) (model.ValidatorUpgrader, error) {
+	return nil, model.ErrLatestVersion
+}
@@ -0,0 +1,145 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package goldentest
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/model"
+	mdl "github.com/abcxyz/abc/templates/testutil/model"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestUpgradeTestUnmarshal(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		in      string
+		want    *UpgradeTest
+		wantErr string
+	}{
+		{
+			name: "full_test_should_succeed",
+			in: `from_ref: 'v1.0.0'
+inputs:
+- name: 'person_name'
+  value: 'iron_man'
+upgrade_inputs:
+- name: 'dog_name'
+  value: 'iron_dog'
+edits:
+- path: 'a.txt'
+  contents: 'my local change'
+- path: 'dir/b.txt'
+  delete: true
+expect_conflicts: ['a.txt']`,
+			want: &UpgradeTest{
+				FromRef: mdl.S("v1.0.0"),
+				Inputs: []*VarValue{
+					{Name: mdl.S("person_name"), Value: mdl.S("iron_man")},
+				},
+				UpgradeInputs: []*VarValue{
+					{Name: mdl.S("dog_name"), Value: mdl.S("iron_dog")},
+				},
+				Edits: []*Edit{
+					{Path: mdl.S("a.txt"), Contents: mdl.S("my local change")},
+					{Path: mdl.S("dir/b.txt"), Delete: model.Bool{Val: true}},
+				},
+				ExpectConflicts: mdl.Strings("a.txt"),
+			},
+		},
+		{
+			name: "minimal_test_should_succeed",
+			in:   `from_ref: 'main'`,
+			want: &UpgradeTest{
+				FromRef: mdl.S("main"),
+			},
+		},
+		{
+			name:    "missing_from_ref_should_fail",
+			in:      `inputs: []`,
+			wantErr: `field "from_ref" is required`,
+		},
+		{
+			name: "edit_without_path_should_fail",
+			in: `from_ref: 'main'
+edits:
+- contents: 'foo'`,
+			wantErr: `field "path" is required`,
+		},
+		{
+			name: "edit_with_contents_and_delete_should_fail",
+			in: `from_ref: 'main'
+edits:
+- path: 'a.txt'
+  contents: 'foo'
+  delete: true`,
+			wantErr: `"contents" can't be used together with "delete"`,
+		},
+		{
+			name: "edit_outside_dest_should_fail",
+			in: `from_ref: 'main'
+edits:
+- path: '../a.txt'
+  delete: true`,
+			wantErr: `must be a relative path inside the destination directory`,
+		},
+		{
+			name: "absolute_edit_path_should_fail",
+			in: `from_ref: 'main'
+edits:
+- path: '/etc/passwd'
+  contents: 'foo'`,
+			wantErr: `must be a relative path inside the destination directory`,
+		},
+		{
+			name: "unknown_field_should_fail",
+			in: `from_ref: 'main'
+to_ref: 'v2'`,
+			wantErr: `unknown field name "to_ref"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			got := &UpgradeTest{}
+			err := yaml.Unmarshal([]byte(tc.in), got)
+			if err == nil {
+				err = got.Validate()
+			}
+			if err != nil {
+				if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+					t.Fatal(diff)
+				}
+				return
+			}
+			if tc.wantErr != "" {
+				t.Fatalf("got no error, but wanted error containing %q", tc.wantErr)
+			}
+
+			opt := cmpopts.IgnoreTypes(&model.ConfigPos{}, model.ConfigPos{})
+			if diff := cmp.Diff(got, tc.want, opt); diff != "" {
+				t.Fatalf("unmarshaling didn't yield expected struct. Diff (-got +want): %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package index contains the model for .abc/index.yaml, which lists every
+// template installation in a git repo.
+package index
+
+import (
+	"errors"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/model"
+	"github.com/abcxyz/abc/templates/model/header"
+)
+
+// Index represents the contents of an index file. The index file lists all
+// the template installations in a git repo, so that they can be found without
+// walking the whole directory tree looking for manifests.
+type Index struct {
+	Pos model.ConfigPos `yaml:"-"`
+
+	// The template installations in this repo, sorted by manifest path.
+	Installations []*Installation `yaml:"installations"`
+}
+
+// This is the same workaround for github.com/go-yaml/yaml/issues/817 as in
+// the manifest model.
+type (
+	ForMarshaling Index
+	WithHeader    header.With[*ForMarshaling]
+)
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (i *Index) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, i, &i.Pos, "api_version", "apiVersion", "kind") //nolint:wrapcheck
+}
+
+// Validate() implements model.Validator.
+func (i *Index) Validate() error {
+	return model.ValidateEach(i.Installations) //nolint:wrapcheck
+}
+
+// Installation is one template installation, summarizing its manifest.
+type Installation struct {
+	Pos model.ConfigPos `yaml:"-"`
+
+	// The path to the manifest file, relative to the directory containing the
+	// .abc directory that contains the index, e.g.
+	// "foo/.abc/manifest_github.com_abcxyz_abc_2024-06-25T11:00:00Z.lock.yaml".
+	ManifestPath model.String `yaml:"manifest_path"`
+
+	// The template_location field of the manifest. May be empty if the
+	// template was installed from a non-canonical location.
+	TemplateLocation model.String `yaml:"template_location"`
+
+	// The template_version field of the manifest.
+	TemplateVersion model.String `yaml:"template_version"`
+
+	// The modification_time field of the manifest; the last time the template
+	// was rendered or upgraded.
+	ModificationTime time.Time `yaml:"modification_time"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (i *Installation) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, i, &i.Pos) //nolint:wrapcheck
+}
+
+// Validate() implements model.Validator.
+func (i *Installation) Validate() error {
+	var pathErr error
+	if common.HasDotDot(i.ManifestPath.Val) || filepath.IsAbs(i.ManifestPath.Val) {
+		pathErr = i.ManifestPath.Pos.Errorf("manifest_path %q must be a relative path without any %q", i.ManifestPath.Val, "..")
+	}
+	return errors.Join(
+		model.NotZeroModel(&i.Pos, i.ManifestPath, "manifest_path"),
+		pathErr,
+	)
+}
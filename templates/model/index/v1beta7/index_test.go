@@ -0,0 +1,141 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/model"
+	mdl "github.com/abcxyz/abc/templates/testutil/model"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestDecode(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name             string
+		in               string
+		want             *Index
+		wantUnmarshalErr string
+		wantValidateErr  string
+	}{
+		{
+			name: "simple_success",
+			in: `
+api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Index'
+installations:
+  - manifest_path: 'foo/.abc/manifest_a.lock.yaml'
+    template_location: 'github.com/abcxyz/abc/t/rest_server'
+    template_version: 'v1.2.3'
+    modification_time: '2024-06-25T11:00:00Z'
+  - manifest_path: '.abc/manifest_nolocation.lock.yaml'
+    template_location: ''
+    template_version: ''
+    modification_time: '2024-06-25T12:00:00Z'
+`,
+			want: &Index{
+				Installations: []*Installation{
+					{
+						ManifestPath:     mdl.S("foo/.abc/manifest_a.lock.yaml"),
+						TemplateLocation: mdl.S("github.com/abcxyz/abc/t/rest_server"),
+						TemplateVersion:  mdl.S("v1.2.3"),
+						ModificationTime: time.Date(2024, time.June, 25, 11, 0, 0, 0, time.UTC),
+					},
+					{
+						ManifestPath:     mdl.S(".abc/manifest_nolocation.lock.yaml"),
+						ModificationTime: time.Date(2024, time.June, 25, 12, 0, 0, 0, time.UTC),
+					},
+				},
+			},
+		},
+		{
+			name: "no_installations",
+			in: `
+api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Index'
+installations: []
+`,
+			want: &Index{Installations: []*Installation{}},
+		},
+		{
+			name: "missing_manifest_path",
+			in: `
+installations:
+  - template_location: 'github.com/abcxyz/abc/t/rest_server'
+`,
+			wantValidateErr: `"manifest_path" is required`,
+		},
+		{
+			name: "dot_dot_manifest_path",
+			in: `
+installations:
+  - manifest_path: '../elsewhere/.abc/manifest.lock.yaml'
+`,
+			wantValidateErr: `must be a relative path without any ".."`,
+		},
+		{
+			name: "absolute_manifest_path",
+			in: `
+installations:
+  - manifest_path: '/elsewhere/.abc/manifest.lock.yaml'
+`,
+			wantValidateErr: `must be a relative path`,
+		},
+		{
+			name:             "unknown_field",
+			in:               `nonexistent_field: 'foo'`,
+			wantUnmarshalErr: `unknown field name "nonexistent_field"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := &Index{}
+			dec := yaml.NewDecoder(strings.NewReader(tc.in))
+			err := dec.Decode(got)
+			if diff := testutil.DiffErrString(err, tc.wantUnmarshalErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			err = got.Validate()
+			if diff := testutil.DiffErrString(err, tc.wantValidateErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			opt := cmpopts.IgnoreTypes(&model.ConfigPos{}, model.ConfigPos{}) // don't force test authors to assert the line and column numbers
+			if diff := cmp.Diff(got, tc.want, opt); diff != "" {
+				t.Errorf("unmarshaling didn't yield expected struct. Diff (-got +want): %s", diff)
+			}
+		})
+	}
+}
@@ -15,9 +15,36 @@
 package manifest
 
 import (
-	manifest "github.com/abcxyz/abc/templates/model/manifest/v1alpha1"
+	"context"
+	"fmt"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/model/decode"
+	manifest "github.com/abcxyz/abc/templates/model/manifest/v1beta7"
 )
 
+// Load reads the manifest at the given path, validating it and upgrading it
+// to the newest manifest model. It also returns the raw file contents.
+func Load(ctx context.Context, fs common.FS, path string) (*manifest.Manifest, []byte, error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open manifest file at %q: %w", path, err)
+	}
+	defer f.Close()
+
+	manifestI, buf, err := decode.DecodeValidateUpgrade(ctx, f, path, decode.KindManifest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading manifest file: %w", err)
+	}
+
+	out, ok := manifestI.(*manifest.Manifest)
+	if !ok {
+		return nil, nil, common.InternalErrorf("manifest file did not decode to *manifest.Manifest")
+	}
+
+	return out, buf, nil
+}
+
 // HashesAsMap transforms the list of OutputHashes into a map of path->hash.
 func HashesAsMap(hs []*manifest.OutputFile) map[string]string {
 	out := make(map[string]string, len(hs))
@@ -16,15 +16,21 @@ package manifest
 
 import (
 	"context"
+	"fmt"
+
+	"github.com/jinzhu/copier"
 
 	"github.com/abcxyz/abc/templates/model"
-	"github.com/abcxyz/pkg/logging"
+	v1beta7 "github.com/abcxyz/abc/templates/model/manifest/v1beta7"
 )
 
 // Upgrade implements model.ValidatorUpgrader.
 func (m *Manifest) Upgrade(ctx context.Context) (model.ValidatorUpgrader, error) {
-	logger := logging.FromContext(ctx).With("logger", "Upgrade")
-	logger.DebugContext(ctx, "finished upgrading manifest model, this is the most recent version")
+	var out v1beta7.Manifest
+
+	if err := copier.Copy(&out, m); err != nil {
+		return nil, fmt.Errorf("internal error: failed upgrading manifest from v1alpha1 to v1beta7: %w", err)
+	}
 
-	return nil, model.ErrLatestVersion
+	return &out, nil
 }
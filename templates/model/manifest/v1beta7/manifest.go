@@ -0,0 +1,415 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/common"
+	"github.com/abcxyz/abc/templates/model"
+	"github.com/abcxyz/abc/templates/model/header"
+)
+
+// Manifest represents the contents of a manifest file. A manifest file is the
+// set of all information that is needed to cleanly upgrade to a new template
+// version in the future.
+type Manifest struct {
+	Pos model.ConfigPos `yaml:"-"`
+
+	// The UTC time when the template was first rendered (it's not touched for
+	// upgrades). Will be marshaled in RFC3339 format, like
+	// "2006-01-02T15:04:05Z". This is only as accurate as the system clock
+	// on the machine where the operation ran.
+	CreationTime time.Time `yaml:"creation_time"`
+
+	// The UTC time when the template was most recently upgraded, or if has
+	// never been upgraded, the time of initial template rendering. Will be
+	// marshaled in RFC3339 format, like "2006-01-02T15:04:05Z". This is only as
+	// accurate as the system clock on the machine where the operation ran.
+	ModificationTime time.Time `yaml:"modification_time"`
+
+	// The canonical template location from which upgraded template versions can
+	// be fetched in the future.
+	TemplateLocation model.String `yaml:"template_location"`
+
+	// How to interpret template_location, e.g. "remote_git" or "local_git".
+	LocationType model.String `yaml:"location_type"`
+
+	// Set when the template is stored in the same git repo as the
+	// destination directory. Upgrades use this to find the template relative
+	// to the repo root and to read other versions of it from the repo's own
+	// history. Only present when location_type is local_git.
+	TemplateRepo *TemplateRepo `yaml:"template_repo,omitempty"`
+
+	// The tag, branch, SHA, or other version information.
+	TemplateVersion model.String `yaml:"template_version"`
+
+	// Either the special string "latest", or the name of a branch to use to
+	// upgrade from in the future. "latest" means the same thing as it does
+	// when passed on the render command line: find the latest semver tag.
+	UpgradeChannel model.String `yaml:"upgrade_channel"`
+
+	// How the upgrade channel was chosen: "flag" if it came from the
+	// --upgrade-channel flag, or "autodetected" if it was derived from the
+	// template version. Absent in manifests written by older CLI versions.
+	UpgradeChannelSource model.String `yaml:"upgrade_channel_source,omitempty"`
+
+	// The upgrade channel that the manifest had before "abc pin" set
+	// upgrade_channel to the installed template_version, so that "abc unpin"
+	// can restore it. Absent if the manifest isn't pinned.
+	PinnedUpgradeChannel model.String `yaml:"pinned_upgrade_channel,omitempty"`
+
+	// How "abc upgrade" names the files it creates for merge conflicts:
+	// "keep_extension" puts the conflict marker before the file extension, like
+	// main.abcmerge_from_new_template.go, so tools still recognize the file
+	// type, and "suffix" appends it, like main.go.abcmerge_from_new_template.
+	// Absent in manifests written by older CLI versions, which means "suffix".
+	ConflictFileNames model.String `yaml:"conflict_file_names,omitempty"`
+
+	// The dirhash (https://pkg.go.dev/golang.org/x/mod/sumdb/dirhash) of the
+	// template source tree (not the output). This shows exactly what version of
+	// the template was installed.
+	TemplateDirhash model.String `yaml:"template_dirhash"`
+
+	// The input values that were supplied by the user when rendering the template.
+	Inputs []*Input `yaml:"inputs"`
+
+	// The --input-file files that supplied input values, so that an upgrade can
+	// tell whether they've changed since, and re-read them if asked. Absent if
+	// no input files were used, and in manifests written by older CLI
+	// versions.
+	InputFiles []*InputFile `yaml:"input_files,omitempty"`
+
+	// The hash of each output file created by the template.
+	OutputFiles []*OutputFile `yaml:"output_files"`
+
+	// The directory where the render that created this manifest backed up the
+	// preexisting files that it overwrote, so they can be found and restored.
+	// It's relative to the backup root (~/.abc/backups by default) of the
+	// machine that did the render, and uses forward slashes. Absent if nothing
+	// was backed up.
+	BackupDir *model.String `yaml:"backup_dir,omitempty"`
+
+	// Information about the machine and CLI that most recently rendered or
+	// upgraded the template. Absent for reproducible renders, since it varies
+	// from machine to machine, and in manifests written by older CLI versions.
+	RenderEnvironment *RenderEnvironment `yaml:"render_environment,omitempty"`
+
+	// Set if the template declared itself deprecated as of the most recent
+	// render or upgrade. Absent otherwise.
+	Deprecated *Deprecated `yaml:"deprecated,omitempty"`
+
+	// The values of the outputs declared by the template, as of the most
+	// recent render or upgrade. Absent if the template declares no outputs.
+	Outputs []*Output `yaml:"outputs,omitempty"`
+
+	// The sources that "include" actions with "from: remote" downloaded files
+	// from, and the exact versions they resolved to. Absent if there were no
+	// such includes.
+	RemoteIncludes []*RemoteInclude `yaml:"remote_includes,omitempty"`
+}
+
+// This absurdity is a workaround for a bug github.com/go-yaml/yaml/issues/817
+// in the YAML library. We want to inline a Manifest in a WithHeader when
+// marshaling. But the bug prevents that, because anything that implements
+// Unmarshaler cannot be inlined. As a workaround, we create a new type with the
+// same fields but without the Unmarshal method.
+type (
+	ForMarshaling Manifest
+	WithHeader    header.With[*ForMarshaling]
+)
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (m *Manifest) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, m, &m.Pos, "api_version", "apiVersion", "kind") //nolint:wrapcheck
+}
+
+// Validate() implements model.Validator.
+func (m *Manifest) Validate() error {
+	// Inputs and OutputHashes can legally be empty, since a template doesn't
+	// necessarily have these.
+
+	var channelSourceErr error
+	if m.UpgradeChannelSource.Val != "" {
+		channelSourceErr = model.OneOf(&m.Pos, m.UpgradeChannelSource,
+			[]string{UpgradeChannelSourceFlag, UpgradeChannelSourceAutodetected}, "upgrade_channel_source")
+	}
+
+	var conflictFileNamesErr error
+	if m.ConflictFileNames.Val != "" {
+		conflictFileNamesErr = model.OneOf(&m.Pos, m.ConflictFileNames, ConflictFileNamesValues, "conflict_file_names")
+	}
+
+	return errors.Join(
+		model.NotZeroModel(&m.Pos, m.TemplateDirhash, "template_dirhash"),
+		model.ValidateEach(m.Inputs),
+		model.ValidateEach(m.InputFiles),
+		model.ValidateEach(m.OutputFiles),
+		model.ValidateEach(m.Outputs),
+		model.ValidateEach(m.RemoteIncludes),
+		model.ValidateUnlessNil(m.TemplateRepo),
+		channelSourceErr,
+		conflictFileNamesErr,
+	)
+}
+
+// Input is a YAML object representing an input value that was provided to the
+// template when it was rendered.
+type Input struct {
+	Pos model.ConfigPos `yaml:"-"`
+
+	// The name of the template input, e.g. "my_service_account"
+	Name model.String `yaml:"name"`
+	// The value of the template input, e.g. "foo@iam.gserviceaccount.com".
+	Value model.String `yaml:"value"`
+
+	// Where the value came from: one of "flag", "input_file", "manifest",
+	// "prompt", or "default". Absent if unknown.
+	Source model.String `yaml:"source,omitempty"`
+
+	// The --input-file that the value came from, if Source is "input_file".
+	SourceFile model.String `yaml:"source_file,omitempty"`
+}
+
+// Output is a YAML object representing the value of one of the outputs
+// declared by the template.
+type Output struct {
+	Pos model.ConfigPos `yaml:"-"`
+
+	// The name of the output, e.g. "service_url".
+	Name model.String `yaml:"name"`
+	// The value of the output, e.g. "https://my-service.run.app".
+	Value model.String `yaml:"value"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (o *Output) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, o, &o.Pos) //nolint:wrapcheck
+}
+
+// Validate() implements model.Validator.
+func (o *Output) Validate() error {
+	return model.NotZeroModel(&o.Pos, o.Name, "name")
+}
+
+// RemoteInclude is a YAML object representing a source that an include with
+// "from: remote" downloaded files from.
+type RemoteInclude struct {
+	Pos model.ConfigPos `yaml:"-"`
+
+	// The source as given in the spec, after template expressions were
+	// evaluated, e.g. "github.com/myorg/shared@latest".
+	Source model.String `yaml:"source"`
+
+	// The canonical location of the source, if it has one.
+	Location model.String `yaml:"location,omitempty"`
+
+	// The tag, branch, SHA, or other version information that the source
+	// resolved to, e.g. "v1.2.3" for "@latest".
+	Version model.String `yaml:"version,omitempty"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (r *RemoteInclude) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, r, &r.Pos) //nolint:wrapcheck
+}
+
+// Validate() implements model.Validator.
+func (r *RemoteInclude) Validate() error {
+	return model.NotZeroModel(&r.Pos, r.Source, "source")
+}
+
+// TemplateRepo is a YAML object recording where a template lives inside the
+// git repo that it was rendered into.
+type TemplateRepo struct {
+	Pos model.ConfigPos `yaml:"-"`
+
+	// The slash-separated path of the template directory relative to the
+	// root of the repo, e.g. "templates/my-service".
+	Path model.String `yaml:"path"`
+
+	// The URL of the repo's "origin" remote, if it had one.
+	RemoteURL model.String `yaml:"remote_url,omitempty"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (t *TemplateRepo) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, t, &t.Pos) //nolint:wrapcheck
+}
+
+// Validate() implements model.Validator.
+func (t *TemplateRepo) Validate() error {
+	return model.NotZeroModel(&t.Pos, t.Path, "path")
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (i *Input) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, i, &i.Pos) //nolint:wrapcheck
+}
+
+// Validate() implements model.Validator.
+func (i *Input) Validate() error {
+	var sourceErr error
+	if i.Source.Val != "" {
+		sourceErr = model.OneOf(&i.Pos, i.Source, InputSources, "source")
+	}
+	return errors.Join(
+		model.NotZeroModel(&i.Pos, i.Name, "name"),
+		sourceErr,
+	)
+}
+
+// The possible values of Input.Source.
+type InputFile struct {
+	Pos model.ConfigPos `yaml:"-"`
+
+	// The path of the input file relative to the directory where the template
+	// was rendered (the parent of the .abc directory), with forward slashes.
+	// May begin with "../" if the file is outside that directory.
+	Path model.String `yaml:"path"`
+
+	// The dirhash-style hash of the file's contents when it was read, like
+	// "h1:0a1b2c3d...".
+	Hash model.String `yaml:"hash"`
+}
+
+func (f *InputFile) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, f, &f.Pos) //nolint:wrapcheck
+}
+
+func (f *InputFile) Validate() error {
+	return errors.Join(
+		model.NotZeroModel(&f.Pos, f.Path, "path"),
+		model.NotZeroModel(&f.Pos, f.Hash, "hash"),
+	)
+}
+
+const (
+	InputSourceFlag      = "flag"
+	InputSourceInputFile = "input_file"
+	InputSourceManifest  = "manifest"
+	InputSourcePrompt    = "prompt"
+	InputSourceDefault   = "default"
+)
+
+// InputSources are all the valid values of Input.Source.
+var InputSources = []string{InputSourceFlag, InputSourceInputFile, InputSourceManifest, InputSourcePrompt, InputSourceDefault}
+
+// The possible values of Manifest.UpgradeChannelSource.
+const (
+	UpgradeChannelSourceFlag         = "flag"
+	UpgradeChannelSourceAutodetected = "autodetected"
+)
+
+// The possible values of Manifest.ConflictFileNames.
+const (
+	ConflictFileNamesKeepExtension = "keep_extension"
+	ConflictFileNamesSuffix        = "suffix"
+)
+
+// ConflictFileNamesValues are all the valid values of
+// Manifest.ConflictFileNames.
+var ConflictFileNamesValues = []string{ConflictFileNamesKeepExtension, ConflictFileNamesSuffix}
+
+// RenderEnvironment records where and how a render happened, for debugging
+// and auditing. It's informational only, and isn't used by upgrades.
+type RenderEnvironment struct {
+	Pos model.ConfigPos `yaml:"-"`
+
+	// The version of the abc CLI, e.g. "0.9.0".
+	CLIVersion model.String `yaml:"cli_version"`
+
+	// The operating system and CPU architecture, in Go's GOOS and GOARCH
+	// format, e.g. "linux" and "amd64".
+	OS   model.String `yaml:"os"`
+	Arch model.String `yaml:"arch"`
+
+	// How long the render took, in milliseconds, from the start of the
+	// render until the manifest was written.
+	RenderDurationMillis model.Int `yaml:"render_duration_ms"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (e *RenderEnvironment) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, e, &e.Pos) //nolint:wrapcheck
+}
+
+// Deprecated is copied from the "deprecated" field of the template's spec.
+type Deprecated struct {
+	Pos model.ConfigPos `yaml:"-"`
+
+	// The template author's explanation of the deprecation.
+	Message model.String `yaml:"message"`
+
+	// The location of the template that replaces this one. Absent if the
+	// author didn't name a replacement.
+	ReplacedBy *model.String `yaml:"replaced_by,omitempty"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (d *Deprecated) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, d, &d.Pos) //nolint:wrapcheck
+}
+
+// OutputFile records a checksum of a single file as it was created during
+// template rendering.
+type OutputFile struct {
+	Pos model.ConfigPos `yaml:"-"`
+
+	// The path, relative to the destination directory, of this file.
+	File model.String `yaml:"file"`
+
+	// The dirhash-style hash (see https://pkg.go.dev/golang.org/x/mod/sumdb/dirhash)
+	// of this file. The format looks like "h1:0a1b2c3d...".
+	Hash model.String `yaml:"hash"`
+
+	// In the (somewhat rare) case where this file is a modified version of one
+	// of the user's preexisting files using the "include from destination"
+	// feature, then we save a patch here that is the inverse of our change.
+	// This allows our change to be un-done in the future.
+	Patch *model.String `yaml:"patch,omitempty"`
+
+	// If this file was included from the destination under a different name
+	// (using "as"), this is the path, relative to the destination directory,
+	// of the file it was included from. Reversing Patch recreates that file.
+	IncludedFrom *model.String `yaml:"included_from,omitempty"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (f *OutputFile) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, f, &f.Pos) //nolint:wrapcheck
+}
+
+// Validate() implements model.Validator.
+func (f *OutputFile) Validate() error {
+	var merr error
+	if common.HasDotDot(f.File.Val) {
+		err := fmt.Errorf(`manifest output file %q had a disallowed ".." path token`, f.File.Val)
+		merr = errors.Join(merr, err)
+	}
+	if f.IncludedFrom != nil && common.HasDotDot(f.IncludedFrom.Val) {
+		err := fmt.Errorf(`manifest output file %q had a disallowed ".." path token in included_from %q`, f.File.Val, f.IncludedFrom.Val)
+		merr = errors.Join(merr, err)
+	}
+	return errors.Join(
+		merr,
+		model.NotZeroModel(&f.Pos, f.File, "file"),
+		model.NotZeroModel(&f.Pos, f.Hash, "hash"),
+	)
+}
@@ -0,0 +1,75 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package policy contains the model for policy files, which hold rules that
+// the output of a render must obey before it's written to the destination.
+package policy
+
+import (
+	"errors"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/model"
+)
+
+// Policy represents the contents of a policy file. Policy files are written by
+// the organization that runs abc rather than by template authors, and apply to
+// every template rendered with them.
+type Policy struct {
+	Pos model.ConfigPos `yaml:"-"`
+
+	// An optional description of the policy as a whole.
+	Desc model.String `yaml:"desc"`
+
+	// The rules that every output file must obey.
+	Rules []*Rule `yaml:"rules"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (p *Policy) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, p, &p.Pos, "api_version", "apiVersion", "kind") //nolint:wrapcheck
+}
+
+// Validate() implements model.Validator.
+func (p *Policy) Validate() error {
+	return errors.Join(
+		model.NonEmptySlice(&p.Pos, p.Rules, "rules"),
+		model.ValidateEach(p.Rules),
+	)
+}
+
+// Rule is a CEL expression that's evaluated once for each output file, with
+// the variables "path" (the file's path relative to the destination
+// directory, with forward slashes) and "contents". A file violates the rule if
+// the expression is false.
+type Rule struct {
+	Pos model.ConfigPos `yaml:"-"`
+
+	// The CEL expression, e.g. 'path.startsWith("src/")'.
+	Rule model.String `yaml:"rule"`
+
+	// An optional explanation of the rule, shown along with violations.
+	Message model.String `yaml:"message"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (r *Rule) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, r, &r.Pos) //nolint:wrapcheck
+}
+
+// Validate() implements model.Validator.
+func (r *Rule) Validate() error {
+	return model.NotZeroModel(&r.Pos, r.Rule, "rule") //nolint:wrapcheck
+}
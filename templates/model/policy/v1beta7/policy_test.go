@@ -0,0 +1,114 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/model"
+	mdl "github.com/abcxyz/abc/templates/testutil/model"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestDecode(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name             string
+		in               string
+		want             *Policy
+		wantUnmarshalErr string
+		wantValidateErr  string
+	}{
+		{
+			name: "simple_success",
+			in: `
+api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Policy'
+desc: 'Platform team rules'
+rules:
+  - rule: 'path.startsWith("src/") || path.startsWith("infra/")'
+    message: 'Files may only be written under src/ and infra/'
+  - rule: '!path.endsWith(".tf") || !contents.contains("?ref=main")'
+`,
+			want: &Policy{
+				Desc: mdl.S("Platform team rules"),
+				Rules: []*Rule{
+					{
+						Rule:    mdl.S(`path.startsWith("src/") || path.startsWith("infra/")`),
+						Message: mdl.S("Files may only be written under src/ and infra/"),
+					},
+					{
+						Rule: mdl.S(`!path.endsWith(".tf") || !contents.contains("?ref=main")`),
+					},
+				},
+			},
+		},
+		{
+			name:            "no_rules",
+			in:              `desc: 'nothing'`,
+			wantValidateErr: `field "rules" is required`,
+		},
+		{
+			name: "missing_rule",
+			in: `
+rules:
+  - message: 'a message without a rule'
+`,
+			wantValidateErr: `"rule" is required`,
+		},
+		{
+			name:             "unknown_field",
+			in:               `nonexistent_field: 'foo'`,
+			wantUnmarshalErr: `unknown field name "nonexistent_field"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := &Policy{}
+			dec := yaml.NewDecoder(strings.NewReader(tc.in))
+			err := dec.Decode(got)
+			if diff := testutil.DiffErrString(err, tc.wantUnmarshalErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			err = got.Validate()
+			if diff := testutil.DiffErrString(err, tc.wantValidateErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			opt := cmpopts.IgnoreTypes(&model.ConfigPos{}, model.ConfigPos{}) // don't force test authors to assert the line and column numbers
+			if diff := cmp.Diff(got, tc.want, opt); diff != "" {
+				t.Errorf("unmarshaling didn't yield expected struct. Diff (-got +want): %s", diff)
+			}
+		})
+	}
+}
@@ -53,11 +53,28 @@ func YAMLPos(n *yaml.Node) *ConfigPos {
 //	Wrapping an error: c.Errorf("foo(): %w", err)
 //
 //	Creating an error: c.Errorf("something went wrong doing action %s", action)
+//
+// When the position is known, the returned error is a *PosError, so that
+// WithExcerpt can later show the part of the file that it points at.
 func (c *ConfigPos) Errorf(fmtStr string, args ...any) error {
 	err := fmt.Errorf(fmtStr, args...)
 	if c == nil || c.IsZero() {
 		return err
 	}
 
-	return fmt.Errorf("at line %d column %d: %w", c.Line, c.Column, err)
+	return &PosError{Pos: *c, Err: err}
+}
+
+// PosError is an error at a known position in a config file.
+type PosError struct {
+	Pos ConfigPos
+	Err error
+}
+
+func (e *PosError) Error() string {
+	return fmt.Sprintf("at line %d column %d: %v", e.Pos.Line, e.Pos.Column, e.Err)
+}
+
+func (e *PosError) Unwrap() error {
+	return e.Err
 }
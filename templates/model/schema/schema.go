@@ -0,0 +1,311 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package schema generates JSON Schemas for abc's YAML files from the model
+// structs, so that editors and CI can validate those files without running
+// abc.
+package schema
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/model/decode"
+)
+
+// Draft is the JSON Schema dialect of the generated schemas.
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is a JSON Schema, ready to be marshaled as JSON.
+type Schema = map[string]any
+
+// Generate returns a JSON Schema for YAML files of the given kind (like
+// decode.KindTemplate). If apiVersion is empty, the schema covers every
+// api_version supported by this build, and validates each file against the
+// model of its own api_version. Otherwise, it only covers that api_version.
+//
+// The schema checks the shape of a file: its fields and their types. Some
+// rules, like which fields are required together, are only checked by abc
+// itself when the file is loaded.
+func Generate(kind, apiVersion string, isReleaseBuild bool) (Schema, error) {
+	models := decode.Models(kind, isReleaseBuild)
+	if len(models) == 0 {
+		return nil, fmt.Errorf("unknown kind %q", kind)
+	}
+	if apiVersion != "" {
+		var found []*decode.APIVersionModel
+		for _, m := range models {
+			if m.APIVersion == apiVersion {
+				found = append(found, m)
+			}
+		}
+		if len(found) == 0 {
+			return nil, fmt.Errorf("api_version %q doesn't exist or has no kind %q", apiVersion, kind)
+		}
+		models = found
+	}
+
+	g := &generator{defs: Schema{}}
+	out := Schema{
+		"$schema": Draft,
+		"title":   fmt.Sprintf("abc %s file", kind),
+	}
+
+	var versions []string
+	var branches []any
+	for _, m := range models {
+		name := path.Base(m.APIVersion) + "." + kind
+		g.defs[name] = Schema{
+			"$ref": g.rootRef(reflect.TypeOf(m.Model)),
+			"properties": Schema{
+				"api_version": Schema{"const": m.APIVersion},
+				"apiVersion":  Schema{"const": m.APIVersion},
+				"kind":        Schema{"const": kind},
+			},
+		}
+		versions = append(versions, m.APIVersion)
+		branches = append(branches, Schema{
+			"if": Schema{"anyOf": []any{
+				Schema{"properties": Schema{"api_version": Schema{"const": m.APIVersion}}, "required": []string{"api_version"}},
+				Schema{"properties": Schema{"apiVersion": Schema{"const": m.APIVersion}}, "required": []string{"apiVersion"}},
+			}},
+			"then": Schema{"$ref": "#/$defs/" + name},
+		})
+	}
+
+	out["type"] = "object"
+	out["required"] = []string{"kind"}
+	out["properties"] = Schema{
+		"api_version": Schema{"enum": versions},
+		"apiVersion":  Schema{"enum": versions},
+	}
+	// The api_version field was once named apiVersion, so either is accepted.
+	out["anyOf"] = []any{
+		Schema{"required": []string{"api_version"}},
+		Schema{"required": []string{"apiVersion"}},
+	}
+	out["allOf"] = branches
+	out["$defs"] = g.defs
+	return out, nil
+}
+
+// generator builds the $defs of a schema, one per Go struct type.
+type generator struct {
+	defs Schema
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	yamlNodeType  = reflect.TypeOf(yaml.Node{})
+	unmarshalType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+)
+
+// rootRef is like ref, for the top-level type of a file, which also has the
+// api_version and kind fields.
+func (g *generator) rootRef(t reflect.Type) string {
+	t = deref(t)
+	name := defName(t)
+	if _, ok := g.defs[name]; !ok {
+		g.defs[name] = nil // Guards against recursion.
+		g.defs[name] = g.structSchema(t, "api_version", "apiVersion", "kind")
+	}
+	return "#/$defs/" + name
+}
+
+// ref returns a $ref to the definition of the struct type t, adding the
+// definition if it's not there yet.
+func (g *generator) ref(t reflect.Type) Schema {
+	name := defName(t)
+	if _, ok := g.defs[name]; !ok {
+		g.defs[name] = nil // Guards against recursion.
+		g.defs[name] = g.structSchema(t)
+	}
+	return Schema{"$ref": "#/$defs/" + name}
+}
+
+// schemaFor returns the schema for a value of type t.
+func (g *generator) schemaFor(t reflect.Type) Schema {
+	t = deref(t)
+	switch {
+	case isValWithPos(t):
+		valField, _ := t.FieldByName("Val")
+		return g.schemaFor(valField.Type)
+	case t == timeType:
+		return Schema{"type": "string", "format": "date-time"}
+	case t == yamlNodeType:
+		return Schema{}
+	}
+
+	switch t.Kind() { //nolint:exhaustive
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return Schema{"type": "array", "items": g.schemaFor(t.Elem())}
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": g.schemaFor(t.Elem())}
+	case reflect.Struct:
+		return g.ref(t)
+	default:
+		return Schema{}
+	}
+}
+
+// structSchema returns the schema of an object that's decoded into the struct
+// type t. extraFields are the names of fields that are accepted in addition
+// to the struct's own, and can have any string value.
+//
+// Besides the fields of the struct, two patterns in the model are understood:
+//
+//   - A struct with an "action" field, and an untagged pointer-to-struct field
+//     per action (like a spec's Step), has a "params" field whose shape
+//     depends on the action. The action names are the snake_case field names.
+//   - A struct whose only field is a list of another struct with a field of
+//     the same name (like Include and IncludePath) can also be written as a
+//     single one of those list elements.
+func (g *generator) structSchema(t reflect.Type, extraFields ...string) Schema {
+	props := Schema{}
+	for _, name := range extraFields {
+		props[name] = Schema{"type": "string"}
+	}
+
+	// Types with their own UnmarshalYAML use model.UnmarshalPlain, which
+	// rejects unknown fields. Plain yaml decoding ignores them.
+	strict := reflect.PointerTo(t).Implements(unmarshalType)
+
+	var keys []string
+	var actionFields []reflect.StructField
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() {
+			continue
+		}
+		key, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if key == "-" {
+			if deref(f.Type).Kind() == reflect.Struct && f.Type.Kind() == reflect.Pointer {
+				actionFields = append(actionFields, f)
+			}
+			continue
+		}
+		if key == "" {
+			if strict || f.Anonymous {
+				continue
+			}
+			key = strings.ToLower(f.Name)
+		}
+		keys = append(keys, key)
+		props[key] = g.schemaFor(f.Type)
+	}
+
+	out := Schema{"type": "object", "properties": props}
+	if strict {
+		out["additionalProperties"] = false
+	}
+
+	if _, ok := props["action"]; ok && len(actionFields) > 0 {
+		var actions []string
+		var branches []any
+		for _, f := range actionFields {
+			action := snakeCase(f.Name)
+			actions = append(actions, action)
+			branches = append(branches, Schema{
+				"if":   Schema{"properties": Schema{"action": Schema{"const": action}}, "required": []string{"action"}},
+				"then": Schema{"properties": Schema{"params": g.schemaFor(f.Type)}},
+			})
+		}
+		sort.Strings(actions)
+		props["action"] = Schema{"type": "string", "enum": actions}
+		props["params"] = Schema{"type": "object"}
+		out["allOf"] = branches
+	}
+
+	if len(keys) == 1 && len(extraFields) == 0 {
+		field, _ := fieldForKey(t, keys[0])
+		if field.Type.Kind() == reflect.Slice {
+			if elem := deref(field.Type.Elem()); elem.Kind() == reflect.Struct && elem != t {
+				if _, ok := fieldForKey(elem, keys[0]); ok {
+					return Schema{"anyOf": []any{out, g.ref(elem)}}
+				}
+			}
+		}
+	}
+	return out
+}
+
+// fieldForKey returns the field of struct t that's decoded from the given YAML
+// key, if any.
+func fieldForKey(t reflect.Type, key string) (reflect.StructField, bool) {
+	for _, f := range reflect.VisibleFields(t) {
+		if k, _, _ := strings.Cut(f.Tag.Get("yaml"), ","); k == key {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// defName returns the $defs key for struct type t, based on its package path
+// within the model, like "spec.v1beta7.Step".
+func defName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	if _, after, ok := strings.Cut(pkg, "/templates/model/"); ok {
+		pkg = after
+	} else {
+		pkg = path.Base(pkg)
+	}
+	return strings.ReplaceAll(pkg, "/", ".") + "." + t.Name()
+}
+
+// isValWithPos returns whether t is one of the model's boxed primitives, like
+// model.String, which are written in YAML as their Val.
+func isValWithPos(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && strings.HasPrefix(t.Name(), "valWithPos[")
+}
+
+func deref(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+// snakeCase converts a Go field name like RegexNameLookup to regex_name_lookup.
+// Initialisms stay together, so HCLModify becomes hcl_modify.
+func snakeCase(s string) string {
+	runes := []rune(s)
+	var sb strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// A word starts at an uppercase letter that follows a lowercase
+			// one, or that's the last letter of an initialism.
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				sb.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
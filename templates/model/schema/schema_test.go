@@ -0,0 +1,166 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/abc/templates/model/decode"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestGenerate(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		kind       string
+		apiVersion string
+		// Each is a path of keys into the schema, separated by spaces, and the
+		// JSON that's expected there.
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name:       "spec_step_params_depend_on_action",
+			kind:       decode.KindTemplate,
+			apiVersion: "cli.abcxyz.dev/v1beta7",
+			want: map[string]string{
+				"$defs v1beta7.Template properties kind":                 `{"const":"Template"}`,
+				"$defs spec.v1beta7.Step properties action enum":         `["append","buf_generate","for_each","go_mod_edit","go_template","hcl_modify","include","license_header","print","regex_name_lookup","regex_replace","string_replace","wasm"]`,
+				"$defs spec.v1beta7.Step allOf 2 then properties params": `{"$ref":"#/$defs/spec.v1beta7.ForEach"}`,
+				"$defs spec.v1beta7.Step additionalProperties":           `false`,
+				"$defs spec.v1beta7.Spec properties file_metadata":       `{"type":"string"}`,
+				"$defs spec.v1beta7.Include anyOf 1":                     `{"$ref":"#/$defs/spec.v1beta7.IncludePath"}`,
+				"$defs spec.v1beta7.ForEach properties steps items":      `{"$ref":"#/$defs/spec.v1beta7.Step"}`,
+				"$defs spec.v1beta7.StringReplace properties paths":      `{"items":{"type":"string"},"type":"array"}`,
+				"$defs spec.v1beta7.Input properties rules items $ref":   `"#/$defs/spec.v1beta7.Rule"`,
+				"properties api_version enum":                            `["cli.abcxyz.dev/v1beta7"]`,
+				"allOf 0 then":                                           `{"$ref":"#/$defs/v1beta7.Template"}`,
+			},
+		},
+		{
+			name: "every_api_version",
+			kind: decode.KindManifest,
+			want: map[string]string{
+				"properties api_version enum":                              `["cli.abcxyz.dev/v1alpha1","cli.abcxyz.dev/v1beta1","cli.abcxyz.dev/v1beta2","cli.abcxyz.dev/v1beta3","cli.abcxyz.dev/v1beta4","cli.abcxyz.dev/v1beta5","cli.abcxyz.dev/v1beta6","cli.abcxyz.dev/v1beta7"]`,
+				"$defs v1beta5.Manifest $ref":                              `"#/$defs/manifest.v1alpha1.Manifest"`,
+				"$defs v1beta7.Manifest $ref":                              `"#/$defs/manifest.v1beta7.Manifest"`,
+				"$defs manifest.v1beta7.Manifest properties creation_time": `{"format":"date-time","type":"string"}`,
+			},
+		},
+		{
+			name:    "unknown_kind",
+			kind:    "Nonexistent",
+			wantErr: `unknown kind "Nonexistent"`,
+		},
+		{
+			name:       "api_version_without_kind",
+			kind:       decode.KindStack,
+			apiVersion: "cli.abcxyz.dev/v1beta1",
+			wantErr:    `api_version "cli.abcxyz.dev/v1beta1" doesn't exist or has no kind "Stack"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := Generate(tc.kind, tc.apiVersion, false)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			// Round trip through JSON, so the schema can be navigated with
+			// generic types.
+			buf, err := json.Marshal(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var tree any
+			if err := json.Unmarshal(buf, &tree); err != nil {
+				t.Fatal(err)
+			}
+
+			for path, want := range tc.want {
+				node := tree
+				for _, key := range strings.Fields(path) {
+					switch n := node.(type) {
+					case map[string]any:
+						node = n[key]
+					case []any:
+						var i int
+						if err := json.Unmarshal([]byte(key), &i); err != nil || i >= len(n) {
+							t.Fatalf("at %q: bad list index %q", path, key)
+						}
+						node = n[i]
+					default:
+						t.Fatalf("at %q: can't find %q in %v", path, key, node)
+					}
+				}
+				gotJSON, err := json.Marshal(node)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(string(gotJSON), want); diff != "" {
+					t.Errorf("at %q, the schema was not as expected (-got,+want): %s", path, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerate_AllKinds(t *testing.T) {
+	t.Parallel()
+
+	for _, kind := range []string{
+		decode.KindTemplate, decode.KindGoldenTest, decode.KindManifest, decode.KindUpgradeTest,
+		decode.KindIndex, decode.KindPolicy, decode.KindStack, decode.KindStackOverlay,
+	} {
+		s, err := Generate(kind, "", false)
+		if err != nil {
+			t.Errorf("Generate(%q): %v", kind, err)
+			continue
+		}
+		if _, err := json.Marshal(s); err != nil {
+			t.Errorf("schema for %q can't be marshaled: %v", kind, err)
+		}
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	t.Parallel()
+
+	for in, want := range map[string]string{
+		"Wasm":            "wasm",
+		"ForEach":         "for_each",
+		"RegexNameLookup": "regex_name_lookup",
+		"HCLModify":       "hcl_modify",
+		"SetHCL":          "set_hcl",
+	} {
+		if got := snakeCase(in); got != want {
+			t.Errorf("snakeCase(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -33,4 +33,32 @@ type Features struct {
 	// SkipTime determines whether to support the _now_ms template variable and
 	// the formatTime template function. New in v1beta6.
 	SkipTime bool
+
+	// SkipFileMetadata determines whether to honor the spec's file_metadata
+	// field. New in v1beta7.
+	SkipFileMetadata bool
+
+	// SkipGitignore determines whether an include with "from: destination"
+	// skips the paths that are ignored by the destination's .gitignore files.
+	// New in v1beta7.
+	SkipGitignore bool
+
+	// SkipGitignorePatterns determines whether the spec's ignore patterns are
+	// simple globs that only apply to includes, rather than gitignore-style
+	// patterns (with "!" negation, "**", and trailing "/" for directories)
+	// that also apply to the files that steps modify and the files written to
+	// the destination. New in v1beta7.
+	SkipGitignorePatterns bool
+
+	// SkipConditionalPaths determines whether file and directory names that
+	// contain Go templates, like "{{if .use_docker}}Dockerfile{{end}}", are
+	// rendered when they're included from the template directory. A name that
+	// renders to the empty string means the file isn't included at all. New in
+	// v1beta7.
+	SkipConditionalPaths bool
+
+	// SkipPartials determines whether the files in the template's _partials
+	// directory are available to go_template actions as named templates, and
+	// left out of includes of the template root. New in v1beta7.
+	SkipPartials bool
 }
@@ -16,27 +16,32 @@ package v1beta6
 
 import (
 	"context"
+	"fmt"
+
+	"github.com/jinzhu/copier"
 
 	"github.com/abcxyz/abc/templates/model"
+	v1beta7 "github.com/abcxyz/abc/templates/model/spec/v1beta7"
 	"github.com/abcxyz/pkg/logging"
 )
 
 // Upgrade implements model.ValidatorUpgrader.
 func (s *Spec) Upgrade(ctx context.Context) (model.ValidatorUpgrader, error) {
 	logger := logging.FromContext(ctx).With("logger", "Upgrade")
-	logger.DebugContext(ctx, "finished upgrading spec model, this is the most recent version")
-
-	// Uncomment this when there's a newer api_version.
-	// var out nextversion.Spec
-	// if err := copier.Copy(&out, s); err != nil {
-	// 	return nil, fmt.Errorf("internal error: failed upgrading spec from v1beta2 to v1beta3: %w", err)
-	// }
-	// // If this spec was upgraded from an older api_version, disable the features
-	// // that weren't supported in its declared api_version.
-	// out.Features = s.Features
+	logger.DebugContext(ctx, "upgrading spec model from v1beta6 to v1beta7")
 
-	// out.Features.SkipFoo = true
-	// return &out, nil
+	var out v1beta7.Spec
+	if err := copier.Copy(&out, s); err != nil {
+		return nil, fmt.Errorf("internal error: failed upgrading spec from v1beta6 to v1beta7: %w", err)
+	}
+	// If this spec was upgraded from an older api_version, disable the features
+	// that weren't supported in its declared api_version.
+	out.Features = s.Features
 
-	return nil, model.ErrLatestVersion
+	out.Features.SkipFileMetadata = true
+	out.Features.SkipGitignore = true
+	out.Features.SkipGitignorePatterns = true
+	out.Features.SkipConditionalPaths = true
+	out.Features.SkipPartials = true
+	return &out, nil
 }
@@ -0,0 +1,1449 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//nolint:wrapcheck // We don't want to excessively wrap errors, like "yaml error: yaml error: ..."
+package v1beta7
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"golang.org/x/exp/slices"
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/model"
+	"github.com/abcxyz/abc/templates/model/spec/features"
+)
+
+// Spec represents a parsed spec.yaml file describing a template.
+type Spec struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	Desc   model.String `yaml:"desc"`
+	Inputs []*Input     `yaml:"inputs"`
+	Rules  []*Rule      `yaml:"rules"`
+	Steps  []*Step      `yaml:"steps"`
+
+	// Optional ignore section, adopting gitignore-like path matching.
+	// Please be ware that there are some patterns that are always ignored such
+	// as: '.DS_Store, '.bin', '.ssh'.
+	Ignore []model.String `yaml:"ignore"`
+
+	// FileMetadata controls which metadata of template files is carried over to
+	// the rendered output files. It's optional, and may be either
+	// "permissions" (the default), which copies the permission bits and gives
+	// every output file a fresh modification time, or "preserve", which also
+	// copies the setuid, setgid, and sticky bits and keeps the template file's
+	// modification time for files that aren't modified by any step, or
+	// "xattrs", which is like "preserve" but also copies extended attributes.
+	FileMetadata model.String `yaml:"file_metadata"`
+
+	// Deprecated is optional, and is set by the template author when this
+	// template shouldn't be used anymore.
+	Deprecated *Deprecated `yaml:"deprecated,omitempty"`
+
+	// InputMigrations is optional, and tells "abc upgrade" how to compute the
+	// values of this template's inputs from the inputs of an older version of
+	// the template, for example when an input was renamed.
+	InputMigrations []*InputMigration `yaml:"input_migrations"`
+
+	// Outputs is optional, and declares named values that are computed from
+	// the inputs and builtin variables after rendering, so that automation can
+	// consume them without parsing the rendered files.
+	Outputs []*Output `yaml:"outputs"`
+
+	// MergeStrategies is optional, and tells "abc upgrade" how to resolve a
+	// merge conflict in certain output files without asking the user, for
+	// example for generated lockfiles.
+	MergeStrategies []*MergeStrategy `yaml:"merge_strategies"`
+
+	// PreUpgrade is optional, and lists hooks that "abc upgrade" runs before
+	// merging the new template version into an installation, for example to
+	// discard a generated file that would always conflict.
+	PreUpgrade []*UpgradeHook `yaml:"pre_upgrade"`
+
+	// PostUpgrade is optional, and lists hooks that "abc upgrade" runs after
+	// the new template version was merged without conflicts, for example to
+	// print notes about migrating from the old version.
+	PostUpgrade []*UpgradeHook `yaml:"post_upgrade"`
+
+	// TemplateEngine is optional, and selects the template language that
+	// go_template actions use when they don't set their own template_engine.
+	// It may be "go" (the default) or "jinja2".
+	TemplateEngine model.String `yaml:"template_engine"`
+
+	// Features configures which features to use depending on spec API version.
+	Features features.Features `yaml:"-"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (s *Spec) UnmarshalYAML(n *yaml.Node) error {
+	// The api_version field was mistakenly named apiVersion in the past, so accept both.
+	if err := model.UnmarshalPlain(n, s, &s.Pos, "api_version", "apiVersion", "kind"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Validate implements Validator.
+func (s *Spec) Validate() error {
+	var fileMetadataErr error
+	validFileMetadata := []string{"permissions", "preserve", "xattrs"}
+	if s.FileMetadata.Val != "" && !slices.Contains(validFileMetadata, s.FileMetadata.Val) {
+		fileMetadataErr = s.FileMetadata.Pos.Errorf(`"file_metadata" must be one of %v`, validFileMetadata)
+	}
+
+	return errors.Join(
+		model.NotZeroModel(&s.Pos, s.Desc, "desc"),
+		fileMetadataErr,
+		validateTemplateEngine(&s.Pos, s.TemplateEngine),
+		model.NonEmptySlice(&s.Pos, s.Steps, "steps"),
+		model.ValidateEach(s.Inputs),
+		model.ValidateEach(s.Steps),
+		model.ValidateUnlessNil(s.Deprecated),
+		model.ValidateEach(s.InputMigrations),
+		s.validateMigrationTargets(),
+		model.ValidateEach(s.Outputs),
+		s.validateOutputNames(),
+		model.ValidateEach(s.MergeStrategies),
+		model.ValidateEach(s.PreUpgrade),
+		model.ValidateEach(s.PostUpgrade),
+		s.validatePostUpgradeActions(),
+	)
+}
+
+// validatePostUpgradeActions checks that the post_upgrade hooks don't delete
+// files, since by the time they run, the merge has already decided what
+// happens to every file.
+func (s *Spec) validatePostUpgradeActions() error {
+	var merr error
+	for _, h := range s.PostUpgrade {
+		if h.Delete != nil {
+			merr = errors.Join(merr, h.Action.Pos.Errorf(`the "delete" action is only allowed in pre_upgrade, not post_upgrade`))
+		}
+	}
+	return merr
+}
+
+// validateOutputNames checks that no two outputs have the same name.
+func (s *Spec) validateOutputNames() error {
+	var merr error
+	seen := make(map[string]struct{}, len(s.Outputs))
+	for _, o := range s.Outputs {
+		if _, ok := seen[o.Name.Val]; ok {
+			merr = errors.Join(merr, o.Name.Pos.Errorf("duplicate output name %q", o.Name.Val))
+		}
+		seen[o.Name.Val] = struct{}{}
+	}
+	return merr
+}
+
+// validateMigrationTargets checks that every input migration produces an
+// input that this template actually has.
+func (s *Spec) validateMigrationTargets() error {
+	var merr error
+	for _, m := range s.InputMigrations {
+		for _, mapping := range m.Inputs {
+			found := slices.ContainsFunc(s.Inputs, func(i *Input) bool {
+				return i.Name.Val == mapping.Name.Val
+			})
+			if !found && mapping.Name.Val != "" {
+				merr = errors.Join(merr, mapping.Name.Pos.Errorf("input migration target %q is not an input of this template", mapping.Name.Val))
+			}
+		}
+	}
+	return merr
+}
+
+// InputMigration computes input values from the inputs of an older version of
+// the template.
+type InputMigration struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// Optional: a semver constraint like "< 2.0.0" on the template version
+	// that is being upgraded from. If omitted, the migration applies when
+	// upgrading from any version.
+	FromVersions model.String `yaml:"from_versions"`
+
+	// The inputs to compute.
+	Inputs []*InputMapping `yaml:"inputs"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (i *InputMigration) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, i, &i.Pos)
+}
+
+// Validate implements Validator.
+func (i *InputMigration) Validate() error {
+	var versionsErr error
+	if i.FromVersions.Val != "" {
+		if _, err := semver.NewConstraint(i.FromVersions.Val); err != nil {
+			versionsErr = i.FromVersions.Pos.Errorf(`"from_versions" is not a valid semver constraint: %w`, err)
+		}
+	}
+	return errors.Join(
+		versionsErr,
+		model.NonEmptySlice(&i.Pos, i.Inputs, "inputs"),
+		model.ValidateEach(i.Inputs),
+	)
+}
+
+// InputMapping computes the value of one input.
+type InputMapping struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// The name of the input in this version of the template.
+	Name model.String `yaml:"name"`
+
+	// A CEL expression that computes the input's value, in which the inputs
+	// of the older template version are in scope, like "service_name".
+	Value model.String `yaml:"value"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (i *InputMapping) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, i, &i.Pos)
+}
+
+// Validate implements Validator.
+func (i *InputMapping) Validate() error {
+	return errors.Join(
+		model.NotZeroModel(&i.Pos, i.Name, "name"),
+		model.NotZeroModel(&i.Pos, i.Value, "value"),
+	)
+}
+
+// The values of MergeStrategy.Strategy.
+const (
+	// Keep the user's version of the file.
+	MergeStrategyOurs = "ours"
+
+	// Take the new template's version of the file.
+	MergeStrategyTheirs = "theirs"
+
+	// Keep the lines of both versions.
+	MergeStrategyUnion = "union"
+
+	// Merge the JSON objects in both versions.
+	MergeStrategyJSONDeepMerge = "json-deep-merge"
+)
+
+// MergeStrategy says how "abc upgrade" resolves a merge conflict in the output
+// files matching any of the given paths.
+type MergeStrategy struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// Glob patterns, like "package-lock.json" or "gen/*.json", matched
+	// against the output file's path relative to the destination directory.
+	Paths []model.String `yaml:"paths"`
+
+	// One of "ours", "theirs", "union", or "json-deep-merge".
+	Strategy model.String `yaml:"strategy"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (m *MergeStrategy) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, m, &m.Pos)
+}
+
+// Validate implements Validator.
+func (m *MergeStrategy) Validate() error {
+	var globErr error
+	for _, p := range m.Paths {
+		if _, err := path.Match(p.Val, ""); err != nil {
+			globErr = errors.Join(globErr, p.Pos.Errorf("invalid glob pattern %q: %w", p.Val, err))
+		}
+	}
+	return errors.Join(
+		model.NonEmptySlice(&m.Pos, m.Paths, "paths"),
+		globErr,
+		model.OneOf(&m.Pos, m.Strategy, []string{
+			MergeStrategyOurs, MergeStrategyTheirs, MergeStrategyUnion, MergeStrategyJSONDeepMerge,
+		}, "strategy"),
+	)
+}
+
+// UpgradeHook is one step that "abc upgrade" runs before or after merging a
+// new template version into an installation. Besides the inputs, the builtin
+// variables _from_version and _to_version are in scope in its "if" expression
+// and parameters.
+type UpgradeHook struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	Desc   model.String `yaml:"desc"`
+	If     model.String `yaml:"if"`
+	Action model.String `yaml:"action"`
+
+	// Each action type has a field below. Only one of these will be set.
+	Delete *DeleteFiles `yaml:"-"`
+	Print  *Print       `yaml:"-"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (h *UpgradeHook) UnmarshalYAML(n *yaml.Node) error {
+	if err := model.UnmarshalPlain(n, h, &h.Pos, "params"); err != nil {
+		return err
+	}
+
+	var unmarshalInto any
+	switch h.Action.Val {
+	case "delete":
+		h.Delete = new(DeleteFiles)
+		unmarshalInto = h.Delete
+		h.Delete.Pos = h.Pos
+	case "print":
+		h.Print = new(Print)
+		unmarshalInto = h.Print
+		h.Print.Pos = h.Pos
+	case "":
+		return h.Pos.Errorf(`missing "action" field in this upgrade hook`)
+	default:
+		return h.Pos.Errorf(`unknown upgrade hook action type %q, must be "delete" or "print"`, h.Action.Val)
+	}
+
+	params := struct {
+		Params yaml.Node `yaml:"params"`
+	}{}
+	if err := n.Decode(&params); err != nil {
+		return err
+	}
+	if err := params.Params.Decode(unmarshalInto); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate implements Validator.
+func (h *UpgradeHook) Validate() error {
+	// The "action" field is implicitly validated by UnmarshalYAML, so not included here.
+	return errors.Join(
+		model.NotZeroModel(&h.Pos, h.Desc, "desc"),
+		model.ValidateUnlessNil(h.Delete),
+		model.ValidateUnlessNil(h.Print),
+	)
+}
+
+// DeleteFiles is an upgrade hook action that discards the installation's
+// copies of some files before the merge. They're treated as though the user
+// never edited them, so the new template version's files are written without
+// a merge conflict, and files that the new version no longer outputs are
+// deleted.
+type DeleteFiles struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// Glob patterns, like "package-lock.json" or "gen/*.json", matched
+	// against the paths of the files output by the old template version,
+	// relative to the destination directory. Files that weren't output by the
+	// template are never deleted.
+	Paths []model.String `yaml:"paths"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (d *DeleteFiles) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, d, &d.Pos)
+}
+
+// Validate implements Validator.
+func (d *DeleteFiles) Validate() error {
+	var globErr error
+	for _, p := range d.Paths {
+		if _, err := path.Match(p.Val, ""); err != nil {
+			globErr = errors.Join(globErr, p.Pos.Errorf("invalid glob pattern %q: %w", p.Val, err))
+		}
+	}
+	return errors.Join(
+		model.NonEmptySlice(&d.Pos, d.Paths, "paths"),
+		globErr,
+	)
+}
+
+// Deprecated says that a template is deprecated, and optionally what replaced
+// it.
+type Deprecated struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// A message for the user explaining the deprecation.
+	Message model.String `yaml:"message"`
+
+	// Optional: the location of the template that replaces this one, in the
+	// same format as the argument to "abc render".
+	ReplacedBy model.String `yaml:"replaced_by"`
+
+	// Optional: whether the replacement template accepts the same inputs and
+	// produces compatible output, so that "abc upgrade --follow-replacement"
+	// can switch existing installations over to it.
+	Compatible model.Bool `yaml:"compatible"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (d *Deprecated) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, d, &d.Pos)
+}
+
+// Validate implements Validator.
+func (d *Deprecated) Validate() error {
+	var compatibleErr error
+	if d.Compatible.Val && d.ReplacedBy.Val == "" {
+		compatibleErr = d.Compatible.Pos.Errorf(`"compatible" can only be used with "replaced_by"`)
+	}
+	return errors.Join(
+		model.NotZeroModel(&d.Pos, d.Message, "message"),
+		compatibleErr,
+	)
+}
+
+// Output is a named value that's computed after rendering.
+type Output struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	Name model.String `yaml:"name"`
+	Desc model.String `yaml:"desc"`
+
+	// A CEL expression that computes the output's value, in which the inputs
+	// and builtin variables are in scope.
+	Value model.String `yaml:"value"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (o *Output) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, o, &o.Pos)
+}
+
+// Validate implements Validator.
+func (o *Output) Validate() error {
+	return errors.Join(
+		model.NotZeroModel(&o.Pos, o.Name, "name"),
+		model.NotZeroModel(&o.Pos, o.Value, "value"),
+	)
+}
+
+// Input represents one of the parsed "input" fields from the spec.yaml file.
+type Input struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	Name    model.String  `yaml:"name"`
+	Desc    model.String  `yaml:"desc"`
+	Default *model.String `yaml:"default,omitempty"`
+	Rules   []*Rule       `yaml:"rules"`
+
+	// TODO(tyroneclay): add your new field here
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (i *Input) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, i, &i.Pos)
+}
+
+// Validate implements Validator.
+func (i *Input) Validate() error {
+	var reservedNameErr error
+	if strings.HasPrefix(i.Name.Val, "_") {
+		reservedNameErr = i.Name.Pos.Errorf("input names beginning with _ are reserved")
+	}
+
+	return errors.Join(
+		model.NotZeroModel(&i.Pos, i.Name, "name"),
+		model.NotZeroModel(&i.Pos, i.Desc, "desc"),
+		reservedNameErr,
+		model.ValidateEach(i.Rules),
+	)
+}
+
+// Rule represents a validation rule.
+type Rule struct {
+	Pos model.ConfigPos `yaml:"-"`
+
+	Rule    model.String `yaml:"rule"`
+	Message model.String `yaml:"message"` // optional
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (i *Rule) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, i, &i.Pos)
+}
+
+// Validate implements Validator.
+func (i *Rule) Validate() error {
+	return model.NotZeroModel(&i.Pos, i.Rule, "rule")
+}
+
+// Step represents one of the work steps involved in rendering a template.
+type Step struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	Desc   model.String `yaml:"desc"`
+	If     model.String `yaml:"if"`
+	Action model.String `yaml:"action"`
+
+	// Timeout optionally limits how long the step may run, as a Go duration
+	// string like "30s" or "5m".
+	Timeout model.String `yaml:"timeout"`
+
+	// Retries is how many more times to try the step if it fails with a
+	// transient error, like a failed download. Defaults to zero.
+	Retries model.Int `yaml:"retries"`
+
+	// Each action type has a field below. Only one of these will be set.
+	Append          *Append          `yaml:"-"`
+	BufGenerate     *BufGenerate     `yaml:"-"`
+	ForEach         *ForEach         `yaml:"-"`
+	GoModEdit       *GoModEdit       `yaml:"-"`
+	GoTemplate      *GoTemplate      `yaml:"-"`
+	HCLModify       *HCLModify       `yaml:"-"`
+	Include         *Include         `yaml:"-"`
+	LicenseHeader   *LicenseHeader   `yaml:"-"`
+	Print           *Print           `yaml:"-"`
+	RegexNameLookup *RegexNameLookup `yaml:"-"`
+	RegexReplace    *RegexReplace    `yaml:"-"`
+	StringReplace   *StringReplace   `yaml:"-"`
+	Wasm            *Wasm            `yaml:"-"`
+}
+
+// MaxStepRetries is the largest allowed value of a step's "retries" field.
+const MaxStepRetries = 10
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (s *Step) UnmarshalYAML(n *yaml.Node) error {
+	if err := model.UnmarshalPlain(n, s, &s.Pos, "params"); err != nil {
+		return err
+	}
+
+	// The rest of this function just unmarshals the "params" field into the correct struct type depending
+	// on the value of "action".
+	var unmarshalInto any
+	switch s.Action.Val {
+	case "append":
+		s.Append = new(Append)
+		unmarshalInto = s.Append
+		s.Append.Pos = s.Pos
+	case "buf_generate":
+		s.BufGenerate = new(BufGenerate)
+		unmarshalInto = s.BufGenerate
+		s.BufGenerate.Pos = s.Pos
+	case "for_each":
+		s.ForEach = new(ForEach)
+		unmarshalInto = s.ForEach
+		s.ForEach.Pos = s.Pos
+	case "go_mod_edit":
+		s.GoModEdit = new(GoModEdit)
+		unmarshalInto = s.GoModEdit
+		s.GoModEdit.Pos = s.Pos
+	case "go_template":
+		s.GoTemplate = new(GoTemplate)
+		unmarshalInto = s.GoTemplate
+		s.GoTemplate.Pos = s.Pos
+	case "hcl_modify":
+		s.HCLModify = new(HCLModify)
+		unmarshalInto = s.HCLModify
+		s.HCLModify.Pos = s.Pos
+	case "include":
+		s.Include = new(Include)
+		unmarshalInto = s.Include
+		s.Include.Pos = s.Pos
+	case "license_header":
+		s.LicenseHeader = new(LicenseHeader)
+		unmarshalInto = s.LicenseHeader
+		s.LicenseHeader.Pos = s.Pos
+	case "print":
+		s.Print = new(Print)
+		unmarshalInto = s.Print
+		s.Print.Pos = s.Pos // Set an approximate position in case yaml unmarshaling fails later
+	case "regex_name_lookup":
+		s.RegexNameLookup = new(RegexNameLookup)
+		unmarshalInto = s.RegexNameLookup
+		s.RegexNameLookup.Pos = s.Pos
+	case "regex_replace":
+		s.RegexReplace = new(RegexReplace)
+		unmarshalInto = s.RegexReplace
+		s.RegexReplace.Pos = s.Pos
+	case "string_replace":
+		s.StringReplace = new(StringReplace)
+		unmarshalInto = s.StringReplace
+		s.StringReplace.Pos = s.Pos
+	case "wasm":
+		s.Wasm = new(Wasm)
+		unmarshalInto = s.Wasm
+		s.Wasm.Pos = s.Pos
+	case "":
+		return s.Pos.Errorf(`missing "action" field in this step`)
+	default:
+		return s.Pos.Errorf("unknown action type %q", s.Action.Val)
+	}
+
+	params := struct {
+		Params yaml.Node `yaml:"params"`
+	}{}
+	if err := n.Decode(&params); err != nil {
+		return err
+	}
+	if err := params.Params.Decode(unmarshalInto); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate implements Validator.
+func (s *Step) Validate() error {
+	var timeoutErr error
+	if s.Timeout.Val != "" {
+		if d, err := time.ParseDuration(s.Timeout.Val); err != nil {
+			timeoutErr = s.Timeout.Pos.Errorf(`"timeout" must be a duration like "30s" or "5m": %w`, err)
+		} else if d <= 0 {
+			timeoutErr = s.Timeout.Pos.Errorf(`"timeout" must be positive, but was %q`, s.Timeout.Val)
+		}
+	}
+
+	var retriesErr error
+	if s.Retries.Val < 0 || s.Retries.Val > MaxStepRetries {
+		retriesErr = s.Retries.Pos.Errorf(`"retries" must be between 0 and %d, but was %d`, MaxStepRetries, s.Retries.Val)
+	}
+
+	// The "action" field is implicitly validated by UnmarshalYAML, so not included here.
+	return errors.Join(
+		model.NotZeroModel(&s.Pos, s.Desc, "desc"),
+		timeoutErr,
+		retriesErr,
+		model.ValidateUnlessNil(s.Append),
+		model.ValidateUnlessNil(s.BufGenerate),
+		model.ValidateUnlessNil(s.ForEach),
+		model.ValidateUnlessNil(s.GoModEdit),
+		model.ValidateUnlessNil(s.GoTemplate),
+		model.ValidateUnlessNil(s.HCLModify),
+		model.ValidateUnlessNil(s.Include),
+		model.ValidateUnlessNil(s.LicenseHeader),
+		model.ValidateUnlessNil(s.Print),
+		model.ValidateUnlessNil(s.RegexNameLookup),
+		model.ValidateUnlessNil(s.RegexReplace),
+		model.ValidateUnlessNil(s.StringReplace),
+		model.ValidateUnlessNil(s.Wasm),
+	)
+}
+
+// Print is an action that prints a message to standard output.
+type Print struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	Message model.String `yaml:"message"`
+
+	// Format is optional, and says how the message should be displayed. With
+	// "markdown", the message is rendered with basic styling when standard
+	// output is a terminal, and printed as-is otherwise. The default is "text",
+	// which always prints the message as-is.
+	Format model.String `yaml:"format"`
+}
+
+// The values of the print action's format field.
+const (
+	PrintFormatText     = "text"
+	PrintFormatMarkdown = "markdown"
+)
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (p *Print) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, p, &p.Pos)
+}
+
+// Validate implements Validator.
+func (p *Print) Validate() error {
+	return errors.Join(
+		model.NotZeroModel(&p.Pos, p.Message, "message"),
+		validatePrintFormat(&p.Pos, p.Format),
+	)
+}
+
+// validatePrintFormat checks the print action's optional format field.
+func validatePrintFormat(parentPos *model.ConfigPos, format model.String) error {
+	if format.Val == "" {
+		return nil
+	}
+	return model.OneOf(parentPos, format, []string{PrintFormatText, PrintFormatMarkdown}, "format") //nolint:wrapcheck
+}
+
+// Include is an action that places files into the output directory.
+type Include struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	Paths []*IncludePath `yaml:"paths"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (i *Include) UnmarshalYAML(n *yaml.Node) error {
+	// There are two cases for an "include":
+	//  1. "paths" is a list of strings (old-style)
+	//  2. "paths" is a list of objects (new-style)
+	//
+	// We do this by unmarshaling into a map, then checking the "kind" of the
+	// YAML objects in the map values. If "paths" is a list of scalars, then we
+	// assume we're dealing with case 1. Otherwise we assume we're dealing with
+	// case 2.
+	//
+	// The shape of the Include struct looks the same either way, so downstream
+	// code inside this program doesn't have to know that there are two cases.
+
+	nodesMap := map[string]yaml.Node{}
+	if err := n.Decode(nodesMap); err != nil {
+		return model.YAMLPos(n).Errorf("%w", err)
+	}
+
+	pathsNode, ok := nodesMap["paths"]
+	if !ok {
+		return model.YAMLPos(n).Errorf(`field "paths" is required`)
+	}
+	if pathsNode.Kind != yaml.SequenceNode {
+		return model.YAMLPos(&pathsNode).Errorf("paths must be a YAML list")
+	}
+	var listElemKind, zeroKind yaml.Kind
+	for _, elemNode := range pathsNode.Content {
+		if listElemKind != zeroKind && elemNode.Kind != listElemKind {
+			return model.YAMLPos(&pathsNode).Errorf("Lists of paths must be homogeneous, either all strings or all objects")
+		}
+		listElemKind = elemNode.Kind
+	}
+
+	if listElemKind == yaml.ScalarNode { // Detect old-style case 1 input
+		ip := &IncludePath{}
+		i.Paths = []*IncludePath{ip}
+		// Subtle point: in case 1 ("old-style"), we unmarshal the incoming YAML object as an "IncludePath" struct.
+		return model.UnmarshalPlain(n, ip, &ip.Pos)
+	}
+
+	// Otherwise we're in case 2, we just unmarshal the incoming YAML object as an "Include: struct.
+	return model.UnmarshalPlain(n, i, &i.Pos)
+}
+
+// Validate implements Validator.
+func (i *Include) Validate() error {
+	return errors.Join(
+		model.ValidateEach(i.Paths),
+		model.NonEmptySlice(&i.Pos, i.Paths, "paths"),
+	)
+}
+
+// IncludePath represents an object for controlling the behavior of included files.
+type IncludePath struct {
+	Pos model.ConfigPos `yaml:"-"`
+
+	As         []model.String `yaml:"as"`
+	From       model.String   `yaml:"from"`
+	OnConflict model.String   `yaml:"on_conflict"`
+	Paths      []model.String `yaml:"paths"`
+	Skip       []model.String `yaml:"skip"`
+
+	// SkipGitignore turns off the default behavior of an include with "from:
+	// destination", which is to leave out the paths that are ignored by the
+	// destination's .gitignore files.
+	SkipGitignore model.Bool `yaml:"skip_gitignore"`
+
+	// Source is where to download the files from when using "from: remote".
+	// It accepts the same template locations as "abc render", like
+	// "github.com/myorg/shared/makefiles@v1.2.3".
+	Source model.String `yaml:"source"`
+
+	// Version optionally gives the version of Source, like "v1.2.3" or
+	// "latest", as an alternative to putting it after an "@" in Source.
+	Version model.String `yaml:"version"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (i *IncludePath) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, i, &i.Pos)
+}
+
+// Validate implements Validator.
+func (i *IncludePath) Validate() error {
+	var exclusivityErr error
+	if len(i.As) != 0 && len(i.Paths) != len(i.As) {
+		exclusivityErr = i.As[0].Pos.Errorf(`when using "as", the size of "as" (%d) must be the same as the size of "paths" (%d)`,
+			len(i.As), len(i.Paths))
+	}
+
+	var fromErr error
+	validFrom := []string{"destination", "remote"}
+	if i.From.Val != "" && !slices.Contains(validFrom, i.From.Val) {
+		fromErr = i.From.Pos.Errorf(`"from" must be one of %v`, validFrom)
+	}
+	if i.SkipGitignore.Val && i.From.Val != "destination" {
+		fromErr = errors.Join(fromErr, i.SkipGitignore.Pos.Errorf(`"skip_gitignore" can only be used with "from: destination"`))
+	}
+
+	var sourceErr error
+	if i.From.Val == "remote" {
+		sourceErr = model.NotZeroModel(&i.Pos, i.Source, "source")
+		if i.Version.Val != "" && strings.Contains(i.Source.Val, "@") {
+			sourceErr = errors.Join(sourceErr, i.Version.Pos.Errorf(`"version" can't be used when "source" already has an "@version"`))
+		}
+	} else {
+		if i.Source.Val != "" {
+			sourceErr = i.Source.Pos.Errorf(`"source" can only be used with "from: remote"`)
+		}
+		if i.Version.Val != "" {
+			sourceErr = errors.Join(sourceErr, i.Version.Pos.Errorf(`"version" can only be used with "from: remote"`))
+		}
+	}
+
+	return errors.Join(
+		model.NonEmptySlice(&i.Pos, i.Paths, "paths"),
+		exclusivityErr,
+		fromErr,
+		sourceErr,
+	)
+}
+
+// RegexReplace is an action that replaces a regex match (or a subgroup of it) with a
+// template expression.
+type RegexReplace struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	Paths        []model.String       `yaml:"paths"`
+	Replacements []*RegexReplaceEntry `yaml:"replacements"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (r *RegexReplace) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, r, &r.Pos)
+}
+
+// Validate implements Validator.
+func (r *RegexReplace) Validate() error {
+	return errors.Join(
+		model.NonEmptySlice(&r.Pos, r.Paths, "paths"),
+		model.NonEmptySlice(&r.Pos, r.Replacements, "replacements"),
+		model.ValidateEach(r.Replacements),
+	)
+}
+
+// RegexReplaceEntry is one of potentially many regex replacements to be applied.
+type RegexReplaceEntry struct {
+	Pos               model.ConfigPos `yaml:"-"`
+	Regex             model.String    `yaml:"regex"`
+	SubgroupToReplace model.String    `yaml:"subgroup_to_replace"`
+	With              model.String    `yaml:"with"`
+}
+
+// Validate implements Validator.
+func (r *RegexReplaceEntry) Validate() error {
+	// Some validation happens later during execution:
+	//  - Compiling the regular expression
+	//  - Compiling the "with" template
+	//  - Validating that the subgroup number is actually a valid subgroup in the regex
+
+	var subgroupErr error
+	if r.SubgroupToReplace.Val != "" {
+		subgroupErr = model.IsValidRegexGroupName(r.SubgroupToReplace, "subgroup")
+	}
+
+	return errors.Join(
+		model.NotZeroModel(&r.Pos, r.Regex, "regex"),
+		model.NotZeroModel(&r.Pos, r.With, "with"),
+		subgroupErr,
+	)
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (r *RegexReplaceEntry) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, r, &r.Pos)
+}
+
+// RegexNameLookup is an action that replaces named regex capturing groups with
+// the template variable of the same name.
+type RegexNameLookup struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	Paths        []model.String          `yaml:"paths"`
+	Replacements []*RegexNameLookupEntry `yaml:"replacements"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (r *RegexNameLookup) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, r, &r.Pos)
+}
+
+// Validate implements Validator.
+func (r *RegexNameLookup) Validate() error {
+	return errors.Join(
+		model.NonEmptySlice(&r.Pos, r.Paths, "paths"),
+		model.NonEmptySlice(&r.Pos, r.Replacements, "replacements"),
+		model.ValidateEach(r.Replacements),
+	)
+}
+
+// RegexNameLookupEntry is one of potentially many regex replacements to be applied.
+type RegexNameLookupEntry struct {
+	Pos   model.ConfigPos `yaml:"-"`
+	Regex model.String    `yaml:"regex"`
+}
+
+// Validate implements Validator.
+func (r *RegexNameLookupEntry) Validate() error {
+	return errors.Join(
+		model.NotZeroModel(&r.Pos, r.Regex, "regex"),
+	)
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (r *RegexNameLookupEntry) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, r, &r.Pos)
+}
+
+// StringReplace is an action that replaces a string with a template expression.
+type StringReplace struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	Paths        []model.String       `yaml:"paths"`
+	Replacements []*StringReplacement `yaml:"replacements"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (s *StringReplace) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, s, &s.Pos)
+}
+
+// Validate implements Validator.
+func (s *StringReplace) Validate() error {
+	// Some validation doesn't happen here, it happens later during execution:
+	//  - Compiling the regular expression
+	//  - Compiling the "with" template
+	//  - Validating that the subgroup number is actually a valid subgroup in
+	//    the regex
+	return errors.Join(
+		model.NonEmptySlice(&s.Pos, s.Paths, "paths"),
+		model.NonEmptySlice(&s.Pos, s.Replacements, "replacements"),
+		model.ValidateEach(s.Replacements),
+	)
+}
+
+type StringReplacement struct {
+	Pos model.ConfigPos `yaml:"-"`
+
+	ToReplace model.String `yaml:"to_replace"`
+	With      model.String `yaml:"with"`
+}
+
+func (s *StringReplacement) Validate() error {
+	return errors.Join(
+		model.NotZeroModel(&s.Pos, s.ToReplace, "to_replace"),
+		model.NotZeroModel(&s.Pos, s.With, "with"),
+	)
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (s *StringReplacement) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, s, &s.Pos)
+}
+
+// Append is an action that appends some output to the end of the file.
+type Append struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	Paths             []model.String `yaml:"paths"`
+	With              model.String   `yaml:"with"`
+	SkipEnsureNewline model.Bool     `yaml:"skip_ensure_newline"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (a *Append) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, a, &a.Pos)
+}
+
+// Validate implements Validator.
+func (a *Append) Validate() error {
+	return errors.Join(
+		model.NonEmptySlice(&a.Pos, a.Paths, "paths"),
+		model.NotZeroModel(&a.Pos, a.With, "with"),
+	)
+}
+
+// BufGenerate is an action that runs "buf generate" to generate code from
+// .proto files in the scratch directory, like the gRPC stubs for a service.
+// It needs the buf CLI to be installed.
+type BufGenerate struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// Input is optional, and is the directory containing the .proto files
+	// (and buf.yaml, if any), relative to the scratch directory. Defaults to
+	// the scratch directory itself.
+	Input model.String `yaml:"input"`
+
+	// Template is optional, and is the buf.gen.yaml file that configures the
+	// code generation, relative to the scratch directory. Defaults to
+	// buf.gen.yaml at the top of the scratch directory.
+	Template model.String `yaml:"template"`
+
+	// Output is optional, and is the directory that the paths in Template's
+	// "out" fields are relative to, relative to the scratch directory.
+	// Defaults to the scratch directory itself.
+	Output model.String `yaml:"output"`
+
+	// Paths is optional, and limits code generation to these .proto files or
+	// directories, relative to the scratch directory.
+	Paths []model.String `yaml:"paths"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (b *BufGenerate) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, b, &b.Pos)
+}
+
+// Validate implements Validator.
+func (b *BufGenerate) Validate() error {
+	// Every field is optional. Checking that the paths are valid happens
+	// later, after templating.
+	return nil
+}
+
+// GoModEdit is an action that edits go.mod files, like "go mod edit" does.
+// Unlike a string_replace, it understands the structure of the file.
+type GoModEdit struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	Paths []model.String `yaml:"paths"`
+
+	// Module is optional, and changes the module path.
+	Module model.String `yaml:"module"`
+
+	// GoVersion is optional, and sets the "go" directive, like "1.22".
+	GoVersion model.String `yaml:"go_version"`
+
+	// Requires are added, or update the version of an existing requirement on
+	// the same module.
+	Requires []*GoModRequire `yaml:"requires"`
+
+	// Replaces are added, or update an existing replacement of the same module
+	// and version.
+	Replaces []*GoModReplace `yaml:"replaces"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (g *GoModEdit) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, g, &g.Pos)
+}
+
+// Validate implements Validator.
+func (g *GoModEdit) Validate() error {
+	var emptyErr error
+	if g.Module.Val == "" && g.GoVersion.Val == "" && len(g.Requires) == 0 && len(g.Replaces) == 0 {
+		emptyErr = g.Pos.Errorf(`at least one of "module", "go_version", "requires", or "replaces" must be given`)
+	}
+	// Validating the module paths and versions happens later, after templating.
+	return errors.Join(
+		model.NonEmptySlice(&g.Pos, g.Paths, "paths"),
+		emptyErr,
+		model.ValidateEach(g.Requires),
+		model.ValidateEach(g.Replaces),
+	)
+}
+
+// GoModRequire is a require directive in a go.mod file.
+type GoModRequire struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// Path is the module path, like "github.com/abcxyz/pkg".
+	Path model.String `yaml:"path"`
+
+	// Version is the module version, like "v1.2.3".
+	Version model.String `yaml:"version"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (r *GoModRequire) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, r, &r.Pos)
+}
+
+// Validate implements Validator.
+func (r *GoModRequire) Validate() error {
+	return errors.Join(
+		model.NotZeroModel(&r.Pos, r.Path, "path"),
+		model.NotZeroModel(&r.Pos, r.Version, "version"),
+	)
+}
+
+// GoModReplace is a replace directive in a go.mod file.
+type GoModReplace struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// Old is the module path being replaced.
+	Old model.String `yaml:"old"`
+
+	// OldVersion is optional; if set, only that version of Old is replaced.
+	OldVersion model.String `yaml:"old_version"`
+
+	// New is a module path, or a local directory starting with "./" or "../".
+	New model.String `yaml:"new"`
+
+	// NewVersion is the version of New. It's required unless New is a local
+	// directory, in which case it must not be set.
+	NewVersion model.String `yaml:"new_version"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (r *GoModReplace) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, r, &r.Pos)
+}
+
+// Validate implements Validator.
+func (r *GoModReplace) Validate() error {
+	return errors.Join(
+		model.NotZeroModel(&r.Pos, r.Old, "old"),
+		model.NotZeroModel(&r.Pos, r.New, "new"),
+	)
+}
+
+// HCLModify is an action that edits HCL files, like Terraform configs, by
+// setting attributes and adding blocks. Unlike regex edits, it understands the
+// structure of the file, and it keeps the existing comments and formatting.
+type HCLModify struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	Paths []model.String `yaml:"paths"`
+
+	// AddBlocks are applied before SetAttributes, so attributes can be set in
+	// the added blocks.
+	AddBlocks     []*HCLAddBlock     `yaml:"add_blocks"`
+	SetAttributes []*HCLSetAttribute `yaml:"set_attributes"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (h *HCLModify) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, h, &h.Pos)
+}
+
+// Validate implements Validator.
+func (h *HCLModify) Validate() error {
+	var emptyErr error
+	if len(h.AddBlocks) == 0 && len(h.SetAttributes) == 0 {
+		emptyErr = h.Pos.Errorf(`at least one of "add_blocks" or "set_attributes" must be given`)
+	}
+	// Parsing the HCL in "value" and "body" happens later, after templating.
+	return errors.Join(
+		model.NonEmptySlice(&h.Pos, h.Paths, "paths"),
+		emptyErr,
+		model.ValidateEach(h.AddBlocks),
+		model.ValidateEach(h.SetAttributes),
+	)
+}
+
+// The values of HCLAddBlock.IfExists.
+const (
+	HCLIfExistsError   = "error"
+	HCLIfExistsSkip    = "skip"
+	HCLIfExistsReplace = "replace"
+)
+
+// HCLAddBlock adds a block to an HCL file.
+type HCLAddBlock struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// Parent is the address of the block to add the new block to, or empty to
+	// add it at the top level of the file. An address is a block type followed
+	// by its labels, then the same for each nested block, separated by dots,
+	// like "terraform" or "resource.google_storage_bucket.main".
+	Parent model.String `yaml:"parent"`
+
+	Type   model.String   `yaml:"type"`
+	Labels []model.String `yaml:"labels"`
+
+	// Body is the HCL source of the block's contents. It's optional.
+	Body model.String `yaml:"body"`
+
+	// IfExists says what to do if there's already a block with the same type
+	// and labels: "error" (the default), "skip", or "replace".
+	IfExists model.String `yaml:"if_exists"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (a *HCLAddBlock) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, a, &a.Pos)
+}
+
+// Validate implements Validator.
+func (a *HCLAddBlock) Validate() error {
+	var ifExistsErr error
+	if a.IfExists.Val != "" {
+		ifExistsErr = model.OneOf(&a.Pos, a.IfExists, []string{HCLIfExistsError, HCLIfExistsSkip, HCLIfExistsReplace}, "if_exists")
+	}
+	return errors.Join(
+		model.NotZeroModel(&a.Pos, a.Type, "type"),
+		ifExistsErr,
+	)
+}
+
+// HCLSetAttribute sets an attribute in an HCL file, adding it if it doesn't
+// exist yet.
+type HCLSetAttribute struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// Block is the address of the block containing the attribute, like
+	// "terraform.backend.gcs", or empty for the top level of the file. See
+	// HCLAddBlock.Parent.
+	Block model.String `yaml:"block"`
+
+	Name model.String `yaml:"name"`
+
+	// Value is an HCL expression, like '"my-bucket"' (note the quotes) or
+	// 'var.project_id'.
+	Value model.String `yaml:"value"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (s *HCLSetAttribute) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, s, &s.Pos)
+}
+
+// Validate implements Validator.
+func (s *HCLSetAttribute) Validate() error {
+	return errors.Join(
+		model.NotZeroModel(&s.Pos, s.Name, "name"),
+		model.NotZeroModel(&s.Pos, s.Value, "value"),
+	)
+}
+
+// LicenseHeader is an action that adds a license or copyright header to the
+// top of source files, as a comment in the right syntax for each file's
+// language.
+type LicenseHeader struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	Paths []model.String `yaml:"paths"`
+
+	// Text is the header, without any comment markers.
+	Text model.String `yaml:"text"`
+
+	// SkipIfContains is optional. Files that contain this string, like
+	// "Licensed under the Apache License", already have a header and are left
+	// alone. Files that already contain the header itself are always skipped.
+	SkipIfContains model.String `yaml:"skip_if_contains"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (l *LicenseHeader) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, l, &l.Pos)
+}
+
+// Validate implements Validator.
+func (l *LicenseHeader) Validate() error {
+	return errors.Join(
+		model.NonEmptySlice(&l.Pos, l.Paths, "paths"),
+		model.NotZeroModel(&l.Pos, l.Text, "text"),
+	)
+}
+
+// Wasm is an action that runs a custom action implemented as a WebAssembly
+// module, so organizations can add their own transforms without changing abc.
+// The module is a WASI command, and it's sandboxed: it can only see the
+// scratch directory and the template variables.
+type Wasm struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// The path to the .wasm file, relative to the template directory.
+	Module model.String `yaml:"module"`
+
+	// Command line arguments for the module. Go templates are allowed.
+	Args []model.String `yaml:"args"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (w *Wasm) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, w, &w.Pos)
+}
+
+// Validate implements Validator.
+func (w *Wasm) Validate() error {
+	// Checking that the module path is valid will happen later.
+	return errors.Join(model.NotZeroModel(&w.Pos, w.Module, "module"))
+}
+
+// GoTemplate is an action that executes one more files as a Go template,
+// replacing each one with its template output.
+type GoTemplate struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	Paths []model.String `yaml:"paths"`
+
+	// TemplateEngine optionally overrides the spec's template_engine for
+	// this action. It may be "go" or "jinja2".
+	TemplateEngine model.String `yaml:"template_engine"`
+
+	// Delimiters optionally replaces the "{{" and "}}" action delimiters,
+	// e.g. ['[[', ']]'], so that files which are themselves Go templates (like
+	// Helm charts) don't need escaping. If set, it must have exactly two
+	// elements. Only supported by the "go" template engine.
+	Delimiters []model.String `yaml:"delimiters"`
+
+	// Verbatim is a list of glob patterns for files that are copied untouched
+	// rather than executed as templates. A pattern without a slash matches
+	// a file name anywhere; otherwise it's matched against the path relative
+	// to the template root. A pattern that matches a directory applies to
+	// everything under it.
+	Verbatim []model.String `yaml:"verbatim"`
+
+	// MissingKeys says what to do when a template references a variable that
+	// doesn't exist: "error" (the default) fails, "zero" renders it as the
+	// empty string, and "warn" does the same as "zero" but logs a warning.
+	// Only supported by the "go" template engine.
+	MissingKeys model.String `yaml:"missing_keys"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (g *GoTemplate) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, g, &g.Pos)
+}
+
+// Validate implements Validator.
+func (g *GoTemplate) Validate() error {
+	// Checking that the input paths are valid will happen later.
+	var delimErr error
+	if len(g.Delimiters) > 0 {
+		if len(g.Delimiters) != 2 {
+			delimErr = g.Delimiters[0].Pos.Errorf(`"delimiters" must have exactly two elements, the left and right delimiters, but had %d`, len(g.Delimiters))
+		} else {
+			for _, d := range g.Delimiters {
+				if d.Val == "" {
+					delimErr = errors.Join(delimErr, d.Pos.Errorf(`"delimiters" must not contain empty strings`))
+				}
+			}
+		}
+		if g.TemplateEngine.Val == TemplateEngineJinja2 {
+			delimErr = errors.Join(delimErr, g.Delimiters[0].Pos.Errorf(`"delimiters" can't be used with template_engine %q`, TemplateEngineJinja2))
+		}
+	}
+
+	var missingKeysErr error
+	if g.MissingKeys.Val != "" {
+		missingKeysErr = model.OneOf(&g.Pos, g.MissingKeys, []string{MissingKeysError, MissingKeysZero, MissingKeysWarn}, "missing_keys")
+		if g.MissingKeys.Val != MissingKeysError && g.TemplateEngine.Val == TemplateEngineJinja2 {
+			missingKeysErr = errors.Join(missingKeysErr, g.MissingKeys.Pos.Errorf(`"missing_keys" can't be used with template_engine %q`, TemplateEngineJinja2))
+		}
+	}
+
+	var globErr error
+	for _, p := range g.Verbatim {
+		if _, err := path.Match(p.Val, ""); err != nil {
+			globErr = errors.Join(globErr, p.Pos.Errorf("invalid glob pattern %q: %w", p.Val, err))
+		}
+	}
+
+	return errors.Join(
+		model.NonEmptySlice(&g.Pos, g.Paths, "paths"),
+		validateTemplateEngine(&g.Pos, g.TemplateEngine),
+		delimErr,
+		missingKeysErr,
+		globErr,
+	)
+}
+
+// The values of the go_template missing_keys field.
+const (
+	MissingKeysError = "error"
+	MissingKeysZero  = "zero"
+	MissingKeysWarn  = "warn"
+)
+
+// The values of the template_engine field.
+const (
+	TemplateEngineGo     = "go"
+	TemplateEngineJinja2 = "jinja2"
+)
+
+// validateTemplateEngine checks an optional template_engine field.
+func validateTemplateEngine(parentPos *model.ConfigPos, engine model.String) error {
+	if engine.Val == "" {
+		return nil
+	}
+	return model.OneOf(parentPos, engine, []string{TemplateEngineGo, TemplateEngineJinja2}, "template_engine") //nolint:wrapcheck
+}
+
+type ForEach struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	Iterator *ForEachIterator `yaml:"iterator"`
+	Steps    []*Step          `yaml:"steps"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (f *ForEach) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, f, &f.Pos)
+}
+
+func (f *ForEach) Validate() error {
+	return errors.Join(
+		model.NotZero(&f.Pos, f.Iterator, "iterator"),
+		model.NonEmptySlice(&f.Pos, f.Steps, "steps"),
+		model.ValidateUnlessNil(f.Iterator),
+		model.ValidateEach(f.Steps),
+	)
+}
+
+type ForEachIterator struct {
+	// Pos is the YAML file location where this object started.
+	Pos model.ConfigPos `yaml:"-"`
+
+	// The name by which the range value is accessed.
+	Key model.String `yaml:"key"`
+
+	// Exactly one of the following fields must be set.
+
+	// Values is a list to range over, e.g. ["dev", "prod"]
+	Values []model.String `yaml:"values"`
+	// ValuesFrom is a CEL expression returning a list of strings to range over.
+	ValuesFrom *model.String `yaml:"values_from"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (f *ForEachIterator) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, f, &f.Pos)
+}
+
+func (f *ForEachIterator) Validate() error {
+	var exclusivityErr error
+	if (len(f.Values) > 0 && f.ValuesFrom != nil) || (len(f.Values) == 0 && f.ValuesFrom == nil) {
+		exclusivityErr = errors.New(`exactly one of the fields "values" or "values_from" must be set`)
+	}
+
+	return errors.Join(
+		model.NotZeroModel(&f.Pos, f.Key, "key"),
+		exclusivityErr,
+	)
+}
@@ -0,0 +1,1957 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta7
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/model"
+	mdl "github.com/abcxyz/abc/templates/testutil/model"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestSpecUnmarshal(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name             string
+		in               string
+		want             *Spec
+		wantUnmarshalErr string
+		wantValidateErr  []string
+	}{
+		{
+			name: "simple_template_should_succeed",
+			in: `api_version: 'cli.abcxyz.dev/v1alpha1'
+kind: 'Template'
+
+desc: 'A simple template that just prints and exits'
+inputs:
+- name: 'person_name'
+  desc: 'An optional name of a person to greet'
+  default: 'default value'
+
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello, {{.or .person_name "World"}}'`,
+			want: &Spec{
+				Desc: mdl.S("A simple template that just prints and exits"),
+				Inputs: []*Input{
+					{
+						Name:    mdl.S("person_name"),
+						Desc:    mdl.S("An optional name of a person to greet"),
+						Default: mdl.SP("default value"),
+					},
+				},
+				Steps: []*Step{
+					{
+						Desc:   mdl.S("Print a message"),
+						Action: mdl.S("print"),
+						Print: &Print{
+							Message: mdl.S(`Hello, {{.or .person_name "World"}}`),
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "apiVersion_camel_case",
+			in: `apiVersion: 'cli.abcxyz.dev/v1alpha1'
+kind: 'Template'
+
+desc: 'A simple template that just prints and exits'
+inputs:
+- name: 'person_name'
+  desc: 'An optional name of a person to greet'
+  default: 'default value'
+
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello, {{.or .person_name "World"}}'`,
+			want: &Spec{
+				Desc: mdl.S("A simple template that just prints and exits"),
+				Inputs: []*Input{
+					{
+						Name:    mdl.S("person_name"),
+						Desc:    mdl.S("An optional name of a person to greet"),
+						Default: mdl.SP("default value"),
+					},
+				},
+				Steps: []*Step{
+					{
+						Desc:   mdl.S("Print a message"),
+						Action: mdl.S("print"),
+						Print: &Print{
+							Message: mdl.S(`Hello, {{.or .person_name "World"}}`),
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "validation_of_children_should_occur_and_fail",
+			in: `desc: 'A simple template that just prints and exits'
+inputs:
+- name: 'person_name'
+
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello, {{.or .person_name "World"}}'`,
+			wantValidateErr: []string{`at line 3 column 3: field "desc" is required`},
+		},
+		{
+			name: "check_required_fields",
+			in:   "inputs:",
+			wantValidateErr: []string{
+				`at line 1 column 1: field "desc" is required`,
+				`at line 1 column 1: field "steps" is required`,
+			},
+		},
+
+		{
+			name: "unknown_field_should_fail",
+			in: `api_version: 'cli.abcxyz.dev/v1alpha1'
+kind: 'Template'
+
+desc: 'A simple template that just prints and exits'
+inputs:
+- name: 'person_name'
+  desc: 'An optional name of a person to greet'
+  not_a_real_field: 'oops'
+
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'`,
+			wantUnmarshalErr: `at line 8 column 3: unknown field name "not_a_real_field"`,
+		},
+		{
+			name: "file_metadata",
+			in: `desc: 'A template that preserves file metadata'
+file_metadata: 'preserve'
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'`,
+			want: &Spec{
+				Desc:         mdl.S("A template that preserves file metadata"),
+				FileMetadata: mdl.S("preserve"),
+				Steps: []*Step{
+					{
+						Desc:   mdl.S("Print a message"),
+						Action: mdl.S("print"),
+						Print: &Print{
+							Message: mdl.S("Hello"),
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "invalid_file_metadata",
+			in: `desc: 'A template with a bad file_metadata'
+file_metadata: 'everything'
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'`,
+			wantValidateErr: []string{`at line 2 column 16: "file_metadata" must be one of [permissions preserve xattrs]`},
+		},
+		{
+			name: "deprecated",
+			in: `desc: 'An old template'
+deprecated:
+  message: 'Use the new one'
+  replaced_by: 'github.com/foo/bar/new@latest'
+  compatible: true
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'`,
+			want: &Spec{
+				Desc: mdl.S("An old template"),
+				Deprecated: &Deprecated{
+					Message:    mdl.S("Use the new one"),
+					ReplacedBy: mdl.S("github.com/foo/bar/new@latest"),
+					Compatible: model.Bool{Val: true},
+				},
+				Steps: []*Step{
+					{
+						Desc:   mdl.S("Print a message"),
+						Action: mdl.S("print"),
+						Print: &Print{
+							Message: mdl.S("Hello"),
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "deprecated_without_message",
+			in: `desc: 'An old template'
+deprecated:
+  replaced_by: 'github.com/foo/bar/new@latest'
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'`,
+			wantValidateErr: []string{`field "message" is required`},
+		},
+		{
+			name: "deprecated_compatible_without_replaced_by",
+			in: `desc: 'An old template'
+deprecated:
+  message: 'Just stop'
+  compatible: true
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'`,
+			wantValidateErr: []string{`at line 4 column 15: "compatible" can only be used with "replaced_by"`},
+		},
+		{
+			name: "input_migrations",
+			in: `desc: 'A template with a renamed input'
+inputs:
+- name: 'app_name'
+  desc: 'The name of the app'
+input_migrations:
+- from_versions: '< 2.0.0'
+  inputs:
+  - name: 'app_name'
+    value: 'service_name'
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'`,
+			want: &Spec{
+				Desc: mdl.S("A template with a renamed input"),
+				Inputs: []*Input{
+					{
+						Name: mdl.S("app_name"),
+						Desc: mdl.S("The name of the app"),
+					},
+				},
+				InputMigrations: []*InputMigration{
+					{
+						FromVersions: mdl.S("< 2.0.0"),
+						Inputs: []*InputMapping{
+							{
+								Name:  mdl.S("app_name"),
+								Value: mdl.S("service_name"),
+							},
+						},
+					},
+				},
+				Steps: []*Step{
+					{
+						Desc:   mdl.S("Print a message"),
+						Action: mdl.S("print"),
+						Print: &Print{
+							Message: mdl.S("Hello"),
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "outputs",
+			in: `desc: 'A template with outputs'
+outputs:
+- name: 'service_url'
+  desc: 'Where the service runs'
+  value: '"https://example.com"'
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'`,
+			want: &Spec{
+				Desc: mdl.S("A template with outputs"),
+				Outputs: []*Output{
+					{
+						Name:  mdl.S("service_url"),
+						Desc:  mdl.S("Where the service runs"),
+						Value: mdl.S(`"https://example.com"`),
+					},
+				},
+				Steps: []*Step{
+					{
+						Desc:   mdl.S("Print a message"),
+						Action: mdl.S("print"),
+						Print: &Print{
+							Message: mdl.S("Hello"),
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "outputs_duplicate_name",
+			in: `desc: 'A template with outputs'
+outputs:
+- name: 'service_url'
+  value: '"a"'
+- name: 'service_url'
+  value: '"b"'
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'`,
+			wantValidateErr: []string{`at line 5 column 9: duplicate output name "service_url"`},
+		},
+		{
+			name: "merge_strategies",
+			in: `desc: 'A template with merge strategies'
+merge_strategies:
+- paths: ['package-lock.json', 'gen/*.json']
+  strategy: 'theirs'
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'`,
+			want: &Spec{
+				Desc: mdl.S("A template with merge strategies"),
+				MergeStrategies: []*MergeStrategy{
+					{
+						Paths:    []model.String{mdl.S("package-lock.json"), mdl.S("gen/*.json")},
+						Strategy: mdl.S("theirs"),
+					},
+				},
+				Steps: []*Step{
+					{
+						Desc:   mdl.S("Print a message"),
+						Action: mdl.S("print"),
+						Print: &Print{
+							Message: mdl.S("Hello"),
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "merge_strategies_unknown_strategy",
+			in: `desc: 'A template with merge strategies'
+merge_strategies:
+- paths: ['package-lock.json']
+  strategy: 'newest'
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'`,
+			wantValidateErr: []string{`field "strategy" value was "newest" but must be one of [ours theirs union json-deep-merge]`},
+		},
+		{
+			name: "merge_strategies_bad_glob",
+			in: `desc: 'A template with merge strategies'
+merge_strategies:
+- paths: ['[']
+  strategy: 'ours'
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'`,
+			wantValidateErr: []string{`invalid glob pattern "["`},
+		},
+		{
+			name: "merge_strategies_missing_paths",
+			in: `desc: 'A template with merge strategies'
+merge_strategies:
+- strategy: 'ours'
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'`,
+			wantValidateErr: []string{`field "paths" is required`},
+		},
+		{
+			name: "template_engine",
+			in: `desc: 'A jinja2 template'
+template_engine: 'jinja2'
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'`,
+			want: &Spec{
+				Desc:           mdl.S("A jinja2 template"),
+				TemplateEngine: mdl.S("jinja2"),
+				Steps: []*Step{
+					{
+						Desc:   mdl.S("Print a message"),
+						Action: mdl.S("print"),
+						Print: &Print{
+							Message: mdl.S("Hello"),
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "template_engine_unknown",
+			in: `desc: 'A mustache template'
+template_engine: 'mustache'
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'`,
+			wantValidateErr: []string{`field "template_engine" value was "mustache" but must be one of [go jinja2]`},
+		},
+		{
+			name: "outputs_missing_value",
+			in: `desc: 'A template with outputs'
+outputs:
+- name: 'service_url'
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'`,
+			wantValidateErr: []string{`field "value" is required`},
+		},
+		{
+			name: "input_migrations_bad_constraint",
+			in: `desc: 'A template with a renamed input'
+inputs:
+- name: 'app_name'
+  desc: 'The name of the app'
+input_migrations:
+- from_versions: 'not a version'
+  inputs:
+  - name: 'app_name'
+    value: 'service_name'
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'`,
+			wantValidateErr: []string{`"from_versions" is not a valid semver constraint`},
+		},
+		{
+			name: "input_migrations_unknown_target",
+			in: `desc: 'A template with a renamed input'
+inputs:
+- name: 'app_name'
+  desc: 'The name of the app'
+input_migrations:
+- inputs:
+  - name: 'application_name'
+    value: 'service_name'
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'`,
+			wantValidateErr: []string{`at line 7 column 11: input migration target "application_name" is not an input of this template`},
+		},
+		{
+			name: "upgrade_hooks",
+			in: `desc: 'A template with upgrade hooks'
+pre_upgrade:
+- desc: 'Discard the generated lockfile'
+  if: '_from_version != _to_version'
+  action: 'delete'
+  params:
+    paths: ['gen/*.lock']
+post_upgrade:
+- desc: 'Print migration notes'
+  action: 'print'
+  params:
+    message: 'Upgraded from {{._from_version}} to {{._to_version}}'
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'`,
+			want: &Spec{
+				Desc: mdl.S("A template with upgrade hooks"),
+				PreUpgrade: []*UpgradeHook{
+					{
+						Desc:   mdl.S("Discard the generated lockfile"),
+						If:     mdl.S("_from_version != _to_version"),
+						Action: mdl.S("delete"),
+						Delete: &DeleteFiles{
+							Paths: []model.String{mdl.S("gen/*.lock")},
+						},
+					},
+				},
+				PostUpgrade: []*UpgradeHook{
+					{
+						Desc:   mdl.S("Print migration notes"),
+						Action: mdl.S("print"),
+						Print: &Print{
+							Message: mdl.S("Upgraded from {{._from_version}} to {{._to_version}}"),
+						},
+					},
+				},
+				Steps: []*Step{
+					{
+						Desc:   mdl.S("Print a message"),
+						Action: mdl.S("print"),
+						Print: &Print{
+							Message: mdl.S("Hello"),
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "upgrade_hook_unknown_action",
+			in: `desc: 'A template with upgrade hooks'
+pre_upgrade:
+- desc: 'Include something'
+  action: 'include'
+  params:
+    paths: ['.']
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'`,
+			wantUnmarshalErr: `unknown upgrade hook action type "include", must be "delete" or "print"`,
+		},
+		{
+			name: "upgrade_hook_delete_missing_paths",
+			in: `desc: 'A template with upgrade hooks'
+pre_upgrade:
+- desc: 'Delete nothing'
+  action: 'delete'
+  params: {}
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'`,
+			wantValidateErr: []string{`field "paths" is required`},
+		},
+		{
+			name: "upgrade_hook_missing_desc",
+			in: `desc: 'A template with upgrade hooks'
+post_upgrade:
+- action: 'print'
+  params:
+    message: 'Hello'
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'`,
+			wantValidateErr: []string{`field "desc" is required`},
+		},
+		{
+			name: "post_upgrade_delete",
+			in: `desc: 'A template with upgrade hooks'
+post_upgrade:
+- desc: 'Discard the generated lockfile'
+  action: 'delete'
+  params:
+    paths: ['gen/*.lock']
+steps:
+- desc: 'Print a message'
+  action: 'print'
+  params:
+    message: 'Hello'`,
+			wantValidateErr: []string{`the "delete" action is only allowed in pre_upgrade, not post_upgrade`},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			got := &Spec{}
+
+			dec := yaml.NewDecoder(strings.NewReader(tc.in))
+			err := dec.Decode(got)
+			if diff := testutil.DiffErrString(err, tc.wantUnmarshalErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			err = got.Validate()
+			for _, wantValidateErr := range tc.wantValidateErr {
+				if diff := testutil.DiffErrString(err, wantValidateErr); diff != "" {
+					t.Fatal(diff)
+				}
+			}
+			if err != nil {
+				return
+			}
+
+			opt := cmpopts.IgnoreTypes(&model.ConfigPos{}, model.ConfigPos{}) // don't force test authors to assert the line and column numbers
+			if diff := cmp.Diff(got, tc.want, opt); diff != "" {
+				t.Errorf("unmarshaling didn't yield expected struct. Diff (-got +want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestUnmarshalInput(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name             string
+		in               string
+		want             *Input
+		wantUnmarshalErr string
+		wantValidateErr  string
+	}{
+		{
+			name: "simple_case_should_pass",
+			in: `name: 'person_name'
+desc: "The name of a person to greet"
+default: "default"`,
+			want: &Input{
+				Name:    mdl.S("person_name"),
+				Desc:    mdl.S("The name of a person to greet"),
+				Default: mdl.SP("default"),
+			},
+		},
+		{
+			name: "missing_default_is_nil",
+			in: `name: 'person_name'
+desc: "The name of a person to greet"`,
+			want: &Input{
+				Name:    mdl.S("person_name"),
+				Desc:    mdl.S("The name of a person to greet"),
+				Default: nil,
+			},
+		},
+		{
+			name:            "missing_required_fields_should_fail",
+			in:              `desc: 'a thing'`,
+			wantValidateErr: `at line 1 column 1: field "name" is required`,
+		},
+		{
+			name: "unexpected_field_should_fail",
+			in: `name: 'a'
+desc: 'b'
+nonexistent_field: 'oops'`,
+			wantUnmarshalErr: `at line 3 column 1: unknown field name "nonexistent_field"`,
+		},
+		{
+			name: "reserved_input_name",
+			in: `desc: 'foo'
+name: '_name_with_leading_underscore'`,
+			wantValidateErr: "are reserved",
+		},
+		{
+			name: "validation_rule",
+			in: `desc: 'foo'
+name: 'a'
+rules:
+  - rule: 'size(a) > 5'
+    message: 'my message'`,
+			want: &Input{
+				Name: mdl.S("a"),
+				Desc: mdl.S("foo"),
+				Rules: []*Rule{
+					{
+						Rule:    mdl.S("size(a) > 5"),
+						Message: mdl.S("my message"),
+					},
+				},
+			},
+		},
+		{
+			name: "validation_rule_without_message",
+			in: `desc: 'foo'
+name: 'a'
+rules:
+  - rule: 'size(a) > 5'`,
+			want: &Input{
+				Name: mdl.S("a"),
+				Desc: mdl.S("foo"),
+				Rules: []*Rule{
+					{
+						Rule: mdl.S("size(a) > 5"),
+					},
+				},
+			},
+		},
+		{
+			name: "multiple_validation_rules",
+			in: `desc: 'foo'
+name: 'a'
+rules:
+  - rule: 'size(a) > 5'
+    message: 'my message'
+  - rule: 'size(a) < 100'
+    message: 'my other message'`,
+			want: &Input{
+				Name: mdl.S("a"),
+				Desc: mdl.S("foo"),
+				Rules: []*Rule{
+					{
+						Rule:    mdl.S("size(a) > 5"),
+						Message: mdl.S("my message"),
+					},
+					{
+						Rule:    mdl.S("size(a) < 100"),
+						Message: mdl.S("my other message"),
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			got := &Input{}
+			dec := yaml.NewDecoder(strings.NewReader(tc.in))
+			err := dec.Decode(got)
+			if diff := testutil.DiffErrString(err, tc.wantUnmarshalErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			err = got.Validate()
+			if diff := testutil.DiffErrString(err, tc.wantValidateErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			if diff := cmp.Diff(got, tc.want, cmpopts.IgnoreTypes(&model.ConfigPos{}, model.ConfigPos{})); diff != "" {
+				t.Errorf("unmarshaling didn't yield expected struct. Diff (-got +want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestUnmarshalStep(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name             string
+		in               string
+		want             *Step
+		wantUnmarshalErr string
+		wantValidateErr  string
+	}{
+		{
+			name: "append_success",
+			in: `desc: 'mydesc'
+action: 'append'
+params:
+  paths: ['a.txt', 'b.txt']
+  with: 'jkl'
+  skip_ensure_newline: true`,
+			want: &Step{
+				Desc:   mdl.S("mydesc"),
+				Action: mdl.S("append"),
+				Append: &Append{
+					Paths:             mdl.Strings("a.txt", "b.txt"),
+					With:              mdl.S("jkl"),
+					SkipEnsureNewline: model.Bool{Val: true},
+				},
+			},
+		},
+		{
+			name: "append_missing_with_field_should_fail",
+			in: `desc: 'mydesc'
+action: 'append'
+params:
+  paths: ['a.txt']`,
+			wantValidateErr: `at line 4 column 3: field "with" is required`,
+		},
+		{
+			name: "append_missing_paths_field_should_fail",
+			in: `desc: 'mydesc'
+action: 'append'
+params:
+  with: 'def'`,
+			wantValidateErr: `at line 4 column 3: field "paths" is required`,
+		},
+		{
+			name: "append_non_bool_skip_ensure_newline_field_should_fail",
+			in: `desc: 'mydesc'
+action: 'append'
+params:
+  paths: ['a.txt']
+  with: 'jkl'
+  skip_ensure_newline: pizza`,
+			wantUnmarshalErr: "cannot unmarshal !!str `pizza` into bool",
+		},
+		{
+			name: "print_success",
+			in: `desc: 'Print a message'
+action: 'print'
+params:
+  message: 'Hello'`,
+			want: &Step{
+				Desc:   mdl.S("Print a message"),
+				Action: mdl.S("print"),
+				Print: &Print{
+					Message: mdl.S("Hello"),
+				},
+			},
+		},
+		{
+			name: "print_empty_message",
+			in: `desc: 'Print a message'
+action: 'print'
+params:
+  message: ''`,
+			wantValidateErr: `field "message" is required`,
+		},
+		{
+			name: "print_empty_message",
+			in: `desc: 'Print a message'
+action: 'print'
+params:
+  message: 'hello'
+  extra_field: 'oops'`,
+			wantUnmarshalErr: `at line 5 column 3: unknown field name "extra_field"`,
+		},
+		{
+			name: "print_markdown_format",
+			in: `desc: 'Print a message'
+action: 'print'
+params:
+  message: '# Next steps'
+  format: 'markdown'`,
+			want: &Step{
+				Desc:   mdl.S("Print a message"),
+				Action: mdl.S("print"),
+				Print: &Print{
+					Message: mdl.S("# Next steps"),
+					Format:  mdl.S("markdown"),
+				},
+			},
+		},
+		{
+			name: "print_unknown_format",
+			in: `desc: 'Print a message'
+action: 'print'
+params:
+  message: 'hello'
+  format: 'html'`,
+			wantValidateErr: `field "format" value was "html" but must be one of [text markdown]`,
+		},
+		{
+			name: "print_missing_message",
+			in: `desc: 'Print a message'
+action: 'print'
+params: `,
+			wantValidateErr: `at line 1 column 1: field "message" is required`,
+		},
+		{
+			name: "include_success_paths_are_string", // not path objects, paths are just strings
+			in: `desc: 'mydesc'
+action: 'include'
+params:
+  paths: ['a/b/c', 'x/y.txt']
+  from: 'destination'`,
+			want: &Step{
+				Desc:   mdl.S("mydesc"),
+				Action: mdl.S("include"),
+				Include: &Include{
+					Paths: []*IncludePath{
+						{
+							From:  mdl.S("destination"),
+							Paths: mdl.Strings("a/b/c", "x/y.txt"),
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "include_success_paths_are_objects",
+			in: `desc: 'mydesc'
+action: 'include'
+params:
+  paths: 
+  - paths: ['a/b/c', 'x/y.txt']
+    from: 'destination'`,
+			want: &Step{
+				Desc:   mdl.S("mydesc"),
+				Action: mdl.S("include"),
+				Include: &Include{
+					Paths: []*IncludePath{
+						{
+							From:  mdl.S("destination"),
+							Paths: mdl.Strings("a/b/c", "x/y.txt"),
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "include_with_as",
+			in: `desc: 'mydesc'
+action: 'include'
+params:
+  paths:
+    - paths: ['a/b/c', 'd/e/f']
+      as: ['x/y/z', 'q/r/s']`,
+			want: &Step{
+				Desc:   mdl.S("mydesc"),
+				Action: mdl.S("include"),
+				Include: &Include{
+					Paths: []*IncludePath{
+						{
+							Paths: mdl.Strings("a/b/c", "d/e/f"),
+							As:    mdl.Strings("x/y/z", "q/r/s"),
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "include_with_skip",
+			in: `desc: 'mydesc'
+action: 'include'
+params:
+  paths:
+    - paths: ['.']
+      skip: ['x/y']`,
+			want: &Step{
+				Desc:   mdl.S("mydesc"),
+				Action: mdl.S("include"),
+				Include: &Include{
+					Paths: []*IncludePath{
+						{
+							Paths: mdl.Strings("."),
+							Skip:  mdl.Strings("x/y"),
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "include_from_destination",
+			in: `desc: 'mydesc'
+action: 'include'
+params:
+  paths:
+    - paths: ['.']
+      from: 'destination'`,
+			want: &Step{
+				Desc:   mdl.S("mydesc"),
+				Action: mdl.S("include"),
+				Include: &Include{
+					Paths: []*IncludePath{
+						{
+							Paths: mdl.Strings("."),
+							From:  mdl.S("destination"),
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "include_from_destination_skip_gitignore",
+			in: `desc: 'mydesc'
+action: 'include'
+params:
+  paths: ['.']
+  from: 'destination'
+  skip_gitignore: true`,
+			want: &Step{
+				Desc:   mdl.S("mydesc"),
+				Action: mdl.S("include"),
+				Include: &Include{
+					Paths: []*IncludePath{
+						{
+							Paths:         mdl.Strings("."),
+							From:          mdl.S("destination"),
+							SkipGitignore: model.Bool{Val: true},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "include_skip_gitignore_without_from_destination",
+			in: `desc: 'mydesc'
+action: 'include'
+params:
+  paths: ['.']
+  skip_gitignore: true`,
+			want: &Step{
+				Desc:   mdl.S("mydesc"),
+				Action: mdl.S("include"),
+				Include: &Include{
+					Paths: []*IncludePath{
+						{
+							Paths:         mdl.Strings("."),
+							SkipGitignore: model.Bool{Val: true},
+						},
+					},
+				},
+			},
+			wantValidateErr: `"skip_gitignore" can only be used with "from: destination"`,
+		},
+		{
+			name: "include_from_remote",
+			in: `desc: 'mydesc'
+action: 'include'
+params:
+  paths: ['Makefile']
+  from: 'remote'
+  source: 'github.com/myorg/shared'
+  version: 'v1.2.3'`,
+			want: &Step{
+				Desc:   mdl.S("mydesc"),
+				Action: mdl.S("include"),
+				Include: &Include{
+					Paths: []*IncludePath{
+						{
+							Paths:   mdl.Strings("Makefile"),
+							From:    mdl.S("remote"),
+							Source:  mdl.S("github.com/myorg/shared"),
+							Version: mdl.S("v1.2.3"),
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "include_from_remote_without_source",
+			in: `desc: 'mydesc'
+action: 'include'
+params:
+  paths: ['Makefile']
+  from: 'remote'`,
+			wantValidateErr: `field "source" is required`,
+		},
+		{
+			name: "include_from_remote_version_twice",
+			in: `desc: 'mydesc'
+action: 'include'
+params:
+  paths: ['Makefile']
+  from: 'remote'
+  source: 'github.com/myorg/shared@v1.2.3'
+  version: 'v1.2.4'`,
+			wantValidateErr: `"version" can't be used when "source" already has an "@version"`,
+		},
+		{
+			name: "include_source_without_from_remote",
+			in: `desc: 'mydesc'
+action: 'include'
+params:
+  paths: ['Makefile']
+  source: 'github.com/myorg/shared@v1.2.3'`,
+			wantValidateErr: `"source" can only be used with "from: remote"`,
+		},
+		{
+			name: "include_paths_heterogeneous_list",
+			in: `desc: 'mydesc'
+action: 'include'
+params:
+  paths:
+    - 'a.txt'
+    - paths: ['b.txt']`,
+			wantUnmarshalErr: "Lists of paths must be homogeneous, either all strings or all objects",
+		},
+		{
+			name: "other_include_fields_forbidden_with_path_objects",
+			in: `desc: 'mydesc'
+action: 'include'
+params:
+  from: 'destination'
+  paths:
+    - paths: 
+      - 'a.txt'`,
+			wantUnmarshalErr: `unknown field name "from"`,
+		},
+		{
+			name: "include_from_invalid",
+			in: `desc: 'mydesc'
+action: 'include'
+params:
+  paths:
+    - paths: ['.']
+      from: 'invalid'`,
+			want: &Step{
+				Desc:   mdl.S("mydesc"),
+				Action: mdl.S("include"),
+				Include: &Include{
+					Paths: []*IncludePath{
+						{
+							Paths: mdl.Strings("."),
+							From:  mdl.S("invalid"),
+						},
+					},
+				},
+			},
+			wantValidateErr: `"from" must be one of`,
+		},
+		{
+			name: "wrong_number_of_as_paths",
+			in: `desc: 'mydesc'
+action: 'include'
+params:
+  paths:
+    - paths: ['a/b/c', 'd/e/f']
+      as: ['x/y/z', 'q/r/s', 't/u/v']`,
+			want: &Step{
+				Desc:   mdl.S("mydesc"),
+				Action: mdl.S("include"),
+				Include: &Include{
+					Paths: []*IncludePath{
+						{
+							Paths: mdl.Strings("a/b/c", "d/e/f"),
+							As:    mdl.Strings("x/y/z", "q/r/s", "t/u/v"),
+						},
+					},
+				},
+			},
+			wantValidateErr: `the size of "as" (3) must be the same as the size of "paths" (2)`,
+		},
+		{
+			name: "missing_action_field_should_fail",
+			in: `desc: 'mydesc'
+params:
+  paths:
+    - 'a/b/c'
+    - 'x/y.txt'`,
+			wantUnmarshalErr: `missing "action" field`,
+		},
+		{
+			name: "empty_include_paths_should_fail",
+			in: `desc: 'mydesc'
+action: 'include'
+params:
+  paths: []`,
+			wantValidateErr: `at line 4 column 3: field "paths" is required`,
+		},
+		{
+			name: "missing_include_paths_should_fail",
+			in: `desc: 'mydesc'
+action: 'include'
+params:`,
+			wantValidateErr: `at line 1 column 1: field "paths" is required`,
+		},
+		{
+			name: "unknown_params_should_fail",
+			in: `desc: 'mydesc'
+action: 'include'
+params:
+  nonexistent: 'foo'
+  paths: ['a.txt']`,
+			wantUnmarshalErr: `at line 4 column 3: unknown field name "nonexistent"`,
+		},
+		{
+			name: "regex_replace_success",
+			in: `desc: 'mydesc'
+action: 'regex_replace'
+params:
+  paths: ['a.txt', 'b.txt']
+  replacements:
+  - regex: 'my_(?P<groupname>regex)'
+    subgroup_to_replace: 'groupname'
+    with: 'some_template'
+  - regex: 'my_other_regex'
+    with: 'whatever'`,
+			want: &Step{
+				Desc:   mdl.S("mydesc"),
+				Action: mdl.S("regex_replace"),
+				RegexReplace: &RegexReplace{
+					Paths: mdl.Strings("a.txt", "b.txt"),
+					Replacements: []*RegexReplaceEntry{
+						{
+							Regex:             mdl.S("my_(?P<groupname>regex)"),
+							SubgroupToReplace: mdl.S("groupname"),
+							With:              mdl.S("some_template"),
+						},
+						{
+							Regex: mdl.S("my_other_regex"),
+							With:  mdl.S("whatever"),
+						},
+					},
+				},
+			},
+		},
+
+		{
+			name: "regex_replace_invalid_subgroup_should_fail",
+			in: `desc: 'mydesc'
+action: 'regex_replace'
+params:
+  paths: ['a.txt']
+  replacements:
+  - regex: '(?p<x>y)'
+    subgroup_to_replace: 1
+    with: 'some_template'`,
+			wantValidateErr: `at line 7 column 26: subgroup name must be a letter followed by zero or more alphanumerics`,
+		},
+		{
+			name: "regex_missing_fields_should_fail",
+			in: `desc: 'mydesc'
+action: 'regex_replace'
+params:
+  paths: ['a.txt']
+  replacements:
+  - subgroup_to_replace: xyz`,
+			wantValidateErr: `at line 6 column 5: field "regex" is required
+at line 6 column 5: field "with" is required`,
+		},
+
+		{
+			name: "regex_replace_negative_numbered_subgroup_should_fail",
+			in: `desc: 'mydesc'
+action: 'regex_replace'
+params:
+  paths: ['a.txt']
+  replacements:
+  - regex: 'my_regex'
+    subgroup_to_replace: -1
+    with: 'some_template'`,
+			wantValidateErr: `at line 7 column 26: subgroup name must be a letter followed by zero or more alphanumerics`,
+		},
+		{
+			name: "regex_missing_fields_should_fail",
+			in: `desc: 'mydesc'
+action: 'regex_replace'
+params:
+  paths: ['a.txt']
+  replacements:
+  - subgroup_to_replace: xyz`,
+			wantValidateErr: `at line 6 column 5: field "regex" is required
+at line 6 column 5: field "with" is required`,
+		},
+		{
+			name: "regex_name_lookup_success",
+			in: `desc: 'mydesc'
+action: 'regex_name_lookup'
+params:
+  paths: ['a.txt', 'b.txt']
+  replacements:
+  - regex: '(?P<mygroup>myregex'
+  - regex: '(?P<myothergroup>myotherregex'`,
+			want: &Step{
+				Desc:   mdl.S("mydesc"),
+				Action: mdl.S("regex_name_lookup"),
+				RegexNameLookup: &RegexNameLookup{
+					Paths: mdl.Strings("a.txt", "b.txt"),
+					Replacements: []*RegexNameLookupEntry{
+						{Regex: mdl.S("(?P<mygroup>myregex")},
+						{Regex: mdl.S("(?P<myothergroup>myotherregex")},
+					},
+				},
+			},
+		},
+		{
+			name: "regex_name_lookup_extra_fields_should_fail",
+			in: `desc: 'mydesc'
+action: 'regex_name_lookup'
+params:
+  paths: ['a.txt']
+  replacements:
+  - fakefield: 'abc' `,
+			wantUnmarshalErr: `unknown field name "fakefield"`,
+		},
+		{
+			name: "string_replace_success",
+			in: `desc: 'mydesc'
+action: 'string_replace'
+params:
+  paths: ['a.txt', 'b.txt']
+  replacements:
+  - to_replace: 'abc'
+    with: 'def'
+  - to_replace: 'ghi'
+    with: 'jkl'`,
+			want: &Step{
+				Desc:   mdl.S("mydesc"),
+				Action: mdl.S("string_replace"),
+				StringReplace: &StringReplace{
+					Paths: mdl.Strings("a.txt", "b.txt"),
+					Replacements: []*StringReplacement{
+						{
+							ToReplace: mdl.S("abc"),
+							With:      mdl.S("def"),
+						},
+						{
+							ToReplace: mdl.S("ghi"),
+							With:      mdl.S("jkl"),
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "string_replace_missing_replacements_field_should_fail",
+			in: `desc: 'mydesc'
+action: 'string_replace'
+params:
+  paths: ['a.txt']`,
+			wantValidateErr: `at line 4 column 3: field "replacements" is required`,
+		},
+		{
+			name: "string_replace_missing_paths_field_should_fail",
+			in: `desc: 'mydesc'
+action: 'string_replace'
+params:
+  replacements:
+  - to_replace: 'abc'
+    with: 'def'`,
+			wantValidateErr: `at line 4 column 3: field "paths" is required`,
+		},
+		{
+			name: "go_template_success",
+			in: `desc: 'mydesc'
+action: 'go_template'
+params:
+  paths: ['my/path/1', 'my/path/2']`,
+			want: &Step{
+				Desc:   mdl.S("mydesc"),
+				Action: mdl.S("go_template"),
+				GoTemplate: &GoTemplate{
+					Paths: mdl.Strings("my/path/1", "my/path/2"),
+				},
+			},
+		},
+		{
+			name: "go_template_missing_paths_should_fail",
+			in: `desc: 'mydesc'
+action: 'go_template'
+params:
+  paths: []`,
+			wantValidateErr: `at line 4 column 3: field "paths" is required`,
+		},
+		{
+			name: "step_timeout_and_retries",
+			in: `desc: 'mydesc'
+action: 'go_template'
+timeout: '30s'
+retries: 3
+params:
+  paths: ['.']`,
+			want: &Step{
+				Desc:    mdl.S("mydesc"),
+				Action:  mdl.S("go_template"),
+				Timeout: mdl.S("30s"),
+				Retries: model.Int{Val: 3},
+				GoTemplate: &GoTemplate{
+					Paths: mdl.Strings("."),
+				},
+			},
+		},
+		{
+			name: "step_bad_timeout",
+			in: `desc: 'mydesc'
+action: 'go_template'
+timeout: '30 seconds'
+params:
+  paths: ['.']`,
+			wantValidateErr: `"timeout" must be a duration like "30s" or "5m"`,
+		},
+		{
+			name: "step_negative_timeout",
+			in: `desc: 'mydesc'
+action: 'go_template'
+timeout: '-1s'
+params:
+  paths: ['.']`,
+			wantValidateErr: `"timeout" must be positive, but was "-1s"`,
+		},
+		{
+			name: "step_too_many_retries",
+			in: `desc: 'mydesc'
+action: 'go_template'
+retries: 11
+params:
+  paths: ['.']`,
+			wantValidateErr: `"retries" must be between 0 and 10, but was 11`,
+		},
+		{
+			name: "go_template_engine",
+			in: `desc: 'mydesc'
+action: 'go_template'
+params:
+  paths: ['my/path/1']
+  template_engine: 'jinja2'`,
+			want: &Step{
+				Desc:   mdl.S("mydesc"),
+				Action: mdl.S("go_template"),
+				GoTemplate: &GoTemplate{
+					Paths:          mdl.Strings("my/path/1"),
+					TemplateEngine: mdl.S("jinja2"),
+				},
+			},
+		},
+		{
+			name: "go_template_unknown_engine",
+			in: `desc: 'mydesc'
+action: 'go_template'
+params:
+  paths: ['my/path/1']
+  template_engine: 'erb'`,
+			wantValidateErr: `field "template_engine" value was "erb" but must be one of [go jinja2]`,
+		},
+		{
+			name: "go_template_delimiters_and_verbatim",
+			in: `desc: 'mydesc'
+action: 'go_template'
+params:
+  paths: ['.']
+  delimiters: ['[[', ']]']
+  verbatim: ['chart/templates', '*.tpl']`,
+			want: &Step{
+				Desc:   mdl.S("mydesc"),
+				Action: mdl.S("go_template"),
+				GoTemplate: &GoTemplate{
+					Paths:      mdl.Strings("."),
+					Delimiters: mdl.Strings("[[", "]]"),
+					Verbatim:   mdl.Strings("chart/templates", "*.tpl"),
+				},
+			},
+		},
+		{
+			name: "go_template_one_delimiter",
+			in: `desc: 'mydesc'
+action: 'go_template'
+params:
+  paths: ['.']
+  delimiters: ['[[']`,
+			wantValidateErr: `"delimiters" must have exactly two elements, the left and right delimiters, but had 1`,
+		},
+		{
+			name: "go_template_empty_delimiter",
+			in: `desc: 'mydesc'
+action: 'go_template'
+params:
+  paths: ['.']
+  delimiters: ['[[', '']`,
+			wantValidateErr: `"delimiters" must not contain empty strings`,
+		},
+		{
+			name: "go_template_delimiters_with_jinja2",
+			in: `desc: 'mydesc'
+action: 'go_template'
+params:
+  paths: ['.']
+  template_engine: 'jinja2'
+  delimiters: ['[[', ']]']`,
+			wantValidateErr: `"delimiters" can't be used with template_engine "jinja2"`,
+		},
+		{
+			name: "go_template_missing_keys",
+			in: `desc: 'mydesc'
+action: 'go_template'
+params:
+  paths: ['.']
+  missing_keys: 'warn'`,
+			want: &Step{
+				Desc:   mdl.S("mydesc"),
+				Action: mdl.S("go_template"),
+				GoTemplate: &GoTemplate{
+					Paths:       mdl.Strings("."),
+					MissingKeys: mdl.S("warn"),
+				},
+			},
+		},
+		{
+			name: "go_template_unknown_missing_keys",
+			in: `desc: 'mydesc'
+action: 'go_template'
+params:
+  paths: ['.']
+  missing_keys: 'ignore'`,
+			wantValidateErr: `field "missing_keys" value was "ignore" but must be one of [error zero warn]`,
+		},
+		{
+			name: "go_template_missing_keys_with_jinja2",
+			in: `desc: 'mydesc'
+action: 'go_template'
+params:
+  paths: ['.']
+  template_engine: 'jinja2'
+  missing_keys: 'zero'`,
+			wantValidateErr: `"missing_keys" can't be used with template_engine "jinja2"`,
+		},
+		{
+			name: "go_template_bad_verbatim_glob",
+			in: `desc: 'mydesc'
+action: 'go_template'
+params:
+  paths: ['.']
+  verbatim: ['[']`,
+			wantValidateErr: `invalid glob pattern "["`,
+		},
+		{
+			name: "wasm_success",
+			in: `desc: 'mydesc'
+action: 'wasm'
+params:
+  module: 'plugins/my_action.wasm'
+  args: ['--flag', '{{.my_input}}']`,
+			want: &Step{
+				Desc:   mdl.S("mydesc"),
+				Action: mdl.S("wasm"),
+				Wasm: &Wasm{
+					Module: mdl.S("plugins/my_action.wasm"),
+					Args:   mdl.Strings("--flag", "{{.my_input}}"),
+				},
+			},
+		},
+		{
+			name: "go_mod_edit_success",
+			in: `desc: 'mydesc'
+action: 'go_mod_edit'
+params:
+  paths: ['go.mod']
+  module: 'github.com/{{.org}}/{{.name}}'
+  go_version: '1.22'
+  requires:
+    - path: 'github.com/abcxyz/pkg'
+      version: 'v1.2.0'
+  replaces:
+    - old: 'github.com/abcxyz/pkg'
+      new: '../pkg'`,
+			want: &Step{
+				Desc:   mdl.S("mydesc"),
+				Action: mdl.S("go_mod_edit"),
+				GoModEdit: &GoModEdit{
+					Paths:     mdl.Strings("go.mod"),
+					Module:    mdl.S("github.com/{{.org}}/{{.name}}"),
+					GoVersion: mdl.S("1.22"),
+					Requires: []*GoModRequire{
+						{Path: mdl.S("github.com/abcxyz/pkg"), Version: mdl.S("v1.2.0")},
+					},
+					Replaces: []*GoModReplace{
+						{Old: mdl.S("github.com/abcxyz/pkg"), New: mdl.S("../pkg")},
+					},
+				},
+			},
+		},
+		{
+			name: "go_mod_edit_nothing_to_do_should_fail",
+			in: `desc: 'mydesc'
+action: 'go_mod_edit'
+params:
+  paths: ['go.mod']`,
+			wantValidateErr: `at least one of "module", "go_version", "requires", or "replaces" must be given`,
+		},
+		{
+			name: "go_mod_edit_require_missing_version_should_fail",
+			in: `desc: 'mydesc'
+action: 'go_mod_edit'
+params:
+  paths: ['go.mod']
+  requires:
+    - path: 'github.com/abcxyz/pkg'`,
+			wantValidateErr: `field "version" is required`,
+		},
+		{
+			name: "license_header_success",
+			in: `desc: 'mydesc'
+action: 'license_header'
+params:
+  paths: ['.']
+  text: 'Copyright {{.year}} {{.holder}}'
+  skip_if_contains: 'Copyright'`,
+			want: &Step{
+				Desc:   mdl.S("mydesc"),
+				Action: mdl.S("license_header"),
+				LicenseHeader: &LicenseHeader{
+					Paths:          mdl.Strings("."),
+					Text:           mdl.S("Copyright {{.year}} {{.holder}}"),
+					SkipIfContains: mdl.S("Copyright"),
+				},
+			},
+		},
+		{
+			name: "license_header_missing_text_should_fail",
+			in: `desc: 'mydesc'
+action: 'license_header'
+params:
+  paths: ['.']`,
+			wantValidateErr: `field "text" is required`,
+		},
+		{
+			name: "buf_generate_success",
+			in: `desc: 'mydesc'
+action: 'buf_generate'
+params:
+  input: 'proto'
+  template: 'buf.gen.yaml'
+  output: 'gen'
+  paths: ['proto/api/v1']`,
+			want: &Step{
+				Desc:   mdl.S("mydesc"),
+				Action: mdl.S("buf_generate"),
+				BufGenerate: &BufGenerate{
+					Input:    mdl.S("proto"),
+					Template: mdl.S("buf.gen.yaml"),
+					Output:   mdl.S("gen"),
+					Paths:    mdl.Strings("proto/api/v1"),
+				},
+			},
+		},
+		{
+			name: "buf_generate_no_params",
+			in: `desc: 'mydesc'
+action: 'buf_generate'
+params: {}`,
+			want: &Step{
+				Desc:        mdl.S("mydesc"),
+				Action:      mdl.S("buf_generate"),
+				BufGenerate: &BufGenerate{},
+			},
+		},
+		{
+			name: "hcl_modify_success",
+			in: `desc: 'mydesc'
+action: 'hcl_modify'
+params:
+  paths: ['main.tf']
+  add_blocks:
+    - type: 'variable'
+      labels: ['project_id']
+      body: 'type = string'
+      if_exists: 'skip'
+  set_attributes:
+    - block: 'terraform.backend.gcs'
+      name: 'bucket'
+      value: '"{{.bucket}}"'`,
+			want: &Step{
+				Desc:   mdl.S("mydesc"),
+				Action: mdl.S("hcl_modify"),
+				HCLModify: &HCLModify{
+					Paths: mdl.Strings("main.tf"),
+					AddBlocks: []*HCLAddBlock{
+						{
+							Type:     mdl.S("variable"),
+							Labels:   mdl.Strings("project_id"),
+							Body:     mdl.S("type = string"),
+							IfExists: mdl.S("skip"),
+						},
+					},
+					SetAttributes: []*HCLSetAttribute{
+						{
+							Block: mdl.S("terraform.backend.gcs"),
+							Name:  mdl.S("bucket"),
+							Value: mdl.S(`"{{.bucket}}"`),
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "hcl_modify_nothing_to_do_should_fail",
+			in: `desc: 'mydesc'
+action: 'hcl_modify'
+params:
+  paths: ['main.tf']`,
+			wantValidateErr: `at least one of "add_blocks" or "set_attributes" must be given`,
+		},
+		{
+			name: "hcl_modify_invalid_if_exists_should_fail",
+			in: `desc: 'mydesc'
+action: 'hcl_modify'
+params:
+  paths: ['main.tf']
+  add_blocks:
+    - type: 'variable'
+      if_exists: 'merge'`,
+			wantValidateErr: `field "if_exists" value was "merge" but must be one of [error skip replace]`,
+		},
+		{
+			name: "hcl_modify_missing_value_should_fail",
+			in: `desc: 'mydesc'
+action: 'hcl_modify'
+params:
+  paths: ['main.tf']
+  set_attributes:
+    - name: 'bucket'`,
+			wantValidateErr: `field "value" is required`,
+		},
+		{
+			name: "wasm_missing_module_should_fail",
+			in: `desc: 'mydesc'
+action: 'wasm'
+params:
+  args: ['foo']`,
+			wantValidateErr: `at line 4 column 3: field "module" is required`,
+		},
+		{
+			name: "for_each_range_over_list",
+			in: `desc: 'mydesc'
+action: 'for_each'
+params:
+  iterator:
+    key: 'environment'
+    values: ['dev', 'prod']
+  steps:
+    - desc: 'print some stuff'
+      action: 'print'
+      params:
+        message: 'Hello, {{.name}}'
+    - desc: 'another action'
+      action: 'print'
+      params:
+        message: 'yet another message'
+`,
+			want: &Step{
+				Desc:   mdl.S("mydesc"),
+				Action: mdl.S("for_each"),
+				ForEach: &ForEach{
+					Iterator: &ForEachIterator{
+						Key:    mdl.S("environment"),
+						Values: mdl.Strings("dev", "prod"),
+					},
+					Steps: []*Step{
+						{
+							Desc:   mdl.S("print some stuff"),
+							Action: mdl.S("print"),
+							Print: &Print{
+								Message: mdl.S(`Hello, {{.name}}`),
+							},
+						},
+						{
+							Desc:   mdl.S("another action"),
+							Action: mdl.S("print"),
+							Print: &Print{
+								Message: mdl.S("yet another message"),
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "for_each_range_over_expression",
+			in: `desc: 'mydesc'
+action: 'for_each'
+params:
+  iterator:
+    key: 'environment'
+    values_from: 'my_cel_expression'
+  steps:
+    - desc: 'print some stuff'
+      action: 'print'
+      params:
+        message: 'Hello, {{.name}}'
+    - desc: 'another action'
+      action: 'print'
+      params:
+        message: 'yet another message'
+`,
+			want: &Step{
+				Desc:   mdl.S("mydesc"),
+				Action: mdl.S("for_each"),
+				ForEach: &ForEach{
+					Iterator: &ForEachIterator{
+						Key:        mdl.S("environment"),
+						ValuesFrom: mdl.SP("my_cel_expression"),
+					},
+					Steps: []*Step{
+						{
+							Desc:   mdl.S("print some stuff"),
+							Action: mdl.S("print"),
+							Print: &Print{
+								Message: mdl.S(`Hello, {{.name}}`),
+							},
+						},
+						{
+							Desc:   mdl.S("another action"),
+							Action: mdl.S("print"),
+							Print: &Print{
+								Message: mdl.S("yet another message"),
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "for_each_missing_values",
+			in: `desc: 'mydesc'
+action: 'for_each'
+params:
+  iterator:
+    key: 'environment'
+    # missing the "values" here
+  steps:
+    - desc: 'print some stuff'
+      action: 'print'
+      params:
+        message: 'Hello, {{.name}}'
+`,
+			wantValidateErr: `exactly one of the fields "values" or "values_from" must be set`,
+		},
+		{
+			name: "for_each_missing_key",
+			in: `desc: 'mydesc'
+action: 'for_each'
+params:
+  iterator:
+    # key: 'environment'
+    values: ['dev', 'prod']
+  steps:
+    - desc: 'print some stuff'
+      action: 'print'
+      params:
+        message: 'Hello, {{.name}}'
+`,
+			wantValidateErr: `field "key" is required`,
+		},
+		{
+			name: "for_each_missing_iterator",
+			in: `desc: 'mydesc'
+action: 'for_each'
+params:
+  steps:
+    - desc: 'print some stuff'
+      action: 'print'
+      params:
+        message: 'Hello, {{.name}}'
+`,
+			wantValidateErr: `field "iterator" is required`,
+		},
+		{
+			name: "for_each_values_and_values_from",
+			in: `desc: 'mydesc'
+action: 'for_each'
+params:
+  iterator:
+    key: 'environment'
+    values: ['dev', 'prod']
+    values_from: 'cel_expression'
+  steps:
+    - desc: 'print some stuff'
+      action: 'print'
+      params:
+        message: 'Hello, {{.name}}'
+`,
+			wantValidateErr: `exactly one of the fields "values" or "values_from" must be set`,
+		},
+		{
+			name: "for_each_no_steps",
+			in: `desc: 'mydesc'
+action: 'for_each'
+params:
+  iterator:
+    key: 'environment'
+    values: ['dev', 'prod']
+`,
+			wantValidateErr: `field "steps" is required`,
+		},
+		{
+			name: "for_each_values_wrong_type",
+			in: `desc: 'mydesc'
+action: 'for_each'
+params:
+  iterator:
+    key: 'environment'
+    values: 'prod'  # invalid, should be a list of string
+  steps:
+    - desc: 'print some stuff'
+      action: 'print'
+      params:
+        message: 'Hello, {{.name}}'
+`,
+			wantUnmarshalErr: `line 6: cannot unmarshal`,
+		},
+		{
+			name: "for_each_values_from_wrong_type",
+			in: `desc: 'mydesc'
+action: 'for_each'
+params:
+  iterator:
+    key: 'environment'
+    values_from: ['dev', 'prod'] # invalid, should be string
+  steps:
+    - desc: 'print some stuff'
+      action: 'print'
+      params:
+        message: 'Hello, {{.name}}'
+`,
+			wantUnmarshalErr: `line 6: cannot unmarshal`,
+		},
+		{
+			name: "print_with_if",
+			in: `desc: 'mydesc'
+action: 'print'
+if: '{{.myinput}}'
+params:
+  message: 'Hello'
+`,
+			want: &Step{
+				Desc:   mdl.S("mydesc"),
+				Action: mdl.S("print"),
+				If:     mdl.S("{{.myinput}}"),
+				Print: &Print{
+					Message: mdl.S("Hello"),
+				},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			got := &Step{}
+			dec := yaml.NewDecoder(strings.NewReader(tc.in))
+			err := dec.Decode(got)
+			if diff := testutil.DiffErrString(err, tc.wantUnmarshalErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			err = got.Validate()
+			if diff := testutil.DiffErrString(err, tc.wantValidateErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			opt := cmpopts.IgnoreTypes(&model.ConfigPos{}, model.ConfigPos{}) // don't force test authors to assert the line and column numbers
+			if diff := cmp.Diff(got, tc.want, opt); diff != "" {
+				t.Errorf("unmarshaling didn't yield expected struct. Diff (-got +want): %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"errors"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/model"
+)
+
+// Overlay represents the contents of a stack overlay file, which adapts a stack
+// to one environment (like dev or prod) by overriding vars and inputs and by
+// adding and removing members.
+type Overlay struct {
+	Pos model.ConfigPos `yaml:"-"`
+
+	// An optional description of the overlay, e.g. "production settings".
+	Desc model.String `yaml:"desc"`
+
+	// Vars to set, replacing any stack var with the same name.
+	Vars []*VarValue `yaml:"vars"`
+
+	// Changes to existing members, matched by name.
+	Members []*MemberPatch `yaml:"members"`
+
+	// Members to add after the stack's own members.
+	AddMembers []*Member `yaml:"add_members"`
+
+	// The names of members to leave out.
+	RemoveMembers []model.String `yaml:"remove_members"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (o *Overlay) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, o, &o.Pos, "api_version", "apiVersion", "kind") //nolint:wrapcheck
+}
+
+// Validate() implements model.Validator. Whether the overlay fits the stack
+// it's applied to can only be checked once it's applied.
+func (o *Overlay) Validate() error {
+	var removeErr error
+	for _, r := range o.RemoveMembers {
+		if r.Val == "" {
+			removeErr = errors.Join(removeErr, r.Pos.Errorf("remove_members must not contain empty names"))
+		}
+	}
+	return errors.Join(
+		model.ValidateEach(o.Vars),
+		model.ValidateEach(o.Members),
+		model.ValidateEach(o.AddMembers),
+		removeErr,
+	)
+}
+
+// MemberPatch changes some fields of an existing stack member. Fields that
+// are left empty keep the stack's value.
+type MemberPatch struct {
+	Pos model.ConfigPos `yaml:"-"`
+
+	// The name of the member to change.
+	Name model.String `yaml:"name"`
+
+	// If set, replaces the member's template location.
+	Source model.String `yaml:"source"`
+
+	// If set, replaces the member's dest directory.
+	Dest model.String `yaml:"dest"`
+
+	// Inputs to set, replacing any of the member's inputs with the same name.
+	Inputs []*VarValue `yaml:"inputs"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (m *MemberPatch) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, m, &m.Pos) //nolint:wrapcheck
+}
+
+// Validate() implements model.Validator.
+func (m *MemberPatch) Validate() error {
+	return errors.Join(
+		model.NotZeroModel(&m.Pos, m.Name, "name"),
+		model.ValidateEach(m.Inputs),
+	)
+}
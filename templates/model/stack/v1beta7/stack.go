@@ -0,0 +1,193 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package stack contains the model for stack files, which list a set of
+// templates that are rendered and upgraded together as a unit.
+package stack
+
+import (
+	"errors"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/model"
+)
+
+// memberNameRE restricts member names to identifiers, so that their outputs
+// can be referenced like {{.outputs.network.vpc_name}}.
+var memberNameRE = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// outputRefRE finds the member names in references like
+// {{.outputs.network.vpc_name}}.
+var outputRefRE = regexp.MustCompile(`\.outputs\.([A-Za-z][A-Za-z0-9_]*)`)
+
+// Stack represents the contents of a stack file (conventionally named
+// stack.yaml).
+type Stack struct {
+	Pos model.ConfigPos `yaml:"-"`
+
+	// An optional description of the stack as a whole.
+	Desc model.String `yaml:"desc"`
+
+	// Variables shared by all members, which member inputs can reference as
+	// {{.vars.name}}.
+	Vars []*VarValue `yaml:"vars"`
+
+	// The templates in the stack. They're rendered and upgraded in this
+	// order, so a member may only use the outputs of the members before it.
+	Members []*Member `yaml:"members"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (s *Stack) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, s, &s.Pos, "api_version", "apiVersion", "kind") //nolint:wrapcheck
+}
+
+// Validate() implements model.Validator.
+func (s *Stack) Validate() error {
+	return errors.Join(
+		model.ValidateEach(s.Vars),
+		s.validateVarNames(),
+		model.NonEmptySlice(&s.Pos, s.Members, "members"),
+		model.ValidateEach(s.Members),
+		s.validateMembersUnique(),
+		s.validateOutputRefs(),
+	)
+}
+
+// validateVarNames checks that no two vars have the same name.
+func (s *Stack) validateVarNames() error {
+	var merr error
+	seen := make(map[string]struct{}, len(s.Vars))
+	for _, v := range s.Vars {
+		if _, ok := seen[v.Name.Val]; ok {
+			merr = errors.Join(merr, v.Name.Pos.Errorf("duplicate var name %q", v.Name.Val))
+		}
+		seen[v.Name.Val] = struct{}{}
+	}
+	return merr
+}
+
+// validateMembersUnique checks that no two members have the same name or the
+// same destination directory. Each member gets its own directory so that its
+// manifest can be told apart from the others'.
+func (s *Stack) validateMembersUnique() error {
+	var merr error
+	names := make(map[string]struct{}, len(s.Members))
+	dests := make(map[string]struct{}, len(s.Members))
+	for _, m := range s.Members {
+		if _, ok := names[m.Name.Val]; ok {
+			merr = errors.Join(merr, m.Name.Pos.Errorf("duplicate member name %q", m.Name.Val))
+		}
+		names[m.Name.Val] = struct{}{}
+
+		dest := path.Clean(m.Dest.Val)
+		if _, ok := dests[dest]; ok {
+			merr = errors.Join(merr, m.Dest.Pos.Errorf("more than one member has the dest %q", m.Dest.Val))
+		}
+		dests[dest] = struct{}{}
+	}
+	return merr
+}
+
+// validateOutputRefs checks that member inputs only reference the outputs of
+// members listed before them, since members are rendered in order.
+func (s *Stack) validateOutputRefs() error {
+	var merr error
+	for i, m := range s.Members {
+		for _, in := range m.Inputs {
+			for _, match := range outputRefRE.FindAllStringSubmatch(in.Value.Val, -1) {
+				ref := match[1]
+				idx := slices.IndexFunc(s.Members, func(o *Member) bool { return o.Name.Val == ref })
+				switch {
+				case idx < 0:
+					merr = errors.Join(merr, in.Value.Pos.Errorf("input %q of member %q references the outputs of %q, which is not a member of this stack", in.Name.Val, m.Name.Val, ref))
+				case idx >= i:
+					merr = errors.Join(merr, in.Value.Pos.Errorf("input %q of member %q references the outputs of %q, which isn't rendered until later; members may only use the outputs of members listed before them", in.Name.Val, m.Name.Val, ref))
+				}
+			}
+		}
+	}
+	return merr
+}
+
+// Member is one template in a stack.
+type Member struct {
+	Pos model.ConfigPos `yaml:"-"`
+
+	// The name of the member, used to refer to its outputs from the inputs of
+	// later members.
+	Name model.String `yaml:"name"`
+
+	// The template location, in any of the forms accepted by "abc render".
+	// Relative local paths are relative to the directory containing the
+	// stack file.
+	Source model.String `yaml:"source"`
+
+	// The directory to render the template into, relative to the stack's
+	// destination directory.
+	Dest model.String `yaml:"dest"`
+
+	// The template inputs. Values may contain Go templates referencing
+	// {{.vars.x}} and {{.outputs.member_name.output_name}}.
+	Inputs []*VarValue `yaml:"inputs"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (m *Member) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, m, &m.Pos) //nolint:wrapcheck
+}
+
+// Validate() implements model.Validator.
+func (m *Member) Validate() error {
+	var nameErr error
+	if m.Name.Val != "" && !memberNameRE.MatchString(m.Name.Val) {
+		nameErr = m.Name.Pos.Errorf("member name %q must start with a letter and contain only letters, digits, and underscores", m.Name.Val)
+	}
+	var destErr error
+	if m.Dest.Val != "" && (path.IsAbs(m.Dest.Val) || strings.HasPrefix(m.Dest.Val, `\`) ||
+		path.Clean(m.Dest.Val) == ".." || strings.HasPrefix(path.Clean(m.Dest.Val), "../")) {
+		destErr = m.Dest.Pos.Errorf("member dest %q must be a relative path inside the stack's destination directory", m.Dest.Val)
+	}
+	return errors.Join(
+		model.NotZeroModel(&m.Pos, m.Name, "name"),
+		nameErr,
+		model.NotZeroModel(&m.Pos, m.Source, "source"),
+		model.NotZeroModel(&m.Pos, m.Dest, "dest"),
+		destErr,
+		model.ValidateEach(m.Inputs),
+	)
+}
+
+// VarValue is a name and a value, used both for stack vars and member inputs.
+type VarValue struct {
+	Pos model.ConfigPos `yaml:"-"`
+
+	Name  model.String `yaml:"name"`
+	Value model.String `yaml:"value"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (v *VarValue) UnmarshalYAML(n *yaml.Node) error {
+	return model.UnmarshalPlain(n, v, &v.Pos) //nolint:wrapcheck
+}
+
+// Validate() implements model.Validator.
+func (v *VarValue) Validate() error {
+	return model.NotZeroModel(&v.Pos, v.Name, "name") //nolint:wrapcheck
+}
@@ -0,0 +1,336 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"gopkg.in/yaml.v3"
+
+	"github.com/abcxyz/abc/templates/model"
+	mdl "github.com/abcxyz/abc/templates/testutil/model"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestDecode(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name             string
+		in               string
+		want             *Stack
+		wantUnmarshalErr string
+		wantValidateErr  string
+	}{
+		{
+			name: "simple_success",
+			in: `
+api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'Stack'
+desc: 'A service and its network'
+vars:
+  - name: 'project_id'
+    value: 'my-project'
+members:
+  - name: 'network'
+    source: 'github.com/example/templates/network@v1.0.0'
+    dest: 'infra/network'
+    inputs:
+      - name: 'project_id'
+        value: '{{.vars.project_id}}'
+  - name: 'service'
+    source: './service'
+    dest: 'services/api'
+    inputs:
+      - name: 'vpc'
+        value: '{{.outputs.network.vpc_name}}'
+`,
+			want: &Stack{
+				Desc: mdl.S("A service and its network"),
+				Vars: []*VarValue{
+					{Name: mdl.S("project_id"), Value: mdl.S("my-project")},
+				},
+				Members: []*Member{
+					{
+						Name:   mdl.S("network"),
+						Source: mdl.S("github.com/example/templates/network@v1.0.0"),
+						Dest:   mdl.S("infra/network"),
+						Inputs: []*VarValue{
+							{Name: mdl.S("project_id"), Value: mdl.S("{{.vars.project_id}}")},
+						},
+					},
+					{
+						Name:   mdl.S("service"),
+						Source: mdl.S("./service"),
+						Dest:   mdl.S("services/api"),
+						Inputs: []*VarValue{
+							{Name: mdl.S("vpc"), Value: mdl.S("{{.outputs.network.vpc_name}}")},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:            "no_members",
+			in:              `desc: 'nothing'`,
+			wantValidateErr: `field "members" is required`,
+		},
+		{
+			name: "missing_fields",
+			in: `
+members:
+  - name: 'network'
+`,
+			wantValidateErr: `"source" is required`,
+		},
+		{
+			name: "bad_member_name",
+			in: `
+members:
+  - name: 'my-network'
+    source: './network'
+    dest: 'network'
+`,
+			wantValidateErr: `member name "my-network" must start with a letter`,
+		},
+		{
+			name: "dest_outside",
+			in: `
+members:
+  - name: 'network'
+    source: './network'
+    dest: '../network'
+`,
+			wantValidateErr: `member dest "../network" must be a relative path inside`,
+		},
+		{
+			name: "duplicate_member",
+			in: `
+members:
+  - name: 'network'
+    source: './network'
+    dest: 'a'
+  - name: 'network'
+    source: './network'
+    dest: 'b'
+`,
+			wantValidateErr: `duplicate member name "network"`,
+		},
+		{
+			name: "duplicate_dest",
+			in: `
+members:
+  - name: 'network'
+    source: './network'
+    dest: 'infra'
+  - name: 'service'
+    source: './service'
+    dest: 'infra/'
+`,
+			wantValidateErr: `more than one member has the dest "infra/"`,
+		},
+		{
+			name: "duplicate_var",
+			in: `
+vars:
+  - name: 'x'
+    value: '1'
+  - name: 'x'
+    value: '2'
+members:
+  - name: 'network'
+    source: './network'
+    dest: 'network'
+`,
+			wantValidateErr: `duplicate var name "x"`,
+		},
+		{
+			name: "output_of_later_member",
+			in: `
+members:
+  - name: 'service'
+    source: './service'
+    dest: 'service'
+    inputs:
+      - name: 'vpc'
+        value: '{{.outputs.network.vpc_name}}'
+  - name: 'network'
+    source: './network'
+    dest: 'network'
+`,
+			wantValidateErr: `input "vpc" of member "service" references the outputs of "network", which isn't rendered until later`,
+		},
+		{
+			name: "output_of_nonexistent_member",
+			in: `
+members:
+  - name: 'service'
+    source: './service'
+    dest: 'service'
+    inputs:
+      - name: 'vpc'
+        value: '{{.outputs.nope.vpc_name}}'
+`,
+			wantValidateErr: `references the outputs of "nope", which is not a member of this stack`,
+		},
+		{
+			name:             "unknown_field",
+			in:               `nonexistent_field: 'foo'`,
+			wantUnmarshalErr: `unknown field name "nonexistent_field"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := &Stack{}
+			dec := yaml.NewDecoder(strings.NewReader(tc.in))
+			err := dec.Decode(got)
+			if diff := testutil.DiffErrString(err, tc.wantUnmarshalErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			err = got.Validate()
+			if diff := testutil.DiffErrString(err, tc.wantValidateErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			opt := cmpopts.IgnoreTypes(&model.ConfigPos{}, model.ConfigPos{}) // don't force test authors to assert the line and column numbers
+			if diff := cmp.Diff(got, tc.want, opt); diff != "" {
+				t.Errorf("unmarshaling didn't yield expected struct. Diff (-got +want): %s", diff)
+			}
+		})
+	}
+}
+
+func TestDecodeOverlay(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name             string
+		in               string
+		want             *Overlay
+		wantUnmarshalErr string
+		wantValidateErr  string
+	}{
+		{
+			name: "simple_success",
+			in: `
+api_version: 'cli.abcxyz.dev/v1beta7'
+kind: 'StackOverlay'
+desc: 'production settings'
+vars:
+  - name: 'project_id'
+    value: 'prod-project'
+members:
+  - name: 'service'
+    inputs:
+      - name: 'replicas'
+        value: '3'
+add_members:
+  - name: 'monitoring'
+    source: './monitoring'
+    dest: 'monitoring'
+remove_members: ['debug_tools']
+`,
+			want: &Overlay{
+				Desc: mdl.S("production settings"),
+				Vars: []*VarValue{
+					{Name: mdl.S("project_id"), Value: mdl.S("prod-project")},
+				},
+				Members: []*MemberPatch{
+					{
+						Name: mdl.S("service"),
+						Inputs: []*VarValue{
+							{Name: mdl.S("replicas"), Value: mdl.S("3")},
+						},
+					},
+				},
+				AddMembers: []*Member{
+					{
+						Name:   mdl.S("monitoring"),
+						Source: mdl.S("./monitoring"),
+						Dest:   mdl.S("monitoring"),
+					},
+				},
+				RemoveMembers: []model.String{mdl.S("debug_tools")},
+			},
+		},
+		{
+			name: "patch_without_name",
+			in: `
+members:
+  - source: './other'
+`,
+			wantValidateErr: `field "name" is required`,
+		},
+		{
+			name: "invalid_added_member",
+			in: `
+add_members:
+  - name: 'monitoring'
+`,
+			wantValidateErr: `"source" is required`,
+		},
+		{
+			name:            "empty_removal",
+			in:              `remove_members: ['']`,
+			wantValidateErr: `remove_members must not contain empty names`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := &Overlay{}
+			dec := yaml.NewDecoder(strings.NewReader(tc.in))
+			err := dec.Decode(got)
+			if diff := testutil.DiffErrString(err, tc.wantUnmarshalErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			err = got.Validate()
+			if diff := testutil.DiffErrString(err, tc.wantValidateErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			opt := cmpopts.IgnoreTypes(&model.ConfigPos{}, model.ConfigPos{}) // don't force test authors to assert the line and column numbers
+			if diff := cmp.Diff(got, tc.want, opt); diff != "" {
+				t.Errorf("unmarshaling didn't yield expected struct. Diff (-got +want): %s", diff)
+			}
+		})
+	}
+}